@@ -0,0 +1,90 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+// Clone flags that are not defined by package syscall. The other CLONE_*
+// flags may be found there.
+const (
+	// CLONE_PIDFD requests a PID file descriptor for the child.
+	CLONE_PIDFD = 0x1000
+
+	// CLONE_CLEAR_SIGHAND resets all signal handlers of the child that are
+	// not ignored to the default. It is only accepted by clone3(2).
+	CLONE_CLEAR_SIGHAND = 0x100000000
+
+	// CLONE_INTO_CGROUP places the child in the cgroup referred to by
+	// CloneArgs.Cgroup. It is only accepted by clone3(2).
+	CLONE_INTO_CGROUP = 0x200000000
+)
+
+// Sizes of versions of CloneArgs. clone3(2) accepts any of these sizes, and
+// larger sizes as long as the bytes beyond CloneArgs are zero.
+const (
+	// CLONE_ARGS_SIZE_VER0 is the size of the first published CloneArgs.
+	CLONE_ARGS_SIZE_VER0 = 64
+
+	// CLONE_ARGS_SIZE_VER1 adds CloneArgs.SetTID and CloneArgs.SetTIDSize.
+	CLONE_ARGS_SIZE_VER1 = 80
+
+	// CLONE_ARGS_SIZE_VER2 adds CloneArgs.Cgroup.
+	CLONE_ARGS_SIZE_VER2 = 88
+)
+
+// MAX_PID_NS_LEVEL is the maximum nesting depth of PID namespaces, and so the
+// maximum number of entries in CloneArgs.SetTID.
+const MAX_PID_NS_LEVEL = 32
+
+// CloneArgs is the argument to clone3(2), struct clone_args in
+// include/uapi/linux/sched.h.
+type CloneArgs struct {
+	// Flags is a set of CLONE_* flags. Unlike clone(2), the exit signal is
+	// not part of Flags.
+	Flags uint64
+
+	// Pidfd is the address at which to store the PID file descriptor if
+	// CLONE_PIDFD is set.
+	Pidfd uint64
+
+	// ChildTID is the address at which to store the child's thread ID if
+	// CLONE_CHILD_SETTID or CLONE_CHILD_CLEARTID is set.
+	ChildTID uint64
+
+	// ParentTID is the address at which to store the child's thread ID if
+	// CLONE_PARENT_SETTID is set.
+	ParentTID uint64
+
+	// ExitSignal is the signal sent to the parent when the child exits.
+	ExitSignal uint64
+
+	// Stack is the lowest address of the child's stack.
+	Stack uint64
+
+	// StackSize is the size of the child's stack.
+	StackSize uint64
+
+	// TLS is the child's thread pointer if CLONE_SETTLS is set.
+	TLS uint64
+
+	// SetTID is the address of an array of SetTIDSize thread IDs that the
+	// child must have, starting with its innermost PID namespace.
+	SetTID uint64
+
+	// SetTIDSize is the number of elements in the SetTID array.
+	SetTIDSize uint64
+
+	// Cgroup is a file descriptor for the child's cgroup if
+	// CLONE_INTO_CGROUP is set.
+	Cgroup uint64
+}
@@ -89,3 +89,68 @@ const (
 	// AT_SYSINFO_EHDR is the address of the VDSO.
 	AT_SYSINFO_EHDR = 33
 )
+
+// ELF note types in core dumps.
+const (
+	// NT_PRSTATUS is the status of a thread, an ElfPrstatus.
+	NT_PRSTATUS = 1
+
+	// NT_PRFPREG are the floating point registers of a thread, in the
+	// format of PTRACE_GETFPREGS.
+	NT_PRFPREG = 2
+
+	// NT_PRPSINFO is information about the process, an ElfPrpsinfo.
+	NT_PRPSINFO = 3
+
+	// NT_AUXV is the auxiliary vector of the process.
+	NT_AUXV = 6
+)
+
+// ElfSiginfo is equivalent to struct elf_siginfo.
+type ElfSiginfo struct {
+	Signo int32
+	Code  int32
+	Errno int32
+}
+
+// ElfPrstatus is equivalent to struct elf_prstatus on amd64.
+type ElfPrstatus struct {
+	Info    ElfSiginfo
+	Cursig  int16
+	_       [2]byte
+	Sigpend uint64
+	Sighold uint64
+	Pid     int32
+	Ppid    int32
+	Pgrp    int32
+	Sid     int32
+	Utime   Timeval
+	Stime   Timeval
+	Cutime  Timeval
+	Cstime  Timeval
+
+	// Regs are the general purpose registers of the thread, in the format
+	// of PTRACE_GETREGS.
+	Regs [27]uint64
+
+	Fpvalid int32
+	_       [4]byte
+}
+
+// ElfPrpsinfo is equivalent to struct elf_prpsinfo on amd64.
+type ElfPrpsinfo struct {
+	State  int8
+	Sname  byte
+	Zomb   int8
+	Nice   int8
+	_      [4]byte
+	Flag   uint64
+	UID    uint32
+	GID    uint32
+	Pid    int32
+	Ppid   int32
+	Pgrp   int32
+	Sid    int32
+	Fname  [16]byte
+	Psargs [80]byte
+}
@@ -28,11 +28,116 @@ const (
 	O_PATH     = 010000000
 )
 
+// Constants for close_range(2).
+const (
+	// CLOSE_RANGE_UNSHARE unshares the file descriptor table before
+	// closing the range.
+	CLOSE_RANGE_UNSHARE = 1 << 1
+
+	// CLOSE_RANGE_CLOEXEC sets close-on-exec on the range instead of
+	// closing it.
+	CLOSE_RANGE_CLOEXEC = 1 << 2
+)
+
+// Constants for openat2(2).
+const (
+	// RESOLVE_NO_XDEV forbids crossing mount points.
+	RESOLVE_NO_XDEV = 0x01
+
+	// RESOLVE_NO_MAGICLINKS forbids following links that are not resolved
+	// by reading their target, such as /proc/[pid]/fd/[fd].
+	RESOLVE_NO_MAGICLINKS = 0x02
+
+	// RESOLVE_NO_SYMLINKS forbids following any symlink.
+	RESOLVE_NO_SYMLINKS = 0x04
+
+	// RESOLVE_BENEATH forbids resolving to anything outside of the starting
+	// directory.
+	RESOLVE_BENEATH = 0x08
+
+	// RESOLVE_IN_ROOT resolves the path as if the starting directory was the
+	// root directory.
+	RESOLVE_IN_ROOT = 0x10
+
+	// RESOLVE_CACHED fails with EAGAIN unless the path can be resolved
+	// entirely from cached dentries.
+	RESOLVE_CACHED = 0x20
+
+	// OPEN_HOW_SIZE_VER0 is the size of the first published OpenHow.
+	OPEN_HOW_SIZE_VER0 = 24
+)
+
+// OpenHow is the argument to openat2(2), struct open_how in
+// include/uapi/linux/openat2.h.
+type OpenHow struct {
+	// Flags are the O_* flags, as for openat(2).
+	Flags uint64
+
+	// Mode is the mode of a file created by O_CREAT or O_TMPFILE. It must
+	// be zero otherwise.
+	Mode uint64
+
+	// Resolve is a set of RESOLVE_* flags.
+	Resolve uint64
+}
+
 // Constants for fstatat(2).
 const (
 	AT_SYMLINK_NOFOLLOW = 0x100
 )
 
+// Constants for statx(2) flags.
+const (
+	AT_NO_AUTOMOUNT = 0x800
+
+	// AT_STATX_SYNC_TYPE is the mask of the sync type.
+	AT_STATX_SYNC_TYPE = 0x6000
+
+	// AT_STATX_SYNC_AS_STAT does whatever stat(2) does.
+	AT_STATX_SYNC_AS_STAT = 0x0000
+
+	// AT_STATX_FORCE_SYNC forces the attributes to be synced with the
+	// backing filesystem.
+	AT_STATX_FORCE_SYNC = 0x2000
+
+	// AT_STATX_DONT_SYNC allows attributes to be returned from cache.
+	AT_STATX_DONT_SYNC = 0x4000
+)
+
+// Constants for statx(2) masks, which tell which fields of Statx are
+// requested and filled.
+const (
+	STATX_TYPE        = 0x00000001
+	STATX_MODE        = 0x00000002
+	STATX_NLINK       = 0x00000004
+	STATX_UID         = 0x00000008
+	STATX_GID         = 0x00000010
+	STATX_ATIME       = 0x00000020
+	STATX_MTIME       = 0x00000040
+	STATX_CTIME       = 0x00000080
+	STATX_INO         = 0x00000100
+	STATX_SIZE        = 0x00000200
+	STATX_BLOCKS      = 0x00000400
+	STATX_BASIC_STATS = 0x000007ff
+	STATX_BTIME       = 0x00000800
+	STATX_ALL         = 0x00000fff
+	STATX_MNT_ID      = 0x00001000
+	STATX__RESERVED   = 0x80000000
+)
+
+// Constants for statx(2) attributes.
+const (
+	STATX_ATTR_COMPRESSED = 0x00000004
+	STATX_ATTR_IMMUTABLE  = 0x00000010
+	STATX_ATTR_APPEND     = 0x00000020
+	STATX_ATTR_NODUMP     = 0x00000040
+	STATX_ATTR_ENCRYPTED  = 0x00000800
+	STATX_ATTR_AUTOMOUNT  = 0x00001000
+	STATX_ATTR_MOUNT_ROOT = 0x00002000
+	STATX_ATTR_VERITY     = 0x00100000
+	STATX_ATTR_DAX        = 0x00200000
+)
+
 // Constants for mount(2).
 const (
 	MS_RDONLY      = 0x1
@@ -154,6 +259,48 @@ type Stat struct {
 	X_unused [3]int64
 }
 
+// StatxTimestamp represents struct statx_timestamp.
+type StatxTimestamp struct {
+	Sec        int64
+	Nsec       uint32
+	X_reserved int32
+}
+
+// NsecToStatxTimestamp translates nanoseconds to StatxTimestamp.
+func NsecToStatxTimestamp(nsec int64) StatxTimestamp {
+	ts := NsecToTimespec(nsec)
+	return StatxTimestamp{Sec: ts.Sec, Nsec: uint32(ts.Nsec)}
+}
+
+// Statx represents struct statx.
+type Statx struct {
+	Mask           uint32
+	Blksize        uint32
+	Attributes     uint64
+	Nlink          uint32
+	UID            uint32
+	GID            uint32
+	Mode           uint16
+	X_spare0       uint16
+	Ino            uint64
+	Size           uint64
+	Blocks         uint64
+	AttributesMask uint64
+	Atime          StatxTimestamp
+	Btime          StatxTimestamp
+	Ctime          StatxTimestamp
+	Mtime          StatxTimestamp
+	RdevMajor      uint32
+	RdevMinor      uint32
+	DevMajor       uint32
+	DevMinor       uint32
+	MntID          uint64
+	X_spare2       [13]uint64
+}
+
+// SizeOfStatx is the size of a Statx struct.
+const SizeOfStatx = 256
+
 // FileMode represents a mode_t.
 type FileMode uint
 
@@ -0,0 +1,221 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+// Flags for io_uring_setup(2), from include/uapi/linux/io_uring.h.
+const (
+	IORING_SETUP_IOPOLL    = 1 << 0
+	IORING_SETUP_SQPOLL    = 1 << 1
+	IORING_SETUP_SQ_AFF    = 1 << 2
+	IORING_SETUP_CQSIZE    = 1 << 3
+	IORING_SETUP_CLAMP     = 1 << 4
+	IORING_SETUP_ATTACH_WQ = 1 << 5
+)
+
+// Features reported in IOUringParams.Features.
+const (
+	IORING_FEAT_SINGLE_MMAP   = 1 << 0
+	IORING_FEAT_NODROP        = 1 << 1
+	IORING_FEAT_SUBMIT_STABLE = 1 << 2
+	IORING_FEAT_RW_CUR_POS    = 1 << 3
+)
+
+// Flags for io_uring_enter(2).
+const (
+	IORING_ENTER_GETEVENTS = 1 << 0
+	IORING_ENTER_SQ_WAKEUP = 1 << 1
+)
+
+// Opcodes for io_uring_register(2).
+const (
+	IORING_REGISTER_BUFFERS       = 0
+	IORING_UNREGISTER_BUFFERS     = 1
+	IORING_REGISTER_FILES         = 2
+	IORING_UNREGISTER_FILES       = 3
+	IORING_REGISTER_EVENTFD       = 4
+	IORING_UNREGISTER_EVENTFD     = 5
+	IORING_REGISTER_FILES_UPDATE  = 6
+	IORING_REGISTER_EVENTFD_ASYNC = 7
+	IORING_REGISTER_PROBE         = 8
+	IORING_REGISTER_PERSONALITY   = 9
+	IORING_UNREGISTER_PERSONALITY = 10
+)
+
+// Magic mmap offsets of the io_uring regions.
+const (
+	IORING_OFF_SQ_RING = 0
+	IORING_OFF_CQ_RING = 0x8000000
+	IORING_OFF_SQES    = 0x10000000
+)
+
+// Submission queue entry opcodes.
+const (
+	IORING_OP_NOP             = 0
+	IORING_OP_READV           = 1
+	IORING_OP_WRITEV          = 2
+	IORING_OP_FSYNC           = 3
+	IORING_OP_READ_FIXED      = 4
+	IORING_OP_WRITE_FIXED     = 5
+	IORING_OP_POLL_ADD        = 6
+	IORING_OP_POLL_REMOVE     = 7
+	IORING_OP_SYNC_FILE_RANGE = 8
+	IORING_OP_SENDMSG         = 9
+	IORING_OP_RECVMSG         = 10
+	IORING_OP_TIMEOUT         = 11
+	IORING_OP_TIMEOUT_REMOVE  = 12
+	IORING_OP_ACCEPT          = 13
+	IORING_OP_ASYNC_CANCEL    = 14
+	IORING_OP_LINK_TIMEOUT    = 15
+	IORING_OP_CONNECT         = 16
+	IORING_OP_FALLOCATE       = 17
+	IORING_OP_OPENAT          = 18
+	IORING_OP_CLOSE           = 19
+	IORING_OP_FILES_UPDATE    = 20
+	IORING_OP_STATX           = 21
+	IORING_OP_READ            = 22
+	IORING_OP_WRITE           = 23
+
+	// IORING_OP_LAST is one past the last opcode above.
+	IORING_OP_LAST = 24
+)
+
+// Flags in IOUringSqe.Flags.
+const (
+	IOSQE_FIXED_FILE  = 1 << 0
+	IOSQE_IO_DRAIN    = 1 << 1
+	IOSQE_IO_LINK     = 1 << 2
+	IOSQE_IO_HARDLINK = 1 << 3
+	IOSQE_ASYNC       = 1 << 4
+)
+
+// IORING_FSYNC_DATASYNC is the only flag accepted by IORING_OP_FSYNC.
+const IORING_FSYNC_DATASYNC = 1 << 0
+
+// IORING_SQ_NEED_WAKEUP is set in the SQ ring flags when an SQPOLL thread
+// must be woken with IORING_ENTER_SQ_WAKEUP.
+const IORING_SQ_NEED_WAKEUP = 1 << 0
+
+// IO_URING_OP_SUPPORTED is set in IOUringProbeOp.Flags for opcodes that are
+// implemented.
+const IO_URING_OP_SUPPORTED = 1 << 0
+
+// IORING_MAX_ENTRIES is the maximum number of submission queue entries.
+const IORING_MAX_ENTRIES = 32768
+
+// IORING_MAX_CQ_ENTRIES is the maximum number of completion queue entries.
+const IORING_MAX_CQ_ENTRIES = 2 * IORING_MAX_ENTRIES
+
+// IORING_MAX_FIXED_FILES is the maximum number of registered files.
+const IORING_MAX_FIXED_FILES = 1024
+
+// IOSqringOffsets represents struct io_sqring_offsets.
+type IOSqringOffsets struct {
+	Head        uint32
+	Tail        uint32
+	RingMask    uint32
+	RingEntries uint32
+	Flags       uint32
+	Dropped     uint32
+	Array       uint32
+	_           uint32
+	_           uint64
+}
+
+// IOCqringOffsets represents struct io_cqring_offsets.
+type IOCqringOffsets struct {
+	Head        uint32
+	Tail        uint32
+	RingMask    uint32
+	RingEntries uint32
+	Overflow    uint32
+	Cqes        uint32
+	Flags       uint32
+	_           uint32
+	_           uint64
+}
+
+// SizeOfIOUringParams is the size of an IOUringParams struct in bytes.
+const SizeOfIOUringParams = 120
+
+// IOUringParams represents struct io_uring_params, passed to
+// io_uring_setup(2).
+type IOUringParams struct {
+	SqEntries    uint32
+	CqEntries    uint32
+	Flags        uint32
+	SqThreadCPU  uint32
+	SqThreadIdle uint32
+	Features     uint32
+	WqFD         uint32
+	Resv         [3]uint32
+	SqOff        IOSqringOffsets
+	CqOff        IOCqringOffsets
+}
+
+// SizeOfIOUringSqe is the size of an IOUringSqe struct in bytes.
+const SizeOfIOUringSqe = 64
+
+// IOUringSqe represents struct io_uring_sqe, a submission queue entry.
+//
+// OpFlags holds the per-opcode union (rw_flags, fsync_flags, poll_events,
+// ...).
+type IOUringSqe struct {
+	Opcode      uint8
+	Flags       uint8
+	IOPrio      uint16
+	FD          int32
+	Off         uint64
+	Addr        uint64
+	Len         uint32
+	OpFlags     uint32
+	UserData    uint64
+	BufIndex    uint16
+	Personality uint16
+	_           int32
+	_           [2]uint64
+}
+
+// SizeOfIOUringCqe is the size of an IOUringCqe struct in bytes.
+const SizeOfIOUringCqe = 16
+
+// IOUringCqe represents struct io_uring_cqe, a completion queue entry.
+type IOUringCqe struct {
+	UserData uint64
+	Res      int32
+	Flags    uint32
+}
+
+// SizeOfIOUringProbe is the size of an IOUringProbe struct in bytes.
+const SizeOfIOUringProbe = 16
+
+// IOUringProbe represents the header of struct io_uring_probe. It is
+// followed by OpsLen IOUringProbeOp entries.
+type IOUringProbe struct {
+	LastOp uint8
+	OpsLen uint8
+	_      uint16
+	_      [3]uint32
+}
+
+// SizeOfIOUringProbeOp is the size of an IOUringProbeOp struct in bytes.
+const SizeOfIOUringProbeOp = 8
+
+// IOUringProbeOp represents struct io_uring_probe_op.
+type IOUringProbeOp struct {
+	Op    uint8
+	_     uint8
+	Flags uint16
+	_     uint32
+}
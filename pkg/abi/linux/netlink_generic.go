@@ -0,0 +1,70 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+// GenericNetlinkHeader is struct genlmsghdr, from uapi/linux/genetlink.h. It
+// follows the NetlinkMessageHeader of NETLINK_GENERIC messages, whose type is
+// the ID of the family the message is addressed to.
+type GenericNetlinkHeader struct {
+	Command  uint8
+	Version  uint8
+	Reserved uint16
+}
+
+// GenericNetlinkHeaderSize is the size of GenericNetlinkHeader.
+const GenericNetlinkHeaderSize = 4
+
+// GENL_NAMSIZ is the maximum length of a generic netlink family name,
+// including the NUL terminator, from uapi/linux/genetlink.h.
+const GENL_NAMSIZ = 16
+
+// Reserved generic netlink family IDs, from uapi/linux/genetlink.h.
+const (
+	GENL_ID_CTRL      = NLMSG_MIN_TYPE
+	GENL_ID_VFS_DQUOT = NLMSG_MIN_TYPE + 1
+	GENL_ID_PMCRAID   = NLMSG_MIN_TYPE + 2
+
+	// GENL_START_ALLOC is the first ID allocated to other families. See
+	// net/netlink/genetlink.c.
+	GENL_START_ALLOC = NLMSG_MIN_TYPE + 3
+)
+
+// Commands of the generic netlink controller family, from
+// uapi/linux/genetlink.h.
+const (
+	CTRL_CMD_UNSPEC       = 0
+	CTRL_CMD_NEWFAMILY    = 1
+	CTRL_CMD_DELFAMILY    = 2
+	CTRL_CMD_GETFAMILY    = 3
+	CTRL_CMD_NEWOPS       = 4
+	CTRL_CMD_DELOPS       = 5
+	CTRL_CMD_GETOPS       = 6
+	CTRL_CMD_NEWMCAST_GRP = 7
+	CTRL_CMD_DELMCAST_GRP = 8
+	CTRL_CMD_GETMCAST_GRP = 9
+)
+
+// Attributes of the generic netlink controller family, from
+// uapi/linux/genetlink.h.
+const (
+	CTRL_ATTR_UNSPEC       = 0
+	CTRL_ATTR_FAMILY_ID    = 1
+	CTRL_ATTR_FAMILY_NAME  = 2
+	CTRL_ATTR_VERSION      = 3
+	CTRL_ATTR_HDRSIZE      = 4
+	CTRL_ATTR_MAXATTR      = 5
+	CTRL_ATTR_OPS          = 6
+	CTRL_ATTR_MCAST_GROUPS = 7
+)
@@ -184,3 +184,85 @@ const (
 	IFA_MULTICAST = 7
 	IFA_FLAGS     = 8
 )
+
+// TrafficControlMessage is struct tcmsg, from uapi/linux/rtnetlink.h.
+type TrafficControlMessage struct {
+	Family   uint8
+	Padding1 uint8
+	Padding2 uint16
+	Index    int32
+	Handle   uint32
+	Parent   uint32
+	Info     uint32
+}
+
+// TrafficControlMessageSize is the size of TrafficControlMessage.
+const TrafficControlMessageSize = 20
+
+// Traffic control attributes, from uapi/linux/rtnetlink.h.
+const (
+	TCA_UNSPEC  = 0
+	TCA_KIND    = 1
+	TCA_OPTIONS = 2
+	TCA_STATS   = 3
+	TCA_XSTATS  = 4
+	TCA_RATE    = 5
+	TCA_FCNT    = 6
+	TCA_STATS2  = 7
+	TCA_STAB    = 8
+)
+
+// Traffic control handles, from uapi/linux/pkt_sched.h.
+const (
+	TC_H_MAJ_MASK = 0xffff0000
+	TC_H_MIN_MASK = 0x0000ffff
+	TC_H_UNSPEC   = 0
+	TC_H_ROOT     = 0xffffffff
+	TC_H_INGRESS  = 0xfffffff1
+)
+
+// TrafficControlRateSpec is struct tc_ratespec, from uapi/linux/pkt_sched.h.
+type TrafficControlRateSpec struct {
+	CellLog   uint8
+	LinkLayer uint8
+	Overhead  uint16
+	CellAlign int16
+	MPU       uint16
+	Rate      uint32
+}
+
+// TBFQueueOptions is struct tc_tbf_qopt, from uapi/linux/pkt_sched.h.
+type TBFQueueOptions struct {
+	Rate     TrafficControlRateSpec
+	PeakRate TrafficControlRateSpec
+	Limit    uint32
+	Buffer   uint32
+	MTU      uint32
+}
+
+// TBF qdisc attributes, from uapi/linux/pkt_sched.h.
+const (
+	TCA_TBF_UNSPEC  = 0
+	TCA_TBF_PARMS   = 1
+	TCA_TBF_RTAB    = 2
+	TCA_TBF_PTAB    = 3
+	TCA_TBF_RATE64  = 4
+	TCA_TBF_PRATE64 = 5
+	TCA_TBF_BURST   = 6
+	TCA_TBF_PBURST  = 7
+	TCA_TBF_PAD     = 8
+)
+
+// FQ_CoDel qdisc attributes, from uapi/linux/pkt_sched.h.
+const (
+	TCA_FQ_CODEL_UNSPEC          = 0
+	TCA_FQ_CODEL_TARGET          = 1
+	TCA_FQ_CODEL_LIMIT           = 2
+	TCA_FQ_CODEL_INTERVAL        = 3
+	TCA_FQ_CODEL_ECN             = 4
+	TCA_FQ_CODEL_FLOWS           = 5
+	TCA_FQ_CODEL_QUANTUM         = 6
+	TCA_FQ_CODEL_CE_THRESHOLD    = 7
+	TCA_FQ_CODEL_DROP_BATCH_SIZE = 8
+	TCA_FQ_CODEL_MEMORY_LIMIT    = 9
+)
@@ -22,6 +22,12 @@ const (
 	// PR_GET_PDEATHSIG will get the process' death signal.
 	PR_GET_PDEATHSIG = 2
 
+	// PR_GET_DUMPABLE will get the process's dumpable flag.
+	PR_GET_DUMPABLE = 3
+
+	// PR_SET_DUMPABLE will set the process's dumpable flag.
+	PR_SET_DUMPABLE = 4
+
 	// PR_GET_KEEPCAPS will get the value of the keep capabilities flag.
 	PR_GET_KEEPCAPS = 7
 
@@ -62,6 +68,14 @@ const (
 	PR_CAPBSET_DROP = 24
 )
 
+// From <linux/sched/coredump.h>, values of the dumpable flag of
+// PR_GET_DUMPABLE and PR_SET_DUMPABLE.
+const (
+	SUID_DUMP_DISABLE = 0
+	SUID_DUMP_USER    = 1
+	SUID_DUMP_ROOT    = 2
+)
+
 // From <asm/prctl.h>
 // Flags are used in syscall arch_prctl(2).
 const (
@@ -0,0 +1,110 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+// Flags for rseq(2).
+const (
+	// RSEQ_FLAG_UNREGISTER unregisters the current thread.
+	RSEQ_FLAG_UNREGISTER = 1 << 0
+)
+
+// Critical section flags used in RSeqCriticalSection.Flags and RSeq.Flags.
+// These flags are deprecated; Linux rejects critical sections that use them.
+const (
+	// RSEQ_CS_FLAG_NO_RESTART_ON_PREEMPT inhibits instruction pointer
+	// modification if preempted in this critical section.
+	RSEQ_CS_FLAG_NO_RESTART_ON_PREEMPT = 1 << 0
+
+	// RSEQ_CS_FLAG_NO_RESTART_ON_SIGNAL inhibits instruction pointer
+	// modification if a signal is delivered in this critical section.
+	RSEQ_CS_FLAG_NO_RESTART_ON_SIGNAL = 1 << 1
+
+	// RSEQ_CS_FLAG_NO_RESTART_ON_MIGRATE inhibits instruction pointer
+	// modification if migrated to a different CPU in this critical section.
+	RSEQ_CS_FLAG_NO_RESTART_ON_MIGRATE = 1 << 2
+
+	// RSEQ_CS_FLAG_NO_RESTART_MASK is the set of all deprecated flags.
+	RSEQ_CS_FLAG_NO_RESTART_MASK = RSEQ_CS_FLAG_NO_RESTART_ON_PREEMPT | RSEQ_CS_FLAG_NO_RESTART_ON_SIGNAL | RSEQ_CS_FLAG_NO_RESTART_ON_MIGRATE
+)
+
+// Special values of RSeq.CPUID.
+const (
+	// RSEQ_CPU_ID_UNINITIALIZED indicates that the thread has not
+	// registered an RSeq.
+	RSEQ_CPU_ID_UNINITIALIZED = -1
+
+	// RSEQ_CPU_ID_REGISTRATION_FAILED indicates that registration failed.
+	// It is written by userspace, never by the kernel.
+	RSEQ_CPU_ID_REGISTRATION_FAILED = -2
+)
+
+// RSeq is the per-thread restartable sequence area registered by rseq(2),
+// struct rseq in include/uapi/linux/rseq.h.
+type RSeq struct {
+	// CPUIDStart is the current CPU number, or 0 if the thread is not
+	// registered.
+	CPUIDStart uint32
+
+	// CPUID is the current CPU number, or one of the special values
+	// RSEQ_CPU_ID_*.
+	CPUID uint32
+
+	// RSeqCriticalSection is a pointer to the current RSeqCriticalSection
+	// descriptor, or 0 if the thread is not in a critical section.
+	RSeqCriticalSection uint64
+
+	// Flags is a set of deprecated RSEQ_CS_FLAG_* flags.
+	Flags uint32
+
+	_ [12]byte
+}
+
+const (
+	// SizeOfRSeq is the size of RSeq, and the only length accepted by
+	// rseq(2).
+	SizeOfRSeq = 32
+
+	// AlignOfRSeq is the required alignment of RSeq.
+	AlignOfRSeq = 32
+
+	// OffsetOfRSeqCriticalSection is the offset of RSeq.RSeqCriticalSection.
+	OffsetOfRSeqCriticalSection = 8
+)
+
+// RSeqCriticalSection describes a restartable sequence critical section,
+// struct rseq_cs in include/uapi/linux/rseq.h.
+type RSeqCriticalSection struct {
+	// Version is the version of this structure. Only version 0 is defined.
+	Version uint32
+
+	// Flags is a set of deprecated RSEQ_CS_FLAG_* flags.
+	Flags uint32
+
+	// Start is the address of the first instruction in the critical
+	// section.
+	Start uint64
+
+	// PostCommitOffset is the size of the critical section, up to and
+	// including the commit instruction.
+	PostCommitOffset uint64
+
+	// Abort is the address to which the instruction pointer is moved if
+	// the critical section is interrupted. The 4 bytes preceding Abort
+	// must contain the signature registered with rseq(2).
+	Abort uint64
+}
+
+// SizeOfRSeqCriticalSection is the size of RSeqCriticalSection.
+const SizeOfRSeqCriticalSection = 32
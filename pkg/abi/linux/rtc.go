@@ -0,0 +1,66 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+// RtcTime represents struct rtc_time, from include/uapi/linux/rtc.h.
+type RtcTime struct {
+	Sec   int32
+	Min   int32
+	Hour  int32
+	Mday  int32
+	Mon   int32
+	Year  int32
+	Wday  int32
+	Yday  int32
+	Isdst int32
+}
+
+// RtcWkalrm represents struct rtc_wkalrm, used by RTC_WKALM_SET and
+// RTC_WKALM_RD.
+type RtcWkalrm struct {
+	Enabled uint8
+	Pending uint8
+	_       uint16
+	Time    RtcTime
+}
+
+// ioctl(2) requests provided by uapi/linux/rtc.h.
+const (
+	RTC_AIE_ON    = 0x00007001
+	RTC_AIE_OFF   = 0x00007002
+	RTC_UIE_ON    = 0x00007003
+	RTC_UIE_OFF   = 0x00007004
+	RTC_PIE_ON    = 0x00007005
+	RTC_PIE_OFF   = 0x00007006
+	RTC_ALM_SET   = 0x40247007
+	RTC_ALM_READ  = 0x80247008
+	RTC_RD_TIME   = 0x80247009
+	RTC_SET_TIME  = 0x4024700a
+	RTC_IRQP_READ = 0x8008700b
+	RTC_IRQP_SET  = 0x4008700c
+	RTC_WKALM_SET = 0x4028700f
+	RTC_WKALM_RD  = 0x80287010
+)
+
+// Interrupt flags reported by read(2) on an RTC device.
+const (
+	RTC_IRQF = 0x80
+	RTC_PF   = 0x40
+	RTC_AF   = 0x20
+	RTC_UF   = 0x10
+)
+
+// RTC_MAX_FREQ is the maximum periodic interrupt frequency.
+const RTC_MAX_FREQ = 8192
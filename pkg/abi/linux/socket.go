@@ -127,8 +127,10 @@ const (
 	SO_LINGER      = 13
 	SO_MARK        = 36
 	SO_PASSCRED    = 16
+	SO_PASSSEC     = 34
 	SO_PEERCRED    = 17
 	SO_PEERNAME    = 28
+	SO_PEERSEC     = 31
 	SO_PROTOCOL    = 38
 	SO_RCVBUF      = 8
 	SO_RCVTIMEO    = 20
@@ -140,6 +142,13 @@ const (
 	SO_TYPE        = 3
 )
 
+// Netfilter socket options, from uapi/linux/netfilter_ipv4.h and
+// uapi/linux/netfilter_ipv6/ip6_tables.h.
+const (
+	SO_ORIGINAL_DST      = 80
+	IP6T_SO_ORIGINAL_DST = 80
+)
+
 // SockAddrInt is struct sockaddr_in, from uapi/linux/in.h.
 type SockAddrInet struct {
 	Family uint16
@@ -250,6 +259,7 @@ var SizeOfTCPInfo = binary.Size(TCPInfo{})
 const (
 	SCM_CREDENTIALS = 0x2
 	SCM_RIGHTS      = 0x1
+	SCM_SECURITY    = 0x3
 )
 
 // A ControlMessageHeader is the header for a socket control message.
@@ -0,0 +1,126 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+// TASKSTATS_GENL_NAME is the name of the taskstats generic netlink family,
+// from uapi/linux/taskstats.h.
+const TASKSTATS_GENL_NAME = "TASKSTATS"
+
+// TASKSTATS_GENL_VERSION is the version of the taskstats generic netlink
+// family, from uapi/linux/taskstats.h.
+const TASKSTATS_GENL_VERSION = 0x1
+
+// Commands of the taskstats family, from uapi/linux/taskstats.h.
+const (
+	TASKSTATS_CMD_UNSPEC = 0
+	TASKSTATS_CMD_GET    = 1
+	TASKSTATS_CMD_NEW    = 2
+)
+
+// Attributes of TASKSTATS_CMD_GET requests, from uapi/linux/taskstats.h.
+const (
+	TASKSTATS_CMD_ATTR_UNSPEC             = 0
+	TASKSTATS_CMD_ATTR_PID                = 1
+	TASKSTATS_CMD_ATTR_TGID               = 2
+	TASKSTATS_CMD_ATTR_REGISTER_CPUMASK   = 3
+	TASKSTATS_CMD_ATTR_DEREGISTER_CPUMASK = 4
+	TASKSTATS_CMD_ATTR_MAX                = TASKSTATS_CMD_ATTR_DEREGISTER_CPUMASK
+)
+
+// Attributes of TASKSTATS_CMD_NEW replies, from uapi/linux/taskstats.h.
+const (
+	TASKSTATS_TYPE_UNSPEC    = 0
+	TASKSTATS_TYPE_PID       = 1
+	TASKSTATS_TYPE_TGID      = 2
+	TASKSTATS_TYPE_STATS     = 3
+	TASKSTATS_TYPE_AGGR_PID  = 4
+	TASKSTATS_TYPE_AGGR_TGID = 5
+	TASKSTATS_TYPE_NULL      = 6
+)
+
+// TASKSTATS_VERSION is the version of the Taskstats layout below, from
+// uapi/linux/taskstats.h.
+const TASKSTATS_VERSION = 8
+
+// TS_COMM_LEN is the length of Taskstats.Comm, from uapi/linux/taskstats.h.
+const TS_COMM_LEN = 32
+
+// Taskstats is struct taskstats, version 8, from uapi/linux/taskstats.h.
+//
+// Delays and CPU run times are in nanoseconds, and other times in
+// microseconds unless noted otherwise.
+type Taskstats struct {
+	Version  uint16
+	_        [2]byte
+	ExitCode uint32
+	Flag     uint8
+	Nice     uint8
+	_        [6]byte
+
+	// Delay accounting fields.
+	CPUCount           uint64
+	CPUDelayTotal      uint64
+	BlkIOCount         uint64
+	BlkIODelayTotal    uint64
+	SwapinCount        uint64
+	SwapinDelayTotal   uint64
+	CPURunRealTotal    uint64
+	CPURunVirtualTotal uint64
+
+	// Basic accounting fields.
+	Comm  [TS_COMM_LEN]byte
+	Sched uint8
+	_     [7]byte
+	UID   uint32
+	GID   uint32
+	PID   uint32
+	PPID  uint32
+	// BeginTime is in seconds since the epoch.
+	BeginTime   uint32
+	_           [4]byte
+	ElapsedTime uint64
+	UTime       uint64
+	STime       uint64
+	MinFlt      uint64
+	MajFlt      uint64
+
+	// Extended accounting fields. Memory sizes are in KB.
+	CoreMem    uint64
+	VirtMem    uint64
+	HiwaterRSS uint64
+	HiwaterVM  uint64
+
+	// I/O accounting fields.
+	ReadChar            uint64
+	WriteChar           uint64
+	ReadSyscalls        uint64
+	WriteSyscalls       uint64
+	ReadBytes           uint64
+	WriteBytes          uint64
+	CancelledWriteBytes uint64
+
+	NVCSw                 uint64
+	NIVCSw                uint64
+	UTimeScaled           uint64
+	STimeScaled           uint64
+	CPUScaledRunRealTotal uint64
+
+	// Memory reclaim delay accounting fields.
+	FreepagesCount      uint64
+	FreepagesDelayTotal uint64
+}
+
+// TaskstatsSize is the size of Taskstats.
+const TaskstatsSize = 328
@@ -70,6 +70,7 @@ const (
 	CLOCK_BOOTTIME           = 7
 	CLOCK_REALTIME_ALARM     = 8
 	CLOCK_BOOTTIME_ALARM     = 9
+	CLOCK_TAI                = 11
 )
 
 // Flags for clock_nanosleep(2).
@@ -207,6 +208,89 @@ type ItimerVal struct {
 	Value    Timeval
 }
 
+// Modes for adjtimex(2) and clock_adjtime(2), from include/uapi/linux/timex.h.
+const (
+	ADJ_OFFSET            = 0x0001
+	ADJ_FREQUENCY         = 0x0002
+	ADJ_MAXERROR          = 0x0004
+	ADJ_ESTERROR          = 0x0008
+	ADJ_STATUS            = 0x0010
+	ADJ_TIMECONST         = 0x0020
+	ADJ_TAI               = 0x0080
+	ADJ_SETOFFSET         = 0x0100
+	ADJ_MICRO             = 0x1000
+	ADJ_NANO              = 0x2000
+	ADJ_TICK              = 0x4000
+	ADJ_OFFSET_READONLY   = 0x2000
+	ADJ_ADJTIME           = 0x8000
+	ADJ_OFFSET_SINGLESHOT = 0x8001
+	ADJ_OFFSET_SS_READ    = 0xa001
+)
+
+// Clock states returned by adjtimex(2) and clock_adjtime(2).
+const (
+	TIME_OK    = 0
+	TIME_INS   = 1
+	TIME_DEL   = 2
+	TIME_OOP   = 3
+	TIME_WAIT  = 4
+	TIME_ERROR = 5
+)
+
+// Clock status bits in Timex.Status.
+const (
+	STA_PLL       = 0x0001
+	STA_PPSFREQ   = 0x0002
+	STA_PPSTIME   = 0x0004
+	STA_FLL       = 0x0008
+	STA_INS       = 0x0010
+	STA_DEL       = 0x0020
+	STA_UNSYNC    = 0x0040
+	STA_FREQHOLD  = 0x0080
+	STA_PPSSIGNAL = 0x0100
+	STA_PPSJITTER = 0x0200
+	STA_PPSWANDER = 0x0400
+	STA_PPSERROR  = 0x0800
+	STA_CLOCKERR  = 0x1000
+	STA_NANO      = 0x2000
+	STA_MODE      = 0x4000
+	STA_CLK       = 0x8000
+
+	// STA_RONLY are the read-only status bits.
+	STA_RONLY = STA_PPSSIGNAL | STA_PPSJITTER | STA_PPSWANDER | STA_PPSERROR | STA_CLOCKERR | STA_NANO | STA_MODE | STA_CLK
+)
+
+// SizeOfTimex is the size of a Timex struct in bytes.
+const SizeOfTimex = 208
+
+// Timex represents struct timex in <linux/timex.h>.
+type Timex struct {
+	Modes     uint32
+	_         int32
+	Offset    int64
+	Freq      int64
+	MaxError  int64
+	EstError  int64
+	Status    int32
+	_         int32
+	Constant  int64
+	Precision int64
+	Tolerance int64
+	Time      Timeval
+	Tick      int64
+	PPSFreq   int64
+	Jitter    int64
+	Shift     int32
+	_         int32
+	Stabil    int64
+	JitCnt    int64
+	CalCnt    int64
+	ErrCnt    int64
+	StbCnt    int64
+	TAI       int32
+	_         [11]int32
+}
+
 // ClockT represents type clock_t.
 type ClockT int64
 
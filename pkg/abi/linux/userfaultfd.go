@@ -0,0 +1,140 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+// Flags for userfaultfd(2).
+const (
+	UFFD_USER_MODE_ONLY = 1
+)
+
+// UFFD_API is the only userfaultfd API version.
+const UFFD_API = 0xAA
+
+// Ioctl command numbers, from include/uapi/linux/userfaultfd.h.
+const (
+	_UFFDIO_REGISTER   = 0x00
+	_UFFDIO_UNREGISTER = 0x01
+	_UFFDIO_WAKE       = 0x02
+	_UFFDIO_COPY       = 0x03
+	_UFFDIO_ZEROPAGE   = 0x04
+	_UFFDIO_API        = 0x3F
+)
+
+// Userfaultfd ioctls.
+const (
+	UFFDIO_API        = 0xc018aa3f
+	UFFDIO_REGISTER   = 0xc020aa00
+	UFFDIO_UNREGISTER = 0x8010aa01
+	UFFDIO_WAKE       = 0x8010aa02
+	UFFDIO_COPY       = 0xc028aa03
+	UFFDIO_ZEROPAGE   = 0xc020aa04
+)
+
+// Sets of ioctls reported by UFFDIO_API and UFFDIO_REGISTER.
+const (
+	// UFFD_API_IOCTLS are the ioctls supported on a userfaultfd.
+	UFFD_API_IOCTLS = 1<<_UFFDIO_REGISTER | 1<<_UFFDIO_UNREGISTER | 1<<_UFFDIO_API
+
+	// UFFD_API_RANGE_IOCTLS are the ioctls supported on a registered range.
+	UFFD_API_RANGE_IOCTLS = 1<<_UFFDIO_WAKE | 1<<_UFFDIO_COPY | 1<<_UFFDIO_ZEROPAGE
+)
+
+// Modes for UFFDIO_REGISTER.
+const (
+	UFFDIO_REGISTER_MODE_MISSING = 1 << 0
+	UFFDIO_REGISTER_MODE_WP      = 1 << 1
+	UFFDIO_REGISTER_MODE_MINOR   = 1 << 2
+)
+
+// Modes for UFFDIO_COPY and UFFDIO_ZEROPAGE.
+const (
+	UFFDIO_COPY_MODE_DONTWAKE     = 1 << 0
+	UFFDIO_COPY_MODE_WP           = 1 << 1
+	UFFDIO_ZEROPAGE_MODE_DONTWAKE = 1 << 0
+)
+
+// Userfaultfd events.
+const (
+	UFFD_EVENT_PAGEFAULT = 0x12
+	UFFD_EVENT_FORK      = 0x13
+	UFFD_EVENT_REMAP     = 0x14
+	UFFD_EVENT_REMOVE    = 0x15
+	UFFD_EVENT_UNMAP     = 0x16
+)
+
+// Flags for UFFD_EVENT_PAGEFAULT.
+const (
+	UFFD_PAGEFAULT_FLAG_WRITE = 1 << 0
+	UFFD_PAGEFAULT_FLAG_WP    = 1 << 1
+	UFFD_PAGEFAULT_FLAG_MINOR = 1 << 2
+)
+
+// UffdioAPI is struct uffdio_api, from include/uapi/linux/userfaultfd.h.
+type UffdioAPI struct {
+	API      uint64
+	Features uint64
+	Ioctls   uint64
+}
+
+// UffdioRange is struct uffdio_range, from include/uapi/linux/userfaultfd.h.
+type UffdioRange struct {
+	Start uint64
+	Len   uint64
+}
+
+// UffdioRegister is struct uffdio_register, from
+// include/uapi/linux/userfaultfd.h.
+type UffdioRegister struct {
+	Range  UffdioRange
+	Mode   uint64
+	Ioctls uint64
+}
+
+// UffdioCopy is struct uffdio_copy, from include/uapi/linux/userfaultfd.h.
+type UffdioCopy struct {
+	Dst  uint64
+	Src  uint64
+	Len  uint64
+	Mode uint64
+
+	// Copy is the number of bytes copied, or a negated errno.
+	Copy int64
+}
+
+// UffdioZeropage is struct uffdio_zeropage, from
+// include/uapi/linux/userfaultfd.h.
+type UffdioZeropage struct {
+	Range UffdioRange
+	Mode  uint64
+
+	// Zeropage is the number of bytes zeroed, or a negated errno.
+	Zeropage int64
+}
+
+// UffdMsg is struct uffd_msg, from include/uapi/linux/userfaultfd.h, with
+// the arg union laid out as for UFFD_EVENT_PAGEFAULT.
+type UffdMsg struct {
+	Event     uint8
+	Reserved1 uint8
+	Reserved2 uint16
+	Reserved3 uint32
+	Flags     uint64
+	Address   uint64
+	Ptid      uint32
+	_         [4]byte
+}
+
+// SizeOfUffdMsg is the size of a UffdMsg.
+const SizeOfUffdMsg = 32
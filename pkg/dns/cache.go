@@ -0,0 +1,170 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dns
+
+import (
+	"container/list"
+	"encoding/binary"
+	"time"
+)
+
+// maxCacheTTL is the maximum time for which a response is cached, regardless
+// of its TTL.
+const maxCacheTTL = time.Hour
+
+// cacheEntry is a cached response.
+type cacheEntry struct {
+	key    question
+	msg    *message
+	stored time.Time
+	expiry time.Time
+}
+
+// cache is a least recently used cache of responses, keyed by the question
+// with its name in canonical form. cache is not safe for concurrent use.
+type cache struct {
+	size int
+
+	// lru contains the *cacheEntries, most recently used first.
+	lru *list.List
+
+	// entries maps keys to their elements in lru.
+	entries map[question]*list.Element
+}
+
+func newCache(size int) *cache {
+	return &cache{
+		size:    size,
+		lru:     list.New(),
+		entries: make(map[question]*list.Element),
+	}
+}
+
+// get returns the response to key, if it is cached. The TTLs of the records in
+// the response are reduced by the time for which it has been cached.
+func (c *cache) get(key question, now time.Time) (*message, bool) {
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := e.Value.(*cacheEntry)
+	if !now.Before(entry.expiry) {
+		c.lru.Remove(e)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.lru.MoveToFront(e)
+
+	age := uint32(now.Sub(entry.stored) / time.Second)
+	m := *entry.msg
+	m.answers = aged(m.answers, age)
+	m.authorities = aged(m.authorities, age)
+	m.additionals = aged(m.additionals, age)
+	return &m, true
+}
+
+// put caches the response m to key, unless it must not be cached.
+func (c *cache) put(key question, m *message, now time.Time) {
+	ttl, ok := cacheTTL(m)
+	if !ok {
+		return
+	}
+	if e, ok := c.entries[key]; ok {
+		c.lru.Remove(e)
+		delete(c.entries, key)
+	}
+	for c.lru.Len() >= c.size {
+		oldest := c.lru.Remove(c.lru.Back()).(*cacheEntry)
+		delete(c.entries, oldest.key)
+	}
+
+	// EDNS OPT records apply to a single hop, so they aren't cached.
+	cached := *m
+	cached.additionals = nil
+	for _, r := range m.additionals {
+		if r.typ != typeOPT {
+			cached.additionals = append(cached.additionals, r)
+		}
+	}
+	c.entries[key] = c.lru.PushFront(&cacheEntry{
+		key:    key,
+		msg:    &cached,
+		stored: now,
+		expiry: now.Add(ttl),
+	})
+}
+
+// aged returns a copy of rs with their TTLs reduced by age seconds.
+func aged(rs []resource, age uint32) []resource {
+	if len(rs) == 0 {
+		return nil
+	}
+	out := make([]resource, len(rs))
+	for i, r := range rs {
+		if r.ttl > age {
+			r.ttl -= age
+		} else {
+			r.ttl = 0
+		}
+		out[i] = r
+	}
+	return out
+}
+
+// cacheTTL returns the time for which the response m may be cached, and false
+// if it must not be cached. Positive responses are cached for the smallest TTL
+// of their records, and negative responses as described in RFC 2308.
+func cacheTTL(m *message) (time.Duration, bool) {
+	if m.flags&flagTC != 0 {
+		return 0, false
+	}
+	var ttl uint32
+	switch {
+	case m.rcode() == rcodeSuccess && len(m.answers) > 0:
+		ttl = ^uint32(0)
+		for _, section := range [][]resource{m.answers, m.authorities} {
+			for _, r := range section {
+				if r.ttl < ttl {
+					ttl = r.ttl
+				}
+			}
+		}
+	case m.rcode() == rcodeSuccess || m.rcode() == rcodeNameError:
+		// "The TTL of this record is set from the minimum of the MINIMUM
+		// field of the SOA record and the TTL of the SOA itself" -
+		// RFC 2308, section 3.
+		found := false
+		for _, r := range m.authorities {
+			if r.typ == typeSOA {
+				ttl = binary.BigEndian.Uint32(r.data[len(r.data)-4:])
+				if r.ttl < ttl {
+					ttl = r.ttl
+				}
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, false
+		}
+	default:
+		return 0, false
+	}
+	d := time.Duration(ttl) * time.Second
+	if d > maxCacheTTL {
+		d = maxCacheTTL
+	}
+	return d, d > 0
+}
@@ -0,0 +1,396 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dns
+
+import (
+	"encoding/binary"
+	"errors"
+	"strings"
+)
+
+const (
+	headerSize = 12
+
+	// maxNameLength is the maximum length of an uncompressed name.
+	maxNameLength = 255
+
+	// maxPointers is the maximum number of compression pointers that are
+	// followed in a name.
+	maxPointers = 16
+
+	// maxUDPSize is the maximum size of a response over UDP to a query
+	// without an EDNS OPT record (RFC 1035, section 4.2.1).
+	maxUDPSize = 512
+
+	// ednsSize is the UDP payload size that is advertised in EDNS OPT
+	// records (RFC 6891).
+	ednsSize = 4096
+)
+
+// Header flags.
+const (
+	flagQR     = 1 << 15
+	flagTC     = 1 << 9
+	flagRD     = 1 << 8
+	flagRA     = 1 << 7
+	opcodeMask = 0xf << 11
+	rcodeMask  = 0xf
+)
+
+// Response codes.
+const (
+	rcodeSuccess        = 0
+	rcodeFormatError    = 1
+	rcodeServerFailure  = 2
+	rcodeNameError      = 3
+	rcodeNotImplemented = 4
+	rcodeRefused        = 5
+)
+
+// Resource record types.
+const (
+	typeNS    = 2
+	typeCNAME = 5
+	typeSOA   = 6
+	typePTR   = 12
+	typeMX    = 15
+	typeSRV   = 33
+	typeDNAME = 39
+	typeOPT   = 41
+)
+
+var errMalformed = errors.New("malformed DNS message")
+
+// A question is an entry in the question section of a message.
+type question struct {
+	// name is the uncompressed wire format of the name.
+	name string
+	typ  uint16
+	cls  uint16
+}
+
+// A resource is a resource record.
+type resource struct {
+	// name is the uncompressed wire format of the owner name.
+	name string
+	typ  uint16
+	cls  uint16
+	ttl  uint32
+
+	// data is the resource data. Names within the data of the types that
+	// are allowed to compress them are uncompressed, so that data is
+	// independent of the message that it was read from.
+	data []byte
+}
+
+// A message is a DNS message (RFC 1035, section 4.1).
+type message struct {
+	id          uint16
+	flags       uint16
+	questions   []question
+	answers     []resource
+	authorities []resource
+	additionals []resource
+}
+
+func (m *message) rcode() int {
+	return int(m.flags & rcodeMask)
+}
+
+// edns returns the EDNS OPT record of m, if any.
+func (m *message) edns() (resource, bool) {
+	for _, r := range m.additionals {
+		if r.typ == typeOPT {
+			return r, true
+		}
+	}
+	return resource{}, false
+}
+
+// parseMessage parses the DNS message in b.
+func parseMessage(b []byte) (*message, error) {
+	if len(b) < headerSize {
+		return nil, errMalformed
+	}
+	m := &message{
+		id:    binary.BigEndian.Uint16(b),
+		flags: binary.BigEndian.Uint16(b[2:]),
+	}
+	off := headerSize
+	for n := binary.BigEndian.Uint16(b[4:]); n > 0; n-- {
+		name, next, err := readName(b, off)
+		if err != nil {
+			return nil, err
+		}
+		if next+4 > len(b) {
+			return nil, errMalformed
+		}
+		m.questions = append(m.questions, question{
+			name: name,
+			typ:  binary.BigEndian.Uint16(b[next:]),
+			cls:  binary.BigEndian.Uint16(b[next+2:]),
+		})
+		off = next + 4
+	}
+	var err error
+	for i, section := range []*[]resource{&m.answers, &m.authorities, &m.additionals} {
+		for n := binary.BigEndian.Uint16(b[6+2*i:]); n > 0; n-- {
+			var r resource
+			if r, off, err = readResource(b, off); err != nil {
+				return nil, err
+			}
+			*section = append(*section, r)
+		}
+	}
+	return m, nil
+}
+
+// readResource reads the resource record at offset off in the message b. It
+// returns the record and the offset following it.
+func readResource(b []byte, off int) (resource, int, error) {
+	name, next, err := readName(b, off)
+	if err != nil {
+		return resource{}, 0, err
+	}
+	if next+10 > len(b) {
+		return resource{}, 0, errMalformed
+	}
+	r := resource{
+		name: name,
+		typ:  binary.BigEndian.Uint16(b[next:]),
+		cls:  binary.BigEndian.Uint16(b[next+2:]),
+		ttl:  binary.BigEndian.Uint32(b[next+4:]),
+	}
+	start := next + 10
+	end := start + int(binary.BigEndian.Uint16(b[next+8:]))
+	if end > len(b) {
+		return resource{}, 0, errMalformed
+	}
+
+	// Decompress the names in the data of the types that RFC 1035 and
+	// RFC 2782 define.
+	var prefix int
+	var names int
+	switch r.typ {
+	case typeNS, typeCNAME, typePTR, typeDNAME:
+		names = 1
+	case typeMX:
+		prefix, names = 2, 1
+	case typeSRV:
+		prefix, names = 6, 1
+	case typeSOA:
+		names = 2
+	default:
+		r.data = append([]byte(nil), b[start:end]...)
+		return r, end, nil
+	}
+	if start+prefix > end {
+		return resource{}, 0, errMalformed
+	}
+	r.data = append(r.data, b[start:start+prefix]...)
+	off = start + prefix
+	for ; names > 0; names-- {
+		name, next, err := readName(b[:end], off)
+		if err != nil {
+			return resource{}, 0, err
+		}
+		r.data = append(r.data, name...)
+		off = next
+	}
+	if r.typ == typeSOA {
+		// SERIAL, REFRESH, RETRY, EXPIRE and MINIMUM.
+		if off+20 != end {
+			return resource{}, 0, errMalformed
+		}
+		r.data = append(r.data, b[off:end]...)
+	} else if off != end {
+		return resource{}, 0, errMalformed
+	}
+	return r, end, nil
+}
+
+// readName reads the possibly compressed name at offset off in the message b.
+// It returns the uncompressed wire format of the name and the offset following
+// it.
+func readName(b []byte, off int) (string, int, error) {
+	var name []byte
+	next := -1
+	for pointers := 0; ; {
+		if off >= len(b) {
+			return "", 0, errMalformed
+		}
+		length := int(b[off])
+		switch {
+		case length == 0:
+			if next < 0 {
+				next = off + 1
+			}
+			return string(append(name, 0)), next, nil
+		case length&0xc0 == 0xc0:
+			if off+1 >= len(b) || pointers >= maxPointers {
+				return "", 0, errMalformed
+			}
+			pointers++
+			if next < 0 {
+				next = off + 2
+			}
+			off = int(binary.BigEndian.Uint16(b[off:]) & 0x3fff)
+		case length&0xc0 != 0:
+			return "", 0, errMalformed
+		default:
+			if off+1+length > len(b) || len(name)+1+length+1 > maxNameLength {
+				return "", 0, errMalformed
+			}
+			name = append(name, b[off:off+1+length]...)
+			off += 1 + length
+		}
+	}
+}
+
+// pack returns the wire format of m. Names are compressed where RFC 3597
+// allows it.
+func (m *message) pack() []byte {
+	b := make([]byte, headerSize, maxUDPSize)
+	binary.BigEndian.PutUint16(b, m.id)
+	binary.BigEndian.PutUint16(b[2:], m.flags)
+	binary.BigEndian.PutUint16(b[4:], uint16(len(m.questions)))
+	binary.BigEndian.PutUint16(b[6:], uint16(len(m.answers)))
+	binary.BigEndian.PutUint16(b[8:], uint16(len(m.authorities)))
+	binary.BigEndian.PutUint16(b[10:], uint16(len(m.additionals)))
+
+	names := make(map[string]int)
+	for _, q := range m.questions {
+		b = appendName(b, q.name, names)
+		b = appendUint16(b, q.typ)
+		b = appendUint16(b, q.cls)
+	}
+	for _, section := range [][]resource{m.answers, m.authorities, m.additionals} {
+		for _, r := range section {
+			b = appendName(b, r.name, names)
+			b = appendUint16(b, r.typ)
+			b = appendUint16(b, r.cls)
+			b = appendUint16(b, uint16(r.ttl>>16))
+			b = appendUint16(b, uint16(r.ttl))
+			length := len(b)
+			b = append(b, 0, 0)
+			b = appendData(b, r, names)
+			binary.BigEndian.PutUint16(b[length:], uint16(len(b)-length-2))
+		}
+	}
+	return b
+}
+
+// appendData appends the data of r to b, compressing the names in the data of
+// the types defined by RFC 1035.
+func appendData(b []byte, r resource, names map[string]int) []byte {
+	switch r.typ {
+	case typeNS, typeCNAME, typePTR:
+		return appendName(b, string(r.data), names)
+	case typeMX:
+		b = append(b, r.data[:2]...)
+		return appendName(b, string(r.data[2:]), names)
+	case typeSOA:
+		mname := nameLength(r.data)
+		rname := nameLength(r.data[mname:])
+		b = appendName(b, string(r.data[:mname]), names)
+		b = appendName(b, string(r.data[mname:mname+rname]), names)
+		return append(b, r.data[mname+rname:]...)
+	default:
+		return append(b, r.data...)
+	}
+}
+
+// appendName appends the wire format name to b, compressed with the names
+// that were previously appended, and records the offsets of its suffixes in
+// names.
+func appendName(b []byte, name string, names map[string]int) []byte {
+	for len(name) > 1 {
+		if off, ok := names[name]; ok {
+			return appendUint16(b, uint16(0xc000|off))
+		}
+		if len(b) < 0x4000 {
+			names[name] = len(b)
+		}
+		length := int(name[0])
+		b = append(b, name[:1+length]...)
+		name = name[1+length:]
+	}
+	return append(b, 0)
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
+
+// nameLength returns the length of the uncompressed wire format name at the
+// start of b.
+func nameLength(b []byte) int {
+	off := 0
+	for b[off] != 0 {
+		off += 1 + int(b[off])
+	}
+	return off + 1
+}
+
+// labels returns the number of labels in the wire format name.
+func labels(name string) int {
+	n := 0
+	for off := 0; name[off] != 0; off += 1 + int(name[off]) {
+		n++
+	}
+	return n
+}
+
+// canonical returns the wire format name with ASCII letters in lower case,
+// since names are compared case insensitively (RFC 4343).
+func canonical(name string) string {
+	b := []byte(name)
+	for i, c := range b {
+		// Length bytes are at most 63, so they are never letters.
+		if 'A' <= c && c <= 'Z' {
+			b[i] = c + 'a' - 'A'
+		}
+	}
+	return string(b)
+}
+
+// encodeName returns the wire format of the domain name s, such as
+// "example.com" or "example.com.".
+func encodeName(s string) (string, error) {
+	s = strings.TrimSuffix(s, ".")
+	var name []byte
+	if s != "" {
+		for _, label := range strings.Split(s, ".") {
+			if len(label) == 0 || len(label) > 63 {
+				return "", errors.New("invalid domain name " + s)
+			}
+			name = append(name, byte(len(label)))
+			name = append(name, label...)
+		}
+	}
+	if len(name)+1 > maxNameLength {
+		return "", errors.New("domain name too long: " + s)
+	}
+	return string(append(name, 0)), nil
+}
+
+// decodeName returns the dotted form of the wire format name, for logging.
+func decodeName(name string) string {
+	var labels []string
+	for off := 0; name[off] != 0; off += 1 + int(name[off]) {
+		labels = append(labels, name[off+1:off+1+int(name[off])])
+	}
+	return strings.Join(labels, ".") + "."
+}
@@ -0,0 +1,119 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dns
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func mustEncodeName(t *testing.T, s string) string {
+	name, err := encodeName(s)
+	if err != nil {
+		t.Fatalf("encodeName(%q) failed: %v", s, err)
+	}
+	return name
+}
+
+func TestMessageRoundTrip(t *testing.T) {
+	name := mustEncodeName(t, "www.Example.com")
+	alias := mustEncodeName(t, "web.example.com")
+	zone := mustEncodeName(t, "example.com")
+	m := &message{
+		id:        0x1234,
+		flags:     flagQR | flagRD | flagRA,
+		questions: []question{{name, 1, 1}},
+		answers: []resource{
+			{name: name, typ: typeCNAME, cls: 1, ttl: 300, data: []byte(alias)},
+			{name: alias, typ: 1, cls: 1, ttl: 60, data: []byte{192, 0, 2, 1}},
+			{name: alias, typ: typeMX, cls: 1, ttl: 60, data: append([]byte{0, 10}, zone...)},
+			{name: alias, typ: typeSRV, cls: 1, ttl: 60, data: append([]byte{0, 1, 0, 2, 0, 3}, zone...)},
+		},
+		authorities: []resource{
+			{name: zone, typ: typeSOA, cls: 1, ttl: 3600, data: append([]byte(name+alias), bytes.Repeat([]byte{1}, 20)...)},
+		},
+		additionals: []resource{
+			{name: "\x00", typ: typeOPT, cls: ednsSize},
+		},
+	}
+	b := m.pack()
+	got, err := parseMessage(b)
+	if err != nil {
+		t.Fatalf("parseMessage failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, m) {
+		t.Errorf("parseMessage(pack(m)) = %+v, want %+v", got, m)
+	}
+
+	// Names are compressed, so the message is shorter than the sum of its
+	// parts.
+	size := headerSize + len(name) + 4
+	for _, r := range append(append(m.answers, m.authorities...), m.additionals...) {
+		size += len(r.name) + 10 + len(r.data)
+	}
+	if len(b) >= size {
+		t.Errorf("packed message is %d bytes, want less than %d", len(b), size)
+	}
+}
+
+func TestParseMessageMalformed(t *testing.T) {
+	valid := (&message{
+		id:        1,
+		questions: []question{{mustEncodeName(t, "example.com"), 1, 1}},
+		answers: []resource{
+			{name: mustEncodeName(t, "example.com"), typ: typeCNAME, cls: 1, data: []byte(mustEncodeName(t, "www.example.com"))},
+		},
+	}).pack()
+	for i := 0; i < len(valid); i++ {
+		if _, err := parseMessage(valid[:i]); err == nil {
+			t.Errorf("parseMessage succeeded on a message truncated to %d bytes", i)
+		}
+	}
+
+	for _, b := range [][]byte{
+		// A compression pointer loop.
+		{0, 1, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0xc0, 12, 0, 1, 0, 1},
+		// A reserved label type.
+		{0, 1, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0x40, 0, 0, 1, 0, 1},
+		// A CNAME whose name extends beyond its data.
+		{0, 1, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 5, 0, 1, 0, 0, 0, 0, 0, 1, 1, 'a', 0},
+	} {
+		if _, err := parseMessage(b); err == nil {
+			t.Errorf("parseMessage(%v) succeeded, want error", b)
+		}
+	}
+}
+
+func TestNames(t *testing.T) {
+	name := mustEncodeName(t, "WWW.example.COM.")
+	if want := "\x03WWW\x07example\x03COM\x00"; name != want {
+		t.Errorf("encodeName = %q, want %q", name, want)
+	}
+	if got, want := canonical(name), "\x03www\x07example\x03com\x00"; got != want {
+		t.Errorf("canonical(%q) = %q, want %q", name, got, want)
+	}
+	if got, want := labels(name), 3; got != want {
+		t.Errorf("labels(%q) = %d, want %d", name, got, want)
+	}
+	if got, want := decodeName(name), "WWW.example.COM."; got != want {
+		t.Errorf("decodeName(%q) = %q, want %q", name, got, want)
+	}
+	for _, s := range []string{"a..b", string(bytes.Repeat([]byte{'a'}, 64)) + ".com"} {
+		if _, err := encodeName(s); err == nil {
+			t.Errorf("encodeName(%q) succeeded, want error", s)
+		}
+	}
+}
@@ -0,0 +1,391 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package dns implements a caching DNS resolver that forwards queries to
+// upstream servers over UDP, TCP or TLS.
+package dns
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/log"
+)
+
+const (
+	// defaultTimeout is the default time to wait for a response from an
+	// upstream.
+	defaultTimeout = 5 * time.Second
+
+	// idleTimeout is the time after which idle client connections are
+	// closed.
+	idleTimeout = 10 * time.Second
+
+	// maxConcurrentQueries is the maximum number of queries received over
+	// UDP that are answered concurrently. Further queries are dropped.
+	maxConcurrentQueries = 256
+)
+
+// Config configures a Resolver.
+type Config struct {
+	// Upstreams are the servers that queries are forwarded to, in order of
+	// preference.
+	Upstreams []Upstream
+
+	// Search are the domains that are appended to names with fewer than
+	// Ndots dots before they are resolved as is, as in resolv.conf(5).
+	Search []string
+
+	// Ndots is the number of dots below which the Search domains are tried
+	// first. If Ndots is 0, 1 is used.
+	Ndots int
+
+	// CacheSize is the maximum number of responses that are cached. If
+	// CacheSize is 0, responses are not cached.
+	CacheSize int
+
+	// Timeout is the time to wait for a response from each upstream. If
+	// Timeout is 0, a default is used.
+	Timeout time.Duration
+
+	// Dialer creates the sockets used to reach the upstreams.
+	Dialer Dialer
+
+	// RootCAs are the certificate authorities that the certificates of
+	// DNS over TLS upstreams are verified against. If RootCAs is nil, the
+	// host's are used.
+	RootCAs *x509.CertPool
+}
+
+// A Resolver answers DNS queries by forwarding them to upstream servers, and
+// caches their responses.
+type Resolver struct {
+	cfg Config
+
+	// search is the wire format of cfg.Search.
+	search []string
+
+	// queries limits the number of concurrent queries received over UDP.
+	queries chan struct{}
+
+	// mu protects the fields below.
+	mu sync.Mutex
+
+	// cache is nil if responses are not cached.
+	cache *cache
+
+	// lookups are the lookups that are in progress, by question. Queries
+	// for the same question wait for the same lookup.
+	lookups map[question]*lookup
+
+	// idle are the idle connections to each DNS over TLS upstream, by
+	// index in cfg.Upstreams.
+	idle map[int][]net.Conn
+}
+
+// lookup is a lookup that is in progress.
+type lookup struct {
+	done chan struct{}
+
+	// resp is the response, or nil if the lookup failed. resp is
+	// immutable once done is closed.
+	resp *message
+}
+
+// New returns a Resolver configured by cfg.
+func New(cfg Config) (*Resolver, error) {
+	if len(cfg.Upstreams) == 0 {
+		return nil, errors.New("no upstreams")
+	}
+	if cfg.Dialer == nil {
+		return nil, errors.New("no dialer")
+	}
+	if cfg.Ndots <= 0 {
+		cfg.Ndots = 1
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	r := &Resolver{
+		cfg:     cfg,
+		queries: make(chan struct{}, maxConcurrentQueries),
+		lookups: make(map[question]*lookup),
+		idle:    make(map[int][]net.Conn),
+	}
+	for _, domain := range cfg.Search {
+		name, err := encodeName(domain)
+		if err != nil {
+			return nil, err
+		}
+		r.search = append(r.search, canonical(name))
+	}
+	if cfg.CacheSize > 0 {
+		r.cache = newCache(cfg.CacheSize)
+	}
+	return r, nil
+}
+
+// ServePacket answers the queries received on c until reading from c fails,
+// and returns the error.
+func (r *Resolver) ServePacket(c net.PacketConn) error {
+	buf := make([]byte, ednsSize)
+	for {
+		n, addr, err := c.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+		select {
+		case r.queries <- struct{}{}:
+		default:
+			log.Debugf("DNS: dropping query from %v, too many queries in progress", addr)
+			continue
+		}
+		query := append([]byte(nil), buf[:n]...)
+		go func() {
+			defer func() { <-r.queries }()
+			if resp := r.respond(query, true); resp != nil {
+				c.WriteTo(resp, addr)
+			}
+		}()
+	}
+}
+
+// Serve answers the queries received on the connections accepted from l
+// until accepting fails, and returns the error.
+func (r *Resolver) Serve(l net.Listener) error {
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go r.serveConn(c)
+	}
+}
+
+// serveConn answers the queries received on the stream connection c, one at a
+// time.
+func (r *Resolver) serveConn(c net.Conn) {
+	defer c.Close()
+	for {
+		if err := c.SetDeadline(time.Now().Add(idleTimeout)); err != nil {
+			return
+		}
+		query, err := readStreamMessage(c)
+		if err != nil {
+			return
+		}
+		resp := r.respond(query, false)
+		if resp == nil {
+			return
+		}
+		if err := c.SetDeadline(time.Now().Add(idleTimeout)); err != nil {
+			return
+		}
+		if err := writeStreamMessage(c, resp); err != nil {
+			return
+		}
+	}
+}
+
+// Resolve returns the response to the query in the DNS message b, or nil if b
+// should be ignored.
+func (r *Resolver) Resolve(b []byte) []byte {
+	return r.respond(b, false)
+}
+
+// respond returns the response to the query in b, or nil if b should be
+// ignored. If udp is true, the response is truncated to the size that the
+// client can receive over UDP.
+func (r *Resolver) respond(b []byte, udp bool) []byte {
+	query, err := parseMessage(b)
+	if err != nil {
+		if len(b) < headerSize || b[2]&0x80 != 0 {
+			return nil
+		}
+		// Answer with only the header, since the question can't be
+		// read.
+		resp := message{
+			id:    binary.BigEndian.Uint16(b),
+			flags: flagQR | binary.BigEndian.Uint16(b[2:])&(opcodeMask|flagRD) | flagRA | rcodeFormatError,
+		}
+		return resp.pack()
+	}
+	if query.flags&flagQR != 0 {
+		return nil
+	}
+
+	resp := &message{
+		id:        query.id,
+		flags:     flagQR | query.flags&(opcodeMask|flagRD) | flagRA,
+		questions: query.questions,
+	}
+	switch {
+	case query.flags&opcodeMask != 0:
+		resp.flags |= rcodeNotImplemented
+	case len(query.questions) != 1:
+		resp.flags |= rcodeFormatError
+	default:
+		if answer := r.resolveSearch(query.questions[0]); answer != nil {
+			resp.flags |= answer.flags & rcodeMask
+			resp.answers = answer.answers
+			resp.authorities = answer.authorities
+			for _, rr := range answer.additionals {
+				if rr.typ != typeOPT {
+					resp.additionals = append(resp.additionals, rr)
+				}
+			}
+		} else {
+			resp.flags |= rcodeServerFailure
+		}
+	}
+
+	maxSize := 0xffff
+	if udp {
+		maxSize = maxUDPSize
+	}
+	if opt, ok := query.edns(); ok {
+		resp.additionals = append(resp.additionals, resource{
+			name: "\x00",
+			typ:  typeOPT,
+			cls:  ednsSize,
+		})
+		if udp && int(opt.cls) > maxSize {
+			maxSize = int(opt.cls)
+			if maxSize > ednsSize {
+				maxSize = ednsSize
+			}
+		}
+	}
+	packed := resp.pack()
+	if len(packed) > maxSize {
+		// The client will retry over TCP.
+		resp.flags |= flagTC
+		resp.answers = nil
+		resp.authorities = nil
+		resp.additionals = nil
+		packed = resp.pack()
+	}
+	return packed
+}
+
+// resolveSearch returns the answer to q, or nil if it couldn't be resolved.
+// Names with fewer than cfg.Ndots dots are first qualified with each search
+// domain, and the answer to the first name that has records is returned after
+// a CNAME record that aliases q's name to it. The root name has no labels, and
+// is never qualified: that would resolve the search domains themselves.
+func (r *Resolver) resolveSearch(q question) *message {
+	if n := labels(q.name); n > 0 && n-1 < r.cfg.Ndots {
+		for _, domain := range r.search {
+			name := canonical(q.name[:len(q.name)-1]) + domain
+			if len(name) > maxNameLength {
+				continue
+			}
+			answer := r.resolve(question{name, q.typ, q.cls})
+			if answer == nil || answer.rcode() != rcodeSuccess || len(answer.answers) == 0 {
+				continue
+			}
+			ttl := answer.answers[0].ttl
+			for _, rr := range answer.answers {
+				if rr.ttl < ttl {
+					ttl = rr.ttl
+				}
+			}
+			alias := *answer
+			alias.answers = append([]resource{{
+				name: q.name,
+				typ:  typeCNAME,
+				cls:  q.cls,
+				ttl:  ttl,
+				data: []byte(name),
+			}}, answer.answers...)
+			return &alias
+		}
+	}
+	return r.resolve(q)
+}
+
+// resolve returns the answer to q from the cache or the upstreams, or nil if
+// it couldn't be resolved.
+func (r *Resolver) resolve(q question) *message {
+	key := question{canonical(q.name), q.typ, q.cls}
+
+	r.mu.Lock()
+	if r.cache != nil {
+		if m, ok := r.cache.get(key, time.Now()); ok {
+			r.mu.Unlock()
+			return m
+		}
+	}
+	if l, ok := r.lookups[key]; ok {
+		r.mu.Unlock()
+		<-l.done
+		return l.resp
+	}
+	l := &lookup{done: make(chan struct{})}
+	r.lookups[key] = l
+	r.mu.Unlock()
+
+	l.resp = r.forward(key)
+
+	r.mu.Lock()
+	delete(r.lookups, key)
+	if r.cache != nil && l.resp != nil {
+		r.cache.put(key, l.resp, time.Now())
+	}
+	r.mu.Unlock()
+	close(l.done)
+	return l.resp
+}
+
+// forward sends a query for q to each upstream in turn, and returns the first
+// response that isn't a failure. If all upstreams fail, it returns the last
+// failure response, or nil if there is none.
+func (r *Resolver) forward(q question) *message {
+	var id [2]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		log.Warningf("DNS: failed to generate query ID: %v", err)
+		return nil
+	}
+	query := &message{
+		id:        binary.BigEndian.Uint16(id[:]),
+		flags:     flagRD,
+		questions: []question{q},
+		additionals: []resource{{
+			name: "\x00",
+			typ:  typeOPT,
+			cls:  ednsSize,
+		}},
+	}
+
+	var failure *message
+	for i, u := range r.cfg.Upstreams {
+		resp, err := r.exchange(i, query)
+		if err != nil {
+			log.Debugf("DNS: query for %s to %v failed: %v", decodeName(q.name), u, err)
+			continue
+		}
+		if rcode := resp.rcode(); rcode == rcodeServerFailure || rcode == rcodeRefused {
+			log.Debugf("DNS: query for %s to %v failed with rcode %d", decodeName(q.name), u, rcode)
+			failure = resp
+			continue
+		}
+		return resp
+	}
+	return failure
+}
@@ -0,0 +1,544 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dns
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"net"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// hostDialer is a Dialer that uses the host network.
+type hostDialer struct{}
+
+// ListenPacket implements Dialer.ListenPacket.
+func (hostDialer) ListenPacket(addr *net.UDPAddr) (net.PacketConn, error) {
+	return net.ListenUDP("udp", nil)
+}
+
+// DialTCP implements Dialer.DialTCP.
+func (hostDialer) DialTCP(addr *net.TCPAddr) (net.Conn, error) {
+	return net.DialTCP("tcp", nil, addr)
+}
+
+// testServer is an upstream DNS server on the loopback address.
+type testServer struct {
+	handler func(q question) *message
+
+	// truncate is non-zero if responses over UDP are truncated. It is
+	// accessed atomically.
+	truncate int32
+
+	udp net.PacketConn
+	tcp net.Listener
+
+	// queries and conns are the number of queries and stream connections
+	// received.
+	queries int32
+	conns   int32
+}
+
+// newTestServer returns a testServer that answers queries with handler, over
+// UDP and TCP, or only over TLS if config is not nil.
+func newTestServer(t *testing.T, handler func(q question) *message, config *tls.Config) *testServer {
+	s := &testServer{handler: handler}
+	for {
+		udp, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			t.Fatalf("ListenUDP failed: %v", err)
+		}
+		addr := udp.LocalAddr().(*net.UDPAddr)
+		tcp, err := net.ListenTCP("tcp", &net.TCPAddr{IP: addr.IP, Port: addr.Port})
+		if err != nil {
+			// The port is taken for TCP, try another one.
+			udp.Close()
+			continue
+		}
+		s.udp, s.tcp = udp, tcp
+		break
+	}
+	if config != nil {
+		s.tcp = tls.NewListener(s.tcp, config)
+	} else {
+		go s.servePacket()
+	}
+	go s.serveStream()
+	return s
+}
+
+func (s *testServer) servePacket() {
+	buf := make([]byte, ednsSize)
+	for {
+		n, addr, err := s.udp.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		s.udp.WriteTo(s.respond(buf[:n], true), addr)
+	}
+}
+
+func (s *testServer) serveStream() {
+	for {
+		c, err := s.tcp.Accept()
+		if err != nil {
+			return
+		}
+		atomic.AddInt32(&s.conns, 1)
+		go func() {
+			defer c.Close()
+			for {
+				b, err := readStreamMessage(c)
+				if err != nil {
+					return
+				}
+				if err := writeStreamMessage(c, s.respond(b, false)); err != nil {
+					return
+				}
+			}
+		}()
+	}
+}
+
+func (s *testServer) respond(b []byte, udp bool) []byte {
+	atomic.AddInt32(&s.queries, 1)
+	query, err := parseMessage(b)
+	if err != nil {
+		panic(err)
+	}
+	resp := *s.handler(query.questions[0])
+	resp.id = query.id
+	resp.flags |= flagQR
+	resp.questions = query.questions
+	if udp && atomic.LoadInt32(&s.truncate) != 0 {
+		resp.flags |= flagTC
+		resp.answers = nil
+	}
+	return resp.pack()
+}
+
+func (s *testServer) upstream() Upstream {
+	addr := s.udp.LocalAddr().(*net.UDPAddr)
+	return Upstream{IP: addr.IP, Port: uint16(addr.Port)}
+}
+
+func (s *testServer) close() {
+	s.udp.Close()
+	s.tcp.Close()
+}
+
+// answerA returns a handler that answers all queries with an A record.
+func answerA(ttl uint32) func(q question) *message {
+	return func(q question) *message {
+		return &message{
+			answers: []resource{{name: q.name, typ: 1, cls: 1, ttl: ttl, data: []byte{192, 0, 2, 1}}},
+		}
+	}
+}
+
+// nxdomain returns a handler that answers all queries with NXDOMAIN, with a
+// SOA record if soa is true.
+func nxdomain(soa bool) func(q question) *message {
+	return func(q question) *message {
+		m := &message{flags: rcodeNameError}
+		if soa {
+			m.authorities = []resource{{
+				name: "\x07example\x00",
+				typ:  typeSOA,
+				cls:  1,
+				ttl:  60,
+				data: append([]byte("\x02ns\x00\x05admin\x00"), make([]byte, 20)...),
+			}}
+			binary.BigEndian.PutUint32(m.authorities[0].data[len(m.authorities[0].data)-4:], 30)
+		}
+		return m
+	}
+}
+
+func newTestResolver(t *testing.T, cfg Config) *Resolver {
+	cfg.Dialer = hostDialer{}
+	r, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	return r
+}
+
+// query returns a query for name and type A.
+func query(t *testing.T, name string, edns bool) []byte {
+	m := &message{
+		id:        0x4242,
+		flags:     flagRD,
+		questions: []question{{mustEncodeName(t, name), 1, 1}},
+	}
+	if edns {
+		m.additionals = []resource{{name: "\x00", typ: typeOPT, cls: ednsSize}}
+	}
+	return m.pack()
+}
+
+// resolve resolves the query for name and type A with r.
+func resolve(t *testing.T, r *Resolver, name string) *message {
+	b := r.Resolve(query(t, name, false))
+	resp, err := parseMessage(b)
+	if err != nil {
+		t.Fatalf("parseMessage(%v) failed: %v", b, err)
+	}
+	if resp.id != 0x4242 || resp.flags&flagQR == 0 {
+		t.Fatalf("response %+v doesn't answer the query", resp)
+	}
+	return resp
+}
+
+func TestResolve(t *testing.T) {
+	s := newTestServer(t, answerA(300), nil)
+	defer s.close()
+	r := newTestResolver(t, Config{Upstreams: []Upstream{s.upstream()}})
+
+	resp := resolve(t, r, "WWW.example.com")
+	if resp.rcode() != rcodeSuccess {
+		t.Fatalf("got rcode %d, want %d", resp.rcode(), rcodeSuccess)
+	}
+	if got, want := resp.questions[0].name, mustEncodeName(t, "WWW.example.com"); got != want {
+		t.Errorf("got question for %q, want %q", got, want)
+	}
+	want := []resource{{name: mustEncodeName(t, "www.example.com"), typ: 1, cls: 1, ttl: 300, data: []byte{192, 0, 2, 1}}}
+	if !reflect.DeepEqual(resp.answers, want) {
+		t.Errorf("got answers %+v, want %+v", resp.answers, want)
+	}
+}
+
+func TestResolveCache(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		handler func(q question) *message
+		queries int32
+	}{
+		{"positive", answerA(300), 1},
+		{"zero TTL", answerA(0), 2},
+		{"negative", nxdomain(true), 1},
+		{"negative without SOA", nxdomain(false), 2},
+	} {
+		s := newTestServer(t, test.handler, nil)
+		r := newTestResolver(t, Config{
+			Upstreams: []Upstream{s.upstream()},
+			CacheSize: 10,
+		})
+		first := resolve(t, r, "www.example.com")
+		second := resolve(t, r, "WWW.EXAMPLE.COM")
+		if got := atomic.LoadInt32(&s.queries); got != test.queries {
+			t.Errorf("%s: upstream got %d queries, want %d", test.name, got, test.queries)
+		}
+		if first.rcode() != second.rcode() || len(first.answers) != len(second.answers) || len(first.authorities) != len(second.authorities) {
+			t.Errorf("%s: cached response %+v differs from %+v", test.name, second, first)
+		}
+		s.close()
+	}
+}
+
+func TestCacheEviction(t *testing.T) {
+	c := newCache(2)
+	now := time.Now()
+	m := answerA(60)(question{})
+	for _, name := range []string{"a", "b", "c"} {
+		c.put(question{name: name}, m, now)
+	}
+	if _, ok := c.get(question{name: "a"}, now); ok {
+		t.Errorf("least recently used entry wasn't evicted")
+	}
+	got, ok := c.get(question{name: "c"}, now.Add(50*time.Second))
+	if !ok {
+		t.Fatalf("entry is not cached")
+	}
+	if got.answers[0].ttl != 10 {
+		t.Errorf("got TTL %d after 50 seconds, want 10", got.answers[0].ttl)
+	}
+	if _, ok := c.get(question{name: "c"}, now.Add(time.Minute)); ok {
+		t.Errorf("expired entry is still cached")
+	}
+}
+
+func TestResolveSearch(t *testing.T) {
+	target := mustEncodeName(t, "db.corp.example")
+	s := newTestServer(t, func(q question) *message {
+		if canonical(q.name) == target {
+			return answerA(300)(q)
+		}
+		return nxdomain(false)(q)
+	}, nil)
+	defer s.close()
+	r := newTestResolver(t, Config{
+		Upstreams: []Upstream{s.upstream()},
+		Search:    []string{"other.example", "corp.example."},
+	})
+
+	resp := resolve(t, r, "DB")
+	if resp.rcode() != rcodeSuccess || len(resp.answers) != 2 {
+		t.Fatalf("got response %+v, want CNAME and A records", resp)
+	}
+	alias := resource{name: mustEncodeName(t, "DB"), typ: typeCNAME, cls: 1, ttl: 300, data: []byte(target)}
+	if !reflect.DeepEqual(resp.answers[0], alias) {
+		t.Errorf("got %+v, want %+v", resp.answers[0], alias)
+	}
+	if resp.answers[1].name != target {
+		t.Errorf("got A record for %q, want %q", resp.answers[1].name, target)
+	}
+
+	// Names with enough dots are resolved as is.
+	if resp := resolve(t, r, "db.corp"); resp.rcode() != rcodeNameError {
+		t.Errorf("got rcode %d, want %d", resp.rcode(), rcodeNameError)
+	}
+}
+
+func TestResolveSearchRoot(t *testing.T) {
+	var names []string
+	var mu sync.Mutex
+	s := newTestServer(t, func(q question) *message {
+		mu.Lock()
+		names = append(names, q.name)
+		mu.Unlock()
+		return answerA(300)(q)
+	}, nil)
+	defer s.close()
+	r := newTestResolver(t, Config{
+		Upstreams: []Upstream{s.upstream()},
+		Search:    []string{"corp.example"},
+	})
+
+	resp := resolve(t, r, ".")
+	want := []resource{{name: "\x00", typ: 1, cls: 1, ttl: 300, data: []byte{192, 0, 2, 1}}}
+	if !reflect.DeepEqual(resp.answers, want) {
+		t.Errorf("got answers %+v, want %+v", resp.answers, want)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(names) != 1 || names[0] != "\x00" {
+		t.Errorf("upstream got queries for %q, want only the root", names)
+	}
+}
+
+func TestResolveFailover(t *testing.T) {
+	failing := newTestServer(t, func(q question) *message {
+		return &message{flags: rcodeServerFailure}
+	}, nil)
+	defer failing.close()
+	good := newTestServer(t, answerA(300), nil)
+	defer good.close()
+
+	// silent never answers.
+	silent, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("ListenUDP failed: %v", err)
+	}
+	defer silent.Close()
+	silentAddr := silent.LocalAddr().(*net.UDPAddr)
+
+	r := newTestResolver(t, Config{
+		Upstreams: []Upstream{
+			{IP: silentAddr.IP, Port: uint16(silentAddr.Port)},
+			failing.upstream(),
+			good.upstream(),
+		},
+		Timeout: 100 * time.Millisecond,
+	})
+	if resp := resolve(t, r, "www.example.com"); resp.rcode() != rcodeSuccess || len(resp.answers) != 1 {
+		t.Errorf("got response %+v, want an answer from the last upstream", resp)
+	}
+
+	r = newTestResolver(t, Config{Upstreams: []Upstream{failing.upstream()}})
+	if resp := resolve(t, r, "www.example.com"); resp.rcode() != rcodeServerFailure {
+		t.Errorf("got rcode %d, want %d", resp.rcode(), rcodeServerFailure)
+	}
+}
+
+func TestResolveTCPFallback(t *testing.T) {
+	s := newTestServer(t, answerA(300), nil)
+	defer s.close()
+	atomic.StoreInt32(&s.truncate, 1)
+	r := newTestResolver(t, Config{Upstreams: []Upstream{s.upstream()}})
+
+	if resp := resolve(t, r, "www.example.com"); len(resp.answers) != 1 {
+		t.Errorf("got response %+v, want an answer over TCP", resp)
+	}
+	if got := atomic.LoadInt32(&s.conns); got != 1 {
+		t.Errorf("upstream got %d TCP connections, want 1", got)
+	}
+}
+
+func TestRespondTruncates(t *testing.T) {
+	s := newTestServer(t, func(q question) *message {
+		m := &message{}
+		for i := 0; i < 40; i++ {
+			m.answers = append(m.answers, resource{name: q.name, typ: 1, cls: 1, ttl: 300, data: []byte{192, 0, 2, byte(i)}})
+		}
+		return m
+	}, nil)
+	defer s.close()
+	r := newTestResolver(t, Config{Upstreams: []Upstream{s.upstream()}})
+
+	for _, test := range []struct {
+		edns      bool
+		truncated bool
+	}{
+		{false, true},
+		{true, false},
+	} {
+		b := r.respond(query(t, "www.example.com", test.edns), true)
+		resp, err := parseMessage(b)
+		if err != nil {
+			t.Fatalf("parseMessage failed: %v", err)
+		}
+		if truncated := resp.flags&flagTC != 0; truncated != test.truncated {
+			t.Errorf("with EDNS %t, got truncated %t, want %t", test.edns, truncated, test.truncated)
+		}
+		if _, ok := resp.edns(); ok != test.edns {
+			t.Errorf("with EDNS %t, got OPT record %t", test.edns, ok)
+		}
+	}
+}
+
+func TestResolveTLS(t *testing.T) {
+	// httptest's certificate is valid for example.com and 127.0.0.1.
+	h := httptest.NewTLSServer(nil)
+	config := h.TLS
+	roots := x509.NewCertPool()
+	roots.AddCert(h.Certificate())
+	h.Close()
+
+	s := newTestServer(t, answerA(300), config)
+	defer s.close()
+	u := s.upstream()
+	u.TLS = true
+	u.ServerName = "example.com"
+	r := newTestResolver(t, Config{
+		Upstreams: []Upstream{u},
+		RootCAs:   roots,
+	})
+	for i := 0; i < 3; i++ {
+		if resp := resolve(t, r, "www.example.com"); len(resp.answers) != 1 {
+			t.Errorf("got response %+v, want an answer over TLS", resp)
+		}
+	}
+	if got := atomic.LoadInt32(&s.conns); got != 1 {
+		t.Errorf("upstream got %d TLS connections, want 1", got)
+	}
+
+	// The certificate must be valid for the server name.
+	u.ServerName = "example.org"
+	r = newTestResolver(t, Config{
+		Upstreams: []Upstream{u},
+		RootCAs:   roots,
+	})
+	if resp := resolve(t, r, "www.example.com"); resp.rcode() != rcodeServerFailure {
+		t.Errorf("got rcode %d, want %d", resp.rcode(), rcodeServerFailure)
+	}
+}
+
+func TestServe(t *testing.T) {
+	s := newTestServer(t, answerA(300), nil)
+	defer s.close()
+	r := newTestResolver(t, Config{Upstreams: []Upstream{s.upstream()}})
+
+	pc, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("ListenUDP failed: %v", err)
+	}
+	defer pc.Close()
+	go r.ServePacket(pc)
+	l, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("ListenTCP failed: %v", err)
+	}
+	defer l.Close()
+	go r.Serve(l)
+
+	uc, err := net.DialUDP("udp", nil, pc.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatalf("DialUDP failed: %v", err)
+	}
+	defer uc.Close()
+	tc, err := net.DialTCP("tcp", nil, l.Addr().(*net.TCPAddr))
+	if err != nil {
+		t.Fatalf("DialTCP failed: %v", err)
+	}
+	defer tc.Close()
+
+	for _, c := range []net.Conn{uc, tc} {
+		c.SetDeadline(time.Now().Add(5 * time.Second))
+		var b []byte
+		if c == uc {
+			if _, err := c.Write(query(t, "www.example.com", false)); err != nil {
+				t.Fatalf("Write failed: %v", err)
+			}
+			b = make([]byte, maxUDPSize)
+			n, err := c.Read(b)
+			if err != nil {
+				t.Fatalf("Read failed: %v", err)
+			}
+			b = b[:n]
+		} else {
+			if err := writeStreamMessage(c, query(t, "www.example.com", false)); err != nil {
+				t.Fatalf("writeStreamMessage failed: %v", err)
+			}
+			if b, err = readStreamMessage(c); err != nil {
+				t.Fatalf("readStreamMessage failed: %v", err)
+			}
+		}
+		resp, err := parseMessage(b)
+		if err != nil {
+			t.Fatalf("parseMessage failed: %v", err)
+		}
+		if resp.id != 0x4242 || len(resp.answers) != 1 {
+			t.Errorf("got response %+v, want an answer", resp)
+		}
+	}
+}
+
+func TestParseUpstream(t *testing.T) {
+	for _, test := range []struct {
+		s    string
+		want Upstream
+	}{
+		{"192.0.2.1", Upstream{IP: net.ParseIP("192.0.2.1").To4(), Port: 53}},
+		{"192.0.2.1:5353", Upstream{IP: net.ParseIP("192.0.2.1").To4(), Port: 5353}},
+		{"2001:db8::1", Upstream{IP: net.ParseIP("2001:db8::1"), Port: 53}},
+		{"[2001:db8::1]:5353", Upstream{IP: net.ParseIP("2001:db8::1"), Port: 5353}},
+		{"tls://192.0.2.1", Upstream{IP: net.ParseIP("192.0.2.1").To4(), Port: 853, TLS: true}},
+		{"tls://192.0.2.1:8853#dns.example", Upstream{IP: net.ParseIP("192.0.2.1").To4(), Port: 8853, TLS: true, ServerName: "dns.example"}},
+	} {
+		got, err := ParseUpstream(test.s)
+		if err != nil {
+			t.Errorf("ParseUpstream(%q) failed: %v", test.s, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ParseUpstream(%q) = %+v, want %+v", test.s, got, test.want)
+		}
+		if again, err := ParseUpstream(got.String()); err != nil || !reflect.DeepEqual(again, got) {
+			t.Errorf("ParseUpstream(%q) = %+v, %v; want %+v", got.String(), again, err, got)
+		}
+	}
+	for _, s := range []string{"", "dns.example", "192.0.2.1:0", "192.0.2.1:http", "udp://192.0.2.1"} {
+		if _, err := ParseUpstream(s); err == nil {
+			t.Errorf("ParseUpstream(%q) succeeded, want error", s)
+		}
+	}
+}
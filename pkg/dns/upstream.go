@@ -0,0 +1,320 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dns
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// dnsPort is the port of DNS over UDP and TCP.
+	dnsPort = 53
+
+	// tlsPort is the port of DNS over TLS (RFC 7858).
+	tlsPort = 853
+
+	// tlsPrefix is the prefix of DNS over TLS upstreams in their string
+	// form.
+	tlsPrefix = "tls://"
+
+	// maxIdleConns is the maximum number of idle connections that are
+	// kept open to each DNS over TLS upstream.
+	maxIdleConns = 2
+)
+
+// Dialer creates the sockets that a Resolver uses to reach its upstreams.
+type Dialer interface {
+	// ListenPacket returns an unconnected UDP socket that can send
+	// datagrams to addr.
+	ListenPacket(addr *net.UDPAddr) (net.PacketConn, error)
+
+	// DialTCP returns a TCP connection to addr.
+	DialTCP(addr *net.TCPAddr) (net.Conn, error)
+}
+
+// Upstream is a DNS server that a Resolver forwards queries to.
+type Upstream struct {
+	// IP and Port are the address of the server.
+	IP   net.IP
+	Port uint16
+
+	// TLS indicates that queries are sent with DNS over TLS. Otherwise
+	// they are sent over UDP, and over TCP if the response is truncated.
+	TLS bool
+
+	// ServerName is the name that the TLS certificate of the server is
+	// verified against. If ServerName is empty, the certificate must be
+	// valid for IP.
+	ServerName string
+}
+
+// ParseUpstream parses an upstream of the form "<ip>[:<port>]" for DNS over
+// UDP and TCP, or "tls://<ip>[:<port>][#<server name>]" for DNS over TLS. IPv6
+// addresses with a port must be enclosed in brackets.
+func ParseUpstream(s string) (Upstream, error) {
+	u := Upstream{Port: dnsPort}
+	addr := s
+	if strings.HasPrefix(addr, tlsPrefix) {
+		u.TLS = true
+		u.Port = tlsPort
+		addr = strings.TrimPrefix(addr, tlsPrefix)
+		if i := strings.IndexByte(addr, '#'); i >= 0 {
+			u.ServerName = addr[i+1:]
+			addr = addr[:i]
+		}
+	}
+	if u.IP = net.ParseIP(addr); u.IP == nil {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return Upstream{}, fmt.Errorf("invalid upstream %q: %v", s, err)
+		}
+		if u.IP = net.ParseIP(host); u.IP == nil {
+			return Upstream{}, fmt.Errorf("invalid upstream %q: %q is not an IP address", s, host)
+		}
+		p, err := strconv.ParseUint(port, 10, 16)
+		if err != nil || p == 0 {
+			return Upstream{}, fmt.Errorf("invalid upstream %q: invalid port %q", s, port)
+		}
+		u.Port = uint16(p)
+	}
+	// Dialers may rely on the length of the address to tell IPv4 from IPv6.
+	if ip4 := u.IP.To4(); ip4 != nil {
+		u.IP = ip4
+	}
+	return u, nil
+}
+
+// String returns u in the form accepted by ParseUpstream.
+func (u Upstream) String() string {
+	s := net.JoinHostPort(u.IP.String(), strconv.Itoa(int(u.Port)))
+	if u.TLS {
+		s = tlsPrefix + s
+		if u.ServerName != "" {
+			s += "#" + u.ServerName
+		}
+	}
+	return s
+}
+
+// exchange sends the query m to upstream i and returns its response.
+func (r *Resolver) exchange(i int, m *message) (*message, error) {
+	u := r.cfg.Upstreams[i]
+	if u.TLS {
+		return r.exchangeTLS(i, m)
+	}
+	resp, err := r.exchangeUDP(u, m)
+	if err != nil || resp.flags&flagTC == 0 {
+		return resp, err
+	}
+	// The response didn't fit in a datagram, so retry over TCP.
+	c, err := r.dial(u)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	return r.exchangeStream(c, m)
+}
+
+// exchangeUDP sends the query m to u over UDP and returns its response.
+func (r *Resolver) exchangeUDP(u Upstream, m *message) (*message, error) {
+	addr := &net.UDPAddr{IP: u.IP, Port: int(u.Port)}
+	c, err := r.cfg.Dialer.ListenPacket(addr)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	if err := c.SetDeadline(time.Now().Add(r.cfg.Timeout)); err != nil {
+		return nil, err
+	}
+	if _, err := c.WriteTo(m.pack(), addr); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, ednsSize)
+	for {
+		n, from, err := c.ReadFrom(buf)
+		if err != nil {
+			return nil, err
+		}
+		if ua, ok := from.(*net.UDPAddr); !ok || !ua.IP.Equal(addr.IP) || ua.Port != addr.Port {
+			continue
+		}
+		// Datagrams that don't answer the query may be spoofed, so
+		// keep waiting for the response.
+		if resp, err := parseMessage(buf[:n]); err == nil && answers(m, resp) {
+			return resp, nil
+		}
+	}
+}
+
+// exchangeTLS sends the query m to upstream i over TLS and returns its
+// response. Connections are reused for later queries.
+func (r *Resolver) exchangeTLS(i int, m *message) (*message, error) {
+	for {
+		r.mu.Lock()
+		var c net.Conn
+		reused := false
+		if idle := r.idle[i]; len(idle) > 0 {
+			c, r.idle[i] = idle[len(idle)-1], idle[:len(idle)-1]
+			reused = true
+		}
+		r.mu.Unlock()
+
+		if c == nil {
+			var err error
+			if c, err = r.dial(r.cfg.Upstreams[i]); err != nil {
+				return nil, err
+			}
+		}
+		resp, err := r.exchangeStream(c, m)
+		if err != nil {
+			c.Close()
+			if reused {
+				// The server may have closed the idle connection, so
+				// retry with a new one.
+				continue
+			}
+			return nil, err
+		}
+
+		r.mu.Lock()
+		if len(r.idle[i]) < maxIdleConns {
+			r.idle[i] = append(r.idle[i], c)
+			c = nil
+		}
+		r.mu.Unlock()
+		if c != nil {
+			c.Close()
+		}
+		return resp, nil
+	}
+}
+
+// dial returns a stream connection to u, over TLS if u.TLS is set.
+func (r *Resolver) dial(u Upstream) (net.Conn, error) {
+	addr := &net.TCPAddr{IP: u.IP, Port: int(u.Port)}
+	deadline := time.Now().Add(r.cfg.Timeout)
+
+	// The Dialer may not time out, so give up on it instead.
+	type result struct {
+		c   net.Conn
+		err error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		c, err := r.cfg.Dialer.DialTCP(addr)
+		ch <- result{c, err}
+	}()
+	var c net.Conn
+	select {
+	case res := <-ch:
+		if res.err != nil {
+			return nil, res.err
+		}
+		c = res.c
+	case <-time.After(time.Until(deadline)):
+		go func() {
+			if res := <-ch; res.c != nil {
+				res.c.Close()
+			}
+		}()
+		return nil, fmt.Errorf("timed out connecting to %v", addr)
+	}
+	if !u.TLS {
+		return c, nil
+	}
+
+	serverName := u.ServerName
+	if serverName == "" {
+		serverName = u.IP.String()
+	}
+	tc := tls.Client(c, &tls.Config{
+		ServerName: serverName,
+		RootCAs:    r.cfg.RootCAs,
+	})
+	if err := tc.SetDeadline(deadline); err != nil {
+		c.Close()
+		return nil, err
+	}
+	if err := tc.Handshake(); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("TLS handshake with %v failed: %v", u, err)
+	}
+	return tc, nil
+}
+
+// exchangeStream sends the query m over the stream connection c and returns
+// its response.
+func (r *Resolver) exchangeStream(c net.Conn, m *message) (*message, error) {
+	if err := c.SetDeadline(time.Now().Add(r.cfg.Timeout)); err != nil {
+		return nil, err
+	}
+	if err := writeStreamMessage(c, m.pack()); err != nil {
+		return nil, err
+	}
+	for {
+		b, err := readStreamMessage(c)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := parseMessage(b)
+		if err != nil {
+			return nil, err
+		}
+		if answers(m, resp) {
+			return resp, nil
+		}
+	}
+}
+
+// answers returns true if resp is a response to the query m.
+func answers(m, resp *message) bool {
+	return resp.flags&flagQR != 0 &&
+		resp.id == m.id &&
+		len(resp.questions) == 1 &&
+		resp.questions[0].typ == m.questions[0].typ &&
+		resp.questions[0].cls == m.questions[0].cls &&
+		canonical(resp.questions[0].name) == canonical(m.questions[0].name)
+}
+
+// readStreamMessage reads a message prefixed with its length, as sent over
+// TCP (RFC 1035, section 4.2.2).
+func readStreamMessage(r io.Reader) ([]byte, error) {
+	var length [2]byte
+	if _, err := io.ReadFull(r, length[:]); err != nil {
+		return nil, err
+	}
+	b := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// writeStreamMessage writes the message b prefixed with its length.
+func writeStreamMessage(w io.Writer, b []byte) error {
+	if len(b) > 0xffff {
+		return errors.New("DNS message too long")
+	}
+	_, err := w.Write(append(appendUint16(nil, uint16(len(b))), b...))
+	return err
+}
@@ -20,7 +20,9 @@ import (
 	"time"
 )
 
-type jsonLog struct {
+// Record is a single log statement, as emitted by JSONEmitter and kept by
+// RingEmitter.
+type Record struct {
 	Msg   string    `json:"msg"`
 	Level Level     `json:"level"`
 	Time  time.Time `json:"time"`
@@ -63,7 +65,7 @@ type JSONEmitter struct {
 
 // Emit implements Emitter.Emit.
 func (e JSONEmitter) Emit(level Level, timestamp time.Time, format string, v ...interface{}) {
-	j := jsonLog{
+	j := Record{
 		Msg:   fmt.Sprintf(format, v...),
 		Level: level,
 		Time:  timestamp,
@@ -0,0 +1,113 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RingEmitter is an Emitter that keeps the most recent log statements in
+// memory, so that they can be reported when the process crashes, even if the
+// log itself is lost or has been rotated away.
+type RingEmitter struct {
+	// mu protects the fields below.
+	mu sync.Mutex
+
+	// records is a circular buffer of the most recent records. next is the
+	// index of the next record to write, and full is true if records has
+	// wrapped around.
+	records []Record
+	next    int
+	full    bool
+}
+
+// NewRingEmitter returns a RingEmitter that keeps the most recent size log
+// statements.
+func NewRingEmitter(size int) *RingEmitter {
+	if size <= 0 {
+		panic(fmt.Sprintf("invalid ring size %d", size))
+	}
+	return &RingEmitter{records: make([]Record, size)}
+}
+
+// Emit implements Emitter.Emit.
+func (r *RingEmitter) Emit(level Level, timestamp time.Time, format string, v ...interface{}) {
+	rec := Record{
+		Msg:   fmt.Sprintf(format, v...),
+		Level: level,
+		Time:  timestamp,
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records[r.next] = rec
+	r.next++
+	if r.next == len(r.records) {
+		r.next = 0
+		r.full = true
+	}
+}
+
+// Records returns the kept log statements, oldest first.
+func (r *RingEmitter) Records() []Record {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.full {
+		return append([]Record(nil), r.records[:r.next]...)
+	}
+	recs := make([]Record, 0, len(r.records))
+	recs = append(recs, r.records[r.next:]...)
+	return append(recs, r.records[:r.next]...)
+}
+
+// recent is the *RingEmitter set by SetRecent, if any.
+var recent atomic.Value
+
+// SetRecent sets the RingEmitter whose records are returned by Recent and
+// written by DumpRecent. It does not add r to the log target; callers must
+// also include r in the Emitter passed to SetTarget.
+func SetRecent(r *RingEmitter) {
+	recent.Store(r)
+}
+
+// Recent returns the most recent log statements kept by the RingEmitter set
+// by SetRecent, oldest first, or nil if there is none.
+func Recent() []Record {
+	r, _ := recent.Load().(*RingEmitter)
+	if r == nil {
+		return nil
+	}
+	return r.Records()
+}
+
+// DumpRecent writes the log statements returned by Recent to w, in the same
+// format as GoogleEmitter. It is intended to be called just before the
+// process crashes.
+func DumpRecent(w io.Writer) {
+	recs := Recent()
+	if len(recs) == 0 {
+		return
+	}
+	e := GoogleEmitter{&Writer{Next: w}}
+	fmt.Fprintf(w, "*** Last %d log messages ***\n", len(recs))
+	for _, rec := range recs {
+		e.Emit(rec.Level, rec.Time, "%s", rec.Msg)
+	}
+	fmt.Fprintf(w, "*** End of log messages ***\n")
+}
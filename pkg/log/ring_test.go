@@ -0,0 +1,67 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRingEmitter(t *testing.T) {
+	r := NewRingEmitter(3)
+	if got := r.Records(); len(got) != 0 {
+		t.Errorf("Records got %v want none", got)
+	}
+
+	for i := 0; i < 5; i++ {
+		r.Emit(Info, time.Now(), "msg %d", i)
+	}
+	var msgs []string
+	for _, rec := range r.Records() {
+		msgs = append(msgs, rec.Msg)
+	}
+	want := []string{"msg 2", "msg 3", "msg 4"}
+	if strings.Join(msgs, ",") != strings.Join(want, ",") {
+		t.Errorf("Records got %v want %v", msgs, want)
+	}
+}
+
+func TestDumpRecent(t *testing.T) {
+	defer SetRecent(nil)
+
+	var b bytes.Buffer
+	DumpRecent(&b)
+	if b.Len() != 0 {
+		t.Errorf("DumpRecent without a ring got %q want nothing", b.String())
+	}
+
+	r := NewRingEmitter(2)
+	SetRecent(r)
+	r.Emit(Warning, time.Now(), "first")
+	r.Emit(Debug, time.Now(), "second %s", "message")
+	DumpRecent(&b)
+
+	out := b.String()
+	if !strings.Contains(out, "*** Last 2 log messages ***") {
+		t.Errorf("DumpRecent got %q, missing header", out)
+	}
+	first := strings.Index(out, "] first\n")
+	second := strings.Index(out, "] second message\n")
+	if first < 0 || second < first {
+		t.Errorf("DumpRecent got %q, want both messages in order", out)
+	}
+}
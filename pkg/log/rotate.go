@@ -0,0 +1,135 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"syscall"
+)
+
+// RotatingFile is an io.Writer that appends to a log file, and moves the file
+// aside when it grows beyond a maximum size. The file at path is renamed to
+// path.1, path.1 to path.2, and so on, and the oldest file is discarded.
+//
+// Several processes may write to the same path, as runsc commands do with
+// --log. They coordinate with an advisory lock on the file so that only one of
+// them rotates it. The others keep appending to the moved file until it is
+// full, and then reopen path.
+type RotatingFile struct {
+	path     string
+	perm     os.FileMode
+	maxSize  int64
+	maxFiles int
+
+	// mu protects f.
+	mu sync.Mutex
+	f  *os.File
+}
+
+// OpenRotatingFile opens the log file at path for appending, creating it with
+// perm if necessary. The file is rotated once it would grow beyond maxSize
+// bytes, and at most maxFiles rotated files are kept.
+func OpenRotatingFile(path string, perm os.FileMode, maxSize int64, maxFiles int) (*RotatingFile, error) {
+	if maxSize <= 0 {
+		return nil, fmt.Errorf("invalid maximum size %d", maxSize)
+	}
+	if maxFiles <= 0 {
+		return nil, fmt.Errorf("invalid maximum number of files %d", maxFiles)
+	}
+	f, err := openAppend(path, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &RotatingFile{
+		path:     path,
+		perm:     perm,
+		maxSize:  maxSize,
+		maxFiles: maxFiles,
+		f:        f,
+	}, nil
+}
+
+// openAppend opens path for appending. O_TRUNC must not be used, because the
+// file may be shared with other processes.
+func openAppend(path string, perm os.FileMode) (*os.File, error) {
+	return os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, perm)
+}
+
+// Write implements io.Writer.Write.
+func (r *RotatingFile) Write(b []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// The size is checked on every write, rather than tracked, because other
+	// processes may be appending to the same file.
+	if fi, err := r.f.Stat(); err == nil && fi.Size() > 0 && fi.Size()+int64(len(b)) > r.maxSize {
+		if err := r.rotateLocked(); err != nil {
+			// Keep writing to the current file rather than dropping
+			// the log.
+			fmt.Fprintf(r.f, "*** Failed to rotate log file: %v ***\n", err)
+		}
+	}
+	return r.f.Write(b)
+}
+
+// rotateLocked moves the current file aside, unless another process already
+// has, and reopens path.
+//
+// Preconditions: r.mu must be locked.
+func (r *RotatingFile) rotateLocked() error {
+	if err := syscall.Flock(int(r.f.Fd()), syscall.LOCK_EX); err != nil {
+		return err
+	}
+	// The lock is released when the file is closed below, or explicitly on
+	// failure.
+	cur, err := r.f.Stat()
+	if err != nil {
+		syscall.Flock(int(r.f.Fd()), syscall.LOCK_UN)
+		return err
+	}
+	if fi, err := os.Stat(r.path); err == nil && os.SameFile(fi, cur) {
+		// Still the file at path, so it's ours to rotate.
+		for i := r.maxFiles - 1; i > 0; i-- {
+			from := fmt.Sprintf("%s.%d", r.path, i)
+			to := fmt.Sprintf("%s.%d", r.path, i+1)
+			if err := os.Rename(from, to); err != nil && !os.IsNotExist(err) {
+				syscall.Flock(int(r.f.Fd()), syscall.LOCK_UN)
+				return err
+			}
+		}
+		if err := os.Rename(r.path, r.path+".1"); err != nil {
+			syscall.Flock(int(r.f.Fd()), syscall.LOCK_UN)
+			return err
+		}
+	}
+
+	f, err := openAppend(r.path, r.perm)
+	if err != nil {
+		syscall.Flock(int(r.f.Fd()), syscall.LOCK_UN)
+		return err
+	}
+	r.f.Close()
+	r.f = f
+	return nil
+}
+
+// Close closes the current file.
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.f.Close()
+}
@@ -0,0 +1,108 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func readFile(t *testing.T, path string) string {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile(%q) failed: %v", path, err)
+	}
+	return string(b)
+}
+
+func TestRotatingFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotate")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "log")
+
+	r, err := OpenRotatingFile(path, 0644, 10, 2)
+	if err != nil {
+		t.Fatalf("OpenRotatingFile failed: %v", err)
+	}
+	defer r.Close()
+
+	for _, s := range []string{"aaaa\n", "bbbb\n", "cccc\n", "dddd\n", "eeee\n", "ffff\n", "gggg\n"} {
+		if _, err := r.Write([]byte(s)); err != nil {
+			t.Fatalf("Write(%q) failed: %v", s, err)
+		}
+	}
+
+	for _, tc := range []struct {
+		path string
+		want string
+	}{
+		{path, "gggg\n"},
+		{path + ".1", "eeee\nffff\n"},
+		{path + ".2", "cccc\ndddd\n"},
+	} {
+		if got := readFile(t, tc.path); got != tc.want {
+			t.Errorf("%s got %q want %q", tc.path, got, tc.want)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("Stat(%s.3) got %v want not exist", path, err)
+	}
+}
+
+// TestRotatingFileShared tests that a file rotated by one writer is reopened,
+// and not rotated again, by another.
+func TestRotatingFileShared(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotate")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "log")
+
+	r1, err := OpenRotatingFile(path, 0644, 10, 2)
+	if err != nil {
+		t.Fatalf("OpenRotatingFile failed: %v", err)
+	}
+	defer r1.Close()
+	r2, err := OpenRotatingFile(path, 0644, 10, 2)
+	if err != nil {
+		t.Fatalf("OpenRotatingFile failed: %v", err)
+	}
+	defer r2.Close()
+
+	if _, err := r1.Write([]byte("aaaaaaaa\n")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	// Both writers see the file as full; r1 rotates it.
+	if _, err := r1.Write([]byte("bbbb\n")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	// r2 must reopen path rather than move it aside again.
+	if _, err := r2.Write([]byte("cccc\n")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	if got, want := readFile(t, path), "bbbb\ncccc\n"; got != want {
+		t.Errorf("%s got %q want %q", path, got, want)
+	}
+	if got, want := readFile(t, path+".1"), "aaaaaaaa\n"; got != want {
+		t.Errorf("%s.1 got %q want %q", path, got, want)
+	}
+}
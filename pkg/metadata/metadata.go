@@ -0,0 +1,243 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package metadata implements an HTTP server that emulates the metadata
+// service of cloud providers, such as the one at 169.254.169.254 on GCE and
+// EC2. Its responses are supplied by a Config, so that applications using
+// cloud SDKs can be tested hermetically, and credentials can be injected
+// without reaching agents on the host.
+package metadata
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+
+	"gvisor.googlesource.com/gvisor/pkg/log"
+)
+
+// DefaultAddress is the address of the metadata service of most cloud
+// providers.
+const DefaultAddress = "169.254.169.254"
+
+// Config is the content of a metadata service. It is stored as JSON, for
+// example:
+//
+//	{
+//	  "headers": {"Metadata-Flavor": "Google"},
+//	  "required_headers": {"Metadata-Flavor": "Google"},
+//	  "entries": [
+//	    {"path": "/computeMetadata/v1/project/project-id", "body": "test-project"},
+//	    {"path": "/computeMetadata/v1/instance/service-accounts/default/token",
+//	     "content_type": "application/json",
+//	     "body": "{\"access_token\": \"fake\", \"expires_in\": 3600, \"token_type\": \"Bearer\"}"},
+//	    {"method": "PUT", "path": "/latest/api/token", "body": "fake-session-token"}
+//	  ]
+//	}
+//
+// A GET request for a path that ends with a slash and has no entry lists the
+// names under it, one per line, with a trailing slash for those that have
+// names under them, as GCE and EC2 do for directories.
+type Config struct {
+	// Address is the address of the service in the sandbox network. If it
+	// is empty, DefaultAddress is used.
+	Address string `json:"address,omitempty"`
+
+	// Headers are added to all responses.
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// RequiredHeaders must be present with the given values in all
+	// requests, which are otherwise rejected with 403 Forbidden. GCE
+	// requires "Metadata-Flavor: Google", for example.
+	RequiredHeaders map[string]string `json:"required_headers,omitempty"`
+
+	// Entries are the responses of the service.
+	Entries []Entry `json:"entries"`
+}
+
+// Entry is the response of the metadata service to requests for a path.
+type Entry struct {
+	// Method is the method of the requests, GET by default. GET entries
+	// also answer HEAD requests.
+	Method string `json:"method,omitempty"`
+
+	// Path is the path of the requests, which starts with a slash. The
+	// query of the requests is ignored.
+	Path string `json:"path"`
+
+	// Status is the status code of the response, 200 by default.
+	Status int `json:"status,omitempty"`
+
+	// ContentType is the Content-Type of the response, text/plain by
+	// default.
+	ContentType string `json:"content_type,omitempty"`
+
+	// Headers are added to the response, after the headers of the Config.
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// Body is the body of the response.
+	Body string `json:"body"`
+}
+
+// Validate returns an error if the config is malformed.
+func (c *Config) Validate() error {
+	_, err := New(c)
+	return err
+}
+
+// IP returns the address of the service.
+func (c *Config) IP() (net.IP, error) {
+	addr := c.Address
+	if addr == "" {
+		addr = DefaultAddress
+	}
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid address %q", addr)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	return ip, nil
+}
+
+// Handler serves the entries of a Config over HTTP.
+type Handler struct {
+	headers         http.Header
+	requiredHeaders http.Header
+
+	// entries are the entries of the config, by path and method.
+	entries map[string]map[string]*Entry
+
+	// dirs are the names listed by each directory, by path.
+	dirs map[string][]string
+}
+
+// New returns a Handler serving the entries of c.
+func New(c *Config) (*Handler, error) {
+	if _, err := c.IP(); err != nil {
+		return nil, err
+	}
+	h := &Handler{
+		headers:         makeHeader(c.Headers),
+		requiredHeaders: makeHeader(c.RequiredHeaders),
+		entries:         make(map[string]map[string]*Entry),
+		dirs:            make(map[string][]string),
+	}
+	dirs := make(map[string]map[string]bool)
+	for i := range c.Entries {
+		e := &c.Entries[i]
+		if !strings.HasPrefix(e.Path, "/") {
+			return nil, fmt.Errorf("entry %d: path %q doesn't start with a slash", i, e.Path)
+		}
+		if e.Status != 0 && (e.Status < 100 || e.Status > 599) {
+			return nil, fmt.Errorf("entry %d: invalid status %d", i, e.Status)
+		}
+		method := e.Method
+		if method == "" {
+			method = http.MethodGet
+		}
+		if strings.ToUpper(method) != method || strings.ContainsAny(method, " \t/") {
+			return nil, fmt.Errorf("entry %d: invalid method %q", i, e.Method)
+		}
+		methods := h.entries[e.Path]
+		if methods == nil {
+			methods = make(map[string]*Entry)
+			h.entries[e.Path] = methods
+		}
+		if methods[method] != nil {
+			return nil, fmt.Errorf("entry %d: duplicate entry for %s %s", i, method, e.Path)
+		}
+		methods[method] = e
+
+		// Add the path to the listings of its parent directories.
+		name := e.Path
+		for name != "/" {
+			dir := name[:strings.LastIndex(strings.TrimSuffix(name, "/"), "/")+1]
+			if dirs[dir] == nil {
+				dirs[dir] = make(map[string]bool)
+			}
+			dirs[dir][name[len(dir):]] = true
+			name = dir
+		}
+	}
+	for dir, names := range dirs {
+		for name := range names {
+			h.dirs[dir] = append(h.dirs[dir], name)
+		}
+		sort.Strings(h.dirs[dir])
+	}
+	return h, nil
+}
+
+func makeHeader(m map[string]string) http.Header {
+	h := make(http.Header)
+	for k, v := range m {
+		h.Set(k, v)
+	}
+	return h
+}
+
+// ServeHTTP implements http.Handler.ServeHTTP.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log.Debugf("Metadata request %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+	for k, v := range h.headers {
+		w.Header()[k] = v
+	}
+	for k := range h.requiredHeaders {
+		if r.Header.Get(k) != h.requiredHeaders.Get(k) {
+			http.Error(w, fmt.Sprintf("Missing required header %q", k), http.StatusForbidden)
+			return
+		}
+	}
+
+	method := r.Method
+	if method == http.MethodHead {
+		method = http.MethodGet
+	}
+	if methods, ok := h.entries[r.URL.Path]; ok {
+		e, ok := methods[method]
+		if !ok {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		for k, v := range e.Headers {
+			w.Header().Set(k, v)
+		}
+		contentType := e.ContentType
+		if contentType == "" {
+			contentType = "text/plain"
+		}
+		w.Header().Set("Content-Type", contentType)
+		status := e.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		w.WriteHeader(status)
+		if r.Method != http.MethodHead {
+			w.Write([]byte(e.Body))
+		}
+		return
+	}
+	if names, ok := h.dirs[r.URL.Path]; ok && method == http.MethodGet {
+		w.Header().Set("Content-Type", "text/plain")
+		if r.Method != http.MethodHead {
+			w.Write([]byte(strings.Join(names, "\n")))
+		}
+		return
+	}
+	http.NotFound(w, r)
+}
@@ -0,0 +1,171 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metadata
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const testConfig = `{
+  "headers": {"Metadata-Flavor": "Google"},
+  "required_headers": {"Metadata-Flavor": "Google"},
+  "entries": [
+    {"path": "/computeMetadata/v1/project/project-id", "body": "test-project"},
+    {"path": "/computeMetadata/v1/project/numeric-project-id", "body": "42"},
+    {"path": "/computeMetadata/v1/instance/service-accounts/default/token",
+     "content_type": "application/json",
+     "body": "{\"access_token\": \"fake\"}"},
+    {"path": "/computeMetadata/v1/instance/zone", "status": 503, "headers": {"Retry-After": "1"}, "body": "unavailable"},
+    {"method": "PUT", "path": "/latest/api/token", "body": "session"}
+  ]
+}`
+
+func TestHandler(t *testing.T) {
+	var c Config
+	if err := json.Unmarshal([]byte(testConfig), &c); err != nil {
+		t.Fatalf("error parsing config: %v", err)
+	}
+	h, err := New(&c)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	for _, test := range []struct {
+		method      string
+		path        string
+		flavor      string
+		status      int
+		contentType string
+		body        string
+	}{
+		{
+			method:      "GET",
+			path:        "/computeMetadata/v1/project/project-id?alt=text",
+			flavor:      "Google",
+			status:      http.StatusOK,
+			contentType: "text/plain",
+			body:        "test-project",
+		},
+		{
+			method:      "GET",
+			path:        "/computeMetadata/v1/instance/service-accounts/default/token",
+			flavor:      "Google",
+			status:      http.StatusOK,
+			contentType: "application/json",
+			body:        `{"access_token": "fake"}`,
+		},
+		{
+			method: "HEAD",
+			path:   "/computeMetadata/v1/project/project-id",
+			flavor: "Google",
+			status: http.StatusOK,
+		},
+		{
+			method: "GET",
+			path:   "/computeMetadata/v1/project/project-id",
+			status: http.StatusForbidden,
+		},
+		{
+			method: "GET",
+			path:   "/computeMetadata/v1/instance/zone",
+			flavor: "Google",
+			status: http.StatusServiceUnavailable,
+			body:   "unavailable",
+		},
+		{
+			method: "GET",
+			path:   "/computeMetadata/v1/project/",
+			flavor: "Google",
+			status: http.StatusOK,
+			body:   "numeric-project-id\nproject-id",
+		},
+		{
+			method: "GET",
+			path:   "/computeMetadata/v1/",
+			flavor: "Google",
+			status: http.StatusOK,
+			body:   "instance/\nproject/",
+		},
+		{
+			method: "GET",
+			path:   "/computeMetadata/v1/project",
+			flavor: "Google",
+			status: http.StatusNotFound,
+		},
+		{
+			method: "PUT",
+			path:   "/latest/api/token",
+			flavor: "Google",
+			status: http.StatusOK,
+			body:   "session",
+		},
+		{
+			method: "GET",
+			path:   "/latest/api/token",
+			flavor: "Google",
+			status: http.StatusMethodNotAllowed,
+		},
+	} {
+		req := httptest.NewRequest(test.method, test.path, nil)
+		if test.flavor != "" {
+			req.Header.Set("Metadata-Flavor", test.flavor)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		resp := w.Result()
+		body, _ := ioutil.ReadAll(resp.Body)
+		if resp.StatusCode != test.status {
+			t.Errorf("%s %s: got status %d, want %d", test.method, test.path, resp.StatusCode, test.status)
+		}
+		if got := resp.Header.Get("Metadata-Flavor"); got != "Google" {
+			t.Errorf("%s %s: got Metadata-Flavor %q, want %q", test.method, test.path, got, "Google")
+		}
+		if test.contentType != "" && resp.Header.Get("Content-Type") != test.contentType {
+			t.Errorf("%s %s: got Content-Type %q, want %q", test.method, test.path, resp.Header.Get("Content-Type"), test.contentType)
+		}
+		if test.body != "" && string(body) != test.body {
+			t.Errorf("%s %s: got body %q, want %q", test.method, test.path, body, test.body)
+		}
+		if test.method == "HEAD" && len(body) != 0 {
+			t.Errorf("%s %s: got body %q, want none", test.method, test.path, body)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, c := range []Config{
+		{Address: "metadata"},
+		{Entries: []Entry{{Path: "relative"}}},
+		{Entries: []Entry{{Path: "/a", Status: 42}}},
+		{Entries: []Entry{{Path: "/a", Method: "get"}}},
+		{Entries: []Entry{{Path: "/a"}, {Path: "/a", Method: "GET"}}},
+	} {
+		if err := c.Validate(); err == nil {
+			t.Errorf("Validate(%+v) succeeded", c)
+		}
+	}
+	c := Config{Entries: []Entry{{Path: "/a"}, {Path: "/a", Method: "PUT"}}}
+	if err := c.Validate(); err != nil {
+		t.Errorf("Validate(%+v) failed: %v", c, err)
+	}
+	ip, err := c.IP()
+	if err != nil || ip.String() != DefaultAddress || len(ip) != 4 {
+		t.Errorf("IP() = %v, %v; want %s", ip, err, DefaultAddress)
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metric
+
+import (
+	"fmt"
+	"sort"
+	"sync/atomic"
+
+	pb "gvisor.googlesource.com/gvisor/pkg/metric/metric_go_proto"
+)
+
+// DistributionMetric records the distribution of samples of some quantity,
+// such as a latency, as the number of samples that fall in each of a fixed
+// set of buckets.
+//
+// Samples are partitioned by the value of a single field, such as a syscall
+// number. Each field value has an independent distribution.
+//
+// Like Uint64Metric, DistributionMetrics are cumulative and are not saved
+// across save/restore.
+type DistributionMetric struct {
+	// metadata describes the metric. It is immutable.
+	metadata *pb.MetricMetadata
+
+	// bounds are the exclusive upper bounds of all buckets but the last,
+	// in increasing order. bounds is immutable.
+	bounds []uint64
+
+	// fieldValues are the values of the metric's field. fieldValues is
+	// immutable.
+	fieldValues []string
+
+	// dists contains the distribution for each element of fieldValues.
+	dists []distribution
+}
+
+// distribution is the distribution of samples for a single field value.
+type distribution struct {
+	// counts contains the number of samples in each bucket. Elements must
+	// be accessed atomically.
+	counts []uint64
+
+	// sum is the sum of all samples. It must be accessed atomically.
+	sum uint64
+}
+
+// ExponentialBounds returns n bucket bounds, starting at first and
+// increasing by a factor of factor.
+func ExponentialBounds(first, factor uint64, n int) []uint64 {
+	bounds := make([]uint64, n)
+	b := first
+	for i := range bounds {
+		bounds[i] = b
+		b *= factor
+	}
+	return bounds
+}
+
+// NewDistributionMetric creates a new distribution metric with the given
+// name, bucket bounds and field. Samples may be recorded for each of
+// fieldValues.
+//
+// Metrics must be statically defined (i.e., at startup).
+// NewDistributionMetric will return an error if called after Initialized.
+//
+// Preconditions:
+//  * name must be globally unique.
+//  * bounds must be in strictly increasing order.
+//  * Initialize/Disable have not been called.
+func NewDistributionMetric(name string, sync bool, description string, bounds []uint64, field string, fieldValues []string) (*DistributionMetric, error) {
+	if initialized {
+		return nil, ErrInitializationDone
+	}
+
+	if allMetrics.inUse(name) {
+		return nil, ErrNameInUse
+	}
+
+	d := &DistributionMetric{
+		metadata: &pb.MetricMetadata{
+			Name:         name,
+			Description:  description,
+			Cumulative:   true,
+			Sync:         sync,
+			Type:         pb.MetricMetadata_DISTRIBUTION,
+			Field:        field,
+			BucketBounds: bounds,
+		},
+		bounds:      bounds,
+		fieldValues: fieldValues,
+		dists:       make([]distribution, len(fieldValues)),
+	}
+	for i := range d.dists {
+		d.dists[i].counts = make([]uint64, len(bounds)+1)
+	}
+	allMetrics.d[name] = d
+	return d, nil
+}
+
+// MustCreateNewDistributionMetric calls NewDistributionMetric and panics if
+// it returns an error.
+func MustCreateNewDistributionMetric(name string, sync bool, description string, bounds []uint64, field string, fieldValues []string) *DistributionMetric {
+	d, err := NewDistributionMetric(name, sync, description, bounds, field, fieldValues)
+	if err != nil {
+		panic(fmt.Sprintf("Unable to create metric %q: %v", name, err))
+	}
+	return d
+}
+
+// Record adds sample v to the distribution for the field value at index
+// field in the metric's field values. Samples for out-of-range fields are
+// dropped.
+func (d *DistributionMetric) Record(field int, v uint64) {
+	if field < 0 || field >= len(d.dists) {
+		return
+	}
+	dist := &d.dists[field]
+	b := sort.Search(len(d.bounds), func(i int) bool {
+		return v < d.bounds[i]
+	})
+	atomic.AddUint64(&dist.counts[b], 1)
+	atomic.AddUint64(&dist.sum, v)
+}
+
+// Value returns the number of samples in each bucket and the sum of all
+// samples for the field value at index field.
+func (d *DistributionMetric) Value(field int) (counts []uint64, sum uint64) {
+	dist := &d.dists[field]
+	counts = make([]uint64, len(dist.counts))
+	for i := range counts {
+		counts[i] = atomic.LoadUint64(&dist.counts[i])
+	}
+	return counts, atomic.LoadUint64(&dist.sum)
+}
@@ -18,6 +18,7 @@ package metric
 import (
 	"errors"
 	"fmt"
+	"sort"
 	"sync"
 	"sync/atomic"
 
@@ -80,6 +81,9 @@ func Initialize() {
 	for _, v := range allMetrics.m {
 		m.Metrics = append(m.Metrics, v.metadata)
 	}
+	for _, v := range allMetrics.d {
+		m.Metrics = append(m.Metrics, v.metadata)
+	}
 	eventchannel.Emit(&m)
 }
 
@@ -114,7 +118,7 @@ func NewUint64Metric(name string, sync bool, description string) (*Uint64Metric,
 		return nil, ErrInitializationDone
 	}
 
-	if _, ok := allMetrics.m[name]; ok {
+	if allMetrics.inUse(name) {
 		return nil, ErrNameInUse
 	}
 
@@ -159,26 +163,81 @@ func (m *Uint64Metric) IncrementBy(v uint64) {
 // metricSet holds named metrics.
 type metricSet struct {
 	m map[string]*Uint64Metric
+	d map[string]*DistributionMetric
 }
 
 // makeMetricSet returns a new metricSet.
 func makeMetricSet() metricSet {
 	return metricSet{
 		m: make(map[string]*Uint64Metric),
+		d: make(map[string]*DistributionMetric),
 	}
 }
 
+// inUse returns true if a metric named name is in m.
+func (m *metricSet) inUse(name string) bool {
+	_, ok := m.m[name]
+	_, dok := m.d[name]
+	return ok || dok
+}
+
 // Values returns a snapshot of all values in m.
 func (m *metricSet) Values() metricValues {
-	vals := make(metricValues)
+	vals := metricValues{
+		m: make(map[string]uint64),
+		d: make(map[string][]distributionValue),
+	}
 	for k, v := range m.m {
-		vals[k] = v.Value()
+		vals.m[k] = v.Value()
+	}
+	for k, v := range m.d {
+		dvs := make([]distributionValue, len(v.dists))
+		for i := range dvs {
+			dvs[i].counts, dvs[i].sum = v.Value(i)
+		}
+		vals.d[k] = dvs
 	}
 	return vals
 }
 
 // metricValues contains a copy of the values of all metrics.
-type metricValues map[string]uint64
+type metricValues struct {
+	// m maps the names of Uint64Metrics to their values.
+	m map[string]uint64
+
+	// d maps the names of DistributionMetrics to their values for each
+	// field value.
+	d map[string][]distributionValue
+}
+
+// distributionValue is a copy of a distribution.
+type distributionValue struct {
+	counts []uint64
+	sum    uint64
+}
+
+// empty returns true if d contains no samples.
+func (d distributionValue) empty() bool {
+	for _, c := range d.counts {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// equal returns true if d and o contain the same samples.
+func (d distributionValue) equal(o distributionValue) bool {
+	if d.sum != o.sum || len(d.counts) != len(o.counts) {
+		return false
+	}
+	for i := range d.counts {
+		if d.counts[i] != o.counts[i] {
+			return false
+		}
+	}
+	return true
+}
 
 var (
 	// emitMu protects metricsAtLastEmit and ensures that all emitted
@@ -205,16 +264,36 @@ func EmitMetricUpdate() {
 	snapshot := allMetrics.Values()
 
 	m := pb.MetricUpdate{}
-	for k, v := range snapshot {
+	for k, v := range snapshot.m {
 		// On the first call metricsAtLastEmit will be empty. Include
 		// all metrics then.
-		if prev, ok := metricsAtLastEmit[k]; !ok || prev != v {
+		if prev, ok := metricsAtLastEmit.m[k]; !ok || prev != v {
 			m.Metrics = append(m.Metrics, &pb.MetricValue{
 				Name:  k,
 				Value: &pb.MetricValue_Uint64Value{v},
 			})
 		}
 	}
+	for k, dvs := range snapshot.d {
+		// Unlike Uint64Metrics, field values without samples are not
+		// included on the first call, since most field values
+		// typically have none.
+		prev := metricsAtLastEmit.d[k]
+		fieldValues := allMetrics.d[k].fieldValues
+		for i, dv := range dvs {
+			if prev == nil && dv.empty() || prev != nil && prev[i].equal(dv) {
+				continue
+			}
+			m.Metrics = append(m.Metrics, &pb.MetricValue{
+				Name: k,
+				Value: &pb.MetricValue_DistributionValue{&pb.Distribution{
+					Counts: dv.counts,
+					Sum:    dv.sum,
+				}},
+				FieldValue: fieldValues[i],
+			})
+		}
+	}
 
 	metricsAtLastEmit = snapshot
 	if len(m.Metrics) == 0 {
@@ -224,3 +303,75 @@ func EmitMetricUpdate() {
 	log.Debugf("Emitting metrics: %v", m)
 	eventchannel.Emit(&m)
 }
+
+// MetricSnapshot is a copy of the value of a single metric, for export to
+// monitoring systems other than the event channel.
+type MetricSnapshot struct {
+	// Name, Description and Cumulative are as in the metric's metadata.
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Cumulative  bool   `json:"cumulative"`
+
+	// Distribution is true if the metric is a DistributionMetric.
+	Distribution bool `json:"distribution,omitempty"`
+
+	// Value is the value of a Uint64Metric.
+	Value uint64 `json:"value,omitempty"`
+
+	// Field and Bounds are the field name and bucket bounds of a
+	// DistributionMetric.
+	Field  string   `json:"field,omitempty"`
+	Bounds []uint64 `json:"bounds,omitempty"`
+
+	// Distributions are the values of a DistributionMetric, for each field
+	// value with at least one sample.
+	Distributions []DistributionSnapshot `json:"distributions,omitempty"`
+}
+
+// DistributionSnapshot is a copy of the distribution of a DistributionMetric
+// for a single field value.
+type DistributionSnapshot struct {
+	FieldValue string   `json:"field_value"`
+	Counts     []uint64 `json:"counts"`
+	Sum        uint64   `json:"sum"`
+}
+
+// Snapshot returns the current values of all metrics, sorted by name.
+func Snapshot() []MetricSnapshot {
+	var snaps []MetricSnapshot
+	for _, m := range allMetrics.m {
+		snaps = append(snaps, MetricSnapshot{
+			Name:        m.metadata.Name,
+			Description: m.metadata.Description,
+			Cumulative:  m.metadata.Cumulative,
+			Value:       m.Value(),
+		})
+	}
+	for _, d := range allMetrics.d {
+		s := MetricSnapshot{
+			Name:         d.metadata.Name,
+			Description:  d.metadata.Description,
+			Cumulative:   d.metadata.Cumulative,
+			Distribution: true,
+			Field:        d.metadata.Field,
+			Bounds:       d.bounds,
+		}
+		for i, fv := range d.fieldValues {
+			dv := distributionValue{}
+			dv.counts, dv.sum = d.Value(i)
+			if dv.empty() {
+				continue
+			}
+			s.Distributions = append(s.Distributions, DistributionSnapshot{
+				FieldValue: fv,
+				Counts:     dv.counts,
+				Sum:        dv.sum,
+			})
+		}
+		snaps = append(snaps, s)
+	}
+	sort.Slice(snaps, func(i, j int) bool {
+		return snaps[i].Name < snaps[j].Name
+	})
+	return snaps
+}
@@ -15,6 +15,7 @@
 package metric
 
 import (
+	"reflect"
 	"testing"
 
 	"github.com/golang/protobuf/proto"
@@ -55,6 +56,7 @@ func init() {
 func reset() {
 	initialized = false
 	allMetrics = makeMetricSet()
+	metricsAtLastEmit = metricValues{}
 	emitter.Reset()
 }
 
@@ -250,3 +252,83 @@ func TestEmitMetricUpdate(t *testing.T) {
 		t.Errorf("%v: Value got %v want 1", m, uv.Uint64Value)
 	}
 }
+
+func TestDistribution(t *testing.T) {
+	defer reset()
+
+	d, err := NewDistributionMetric("/dist", false, fooDescription, ExponentialBounds(10, 10, 3), "field", []string{"a", "b"})
+	if err != nil {
+		t.Fatalf("NewDistributionMetric got err %v want nil", err)
+	}
+	if _, err := NewUint64Metric("/dist", false, barDescription); err != ErrNameInUse {
+		t.Errorf("NewUint64Metric with distribution name got err %v want %v", err, ErrNameInUse)
+	}
+
+	Initialize()
+
+	mr, ok := emitter[0].(*pb.MetricRegistration)
+	if !ok {
+		t.Fatalf("emitter %v got %T want pb.MetricRegistration", emitter[0], emitter[0])
+	}
+	if len(mr.Metrics) != 1 {
+		t.Fatalf("MetricRegistration got %d metrics want 1", len(mr.Metrics))
+	}
+	if md := mr.Metrics[0]; md.Type != pb.MetricMetadata_DISTRIBUTION || md.Field != "field" || len(md.BucketBounds) != 3 {
+		t.Errorf("Metadata got %+v want DISTRIBUTION with field and 3 bounds", md)
+	}
+
+	// Buckets are [0, 10), [10, 100), [100, 1000) and [1000, inf).
+	for _, v := range []uint64{0, 9, 10, 500, 1000, 5000} {
+		d.Record(0, v)
+	}
+	// Out of range fields are ignored.
+	d.Record(2, 1)
+
+	wantCounts := []uint64{2, 1, 1, 2}
+	counts, sum := d.Value(0)
+	if !reflect.DeepEqual(counts, wantCounts) || sum != 6519 {
+		t.Errorf("Value(0) got (%v, %d) want (%v, 6519)", counts, sum, wantCounts)
+	}
+
+	// Only the field value with samples is included.
+	emitter.Reset()
+	EmitMetricUpdate()
+
+	if len(emitter) != 1 {
+		t.Fatalf("EmitMetricUpdate emitted %d events want 1", len(emitter))
+	}
+	update, ok := emitter[0].(*pb.MetricUpdate)
+	if !ok {
+		t.Fatalf("emitter %v got %T want pb.MetricUpdate", emitter[0], emitter[0])
+	}
+	if len(update.Metrics) != 1 {
+		t.Fatalf("MetricUpdate got %d metrics want 1", len(update.Metrics))
+	}
+	m := update.Metrics[0]
+	dv, ok := m.Value.(*pb.MetricValue_DistributionValue)
+	if !ok {
+		t.Fatalf("%+v: value %v got %T want pb.MetricValue_DistributionValue", m, m.Value, m.Value)
+	}
+	if m.Name != "/dist" || m.FieldValue != "a" || !reflect.DeepEqual(dv.DistributionValue.Counts, wantCounts) {
+		t.Errorf("MetricValue got %+v want /dist field a with counts %v", m, wantCounts)
+	}
+
+	// Nothing changed, so nothing is emitted.
+	emitter.Reset()
+	EmitMetricUpdate()
+	if len(emitter) != 0 {
+		t.Errorf("EmitMetricUpdate emitted %d events want 0", len(emitter))
+	}
+
+	// Only the changed field value is included.
+	d.Record(1, 50)
+	emitter.Reset()
+	EmitMetricUpdate()
+	if len(emitter) != 1 {
+		t.Fatalf("EmitMetricUpdate emitted %d events want 1", len(emitter))
+	}
+	update = emitter[0].(*pb.MetricUpdate)
+	if len(update.Metrics) != 1 || update.Metrics[0].FieldValue != "b" {
+		t.Errorf("MetricUpdate got %+v want only field b", update.Metrics)
+	}
+}
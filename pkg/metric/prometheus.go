@@ -0,0 +1,162 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metric
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PrometheusPrefix is prepended to the names of all metrics exported by
+// WritePrometheus.
+const PrometheusPrefix = "gvisor"
+
+// PrometheusSource is a set of metric values from a single source, such as a
+// sandbox.
+type PrometheusSource struct {
+	// Labels are added to every exported value from this source.
+	Labels map[string]string
+
+	// Metrics are the metric values of this source.
+	Metrics []MetricSnapshot
+}
+
+// PrometheusName returns the Prometheus metric name for the metric called
+// name: the name prefixed with PrometheusPrefix, with every character that is
+// not valid in a Prometheus metric name replaced by an underscore. For
+// example, "/syscalls/latency" becomes "gvisor_syscalls_latency".
+func PrometheusName(name string) string {
+	return PrometheusPrefix + strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// WritePrometheus writes the metric values of all sources to w in the
+// Prometheus text exposition format. Metrics with the same name in different
+// sources are written as a single metric family, distinguished by the
+// sources' labels.
+//
+// Uint64Metrics are exported as counters if they are cumulative and gauges
+// otherwise. DistributionMetrics are exported as histograms, with the
+// metric's field as an additional label.
+func WritePrometheus(w io.Writer, sources []PrometheusSource) error {
+	// Group values by metric name, so that each family is written once.
+	type value struct {
+		labels string
+		m      *MetricSnapshot
+	}
+	families := make(map[string][]value)
+	for _, src := range sources {
+		labels := formatLabels(src.Labels)
+		for i := range src.Metrics {
+			m := &src.Metrics[i]
+			families[m.Name] = append(families[m.Name], value{labels, m})
+		}
+	}
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	bw := bufio.NewWriter(w)
+	for _, name := range names {
+		vals := families[name]
+		first := vals[0].m
+		pname := PrometheusName(name)
+		typ := "gauge"
+		switch {
+		case first.Distribution:
+			typ = "histogram"
+		case first.Cumulative:
+			typ = "counter"
+		}
+		fmt.Fprintf(bw, "# HELP %s %s\n", pname, escapeHelp(first.Description))
+		fmt.Fprintf(bw, "# TYPE %s %s\n", pname, typ)
+
+		for _, v := range vals {
+			if !v.m.Distribution {
+				fmt.Fprintf(bw, "%s%s %d\n", pname, braces(v.labels), v.m.Value)
+				continue
+			}
+			for _, d := range v.m.Distributions {
+				labels := joinLabels(v.labels, formatLabel(v.m.Field, d.FieldValue))
+				var cum uint64
+				for i, c := range d.Counts {
+					cum += c
+					le := "+Inf"
+					if i < len(v.m.Bounds) {
+						le = strconv.FormatUint(v.m.Bounds[i], 10)
+					}
+					fmt.Fprintf(bw, "%s_bucket%s %d\n", pname, braces(joinLabels(labels, formatLabel("le", le))), cum)
+				}
+				fmt.Fprintf(bw, "%s_sum%s %d\n", pname, braces(labels), d.Sum)
+				fmt.Fprintf(bw, "%s_count%s %d\n", pname, braces(labels), cum)
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// formatLabels returns labels in the exposition format, without braces,
+// sorted by name.
+func formatLabels(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var s string
+	for _, name := range names {
+		s = joinLabels(s, formatLabel(name, labels[name]))
+	}
+	return s
+}
+
+// formatLabel returns a single label in the exposition format.
+func formatLabel(name, value string) string {
+	return name + `="` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value) + `"`
+}
+
+// joinLabels joins two lists of labels formatted by formatLabels.
+func joinLabels(a, b string) string {
+	if a == "" {
+		return b
+	}
+	if b == "" {
+		return a
+	}
+	return a + "," + b
+}
+
+// braces returns labels enclosed in braces, or "" if there are no labels.
+func braces(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+// escapeHelp escapes a metric description for a HELP line.
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
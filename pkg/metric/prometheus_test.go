@@ -0,0 +1,61 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metric
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWritePrometheus(t *testing.T) {
+	defer reset()
+
+	foo := MustCreateNewUint64Metric("/foo/count", false, fooDescription)
+	d := MustCreateNewDistributionMetric("/dist", false, "Line\nbreak", []uint64{10, 100}, "field", []string{"a", "b"})
+
+	foo.IncrementBy(3)
+	d.Record(1, 5)
+	d.Record(1, 50)
+	d.Record(1, 500)
+
+	snaps := Snapshot()
+	if len(snaps) != 2 || snaps[0].Name != "/dist" || snaps[1].Name != "/foo/count" {
+		t.Fatalf("Snapshot() = %+v, want /dist and /foo/count", snaps)
+	}
+
+	var buf bytes.Buffer
+	if err := WritePrometheus(&buf, []PrometheusSource{
+		{Labels: map[string]string{"sandbox": "one"}, Metrics: snaps},
+		{Labels: map[string]string{"sandbox": `t"wo`}, Metrics: snaps[1:]},
+	}); err != nil {
+		t.Fatalf("WritePrometheus failed: %v", err)
+	}
+
+	want := `# HELP gvisor_dist Line\nbreak
+# TYPE gvisor_dist histogram
+gvisor_dist_bucket{sandbox="one",field="b",le="10"} 1
+gvisor_dist_bucket{sandbox="one",field="b",le="100"} 2
+gvisor_dist_bucket{sandbox="one",field="b",le="+Inf"} 3
+gvisor_dist_sum{sandbox="one",field="b"} 555
+gvisor_dist_count{sandbox="one",field="b"} 3
+# HELP gvisor_foo_count Foo!
+# TYPE gvisor_foo_count counter
+gvisor_foo_count{sandbox="one"} 3
+gvisor_foo_count{sandbox="t\"wo"} 3
+`
+	if got := buf.String(); got != want {
+		t.Errorf("WritePrometheus wrote:\n%s\nwant:\n%s", got, want)
+	}
+}
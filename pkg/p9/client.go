@@ -18,6 +18,7 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"syscall"
 
 	"gvisor.googlesource.com/gvisor/pkg/log"
@@ -68,8 +69,13 @@ var responsePool = sync.Pool{
 
 // Client is at least a 9P2000.L client.
 type Client struct {
-	// socket is the connected socket.
-	socket *unet.Socket
+	// channels are the sockets carrying requests. Requests are spread
+	// over them in turn.
+	channels []*clientChannel
+
+	// next is the index of the channel of the next request, modulo the
+	// number of channels. It is accessed atomically.
+	next uint32
 
 	// tagPool is the collection of available tags.
 	tagPool pool
@@ -77,19 +83,6 @@ type Client struct {
 	// fidPool is the collection of available fids.
 	fidPool pool
 
-	// pending is the set of pending messages.
-	pending   map[Tag]*response
-	pendingMu sync.Mutex
-
-	// sendMu is the lock for sending a request.
-	sendMu sync.Mutex
-
-	// recvr is essentially a mutex for calling recv.
-	//
-	// Whoever writes to this channel is permitted to call recv. When
-	// finished calling recv, this channel should be emptied.
-	recvr chan bool
-
 	// messageSize is the maximum total size of a message.
 	messageSize uint32
 
@@ -104,11 +97,41 @@ type Client struct {
 	version uint32
 }
 
+// clientChannel is a socket carrying requests of a Client.
+type clientChannel struct {
+	// socket is the connected socket.
+	socket *unet.Socket
+
+	// messageSize is the maximum total size of a message.
+	messageSize uint32
+
+	// pending is the set of pending messages.
+	pending   map[Tag]*response
+	pendingMu sync.Mutex
+
+	// sendMu is the lock for sending a request.
+	sendMu sync.Mutex
+
+	// recvr is essentially a mutex for calling recv.
+	//
+	// Whoever writes to this channel is permitted to call recv. When
+	// finished calling recv, this channel should be emptied.
+	recvr chan bool
+}
+
 // NewClient creates a new client.  It performs a Tversion exchange with
 // the server to assert that messageSize is ok to use.
 //
 // You should not use the same socket for multiple clients.
 func NewClient(socket *unet.Socket, messageSize uint32, version string) (*Client, error) {
+	return NewClientChannels([]*unet.Socket{socket}, messageSize, version)
+}
+
+// NewClientChannels creates a new client whose requests are spread over
+// several sockets, which must be handled as one connection by the server, as
+// with Server.HandleChannels. Requests on different sockets don't wait for
+// each other to be sent and received.
+func NewClientChannels(sockets []*unet.Socket, messageSize uint32, version string) (*Client, error) {
 	// Need at least one byte of payload.
 	if messageSize <= largestFixedSize {
 		return nil, &ErrMessageTooLarge{
@@ -123,14 +146,19 @@ func NewClient(socket *unet.Socket, messageSize uint32, version string) (*Client
 		payloadSize -= (payloadSize % 512)
 	}
 	c := &Client{
-		socket:      socket,
 		tagPool:     pool{start: 1, limit: uint64(NoTag)},
 		fidPool:     pool{start: 1, limit: uint64(NoFID)},
-		pending:     make(map[Tag]*response),
-		recvr:       make(chan bool, 1),
 		messageSize: messageSize,
 		payloadSize: payloadSize,
 	}
+	for _, socket := range sockets {
+		c.channels = append(c.channels, &clientChannel{
+			socket:      socket,
+			messageSize: messageSize,
+			pending:     make(map[Tag]*response),
+			recvr:       make(chan bool, 1),
+		})
+	}
 	// Agree upon a version.
 	requested, ok := parseVersion(version)
 	if !ok {
@@ -171,11 +199,11 @@ func NewClient(socket *unet.Socket, messageSize uint32, version string) (*Client
 //
 // This should only be called with the token from recvr. Note that the received
 // tag will automatically be cleared from pending.
-func (c *Client) handleOne() {
-	tag, r, err := recv(c.socket, c.messageSize, func(tag Tag, t MsgType) (message, error) {
-		c.pendingMu.Lock()
-		resp := c.pending[tag]
-		c.pendingMu.Unlock()
+func (ch *clientChannel) handleOne() {
+	tag, r, err := recv(ch.socket, ch.messageSize, func(tag Tag, t MsgType) (message, error) {
+		ch.pendingMu.Lock()
+		resp := ch.pending[tag]
+		ch.pendingMu.Unlock()
 
 		// Not expecting this message?
 		if resp == nil {
@@ -202,45 +230,45 @@ func (c *Client) handleOne() {
 		// No tag was extracted (probably a socket error).
 		//
 		// Likely catastrophic. Notify all waiters and clear pending.
-		c.pendingMu.Lock()
-		for _, resp := range c.pending {
+		ch.pendingMu.Lock()
+		for _, resp := range ch.pending {
 			resp.done <- err
 		}
-		c.pending = make(map[Tag]*response)
-		c.pendingMu.Unlock()
+		ch.pending = make(map[Tag]*response)
+		ch.pendingMu.Unlock()
 	} else {
 		// Process the tag.
 		//
 		// We know that is is contained in the map because our lookup function
 		// above must have succeeded (found the tag) to return nil err.
-		c.pendingMu.Lock()
-		resp := c.pending[tag]
-		delete(c.pending, tag)
-		c.pendingMu.Unlock()
+		ch.pendingMu.Lock()
+		resp := ch.pending[tag]
+		delete(ch.pending, tag)
+		ch.pendingMu.Unlock()
 		resp.r = r
 		resp.done <- err
 	}
 }
 
 // waitAndRecv co-ordinates with other receivers to handle responses.
-func (c *Client) waitAndRecv(done chan error) error {
+func (ch *clientChannel) waitAndRecv(done chan error) error {
 	for {
 		select {
 		case err := <-done:
 			return err
-		case c.recvr <- true:
+		case ch.recvr <- true:
 			select {
 			case err := <-done:
 				// It's possible that we got the token, despite
 				// done also being available. Check for that.
-				<-c.recvr
+				<-ch.recvr
 				return err
 			default:
 				// Handle receiving one tag.
-				c.handleOne()
+				ch.handleOne()
 
 				// Return the token.
-				<-c.recvr
+				<-ch.recvr
 			}
 		}
 	}
@@ -256,6 +284,9 @@ func (c *Client) sendRecv(t message, r message) error {
 	}
 	defer c.tagPool.Put(tag)
 
+	// Tags are unique across channels, so any channel will do.
+	ch := c.channels[int(atomic.AddUint32(&c.next, 1)%uint32(len(c.channels)))]
+
 	// Indicate we're expecting a response.
 	//
 	// Note that the tag will be cleared from pending
@@ -263,20 +294,20 @@ func (c *Client) sendRecv(t message, r message) error {
 	resp := responsePool.Get().(*response)
 	defer responsePool.Put(resp)
 	resp.r = r
-	c.pendingMu.Lock()
-	c.pending[Tag(tag)] = resp
-	c.pendingMu.Unlock()
+	ch.pendingMu.Lock()
+	ch.pending[Tag(tag)] = resp
+	ch.pendingMu.Unlock()
 
 	// Send the request over the wire.
-	c.sendMu.Lock()
-	err := send(c.socket, Tag(tag), t)
-	c.sendMu.Unlock()
+	ch.sendMu.Lock()
+	err := send(ch.socket, Tag(tag), t)
+	ch.sendMu.Unlock()
 	if err != nil {
 		return err
 	}
 
 	// Co-ordinate with other receivers.
-	if err := c.waitAndRecv(resp.done); err != nil {
+	if err := ch.waitAndRecv(resp.done); err != nil {
 		return err
 	}
 
@@ -205,6 +205,19 @@ func (c *clientFile) Connect(flags ConnectFlags) (*fd.FD, error) {
 	return rlconnect.File, nil
 }
 
+// Watch implements File.Watch.
+func (c *clientFile) Watch(mask uint32) (*fd.FD, error) {
+	if !VersionSupportsWatch(c.client.version) {
+		return nil, syscall.ENOSYS
+	}
+	rlwatch := Rlwatch{}
+	if err := c.client.sendRecv(&Tlwatch{FID: c.fid, Mask: mask}, &rlwatch); err != nil {
+		return nil, err
+	}
+
+	return rlwatch.File, nil
+}
+
 // chunk applies fn to p in chunkSize-sized chunks until fn returns a partial result, p is
 // exhausted, or an error is encountered (which may be io.EOF).
 func chunk(chunkSize uint32, fn func([]byte, uint64) (int, error), p []byte, offset uint64) (int, error) {
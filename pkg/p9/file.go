@@ -169,6 +169,20 @@ type File interface {
 	//
 	// flags indicates the requested type of socket.
 	Connect(flags ConnectFlags) (*fd.FD, error)
+
+	// Watch returns a host inotify instance that reports changes to this
+	// file made outside of the client, in the format of inotify(7). A File
+	// does not need to be opened before it can be watched. As with Connect,
+	// the lifetime of the *fd.FD is independent from the lifetime of the
+	// p9.File and must be managed by the caller.
+	//
+	// The returned FD must be non-blocking.
+	//
+	// mask is the set of inotify events to report.
+	//
+	// Server-side p9.Files may return syscall.ENOSYS if they do not
+	// support watches.
+	Watch(mask uint32) (*fd.FD, error)
 }
 
 // DefaultWalkGetAttr implements File.WalkGetAttr to return ENOSYS for server-side Files.
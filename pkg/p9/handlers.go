@@ -703,3 +703,21 @@ func (t *Tlconnect) handle(cs *connState) message {
 
 	return &Rlconnect{File: osFile}
 }
+
+// handle implements handler.handle.
+func (t *Tlwatch) handle(cs *connState) message {
+	// Lookup the FID.
+	ref, ok := cs.LookupFID(t.FID)
+	if !ok {
+		return newErr(syscall.EBADF)
+	}
+	defer ref.DecRef()
+
+	// Set up the watch.
+	osFile, err := ref.file.Watch(t.Mask)
+	if err != nil {
+		return newErr(err)
+	}
+
+	return &Rlwatch{File: osFile}
+}
@@ -318,6 +318,13 @@ func (l *local) Connect(p9.ConnectFlags) (*fd.FD, error) {
 	return nil, syscall.ECONNREFUSED
 }
 
+// Watch implements p9.File.Watch.
+//
+// Not implemented.
+func (l *local) Watch(uint32) (*fd.FD, error) {
+	return nil, syscall.ENOSYS
+}
+
 func main() {
 	log.SetLevel(log.Debug)
 
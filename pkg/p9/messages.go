@@ -2139,6 +2139,69 @@ func (r *Rlconnect) String() string {
 	return fmt.Sprintf("Rlconnect{File: %v}", r.File)
 }
 
+// Tlwatch is a watch request.
+type Tlwatch struct {
+	// FID is the FID to be watched.
+	FID FID
+
+	// Mask is the inotify event mask.
+	Mask uint32
+}
+
+// Decode implements encoder.Decode.
+func (t *Tlwatch) Decode(b *buffer) {
+	t.FID = b.ReadFID()
+	t.Mask = b.Read32()
+}
+
+// Encode implements encoder.Encode.
+func (t *Tlwatch) Encode(b *buffer) {
+	b.WriteFID(t.FID)
+	b.Write32(t.Mask)
+}
+
+// Type implements message.Type.
+func (*Tlwatch) Type() MsgType {
+	return MsgTlwatch
+}
+
+// String implements fmt.Stringer.
+func (t *Tlwatch) String() string {
+	return fmt.Sprintf("Tlwatch{FID: %d, Mask: %#x}", t.FID, t.Mask)
+}
+
+// Rlwatch is a watch response.
+type Rlwatch struct {
+	// File is a host inotify instance.
+	File *fd.FD
+}
+
+// Decode implements encoder.Decode.
+func (r *Rlwatch) Decode(*buffer) {}
+
+// Encode implements encoder.Encode.
+func (r *Rlwatch) Encode(*buffer) {}
+
+// Type implements message.Type.
+func (*Rlwatch) Type() MsgType {
+	return MsgRlwatch
+}
+
+// FilePayload returns the file payload.
+func (r *Rlwatch) FilePayload() *fd.FD {
+	return r.File
+}
+
+// SetFilePayload sets the received file.
+func (r *Rlwatch) SetFilePayload(file *fd.FD) {
+	r.File = file
+}
+
+// String implements fmt.Stringer.
+func (r *Rlwatch) String() string {
+	return fmt.Sprintf("Rlwatch{File: %v}", r.File)
+}
+
 // messageRegistry indexes all messages by type.
 var messageRegistry = make(map[MsgType]func() message)
 
@@ -2266,6 +2329,8 @@ func init() {
 	register(&Rusymlink{})
 	register(&Tlconnect{})
 	register(&Rlconnect{})
+	register(&Tlwatch{})
+	register(&Rlwatch{})
 
 	calculateLargestFixedSize()
 }
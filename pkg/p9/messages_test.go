@@ -121,6 +121,11 @@ func TestEncodeDecode(t *testing.T) {
 			FID: 1,
 		},
 		&Rlconnect{},
+		&Tlwatch{
+			FID:  1,
+			Mask: 2,
+		},
+		&Rlwatch{},
 		&Tlcreate{
 			FID:         1,
 			Name:        "a",
@@ -361,6 +361,8 @@ const (
 	MsgRusymlink            = 135
 	MsgTlconnect            = 136
 	MsgRlconnect            = 137
+	MsgTlwatch              = 138
+	MsgRlwatch              = 139
 )
 
 // QIDType represents the file type for QIDs.
@@ -289,6 +289,62 @@ func TestClient(t *testing.T) {
 	}
 }
 
+func TestClientChannels(t *testing.T) {
+	// Backend mock.
+	a := &AttachMock{
+		File: &FileMock{
+			GetAttrMock: GetAttrMock{
+				QID:   p9.QID{Path: 1},
+				Valid: p9.AttrMaskAll(),
+			},
+		},
+	}
+
+	// Create a connection over several sockets.
+	const channels = 3
+	var serverSockets, clientSockets []*unet.Socket
+	for i := 0; i < channels; i++ {
+		serverSocket, clientSocket, err := unet.SocketPair(false)
+		if err != nil {
+			t.Fatalf("socketpair got err %v wanted nil", err)
+		}
+		defer clientSocket.Close()
+		serverSockets = append(serverSockets, serverSocket)
+		clientSockets = append(clientSockets, clientSocket)
+	}
+	server := p9.NewServer(a)
+	done := make(chan error, 1)
+	go func() {
+		done <- server.HandleChannels(serverSockets, 1)
+	}()
+	client, err := p9.NewClientChannels(clientSockets, 1024*1024 /* 1M message size */, p9.HighestVersionString())
+	if err != nil {
+		t.Fatalf("new client got err %v, wanted nil", err)
+	}
+
+	// The FID of the attach point must be usable on all sockets, since
+	// requests are spread over them.
+	f, err := client.Attach("")
+	if err != nil {
+		t.Fatalf("attach got err %v, wanted nil", err)
+	}
+	for i := 0; i < 2*channels; i++ {
+		qid, _, _, err := f.GetAttr(p9.AttrMaskAll())
+		if err != nil {
+			t.Fatalf("getattr got err %v, wanted nil", err)
+		}
+		if qid.Path != 1 {
+			t.Errorf("getattr got QID %+v, wanted path 1", qid)
+		}
+	}
+
+	// Closing one socket stops the server.
+	clientSockets[0].Close()
+	if err := <-done; err == nil {
+		t.Errorf("HandleChannels got nil, wanted an error")
+	}
+}
+
 func BenchmarkClient(b *testing.B) {
 	// Backend mock.
 	a := &AttachMock{
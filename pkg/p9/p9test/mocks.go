@@ -458,6 +458,24 @@ func (o *ConnectMock) Connect(flags p9.ConnectFlags) (*fd.FD, error) {
 	return o.File, o.Err
 }
 
+// WatchMock mocks p9.File.Watch.
+type WatchMock struct {
+	Called bool
+
+	// Args.
+	Mask uint32
+
+	// Return.
+	File *fd.FD
+	Err  error
+}
+
+// Watch implements p9.File.Watch.
+func (o *WatchMock) Watch(mask uint32) (*fd.FD, error) {
+	o.Called, o.Mask = true, mask
+	return o.File, o.Err
+}
+
 // FileMock mocks p9.File.
 type FileMock struct {
 	WalkMock
@@ -483,6 +501,7 @@ type FileMock struct {
 	ReadlinkMock
 	FlushMock
 	ConnectMock
+	WatchMock
 }
 
 var (
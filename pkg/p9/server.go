@@ -37,17 +37,12 @@ func NewServer(attacher Attacher) *Server {
 	}
 }
 
-// connState is the state for a single connection.
+// connState is the state for a single connection, which may be carried over
+// several channels.
 type connState struct {
 	// server is the backing server.
 	server *Server
 
-	// sendMu is the send lock.
-	sendMu sync.Mutex
-
-	// conn is the connection.
-	conn *unet.Socket
-
 	// fids is the set of active FIDs.
 	//
 	// This is used to find FIDs for files.
@@ -69,6 +64,22 @@ type connState struct {
 	// version 0 implies 9P2000.L.
 	version uint32
 
+	// workers holds a token for each request being handled, if the number
+	// of concurrent requests is bounded. It is nil otherwise.
+	workers chan struct{}
+}
+
+// channel is a socket carrying requests of a connection.
+type channel struct {
+	// cs is the connection.
+	cs *connState
+
+	// sendMu is the send lock.
+	sendMu sync.Mutex
+
+	// conn is the socket.
+	conn *unet.Socket
+
 	// recvOkay indicates that a receive may start.
 	recvOkay chan bool
 
@@ -207,7 +218,9 @@ func (cs *connState) WaitTag(t Tag) {
 //
 // The recvDone channel is signaled when recv is done (with a error if
 // necessary). The sendDone channel is signaled with the result of the send.
-func (cs *connState) handleRequest() {
+func (ch *channel) handleRequest() {
+	cs := ch.cs
+
 	messageSize := atomic.LoadUint32(&cs.messageSize)
 	if messageSize == 0 {
 		// Default or not yet negotiated.
@@ -215,32 +228,40 @@ func (cs *connState) handleRequest() {
 	}
 
 	// Receive a message.
-	tag, m, err := recv(cs.conn, messageSize, messageByType)
+	tag, m, err := recv(ch.conn, messageSize, messageByType)
 	if errSocket, ok := err.(ErrSocket); ok {
 		// Connection problem; stop serving.
-		cs.recvDone <- errSocket.error
+		ch.recvDone <- errSocket.error
 		return
 	}
 
 	// Signal receive is done.
-	cs.recvDone <- nil
+	ch.recvDone <- nil
 
 	// Deal with other errors.
 	if err != nil {
 		// If it's not a connection error, but some other protocol error,
 		// we can send a response immediately.
 		log.Debugf("err [%05d] %v", tag, err)
-		cs.sendMu.Lock()
-		err := send(cs.conn, tag, newErr(err))
-		cs.sendMu.Unlock()
-		cs.sendDone <- err
+		ch.sendMu.Lock()
+		err := send(ch.conn, tag, newErr(err))
+		ch.sendMu.Unlock()
+		ch.sendDone <- err
 		return
 	}
 
+	// Wait for a worker, if their number is bounded. This is done only
+	// once a message is received, so that idle receivers don't hold
+	// workers.
+	if cs.workers != nil {
+		cs.workers <- struct{}{}
+		defer func() { <-cs.workers }()
+	}
+
 	// Try to start the tag.
 	if !cs.StartTag(tag) {
 		// Nothing we can do at this point; client is bogus.
-		cs.sendDone <- ErrNoValidMessage
+		ch.sendDone <- ErrNoValidMessage
 		return
 	}
 
@@ -260,57 +281,59 @@ func (cs *connState) handleRequest() {
 	cs.ClearTag(tag)
 
 	// Send back the result.
-	cs.sendMu.Lock()
-	err = send(cs.conn, tag, r)
-	cs.sendMu.Unlock()
-	cs.sendDone <- err
+	ch.sendMu.Lock()
+	err = send(ch.conn, tag, r)
+	ch.sendMu.Unlock()
+	ch.sendDone <- err
 	return
 }
 
-func (cs *connState) handleRequests() {
-	for range cs.recvOkay {
-		cs.handleRequest()
+func (ch *channel) handleRequests() {
+	for range ch.recvOkay {
+		ch.handleRequest()
 	}
 }
 
-func (cs *connState) stop() {
+func (ch *channel) stop() {
 	// Close all channels.
-	close(cs.recvOkay)
-	close(cs.recvDone)
-	close(cs.sendDone)
+	close(ch.recvOkay)
+	close(ch.recvDone)
+	close(ch.sendDone)
 
+	// Ensure the connection is closed.
+	ch.conn.Close()
+}
+
+func (cs *connState) stop() {
 	for _, fidRef := range cs.fids {
 		// Drop final reference in the FID table. Note this should
 		// always close the file, since we've ensured that there are no
-		// handlers running via the wait for Pending => 0 below.
+		// handlers running via the wait for Pending => 0 in service.
 		fidRef.DecRef()
 	}
-
-	// Ensure the connection is closed.
-	cs.conn.Close()
 }
 
 // service services requests concurrently.
-func (cs *connState) service() error {
+func (ch *channel) service() error {
 	// Pending is the number of handlers that have finished receiving but
 	// not finished processing requests. These must be waiting on properly
 	// below. See the next comment for an explanation of the loop.
 	pending := 0
 
 	// Start the first request handler.
-	go cs.handleRequests() // S/R-SAFE: Irrelevant.
-	cs.recvOkay <- true
+	go ch.handleRequests() // S/R-SAFE: Irrelevant.
+	ch.recvOkay <- true
 
 	// We loop and make sure there's always one goroutine waiting for a new
 	// request. We process all the data for a single request in one
 	// goroutine however, to ensure the best turnaround time possible.
 	for {
 		select {
-		case err := <-cs.recvDone:
+		case err := <-ch.recvDone:
 			if err != nil {
 				// Wait for pending handlers.
 				for i := 0; i < pending; i++ {
-					<-cs.sendDone
+					<-ch.sendDone
 				}
 				return err
 			}
@@ -321,13 +344,13 @@ func (cs *connState) service() error {
 			// Kick the next receiver, or start a new handler
 			// if no receiver is currently waiting.
 			select {
-			case cs.recvOkay <- true:
+			case ch.recvOkay <- true:
 			default:
-				go cs.handleRequests() // S/R-SAFE: Irrelevant.
-				cs.recvOkay <- true
+				go ch.handleRequests() // S/R-SAFE: Irrelevant.
+				ch.recvOkay <- true
 			}
 
-		case <-cs.sendDone:
+		case <-ch.sendDone:
 			// This handler is finished.
 			pending--
 
@@ -342,17 +365,52 @@ func (cs *connState) service() error {
 
 // Handle handles a single connection.
 func (s *Server) Handle(conn *unet.Socket) error {
+	return s.HandleChannels([]*unet.Socket{conn}, 0)
+}
+
+// HandleChannels handles a single connection carried over several sockets,
+// which share FIDs and tags, as created by NewClientChannels. Requests are
+// handled concurrently; if workers is not 0, at most workers requests are
+// handled at a time across all sockets.
+//
+// All sockets are closed as soon as one of them fails, and the error of the
+// first one is returned.
+func (s *Server) HandleChannels(conns []*unet.Socket, workers int) error {
 	cs := &connState{
-		server:   s,
-		conn:     conn,
-		fids:     make(map[FID]*fidRef),
-		tags:     make(map[Tag]chan struct{}),
-		recvOkay: make(chan bool),
-		recvDone: make(chan error, 10),
-		sendDone: make(chan error, 10),
+		server: s,
+		fids:   make(map[FID]*fidRef),
+		tags:   make(map[Tag]chan struct{}),
+	}
+	if workers > 0 {
+		cs.workers = make(chan struct{}, workers)
 	}
 	defer cs.stop()
-	return cs.service()
+
+	errs := make(chan error, len(conns))
+	for _, conn := range conns {
+		ch := &channel{
+			cs:       cs,
+			conn:     conn,
+			recvOkay: make(chan bool),
+			recvDone: make(chan error, 10),
+			sendDone: make(chan error, 10),
+		}
+		go func() { // S/R-SAFE: Irrelevant.
+			err := ch.service()
+			ch.stop()
+			errs <- err
+		}()
+	}
+
+	// Stop the other channels once one fails.
+	err := <-errs
+	for _, conn := range conns {
+		conn.Shutdown()
+	}
+	for i := 1; i < len(conns); i++ {
+		<-errs
+	}
+	return err
 }
 
 // Serve handles requests from the bound socket.
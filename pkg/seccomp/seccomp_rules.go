@@ -107,13 +107,20 @@ func (sr SyscallRules) AddRule(sysno uintptr, r Rule) {
 	}
 }
 
-// Merge merges the given SyscallRules.
+// Merge merges the given SyscallRules. A syscall allowed without rules by
+// either set remains allowed without rules.
 func (sr SyscallRules) Merge(rules SyscallRules) {
 	for sysno, rs := range rules {
-		if _, ok := sr[sysno]; ok {
-			sr[sysno] = append(sr[sysno], rs...)
-		} else {
+		existing, ok := sr[sysno]
+		switch {
+		case !ok:
 			sr[sysno] = rs
+		case len(existing) == 0:
+			// Already allowed with any arguments.
+		case len(rs) == 0:
+			sr[sysno] = []Rule{}
+		default:
+			sr[sysno] = append(existing, rs...)
 		}
 	}
 }
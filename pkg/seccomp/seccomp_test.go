@@ -355,3 +355,29 @@ func TestRealDeal(t *testing.T) {
 		}
 	}
 }
+
+// TestMerge checks that merging rules never restricts a syscall that is
+// allowed with any arguments.
+func TestMerge(t *testing.T) {
+	rule := Rule{AllowAny{}, AllowValue(1)}
+	for _, tc := range []struct {
+		desc   string
+		a, b   []Rule
+		want   int
+		anyArg bool
+	}{
+		{desc: "rules and rules", a: []Rule{rule}, b: []Rule{rule}, want: 2},
+		{desc: "any and rules", a: []Rule{}, b: []Rule{rule}, anyArg: true},
+		{desc: "rules and any", a: []Rule{rule}, b: []Rule{}, anyArg: true},
+		{desc: "any and any", a: []Rule{}, b: []Rule{}, anyArg: true},
+	} {
+		sr := SyscallRules{1: tc.a}
+		sr.Merge(SyscallRules{1: tc.b, 2: {rule}})
+		if got := len(sr[1]); tc.anyArg && got != 0 || !tc.anyArg && got != tc.want {
+			t.Errorf("%s: merged %d rules, want %d (any arguments: %t)", tc.desc, got, tc.want, tc.anyArg)
+		}
+		if len(sr[2]) != 1 {
+			t.Errorf("%s: merged %d rules for a new syscall, want 1", tc.desc, len(sr[2]))
+		}
+	}
+}
@@ -0,0 +1,227 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package control
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"sort"
+
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/mm"
+)
+
+// HeapProfile attributes the sentry heap to the processes and filesystems of
+// the application that hold it.
+//
+// The Go heap does not record which object owns an allocation, so the heap
+// held by an owner is estimated from the types of the sentry objects reachable
+// from it: each object counts for the size of its type, plus the data that it
+// buffers, such as the contents of pipes. Objects shared by several processes
+// are attributed to the first one found. The rest of the heap, such as the
+// network stack and the runtime, is used by the sentry itself.
+type HeapProfile struct {
+	// Container is the container that the processes and filesystems
+	// belong to. It is set by runsc, since the sentry runs a single
+	// container.
+	Container string `json:"container,omitempty"`
+
+	// InUse is the number of bytes in in-use sentry heap spans, after a
+	// garbage collection.
+	InUse uint64 `json:"in_use"`
+
+	// Attributed is the estimated number of bytes of InUse held by
+	// Processes and Filesystems.
+	Attributed uint64 `json:"attributed"`
+
+	// Processes are the owners of the heap held by each process, by
+	// decreasing size.
+	Processes []HeapOwner `json:"processes"`
+
+	// Filesystems are the owners of the heap held by each mount, by
+	// decreasing size.
+	Filesystems []HeapOwner `json:"filesystems"`
+}
+
+// HeapOwner is the estimated sentry heap held on behalf of a process or a
+// filesystem.
+type HeapOwner struct {
+	// Name identifies the owner: "<pid> (<comm>)" for processes, and
+	// "<mount point> (<filesystem>)" for filesystems.
+	Name string `json:"name"`
+
+	// Bytes is the sum of the sizes of Objects.
+	Bytes uint64 `json:"bytes"`
+
+	// Objects are the objects held by the owner, by type.
+	Objects map[string]HeapObjects `json:"objects"`
+}
+
+// HeapObjects is the estimated sentry heap held by the objects of one type.
+type HeapObjects struct {
+	Count uint64 `json:"count"`
+	Bytes uint64 `json:"bytes"`
+}
+
+// heapSizer is implemented by objects that hold sentry heap beyond the size
+// of their type, such as buffered data.
+type heapSizer interface {
+	HeapBytes() uint64
+}
+
+func newHeapOwner(name string) *HeapOwner {
+	return &HeapOwner{
+		Name:    name,
+		Objects: make(map[string]HeapObjects),
+	}
+}
+
+// addType accounts count objects of the type of v, or of the type that v
+// points to.
+func (o *HeapOwner) addType(v interface{}, count uint64) {
+	o.add(reflect.TypeOf(v), count, 0)
+}
+
+// addObject accounts the object v, including the heap that it holds beyond
+// the size of its type.
+func (o *HeapOwner) addObject(v interface{}) {
+	var extra uint64
+	if s, ok := v.(heapSizer); ok {
+		extra = s.HeapBytes()
+	}
+	o.add(reflect.TypeOf(v), 1, extra)
+}
+
+func (o *HeapOwner) add(t reflect.Type, count, extra uint64) {
+	if count == 0 && extra == 0 {
+		return
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	bytes := count*uint64(t.Size()) + extra
+	name := t.String()
+	objs := o.Objects[name]
+	objs.Count += count
+	objs.Bytes += bytes
+	o.Objects[name] = objs
+	o.Bytes += bytes
+}
+
+// heapProfile returns the HeapProfile of the sentry running k.
+func heapProfile(k *kernel.Kernel) *HeapProfile {
+	runtime.GC()
+	p := &HeapProfile{
+		InUse:       heapInUse(),
+		Processes:   []HeapOwner{},
+		Filesystems: []HeapOwner{},
+	}
+
+	// Objects shared by several processes are only counted once.
+	fdms := make(map[*kernel.FDMap]struct{})
+	files := make(map[*fs.File]struct{})
+	mms := make(map[*mm.MemoryManager]struct{})
+
+	ts := k.TaskSet()
+	for _, tg := range ts.Root.ThreadGroups() {
+		pid := ts.Root.IDOfThreadGroup(tg)
+		leader := tg.Leader()
+		// Ignore thread groups that have been reaped.
+		if pid == 0 || leader == nil {
+			continue
+		}
+		o := newHeapOwner(fmt.Sprintf("%d (%s)", pid, leader.Name()))
+		o.addType(tg, 1)
+		o.addType(leader, uint64(len(tg.MemberIDs(ts.Root))))
+		leader.WithMuLocked(func(t *kernel.Task) {
+			if m := t.MemoryManager(); m != nil {
+				if _, ok := mms[m]; !ok {
+					mms[m] = struct{}{}
+					o.addType(m, 1)
+					m.HeapObjects(o.addType)
+				}
+			}
+			fdm := t.FDMap()
+			if fdm == nil {
+				return
+			}
+			if _, ok := fdms[fdm]; ok {
+				return
+			}
+			fdms[fdm] = struct{}{}
+			o.addType(fdm, 1)
+			for _, file := range fdm.GetRefs() {
+				if _, ok := files[file]; !ok {
+					files[file] = struct{}{}
+					o.addObject(file)
+					o.addObject(file.FileOperations)
+				}
+				file.DecRef()
+			}
+		})
+		p.Processes = append(p.Processes, *o)
+		p.Attributed += o.Bytes
+	}
+
+	if mns := k.RootMountNamespace(); mns != nil {
+		root := mns.Root()
+		rootMsrc := root.Inode.MountSource
+		for _, msrc := range append([]*fs.MountSource{rootMsrc}, rootMsrc.Submounts()...) {
+			o := newHeapOwner(mountName(msrc, root))
+			// Each cached Dirent holds an Inode, and its
+			// filesystem's InodeOperations, which are estimated
+			// to be those of the root of the mount.
+			n := msrc.CachedDirents()
+			o.addType((*fs.Dirent)(nil), n)
+			o.addType((*fs.Inode)(nil), n)
+			if d := msrc.Root(); d != nil {
+				o.addType(d.Inode.InodeOperations, n)
+			}
+			p.Filesystems = append(p.Filesystems, *o)
+			p.Attributed += o.Bytes
+		}
+		root.DecRef()
+	}
+
+	sortHeapOwners(p.Processes)
+	sortHeapOwners(p.Filesystems)
+	return p
+}
+
+// mountName returns the HeapOwner.Name of msrc, in the mount namespace whose
+// root is root.
+func mountName(msrc *fs.MountSource, root *fs.Dirent) string {
+	path := "/"
+	if d := msrc.Root(); d != nil {
+		path, _ = d.FullName(root)
+	}
+	fsName := "none"
+	if msrc.Filesystem != nil {
+		fsName = msrc.Filesystem.Name()
+	}
+	return fmt.Sprintf("%s (%s)", path, fsName)
+}
+
+// sortHeapOwners sorts owners by decreasing size, then by name.
+func sortHeapOwners(owners []HeapOwner) {
+	sort.Slice(owners, func(i, j int) bool {
+		if owners[i].Bytes != owners[j].Bytes {
+			return owners[i].Bytes > owners[j].Bytes
+		}
+		return owners[i].Name < owners[j].Name
+	})
+}
@@ -0,0 +1,68 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package control
+
+import (
+	"reflect"
+	"testing"
+)
+
+type testObject struct {
+	a, b uint64
+}
+
+type testBuffer struct {
+	testObject
+	buffered uint64
+}
+
+func (b *testBuffer) HeapBytes() uint64 {
+	return b.buffered
+}
+
+func TestHeapOwner(t *testing.T) {
+	o := newHeapOwner("1 (init)")
+	o.addType((*testObject)(nil), 3)
+	o.addType(testObject{}, 0)
+	o.addObject(&testBuffer{buffered: 100})
+	o.addObject(&testBuffer{buffered: 50})
+
+	want := map[string]HeapObjects{
+		"control.testObject": {Count: 3, Bytes: 3 * 16},
+		"control.testBuffer": {Count: 2, Bytes: 2*24 + 150},
+	}
+	if !reflect.DeepEqual(o.Objects, want) {
+		t.Errorf("got objects %+v, want %+v", o.Objects, want)
+	}
+	if wantBytes := uint64(3*16 + 2*24 + 150); o.Bytes != wantBytes {
+		t.Errorf("got %d bytes, want %d", o.Bytes, wantBytes)
+	}
+}
+
+func TestSortHeapOwners(t *testing.T) {
+	owners := []HeapOwner{
+		{Name: "b", Bytes: 10},
+		{Name: "c", Bytes: 20},
+		{Name: "a", Bytes: 10},
+	}
+	sortHeapOwners(owners)
+	var got []string
+	for _, o := range owners {
+		got = append(got, o.Name)
+	}
+	if want := []string{"c", "a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got order %v, want %v", got, want)
+	}
+}
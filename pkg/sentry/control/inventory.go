@@ -0,0 +1,168 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package control
+
+import (
+	"strings"
+
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel/kdefs"
+)
+
+// Inventory describes the processes of a sandbox and their open files, for
+// tools that list the contents of checkpoints. IDs are in the root PID
+// namespace.
+type Inventory struct {
+	Processes []InventoryProcess `json:"processes"`
+}
+
+// InventoryProcess describes a process of an Inventory.
+type InventoryProcess struct {
+	PID  kernel.ThreadID       `json:"pid"`
+	PPID kernel.ThreadID       `json:"ppid"`
+	PGID kernel.ProcessGroupID `json:"pgid"`
+	SID  kernel.SessionID      `json:"sid"`
+
+	// Threads are the IDs of the threads of the process.
+	Threads []kernel.ThreadID `json:"threads"`
+
+	// Comm is the name of the process' leader, as in /proc/[pid]/comm.
+	Comm string `json:"comm"`
+
+	// FilesID identifies the FD table of the process, which may be shared
+	// with other processes. It is 0 if the process has no FD table.
+	FilesID uint64 `json:"filesID"`
+
+	// FDs are the open file descriptors of the process, by increasing FD.
+	FDs []InventoryFD `json:"fds"`
+}
+
+// InventoryFD describes an open file descriptor of an InventoryProcess.
+type InventoryFD struct {
+	FD kdefs.FD `json:"fd"`
+
+	// Kind is the kind of the file: "reg", "dir", "chr", "blk", "fifo",
+	// "pipe", "socket", "eventfd", "eventpoll", "timerfd", "inotify" or
+	// "anon".
+	Kind string `json:"kind"`
+
+	// Path is the path of the file in the root mount namespace, or a name
+	// such as "pipe:[3]" for files that aren't in the file system.
+	Path string `json:"path"`
+
+	// Flags are the Linux file status flags of the file, as returned by
+	// fcntl(F_GETFL).
+	Flags uint32 `json:"flags"`
+
+	// CloseOnExec is true if the FD has FD_CLOEXEC set.
+	CloseOnExec bool `json:"closeOnExec"`
+
+	// Pos is the offset of the file.
+	Pos int64 `json:"pos"`
+}
+
+// NewInventory returns the Inventory of the processes running in k. k should
+// be paused, so that the processes don't change while they are listed.
+func NewInventory(k *kernel.Kernel) *Inventory {
+	var root *fs.Dirent
+	if mns := k.RootMountNamespace(); mns != nil {
+		root = mns.Root()
+		defer root.DecRef()
+	}
+
+	ts := k.TaskSet()
+	inv := &Inventory{}
+	for _, tg := range ts.Root.ThreadGroups() {
+		pid := ts.Root.IDOfThreadGroup(tg)
+		leader := tg.Leader()
+		// Ignore thread groups that have been reaped.
+		if pid == 0 || leader == nil {
+			continue
+		}
+		p := InventoryProcess{
+			PID:     pid,
+			PPID:    ts.Root.IDOfTask(leader.Parent()),
+			PGID:    ts.Root.IDOfProcessGroup(tg.ProcessGroup()),
+			SID:     ts.Root.IDOfSession(tg.Session()),
+			Threads: tg.MemberIDs(ts.Root),
+			Comm:    leader.Name(),
+		}
+		leader.WithMuLocked(func(t *kernel.Task) {
+			fdm := t.FDMap()
+			if fdm == nil {
+				return
+			}
+			p.FilesID = fdm.ID()
+			for _, fd := range fdm.GetFDs() {
+				file, flags := fdm.GetDescriptor(fd)
+				if file == nil {
+					continue
+				}
+				p.FDs = append(p.FDs, newInventoryFD(fd, file, flags, root))
+				file.DecRef()
+			}
+		})
+		inv.Processes = append(inv.Processes, p)
+	}
+	return inv
+}
+
+// newInventoryFD returns the InventoryFD of file, open as fd.
+func newInventoryFD(fd kdefs.FD, file *fs.File, flags kernel.FDFlags, root *fs.Dirent) InventoryFD {
+	path, _ := file.Dirent.FullName(root)
+	return InventoryFD{
+		FD:          fd,
+		Kind:        fileKind(file.Dirent.Inode.StableAttr.Type, path),
+		Path:        path,
+		Flags:       uint32(file.Flags().ToLinux()),
+		CloseOnExec: flags.CloseOnExec,
+		Pos:         file.Offset(),
+	}
+}
+
+// fileKind returns the InventoryFD.Kind of a file of type typ at path.
+func fileKind(typ fs.InodeType, path string) string {
+	switch typ {
+	case fs.Directory, fs.SpecialDirectory:
+		return "dir"
+	case fs.CharacterDevice:
+		return "chr"
+	case fs.BlockDevice:
+		return "blk"
+	case fs.Pipe:
+		// Anonymous pipes aren't in the file system, and are named after
+		// their inode, as in Linux.
+		if strings.HasPrefix(path, "pipe:[") {
+			return "pipe"
+		}
+		return "fifo"
+	case fs.Socket:
+		return "socket"
+	case fs.Anonymous:
+		switch {
+		case path == "anon_inode:[eventfd]":
+			return "eventfd"
+		case path == "anon_inode:[eventpoll]":
+			return "eventpoll"
+		case path == "anon_inode:[timerfd]":
+			return "timerfd"
+		case path == "inotify":
+			return "inotify"
+		}
+		return "anon"
+	}
+	return "reg"
+}
@@ -0,0 +1,46 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package control
+
+import (
+	"testing"
+
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
+)
+
+func TestFileKind(t *testing.T) {
+	for _, tc := range []struct {
+		typ  fs.InodeType
+		path string
+		want string
+	}{
+		{fs.RegularFile, "/etc/passwd", "reg"},
+		{fs.Directory, "/tmp", "dir"},
+		{fs.SpecialDirectory, "/proc/1", "dir"},
+		{fs.CharacterDevice, "/dev/null", "chr"},
+		{fs.Pipe, "pipe:[3]", "pipe"},
+		{fs.Pipe, "/tmp/fifo", "fifo"},
+		{fs.Socket, "socket:[4]", "socket"},
+		{fs.Anonymous, "anon_inode:[eventfd]", "eventfd"},
+		{fs.Anonymous, "anon_inode:[eventpoll]", "eventpoll"},
+		{fs.Anonymous, "anon_inode:[timerfd]", "timerfd"},
+		{fs.Anonymous, "inotify", "inotify"},
+		{fs.Anonymous, "test", "anon"},
+	} {
+		if got := fileKind(tc.typ, tc.path); got != tc.want {
+			t.Errorf("fileKind(%v, %q) = %q, want %q", tc.typ, tc.path, got, tc.want)
+		}
+	}
+}
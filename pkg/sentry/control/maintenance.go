@@ -0,0 +1,245 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package control
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"runtime"
+	"runtime/debug"
+	"sort"
+
+	"gvisor.googlesource.com/gvisor/pkg/abi"
+	"gvisor.googlesource.com/gvisor/pkg/log"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/arch"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/inet"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/strace"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usage"
+)
+
+// Maintenance includes functions that reclaim sentry resources and gather
+// diagnostics in a running sandbox, without affecting the application.
+type Maintenance struct {
+	Kernel *kernel.Kernel
+}
+
+// MaintenanceOpts contains options for the Run RPC call. Tasks are run in the
+// order in which they are listed.
+type MaintenanceOpts struct {
+	// DropCaches releases the dirent references cached by each mount,
+	// which in turn releases unused inodes and their cached file contents.
+	// This is analogous to writing 3 to /proc/sys/vm/drop_caches.
+	DropCaches bool `json:"drop_caches"`
+
+	// CompactHeap runs the garbage collector and returns as much memory
+	// as possible to the host.
+	CompactHeap bool `json:"compact_heap"`
+
+	// NetworkDiagnostics gathers the state of the sandbox's network
+	// interfaces.
+	NetworkDiagnostics bool `json:"network_diagnostics"`
+
+	// CompatReport gathers the unsupported syscalls and ioctls that the
+	// application has invoked.
+	CompatReport bool `json:"compat_report"`
+
+	// HeapProfile attributes the sentry heap to the processes and
+	// filesystems of the application. See HeapProfile.
+	HeapProfile bool `json:"heap_profile"`
+}
+
+// MaintenanceResult is the result of the Run RPC call.
+type MaintenanceResult struct {
+	// SentryHeapBefore and SentryHeapAfter are the number of bytes of
+	// sentry heap in use before and after the maintenance tasks ran.
+	SentryHeapBefore uint64 `json:"sentry_heap_before"`
+	SentryHeapAfter  uint64 `json:"sentry_heap_after"`
+
+	// AppMemoryBefore and AppMemoryAfter are the number of bytes of
+	// application memory in use before and after the maintenance tasks
+	// ran.
+	AppMemoryBefore uint64 `json:"app_memory_before"`
+	AppMemoryAfter  uint64 `json:"app_memory_after"`
+
+	// Network is a human-readable description of the network interfaces,
+	// if requested by MaintenanceOpts.NetworkDiagnostics.
+	Network string `json:"network,omitempty"`
+
+	// Compat is the compatibility report, if requested by
+	// MaintenanceOpts.CompatReport.
+	Compat *CompatReport `json:"compat,omitempty"`
+
+	// Heap is the heap profile, if requested by
+	// MaintenanceOpts.HeapProfile.
+	Heap *HeapProfile `json:"heap,omitempty"`
+}
+
+// CompatReport lists the unsupported operations invoked by the application.
+type CompatReport struct {
+	// Syscalls are the unimplemented or partially implemented syscalls
+	// that were invoked.
+	Syscalls []CompatEntry `json:"syscalls"`
+
+	// Ioctls are the ioctls that were invoked and failed with ENOTTY.
+	Ioctls []CompatEntry `json:"ioctls"`
+
+	// Dropped is the number of invocations that were not recorded because
+	// too many distinct operations were invoked.
+	Dropped uint64 `json:"dropped"`
+}
+
+// CompatEntry describes a single unsupported syscall or ioctl.
+type CompatEntry struct {
+	// Name is the name of the syscall. For ioctls, Name is "ioctl".
+	Name string `json:"name"`
+
+	// Request is the ioctl request number.
+	Request uint32 `json:"request,omitempty"`
+
+	// File is the type of file that the ioctl was invoked on.
+	File string `json:"file,omitempty"`
+
+	// Count is the number of times that the operation was invoked.
+	Count uint64 `json:"count"`
+
+	// Args are the syscall arguments of the first invocation.
+	Args []string `json:"args"`
+}
+
+// Run runs the maintenance tasks requested by o.
+func (m *Maintenance) Run(o *MaintenanceOpts, out *MaintenanceResult) error {
+	out.SentryHeapBefore = heapInUse()
+	out.AppMemoryBefore = m.appMemory()
+
+	if o.DropCaches {
+		log.Infof("Maintenance: dropping caches")
+		mns := m.Kernel.RootMountNamespace()
+		if mns == nil {
+			return fmt.Errorf("no root mount namespace")
+		}
+		mns.FlushMountSourceRefs()
+	}
+	if o.CompactHeap {
+		log.Infof("Maintenance: compacting heap")
+		// FreeOSMemory forces a garbage collection first.
+		debug.FreeOSMemory()
+	}
+	if o.NetworkDiagnostics {
+		out.Network = m.networkDiagnostics()
+	}
+	if o.CompatReport {
+		out.Compat = m.compatReport()
+	}
+	if o.HeapProfile {
+		log.Infof("Maintenance: profiling heap")
+		out.Heap = heapProfile(m.Kernel)
+	}
+
+	out.SentryHeapAfter = heapInUse()
+	out.AppMemoryAfter = m.appMemory()
+	return nil
+}
+
+// heapInUse returns the number of bytes in in-use sentry heap spans.
+func heapInUse() uint64 {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	return ms.HeapInuse
+}
+
+// appMemory returns the number of bytes of application memory in use.
+func (m *Maintenance) appMemory() uint64 {
+	m.Kernel.Platform.Memory().UpdateUsage()
+	_, total := usage.MemoryAccounting.Copy()
+	return total
+}
+
+// networkDiagnostics describes the network interfaces of the sandbox's
+// network stack.
+func (m *Maintenance) networkDiagnostics() string {
+	return describeNetwork(m.Kernel.NetworkStack())
+}
+
+// describeNetwork describes the network interfaces of stack, in order of
+// interface index.
+func describeNetwork(stack inet.Stack) string {
+	if stack == nil {
+		return "no network stack\n"
+	}
+
+	ifaces := stack.Interfaces()
+	addrs := stack.InterfaceAddrs()
+	idxs := make([]int, 0, len(ifaces))
+	for idx := range ifaces {
+		idxs = append(idxs, int(idx))
+	}
+	sort.Ints(idxs)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "IPv6 supported: %t\n", stack.SupportsIPv6())
+	for _, idx := range idxs {
+		iface := ifaces[int32(idx)]
+		fmt.Fprintf(&buf, "%d: %s flags=%#x type=%d addr=%s\n", idx, iface.Name, iface.Flags, iface.DeviceType, net.HardwareAddr(iface.Addr))
+		for _, a := range addrs[int32(idx)] {
+			fmt.Fprintf(&buf, "\tfamily=%d %s/%d\n", a.Family, net.IP(a.Addr), a.PrefixLen)
+		}
+	}
+	if rbuf, err := stack.TCPReceiveBufferSize(); err == nil {
+		fmt.Fprintf(&buf, "TCP receive buffer: %d %d %d\n", rbuf.Min, rbuf.Default, rbuf.Max)
+	}
+	if sbuf, err := stack.TCPSendBufferSize(); err == nil {
+		fmt.Fprintf(&buf, "TCP send buffer: %d %d %d\n", sbuf.Min, sbuf.Default, sbuf.Max)
+	}
+	return buf.String()
+}
+
+// compatReport converts the records in the kernel's CompatTracker to a
+// CompatReport.
+func (m *Maintenance) compatReport() *CompatReport {
+	return newCompatReport(m.Kernel.Compat())
+}
+
+// newCompatReport converts the records in ct to a CompatReport.
+func newCompatReport(ct *kernel.CompatTracker) *CompatReport {
+	names, _ := strace.Lookup(abi.Linux, arch.AMD64)
+	entry := func(r kernel.CompatRecord, name string) CompatEntry {
+		args := make([]string, len(r.Args))
+		for i, a := range r.Args {
+			args[i] = fmt.Sprintf("%#x", a.Value)
+		}
+		return CompatEntry{
+			Name:    name,
+			Request: r.Request,
+			File:    r.File,
+			Count:   r.Count,
+			Args:    args,
+		}
+	}
+
+	rep := &CompatReport{
+		Syscalls: []CompatEntry{},
+		Ioctls:   []CompatEntry{},
+		Dropped:  ct.Dropped(),
+	}
+	for _, r := range ct.Syscalls() {
+		rep.Syscalls = append(rep.Syscalls, entry(r, names.Name(r.Sysno)))
+	}
+	for _, r := range ct.Ioctls() {
+		rep.Ioctls = append(rep.Ioctls, entry(r, "ioctl"))
+	}
+	return rep
+}
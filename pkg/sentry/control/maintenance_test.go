@@ -0,0 +1,140 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package control
+
+import (
+	"reflect"
+	"testing"
+
+	"gvisor.googlesource.com/gvisor/pkg/sentry/arch"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/context/contexttest"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/tmpfs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/inet"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/platform"
+)
+
+func TestDescribeNetwork(t *testing.T) {
+	if got, want := describeNetwork(nil), "no network stack\n"; got != want {
+		t.Errorf("describeNetwork(nil) got %q, want %q", got, want)
+	}
+
+	s := inet.NewTestStack()
+	s.SupportsIPv6Flag = true
+	s.InterfacesMap[2] = inet.Interface{Name: "eth0", Flags: 0x1043, DeviceType: 1, Addr: []byte{2, 0, 0, 0, 0, 1}}
+	s.InterfacesMap[1] = inet.Interface{Name: "lo", Flags: 0x49, DeviceType: 772}
+	s.InterfaceAddrsMap[1] = []inet.InterfaceAddr{{Family: 2, PrefixLen: 8, Addr: []byte{127, 0, 0, 1}}}
+	s.InterfaceAddrsMap[2] = []inet.InterfaceAddr{{Family: 2, PrefixLen: 24, Addr: []byte{10, 0, 0, 2}}}
+	s.TCPRecvBufSize = inet.TCPBufferSize{Min: 1, Default: 2, Max: 3}
+	s.TCPSendBufSize = inet.TCPBufferSize{Min: 4, Default: 5, Max: 6}
+
+	want := "IPv6 supported: true\n" +
+		"1: lo flags=0x49 type=772 addr=\n" +
+		"\tfamily=2 127.0.0.1/8\n" +
+		"2: eth0 flags=0x1043 type=1 addr=02:00:00:00:00:01\n" +
+		"\tfamily=2 10.0.0.2/24\n" +
+		"TCP receive buffer: 1 2 3\n" +
+		"TCP send buffer: 4 5 6\n"
+	if got := describeNetwork(s); got != want {
+		t.Errorf("describeNetwork got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestNewCompatReport(t *testing.T) {
+	var ct kernel.CompatTracker
+	rep := newCompatReport(&ct)
+	want := &CompatReport{Syscalls: []CompatEntry{}, Ioctls: []CompatEntry{}}
+	if !reflect.DeepEqual(rep, want) {
+		t.Errorf("empty report got %+v, want %+v", rep, want)
+	}
+
+	args := arch.SyscallArguments{{Value: 1}, {Value: 0x20}}
+	ct.RecordSyscall(165, args) // mount
+	ct.RecordSyscall(165, args)
+	ct.RecordIoctl(0x5401, "pipe", args)
+	rep = newCompatReport(&ct)
+	wantArgs := []string{"0x1", "0x20", "0x0", "0x0", "0x0", "0x0"}
+	want = &CompatReport{
+		Syscalls: []CompatEntry{{Name: "mount", Count: 2, Args: wantArgs}},
+		Ioctls:   []CompatEntry{{Name: "ioctl", Request: 0x5401, File: "pipe", Count: 1, Args: wantArgs}},
+	}
+	if !reflect.DeepEqual(rep, want) {
+		t.Errorf("report got %+v, want %+v", rep, want)
+	}
+}
+
+func TestMaintenanceRun(t *testing.T) {
+	p := platform.FromContext(contexttest.Context(t))
+	m := Maintenance{Kernel: &kernel.Kernel{Platform: p}}
+
+	var out MaintenanceResult
+	opts := MaintenanceOpts{CompactHeap: true, NetworkDiagnostics: true, CompatReport: true}
+	if err := m.Run(&opts, &out); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if out.SentryHeapBefore == 0 || out.SentryHeapAfter == 0 {
+		t.Errorf("sentry heap not reported: %+v", out)
+	}
+	if want := "no network stack\n"; out.Network != want {
+		t.Errorf("network got %q, want %q", out.Network, want)
+	}
+	if out.Compat == nil {
+		t.Errorf("compatibility report missing")
+	}
+	if out.Heap != nil {
+		t.Errorf("heap profile present but not requested")
+	}
+
+	// Without a root mount namespace, there are no caches to drop.
+	if err := m.Run(&MaintenanceOpts{DropCaches: true}, &out); err == nil {
+		t.Errorf("Run with DropCaches succeeded without mounts, want error")
+	}
+}
+
+func TestMaintenanceDropCaches(t *testing.T) {
+	ctx := contexttest.Context(t)
+	p := platform.FromContext(ctx)
+	perms := fs.FilePermsFromMode(0777)
+	msrc := fs.NewCachingMountSource(nil, fs.MountSourceFlags{})
+	mns, err := fs.NewMountNamespace(ctx, tmpfs.NewDir(ctx, nil, fs.RootOwner, perms, msrc, p))
+	if err != nil {
+		t.Fatalf("NewMountNamespace failed: %v", err)
+	}
+	k := &kernel.Kernel{Platform: p}
+	k.SetRootMountNamespace(mns)
+
+	// The dirent of a created file stays cached after the last reference
+	// to the file is dropped.
+	root := mns.Root()
+	defer root.DecRef()
+	f, err := root.Create(ctx, root, "foo", fs.FileFlags{Read: true, Write: true}, perms)
+	if err != nil {
+		t.Fatalf("error creating foo: %v", err)
+	}
+	f.DecRef()
+	if msrc.CachedDirents() == 0 {
+		t.Fatalf("no dirents cached after create")
+	}
+
+	m := Maintenance{Kernel: k}
+	var out MaintenanceResult
+	if err := m.Run(&MaintenanceOpts{DropCaches: true}, &out); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if n := msrc.CachedDirents(); n != 0 {
+		t.Errorf("%d dirents cached after dropping caches, want 0", n)
+	}
+}
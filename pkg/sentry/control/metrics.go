@@ -0,0 +1,28 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package control
+
+import (
+	"gvisor.googlesource.com/gvisor/pkg/metric"
+)
+
+// Metrics includes functions for exporting the sentry's metrics.
+type Metrics struct{}
+
+// Snapshot returns the current values of all of the sentry's metrics.
+func (*Metrics) Snapshot(_ *struct{}, out *[]metric.MetricSnapshot) error {
+	*out = metric.Snapshot()
+	return nil
+}
@@ -0,0 +1,217 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package control
+
+import (
+	"errors"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+	"sync"
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/log"
+	"gvisor.googlesource.com/gvisor/pkg/urpc"
+)
+
+// ErrProfileInProgress is returned when a profile is requested while another
+// profile of the same kind is being collected.
+var ErrProfileInProgress = errors.New("a profile of this kind is already being collected")
+
+// Profile includes functions that collect pprof profiles of the sentry. Each
+// profile is written in the standard pprof format to the file provided in
+// the call.
+type Profile struct {
+	// mu protects the fields below.
+	mu sync.Mutex
+
+	// cpu, block, mutex and trace are true while the corresponding profile
+	// is being collected.
+	cpu   bool
+	block bool
+	mutex bool
+	trace bool
+
+	// blockAlways and mutexAlways are true if block and mutex profiling
+	// are enabled outside of Block and Mutex calls, see
+	// EnableBlockProfiling and EnableMutexProfiling.
+	blockAlways bool
+	mutexAlways bool
+}
+
+// ProfileOpts contains options for the profile RPC calls.
+type ProfileOpts struct {
+	// Duration is the amount of time over which CPU, block and mutex
+	// profiles and execution traces are collected. It is ignored for heap profiles.
+	Duration time.Duration `json:"duration"`
+
+	// FilePayload contains the destination for the profile.
+	urpc.FilePayload
+}
+
+// begin marks the profile tracked by inProgress as being collected.
+func (p *Profile) begin(inProgress *bool) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if *inProgress {
+		return ErrProfileInProgress
+	}
+	*inProgress = true
+	return nil
+}
+
+// end marks the profile tracked by inProgress as no longer being collected.
+func (p *Profile) end(inProgress *bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	*inProgress = false
+}
+
+// EnableBlockProfiling enables or disables the recording of blocking events
+// outside of Block calls. If it is enabled, Block profiles include the events
+// recorded since it was enabled, and Block leaves it enabled.
+func (p *Profile) EnableBlockProfiling(enable bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.blockAlways = enable
+	if enable {
+		runtime.SetBlockProfileRate(1)
+	} else if !p.block {
+		runtime.SetBlockProfileRate(0)
+	}
+}
+
+// EnableMutexProfiling enables or disables the recording of mutex contention
+// outside of Mutex calls, as EnableBlockProfiling does for blocking events.
+func (p *Profile) EnableMutexProfiling(enable bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.mutexAlways = enable
+	if enable {
+		runtime.SetMutexProfileFraction(1)
+	} else if !p.mutex {
+		runtime.SetMutexProfileFraction(0)
+	}
+}
+
+// CPU collects a CPU profile for o.Duration.
+func (p *Profile) CPU(o *ProfileOpts, _ *struct{}) error {
+	if len(o.FilePayload.Files) != 1 {
+		return ErrInvalidFiles
+	}
+	output := o.FilePayload.Files[0]
+	defer output.Close()
+
+	if err := p.begin(&p.cpu); err != nil {
+		return err
+	}
+	defer p.end(&p.cpu)
+
+	log.Infof("Collecting CPU profile for %v", o.Duration)
+	if err := pprof.StartCPUProfile(output); err != nil {
+		return err
+	}
+	time.Sleep(o.Duration)
+	pprof.StopCPUProfile()
+	return nil
+}
+
+// Heap writes a heap profile.
+func (p *Profile) Heap(o *ProfileOpts, _ *struct{}) error {
+	if len(o.FilePayload.Files) != 1 {
+		return ErrInvalidFiles
+	}
+	output := o.FilePayload.Files[0]
+	defer output.Close()
+
+	log.Infof("Writing heap profile")
+	// Run a garbage collection so that the profile is up to date.
+	runtime.GC()
+	return pprof.WriteHeapProfile(output)
+}
+
+// Block collects a profile of blocking on synchronization primitives for
+// o.Duration. Blocking events are accumulated across calls, so the profile
+// also includes events recorded by earlier calls.
+func (p *Profile) Block(o *ProfileOpts, _ *struct{}) error {
+	if len(o.FilePayload.Files) != 1 {
+		return ErrInvalidFiles
+	}
+	output := o.FilePayload.Files[0]
+	defer output.Close()
+
+	if err := p.begin(&p.block); err != nil {
+		return err
+	}
+	defer p.end(&p.block)
+
+	log.Infof("Collecting block profile for %v", o.Duration)
+	runtime.SetBlockProfileRate(1)
+	time.Sleep(o.Duration)
+	p.mu.Lock()
+	if !p.blockAlways {
+		runtime.SetBlockProfileRate(0)
+	}
+	p.mu.Unlock()
+	return pprof.Lookup("block").WriteTo(output, 0)
+}
+
+// Mutex collects a profile of mutex contention for o.Duration. As with
+// Block, contention events are accumulated across calls.
+func (p *Profile) Mutex(o *ProfileOpts, _ *struct{}) error {
+	if len(o.FilePayload.Files) != 1 {
+		return ErrInvalidFiles
+	}
+	output := o.FilePayload.Files[0]
+	defer output.Close()
+
+	if err := p.begin(&p.mutex); err != nil {
+		return err
+	}
+	defer p.end(&p.mutex)
+
+	log.Infof("Collecting mutex profile for %v", o.Duration)
+	runtime.SetMutexProfileFraction(1)
+	time.Sleep(o.Duration)
+	p.mu.Lock()
+	if !p.mutexAlways {
+		runtime.SetMutexProfileFraction(0)
+	}
+	p.mu.Unlock()
+	return pprof.Lookup("mutex").WriteTo(output, 0)
+}
+
+// Trace collects a runtime execution trace for o.Duration. The trace can be
+// viewed with "go tool trace".
+func (p *Profile) Trace(o *ProfileOpts, _ *struct{}) error {
+	if len(o.FilePayload.Files) != 1 {
+		return ErrInvalidFiles
+	}
+	output := o.FilePayload.Files[0]
+	defer output.Close()
+
+	if err := p.begin(&p.trace); err != nil {
+		return err
+	}
+	defer p.end(&p.trace)
+
+	log.Infof("Collecting execution trace for %v", o.Duration)
+	if err := trace.Start(output); err != nil {
+		return err
+	}
+	time.Sleep(o.Duration)
+	trace.Stop()
+	return nil
+}
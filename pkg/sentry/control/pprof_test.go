@@ -0,0 +1,95 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package control
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/urpc"
+)
+
+func profileOpts(t *testing.T, d time.Duration) (*ProfileOpts, string) {
+	f, err := ioutil.TempFile("", "pprof_test")
+	if err != nil {
+		t.Fatalf("TempFile failed: %v", err)
+	}
+	return &ProfileOpts{
+		Duration:    d,
+		FilePayload: urpc.FilePayload{Files: []*os.File{f}},
+	}, f.Name()
+}
+
+func TestProfile(t *testing.T) {
+	var p Profile
+	for _, test := range []struct {
+		name string
+		fn   func(*ProfileOpts, *struct{}) error
+	}{
+		{"CPU", p.CPU},
+		{"Heap", p.Heap},
+		{"Block", p.Block},
+		{"Mutex", p.Mutex},
+		{"Trace", p.Trace},
+	} {
+		o, name := profileOpts(t, 10*time.Millisecond)
+		defer os.Remove(name)
+		if err := test.fn(o, nil); err != nil {
+			t.Errorf("%s failed: %v", test.name, err)
+			continue
+		}
+		fi, err := os.Stat(name)
+		if err != nil {
+			t.Fatalf("Stat failed: %v", err)
+		}
+		if fi.Size() == 0 {
+			t.Errorf("%s wrote an empty profile", test.name)
+		}
+	}
+
+	if err := p.Heap(&ProfileOpts{}, nil); err != ErrInvalidFiles {
+		t.Errorf("Heap without a file got error %v, want %v", err, ErrInvalidFiles)
+	}
+}
+
+func TestProfileInProgress(t *testing.T) {
+	var p Profile
+	o, name := profileOpts(t, 500*time.Millisecond)
+	defer os.Remove(name)
+	done := make(chan error)
+	go func() { done <- p.CPU(o, nil) }()
+
+	// Wait for the first profile to start.
+	for {
+		p.mu.Lock()
+		started := p.cpu
+		p.mu.Unlock()
+		if started {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	o2, name2 := profileOpts(t, 0)
+	defer os.Remove(name2)
+	if err := p.CPU(o2, nil); err != ErrProfileInProgress {
+		t.Errorf("concurrent CPU got error %v, want %v", err, ErrProfileInProgress)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("CPU failed: %v", err)
+	}
+}
@@ -23,13 +23,16 @@ import (
 	"time"
 
 	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/bpf"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/host"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel/auth"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel/kdefs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel/sched"
 	ktime "gvisor.googlesource.com/gvisor/pkg/sentry/kernel/time"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/limits"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/mm"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/usage"
 	"gvisor.googlesource.com/gvisor/pkg/urpc"
 )
@@ -72,14 +75,54 @@ type ExecArgs struct {
 	// Capabilities is the list of capabilities to give to the process.
 	Capabilities *auth.TaskCapabilities
 
+	// Niceness is the niceness of the process, in the range [-20, 19].
+	Niceness int `json:"nice"`
+
+	// CPUs is the list of CPUs that the process may run on. If empty, the
+	// process may run on all CPUs.
+	CPUs []uint `json:"cpus"`
+
 	// FilePayload determines the files to give to the new process.
 	urpc.FilePayload
 }
 
 // Exec runs a new task.
 func (proc *Proc) Exec(args *ExecArgs, waitStatus *uint32) error {
-	// Import file descriptors.
+	// Processes started in the container get the same resource limits,
+	// syscall whitelist, syscall origin policy, executable mapping policy
+	// and seccomp filters, and are charged to the same PIDsController, as
+	// the container's init process.
 	l := limits.NewLimitSet()
+	var pids *kernel.PIDsController
+	var whitelist *kernel.SyscallWhitelist
+	var origins *kernel.SyscallOriginPolicy
+	var execs *mm.ExecPolicy
+	var filters []bpf.Program
+	if init := proc.Kernel.GlobalInit(); init != nil {
+		l = init.Limits().GetCopy()
+		pids = init.PIDsController()
+		whitelist = init.SyscallWhitelist()
+		origins = init.SyscallOriginPolicy()
+		execs = init.ExecPolicy()
+		filters = init.InitialSyscallFilters()
+	}
+
+	if args.Niceness < -20 || args.Niceness > 19 {
+		return fmt.Errorf("niceness %d is out of range [-20, 19]", args.Niceness)
+	}
+	var mask sched.CPUSet
+	if len(args.CPUs) > 0 {
+		cores := proc.Kernel.ApplicationCores()
+		mask = sched.NewCPUSet(cores)
+		for _, cpu := range args.CPUs {
+			if cpu >= cores {
+				return fmt.Errorf("CPU %d is out of range, the sandbox has %d CPUs", cpu, cores)
+			}
+			mask.Set(cpu)
+		}
+	}
+
+	// Import file descriptors.
 	fdm := proc.Kernel.NewFDMap()
 	defer fdm.DecRef()
 
@@ -102,6 +145,13 @@ func (proc *Proc) Exec(args *ExecArgs, waitStatus *uint32) error {
 		MaxSymlinkTraversals: linux.MaxSymlinkTraversals,
 		UTSNamespace:         proc.Kernel.RootUTSNamespace(),
 		IPCNamespace:         proc.Kernel.RootIPCNamespace(),
+		PIDsController:       pids,
+		SyscallWhitelist:     whitelist,
+		SyscallOrigins:       origins,
+		ExecPolicy:           execs,
+		SyscallFilters:       filters,
+		Niceness:             args.Niceness,
+		AllowedCPUMask:       mask,
 	}
 	ctx := initArgs.NewContext(proc.Kernel)
 	mounter := fs.FileOwnerFromContext(ctx)
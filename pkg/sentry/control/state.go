@@ -42,24 +42,50 @@ type SaveOpts struct {
 	// Metadata is the set of metadata to prepend to the state file.
 	Metadata map[string]string `json:"metadata"`
 
+	// Incremental indicates that only the memory that changed since the
+	// previous save should be saved. See state.SaveOpts.Incremental.
+	Incremental bool `json:"incremental"`
+
+	// Resume indicates that the system should continue running after the
+	// save, rather than exiting.
+	Resume bool `json:"resume"`
+
 	// FilePayload contains the destination for the state.
 	urpc.FilePayload
 }
 
-// Save saves the running system.
-func (s *State) Save(o *SaveOpts, _ *struct{}) error {
+// Save saves the running system. If inv is not nil, it is set to the
+// Inventory of the saved processes.
+func (s *State) Save(o *SaveOpts, inv *Inventory) error {
 	// Create an output stream.
 	if len(o.FilePayload.Files) != 1 {
 		return ErrInvalidFiles
 	}
 	defer o.FilePayload.Files[0].Close()
 
+	if inv != nil {
+		// Keep the kernel paused until it is saved, so that the
+		// inventory matches the saved state.
+		s.Kernel.Pause()
+		defer s.Kernel.Unpause()
+		*inv = *NewInventory(s.Kernel)
+	}
+
 	// Save to the first provided stream.
 	saveOpts := state.SaveOpts{
 		Destination: o.FilePayload.Files[0],
 		Key:         o.Key,
 		Metadata:    o.Metadata,
+		Incremental: o.Incremental,
 		Callback: func(err error) {
+			if o.Resume {
+				if err == nil {
+					log.Infof("Save succeeded: resuming...")
+				} else {
+					log.Warningf("Save failed: resuming...")
+				}
+				return
+			}
 			if err == nil {
 				log.Infof("Save succeeded: exiting...")
 			} else {
@@ -57,3 +57,30 @@ func TestMultiDevice(t *testing.T) {
 		t.Fatalf("got inode %d, want %d in %s", i, virtual+1, device)
 	}
 }
+
+func TestIOStats(t *testing.T) {
+	var s IOStats
+
+	r := s.Start()
+	w := s.Start()
+	if got := s.Snapshot().InFlight; got != 2 {
+		t.Fatalf("got %d I/Os in flight, want 2", got)
+	}
+
+	s.FinishRead(r, 4096)
+	s.FinishWrite(w, 1024)
+	got := s.Snapshot()
+	want := DiskStats{
+		ReadIOs:      1,
+		ReadSectors:  8,
+		ReadMillis:   got.ReadMillis,
+		WriteIOs:     1,
+		WriteSectors: 2,
+		WriteMillis:  got.WriteMillis,
+		IOMillis:     got.IOMillis,
+		QueueMillis:  got.QueueMillis,
+	}
+	if got != want {
+		t.Errorf("got stats %+v, want %+v", got, want)
+	}
+}
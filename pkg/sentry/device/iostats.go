@@ -0,0 +1,176 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package device
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// sectorSize is the unit of the sector counts in DiskStats. It is always 512,
+// regardless of the block size of the device.
+const sectorSize = 512
+
+// IOStats accumulates I/O statistics for a device.
+//
+// Like device numbers, IOStats are not saved: they are expected to be package
+// global variables, and restart from zero after restore.
+type IOStats struct {
+	// mu protects the fields below.
+	mu sync.Mutex
+
+	readIOs    uint64
+	readBytes  uint64
+	readTime   time.Duration
+	writeIOs   uint64
+	writeBytes uint64
+	writeTime  time.Duration
+
+	// inFlight is the number of I/Os that have started but not finished.
+	inFlight uint64
+
+	// busySince is the time at which inFlight last became non-zero.
+	busySince time.Time
+
+	// busyTime is the total time during which inFlight was non-zero,
+	// excluding the current busy period.
+	busyTime time.Duration
+}
+
+// Start records the start of an I/O. It returns the start time, which must
+// be passed to FinishRead or FinishWrite when the I/O completes.
+func (s *IOStats) Start() time.Time {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.inFlight == 0 {
+		s.busySince = now
+	}
+	s.inFlight++
+	return now
+}
+
+// FinishRead records the completion of a read of n bytes started at start.
+func (s *IOStats) FinishRead(start time.Time, n uint64) {
+	s.finish(start, func(d time.Duration) {
+		s.readIOs++
+		s.readBytes += n
+		s.readTime += d
+	})
+}
+
+// FinishWrite records the completion of a write of n bytes started at start.
+func (s *IOStats) FinishWrite(start time.Time, n uint64) {
+	s.finish(start, func(d time.Duration) {
+		s.writeIOs++
+		s.writeBytes += n
+		s.writeTime += d
+	})
+}
+
+// finish records the completion of an I/O started at start, calling fn with
+// the I/O's duration and s.mu held.
+func (s *IOStats) finish(start time.Time, fn func(d time.Duration)) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(now.Sub(start))
+	s.inFlight--
+	if s.inFlight == 0 {
+		s.busyTime += now.Sub(s.busySince)
+	}
+}
+
+// DiskStats is a snapshot of IOStats in the units of /proc/diskstats. See
+// Linux's Documentation/iostats.txt.
+type DiskStats struct {
+	ReadIOs      uint64
+	ReadSectors  uint64
+	ReadMillis   uint64
+	WriteIOs     uint64
+	WriteSectors uint64
+	WriteMillis  uint64
+	InFlight     uint64
+	IOMillis     uint64
+	QueueMillis  uint64
+}
+
+// Snapshot returns the current statistics.
+func (s *IOStats) Snapshot() DiskStats {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	busy := s.busyTime
+	if s.inFlight != 0 {
+		busy += now.Sub(s.busySince)
+	}
+	return DiskStats{
+		ReadIOs:      s.readIOs,
+		ReadSectors:  s.readBytes / sectorSize,
+		ReadMillis:   uint64(s.readTime / time.Millisecond),
+		WriteIOs:     s.writeIOs,
+		WriteSectors: s.writeBytes / sectorSize,
+		WriteMillis:  uint64(s.writeTime / time.Millisecond),
+		InFlight:     s.inFlight,
+		IOMillis:     uint64(busy / time.Millisecond),
+		// Merges aren't tracked, so the weighted time spent doing I/O
+		// is simply the sum of the time spent on completed I/Os.
+		QueueMillis: uint64((s.readTime + s.writeTime) / time.Millisecond),
+	}
+}
+
+// BlockDevice is a device whose I/O statistics are reported in
+// /proc/diskstats and /sys/block.
+type BlockDevice struct {
+	// Name is the name of the device, e.g. "vda".
+	Name string
+
+	// ID is the device number.
+	ID ID
+
+	// Stats are the device's I/O statistics.
+	Stats *IOStats
+}
+
+var blockDevices struct {
+	mu   sync.Mutex
+	devs []BlockDevice
+}
+
+// RegisterBlockDevice registers a device whose I/O statistics are reported
+// by BlockDevices. Like anonymous devices, block devices should be registered
+// during package initialization.
+func RegisterBlockDevice(name string, id ID, stats *IOStats) {
+	blockDevices.mu.Lock()
+	defer blockDevices.mu.Unlock()
+	blockDevices.devs = append(blockDevices.devs, BlockDevice{Name: name, ID: id, Stats: stats})
+}
+
+// BlockDevices returns all registered block devices, sorted by device
+// number.
+func BlockDevices() []BlockDevice {
+	blockDevices.mu.Lock()
+	devs := append([]BlockDevice(nil), blockDevices.devs...)
+	blockDevices.mu.Unlock()
+
+	sort.Slice(devs, func(i, j int) bool {
+		if devs[i].ID.Major != devs[j].ID.Major {
+			return devs[i].ID.Major < devs[j].ID.Major
+		}
+		return devs[i].ID.Minor < devs[j].ID.Minor
+	})
+	return devs
+}
@@ -0,0 +1,279 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package flightrecorder implements an in-memory recorder that periodically
+// samples the goroutine stacks of the sentry and the scheduling state of its
+// tasks. The recent samples can be dumped after an incident, to diagnose hangs
+// and stalls that are gone by the time they are investigated.
+package flightrecorder
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/log"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
+	ktime "gvisor.googlesource.com/gvisor/pkg/sentry/kernel/time"
+)
+
+// DefaultSamples is the default number of samples that are kept.
+const DefaultSamples = 60
+
+// taskStateNames are the names of the task goroutine states in dumps.
+var taskStateNames = map[kernel.TaskGoroutineState]string{
+	kernel.TaskGoroutineRunningSys:             "running-sys",
+	kernel.TaskGoroutineRunningApp:             "running-app",
+	kernel.TaskGoroutineBlockedInterruptible:   "blocked-interruptible",
+	kernel.TaskGoroutineBlockedUninterruptible: "blocked-uninterruptible",
+	kernel.TaskGoroutineStopped:                "stopped",
+}
+
+// sample is the state of the sentry at one point in time.
+type sample struct {
+	// time is when the sample was taken.
+	time time.Time
+
+	// goroutines is the number of goroutines.
+	goroutines int
+
+	// gomaxprocs is the maximum number of threads that run goroutines
+	// simultaneously.
+	gomaxprocs int
+
+	// tasks is the number of tasks in each goroutine state.
+	tasks map[kernel.TaskGoroutineState]int
+
+	// sysTasks are the tasks that have been running in the sentry for
+	// longer than a sample period, ordered by TID.
+	sysTasks []sysTask
+
+	// stacks are the stacks of all goroutines, as formatted by
+	// runtime.Stack, compressed with flate.
+	stacks []byte
+}
+
+// sysTask is a task that has been running in the sentry for a while.
+type sysTask struct {
+	tid     kernel.ThreadID
+	elapsed time.Duration
+}
+
+// Recorder periodically samples the state of the sentry, and keeps the most
+// recent samples.
+type Recorder struct {
+	// k is the kernel whose tasks are sampled. It may be nil, in which
+	// case only goroutines are sampled.
+	k *kernel.Kernel
+
+	// maxSamples is the maximum number of samples that are kept.
+	maxSamples int
+
+	// mu protects the fields below.
+	mu sync.Mutex
+
+	// period is the time between samples. If it is 0, the recorder is
+	// stopped.
+	period time.Duration
+
+	// samples is a ring buffer of the most recent samples. next is the
+	// index of the next sample in samples once it is full.
+	samples []sample
+	next    int
+
+	// stop and done are used to stop the sampling goroutine, and to wait
+	// for it.
+	stop chan struct{}
+	done chan struct{}
+
+	// stackBuf is reused to format stacks.
+	stackBuf []byte
+}
+
+// New returns a stopped Recorder that samples the tasks of k and keeps the
+// maxSamples most recent samples.
+func New(k *kernel.Kernel, maxSamples int) *Recorder {
+	if maxSamples <= 0 {
+		maxSamples = DefaultSamples
+	}
+	return &Recorder{
+		k:          k,
+		maxSamples: maxSamples,
+		stackBuf:   make([]byte, 64<<10),
+	}
+}
+
+// SetPeriod starts sampling every period, or stops sampling if period is 0.
+// Samples that were taken with a previous period are kept.
+func (r *Recorder) SetPeriod(period time.Duration) {
+	r.mu.Lock()
+	stop, done := r.stop, r.done
+	r.stop, r.done = nil, nil
+	r.period = period
+	if period > 0 {
+		r.stop, r.done = make(chan struct{}), make(chan struct{})
+		go r.loop(period, r.stop, r.done) // S/R-SAFE: diagnostics only.
+	}
+	r.mu.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+	if period > 0 {
+		log.Infof("Flight recorder sampling every %v, keeping %d samples", period, r.maxSamples)
+	} else {
+		log.Infof("Flight recorder stopped")
+	}
+}
+
+// loop takes a sample every period until stop is closed.
+func (r *Recorder) loop(period time.Duration, stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for {
+		r.sample(period)
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sample takes a sample and adds it to the ring buffer.
+func (r *Recorder) sample(period time.Duration) {
+	s := sample{
+		time:       time.Now(),
+		goroutines: runtime.NumGoroutine(),
+		gomaxprocs: runtime.GOMAXPROCS(0),
+	}
+	if r.k != nil {
+		s.tasks, s.sysTasks = r.taskStates(period)
+	}
+
+	// Only the sampling goroutine uses stackBuf.
+	for {
+		n := runtime.Stack(r.stackBuf, true)
+		if n < len(r.stackBuf) {
+			s.stacks = compress(r.stackBuf[:n])
+			break
+		}
+		r.stackBuf = make([]byte, 2*len(r.stackBuf))
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.samples) < r.maxSamples {
+		r.samples = append(r.samples, s)
+		return
+	}
+	r.samples[r.next] = s
+	r.next = (r.next + 1) % r.maxSamples
+}
+
+// taskStates returns the number of tasks in each state, and the tasks that
+// have been running in the sentry for longer than period.
+func (r *Recorder) taskStates(period time.Duration) (map[kernel.TaskGoroutineState]int, []sysTask) {
+	states := make(map[kernel.TaskGoroutineState]int)
+	var sys []sysTask
+	now := ktime.FromNanoseconds(int64(r.k.CPUClockNow() * uint64(linux.ClockTick)))
+	ts := r.k.TaskSet()
+	for _, t := range ts.Root.Tasks() {
+		sched := t.TaskGoroutineSchedInfo()
+		states[sched.State]++
+		if sched.State != kernel.TaskGoroutineRunningSys {
+			continue
+		}
+		since := ktime.FromNanoseconds(int64(sched.Timestamp * uint64(linux.ClockTick)))
+		if elapsed := now.Sub(since); elapsed > period {
+			sys = append(sys, sysTask{tid: ts.Root.IDOfTask(t), elapsed: elapsed})
+		}
+	}
+	sort.Slice(sys, func(i, j int) bool { return sys[i].tid < sys[j].tid })
+	return states, sys
+}
+
+// compress returns b compressed with flate.
+func compress(b []byte) []byte {
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.BestSpeed)
+	if err != nil {
+		panic(fmt.Sprintf("flate.NewWriter failed: %v", err))
+	}
+	w.Write(b)
+	w.Close()
+	return buf.Bytes()
+}
+
+// Dump writes the samples to w in a human-readable format, from the oldest to
+// the most recent.
+func (r *Recorder) Dump(w io.Writer) error {
+	r.mu.Lock()
+	samples := make([]sample, 0, len(r.samples))
+	samples = append(samples, r.samples[r.next:]...)
+	samples = append(samples, r.samples[:r.next]...)
+	period := r.period
+	r.mu.Unlock()
+
+	if period == 0 && len(samples) == 0 {
+		return fmt.Errorf("flight recorder is not enabled")
+	}
+	if _, err := fmt.Fprintf(w, "Flight recorder: %d samples, period %v\n", len(samples), period); err != nil {
+		return err
+	}
+	for i, s := range samples {
+		if err := s.dump(w, i+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dump writes s, the n-th sample, to w.
+func (s *sample) dump(w io.Writer, n int) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "\n=== Sample %d at %s\n", n, s.time.Format(time.RFC3339Nano))
+	fmt.Fprintf(&buf, "Goroutines: %d, GOMAXPROCS: %d\n", s.goroutines, s.gomaxprocs)
+	if s.tasks != nil {
+		buf.WriteString("Tasks:")
+		for state := kernel.TaskGoroutineRunningSys; state <= kernel.TaskGoroutineStopped; state++ {
+			fmt.Fprintf(&buf, " %s %d", taskStateNames[state], s.tasks[state])
+		}
+		buf.WriteString("\n")
+	}
+	if len(s.sysTasks) > 0 {
+		buf.WriteString("Tasks running in the sentry for longer than the period:")
+		for _, t := range s.sysTasks {
+			fmt.Fprintf(&buf, " %d (%v)", t.tid, t.elapsed)
+		}
+		buf.WriteString("\n")
+	}
+	buf.WriteString("\n")
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return err
+	}
+
+	fr := flate.NewReader(bytes.NewReader(s.stacks))
+	defer fr.Close()
+	_, err := io.Copy(w, fr)
+	return err
+}
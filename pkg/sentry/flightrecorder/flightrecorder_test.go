@@ -0,0 +1,91 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package flightrecorder
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDumpDisabled(t *testing.T) {
+	r := New(nil, 3)
+	if err := r.Dump(&bytes.Buffer{}); err == nil {
+		t.Errorf("Dump succeeded on a disabled recorder, want error")
+	}
+}
+
+func TestRing(t *testing.T) {
+	r := New(nil, 3)
+	for i := 0; i < 5; i++ {
+		r.sample(time.Second)
+	}
+	if len(r.samples) != 3 {
+		t.Fatalf("got %d samples, want 3", len(r.samples))
+	}
+
+	var buf bytes.Buffer
+	if err := r.Dump(&buf); err != nil {
+		t.Fatalf("Dump failed: %v", err)
+	}
+	out := buf.String()
+	if !strings.HasPrefix(out, "Flight recorder: 3 samples") {
+		t.Errorf("Dump output doesn't start with the summary:\n%s", out)
+	}
+	if got := strings.Count(out, "\n=== Sample "); got != 3 {
+		t.Errorf("Dump output has %d samples, want 3", got)
+	}
+	// The stacks of this goroutine were sampled.
+	if !strings.Contains(out, "flightrecorder.TestRing") {
+		t.Errorf("Dump output doesn't contain the stack of the test:\n%s", out)
+	}
+
+	// Samples are dumped from the oldest to the most recent.
+	var prev time.Time
+	for i := 0; i < 3; i++ {
+		s := r.samples[(r.next+i)%3]
+		if s.time.Before(prev) {
+			t.Errorf("sample %d at %v is older than the previous sample at %v", i, s.time, prev)
+		}
+		prev = s.time
+	}
+}
+
+func TestSetPeriod(t *testing.T) {
+	r := New(nil, 10)
+	r.SetPeriod(time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	r.SetPeriod(0)
+
+	r.mu.Lock()
+	n := len(r.samples)
+	r.mu.Unlock()
+	if n == 0 {
+		t.Fatalf("no samples were taken")
+	}
+
+	// The samples are kept after the recorder is stopped.
+	var buf bytes.Buffer
+	if err := r.Dump(&buf); err != nil {
+		t.Fatalf("Dump failed: %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.samples) != n {
+		t.Errorf("got %d samples after the recorder was stopped, want %d", len(r.samples), n)
+	}
+}
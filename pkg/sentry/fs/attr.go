@@ -172,16 +172,22 @@ type UnstableAttr struct {
 	// StatusChangeTime is the time of last attribute modification.
 	StatusChangeTime ktime.Time
 
+	// CreationTime is the time the file was created. It is zero if the
+	// filesystem doesn't record it.
+	CreationTime ktime.Time
+
 	// Links is the number of hard links.
 	Links uint64
 }
 
-// WithCurrentTime returns u with AccessTime == ModificationTime == current time.
+// WithCurrentTime returns u with AccessTime == ModificationTime ==
+// StatusChangeTime == CreationTime == current time.
 func WithCurrentTime(ctx context.Context, u UnstableAttr) UnstableAttr {
 	t := ktime.NowFromContext(ctx)
 	u.AccessTime = t
 	u.ModificationTime = t
 	u.StatusChangeTime = t
+	u.CreationTime = t
 	return u
 }
 
@@ -26,6 +26,9 @@ type contextID int
 const (
 	// CtxRoot is a Context.Value key for a Dirent.
 	CtxRoot contextID = iota
+
+	// CtxWriteAuditor is a Context.Value key for a WriteAuditor.
+	CtxWriteAuditor
 )
 
 // ContextCanAccessFile determines whether `file` can be accessed in the requested way
@@ -95,3 +98,12 @@ func RootFromContext(ctx context.Context) *Dirent {
 	}
 	return nil
 }
+
+// WriteAuditorFromContext returns the WriteAuditor used by ctx, or nil if ctx
+// does not audit writes.
+func WriteAuditorFromContext(ctx context.Context) WriteAuditor {
+	if v := ctx.Value(CtxWriteAuditor); v != nil {
+		return v.(WriteAuditor)
+	}
+	return nil
+}
@@ -84,6 +84,10 @@ func New(ctx context.Context, msrc *fs.MountSource, binderEnabled bool, ashmemEn
 		"random":  newCharacterDevice(newRandomDevice(ctx, fs.RootOwner, 0444), msrc),
 		"urandom": newCharacterDevice(newRandomDevice(ctx, fs.RootOwner, 0444), msrc),
 
+		// A virtual RTC, for hwclock(8) and the like. See rtcDevice.
+		"rtc0": newCharacterDevice(newRTCDevice(ctx, fs.RootOwner, 0644), msrc),
+		"rtc":  newSymlink(ctx, "rtc0", msrc),
+
 		"shm": tmpfs.NewDir(ctx, nil, fs.RootOwner, fs.FilePermsFromMode(0777), msrc, platform.FromContext(ctx)),
 
 		// A devpts is typically mounted at /dev/pts to provide
@@ -0,0 +1,471 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dev
+
+import (
+	"sync"
+	"syscall"
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/arch"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/fsutil"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/ramfs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel/auth"
+	ktime "gvisor.googlesource.com/gvisor/pkg/sentry/kernel/time"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
+	"gvisor.googlesource.com/gvisor/pkg/syserror"
+	"gvisor.googlesource.com/gvisor/pkg/waiter"
+)
+
+// rtcMaxUserFreq is the highest periodic interrupt frequency that may be set
+// without CAP_SYS_RESOURCE, as in Linux.
+const rtcMaxUserFreq = 64
+
+// rtcDevice is a virtual real-time clock, as described by rtc(4).
+//
+// The RTC runs off the sandbox's realtime clock. Setting the RTC only changes
+// its offset from that clock, so it does not change the time seen by the rest
+// of the sandbox.
+type rtcDevice struct {
+	ramfs.Entry
+
+	// mu protects the fields below.
+	mu sync.Mutex `state:"nosave"`
+
+	// offset is the RTC time minus the realtime clock.
+	offset time.Duration
+
+	// alarm is the RTC time of the alarm. It is zero if no alarm is set.
+	alarm ktime.Time
+
+	// alarmEnabled is true if the alarm interrupt is enabled (RTC_AIE_ON).
+	alarmEnabled bool
+
+	// freq is the periodic interrupt frequency in Hz.
+	freq uint64
+
+	// file is the open file, if any. Like Linux, the RTC may only be open
+	// once at a time.
+	file *rtcFile
+}
+
+func newRTCDevice(ctx context.Context, owner fs.FileOwner, mode linux.FileMode) *rtcDevice {
+	r := &rtcDevice{
+		freq: 1,
+	}
+	r.InitEntry(ctx, owner, fs.FilePermsFromMode(mode))
+	return r
+}
+
+// GetFile implements fs.InodeOperations.GetFile.
+func (r *rtcDevice) GetFile(ctx context.Context, d *fs.Dirent, flags fs.FileFlags) (*fs.File, error) {
+	clock := ktime.RealtimeClockFromContext(ctx)
+	if clock == nil {
+		return nil, syserror.ENODEV
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file != nil {
+		return nil, syserror.EBUSY
+	}
+	f := &rtcFile{dev: r}
+	f.alarmTimer = ktime.NewTimer(clock, &rtcIRQ{f: f, flag: linux.RTC_AF})
+	f.updateTimer = ktime.NewTimer(clock, &rtcIRQ{f: f, flag: linux.RTC_UF})
+	f.periodicTimer = ktime.NewTimer(clock, &rtcIRQ{f: f, flag: linux.RTC_PF})
+	r.file = f
+	r.armTimersLocked()
+	return fs.NewFile(ctx, d, flags, f), nil
+}
+
+// Truncate is ignored for character devices.
+func (*rtcDevice) Truncate(context.Context, *fs.Inode, int64) error {
+	return nil
+}
+
+// nowLocked returns the current RTC time.
+//
+// Preconditions: r.mu must be locked. r.file != nil.
+func (r *rtcDevice) nowLocked() ktime.Time {
+	return r.file.alarmTimer.Clock().Now().Add(r.offset)
+}
+
+// armTimersLocked arms or disarms the open file's alarm and update timers,
+// which depend on the RTC's offset.
+//
+// Preconditions: r.mu must be locked.
+func (r *rtcDevice) armTimersLocked() {
+	f := r.file
+	if f == nil {
+		return
+	}
+	var alarm ktime.Setting
+	if r.alarmEnabled && !r.alarm.IsZero() {
+		alarm = ktime.Setting{
+			Enabled: true,
+			Next:    r.alarm.Add(-r.offset),
+		}
+	}
+	f.alarmTimer.Swap(alarm)
+
+	var update ktime.Setting
+	if f.updateEnabled {
+		// Update interrupts are raised as each RTC second begins.
+		now := r.nowLocked()
+		next := ktime.FromSeconds(now.Seconds() + 1)
+		update = ktime.Setting{
+			Enabled: true,
+			Next:    next.Add(-r.offset),
+			Period:  time.Second,
+		}
+	}
+	f.updateTimer.Swap(update)
+}
+
+// rtcFile implements fs.FileOperations for an open RTC.
+type rtcFile struct {
+	fsutil.PipeSeek      `state:"nosave"`
+	fsutil.NotDirReaddir `state:"nosave"`
+	fsutil.NoFsync       `state:"nosave"`
+	fsutil.NoopFlush     `state:"nosave"`
+	fsutil.NoMMap        `state:"nosave"`
+
+	events waiter.Queue `state:"nosave"`
+
+	dev *rtcDevice
+
+	// alarmTimer, updateTimer and periodicTimer raise alarm, update and
+	// periodic interrupts. Immutable.
+	alarmTimer    *ktime.Timer
+	updateTimer   *ktime.Timer
+	periodicTimer *ktime.Timer
+
+	// updateEnabled and periodicEnabled are true if update and periodic
+	// interrupts are enabled. They are protected by dev.mu.
+	updateEnabled   bool
+	periodicEnabled bool
+
+	// irqMu protects irqData. It is taken by timer listeners, so it must not
+	// be held while calling Timer methods.
+	irqMu sync.Mutex `state:"nosave"`
+
+	// irqData holds the number of interrupts since the last read in its
+	// upper bytes and the interrupt flags in its low byte, as returned by
+	// read(2).
+	irqData uint64
+}
+
+// rtcIRQ is a ktime.TimerListener that raises an RTC interrupt.
+type rtcIRQ struct {
+	f    *rtcFile
+	flag uint64
+}
+
+// Notify implements ktime.TimerListener.Notify.
+func (i *rtcIRQ) Notify(exp uint64) {
+	i.f.irqMu.Lock()
+	i.f.irqData = (i.f.irqData + exp<<8) | i.flag | linux.RTC_IRQF
+	i.f.irqMu.Unlock()
+	i.f.events.Notify(waiter.EventIn)
+}
+
+// Destroy implements ktime.TimerListener.Destroy.
+func (*rtcIRQ) Destroy() {}
+
+// Release implements fs.FileOperations.Release.
+func (f *rtcFile) Release() {
+	f.dev.mu.Lock()
+	f.dev.file = nil
+	f.dev.mu.Unlock()
+	f.alarmTimer.Destroy()
+	f.updateTimer.Destroy()
+	f.periodicTimer.Destroy()
+}
+
+// PauseTimer pauses the RTC's timers.
+func (f *rtcFile) PauseTimer() {
+	f.alarmTimer.Pause()
+	f.updateTimer.Pause()
+	f.periodicTimer.Pause()
+}
+
+// ResumeTimer resumes the RTC's timers.
+func (f *rtcFile) ResumeTimer() {
+	f.alarmTimer.Resume()
+	f.updateTimer.Resume()
+	f.periodicTimer.Resume()
+}
+
+// Readiness implements waiter.Waitable.Readiness.
+func (f *rtcFile) Readiness(mask waiter.EventMask) waiter.EventMask {
+	f.irqMu.Lock()
+	defer f.irqMu.Unlock()
+	if f.irqData != 0 {
+		return mask & waiter.EventIn
+	}
+	return 0
+}
+
+// EventRegister implements waiter.Waitable.EventRegister.
+func (f *rtcFile) EventRegister(e *waiter.Entry, mask waiter.EventMask) {
+	f.events.EventRegister(e, mask)
+}
+
+// EventUnregister implements waiter.Waitable.EventUnregister.
+func (f *rtcFile) EventUnregister(e *waiter.Entry) {
+	f.events.EventUnregister(e)
+}
+
+// Read implements fs.FileOperations.Read. It returns the interrupts raised
+// since the last read, blocking until there is one.
+func (f *rtcFile) Read(ctx context.Context, _ *fs.File, dst usermem.IOSequence, _ int64) (int64, error) {
+	// Like Linux, return an unsigned int if that is all that fits, and an
+	// unsigned long otherwise.
+	size := dst.NumBytes()
+	switch {
+	case size < 4:
+		return 0, syserror.EINVAL
+	case size < 8:
+		size = 4
+	default:
+		size = 8
+	}
+
+	f.irqMu.Lock()
+	data := f.irqData
+	f.irqData = 0
+	f.irqMu.Unlock()
+	if data == 0 {
+		return 0, syserror.ErrWouldBlock
+	}
+
+	var buf [8]byte
+	if size == 4 {
+		usermem.ByteOrder.PutUint32(buf[:], uint32(data))
+	} else {
+		usermem.ByteOrder.PutUint64(buf[:], data)
+	}
+	n, err := dst.CopyOut(ctx, buf[:size])
+	return int64(n), err
+}
+
+// Write implements fs.FileOperations.Write.
+func (*rtcFile) Write(context.Context, *fs.File, usermem.IOSequence, int64) (int64, error) {
+	return 0, syserror.EINVAL
+}
+
+// Ioctl implements fs.FileOperations.Ioctl.
+func (f *rtcFile) Ioctl(ctx context.Context, io usermem.IO, args arch.SyscallArguments) (uintptr, error) {
+	r := f.dev
+	addr := args[2].Pointer()
+	opts := usermem.IOOpts{
+		AddressSpaceActive: true,
+	}
+
+	switch args[1].Uint() {
+	case linux.RTC_RD_TIME:
+		r.mu.Lock()
+		tm := rtcTimeFrom(r.nowLocked())
+		r.mu.Unlock()
+		_, err := usermem.CopyObjectOut(ctx, io, addr, &tm, opts)
+		return 0, err
+
+	case linux.RTC_SET_TIME:
+		if !auth.CredentialsFromContext(ctx).HasCapability(linux.CAP_SYS_TIME) {
+			return 0, syserror.EACCES
+		}
+		var tm linux.RtcTime
+		if _, err := usermem.CopyObjectIn(ctx, io, addr, &tm, opts); err != nil {
+			return 0, err
+		}
+		t, err := rtcTimeTo(tm)
+		if err != nil {
+			return 0, err
+		}
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.offset = t.Sub(f.alarmTimer.Clock().Now())
+		r.armTimersLocked()
+		return 0, nil
+
+	case linux.RTC_ALM_READ:
+		r.mu.Lock()
+		tm := rtcTimeFrom(r.alarm)
+		r.mu.Unlock()
+		_, err := usermem.CopyObjectOut(ctx, io, addr, &tm, opts)
+		return 0, err
+
+	case linux.RTC_ALM_SET:
+		var tm linux.RtcTime
+		if _, err := usermem.CopyObjectIn(ctx, io, addr, &tm, opts); err != nil {
+			return 0, err
+		}
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		// RTC_ALM_SET only sets the time of day. The alarm is the next
+		// occurrence of that time, within 24 hours, and is disabled until
+		// RTC_AIE_ON.
+		now := rtcTimeFrom(r.nowLocked())
+		tm.Year, tm.Mon, tm.Mday = now.Year, now.Mon, now.Mday
+		t, err := rtcTimeTo(tm)
+		if err != nil {
+			return 0, err
+		}
+		if !t.After(r.nowLocked()) {
+			t = t.Add(24 * time.Hour)
+		}
+		r.alarm = t
+		r.alarmEnabled = false
+		r.armTimersLocked()
+		return 0, nil
+
+	case linux.RTC_WKALM_RD:
+		f.irqMu.Lock()
+		pending := f.irqData&linux.RTC_AF != 0
+		f.irqMu.Unlock()
+		r.mu.Lock()
+		alrm := linux.RtcWkalrm{
+			Time: rtcTimeFrom(r.alarm),
+		}
+		if r.alarmEnabled {
+			alrm.Enabled = 1
+		}
+		r.mu.Unlock()
+		if pending {
+			alrm.Pending = 1
+		}
+		_, err := usermem.CopyObjectOut(ctx, io, addr, &alrm, opts)
+		return 0, err
+
+	case linux.RTC_WKALM_SET:
+		var alrm linux.RtcWkalrm
+		if _, err := usermem.CopyObjectIn(ctx, io, addr, &alrm, opts); err != nil {
+			return 0, err
+		}
+		t, err := rtcTimeTo(alrm.Time)
+		if err != nil {
+			return 0, err
+		}
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if alrm.Enabled != 0 && !t.After(r.nowLocked()) {
+			return 0, syscall.ETIME
+		}
+		r.alarm = t
+		r.alarmEnabled = alrm.Enabled != 0
+		r.armTimersLocked()
+		return 0, nil
+
+	case linux.RTC_AIE_ON, linux.RTC_AIE_OFF:
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		on := args[1].Uint() == linux.RTC_AIE_ON
+		if on && r.alarm.IsZero() {
+			return 0, syserror.EINVAL
+		}
+		r.alarmEnabled = on
+		r.armTimersLocked()
+		return 0, nil
+
+	case linux.RTC_UIE_ON, linux.RTC_UIE_OFF:
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		f.updateEnabled = args[1].Uint() == linux.RTC_UIE_ON
+		r.armTimersLocked()
+		return 0, nil
+
+	case linux.RTC_PIE_ON, linux.RTC_PIE_OFF:
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		f.periodicEnabled = args[1].Uint() == linux.RTC_PIE_ON
+		f.armPeriodicLocked()
+		return 0, nil
+
+	case linux.RTC_IRQP_READ:
+		r.mu.Lock()
+		freq := r.freq
+		r.mu.Unlock()
+		_, err := usermem.CopyObjectOut(ctx, io, addr, &freq, opts)
+		return 0, err
+
+	case linux.RTC_IRQP_SET:
+		freq := args[2].Uint64()
+		if freq == 0 || freq > linux.RTC_MAX_FREQ {
+			return 0, syserror.EINVAL
+		}
+		if freq > rtcMaxUserFreq && !auth.CredentialsFromContext(ctx).HasCapability(linux.CAP_SYS_RESOURCE) {
+			return 0, syserror.EACCES
+		}
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.freq = freq
+		f.armPeriodicLocked()
+		return 0, nil
+
+	default:
+		return 0, syserror.ENOTTY
+	}
+}
+
+// armPeriodicLocked arms or disarms the periodic interrupt timer.
+//
+// Preconditions: f.dev.mu must be locked.
+func (f *rtcFile) armPeriodicLocked() {
+	var s ktime.Setting
+	if f.periodicEnabled {
+		period := time.Second / time.Duration(f.dev.freq)
+		s = ktime.Setting{
+			Enabled: true,
+			Next:    f.periodicTimer.Clock().Now().Add(period),
+			Period:  period,
+		}
+	}
+	f.periodicTimer.Swap(s)
+}
+
+// rtcTimeFrom converts t to a broken-down UTC time.
+func rtcTimeFrom(t ktime.Time) linux.RtcTime {
+	s, ns := t.Unix()
+	ut := time.Unix(s, ns).UTC()
+	return linux.RtcTime{
+		Sec:  int32(ut.Second()),
+		Min:  int32(ut.Minute()),
+		Hour: int32(ut.Hour()),
+		Mday: int32(ut.Day()),
+		Mon:  int32(ut.Month()) - 1,
+		Year: int32(ut.Year()) - 1900,
+		Wday: int32(ut.Weekday()),
+		Yday: int32(ut.YearDay()) - 1,
+	}
+}
+
+// rtcTimeTo converts a broken-down UTC time to a ktime.Time. It returns
+// EINVAL if tm is not a valid time, as Linux's rtc_valid_tm does.
+func rtcTimeTo(tm linux.RtcTime) (ktime.Time, error) {
+	if tm.Year < 70 || tm.Mon < 0 || tm.Mon >= 12 || tm.Mday < 1 ||
+		tm.Hour < 0 || tm.Hour >= 24 || tm.Min < 0 || tm.Min >= 60 ||
+		tm.Sec < 0 || tm.Sec >= 60 {
+		return ktime.Time{}, syserror.EINVAL
+	}
+	t := time.Date(int(tm.Year)+1900, time.Month(tm.Mon+1), int(tm.Mday), int(tm.Hour), int(tm.Min), int(tm.Sec), 0, time.UTC)
+	// time.Date normalizes days past the end of the month.
+	if t.Day() != int(tm.Mday) {
+		return ktime.Time{}, syserror.EINVAL
+	}
+	return ktime.FromUnix(t.Unix(), 0), nil
+}
@@ -0,0 +1,130 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package devproxy
+
+import (
+	"syscall"
+
+	"gvisor.googlesource.com/gvisor/pkg/sentry/arch"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/device"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/fsutil"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/ramfs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/memmap"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
+	"gvisor.googlesource.com/gvisor/pkg/syserror"
+)
+
+// proxyDevice is the pseudo-filesystem device of proxied device files.
+var proxyDevice = device.NewAnonDevice()
+
+// Device is a device file that forwards the ioctls safelisted by its driver to
+// a host device.
+type Device struct {
+	ramfs.Entry
+
+	// driver is the host driver of the device.
+	driver *Driver `state:"nosave"`
+
+	// hostFD is the file descriptor of the host device. It is owned by the
+	// Device.
+	hostFD int `state:"nosave"`
+}
+
+// NewDevice returns a Device that forwards ioctls to the host device open at
+// hostFD, taking ownership of hostFD.
+func NewDevice(ctx context.Context, driver *Driver, hostFD int, owner fs.FileOwner, perms fs.FilePermissions) *Device {
+	d := &Device{
+		driver: driver,
+		hostFD: hostFD,
+	}
+	d.InitEntry(ctx, owner, perms)
+	return d
+}
+
+// NewInode returns a character device inode for d.
+func NewInode(d *Device, msrc *fs.MountSource) *fs.Inode {
+	return fs.NewInode(d, msrc, fs.StableAttr{
+		DeviceID:  proxyDevice.DeviceID(),
+		InodeID:   proxyDevice.NextIno(),
+		BlockSize: usermem.PageSize,
+		Type:      fs.CharacterDevice,
+	})
+}
+
+// Release implements fs.InodeOperations.Release.
+func (d *Device) Release(context.Context) {
+	syscall.Close(d.hostFD)
+}
+
+// Truncate is ignored for character devices, like on Linux.
+func (d *Device) Truncate(context.Context, *fs.Inode, int64) error {
+	return nil
+}
+
+// GetFile implements fs.InodeOperations.GetFile.
+func (d *Device) GetFile(ctx context.Context, dirent *fs.Dirent, flags fs.FileFlags) (*fs.File, error) {
+	return fs.NewFile(ctx, dirent, flags, &fileOperations{
+		Handle: fsutil.Handle{HandleOperations: dirent.Inode.HandleOps()},
+		device: d,
+	}), nil
+}
+
+// fileOperations implements fs.FileOperations for a Device.
+type fileOperations struct {
+	fsutil.Handle
+
+	device *Device
+}
+
+// ConfigureMMap implements fs.FileOperations.ConfigureMMap.
+func (*fileOperations) ConfigureMMap(context.Context, *fs.File, *memmap.MMapOpts) error {
+	// Mapping host device memory is not supported.
+	return syserror.ENODEV
+}
+
+// Ioctl implements fs.FileOperations.Ioctl.
+func (f *fileOperations) Ioctl(ctx context.Context, io usermem.IO, args arch.SyscallArguments) (uintptr, error) {
+	request := args[1].Uint()
+	if !f.device.driver.allowed(request) {
+		return 0, syserror.ENOTTY
+	}
+
+	dir := request >> ioctlDirShift
+	buf := make([]byte, (request>>ioctlSizeShift)&ioctlSizeMask)
+	addr := args[2].Pointer()
+	if dir&ioctlWrite != 0 {
+		if _, err := io.CopyIn(ctx, addr, buf, usermem.IOOpts{
+			AddressSpaceActive: true,
+		}); err != nil {
+			return 0, err
+		}
+	}
+
+	ret, err := hostIoctl(f.device.hostFD, request, buf)
+	if err != nil {
+		return 0, err
+	}
+
+	if dir&ioctlRead != 0 {
+		if _, err := io.CopyOut(ctx, addr, buf, usermem.IOOpts{
+			AddressSpaceActive: true,
+		}); err != nil {
+			return 0, err
+		}
+	}
+	return ret, nil
+}
@@ -0,0 +1,142 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package devproxy provides device files that forward a safelisted set of
+// ioctls to a host device.
+//
+// Only ioctls whose argument is a single buffer, with the direction and size
+// encoded in the request number, can be forwarded: the buffer is copied from
+// the application, passed to the host driver and copied back. Ioctls whose
+// arguments contain pointers or file descriptors can't be forwarded, since
+// those are only meaningful in the application's address space and FD table.
+// Read, write and mmap are not supported.
+package devproxy
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+// Ioctl request numbers are encoded as in include/uapi/asm-generic/ioctl.h.
+const (
+	ioctlNumberShift = 0
+	ioctlTypeShift   = 8
+	ioctlSizeShift   = 16
+	ioctlDirShift    = 30
+
+	ioctlSizeMask = 1<<14 - 1
+
+	ioctlWrite = 1
+	ioctlRead  = 2
+)
+
+// ioc returns an ioctl request number, like _IOC in
+// include/uapi/asm-generic/ioctl.h.
+func ioc(dir, typ, nr, size uint32) uint32 {
+	return dir<<ioctlDirShift | size<<ioctlSizeShift | typ<<ioctlTypeShift | nr<<ioctlNumberShift
+}
+
+// Driver describes a host driver whose devices may be proxied.
+type Driver struct {
+	// Name is the name of the driver.
+	Name string
+
+	// Devices matches the names of the driver's device files in /dev.
+	Devices *regexp.Regexp
+
+	// Ioctls is the safelist of ioctl requests that are forwarded to the
+	// host. Requests are matched in full, including their direction and
+	// size, so that the sentry never copies a buffer of a different size
+	// than the host driver expects.
+	Ioctls map[uint32]struct{}
+}
+
+// allowed returns true if request may be forwarded to the driver.
+func (d *Driver) allowed(request uint32) bool {
+	dir := request >> ioctlDirShift
+	size := (request >> ioctlSizeShift) & ioctlSizeMask
+	if dir == 0 || size == 0 {
+		// The argument isn't a buffer that can be copied.
+		return false
+	}
+	_, ok := d.Ioctls[request]
+	return ok
+}
+
+const (
+	// nvidiaIoctlType is NV_IOCTL_MAGIC.
+	nvidiaIoctlType = 'F'
+
+	// nvidiaMaxDevices is NV_MAX_DEVICES.
+	nvidiaMaxDevices = 32
+
+	// nvidiaCardInfoSize is sizeof(nv_ioctl_card_info_t).
+	nvidiaCardInfoSize = 72
+)
+
+// nvidiaIoctl returns the request number of the NVIDIA control escape nr,
+// whose argument is a size byte buffer.
+func nvidiaIoctl(nr, size uint32) uint32 {
+	return ioc(ioctlRead|ioctlWrite, nvidiaIoctlType, nr, size)
+}
+
+// nvidia is the NVIDIA GPU driver. Only its control escapes with flat
+// arguments are safelisted, which lets applications query the driver and the
+// devices but not use them: resource manager ioctls pass pointers to
+// parameter structures and are not forwarded.
+var nvidia = &Driver{
+	Name:    "nvidia",
+	Devices: regexp.MustCompile(`^nvidia(ctl|[0-9]+)$`),
+	Ioctls: func() map[uint32]struct{} {
+		m := map[uint32]struct{}{
+			nvidiaIoctl(200, nvidiaCardInfoSize*nvidiaMaxDevices): {}, // NV_ESC_CARD_INFO
+			nvidiaIoctl(209, 12): {}, // NV_ESC_STATUS_CODE
+			nvidiaIoctl(210, 72): {}, // NV_ESC_CHECK_VERSION_STR
+			nvidiaIoctl(214, 8):  {}, // NV_ESC_SYS_PARAMS
+		}
+		// NV_ESC_ATTACH_GPUS_TO_FD takes an array of GPU IDs.
+		for n := uint32(1); n <= nvidiaMaxDevices; n++ {
+			m[nvidiaIoctl(212, 4*n)] = struct{}{}
+		}
+		return m
+	}(),
+}
+
+// drivers is the list of drivers whose devices may be proxied.
+var drivers = []*Driver{nvidia}
+
+// FindDriver returns the driver of the device file with the given name in
+// /dev.
+func FindDriver(name string) (*Driver, error) {
+	for _, d := range drivers {
+		if d.Devices.MatchString(name) {
+			return d, nil
+		}
+	}
+	return nil, fmt.Errorf("device %q is not supported by the device proxy", name)
+}
+
+// Requests returns the ioctl requests safelisted by any driver, in increasing
+// order.
+func Requests() []uint32 {
+	var rs []uint32
+	for _, d := range drivers {
+		for r := range d.Ioctls {
+			rs = append(rs, r)
+		}
+	}
+	sort.Slice(rs, func(i, j int) bool { return rs[i] < rs[j] })
+	return rs
+}
@@ -0,0 +1,111 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package devproxy
+
+import (
+	"testing"
+)
+
+func TestFindDriver(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		want *Driver
+	}{
+		{name: "nvidiactl", want: nvidia},
+		{name: "nvidia0", want: nvidia},
+		{name: "nvidia12", want: nvidia},
+		{name: "nvidia"},
+		{name: "nvidia-uvm"},
+		{name: "nvidia0/../null"},
+		{name: "null"},
+	} {
+		d, err := FindDriver(tc.name)
+		if tc.want == nil {
+			if err == nil {
+				t.Errorf("FindDriver(%q) = %s, want error", tc.name, d.Name)
+			}
+			continue
+		}
+		if err != nil || d != tc.want {
+			t.Errorf("FindDriver(%q) = %v, %v, want %s", tc.name, d, err, tc.want.Name)
+		}
+	}
+}
+
+func TestAllowed(t *testing.T) {
+	for _, tc := range []struct {
+		desc    string
+		request uint32
+		want    bool
+	}{
+		{
+			desc:    "safelisted",
+			request: ioc(ioctlRead|ioctlWrite, nvidiaIoctlType, 210, 72),
+			want:    true,
+		},
+		{
+			desc:    "safelisted array",
+			request: ioc(ioctlRead|ioctlWrite, nvidiaIoctlType, 212, 8),
+			want:    true,
+		},
+		{
+			desc:    "different size",
+			request: ioc(ioctlRead|ioctlWrite, nvidiaIoctlType, 210, 64),
+		},
+		{
+			desc:    "array too large",
+			request: ioc(ioctlRead|ioctlWrite, nvidiaIoctlType, 212, 4*(nvidiaMaxDevices+1)),
+		},
+		{
+			desc:    "different direction",
+			request: ioc(ioctlRead, nvidiaIoctlType, 210, 72),
+		},
+		{
+			desc:    "not safelisted",
+			request: ioc(ioctlRead|ioctlWrite, nvidiaIoctlType, 201, 4),
+		},
+		{
+			desc:    "other type",
+			request: ioc(ioctlRead|ioctlWrite, 'G', 210, 72),
+		},
+		{
+			desc:    "no direction",
+			request: ioc(0, nvidiaIoctlType, 210, 72),
+		},
+		{
+			desc:    "no size",
+			request: ioc(ioctlRead|ioctlWrite, nvidiaIoctlType, 210, 0),
+		},
+	} {
+		if got := nvidia.allowed(tc.request); got != tc.want {
+			t.Errorf("%s: allowed(%#x) = %t, want %t", tc.desc, tc.request, got, tc.want)
+		}
+	}
+}
+
+func TestRequests(t *testing.T) {
+	rs := Requests()
+	if len(rs) != len(nvidia.Ioctls) {
+		t.Fatalf("Requests() returned %d requests, want %d", len(rs), len(nvidia.Ioctls))
+	}
+	for i, r := range rs {
+		if !nvidia.allowed(r) {
+			t.Errorf("Requests() returned %#x, which isn't allowed", r)
+		}
+		if i > 0 && rs[i-1] >= r {
+			t.Errorf("Requests() isn't sorted: %#x before %#x", rs[i-1], r)
+		}
+	}
+}
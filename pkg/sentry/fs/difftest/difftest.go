@@ -0,0 +1,408 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package difftest finds semantic differences between sentry filesystems and
+// Linux. It runs sequences of filesystem operations against both a sentry
+// filesystem and a directory on the host, and reports operations whose
+// results differ.
+//
+// Operations are applied to the sentry filesystem through the fs package,
+// below the syscall layer. Where the syscall layer performs a check before
+// reaching the fs package (e.g. that write(2) is not invoked on a
+// directory), the sentry side of the harness performs the same check.
+package difftest
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"path"
+	"strings"
+	"syscall"
+
+	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
+	"gvisor.googlesource.com/gvisor/pkg/syserror"
+)
+
+// OpType is a type of filesystem operation.
+type OpType int
+
+// Filesystem operations.
+const (
+	// OpMkdir is mkdir(Path, 0755).
+	OpMkdir OpType = iota
+
+	// OpCreate is open(Path, O_CREAT|O_EXCL|O_WRONLY, 0644).
+	OpCreate
+
+	// OpUnlink is unlink(Path).
+	OpUnlink
+
+	// OpRmdir is rmdir(Path).
+	OpRmdir
+
+	// OpRename is rename(Path, NewPath).
+	OpRename
+
+	// OpWrite is pwrite(open(Path, O_WRONLY), Data, Offset).
+	OpWrite
+
+	// OpTruncate is truncate(Path, Size).
+	OpTruncate
+
+	// OpStat is lstat(Path).
+	OpStat
+
+	// OpRead reads the contents of the file at Path.
+	OpRead
+
+	numOpTypes
+)
+
+var opNames = []string{"mkdir", "create", "unlink", "rmdir", "rename", "write", "truncate", "stat", "read"}
+
+// String implements fmt.Stringer.String.
+func (t OpType) String() string {
+	if t < 0 || t >= numOpTypes {
+		return fmt.Sprintf("OpType(%d)", int(t))
+	}
+	return opNames[t]
+}
+
+// maxReadSize is the maximum number of bytes that OpRead reads.
+const maxReadSize = 4096
+
+// Op is a filesystem operation. Paths are relative to the root of the
+// filesystem under test.
+type Op struct {
+	Type    OpType
+	Path    string
+	NewPath string
+	Offset  int64
+	Size    int64
+	Data    []byte
+}
+
+// String implements fmt.Stringer.String.
+func (o Op) String() string {
+	switch o.Type {
+	case OpRename:
+		return fmt.Sprintf("rename(%q, %q)", o.Path, o.NewPath)
+	case OpWrite:
+		return fmt.Sprintf("write(%q, %q, %d)", o.Path, o.Data, o.Offset)
+	case OpTruncate:
+		return fmt.Sprintf("truncate(%q, %d)", o.Path, o.Size)
+	default:
+		return fmt.Sprintf("%s(%q)", o.Type, o.Path)
+	}
+}
+
+// Result is the outcome of an Op.
+type Result struct {
+	// Errno is the error returned by the operation, or 0 if the operation
+	// succeeded.
+	Errno syscall.Errno
+
+	// Data describes the output of a successful OpStat or OpRead.
+	Data string
+}
+
+// String implements fmt.Stringer.String.
+func (r Result) String() string {
+	if r.Errno != 0 {
+		return fmt.Sprintf("errno %d (%v)", int(r.Errno), r.Errno)
+	}
+	if r.Data != "" {
+		return r.Data
+	}
+	return "ok"
+}
+
+// Divergence is an Op whose results on the sentry and the host differ.
+type Divergence struct {
+	// Index is the index of the Op in the sequence.
+	Index int
+
+	Op     Op
+	Sentry Result
+	Host   Result
+}
+
+// String implements fmt.Stringer.String.
+func (d Divergence) String() string {
+	return fmt.Sprintf("op %d: %v: sentry got %v, host got %v", d.Index, d.Op, d.Sentry, d.Host)
+}
+
+// Runner applies operations to a sentry filesystem and a host directory.
+type Runner struct {
+	// Ctx is the context used for sentry operations.
+	Ctx context.Context
+
+	// Root is the root of the sentry filesystem under test.
+	Root *fs.Dirent
+
+	// HostDir is the host directory to compare with. It should be empty
+	// initially.
+	HostDir string
+}
+
+// Run applies ops in order, and returns the operations whose results differ.
+func (r *Runner) Run(ops []Op) []Divergence {
+	var divs []Divergence
+	for i, op := range ops {
+		s := r.sentry(op)
+		h := r.host(op)
+		if s != h {
+			divs = append(divs, Divergence{Index: i, Op: op, Sentry: s, Host: h})
+		}
+	}
+	return divs
+}
+
+// names are the path components used by Generate.
+var names = []string{"a", "b", "c"}
+
+// randomPath returns a path of one or two components.
+func randomPath(rng *rand.Rand) string {
+	p := names[rng.Intn(len(names))]
+	if rng.Intn(2) == 0 {
+		p = path.Join(p, names[rng.Intn(len(names))])
+	}
+	return p
+}
+
+// Generate returns n random operations. The operations use a small set of
+// paths so that they frequently interact.
+func Generate(rng *rand.Rand, n int) []Op {
+	ops := make([]Op, n)
+	for i := range ops {
+		op := Op{
+			Type: OpType(rng.Intn(int(numOpTypes))),
+			Path: randomPath(rng),
+		}
+		switch op.Type {
+		case OpRename:
+			op.NewPath = randomPath(rng)
+		case OpWrite:
+			op.Offset = int64(rng.Intn(16))
+			op.Data = []byte(strings.Repeat(string(rune('a'+rng.Intn(26))), 1+rng.Intn(16)))
+		case OpTruncate:
+			op.Size = int64(rng.Intn(32))
+		}
+		ops[i] = op
+	}
+	return ops
+}
+
+// toResult converts an error returned by the sentry to a Result.
+func toResult(err error) Result {
+	if err == nil {
+		return Result{}
+	}
+	if errno, ok := err.(syscall.Errno); ok {
+		return Result{Errno: errno}
+	}
+	if errno, ok := syserror.TranslateError(err); ok {
+		return Result{Errno: errno}
+	}
+	panic(fmt.Sprintf("unknown error %v", err))
+}
+
+// resolve walks to p from r.Root.
+func (r *Runner) resolve(p string) (*fs.Dirent, error) {
+	d := r.Root
+	d.IncRef()
+	for _, name := range strings.Split(p, "/") {
+		next, err := d.Walk(r.Ctx, r.Root, name)
+		d.DecRef()
+		if err != nil {
+			return nil, err
+		}
+		d = next
+	}
+	return d, nil
+}
+
+// resolveParent walks to the parent of p from r.Root, and returns the final
+// component of p. As in the syscall layer, the parent must be a directory.
+func (r *Runner) resolveParent(p string) (*fs.Dirent, string, error) {
+	dir, name := path.Split(p)
+	if dir == "" {
+		r.Root.IncRef()
+		return r.Root, name, nil
+	}
+	d, err := r.resolve(path.Clean(dir))
+	if err != nil {
+		return nil, "", err
+	}
+	if !fs.IsDir(d.Inode.StableAttr) {
+		d.DecRef()
+		return nil, "", syscall.ENOTDIR
+	}
+	return d, name, nil
+}
+
+// sentry applies op to the sentry filesystem.
+func (r *Runner) sentry(op Op) Result {
+	switch op.Type {
+	case OpMkdir, OpCreate, OpUnlink, OpRmdir:
+		parent, name, err := r.resolveParent(op.Path)
+		if err != nil {
+			return toResult(err)
+		}
+		defer parent.DecRef()
+		switch op.Type {
+		case OpMkdir:
+			err = parent.CreateDirectory(r.Ctx, r.Root, name, fs.FilePermsFromMode(0755))
+		case OpCreate:
+			var f *fs.File
+			f, err = parent.Create(r.Ctx, r.Root, name, fs.FileFlags{Write: true}, fs.FilePermsFromMode(0644))
+			if err == nil {
+				f.DecRef()
+			}
+		case OpUnlink:
+			err = parent.Remove(r.Ctx, r.Root, name)
+		case OpRmdir:
+			err = parent.RemoveDirectory(r.Ctx, r.Root, name)
+		}
+		return toResult(err)
+
+	case OpRename:
+		oldParent, oldName, err := r.resolveParent(op.Path)
+		if err != nil {
+			return toResult(err)
+		}
+		defer oldParent.DecRef()
+		newParent, newName, err := r.resolveParent(op.NewPath)
+		if err != nil {
+			return toResult(err)
+		}
+		defer newParent.DecRef()
+		return toResult(fs.Rename(r.Ctx, r.Root, oldParent, oldName, newParent, newName))
+
+	case OpWrite, OpTruncate, OpRead:
+		d, err := r.resolve(op.Path)
+		if err != nil {
+			return toResult(err)
+		}
+		defer d.DecRef()
+		// The syscall layer rejects these operations on directories.
+		if fs.IsDir(d.Inode.StableAttr) {
+			return Result{Errno: syscall.EISDIR}
+		}
+		switch op.Type {
+		case OpWrite:
+			f, err := d.Inode.GetFile(r.Ctx, d, fs.FileFlags{Write: true})
+			if err != nil {
+				return toResult(err)
+			}
+			defer f.DecRef()
+			_, err = f.Pwritev(r.Ctx, usermem.BytesIOSequence(op.Data), op.Offset)
+			return toResult(err)
+		case OpTruncate:
+			return toResult(d.Inode.Truncate(r.Ctx, d, op.Size))
+		default:
+			f, err := d.Inode.GetFile(r.Ctx, d, fs.FileFlags{Read: true})
+			if err != nil {
+				return toResult(err)
+			}
+			defer f.DecRef()
+			buf := make([]byte, maxReadSize)
+			n, err := f.Preadv(r.Ctx, usermem.BytesIOSequence(buf), 0)
+			if err != nil && err != io.EOF {
+				return toResult(err)
+			}
+			return Result{Data: fmt.Sprintf("%q", buf[:n])}
+		}
+
+	case OpStat:
+		d, err := r.resolve(op.Path)
+		if err != nil {
+			return toResult(err)
+		}
+		defer d.DecRef()
+		if fs.IsDir(d.Inode.StableAttr) {
+			return Result{Data: "directory"}
+		}
+		attr, err := d.Inode.UnstableAttr(r.Ctx)
+		if err != nil {
+			return toResult(err)
+		}
+		return Result{Data: fmt.Sprintf("file of size %d", attr.Size)}
+	}
+	panic(fmt.Sprintf("unknown op %v", op))
+}
+
+// hostResult converts an error returned by the host to a Result.
+func hostResult(err error) Result {
+	if err == nil {
+		return Result{}
+	}
+	return Result{Errno: err.(syscall.Errno)}
+}
+
+// host applies op to the host directory.
+func (r *Runner) host(op Op) Result {
+	p := path.Join(r.HostDir, op.Path)
+	switch op.Type {
+	case OpMkdir:
+		return hostResult(syscall.Mkdir(p, 0755))
+	case OpCreate:
+		fd, err := syscall.Open(p, syscall.O_CREAT|syscall.O_EXCL|syscall.O_WRONLY, 0644)
+		if err == nil {
+			syscall.Close(fd)
+		}
+		return hostResult(err)
+	case OpUnlink:
+		return hostResult(syscall.Unlink(p))
+	case OpRmdir:
+		return hostResult(syscall.Rmdir(p))
+	case OpRename:
+		return hostResult(syscall.Rename(p, path.Join(r.HostDir, op.NewPath)))
+	case OpWrite:
+		fd, err := syscall.Open(p, syscall.O_WRONLY, 0)
+		if err != nil {
+			return hostResult(err)
+		}
+		defer syscall.Close(fd)
+		_, err = syscall.Pwrite(fd, op.Data, op.Offset)
+		return hostResult(err)
+	case OpTruncate:
+		return hostResult(syscall.Truncate(p, op.Size))
+	case OpRead:
+		fd, err := syscall.Open(p, syscall.O_RDONLY, 0)
+		if err != nil {
+			return hostResult(err)
+		}
+		defer syscall.Close(fd)
+		buf := make([]byte, maxReadSize)
+		n, err := syscall.Pread(fd, buf, 0)
+		if err != nil {
+			return hostResult(err)
+		}
+		return Result{Data: fmt.Sprintf("%q", buf[:n])}
+	case OpStat:
+		var st syscall.Stat_t
+		if err := syscall.Lstat(p, &st); err != nil {
+			return hostResult(err)
+		}
+		if st.Mode&syscall.S_IFMT == syscall.S_IFDIR {
+			return Result{Data: "directory"}
+		}
+		return Result{Data: fmt.Sprintf("file of size %d", st.Size)}
+	}
+	panic(fmt.Sprintf("unknown op %v", op))
+}
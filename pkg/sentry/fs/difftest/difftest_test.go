@@ -0,0 +1,61 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package difftest
+
+import (
+	"flag"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"testing"
+
+	"gvisor.googlesource.com/gvisor/pkg/sentry/context/contexttest"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
+	_ "gvisor.googlesource.com/gvisor/pkg/sentry/fs/tmpfs"
+)
+
+var (
+	seeds  = flag.Int("seeds", 50, "number of random operation sequences to run")
+	numOps = flag.Int("ops", 100, "number of operations in each sequence")
+)
+
+// TestTmpfs compares tmpfs with the host filesystem.
+func TestTmpfs(t *testing.T) {
+	ctx := contexttest.Context(t)
+	fsys, ok := fs.FindFilesystem("tmpfs")
+	if !ok {
+		t.Fatalf("tmpfs not found")
+	}
+
+	for seed := int64(0); seed < int64(*seeds); seed++ {
+		inode, err := fsys.Mount(ctx, "", fs.MountSourceFlags{}, "")
+		if err != nil {
+			t.Fatalf("failed to mount tmpfs: %v", err)
+		}
+		root := fs.NewDirent(inode, "/")
+		hostDir, err := ioutil.TempDir("", "difftest")
+		if err != nil {
+			t.Fatalf("TempDir failed: %v", err)
+		}
+
+		r := Runner{Ctx: ctx, Root: root, HostDir: hostDir}
+		for _, d := range r.Run(Generate(rand.New(rand.NewSource(seed)), *numOps)) {
+			t.Errorf("seed %d: %v", seed, d)
+		}
+
+		root.DecRef()
+		os.RemoveAll(hostDir)
+	}
+}
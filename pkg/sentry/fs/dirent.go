@@ -1082,11 +1082,10 @@ func (d *Dirent) mount(ctx context.Context, inode *Inode) (newChild *Dirent, err
 	return replacement, nil
 }
 
-// unmount unmounts `d` and replaces it with the last Dirent that was in its
-// place, supplied by the MountNamespace as `replacement`.
+// checkUnmount returns the error with which unmount would fail, if any.
 //
-// Precondition: must be called with mm.withMountLocked held on `d`.
-func (d *Dirent) unmount(ctx context.Context, replacement *Dirent) error {
+// Preconditions: The same locks as for unmount must be held.
+func (d *Dirent) checkUnmount() error {
 	// Did we race with deletion?
 	if atomic.LoadInt32(&d.deleted) != 0 {
 		return syserror.ENOENT
@@ -1096,6 +1095,17 @@ func (d *Dirent) unmount(ctx context.Context, replacement *Dirent) error {
 	if d.parent.frozen && !d.parent.Inode.IsVirtual() {
 		return syserror.ENOENT
 	}
+	return nil
+}
+
+// unmount unmounts `d` and replaces it with the last Dirent that was in its
+// place, supplied by the MountNamespace as `replacement`.
+//
+// Precondition: must be called with mm.withMountLocked held on `d`.
+func (d *Dirent) unmount(ctx context.Context, replacement *Dirent) error {
+	if err := d.checkUnmount(); err != nil {
+		return err
+	}
 
 	// Remount our former child in its place.
 	//
@@ -1450,6 +1460,10 @@ func checkSticky(ctx context.Context, dir *Dirent, victim *Dirent) error {
 //
 // Compare Linux kernel fs/namei.c:may_delete.
 func MayDelete(ctx context.Context, root, dir *Dirent, name string) error {
+	if err := dir.mayWrite(ctx); err != nil {
+		return err
+	}
+
 	victim, err := dir.Walk(ctx, root, name)
 	if err != nil {
 		return err
@@ -1474,9 +1488,25 @@ func Rename(ctx context.Context, root *Dirent, oldParent *Dirent, oldName string
 		panic("Rename: root must not be nil")
 	}
 	if oldParent == newParent && oldName == newName {
+		// Renaming a file to itself does nothing, but the file must
+		// exist.
+		renamed, err := oldParent.Walk(ctx, root, oldName)
+		if err != nil {
+			return err
+		}
+		renamed.DecRef()
 		return nil
 	}
 
+	// Check for read-only mounts before taking locks, since reporting
+	// audited writes may need them.
+	if err := oldParent.mayWrite(ctx); err != nil {
+		return err
+	}
+	if err := newParent.mayWrite(ctx); err != nil {
+		return err
+	}
+
 	// Acquire global renameMu lock, and mu locks on oldParent/newParent.
 	unlock, err := lockForRename(oldParent, oldName, newParent, newName)
 	defer unlock()
@@ -132,6 +132,11 @@ type MountSourceFlags struct {
 	// cache, even when the platform supports direct mapped I/O. This
 	// doesn't correspond to any Linux mount options.
 	ForcePageCache bool
+
+	// AuditWrites causes write attempts denied because the filesystem is
+	// mounted read-only to be reported to the WriteAuditor of the caller.
+	// This doesn't correspond to any Linux mount options.
+	AuditWrites bool
 }
 
 // GenericMountSourceOptions splits a string containing comma separated tokens of the
@@ -14,6 +14,10 @@
 
 package fs
 
+import (
+	"syscall"
+)
+
 // FileFlags encodes file flags.
 type FileFlags struct {
 	// Direct indicates that I/O should be done directly.
@@ -65,3 +69,31 @@ func (f FileFlags) Settable() SettableFileFlags {
 		Append:      f.Append,
 	}
 }
+
+// ToLinux converts a FileFlags object to a Linux representation.
+func (f FileFlags) ToLinux() (mask uint) {
+	if f.Direct {
+		mask |= syscall.O_DIRECT
+	}
+	if f.NonBlocking {
+		mask |= syscall.O_NONBLOCK
+	}
+	if f.Sync {
+		mask |= syscall.O_SYNC
+	}
+	if f.Append {
+		mask |= syscall.O_APPEND
+	}
+	if f.Directory {
+		mask |= syscall.O_DIRECTORY
+	}
+	switch {
+	case f.Read && f.Write:
+		mask |= syscall.O_RDWR
+	case f.Write:
+		mask |= syscall.O_WRONLY
+	case f.Read:
+		mask |= syscall.O_RDONLY
+	}
+	return
+}
@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"io"
 	"sync"
+	"time"
 
 	"gvisor.googlesource.com/gvisor/pkg/log"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
@@ -326,6 +327,15 @@ func (c *CachingInodeOperations) Truncate(ctx context.Context, inode *fs.Inode,
 	c.dataMu.Lock()
 	defer c.dataMu.Unlock()
 	c.cache.Truncate(uint64(size), c.platform.Memory())
+	if u := usage.IOFromContext(ctx); u != nil {
+		// Compare Linux's mm/page-writeback.c:account_page_cleaned().
+		mr := memmap.MappableRange{uint64(size), uint64(oldSize)}
+		var cancelled uint64
+		for seg := c.dirty.LowerBoundSegment(mr.Start); seg.Ok() && seg.Start() < mr.End; seg = seg.NextSegment() {
+			cancelled += seg.Range().Intersect(mr).Length()
+		}
+		u.AccountCancelledWriteIO(int64(cancelled))
+	}
 	c.dirty.KeepClean(memmap.MappableRange{uint64(size), oldpgend})
 
 	return nil
@@ -523,7 +533,7 @@ func (rw *inodeReadWriter) ReadToBlocks(dsts safemem.BlockSeq) (uint64, error) {
 			// Read directly from the backing file.
 			gapmr := gap.Range().Intersect(mr)
 			dst := dsts.TakeFirst64(gapmr.Length())
-			n, err := rw.c.backingFile.ReadToBlocksAt(rw.ctx, dst, gapmr.Start)
+			n, err := rw.c.readToBlocksAt(rw.ctx, dst, gapmr.Start)
 			done += n
 			rw.offset += int64(n)
 			dsts = dsts.DropFirst64(n)
@@ -591,6 +601,12 @@ func (rw *inodeReadWriter) WriteFromBlocks(srcs safemem.BlockSeq) (uint64, error
 			rw.offset += int64(n)
 			srcs = srcs.DropFirst64(n)
 			rw.c.dirty.MarkDirty(segMR)
+			// Compare Linux's mm/page-writeback.c:account_page_dirtied(),
+			// which accounts writes when they dirty the page cache
+			// rather than when they are written back.
+			if u := usage.IOFromContext(rw.ctx); u != nil {
+				u.AccountWriteIO(int64(n))
+			}
 			if err != nil {
 				return done, err
 			}
@@ -602,7 +618,7 @@ func (rw *inodeReadWriter) WriteFromBlocks(srcs safemem.BlockSeq) (uint64, error
 			// Write directly to the backing file.
 			gapmr := gap.Range().Intersect(mr)
 			src := srcs.TakeFirst64(gapmr.Length())
-			n, err := rw.c.backingFile.WriteFromBlocksAt(rw.ctx, src, gapmr.Start)
+			n, err := rw.c.writeFromBlocksAt(rw.ctx, src, gapmr.Start)
 			done += n
 			rw.offset += int64(n)
 			srcs = srcs.DropFirst64(n)
@@ -707,7 +723,7 @@ func (c *CachingInodeOperations) Translate(ctx context.Context, required, option
 	}
 
 	mem := c.platform.Memory()
-	cerr := c.cache.Fill(ctx, required, maxFillRange(required, optional), mem, usage.PageCache, c.backingFile.ReadToBlocksAt)
+	cerr := c.cache.Fill(ctx, required, maxFillRange(required, optional), mem, usage.PageCache, c.readToBlocksAt)
 
 	var ts []memmap.Translation
 	var translatedEnd uint64
@@ -737,6 +753,30 @@ func (c *CachingInodeOperations) Translate(ctx context.Context, required, option
 	return ts, nil
 }
 
+// readToBlocksAt reads from the backing file, and accounts the bytes read and
+// the time spent waiting for them to the I/O usage of ctx.
+func (c *CachingInodeOperations) readToBlocksAt(ctx context.Context, dsts safemem.BlockSeq, offset uint64) (uint64, error) {
+	start := time.Now()
+	n, err := c.backingFile.ReadToBlocksAt(ctx, dsts, offset)
+	if u := usage.IOFromContext(ctx); u != nil {
+		u.AccountBlockIODelay(time.Since(start))
+		u.AccountReadIO(int64(n))
+	}
+	return n, err
+}
+
+// writeFromBlocksAt writes through to the backing file, and accounts the bytes
+// written and the time spent waiting for them to the I/O usage of ctx.
+func (c *CachingInodeOperations) writeFromBlocksAt(ctx context.Context, srcs safemem.BlockSeq, offset uint64) (uint64, error) {
+	start := time.Now()
+	n, err := c.backingFile.WriteFromBlocksAt(ctx, srcs, offset)
+	if u := usage.IOFromContext(ctx); u != nil {
+		u.AccountBlockIODelay(time.Since(start))
+		u.AccountWriteIO(int64(n))
+	}
+	return n, err
+}
+
 func maxFillRange(required, optional memmap.MappableRange) memmap.MappableRange {
 	const maxReadahead = 64 << 10 // 64 KB, chosen arbitrarily
 	if required.Length() >= maxReadahead {
@@ -26,6 +26,7 @@ import (
 	ktime "gvisor.googlesource.com/gvisor/pkg/sentry/kernel/time"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/memmap"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/safemem"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usage"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
 )
 
@@ -401,3 +402,80 @@ func TestWrite(t *testing.T) {
 		t.Errorf("File contents are %v, want %v", buf, want)
 	}
 }
+
+// ioContext is a context that accounts storage I/O to io.
+type ioContext struct {
+	context.Context
+	io *usage.IO
+}
+
+// Value implements context.Context.Value.
+func (ctx *ioContext) Value(key interface{}) interface{} {
+	if key == usage.CtxIO {
+		return ctx.io
+	}
+	return ctx.Context.Value(key)
+}
+
+func TestIOAccounting(t *testing.T) {
+	ctx := &ioContext{Context: contexttest.Context(t), io: &usage.IO{}}
+
+	// Construct a 4-page file.
+	buf := pagesOf('a', 'b', 'c', 'd')
+	file := fs.NewFile(ctx, fs.NewDirent(anonInode(ctx), "anon"), fs.FileFlags{}, nil)
+	uattr := fs.UnstableAttr{
+		Size: int64(len(buf)),
+	}
+	iops := NewCachingInodeOperations(ctx, newSliceBackingFile(buf), uattr, false /*forcePageCache*/)
+	defer iops.Release()
+
+	// Cache the second page, which reads it from the "file".
+	var ms noopMappingSpace
+	ar := usermem.AddrRange{usermem.PageSize, 2 * usermem.PageSize}
+	if err := iops.AddMapping(ctx, ms, ar, usermem.PageSize); err != nil {
+		t.Fatalf("AddMapping got %v, want nil", err)
+	}
+	defer iops.RemoveMapping(ctx, ms, ar, usermem.PageSize)
+	mr := memmap.MappableRange{usermem.PageSize, 2 * usermem.PageSize}
+	if _, err := iops.Translate(ctx, mr, mr, usermem.Read); err != nil {
+		t.Fatalf("Translate got %v, want nil", err)
+	}
+	if got, want := ctx.io.BytesRead, uint64(usermem.PageSize); got != want {
+		t.Errorf("BytesRead after Translate got %d, want %d", got, want)
+	}
+	if got, want := ctx.io.BlockIOCount, uint64(1); got != want {
+		t.Errorf("BlockIOCount after Translate got %d, want %d", got, want)
+	}
+
+	// Read the whole file. Only the uncached pages are read from the "file".
+	n, err := iops.Read(ctx, file, usermem.BytesIOSequence(make([]byte, len(buf))), 0)
+	if n != int64(len(buf)) || (err != nil && err != io.EOF) {
+		t.Fatalf("Read got (%d, %v), want (%d, nil or EOF)", n, err, len(buf))
+	}
+	if got, want := ctx.io.BytesRead, uint64(len(buf)); got != want {
+		t.Errorf("BytesRead after Read got %d, want %d", got, want)
+	}
+
+	// Write the first two pages. The first page is written directly, and
+	// the second is dirtied in the cache.
+	n, err = iops.Write(ctx, usermem.BytesIOSequence(pagesOf('e', 'f')), 0)
+	if n != 2*usermem.PageSize || err != nil {
+		t.Fatalf("Write got (%d, %v), want (%d, nil)", n, err, 2*usermem.PageSize)
+	}
+	if got, want := ctx.io.BytesWritten, uint64(2*usermem.PageSize); got != want {
+		t.Errorf("BytesWritten after Write got %d, want %d", got, want)
+	}
+
+	// Only reads and writes of the backing file wait for I/O.
+	if got, want := ctx.io.BlockIOCount, uint64(4); got != want {
+		t.Errorf("BlockIOCount after Write got %d, want %d", got, want)
+	}
+
+	// Truncating the file drops the dirty page before it is written back.
+	if err := iops.Truncate(ctx, nil, usermem.PageSize); err != nil {
+		t.Fatalf("Truncate got %v, want nil", err)
+	}
+	if got, want := ctx.io.BytesWriteCancelled, uint64(usermem.PageSize); got != want {
+		t.Errorf("BytesWriteCancelled after Truncate got %d, want %d", got, want)
+	}
+}
@@ -51,6 +51,7 @@ func unstable(ctx context.Context, valid p9.AttrMask, pattr p9.Attr, mounter fs.
 		AccessTime:       atime(ctx, valid, pattr),
 		ModificationTime: mtime(ctx, valid, pattr),
 		StatusChangeTime: ctime(ctx, valid, pattr),
+		CreationTime:     btime(valid, pattr),
 		Links:            links(valid, pattr),
 	}
 }
@@ -124,6 +125,15 @@ func ctime(ctx context.Context, valid p9.AttrMask, pattr p9.Attr) ktime.Time {
 	return mtime(ctx, valid, pattr)
 }
 
+// btime returns a creation time from 9p attributes, or zero if it isn't
+// available.
+func btime(valid p9.AttrMask, pattr p9.Attr) ktime.Time {
+	if valid.BTime {
+		return ktime.FromUnix(int64(pattr.BTimeSeconds), int64(pattr.BTimeNanoSeconds))
+	}
+	return ktime.ZeroTime
+}
+
 // atime returns an access time from 9p attributes.
 func atime(ctx context.Context, valid p9.AttrMask, pattr p9.Attr) ktime.Time {
 	if valid.ATime {
@@ -188,3 +188,10 @@ func (c *contextFile) connect(ctx context.Context, flags p9.ConnectFlags) (*fd.F
 
 	return c.file.Connect(flags)
 }
+
+func (c *contextFile) watch(ctx context.Context, mask uint32) (*fd.FD, error) {
+	ctx.UninterruptibleSleepStart(false)
+	defer ctx.UninterruptibleSleepFinish(false)
+
+	return c.file.Watch(mask)
+}
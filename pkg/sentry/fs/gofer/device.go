@@ -18,3 +18,11 @@ import "gvisor.googlesource.com/gvisor/pkg/sentry/device"
 
 // goferDevice is the gofer virtual device.
 var goferDevice = device.NewAnonMultiDevice()
+
+// goferIOStats are the I/O statistics of file data read from and written to
+// gofers, reported as the block device "gofer".
+var goferIOStats device.IOStats
+
+func init() {
+	device.RegisterBlockDevice("gofer", goferDevice.ID, &goferIOStats)
+}
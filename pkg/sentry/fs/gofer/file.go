@@ -16,6 +16,7 @@ package gofer
 
 import (
 	"syscall"
+	"time"
 
 	"gvisor.googlesource.com/gvisor/pkg/log"
 	"gvisor.googlesource.com/gvisor/pkg/metric"
@@ -25,6 +26,7 @@ import (
 	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/fsutil"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/memmap"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usage"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
 	"gvisor.googlesource.com/gvisor/pkg/syserror"
 	"gvisor.googlesource.com/gvisor/pkg/waiter"
@@ -187,7 +189,13 @@ func (f *fileOperations) Write(ctx context.Context, file *fs.File, src usermem.I
 	// Do cached IO for regular files only. Some character devices expect no caching.
 	isFile := fs.IsFile(file.Dirent.Inode.StableAttr)
 	if f.inodeOperations.session().cachePolicy == cacheNone || !isFile {
-		return src.CopyInTo(ctx, f.handles.readWriterAt(ctx, offset))
+		start := time.Now()
+		n, err := src.CopyInTo(ctx, f.handles.readWriterAt(ctx, offset, f.inodeOperations.session().throttle))
+		if u := usage.IOFromContext(ctx); u != nil && isFile {
+			u.AccountBlockIODelay(time.Since(start))
+			u.AccountWriteIO(n)
+		}
+		return n, err
 	}
 	return f.inodeOperations.cachingInodeOps.Write(ctx, src, offset)
 }
@@ -202,7 +210,13 @@ func (f *fileOperations) Read(ctx context.Context, file *fs.File, dst usermem.IO
 	// Do cached IO for regular files only. Some character devices expect no caching.
 	isFile := fs.IsFile(file.Dirent.Inode.StableAttr)
 	if f.inodeOperations.session().cachePolicy == cacheNone || !isFile {
-		return dst.CopyOutFrom(ctx, f.handles.readWriterAt(ctx, offset))
+		start := time.Now()
+		n, err := dst.CopyOutFrom(ctx, f.handles.readWriterAt(ctx, offset, f.inodeOperations.session().throttle))
+		if u := usage.IOFromContext(ctx); u != nil && isFile {
+			u.AccountBlockIODelay(time.Since(start))
+			u.AccountReadIO(n)
+		}
+		return n, err
 	}
 	return f.inodeOperations.cachingInodeOps.Read(ctx, file, dst, offset)
 }
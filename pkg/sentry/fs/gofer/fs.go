@@ -19,6 +19,7 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 
 	"gvisor.googlesource.com/gvisor/pkg/p9"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
@@ -44,6 +45,12 @@ const (
 	// The file descriptor for writing with trans=fd.
 	writeFDKey = "wfdno"
 
+	// The file descriptors of additional channels of the connection with
+	// trans=fd, separated by colons. Requests are spread over the rfdno
+	// channel and these. This is a gVisor extension, not supported by the
+	// Linux 9p client.
+	channelFDsKey = "channelfds"
+
 	// The number of bytes to use for a 9p packet payload.
 	msizeKey = "msize"
 
@@ -54,6 +61,19 @@ const (
 	// sandbox using files backed by the gofer. If set to false, unix sockets
 	// cannot be bound to gofer files without an overlay on top.
 	privateUnixSocketKey = "privateunixsocket"
+
+	// The maximum rates of file I/O, with the meaning of the keys of
+	// io.max in Linux's cgroup v2 io controller. These are gVisor
+	// extensions, not supported by the Linux 9p client.
+	ioMaxRBPSKey  = "io_max_rbps"
+	ioMaxWBPSKey  = "io_max_wbps"
+	ioMaxRIOPSKey = "io_max_riops"
+	ioMaxWIOPSKey = "io_max_wiops"
+
+	// The name of the group of mounts that share the I/O limits above,
+	// such as the ID of the container that the mounts belong to. Mounts
+	// without a group have their own limits.
+	ioGroupKey = "io_group"
 )
 
 // cachePolicy is a 9p cache policy.
@@ -147,11 +167,14 @@ func (f *filesystem) Mount(ctx context.Context, device string, flags fs.MountSou
 // opts are parsed 9p mount options.
 type opts struct {
 	fd                int
+	channelFDs        []int
 	aname             string
 	policy            cachePolicy
 	msize             uint32
 	version           string
 	privateunixsocket bool
+	ioMax             ioLimits
+	ioGroup           string
 }
 
 // options parses mount(2) data into structured options.
@@ -203,6 +226,18 @@ func options(data string) (opts, error) {
 	}
 	o.fd = rfd
 
+	// Parse the additional channels.
+	if v, ok := options[channelFDsKey]; ok {
+		for _, sfd := range strings.Split(v, ":") {
+			fd, err := strconv.Atoi(sfd)
+			if err != nil {
+				return o, fmt.Errorf("invalid fd %q in '%s=%s': %v", sfd, channelFDsKey, v, err)
+			}
+			o.channelFDs = append(o.channelFDs, fd)
+		}
+		delete(options, channelFDsKey)
+	}
+
 	// Parse the attach name.
 	o.aname = defaultAname
 	if an, ok := options[anameKey]; ok {
@@ -249,6 +284,30 @@ func options(data string) (opts, error) {
 		delete(options, privateUnixSocketKey)
 	}
 
+	if v, ok := options[ioGroupKey]; ok {
+		o.ioGroup = v
+		delete(options, ioGroupKey)
+	}
+
+	// Parse the I/O limits. Reject malformed options.
+	for key, limit := range map[string]*uint64{
+		ioMaxRBPSKey:  &o.ioMax.rbps,
+		ioMaxWBPSKey:  &o.ioMax.wbps,
+		ioMaxRIOPSKey: &o.ioMax.riops,
+		ioMaxWIOPSKey: &o.ioMax.wiops,
+	} {
+		v, ok := options[key]
+		if !ok {
+			continue
+		}
+		i, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return o, fmt.Errorf("invalid limit for '%s=%s': %v", key, v, err)
+		}
+		*limit = i
+		delete(options, key)
+	}
+
 	// Fail to attach if the caller wanted us to do something that we
 	// don't support.
 	if len(options) > 0 {
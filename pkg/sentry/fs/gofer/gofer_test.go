@@ -18,8 +18,10 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"syscall"
 	"testing"
+	"time"
 
 	"gvisor.googlesource.com/gvisor/pkg/log"
 	"gvisor.googlesource.com/gvisor/pkg/p9"
@@ -70,7 +72,7 @@ func root(ctx context.Context, mode p9.FileMode, size uint64) (*p9test.FileMock,
 
 	// Construct a dummy session that we can destruct.
 	s := &session{
-		conn:        sock,
+		conns:       []*unet.Socket{sock},
 		mounter:     fs.RootOwner,
 		cachePolicy: cacheNone,
 	}
@@ -149,6 +151,24 @@ func TestLookup(t *testing.T) {
 	}
 }
 
+// TestCachesAttributes checks that the attributes of regular files are only
+// reported as cached in the sentry if the cache policy allows caching.
+func TestCachesAttributes(t *testing.T) {
+	ctx := contexttest.Context(t)
+	_, inode, err := root(ctx, p9.ModeRegular|p9.PermissionsMask, 0)
+	if err != nil {
+		t.Fatalf("root failed: %v", err)
+	}
+	s := inode.MountSource.MountSourceOperations.(*session)
+	if inode.MountSource.CachesAttributes(inode) {
+		t.Errorf("CachesAttributes with cache policy %v got true, want false", s.cachePolicy)
+	}
+	s.cachePolicy = cacheAll
+	if !inode.MountSource.CachesAttributes(inode) {
+		t.Errorf("CachesAttributes with cache policy %v got false, want true", s.cachePolicy)
+	}
+}
+
 func TestSetTimestamps(t *testing.T) {
 	// Test parameters.
 	type setTimestampsTest struct {
@@ -774,3 +794,114 @@ func TestPwritev(t *testing.T) {
 		}
 	}
 }
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Now()
+	r := rateLimiter{rate: 1000}
+
+	// The first operation starts immediately, and delays the next one by
+	// its cost.
+	if got := r.reserve(now, 500); !got.Equal(now) {
+		t.Errorf("reserve got start %v, want %v", got, now)
+	}
+	if got, want := r.reserve(now, 1000), now.Add(500*time.Millisecond); !got.Equal(want) {
+		t.Errorf("reserve got start %v, want %v", got, want)
+	}
+
+	// Idle time isn't accumulated as burst.
+	later := now.Add(10 * time.Second)
+	if got := r.reserve(later, 1); !got.Equal(later) {
+		t.Errorf("reserve got start %v, want %v", got, later)
+	}
+
+	// Large I/Os don't overflow.
+	big := rateLimiter{rate: 1 << 30}
+	big.reserve(now, 1<<36)
+	if got, want := big.reserve(now, 1), now.Add(64*time.Second); !got.Equal(want) {
+		t.Errorf("reserve after a large I/O got start %v, want %v", got, want)
+	}
+
+	// An I/O that would take longer than a Duration can hold delays the
+	// next one for as long as possible, rather than wrapping around.
+	tiny := rateLimiter{rate: 1}
+	tiny.reserve(now, 1<<40)
+	if got, want := tiny.reserve(now, 1), now.Add(time.Duration(math.MaxInt64)); !got.Equal(want) {
+		t.Errorf("reserve at a tiny rate got start %v, want %v", got, want)
+	}
+
+	// An unlimited limiter never delays.
+	var u rateLimiter
+	u.reserve(now, 1<<40)
+	if got := u.reserve(now, 1<<40); !got.Equal(now) {
+		t.Errorf("unlimited reserve got start %v, want %v", got, now)
+	}
+}
+
+func TestIOThrottleFor(t *testing.T) {
+	l := ioLimits{rbps: 1000}
+	if got := ioThrottleFor("c1", ioLimits{}); got != nil {
+		t.Errorf("ioThrottleFor without limits = %p, want nil", got)
+	}
+	a, b := ioThrottleFor("c1", l), ioThrottleFor("c1", l)
+	if a == nil || a != b {
+		t.Errorf("ioThrottleFor in the same group = %p, %p, want the same throttle", a, b)
+	}
+	if c := ioThrottleFor("c2", l); c == a {
+		t.Errorf("ioThrottleFor in another group returned the same throttle")
+	}
+	if d, e := ioThrottleFor("", l), ioThrottleFor("", l); d == e {
+		t.Errorf("ioThrottleFor without a group returned the same throttle")
+	}
+
+	// Once all sessions of the group release the throttle, the group
+	// starts over with the limits of the next session.
+	a.release()
+	if got := ioThrottleFor("c1", l); got != a {
+		t.Errorf("ioThrottleFor with a live session in the group = %p, want %p", got, a)
+	}
+	a.release()
+	a.release()
+	l2 := ioLimits{rbps: 2000}
+	if got := ioThrottleFor("c1", l2); got == a || got.rbps.rate != l2.rbps {
+		t.Errorf("ioThrottleFor after the group was released = %p with rate %d, want a new throttle with rate %d", got, got.rbps.rate, l2.rbps)
+	}
+}
+
+func TestOptionsIOGroup(t *testing.T) {
+	o, err := options("trans=fd,rfdno=3,wfdno=3,io_max_rbps=1000,io_group=foo")
+	if err != nil {
+		t.Fatalf("options failed: %v", err)
+	}
+	if o.ioGroup != "foo" || o.ioMax.rbps != 1000 {
+		t.Errorf("options got group %q and limits %+v, want group %q and rbps 1000", o.ioGroup, o.ioMax, "foo")
+	}
+}
+
+func TestOptionsChannelFDs(t *testing.T) {
+	for _, test := range []struct {
+		data    string
+		want    []int
+		wantErr bool
+	}{
+		{data: "trans=fd,rfdno=3,wfdno=3"},
+		{data: "trans=fd,rfdno=3,wfdno=3,channelfds=4", want: []int{4}},
+		{data: "trans=fd,rfdno=3,wfdno=3,channelfds=4:5:6", want: []int{4, 5, 6}},
+		{data: "trans=fd,rfdno=3,wfdno=3,channelfds=4:x", wantErr: true},
+		{data: "trans=fd,rfdno=3,wfdno=3,channelfds=", wantErr: true},
+	} {
+		o, err := options(test.data)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("options(%q) got nil error, want error", test.data)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("options(%q) got error %v, want nil", test.data, err)
+			continue
+		}
+		if fmt.Sprint(o.channelFDs) != fmt.Sprint(test.want) {
+			t.Errorf("options(%q) got channel FDs %v, want %v", test.data, o.channelFDs, test.want)
+		}
+	}
+}
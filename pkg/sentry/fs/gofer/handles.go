@@ -102,13 +102,16 @@ func newHandles(ctx context.Context, file contextFile, flags fs.FileFlags) (*han
 }
 
 type handleReadWriter struct {
-	ctx context.Context
-	h   *handles
-	off int64
+	ctx      context.Context
+	h        *handles
+	off      int64
+	throttle *ioThrottle
 }
 
-func (h *handles) readWriterAt(ctx context.Context, offset int64) *handleReadWriter {
-	return &handleReadWriter{ctx, h, offset}
+// readWriterAt returns a reader and writer of h at offset, whose I/O is
+// delayed by throttle. throttle may be nil.
+func (h *handles) readWriterAt(ctx context.Context, offset int64, throttle *ioThrottle) *handleReadWriter {
+	return &handleReadWriter{ctx, h, offset, throttle}
 }
 
 // ReadToBlocks implements safemem.Reader.ReadToBlocks.
@@ -120,9 +123,14 @@ func (rw *handleReadWriter) ReadToBlocks(dsts safemem.BlockSeq) (uint64, error)
 		r = &p9.ReadWriterFile{File: rw.h.File.file, Offset: uint64(rw.off)}
 	}
 
+	if err := rw.throttle.wait(rw.ctx, false, dsts.NumBytes()); err != nil {
+		return 0, err
+	}
 	rw.ctx.UninterruptibleSleepStart(false)
 	defer rw.ctx.UninterruptibleSleepFinish(false)
+	start := goferIOStats.Start()
 	n, err := safemem.FromIOReader{r}.ReadToBlocks(dsts)
+	goferIOStats.FinishRead(start, n)
 	rw.off += int64(n)
 	return n, err
 }
@@ -136,9 +144,14 @@ func (rw *handleReadWriter) WriteFromBlocks(srcs safemem.BlockSeq) (uint64, erro
 		w = &p9.ReadWriterFile{File: rw.h.File.file, Offset: uint64(rw.off)}
 	}
 
+	if err := rw.throttle.wait(rw.ctx, true, srcs.NumBytes()); err != nil {
+		return 0, err
+	}
 	rw.ctx.UninterruptibleSleepStart(false)
 	defer rw.ctx.UninterruptibleSleepFinish(false)
+	start := goferIOStats.Start()
 	n, err := safemem.FromIOWriter{w}.WriteFromBlocks(srcs)
+	goferIOStats.FinishWrite(start, n)
 	rw.off += int64(n)
 	return n, err
 }
@@ -113,6 +113,13 @@ func (i *inodeFileState) afterLoad() {
 		if !mask.RDev {
 			return fs.ErrCorruption{fmt.Errorf("file %s lacks device", name)}
 		}
+		// Files may not change type, e.g. if a mount has been rebound to
+		// a different location. Sockets are exempt because they are
+		// represented by regular files on the host; see
+		// newInodeOperations.
+		if t := ntype(attrs); i.sattr.Type != fs.Socket && t != i.sattr.Type {
+			return fs.ErrCorruption{fmt.Errorf("file type has changed for %s: previously %v, now %v", name, i.sattr.Type, t)}
+		}
 		i.key = device.MultiDeviceKey{
 			Device:          attrs.RDev,
 			SecondaryDevice: i.s.connID,
@@ -66,9 +66,9 @@ func (e *endpointMap) get(key device.MultiDeviceKey) unix.BoundEndpoint {
 type session struct {
 	refs.AtomicRefCount
 
-	// conn is a unet.Socket that wraps the readFD/writeFD mount option,
-	// see fs/gofer/fs.go.
-	conn *unet.Socket `state:"nosave"`
+	// conns are the unet.Sockets that wrap the readFD/writeFD and
+	// channelFDs mount options, see fs/gofer/fs.go.
+	conns []*unet.Socket `state:"nosave"`
 
 	// msize is the value of the msize mount option, see fs/gofer/fs.go.
 	msize uint32 `state:"wait"`
@@ -113,11 +113,20 @@ type session struct {
 	// file and another deleting it concurrently, where the file will not be
 	// reported as socket file.
 	endpoints *endpointMap `state:"wait"`
+
+	// throttle limits the rate of file I/O to the gofer. It is nil if
+	// there are no limits, and is shared with the other sessions in the
+	// same I/O group until the session is destroyed. throttle is set from
+	// the mount options, which are parsed again on restore.
+	throttle *ioThrottle `state:"nosave"`
 }
 
 // Destroy tears down the session.
 func (s *session) Destroy() {
-	s.conn.Close()
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+	s.throttle.release()
 }
 
 // Revalidate returns true if the cache policy is does not allow for VFS caching.
@@ -135,6 +144,11 @@ func (s *session) Keep(dirent *fs.Dirent) bool {
 	return fs.IsFile(sattr) || fs.IsDir(sattr) || fs.IsSymlink(sattr)
 }
 
+// CachesAttributes implements fs.MountSourceOperations.CachesAttributes.
+func (s *session) CachesAttributes(inode *fs.Inode) bool {
+	return isCachable(s, inode)
+}
+
 // ResetInodeMappings implements fs.MountSourceOperations.ResetInodeMappings.
 func (s *session) ResetInodeMappings() {
 	s.inodeMappings = make(map[uint64]string)
@@ -187,8 +201,24 @@ func newInodeOperations(ctx context.Context, s *session, file contextFile, qid p
 	}
 }
 
+// newConns returns the sockets of the channels of the mount options o.
+func newConns(o opts) ([]*unet.Socket, error) {
+	var conns []*unet.Socket
+	for _, fd := range append([]int{o.fd}, o.channelFDs...) {
+		conn, err := unet.NewSocket(fd)
+		if err != nil {
+			for _, c := range conns {
+				c.Close()
+			}
+			return nil, err
+		}
+		conns = append(conns, conn)
+	}
+	return conns, nil
+}
+
 // Root returns the root of a 9p mount. This mount is bound to a 9p server
-// based on conn. Otherwise configuration parameters are:
+// over the channels in opts. Otherwise configuration parameters are:
 //
 // * dev:         connection id
 // * filesystem:  the filesystem backing the mount
@@ -199,7 +229,7 @@ func Root(ctx context.Context, dev string, filesystem fs.Filesystem, superBlockF
 	// be used to assign ownership to files that the Gofer owns.
 	mounter := fs.FileOwnerFromContext(ctx)
 
-	conn, err := unet.NewSocket(o.fd)
+	conns, err := newConns(o)
 	if err != nil {
 		return nil, err
 	}
@@ -207,13 +237,14 @@ func Root(ctx context.Context, dev string, filesystem fs.Filesystem, superBlockF
 	// Construct the session.
 	s := &session{
 		connID:          dev,
-		conn:            conn,
+		conns:           conns,
 		msize:           o.msize,
 		version:         o.version,
 		cachePolicy:     o.policy,
 		aname:           o.aname,
 		superBlockFlags: superBlockFlags,
 		mounter:         mounter,
+		throttle:        ioThrottleFor(o.ioGroup, o.ioMax),
 	}
 
 	if o.privateunixsocket {
@@ -224,7 +255,7 @@ func Root(ctx context.Context, dev string, filesystem fs.Filesystem, superBlockF
 	m := fs.NewMountSource(s, filesystem, superBlockFlags)
 
 	// Send the Tversion request.
-	s.client, err = p9.NewClient(s.conn, s.msize, s.version)
+	s.client, err = p9.NewClientChannels(s.conns, s.msize, s.version)
 	if err != nil {
 		// Drop our reference on the session, it needs to be torn down.
 		s.DecRef()
@@ -19,7 +19,6 @@ import (
 
 	"gvisor.googlesource.com/gvisor/pkg/p9"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
-	"gvisor.googlesource.com/gvisor/pkg/unet"
 )
 
 // beforeSave is invoked by stateify.
@@ -39,21 +38,18 @@ func (s *session) afterLoad() {
 	if !ok {
 		panic("failed to find restore environment")
 	}
-	mounts, ok := env.MountSources[fsys.Name()]
-	if !ok {
+	if _, ok := env.MountSources[fsys.Name()]; !ok {
 		panic("failed to find mounts for filesystem type " + fsys.Name())
 	}
-	var args fs.MountArgs
-	var found bool
-	for _, mount := range mounts {
-		if mount.Dev == s.connID {
-			args = mount
-			found = true
-		}
-	}
-	if !found {
+	args, rebound, ok := env.FindMount(fsys.Name(), s.connID)
+	if !ok {
 		panic(fmt.Sprintf("no connection for connection id %q", s.connID))
 	}
+	if rebound {
+		// Inodes in this session are keyed by the new connection from
+		// now on; see inodeFileState.afterLoad.
+		s.connID = args.Dev
+	}
 
 	// Validate the mount flags and options.
 	opts, err := options(args.Data)
@@ -69,7 +65,10 @@ func (s *session) afterLoad() {
 	if opts.policy != s.cachePolicy {
 		panic(fmt.Sprintf("new cache policy %v, want %v", opts.policy, s.cachePolicy))
 	}
-	if opts.aname != s.aname {
+	if rebound {
+		// A rebound mount may be attached elsewhere.
+		s.aname = opts.aname
+	} else if opts.aname != s.aname {
 		panic(fmt.Sprintf("new attach name %v, want %v", opts.aname, s.aname))
 	}
 	if opts.privateunixsocket != (s.endpoints != nil) {
@@ -79,14 +78,17 @@ func (s *session) afterLoad() {
 		panic(fmt.Sprintf("new mount flags %v, want %v", args.Flags, s.superBlockFlags))
 	}
 
+	// I/O limits may change across restore.
+	s.throttle = ioThrottleFor(opts.ioGroup, opts.ioMax)
+
 	// Manually restore the connection.
-	s.conn, err = unet.NewSocket(opts.fd)
+	s.conns, err = newConns(opts)
 	if err != nil {
-		panic(fmt.Sprintf("failed to create Socket for FD %d: %v", opts.fd, err))
+		panic(fmt.Sprintf("failed to create Sockets for FDs %d and %v: %v", opts.fd, opts.channelFDs, err))
 	}
 
 	// Manually restore the client.
-	s.client, err = p9.NewClient(s.conn, s.msize, s.version)
+	s.client, err = p9.NewClientChannels(s.conns, s.msize, s.version)
 	if err != nil {
 		panic(fmt.Sprintf("failed to connect client to server: %v", err))
 	}
@@ -0,0 +1,194 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gofer
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
+	"gvisor.googlesource.com/gvisor/pkg/syserror"
+)
+
+// ioLimits are the maximum rates of file I/O to a gofer. They have the
+// meaning of the keys of the io.max file of Linux's cgroup v2 io controller,
+// see Documentation/cgroup-v2.txt. A limit of 0 means unlimited.
+type ioLimits struct {
+	// rbps is the maximum number of bytes read per second.
+	rbps uint64
+
+	// wbps is the maximum number of bytes written per second.
+	wbps uint64
+
+	// riops is the maximum number of read operations per second.
+	riops uint64
+
+	// wiops is the maximum number of write operations per second.
+	wiops uint64
+}
+
+// rateLimiter delays operations so that their cost doesn't exceed a rate.
+type rateLimiter struct {
+	// rate is the maximum cost per second. If rate is 0, the limiter never
+	// delays.
+	rate uint64
+
+	// next is the earliest time at which the next operation may start.
+	next time.Time
+}
+
+// reserve reserves cost at time now and returns the time at which the
+// operation may start.
+func (r *rateLimiter) reserve(now time.Time, cost uint64) time.Time {
+	if r.rate == 0 {
+		return now
+	}
+	start := r.next
+	if start.Before(now) {
+		start = now
+	}
+	// Compute in floating point: cost * time.Second overflows uint64 for
+	// I/Os larger than about 18GB.
+	// float64(math.MaxInt64) is rounded up to 2^63, which doesn't fit in a
+	// Duration, so the comparison must be against it rather than below.
+	d := float64(cost) / float64(r.rate) * float64(time.Second)
+	if d >= float64(math.MaxInt64) {
+		r.next = start.Add(time.Duration(math.MaxInt64))
+	} else {
+		r.next = start.Add(time.Duration(d))
+	}
+	return start
+}
+
+// ioThrottle delays file I/O to a gofer to enforce ioLimits.
+//
+// A nil *ioThrottle is valid and never delays.
+type ioThrottle struct {
+	// mu protects the limiters below.
+	mu sync.Mutex
+
+	rbps  rateLimiter
+	wbps  rateLimiter
+	riops rateLimiter
+	wiops rateLimiter
+
+	// group is the I/O group of the sessions sharing the throttle, or empty
+	// if it belongs to a single session. It is immutable.
+	group string
+
+	// refs is the number of sessions using the throttle. It is protected
+	// by ioThrottles.mu.
+	refs int
+}
+
+// newIOThrottle returns an ioThrottle enforcing l, or nil if l has no limits.
+func newIOThrottle(l ioLimits) *ioThrottle {
+	if l == (ioLimits{}) {
+		return nil
+	}
+	return &ioThrottle{
+		rbps:  rateLimiter{rate: l.rbps},
+		wbps:  rateLimiter{rate: l.wbps},
+		riops: rateLimiter{rate: l.riops},
+		wiops: rateLimiter{rate: l.wiops},
+	}
+}
+
+// ioThrottles are the ioThrottles shared by the live gofer sessions in each I/O
+// group, keyed by the name of the group.
+var ioThrottles = struct {
+	mu sync.Mutex
+	m  map[string]*ioThrottle
+}{m: make(map[string]*ioThrottle)}
+
+// ioThrottleFor returns the ioThrottle of the sessions in the given I/O group,
+// or nil if l has no limits. Sessions in the same group share one budget, so
+// that the limits apply to their I/O combined rather than to each session. The
+// group's limits are those of the first live session that joined it. If group
+// is empty, the session has its own ioThrottle.
+//
+// The session must call release on the returned ioThrottle when it is
+// destroyed.
+func ioThrottleFor(group string, l ioLimits) *ioThrottle {
+	if group == "" {
+		return newIOThrottle(l)
+	}
+	ioThrottles.mu.Lock()
+	defer ioThrottles.mu.Unlock()
+	if t, ok := ioThrottles.m[group]; ok {
+		t.refs++
+		return t
+	}
+	t := newIOThrottle(l)
+	if t != nil {
+		t.group = group
+		t.refs = 1
+		ioThrottles.m[group] = t
+	}
+	return t
+}
+
+// release drops the reference of a session on t, which was returned by
+// ioThrottleFor. Once all sessions of the group have released it, the next
+// session in the group gets a new ioThrottle with its own limits.
+func (t *ioThrottle) release() {
+	if t == nil || t.group == "" {
+		return
+	}
+	ioThrottles.mu.Lock()
+	defer ioThrottles.mu.Unlock()
+	t.refs--
+	if t.refs == 0 {
+		delete(ioThrottles.m, t.group)
+	}
+}
+
+// wait blocks until an I/O of n bytes may start without exceeding the limits.
+// If ctx is a task, the wait can be interrupted, in which case wait returns
+// syserror.ErrInterrupted and the I/O must not be done.
+func (t *ioThrottle) wait(ctx context.Context, write bool, n uint64) error {
+	if t == nil {
+		return nil
+	}
+	now := time.Now()
+	t.mu.Lock()
+	var bps, iops time.Time
+	if write {
+		bps, iops = t.wbps.reserve(now, n), t.wiops.reserve(now, 1)
+	} else {
+		bps, iops = t.rbps.reserve(now, n), t.riops.reserve(now, 1)
+	}
+	t.mu.Unlock()
+
+	start := bps
+	if iops.After(start) {
+		start = iops
+	}
+	d := start.Sub(now)
+	if d <= 0 {
+		return nil
+	}
+	task := kernel.TaskFromContext(ctx)
+	if task == nil {
+		time.Sleep(d)
+		return nil
+	}
+	if _, err := task.BlockWithTimeout(nil, true, d); err != syserror.ETIMEDOUT {
+		return err
+	}
+	return nil
+}
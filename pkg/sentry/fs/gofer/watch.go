@@ -0,0 +1,153 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gofer
+
+import (
+	"bytes"
+	"syscall"
+
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/fd"
+	"gvisor.googlesource.com/gvisor/pkg/log"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
+	"gvisor.googlesource.com/gvisor/pkg/waiter"
+	"gvisor.googlesource.com/gvisor/pkg/waiter/fdnotifier"
+)
+
+// hostEventBaseSize is the size of the fixed part of a host struct
+// inotify_event.
+const hostEventBaseSize = 16
+
+// hostEventBufferSize is the size of the buffer used to read events from a
+// host inotify instance. It must be large enough for at least one event with
+// a name of NAME_MAX (255) bytes.
+const hostEventBufferSize = 4096
+
+// WatchHost implements fs.HostWatcher.WatchHost.
+//
+// If the gofer supports it, events are read from a host inotify instance
+// donated by the gofer and forwarded to w.
+func (i *inodeOperations) WatchHost(ctx context.Context, w *fs.Watches) (func(), error) {
+	f, err := i.fileState.file.watch(ctx, linux.IN_ALL_EVENTS)
+	if err != nil {
+		return nil, err
+	}
+	return startHostWatch(f, w)
+}
+
+// hostWatch forwards events from a host inotify instance to a set of
+// watches.
+type hostWatch struct {
+	// file is the host inotify instance. It is owned by the hostWatch
+	// goroutine.
+	file *fd.FD
+
+	// w receives the forwarded events.
+	w *fs.Watches
+
+	// queue is notified when file is readable.
+	queue waiter.Queue
+
+	// stop is closed to stop forwarding.
+	stop chan struct{}
+}
+
+// startHostWatch starts forwarding events from file to w. It takes ownership
+// of file. The returned function stops forwarding without blocking.
+func startHostWatch(file *fd.FD, w *fs.Watches) (func(), error) {
+	hw := &hostWatch{
+		file: file,
+		w:    w,
+		stop: make(chan struct{}),
+	}
+	if err := fdnotifier.AddFD(int32(file.FD()), &hw.queue); err != nil {
+		file.Close()
+		return nil, err
+	}
+	go hw.run() // S/R-SAFE: host watches are not saved.
+	return func() { close(hw.stop) }, nil
+}
+
+// run reads events from hw.file until hw.stop is closed or the host watch
+// goes away.
+func (hw *hostWatch) run() {
+	defer func() {
+		fdnotifier.RemoveFD(int32(hw.file.FD()))
+		hw.file.Close()
+	}()
+
+	e, ch := waiter.NewChannelEntry(nil)
+	hw.queue.EventRegister(&e, waiter.EventIn)
+	defer hw.queue.EventUnregister(&e)
+
+	buf := make([]byte, hostEventBufferSize)
+	for {
+		n, err := syscall.Read(hw.file.FD(), buf)
+		switch {
+		case err == syscall.EAGAIN || err == syscall.EINTR:
+			select {
+			case <-ch:
+				continue
+			case <-hw.stop:
+				return
+			}
+		case err != nil:
+			log.Warningf("Failed to read host inotify events: %v", err)
+			return
+		}
+
+		// Don't deliver events once stopped, the watches may be gone.
+		select {
+		case <-hw.stop:
+			return
+		default:
+		}
+		if !hw.forward(buf[:n]) {
+			return
+		}
+	}
+}
+
+// forward queues the events in buf with hw.w. It returns false if the host
+// watch was removed.
+func (hw *hostWatch) forward(buf []byte) bool {
+	for len(buf) >= hostEventBaseSize {
+		mask := usermem.ByteOrder.Uint32(buf[4:8])
+		cookie := usermem.ByteOrder.Uint32(buf[8:12])
+		nameLen := usermem.ByteOrder.Uint32(buf[12:16])
+		if uint64(len(buf)) < hostEventBaseSize+uint64(nameLen) {
+			log.Warningf("Truncated host inotify event: %v", buf)
+			return true
+		}
+		name := buf[hostEventBaseSize : hostEventBaseSize+nameLen]
+		if i := bytes.IndexByte(name, 0); i >= 0 {
+			name = name[:i]
+		}
+		buf = buf[hostEventBaseSize+nameLen:]
+
+		switch {
+		case mask&linux.IN_IGNORED != 0:
+			// The host file was removed or unmounted.
+			return false
+		case mask&linux.IN_Q_OVERFLOW != 0:
+			log.Debugf("Host inotify queue overflowed, events were dropped")
+			continue
+		}
+		hw.w.Notify(string(name), mask, cookie)
+	}
+	return true
+}
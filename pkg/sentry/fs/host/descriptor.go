@@ -83,6 +83,9 @@ func (d *descriptor) initAfterLoad(mo *superOperations, id uint64, queue *waiter
 			return fmt.Errorf("failed to dup restored fd %d: %v", d.origFD, err)
 		}
 	} else {
+		if mo.donatedRoot {
+			return fmt.Errorf("failed to restore inode number %d: the mount root was donated", id)
+		}
 		name, ok := mo.inodeMappings[id]
 		if !ok {
 			return fmt.Errorf("failed to find path for inode number %d", id)
@@ -17,6 +17,7 @@ package host
 import (
 	"fmt"
 	"syscall"
+	"time"
 
 	"golang.org/x/sys/unix"
 	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
@@ -30,6 +31,7 @@ import (
 	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/memmap"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/safemem"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usage"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
 	"gvisor.googlesource.com/gvisor/pkg/syserror"
 	"gvisor.googlesource.com/gvisor/pkg/waiter"
@@ -213,7 +215,13 @@ func (f *fileOperations) Write(ctx context.Context, file *fs.File, src usermem.I
 	}
 	if !file.Dirent.Inode.MountSource.Flags.ForcePageCache {
 		writer := secio.NewOffsetWriter(fd.NewReadWriter(f.iops.fileState.FD()), offset)
-		return src.CopyInTo(ctx, safemem.FromIOWriter{writer})
+		start := time.Now()
+		n, err := src.CopyInTo(ctx, safemem.FromIOWriter{writer})
+		if u := usage.IOFromContext(ctx); u != nil && fs.IsFile(file.Dirent.Inode.StableAttr) {
+			u.AccountBlockIODelay(time.Since(start))
+			u.AccountWriteIO(n)
+		}
+		return n, err
 	}
 	return f.iops.cachingInodeOps.Write(ctx, src, offset)
 }
@@ -245,7 +253,13 @@ func (f *fileOperations) Read(ctx context.Context, file *fs.File, dst usermem.IO
 	}
 	if !file.Dirent.Inode.MountSource.Flags.ForcePageCache {
 		reader := secio.NewOffsetReader(fd.NewReadWriter(f.iops.fileState.FD()), offset)
-		return dst.CopyOutFrom(ctx, safemem.FromIOReader{reader})
+		start := time.Now()
+		n, err := dst.CopyOutFrom(ctx, safemem.FromIOReader{reader})
+		if u := usage.IOFromContext(ctx); u != nil && fs.IsFile(file.Dirent.Inode.StableAttr) {
+			u.AccountBlockIODelay(time.Since(start))
+			u.AccountReadIO(n)
+		}
+		return n, err
 	}
 	return f.iops.cachingInodeOps.Read(ctx, file, dst, offset)
 }
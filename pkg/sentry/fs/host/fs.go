@@ -40,6 +40,11 @@ const (
 	// mount.
 	rootPathKey = "root"
 
+	// rootFDKey is the mount option containing a host fd open at the root
+	// of the mount, donated by another process. Files are then opened
+	// relative to it, and the mount does not need access to host paths.
+	rootFDKey = "rootfd"
+
 	// dontTranslateOwnershipKey is the key to superOperations.dontTranslateOwnership.
 	dontTranslateOwnershipKey = "dont_translate_ownership"
 )
@@ -85,6 +90,12 @@ func (f *Filesystem) Mount(ctx context.Context, _ string, flags fs.MountSourceFl
 		delete(options, whitelistKey)
 	}
 
+	if _, ok := options[rootFDKey]; ok {
+		if _, ok := options[rootPathKey]; ok {
+			return nil, fmt.Errorf("%q and %q are mutually exclusive", rootPathKey, rootFDKey)
+		}
+	}
+
 	// If the rootPath was set, use it. Othewise default to the root of the
 	// host fs.
 	rootPath := "/"
@@ -101,8 +112,20 @@ func (f *Filesystem) Mount(ctx context.Context, _ string, flags fs.MountSourceFl
 			f.paths[i] = path.Join("/", rel)
 		}
 	}
-	fd, err := open(nil, rootPath)
-	if err != nil {
+
+	// If the root was donated, use it rather than opening rootPath.
+	var (
+		fd          int
+		donatedRoot bool
+		err         error
+	)
+	if v, ok := options[rootFDKey]; ok {
+		if fd, err = strconv.Atoi(v); err != nil || fd < 0 {
+			return nil, fmt.Errorf("invalid value for %q: %q", rootFDKey, v)
+		}
+		donatedRoot = true
+		delete(options, rootFDKey)
+	} else if fd, err = open(nil, rootPath); err != nil {
 		return nil, fmt.Errorf("failed to find root: %v", err)
 	}
 
@@ -127,6 +150,7 @@ func (f *Filesystem) Mount(ctx context.Context, _ string, flags fs.MountSourceFl
 
 	// Construct the host file system mount and inode.
 	msrc := newMountSource(ctx, rootPath, owner, f, flags, dontTranslateOwnership)
+	msrc.MountSourceOperations.(*superOperations).donatedRoot = donatedRoot
 	return newInode(ctx, msrc, fd, false /* saveable */, false /* donated */)
 }
 
@@ -288,6 +312,11 @@ type superOperations struct {
 	// If whitelistfs is a lower filesystem in an overlay, set
 	// dont_translate_ownership=true in mount options.
 	dontTranslateOwnership bool
+
+	// donatedRoot indicates that the root of the mount is a host fd
+	// donated by another process rather than root. Files cannot be
+	// reopened by path on restore.
+	donatedRoot bool
 }
 
 var _ fs.MountSourceOperations = (*superOperations)(nil)
@@ -306,6 +335,14 @@ func (m *superOperations) SaveInodeMapping(inode *fs.Inode, path string) {
 	m.inodeMappings[sattr.InodeID] = path
 }
 
+// CachesAttributes implements fs.MountSourceOperations.CachesAttributes.
+//
+// The attributes of files that are mapped through the sentry's page cache are
+// maintained by the sentry; see inodeOperations.UnstableAttr.
+func (*superOperations) CachesAttributes(inode *fs.Inode) bool {
+	return inode.MountSource.Flags.ForcePageCache && canMap(inode)
+}
+
 // Keep implements fs.MountSourceOperations.Keep.
 //
 // TODO: It is possible to change the permissions on a
@@ -21,6 +21,7 @@ import (
 	"path"
 	"reflect"
 	"sort"
+	"syscall"
 	"testing"
 
 	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
@@ -354,6 +355,62 @@ func TestRootPath(t *testing.T) {
 	}
 }
 
+func TestRootFD(t *testing.T) {
+	rootPath, err := ioutil.TempDir(os.TempDir(), "root")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(rootPath)
+	if err := ioutil.WriteFile(path.Join(rootPath, "file"), []byte("data"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	// Mount the directory from a donated fd.
+	fd, err := syscall.Open(rootPath, syscall.O_RDONLY, 0)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	hostFS := &Filesystem{}
+	ctx := contexttest.Context(t)
+	inode, err := hostFS.Mount(ctx, "", fs.MountSourceFlags{}, fmt.Sprintf("%s=%d", rootFDKey, fd))
+	if err != nil {
+		syscall.Close(fd)
+		t.Fatalf("Mount failed: %v", err)
+	}
+	mm, err := fs.NewMountNamespace(ctx, inode)
+	if err != nil {
+		t.Fatalf("NewMountNamespace failed: %v", err)
+	}
+	root := mm.Root()
+	defer root.DecRef()
+
+	// Files are looked up and created relative to the fd.
+	d, err := mm.FindInode(ctx, root, nil, "/file", 0)
+	if err != nil {
+		t.Fatalf("FindInode failed: %v", err)
+	}
+	d.DecRef()
+	if err := root.CreateDirectory(ctx, root, "dir", fs.FilePermsFromMode(0755)); err != nil {
+		t.Fatalf("CreateDirectory failed: %v", err)
+	}
+	if _, err := os.Stat(path.Join(rootPath, "dir")); err != nil {
+		t.Errorf("Stat of created directory failed: %v", err)
+	}
+}
+
+func TestRootFDInvalid(t *testing.T) {
+	ctx := contexttest.Context(t)
+	for _, data := range []string{
+		fmt.Sprintf("%s=-1", rootFDKey),
+		fmt.Sprintf("%s=foo", rootFDKey),
+		fmt.Sprintf("%s=3,%s=/", rootFDKey, rootPathKey),
+	} {
+		if _, err := (&Filesystem{}).Mount(ctx, "", fs.MountSourceFlags{}, data); err == nil {
+			t.Errorf("Mount(%q) succeeded, wanted an error", data)
+		}
+	}
+}
+
 type rootContext struct {
 	context.Context
 	root *fs.Dirent
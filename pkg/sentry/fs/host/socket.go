@@ -184,6 +184,10 @@ func (e *endpoint) GetSockOpt(opt interface{}) *tcpip.Error {
 		// We don't support passcred on host sockets.
 		*o = 0
 		return nil
+	case *tcpip.PasssecOption:
+		// We don't support passsec on host sockets.
+		*o = 0
+		return nil
 	case *tcpip.SendBufferSizeOption:
 		v, err := syscall.GetsockoptInt(e.fd, syscall.SOL_SOCKET, syscall.SO_SNDBUF)
 		*o = tcpip.SendBufferSizeOption(v)
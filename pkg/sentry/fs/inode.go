@@ -74,7 +74,7 @@ func NewInode(iops InodeOperations, msrc *MountSource, sattr StableAttr) *Inode
 	return &Inode{
 		InodeOperations: iops,
 		StableAttr:      sattr,
-		Watches:         newWatches(),
+		Watches:         newWatches(iops),
 		MountSource:     msrc,
 	}
 }
@@ -273,10 +273,19 @@ func (i *Inode) Listxattr() (map[string]struct{}, error) {
 // - checks file system mount flags,
 // - and utilizes InodeOperations.Check to check capabilities and modes.
 func (i *Inode) CheckPermission(ctx context.Context, p PermMask) error {
-	// First check the outer-most mounted filesystem.
-	if p.Write && i.MountSource.Flags.ReadOnly {
+	if p.Write && i.readOnlyMountSource() != nil {
 		return syserror.EROFS
 	}
+	return i.check(ctx, p)
+}
+
+// readOnlyMountSource returns the read-only MountSource that prevents writes
+// to i, or nil if i's mounts permit writes.
+func (i *Inode) readOnlyMountSource() *MountSource {
+	// First check the outer-most mounted filesystem.
+	if i.MountSource.Flags.ReadOnly {
+		return i.MountSource
+	}
 
 	if i.overlay != nil {
 		// CheckPermission requires some special handling for
@@ -288,12 +297,12 @@ func (i *Inode) CheckPermission(ctx context.Context, p PermMask) error {
 		// But still honor the upper-most filesystem's mount flags;
 		// we should not attempt to modify the writable layer if it
 		// is mounted read-only.
-		if p.Write && overlayUpperMountSource(i.MountSource).Flags.ReadOnly {
-			return syserror.EROFS
+		if upper := overlayUpperMountSource(i.MountSource); upper.Flags.ReadOnly {
+			return upper
 		}
 	}
 
-	return i.check(ctx, p)
+	return nil
 }
 
 func (i *Inode) check(ctx context.Context, p PermMask) error {
@@ -17,8 +17,22 @@ package fs
 import (
 	"fmt"
 	"sync"
+
+	"gvisor.googlesource.com/gvisor/pkg/log"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
 )
 
+// HostWatcher is implemented by InodeOperations whose files may be changed
+// outside of the sentry, and which can report such changes as inotify events.
+type HostWatcher interface {
+	// WatchHost starts queueing events with w for changes made outside of
+	// the sentry. It returns a function that stops doing so.
+	//
+	// WatchHost is called without w.mu held, and may block. The returned
+	// function is called with w.mu held, so it may not block on w.
+	WatchHost(ctx context.Context, w *Watches) (stop func(), err error)
+}
+
 // Watches is the collection of inotify watches on an inode.
 type Watches struct {
 	// mu protects the fields below.
@@ -34,12 +48,26 @@ type Watches struct {
 	// knowing if the target inode is going down due to a deletion or
 	// revalidation.
 	unlinked bool
+
+	// host generates events for changes made to the target outside of the
+	// sentry while there are active watches. It may be nil.
+	//
+	// Host events are not restored along with the watches.
+	host HostWatcher `state:"nosave"`
+
+	// stopHost stops the events generated by host. It is non-nil only
+	// while host is generating events.
+	stopHost func() `state:"nosave"`
 }
 
-func newWatches() *Watches {
-	return &Watches{
+func newWatches(iops InodeOperations) *Watches {
+	w := &Watches{
 		ws: make(map[uint64]*Watch),
 	}
+	if hw, ok := iops.(HostWatcher); ok {
+		w.host = hw
+	}
+	return w
 }
 
 // MarkUnlinked indicates the target for this set of watches to be unlinked.
@@ -63,8 +91,9 @@ func (w *Watches) Lookup(id uint64) *Watch {
 }
 
 // Add adds watch into this set of watches. The watch being added must be unique
-// - its ID() should not collide with any existing watches.
-func (w *Watches) Add(watch *Watch) {
+// - its ID() should not collide with any existing watches. stop is the result
+// of a previous call to StartHost, and may be nil; see SetHost.
+func (w *Watches) Add(watch *Watch, stop func()) {
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
@@ -77,6 +106,55 @@ func (w *Watches) Add(watch *Watch) {
 		panic(fmt.Sprintf("Watch collision with ID %+v", watch.ID()))
 	}
 	w.ws[watch.ID()] = watch
+	w.setHostLocked(stop)
+}
+
+// StartHost starts host events for w if they aren't started yet, and returns
+// the function that stops them. It returns nil if there is no need to start
+// host events or if they couldn't be started. The result must be passed to Add
+// or SetHost.
+//
+// Watching the host may block, e.g. on a gofer RPC, so StartHost should be
+// called without holding the lock of an inotify instance. It must be called
+// without w.mu held.
+func (w *Watches) StartHost(ctx context.Context) func() {
+	w.mu.RLock()
+	started := w.host == nil || w.stopHost != nil
+	w.mu.RUnlock()
+	if started {
+		return nil
+	}
+
+	stop, err := w.host.WatchHost(ctx, w)
+	if err != nil {
+		// Events for changes made within the sentry are still delivered.
+		log.Debugf("Failed to watch host file: %v", err)
+		return nil
+	}
+	return stop
+}
+
+// SetHost makes stop, the result of StartHost, stop host events once there are
+// no watches left. If host events were started concurrently, or if there are
+// no watches, stop is called instead. stop may be nil.
+func (w *Watches) SetHost(stop func()) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.setHostLocked(stop)
+}
+
+// setHostLocked implements SetHost.
+//
+// Preconditions: w.mu must be locked.
+func (w *Watches) setHostLocked(stop func()) {
+	if stop == nil {
+		return
+	}
+	if w.stopHost == nil && len(w.ws) > 0 {
+		w.stopHost = stop
+		return
+	}
+	stop()
 }
 
 // Remove removes a watch with the given id from this set of watches. The caller
@@ -102,6 +180,11 @@ func (w *Watches) Remove(id uint64) {
 		panic(fmt.Sprintf("Attempt to remove a watch, but no watch found with provided id %+v.", id))
 	}
 	delete(w.ws, watch.ID())
+
+	if len(w.ws) == 0 && w.stopHost != nil {
+		w.stopHost()
+		w.stopHost = nil
+	}
 }
 
 // Notify queues a new event with all watches in this set.
@@ -158,6 +241,10 @@ func (w *Watches) targetDestroyed() {
 	w.mu.Lock()
 	ws = w.ws
 	w.ws = nil
+	if w.stopHost != nil {
+		w.stopHost()
+		w.stopHost = nil
+	}
 	w.mu.Unlock()
 
 	for _, watch := range ws {
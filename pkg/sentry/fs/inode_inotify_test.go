@@ -0,0 +1,131 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs
+
+import (
+	"testing"
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/context/contexttest"
+)
+
+// fakeHostWatcher is a HostWatcher that counts the host watches it starts
+// and stops.
+type fakeHostWatcher struct {
+	t       *testing.T
+	started int
+	stopped int
+}
+
+// WatchHost implements HostWatcher.WatchHost.
+func (h *fakeHostWatcher) WatchHost(ctx context.Context, w *Watches) (func(), error) {
+	// Lookup locks w.mu, so it only returns if WatchHost is called
+	// without w.mu held.
+	done := make(chan struct{})
+	go func() {
+		w.Lookup(0)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		h.t.Fatalf("WatchHost called with Watches.mu held")
+	}
+	h.started++
+	return func() { h.stopped++ }, nil
+}
+
+func TestWatchesHost(t *testing.T) {
+	ctx := contexttest.Context(t)
+	h := &fakeHostWatcher{t: t}
+	w := &Watches{
+		ws:   make(map[uint64]*Watch),
+		host: h,
+	}
+	w1 := &Watch{owner: &Inotify{id: 1}}
+	w2 := &Watch{owner: &Inotify{id: 2}}
+
+	w.Add(w1, w.StartHost(ctx))
+	w.Add(w2, w.StartHost(ctx))
+	if h.started != 1 {
+		t.Errorf("Host watches started = %d, want 1", h.started)
+	}
+
+	w.Remove(w1.ID())
+	if h.stopped != 0 {
+		t.Errorf("Host watch stopped with a watch left")
+	}
+	w.Remove(w2.ID())
+	if h.stopped != 1 {
+		t.Errorf("Host watches stopped = %d, want 1", h.stopped)
+	}
+
+	w.Add(w1, w.StartHost(ctx))
+	if h.started != 2 {
+		t.Errorf("Host watches started = %d after re-adding a watch, want 2", h.started)
+	}
+}
+
+// lockingHostWatcher is a HostWatcher that checks that the lock of an inotify
+// instance isn't held while watching the host.
+type lockingHostWatcher struct {
+	*MockInodeOperations
+	t       *testing.T
+	i       *Inotify
+	started int
+	stopped int
+}
+
+// WatchHost implements HostWatcher.WatchHost.
+func (h *lockingHostWatcher) WatchHost(ctx context.Context, w *Watches) (func(), error) {
+	done := make(chan struct{})
+	go func() {
+		h.i.mu.Lock()
+		h.i.mu.Unlock()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		h.t.Fatalf("WatchHost called with Inotify.mu held")
+	}
+	h.started++
+	return func() { h.stopped++ }, nil
+}
+
+func TestAddWatchHost(t *testing.T) {
+	ctx := contexttest.Context(t)
+	i := NewInotify(ctx)
+	h := &lockingHostWatcher{MockInodeOperations: NewMockInodeOperations(ctx), t: t, i: i}
+	d := NewDirent(NewInode(h, NewMockMountSource(nil), StableAttr{}), "file")
+	defer d.DecRef()
+
+	wd := i.AddWatch(ctx, d, linux.IN_MODIFY)
+	if got := i.AddWatch(ctx, d, linux.IN_ATTRIB); got != wd {
+		t.Errorf("AddWatch on watched file returned %d, want %d", got, wd)
+	}
+	if h.started != 1 {
+		t.Errorf("Host watches started = %d, want 1", h.started)
+	}
+
+	if err := i.RmWatch(wd); err != nil {
+		t.Fatalf("RmWatch failed: %v", err)
+	}
+	if h.stopped != 1 {
+		t.Errorf("Host watches stopped = %d, want 1", h.stopped)
+	}
+}
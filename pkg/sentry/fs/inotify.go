@@ -226,8 +226,9 @@ func (i *Inotify) queueEvent(ev *Event) {
 	i.Queue.Notify(waiter.EventIn)
 }
 
-// newWatchLocked creates and adds a new watch to target.
-func (i *Inotify) newWatchLocked(target *Dirent, mask uint32) *Watch {
+// newWatchLocked creates and adds a new watch to target. stop is the result
+// of target.Inode.Watches.StartHost.
+func (i *Inotify) newWatchLocked(target *Dirent, mask uint32, stop func()) *Watch {
 	wd := i.nextWatch
 	i.nextWatch++
 
@@ -245,7 +246,7 @@ func (i *Inotify) newWatchLocked(target *Dirent, mask uint32) *Watch {
 	// memory. This ref is dropped during either watch removal, target
 	// destruction, or inotify instance destruction. See callers of Watch.Unpin.
 	watch.Pin(target)
-	target.Inode.Watches.Add(watch)
+	target.Inode.Watches.Add(watch, stop)
 
 	return watch
 }
@@ -265,35 +266,61 @@ func (i *Inotify) targetDestroyed(w *Watch) {
 
 // AddWatch constructs a new inotify watch and adds it to the target dirent. It
 // returns the watch descriptor returned by inotify_add_watch(2).
-func (i *Inotify) AddWatch(target *Dirent, mask uint32) int32 {
+func (i *Inotify) AddWatch(ctx context.Context, target *Dirent, mask uint32) int32 {
 	// Note: Locking this inotify instance protects the result returned by
 	// Lookup() below. With the lock held, we know for sure the lookup result
 	// won't become stale because it's impossible for *this* instance to
 	// add/remove watches on target.
+	i.mu.Lock()
+	if wd, ok := i.updateWatchLocked(target, mask); ok {
+		i.mu.Unlock()
+		return wd
+	}
+	i.mu.Unlock()
+
+	// Watching the host may block, e.g. on a gofer RPC, which would block
+	// all other operations on this instance, so it is done without i.mu.
+	stop := target.Inode.Watches.StartHost(ctx)
+
 	i.mu.Lock()
 	defer i.mu.Unlock()
 
-	// Does the target already have a watch from this inotify instance?
-	if existing := target.Inode.Watches.Lookup(i.id); existing != nil {
-		// This may be a watch on a different dirent pointing to the
-		// same inode. Obtain an extra reference if necessary.
-		existing.Pin(target)
-
-		if mergeMask := mask&linux.IN_MASK_ADD != 0; mergeMask {
-			// "Add (OR) events to watch mask for this pathname if it already
-			// exists (instead of replacing mask)." -- inotify(7)
-			existing.mask |= mask
-		} else {
-			existing.mask = mask
-		}
-		return existing.wd
+	// A concurrent AddWatch may have added a watch on target while i.mu
+	// was released.
+	if wd, ok := i.updateWatchLocked(target, mask); ok {
+		target.Inode.Watches.SetHost(stop)
+		return wd
 	}
 
 	// No existing watch, create a new watch.
-	watch := i.newWatchLocked(target, mask)
+	watch := i.newWatchLocked(target, mask, stop)
 	return watch.wd
 }
 
+// updateWatchLocked updates the mask of the existing watch of i on target, if
+// any, and returns its descriptor. ok is false if there is no such watch.
+//
+// Preconditions: i.mu must be locked.
+func (i *Inotify) updateWatchLocked(target *Dirent, mask uint32) (wd int32, ok bool) {
+	existing := target.Inode.Watches.Lookup(i.id)
+	if existing == nil {
+		return 0, false
+	}
+
+	// This may be a watch on a different dirent pointing to the
+	// same inode. Obtain an extra reference if necessary.
+	existing.Pin(target)
+
+	if mergeMask := mask&linux.IN_MASK_ADD != 0; mergeMask {
+		// "Add (OR) events to watch mask for this pathname if it already
+		// exists (instead of replacing mask)." -- inotify(7)
+		existing.mask |= mask
+	} else {
+		existing.mask = mask
+	}
+	return existing.wd, true
+}
+
 // RmWatch implements watcher.Watchable.RmWatch.
 //
 // RmWatch looks up an inotify watch for the given 'wd' and configures the
@@ -77,6 +77,11 @@ func (n *MockMountSourceOps) Keep(dirent *Dirent) bool {
 	return n.keep
 }
 
+// CachesAttributes implements fs.MountSourceOperations.CachesAttributes.
+func (n *MockMountSourceOps) CachesAttributes(*Inode) bool {
+	return false
+}
+
 // WriteOut implements fs.InodeOperations.WriteOut.
 func (n *MockInodeOperations) WriteOut(context.Context, *Inode) error {
 	return nil
@@ -62,6 +62,11 @@ type MountSourceOperations interface {
 	// which path is mapped. Filesystems that do not use this information to
 	// restore inodes can make SaveInodeMappings a no-op.
 	SaveInodeMapping(inode *Inode, path string)
+
+	// CachesAttributes returns true if the attributes of inode, which is in
+	// the mounted filesystem, may be cached in the sentry, so that they
+	// don't reflect changes made to the file outside of it.
+	CachesAttributes(inode *Inode) bool
 }
 
 // InodeMappings defines a fmt.Stringer MountSource Inode mappings.
@@ -205,6 +210,12 @@ func (msrc *MountSource) Root() *Dirent {
 	return msrc.root
 }
 
+// CachedDirents returns the number of Dirents pinned by the dirent cache of
+// this mount.
+func (msrc *MountSource) CachedDirents() uint64 {
+	return msrc.fscache.Size()
+}
+
 // DirentRefs returns the current mount direntRefs.
 func (msrc *MountSource) DirentRefs() uint64 {
 	return atomic.LoadUint64(&msrc.direntRefs)
@@ -276,6 +287,11 @@ func (*SimpleMountSourceOperations) ResetInodeMappings() {}
 // SaveInodeMapping implements MountSourceOperations.SaveInodeMapping.
 func (*SimpleMountSourceOperations) SaveInodeMapping(*Inode, string) {}
 
+// CachesAttributes implements MountSourceOperations.CachesAttributes.
+func (*SimpleMountSourceOperations) CachesAttributes(*Inode) bool {
+	return false
+}
+
 // Destroy implements MountSourceOperations.Destroy.
 func (*SimpleMountSourceOperations) Destroy() {}
 
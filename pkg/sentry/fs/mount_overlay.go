@@ -65,6 +65,17 @@ func (o *overlayMountSourceOperations) SaveInodeMapping(inode *Inode, path strin
 	}
 }
 
+// CachesAttributes returns true if the upper or lower MountSource caches the
+// attributes of the Inode that inode is currently backed by.
+func (o *overlayMountSourceOperations) CachesAttributes(inode *Inode) bool {
+	inode.overlay.copyMu.RLock()
+	defer inode.overlay.copyMu.RUnlock()
+	if inode.overlay.upper != nil {
+		return o.upper.CachesAttributes(inode.overlay.upper)
+	}
+	return o.lower.CachesAttributes(inode.overlay.lower)
+}
+
 // Destroy drops references on the upper and lower MountSource.
 func (o *overlayMountSourceOperations) Destroy() {
 	o.upper.DecRef()
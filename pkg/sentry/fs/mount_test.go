@@ -16,9 +16,11 @@ package fs
 
 import (
 	"fmt"
+	"sync/atomic"
 	"testing"
 
 	"gvisor.googlesource.com/gvisor/pkg/sentry/context/contexttest"
+	"gvisor.googlesource.com/gvisor/pkg/syserror"
 )
 
 // cacheReallyContains iterates through the dirent cache to determine whether
@@ -214,3 +216,127 @@ func mountPathsAre(root *Dirent, got []*MountSource, want ...string) error {
 	}
 	return nil
 }
+
+// Test that a lazy unmount detaches the whole mount tree, while a regular
+// unmount of a mount with submounts fails.
+func TestUnmountSubmounts(t *testing.T) {
+	ctx := contexttest.Context(t)
+
+	rootCache := NewDirentCache(100)
+	rootInode := NewMockInode(ctx, NewMockMountSource(rootCache), StableAttr{
+		Type: Directory,
+	})
+	mm, err := NewMountNamespace(ctx, rootInode)
+	if err != nil {
+		t.Fatalf("NewMountNamespace failed: %v", err)
+	}
+	rootDirent := mm.Root()
+	defer rootDirent.DecRef()
+
+	for _, p := range []string{"/foo", "/foo/bar", "/foo/bar/baz", "/foo/qux"} {
+		d, err := mm.FindLink(ctx, rootDirent, nil, p, 0)
+		if err != nil {
+			t.Fatalf("could not find path %q in mount manager: %v", p, err)
+		}
+		submountInode := NewMockInode(ctx, NewMockMountSource(nil), StableAttr{
+			Type: Directory,
+		})
+		if err := mm.Mount(ctx, d, submountInode); err != nil {
+			t.Fatalf("could not mount at %q: %v", p, err)
+		}
+		d.DecRef()
+	}
+
+	foo, err := mm.FindLink(ctx, rootDirent, nil, "/foo", 0)
+	if err != nil {
+		t.Fatalf("could not find path %q in mount manager: %v", "/foo", err)
+	}
+	defer foo.DecRef()
+
+	if err := mm.Unmount(ctx, foo, false /* detachOnly */); err != syserror.EBUSY {
+		t.Errorf("Unmount(/foo) got error %v, want %v", err, syserror.EBUSY)
+	}
+
+	if err := mm.Unmount(ctx, foo, true /* detachOnly */); err != nil {
+		t.Fatalf("Unmount(/foo, detach) failed: %v", err)
+	}
+	if got := len(rootDirent.Inode.MountSource.Submounts()); got != 0 {
+		t.Errorf("root got %d submounts after detach, wanted 0", got)
+	}
+	if got := len(mm.mounts); got != 0 {
+		t.Errorf("mount namespace has %d mount points after detach, wanted 0", got)
+	}
+	if got := len(foo.Inode.MountSource.Submounts()); got != 0 {
+		t.Errorf("detached /foo got %d submounts, wanted 0", got)
+	}
+	if p := foo.Inode.MountSource.Parent(); p != nil {
+		t.Errorf("detached /foo got parent %+v, wanted nil", p)
+	}
+}
+
+// Test that a lazy unmount that fails for one mount of the tree leaves the
+// whole tree mounted.
+func TestUnmountSubmountsFailure(t *testing.T) {
+	ctx := contexttest.Context(t)
+
+	rootCache := NewDirentCache(100)
+	rootInode := NewMockInode(ctx, NewMockMountSource(rootCache), StableAttr{
+		Type: Directory,
+	})
+	mm, err := NewMountNamespace(ctx, rootInode)
+	if err != nil {
+		t.Fatalf("NewMountNamespace failed: %v", err)
+	}
+	rootDirent := mm.Root()
+	defer rootDirent.DecRef()
+
+	mounts := make(map[string]*MountSource)
+	for _, p := range []string{"/foo", "/foo/bar", "/foo/bar/baz", "/foo/qux"} {
+		d, err := mm.FindLink(ctx, rootDirent, nil, p, 0)
+		if err != nil {
+			t.Fatalf("could not find path %q in mount manager: %v", p, err)
+		}
+		submountInode := NewMockInode(ctx, NewMockMountSource(nil), StableAttr{
+			Type: Directory,
+		})
+		if err := mm.Mount(ctx, d, submountInode); err != nil {
+			t.Fatalf("could not mount at %q: %v", p, err)
+		}
+		mounts[p] = submountInode.MountSource
+		d.DecRef()
+	}
+
+	foo, err := mm.FindLink(ctx, rootDirent, nil, "/foo", 0)
+	if err != nil {
+		t.Fatalf("could not find path %q in mount manager: %v", "/foo", err)
+	}
+	defer foo.DecRef()
+
+	// /foo/bar can't be unmounted, but /foo/bar/baz below it and /foo/qux
+	// next to it can.
+	bar := mounts["/foo/bar"].Root()
+	atomic.StoreInt32(&bar.deleted, 1)
+	if err := mm.Unmount(ctx, foo, true /* detachOnly */); err != syserror.ENOENT {
+		t.Fatalf("Unmount(/foo, detach) got error %v, want %v", err, syserror.ENOENT)
+	}
+	if got := len(mm.mounts); got != 4 {
+		t.Errorf("mount namespace has %d mount points after failed detach, wanted 4", got)
+	}
+	if got := len(rootDirent.Inode.MountSource.Submounts()); got != 4 {
+		t.Errorf("root got %d submounts after failed detach, wanted 4", got)
+	}
+	for p, m := range mounts {
+		if m.Parent() == nil {
+			t.Errorf("%s got no parent after failed detach", p)
+		}
+	}
+
+	// Once the failure is gone, the whole tree is detached.
+	atomic.StoreInt32(&bar.deleted, 0)
+	if err := mm.Unmount(ctx, foo, true /* detachOnly */); err != nil {
+		t.Fatalf("Unmount(/foo, detach) failed: %v", err)
+	}
+	if got := len(mm.mounts); got != 0 {
+		t.Errorf("mount namespace has %d mount points after detach, wanted 0", got)
+	}
+}
@@ -174,6 +174,14 @@ func (mns *MountNamespace) withMountLocked(node *Dirent, fn func() error) error
 	renameMu.Lock()
 	defer renameMu.Unlock()
 
+	return withDirentLocked(node, fn)
+}
+
+// withDirentLocked locks node and its parent for withMountLocked, and calls
+// fn.
+//
+// Preconditions: mns.mu and renameMu must be locked.
+func withDirentLocked(node *Dirent, fn func() error) error {
 	// Linux allows mounting over the root (?). It comes with a strange set
 	// of semantics. We'll just not do this for now.
 	if node.parent == nil {
@@ -257,79 +265,203 @@ func (mns *MountNamespace) Mount(ctx context.Context, node *Dirent, inode *Inode
 // be destroyed at a later time when all references to Dirents within are
 // dropped.
 //
+// A detached mount takes all of its submounts with it, as umount_tree does in
+// Linux. Without detachOnly, a mount that still has submounts is busy.
+//
 // The caller must hold a reference to node from walking to it.
 func (mns *MountNamespace) Unmount(ctx context.Context, node *Dirent, detachOnly bool) error {
+	if detachOnly {
+		return mns.detachTree(ctx, node)
+	}
 	// This takes locks to prevent further walks to Dirents in this mount
 	// under the assumption that `node` is the root of the mount.
 	return mns.withMountLocked(node, func() error {
-		origs, ok := mns.mounts[node]
-		if !ok {
-			// node is not a mount point.
-			return syserror.EINVAL
-		}
+		return mns.unmountLocked(ctx, node, false /* detachOnly */)
+	})
+}
 
-		if len(origs) == 0 {
-			panic("cannot unmount initial dirent")
+// detachTree lazily unmounts the mount rooted at node and all of its
+// descendants, as umount_tree does in Linux. Every mount of the tree is
+// checked before any of them is detached, so that the tree is either detached
+// as a whole or left untouched.
+func (mns *MountNamespace) detachTree(ctx context.Context, node *Dirent) error {
+	// roots holds references on the roots of the submounts. They are
+	// dropped once all locks are released, as dropping the last one may
+	// destroy the Dirent.
+	var roots []*Dirent
+	defer func() {
+		for _, root := range roots {
+			root.DecRef()
 		}
+	}()
 
-		m := node.Inode.MountSource
-		if !detachOnly {
-			// Flush all references on the mounted node.
-			m.FlushDirentRefs()
+	// Holding mns.mu prevents mounts from being added to or removed from
+	// the tree until it is detached.
+	mns.mu.Lock()
+	defer mns.mu.Unlock()
 
-			// At this point, exactly two references must be held
-			// to mount: one mount reference on node, and one due
-			// to walking to node.
-			//
-			// We must also be guaranteed that no more references
-			// can be taken on mount. This is why withMountLocked
-			// must be held at this point to prevent any walks to
-			// and from node.
-			if refs := m.DirentRefs(); refs < 2 {
-				panic(fmt.Sprintf("have %d refs on unmount, expect 2 or more", refs))
-			} else if refs != 2 {
-				return syserror.EBUSY
-			}
+	renameMu.Lock()
+	defer renameMu.Unlock()
+
+	if _, ok := mns.mounts[node]; !ok {
+		// node is not a mount point.
+		return syserror.EINVAL
+	}
+
+	// Detach the deepest mounts first, so that each mount is a leaf by
+	// the time it is detached.
+	var collect func(m *MountSource)
+	collect = func(m *MountSource) {
+		for _, c := range m.Children() {
+			collect(c)
+			root := c.Root()
+			root.IncRef()
+			roots = append(roots, root)
 		}
+	}
+	collect(node.Inode.MountSource)
+	tree := append(append([]*Dirent(nil), roots...), node)
 
-		// Lock the parent MountSource first, if it exists. We are
-		// holding mns.Lock, so the parent can not change out
-		// from under us.
-		parent := m.Parent()
-		if parent != nil {
-			parent.mu.Lock()
-			defer parent.mu.Unlock()
+	for _, root := range tree {
+		if err := withDirentLocked(root, func() error {
+			return mns.checkUnmountLocked(root)
+		}); err != nil {
+			return err
+		}
+	}
+	for _, root := range tree {
+		if err := withDirentLocked(root, func() error {
+			return mns.unmountLocked(ctx, root, true /* detachOnly */)
+		}); err != nil {
+			panic(fmt.Sprintf("failed to detach mount after checking it: %v", err))
 		}
+	}
+	return nil
+}
+
+// checkUnmountLocked returns the error with which unmountLocked would fail to
+// detach the mount rooted at node, if any.
+//
+// Preconditions: The locks taken by withMountLocked for node must be held.
+func (mns *MountNamespace) checkUnmountLocked(node *Dirent) error {
+	origs, ok := mns.mounts[node]
+	if !ok {
+		// node is not a mount point.
+		return syserror.EINVAL
+	}
+	if len(origs) == 0 {
+		panic("cannot unmount initial dirent")
+	}
+	return node.checkUnmount()
+}
 
-		// Lock the mount that is being unmounted.
-		m.mu.Lock()
-		defer m.mu.Unlock()
+// unmountLocked removes the single mount rooted at node. See Unmount.
+//
+// Preconditions: The locks taken by withMountLocked for node must be held.
+func (mns *MountNamespace) unmountLocked(ctx context.Context, node *Dirent, detachOnly bool) error {
+	if err := mns.checkUnmountLocked(node); err != nil {
+		return err
+	}
+	origs := mns.mounts[node]
 
-		if m.parent != nil {
-			// Sanity check.
-			if _, ok := m.parent.children[m]; !ok {
-				panic(fmt.Sprintf("mount %+v is not a child of parent %+v", m, m.parent))
-			}
-			delete(m.parent.children, m)
-		}
+	m := node.Inode.MountSource
+	if !detachOnly {
+		// Flush all references on the mounted node.
+		m.FlushDirentRefs()
 
-		original := origs[len(origs)-1]
-		if err := node.unmount(ctx, original); err != nil {
-			return err
+		// At this point, exactly two references must be held
+		// to mount: one mount reference on node, and one due
+		// to walking to node.
+		//
+		// We must also be guaranteed that no more references
+		// can be taken on mount. This is why withMountLocked
+		// must be held at this point to prevent any walks to
+		// and from node.
+		if refs := m.DirentRefs(); refs < 2 {
+			panic(fmt.Sprintf("have %d refs on unmount, expect 2 or more", refs))
+		} else if refs != 2 {
+			return syserror.EBUSY
 		}
+	}
+
+	// Lock the parent MountSource first, if it exists. We are
+	// holding mns.Lock, so the parent can not change out
+	// from under us.
+	parent := m.Parent()
+	if parent != nil {
+		parent.mu.Lock()
+		defer parent.mu.Unlock()
+	}
+
+	// Lock the mount that is being unmounted.
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Submounts pin the mount. For lazy unmounts they have all
+	// been detached by now.
+	if len(m.children) != 0 {
+		return syserror.EBUSY
+	}
 
-		switch {
-		case len(origs) > 1:
-			mns.mounts[original] = origs[:len(origs)-1]
-		case len(origs) == 1:
-			// Drop mount reference taken at the end of
-			// MountNamespace.Mount.
-			original.DecRef()
+	if m.parent != nil {
+		// Sanity check.
+		if _, ok := m.parent.children[m]; !ok {
+			panic(fmt.Sprintf("mount %+v is not a child of parent %+v", m, m.parent))
 		}
+		delete(m.parent.children, m)
+		m.parent = nil
+	}
 
-		delete(mns.mounts, node)
-		return nil
-	})
+	original := origs[len(origs)-1]
+	if err := node.unmount(ctx, original); err != nil {
+		return err
+	}
+
+	switch {
+	case len(origs) > 1:
+		mns.mounts[original] = origs[:len(origs)-1]
+	case len(origs) == 1:
+		// Drop mount reference taken at the end of
+		// MountNamespace.Mount.
+		original.DecRef()
+	}
+
+	delete(mns.mounts, node)
+	return nil
+}
+
+// ResolveOptions restricts path resolution, as by the RESOLVE_* flags of
+// openat2(2). The zero value imposes no restrictions.
+type ResolveOptions struct {
+	// If Beneath is true, resolution fails with EXDEV rather than leave the
+	// root directory it was given, by an absolute path, an absolute symlink,
+	// or ".." in the root directory. The caller passes the directory that
+	// resolution must stay beneath as root.
+	Beneath bool
+
+	// If InRoot is true, the caller passes the directory that resolution is
+	// confined to as root, and absolute paths and symlinks are resolved
+	// relative to it, like chroot(2).
+	InRoot bool
+
+	// If NoSymlinks is true, resolution fails with ELOOP at any symlink.
+	NoSymlinks bool
+
+	// If NoMagicLinks is true, resolution fails with ELOOP at any symlink
+	// that is not resolved by reading its target, such as
+	// /proc/[pid]/fd/[fd].
+	NoMagicLinks bool
+
+	// If NoXDev is true, resolution fails with EXDEV rather than cross a
+	// mount point, in either direction.
+	NoXDev bool
+}
+
+// scoped returns true if resolution is confined to the root directory
+// passed with opts. Such resolution must not follow links that are not
+// resolved by reading their target, since those may refer to any file.
+func (opts ResolveOptions) scoped() bool {
+	return opts.Beneath || opts.InRoot
 }
 
 // FindLink returns an Dirent from a given node, which may be a symlink.
@@ -345,6 +477,12 @@ func (mns *MountNamespace) Unmount(ctx context.Context, node *Dirent, detachOnly
 // Precondition: root must be non-nil.
 // Precondition: the path must be non-empty.
 func (mns *MountNamespace) FindLink(ctx context.Context, root, wd *Dirent, path string, maxTraversals uint) (*Dirent, error) {
+	return mns.FindLinkWithOptions(ctx, root, wd, path, maxTraversals, ResolveOptions{})
+}
+
+// FindLinkWithOptions is identical to FindLink except that resolution is
+// restricted by opts.
+func (mns *MountNamespace) FindLinkWithOptions(ctx context.Context, root, wd *Dirent, path string, maxTraversals uint, opts ResolveOptions) (*Dirent, error) {
 	if root == nil {
 		panic("MountNamespace.FindInode: root must not be nil")
 	}
@@ -361,6 +499,13 @@ func (mns *MountNamespace) FindLink(ctx context.Context, root, wd *Dirent, path
 		current = root
 	}
 	for first == "/" {
+		if opts.Beneath {
+			return nil, syscall.EXDEV
+		}
+		if opts.NoXDev && root.Inode.MountSource != current.Inode.MountSource {
+			return nil, syscall.EXDEV
+		}
+
 		// Special case: it's possible that we have nothing to walk at
 		// all. This is necessary since we're resplitting the path.
 		if remainder == "" {
@@ -383,8 +528,9 @@ func (mns *MountNamespace) FindLink(ctx context.Context, root, wd *Dirent, path
 		//
 		// Note that we elide this check for the root directory as an
 		// optimization; a non-executable root may still be walked.  A
-		// non-directory root is hopeless.
-		if current != root {
+		// non-directory root is hopeless. This does not apply to a root
+		// passed with scoped opts, which is an ordinary directory.
+		if current != root || opts.scoped() {
 			if !IsDir(current.Inode.StableAttr) {
 				current.DecRef() // Drop reference from above.
 				return nil, syserror.ENOTDIR
@@ -395,6 +541,11 @@ func (mns *MountNamespace) FindLink(ctx context.Context, root, wd *Dirent, path
 			}
 		}
 
+		if opts.Beneath && first == ".." && current == root {
+			current.DecRef() // Drop reference from above.
+			return nil, syscall.EXDEV
+		}
+
 		// Move to the next level.
 		next, err := current.Walk(ctx, root, first)
 		if err != nil {
@@ -405,6 +556,12 @@ func (mns *MountNamespace) FindLink(ctx context.Context, root, wd *Dirent, path
 			return nil, err
 		}
 
+		if opts.NoXDev && next.Inode.MountSource != current.Inode.MountSource {
+			next.DecRef()
+			current.DecRef()
+			return nil, syscall.EXDEV
+		}
+
 		// Drop old reference.
 		current.DecRef()
 
@@ -413,7 +570,7 @@ func (mns *MountNamespace) FindLink(ctx context.Context, root, wd *Dirent, path
 			//
 			// See resolve for reference semantics; on err next
 			// will have one dropped.
-			current, err = mns.resolve(ctx, root, next, maxTraversals)
+			current, err = mns.resolve(ctx, root, next, maxTraversals, opts)
 			if err != nil {
 				return nil, err
 			}
@@ -434,14 +591,20 @@ func (mns *MountNamespace) FindLink(ctx context.Context, root, wd *Dirent, path
 //
 //go:nosplit
 func (mns *MountNamespace) FindInode(ctx context.Context, root, wd *Dirent, path string, maxTraversals uint) (*Dirent, error) {
-	d, err := mns.FindLink(ctx, root, wd, path, maxTraversals)
+	return mns.FindInodeWithOptions(ctx, root, wd, path, maxTraversals, ResolveOptions{})
+}
+
+// FindInodeWithOptions is identical to FindInode except that resolution is
+// restricted by opts.
+func (mns *MountNamespace) FindInodeWithOptions(ctx context.Context, root, wd *Dirent, path string, maxTraversals uint, opts ResolveOptions) (*Dirent, error) {
+	d, err := mns.FindLinkWithOptions(ctx, root, wd, path, maxTraversals, opts)
 	if err != nil {
 		return nil, err
 	}
 
 	// See resolve for reference semantics; on err d will have the
 	// reference dropped.
-	return mns.resolve(ctx, root, d, maxTraversals)
+	return mns.resolve(ctx, root, d, maxTraversals, opts)
 }
 
 // resolve resolves the given link.
@@ -452,7 +615,12 @@ func (mns *MountNamespace) FindInode(ctx context.Context, root, wd *Dirent, path
 // If not successful, a reference is _also_ dropped on the node and an error
 // returned. This is for convenience in using resolve directly as a return
 // value.
-func (mns *MountNamespace) resolve(ctx context.Context, root, node *Dirent, maxTraversals uint) (*Dirent, error) {
+func (mns *MountNamespace) resolve(ctx context.Context, root, node *Dirent, maxTraversals uint, opts ResolveOptions) (*Dirent, error) {
+	if opts.NoSymlinks && IsSymlink(node.Inode.StableAttr) {
+		node.DecRef() // Drop for err; see above.
+		return nil, syscall.ELOOP
+	}
+
 	// Resolve the path.
 	target, err := node.Inode.Getlink(ctx)
 
@@ -464,6 +632,18 @@ func (mns *MountNamespace) resolve(ctx context.Context, root, node *Dirent, maxT
 			return nil, syscall.ELOOP
 		}
 
+		// The target was not found by walking, so it may be anywhere.
+		if opts.NoSymlinks || opts.NoMagicLinks {
+			target.DecRef()
+			node.DecRef() // Drop for err; see above.
+			return nil, syscall.ELOOP
+		}
+		if opts.scoped() || (opts.NoXDev && target.Inode.MountSource != node.Inode.MountSource) {
+			target.DecRef()
+			node.DecRef() // Drop for err; see above.
+			return nil, syscall.EXDEV
+		}
+
 		node.DecRef() // Drop the original reference.
 		return target, nil
 
@@ -486,7 +666,7 @@ func (mns *MountNamespace) resolve(ctx context.Context, root, node *Dirent, maxT
 		}
 
 		// Find the node; we resolve relative to the current symlink's parent.
-		d, err := mns.FindInode(ctx, root, node.parent, targetPath, maxTraversals-1)
+		d, err := mns.FindInodeWithOptions(ctx, root, node.parent, targetPath, maxTraversals-1, opts)
 		if err != nil {
 			return nil, err
 		}
@@ -20,7 +20,9 @@ import (
 	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/context/contexttest"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/ramfs"
 	ramfstest "gvisor.googlesource.com/gvisor/pkg/sentry/fs/ramfs/test"
+	"gvisor.googlesource.com/gvisor/pkg/syserror"
 )
 
 // Creates a new MountNamespace with filesystem:
@@ -100,3 +102,88 @@ func TestFindLink(t *testing.T) {
 		}
 	}
 }
+
+// newSymlink returns a ramfs symlink inode pointing to target.
+func newSymlink(ctx context.Context, m *fs.MountSource, target string) *fs.Inode {
+	s := &ramfs.Symlink{}
+	s.InitSymlink(ctx, fs.RootOwner, target)
+	return fs.NewInode(s, m, fs.StableAttr{Type: fs.Symlink})
+}
+
+func TestFindInodeWithOptions(t *testing.T) {
+	ctx := contexttest.Context(t)
+	perms := fs.FilePermsFromMode(0777)
+	m := fs.NewNonCachingMountSource(nil, fs.MountSourceFlags{})
+
+	// /
+	// |-bar      (file)
+	// |-foo      (dir)
+	//   |-bar    (file)
+	//   |-abs    -> /bar
+	//   |-rel    -> bar
+	//   |-escape -> ../bar
+	fooDir := ramfstest.NewDir(ctx, map[string]*fs.Inode{
+		"bar":    fs.NewInode(ramfstest.NewFile(ctx, perms), m, fs.StableAttr{Type: fs.RegularFile}),
+		"abs":    newSymlink(ctx, m, "/bar"),
+		"rel":    newSymlink(ctx, m, "bar"),
+		"escape": newSymlink(ctx, m, "../bar"),
+	}, perms)
+	rootDir := ramfstest.NewDir(ctx, map[string]*fs.Inode{
+		"bar": fs.NewInode(ramfstest.NewFile(ctx, perms), m, fs.StableAttr{Type: fs.RegularFile}),
+		"foo": fs.NewInode(fooDir, m, fs.StableAttr{Type: fs.Directory}),
+	}, perms)
+	mm, err := fs.NewMountNamespace(ctx, fs.NewInode(rootDir, m, fs.StableAttr{Type: fs.Directory}))
+	if err != nil {
+		t.Fatalf("NewMountNamespace failed: %v", err)
+	}
+
+	root := mm.Root()
+	defer root.DecRef()
+	foo, err := root.Walk(ctx, root, "foo")
+	if err != nil {
+		t.Fatalf("Error walking to foo: %v", err)
+	}
+	defer foo.DecRef()
+
+	beneath := fs.ResolveOptions{Beneath: true}
+	inRoot := fs.ResolveOptions{InRoot: true}
+	noSymlinks := fs.ResolveOptions{NoSymlinks: true}
+	for _, tc := range []struct {
+		findPath string
+		opts     fs.ResolveOptions
+		wantPath string
+		wantErr  error
+	}{
+		{"bar", beneath, "/foo/bar", nil},
+		{"rel", beneath, "/foo/bar", nil},
+		{"./bar", beneath, "/foo/bar", nil},
+		{"/bar", beneath, "", syserror.EXDEV},
+		{"../bar", beneath, "", syserror.EXDEV},
+		{"abs", beneath, "", syserror.EXDEV},
+		{"escape", beneath, "", syserror.EXDEV},
+		{"/bar", inRoot, "/foo/bar", nil},
+		{"../bar", inRoot, "/foo/bar", nil},
+		{"abs", inRoot, "/foo/bar", nil},
+		{"escape", inRoot, "/foo/bar", nil},
+		{"bar", noSymlinks, "/foo/bar", nil},
+		{"rel", noSymlinks, "", syserror.ELOOP},
+	} {
+		// Scoped resolution is confined to the starting directory.
+		scope := root
+		if tc.opts.Beneath || tc.opts.InRoot {
+			scope = foo
+		}
+		d, err := mm.FindInodeWithOptions(ctx, scope, foo, tc.findPath, 1, tc.opts)
+		if err != tc.wantErr {
+			t.Errorf("FindInodeWithOptions(%q, %+v) got error %v, want %v", tc.findPath, tc.opts, err, tc.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if got, _ := d.FullName(root); got != tc.wantPath {
+			t.Errorf("FindInodeWithOptions(%q, %+v) got dirent %q, want %q", tc.findPath, tc.opts, got, tc.wantPath)
+		}
+		d.DecRef()
+	}
+}
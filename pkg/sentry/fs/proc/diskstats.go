@@ -0,0 +1,57 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proc
+
+import (
+	"bytes"
+	"fmt"
+
+	"gvisor.googlesource.com/gvisor/pkg/sentry/device"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/proc/seqfile"
+)
+
+// diskstatsData backs /proc/diskstats.
+type diskstatsData struct{}
+
+// NeedsUpdate implements seqfile.SeqSource.NeedsUpdate.
+func (*diskstatsData) NeedsUpdate(generation int64) bool {
+	return true
+}
+
+// ReadSeqFileData implements seqfile.SeqSource.ReadSeqFileData.
+func (*diskstatsData) ReadSeqFileData(h seqfile.SeqHandle) ([]seqfile.SeqData, int64) {
+	if h != nil {
+		return nil, 0
+	}
+
+	var buf bytes.Buffer
+	for _, d := range device.BlockDevices() {
+		s := d.Stats.Snapshot()
+		// See Linux's block/genhd.c:diskstats_show(). Merges are never
+		// reported.
+		fmt.Fprintf(&buf, "%4d %7d %s %d %d %d %d %d %d %d %d %d %d %d\n",
+			d.ID.Major, d.ID.Minor, d.Name,
+			s.ReadIOs, 0, s.ReadSectors, s.ReadMillis,
+			s.WriteIOs, 0, s.WriteSectors, s.WriteMillis,
+			s.InFlight, s.IOMillis, s.QueueMillis)
+	}
+
+	return []seqfile.SeqData{
+		{
+			Buf:    buf.Bytes(),
+			Handle: (*diskstatsData)(nil),
+		},
+	}, 0
+}
@@ -83,6 +83,7 @@ func New(ctx context.Context, msrc *fs.MountSource) (*fs.Inode, error) {
 	p.InitDir(ctx, map[string]*fs.Inode{
 		// Note that these are just the static members. There are
 		// dynamic members populated in Readdir and Lookup below.
+		"diskstats":   seqfile.NewSeqFileInode(ctx, &diskstatsData{}, msrc),
 		"filesystems": seqfile.NewSeqFileInode(ctx, &filesystemsData{}, msrc),
 		"loadavg":     seqfile.NewSeqFileInode(ctx, &loadavgData{}, msrc),
 		"meminfo":     seqfile.NewSeqFileInode(ctx, &meminfoData{k}, msrc),
@@ -17,6 +17,7 @@ package proc
 import (
 	"fmt"
 	"io"
+	"strings"
 
 	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
@@ -51,6 +52,60 @@ func (p *proc) newHostname(ctx context.Context, msrc *fs.MountSource) *fs.Inode
 	return newFile(h, msrc, fs.SpecialFile, nil)
 }
 
+// corePatternMaxSize is the maximum size of /proc/sys/kernel/core_pattern.
+//
+// Linux: include/linux/binfmts.h:CORENAME_MAX_SIZE.
+const corePatternMaxSize = 128
+
+// corePattern is a file containing the pattern of the names of core dumps.
+type corePattern struct {
+	ramfs.Entry
+	k *kernel.Kernel
+}
+
+func (p *proc) newCorePattern(ctx context.Context, msrc *fs.MountSource) *fs.Inode {
+	c := &corePattern{k: p.k}
+	c.InitEntry(ctx, fs.RootOwner, fs.FilePermsFromMode(0644))
+	return newFile(c, msrc, fs.SpecialFile, nil)
+}
+
+// DeprecatedPreadv implements fs.InodeOperations.DeprecatedPreadv.
+func (c *corePattern) DeprecatedPreadv(ctx context.Context, dst usermem.IOSequence, offset int64) (int64, error) {
+	contents := []byte(c.k.CorePattern() + "\n")
+	if offset >= int64(len(contents)) {
+		return 0, io.EOF
+	}
+
+	n, err := dst.CopyOut(ctx, contents[offset:])
+	return int64(n), err
+}
+
+// Truncate implements fs.InodeOperations.Truncate.
+func (*corePattern) Truncate(context.Context, *fs.Inode, int64) error {
+	return nil
+}
+
+// DeprecatedPwritev implements fs.InodeOperations.DeprecatedPwritev.
+func (c *corePattern) DeprecatedPwritev(ctx context.Context, src usermem.IOSequence, offset int64) (int64, error) {
+	if src.NumBytes() == 0 {
+		return 0, nil
+	}
+	src = src.TakeFirst(corePatternMaxSize - 1)
+
+	buf := make([]byte, src.NumBytes())
+	n, err := src.CopyIn(ctx, buf)
+	if err != nil {
+		return int64(n), err
+	}
+	// As in Linux, the pattern ends at the first newline.
+	pattern := string(buf[:n])
+	if i := strings.IndexByte(pattern, '\n'); i >= 0 {
+		pattern = pattern[:i]
+	}
+	c.k.SetCorePattern(pattern)
+	return int64(n), nil
+}
+
 // mmapMinAddrData backs /proc/sys/vm/mmap_min_addr.
 type mmapMinAddrData struct {
 	k *kernel.Kernel
@@ -96,6 +151,7 @@ func (*overcommitMemory) ReadSeqFileData(h seqfile.SeqHandle) ([]seqfile.SeqData
 func (p *proc) newKernelDir(ctx context.Context, msrc *fs.MountSource) *fs.Inode {
 	d := &ramfs.Dir{}
 	d.InitDir(ctx, nil, fs.RootOwner, fs.FilePermsFromMode(0555))
+	d.AddChild(ctx, "core_pattern", p.newCorePattern(ctx, msrc))
 	d.AddChild(ctx, "hostname", p.newHostname(ctx, msrc))
 	return newFile(d, msrc, fs.SpecialDirectory, nil)
 }
@@ -28,6 +28,7 @@ import (
 	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/proc/seqfile"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/ramfs"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/limits"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/mm"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/usage"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
@@ -64,22 +65,21 @@ func newTaskDir(t *kernel.Task, msrc *fs.MountSource, pidns *kernel.PIDNamespace
 	d := &taskDir{t: t}
 	// TODO: Set EUID/EGID based on dumpability.
 	d.InitDir(t, map[string]*fs.Inode{
-		"auxv":    newAuxvec(t, msrc),
-		"cmdline": newExecArgFile(t, msrc, cmdlineExecArg),
-		"comm":    newComm(t, msrc),
-		"environ": newExecArgFile(t, msrc, environExecArg),
-		"exe":     newExe(t, msrc),
-		"fd":      newFdDir(t, msrc),
-		"fdinfo":  newFdInfoDir(t, msrc),
-		"gid_map": newGIDMap(t, msrc),
-		// TODO: This is incorrect for /proc/[pid]/task/[tid]/io, i.e. if
-		// showSubtasks is false:
-		// http://lxr.free-electrons.com/source/fs/proc/base.c?v=3.11#L2980
-		"io":        newIO(t, msrc),
+		"auxv":      newAuxvec(t, msrc),
+		"cmdline":   newExecArgFile(t, msrc, cmdlineExecArg),
+		"comm":      newComm(t, msrc),
+		"environ":   newExecArgFile(t, msrc, environExecArg),
+		"exe":       newExe(t, msrc),
+		"fd":        newFdDir(t, msrc),
+		"fdinfo":    newFdInfoDir(t, msrc),
+		"gid_map":   newGIDMap(t, msrc),
+		"io":        newIO(t, msrc, showSubtasks),
+		"limits":    newLimits(t, msrc),
 		"maps":      newMaps(t, msrc),
 		"mountinfo": seqfile.NewSeqFileInode(t, &mountInfoFile{t: t}, msrc),
 		"mounts":    seqfile.NewSeqFileInode(t, &mountsFile{t: t}, msrc),
 		"ns":        newNamespaceDir(t, msrc),
+		"schedstat": newSchedstat(t, msrc),
 		"stat":      newTaskStat(t, msrc, showSubtasks, pidns),
 		"statm":     newStatm(t, msrc),
 		"status":    newStatus(t, msrc, pidns),
@@ -424,6 +424,39 @@ func (s *statmData) ReadSeqFileData(h seqfile.SeqHandle) ([]seqfile.SeqData, int
 	return []seqfile.SeqData{{Buf: buf.Bytes(), Handle: (*statmData)(nil)}}, 0
 }
 
+// schedstatData implements seqfile.SeqSource for /proc/[pid]/schedstat.
+type schedstatData struct {
+	t *kernel.Task
+}
+
+func newSchedstat(t *kernel.Task, msrc *fs.MountSource) *fs.Inode {
+	return newFile(seqfile.NewSeqFile(t, &schedstatData{t}), msrc, fs.SpecialFile, t)
+}
+
+// NeedsUpdate implements seqfile.SeqSource.NeedsUpdate.
+func (s *schedstatData) NeedsUpdate(generation int64) bool {
+	return true
+}
+
+// ReadSeqFileData implements seqfile.SeqSource.ReadSeqFileData.
+//
+// As in Linux, the fields are the time spent running, the time spent waiting
+// to run, both in nanoseconds, and the number of waits. Only the waits
+// measured by kernel.Task.SchedDelay are included.
+func (s *schedstatData) ReadSeqFileData(h seqfile.SeqHandle) ([]seqfile.SeqData, int64) {
+	if h != nil {
+		return nil, 0
+	}
+
+	cs := s.t.CPUStats()
+	delay, count := s.t.SchedDelay()
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%d %d %d\n", (cs.UserTime + cs.SysTime).Nanoseconds(), delay.Nanoseconds(), count)
+
+	return []seqfile.SeqData{{Buf: buf.Bytes(), Handle: (*schedstatData)(nil)}}, 0
+}
+
 // statusData implements seqfile.SeqSource for /proc/[pid]/status.
 type statusData struct {
 	t     *kernel.Task
@@ -484,6 +517,74 @@ func (s *statusData) ReadSeqFileData(h seqfile.SeqHandle) ([]seqfile.SeqData, in
 	return []seqfile.SeqData{{Buf: buf.Bytes(), Handle: (*statusData)(nil)}}, 0
 }
 
+// limitsData implements seqfile.SeqSource for /proc/[pid]/limits.
+type limitsData struct {
+	t *kernel.Task
+}
+
+func newLimits(t *kernel.Task, msrc *fs.MountSource) *fs.Inode {
+	return newFile(seqfile.NewSeqFile(t, &limitsData{t}), msrc, fs.SpecialFile, t)
+}
+
+// limitNames maps each limit type to its name and units in
+// /proc/[pid]/limits, in the order in which Linux lists them. See Linux's
+// fs/proc/base.c:lnames.
+var limitNames = []struct {
+	lt    limits.LimitType
+	name  string
+	units string
+}{
+	{limits.CPU, "Max cpu time", "seconds"},
+	{limits.FileSize, "Max file size", "bytes"},
+	{limits.Data, "Max data size", "bytes"},
+	{limits.Stack, "Max stack size", "bytes"},
+	{limits.Core, "Max core file size", "bytes"},
+	{limits.Rss, "Max resident set", "bytes"},
+	{limits.ProcessCount, "Max processes", "processes"},
+	{limits.NumberOfFiles, "Max open files", "files"},
+	{limits.MemoryPagesLocked, "Max locked memory", "bytes"},
+	{limits.AS, "Max address space", "bytes"},
+	{limits.Locks, "Max file locks", "locks"},
+	{limits.SignalsPending, "Max pending signals", "signals"},
+	{limits.MessageQueueBytes, "Max msgqueue size", "bytes"},
+	{limits.Nice, "Max nice priority", ""},
+	{limits.RealTimePriority, "Max realtime priority", ""},
+	{limits.Rttime, "Max realtime timeout", "us"},
+}
+
+// NeedsUpdate implements seqfile.SeqSource.NeedsUpdate.
+func (l *limitsData) NeedsUpdate(generation int64) bool {
+	return true
+}
+
+// ReadSeqFileData implements seqfile.SeqSource.ReadSeqFileData.
+func (l *limitsData) ReadSeqFileData(h seqfile.SeqHandle) ([]seqfile.SeqData, int64) {
+	if h != nil {
+		return nil, 0
+	}
+
+	ls := l.t.ThreadGroup().Limits()
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%-25s %-20s %-20s %-10s\n", "Limit", "Soft Limit", "Hard Limit", "Units")
+	for _, ln := range limitNames {
+		lim := ls.Get(ln.lt)
+		fmt.Fprintf(&buf, "%-25s %-20s %-20s ", ln.name, limitString(lim.Cur), limitString(lim.Max))
+		if ln.units != "" {
+			fmt.Fprintf(&buf, "%-10s", ln.units)
+		}
+		buf.WriteString("\n")
+	}
+	return []seqfile.SeqData{{Buf: buf.Bytes(), Handle: (*limitsData)(nil)}}, 0
+}
+
+// limitString formats a resource limit value for /proc/[pid]/limits.
+func limitString(v uint64) string {
+	if v == limits.Infinity {
+		return "unlimited"
+	}
+	return strconv.FormatUint(v, 10)
+}
+
 // ioUsage is the /proc/<pid>/io and /proc/<pid>/task/<tid>/io data provider.
 type ioUsage interface {
 	// IOUsage returns the io usage data.
@@ -494,8 +595,13 @@ type ioData struct {
 	ioUsage
 }
 
-func newIO(t *kernel.Task, msrc *fs.MountSource) *fs.Inode {
-	return newFile(seqfile.NewSeqFile(t, &ioData{t.ThreadGroup()}), msrc, fs.SpecialFile, t)
+// newIO returns the io file of a thread group, or of a single task if
+// isThreadGroup is false.
+func newIO(t *kernel.Task, msrc *fs.MountSource, isThreadGroup bool) *fs.Inode {
+	if isThreadGroup {
+		return newFile(seqfile.NewSeqFile(t, &ioData{t.ThreadGroup()}), msrc, fs.SpecialFile, t)
+	}
+	return newFile(seqfile.NewSeqFile(t, &ioData{t}), msrc, fs.SpecialFile, t)
 }
 
 // NeedsUpdate returns whether the generation is old or not.
@@ -514,7 +620,7 @@ func (i *ioData) ReadSeqFileData(h seqfile.SeqHandle) ([]seqfile.SeqData, int64)
 	io.Accumulate(i.IOUsage())
 
 	var buf bytes.Buffer
-	fmt.Fprintf(&buf, "char: %d\n", io.CharsRead)
+	fmt.Fprintf(&buf, "rchar: %d\n", io.CharsRead)
 	fmt.Fprintf(&buf, "wchar: %d\n", io.CharsWritten)
 	fmt.Fprintf(&buf, "syscr: %d\n", io.ReadSyscalls)
 	fmt.Fprintf(&buf, "syscw: %d\n", io.WriteSyscalls)
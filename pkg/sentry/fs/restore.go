@@ -25,6 +25,18 @@ type RestoreEnvironment struct {
 	// MountSources maps Filesystem.Name() to mount arguments.
 	MountSources map[string][]MountArgs
 
+	// RebindDevs maps the device name of a mount at the time it was saved
+	// to the device name of the mount in MountSources that replaces it.
+	// This allows a mount to be restored from a different location than
+	// it was saved from, e.g. a different host path or gofer. Mounts
+	// without an entry are restored from the mount in MountSources with
+	// the same device name.
+	//
+	// Filesystems validate that files in a rebound mount are still the
+	// same type as they were when saved; ValidateFileSize and
+	// ValidateFileTimestamp apply as usual.
+	RebindDevs map[string]string
+
 	// ValidateFileSize indicates file size should not change across S/R.
 	ValidateFileSize bool
 
@@ -45,6 +57,23 @@ type MountArgs struct {
 	Data string
 }
 
+// FindMount returns the arguments with which to restore the mount of the
+// filesystem named fsName whose device name was dev when it was saved.
+// rebound is true if the returned mount replaces dev as specified by
+// RebindDevs. ok is false if there is no such mount.
+func (r *RestoreEnvironment) FindMount(fsName, dev string) (args MountArgs, rebound bool, ok bool) {
+	if newDev, found := r.RebindDevs[dev]; found {
+		dev = newDev
+		rebound = true
+	}
+	for _, mount := range r.MountSources[fsName] {
+		if mount.Dev == dev {
+			return mount, rebound, true
+		}
+	}
+	return MountArgs{}, false, false
+}
+
 // restoreEnv holds the fs package global RestoreEnvironment.
 var restoreEnv = struct {
 	mu  sync.Mutex
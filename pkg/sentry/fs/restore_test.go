@@ -0,0 +1,54 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs
+
+import (
+	"testing"
+)
+
+func TestFindMount(t *testing.T) {
+	env := RestoreEnvironment{
+		MountSources: map[string][]MountArgs{
+			"9p": {
+				{Dev: "9pfs-/", Data: "trans=fd,rfdno=1,wfdno=1"},
+				{Dev: "9pfs-/data", Data: "trans=fd,rfdno=2,wfdno=2"},
+				{Dev: "9pfs-/new", Data: "trans=fd,rfdno=3,wfdno=3"},
+			},
+		},
+		RebindDevs: map[string]string{
+			"9pfs-/data": "9pfs-/new",
+			"9pfs-/gone": "9pfs-/missing",
+		},
+	}
+
+	for _, tc := range []struct {
+		fsName      string
+		dev         string
+		wantData    string
+		wantRebound bool
+		wantOK      bool
+	}{
+		{fsName: "9p", dev: "9pfs-/", wantData: "trans=fd,rfdno=1,wfdno=1", wantOK: true},
+		{fsName: "9p", dev: "9pfs-/data", wantData: "trans=fd,rfdno=3,wfdno=3", wantRebound: true, wantOK: true},
+		{fsName: "9p", dev: "9pfs-/gone"},
+		{fsName: "9p", dev: "9pfs-/other"},
+		{fsName: "tmpfs", dev: "9pfs-/"},
+	} {
+		args, rebound, ok := env.FindMount(tc.fsName, tc.dev)
+		if ok != tc.wantOK || rebound != tc.wantRebound || args.Data != tc.wantData {
+			t.Errorf("FindMount(%q, %q) = (%+v, %t, %t), want data %q, rebound %t, ok %t", tc.fsName, tc.dev, args, rebound, ok, tc.wantData, tc.wantRebound, tc.wantOK)
+		}
+	}
+}
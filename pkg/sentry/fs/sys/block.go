@@ -0,0 +1,113 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sys
+
+import (
+	"bytes"
+	"fmt"
+
+	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/device"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/proc/seqfile"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
+)
+
+// newBlockDir returns the /sys/block directory, which contains a directory
+// for each block device.
+func newBlockDir(ctx context.Context, msrc *fs.MountSource) *fs.Inode {
+	contents := make(map[string]*fs.Inode)
+	for _, d := range device.BlockDevices() {
+		contents[d.Name] = newDir(ctx, msrc, map[string]*fs.Inode{
+			"dev":  newSeqFile(ctx, msrc, &blockDevData{id: d.ID}),
+			"stat": newSeqFile(ctx, msrc, &blockStatData{name: d.Name}),
+		})
+	}
+	return newDir(ctx, msrc, contents)
+}
+
+// newSeqFile returns a sysfs file backed by source.
+func newSeqFile(ctx context.Context, msrc *fs.MountSource, source seqfile.SeqSource) *fs.Inode {
+	return fs.NewInode(seqfile.NewSeqFile(ctx, source), msrc, fs.StableAttr{
+		DeviceID:  sysfsDevice.DeviceID(),
+		InodeID:   sysfsDevice.NextIno(),
+		BlockSize: usermem.PageSize,
+		Type:      fs.SpecialFile,
+	})
+}
+
+// blockDevData backs /sys/block/<dev>/dev.
+type blockDevData struct {
+	id device.ID
+}
+
+// NeedsUpdate implements seqfile.SeqSource.NeedsUpdate.
+func (*blockDevData) NeedsUpdate(generation int64) bool {
+	return false
+}
+
+// ReadSeqFileData implements seqfile.SeqSource.ReadSeqFileData.
+func (b *blockDevData) ReadSeqFileData(h seqfile.SeqHandle) ([]seqfile.SeqData, int64) {
+	if h != nil {
+		return nil, 0
+	}
+	return []seqfile.SeqData{
+		{
+			Buf:    []byte(fmt.Sprintf("%d:%d\n", b.id.Major, b.id.Minor)),
+			Handle: (*blockDevData)(nil),
+		},
+	}, 0
+}
+
+// blockStatData backs /sys/block/<dev>/stat.
+type blockStatData struct {
+	// name is the name of the block device. The device is looked up by
+	// name on each read, since its statistics aren't saved.
+	name string
+}
+
+// NeedsUpdate implements seqfile.SeqSource.NeedsUpdate.
+func (*blockStatData) NeedsUpdate(generation int64) bool {
+	return true
+}
+
+// ReadSeqFileData implements seqfile.SeqSource.ReadSeqFileData.
+func (b *blockStatData) ReadSeqFileData(h seqfile.SeqHandle) ([]seqfile.SeqData, int64) {
+	if h != nil {
+		return nil, 0
+	}
+
+	var s device.DiskStats
+	for _, d := range device.BlockDevices() {
+		if d.Name == b.name {
+			s = d.Stats.Snapshot()
+			break
+		}
+	}
+
+	// See Linux's block/partition-generic.c:part_stat_show(). Merges are
+	// never reported.
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%8d %8d %8d %8d %8d %8d %8d %8d %8d %8d %8d\n",
+		s.ReadIOs, 0, s.ReadSectors, s.ReadMillis,
+		s.WriteIOs, 0, s.WriteSectors, s.WriteMillis,
+		s.InFlight, s.IOMillis, s.QueueMillis)
+	return []seqfile.SeqData{
+		{
+			Buf:    buf.Bytes(),
+			Handle: (*blockStatData)(nil),
+		},
+	}, 0
+}
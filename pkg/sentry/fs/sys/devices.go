@@ -0,0 +1,202 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sys
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/proc/seqfile"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usage"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
+	"gvisor.googlesource.com/gvisor/pkg/syserror"
+)
+
+// newDevicesDir returns the /sys/devices directory. It contains the node and
+// memory directories of /sys/devices/system if k is not nil.
+func newDevicesDir(ctx context.Context, msrc *fs.MountSource, k *kernel.Kernel) *fs.Inode {
+	if k == nil {
+		return newDir(ctx, msrc, nil)
+	}
+	return newDir(ctx, msrc, map[string]*fs.Inode{
+		"system": newDir(ctx, msrc, map[string]*fs.Inode{
+			"memory": newMemoryDir(ctx, msrc, k),
+			"node":   newNodeDir(ctx, msrc, k),
+		}),
+	})
+}
+
+// newNodeDir returns the /sys/devices/system/node directory. The sandbox is a
+// single NUMA node, which has all of the CPUs and memory.
+func newNodeDir(ctx context.Context, msrc *fs.MountSource, k *kernel.Kernel) *fs.Inode {
+	cpulist := "0\n"
+	if n := k.ApplicationCores(); n > 1 {
+		cpulist = fmt.Sprintf("0-%d\n", n-1)
+	}
+	return newDir(ctx, msrc, map[string]*fs.Inode{
+		"has_cpu":    newFixedFile(ctx, msrc, "0\n"),
+		"has_memory": newFixedFile(ctx, msrc, "0\n"),
+		"online":     newFixedFile(ctx, msrc, "0\n"),
+		"possible":   newFixedFile(ctx, msrc, "0\n"),
+		"node0": newDir(ctx, msrc, map[string]*fs.Inode{
+			"cpulist": newFixedFile(ctx, msrc, cpulist),
+			"meminfo": newSeqFile(ctx, msrc, &nodeMeminfoData{k: k}),
+		}),
+	})
+}
+
+// newFixedFile returns a sysfs file with the given contents.
+func newFixedFile(ctx context.Context, msrc *fs.MountSource, data string) *fs.Inode {
+	return newSeqFile(ctx, msrc, &fixedData{data: []byte(data)})
+}
+
+// fixedData backs sysfs files whose contents never change.
+type fixedData struct {
+	data []byte
+}
+
+// NeedsUpdate implements seqfile.SeqSource.NeedsUpdate.
+func (*fixedData) NeedsUpdate(generation int64) bool {
+	return false
+}
+
+// ReadSeqFileData implements seqfile.SeqSource.ReadSeqFileData.
+func (f *fixedData) ReadSeqFileData(h seqfile.SeqHandle) ([]seqfile.SeqData, int64) {
+	if h != nil {
+		return nil, 0
+	}
+	return []seqfile.SeqData{{Buf: f.data, Handle: (*fixedData)(nil)}}, 0
+}
+
+// nodeMeminfoData backs /sys/devices/system/node/node0/meminfo.
+type nodeMeminfoData struct {
+	// k is the owning Kernel.
+	k *kernel.Kernel
+}
+
+// NeedsUpdate implements seqfile.SeqSource.NeedsUpdate.
+func (*nodeMeminfoData) NeedsUpdate(generation int64) bool {
+	return true
+}
+
+// ReadSeqFileData implements seqfile.SeqSource.ReadSeqFileData.
+func (d *nodeMeminfoData) ReadSeqFileData(h seqfile.SeqHandle) ([]seqfile.SeqData, int64) {
+	if h != nil {
+		return nil, 0
+	}
+
+	// See /proc/meminfo, which reports the same totals.
+	mem := d.k.Platform.Memory()
+	mem.UpdateUsage()
+	_, totalUsage := usage.MemoryAccounting.Copy()
+	totalSize := usage.TotalMemory(mem.TotalSize(), totalUsage)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "Node 0 MemTotal:       %8d kB\n", totalSize/1024)
+	fmt.Fprintf(&buf, "Node 0 MemFree:        %8d kB\n", (totalSize-totalUsage)/1024)
+	fmt.Fprintf(&buf, "Node 0 MemUsed:        %8d kB\n", totalUsage/1024)
+	return []seqfile.SeqData{{Buf: buf.Bytes(), Handle: (*nodeMeminfoData)(nil)}}, 0
+}
+
+// memoryDir implements /sys/devices/system/memory, which contains a directory
+// for each online memory block. The blocks change with the memory limit of
+// the sandbox; see kernel.Kernel.SetMemoryLimit.
+type memoryDir struct {
+	Dir
+
+	// k is the owning Kernel.
+	k *kernel.Kernel
+}
+
+// newMemoryDir creates a new memoryDir.
+func newMemoryDir(ctx context.Context, msrc *fs.MountSource, k *kernel.Kernel) *fs.Inode {
+	d := &memoryDir{k: k}
+	d.InitDir(ctx, map[string]*fs.Inode{
+		"auto_online_blocks": newFixedFile(ctx, msrc, "online\n"),
+		"block_size_bytes":   newFixedFile(ctx, msrc, fmt.Sprintf("%x\n", kernel.MemoryBlockSize)),
+	}, fs.RootOwner, fs.FilePermsFromMode(0555))
+	return fs.NewInode(d, msrc, fs.StableAttr{
+		DeviceID:  sysfsDevice.DeviceID(),
+		InodeID:   sysfsDevice.NextIno(),
+		BlockSize: usermem.PageSize,
+		Type:      fs.SpecialDirectory,
+	})
+}
+
+// memoryBlock returns the index of the memory block directory with the given
+// name, if the block is online.
+func (d *memoryDir) memoryBlock(name string) (int, bool) {
+	if !strings.HasPrefix(name, "memory") {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(strings.TrimPrefix(name, "memory"), 10, 32)
+	if err != nil || int(n) >= d.k.MemoryBlocks() {
+		return 0, false
+	}
+	return int(n), true
+}
+
+// Lookup implements fs.InodeOperations.Lookup.
+func (d *memoryDir) Lookup(ctx context.Context, dir *fs.Inode, name string) (*fs.Dirent, error) {
+	// Is it one of the static ones?
+	dirent, err := d.Dir.Lookup(ctx, dir, name)
+	if err == nil {
+		return dirent, nil
+	}
+
+	block, ok := d.memoryBlock(name)
+	if !ok {
+		return nil, syserror.ENOENT
+	}
+	return fs.NewDirent(newDir(ctx, dir.MountSource, map[string]*fs.Inode{
+		"online":     newFixedFile(ctx, dir.MountSource, "1\n"),
+		"phys_index": newFixedFile(ctx, dir.MountSource, fmt.Sprintf("%08x\n", block)),
+		"removable":  newFixedFile(ctx, dir.MountSource, "1\n"),
+		"state":      newFixedFile(ctx, dir.MountSource, "online\n"),
+	}), name), nil
+}
+
+// DeprecatedReaddir implements fs.InodeOperations.DeprecatedReaddir.
+func (d *memoryDir) DeprecatedReaddir(ctx context.Context, dirCtx *fs.DirCtx, offset int) (int, error) {
+	m := map[string]fs.DentAttr{
+		"auto_online_blocks": fs.GenericDentAttr(fs.SpecialFile, sysfsDevice),
+		"block_size_bytes":   fs.GenericDentAttr(fs.SpecialFile, sysfsDevice),
+	}
+	for i := 0; i < d.k.MemoryBlocks(); i++ {
+		m[fmt.Sprintf("memory%d", i)] = fs.GenericDentAttr(fs.SpecialDirectory, sysfsDevice)
+	}
+
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if offset >= len(names) {
+		return offset, nil
+	}
+	for _, name := range names[offset:] {
+		if err := dirCtx.DirEmit(name, m[name]); err != nil {
+			return offset, err
+		}
+		offset++
+	}
+	return offset, nil
+}
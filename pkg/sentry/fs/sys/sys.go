@@ -19,6 +19,7 @@ import (
 	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/ramfs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
 )
 
@@ -43,11 +44,11 @@ func New(ctx context.Context, msrc *fs.MountSource) *fs.Inode {
 		// Add a basic set of top-level directories. In Linux, these
 		// are dynamically added depending on the KConfig. Here we just
 		// add the most common ones.
-		"block":    newDir(ctx, msrc, nil),
+		"block":    newBlockDir(ctx, msrc),
 		"bus":      newDir(ctx, msrc, nil),
 		"class":    newDir(ctx, msrc, nil),
 		"dev":      newDir(ctx, msrc, nil),
-		"devices":  newDir(ctx, msrc, nil),
+		"devices":  newDevicesDir(ctx, msrc, kernel.KernelFromContext(ctx)),
 		"firmware": newDir(ctx, msrc, nil),
 		"fs":       newDir(ctx, msrc, nil),
 		"kernel":   newDir(ctx, msrc, nil),
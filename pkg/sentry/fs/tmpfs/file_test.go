@@ -24,6 +24,7 @@ import (
 	"gvisor.googlesource.com/gvisor/pkg/sentry/platform"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/usage"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
+	"gvisor.googlesource.com/gvisor/pkg/syserror"
 )
 
 func newFileInode(ctx context.Context) *fs.Inode {
@@ -71,3 +72,45 @@ func TestGrow(t *testing.T) {
 		t.Fatalf("Read %v, want %v", rbuf, want)
 	}
 }
+
+func TestQuota(t *testing.T) {
+	ctx := contexttest.Context(t)
+	q := newQuota(usermem.PageSize, nil)
+	m := fs.NewCachingMountSource(&Filesystem{}, fs.MountSourceFlags{})
+	uattr := fs.WithCurrentTime(ctx, fs.UnstableAttr{Owner: fs.FileOwnerFromContext(ctx)})
+	iops := newInMemoryFile(ctx, usage.Tmpfs, uattr, platform.FromContext(ctx), q)
+	inode := fs.NewInode(iops, m, fs.StableAttr{
+		DeviceID:  tmpfsDevice.DeviceID(),
+		InodeID:   tmpfsDevice.NextIno(),
+		BlockSize: usermem.PageSize,
+		Type:      fs.RegularFile,
+	})
+	f, err := inode.GetFile(ctx, fs.NewDirent(inode, "stub"), fs.FileFlags{Read: true, Write: true})
+	if err != nil {
+		t.Fatalf("GetFile failed: %v", err)
+	}
+	defer f.DecRef()
+	uid := uattr.Owner.UID
+
+	// The first page fits within the limit.
+	buf := bytes.Repeat([]byte{'a'}, usermem.PageSize)
+	if n, err := f.Pwritev(ctx, usermem.BytesIOSequence(buf), 0); n != int64(len(buf)) || err != nil {
+		t.Fatalf("Pwritev got (%d, %v) want (%d, nil)", n, err, len(buf))
+	}
+	if got := q.usageOf(uid); got != usermem.PageSize {
+		t.Errorf("usage got %d, want %d", got, usermem.PageSize)
+	}
+
+	// The second page doesn't.
+	if n, err := f.Pwritev(ctx, usermem.BytesIOSequence(buf), usermem.PageSize); n != 0 || err != syserror.EDQUOT {
+		t.Fatalf("Pwritev got (%d, %v) want (0, %v)", n, err, syserror.EDQUOT)
+	}
+
+	// Truncating the file returns its charge.
+	if err := inode.Truncate(ctx, fs.NewDirent(inode, "stub"), 0); err != nil {
+		t.Fatalf("Truncate failed: %v", err)
+	}
+	if got := q.usageOf(uid); got != 0 {
+		t.Errorf("usage got %d, want 0", got)
+	}
+}
@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"regexp"
 	"strconv"
+	"strings"
 
 	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
@@ -36,6 +37,20 @@ const (
 	// GID for the root directory.
 	rootGIDKey = "gid"
 
+	// Don't swap out file data. tmpfs file data is never swapped by the
+	// sentry, so this is accepted and ignored.
+	noswapKey = "noswap"
+
+	// Enable per-user block quotas.
+	usrQuotaKey = "usrquota"
+
+	// Default per-user block hard limit, in bytes. Requires usrquota.
+	usrQuotaLimitKey = "usrquota_block_hardlimit"
+
+	// Per-user block hard limit for a single user, in bytes, given as
+	// usrquota_block_hardlimit.<uid>=<size>. Requires usrquota.
+	usrQuotaUserLimitPrefix = usrQuotaLimitKey + "."
+
 	// TODO: support a tmpfs size limit.
 	// size = "size"
 
@@ -43,8 +58,9 @@ const (
 	defaultMode = 0777
 )
 
-// modeRegexp is the expected format of the mode option.
-var modeRegexp = regexp.MustCompile("0[0-7][0-7][0-7]")
+// modeRegexp is the expected format of the mode option. The optional leading
+// digit allows the sticky, setuid and setgid bits, e.g. mode=1777 for /tmp.
+var modeRegexp = regexp.MustCompile("^0?[0-7]?[0-7][0-7][0-7]$")
 
 // Filesystem is a tmpfs.
 type Filesystem struct{}
@@ -117,6 +133,13 @@ func (f *Filesystem) Mount(ctx context.Context, device string, flags fs.MountSou
 		delete(options, rootGIDKey)
 	}
 
+	delete(options, noswapKey)
+
+	q, err := parseQuota(creds.UserNamespace, options)
+	if err != nil {
+		return nil, err
+	}
+
 	// Fail if the caller passed us more options than we can parse. They may be
 	// expecting us to set something we can't set.
 	if len(options) > 0 {
@@ -127,5 +150,54 @@ func (f *Filesystem) Mount(ctx context.Context, device string, flags fs.MountSou
 	msrc := fs.NewCachingMountSource(f, flags)
 
 	// Construct the tmpfs root.
-	return NewDir(ctx, nil, owner, perms, msrc, platform.FromContext(ctx)), nil
+	return newDir(ctx, nil, owner, perms, msrc, platform.FromContext(ctx), q), nil
+}
+
+// parseQuota parses and removes the quota options from options. It returns a
+// nil quota if quotas are not enabled.
+func parseQuota(userns *auth.UserNamespace, options map[string]string) (*quota, error) {
+	_, enabled := options[usrQuotaKey]
+	delete(options, usrQuotaKey)
+
+	var defaultLimit uint64
+	if v, ok := options[usrQuotaLimitKey]; ok {
+		if !enabled {
+			return nil, fmt.Errorf("'%s' requires '%s'", usrQuotaLimitKey, usrQuotaKey)
+		}
+		l, err := parseSize(v)
+		if err != nil {
+			return nil, fmt.Errorf("limit not parsable '%s=%s': %v", usrQuotaLimitKey, v, err)
+		}
+		defaultLimit = l
+		delete(options, usrQuotaLimitKey)
+	}
+
+	limits := make(map[auth.KUID]uint64)
+	for k, v := range options {
+		if !strings.HasPrefix(k, usrQuotaUserLimitPrefix) {
+			continue
+		}
+		if !enabled {
+			return nil, fmt.Errorf("'%s' requires '%s'", k, usrQuotaKey)
+		}
+		uid, err := strconv.ParseUint(strings.TrimPrefix(k, usrQuotaUserLimitPrefix), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("uid not parsable '%s': %v", k, err)
+		}
+		kuid := userns.MapToKUID(auth.UID(uid))
+		if !kuid.Ok() {
+			return nil, fmt.Errorf("uid not mapped '%s'", k)
+		}
+		l, err := parseSize(v)
+		if err != nil {
+			return nil, fmt.Errorf("limit not parsable '%s=%s': %v", k, v, err)
+		}
+		limits[kuid] = l
+		delete(options, k)
+	}
+
+	if !enabled {
+		return nil, nil
+	}
+	return newQuota(defaultLimit, limits), nil
 }
@@ -21,6 +21,7 @@ import (
 	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/fsutil"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel/auth"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/memmap"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/platform"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/safemem"
@@ -79,16 +80,43 @@ type fileInodeOperations struct {
 	//
 	// data is protected by dataMu.
 	data fsutil.FileRangeSet
+
+	// quota is the per-user quota of the mount that the file belongs to. If
+	// quota is nil, the file's memory is not charged to any user.
+	//
+	// quota is immutable.
+	quota *quota
+
+	// quotaUID is the user that charged is charged to. It tracks
+	// attr.Unstable.Owner.UID, but is protected by dataMu so that it can be
+	// used without holding attrMu.
+	//
+	// quotaUID is protected by dataMu.
+	quotaUID auth.KUID
+
+	// charged is the number of bytes charged to quotaUID in quota. It is
+	// never less than the number of bytes of memory in data.
+	//
+	// charged is protected by dataMu.
+	charged uint64
 }
 
 // NewInMemoryFile returns a new file backed by p.Memory().
 func NewInMemoryFile(ctx context.Context, usage usage.MemoryKind, uattr fs.UnstableAttr, p platform.Platform) fs.InodeOperations {
+	return newInMemoryFile(ctx, usage, uattr, p, nil)
+}
+
+// newInMemoryFile returns a new file backed by p.Memory() whose memory is
+// charged against q.
+func newInMemoryFile(ctx context.Context, usage usage.MemoryKind, uattr fs.UnstableAttr, p platform.Platform, q *quota) *fileInodeOperations {
 	return &fileInodeOperations{
 		attr: fsutil.InMemoryAttributes{
 			Unstable: uattr,
 		},
 		platform: p,
 		memUsage: usage,
+		quota:    q,
+		quotaUID: uattr.Owner.UID,
 	}
 }
 
@@ -97,6 +125,7 @@ func (f *fileInodeOperations) Release(context.Context) {
 	f.dataMu.Lock()
 	defer f.dataMu.Unlock()
 	f.data.DropAll(f.platform.Memory())
+	f.syncQuota()
 }
 
 // Mappable implements fs.InodeOperations.Mappable.
@@ -171,6 +200,15 @@ func (f *fileInodeOperations) SetTimestamps(ctx context.Context, inode *fs.Inode
 func (f *fileInodeOperations) SetOwner(ctx context.Context, inode *fs.Inode, owner fs.FileOwner) error {
 	f.attrMu.Lock()
 	defer f.attrMu.Unlock()
+	if owner.UID.Ok() {
+		f.dataMu.Lock()
+		if err := f.quota.transfer(f.quotaUID, owner.UID, f.charged); err != nil {
+			f.dataMu.Unlock()
+			return err
+		}
+		f.quotaUID = owner.UID
+		f.dataMu.Unlock()
+	}
 	return f.attr.SetOwner(ctx, owner)
 }
 
@@ -211,6 +249,7 @@ func (f *fileInodeOperations) Truncate(ctx context.Context, inode *fs.Inode, siz
 	f.dataMu.Lock()
 	defer f.dataMu.Unlock()
 	f.data.Truncate(uint64(size), f.platform.Memory())
+	f.syncQuota()
 
 	return nil
 }
@@ -408,10 +447,17 @@ func (rw *fileReadWriter) WriteFromBlocks(srcs safemem.BlockSeq) (uint64, error)
 		case gap.Ok():
 			// Allocate memory for the write.
 			gapMR := gap.Range().Intersect(pgMR)
+			if err := rw.f.quota.charge(rw.f.quotaUID, gapMR.Length()); err != nil {
+				return done, err
+			}
 			fr, err := mem.Allocate(gapMR.Length(), rw.f.memUsage)
 			if err != nil {
+				rw.f.quota.uncharge(rw.f.quotaUID, gapMR.Length())
 				return done, err
 			}
+			if rw.f.quota != nil {
+				rw.f.charged += gapMR.Length()
+			}
 
 			// Write to that memory as usual.
 			seg, gap = rw.f.data.Insert(gap, gapMR, fr.Start), fsutil.FileRangeGapIterator{}
@@ -460,6 +506,21 @@ func (f *fileInodeOperations) Translate(ctx context.Context, required, optional
 		optional.End = pgend
 	}
 
+	// Charge the quota for any pages that Fill may allocate, falling back to
+	// only the required range if that would exceed the quota.
+	if f.quota != nil {
+		n := f.unallocated(optional)
+		if err := f.quota.charge(f.quotaUID, n); err != nil {
+			optional = required
+			n = f.unallocated(required)
+			if err := f.quota.charge(f.quotaUID, n); err != nil {
+				return nil, err
+			}
+		}
+		f.charged += n
+		defer f.syncQuota()
+	}
+
 	mem := f.platform.Memory()
 	cerr := f.data.Fill(ctx, required, optional, mem, f.memUsage, func(_ context.Context, dsts safemem.BlockSeq, _ uint64) (uint64, error) {
 		// Newly-allocated pages are zeroed, so we don't need to do anything.
@@ -0,0 +1,175 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmpfs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/memmap"
+	"gvisor.googlesource.com/gvisor/pkg/syserror"
+)
+
+// quota tracks the number of bytes of file data charged to each user of a
+// single tmpfs mount, and enforces per-user limits on it.
+//
+// Compare Linux's mm/shmem_quota.c. Only block hard limits are supported.
+//
+// A nil *quota is valid and imposes no limits.
+type quota struct {
+	mu sync.Mutex `state:"nosave"`
+
+	// defaultLimit is the limit in bytes for users without an entry in
+	// limits. If defaultLimit is 0, such users are unlimited.
+	//
+	// defaultLimit is immutable.
+	defaultLimit uint64
+
+	// limits maps users to their limit in bytes. A limit of 0 means that
+	// the user is unlimited.
+	//
+	// limits is immutable.
+	limits map[auth.KUID]uint64
+
+	// usage maps users to the number of bytes currently charged to them.
+	//
+	// usage is protected by mu.
+	usage map[auth.KUID]uint64
+}
+
+// newQuota returns a quota with the given default and per-user limits.
+func newQuota(defaultLimit uint64, limits map[auth.KUID]uint64) *quota {
+	return &quota{
+		defaultLimit: defaultLimit,
+		limits:       limits,
+		usage:        make(map[auth.KUID]uint64),
+	}
+}
+
+// limit returns the limit in bytes for uid, or 0 if uid is unlimited.
+func (q *quota) limit(uid auth.KUID) uint64 {
+	if l, ok := q.limits[uid]; ok {
+		return l
+	}
+	return q.defaultLimit
+}
+
+// charge charges n bytes to uid. If doing so would exceed uid's limit,
+// nothing is charged and charge returns EDQUOT.
+func (q *quota) charge(uid auth.KUID, n uint64) error {
+	if q == nil || n == 0 {
+		return nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	used := q.usage[uid]
+	if l := q.limit(uid); l != 0 && (used+n < used || used+n > l) {
+		return syserror.EDQUOT
+	}
+	q.usage[uid] = used + n
+	return nil
+}
+
+// uncharge returns n bytes previously charged to uid.
+func (q *quota) uncharge(uid auth.KUID, n uint64) {
+	if q == nil || n == 0 {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	used := q.usage[uid]
+	if n >= used {
+		delete(q.usage, uid)
+		return
+	}
+	q.usage[uid] = used - n
+}
+
+// transfer moves n bytes charged to from so that they are charged to to. If
+// doing so would exceed to's limit, nothing is transferred and transfer
+// returns EDQUOT.
+func (q *quota) transfer(from, to auth.KUID, n uint64) error {
+	if q == nil || from == to {
+		return nil
+	}
+	if err := q.charge(to, n); err != nil {
+		return err
+	}
+	q.uncharge(from, n)
+	return nil
+}
+
+// usageOf returns the number of bytes charged to uid.
+func (q *quota) usageOf(uid auth.KUID) uint64 {
+	if q == nil {
+		return 0
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.usage[uid]
+}
+
+// unallocated returns the number of bytes in mr that are not backed by
+// memory.
+//
+// Preconditions: f.dataMu must be locked.
+func (f *fileInodeOperations) unallocated(mr memmap.MappableRange) uint64 {
+	var n uint64
+	for gap := f.data.LowerBoundGap(mr.Start); gap.Ok() && gap.Start() < mr.End; gap = gap.NextGap() {
+		n += gap.Range().Intersect(mr).Length()
+	}
+	return n
+}
+
+// syncQuota adjusts the charge held by f so that it matches the amount of
+// memory that backs f.
+//
+// Preconditions: f.dataMu must be locked for writing. The charge held by f
+// must not be less than the amount of memory that backs f.
+func (f *fileInodeOperations) syncQuota() {
+	span := f.data.Span()
+	if f.charged > span {
+		f.quota.uncharge(f.quotaUID, f.charged-span)
+		f.charged = span
+	}
+}
+
+// parseSize parses a size in bytes, with an optional k, m or g suffix, as
+// accepted by Linux's lib/cmdline.c:memparse().
+func parseSize(s string) (uint64, error) {
+	shift := uint(0)
+	switch {
+	case strings.HasSuffix(s, "k"), strings.HasSuffix(s, "K"):
+		shift = 10
+	case strings.HasSuffix(s, "m"), strings.HasSuffix(s, "M"):
+		shift = 20
+	case strings.HasSuffix(s, "g"), strings.HasSuffix(s, "G"):
+		shift = 30
+	}
+	if shift != 0 {
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.ParseUint(s, 0, 64)
+	if err != nil {
+		return 0, err
+	}
+	if n<<shift>>shift != n {
+		return 0, fmt.Errorf("size %s overflows", s)
+	}
+	return n << shift, nil
+}
@@ -54,11 +54,21 @@ type Dir struct {
 
 	// platform is used to allocate storage for tmpfs Files.
 	platform platform.Platform
+
+	// quota is charged for the storage of tmpfs Files created in this Dir.
+	// It is shared by all Dirs of a mount. If quota is nil, storage is not
+	// charged to any user.
+	quota *quota
 }
 
 // NewDir returns a new directory.
 func NewDir(ctx context.Context, contents map[string]*fs.Inode, owner fs.FileOwner, perms fs.FilePermissions, msrc *fs.MountSource, platform platform.Platform) *fs.Inode {
-	d := &Dir{platform: platform}
+	return newDir(ctx, contents, owner, perms, msrc, platform, nil)
+}
+
+// newDir returns a new directory whose Files are charged against q.
+func newDir(ctx context.Context, contents map[string]*fs.Inode, owner fs.FileOwner, perms fs.FilePermissions, msrc *fs.MountSource, platform platform.Platform, q *quota) *fs.Inode {
+	d := &Dir{platform: platform, quota: q}
 	d.InitDir(ctx, contents, owner, perms)
 
 	// Manually set the CreateOps.
@@ -82,7 +92,7 @@ func (d *Dir) afterLoad() {
 func (d *Dir) newCreateOps() *ramfs.CreateOps {
 	return &ramfs.CreateOps{
 		NewDir: func(ctx context.Context, dir *fs.Inode, perms fs.FilePermissions) (*fs.Inode, error) {
-			return NewDir(ctx, nil, fs.FileOwnerFromContext(ctx), perms, dir.MountSource, d.platform), nil
+			return newDir(ctx, nil, fs.FileOwnerFromContext(ctx), perms, dir.MountSource, d.platform, d.quota), nil
 		},
 		NewFile: func(ctx context.Context, dir *fs.Inode, perms fs.FilePermissions) (*fs.Inode, error) {
 			uattr := fs.WithCurrentTime(ctx, fs.UnstableAttr{
@@ -91,7 +101,7 @@ func (d *Dir) newCreateOps() *ramfs.CreateOps {
 				// Always start unlinked.
 				Links: 0,
 			})
-			iops := NewInMemoryFile(ctx, usage.Tmpfs, uattr, d.platform)
+			iops := newInMemoryFile(ctx, usage.Tmpfs, uattr, d.platform, d.quota)
 			return fs.NewInode(iops, dir.MountSource, fs.StableAttr{
 				DeviceID:  tmpfsDevice.DeviceID(),
 				InodeID:   tmpfsDevice.NextIno(),
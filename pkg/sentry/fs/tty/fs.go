@@ -91,5 +91,10 @@ func (superOperations) ResetInodeMappings() {}
 // SaveInodeMapping implements MountSourceOperations.SaveInodeMapping.
 func (superOperations) SaveInodeMapping(*fs.Inode, string) {}
 
+// CachesAttributes implements MountSourceOperations.CachesAttributes.
+func (superOperations) CachesAttributes(*fs.Inode) bool {
+	return false
+}
+
 // Destroy implements MountSourceOperations.Destroy.
 func (superOperations) Destroy() {}
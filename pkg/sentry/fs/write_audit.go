@@ -0,0 +1,60 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs
+
+import (
+	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
+	"gvisor.googlesource.com/gvisor/pkg/syserror"
+)
+
+// WriteAuditor is notified of write attempts denied by read-only mounts with
+// MountSourceFlags.AuditWrites set.
+type WriteAuditor interface {
+	// AuditWrite reports a denied attempt to write to d.
+	AuditWrite(d *Dirent)
+}
+
+// CheckPermission checks whether the caller may access d in the requested
+// way, as Inode.CheckPermission does. In addition, writes denied by a
+// read-only mount with MountSourceFlags.AuditWrites set are reported to the
+// caller's WriteAuditor.
+func (d *Dirent) CheckPermission(ctx context.Context, p PermMask) error {
+	if p.Write {
+		if err := d.mayWrite(ctx); err != nil {
+			return err
+		}
+	}
+	return d.Inode.check(ctx, p)
+}
+
+// mayWrite returns EROFS if d is on a read-only mount, reporting the attempt
+// if the mount audits writes.
+//
+// The WriteAuditor may need to resolve d's path, so mayWrite must not be
+// called with Dirent locks held.
+//
+// Compare Linux's fs/namespace.c:mnt_want_write.
+func (d *Dirent) mayWrite(ctx context.Context) error {
+	msrc := d.Inode.readOnlyMountSource()
+	if msrc == nil {
+		return nil
+	}
+	if msrc.Flags.AuditWrites {
+		if wa := WriteAuditorFromContext(ctx); wa != nil {
+			wa.AuditWrite(d)
+		}
+	}
+	return syserror.EROFS
+}
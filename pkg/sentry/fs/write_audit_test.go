@@ -0,0 +1,110 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs_test
+
+import (
+	"reflect"
+	"testing"
+
+	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/context/contexttest"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
+	ramfstest "gvisor.googlesource.com/gvisor/pkg/sentry/fs/ramfs/test"
+	"gvisor.googlesource.com/gvisor/pkg/syserror"
+)
+
+// auditContext is a context.Context that records the paths of audited
+// writes.
+type auditContext struct {
+	context.Context
+	root  *fs.Dirent
+	paths []string
+}
+
+// Value implements context.Context.Value.
+func (c *auditContext) Value(key interface{}) interface{} {
+	if key == fs.CtxWriteAuditor {
+		return c
+	}
+	return c.Context.Value(key)
+}
+
+// AuditWrite implements fs.WriteAuditor.AuditWrite.
+func (c *auditContext) AuditWrite(d *fs.Dirent) {
+	name, _ := d.FullName(c.root)
+	c.paths = append(c.paths, name)
+}
+
+// Creates a new MountNamespace with the same filesystem as
+// createMountNamespace, but mounted read-only.
+func createReadOnlyMountNamespace(ctx context.Context, audit bool) (*fs.MountNamespace, error) {
+	perms := fs.FilePermsFromMode(0777)
+	m := fs.NewNonCachingMountSource(nil, fs.MountSourceFlags{ReadOnly: true, AuditWrites: audit})
+
+	barFile := ramfstest.NewFile(ctx, perms)
+	fooDir := ramfstest.NewDir(ctx, map[string]*fs.Inode{
+		"bar": fs.NewInode(barFile, m, fs.StableAttr{Type: fs.RegularFile}),
+	}, perms)
+	rootDir := ramfstest.NewDir(ctx, map[string]*fs.Inode{
+		"foo": fs.NewInode(fooDir, m, fs.StableAttr{Type: fs.Directory}),
+	}, perms)
+
+	return fs.NewMountNamespace(ctx, fs.NewInode(rootDir, m, fs.StableAttr{Type: fs.Directory}))
+}
+
+func TestAuditWrites(t *testing.T) {
+	for _, audit := range []bool{false, true} {
+		ctx := &auditContext{Context: contexttest.Context(t)}
+		mns, err := createReadOnlyMountNamespace(ctx, audit)
+		if err != nil {
+			t.Fatalf("createReadOnlyMountNamespace failed: %v", err)
+		}
+		root := mns.Root()
+		defer root.DecRef()
+		ctx.root = root
+
+		foo, err := root.Walk(ctx, root, "foo")
+		if err != nil {
+			t.Fatalf("Error walking to foo: %v", err)
+		}
+		defer foo.DecRef()
+		bar, err := foo.Walk(ctx, root, "bar")
+		if err != nil {
+			t.Fatalf("Error walking to bar: %v", err)
+		}
+		defer bar.DecRef()
+
+		if err := bar.CheckPermission(ctx, fs.PermMask{Read: true}); err != nil {
+			t.Errorf("bar.CheckPermission(read) got error %v, want nil", err)
+		}
+		if err := bar.CheckPermission(ctx, fs.PermMask{Write: true}); err != syserror.EROFS {
+			t.Errorf("bar.CheckPermission(write) got error %v, want %v", err, syserror.EROFS)
+		}
+		if err := fs.MayDelete(ctx, root, foo, "bar"); err != syserror.EROFS {
+			t.Errorf("MayDelete(foo, bar) got error %v, want %v", err, syserror.EROFS)
+		}
+		if err := fs.Rename(ctx, root, foo, "bar", root, "baz"); err != syserror.EROFS {
+			t.Errorf("Rename(foo/bar, baz) got error %v, want %v", err, syserror.EROFS)
+		}
+
+		var want []string
+		if audit {
+			want = []string{"/foo/bar", "/foo", "/foo"}
+		}
+		if !reflect.DeepEqual(ctx.paths, want) {
+			t.Errorf("audit %t: got audited paths %v, want %v", audit, ctx.paths, want)
+		}
+	}
+}
@@ -15,6 +15,10 @@
 // Package inet defines semantics for IP stacks.
 package inet
 
+import (
+	"time"
+)
+
 // Stack represents a TCP/IP stack.
 type Stack interface {
 	// Interfaces returns all network interfaces as a mapping from interface
@@ -51,6 +55,69 @@ type Stack interface {
 	SetTCPSACKEnabled(enabled bool) error
 }
 
+// NetlinkRouteDumper is implemented by Stacks that can serve NETLINK_ROUTE
+// dump requests that the sentry does not implement itself, by forwarding them
+// to the host.
+type NetlinkRouteDumper interface {
+	// DumpNetlinkRoute performs a NETLINK_ROUTE dump request with the given
+	// message type and payload, and returns the response messages, not
+	// including the terminating NLMSG_DONE.
+	DumpNetlinkRoute(typ uint16, data []byte) ([]NetlinkRouteMessage, error)
+}
+
+// NetlinkRouteMessage is a NETLINK_ROUTE message returned by
+// NetlinkRouteDumper.DumpNetlinkRoute.
+type NetlinkRouteMessage struct {
+	// Type is the message type, a Linux RTM_* constant.
+	Type uint16
+
+	// Flags is the message flags, a set of Linux NLM_F_* constants.
+	Flags uint16
+
+	// Data is the message payload, following the netlink message header.
+	Data []byte
+}
+
+// TrafficShaper is implemented by Stacks that can shape the outbound traffic
+// of their interfaces.
+type TrafficShaper interface {
+	// QueueingDiscipline returns the queueing discipline of the interface
+	// with the given index. ok is false if the interface doesn't exist or
+	// can't be shaped.
+	QueueingDiscipline(idx int32) (q QueueingDiscipline, ok bool)
+
+	// SetQueueingDiscipline replaces the queueing discipline of the
+	// interface with the given index.
+	SetQueueingDiscipline(idx int32, q QueueingDiscipline) error
+}
+
+// QueueingDiscipline describes how the outbound traffic of an interface is
+// shaped. Packets are sent at a limited rate, and queued in flow queues that
+// are served in turn. The zero value disables shaping.
+type QueueingDiscipline struct {
+	// Rate is the maximum rate, in bytes per second. If it is zero,
+	// shaping is disabled and the other fields are ignored.
+	Rate uint64
+
+	// Burst is the number of bytes that can be sent at once.
+	Burst uint32
+
+	// Limit is the maximum number of queued packets.
+	Limit uint32
+
+	// Flows is the number of flow queues. If it is zero or one, packets
+	// are sent in order.
+	Flows uint32
+
+	// Quantum is the number of bytes that each flow queue may send in
+	// turn.
+	Quantum uint32
+
+	// Target is the queueing delay above which packets are dropped. If it
+	// is zero, packets are only dropped when the queue is full.
+	Target time.Duration
+}
+
 // Interface contains information about a network interface.
 type Interface struct {
 	// Keep these fields sorted in the order they appear in rtnetlink(7).
@@ -19,7 +19,9 @@ import (
 	"syscall"
 
 	"gvisor.googlesource.com/gvisor/pkg/refs"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
 	"gvisor.googlesource.com/gvisor/pkg/tcpip/transport/unix"
+	"gvisor.googlesource.com/gvisor/pkg/waiter"
 )
 
 type abstractEndpoint struct {
@@ -38,12 +40,25 @@ func (e *abstractEndpoint) WeakRefGone() {
 	e.ns.mu.Unlock()
 }
 
+// AbstractSocketBridge provides endpoints for abstract sockets that are bound
+// outside of the sandbox.
+type AbstractSocketBridge interface {
+	// BoundEndpoint returns the endpoint bound to the given name outside of
+	// the sandbox. The return value is nil if the name isn't bridged.
+	BoundEndpoint(name string) unix.BoundEndpoint
+}
+
 // AbstractSocketNamespace is used to implement the Linux abstract socket functionality.
 type AbstractSocketNamespace struct {
 	mu sync.Mutex `state:"nosave"`
 
 	// Keeps mapping from name to endpoint.
 	endpoints map[string]abstractEndpoint
+
+	// bridge provides the endpoints of names that aren't bound in the
+	// namespace, if not nil. It is not saved, and must be set again after
+	// restore.
+	bridge AbstractSocketBridge `state:"nosave"`
 }
 
 // NewAbstractSocketNamespace returns a new AbstractSocketNamespace.
@@ -66,26 +81,55 @@ func (e *boundEndpoint) Release() {
 	e.BoundEndpoint.Release()
 }
 
-// BoundEndpoint retrieves the endpoint bound to the given name. The return
-// value is nil if no endpoint was bound.
+// AcceptExternal implements unix.ExternalAcceptor.AcceptExternal.
+func (e *boundEndpoint) AcceptExternal(stype unix.SockType, connect func(*waiter.Queue) (unix.Receiver, unix.ConnectedEndpoint, *tcpip.Error)) *tcpip.Error {
+	ea, ok := e.BoundEndpoint.(unix.ExternalAcceptor)
+	if !ok {
+		return tcpip.ErrConnectionRefused
+	}
+	return ea.AcceptExternal(stype, connect)
+}
+
+// SetBridge sets the bridge that provides the endpoints of names that aren't
+// bound in the namespace.
+func (a *AbstractSocketNamespace) SetBridge(b AbstractSocketBridge) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.bridge = b
+}
+
+// BoundEndpoint retrieves the endpoint bound to the given name. Names that
+// aren't bound in the namespace are looked up in the bridge, if any. The
+// return value is nil if no endpoint was bound.
 func (a *AbstractSocketNamespace) BoundEndpoint(name string) unix.BoundEndpoint {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
 	ep, ok := a.endpoints[name]
 	if !ok {
-		return nil
+		return a.bridgedEndpointLocked(name)
 	}
 
 	rc := ep.wr.Get()
 	if rc == nil {
 		delete(a.endpoints, name)
-		return nil
+		return a.bridgedEndpointLocked(name)
 	}
 
 	return &boundEndpoint{ep.ep, rc}
 }
 
+// bridgedEndpointLocked returns the endpoint that the bridge provides for the
+// given name, or nil if there is none.
+//
+// Preconditions: a.mu must be locked.
+func (a *AbstractSocketNamespace) bridgedEndpointLocked(name string) unix.BoundEndpoint {
+	if a.bridge == nil {
+		return nil
+	}
+	return a.bridge.BoundEndpoint(name)
+}
+
 // Bind binds the given socket.
 //
 // When the last reference managed by rc is dropped, ep may be removed from the
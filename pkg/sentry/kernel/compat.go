@@ -0,0 +1,154 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"sort"
+	"sync"
+
+	"gvisor.googlesource.com/gvisor/pkg/sentry/arch"
+)
+
+// maxCompatRecords is the maximum number of distinct syscalls and ioctls that
+// a CompatTracker records. Further unsupported operations are counted, but
+// not recorded.
+const maxCompatRecords = 1024
+
+// CompatRecord describes an unsupported syscall or ioctl invoked by the
+// application.
+type CompatRecord struct {
+	// Sysno is the syscall number. Sysno is only meaningful for syscalls.
+	Sysno uintptr
+
+	// Request is the ioctl request number. Request is only meaningful for
+	// ioctls.
+	Request uint32
+
+	// File describes the type of file that the ioctl was invoked on. File
+	// is only meaningful for ioctls.
+	File string
+
+	// Count is the number of times that the operation was invoked.
+	Count uint64
+
+	// Args are the syscall arguments of the first invocation.
+	Args arch.SyscallArguments
+}
+
+// compatIoctlKey identifies an unsupported ioctl.
+type compatIoctlKey struct {
+	request uint32
+	file    string
+}
+
+// CompatTracker records the unimplemented and partially implemented syscalls
+// and ioctls invoked by the application, so that compatibility gaps can be
+// reported. The zero value of CompatTracker is ready to use.
+type CompatTracker struct {
+	// mu protects the fields below. mu is a leaf lock.
+	mu sync.Mutex
+
+	// syscalls maps syscall numbers to records.
+	syscalls map[uintptr]*CompatRecord
+
+	// ioctls maps ioctls to records.
+	ioctls map[compatIoctlKey]*CompatRecord
+
+	// dropped is the number of invocations that were not recorded because
+	// the tracker was full.
+	dropped uint64
+}
+
+// full returns true if no more records may be added.
+//
+// Preconditions: ct.mu must be locked.
+func (ct *CompatTracker) full() bool {
+	return len(ct.syscalls)+len(ct.ioctls) >= maxCompatRecords
+}
+
+// RecordSyscall records an invocation of the unsupported syscall sysno.
+func (ct *CompatTracker) RecordSyscall(sysno uintptr, args arch.SyscallArguments) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	if r, ok := ct.syscalls[sysno]; ok {
+		r.Count++
+		return
+	}
+	if ct.full() {
+		ct.dropped++
+		return
+	}
+	if ct.syscalls == nil {
+		ct.syscalls = make(map[uintptr]*CompatRecord)
+	}
+	ct.syscalls[sysno] = &CompatRecord{Sysno: sysno, Count: 1, Args: args}
+}
+
+// RecordIoctl records an invocation of the unsupported ioctl request on a
+// file described by file.
+func (ct *CompatTracker) RecordIoctl(request uint32, file string, args arch.SyscallArguments) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	key := compatIoctlKey{request, file}
+	if r, ok := ct.ioctls[key]; ok {
+		r.Count++
+		return
+	}
+	if ct.full() {
+		ct.dropped++
+		return
+	}
+	if ct.ioctls == nil {
+		ct.ioctls = make(map[compatIoctlKey]*CompatRecord)
+	}
+	ct.ioctls[key] = &CompatRecord{Request: request, File: file, Count: 1, Args: args}
+}
+
+// Syscalls returns the recorded syscalls, sorted by syscall number.
+func (ct *CompatTracker) Syscalls() []CompatRecord {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	rs := make([]CompatRecord, 0, len(ct.syscalls))
+	for _, r := range ct.syscalls {
+		rs = append(rs, *r)
+	}
+	sort.Slice(rs, func(i, j int) bool { return rs[i].Sysno < rs[j].Sysno })
+	return rs
+}
+
+// Ioctls returns the recorded ioctls, sorted by request number and file.
+func (ct *CompatTracker) Ioctls() []CompatRecord {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	rs := make([]CompatRecord, 0, len(ct.ioctls))
+	for _, r := range ct.ioctls {
+		rs = append(rs, *r)
+	}
+	sort.Slice(rs, func(i, j int) bool {
+		if rs[i].Request != rs[j].Request {
+			return rs[i].Request < rs[j].Request
+		}
+		return rs[i].File < rs[j].File
+	})
+	return rs
+}
+
+// Dropped returns the number of unsupported operations that were not
+// recorded because the tracker was full.
+func (ct *CompatTracker) Dropped() uint64 {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	return ct.dropped
+}
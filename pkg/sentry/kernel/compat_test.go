@@ -0,0 +1,58 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"testing"
+
+	"gvisor.googlesource.com/gvisor/pkg/sentry/arch"
+)
+
+func TestCompatTracker(t *testing.T) {
+	var ct CompatTracker
+	first := arch.SyscallArguments{{Value: 1}}
+	ct.RecordSyscall(10, first)
+	ct.RecordSyscall(5, arch.SyscallArguments{})
+	ct.RecordSyscall(10, arch.SyscallArguments{{Value: 2}})
+	ct.RecordIoctl(0x5401, "*b", arch.SyscallArguments{})
+	ct.RecordIoctl(0x5401, "*a", arch.SyscallArguments{})
+	ct.RecordIoctl(0x5401, "*a", arch.SyscallArguments{})
+
+	sys := ct.Syscalls()
+	if len(sys) != 2 || sys[0].Sysno != 5 || sys[1].Sysno != 10 {
+		t.Fatalf("Syscalls() = %+v, want syscalls 5 and 10", sys)
+	}
+	if sys[1].Count != 2 || sys[1].Args != first {
+		t.Errorf("syscall 10 record = %+v, want count 2 and args of first call", sys[1])
+	}
+
+	ioctls := ct.Ioctls()
+	if len(ioctls) != 2 || ioctls[0].File != "*a" || ioctls[0].Count != 2 || ioctls[1].File != "*b" {
+		t.Errorf("Ioctls() = %+v, want 2 calls on *a and 1 on *b", ioctls)
+	}
+
+	// Once full, new operations are dropped, but existing records are
+	// still counted.
+	for i := uintptr(0); i < maxCompatRecords; i++ {
+		ct.RecordSyscall(1000+i, arch.SyscallArguments{})
+	}
+	if got, want := ct.Dropped(), uint64(4); got != want {
+		t.Errorf("Dropped() = %d, want %d", got, want)
+	}
+	ct.RecordSyscall(5, arch.SyscallArguments{})
+	if got := ct.Syscalls()[0]; got.Sysno != 5 || got.Count != 2 {
+		t.Errorf("syscall 5 record = %+v, want count 2", got)
+	}
+}
@@ -0,0 +1,563 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+// Core dumps.
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"strconv"
+	"strings"
+
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/arch"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/limits"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/mm"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
+	"gvisor.googlesource.com/gvisor/pkg/syserror"
+)
+
+const (
+	// coreNoteName is the name of the notes of core dumps.
+	coreNoteName = "CORE"
+
+	// coreChunkSize is the size of the chunks in which memory is copied to
+	// core dumps.
+	coreChunkSize = 1 << 20
+)
+
+// CorePattern returns the pattern of the names of core dumps.
+func (k *Kernel) CorePattern() string {
+	k.corePatternMu.Lock()
+	defer k.corePatternMu.Unlock()
+	return k.corePattern
+}
+
+// SetCorePattern sets the pattern of the names of core dumps, as in Linux's
+// /proc/sys/kernel/core_pattern. The % specifiers of the pattern are replaced
+// as in Linux, and a name that isn't absolute is relative to the working
+// directory of the dumping process. If pattern is empty, no core dumps are
+// written.
+func (k *Kernel) SetCorePattern(pattern string) {
+	k.corePatternMu.Lock()
+	defer k.corePatternMu.Unlock()
+	k.corePattern = pattern
+}
+
+// dumpCore writes an ELF core dump of t's thread group, which is being killed
+// by the signal info, if the core pattern, RLIMIT_CORE and the dumpability of
+// t's MemoryManager allow it. It returns true if a core dump was written.
+//
+// The other tasks of the thread group are stopped while the core dump is
+// written, as in Linux's fs/coredump.c:coredump_wait(), and are only resumed
+// once the group exit has been initiated.
+func (t *Task) dumpCore(info *arch.SignalInfo) bool {
+	t.tg.signalHandlers.mu.Lock()
+	exiting := t.tg.exiting || t.tg.execing != nil
+	t.tg.signalHandlers.mu.Unlock()
+	if exiting {
+		return false
+	}
+
+	// Linux: fs/binfmt_elf.c:elf_format.min_coredump.
+	limit := t.tg.Limits().Get(limits.Core).Cur
+	if limit < usermem.PageSize {
+		return false
+	}
+	pattern := t.k.CorePattern()
+	if pattern == "" {
+		return false
+	}
+	if strings.HasPrefix(pattern, "|") {
+		t.Warningf("Not dumping core: core pattern %q pipes to a program, which isn't supported", pattern)
+		return false
+	}
+	tmm := t.MemoryManager()
+	if tmm == nil {
+		return false
+	}
+	// RootDumpable would require the core dump to be owned by root, which
+	// isn't supported.
+	if tmm.Dumpability() != mm.UserDumpable {
+		return false
+	}
+
+	others, ok := t.stopCoreDumpSiblings()
+	if !ok {
+		return false
+	}
+	name := expandCorePattern(pattern, t.corePatternValues(int(info.Signo), limit))
+	dumped := true
+	if err := t.writeCore(name, info, limit, others); err != nil {
+		t.Warningf("Failed to dump core to %q: %v", name, err)
+		dumped = false
+	} else {
+		t.Infof("Dumped core to %q", name)
+	}
+
+	// Initiate the group exit before resuming the other tasks, so that they
+	// don't run application code again. The caller's PrepareGroupExit is then
+	// a no-op.
+	t.PrepareGroupExit(ExitStatus{Signo: int(info.Signo), CoreDumped: dumped})
+	t.resumeCoreDumpSiblings(others)
+	return dumped
+}
+
+// stopCoreDumpSiblings stops the other live tasks of t's thread group for a
+// core dump by t, and waits for their task goroutines to stop. It returns the
+// stopped tasks.
+//
+// stopCoreDumpSiblings returns false if no core dump should be written
+// because the thread group is already exiting or another task is dumping
+// core. In the latter case, it blocks until the other task has finished.
+//
+// Preconditions: The caller must be running on the task goroutine.
+func (t *Task) stopCoreDumpSiblings() ([]*Task, bool) {
+	t.tg.pidns.owner.mu.RLock()
+	t.tg.signalHandlers.mu.Lock()
+	if t.tg.exiting || t.tg.execing != nil || t.tg.dumpingCore {
+		dumping := t.tg.dumpingCore
+		t.tg.signalHandlers.mu.Unlock()
+		t.tg.pidns.owner.mu.RUnlock()
+		if dumping {
+			// The dumping task has stopped t. Enter the stop
+			// until it has initiated the group exit.
+			t.doStop()
+		}
+		return nil, false
+	}
+	t.tg.dumpingCore = true
+	var others []*Task
+	for sibling := t.tg.tasks.Front(); sibling != nil; sibling = sibling.Next() {
+		if sibling != t && sibling.exitState == TaskExitNone {
+			sibling.beginStopLocked()
+			sibling.interrupt()
+			others = append(others, sibling)
+		}
+	}
+	t.tg.signalHandlers.mu.Unlock()
+	t.tg.pidns.owner.mu.RUnlock()
+
+	for _, sibling := range others {
+		sibling.waitGoroutineStoppedOrExited()
+	}
+	return others, true
+}
+
+// resumeCoreDumpSiblings ends the stops begun by stopCoreDumpSiblings.
+func (t *Task) resumeCoreDumpSiblings(others []*Task) {
+	t.tg.pidns.owner.mu.RLock()
+	defer t.tg.pidns.owner.mu.RUnlock()
+	t.tg.signalHandlers.mu.Lock()
+	defer t.tg.signalHandlers.mu.Unlock()
+	t.tg.dumpingCore = false
+	for _, sibling := range others {
+		sibling.endStopLocked()
+	}
+}
+
+// corePatternValues returns the values of the % specifiers of core patterns
+// for a core dump of t caused by signal sig.
+func (t *Task) corePatternValues(sig int, limit uint64) map[byte]string {
+	creds := t.Credentials()
+	// Linux: fs/coredump.c:cn_esc_printf().
+	escape := func(s string) string {
+		return strings.Replace(s, "/", "!", -1)
+	}
+	return map[byte]string{
+		'p': strconv.Itoa(int(t.tg.pidns.IDOfThreadGroup(t.tg))),
+		'P': strconv.Itoa(int(t.k.tasks.Root.IDOfThreadGroup(t.tg))),
+		'i': strconv.Itoa(int(t.tg.pidns.IDOfTask(t))),
+		'I': strconv.Itoa(int(t.k.tasks.Root.IDOfTask(t))),
+		'u': strconv.FormatUint(uint64(creds.RealKUID), 10),
+		'g': strconv.FormatUint(uint64(creds.RealKGID), 10),
+		's': strconv.Itoa(sig),
+		't': strconv.FormatInt(t.k.RealtimeClock().Now().Seconds(), 10),
+		'h': escape(t.UTSNamespace().HostName()),
+		'e': escape(t.Name()),
+		'c': strconv.FormatUint(limit, 10),
+	}
+}
+
+// expandCorePattern returns the name of a core dump, which is pattern with
+// each % specifier replaced by its value in vals, as in Linux's
+// fs/coredump.c:format_corename(). "%%" is a literal '%', and unknown
+// specifiers are dropped.
+func expandCorePattern(pattern string, vals map[byte]string) string {
+	var b bytes.Buffer
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] != '%' {
+			b.WriteByte(pattern[i])
+			continue
+		}
+		i++
+		if i == len(pattern) {
+			break
+		}
+		if pattern[i] == '%' {
+			b.WriteByte('%')
+			continue
+		}
+		b.WriteString(vals[pattern[i]])
+	}
+	return b.String()
+}
+
+// writeCore writes an ELF core dump of t's thread group to the file name,
+// truncated to limit bytes. others are the other tasks of the thread group,
+// which must be stopped.
+func (t *Task) writeCore(name string, info *arch.SignalInfo, limit uint64, others []*Task) error {
+	f, err := t.createCoreFile(name)
+	if err != nil {
+		return err
+	}
+	defer f.DecRef()
+
+	notes, err := t.coreNotes(info, others)
+	if err != nil {
+		return err
+	}
+	tmm := t.MemoryManager()
+	maps := tmm.CoreMappings()
+	layout := newCoreLayout(maps, notes)
+
+	// write writes b at off, up to limit.
+	write := func(b []byte, off uint64) error {
+		if off >= limit {
+			return nil
+		}
+		if uint64(len(b)) > limit-off {
+			b = b[:limit-off]
+		}
+		_, err := f.Pwritev(t, usermem.BytesIOSequence(b), int64(off))
+		return err
+	}
+	if err := write(layout.headers, 0); err != nil {
+		return err
+	}
+	buf := make([]byte, coreChunkSize)
+	for i, m := range maps {
+		for _, ar := range m.Populated {
+			for addr := ar.Start; addr < ar.End; {
+				n := uint64(ar.End - addr)
+				if n > coreChunkSize {
+					n = coreChunkSize
+				}
+				off := layout.offsets[i] + uint64(addr-m.Range.Start)
+				if off >= limit {
+					break
+				}
+				// Pages that can't be read, such as pages of file
+				// mappings past the end of the file, are left as
+				// holes.
+				cn, cerr := tmm.CopyIn(t, addr, buf[:n], usermem.IOOpts{IgnorePermissions: true})
+				if err := write(buf[:cn], off); err != nil {
+					return err
+				}
+				addr += usermem.Addr(cn)
+				if cerr != nil {
+					addr += usermem.PageSize
+					addr = addr.RoundDown()
+				}
+			}
+		}
+	}
+
+	// Extend the file over the trailing holes.
+	size := layout.size
+	if size > limit {
+		size = limit
+	}
+	return f.Dirent.Inode.Truncate(t, f.Dirent, int64(size))
+}
+
+// createCoreFile creates the core dump file name for writing, relative to t's
+// working directory. As in Linux, an existing file is truncated and reused
+// only if checkCoreFile allows it.
+func (t *Task) createCoreFile(name string) (*fs.File, error) {
+	root := t.FSContext().RootDirectory()
+	defer root.DecRef()
+	wd := t.FSContext().WorkingDirectory()
+	defer wd.DecRef()
+
+	dirPath, fileName := fs.SplitLast(name)
+	mns := t.MountNamespace()
+	dir, err := mns.FindInode(t, root, wd, dirPath, linux.MaxSymlinkTraversals)
+	if err != nil {
+		return nil, err
+	}
+	defer dir.DecRef()
+	if !fs.IsDir(dir.Inode.StableAttr) {
+		return nil, syserror.ENOTDIR
+	}
+
+	flags := fs.FileFlags{Write: true}
+	d, err := mns.FindLink(t, root, dir, fileName, 0 /* maxTraversals */)
+	if err != nil {
+		if err := dir.CheckPermission(t, fs.PermMask{Write: true, Execute: true}); err != nil {
+			return nil, err
+		}
+		perms := fs.FilePermsFromMode(0600 &^ linux.FileMode(t.FSContext().Umask()))
+		return dir.Create(t, root, fileName, flags, perms)
+	}
+	defer d.DecRef()
+
+	uattr, err := d.Inode.UnstableAttr(t)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkCoreFile(d.Inode.StableAttr, uattr, t.Credentials().EffectiveKUID); err != nil {
+		return nil, err
+	}
+	if err := d.CheckPermission(t, fs.PermMask{Write: true}); err != nil {
+		return nil, err
+	}
+	if err := d.Inode.Truncate(t, d, 0); err != nil {
+		return nil, err
+	}
+	return d.Inode.GetFile(t, d, flags)
+}
+
+// checkCoreFile returns an error if an existing file, with the given
+// attributes, may not be reused for a core dump written with filesystem UID
+// fsuid. As in Linux's fs/coredump.c:do_coredump(), symlinks and special files
+// aren't written to, and neither are files that are owned by another user or
+// have other hard links, which could otherwise be used to overwrite them.
+func checkCoreFile(sattr fs.StableAttr, uattr fs.UnstableAttr, fsuid auth.KUID) error {
+	if !fs.IsRegular(sattr) {
+		return syserror.EEXIST
+	}
+	if uattr.Links != 1 {
+		return syserror.EPERM
+	}
+	if uattr.Owner.UID != fsuid {
+		return syserror.EPERM
+	}
+	return nil
+}
+
+// coreNotes returns the notes of a core dump of t, which is being killed by
+// the signal info. others are the other tasks of t's thread group, which must
+// be stopped.
+func (t *Task) coreNotes(info *arch.SignalInfo, others []*Task) ([]byte, error) {
+	status, fpregs, err := t.coreThreadState(t, info)
+	if err != nil {
+		return nil, err
+	}
+
+	creds := t.Credentials()
+	psinfo := linux.ElfPrpsinfo{
+		Sname: 'R',
+		Nice:  int8(t.Niceness()),
+		UID:   uint32(creds.RealKUID.In(creds.UserNamespace).OrOverflow()),
+		GID:   uint32(creds.RealKGID.In(creds.UserNamespace).OrOverflow()),
+		Pid:   int32(t.tg.pidns.IDOfThreadGroup(t.tg)),
+		Ppid:  status.Ppid,
+		Pgrp:  status.Pgrp,
+		Sid:   status.Sid,
+	}
+	copy(psinfo.Fname[:len(psinfo.Fname)-1], t.Name())
+	tmm := t.MemoryManager()
+	// Linux: fs/binfmt_elf.c:fill_psinfo().
+	args := psinfo.Psargs[:len(psinfo.Psargs)-1]
+	if n := int(tmm.ArgvEnd() - tmm.ArgvStart()); n < len(args) {
+		args = args[:n]
+	}
+	n, _ := tmm.CopyIn(t, tmm.ArgvStart(), args, usermem.IOOpts{IgnorePermissions: true})
+	for i := range args[:n] {
+		if args[i] == 0 {
+			args[i] = ' '
+		}
+	}
+
+	var auxv bytes.Buffer
+	for _, e := range tmm.Auxv() {
+		binary.Write(&auxv, usermem.ByteOrder, [2]uint64{e.Key, uint64(e.Value)})
+	}
+	binary.Write(&auxv, usermem.ByteOrder, [2]uint64{linux.AT_NULL, 0})
+
+	var notes bytes.Buffer
+	appendCoreNote(&notes, linux.NT_PRSTATUS, &status)
+	appendCoreNote(&notes, linux.NT_PRPSINFO, &psinfo)
+	appendCoreNote(&notes, linux.NT_AUXV, auxv.Bytes())
+	appendCoreNote(&notes, linux.NT_PRFPREG, fpregs)
+	// As in Linux's fs/binfmt_elf.c:fill_note_info(), the notes of the
+	// dumping task are followed by the per-thread notes of the other tasks.
+	for _, other := range others {
+		status, fpregs, err := t.coreThreadState(other, info)
+		if err != nil {
+			return nil, err
+		}
+		appendCoreNote(&notes, linux.NT_PRSTATUS, &status)
+		appendCoreNote(&notes, linux.NT_PRFPREG, fpregs)
+	}
+	return notes.Bytes(), nil
+}
+
+// coreThreadState returns the descriptors of the NT_PRSTATUS and NT_PRFPREG
+// notes of target, which is t or a stopped task in t's thread group, for a
+// core dump caused by the signal info.
+func (t *Task) coreThreadState(target *Task, info *arch.SignalInfo) (linux.ElfPrstatus, []byte, error) {
+	var regs, fpregs bytes.Buffer
+	if _, err := target.Arch().PtraceGetRegs(&regs); err != nil {
+		return linux.ElfPrstatus{}, nil, err
+	}
+	if _, err := target.Arch().PtraceGetFPRegs(&fpregs); err != nil {
+		return linux.ElfPrstatus{}, nil, err
+	}
+
+	pidns := t.tg.pidns
+	var ppid ThreadID
+	if parent := target.Parent(); parent != nil {
+		ppid = pidns.IDOfThreadGroup(parent.tg)
+	}
+	pgid := pidns.IDOfProcessGroup(t.tg.ProcessGroup())
+	sid := pidns.IDOfSession(t.tg.Session())
+	// Linux: fs/binfmt_elf.c:fill_prstatus() reports the CPU time of the
+	// whole thread group for its leader.
+	cpu := target.CPUStats()
+	if target == t.tg.Leader() {
+		cpu = t.tg.CPUStats()
+	}
+	childCPU := t.tg.JoinedChildCPUStats()
+
+	status := linux.ElfPrstatus{
+		Info: linux.ElfSiginfo{
+			Signo: info.Signo,
+			Code:  info.Code,
+			Errno: info.Errno,
+		},
+		Cursig:  int16(info.Signo),
+		Sighold: uint64(target.SignalMask()),
+		Pid:     int32(pidns.IDOfTask(target)),
+		Ppid:    int32(ppid),
+		Pgrp:    int32(pgid),
+		Sid:     int32(sid),
+		Utime:   linux.DurationToTimeval(cpu.UserTime),
+		Stime:   linux.DurationToTimeval(cpu.SysTime),
+		Cutime:  linux.DurationToTimeval(childCPU.UserTime),
+		Cstime:  linux.DurationToTimeval(childCPU.SysTime),
+		Fpvalid: 1,
+	}
+	if err := binary.Read(&regs, usermem.ByteOrder, &status.Regs); err != nil {
+		return linux.ElfPrstatus{}, nil, err
+	}
+	return status, fpregs.Bytes(), nil
+}
+
+// appendCoreNote appends an ELF note of type typ, whose descriptor is the
+// binary encoding of desc, to b.
+func appendCoreNote(b *bytes.Buffer, typ uint32, desc interface{}) {
+	var d bytes.Buffer
+	binary.Write(&d, usermem.ByteOrder, desc)
+	namesz := len(coreNoteName) + 1
+	binary.Write(b, usermem.ByteOrder, [3]uint32{uint32(namesz), uint32(d.Len()), typ})
+	b.WriteString(coreNoteName)
+	b.Write(make([]byte, 1+notePadding(namesz)))
+	b.Write(d.Bytes())
+	b.Write(make([]byte, notePadding(d.Len())))
+}
+
+// notePadding returns the number of bytes that align a field of n bytes in an
+// ELF note to 4 bytes.
+func notePadding(n int) int {
+	return -n & 3
+}
+
+// coreLayout is the layout of an ELF core dump file.
+type coreLayout struct {
+	// headers are the ELF header, the program headers and the notes, which
+	// are at the start of the file.
+	headers []byte
+
+	// offsets are the file offsets of the contents of each mapping.
+	offsets []uint64
+
+	// size is the size of the file.
+	size uint64
+}
+
+// newCoreLayout returns the layout of a core dump of maps, with the given
+// notes. As in Linux, the notes are described by the first program header,
+// followed by a PT_LOAD program header for each mapping, and the contents of
+// the mappings start at a page boundary.
+func newCoreLayout(maps []mm.CoreMapping, notes []byte) coreLayout {
+	const (
+		ehdrSize = 64
+		phdrSize = 56
+	)
+	phnum := 1 + len(maps)
+	notesOff := uint64(ehdrSize + phnum*phdrSize)
+	off := notesOff + uint64(len(notes))
+	off = uint64(usermem.Addr(off).MustRoundUp())
+
+	var b bytes.Buffer
+	binary.Write(&b, usermem.ByteOrder, elf.Header64{
+		Ident: [elf.EI_NIDENT]byte{
+			'\x7f', 'E', 'L', 'F',
+			byte(elf.ELFCLASS64), byte(elf.ELFDATA2LSB), byte(elf.EV_CURRENT), byte(elf.ELFOSABI_NONE),
+		},
+		Type:      uint16(elf.ET_CORE),
+		Machine:   uint16(elf.EM_X86_64),
+		Version:   uint32(elf.EV_CURRENT),
+		Phoff:     ehdrSize,
+		Ehsize:    ehdrSize,
+		Phentsize: phdrSize,
+		Phnum:     uint16(phnum),
+	})
+	binary.Write(&b, usermem.ByteOrder, elf.Prog64{
+		Type:   uint32(elf.PT_NOTE),
+		Off:    notesOff,
+		Filesz: uint64(len(notes)),
+	})
+	offsets := make([]uint64, 0, len(maps))
+	for _, m := range maps {
+		var flags elf.ProgFlag
+		if m.Perms.Read {
+			flags |= elf.PF_R
+		}
+		if m.Perms.Write {
+			flags |= elf.PF_W
+		}
+		if m.Perms.Execute {
+			flags |= elf.PF_X
+		}
+		var filesz uint64
+		if m.Dump {
+			filesz = uint64(m.Range.Length())
+		}
+		binary.Write(&b, usermem.ByteOrder, elf.Prog64{
+			Type:   uint32(elf.PT_LOAD),
+			Flags:  uint32(flags),
+			Off:    off,
+			Vaddr:  uint64(m.Range.Start),
+			Filesz: filesz,
+			Memsz:  uint64(m.Range.Length()),
+			Align:  usermem.PageSize,
+		})
+		offsets = append(offsets, off)
+		off += filesz
+	}
+	b.Write(notes)
+	return coreLayout{
+		headers: b.Bytes(),
+		offsets: offsets,
+		size:    off,
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"testing"
+
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/mm"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
+	"gvisor.googlesource.com/gvisor/pkg/syserror"
+)
+
+func TestExpandCorePattern(t *testing.T) {
+	vals := map[byte]string{
+		'p': "12",
+		'e': "a!b",
+		's': "11",
+	}
+	for _, test := range []struct {
+		pattern string
+		want    string
+	}{
+		{"core", "core"},
+		{"core.%p", "core.12"},
+		{"/cores/%e-%p-%s", "/cores/a!b-12-11"},
+		{"100%%", "100%"},
+		{"core.%x", "core."},
+		{"core%", "core"},
+	} {
+		if got := expandCorePattern(test.pattern, vals); got != test.want {
+			t.Errorf("expandCorePattern(%q) = %q, want %q", test.pattern, got, test.want)
+		}
+	}
+}
+
+func TestCheckCoreFile(t *testing.T) {
+	const fsuid = auth.KUID(1000)
+	regular := fs.StableAttr{Type: fs.RegularFile}
+	for _, test := range []struct {
+		name  string
+		sattr fs.StableAttr
+		uattr fs.UnstableAttr
+		want  error
+	}{
+		{
+			name:  "owned regular file",
+			sattr: regular,
+			uattr: fs.UnstableAttr{Links: 1, Owner: fs.FileOwner{UID: fsuid}},
+		},
+		{
+			name:  "symlink",
+			sattr: fs.StableAttr{Type: fs.Symlink},
+			uattr: fs.UnstableAttr{Links: 1, Owner: fs.FileOwner{UID: fsuid}},
+			want:  syserror.EEXIST,
+		},
+		{
+			name:  "hard linked",
+			sattr: regular,
+			uattr: fs.UnstableAttr{Links: 2, Owner: fs.FileOwner{UID: fsuid}},
+			want:  syserror.EPERM,
+		},
+		{
+			name:  "other owner",
+			sattr: regular,
+			uattr: fs.UnstableAttr{Links: 1, Owner: fs.FileOwner{UID: 0}},
+			want:  syserror.EPERM,
+		},
+	} {
+		if got := checkCoreFile(test.sattr, test.uattr, fsuid); got != test.want {
+			t.Errorf("%s: checkCoreFile() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestCoreLayout(t *testing.T) {
+	maps := []mm.CoreMapping{
+		{
+			Range: usermem.AddrRange{Start: 0x400000, End: 0x402000},
+			Perms: usermem.ReadWrite,
+			Dump:  true,
+		},
+		{
+			Range: usermem.AddrRange{Start: 0x600000, End: 0x601000},
+			Perms: usermem.AccessType{Read: true, Execute: true},
+		},
+	}
+	var notes bytes.Buffer
+	appendCoreNote(&notes, linux.NT_AUXV, [2]uint64{linux.AT_NULL, 0})
+	appendCoreNote(&notes, linux.NT_PRFPREG, []byte{1, 2, 3})
+	if notes.Len()%4 != 0 {
+		t.Errorf("Notes of %d bytes aren't aligned", notes.Len())
+	}
+
+	layout := newCoreLayout(maps, notes.Bytes())
+	core := make([]byte, layout.size)
+	copy(core, layout.headers)
+	f, err := elf.NewFile(bytes.NewReader(core))
+	if err != nil {
+		t.Fatalf("elf.NewFile failed: %v", err)
+	}
+	if f.Type != elf.ET_CORE || f.Machine != elf.EM_X86_64 {
+		t.Errorf("Got type %v, machine %v, want %v, %v", f.Type, f.Machine, elf.ET_CORE, elf.EM_X86_64)
+	}
+	if len(f.Progs) != 3 {
+		t.Fatalf("Got %d program headers, want 3", len(f.Progs))
+	}
+
+	note := f.Progs[0]
+	if note.Type != elf.PT_NOTE || note.Filesz != uint64(notes.Len()) {
+		t.Errorf("Got notes %+v, want PT_NOTE of %d bytes", note.ProgHeader, notes.Len())
+	}
+	var hdr [3]uint32
+	if err := binary.Read(note.Open(), usermem.ByteOrder, &hdr); err != nil {
+		t.Fatalf("Reading note header failed: %v", err)
+	}
+	if want := [3]uint32{5, 16, linux.NT_AUXV}; hdr != want {
+		t.Errorf("Got note header %v, want %v", hdr, want)
+	}
+
+	for i, m := range maps {
+		p := f.Progs[i+1]
+		if p.Type != elf.PT_LOAD || p.Vaddr != uint64(m.Range.Start) || p.Memsz != uint64(m.Range.Length()) {
+			t.Errorf("Got program header %+v for mapping %v", p.ProgHeader, m.Range)
+		}
+		if p.Off != layout.offsets[i] || p.Off%usermem.PageSize != 0 {
+			t.Errorf("Got offset %#x for mapping %v, want page aligned %#x", p.Off, m.Range, layout.offsets[i])
+		}
+	}
+	if got, want := f.Progs[1].Flags, elf.PF_R|elf.PF_W; got != want {
+		t.Errorf("Got flags %v, want %v", got, want)
+	}
+	if got, want := f.Progs[1].Filesz, uint64(0x2000); got != want {
+		t.Errorf("Got dumped mapping of %#x bytes, want %#x", got, want)
+	}
+	if got := f.Progs[2].Filesz; got != 0 {
+		t.Errorf("Got undumped mapping of %#x bytes, want 0", got)
+	}
+	if got, want := layout.size, f.Progs[1].Off+0x2000; got != want {
+		t.Errorf("Got core of %#x bytes, want %#x", got, want)
+	}
+}
@@ -464,3 +464,30 @@ func (e *EventPoll) UnregisterEpollWaiters() {
 		entry.id.File.EventUnregister(&entry.waiter)
 	}
 }
+
+// RegisterEpollWaiters registers the waiter objects unregistered by
+// UnregisterEpollWaiters, allowing the event poll object to be used again
+// after a save.
+func (e *EventPoll) RegisterEpollWaiters() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, entry := range e.files {
+		entry.id.File.EventRegister(&entry.waiter, entry.mask)
+	}
+
+	// Events may have been missed while the waiters were unregistered. See
+	// afterLoad.
+	e.listsMu.Lock()
+	defer e.listsMu.Unlock()
+	for it := e.waitingList.Front(); it != nil; {
+		p := it.(*pollEntry)
+		it = it.Next()
+		if p.id.File.Readiness(p.mask) != 0 {
+			e.waitingList.Remove(p)
+			e.readyList.PushBack(p)
+			p.curList = &e.readyList
+			e.Notify(waiter.EventIn)
+		}
+	}
+}
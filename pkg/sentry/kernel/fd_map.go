@@ -198,6 +198,18 @@ func (f *FDMap) SetFlags(fd kdefs.FD, flags FDFlags) {
 	f.files[fd] = descriptor{desc.file, flags}
 }
 
+// SetFlagsRange sets the flags of all valid file descriptors in [first, last].
+func (f *FDMap) SetFlagsRange(first, last kdefs.FD, flags FDFlags) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for fd, desc := range f.files {
+		if fd >= first && fd <= last {
+			f.files[fd] = descriptor{desc.file, flags}
+		}
+	}
+}
+
 // GetDescriptor returns a reference to the file and the flags for the FD. It
 // bumps its reference count as well. It returns nil if there is no File
 // for the FD, i.e. if the FD is invalid. The caller must use DecRef
@@ -320,6 +332,28 @@ func (f *FDMap) Remove(fd kdefs.FD) (*fs.File, bool) {
 	return nil, false
 }
 
+// RemoveRange removes all FDs in [first, last], and returns their Files in
+// the order of the FDs. Callers are expected to decrement the reference count
+// on each File.
+func (f *FDMap) RemoveRange(first, last kdefs.FD) []*fs.File {
+	f.mu.Lock()
+	var removed []*fs.File
+	for _, fd := range f.fds() {
+		if fd < first || fd > last {
+			continue
+		}
+		removed = append(removed, f.files[fd].file)
+		delete(f.files, fd)
+	}
+	f.mu.Unlock()
+
+	for _, file := range removed {
+		f.unlock(file)
+		inotifyFileClose(file)
+	}
+	return removed
+}
+
 // RemoveIf removes all FDs where cond is true.
 func (f *FDMap) RemoveIf(cond func(*fs.File, FDFlags) bool) {
 	var removed []*fs.File
@@ -134,3 +134,39 @@ func TestDescriptorFlags(t *testing.T) {
 		t.Fatalf("new File flags %+v don't match original %+v", newFlags, origFlags)
 	}
 }
+
+func TestFDMapRange(t *testing.T) {
+	file := filetest.NewTestFile(t)
+	f := newTestFDMap()
+	limitSet := limits.NewLimitSet()
+	limitSet.Set(limits.NumberOfFiles, limits.Limit{maxFD, maxFD})
+
+	for _, fd := range []kdefs.FD{0, 1, 3, 5, 8} {
+		if err := f.NewFDAt(fd, file, FDFlags{}, limitSet); err != nil {
+			t.Fatalf("f.NewFDAt(%d, r, FDFlags{}): got %v, wanted nil", fd, err)
+		}
+	}
+
+	f.SetFlagsRange(4, 8, FDFlags{CloseOnExec: true})
+	for fd, want := range map[kdefs.FD]bool{3: false, 5: true, 8: true} {
+		ref, flags := f.GetDescriptor(fd)
+		if ref == nil {
+			t.Fatalf("f.GetDescriptor(%d): got nil, wanted %v", fd, file)
+		}
+		ref.DecRef()
+		if flags.CloseOnExec != want {
+			t.Errorf("f.GetDescriptor(%d): got CloseOnExec %v, want %v", fd, flags.CloseOnExec, want)
+		}
+	}
+
+	removed := f.RemoveRange(1, 5)
+	for _, ref := range removed {
+		ref.DecRef()
+	}
+	if len(removed) != 3 {
+		t.Errorf("f.RemoveRange(1, 5): got %d files, want 3", len(removed))
+	}
+	if got, want := f.GetFDs(), (FDs{0, 8}); len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("f.GetFDs() after f.RemoveRange(1, 5): got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,519 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package iouring provides the shared submission and completion rings of
+// Linux's io_uring interface.
+//
+// A Ring owns the memory that the application maps with mmap(2) and
+// implements the kernel side of the ring protocol: consuming submission queue
+// entries and posting completion queue entries. Executing the requests
+// themselves is left to the caller, since that requires access to the
+// submitting task's address space.
+package iouring
+
+import (
+	"sync"
+
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/binary"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/anon"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/fsutil"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel/eventfd"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/memmap"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/platform"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/safemem"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usage"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
+	"gvisor.googlesource.com/gvisor/pkg/syserror"
+	"gvisor.googlesource.com/gvisor/pkg/waiter"
+)
+
+// Layout of the rings region, which is mapped at both IORING_OFF_SQ_RING and
+// IORING_OFF_CQ_RING (IORING_FEAT_SINGLE_MMAP). The submission queue index
+// array follows the completion queue entries.
+const (
+	sqHeadOff     = 0
+	sqTailOff     = 4
+	cqHeadOff     = 8
+	cqTailOff     = 12
+	sqRingMaskOff = 16
+	cqRingMaskOff = 20
+	sqEntriesOff  = 24
+	cqEntriesOff  = 28
+	sqDroppedOff  = 32
+	sqFlagsOff    = 36
+	cqFlagsOff    = 40
+	cqOverflowOff = 44
+	cqesOff       = 64
+	sqIndexSize   = 4
+)
+
+// Ring is an io_uring instance. It is the FileOperations of the file
+// returned by io_uring_setup(2), and the Mappable of its mappings.
+//
+// Requests in flight are not saved; they are lost across save/restore, as
+// are requests still waiting for their file to become ready.
+type Ring struct {
+	fsutil.PipeSeek      `state:"nosave"`
+	fsutil.NotDirReaddir `state:"nosave"`
+	fsutil.NoFsync       `state:"nosave"`
+	fsutil.NoopFlush     `state:"nosave"`
+	fsutil.NoIoctl       `state:"nosave"`
+
+	// Queue is notified with EventIn when a completion is posted.
+	waiter.Queue `state:"nosave"`
+
+	p platform.Platform
+
+	// sqEntries and cqEntries are the sizes of the submission and
+	// completion queues. Both are powers of two. Immutable.
+	sqEntries uint32
+	cqEntries uint32
+
+	// rings holds the ring headers, completion queue entries and submission
+	// queue index array. Immutable.
+	rings platform.FileRange
+
+	// sqes holds the submission queue entries. Immutable.
+	sqes platform.FileRange
+
+	// sqArrayOff is the offset of the submission queue index array in
+	// rings. Immutable.
+	sqArrayOff uint64
+
+	// submitMu serializes consumers of the submission queue.
+	submitMu sync.Mutex `state:"nosave"`
+
+	// mu protects the fields below.
+	mu sync.Mutex `state:"nosave"`
+
+	// overflow holds completions that did not fit in the completion queue.
+	// They are moved to the queue as the application makes room.
+	overflow []linux.IOUringCqe
+
+	// buffers are the buffers registered with IORING_REGISTER_BUFFERS.
+	buffers []usermem.AddrRange
+
+	// files are the files registered with IORING_REGISTER_FILES. Entries
+	// may be nil for sparse registrations.
+	files []*fs.File
+
+	// filesRegistered is true if files were registered, even if all
+	// entries are nil.
+	filesRegistered bool
+
+	// eventfd is signalled for each posted completion, or only for
+	// completions posted asynchronously if eventfdAsync is set.
+	eventfd      *fs.File
+	eventfdAsync bool
+
+	// waits are the outstanding waits for files to become ready.
+	waits map[*wait]struct{} `state:"nosave"`
+
+	// released is set once the file is released, after which completions
+	// are dropped.
+	released bool
+}
+
+// New returns a new io_uring file with the given queue sizes.
+//
+// Preconditions: sqEntries and cqEntries are powers of two no larger than
+// IORING_MAX_ENTRIES and IORING_MAX_CQ_ENTRIES.
+func New(ctx context.Context, sqEntries, cqEntries uint32) (*fs.File, error) {
+	p := platform.FromContext(ctx)
+	if p == nil {
+		return nil, syserror.ENOMEM
+	}
+	mem := p.Memory()
+
+	sqArrayOff := uint64(cqesOff + cqEntries*linux.SizeOfIOUringCqe)
+	ringsSize := uint64(usermem.Addr(sqArrayOff + uint64(sqEntries)*sqIndexSize).MustRoundUp())
+	rings, err := mem.Allocate(ringsSize, usage.Anonymous)
+	if err != nil {
+		return nil, err
+	}
+	sqesSize := uint64(usermem.Addr(uint64(sqEntries) * linux.SizeOfIOUringSqe).MustRoundUp())
+	sqes, err := mem.Allocate(sqesSize, usage.Anonymous)
+	if err != nil {
+		mem.DecRef(rings)
+		return nil, err
+	}
+
+	r := &Ring{
+		p:          p,
+		sqEntries:  sqEntries,
+		cqEntries:  cqEntries,
+		rings:      rings,
+		sqes:       sqes,
+		sqArrayOff: sqArrayOff,
+	}
+	for _, f := range []struct {
+		off uint64
+		val uint32
+	}{
+		{sqRingMaskOff, sqEntries - 1},
+		{cqRingMaskOff, cqEntries - 1},
+		{sqEntriesOff, sqEntries},
+		{cqEntriesOff, cqEntries},
+	} {
+		if err := r.storeField(f.off, f.val); err != nil {
+			mem.DecRef(rings)
+			mem.DecRef(sqes)
+			return nil, err
+		}
+	}
+
+	// name matches fs/io_uring.c:io_uring_get_fd.
+	dirent := fs.NewDirent(anon.NewInode(ctx), "anon_inode:[io_uring]")
+	return fs.NewFile(ctx, dirent, fs.FileFlags{Read: true, Write: true}, r), nil
+}
+
+// CQEntries returns the size of the completion queue.
+func (r *Ring) CQEntries() uint32 {
+	return r.cqEntries
+}
+
+// Offsets returns the offsets of the ring fields in the mapped rings, as
+// reported by io_uring_setup(2).
+func (r *Ring) Offsets() (linux.IOSqringOffsets, linux.IOCqringOffsets) {
+	return linux.IOSqringOffsets{
+		Head:        sqHeadOff,
+		Tail:        sqTailOff,
+		RingMask:    sqRingMaskOff,
+		RingEntries: sqEntriesOff,
+		Flags:       sqFlagsOff,
+		Dropped:     sqDroppedOff,
+		Array:       uint32(r.sqArrayOff),
+	}, linux.IOCqringOffsets{
+		Head:        cqHeadOff,
+		Tail:        cqTailOff,
+		RingMask:    cqRingMaskOff,
+		RingEntries: cqEntriesOff,
+		Overflow:    cqOverflowOff,
+		Cqes:        cqesOff,
+		Flags:       cqFlagsOff,
+	}
+}
+
+// mapInternal returns the n bytes at offset off of fr.
+func (r *Ring) mapInternal(fr platform.FileRange, off, n uint64) (safemem.BlockSeq, error) {
+	return r.p.Memory().MapInternal(platform.FileRange{fr.Start + off, fr.Start + off + n}, usermem.ReadWrite)
+}
+
+// loadField atomically loads the ring field at offset off of the rings region.
+func (r *Ring) loadField(off uint64) (uint32, error) {
+	bs, err := r.mapInternal(r.rings, off, 4)
+	if err != nil {
+		return 0, err
+	}
+	// There is no atomic load; a no-op compare-and-swap is equivalent.
+	return safemem.CompareAndSwapUint32(bs.Head(), 0, 0)
+}
+
+// storeField atomically stores val to the ring field at offset off of the
+// rings region.
+func (r *Ring) storeField(off uint64, val uint32) error {
+	bs, err := r.mapInternal(r.rings, off, 4)
+	if err != nil {
+		return err
+	}
+	_, err = safemem.SwapUint32(bs.Head(), val)
+	return err
+}
+
+// PopSubmission consumes the next submission queue entry. It returns false
+// if the submission queue is empty.
+//
+// Entries whose index is out of range are counted as dropped and skipped, as
+// in Linux.
+func (r *Ring) PopSubmission() (linux.IOUringSqe, bool, error) {
+	r.submitMu.Lock()
+	defer r.submitMu.Unlock()
+
+	for {
+		head, err := r.loadField(sqHeadOff)
+		if err != nil {
+			return linux.IOUringSqe{}, false, err
+		}
+		tail, err := r.loadField(sqTailOff)
+		if err != nil {
+			return linux.IOUringSqe{}, false, err
+		}
+		if head == tail {
+			return linux.IOUringSqe{}, false, nil
+		}
+		idx, err := r.loadField(r.sqArrayOff + uint64(head&(r.sqEntries-1))*sqIndexSize)
+		if err != nil {
+			return linux.IOUringSqe{}, false, err
+		}
+		if err := r.storeField(sqHeadOff, head+1); err != nil {
+			return linux.IOUringSqe{}, false, err
+		}
+		if idx >= r.sqEntries {
+			dropped, err := r.loadField(sqDroppedOff)
+			if err != nil {
+				return linux.IOUringSqe{}, false, err
+			}
+			if err := r.storeField(sqDroppedOff, dropped+1); err != nil {
+				return linux.IOUringSqe{}, false, err
+			}
+			continue
+		}
+
+		src, err := r.mapInternal(r.sqes, uint64(idx)*linux.SizeOfIOUringSqe, linux.SizeOfIOUringSqe)
+		if err != nil {
+			return linux.IOUringSqe{}, false, err
+		}
+		var buf [linux.SizeOfIOUringSqe]byte
+		if _, err := safemem.CopySeq(safemem.BlockSeqOf(safemem.BlockFromSafeSlice(buf[:])), src); err != nil {
+			return linux.IOUringSqe{}, false, err
+		}
+		var sqe linux.IOUringSqe
+		binary.Unmarshal(buf[:], usermem.ByteOrder, &sqe)
+		return sqe, true, nil
+	}
+}
+
+// Complete posts a completion for the request identified by userData. async
+// indicates that the request did not complete within io_uring_enter(2).
+//
+// If the completion queue is full, the completion is kept until the
+// application makes room (IORING_FEAT_NODROP).
+func (r *Ring) Complete(userData uint64, res int32, async bool) {
+	cqe := linux.IOUringCqe{
+		UserData: userData,
+		Res:      res,
+	}
+
+	r.mu.Lock()
+	if r.released {
+		r.mu.Unlock()
+		return
+	}
+	if posted, err := r.flushOverflowLocked(); err != nil || !posted {
+		r.overflow = append(r.overflow, cqe)
+	} else if posted, err := r.postLocked(cqe); err != nil || !posted {
+		r.overflow = append(r.overflow, cqe)
+	}
+	var ev *fs.File
+	if r.eventfd != nil && (async || !r.eventfdAsync) {
+		ev = r.eventfd
+		ev.IncRef()
+	}
+	r.mu.Unlock()
+
+	r.Notify(waiter.EventIn)
+
+	// Signal the eventfd after posting the completion, so that a waiter
+	// woken by it finds the completion.
+	if ev != nil {
+		ev.FileOperations.(*eventfd.EventOperations).Signal(1)
+		ev.DecRef()
+	}
+}
+
+// postLocked writes cqe to the completion queue. It returns false if the
+// completion queue is full.
+//
+// Preconditions: r.mu must be locked.
+func (r *Ring) postLocked(cqe linux.IOUringCqe) (bool, error) {
+	head, err := r.loadField(cqHeadOff)
+	if err != nil {
+		return false, err
+	}
+	tail, err := r.loadField(cqTailOff)
+	if err != nil {
+		return false, err
+	}
+	if tail-head >= r.cqEntries {
+		return false, nil
+	}
+
+	dst, err := r.mapInternal(r.rings, cqesOff+uint64(tail&(r.cqEntries-1))*linux.SizeOfIOUringCqe, linux.SizeOfIOUringCqe)
+	if err != nil {
+		return false, err
+	}
+	buf := binary.Marshal(nil, usermem.ByteOrder, &cqe)
+	if _, err := safemem.CopySeq(dst, safemem.BlockSeqOf(safemem.BlockFromSafeSlice(buf))); err != nil {
+		return false, err
+	}
+	// Publish the entry only after it has been written.
+	if err := r.storeField(cqTailOff, tail+1); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// flushOverflowLocked moves completions from r.overflow to the completion
+// queue. It returns true if r.overflow is empty.
+//
+// Preconditions: r.mu must be locked.
+func (r *Ring) flushOverflowLocked() (bool, error) {
+	for len(r.overflow) > 0 {
+		posted, err := r.postLocked(r.overflow[0])
+		if err != nil || !posted {
+			return false, err
+		}
+		r.overflow = r.overflow[1:]
+	}
+	r.overflow = nil
+	return true, nil
+}
+
+// Overflowed returns true if completions are still waiting for room in the
+// completion queue after moving as many as possible into it. Submission
+// fails with EBUSY in that case, as in Linux.
+func (r *Ring) Overflowed() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	flushed, _ := r.flushOverflowLocked()
+	return !flushed
+}
+
+// Completions returns the number of completions that the application has
+// yet to consume from the completion queue.
+func (r *Ring) Completions() uint32 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.flushOverflowLocked()
+	head, err := r.loadField(cqHeadOff)
+	if err != nil {
+		return 0
+	}
+	tail, err := r.loadField(cqTailOff)
+	if err != nil {
+		return 0
+	}
+	return tail - head
+}
+
+// Readiness implements waiter.Waitable.Readiness.
+func (r *Ring) Readiness(mask waiter.EventMask) waiter.EventMask {
+	var ready waiter.EventMask
+	if r.Completions() != 0 {
+		ready |= waiter.EventIn
+	}
+	head, herr := r.loadField(sqHeadOff)
+	tail, terr := r.loadField(sqTailOff)
+	if herr == nil && terr == nil && tail-head < r.sqEntries {
+		ready |= waiter.EventOut
+	}
+	return mask & ready
+}
+
+// Read implements fs.FileOperations.Read.
+func (*Ring) Read(context.Context, *fs.File, usermem.IOSequence, int64) (int64, error) {
+	return 0, syserror.EINVAL
+}
+
+// Write implements fs.FileOperations.Write.
+func (*Ring) Write(context.Context, *fs.File, usermem.IOSequence, int64) (int64, error) {
+	return 0, syserror.EINVAL
+}
+
+// Release implements fs.FileOperations.Release.
+func (r *Ring) Release() {
+	r.mu.Lock()
+	r.released = true
+	r.overflow = nil
+	waits := r.waits
+	r.waits = nil
+	files := r.files
+	r.files = nil
+	ev := r.eventfd
+	r.eventfd = nil
+	r.mu.Unlock()
+
+	for w := range waits {
+		w.cancel()
+	}
+	for _, f := range files {
+		if f != nil {
+			f.DecRef()
+		}
+	}
+	if ev != nil {
+		ev.DecRef()
+	}
+
+	mem := r.p.Memory()
+	mem.DecRef(r.rings)
+	mem.DecRef(r.sqes)
+}
+
+// region returns the offset at which the region containing offset off is
+// mapped, and the memory backing it.
+func (r *Ring) region(off uint64) (uint64, platform.FileRange) {
+	switch {
+	case off >= linux.IORING_OFF_SQES:
+		return linux.IORING_OFF_SQES, r.sqes
+	case off >= linux.IORING_OFF_CQ_RING:
+		return linux.IORING_OFF_CQ_RING, r.rings
+	default:
+		return linux.IORING_OFF_SQ_RING, r.rings
+	}
+}
+
+// ConfigureMMap implements fs.FileOperations.ConfigureMMap.
+func (r *Ring) ConfigureMMap(ctx context.Context, file *fs.File, opts *memmap.MMapOpts) error {
+	switch opts.Offset {
+	case linux.IORING_OFF_SQ_RING, linux.IORING_OFF_CQ_RING, linux.IORING_OFF_SQES:
+	default:
+		return syserror.EINVAL
+	}
+	if _, fr := r.region(opts.Offset); opts.Length > fr.Length() {
+		return syserror.EINVAL
+	}
+	return fsutil.GenericConfigureMMap(file, r, opts)
+}
+
+// AddMapping implements memmap.Mappable.AddMapping.
+func (*Ring) AddMapping(context.Context, memmap.MappingSpace, usermem.AddrRange, uint64) error {
+	return nil
+}
+
+// RemoveMapping implements memmap.Mappable.RemoveMapping.
+func (*Ring) RemoveMapping(context.Context, memmap.MappingSpace, usermem.AddrRange, uint64) {
+}
+
+// CopyMapping implements memmap.Mappable.CopyMapping.
+func (*Ring) CopyMapping(context.Context, memmap.MappingSpace, usermem.AddrRange, usermem.AddrRange, uint64) error {
+	return nil
+}
+
+// Translate implements memmap.Mappable.Translate.
+func (r *Ring) Translate(ctx context.Context, required, optional memmap.MappableRange, at usermem.AccessType) ([]memmap.Translation, error) {
+	base, fr := r.region(required.Start)
+	var err error
+	if required.End > base+fr.Length() {
+		err = &memmap.BusError{syserror.EFAULT}
+	}
+	if source := optional.Intersect(memmap.MappableRange{base, base + fr.Length()}); source.Length() != 0 {
+		return []memmap.Translation{
+			{
+				Source: source,
+				File:   r.p.Memory(),
+				Offset: fr.Start + source.Start - base,
+			},
+		}, err
+	}
+	return nil, err
+}
+
+// InvalidateUnsavable implements memmap.Mappable.InvalidateUnsavable.
+func (*Ring) InvalidateUnsavable(context.Context) error {
+	return nil
+}
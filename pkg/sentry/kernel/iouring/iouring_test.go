@@ -0,0 +1,204 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iouring
+
+import (
+	"testing"
+
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/binary"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/context/contexttest"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/safemem"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
+	"gvisor.googlesource.com/gvisor/pkg/waiter"
+)
+
+func newRing(t *testing.T, sqEntries, cqEntries uint32) (*fs.File, *Ring) {
+	f, err := New(contexttest.Context(t), sqEntries, cqEntries)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	return f, f.FileOperations.(*Ring)
+}
+
+// submit places sqe in slot idx and publishes it, as the application would.
+func submit(t *testing.T, r *Ring, idx uint32, sqe linux.IOUringSqe) {
+	dst, err := r.mapInternal(r.sqes, uint64(idx)*linux.SizeOfIOUringSqe, linux.SizeOfIOUringSqe)
+	if err != nil {
+		t.Fatalf("mapInternal failed: %v", err)
+	}
+	buf := binary.Marshal(nil, usermem.ByteOrder, &sqe)
+	if _, err := safemem.CopySeq(dst, safemem.BlockSeqOf(safemem.BlockFromSafeSlice(buf))); err != nil {
+		t.Fatalf("CopySeq failed: %v", err)
+	}
+	publish(t, r, idx)
+}
+
+// publish appends idx to the submission queue.
+func publish(t *testing.T, r *Ring, idx uint32) {
+	tail := mustLoad(t, r, sqTailOff)
+	mustStore(t, r, r.sqArrayOff+uint64(tail&(r.sqEntries-1))*sqIndexSize, idx)
+	mustStore(t, r, sqTailOff, tail+1)
+}
+
+// reap consumes the next completion, as the application would.
+func reap(t *testing.T, r *Ring) linux.IOUringCqe {
+	head := mustLoad(t, r, cqHeadOff)
+	if tail := mustLoad(t, r, cqTailOff); head == tail {
+		t.Fatalf("completion queue is empty")
+	}
+	src, err := r.mapInternal(r.rings, cqesOff+uint64(head&(r.cqEntries-1))*linux.SizeOfIOUringCqe, linux.SizeOfIOUringCqe)
+	if err != nil {
+		t.Fatalf("mapInternal failed: %v", err)
+	}
+	var buf [linux.SizeOfIOUringCqe]byte
+	if _, err := safemem.CopySeq(safemem.BlockSeqOf(safemem.BlockFromSafeSlice(buf[:])), src); err != nil {
+		t.Fatalf("CopySeq failed: %v", err)
+	}
+	var cqe linux.IOUringCqe
+	binary.Unmarshal(buf[:], usermem.ByteOrder, &cqe)
+	mustStore(t, r, cqHeadOff, head+1)
+	return cqe
+}
+
+func mustLoad(t *testing.T, r *Ring, off uint64) uint32 {
+	v, err := r.loadField(off)
+	if err != nil {
+		t.Fatalf("load(%d) failed: %v", off, err)
+	}
+	return v
+}
+
+func mustStore(t *testing.T, r *Ring, off uint64, v uint32) {
+	if err := r.storeField(off, v); err != nil {
+		t.Fatalf("store(%d) failed: %v", off, err)
+	}
+}
+
+func TestSizes(t *testing.T) {
+	for _, tc := range []struct {
+		v    interface{}
+		want uintptr
+	}{
+		{linux.IOUringParams{}, linux.SizeOfIOUringParams},
+		{linux.IOUringSqe{}, linux.SizeOfIOUringSqe},
+		{linux.IOUringCqe{}, linux.SizeOfIOUringCqe},
+		{linux.IOUringProbe{}, linux.SizeOfIOUringProbe},
+		{linux.IOUringProbeOp{}, linux.SizeOfIOUringProbeOp},
+	} {
+		if got := binary.Size(tc.v); got != tc.want {
+			t.Errorf("binary.Size(%T) = %d, want %d", tc.v, got, tc.want)
+		}
+	}
+}
+
+func TestLayout(t *testing.T) {
+	f, r := newRing(t, 4, 8)
+	defer f.DecRef()
+
+	sqOff, cqOff := r.Offsets()
+	for _, tc := range []struct {
+		name string
+		off  uint32
+		want uint32
+	}{
+		{"sq ring mask", sqOff.RingMask, 3},
+		{"sq ring entries", sqOff.RingEntries, 4},
+		{"cq ring mask", cqOff.RingMask, 7},
+		{"cq ring entries", cqOff.RingEntries, 8},
+	} {
+		if got := mustLoad(t, r, uint64(tc.off)); got != tc.want {
+			t.Errorf("%s = %d, want %d", tc.name, got, tc.want)
+		}
+	}
+	if want := cqOff.Cqes + 8*linux.SizeOfIOUringCqe; sqOff.Array < want {
+		t.Errorf("sq array at %d overlaps cqes ending at %d", sqOff.Array, want)
+	}
+}
+
+func TestSubmitComplete(t *testing.T) {
+	f, r := newRing(t, 4, 8)
+	defer f.DecRef()
+
+	if _, ok, err := r.PopSubmission(); err != nil || ok {
+		t.Fatalf("PopSubmission on empty ring = %v, %v, want false, nil", ok, err)
+	}
+
+	submit(t, r, 2, linux.IOUringSqe{Opcode: linux.IORING_OP_NOP, UserData: 42})
+	sqe, ok, err := r.PopSubmission()
+	if err != nil || !ok {
+		t.Fatalf("PopSubmission = %v, %v, want true, nil", ok, err)
+	}
+	if sqe.Opcode != linux.IORING_OP_NOP || sqe.UserData != 42 {
+		t.Errorf("PopSubmission got %+v, want NOP with user data 42", sqe)
+	}
+
+	e, ch := waiter.NewChannelEntry(nil)
+	f.EventRegister(&e, waiter.EventIn)
+	defer f.EventUnregister(&e)
+
+	if got := f.Readiness(waiter.EventIn); got != 0 {
+		t.Errorf("Readiness before completion = %v, want 0", got)
+	}
+	r.Complete(sqe.UserData, 7, false)
+	select {
+	case <-ch:
+	default:
+		t.Errorf("Didn't get notified of EventIn after completion")
+	}
+	if got := r.Completions(); got != 1 {
+		t.Errorf("Completions = %d, want 1", got)
+	}
+	if cqe := reap(t, r); cqe.UserData != 42 || cqe.Res != 7 {
+		t.Errorf("got completion %+v, want user data 42 and result 7", cqe)
+	}
+}
+
+func TestDroppedSubmission(t *testing.T) {
+	f, r := newRing(t, 4, 8)
+	defer f.DecRef()
+
+	publish(t, r, 9)
+	if _, ok, err := r.PopSubmission(); err != nil || ok {
+		t.Fatalf("PopSubmission = %v, %v, want false, nil", ok, err)
+	}
+	if got := mustLoad(t, r, sqDroppedOff); got != 1 {
+		t.Errorf("dropped = %d, want 1", got)
+	}
+}
+
+func TestOverflow(t *testing.T) {
+	f, r := newRing(t, 2, 4)
+	defer f.DecRef()
+
+	for i := 0; i < 6; i++ {
+		r.Complete(uint64(i), 0, false)
+	}
+	if !r.Overflowed() {
+		t.Fatalf("Overflowed = false after exceeding the completion queue")
+	}
+
+	// Completions are delivered in order as room is made.
+	for i := 0; i < 6; i++ {
+		if cqe := reap(t, r); cqe.UserData != uint64(i) {
+			t.Errorf("got completion %d, want %d", cqe.UserData, i)
+		}
+		r.Completions()
+	}
+	if r.Overflowed() {
+		t.Errorf("Overflowed = true after consuming all completions")
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iouring
+
+import (
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
+	"gvisor.googlesource.com/gvisor/pkg/syserror"
+)
+
+// RegisterBuffers registers the buffers used by IORING_OP_READ_FIXED and
+// IORING_OP_WRITE_FIXED.
+func (r *Ring) RegisterBuffers(buffers []usermem.AddrRange) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.buffers != nil {
+		return syserror.EBUSY
+	}
+	r.buffers = buffers
+	return nil
+}
+
+// UnregisterBuffers unregisters the buffers registered by RegisterBuffers.
+func (r *Ring) UnregisterBuffers() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.buffers == nil {
+		return syserror.ENXIO
+	}
+	r.buffers = nil
+	return nil
+}
+
+// Buffer returns the registered buffer at index i.
+func (r *Ring) Buffer(i uint16) (usermem.AddrRange, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if int(i) >= len(r.buffers) {
+		return usermem.AddrRange{}, false
+	}
+	return r.buffers[i], true
+}
+
+// RegisterFiles registers the files used by requests with IOSQE_FIXED_FILE.
+// On success, r takes ownership of the references on files.
+func (r *Ring) RegisterFiles(files []*fs.File) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.filesRegistered {
+		return syserror.EBUSY
+	}
+	r.files = files
+	r.filesRegistered = true
+	return nil
+}
+
+// UnregisterFiles unregisters the files registered by RegisterFiles.
+func (r *Ring) UnregisterFiles() error {
+	r.mu.Lock()
+	if !r.filesRegistered {
+		r.mu.Unlock()
+		return syserror.ENXIO
+	}
+	files := r.files
+	r.files = nil
+	r.filesRegistered = false
+	r.mu.Unlock()
+
+	for _, f := range files {
+		if f != nil {
+			f.DecRef()
+		}
+	}
+	return nil
+}
+
+// File returns the registered file at index i, with an extra reference, or
+// nil if there is none.
+func (r *Ring) File(i int32) *fs.File {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if i < 0 || int(i) >= len(r.files) || r.files[i] == nil {
+		return nil
+	}
+	f := r.files[i]
+	f.IncRef()
+	return f
+}
+
+// RegisterEventfd registers an eventfd to be signalled when completions are
+// posted. If async is true, only completions posted after io_uring_enter(2)
+// returns signal it. On success, r takes ownership of the reference on file.
+//
+// Preconditions: file is an eventfd.
+func (r *Ring) RegisterEventfd(file *fs.File, async bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.eventfd != nil {
+		return syserror.EBUSY
+	}
+	r.eventfd = file
+	r.eventfdAsync = async
+	return nil
+}
+
+// UnregisterEventfd unregisters the eventfd registered by RegisterEventfd.
+func (r *Ring) UnregisterEventfd() error {
+	r.mu.Lock()
+	ev := r.eventfd
+	r.eventfd = nil
+	r.mu.Unlock()
+
+	if ev == nil {
+		return syserror.ENXIO
+	}
+	ev.DecRef()
+	return nil
+}
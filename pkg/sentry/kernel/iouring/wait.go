@@ -0,0 +1,121 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iouring
+
+import (
+	"sync/atomic"
+
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
+	"gvisor.googlesource.com/gvisor/pkg/waiter"
+)
+
+// wait is an outstanding wait for a file to become ready on behalf of a
+// request.
+type wait struct {
+	r     *Ring
+	file  *fs.File
+	entry waiter.Entry
+	mask  waiter.EventMask
+
+	// poll is true for IORING_OP_POLL_ADD requests, which may be cancelled
+	// by IORING_OP_POLL_REMOVE with userData.
+	poll     bool
+	userData uint64
+
+	// fn is called with the file's readiness once the file is ready.
+	fn func(waiter.EventMask)
+
+	// done is set, atomically, once the wait has fired or been cancelled.
+	done int32
+}
+
+// Callback implements waiter.EntryCallback.Callback.
+func (w *wait) Callback(*waiter.Entry) {
+	if atomic.CompareAndSwapInt32(&w.done, 0, 1) {
+		// The file's queue is locked; finish outside of it.
+		fs.Async(w.fire)
+	}
+}
+
+func (w *wait) fire() {
+	w.file.EventUnregister(&w.entry)
+	w.r.mu.Lock()
+	delete(w.r.waits, w)
+	w.r.mu.Unlock()
+	w.fn(w.file.Readiness(w.mask))
+	w.file.DecRef()
+}
+
+// cancel cancels the wait. It returns false if the wait has already fired.
+func (w *wait) cancel() bool {
+	if !atomic.CompareAndSwapInt32(&w.done, 0, 1) {
+		return false
+	}
+	w.file.EventUnregister(&w.entry)
+	w.file.DecRef()
+	return true
+}
+
+// Wait arranges for fn to be called, asynchronously, once file is ready for
+// an event in mask. If poll is true, the wait may be cancelled with
+// CancelPoll(userData).
+//
+// Wait returns false, without calling fn, if r has been released.
+func (r *Ring) Wait(file *fs.File, mask waiter.EventMask, userData uint64, poll bool, fn func(waiter.EventMask)) bool {
+	w := &wait{
+		r:        r,
+		file:     file,
+		mask:     mask,
+		poll:     poll,
+		userData: userData,
+		fn:       fn,
+	}
+	w.entry.Callback = w
+
+	r.mu.Lock()
+	if r.released {
+		r.mu.Unlock()
+		return false
+	}
+	if r.waits == nil {
+		r.waits = make(map[*wait]struct{})
+	}
+	r.waits[w] = struct{}{}
+	file.IncRef()
+	file.EventRegister(&w.entry, mask)
+	r.mu.Unlock()
+
+	// The file may have become ready before the entry was registered.
+	if file.Readiness(mask) != 0 {
+		w.Callback(&w.entry)
+	}
+	return true
+}
+
+// CancelPoll cancels the IORING_OP_POLL_ADD request identified by userData.
+// It returns false if no such request is waiting.
+func (r *Ring) CancelPoll(userData uint64) bool {
+	r.mu.Lock()
+	var found *wait
+	for w := range r.waits {
+		if w.poll && w.userData == userData {
+			found = w
+			delete(r.waits, w)
+			break
+		}
+	}
+	r.mu.Unlock()
+	return found != nil && found.cancel()
+}
@@ -37,12 +37,12 @@ import (
 	"time"
 
 	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/bpf"
 	"gvisor.googlesource.com/gvisor/pkg/cpuid"
 	"gvisor.googlesource.com/gvisor/pkg/log"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/arch"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
-	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/timerfd"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/hostcpu"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/inet"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel/auth"
@@ -97,6 +97,17 @@ type Kernel struct {
 	rootUTSNamespace  *UTSNamespace
 	rootIPCNamespace  *IPCNamespace
 
+	// rootPIDs is the PIDsController from which all others descend. It
+	// limits the total number of tasks in the kernel.
+	rootPIDs *PIDsController
+
+	// propagateNiceness is InitKernelArgs.PropagateNiceness.
+	propagateNiceness bool
+
+	// timeSlice is InitKernelArgs.TimeSlice, in units of linux.ClockTick.
+	// If it is 0, task goroutines are never preempted.
+	timeSlice uint64
+
 	// mounts holds the state of the virtual filesystem. mounts is initially
 	// nil, and must be set by calling Kernel.SetRootMountNamespace before
 	// Kernel.CreateProcess can succeed.
@@ -117,6 +128,9 @@ type Kernel struct {
 	// monotonicClock is a ktime.Clock based on timekeeper's Monotonic.
 	monotonicClock *timekeeperClock
 
+	// taiClock is a ktime.Clock based on timekeeper's TAI.
+	taiClock *timekeeperClock
+
 	// syslog is the kernel log.
 	syslog syslog
 
@@ -158,6 +172,28 @@ type Kernel struct {
 	// exitErr is the error causing the sandbox to exit, if any. It is
 	// protected by extMu.
 	exitErr error
+
+	// compat records the unsupported syscalls and ioctls invoked by the
+	// application.
+	compat CompatTracker `state:"nosave"`
+
+	// corePatternMu protects corePattern.
+	corePatternMu sync.Mutex `state:"nosave"`
+
+	// corePattern is the pattern of the names of core dumps, as in Linux's
+	// /proc/sys/kernel/core_pattern. If it is empty, no core dumps are
+	// written.
+	corePattern string
+
+	// uevents multicasts device uevents.
+	uevents uevents
+
+	// memoryLimitMu serializes changes of the memory limit.
+	memoryLimitMu sync.Mutex `state:"nosave"`
+
+	// processLog records changes to the process tree. If it is nil,
+	// process events are not recorded. processLog is immutable.
+	processLog *ProcessLog
 }
 
 // InitKernelArgs holds arguments to Init.
@@ -198,6 +234,27 @@ type InitKernelArgs struct {
 
 	// RootIPCNamespace is the root IPC namepsace.
 	RootIPCNamespace *IPCNamespace
+
+	// MaxTasks is the maximum number of tasks that may exist at any time.
+	// If MaxTasks is 0, the number of tasks is unlimited.
+	MaxTasks uint64
+
+	// PropagateNiceness indicates that the niceness of each task should be
+	// passed to the platform, for platforms that support it. See
+	// platform.NicenessSetter.
+	PropagateNiceness bool
+
+	// TimeSlice is the time for which a task goroutine may execute
+	// application code before it is preempted, if more task goroutines are
+	// running than the sentry has CPUs. It is rounded up to a multiple of
+	// linux.ClockTick. If TimeSlice is 0, task goroutines are never
+	// preempted, and are only scheduled by the Go runtime and the host.
+	TimeSlice time.Duration
+
+	// ProcessLogSize is the number of recent process events kept by the
+	// kernel's ProcessLog. If ProcessLogSize is 0, process events are not
+	// recorded.
+	ProcessLogSize int
 }
 
 // Init initialize the Kernel with no tasks.
@@ -223,6 +280,14 @@ func (k *Kernel) Init(args InitKernelArgs) error {
 	k.rootUserNamespace = args.RootUserNamespace
 	k.rootUTSNamespace = args.RootUTSNamespace
 	k.rootIPCNamespace = args.RootIPCNamespace
+	k.rootPIDs = NewPIDsController(nil, args.MaxTasks)
+	k.propagateNiceness = args.PropagateNiceness
+	if args.TimeSlice > 0 {
+		k.timeSlice = uint64((args.TimeSlice + linux.ClockTick - 1) / linux.ClockTick)
+	}
+	if args.ProcessLogSize > 0 {
+		k.processLog = NewProcessLog(args.ProcessLogSize)
+	}
 	k.networkStack = args.NetworkStack
 	k.applicationCores = args.ApplicationCores
 	if args.UseHostCores {
@@ -241,6 +306,7 @@ func (k *Kernel) Init(args InitKernelArgs) error {
 	k.vdso = args.Vdso
 	k.realtimeClock = &timekeeperClock{tk: args.Timekeeper, c: sentrytime.Realtime}
 	k.monotonicClock = &timekeeperClock{tk: args.Timekeeper, c: sentrytime.Monotonic}
+	k.taiClock = &timekeeperClock{tk: args.Timekeeper, c: sentrytime.TAI}
 	k.netlinkPorts = port.New()
 
 	return nil
@@ -250,6 +316,23 @@ func (k *Kernel) Init(args InitKernelArgs) error {
 //
 // Preconditions: The kernel must be paused throughout the call to SaveTo.
 func (k *Kernel) SaveTo(w io.Writer) error {
+	return k.saveTo(w, false)
+}
+
+// SaveDeltaTo saves the state of k to w, like SaveTo, except that only the
+// memory contents that changed since the previous call to SaveTo or
+// SaveDeltaTo are saved. Restoring the state requires the state saved by all
+// preceding calls, back to and including the last call to SaveTo; see
+// LoadFrom.
+//
+// Preconditions: The kernel must be paused throughout the call to
+// SaveDeltaTo.
+func (k *Kernel) SaveDeltaTo(w io.Writer) error {
+	return k.saveTo(w, true)
+}
+
+// saveTo implements SaveTo and SaveDeltaTo.
+func (k *Kernel) saveTo(w io.Writer, delta bool) error {
 	saveStart := time.Now()
 	ctx := k.SupervisorContext()
 
@@ -266,10 +349,10 @@ func (k *Kernel) SaveTo(w io.Writer) error {
 		return err
 	}
 
-	// Remove all epoll waiter objects from underlying wait queues.
-	// NOTE: for programs to resume execution in future snapshot scenarios,
-	// we will need to re-establish these waiter objects after saving.
+	// Remove all epoll waiter objects from underlying wait queues, and
+	// re-establish them after saving so that programs can resume execution.
 	k.tasks.unregisterEpollWaiters()
+	defer k.tasks.registerEpollWaiters()
 
 	// Clear the dirent cache before saving because Dirents must be Loaded in a
 	// particular order (parents before children), and Loading dirents from a cache
@@ -310,8 +393,14 @@ func (k *Kernel) SaveTo(w io.Writer) error {
 	// currently a single implementation anyways, it just needs to be
 	// "unabstracted" and reparented appropriately.)
 	memoryStart := time.Now()
-	if err := k.Platform.Memory().SaveTo(w); err != nil {
-		return err
+	if delta {
+		if err := k.Platform.Memory().SaveDeltaTo(w); err != nil {
+			return err
+		}
+	} else {
+		if err := k.Platform.Memory().SaveTo(w); err != nil {
+			return err
+		}
 	}
 	log.Infof("Memory save took [%s].", time.Since(memoryStart))
 
@@ -370,14 +459,29 @@ func (k *Kernel) invalidateUnsavableMappings(ctx context.Context) error {
 }
 
 func (ts *TaskSet) unregisterEpollWaiters() {
+	ts.forEachEventPoll((*epoll.EventPoll).UnregisterEpollWaiters)
+}
+
+func (ts *TaskSet) registerEpollWaiters() {
+	ts.forEachEventPoll((*epoll.EventPoll).RegisterEpollWaiters)
+}
+
+// forEachEventPoll calls fn once for each event poll object in ts. An event
+// poll object may be shared by multiple tasks and FDs, but its waiters must
+// only be registered or unregistered once.
+func (ts *TaskSet) forEachEventPoll(fn func(*epoll.EventPoll)) {
 	ts.mu.RLock()
 	defer ts.mu.RUnlock()
+	seen := make(map[*epoll.EventPoll]struct{})
 	for t := range ts.Root.tids {
 		if fdmap := t.FDMap(); fdmap != nil {
 			for _, desc := range fdmap.files {
 				if desc.file != nil {
 					if e, ok := desc.file.FileOperations.(*epoll.EventPoll); ok {
-						e.UnregisterEpollWaiters()
+						if _, ok := seen[e]; !ok {
+							seen[e] = struct{}{}
+							fn(e)
+						}
 					}
 				}
 			}
@@ -386,7 +490,12 @@ func (ts *TaskSet) unregisterEpollWaiters() {
 }
 
 // LoadFrom returns a new Kernel loaded from args.
-func (k *Kernel) LoadFrom(r io.Reader, p platform.Platform, net inet.Stack) error {
+//
+// If r was saved by SaveDeltaTo, parents must contain the state saved by the
+// preceding calls to SaveTo and SaveDeltaTo, starting with SaveTo, in order.
+// Otherwise, parents must be empty. Only the memory state is loaded from
+// parents.
+func (k *Kernel) LoadFrom(r io.Reader, parents []io.Reader, p platform.Platform, net inet.Stack) error {
 	loadStart := time.Now()
 	if p == nil {
 		return fmt.Errorf("Platform is nil")
@@ -408,10 +517,24 @@ func (k *Kernel) LoadFrom(r io.Reader, p platform.Platform, net inet.Stack) erro
 
 	// Load the memory state.
 	//
-	// See the note in SaveTo.
+	// See the note in SaveTo. The kernel state saved with the base and
+	// intermediate memory states is superseded by the kernel state loaded
+	// above.
 	memoryStart := time.Now()
-	if err := k.Platform.Memory().LoadFrom(r); err != nil {
-		return err
+	readers := append(append([]io.Reader(nil), parents...), r)
+	for i, mr := range readers {
+		if i < len(parents) {
+			if err := state.Skip(mr); err != nil {
+				return fmt.Errorf("failed to skip kernel state of parent %d: %v", i, err)
+			}
+		}
+		if i == 0 {
+			if err := k.Platform.Memory().LoadFrom(mr); err != nil {
+				return err
+			}
+		} else if err := k.Platform.Memory().LoadDeltaFrom(mr); err != nil {
+			return err
+		}
 	}
 	log.Infof("Memory load took [%s].", time.Since(memoryStart))
 
@@ -496,6 +619,47 @@ type CreateProcessArgs struct {
 
 	// IPCNamespace is the initial IPC namespace.
 	IPCNamespace *IPCNamespace
+
+	// AbstractSocketNamespace is the initial abstract socket namespace. If
+	// AbstractSocketNamespace is nil, the new process gets a new namespace.
+	AbstractSocketNamespace *AbstractSocketNamespace
+
+	// PIDsController limits the number of tasks in the new process and its
+	// descendants. If PIDsController is nil, the Kernel's root
+	// PIDsController is used.
+	PIDsController *PIDsController
+
+	// SyscallWhitelist restricts the syscalls that the new process and its
+	// descendants may invoke. If SyscallWhitelist is nil, all syscalls are
+	// permitted.
+	SyscallWhitelist *SyscallWhitelist
+
+	// SyscallOrigins restricts the code from which the new process and its
+	// descendants may invoke syscalls. If SyscallOrigins is nil, syscalls
+	// may be invoked from anywhere.
+	SyscallOrigins *SyscallOriginPolicy
+
+	// ExecPolicy restricts the executable mappings that the new process and
+	// its descendants may create. If ExecPolicy is nil, executable mappings
+	// are unrestricted.
+	ExecPolicy *mm.ExecPolicy
+
+	// Redaction masks secrets in trace and event payloads describing the
+	// new process and its descendants. If Redaction is nil, nothing is
+	// masked.
+	Redaction *RedactionPolicy
+
+	// SyscallFilters are seccomp-bpf syscall filters installed on the new
+	// process before it begins executing, as if by seccomp(2). They are
+	// inherited by its descendants like any other seccomp filter.
+	SyscallFilters []bpf.Program
+
+	// Niceness is the initial niceness of the new process.
+	Niceness int
+
+	// AllowedCPUMask contains the CPUs that the new process may run on. If
+	// AllowedCPUMask is nil, the new process may run on all CPUs.
+	AllowedCPUMask sched.CPUSet
 }
 
 // NewContext returns a context.Context that represents the task that will be
@@ -569,7 +733,16 @@ func (k *Kernel) CreateProcess(args CreateProcessArgs) (*ThreadGroup, error) {
 		return nil, fmt.Errorf("no kernel MountNamespace")
 	}
 
-	tg := NewThreadGroup(k.tasks.Root, NewSignalHandlers(), linux.SIGCHLD, args.Limits, k.monotonicClock)
+	pids := args.PIDsController
+	if pids == nil {
+		pids = k.rootPIDs
+	}
+	tg := NewThreadGroup(k.tasks.Root, NewSignalHandlers(), linux.SIGCHLD, args.Limits, pids, k.monotonicClock)
+	tg.syscallWhitelist = args.SyscallWhitelist
+	tg.syscallOrigins = args.SyscallOrigins
+	tg.execPolicy = args.ExecPolicy
+	tg.redaction = args.Redaction
+	tg.initialSyscallFilters = args.SyscallFilters
 	ctx := args.NewContext(k)
 
 	// Grab the root directory.
@@ -598,12 +771,27 @@ func (k *Kernel) CreateProcess(args CreateProcessArgs) (*ThreadGroup, error) {
 		args.Filename = args.Argv[0]
 	}
 
+	mask := sched.NewFullCPUSet(k.applicationCores)
+	if args.AllowedCPUMask != nil {
+		if want := sched.CPUSetSize(k.applicationCores); args.AllowedCPUMask.Size() != want {
+			return nil, fmt.Errorf("invalid CPU mask %v (expected %d bytes)", args.AllowedCPUMask, want)
+		}
+		mask = args.AllowedCPUMask.Copy()
+		mask.ClearAbove(k.applicationCores)
+		if mask.NumCPUs() == 0 {
+			return nil, fmt.Errorf("CPU mask %v allows no CPUs", args.AllowedCPUMask)
+		}
+	}
+
 	// Create a fresh task context.
 	tc, err := k.LoadTaskImage(ctx, k.mounts, root, wd, args.MaxSymlinkTraversals, args.Filename, args.Argv, args.Envv, k.featureSet)
 	if err != nil {
 		return nil, err
 	}
-	tr := newTaskResources(args.FDMap, newFSContext(root, wd, args.Umask))
+	if args.ExecPolicy != nil {
+		tc.MemoryManager.SetExecPolicy(args.ExecPolicy, executablePath(tc.MemoryManager, root))
+	}
+	tr := newTaskResources(args.FDMap, newFSContext(root, wd, args.Umask), args.AbstractSocketNamespace)
 	// NewTask unconditionally takes ownership of tr, so we never have to call
 	// tr.release.
 
@@ -616,12 +804,15 @@ func (k *Kernel) CreateProcess(args CreateProcessArgs) (*ThreadGroup, error) {
 		Credentials:    args.Credentials,
 		UTSNamespace:   args.UTSNamespace,
 		IPCNamespace:   args.IPCNamespace,
-		AllowedCPUMask: sched.NewFullCPUSet(k.applicationCores),
+		Niceness:       args.Niceness,
+		AllowedCPUMask: mask,
+		SyscallFilters: args.SyscallFilters,
 	}
 	t, err := k.tasks.NewTask(config)
 	if err != nil {
 		return nil, err
 	}
+	t.recordProcessExec(ctx)
 
 	// Success.
 	if k.started {
@@ -666,6 +857,13 @@ func (k *Kernel) Start() error {
 	return nil
 }
 
+// timerFile is implemented by the FileOperations of files that own Timers,
+// such as timerfds and RTC devices.
+type timerFile interface {
+	PauseTimer()
+	ResumeTimer()
+}
+
 // pauseTimeLocked pauses all Timers and Timekeeper updates.
 //
 // Preconditions: Any task goroutines running in k must be stopped. k.extMu
@@ -690,7 +888,7 @@ func (k *Kernel) pauseTimeLocked() {
 		// but ktime.Timer.Pause is idempotent so this is harmless.
 		if fdm := t.tr.FDMap; fdm != nil {
 			for _, desc := range fdm.files {
-				if tfd, ok := desc.file.FileOperations.(*timerfd.TimerOperations); ok {
+				if tfd, ok := desc.file.FileOperations.(timerFile); ok {
 					tfd.PauseTimer()
 				}
 			}
@@ -717,7 +915,7 @@ func (k *Kernel) resumeTimeLocked() {
 		}
 		if fdm := t.tr.FDMap; fdm != nil {
 			for _, desc := range fdm.files {
-				if tfd, ok := desc.file.FileOperations.(*timerfd.TimerOperations); ok {
+				if tfd, ok := desc.file.FileOperations.(timerFile); ok {
 					tfd.ResumeTimer()
 				}
 			}
@@ -798,6 +996,18 @@ func (k *Kernel) RootIPCNamespace() *IPCNamespace {
 	return k.rootIPCNamespace
 }
 
+// RootPIDsController returns the root PIDsController, which limits the total
+// number of tasks in the kernel.
+func (k *Kernel) RootPIDsController() *PIDsController {
+	return k.rootPIDs
+}
+
+// Compat returns the CompatTracker that records unsupported operations
+// invoked by the application.
+func (k *Kernel) Compat() *CompatTracker {
+	return &k.compat
+}
+
 // RootMountNamespace returns the MountNamespace.
 func (k *Kernel) RootMountNamespace() *fs.MountNamespace {
 	k.extMu.Lock()
@@ -843,6 +1053,39 @@ func (k *Kernel) MonotonicClock() ktime.Clock {
 	return k.monotonicClock
 }
 
+// TAIClock returns the application CLOCK_TAI clock.
+func (k *Kernel) TAIClock() ktime.Clock {
+	return k.taiClock
+}
+
+// Adjtime implements adjtimex(2) for the application CLOCK_REALTIME clock, as
+// described by Timekeeper.Adjtime. The caller must check that the task may
+// adjust the clock.
+func (k *Kernel) Adjtime(txc *linux.Timex) (uintptr, error) {
+	state, stepped, err := k.timekeeper.Adjtime(txc)
+	if stepped {
+		k.notifyRealtimeSet()
+	}
+	return state, err
+}
+
+// SetRealtime steps the application CLOCK_REALTIME clock, and CLOCK_TAI with
+// it, to now.
+func (k *Kernel) SetRealtime(now ktime.Time) error {
+	if err := k.timekeeper.SetRealtime(now.Nanoseconds()); err != nil {
+		return err
+	}
+	k.notifyRealtimeSet()
+	return nil
+}
+
+// notifyRealtimeSet notifies timers of the realtime and TAI clocks that the
+// clocks were stepped.
+func (k *Kernel) notifyRealtimeSet() {
+	k.realtimeClock.Notify(ktime.ClockEventSet)
+	k.taiClock.Notify(ktime.ClockEventSet)
+}
+
 // CPUClockNow returns the current value of k.cpuClock.
 func (k *Kernel) CPUClockNow() uint64 {
 	return atomic.LoadUint64(&k.cpuClock)
@@ -960,7 +1203,8 @@ type kernelCPUClockListener struct {
 
 // Notify implements ktime.TimerListener.Notify.
 func (l kernelCPUClockListener) Notify(exp uint64) {
-	atomic.AddUint64(&l.k.cpuClock, exp)
+	now := atomic.AddUint64(&l.k.cpuClock, exp)
+	l.k.preemptTasks(now)
 }
 
 // Destroy implements ktime.TimerListener.Destroy.
@@ -0,0 +1,79 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"runtime"
+
+	ssync "gvisor.googlesource.com/gvisor/pkg/sync"
+)
+
+// Membarrier issues a memory barrier on every task other than t that is
+// executing application code, as for membarrier(2), and waits for the barrier
+// to complete on all of them before returning. If private is true, only tasks
+// that share t's MemoryManager are affected.
+//
+// Tasks that are executing application code are interrupted, which forces
+// them to switch to the sentry and back. The switch passes through the host
+// kernel, which both orders memory accesses and serializes the instruction
+// stream, so Membarrier also satisfies
+// MEMBARRIER_CMD_PRIVATE_EXPEDITED_SYNC_CORE. Tasks that are not executing
+// application code will pass through the host kernel before they next do so,
+// and so need not be interrupted.
+//
+// Preconditions: The caller must be running on the task goroutine.
+func (t *Task) Membarrier(private bool) {
+	type target struct {
+		t     *Task
+		epoch ssync.SeqCountEpoch
+	}
+	var targets []target
+
+	m := t.MemoryManager()
+	t.tg.pidns.owner.mu.RLock()
+	for ot := range t.tg.pidns.owner.Root.tids {
+		if ot == t {
+			continue
+		}
+		if private {
+			ot.mu.Lock()
+			shared := ot.MemoryManager() == m
+			ot.mu.Unlock()
+			if !shared {
+				continue
+			}
+		}
+		epoch := ot.goschedSeq.BeginRead()
+		info := ot.TaskGoroutineSchedInfo()
+		if !ot.goschedSeq.ReadOk(epoch) || info.State != TaskGoroutineRunningApp {
+			// ot has switched between application code and the sentry since
+			// Membarrier was called, or will do so before executing more
+			// application code.
+			continue
+		}
+		ot.p.Interrupt()
+		targets = append(targets, target{ot, epoch})
+	}
+	t.tg.pidns.owner.mu.RUnlock()
+
+	// Wait for each interrupted task to leave application code. Since each
+	// task's state changes when it does so, this requires only that the
+	// interrupted task goroutines get to run.
+	for _, tgt := range targets {
+		for tgt.t.goschedSeq.ReadOk(tgt.epoch) {
+			runtime.Gosched()
+		}
+	}
+}
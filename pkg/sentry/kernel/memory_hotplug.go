@@ -0,0 +1,63 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"fmt"
+
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usage"
+)
+
+// MemoryBlockSize is the size of the memory blocks in
+// /sys/devices/system/memory, as on x86_64 Linux.
+const MemoryBlockSize = 128 << 20
+
+// MemoryBlocks returns the number of memory blocks of the total memory that
+// is reported to applications.
+func (k *Kernel) MemoryBlocks() int {
+	total := usage.TotalMemory(k.Platform.Memory().TotalSize(), 0)
+	return int((total + MemoryBlockSize - 1) / MemoryBlockSize)
+}
+
+// SetMemoryLimit sets the memory limit of the sandbox, which is reported to
+// applications as the total memory, in /proc/meminfo and sysinfo(2). A limit
+// of 0 removes the limit. Memory blocks added or removed by the change are
+// announced with uevents, as Linux does for memory hotplug, so that
+// applications can resize their heaps.
+func (k *Kernel) SetMemoryLimit(limit uint64) {
+	k.memoryLimitMu.Lock()
+	defer k.memoryLimitMu.Unlock()
+
+	before := k.MemoryBlocks()
+	usage.SetMemoryLimit(limit)
+	after := k.MemoryBlocks()
+	for i := before; i < after; i++ {
+		k.SendUEvent(memoryBlockUEvent("add", i))
+		k.SendUEvent(memoryBlockUEvent("online", i))
+	}
+	for i := before - 1; i >= after; i-- {
+		k.SendUEvent(memoryBlockUEvent("offline", i))
+		k.SendUEvent(memoryBlockUEvent("remove", i))
+	}
+}
+
+// memoryBlockUEvent returns the uevent of the given action on a memory block.
+func memoryBlockUEvent(action string, block int) UEvent {
+	return UEvent{
+		Action:    action,
+		DevPath:   fmt.Sprintf("/devices/system/memory/memory%d", block),
+		Subsystem: "memory",
+	}
+}
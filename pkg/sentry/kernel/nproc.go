@@ -0,0 +1,96 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"sync"
+
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/limits"
+	"gvisor.googlesource.com/gvisor/pkg/syserror"
+)
+
+// userProcesses counts the tasks belonging to each user, for enforcement of
+// RLIMIT_NPROC. A task belongs to the user that is its real UID. This is
+// analogous to Linux's user_struct.processes.
+type userProcesses struct {
+	// mu protects counts. mu is a leaf lock: it may be locked with any other
+	// kernel lock held.
+	mu sync.Mutex `state:"nosave"`
+
+	// counts maps each user to the number of tasks that belong to it. Users
+	// with no tasks have no entry.
+	counts map[auth.KUID]uint64
+}
+
+// newUserProcesses returns a userProcesses with no tasks.
+func newUserProcesses() userProcesses {
+	return userProcesses{counts: make(map[auth.KUID]uint64)}
+}
+
+// count returns the number of tasks that belong to uid.
+func (up *userProcesses) count(uid auth.KUID) uint64 {
+	up.mu.Lock()
+	defer up.mu.Unlock()
+	return up.counts[uid]
+}
+
+// tryInc adds a task with credentials creds, in a thread group with resource
+// limits ls. If the task's user already has at least RLIMIT_NPROC tasks,
+// tryInc returns EAGAIN, unless the user is root or creds has
+// CAP_SYS_RESOURCE or CAP_SYS_ADMIN in rootNS. Compare Linux's
+// kernel/fork.c:copy_process().
+func (up *userProcesses) tryInc(creds *auth.Credentials, ls *limits.LimitSet, rootNS *auth.UserNamespace) error {
+	uid := creds.RealKUID
+	up.mu.Lock()
+	defer up.mu.Unlock()
+	if up.counts[uid] >= ls.Get(limits.ProcessCount).Cur &&
+		uid != auth.RootKUID &&
+		!creds.HasCapabilityIn(linux.CAP_SYS_RESOURCE, rootNS) &&
+		!creds.HasCapabilityIn(linux.CAP_SYS_ADMIN, rootNS) {
+		return syserror.EAGAIN
+	}
+	up.counts[uid]++
+	return nil
+}
+
+// inc adds a task that belongs to uid, without checking RLIMIT_NPROC.
+func (up *userProcesses) inc(uid auth.KUID) {
+	up.mu.Lock()
+	defer up.mu.Unlock()
+	up.counts[uid]++
+}
+
+// dec removes a task that belongs to uid.
+func (up *userProcesses) dec(uid auth.KUID) {
+	up.mu.Lock()
+	defer up.mu.Unlock()
+	if up.counts[uid] <= 1 {
+		delete(up.counts, uid)
+		return
+	}
+	up.counts[uid]--
+}
+
+// transfer moves a task from user from to user to, as when a task changes
+// its real UID.
+func (up *userProcesses) transfer(from, to auth.KUID) {
+	if from == to {
+		return
+	}
+	up.dec(from)
+	up.inc(to)
+}
@@ -0,0 +1,70 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"testing"
+
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/limits"
+	"gvisor.googlesource.com/gvisor/pkg/syserror"
+)
+
+func TestUserProcesses(t *testing.T) {
+	ns := auth.NewRootUserNamespace()
+	ls := limits.NewLimitSet()
+	ls.SetUnchecked(limits.ProcessCount, limits.Limit{Cur: 2, Max: 2})
+
+	user := auth.NewUserCredentials(1000, 1000, nil, &auth.TaskCapabilities{}, ns)
+	privileged := auth.NewUserCredentials(1001, 1001, nil, nil, ns)
+	root := auth.NewUserCredentials(auth.RootKUID, 0, nil, &auth.TaskCapabilities{}, ns)
+
+	up := newUserProcesses()
+	for i := 0; i < 2; i++ {
+		if err := up.tryInc(user, ls, ns); err != nil {
+			t.Fatalf("tryInc(user) #%d got error %v, want nil", i, err)
+		}
+	}
+	if err := up.tryInc(user, ls, ns); err != syserror.EAGAIN {
+		t.Fatalf("tryInc(user) over RLIMIT_NPROC got error %v, want %v", err, syserror.EAGAIN)
+	}
+	if got, want := up.count(user.RealKUID), uint64(2); got != want {
+		t.Errorf("count(user) = %d, want %d", got, want)
+	}
+
+	// Root and users with CAP_SYS_RESOURCE or CAP_SYS_ADMIN are exempt.
+	for _, creds := range []*auth.Credentials{privileged, root} {
+		for i := 0; i < 3; i++ {
+			if err := up.tryInc(creds, ls, ns); err != nil {
+				t.Fatalf("tryInc(%d) #%d got error %v, want nil", creds.RealKUID, i, err)
+			}
+		}
+	}
+
+	// Moving a task to another user makes room for a new one.
+	up.transfer(user.RealKUID, privileged.RealKUID)
+	if err := up.tryInc(user, ls, ns); err != nil {
+		t.Fatalf("tryInc(user) after transfer got error %v, want nil", err)
+	}
+	if got, want := up.count(privileged.RealKUID), uint64(4); got != want {
+		t.Errorf("count(privileged) = %d, want %d", got, want)
+	}
+
+	up.dec(user.RealKUID)
+	up.dec(user.RealKUID)
+	if got, want := up.count(user.RealKUID), uint64(0); got != want {
+		t.Errorf("count(user) after dec = %d, want %d", got, want)
+	}
+}
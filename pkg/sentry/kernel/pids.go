@@ -0,0 +1,119 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"sync"
+
+	"gvisor.googlesource.com/gvisor/pkg/syserror"
+)
+
+// PIDsController limits the number of tasks that may exist in a set of thread
+// groups, analogous to the cgroup pids controller (Linux's
+// kernel/cgroup/pids.c). Controllers form a hierarchy: a task charged to a
+// controller is also charged to all of its ancestors, and creating the task
+// fails if any of them is at its limit.
+//
+// Every ThreadGroup has a PIDsController, inherited from its parent thread
+// group on fork. The Kernel's root controller, which all others descend from,
+// bounds the total number of tasks in the sandbox.
+type PIDsController struct {
+	// parent is the parent controller, or nil if this is a root controller.
+	// parent is immutable.
+	parent *PIDsController
+
+	// mu protects the fields below.
+	mu sync.Mutex `state:"nosave"`
+
+	// max is the maximum number of tasks that may be charged to this
+	// controller, analogous to pids.max. If max is 0, the controller is
+	// unlimited.
+	max uint64
+
+	// current is the number of tasks charged to this controller, analogous
+	// to pids.current.
+	current uint64
+}
+
+// NewPIDsController returns a new PIDsController that descends from parent,
+// which may be nil, and permits at most max tasks. If max is 0, the returned
+// controller imposes no limit of its own.
+func NewPIDsController(parent *PIDsController, max uint64) *PIDsController {
+	return &PIDsController{
+		parent: parent,
+		max:    max,
+	}
+}
+
+// Max returns c's limit, or 0 if c is unlimited.
+func (c *PIDsController) Max() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.max
+}
+
+// SetMax changes c's limit. If max is 0, c becomes unlimited. Lowering the
+// limit below the current number of tasks does not kill any tasks, but
+// prevents new tasks from being created until enough have exited.
+func (c *PIDsController) SetMax(max uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.max = max
+}
+
+// Current returns the number of tasks charged to c, including tasks charged
+// to its descendants.
+func (c *PIDsController) Current() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.current
+}
+
+// tryCharge charges a new task to c and all of its ancestors. If any of them
+// is at its limit, nothing is charged and tryCharge returns EAGAIN, as
+// fork(2) does when RLIMIT_NPROC or pids.max is reached.
+func (c *PIDsController) tryCharge() error {
+	for p := c; p != nil; p = p.parent {
+		p.mu.Lock()
+		if p.max != 0 && p.current >= p.max {
+			p.mu.Unlock()
+			// Roll back the charges to p's descendants.
+			for q := c; q != p; q = q.parent {
+				q.uncharge1()
+			}
+			return syserror.EAGAIN
+		}
+		p.current++
+		p.mu.Unlock()
+	}
+	return nil
+}
+
+// uncharge returns a task previously charged by tryCharge.
+func (c *PIDsController) uncharge() {
+	for p := c; p != nil; p = p.parent {
+		p.uncharge1()
+	}
+}
+
+// uncharge1 returns a task charged to c, but not to its ancestors.
+func (c *PIDsController) uncharge1() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.current == 0 {
+		panic("PIDsController uncharged more tasks than were charged")
+	}
+	c.current--
+}
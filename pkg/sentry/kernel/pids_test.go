@@ -0,0 +1,68 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"testing"
+
+	"gvisor.googlesource.com/gvisor/pkg/syserror"
+)
+
+func TestPIDsController(t *testing.T) {
+	root := NewPIDsController(nil, 3)
+	a := NewPIDsController(root, 2)
+	b := NewPIDsController(root, 0)
+
+	// a is limited by its own max.
+	for i := 0; i < 2; i++ {
+		if err := a.tryCharge(); err != nil {
+			t.Fatalf("a.tryCharge() #%d got error %v, want nil", i, err)
+		}
+	}
+	if err := a.tryCharge(); err != syserror.EAGAIN {
+		t.Fatalf("a.tryCharge() over a's limit got error %v, want %v", err, syserror.EAGAIN)
+	}
+
+	// b is limited by root's max, and a failed charge to b must not leave
+	// b charged.
+	if err := b.tryCharge(); err != nil {
+		t.Fatalf("b.tryCharge() got error %v, want nil", err)
+	}
+	if err := b.tryCharge(); err != syserror.EAGAIN {
+		t.Fatalf("b.tryCharge() over root's limit got error %v, want %v", err, syserror.EAGAIN)
+	}
+	if got, want := b.Current(), uint64(1); got != want {
+		t.Errorf("b.Current() = %d, want %d", got, want)
+	}
+	if got, want := root.Current(), uint64(3); got != want {
+		t.Errorf("root.Current() = %d, want %d", got, want)
+	}
+
+	// Uncharging a task in a makes room in root for b.
+	a.uncharge()
+	if err := b.tryCharge(); err != nil {
+		t.Fatalf("b.tryCharge() after a.uncharge() got error %v, want nil", err)
+	}
+
+	// Lowering a limit below the current count only blocks new tasks.
+	b.SetMax(1)
+	root.SetMax(0)
+	if err := b.tryCharge(); err != syserror.EAGAIN {
+		t.Fatalf("b.tryCharge() after lowering b's limit got error %v, want %v", err, syserror.EAGAIN)
+	}
+	if err := NewPIDsController(root, 0).tryCharge(); err != nil {
+		t.Fatalf("tryCharge() on unlimited controller got error %v, want nil", err)
+	}
+}
@@ -328,6 +328,12 @@ func (p *Pipe) rwReadiness() waiter.EventMask {
 	return p.rReadinessLocked() | p.wReadinessLocked()
 }
 
+// HeapBytes returns the number of bytes of sentry heap held by the data
+// buffered in the pipe.
+func (p *Pipe) HeapBytes() uint64 {
+	return uint64(p.queuedSize())
+}
+
 func (p *Pipe) queuedSize() int {
 	p.mu.Lock()
 	defer p.mu.Unlock()
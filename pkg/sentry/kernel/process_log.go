@@ -0,0 +1,371 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"sync"
+
+	"gvisor.googlesource.com/gvisor/pkg/eventchannel"
+	"gvisor.googlesource.com/gvisor/pkg/log"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
+	pb "gvisor.googlesource.com/gvisor/pkg/sentry/kernel/process_log_go_proto"
+	ktime "gvisor.googlesource.com/gvisor/pkg/sentry/kernel/time"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/mm"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
+)
+
+// maxProcessEventArgs is the maximum number of bytes of a new program's
+// arguments that are recorded in a ProcessEvent.
+const maxProcessEventArgs = 4096
+
+// maxBinaryDigests is the maximum number of digests of executables that are
+// cached by a ProcessLog.
+const maxBinaryDigests = 256
+
+// ProcessEventType is the type of a ProcessEvent.
+type ProcessEventType string
+
+const (
+	// ProcessFork is the creation of a process by fork(2) or clone(2)
+	// without CLONE_THREAD.
+	ProcessFork ProcessEventType = "fork"
+
+	// ProcessExec is the execution of a new program, by execve(2) or when a
+	// process is started by the sandbox.
+	ProcessExec ProcessEventType = "exec"
+
+	// ProcessExit is the exit of the last task of a process.
+	ProcessExit ProcessEventType = "exit"
+)
+
+// protoTypes maps ProcessEventTypes to their protobuf equivalents.
+var protoTypes = map[ProcessEventType]pb.ProcessEvent_Type{
+	ProcessFork: pb.ProcessEvent_FORK,
+	ProcessExec: pb.ProcessEvent_EXEC,
+	ProcessExit: pb.ProcessEvent_EXIT,
+}
+
+// ProcessEvent is a change to the process tree of the sandbox. Thread IDs are
+// in the root PID namespace.
+type ProcessEvent struct {
+	// Seq is the sequence number of the event. Sequence numbers are
+	// consecutive, so a gap between events indicates that the events in
+	// between were dropped from the log.
+	Seq uint64 `json:"seq"`
+
+	Type ProcessEventType `json:"type"`
+
+	// Time is the time of the event, in nanoseconds since the Unix epoch.
+	Time int64 `json:"time"`
+
+	// PID and PPID are the thread group IDs of the process and its parent.
+	PID  ThreadID `json:"pid"`
+	PPID ThreadID `json:"ppid"`
+
+	// Argv are the arguments of the new program, truncated to
+	// maxProcessEventArgs bytes. Set for ProcessExec only.
+	Argv []string `json:"argv,omitempty"`
+
+	// EnvHash is the hex-encoded SHA-256 digest of the environment of the
+	// new program, as shown in /proc/[pid]/environ. Set for ProcessExec
+	// only.
+	EnvHash string `json:"env_hash,omitempty"`
+
+	// Cwd is the working directory of the process. Set for ProcessExec only.
+	Cwd string `json:"cwd,omitempty"`
+
+	// Binary and BinaryDigest are the path and the hex-encoded SHA-256
+	// digest of the executable. Set for ProcessExec only.
+	Binary       string `json:"binary,omitempty"`
+	BinaryDigest string `json:"binary_digest,omitempty"`
+
+	// ExitStatus is the exit status of the process, as returned by wait(2).
+	// Set for ProcessExit only.
+	ExitStatus uint32 `json:"exit_status,omitempty"`
+}
+
+// ProcessLog keeps the most recent ProcessEvents, and emits each of them on
+// the eventchannel.
+type ProcessLog struct {
+	// size is the maximum number of events that are kept. size is
+	// immutable.
+	size int
+
+	// mu protects the fields below.
+	mu sync.Mutex `state:"nosave"`
+
+	// events is a ring buffer of the most recent events. next is the index
+	// of the next event in events once it is full.
+	events []ProcessEvent
+	next   int
+
+	// seq is the sequence number of the next event.
+	seq uint64
+
+	// digestsMu protects digests. It is distinct from mu since digests are
+	// computed without holding it.
+	digestsMu sync.Mutex `state:"nosave"`
+
+	// digests caches the digests of executables, so that a program that is
+	// executed repeatedly is only read once. Each entry holds a reference on
+	// its inode, so that the inode number isn't reused by another inode
+	// while it is cached. Inode numbers are not stable across save and
+	// restore, so digests is not saved.
+	digests map[digestKey]digestEntry `state:"nosave"`
+}
+
+// digestKey identifies an inode.
+type digestKey struct {
+	dev uint64
+	ino uint64
+}
+
+// digestEntry is the digest of the contents of inode when it had the given
+// modification time and size.
+type digestEntry struct {
+	inode  *fs.Inode
+	mtime  ktime.Time
+	size   int64
+	digest string
+}
+
+// NewProcessLog returns a ProcessLog that keeps the size most recent events.
+func NewProcessLog(size int) *ProcessLog {
+	return &ProcessLog{size: size}
+}
+
+// Events returns the events in the log, oldest first. Events returns nil if
+// l is nil.
+func (l *ProcessLog) Events() []ProcessEvent {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	events := make([]ProcessEvent, 0, len(l.events))
+	events = append(events, l.events[l.next:]...)
+	return append(events, l.events[:l.next]...)
+}
+
+// record assigns e a sequence number, adds it to the log and emits it.
+func (l *ProcessLog) record(e ProcessEvent) {
+	l.mu.Lock()
+	e.Seq = l.seq
+	l.seq++
+	if len(l.events) < l.size {
+		l.events = append(l.events, e)
+	} else {
+		l.events[l.next] = e
+		l.next = (l.next + 1) % l.size
+	}
+	l.mu.Unlock()
+
+	eventchannel.Emit(&pb.ProcessEvent{
+		Seq:          e.Seq,
+		Type:         protoTypes[e.Type],
+		TimeNs:       e.Time,
+		Pid:          int32(e.PID),
+		Ppid:         int32(e.PPID),
+		Argv:         e.Argv,
+		EnvHash:      e.EnvHash,
+		Cwd:          e.Cwd,
+		Binary:       e.Binary,
+		BinaryDigest: e.BinaryDigest,
+		ExitStatus:   e.ExitStatus,
+	})
+}
+
+// ProcessLog returns the process log of k, or nil if process events are not
+// recorded.
+func (k *Kernel) ProcessLog() *ProcessLog {
+	return k.processLog
+}
+
+// recordProcessEvent fills in the process of t and the time of e, and records
+// it in the process log, if enabled.
+//
+// Preconditions: The TaskSet mutex must be unlocked.
+func (t *Task) recordProcessEvent(e ProcessEvent) {
+	l := t.k.processLog
+	if l == nil {
+		return
+	}
+	ts := t.k.tasks
+	ts.mu.RLock()
+	leader := t.tg.leader
+	e.PID = ts.Root.tids[leader]
+	if leader.parent != nil {
+		e.PPID = ts.Root.tids[leader.parent.tg.leader]
+	}
+	ts.mu.RUnlock()
+	e.Time = t.k.RealtimeClock().Now().Nanoseconds()
+	l.record(e)
+}
+
+// recordProcessExec records the execution of t's current program in the
+// process log, if enabled. ctx is used to read the program's arguments,
+// environment and executable.
+//
+// Preconditions: The TaskSet mutex must be unlocked.
+func (t *Task) recordProcessExec(ctx context.Context) {
+	if t.k.processLog == nil {
+		return
+	}
+	root := t.FSContext().RootDirectory()
+	if root == nil {
+		return
+	}
+	defer root.DecRef()
+	m := t.MemoryManager()
+	redaction := t.tg.redaction
+
+	e := ProcessEvent{
+		Type:   ProcessExec,
+		Binary: redaction.Path(executablePath(m, root)),
+	}
+	args := readExecArg(ctx, m, m.ArgvStart(), m.ArgvEnd(), maxProcessEventArgs)
+	for _, arg := range bytes.SplitAfter(args, []byte{0}) {
+		if len(arg) == 0 {
+			continue
+		}
+		e.Argv = append(e.Argv, redaction.Arg(string(bytes.TrimSuffix(arg, []byte{0}))))
+	}
+	env := sha256.Sum256(readExecArg(ctx, m, m.EnvvStart(), m.EnvvEnd(), -1))
+	e.EnvHash = hex.EncodeToString(env[:])
+	if wd := t.FSContext().WorkingDirectory(); wd != nil {
+		e.Cwd, _ = wd.FullName(root)
+		e.Cwd = redaction.Path(e.Cwd)
+		wd.DecRef()
+	}
+	if exe := m.Executable(); exe != nil {
+		digest, err := t.k.processLog.binaryDigest(ctx, exe)
+		if err != nil {
+			log.Warningf("Failed to compute digest of %q: %v", e.Binary, err)
+		}
+		e.BinaryDigest = digest
+		exe.DecRef()
+	}
+	t.recordProcessEvent(e)
+}
+
+// readExecArg returns the contents of [start, end) in m, truncated to max
+// bytes unless max is negative.
+func readExecArg(ctx context.Context, m *mm.MemoryManager, start, end usermem.Addr, max int) []byte {
+	if start == 0 || end <= start {
+		return nil
+	}
+	n := int(end - start)
+	if max >= 0 && n > max {
+		n = max
+	}
+	buf := make([]byte, n)
+	n, _ = m.CopyIn(ctx, start, buf, usermem.IOOpts{IgnorePermissions: true})
+	return buf[:n]
+}
+
+// binaryDigest returns the hex-encoded SHA-256 digest of the contents of d,
+// reusing the digest computed by a previous call if the inode of d has the
+// same modification time and size. Digests of inodes whose attributes may be
+// cached in the sentry are not reused, as the attributes may not reflect
+// changes made outside of it.
+func (l *ProcessLog) binaryDigest(ctx context.Context, d *fs.Dirent) (string, error) {
+	compute := func() (string, error) {
+		return fileDigest(ctx, d)
+	}
+	if d.Inode.MountSource.CachesAttributes(d.Inode) {
+		return compute()
+	}
+	uattr, err := d.Inode.UnstableAttr(ctx)
+	if err != nil {
+		return "", err
+	}
+	return l.cachedDigest(d.Inode, uattr.ModificationTime, uattr.Size, compute)
+}
+
+// cachedDigest returns the digest cached for inode if it was computed when
+// inode had modification time mtime and size size. Otherwise, it returns the
+// digest returned by compute, and caches it.
+func (l *ProcessLog) cachedDigest(inode *fs.Inode, mtime ktime.Time, size int64, compute func() (string, error)) (string, error) {
+	key := digestKey{dev: inode.StableAttr.DeviceID, ino: inode.StableAttr.InodeID}
+	l.digestsMu.Lock()
+	e, ok := l.digests[key]
+	l.digestsMu.Unlock()
+	if ok && e.inode == inode && e.mtime.Equal(mtime) && e.size == size {
+		return e.digest, nil
+	}
+
+	digest, err := compute()
+	if err != nil {
+		return "", err
+	}
+
+	// The references on replaced and evicted inodes are dropped without
+	// holding digestsMu, as releasing an inode may block.
+	var released *fs.Inode
+	defer func() {
+		if released != nil {
+			released.DecRef()
+		}
+	}()
+
+	l.digestsMu.Lock()
+	defer l.digestsMu.Unlock()
+	if l.digests == nil {
+		l.digests = make(map[digestKey]digestEntry)
+	}
+	if old, ok := l.digests[key]; ok {
+		released = old.inode
+	} else if len(l.digests) >= maxBinaryDigests {
+		// Evict an arbitrary entry.
+		for k, old := range l.digests {
+			released = old.inode
+			delete(l.digests, k)
+			break
+		}
+	}
+	inode.IncRef()
+	l.digests[key] = digestEntry{inode: inode, mtime: mtime, size: size, digest: digest}
+	return digest, nil
+}
+
+// fileDigest returns the hex-encoded SHA-256 digest of the contents of d.
+func fileDigest(ctx context.Context, d *fs.Dirent) (string, error) {
+	f, err := d.Inode.GetFile(ctx, d, fs.FileFlags{Read: true})
+	if err != nil {
+		return "", err
+	}
+	defer f.DecRef()
+
+	h := sha256.New()
+	buf := make([]byte, 64*1024)
+	var off int64
+	for {
+		n, err := f.Preadv(ctx, usermem.BytesIOSequence(buf), off)
+		h.Write(buf[:n])
+		off += n
+		if err == io.EOF || (err == nil && n == 0) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
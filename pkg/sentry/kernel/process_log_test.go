@@ -0,0 +1,139 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"fmt"
+	"testing"
+
+	"gvisor.googlesource.com/gvisor/pkg/sentry/context/contexttest"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
+	ktime "gvisor.googlesource.com/gvisor/pkg/sentry/kernel/time"
+	"gvisor.googlesource.com/gvisor/pkg/syserror"
+)
+
+func TestProcessLog(t *testing.T) {
+	l := NewProcessLog(3)
+	if got := l.Events(); len(got) != 0 {
+		t.Errorf("Events() on empty log = %v, want none", got)
+	}
+	for pid := ThreadID(1); pid <= 5; pid++ {
+		l.record(ProcessEvent{Type: ProcessFork, PID: pid})
+	}
+
+	// Only the 3 most recent events are kept, oldest first.
+	got := l.Events()
+	if len(got) != 3 {
+		t.Fatalf("Events() returned %d events, want 3", len(got))
+	}
+	for i, e := range got {
+		if wantSeq, wantPID := uint64(i+2), ThreadID(i+3); e.Seq != wantSeq || e.PID != wantPID {
+			t.Errorf("Events()[%d] has seq %d and pid %d, want seq %d and pid %d", i, e.Seq, e.PID, wantSeq, wantPID)
+		}
+	}
+
+	// A nil log has no events.
+	var nilLog *ProcessLog
+	if got := nilLog.Events(); got != nil {
+		t.Errorf("Events() on nil log = %v, want nil", got)
+	}
+}
+
+func TestProcessLogDigestCache(t *testing.T) {
+	ctx := contexttest.Context(t)
+	msrc := fs.NewMockMountSource(nil)
+	newInode := func(dev, ino uint64) *fs.Inode {
+		return fs.NewMockInode(ctx, msrc, fs.StableAttr{DeviceID: dev, InodeID: ino})
+	}
+
+	l := NewProcessLog(1)
+	computed := 0
+	digest := func(inode *fs.Inode, mtime ktime.Time, size int64) string {
+		d, err := l.cachedDigest(inode, mtime, size, func() (string, error) {
+			computed++
+			return fmt.Sprintf("digest%d", computed), nil
+		})
+		if err != nil {
+			t.Fatalf("cachedDigest failed: %v", err)
+		}
+		return d
+	}
+
+	a := newInode(1, 1)
+	b := newInode(1, 2)
+	mtime := ktime.FromSeconds(1)
+	for _, tc := range []struct {
+		name  string
+		inode *fs.Inode
+		mtime ktime.Time
+		size  int64
+		want  string
+	}{
+		{"first", a, mtime, 10, "digest1"},
+		{"cached", a, mtime, 10, "digest1"},
+		{"other inode", b, mtime, 10, "digest2"},
+		{"modified", a, ktime.FromSeconds(2), 10, "digest3"},
+		{"resized", a, ktime.FromSeconds(2), 20, "digest4"},
+		{"cached again", a, ktime.FromSeconds(2), 20, "digest4"},
+		{"other inode cached", b, mtime, 10, "digest2"},
+	} {
+		if got := digest(tc.inode, tc.mtime, tc.size); got != tc.want {
+			t.Errorf("%s: got digest %q, want %q", tc.name, got, tc.want)
+		}
+	}
+
+	// The cache holds one reference on each cached inode.
+	if refs := a.ReadRefs(); refs != 2 {
+		t.Errorf("cached inode has %d references, want 2", refs)
+	}
+
+	// Another inode with the same number, size and modification time
+	// doesn't get the digest of the cached one, and replaces it.
+	alias := newInode(1, 1)
+	if got := digest(alias, ktime.FromSeconds(2), 20); got != "digest5" {
+		t.Errorf("got digest %q for aliasing inode, want digest5", got)
+	}
+	if refs := a.ReadRefs(); refs != 1 {
+		t.Errorf("replaced inode has %d references, want 1", refs)
+	}
+
+	// Errors are not cached.
+	c := newInode(2, 0)
+	if _, err := l.cachedDigest(c, mtime, 0, func() (string, error) {
+		return "", syserror.EIO
+	}); err != syserror.EIO {
+		t.Errorf("cachedDigest returned error %v, want %v", err, syserror.EIO)
+	}
+	if got := digest(c, mtime, 0); got != "digest6" {
+		t.Errorf("got digest %q after error, want digest6", got)
+	}
+
+	// The cache is bounded, and drops the references on evicted inodes.
+	inodes := make([]*fs.Inode, 2*maxBinaryDigests)
+	for i := range inodes {
+		inodes[i] = newInode(3, uint64(i))
+		digest(inodes[i], mtime, 0)
+	}
+	if n := len(l.digests); n > maxBinaryDigests {
+		t.Errorf("cache has %d entries, want at most %d", n, maxBinaryDigests)
+	}
+	var held int
+	for _, inode := range inodes {
+		held += int(inode.ReadRefs() - 1)
+	}
+	if held > maxBinaryDigests {
+		t.Errorf("cache holds %d references, want at most %d", held, maxBinaryDigests)
+	}
+}
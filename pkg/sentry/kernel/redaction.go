@@ -0,0 +1,133 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// redacted replaces redacted values.
+const redacted = "[redacted]"
+
+// RedactionPolicy masks secrets in the payloads of strace output and of
+// process and audit events, so that tracing can be enabled without leaking
+// credentials into logs.
+//
+// Environment variables are identified by name, and their values are masked
+// wherever a NAME=value string appears, including in argv. Paths are masked
+// if they, or any of their ancestor directories, match a pattern; the longest
+// unmatched prefix is kept.
+//
+// Patterns use filepath.Match syntax. As for SyscallOriginPolicy, a path
+// pattern containing a '/' is matched against whole absolute paths; other
+// patterns are matched against a single path component, so that "*.pem"
+// masks such files wherever they appear, even in relative paths.
+//
+// Every ThreadGroup may have a RedactionPolicy, inherited from its parent
+// thread group on fork. A nil *RedactionPolicy masks nothing.
+//
+// RedactionPolicy is immutable.
+type RedactionPolicy struct {
+	// env are the patterns for environment variable names.
+	env []string
+
+	// paths are the patterns for paths.
+	paths []string
+}
+
+// NewRedactionPolicy returns a RedactionPolicy that masks the values of
+// environment variables whose names match env, and paths matching paths.
+func NewRedactionPolicy(env, paths []string) (*RedactionPolicy, error) {
+	for _, patterns := range [][]string{env, paths} {
+		for _, pattern := range patterns {
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid pattern %q: %v", pattern, err)
+			}
+		}
+	}
+	return &RedactionPolicy{
+		env:   env,
+		paths: paths,
+	}, nil
+}
+
+// Env returns kv, an environment variable of the form NAME=value, with the
+// value masked if p redacts NAME. Strings not of that form are returned
+// unchanged.
+func (p *RedactionPolicy) Env(kv string) string {
+	if p == nil {
+		return kv
+	}
+	i := strings.IndexByte(kv, '=')
+	if i <= 0 {
+		return kv
+	}
+	name := kv[:i]
+	for _, pattern := range p.env {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return name + "=" + redacted
+		}
+	}
+	return kv
+}
+
+// Path returns path with the first component that p redacts, and everything
+// below it, masked.
+func (p *RedactionPolicy) Path(path string) string {
+	if p == nil || len(p.paths) == 0 {
+		return path
+	}
+	// Walk down from the root, so that the outermost match is masked.
+	for i := 0; i <= len(path); i++ {
+		if i != len(path) && path[i] != '/' {
+			continue
+		}
+		prefix := path[:i]
+		if prefix == "" || strings.HasSuffix(prefix, "/") {
+			continue
+		}
+		if p.matchPath(prefix) {
+			return prefix[:strings.LastIndexByte(prefix, '/')+1] + redacted
+		}
+	}
+	return path
+}
+
+// matchPath returns true if path, whose last component is being considered,
+// matches any of p's path patterns.
+func (p *RedactionPolicy) matchPath(path string) bool {
+	base := path[strings.LastIndexByte(path, '/')+1:]
+	for _, pattern := range p.paths {
+		name := base
+		if strings.Contains(pattern, "/") {
+			name = path
+		}
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Arg returns arg, a program argument, with any environment variable
+// assignment or absolute path that p redacts masked.
+func (p *RedactionPolicy) Arg(arg string) string {
+	if strings.HasPrefix(arg, "/") {
+		return p.Path(arg)
+	}
+	return p.Env(arg)
+}
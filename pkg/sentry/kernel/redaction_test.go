@@ -0,0 +1,75 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"testing"
+)
+
+func TestRedactionPolicy(t *testing.T) {
+	p, err := NewRedactionPolicy([]string{"DB_PASSWORD", "*_TOKEN"}, []string{"/run/secrets", "*.pem"})
+	if err != nil {
+		t.Fatalf("NewRedactionPolicy failed: %v", err)
+	}
+	for _, test := range []struct {
+		arg  string
+		want string
+	}{
+		{"DB_PASSWORD=hunter2", "DB_PASSWORD=[redacted]"},
+		{"GITHUB_TOKEN=abc", "GITHUB_TOKEN=[redacted]"},
+		{"GITHUB_TOKEN=", "GITHUB_TOKEN=[redacted]"},
+		{"HOME=/root", "HOME=/root"},
+		{"DB_PASSWORD", "DB_PASSWORD"},
+		{"=DB_PASSWORD", "=DB_PASSWORD"},
+		{"--verbose", "--verbose"},
+		{"/run/secrets", "/run/[redacted]"},
+		{"/run/secrets/db/password", "/run/[redacted]"},
+		{"/run/secretsfoo", "/run/secretsfoo"},
+		{"/etc/ssl/server.pem", "/etc/ssl/[redacted]"},
+		{"/etc/ssl/server.pem/key", "/etc/ssl/[redacted]"},
+		{"/etc/ssl/server.crt", "/etc/ssl/server.crt"},
+		{"/", "/"},
+	} {
+		if got := p.Arg(test.arg); got != test.want {
+			t.Errorf("Arg(%q) = %q, want %q", test.arg, got, test.want)
+		}
+	}
+
+	// Relative paths are masked by patterns without a '/'.
+	if got, want := p.Path("certs/server.pem"), "certs/[redacted]"; got != want {
+		t.Errorf("Path(%q) = %q, want %q", "certs/server.pem", got, want)
+	}
+	if got, want := p.Path("server.pem"), "[redacted]"; got != want {
+		t.Errorf("Path(%q) = %q, want %q", "server.pem", got, want)
+	}
+
+	// A nil policy masks nothing.
+	var nilPolicy *RedactionPolicy
+	if got := nilPolicy.Arg("DB_PASSWORD=hunter2"); got != "DB_PASSWORD=hunter2" {
+		t.Errorf("nil policy Arg(%q) = %q, want unchanged", "DB_PASSWORD=hunter2", got)
+	}
+	if got := nilPolicy.Path("/run/secrets/db"); got != "/run/secrets/db" {
+		t.Errorf("nil policy Path(%q) = %q, want unchanged", "/run/secrets/db", got)
+	}
+}
+
+func TestRedactionPolicyBadPattern(t *testing.T) {
+	if _, err := NewRedactionPolicy([]string{"["}, nil); err == nil {
+		t.Errorf("NewRedactionPolicy with malformed env pattern succeeded")
+	}
+	if _, err := NewRedactionPolicy(nil, []string{"/run/["}); err == nil {
+		t.Errorf("NewRedactionPolicy with malformed path pattern succeeded")
+	}
+}
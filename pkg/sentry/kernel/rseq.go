@@ -15,6 +15,9 @@
 package kernel
 
 import (
+	"fmt"
+
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/hostcpu"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
 	"gvisor.googlesource.com/gvisor/pkg/syserror"
@@ -88,31 +91,187 @@ func (t *Task) SetRSEQCPUAddr(addr usermem.Addr) error {
 	if addr != 0 {
 		if err := t.rseqCopyOutCPU(); err != nil {
 			t.rseqCPUAddr = 0
-			t.rseqCPU = -1
+			if t.rseqAddr == 0 {
+				t.rseqCPU = -1
+			}
 			return syserror.EINVAL // yes, EINVAL, not err or EFAULT
 		}
-	} else {
+	} else if t.rseqAddr == 0 {
 		t.rseqCPU = -1
 	}
 	return nil
 }
 
+// SetRSeq registers the linux.RSeq at addr as t's restartable sequence area,
+// as for rseq(2). The CPU number in the linux.RSeq is updated before t
+// returns to application code.
+//
+// Preconditions: t.RSEQAvailable() == true. The caller must be running on the
+// task goroutine.
+func (t *Task) SetRSeq(addr usermem.Addr, length, signature uint32) error {
+	if t.rseqAddr != 0 {
+		if t.rseqAddr != addr || length != linux.SizeOfRSeq {
+			return syserror.EINVAL
+		}
+		if t.rseqSignature != signature {
+			return syserror.EPERM
+		}
+		return syserror.EBUSY
+	}
+	if addr == 0 || addr%linux.AlignOfRSeq != 0 || length != linux.SizeOfRSeq {
+		return syserror.EINVAL
+	}
+	if _, ok := addr.ToRange(linux.SizeOfRSeq); !ok {
+		return syserror.EFAULT
+	}
+	t.rseqAddr = addr
+	t.rseqSignature = signature
+	t.rseqPreempted = true
+	return nil
+}
+
+// ClearRSeq unregisters t's restartable sequence area, as for rseq(2) with
+// RSEQ_FLAG_UNREGISTER. addr, length and signature must match the arguments
+// to the SetRSeq call that registered it.
+//
+// Preconditions: t.RSEQAvailable() == true. The caller must be running on the
+// task goroutine. t's AddressSpace must be active.
+func (t *Task) ClearRSeq(addr usermem.Addr, length, signature uint32) error {
+	if t.rseqAddr == 0 || t.rseqAddr != addr || length != linux.SizeOfRSeq {
+		return syserror.EINVAL
+	}
+	if t.rseqSignature != signature {
+		return syserror.EPERM
+	}
+
+	// Reset the CPU numbers, as in kernel/rseq.c:rseq_reset_rseq_cpu_id().
+	buf := t.CopyScratchBuffer(8)
+	usermem.ByteOrder.PutUint32(buf, 0)
+	cpuID := int32(linux.RSEQ_CPU_ID_UNINITIALIZED)
+	usermem.ByteOrder.PutUint32(buf[4:], uint32(cpuID))
+	if _, err := t.CopyOutBytes(t.rseqAddr, buf); err != nil {
+		return syserror.EFAULT
+	}
+
+	t.rseqAddr = 0
+	t.rseqSignature = 0
+	if t.rseqCPUAddr == 0 {
+		t.rseqCPU = -1
+	}
+	return nil
+}
+
+// rseqCopyOutCPU writes t's current CPU number to rseqCPUAddr and to the CPU
+// number fields of the linux.RSeq at rseqAddr, if they are set.
+//
 // Preconditions: The caller must be running on the task goroutine. t's
 // AddressSpace must be active.
 func (t *Task) rseqCopyOutCPU() error {
 	t.rseqCPU = int32(hostcpu.GetCPU())
-	buf := t.CopyScratchBuffer(4)
-	usermem.ByteOrder.PutUint32(buf, uint32(t.rseqCPU))
-	_, err := t.CopyOutBytes(t.rseqCPUAddr, buf)
-	return err
+	if t.rseqCPUAddr != 0 {
+		buf := t.CopyScratchBuffer(4)
+		usermem.ByteOrder.PutUint32(buf, uint32(t.rseqCPU))
+		if _, err := t.CopyOutBytes(t.rseqCPUAddr, buf); err != nil {
+			return err
+		}
+	}
+	if t.rseqAddr != 0 {
+		// Update both RSeq.CPUIDStart and RSeq.CPUID.
+		buf := t.CopyScratchBuffer(8)
+		usermem.ByteOrder.PutUint32(buf, uint32(t.rseqCPU))
+		usermem.ByteOrder.PutUint32(buf[4:], uint32(t.rseqCPU))
+		if _, err := t.CopyOutBytes(t.rseqAddr, buf); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-// Preconditions: The caller must be running on the task goroutine.
-func (t *Task) rseqInterrupt() {
+// rseqInterrupt interrupts t's restartable sequence critical section, if its
+// instruction pointer is in one. It returns false if the critical section
+// described by t's linux.RSeq is invalid or cannot be read, in which case
+// SIGSEGV has been sent to t.
+//
+// Preconditions: The caller must be running on the task goroutine. t's
+// AddressSpace must be active.
+func (t *Task) rseqInterrupt() bool {
 	rscr := t.tg.rscr.Load().(*RSEQCriticalRegion)
 	if ip := t.Arch().IP(); rscr.CriticalSection.Contains(usermem.Addr(ip)) {
 		t.Debugf("Interrupted RSEQ critical section at %#x; restarting at %#x", ip, rscr.Restart)
 		t.Arch().SetIP(uintptr(rscr.Restart))
 		t.Arch().SetRSEQInterruptedIP(ip)
 	}
+
+	if t.rseqAddr == 0 {
+		return true
+	}
+	if err := t.rseqAddrInterrupt(); err != nil {
+		t.Warningf("Failed to interrupt RSEQ critical section described by %#x: %v", t.rseqAddr, err)
+		t.forceSignal(linux.SIGSEGV, false)
+		t.SendSignal(sigPriv(linux.SIGSEGV))
+		return false
+	}
+	return true
+}
+
+// rseqAddrInterrupt implements rseqInterrupt for the critical section
+// described by the linux.RSeq at t.rseqAddr, following
+// kernel/rseq.c:rseq_ip_fixup().
+//
+// Preconditions: t.rseqAddr != 0. The caller must be running on the task
+// goroutine. t's AddressSpace must be active.
+func (t *Task) rseqAddrInterrupt() error {
+	var rseq linux.RSeq
+	if _, err := t.CopyIn(t.rseqAddr, &rseq); err != nil {
+		return err
+	}
+	if rseq.RSeqCriticalSection == 0 {
+		return nil
+	}
+
+	var cs linux.RSeqCriticalSection
+	if _, err := t.CopyIn(usermem.Addr(rseq.RSeqCriticalSection), &cs); err != nil {
+		return err
+	}
+	if cs.Version != 0 {
+		return fmt.Errorf("unknown critical section version %d", cs.Version)
+	}
+	csRange, ok := usermem.Addr(cs.Start).ToRange(cs.PostCommitOffset)
+	if !ok {
+		return fmt.Errorf("critical section at %#x with length %#x overflows", cs.Start, cs.PostCommitOffset)
+	}
+	abort := usermem.Addr(cs.Abort)
+	if csRange.Contains(abort) {
+		return fmt.Errorf("abort handler %#x is inside critical section %v", abort, csRange)
+	}
+	buf := t.CopyScratchBuffer(4)
+	if _, err := t.CopyInBytes(abort-4, buf); err != nil {
+		return err
+	}
+	if sig := usermem.ByteOrder.Uint32(buf); sig != t.rseqSignature {
+		return fmt.Errorf("abort handler %#x has signature %#x, want %#x", abort, sig, t.rseqSignature)
+	}
+
+	ip := usermem.Addr(t.Arch().IP())
+	if csRange.Contains(ip) {
+		// Linux no longer honors the deprecated RSEQ_CS_FLAG_NO_RESTART_*
+		// flags, and rejects critical sections that use them.
+		if (rseq.Flags|cs.Flags)&linux.RSEQ_CS_FLAG_NO_RESTART_MASK != 0 {
+			return fmt.Errorf("critical section uses deprecated flags %#x", rseq.Flags|cs.Flags)
+		}
+	}
+
+	// Clear the pointer to the critical section descriptor, whether or not
+	// the task is still in the critical section.
+	buf = t.CopyScratchBuffer(8)
+	usermem.ByteOrder.PutUint64(buf, 0)
+	if _, err := t.CopyOutBytes(t.rseqAddr+linux.OffsetOfRSeqCriticalSection, buf); err != nil {
+		return err
+	}
+
+	if csRange.Contains(ip) {
+		t.Debugf("Interrupted RSEQ critical section at %#x; restarting at %#x", ip, abort)
+		t.Arch().SetIP(uintptr(abort))
+	}
+	return nil
 }
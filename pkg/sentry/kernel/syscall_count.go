@@ -0,0 +1,59 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"sync/atomic"
+)
+
+// syscallCounts is the number of times each syscall was executed, by syscall
+// number, while counting is enabled. Its elements must be accessed
+// atomically.
+var syscallCounts [maxSyscallNum + 1]uint64
+
+// EnableSyscallCounts enables counting of all syscalls in all syscall tables.
+func EnableSyscallCounts() {
+	for _, table := range SyscallTables() {
+		table.FeatureEnable.EnableAll(CountEnable)
+	}
+}
+
+// DisableSyscallCounts disables counting of all syscalls in all syscall
+// tables. The counts so far are kept.
+func DisableSyscallCounts() {
+	for _, table := range SyscallTables() {
+		table.FeatureEnable.Enable(CountEnable, nil, false)
+	}
+}
+
+// SyscallCounts returns the number of times each syscall was executed while
+// counting was enabled, by syscall number. Syscalls that were never counted
+// are omitted.
+func SyscallCounts() map[uintptr]uint64 {
+	counts := make(map[uintptr]uint64)
+	for sysno := range syscallCounts {
+		if n := atomic.LoadUint64(&syscallCounts[sysno]); n > 0 {
+			counts[uintptr(sysno)] = n
+		}
+	}
+	return counts
+}
+
+// countSyscall counts an execution of syscall sysno.
+func countSyscall(sysno uintptr) {
+	if sysno < uintptr(len(syscallCounts)) {
+		atomic.AddUint64(&syscallCounts[sysno], 1)
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"testing"
+
+	"gvisor.googlesource.com/gvisor/pkg/bits"
+)
+
+func TestSyscallCounts(t *testing.T) {
+	table := createSyscallTable()
+	defer func() {
+		// Cleanup registered tables to keep tests separate.
+		allSyscallTables = []*SyscallTable{}
+	}()
+
+	EnableSyscallCounts()
+	for _, sysno := range []uintptr{0, maxTestSyscall, maxTestSyscall + 1} {
+		if !bits.IsOn32(table.FeatureEnable.Word(sysno), CountEnable) {
+			t.Errorf("Syscall %d: counting not enabled", sysno)
+		}
+	}
+
+	before := SyscallCounts()[2]
+	countSyscall(2)
+	countSyscall(2)
+	// Out of range syscalls are ignored.
+	countSyscall(maxSyscallNum + 1)
+	if got, want := SyscallCounts()[2]-before, uint64(2); got != want {
+		t.Errorf("Counted %d syscalls, want %d", got, want)
+	}
+
+	DisableSyscallCounts()
+	if bits.IsOn32(table.FeatureEnable.Word(2), CountEnable) {
+		t.Errorf("Counting still enabled after DisableSyscallCounts")
+	}
+}
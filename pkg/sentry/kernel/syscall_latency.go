@@ -0,0 +1,72 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/metric"
+)
+
+// syscallLatency records the latency of each syscall, by syscall number,
+// while latency recording is enabled. Buckets range from 1us to ~0.5s.
+//
+// Latency is wall time from dispatch to completion, so it includes time that
+// the task spends blocked in the syscall.
+var syscallLatency = metric.MustCreateNewDistributionMetric("/syscalls/latency", false /* sync */, "Latency of syscalls in nanoseconds, by syscall number.", metric.ExponentialBounds(1000, 2, 20), "sysno", sysnoFieldValues())
+
+// slowSyscallThreshold is the latency, in nanoseconds, at or above which
+// syscalls are logged while latency recording is enabled. If it is 0, no
+// syscalls are logged. It must be accessed atomically.
+var slowSyscallThreshold int64
+
+// sysnoFieldValues returns the field values of syscallLatency.
+func sysnoFieldValues() []string {
+	vals := make([]string, maxSyscallNum+1)
+	for i := range vals {
+		vals[i] = strconv.Itoa(i)
+	}
+	return vals
+}
+
+// EnableSyscallLatency enables latency recording for all syscalls in all
+// syscall tables. Syscalls that take at least slow are logged, unless slow
+// is 0.
+func EnableSyscallLatency(slow time.Duration) {
+	atomic.StoreInt64(&slowSyscallThreshold, int64(slow))
+	for _, table := range SyscallTables() {
+		table.FeatureEnable.EnableAll(LatencyEnable)
+	}
+}
+
+// DisableSyscallLatency disables latency recording for all syscalls in all
+// syscall tables.
+func DisableSyscallLatency() {
+	for _, table := range SyscallTables() {
+		table.FeatureEnable.Enable(LatencyEnable, nil, false)
+	}
+}
+
+// recordSyscallLatency records the latency of syscall sysno, which was
+// dispatched at start.
+func (t *Task) recordSyscallLatency(sysno uintptr, start time.Time) {
+	d := time.Since(start)
+	syscallLatency.Record(int(sysno), uint64(d))
+	if slow := atomic.LoadInt64(&slowSyscallThreshold); slow > 0 && int64(d) >= slow {
+		t.Infof("Slow syscall %d: took %v", sysno, d)
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"testing"
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/bits"
+)
+
+func TestSyscallLatency(t *testing.T) {
+	table := createSyscallTable()
+	defer func() {
+		// Cleanup registered tables to keep tests separate.
+		allSyscallTables = []*SyscallTable{}
+	}()
+
+	EnableSyscallLatency(0)
+	for _, sysno := range []uintptr{0, maxTestSyscall, maxTestSyscall + 1} {
+		if !bits.IsOn32(table.FeatureEnable.Word(sysno), LatencyEnable) {
+			t.Errorf("Syscall %d: latency recording not enabled", sysno)
+		}
+	}
+
+	total := func(counts []uint64) (n uint64) {
+		for _, c := range counts {
+			n += c
+		}
+		return n
+	}
+	countsBefore, sumBefore := syscallLatency.Value(1)
+
+	// The threshold is 0, so the nil Task is never used for logging.
+	var task *Task
+	task.recordSyscallLatency(1, time.Now().Add(-3*time.Millisecond))
+
+	countsAfter, sumAfter := syscallLatency.Value(1)
+	if got, want := total(countsAfter)-total(countsBefore), uint64(1); got != want {
+		t.Errorf("Recorded %d samples, want %d", got, want)
+	}
+	if got, want := sumAfter-sumBefore, uint64(3*time.Millisecond); got < want {
+		t.Errorf("Recorded latency %d, want at least %d", got, want)
+	}
+
+	DisableSyscallLatency()
+	if bits.IsOn32(table.FeatureEnable.Word(1), LatencyEnable) {
+		t.Errorf("Latency recording still enabled after DisableSyscallLatency")
+	}
+}
@@ -0,0 +1,239 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"gvisor.googlesource.com/gvisor/pkg/sentry/arch"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/mm"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
+)
+
+// SyscallOriginAction is the action taken when a task invokes a syscall from
+// code that is not permitted by its SyscallOriginPolicy.
+type SyscallOriginAction int
+
+const (
+	// SyscallOriginLog logs the syscall, which then proceeds normally.
+	SyscallOriginLog SyscallOriginAction = iota
+
+	// SyscallOriginKill kills the task's thread group, which exits as if
+	// killed by SIGSYS.
+	SyscallOriginKill
+)
+
+// SyscallOriginPolicy restricts the code from which tasks may invoke
+// syscalls, for example to libc and the vDSO, so that raw syscalls issued
+// from JIT-compiled code or other anonymous memory are detected. Syscalls
+// issued from unlisted mappings, or from pages of a file mapping that have
+// been modified since they were mapped, violate the policy. The policy is
+// enforced at syscall entry, before seccomp filters installed by the
+// application.
+//
+// Mappings are identified by the name shown for them in /proc/[pid]/maps.
+// Patterns use filepath.Match syntax. A pattern containing a '/' is matched
+// against the whole name; other patterns are matched against its last
+// element only, so that "libc-*.so" matches wherever the library appears. A
+// pattern also matches a name that is identical to it, so that special
+// mappings such as "[vdso]" need not be escaped.
+// Absolute patterns are preferable for libraries, since a bare file name is
+// also matched by copies of the library elsewhere in the filesystem.
+//
+// Every ThreadGroup may have a SyscallOriginPolicy, inherited from its parent
+// thread group on fork. A nil *SyscallOriginPolicy permits syscalls from
+// anywhere.
+type SyscallOriginPolicy struct {
+	// action is immutable.
+	action SyscallOriginAction
+
+	// defaults are the patterns that apply to executables with no entry in
+	// binaries. defaults is immutable.
+	defaults []string
+
+	// binaries maps executable paths to the patterns that apply to them.
+	// binaries is immutable.
+	binaries map[string][]string
+
+	// mu protects reported.
+	mu sync.Mutex `state:"nosave"`
+
+	// reported is the set of violations that have been logged.
+	reported map[syscallOrigin]struct{} `state:"nosave"`
+}
+
+// syscallOrigin identifies the code that issued a syscall.
+type syscallOrigin struct {
+	// binary is the path of the task's executable.
+	binary string
+
+	// mapping is the name of the mapping containing the instruction
+	// pointer, or a description of the memory if it has none.
+	mapping string
+}
+
+// NewSyscallOriginPolicy returns a SyscallOriginPolicy that permits syscalls
+// from mappings matching defaults, or, for executables whose paths are keys in
+// binaries, the corresponding patterns instead.
+func NewSyscallOriginPolicy(action SyscallOriginAction, defaults []string, binaries map[string][]string) (*SyscallOriginPolicy, error) {
+	if err := checkSyscallOriginPatterns(defaults); err != nil {
+		return nil, err
+	}
+	for _, patterns := range binaries {
+		if err := checkSyscallOriginPatterns(patterns); err != nil {
+			return nil, err
+		}
+	}
+	return &SyscallOriginPolicy{
+		action:   action,
+		defaults: defaults,
+		binaries: binaries,
+	}, nil
+}
+
+// checkSyscallOriginPatterns returns an error if any of patterns is malformed.
+func checkSyscallOriginPatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %v", pattern, err)
+		}
+	}
+	return nil
+}
+
+// patterns returns the patterns that apply to the executable at path binary.
+func (p *SyscallOriginPolicy) patterns(binary string) []string {
+	if patterns, ok := p.binaries[binary]; ok {
+		return patterns
+	}
+	return p.defaults
+}
+
+// Allowed returns true if p permits the executable at path binary to invoke
+// syscalls from the mapping with the given name.
+func (p *SyscallOriginPolicy) Allowed(binary, mapping string) bool {
+	if p == nil {
+		return true
+	}
+	return matchSyscallOrigin(p.patterns(binary), mapping)
+}
+
+// matchSyscallOrigin returns true if mapping matches any of patterns.
+func matchSyscallOrigin(patterns []string, mapping string) bool {
+	if mapping == "" {
+		return false
+	}
+	base := mapping
+	if i := strings.LastIndexByte(mapping, '/'); i >= 0 {
+		base = mapping[i+1:]
+	}
+	for _, pattern := range patterns {
+		name := base
+		if strings.ContainsRune(pattern, '/') {
+			name = mapping
+		}
+		if pattern == name {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// checkSyscallOrigin returns false if t should be killed for invoking syscall
+// sysno from code that is not permitted by p. Violations are logged at
+// warning level the first time that they occur for each executable and
+// mapping, and at debug level thereafter.
+func (t *Task) checkSyscallOrigin(p *SyscallOriginPolicy, sysno uintptr) bool {
+	mm := t.MemoryManager()
+	if mm == nil {
+		return true
+	}
+	if t.syscallOriginMM != mm {
+		t.syscallOriginMM = mm
+		t.syscallOriginBinary = t.executablePath()
+		t.syscallOriginPatterns = p.patterns(t.syscallOriginBinary)
+	}
+
+	ip, mapping, ok := syscallCodeOrigin(t, mm, t.Arch().IP())
+	if ok && matchSyscallOrigin(t.syscallOriginPatterns, mapping) {
+		return true
+	}
+	switch {
+	case !ok:
+		mapping = "[modified or non-executable memory]"
+	case mapping == "":
+		mapping = "[anonymous memory]"
+	}
+
+	origin := syscallOrigin{binary: t.syscallOriginBinary, mapping: mapping}
+	p.mu.Lock()
+	_, reported := p.reported[origin]
+	if !reported {
+		if p.reported == nil {
+			p.reported = make(map[syscallOrigin]struct{})
+		}
+		p.reported[origin] = struct{}{}
+	}
+	p.mu.Unlock()
+
+	if !reported {
+		t.Warningf("Syscall %d: invoked by %s from %s at %#x, not permitted by syscall origin policy", sysno, origin.binary, origin.mapping, ip)
+	} else {
+		t.Debugf("Syscall %d: invoked by %s from %s at %#x, not permitted by syscall origin policy", sysno, origin.binary, origin.mapping, ip)
+	}
+	return p.action != SyscallOriginKill
+}
+
+// syscallCodeOrigin returns the address of the syscall instruction that
+// precedes ip, the instruction pointer of a task at syscall entry, and the
+// result of MemoryManager.CodeOrigin for it. The syscall instruction must be
+// looked up rather than ip, since ip may be on the next page, in a different
+// mapping.
+func syscallCodeOrigin(ctx context.Context, m *mm.MemoryManager, ip uintptr) (usermem.Addr, string, bool) {
+	addr := usermem.Addr(ip - arch.SyscallWidth)
+	mapping, ok := m.CodeOrigin(ctx, addr)
+	return addr, mapping, ok
+}
+
+// executablePath returns the path of the executable running in t, relative to
+// t's root directory, or an empty string if it cannot be determined.
+func (t *Task) executablePath() string {
+	root := t.FSContext().RootDirectory()
+	if root == nil {
+		return ""
+	}
+	defer root.DecRef()
+	return executablePath(t.MemoryManager(), root)
+}
+
+// executablePath returns the path of m's executable relative to root, or an
+// empty string if m has no executable.
+func executablePath(m *mm.MemoryManager, root *fs.Dirent) string {
+	exe := m.Executable()
+	if exe == nil {
+		return ""
+	}
+	defer exe.DecRef()
+	name, _ := exe.FullName(root)
+	return name
+}
@@ -0,0 +1,107 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"testing"
+
+	"gvisor.googlesource.com/gvisor/pkg/cpuid"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/arch"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/context/contexttest"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/limits"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/memmap"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/mm"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/platform"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
+)
+
+func TestSyscallOriginPolicy(t *testing.T) {
+	p, err := NewSyscallOriginPolicy(SyscallOriginKill, []string{"[vdso]", "libc-*.so"}, map[string][]string{
+		"/usr/bin/jit": {"[vdso]", "/lib/x86_64-linux-gnu/libc-*.so", "/usr/bin/jit"},
+	})
+	if err != nil {
+		t.Fatalf("NewSyscallOriginPolicy failed: %v", err)
+	}
+	for _, test := range []struct {
+		binary  string
+		mapping string
+		want    bool
+	}{
+		{"/bin/sh", "[vdso]", true},
+		{"/bin/sh", "/lib/x86_64-linux-gnu/libc-2.24.so", true},
+		{"/bin/sh", "/tmp/libc-2.24.so", true},
+		{"/bin/sh", "/bin/sh", false},
+		{"/bin/sh", "", false},
+		{"/usr/bin/jit", "[vdso]", true},
+		{"/usr/bin/jit", "/lib/x86_64-linux-gnu/libc-2.24.so", true},
+		{"/usr/bin/jit", "/tmp/libc-2.24.so", false},
+		{"/usr/bin/jit", "/usr/bin/jit", true},
+		{"/usr/bin/jit", "", false},
+	} {
+		if got := p.Allowed(test.binary, test.mapping); got != test.want {
+			t.Errorf("Allowed(%q, %q) = %t, want %t", test.binary, test.mapping, got, test.want)
+		}
+	}
+
+	// A nil policy permits everything.
+	var nilPolicy *SyscallOriginPolicy
+	if !nilPolicy.Allowed("/bin/sh", "") {
+		t.Errorf("nil policy Allowed(\"/bin/sh\", \"\") = false, want true")
+	}
+}
+
+func TestSyscallOriginPolicyBadPattern(t *testing.T) {
+	if _, err := NewSyscallOriginPolicy(SyscallOriginLog, []string{"libc-[.so"}, nil); err == nil {
+		t.Errorf("NewSyscallOriginPolicy with malformed default pattern succeeded")
+	}
+	if _, err := NewSyscallOriginPolicy(SyscallOriginLog, nil, map[string][]string{"/bin/sh": {"["}}); err == nil {
+		t.Errorf("NewSyscallOriginPolicy with malformed binary pattern succeeded")
+	}
+}
+
+func TestSyscallCodeOriginPageBoundary(t *testing.T) {
+	ctx := contexttest.Context(t)
+	m := mm.NewMemoryManager(platform.FromContext(ctx))
+	defer m.DecUsers(ctx)
+	if _, err := m.SetMmapLayout(arch.New(arch.AMD64, cpuid.HostFeatureSet()), limits.NewLimitSet()); err != nil {
+		t.Fatalf("SetMmapLayout failed: %v", err)
+	}
+
+	// Map an executable page followed by a non-executable one, with a
+	// syscall instruction in the last bytes of the executable page.
+	addr, err := m.MMap(ctx, memmap.MMapOpts{
+		Length:   2 * usermem.PageSize,
+		Private:  true,
+		Perms:    usermem.AccessType{Read: true, Execute: true},
+		MaxPerms: usermem.AnyAccess,
+	})
+	if err != nil {
+		t.Fatalf("MMap failed: %v", err)
+	}
+	next := addr + usermem.PageSize
+	if err := m.MProtect(next, usermem.PageSize, usermem.Read, false); err != nil {
+		t.Fatalf("MProtect failed: %v", err)
+	}
+
+	// At syscall entry, the instruction pointer is the first address of
+	// the non-executable page.
+	got, mapping, ok := syscallCodeOrigin(ctx, m, uintptr(next))
+	if want := next - arch.SyscallWidth; got != want {
+		t.Errorf("syscallCodeOrigin() address = %#x, want %#x", got, want)
+	}
+	if !ok || mapping != "" {
+		t.Errorf("syscallCodeOrigin() = %q, %t, want anonymous executable memory", mapping, ok)
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"sync"
+)
+
+// SyscallWhitelist is a set of syscalls that tasks may invoke. It is enforced
+// at syscall dispatch, after seccomp filters installed by the application;
+// syscalls that are not in the whitelist fail with ENOSYS.
+//
+// Every ThreadGroup may have a SyscallWhitelist, inherited from its parent
+// thread group on fork. A nil *SyscallWhitelist permits all syscalls.
+type SyscallWhitelist struct {
+	// allowed is indexed by syscall number. Syscall numbers beyond the end
+	// of allowed are not permitted. allowed is immutable.
+	allowed []bool
+
+	// mu protects reported.
+	mu sync.Mutex `state:"nosave"`
+
+	// reported is the set of syscalls whose denial has been logged.
+	reported map[uintptr]struct{} `state:"nosave"`
+}
+
+// NewSyscallWhitelist returns a SyscallWhitelist that permits the syscalls
+// for which sysnos is true.
+func NewSyscallWhitelist(sysnos map[uintptr]bool) *SyscallWhitelist {
+	var max uintptr
+	for sysno, ok := range sysnos {
+		if ok && sysno >= max {
+			max = sysno + 1
+		}
+	}
+	w := &SyscallWhitelist{
+		allowed: make([]bool, max),
+	}
+	for sysno, ok := range sysnos {
+		if ok {
+			w.allowed[sysno] = true
+		}
+	}
+	return w
+}
+
+// Allowed returns true if w permits syscall sysno.
+func (w *SyscallWhitelist) Allowed(sysno uintptr) bool {
+	if w == nil {
+		return true
+	}
+	return sysno < uintptr(len(w.allowed)) && w.allowed[sysno]
+}
+
+// deny logs the denial of syscall sysno by t. Each syscall is logged at
+// warning level the first time that it is denied, so that denials are
+// recorded without flooding the log.
+func (w *SyscallWhitelist) deny(t *Task, sysno uintptr) {
+	w.mu.Lock()
+	_, ok := w.reported[sysno]
+	if !ok {
+		if w.reported == nil {
+			w.reported = make(map[uintptr]struct{})
+		}
+		w.reported[sysno] = struct{}{}
+	}
+	w.mu.Unlock()
+
+	if !ok {
+		t.Warningf("Syscall %d: denied by syscall whitelist", sysno)
+	} else {
+		t.Debugf("Syscall %d: denied by syscall whitelist", sysno)
+	}
+}
@@ -0,0 +1,43 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"testing"
+)
+
+func TestSyscallWhitelist(t *testing.T) {
+	w := NewSyscallWhitelist(map[uintptr]bool{0: true, 2: true, 3: false})
+	for _, test := range []struct {
+		sysno uintptr
+		want  bool
+	}{
+		{0, true},
+		{1, false},
+		{2, true},
+		{3, false},
+		{1000, false},
+	} {
+		if got := w.Allowed(test.sysno); got != test.want {
+			t.Errorf("Allowed(%d) = %t, want %t", test.sysno, got, test.want)
+		}
+	}
+
+	// A nil whitelist permits everything.
+	var nilWhitelist *SyscallWhitelist
+	if !nilWhitelist.Allowed(1000) {
+		t.Errorf("nil whitelist Allowed(1000) = false, want true")
+	}
+}
@@ -56,10 +56,21 @@ const (
 
 	// ExternalAfterEnable enables the external hook after syscall execution.
 	ExternalAfterEnable
+
+	// StraceEnableRing enables syscall tracing to the task's trace ring,
+	// which is logged when the task encounters an anomaly.
+	StraceEnableRing
+
+	// LatencyEnable enables recording of syscall latency. See
+	// EnableSyscallLatency.
+	LatencyEnable
+
+	// CountEnable enables counting of syscalls. See EnableSyscallCounts.
+	CountEnable
 )
 
-// StraceEnableBits combines both strace log and event flags.
-const StraceEnableBits = StraceEnableLog | StraceEnableEvent
+// StraceEnableBits combines all strace flags.
+const StraceEnableBits = StraceEnableLog | StraceEnableEvent | StraceEnableRing
 
 // SyscallFlagsTable manages a set of enable/disable bit fields on a per-syscall
 // basis.
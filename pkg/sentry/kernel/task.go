@@ -29,6 +29,7 @@ import (
 	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel/sched"
 	ktime "gvisor.googlesource.com/gvisor/pkg/sentry/kernel/time"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/limits"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/mm"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/platform"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/uniqueid"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/usage"
@@ -81,6 +82,10 @@ type Task struct {
 	goschedSeq ssync.SeqCount `state:"nosave"`
 	gosched    TaskGoroutineSchedInfo
 
+	// schedDelay accumulates the scheduling delays of the task goroutine.
+	// Delays are not saved.
+	schedDelay schedDelay `state:"nosave"`
+
 	// yieldCount is the number of times the task goroutine has called
 	// Task.InterruptibleSleepStart, Task.UninterruptibleSleepStart, or
 	// Task.Yield(), voluntarily ceasing execution.
@@ -89,6 +94,13 @@ type Task struct {
 	// owned by the task goroutine.
 	yieldCount uint64
 
+	// preempt is set to 1 by the kernel's CPU clock ticker when the task
+	// goroutine has executed application code for a full time slice and
+	// should yield its CPU. See Kernel.preemptTasks.
+	//
+	// preempt is accessed using atomic memory operations.
+	preempt uint32 `state:"nosave"`
+
 	// pendingSignals is the set of pending signals that may be handled only by
 	// this task.
 	//
@@ -359,6 +371,15 @@ type Task struct {
 	// goroutine.
 	syscallFilters []bpf.Program
 
+	// syscallOriginMM is the MemoryManager for which syscallOriginBinary and
+	// syscallOriginPatterns were computed. They are recomputed when the
+	// task's MemoryManager changes, e.g. on execve.
+	//
+	// These fields are exclusive to the task goroutine.
+	syscallOriginMM       *mm.MemoryManager `state:"nosave"`
+	syscallOriginBinary   string            `state:"nosave"`
+	syscallOriginPatterns []string          `state:"nosave"`
+
 	// If cleartid is non-zero, treat it as a pointer to a ThreadID in the
 	// task's virtual address space; when the task exits, set the pointed-to
 	// ThreadID to 0, and wake any futex waiters.
@@ -412,16 +433,23 @@ type Task struct {
 	netns bool
 
 	// If rseqPreempted is true, before the next call to p.Switch(), interrupt
-	// RSEQ critical regions as defined by tg.rseq and write the task
-	// goroutine's CPU number to rseqCPUAddr. rseqCPU is the last CPU number
-	// written to rseqCPUAddr.
+	// RSEQ critical regions as defined by tg.rseq and rseqAddr, and write
+	// the task goroutine's CPU number to rseqCPUAddr and rseqAddr. rseqCPU
+	// is the last CPU number written to rseqCPUAddr or rseqAddr.
 	//
-	// If rseqCPUAddr is 0, rseqCPU is -1.
+	// rseqAddr is the address of the linux.RSeq registered by rseq(2), or 0
+	// if no linux.RSeq is registered. rseqSignature is the signature that
+	// must precede the abort handler of each critical section described by
+	// the linux.RSeq.
 	//
-	// rseqCPUAddr, rseqCPU, and rseqPreempted are exclusive to the task
-	// goroutine.
+	// If rseqCPUAddr and rseqAddr are both 0, rseqCPU is -1.
+	//
+	// rseqCPUAddr, rseqAddr, rseqSignature, rseqCPU, and rseqPreempted are
+	// exclusive to the task goroutine.
 	rseqPreempted bool `state:"nosave"`
 	rseqCPUAddr   usermem.Addr
+	rseqAddr      usermem.Addr
+	rseqSignature uint32
 	rseqCPU       int32
 
 	// copyScratchBuffer is a buffer available to CopyIn/CopyOut
@@ -449,6 +477,9 @@ type Task struct {
 	//
 	// startTime is protected by mu.
 	startTime ktime.Time
+
+	// traceRing holds the task's most recent syscall traces.
+	traceRing traceRing `state:"nosave"`
 }
 
 func (t *Task) savePtraceTracer() *Task {
@@ -476,6 +507,7 @@ func (t *Task) afterLoad() {
 	}
 	t.endStopCond.L = &t.tg.signalHandlers.mu
 	t.p = t.k.Platform.NewContext()
+	t.propagateNiceness()
 	t.rseqPreempted = true
 	t.futexWaiter = futex.NewWaiter()
 }
@@ -564,6 +596,8 @@ func (t *Task) Value(key interface{}) interface{} {
 		return int32(t.ThreadGroup().ID())
 	case fs.CtxRoot:
 		return t.FSContext().RootDirectory()
+	case fs.CtxWriteAuditor:
+		return t
 	case inet.CtxStack:
 		return t.NetworkContext()
 	case ktime.CtxRealtimeClock:
@@ -572,6 +606,8 @@ func (t *Task) Value(key interface{}) interface{} {
 		return t.tg.limits
 	case platform.CtxPlatform:
 		return t.k
+	case usage.CtxIO:
+		return t.ioUsage
 	case uniqueid.CtxGlobalUniqueID:
 		return t.k.UniqueID()
 	case uniqueid.CtxInotifyCookie:
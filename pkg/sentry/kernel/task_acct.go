@@ -41,6 +41,20 @@ func (tg *ThreadGroup) IOUsage() *usage.IO {
 	return &io
 }
 
+// IOUsage returns the total io usage of all dead and live threads in the
+// kernel.
+func (k *Kernel) IOUsage() *usage.IO {
+	k.tasks.mu.RLock()
+	defer k.tasks.mu.RUnlock()
+
+	io := *k.tasks.exitedIOUsage
+	// Account for active tasks.
+	for t := range k.tasks.Root.tids {
+		io.Accumulate(t.IOUsage())
+	}
+	return &io
+}
+
 // Name returns t's name.
 func (t *Task) Name() string {
 	t.mu.Lock()
@@ -15,6 +15,7 @@
 package kernel
 
 import (
+	"sync/atomic"
 	"time"
 
 	ktime "gvisor.googlesource.com/gvisor/pkg/sentry/kernel/time"
@@ -76,6 +77,9 @@ func (t *Task) BlockWithDeadline(C chan struct{}, haveDeadline bool, deadline kt
 	})
 
 	err := t.block(C, t.blockingTimerChan)
+	if err == syserror.ETIMEDOUT {
+		t.recordSchedDelay(schedDelayTimeout, t.Kernel().MonotonicClock().Now().Sub(deadline).Nanoseconds())
+	}
 
 	// Stop the timeout timer and drain the channel.
 	t.blockingTimer.Swap(ktime.Setting{})
@@ -141,6 +145,7 @@ func (t *Task) block(C chan struct{}, timerChan <-chan struct{}) error {
 // SleepStart implements amutex.Sleeper.SleepStart.
 func (t *Task) SleepStart() <-chan struct{} {
 	t.Deactivate()
+	atomic.StoreInt64(&t.schedDelay.interruptTime, 0)
 	t.accountTaskGoroutineEnter(TaskGoroutineBlockedInterruptible)
 	return t.interruptChan
 }
@@ -153,6 +158,9 @@ func (t *Task) SleepFinish(success bool) {
 		// This will also elide our next entry back into the task, so we
 		// will process signals, state changes, etc.
 		t.interruptSelf()
+		if it := atomic.LoadInt64(&t.schedDelay.interruptTime); it != 0 {
+			t.recordSchedDelay(schedDelayInterrupt, t.k.MonotonicClock().Now().Nanoseconds()-it)
+		}
 	}
 	t.accountTaskGoroutineLeave(TaskGoroutineBlockedInterruptible)
 	t.Activate()
@@ -188,6 +196,7 @@ func (t *Task) interrupted() bool {
 // interrupt unblocks the task and interrupts it if it's currently running in
 // userspace.
 func (t *Task) interrupt() {
+	t.noteInterrupt()
 	t.interruptSelf()
 	t.p.Interrupt()
 }
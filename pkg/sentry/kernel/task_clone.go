@@ -126,6 +126,17 @@ type CloneOptions struct {
 	// for it. If both Untraced and InheritTracer are true, no event will be
 	// reported, but tracer inheritance will still occur.
 	InheritTracer bool
+
+	// If ClearSignalHandlers is true, the new task's signal handlers are
+	// reset to the default, except for ignored signals, as on execve(2).
+	// ClearSignalHandlers requires NewSignalHandlers.
+	ClearSignalHandlers bool
+
+	// If SetTIDs is not empty, it contains the thread IDs that the new task
+	// must have in its PID namespace, followed by its parent PID namespaces,
+	// in order. Namespaces beyond len(SetTIDs) allocate thread IDs as usual.
+	// A thread ID of 0 is also allocated as usual.
+	SetTIDs []ThreadID
 }
 
 // Clone implements the clone(2) syscall and returns the thread ID of the new
@@ -159,6 +170,10 @@ func (t *Task) Clone(opts *CloneOptions) (ThreadID, *SyscallControl, error) {
 	if opts.NewUserNamespace && (!opts.NewThreadGroup || !opts.NewFSContext) {
 		return 0, nil, syserror.EINVAL
 	}
+	// Shared signal handlers can't be reset.
+	if opts.ClearSignalHandlers && !opts.NewSignalHandlers {
+		return 0, nil, syserror.EINVAL
+	}
 
 	// "If CLONE_NEWUSER is specified along with other CLONE_NEW* flags in a
 	// single clone(2) or unshare(2) call, the user namespace is guaranteed to
@@ -186,6 +201,20 @@ func (t *Task) Clone(opts *CloneOptions) (ThreadID, *SyscallControl, error) {
 		return 0, nil, syserror.EPERM
 	}
 
+	pidns := t.tg.pidns
+	if t.childPIDNamespace != nil {
+		pidns = t.childPIDNamespace
+	} else if opts.NewPIDNamespace {
+		owner := creds.UserNamespace
+		if userns != nil {
+			owner = userns
+		}
+		pidns = pidns.NewChild(owner)
+	}
+	if err := checkSetTIDs(&creds, pidns, opts.SetTIDs); err != nil {
+		return 0, nil, err
+	}
+
 	utsns := t.UTSNamespace()
 	if opts.NewUTSNamespace {
 		// Note that this must happen after NewUserNamespace so we get
@@ -213,20 +242,20 @@ func (t *Task) Clone(opts *CloneOptions) (ThreadID, *SyscallControl, error) {
 		tc.Arch.StateData().Regs.Fs_base = uint64(opts.TLS)
 	}
 
-	pidns := t.tg.pidns
-	if t.childPIDNamespace != nil {
-		pidns = t.childPIDNamespace
-	} else if opts.NewPIDNamespace {
-		pidns = pidns.NewChild(userns)
-	}
 	tg := t.tg
 	parent := t.parent
 	if opts.NewThreadGroup {
 		sh := t.tg.signalHandlers
-		if opts.NewSignalHandlers {
+		if opts.ClearSignalHandlers {
+			sh = sh.CopyForExec()
+		} else if opts.NewSignalHandlers {
 			sh = sh.Fork()
 		}
-		tg = NewThreadGroup(pidns, sh, opts.TerminationSignal, tg.limits.GetCopy(), t.k.monotonicClock)
+		tg = NewThreadGroup(pidns, sh, opts.TerminationSignal, tg.limits.GetCopy(), tg.pids, t.k.monotonicClock)
+		tg.syscallWhitelist = t.tg.syscallWhitelist
+		tg.syscallOrigins = t.tg.syscallOrigins
+		tg.execPolicy = t.tg.execPolicy
+		tg.redaction = t.tg.redaction
 		parent = t
 	}
 	cfg := &TaskConfig{
@@ -241,6 +270,7 @@ func (t *Task) Clone(opts *CloneOptions) (ThreadID, *SyscallControl, error) {
 		AllowedCPUMask:    t.CPUMask(),
 		UTSNamespace:      utsns,
 		IPCNamespace:      ipcns,
+		SetTIDs:           opts.SetTIDs,
 	}
 	if opts.NewNetworkNamespace {
 		cfg.NetworkNamespaced = true
@@ -262,6 +292,15 @@ func (t *Task) Clone(opts *CloneOptions) (ThreadID, *SyscallControl, error) {
 		nt.SetSignalStack(t.SignalStack())
 	}
 
+	// "Children created by fork inherit the restartable sequence
+	// registration; threads created with CLONE_VM do not." -
+	// kernel/rseq.c:rseq_fork().
+	if opts.NewAddressSpace && t.rseqAddr != 0 {
+		nt.rseqAddr = t.rseqAddr
+		nt.rseqSignature = t.rseqSignature
+		nt.rseqPreempted = true
+	}
+
 	if userns != nil {
 		if err := nt.SetUserNamespace(userns); err != nil {
 			// This shouldn't be possible: userns was created from nt.creds, so
@@ -270,6 +309,10 @@ func (t *Task) Clone(opts *CloneOptions) (ThreadID, *SyscallControl, error) {
 		}
 	}
 
+	if opts.NewThreadGroup {
+		nt.recordProcessEvent(ProcessEvent{Type: ProcessFork})
+	}
+
 	// This has to happen last, because e.g. ptraceClone may send a SIGSTOP to
 	// nt that it must receive before its task goroutine starts running.
 	tid := nt.k.tasks.Root.IDOfTask(nt)
@@ -314,6 +357,32 @@ func (t *Task) Clone(opts *CloneOptions) (ThreadID, *SyscallControl, error) {
 	return ntid, nil, nil
 }
 
+// checkSetTIDs returns an error if a task with credentials creds may not
+// request thread IDs tids for a new task in PID namespace pidns, as described
+// by CloneOptions.SetTIDs. Whether the thread IDs are available is checked
+// when they are allocated.
+func checkSetTIDs(creds *auth.Credentials, pidns *PIDNamespace, tids []ThreadID) error {
+	ns := pidns
+	for _, tid := range tids {
+		// "EINVAL: set_tid_size is larger than the number of nested PID
+		// namespaces." - clone(2)
+		if ns == nil {
+			return syserror.EINVAL
+		}
+		if tid < 0 || tid > TasksLimit {
+			return syserror.EINVAL
+		}
+		// "EPERM: set_tid_size was greater than zero, and the caller lacks
+		// the CAP_SYS_ADMIN capability in one or more of the user namespaces
+		// that own the corresponding PID namespaces." - clone(2)
+		if tid != 0 && !creds.HasCapabilityIn(linux.CAP_SYS_ADMIN, ns.userns) {
+			return syserror.EPERM
+		}
+		ns = ns.parent
+	}
+	return nil
+}
+
 // maybeBeginVforkStop checks if a previously-started vfork child is still
 // running and has not yet released its MM, such that its parent t should enter
 // a vforkStop.
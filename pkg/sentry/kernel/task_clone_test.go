@@ -0,0 +1,97 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"testing"
+
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.googlesource.com/gvisor/pkg/syserror"
+)
+
+func TestSetTIDs(t *testing.T) {
+	ts := newTaskSet()
+	child := ts.Root.NewChild(ts.Root.userns)
+	newTask := func(pidns *PIDNamespace) *Task {
+		return &Task{taskNode: taskNode{tg: &ThreadGroup{threadGroupNode: threadGroupNode{pidns: pidns}}}}
+	}
+	if err := ts.assignTIDsLocked(newTask(ts.Root), nil); err != nil {
+		t.Fatalf("assignTIDsLocked for root init failed: %v", err)
+	}
+
+	// The first task in a PID namespace must be its init process.
+	if err := ts.assignTIDsLocked(newTask(child), []ThreadID{5}); err != syserror.EINVAL {
+		t.Fatalf("assignTIDsLocked({5}) before init: got %v, wanted %v", err, syserror.EINVAL)
+	}
+	if len(ts.Root.tids) != 1 || len(child.tids) != 0 {
+		t.Fatalf("failed assignTIDsLocked left thread IDs allocated")
+	}
+
+	initTask := newTask(child)
+	if err := ts.assignTIDsLocked(initTask, []ThreadID{1, 100}); err != nil {
+		t.Fatalf("assignTIDsLocked({1, 100}) failed: %v", err)
+	}
+	if got := child.tids[initTask]; got != 1 {
+		t.Errorf("init TID in child namespace: got %d, wanted 1", got)
+	}
+	if got := ts.Root.tids[initTask]; got != 100 {
+		t.Errorf("init TID in root namespace: got %d, wanted 100", got)
+	}
+
+	// Unspecified levels are allocated as usual.
+	nt := newTask(child)
+	if err := ts.assignTIDsLocked(nt, []ThreadID{0, 200}); err != nil {
+		t.Fatalf("assignTIDsLocked({0, 200}) failed: %v", err)
+	}
+	if got := child.tids[nt]; got != 2 {
+		t.Errorf("TID in child namespace: got %d, wanted 2", got)
+	}
+	if got := ts.Root.tids[nt]; got != 200 {
+		t.Errorf("TID in root namespace: got %d, wanted 200", got)
+	}
+
+	// Thread IDs may not be reused.
+	if err := ts.assignTIDsLocked(newTask(child), []ThreadID{10, 200}); err != syserror.EEXIST {
+		t.Errorf("assignTIDsLocked({10, 200}): got %v, wanted %v", err, syserror.EEXIST)
+	}
+	if child.tasks[10] != nil {
+		t.Errorf("failed assignTIDsLocked left TID 10 allocated in child namespace")
+	}
+}
+
+func TestCheckSetTIDs(t *testing.T) {
+	ts := newTaskSet()
+	child := ts.Root.NewChild(ts.Root.userns)
+	root := auth.NewRootCredentials(ts.Root.userns)
+	anon := auth.NewAnonymousCredentials()
+
+	for _, test := range []struct {
+		name  string
+		creds *auth.Credentials
+		tids  []ThreadID
+		want  error
+	}{
+		{"none", anon, nil, nil},
+		{"privileged", root, []ThreadID{1, 10}, nil},
+		{"too deep", root, []ThreadID{1, 10, 20}, syserror.EINVAL},
+		{"out of range", root, []ThreadID{TasksLimit + 1}, syserror.EINVAL},
+		{"unprivileged", anon, []ThreadID{1}, syserror.EPERM},
+		{"unprivileged unspecified", anon, []ThreadID{0, 0}, nil},
+	} {
+		if got := checkSetTIDs(test.creds, child, test.tids); got != test.want {
+			t.Errorf("%s: checkSetTIDs(%v): got %v, wanted %v", test.name, test.tids, got, test.want)
+		}
+	}
+}
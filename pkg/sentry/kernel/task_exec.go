@@ -84,6 +84,12 @@ func (*execStop) Killable() bool { return true }
 // Preconditions: The caller must be running Task.doSyscallInvoke on the task
 // goroutine.
 func (t *Task) Execve(newTC *TaskContext) (*SyscallControl, error) {
+	if p := t.tg.execPolicy; p != nil {
+		root := t.FSContext().RootDirectory()
+		newTC.MemoryManager.SetExecPolicy(p, executablePath(newTC.MemoryManager, root))
+		root.DecRef()
+	}
+
 	t.tg.pidns.owner.mu.Lock()
 	defer t.tg.pidns.owner.mu.Unlock()
 	t.tg.signalHandlers.mu.Lock()
@@ -169,6 +175,8 @@ func (r *runSyscallAfterExecStop) execute(t *Task) taskRunState {
 	// Restartable sequence state is discarded.
 	t.rseqPreempted = false
 	t.rseqCPUAddr = 0
+	t.rseqAddr = 0
+	t.rseqSignature = 0
 	t.rseqCPU = -1
 	t.tg.rscr.Store(&RSEQCriticalRegion{})
 	t.tg.pidns.owner.mu.Unlock()
@@ -191,6 +199,7 @@ func (r *runSyscallAfterExecStop) execute(t *Task) taskRunState {
 	// NOTE: All locks must be dropped prior to calling Activate.
 	t.MemoryManager().Activate()
 
+	t.recordProcessExec(t)
 	t.ptraceExec(oldTID)
 	return (*runSyscallExit)(nil)
 }
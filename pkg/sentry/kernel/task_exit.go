@@ -46,6 +46,9 @@ type ExitStatus struct {
 	// Signo is the signal that caused the exit. If the exit was not caused by
 	// a signal, Signo is 0.
 	Signo int
+
+	// CoreDumped is true if the signal that caused the exit dumped a core.
+	CoreDumped bool
 }
 
 // Signaled returns true if the ExitStatus indicates that the exiting task or
@@ -57,7 +60,12 @@ func (es ExitStatus) Signaled() bool {
 // Status returns the numeric representation of the ExitStatus returned by e.g.
 // the wait4() system call.
 func (es ExitStatus) Status() uint32 {
-	return ((uint32(es.Code) & 0xff) << 8) | (uint32(es.Signo) & 0xff)
+	status := ((uint32(es.Code) & 0xff) << 8) | (uint32(es.Signo) & 0xff)
+	if es.CoreDumped {
+		// Linux: include/uapi/linux/wait.h:WCOREFLAG.
+		status |= 0x80
+	}
+	return status
 }
 
 // ShellExitCode returns the numeric exit code that Bash would return for an
@@ -266,6 +274,10 @@ func (*runExitMain) execute(t *Task) taskRunState {
 	// If this is the last task to exit from the thread group, release the
 	// thread group's resources.
 	if lastExiter {
+		t.recordProcessEvent(ProcessEvent{
+			Type:       ProcessExit,
+			ExitStatus: t.tg.ExitStatus().Status(),
+		})
 		t.tg.release()
 	}
 
@@ -664,8 +676,17 @@ func (t *Task) exitNotifyLocked(fromPtraceDetach bool) {
 			delete(ns.tasks, tid)
 			delete(ns.tids, t)
 		}
-		t.tg.exitedCPUStats.Accumulate(t.CPUStats())
+		t.tg.pids.uncharge()
+		// t.creds can no longer change since t has exited.
+		t.k.tasks.userProcesses.dec(t.creds.RealKUID)
+		stats := t.CPUStats()
+		t.tg.exitedCPUStats.Accumulate(stats)
 		t.tg.ioUsage.Accumulate(t.ioUsage)
+		delay, count := t.SchedDelay()
+		t.tg.exitedSchedDelay.total += uint64(delay)
+		t.tg.exitedSchedDelay.count += count
+		t.k.tasks.exitedCPUStats.Accumulate(stats)
+		t.k.tasks.exitedIOUsage.Accumulate(t.ioUsage)
 		t.tg.signalHandlers.mu.Lock()
 		t.tg.tasks.Remove(t)
 		if t.tg.lastTimerSignalTask == t {
@@ -17,6 +17,7 @@ package kernel
 import (
 	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/mm"
 	"gvisor.googlesource.com/gvisor/pkg/syserror"
 )
 
@@ -164,6 +165,10 @@ func (t *Task) setKUIDsUncheckedLocked(newR, newE, newS auth.KUID) {
 	oldR, oldE, oldS := t.creds.RealKUID, t.creds.EffectiveKUID, t.creds.SavedKUID
 	t.creds.RealKUID, t.creds.EffectiveKUID, t.creds.SavedKUID = newR, newE, newS
 
+	// t now counts towards newR's RLIMIT_NPROC instead of oldR's. Compare
+	// Linux's kernel/sys.c:set_user().
+	t.k.tasks.userProcesses.transfer(oldR, newR)
+
 	// "1. If one or more of the real, effective or saved set user IDs was
 	// previously 0, and as a result of the UID changes all of these IDs have a
 	// nonzero value, then all capabilities are cleared from the permitted and
@@ -206,6 +211,18 @@ func (t *Task) setKUIDsUncheckedLocked(newR, newE, newS auth.KUID) {
 	// Not documented, but compare Linux's kernel/cred.c:commit_creds().
 	if oldE != newE {
 		t.parentDeathSignal = 0
+		t.dropDumpabilityLocked()
+	}
+}
+
+// dropDumpabilityLocked makes t's MemoryManager undumpable after a change of
+// credentials, as Linux does with the default fs.suid_dumpable of 0. Compare
+// Linux's kernel/cred.c:commit_creds().
+//
+// Preconditions: t.mu must be locked.
+func (t *Task) dropDumpabilityLocked() {
+	if tmm := t.MemoryManager(); tmm != nil {
+		tmm.SetDumpability(mm.NotDumpable)
 	}
 }
 
@@ -302,6 +319,7 @@ func (t *Task) setKGIDsUncheckedLocked(newR, newE, newS auth.KGID) {
 	// Not documented, but compare Linux's kernel/cred.c:commit_creds().
 	if oldE != newE {
 		t.parentDeathSignal = 0
+		t.dropDumpabilityLocked()
 	}
 }
 
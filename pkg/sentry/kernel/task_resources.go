@@ -38,13 +38,16 @@ type TaskResources struct {
 }
 
 // newTaskResources returns a new TaskResources, taking an additional reference
-// on fdm.
-func newTaskResources(fdm *FDMap, fc *FSContext) *TaskResources {
+// on fdm. If as is nil, the TaskResources get a new AbstractSocketNamespace.
+func newTaskResources(fdm *FDMap, fc *FSContext, as *AbstractSocketNamespace) *TaskResources {
 	fdm.IncRef()
+	if as == nil {
+		as = NewAbstractSocketNamespace()
+	}
 	return &TaskResources{
 		FDMap:           fdm,
 		FSContext:       fc,
-		AbstractSockets: NewAbstractSocketNamespace(),
+		AbstractSockets: as,
 	}
 }
 
@@ -16,13 +16,16 @@ package kernel
 
 import (
 	"bytes"
+	"os"
 	"runtime"
 	"sync/atomic"
 
 	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/log"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/arch"
 	ktime "gvisor.googlesource.com/gvisor/pkg/sentry/kernel/time"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/memmap"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/mm"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/platform"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
 	"gvisor.googlesource.com/gvisor/pkg/syserror"
@@ -55,6 +58,15 @@ type taskRunState interface {
 // make it visible in stack dumps. A goroutine for a given task can be identified
 // searching for Task.run()'s argument value.
 func (t *Task) run(threadID uintptr) {
+	// Report the recent log messages if the sentry panics while running
+	// the task, since they often explain how it got there.
+	defer func() {
+		if r := recover(); r != nil {
+			log.DumpRecent(os.Stderr)
+			panic(r)
+		}
+	}()
+
 	// Construct t.blockingTimer here. We do this here because we can't
 	// reconstruct t.blockingTimer during restore in Task.afterLoad(), because
 	// kernel.timekeeper.SetClocks() hasn't been called yet.
@@ -170,16 +182,19 @@ func (*runApp) execute(t *Task) taskRunState {
 	// Apply restartable sequences.
 	if t.rseqPreempted {
 		t.rseqPreempted = false
-		if t.rseqCPUAddr != 0 {
+		if t.rseqCPUAddr != 0 || t.rseqAddr != 0 {
 			if err := t.rseqCopyOutCPU(); err != nil {
-				t.Warningf("Failed to copy CPU to %#x for RSEQ: %v", t.rseqCPUAddr, err)
+				t.Warningf("Failed to copy CPU for RSEQ: %v", err)
 				t.forceSignal(linux.SIGSEGV, false)
 				t.SendSignal(sigPriv(linux.SIGSEGV))
 				// Re-enter the task run loop for signal delivery.
 				return (*runApp)(nil)
 			}
 		}
-		t.rseqInterrupt()
+		if !t.rseqInterrupt() {
+			// Re-enter the task run loop for signal delivery.
+			return (*runApp)(nil)
+		}
 	}
 
 	// Check if we need to enable single-stepping. Tracers expect that the
@@ -219,6 +234,12 @@ func (*runApp) execute(t *Task) taskRunState {
 	case platform.ErrContextInterrupt:
 		// Interrupted by platform.Context.Interrupt(). Re-enter the run
 		// loop to figure out why.
+		if atomic.SwapUint32(&t.preempt, 0) != 0 {
+			// The time slice has expired; let other task goroutines
+			// run before continuing.
+			preemptMetric.Increment()
+			runtime.Gosched()
+		}
 		return (*runApp)(nil)
 
 	case platform.ErrContextSignal:
@@ -239,6 +260,15 @@ func (*runApp) execute(t *Task) taskRunState {
 				return (*runApp)(nil)
 			}
 
+			// Was the fault reported to a userfaultfd? If so, wait for it
+			// to be resolved and then retry the faulting instruction. If
+			// we're interrupted, the run loop will handle the interruption
+			// and the instruction will fault again.
+			if uerr, ok := err.(*mm.UserfaultError); ok {
+				t.Block(uerr.C)
+				return (*runApp)(nil)
+			}
+
 			// Is this a vsyscall that we need emulate?
 			if at.Execute {
 				if sysno, ok := t.tc.st.LookupEmulate(addr); ok {
@@ -254,6 +284,7 @@ func (*runApp) execute(t *Task) taskRunState {
 				t.Warningf("Unhandled user fault: addr=%x ip=%x access=%v err=%v", addr, t.Arch().IP(), at, err)
 			}
 			t.DebugDumpState()
+			t.DumpTrace("Unhandled user fault")
 
 			// Continue to signal handling.
 			//
@@ -18,12 +18,15 @@ package kernel
 
 import (
 	"fmt"
+	"runtime"
 	"sync/atomic"
 	"time"
 
 	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/metric"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/hostcpu"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel/sched"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/platform"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/usage"
 	"gvisor.googlesource.com/gvisor/pkg/syserror"
 )
@@ -114,6 +117,130 @@ func (t *Task) accountTaskGoroutineLeave(state TaskGoroutineState) {
 	t.goschedSeq.EndWrite()
 }
 
+// preemptMetric counts the task goroutines preempted at the end of their time
+// slice.
+var preemptMetric = metric.MustCreateNewUint64Metric("/sched/preemptions", false /* sync */, "Number of task goroutines preempted at the end of their time slice.")
+
+// preemptTasks preempts the task goroutines that have executed application
+// code for at least a time slice, if more task goroutines are running than the
+// sentry has CPUs. now is the current value of the kernel's CPU clock.
+//
+// Task goroutines are otherwise scheduled by the Go runtime, which can't
+// preempt a goroutine while it executes application code. Without preemption,
+// a task in a tight loop can keep other runnable tasks off the CPUs for as long
+// as the host lets it run.
+//
+// Preempted task goroutines are interrupted, and call runtime.Gosched before
+// returning to application code.
+func (k *Kernel) preemptTasks(now uint64) {
+	if k.timeSlice == 0 {
+		return
+	}
+	k.tasks.mu.RLock()
+	defer k.tasks.mu.RUnlock()
+	if k.tasks.Root == nil {
+		return
+	}
+	var (
+		running int
+		expired []*Task
+	)
+	for t := range k.tasks.Root.tids {
+		info := t.TaskGoroutineSchedInfo()
+		switch info.State {
+		case TaskGoroutineRunningSys:
+			running++
+		case TaskGoroutineRunningApp:
+			running++
+			if now-info.Timestamp >= k.timeSlice {
+				expired = append(expired, t)
+			}
+		}
+	}
+	if running <= runtime.GOMAXPROCS(0) {
+		// No task goroutine is waiting for a CPU.
+		return
+	}
+	for _, t := range expired {
+		atomic.StoreUint32(&t.preempt, 1)
+		t.p.Interrupt()
+	}
+}
+
+// schedDelayMetric records the scheduling delays of all task goroutines, in
+// nanoseconds, by the kind of wakeup that made the task goroutine runnable.
+// Buckets range from 1us to ~0.5s.
+var schedDelayMetric = metric.MustCreateNewDistributionMetric("/sched/delay", false /* sync */, "Delay between a task becoming runnable and running, in nanoseconds.", metric.ExponentialBounds(1000, 2, 20), "wakeup", []string{"interrupt", "timeout"})
+
+// Field indices of schedDelayMetric.
+const (
+	schedDelayInterrupt = iota
+	schedDelayTimeout
+)
+
+// schedDelay accumulates the scheduling delays of a task goroutine: the time
+// between when the task goroutine is made runnable and when it begins
+// running, analogous to Linux's sched_info.run_delay.
+//
+// Task goroutines are scheduled by the Go runtime, so delays are only
+// measured for wakeups whose time is known to the kernel: expiry of the
+// deadline passed to Task.BlockWithDeadline, and interrupts of a task
+// goroutine in TaskGoroutineBlockedInterruptible (e.g. due to signal
+// delivery). Delays of other wakeups are not counted.
+type schedDelay struct {
+	// interruptTime is the time, in nanoseconds of the kernel's monotonic
+	// clock, at which the blocked task goroutine was interrupted, or 0 if
+	// it has not been interrupted since it blocked. interruptTime is
+	// accessed atomically.
+	interruptTime int64
+
+	// total is the sum of all measured delays in nanoseconds, and count is
+	// the number of measured delays. Both are accessed atomically.
+	total uint64
+	count uint64
+}
+
+// SchedDelay returns the sum of t's measured scheduling delays, and the number
+// of delays measured.
+func (t *Task) SchedDelay() (time.Duration, uint64) {
+	return time.Duration(atomic.LoadUint64(&t.schedDelay.total)), atomic.LoadUint64(&t.schedDelay.count)
+}
+
+// SchedDelay returns the sum of the measured scheduling delays of all past and
+// present threads in tg, and the number of delays measured.
+func (tg *ThreadGroup) SchedDelay() (time.Duration, uint64) {
+	tg.pidns.owner.mu.RLock()
+	defer tg.pidns.owner.mu.RUnlock()
+	total, count := time.Duration(tg.exitedSchedDelay.total), tg.exitedSchedDelay.count
+	// Account for active tasks.
+	for t := tg.tasks.Front(); t != nil; t = t.Next() {
+		d, n := t.SchedDelay()
+		total += d
+		count += n
+	}
+	return total, count
+}
+
+// recordSchedDelay adds a scheduling delay of d nanoseconds, measured for a
+// wakeup of the kind given by the schedDelayMetric field index wakeup.
+func (t *Task) recordSchedDelay(wakeup int, d int64) {
+	if d < 0 {
+		d = 0
+	}
+	atomic.AddUint64(&t.schedDelay.total, uint64(d))
+	atomic.AddUint64(&t.schedDelay.count, 1)
+	schedDelayMetric.Record(wakeup, uint64(d))
+}
+
+// noteInterrupt records the time of an interrupt of t, if its task goroutine
+// is blocked interruptibly.
+func (t *Task) noteInterrupt() {
+	if t.TaskGoroutineSchedInfo().State != TaskGoroutineBlockedInterruptible {
+		return
+	}
+	atomic.CompareAndSwapInt64(&t.schedDelay.interruptTime, 0, t.k.MonotonicClock().Now().Nanoseconds())
+}
+
 // TaskGoroutineSchedInfo returns a copy of t's task goroutine scheduling info.
 // Most clients should use t.CPUStats() instead.
 func (t *Task) TaskGoroutineSchedInfo() TaskGoroutineSchedInfo {
@@ -169,6 +296,20 @@ func (tg *ThreadGroup) CPUStats() usage.CPUStats {
 	return stats
 }
 
+// CPUStats returns the combined CPU usage statistics of all dead and live
+// tasks in the kernel.
+func (k *Kernel) CPUStats() usage.CPUStats {
+	k.tasks.mu.RLock()
+	defer k.tasks.mu.RUnlock()
+	now := k.CPUClockNow()
+	stats := k.tasks.exitedCPUStats
+	// Account for active tasks.
+	for t := range k.tasks.Root.tids {
+		stats.Accumulate(t.cpuStatsAt(now))
+	}
+	return stats
+}
+
 // JoinedChildCPUStats implements the semantics of RUSAGE_CHILDREN: "Return
 // resource usage statistics for all children of [tg] that have terminated and
 // been waited for. These statistics will include the resources used by
@@ -311,6 +452,21 @@ func (t *Task) SetNiceness(n int) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 	t.niceness = n
+	t.propagateNiceness()
+}
+
+// propagateNiceness passes t's niceness to its platform.Context, if enabled
+// by InitKernelArgs.PropagateNiceness and supported by the platform.
+//
+// Preconditions: t.mu must be locked, or t must not yet be visible to other
+// goroutines.
+func (t *Task) propagateNiceness() {
+	if !t.k.propagateNiceness {
+		return
+	}
+	if ns, ok := t.p.(platform.NicenessSetter); ok {
+		ns.SetNiceness(t.niceness)
+	}
 }
 
 // NumaPolicy returns t's current numa policy.
@@ -0,0 +1,94 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/sentry/platform"
+)
+
+func TestSchedDelay(t *testing.T) {
+	var task Task
+	if d, n := task.SchedDelay(); d != 0 || n != 0 {
+		t.Errorf("SchedDelay() = (%v, %d), want (0, 0)", d, n)
+	}
+
+	_, sumBefore := schedDelayMetric.Value(schedDelayTimeout)
+	task.recordSchedDelay(schedDelayTimeout, 5000)
+	// Negative delays, from clock skew, count as 0.
+	task.recordSchedDelay(schedDelayInterrupt, -3)
+
+	if d, n := task.SchedDelay(); d != 5*time.Microsecond || n != 2 {
+		t.Errorf("SchedDelay() = (%v, %d), want (%v, 2)", d, n, 5*time.Microsecond)
+	}
+	if _, sum := schedDelayMetric.Value(schedDelayTimeout); sum-sumBefore != 5000 {
+		t.Errorf("Timeout delays recorded in metric = %d, want 5000", sum-sumBefore)
+	}
+}
+
+// interruptCountingContext is a platform.Context that counts calls to
+// Interrupt.
+type interruptCountingContext struct {
+	platform.Context
+	interrupts int
+}
+
+// Interrupt implements platform.Context.Interrupt.
+func (c *interruptCountingContext) Interrupt() {
+	c.interrupts++
+}
+
+func TestPreemptTasks(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(1))
+
+	const now = 100
+	k := &Kernel{tasks: newTaskSet(), timeSlice: 2}
+	newTask := func(state TaskGoroutineState, since uint64) (*Task, *interruptCountingContext) {
+		c := &interruptCountingContext{}
+		task := &Task{p: c}
+		task.gosched = TaskGoroutineSchedInfo{State: state, Timestamp: since}
+		k.tasks.Root.tids[task] = ThreadID(len(k.tasks.Root.tids) + 1)
+		return task, c
+	}
+
+	expired, expiredCtx := newTask(TaskGoroutineRunningApp, now-2)
+	k.preemptTasks(now)
+	if expiredCtx.interrupts != 0 {
+		t.Errorf("Task preempted without another running task goroutine")
+	}
+
+	fresh, freshCtx := newTask(TaskGoroutineRunningApp, now-1)
+	_, blockedCtx := newTask(TaskGoroutineBlockedInterruptible, 0)
+	k.preemptTasks(now)
+	if expiredCtx.interrupts != 1 || atomic.LoadUint32(&expired.preempt) != 1 {
+		t.Errorf("Task at the end of its time slice not preempted: %d interrupts, preempt = %d", expiredCtx.interrupts, expired.preempt)
+	}
+	if freshCtx.interrupts != 0 || atomic.LoadUint32(&fresh.preempt) != 0 {
+		t.Errorf("Task within its time slice preempted")
+	}
+	if blockedCtx.interrupts != 0 {
+		t.Errorf("Blocked task preempted")
+	}
+
+	k.timeSlice = 0
+	k.preemptTasks(now)
+	if expiredCtx.interrupts != 1 {
+		t.Errorf("Task preempted with preemption disabled")
+	}
+}
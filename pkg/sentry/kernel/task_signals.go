@@ -197,7 +197,13 @@ func (t *Task) deliverSignal(info *arch.SignalInfo, act arch.SignalAct) taskRunS
 	case SignalActionTerm, SignalActionCore:
 		// "Default action is to terminate the process." - signal(7)
 		t.Debugf("Signal %d: terminating thread group", info.Signo)
-		t.PrepareGroupExit(ExitStatus{Signo: int(info.Signo)})
+		es := ExitStatus{Signo: int(info.Signo)}
+		if sigact == SignalActionCore {
+			// "Default action is to terminate the process and dump
+			// core (see core(5))." - signal(7)
+			es.CoreDumped = t.dumpCore(info)
+		}
+		t.PrepareGroupExit(es)
 		return (*runExit)(nil)
 
 	case SignalActionStop:
@@ -15,6 +15,7 @@
 package kernel
 
 import (
+	"gvisor.googlesource.com/gvisor/pkg/bpf"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/arch"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel/auth"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel/futex"
@@ -58,6 +59,14 @@ type TaskConfig struct {
 
 	// IPCNamespace is the IPCNamespace of the new task.
 	IPCNamespace *IPCNamespace
+
+	// SyscallFilters is the initial set of seccomp-bpf syscall filters of
+	// the new task.
+	SyscallFilters []bpf.Program
+
+	// SetTIDs contains the thread IDs requested for the new task; see
+	// CloneOptions.SetTIDs.
+	SetTIDs []ThreadID
 }
 
 // NewTask creates a new task defined by TaskConfig.
@@ -103,9 +112,11 @@ func (ts *TaskSet) newTask(cfg *TaskConfig) (*Task, error) {
 		ipcns:          cfg.IPCNamespace,
 		rseqCPU:        -1,
 		futexWaiter:    futex.NewWaiter(),
+		syscallFilters: append([]bpf.Program(nil), cfg.SyscallFilters...),
 	}
 	t.endStopCond.L = &t.tg.signalHandlers.mu
 	t.ptraceTracer.Store((*Task)(nil))
+	t.propagateNiceness()
 	// We don't construct t.blockingTimer until Task.run(); see that function
 	// for justification.
 
@@ -122,7 +133,22 @@ func (ts *TaskSet) newTask(cfg *TaskConfig) (*Task, error) {
 		// we're in uncharted territory and can return whatever we want.
 		return nil, syserror.EINTR
 	}
-	if err := ts.assignTIDsLocked(t); err != nil {
+	if err := tg.pids.tryCharge(); err != nil {
+		return nil, err
+	}
+	if cfg.Parent != nil {
+		if err := ts.userProcesses.tryInc(t.creds, tg.limits, cfg.Kernel.rootUserNamespace); err != nil {
+			tg.pids.uncharge()
+			return nil, err
+		}
+	} else {
+		// Tasks created by Kernel.CreateProcess are analogous to execve(2)
+		// by the container runtime, which doesn't check RLIMIT_NPROC.
+		ts.userProcesses.inc(t.creds.RealKUID)
+	}
+	if err := ts.assignTIDsLocked(t, cfg.SetTIDs); err != nil {
+		ts.userProcesses.dec(t.creds.RealKUID)
+		tg.pids.uncharge()
 		return nil, err
 	}
 	// Below this point, newTask is expected not to fail (there is no rollback
@@ -167,17 +193,27 @@ func (ts *TaskSet) newTask(cfg *TaskConfig) (*Task, error) {
 }
 
 // assignTIDsLocked ensures that new task t is visible in all PID namespaces in
-// which it should be visible.
+// which it should be visible. setTIDs contains the thread IDs requested for t
+// in t's PID namespace and its ancestors, in that order; see
+// CloneOptions.SetTIDs.
 //
 // Preconditions: ts.mu must be locked for writing.
-func (ts *TaskSet) assignTIDsLocked(t *Task) error {
+func (ts *TaskSet) assignTIDsLocked(t *Task, setTIDs []ThreadID) error {
 	type allocatedTID struct {
 		ns  *PIDNamespace
 		tid ThreadID
 	}
 	var allocatedTIDs []allocatedTID
-	for ns := t.tg.pidns; ns != nil; ns = ns.parent {
-		tid, err := ns.allocateTID()
+	for ns, i := t.tg.pidns, 0; ns != nil; ns, i = ns.parent, i+1 {
+		var (
+			tid ThreadID
+			err error
+		)
+		if i < len(setTIDs) && setTIDs[i] != 0 {
+			tid, err = ns.allocateSpecificTID(setTIDs[i])
+		} else {
+			tid, err = ns.allocateTID()
+		}
 		if err != nil {
 			// Failure. Remove the tids we already allocated in descendant
 			// namespaces.
@@ -228,6 +264,28 @@ func (ns *PIDNamespace) allocateTID() (ThreadID, error) {
 	}
 }
 
+// allocateSpecificTID reserves tid in ns, returning tid if it is unused.
+//
+// Preconditions: ns.owner.mu must be locked for writing.
+func (ns *PIDNamespace) allocateSpecificTID(tid ThreadID) (ThreadID, error) {
+	if ns.exiting {
+		// See allocateTID.
+		return 0, syserror.ENOMEM
+	}
+	if tid < InitTID || tid > TasksLimit {
+		return 0, syserror.EINVAL
+	}
+	// Only the init process of a PID namespace can have TID 1, and it must
+	// be the first task created in the namespace.
+	if tid != InitTID && ns.tasks[InitTID] == nil {
+		return 0, syserror.EINVAL
+	}
+	if _, ok := ns.tasks[tid]; ok {
+		return 0, syserror.EEXIST
+	}
+	return tid, nil
+}
+
 // Start starts the task goroutine. Start must be called exactly once for each
 // task returned by NewTask.
 //
@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"os"
 	"syscall"
+	"time"
 
 	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
 	"gvisor.googlesource.com/gvisor/pkg/bits"
@@ -151,13 +152,25 @@ func (t *Task) executeSyscall(sysno uintptr, args arch.SyscallArguments) (rval u
 		straceContext = s.Stracer.SyscallEnter(t, sysno, args, fe)
 	}
 
+	var start time.Time
+	if bits.IsOn32(fe, LatencyEnable) {
+		start = time.Now()
+	}
+
+	if bits.IsOn32(fe, CountEnable) {
+		countSyscall(sysno)
+	}
+
 	if bits.IsOn32(fe, ExternalBeforeEnable) && (s.ExternalFilterBefore == nil || s.ExternalFilterBefore(t, sysno, args)) {
 		t.invokeExternal()
 		// Ensure we check for stops, then invoke the syscall again.
 		ctrl = ctrlStopAndReinvokeSyscall
 	} else {
 		fn := s.Lookup(sysno)
-		if fn != nil {
+		if w := t.tg.syscallWhitelist; !w.Allowed(sysno) {
+			w.deny(t, sysno)
+			err = syserror.ENOSYS
+		} else if fn != nil {
 			// Call our syscall implementation.
 			rval, ctrl, err = fn(t, args)
 		} else {
@@ -171,6 +184,10 @@ func (t *Task) executeSyscall(sysno uintptr, args arch.SyscallArguments) (rval u
 		// Don't reinvoke the syscall.
 	}
 
+	if bits.IsOn32(fe, LatencyEnable) {
+		t.recordSyscallLatency(sysno, start)
+	}
+
 	if bits.IsAnyOn32(fe, StraceEnableBits) {
 		s.Stracer.SyscallExit(straceContext, t, sysno, rval, err)
 	}
@@ -192,6 +209,13 @@ func (t *Task) doSyscall() taskRunState {
 	tmp := uintptr(syscall.ENOSYS)
 	t.Arch().SetReturn(-tmp)
 
+	// Check the syscall origin policy before seccomp filters installed by
+	// the application, which cannot relax it.
+	if p := t.tg.syscallOrigins; p != nil && !t.checkSyscallOrigin(p, sysno) {
+		t.PrepareGroupExit(ExitStatus{Signo: int(linux.SIGSYS)})
+		return (*runExit)(nil)
+	}
+
 	// Check seccomp filters. The nil check is for performance (as seccomp use
 	// is rare), not needed for correctness.
 	if t.syscallFilters != nil {
@@ -0,0 +1,93 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"sync"
+)
+
+// traceRing holds a task's most recent syscall traces, so that they can be
+// logged when the task encounters an anomaly. Traces are only recorded for
+// syscalls with StraceEnableRing set.
+type traceRing struct {
+	// mu protects the fields below. mu is a leaf lock.
+	mu sync.Mutex
+
+	// lines is the ring buffer of traces. It is allocated by the first
+	// call to RecordTrace.
+	lines []string
+
+	// next is the index in lines at which the next trace is recorded.
+	next int
+
+	// count is the number of traces in lines.
+	count int
+}
+
+// record adds line to r, which holds at most max traces. If r is full, the
+// oldest trace is discarded.
+func (r *traceRing) record(max int, line string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.lines) != max {
+		r.lines = make([]string, max)
+		r.next = 0
+		r.count = 0
+	}
+	r.lines[r.next] = line
+	r.next = (r.next + 1) % max
+	if r.count < max {
+		r.count++
+	}
+}
+
+// drain removes and returns the traces in r, oldest first.
+func (r *traceRing) drain() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	lines := make([]string, 0, r.count)
+	for i := r.count; i > 0; i-- {
+		j := (r.next - i + len(r.lines)) % len(r.lines)
+		lines = append(lines, r.lines[j])
+		r.lines[j] = ""
+	}
+	r.count = 0
+	return lines
+}
+
+// RecordTrace records a syscall trace in t's trace ring, which holds at most
+// max traces. If the ring is full, the oldest trace is discarded.
+func (t *Task) RecordTrace(max int, line string) {
+	if max <= 0 {
+		return
+	}
+	t.traceRing.record(max, line)
+}
+
+// DumpTrace logs and clears the syscall traces in t's trace ring, citing
+// reason as the anomaly that caused the dump. If no traces have been
+// recorded, DumpTrace does nothing.
+//
+// DumpTrace may be called from any goroutine.
+func (t *Task) DumpTrace(reason string) {
+	lines := t.traceRing.drain()
+	if len(lines) == 0 {
+		return
+	}
+	t.Warningf("%s; %d most recent syscalls:", reason, len(lines))
+	for _, line := range lines {
+		t.Warningf("    %s", line)
+	}
+}
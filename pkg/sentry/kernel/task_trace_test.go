@@ -0,0 +1,44 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTraceRing(t *testing.T) {
+	var r traceRing
+	if got := r.drain(); len(got) != 0 {
+		t.Errorf("drain() on empty ring = %v, want none", got)
+	}
+
+	r.record(3, "a")
+	r.record(3, "b")
+	if got, want := r.drain(), []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("drain() = %v, want %v", got, want)
+	}
+
+	// Once full, the oldest traces are discarded.
+	for _, line := range []string{"c", "d", "e", "f", "g"} {
+		r.record(3, line)
+	}
+	if got, want := r.drain(), []string{"e", "f", "g"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("drain() after wrapping = %v, want %v", got, want)
+	}
+	if got := r.drain(); len(got) != 0 {
+		t.Errorf("second drain() = %v, want none", got)
+	}
+}
@@ -19,7 +19,9 @@ import (
 	"sync/atomic"
 
 	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/bpf"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/limits"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/mm"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/usage"
 )
 
@@ -137,6 +139,13 @@ type ThreadGroup struct {
 	// When exiting becomes true, exitStatus becomes immutable.
 	exitStatus ExitStatus
 
+	// dumpingCore is true while a task in the thread group is writing a core
+	// dump, during which the other tasks in the thread group are stopped.
+	// dumpingCore is analogous to Linux's signal_struct::core_state.
+	//
+	// dumpingCore is protected by the signal mutex.
+	dumpingCore bool
+
 	// terminationSignal is the signal that this thread group's leader will
 	// send to its parent when it exits.
 	//
@@ -157,6 +166,11 @@ type ThreadGroup struct {
 	// group. exitedCPUStats is protected by the TaskSet mutex.
 	exitedCPUStats usage.CPUStats
 
+	// exitedSchedDelay accumulates the scheduling delays of all exited tasks
+	// in the thread group. exitedSchedDelay is protected by the TaskSet
+	// mutex.
+	exitedSchedDelay schedDelay `state:"nosave"`
+
 	// childCPUStats is the CPU usage of all joined descendants of this thread
 	// group. childCPUStats is protected by the TaskSet mutex.
 	childCPUStats usage.CPUStats
@@ -185,6 +199,39 @@ type ThreadGroup struct {
 	// Resource limits for this ThreadGroup. The limits pointer is immutable.
 	limits *limits.LimitSet
 
+	// pids limits the number of tasks in this ThreadGroup and the thread
+	// groups that it forks. Each task in the ThreadGroup is charged to pids
+	// from when it is created until it is reaped. The pids pointer is
+	// immutable.
+	pids *PIDsController
+
+	// syscallWhitelist restricts the syscalls that tasks in this
+	// ThreadGroup may invoke. If syscallWhitelist is nil, all syscalls are
+	// permitted. The syscallWhitelist pointer is immutable.
+	syscallWhitelist *SyscallWhitelist
+
+	// syscallOrigins restricts the code from which tasks in this
+	// ThreadGroup may invoke syscalls. If syscallOrigins is nil, syscalls
+	// may be invoked from anywhere. The syscallOrigins pointer is immutable.
+	syscallOrigins *SyscallOriginPolicy
+
+	// execPolicy restricts the executable mappings that tasks in this
+	// ThreadGroup may create. It is applied to each MemoryManager created
+	// by execve. If execPolicy is nil, executable mappings are
+	// unrestricted. The execPolicy pointer is immutable.
+	execPolicy *mm.ExecPolicy
+
+	// redaction masks secrets in trace and event payloads describing tasks
+	// in this ThreadGroup. If redaction is nil, nothing is masked. The
+	// redaction pointer is immutable.
+	redaction *RedactionPolicy
+
+	// initialSyscallFilters are the seccomp-bpf filters that were installed
+	// on this ThreadGroup's first task by Kernel.CreateProcess. They do not
+	// include filters installed by the application. initialSyscallFilters
+	// is immutable.
+	initialSyscallFilters []bpf.Program
+
 	// processGroup is the processGroup for this thread group.
 	//
 	// processGroup is protected by the TaskSet mutex.
@@ -204,8 +251,9 @@ type ThreadGroup struct {
 // NewThreadGroup returns a new, empty thread group in PID namespace ns. The
 // thread group leader will send its parent terminationSignal when it exits.
 // The new thread group isn't visible to the system until a task has been
-// created inside of it by a successful call to TaskSet.NewTask.
-func NewThreadGroup(ns *PIDNamespace, sh *SignalHandlers, terminationSignal linux.Signal, limits *limits.LimitSet, monotonicClock *timekeeperClock) *ThreadGroup {
+// created inside of it by a successful call to TaskSet.NewTask. Tasks in the
+// thread group are charged to pids.
+func NewThreadGroup(ns *PIDNamespace, sh *SignalHandlers, terminationSignal linux.Signal, limits *limits.LimitSet, pids *PIDsController, monotonicClock *timekeeperClock) *ThreadGroup {
 	tg := &ThreadGroup{
 		threadGroupNode: threadGroupNode{
 			pidns: ns,
@@ -214,6 +262,7 @@ func NewThreadGroup(ns *PIDNamespace, sh *SignalHandlers, terminationSignal linu
 		terminationSignal: terminationSignal,
 		ioUsage:           &usage.IO{},
 		limits:            limits,
+		pids:              pids,
 	}
 	tg.tm = newTimerManager(tg, monotonicClock)
 	tg.rscr.Store(&RSEQCriticalRegion{})
@@ -238,6 +287,41 @@ func (tg *ThreadGroup) SignalHandlers() *SignalHandlers {
 	return tg.signalHandlers
 }
 
+// PIDsController returns the PIDsController that tasks in tg are charged to.
+func (tg *ThreadGroup) PIDsController() *PIDsController {
+	return tg.pids
+}
+
+// SyscallWhitelist returns the syscall whitelist that restricts tasks in tg,
+// or nil if tg is unrestricted.
+func (tg *ThreadGroup) SyscallWhitelist() *SyscallWhitelist {
+	return tg.syscallWhitelist
+}
+
+// SyscallOriginPolicy returns the policy that restricts the code from which
+// tasks in tg may invoke syscalls, or nil if tg is unrestricted.
+func (tg *ThreadGroup) SyscallOriginPolicy() *SyscallOriginPolicy {
+	return tg.syscallOrigins
+}
+
+// ExecPolicy returns the policy that restricts executable mappings in tg, or
+// nil if tg is unrestricted.
+func (tg *ThreadGroup) ExecPolicy() *mm.ExecPolicy {
+	return tg.execPolicy
+}
+
+// RedactionPolicy returns the policy that masks secrets in trace and event
+// payloads describing tg, or nil if nothing is masked.
+func (tg *ThreadGroup) RedactionPolicy() *RedactionPolicy {
+	return tg.redaction
+}
+
+// InitialSyscallFilters returns the seccomp-bpf filters that were installed
+// on tg by Kernel.CreateProcess.
+func (tg *ThreadGroup) InitialSyscallFilters() []bpf.Program {
+	return tg.initialSyscallFilters
+}
+
 // Timer returns tg's timers.
 func (tg *ThreadGroup) Timer() *TimerManager {
 	return &tg.tm
@@ -19,6 +19,7 @@ import (
 	"sync"
 
 	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usage"
 	"gvisor.googlesource.com/gvisor/pkg/waiter"
 )
 
@@ -85,11 +86,26 @@ type TaskSet struct {
 	// at time of save (but note that this is not necessarily the same thing as
 	// sync.WaitGroup's zero value).
 	runningGoroutines sync.WaitGroup `state:"nosave"`
+
+	// userProcesses counts the tasks in the TaskSet that belong to each
+	// user, for enforcement of RLIMIT_NPROC.
+	userProcesses userProcesses
+
+	// exitedCPUStats is the CPU usage of all released tasks in the TaskSet.
+	// exitedCPUStats is protected by mu.
+	exitedCPUStats usage.CPUStats
+
+	// exitedIOUsage is the I/O usage of all released tasks in the TaskSet.
+	// The exitedIOUsage pointer is immutable.
+	exitedIOUsage *usage.IO
 }
 
 // newTaskSet returns a new, empty TaskSet.
 func newTaskSet() *TaskSet {
-	ts := &TaskSet{}
+	ts := &TaskSet{
+		userProcesses: newUserProcesses(),
+		exitedIOUsage: &usage.IO{},
+	}
 	ts.Root = newPIDNamespace(ts, nil /* parent */, auth.NewRootUserNamespace())
 	return ts
 }
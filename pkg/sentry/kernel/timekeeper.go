@@ -16,8 +16,10 @@ package kernel
 
 import (
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
 	"gvisor.googlesource.com/gvisor/pkg/log"
 	ktime "gvisor.googlesource.com/gvisor/pkg/sentry/kernel/time"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/platform"
@@ -65,15 +67,36 @@ type Timekeeper struct {
 	// monotonicOffset.
 	saveRealtime int64
 
+	// taiOffset is the offset of the TAI clock from the realtime clock, in
+	// seconds. It is accessed atomically.
+	taiOffset int32
+
+	// adjustMu protects adjust.
+	adjustMu sync.Mutex `state:"nosave"`
+
+	// adjust is the discipline of the realtime clock set with adjtimex(2).
+	adjust realtimeAdjust
+
 	// params manages the parameter page.
 	params *VDSOParamPage
 
+	// vdsoDisabled indicates that the parameters are never marked ready,
+	// so that the VDSO falls back to syscalls for all reads of time.
+	//
+	// It is not saved, as whether the VDSO can read time depends on the
+	// host. It is set by DisableVDSO before SetClocks.
+	vdsoDisabled bool `state:"nosave"`
+
 	// mu protects destruction with stop and wg.
 	mu sync.Mutex `state:"nosave"`
 
 	// stop is used to tell the update goroutine to exit.
 	stop chan struct{} `state:"nosave"`
 
+	// update is used to tell the update goroutine to update the
+	// parameters before the next update interval.
+	update chan struct{} `state:"nosave"`
+
 	// wg is used to indicate that the update goroutine has exited.
 	wg sync.WaitGroup `state:"nosave"`
 }
@@ -83,9 +106,23 @@ type Timekeeper struct {
 //
 // SetClocks must be called on the returned Timekeeper before it is usable.
 func NewTimekeeper(platform platform.Platform, paramPage platform.FileRange) (*Timekeeper, error) {
-	return &Timekeeper{
+	t := &Timekeeper{
 		params: NewVDSOParamPage(platform, paramPage),
-	}, nil
+	}
+	t.adjust.init()
+	return t, nil
+}
+
+// DisableVDSO makes the VDSO fall back to syscalls for all reads of time, so
+// that they are all served by the sentry. It is useful when the application
+// can't read the same clock source as the sentry.
+//
+// DisableVDSO must be called before SetClocks.
+func (t *Timekeeper) DisableVDSO() {
+	if t.clocks != nil {
+		panic("DisableVDSO called after SetClocks")
+	}
+	t.vdsoDisabled = true
 }
 
 // SetClocks the backing clock source.
@@ -164,6 +201,8 @@ func (t *Timekeeper) startUpdater() {
 		return
 	}
 	t.stop = make(chan struct{})
+	t.update = make(chan struct{}, 1)
+	stop, update := t.stop, t.update
 
 	// Keep the clocks up to date.
 	//
@@ -171,7 +210,8 @@ func (t *Timekeeper) startUpdater() {
 	// timer, so it may run at a *slightly* different rate from the
 	// application CLOCK_MONOTONIC. That is fine, as we only need to update
 	// at approximately this rate.
-	timer := time.NewTicker(sentrytime.ApproxUpdateInterval)
+	interval := t.clocks.UpdateInterval()
+	timer := time.NewTicker(interval)
 	t.wg.Add(1)
 	go func() { // S/R-SAFE: stopped during save.
 		for {
@@ -191,12 +231,32 @@ func (t *Timekeeper) startUpdater() {
 					p.monotonicBaseRef = int64(monotonicParams.BaseRef) + t.monotonicOffset
 					p.monotonicFrequency = monotonicParams.Frequency
 				}
+				if realtimeOk {
+					// Apply the discipline of the realtime
+					// clock until the next update.
+					t.adjustMu.Lock()
+					t.adjust.rebase(int64(realtimeParams.BaseRef), interval)
+					baseRef := t.adjust.apply(int64(realtimeParams.BaseRef))
+					rate := t.adjust.effectiveRate()
+					t.adjustMu.Unlock()
+					realtimeParams, realtimeOk = realtimeParams.Scaled(sentrytime.ReferenceNS(baseRef), rate)
+					if !realtimeOk {
+						log.Warningf("Unable to adjust realtime parameters by %d ppb", rate)
+					}
+				}
 				if realtimeOk {
 					p.realtimeReady = 1
 					p.realtimeBaseCycles = int64(realtimeParams.BaseCycles)
 					p.realtimeBaseRef = int64(realtimeParams.BaseRef)
 					p.realtimeFrequency = realtimeParams.Frequency
 				}
+				p.taiOffset = int64(t.TAIOffset()) * time.Second.Nanoseconds()
+				if t.vdsoDisabled {
+					// The clocks are still updated above,
+					// as the sentry uses them.
+					p.monotonicReady = 0
+					p.realtimeReady = 0
+				}
 
 				log.Debugf("Updating VDSO parameters: %+v", p)
 
@@ -207,7 +267,9 @@ func (t *Timekeeper) startUpdater() {
 
 			select {
 			case <-timer.C:
-			case <-t.stop:
+			case <-update:
+			case <-stop:
+				timer.Stop()
 				t.wg.Done()
 				return
 			}
@@ -227,6 +289,7 @@ func (t *Timekeeper) stopUpdater() {
 	close(t.stop)
 	t.wg.Wait()
 	t.stop = nil
+	t.update = nil
 }
 
 // Destroy destroys the Timekeeper, freeing all associated resources.
@@ -257,6 +320,19 @@ func (t *Timekeeper) GetTime(c sentrytime.ClockID) (int64, error) {
 	if t.clocks == nil {
 		panic("Timekeeper used before initialized with SetClocks")
 	}
+	if c == sentrytime.Realtime || c == sentrytime.TAI {
+		now, err := t.clocks.GetTime(sentrytime.Realtime)
+		if err != nil {
+			return 0, err
+		}
+		t.adjustMu.Lock()
+		now = t.adjust.apply(now)
+		t.adjustMu.Unlock()
+		if c == sentrytime.TAI {
+			now += int64(t.TAIOffset()) * time.Second.Nanoseconds()
+		}
+		return now, nil
+	}
 	now, err := t.clocks.GetTime(c)
 	if err == nil && c == sentrytime.Monotonic {
 		now += t.monotonicOffset
@@ -264,6 +340,84 @@ func (t *Timekeeper) GetTime(c sentrytime.ClockID) (int64, error) {
 	return now, err
 }
 
+// TAIOffset returns the offset of the TAI clock from the realtime clock, in
+// seconds.
+func (t *Timekeeper) TAIOffset() int32 {
+	return atomic.LoadInt32(&t.taiOffset)
+}
+
+// SetTAIOffset sets the offset of the TAI clock from the realtime clock, in
+// seconds.
+func (t *Timekeeper) SetTAIOffset(offset int32) {
+	atomic.StoreInt32(&t.taiOffset, offset)
+	t.kickUpdate()
+}
+
+// Adjtime reads, and adjusts as requested by txc.Modes, the discipline of the
+// realtime clock as adjtimex(2) does, and fills txc with the resulting state.
+// Adjustments only apply to the sandbox, not to the host clock.
+//
+// It returns the clock state, and whether the realtime or TAI clock was
+// stepped. The caller must check that the task may adjust the clock.
+func (t *Timekeeper) Adjtime(txc *linux.Timex) (uintptr, bool, error) {
+	if t.clocks == nil {
+		panic("Timekeeper used before initialized with SetClocks")
+	}
+	h, err := t.clocks.GetTime(sentrytime.Realtime)
+	if err != nil {
+		return 0, false, err
+	}
+	modes := txc.Modes
+
+	t.adjustMu.Lock()
+	tai := t.TAIOffset()
+	stepped, err := t.adjust.adjtime(h, t.clocks.UpdateInterval(), txc, &tai)
+	state := t.adjust.state()
+	t.adjustMu.Unlock()
+	if err != nil {
+		return 0, false, err
+	}
+
+	atomic.StoreInt32(&t.taiOffset, tai)
+	if modes != 0 && modes != linux.ADJ_OFFSET_SS_READ {
+		t.kickUpdate()
+	}
+	return state, stepped, nil
+}
+
+// SetRealtime steps the realtime clock of the sandbox to now, in nanoseconds.
+func (t *Timekeeper) SetRealtime(now int64) error {
+	if t.clocks == nil {
+		panic("Timekeeper used before initialized with SetClocks")
+	}
+	h, err := t.clocks.GetTime(sentrytime.Realtime)
+	if err != nil {
+		return err
+	}
+
+	t.adjustMu.Lock()
+	t.adjust.rebase(h, t.clocks.UpdateInterval())
+	t.adjust.offset += now - t.adjust.apply(h)
+	t.adjustMu.Unlock()
+
+	t.kickUpdate()
+	return nil
+}
+
+// kickUpdate updates the VDSO parameters now, rather than at the next update
+// interval, so that the VDSO doesn't use outdated parameters for long.
+func (t *Timekeeper) kickUpdate() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.update != nil {
+		select {
+		case t.update <- struct{}{}:
+		default:
+			// An update is already pending.
+		}
+	}
+}
+
 // BootTime returns the system boot real time.
 func (t *Timekeeper) BootTime() ktime.Time {
 	return t.bootTime
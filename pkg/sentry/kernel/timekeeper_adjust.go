@@ -0,0 +1,302 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"math"
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/syserror"
+)
+
+const (
+	// defaultTick is the default length of a clock tick in microseconds,
+	// as reported by adjtimex(2).
+	defaultTick = int64(linux.ClockTick / time.Microsecond)
+
+	// maxFreq is the maximum frequency adjustment, in units of 2^-16 ppm,
+	// as in Linux's MAXFREQ_SCALED.
+	maxFreq = 500 << 16
+
+	// maxSlewRate is the rate at which offsets are slewed away, in parts
+	// per billion. Linux slews adjtime(3) offsets at 500ppm.
+	maxSlewRate = 500000
+
+	// maxPhase is the maximum offset, in nanoseconds, that may be set with
+	// ADJ_OFFSET, as in Linux's MAXPHASE.
+	maxPhase = 500 * int64(time.Millisecond)
+
+	// maxTimeConstant is the maximum PLL time constant, as in Linux's MAXTC.
+	maxTimeConstant = 10
+
+	// phaseLimit is the initial maximum and estimated error in
+	// microseconds, as in Linux's NTP_PHASE_LIMIT.
+	phaseLimit = 16000000
+)
+
+// realtimeAdjust is the discipline of the sandbox's realtime clock, as set
+// with adjtimex(2). It only affects the sandbox: the sandbox's realtime clock
+// is the host's, stepped by offset, running at a rate adjusted by freq and
+// tick, and slewing away the remaining slew.
+//
+// The discipline is a simplification of Linux's NTP code. Offsets set with
+// ADJ_OFFSET, in PLL mode, and ADJ_OFFSET_SINGLESHOT are both slewed at up to
+// maxSlewRate, rather than by a PLL, and the errors do not grow over time.
+type realtimeAdjust struct {
+	// base is the host realtime at which offset and slew were last
+	// computed.
+	base int64
+
+	// offset is the difference between the sandbox and the host realtime at
+	// base, in nanoseconds.
+	offset int64
+
+	// slew is the offset that remains to be slewed away, in nanoseconds,
+	// and slewRate is the rate at which it is slewed away, in parts per
+	// billion.
+	slew     int64
+	slewRate int64
+
+	// freq is the frequency adjustment, in units of 2^-16 ppm.
+	freq int64
+
+	// tickAdjust is the difference between the length of a clock tick and
+	// defaultTick, in microseconds. Longer ticks make the clock run faster.
+	tickAdjust int64
+
+	// The following are only reported by adjtimex(2).
+	status   int32
+	constant int64
+	maxError int64
+	estError int64
+}
+
+// init sets the initial discipline, in which the clock is not adjusted and
+// reported as unsynchronized. The zero value doesn't adjust the clock either,
+// but reports it as synchronized.
+func (a *realtimeAdjust) init() {
+	*a = realtimeAdjust{
+		status:   linux.STA_UNSYNC,
+		constant: 2,
+		maxError: phaseLimit,
+		estError: phaseLimit,
+	}
+}
+
+// mulPPB returns d*ppb/10^9 without overflowing for large d.
+func mulPPB(d, ppb int64) int64 {
+	const nsPerSec = int64(time.Second)
+	return d/nsPerSec*ppb + d%nsPerSec*ppb/nsPerSec
+}
+
+// rate returns the rate adjustment of the clock, excluding slewing, in parts
+// per billion.
+func (a *realtimeAdjust) rate() int64 {
+	// 2^-16 ppm is 1000/65536 ppb, and each microsecond of tick is 100ppm.
+	return a.freq*1000/65536 + a.tickAdjust*100000
+}
+
+// slewed returns the part of slew that has been slewed away after d
+// nanoseconds.
+func (a *realtimeAdjust) slewed(d int64) int64 {
+	s := mulPPB(d, a.slewRate)
+	if a.slew < 0 {
+		if s > -a.slew {
+			return a.slew
+		}
+		return -s
+	}
+	if s > a.slew {
+		return a.slew
+	}
+	return s
+}
+
+// apply returns the sandbox realtime at host realtime h.
+func (a *realtimeAdjust) apply(h int64) int64 {
+	d := h - a.base
+	if d < 0 {
+		d = 0
+	}
+	return h + a.offset + mulPPB(d, a.rate()) + a.slewed(d)
+}
+
+// effectiveRate returns the rate adjustment of the clock until the next
+// rebase, including slewing, in parts per billion.
+func (a *realtimeAdjust) effectiveRate() int64 {
+	if a.slew < 0 {
+		return a.rate() - a.slewRate
+	}
+	return a.rate() + a.slewRate
+}
+
+// rebase moves base to host realtime h, which must be the current time, and
+// picks a slew rate such that slew is slewed away no faster than
+// maxSlewRate, and not beyond its end before the next rebase, interval later.
+func (a *realtimeAdjust) rebase(h int64, interval time.Duration) {
+	if d := h - a.base; d > 0 {
+		a.offset = a.apply(h) - h
+		a.slew -= a.slewed(d)
+		a.base = h
+	}
+
+	slew := a.slew
+	if slew < 0 {
+		slew = -slew
+	}
+	if slew >= mulPPB(int64(interval), maxSlewRate) {
+		a.slewRate = maxSlewRate
+	} else {
+		a.slewRate = slew * int64(time.Second) / int64(interval)
+	}
+}
+
+// adjtime implements adjtimex(2) for the discipline, with the host realtime
+// h, as described in Timekeeper.Adjtime.
+func (a *realtimeAdjust) adjtime(h int64, interval time.Duration, txc *linux.Timex, tai *int32) (stepped bool, err error) {
+	// Validate the modes first, so that nothing changes on failure. As in
+	// Linux, other modes are ignored with ADJ_ADJTIME.
+	if txc.Modes&linux.ADJ_ADJTIME == 0 {
+		if txc.Modes&linux.ADJ_TICK != 0 && (txc.Tick < defaultTick*9/10 || txc.Tick > defaultTick*11/10) {
+			return false, syserror.EINVAL
+		}
+		if txc.Modes&linux.ADJ_SETOFFSET != 0 {
+			limit := int64(time.Second / time.Microsecond)
+			if txc.Modes&linux.ADJ_NANO != 0 {
+				limit = int64(time.Second)
+			}
+			if txc.Time.Usec < 0 || txc.Time.Usec >= limit {
+				return false, syserror.EINVAL
+			}
+		}
+	}
+
+	// Bring the discipline up to date, so that changes apply from now.
+	a.rebase(h, interval)
+
+	if txc.Modes&linux.ADJ_ADJTIME != 0 {
+		// adjtime(3) reports the previous remaining offset, in
+		// microseconds.
+		prev := a.slew / int64(time.Microsecond)
+		if txc.Modes&linux.ADJ_OFFSET_READONLY == 0 {
+			a.slew = txc.Offset * int64(time.Microsecond)
+			a.rebase(h, interval)
+		}
+		a.report(h, txc, *tai)
+		txc.Offset = prev
+		return false, nil
+	}
+
+	if txc.Modes&linux.ADJ_SETOFFSET != 0 {
+		delta := txc.Time.Sec * int64(time.Second)
+		if txc.Modes&linux.ADJ_NANO != 0 {
+			delta += txc.Time.Usec
+		} else {
+			delta += txc.Time.Usec * int64(time.Microsecond)
+		}
+		a.offset += delta
+		stepped = true
+	}
+	if txc.Modes&linux.ADJ_STATUS != 0 {
+		a.status = (a.status & linux.STA_RONLY) | (txc.Status &^ linux.STA_RONLY)
+	}
+	if txc.Modes&linux.ADJ_NANO != 0 {
+		a.status |= linux.STA_NANO
+	}
+	if txc.Modes&linux.ADJ_MICRO != 0 {
+		a.status &^= linux.STA_NANO
+	}
+	if txc.Modes&linux.ADJ_FREQUENCY != 0 {
+		a.freq = txc.Freq
+		if a.freq > maxFreq {
+			a.freq = maxFreq
+		} else if a.freq < -maxFreq {
+			a.freq = -maxFreq
+		}
+	}
+	if txc.Modes&linux.ADJ_MAXERROR != 0 {
+		a.maxError = txc.MaxError
+	}
+	if txc.Modes&linux.ADJ_ESTERROR != 0 {
+		a.estError = txc.EstError
+	}
+	if txc.Modes&linux.ADJ_TIMECONST != 0 {
+		a.constant = txc.Constant
+		if a.constant < 0 {
+			a.constant = 0
+		} else if a.constant > maxTimeConstant {
+			a.constant = maxTimeConstant
+		}
+	}
+	if txc.Modes&linux.ADJ_TAI != 0 && txc.Constant >= 0 && txc.Constant <= math.MaxInt32 {
+		*tai = int32(txc.Constant)
+		stepped = true
+	}
+	// As in Linux, ADJ_OFFSET is ignored unless the PLL is enabled.
+	if txc.Modes&linux.ADJ_OFFSET != 0 && a.status&linux.STA_PLL != 0 {
+		offset := txc.Offset
+		if a.status&linux.STA_NANO == 0 {
+			offset *= int64(time.Microsecond)
+		}
+		if offset > maxPhase {
+			offset = maxPhase
+		} else if offset < -maxPhase {
+			offset = -maxPhase
+		}
+		a.slew = offset
+	}
+	if txc.Modes&linux.ADJ_TICK != 0 {
+		a.tickAdjust = txc.Tick - defaultTick
+	}
+
+	a.rebase(h, interval)
+	a.report(h, txc, *tai)
+	return stepped, nil
+}
+
+// report fills txc with the state of the discipline at host realtime h.
+func (a *realtimeAdjust) report(h int64, txc *linux.Timex, tai int32) {
+	now := a.apply(h)
+	nano := a.status&linux.STA_NANO != 0
+	offset := a.slew
+	usec := now % int64(time.Second) / int64(time.Microsecond)
+	if nano {
+		usec = now % int64(time.Second)
+	} else {
+		offset /= int64(time.Microsecond)
+	}
+	*txc = linux.Timex{
+		Offset:    offset,
+		Freq:      a.freq,
+		MaxError:  a.maxError,
+		EstError:  a.estError,
+		Status:    a.status,
+		Constant:  a.constant,
+		Precision: 1,
+		Tolerance: maxFreq,
+		Time:      linux.Timeval{Sec: now / int64(time.Second), Usec: usec},
+		Tick:      defaultTick + a.tickAdjust,
+		TAI:       tai,
+	}
+}
+
+// state returns the clock state returned by adjtimex(2).
+func (a *realtimeAdjust) state() uintptr {
+	if a.status&(linux.STA_UNSYNC|linux.STA_CLOCKERR) != 0 {
+		return linux.TIME_ERROR
+	}
+	return linux.TIME_OK
+}
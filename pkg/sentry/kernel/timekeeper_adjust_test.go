@@ -0,0 +1,224 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"testing"
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/syserror"
+)
+
+const testInterval = time.Second
+
+func TestRealtimeAdjustInitial(t *testing.T) {
+	var a realtimeAdjust
+	a.init()
+
+	const h = int64(1000 * time.Second)
+	var txc linux.Timex
+	var tai int32
+	if _, err := a.adjtime(h, testInterval, &txc, &tai); err != nil {
+		t.Fatalf("adjtime failed: %v", err)
+	}
+	if got := a.apply(h); got != h {
+		t.Errorf("apply got %d want %d", got, h)
+	}
+	if txc.Time.Sec != 1000 || txc.Tick != 10000 || txc.Status != linux.STA_UNSYNC {
+		t.Errorf("adjtime got %+v, want time 1000s, tick 10000 and STA_UNSYNC", txc)
+	}
+	if got := a.state(); got != linux.TIME_ERROR {
+		t.Errorf("state got %d want TIME_ERROR", got)
+	}
+}
+
+func TestRealtimeAdjustSetOffset(t *testing.T) {
+	var a realtimeAdjust
+	a.init()
+
+	const h = int64(1000 * time.Second)
+	txc := linux.Timex{
+		Modes: linux.ADJ_SETOFFSET | linux.ADJ_NANO,
+		Time:  linux.Timeval{Sec: -2, Usec: 500},
+	}
+	var tai int32
+	stepped, err := a.adjtime(h, testInterval, &txc, &tai)
+	if err != nil {
+		t.Fatalf("adjtime failed: %v", err)
+	}
+	if !stepped {
+		t.Errorf("adjtime stepped got false want true")
+	}
+	if got, want := a.apply(h), h-int64(2*time.Second)+500; got != want {
+		t.Errorf("apply got %d want %d", got, want)
+	}
+
+	txc = linux.Timex{
+		Modes: linux.ADJ_SETOFFSET,
+		Time:  linux.Timeval{Sec: 1, Usec: 1000000},
+	}
+	if _, err := a.adjtime(h, testInterval, &txc, &tai); err != syserror.EINVAL {
+		t.Errorf("adjtime with invalid time got %v want EINVAL", err)
+	}
+}
+
+func TestRealtimeAdjustFrequency(t *testing.T) {
+	var a realtimeAdjust
+	a.init()
+
+	const h = int64(1000 * time.Second)
+	// 100ppm, in units of 2^-16 ppm.
+	txc := linux.Timex{
+		Modes: linux.ADJ_FREQUENCY,
+		Freq:  100 << 16,
+	}
+	var tai int32
+	if _, err := a.adjtime(h, testInterval, &txc, &tai); err != nil {
+		t.Fatalf("adjtime failed: %v", err)
+	}
+	if txc.Freq != 100<<16 {
+		t.Errorf("adjtime freq got %d want %d", txc.Freq, 100<<16)
+	}
+
+	// The clock gains 100us per second, across rebases.
+	a.rebase(h+int64(5*time.Second), testInterval)
+	got := a.apply(h + int64(10*time.Second))
+	if want := h + int64(10*time.Second+time.Millisecond); got != want {
+		t.Errorf("apply got %d want %d", got, want)
+	}
+
+	// Frequencies beyond 500ppm are clamped.
+	txc = linux.Timex{
+		Modes: linux.ADJ_FREQUENCY,
+		Freq:  -1000 << 16,
+	}
+	if _, err := a.adjtime(h, testInterval, &txc, &tai); err != nil {
+		t.Fatalf("adjtime failed: %v", err)
+	}
+	if txc.Freq != -maxFreq {
+		t.Errorf("adjtime freq got %d want %d", txc.Freq, -maxFreq)
+	}
+}
+
+func TestRealtimeAdjustSingleshot(t *testing.T) {
+	var a realtimeAdjust
+	a.init()
+
+	h := int64(1000 * time.Second)
+	// Slew 1ms, which takes 2s at 500ppm.
+	txc := linux.Timex{
+		Modes:  linux.ADJ_OFFSET_SINGLESHOT,
+		Offset: 1000,
+	}
+	var tai int32
+	if _, err := a.adjtime(h, testInterval, &txc, &tai); err != nil {
+		t.Fatalf("adjtime failed: %v", err)
+	}
+	if txc.Offset != 0 {
+		t.Errorf("adjtime offset got %d want the previous offset 0", txc.Offset)
+	}
+
+	h += int64(time.Second)
+	if got, want := a.apply(h), h+int64(500*time.Microsecond); got != want {
+		t.Errorf("apply after 1s got %d want %d", got, want)
+	}
+	a.rebase(h, testInterval)
+
+	txc = linux.Timex{Modes: linux.ADJ_OFFSET_SS_READ}
+	if _, err := a.adjtime(h, testInterval, &txc, &tai); err != nil {
+		t.Fatalf("adjtime failed: %v", err)
+	}
+	if txc.Offset != 500 {
+		t.Errorf("adjtime offset got %d want 500", txc.Offset)
+	}
+
+	// The slew ends once the whole offset is applied.
+	for i := 0; i < 3; i++ {
+		h += int64(time.Second)
+		a.rebase(h, testInterval)
+	}
+	if got, want := a.apply(h), h+int64(time.Millisecond); got != want {
+		t.Errorf("apply after 4s got %d want %d", got, want)
+	}
+	if a.slew != 0 {
+		t.Errorf("slew got %d want 0", a.slew)
+	}
+}
+
+func TestRealtimeAdjustPLLOffset(t *testing.T) {
+	var a realtimeAdjust
+	a.init()
+
+	const h = int64(1000 * time.Second)
+	// ADJ_OFFSET is ignored without STA_PLL.
+	txc := linux.Timex{
+		Modes:  linux.ADJ_OFFSET,
+		Offset: 1000,
+	}
+	var tai int32
+	if _, err := a.adjtime(h, testInterval, &txc, &tai); err != nil {
+		t.Fatalf("adjtime failed: %v", err)
+	}
+	if txc.Offset != 0 {
+		t.Errorf("adjtime offset without STA_PLL got %d want 0", txc.Offset)
+	}
+
+	txc = linux.Timex{
+		Modes:  linux.ADJ_OFFSET | linux.ADJ_STATUS | linux.ADJ_NANO,
+		Status: linux.STA_PLL,
+		Offset: int64(time.Second),
+	}
+	if _, err := a.adjtime(h, testInterval, &txc, &tai); err != nil {
+		t.Fatalf("adjtime failed: %v", err)
+	}
+	// The offset is clamped to maxPhase.
+	if txc.Offset != maxPhase {
+		t.Errorf("adjtime offset got %d want %d", txc.Offset, maxPhase)
+	}
+	if txc.Status != linux.STA_PLL|linux.STA_NANO {
+		t.Errorf("adjtime status got %#x want %#x", txc.Status, linux.STA_PLL|linux.STA_NANO)
+	}
+	if got := a.state(); got != linux.TIME_OK {
+		t.Errorf("state got %d want TIME_OK", got)
+	}
+}
+
+func TestRealtimeAdjustTick(t *testing.T) {
+	var a realtimeAdjust
+	a.init()
+
+	const h = int64(1000 * time.Second)
+	txc := linux.Timex{
+		Modes: linux.ADJ_TICK,
+		Tick:  10001,
+	}
+	var tai int32
+	if _, err := a.adjtime(h, testInterval, &txc, &tai); err != nil {
+		t.Fatalf("adjtime failed: %v", err)
+	}
+	// A tick 1us longer makes the clock 100ppm faster.
+	if got, want := a.apply(h+int64(time.Second)), h+int64(time.Second+100*time.Microsecond); got != want {
+		t.Errorf("apply got %d want %d", got, want)
+	}
+
+	txc = linux.Timex{
+		Modes: linux.ADJ_TICK,
+		Tick:  12000,
+	}
+	if _, err := a.adjtime(h, testInterval, &txc, &tai); err != syserror.EINVAL {
+		t.Errorf("adjtime with invalid tick got %v want EINVAL", err)
+	}
+}
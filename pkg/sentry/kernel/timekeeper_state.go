@@ -30,7 +30,9 @@ func (t *Timekeeper) beforeSave() {
 		panic("unable to get current monotonic time: " + err.Error())
 	}
 
-	if t.saveRealtime, err = t.GetTime(time.Realtime); err != nil {
+	// N.B. we want the host realtime, not the adjusted one, as it is compared
+	// against the host realtime after restore.
+	if t.saveRealtime, err = t.clocks.GetTime(time.Realtime); err != nil {
 		panic("unable to get current realtime: " + err.Error())
 	}
 }
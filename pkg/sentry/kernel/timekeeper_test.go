@@ -16,7 +16,9 @@ package kernel
 
 import (
 	"testing"
+	"time"
 
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/context/contexttest"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/platform"
 	sentrytime "gvisor.googlesource.com/gvisor/pkg/sentry/time"
@@ -37,6 +39,11 @@ func (*mockClocks) Update() (monotonicParams sentrytime.Parameters, monotonicOk
 	return
 }
 
+// UpdateInterval implements sentrytime.Clocks.UpdateInterval.
+func (*mockClocks) UpdateInterval() time.Duration {
+	return sentrytime.DefaultUpdateInterval
+}
+
 // Update implements sentrytime.Clocks.GetTime.
 func (c *mockClocks) GetTime(id sentrytime.ClockID) (int64, error) {
 	switch id {
@@ -65,7 +72,7 @@ func stateTestClocklessTimekeeper(tb testing.TB) *Timekeeper {
 
 func stateTestTimekeeper(tb testing.TB) *Timekeeper {
 	t := stateTestClocklessTimekeeper(tb)
-	t.SetClocks(sentrytime.NewCalibratedClocks())
+	t.SetClocks(sentrytime.NewCalibratedClocks(sentrytime.DefaultUpdateInterval))
 	return t
 }
 
@@ -154,3 +161,117 @@ func TestTimekeeperMonotonicJumpBackwards(t *testing.T) {
 		t.Errorf("GetTime got %d want 100000", now)
 	}
 }
+
+// TestTimekeeperTAI tests that TAI time is offset from realtime by the
+// configured TAI offset.
+func TestTimekeeperTAI(t *testing.T) {
+	c := &mockClocks{
+		monotonic: 100000,
+		realtime:  400000,
+	}
+
+	tk := stateTestClocklessTimekeeper(t)
+	tk.SetClocks(c)
+	defer tk.Destroy()
+
+	now, err := tk.GetTime(sentrytime.TAI)
+	if err != nil {
+		t.Errorf("GetTime err got %v want nil", err)
+	}
+	if now != 400000 {
+		t.Errorf("GetTime got %d want 400000", now)
+	}
+
+	tk.SetTAIOffset(37)
+
+	now, err = tk.GetTime(sentrytime.TAI)
+	if err != nil {
+		t.Errorf("GetTime err got %v want nil", err)
+	}
+	if want := int64(400000 + 37*time.Second); now != want {
+		t.Errorf("GetTime got %d want %d", now, want)
+	}
+}
+
+// TestTimekeeperAdjtime tests that adjustments of realtime apply to realtime
+// and TAI, but not to the monotonic clock.
+func TestTimekeeperAdjtime(t *testing.T) {
+	c := &mockClocks{
+		monotonic: 100000,
+		realtime:  400000,
+	}
+
+	tk := stateTestClocklessTimekeeper(t)
+	tk.SetClocks(c)
+	defer tk.Destroy()
+
+	txc := linux.Timex{
+		Modes: linux.ADJ_SETOFFSET | linux.ADJ_NANO,
+		Time:  linux.Timeval{Sec: 1},
+	}
+	if _, stepped, err := tk.Adjtime(&txc); err != nil || !stepped {
+		t.Fatalf("Adjtime got stepped %v, err %v, want true, nil", stepped, err)
+	}
+
+	for _, tc := range []struct {
+		c    sentrytime.ClockID
+		want int64
+	}{
+		{sentrytime.Monotonic, 0},
+		{sentrytime.Realtime, 400000 + int64(time.Second)},
+		{sentrytime.TAI, 400000 + int64(time.Second)},
+	} {
+		now, err := tk.GetTime(tc.c)
+		if err != nil {
+			t.Errorf("GetTime(%v) err got %v want nil", tc.c, err)
+		}
+		if now != tc.want {
+			t.Errorf("GetTime(%v) got %d want %d", tc.c, now, tc.want)
+		}
+	}
+}
+
+// readyClocks is a mockClocks whose parameters are always ready.
+type readyClocks struct {
+	mockClocks
+}
+
+// Update implements sentrytime.Clocks.Update.
+func (*readyClocks) Update() (monotonicParams sentrytime.Parameters, monotonicOk bool, realtimeParam sentrytime.Parameters, realtimeOk bool) {
+	p := sentrytime.Parameters{Frequency: uint64(time.Second.Nanoseconds())}
+	return p, true, p, true
+}
+
+// TestTimekeeperDisableVDSO tests that the VDSO parameters are never ready if
+// the VDSO is disabled.
+func TestTimekeeperDisableVDSO(t *testing.T) {
+	for _, disabled := range []bool{false, true} {
+		tk := stateTestClocklessTimekeeper(t)
+		if disabled {
+			tk.DisableVDSO()
+		}
+		tk.SetClocks(&readyClocks{})
+		// The parameters are updated once as soon as the updater
+		// starts, and Destroy waits for it to stop.
+		tk.Destroy()
+
+		page, err := tk.params.access()
+		if err != nil {
+			t.Fatalf("access got err %v want nil", err)
+		}
+		// The page starts with the sequence counter, followed by
+		// vdsoParams, in which monotonicReady and realtimeReady are
+		// the first and fifth fields.
+		b := page.ToSlice()
+		monotonicReady := usermem.ByteOrder.Uint64(b[8:])
+		realtimeReady := usermem.ByteOrder.Uint64(b[40:])
+
+		want := uint64(1)
+		if disabled {
+			want = 0
+		}
+		if monotonicReady != want || realtimeReady != want {
+			t.Errorf("with VDSO disabled %v, got monotonicReady %d, realtimeReady %d, want %d", disabled, monotonicReady, realtimeReady, want)
+		}
+	}
+}
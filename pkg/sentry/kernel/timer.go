@@ -33,9 +33,11 @@ type timekeeperClock struct {
 	// Implements ktime.Clock.WallTimeUntil.
 	ktime.WallRateClock `state:"nosave"`
 
-	// Implements waiter.Waitable. (We have no ability to detect
-	// discontinuities from external changes to CLOCK_REALTIME).
-	ktime.NoClockEvents `state:"nosave"`
+	// Implements waiter.Waitable. Timers are notified of steps of
+	// CLOCK_REALTIME and CLOCK_TAI made in the sandbox. (We have no ability
+	// to detect discontinuities from external changes to the host
+	// CLOCK_REALTIME).
+	ktime.ClockEventsQueue `state:"nosave"`
 }
 
 // Now implements ktime.Clock.Now.
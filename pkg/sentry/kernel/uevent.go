@@ -0,0 +1,100 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+)
+
+// UEvent is a kobject uevent, which Linux multicasts to NETLINK_KOBJECT_UEVENT
+// sockets to notify udev and other listeners of changes to devices.
+type UEvent struct {
+	// Action is the change, such as "add", "remove", "online" or
+	// "offline".
+	Action string
+
+	// DevPath is the path of the device in /sys, without the /sys prefix.
+	DevPath string
+
+	// Subsystem is the subsystem of the device, such as "memory".
+	Subsystem string
+
+	// Env holds additional KEY=VALUE variables.
+	Env []string
+}
+
+// Message returns the message of the uevent as sent by Linux, with the given
+// sequence number. See lib/kobject_uevent.c:kobject_uevent_env.
+func (e UEvent) Message(seqnum uint64) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s@%s\x00", e.Action, e.DevPath)
+	fmt.Fprintf(&buf, "ACTION=%s\x00", e.Action)
+	fmt.Fprintf(&buf, "DEVPATH=%s\x00", e.DevPath)
+	fmt.Fprintf(&buf, "SUBSYSTEM=%s\x00", e.Subsystem)
+	for _, v := range e.Env {
+		fmt.Fprintf(&buf, "%s\x00", v)
+	}
+	fmt.Fprintf(&buf, "SEQNUM=%d\x00", seqnum)
+	return buf.Bytes()
+}
+
+// UEventListener is notified of the uevents sent by the kernel.
+type UEventListener interface {
+	// NotifyUEvent is called for each uevent, with its sequence number.
+	// It must not block, and must not call the kernel's uevent methods.
+	NotifyUEvent(e UEvent, seqnum uint64)
+}
+
+// uevents multicasts uevents to listeners.
+type uevents struct {
+	// mu protects the fields below.
+	mu sync.Mutex `state:"nosave"`
+
+	// listeners are the registered listeners. They register again after
+	// restore.
+	listeners map[UEventListener]struct{} `state:"nosave"`
+
+	// seqnum is the sequence number of the last uevent.
+	seqnum uint64
+}
+
+// AddUEventListener registers l to be notified of uevents.
+func (k *Kernel) AddUEventListener(l UEventListener) {
+	k.uevents.mu.Lock()
+	defer k.uevents.mu.Unlock()
+	if k.uevents.listeners == nil {
+		k.uevents.listeners = make(map[UEventListener]struct{})
+	}
+	k.uevents.listeners[l] = struct{}{}
+}
+
+// RemoveUEventListener unregisters l.
+func (k *Kernel) RemoveUEventListener(l UEventListener) {
+	k.uevents.mu.Lock()
+	defer k.uevents.mu.Unlock()
+	delete(k.uevents.listeners, l)
+}
+
+// SendUEvent notifies the registered listeners of e.
+func (k *Kernel) SendUEvent(e UEvent) {
+	k.uevents.mu.Lock()
+	defer k.uevents.mu.Unlock()
+	k.uevents.seqnum++
+	for l := range k.uevents.listeners {
+		l.NotifyUEvent(e, k.uevents.seqnum)
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUEventMessage(t *testing.T) {
+	e := UEvent{
+		Action:    "add",
+		DevPath:   "/devices/system/memory/memory16",
+		Subsystem: "memory",
+		Env:       []string{"KEY=value"},
+	}
+	got := strings.Split(string(e.Message(7)), "\x00")
+	want := []string{
+		"add@/devices/system/memory/memory16",
+		"ACTION=add",
+		"DEVPATH=/devices/system/memory/memory16",
+		"SUBSYSTEM=memory",
+		"KEY=value",
+		"SEQNUM=7",
+		"",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got message %q, want %q", got, want)
+	}
+}
+
+// ueventRecorder is a UEventListener that records the uevents it receives.
+type ueventRecorder struct {
+	events []string
+}
+
+// NotifyUEvent implements UEventListener.NotifyUEvent.
+func (r *ueventRecorder) NotifyUEvent(e UEvent, seqnum uint64) {
+	r.events = append(r.events, string(e.Message(seqnum)))
+}
+
+func TestUEventListeners(t *testing.T) {
+	k := &Kernel{}
+	var r1, r2 ueventRecorder
+	k.AddUEventListener(&r1)
+	k.AddUEventListener(&r2)
+	k.SendUEvent(memoryBlockUEvent("add", 1))
+	k.RemoveUEventListener(&r2)
+	k.SendUEvent(memoryBlockUEvent("online", 1))
+
+	add := string(memoryBlockUEvent("add", 1).Message(1))
+	online := string(memoryBlockUEvent("online", 1).Message(2))
+	if want := []string{add, online}; !reflect.DeepEqual(r1.events, want) {
+		t.Errorf("got events %q, want %q", r1.events, want)
+	}
+	if want := []string{add}; !reflect.DeepEqual(r2.events, want) {
+		t.Errorf("got events %q after removing the listener, want %q", r2.events, want)
+	}
+}
@@ -0,0 +1,327 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package userfaultfd provides an implementation of Linux's userfaultfd, which
+// reports application faults on missing pages to userspace.
+package userfaultfd
+
+import (
+	"sync"
+	"syscall"
+
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/binary"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/arch"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/anon"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/fsutil"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/mm"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
+	"gvisor.googlesource.com/gvisor/pkg/syserror"
+	"gvisor.googlesource.com/gvisor/pkg/waiter"
+)
+
+// UserfaultOperations implements fs.FileOperations for a userfaultfd.
+type UserfaultOperations struct {
+	fsutil.PipeSeek      `state:"nosave"`
+	fsutil.NotDirReaddir `state:"nosave"`
+	fsutil.NoFsync       `state:"nosave"`
+	fsutil.NoopFlush     `state:"nosave"`
+	fsutil.NoMMap        `state:"nosave"`
+
+	// uf tracks the registered vmas and the faults reported in them. uf is
+	// immutable.
+	uf *mm.Userfault
+
+	// mu protects ready.
+	mu sync.Mutex `state:"nosave"`
+
+	// ready is set once the API has been negotiated with UFFDIO_API. Until
+	// then, the userfaultfd can't be read and only UFFDIO_API is accepted.
+	ready bool
+}
+
+// New creates a userfaultfd that reports faults in m.
+func New(ctx context.Context, m *mm.MemoryManager) *fs.File {
+	// name matches fs/userfaultfd.c:SYSCALL_DEFINE1(userfaultfd).
+	dirent := fs.NewDirent(anon.NewInode(ctx), "anon_inode:[userfaultfd]")
+	return fs.NewFile(ctx, dirent, fs.FileFlags{Read: true, Write: true}, &UserfaultOperations{
+		uf: m.NewUserfault(),
+	})
+}
+
+// isReady returns true if the API has been negotiated.
+func (u *UserfaultOperations) isReady() bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.ready
+}
+
+// Release implements fs.FileOperations.Release.
+func (u *UserfaultOperations) Release() {
+	u.uf.Release()
+}
+
+// Readiness implements waiter.Waitable.Readiness.
+func (u *UserfaultOperations) Readiness(mask waiter.EventMask) waiter.EventMask {
+	return u.uf.Readiness(mask)
+}
+
+// EventRegister implements waiter.Waitable.EventRegister.
+func (u *UserfaultOperations) EventRegister(e *waiter.Entry, mask waiter.EventMask) {
+	u.uf.EventRegister(e, mask)
+}
+
+// EventUnregister implements waiter.Waitable.EventUnregister.
+func (u *UserfaultOperations) EventUnregister(e *waiter.Entry) {
+	u.uf.EventUnregister(e)
+}
+
+// Read implements fs.FileOperations.Read.
+//
+// Read returns as many fault messages as fit in dst.
+func (u *UserfaultOperations) Read(ctx context.Context, _ *fs.File, dst usermem.IOSequence, _ int64) (int64, error) {
+	if !u.isReady() {
+		return 0, syserror.EINVAL
+	}
+	max := dst.NumBytes() / linux.SizeOfUffdMsg
+	if max == 0 {
+		return 0, syserror.EINVAL
+	}
+	evs := u.uf.Events(int(max))
+	if len(evs) == 0 {
+		return 0, syserror.ErrWouldBlock
+	}
+
+	buf := make([]byte, 0, len(evs)*linux.SizeOfUffdMsg)
+	for _, ev := range evs {
+		msg := linux.UffdMsg{
+			Event:   linux.UFFD_EVENT_PAGEFAULT,
+			Address: uint64(ev.Addr),
+		}
+		if ev.Write {
+			msg.Flags = linux.UFFD_PAGEFAULT_FLAG_WRITE
+		}
+		buf = binary.Marshal(buf, usermem.ByteOrder, &msg)
+	}
+	n, err := dst.CopyOut(ctx, buf)
+	return int64(n), err
+}
+
+// Write implements fs.FileOperations.Write.
+func (*UserfaultOperations) Write(context.Context, *fs.File, usermem.IOSequence, int64) (int64, error) {
+	return 0, syserror.EINVAL
+}
+
+// Ioctl implements fs.FileOperations.Ioctl.
+func (u *UserfaultOperations) Ioctl(ctx context.Context, io usermem.IO, args arch.SyscallArguments) (uintptr, error) {
+	addr := args[2].Pointer()
+	opts := usermem.IOOpts{
+		AddressSpaceActive: true,
+	}
+
+	cmd := args[1].Uint()
+	if cmd == linux.UFFDIO_API {
+		return 0, u.api(ctx, io, addr, opts)
+	}
+	if !u.isReady() {
+		return 0, syserror.EINVAL
+	}
+
+	switch cmd {
+	case linux.UFFDIO_REGISTER:
+		var reg linux.UffdioRegister
+		if _, err := usermem.CopyObjectIn(ctx, io, addr, &reg, opts); err != nil {
+			return 0, err
+		}
+		// Only missing-page tracking is supported.
+		if reg.Mode != linux.UFFDIO_REGISTER_MODE_MISSING {
+			return 0, syserror.EINVAL
+		}
+		ar, err := userfaultRange(reg.Range)
+		if err != nil {
+			return 0, err
+		}
+		if err := u.uf.Register(ar); err != nil {
+			return 0, err
+		}
+		reg.Ioctls = linux.UFFD_API_RANGE_IOCTLS
+		_, err = usermem.CopyObjectOut(ctx, io, addr, &reg, opts)
+		return 0, err
+
+	case linux.UFFDIO_UNREGISTER:
+		var r linux.UffdioRange
+		if _, err := usermem.CopyObjectIn(ctx, io, addr, &r, opts); err != nil {
+			return 0, err
+		}
+		ar, err := userfaultRange(r)
+		if err != nil {
+			return 0, err
+		}
+		return 0, u.uf.Unregister(ar)
+
+	case linux.UFFDIO_WAKE:
+		var r linux.UffdioRange
+		if _, err := usermem.CopyObjectIn(ctx, io, addr, &r, opts); err != nil {
+			return 0, err
+		}
+		ar, err := userfaultRange(r)
+		if err != nil {
+			return 0, err
+		}
+		u.uf.Wake(ar)
+		return 0, nil
+
+	case linux.UFFDIO_COPY:
+		var c linux.UffdioCopy
+		if _, err := usermem.CopyObjectIn(ctx, io, addr, &c, opts); err != nil {
+			return 0, err
+		}
+		if c.Mode&^linux.UFFDIO_COPY_MODE_DONTWAKE != 0 {
+			return 0, syserror.EINVAL
+		}
+		ar, err := userfaultRange(linux.UffdioRange{Start: c.Dst, Len: c.Len})
+		if err != nil {
+			return 0, err
+		}
+		if _, ok := usermem.Addr(c.Src).AddLength(c.Len); !ok {
+			return 0, syserror.EINVAL
+		}
+		n, err := u.fill(ctx, io, ar, usermem.Addr(c.Src), true, c.Mode&linux.UFFDIO_COPY_MODE_DONTWAKE == 0, opts)
+		c.Copy = fillResult(n, err)
+		if _, err := usermem.CopyObjectOut(ctx, io, addr, &c, opts); err != nil {
+			return 0, err
+		}
+		return 0, fillError(ar, n, err)
+
+	case linux.UFFDIO_ZEROPAGE:
+		var z linux.UffdioZeropage
+		if _, err := usermem.CopyObjectIn(ctx, io, addr, &z, opts); err != nil {
+			return 0, err
+		}
+		if z.Mode&^linux.UFFDIO_ZEROPAGE_MODE_DONTWAKE != 0 {
+			return 0, syserror.EINVAL
+		}
+		ar, err := userfaultRange(z.Range)
+		if err != nil {
+			return 0, err
+		}
+		n, err := u.fill(ctx, io, ar, 0, false, z.Mode&linux.UFFDIO_ZEROPAGE_MODE_DONTWAKE == 0, opts)
+		z.Zeropage = fillResult(n, err)
+		if _, err := usermem.CopyObjectOut(ctx, io, addr, &z, opts); err != nil {
+			return 0, err
+		}
+		return 0, fillError(ar, n, err)
+
+	default:
+		return 0, syserror.EINVAL
+	}
+}
+
+// api implements UFFDIO_API.
+func (u *UserfaultOperations) api(ctx context.Context, io usermem.IO, addr usermem.Addr, opts usermem.IOOpts) error {
+	var api linux.UffdioAPI
+	if _, err := usermem.CopyObjectIn(ctx, io, addr, &api, opts); err != nil {
+		return err
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.ready {
+		return syserror.EINVAL
+	}
+	// No optional features are supported.
+	if api.API != linux.UFFD_API || api.Features != 0 {
+		api = linux.UffdioAPI{}
+		if _, err := usermem.CopyObjectOut(ctx, io, addr, &api, opts); err != nil {
+			return err
+		}
+		return syserror.EINVAL
+	}
+	api.Ioctls = linux.UFFD_API_IOCTLS
+	if _, err := usermem.CopyObjectOut(ctx, io, addr, &api, opts); err != nil {
+		return err
+	}
+	u.ready = true
+	return nil
+}
+
+// fill fills the missing pages in ar, with data copied from src in io if copyIn
+// is true or with zeroes otherwise. If wake is true, it then wakes threads
+// waiting for faults on the filled pages. It returns the number of bytes
+// filled.
+func (u *UserfaultOperations) fill(ctx context.Context, io usermem.IO, ar usermem.AddrRange, src usermem.Addr, copyIn, wake bool, opts usermem.IOOpts) (int64, error) {
+	var buf []byte
+	if copyIn {
+		buf = make([]byte, usermem.PageSize)
+	}
+	var n int64
+	var err error
+	for ; n < int64(ar.Length()); n += usermem.PageSize {
+		if copyIn {
+			if _, err = io.CopyIn(ctx, src+usermem.Addr(n), buf, opts); err != nil {
+				break
+			}
+		}
+		if err = u.uf.Fill(ctx, ar.Start+usermem.Addr(n), buf); err != nil {
+			break
+		}
+	}
+	if n != 0 && wake {
+		u.uf.Wake(usermem.AddrRange{ar.Start, ar.Start + usermem.Addr(n)})
+	}
+	return n, err
+}
+
+// userfaultRange returns the address range described by r, which must be
+// page-aligned and non-empty.
+func userfaultRange(r linux.UffdioRange) (usermem.AddrRange, error) {
+	start := usermem.Addr(r.Start)
+	if start.RoundDown() != start || usermem.Addr(r.Len).RoundDown() != usermem.Addr(r.Len) || r.Len == 0 {
+		return usermem.AddrRange{}, syserror.EINVAL
+	}
+	ar, ok := start.ToRange(r.Len)
+	if !ok {
+		return usermem.AddrRange{}, syserror.EINVAL
+	}
+	return ar, nil
+}
+
+// fillResult returns the result reported by UFFDIO_COPY or UFFDIO_ZEROPAGE:
+// the number of bytes filled if any, or a negated errno otherwise.
+func fillResult(n int64, err error) int64 {
+	if n != 0 || err == nil {
+		return n
+	}
+	if errno, ok := err.(syscall.Errno); ok {
+		return -int64(errno)
+	}
+	if errno, ok := syserror.TranslateError(err); ok {
+		return -int64(errno)
+	}
+	return -int64(syscall.EFAULT)
+}
+
+// fillError returns the error returned by UFFDIO_COPY or UFFDIO_ZEROPAGE after
+// filling n bytes of ar. As in Linux, partial success is reported as EAGAIN.
+func fillError(ar usermem.AddrRange, n int64, err error) error {
+	if n == int64(ar.Length()) {
+		return nil
+	}
+	if n != 0 {
+		return syserror.EAGAIN
+	}
+	return err
+}
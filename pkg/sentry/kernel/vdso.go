@@ -37,6 +37,10 @@ type vdsoParams struct {
 	realtimeBaseCycles int64
 	realtimeBaseRef    int64
 	realtimeFrequency  uint64
+
+	// taiOffset is the offset of the TAI clock from the realtime clock, in
+	// nanoseconds.
+	taiOffset int64
 }
 
 // VDSOParamPage manages a VDSO parameter page.
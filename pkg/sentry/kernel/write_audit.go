@@ -0,0 +1,59 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"gvisor.googlesource.com/gvisor/pkg/eventchannel"
+	"gvisor.googlesource.com/gvisor/pkg/log"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
+	pb "gvisor.googlesource.com/gvisor/pkg/sentry/kernel/write_audit_go_proto"
+)
+
+// AuditWrite implements fs.WriteAuditor.AuditWrite.
+func (t *Task) AuditWrite(d *fs.Dirent) {
+	var path string
+	if root := t.FSContext().RootDirectory(); root != nil {
+		path, _ = d.FullName(root)
+		root.DecRef()
+	}
+	path = t.tg.redaction.Path(path)
+	lineage := t.lineage()
+	exe := t.tg.redaction.Path(t.executablePath())
+	uid := t.Credentials().EffectiveKUID
+	log.Warningf("Write to read-only %q denied for %s (tid %d)", path, exe, lineage[0].Tid)
+	eventchannel.Emit(&pb.WriteAudit{
+		Path:       path,
+		Executable: exe,
+		Uid:        uint32(uid),
+		Lineage:    lineage,
+	})
+}
+
+// lineage returns t and its ancestors, as described by
+// pb.WriteAudit.Lineage.
+func (t *Task) lineage() []*pb.WriteAudit_Process {
+	ts := t.k.tasks
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	var lineage []*pb.WriteAudit_Process
+	for p := t; p != nil; p = p.parent {
+		lineage = append(lineage, &pb.WriteAudit_Process{
+			Tid:  int32(ts.Root.tids[p]),
+			Pid:  int32(ts.Root.tids[p.tg.leader]),
+			Comm: p.Name(),
+		})
+	}
+	return lineage
+}
@@ -0,0 +1,73 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mm
+
+import (
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
+)
+
+// CoreMapping describes a mapping in a core dump.
+type CoreMapping struct {
+	// Range is the range of addresses of the mapping.
+	Range usermem.AddrRange
+
+	// Perms are the permissions of the mapping, as defined by the
+	// application.
+	Perms usermem.AccessType
+
+	// Dump is true if the contents of the mapping are included in the core
+	// dump.
+	Dump bool
+
+	// Populated are the subranges of Range that are backed by memory, in
+	// address order. The rest of Range has never been touched, and reads as
+	// zeroes. Populated is empty if Dump is false.
+	Populated []usermem.AddrRange
+}
+
+// CoreMappings returns the mappings of mm for a core dump, in address order.
+//
+// As with Linux's default /proc/[pid]/coredump_filter, the contents of private
+// anonymous mappings and of writable private file mappings are dumped, while
+// the contents of other file mappings are expected to be read from the mapped
+// files by debuggers. Mappings that aren't readable are never dumped.
+func (mm *MemoryManager) CoreMappings() []CoreMapping {
+	mm.mappingMu.RLock()
+	defer mm.mappingMu.RUnlock()
+	mm.activeMu.RLock()
+	defer mm.activeMu.RUnlock()
+
+	var maps []CoreMapping
+	for vseg := mm.vmas.FirstSegment(); vseg.Ok(); vseg = vseg.NextSegment() {
+		vma := vseg.ValuePtr()
+		m := CoreMapping{
+			Range: vseg.Range(),
+			Perms: vma.realPerms,
+			Dump:  vma.realPerms.Read && (vma.mappable == nil || vma.private && vma.realPerms.Write),
+		}
+		if m.Dump {
+			for pseg := mm.pmas.LowerBoundSegment(m.Range.Start); pseg.Ok() && pseg.Start() < m.Range.End; pseg = pseg.NextSegment() {
+				ar := pseg.Range().Intersect(m.Range)
+				if n := len(m.Populated); n > 0 && m.Populated[n-1].End == ar.Start {
+					m.Populated[n-1].End = ar.End
+				} else {
+					m.Populated = append(m.Populated, ar)
+				}
+			}
+		}
+		maps = append(maps, m)
+	}
+	return maps
+}
@@ -38,6 +38,25 @@ func (mm *MemoryManager) String() string {
 	return mm.DebugString(context.Background())
 }
 
+// HeapObjects calls fn with a value of each type of sentry object that mm
+// allocates per mapping, and the number of such objects in mm.
+func (mm *MemoryManager) HeapObjects(fn func(v interface{}, count uint64)) {
+	mm.mappingMu.RLock()
+	defer mm.mappingMu.RUnlock()
+	mm.activeMu.RLock()
+	defer mm.activeMu.RUnlock()
+
+	var vmas, pmas uint64
+	for vseg := mm.vmas.FirstSegment(); vseg.Ok(); vseg = vseg.NextSegment() {
+		vmas++
+	}
+	for pseg := mm.pmas.FirstSegment(); pseg.Ok(); pseg = pseg.NextSegment() {
+		pmas++
+	}
+	fn(vma{}, vmas)
+	fn(pma{}, pmas)
+}
+
 // DebugString returns a string containing information about mm for debugging.
 func (mm *MemoryManager) DebugString(ctx context.Context) string {
 	mm.mappingMu.RLock()
@@ -0,0 +1,184 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mm
+
+import (
+	"path/filepath"
+
+	"gvisor.googlesource.com/gvisor/pkg/eventchannel"
+	"gvisor.googlesource.com/gvisor/pkg/log"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/memmap"
+	pb "gvisor.googlesource.com/gvisor/pkg/sentry/mm/exec_policy_go_proto"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
+	"gvisor.googlesource.com/gvisor/pkg/syserror"
+)
+
+// ExecPolicy restricts the executable mappings that an application may
+// create, so that an exploited application cannot easily stage and run
+// injected code. Violations are logged and emitted on the eventchannel as
+// ExecPolicyViolation events.
+//
+// Mappings created while an executable is loaded, before the policy is
+// applied to the MemoryManager by SetExecPolicy, are not checked.
+//
+// ExecPolicy is immutable.
+type ExecPolicy struct {
+	// If DenyWriteExec is true, mappings may not be both writable and
+	// executable, and private file mappings whose pages have been written
+	// may not be made executable.
+	DenyWriteExec bool
+
+	// If DenyAnonymousExec is true, anonymous mappings, private or shared,
+	// may not be executable.
+	DenyAnonymousExec bool
+
+	// If AuditOnly is true, violations are reported but not denied.
+	AuditOnly bool
+
+	// Exceptions are patterns, in filepath.Match syntax, that match the
+	// paths of executables to which the policy does not apply, such as
+	// language runtimes with JIT compilers.
+	Exceptions []string
+}
+
+// Exempt returns true if p does not apply to the executable at path binary.
+func (p *ExecPolicy) Exempt(binary string) bool {
+	for _, pattern := range p.Exceptions {
+		if ok, _ := filepath.Match(pattern, binary); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// SetExecPolicy applies p to mm, which contains an image of the executable at
+// path binary, unless p exempts binary. A nil p leaves executable mappings in
+// mm unrestricted.
+//
+// Preconditions: mm must not yet be in use by any task.
+func (mm *MemoryManager) SetExecPolicy(p *ExecPolicy, binary string) {
+	if p != nil && p.Exempt(binary) {
+		p = nil
+	}
+	mm.execPolicy = p
+	mm.execBinary = binary
+}
+
+// isAnonymousMappable returns true if a mapping of m maps anonymous memory.
+// This includes shared anonymous memory, e.g. from mmap(MAP_SHARED |
+// MAP_ANONYMOUS) or mappings of /dev/zero, which is implemented by a
+// SpecialMappable.
+func isAnonymousMappable(m memmap.Mappable) bool {
+	if m == nil {
+		return true
+	}
+	sm, ok := m.(*SpecialMappable)
+	return ok && sm.anonymous
+}
+
+// isAnonymous returns true if vma maps anonymous memory.
+func (vma *vma) isAnonymous() bool {
+	return isAnonymousMappable(vma.mappable)
+}
+
+// hasPrivateCopiesLocked returns true if any page in ar, which must be within
+// a file-backed vma, has been replaced by a private copy, i.e. has been
+// written through a private mapping.
+//
+// Preconditions: mm.activeMu must be locked.
+func (mm *MemoryManager) hasPrivateCopiesLocked(ar usermem.AddrRange) bool {
+	for pseg := mm.pmas.LowerBoundSegment(ar.Start); pseg.Ok() && pseg.Start() < ar.End; pseg = pseg.NextSegment() {
+		if pseg.ValuePtr().private {
+			return true
+		}
+	}
+	return false
+}
+
+// checkExecPolicyMMap returns an error if mm's ExecPolicy denies the mapping
+// described by opts.
+//
+// Preconditions: opts.Length must be page-aligned.
+func (mm *MemoryManager) checkExecPolicyMMap(ctx context.Context, opts *memmap.MMapOpts) error {
+	// New mappings contain no modified pages.
+	rule := mm.execPolicyViolation(opts.Perms, isAnonymousMappable(opts.Mappable), func() bool { return false })
+	if rule == pb.ExecPolicyViolation_UNKNOWN {
+		return nil
+	}
+	ar, _ := opts.Addr.ToRange(opts.Length)
+	name := opts.Hint
+	if name == "" && opts.MappingIdentity != nil {
+		name = opts.MappingIdentity.MappedName(ctx)
+	}
+	return mm.reportExecPolicyViolation(rule, ar, name)
+}
+
+// checkExecPolicyMProtectLocked returns an error if mm's ExecPolicy denies
+// changing the effective permissions of the part of vseg in ar to perms.
+//
+// Preconditions: mm.mappingMu and mm.activeMu must be locked.
+func (mm *MemoryManager) checkExecPolicyMProtectLocked(vseg vmaIterator, ar usermem.AddrRange, perms usermem.AccessType) error {
+	vma := vseg.ValuePtr()
+	ar = vseg.Range().Intersect(ar)
+	rule := mm.execPolicyViolation(perms, vma.isAnonymous(), func() bool { return mm.hasPrivateCopiesLocked(ar) })
+	if rule == pb.ExecPolicyViolation_UNKNOWN {
+		return nil
+	}
+	// MProtect has no context with which to resolve names relative to the
+	// caller's root, so paths are reported relative to the global root.
+	return mm.reportExecPolicyViolation(rule, ar, vmaNameLocked(context.Background(), vma))
+}
+
+// execPolicyViolation returns the rule of mm's ExecPolicy that is violated
+// by mapping memory with effective permissions perms, or
+// ExecPolicyViolation_UNKNOWN if there is none. anonymous is true if the
+// mapping is anonymous. modified is called if necessary to determine whether
+// the mapping contains private copies of file pages.
+func (mm *MemoryManager) execPolicyViolation(perms usermem.AccessType, anonymous bool, modified func() bool) pb.ExecPolicyViolation_Rule {
+	p := mm.execPolicy
+	switch {
+	case p == nil || !perms.Execute:
+		return pb.ExecPolicyViolation_UNKNOWN
+	case p.DenyWriteExec && perms.Write:
+		return pb.ExecPolicyViolation_WRITE_EXEC
+	case p.DenyAnonymousExec && anonymous:
+		return pb.ExecPolicyViolation_ANONYMOUS_EXEC
+	case p.DenyWriteExec && !anonymous && modified():
+		return pb.ExecPolicyViolation_MODIFIED_EXEC
+	default:
+		return pb.ExecPolicyViolation_UNKNOWN
+	}
+}
+
+// reportExecPolicyViolation logs and emits a violation of rule by the
+// mapping named name at ar. It returns the error that the operation should
+// fail with, or nil if mm's ExecPolicy only audits violations.
+func (mm *MemoryManager) reportExecPolicyViolation(rule pb.ExecPolicyViolation_Rule, ar usermem.AddrRange, name string) error {
+	denied := !mm.execPolicy.AuditOnly
+	log.Warningf("Executable mapping policy violation by %s: %v at %v (%q), denied: %t", mm.execBinary, rule, ar, name, denied)
+	eventchannel.Emit(&pb.ExecPolicyViolation{
+		Rule:       rule,
+		Executable: mm.execBinary,
+		Addr:       uint64(ar.Start),
+		Length:     uint64(ar.Length()),
+		Mapping:    name,
+		Denied:     denied,
+	})
+	if !denied {
+		return nil
+	}
+	return syserror.EACCES
+}
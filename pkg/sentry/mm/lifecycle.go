@@ -34,6 +34,7 @@ func NewMemoryManager(p platform.Platform) *MemoryManager {
 		privateRefs: &privateRefs{},
 		users:       1,
 		auxv:        arch.Auxv{},
+		dumpability: UserDumpable,
 		aioManager:  aioManager{contexts: make(map[uint64]*AIOContext)},
 	}
 }
@@ -70,8 +71,14 @@ func (mm *MemoryManager) Fork(ctx context.Context) (*MemoryManager, error) {
 		envv:                 mm.envv,
 		auxv:                 append(arch.Auxv(nil), mm.auxv...),
 		// IncRef'd below, once we know that there isn't an error.
-		executable: mm.executable,
-		aioManager: aioManager{contexts: make(map[uint64]*AIOContext)},
+		executable:  mm.executable,
+		execPolicy:  mm.execPolicy,
+		execBinary:  mm.execBinary,
+		dumpability: mm.dumpability,
+		aioManager:  aioManager{contexts: make(map[uint64]*AIOContext)},
+		// Registrations for membarrier(2) are inherited by fork.
+		membarrierPrivateEnabled:  atomic.LoadUint32(&mm.membarrierPrivateEnabled),
+		membarrierSyncCoreEnabled: atomic.LoadUint32(&mm.membarrierSyncCoreEnabled),
 	}
 
 	// Copy vmas.
@@ -89,7 +96,11 @@ func (mm *MemoryManager) Fork(ctx context.Context) (*MemoryManager, error) {
 		if vma.id != nil {
 			vma.id.IncRef()
 		}
-		dstvgap = mm2.vmas.Insert(dstvgap, vmaAR, *vma).NextGap()
+		// Userfaultfd registrations are not inherited, as in Linux without
+		// UFFD_FEATURE_EVENT_FORK.
+		vma2 := *vma
+		vma2.uffd = nil
+		dstvgap = mm2.vmas.Insert(dstvgap, vmaAR, vma2).NextGap()
 		// We don't need to update mm2.usageAS since we copied it from mm
 		// above.
 	}
@@ -201,9 +201,34 @@ type MemoryManager struct {
 	// executable is protected by metadataMu.
 	executable *fs.Dirent
 
+	// execPolicy restricts the executable mappings that may be created in
+	// this MemoryManager. If execPolicy is nil, executable mappings are
+	// unrestricted. execBinary is the path of the executable for which
+	// execPolicy was applied, used to report violations.
+	//
+	// execPolicy and execBinary are immutable after the MemoryManager is
+	// first used by a task.
+	execPolicy *ExecPolicy
+	execBinary string
+
+	// dumpability describes if and how this MemoryManager may be dumped to
+	// userspace.
+	//
+	// dumpability is protected by metadataMu.
+	dumpability Dumpability
+
 	// aioManager keeps track of AIOContexts used for async IOs. AIOManager
 	// must be cloned when CLONE_VM is used.
 	aioManager aioManager
+
+	// membarrierPrivateEnabled is non-zero if EnableMembarrierPrivate has
+	// been called, permitting MEMBARRIER_CMD_PRIVATE_EXPEDITED.
+	// membarrierSyncCoreEnabled is non-zero if EnableMembarrierSyncCore has
+	// been called, permitting MEMBARRIER_CMD_PRIVATE_EXPEDITED_SYNC_CORE.
+	//
+	// These fields are accessed using atomic memory operations.
+	membarrierPrivateEnabled  uint32
+	membarrierSyncCoreEnabled uint32
 }
 
 // vma represents a virtual memory area.
@@ -255,6 +280,10 @@ type vma struct {
 	// If hint is non-empty, it is a description of the vma printed in
 	// /proc/[pid]/maps. hint takes priority over id.MappedName().
 	hint string
+
+	// If uffd is not nil, application faults on missing pages in this vma
+	// are reported by uffd. If uffd is not nil, mappable must be nil.
+	uffd *Userfault
 }
 
 const (
@@ -15,6 +15,7 @@
 package mm
 
 import (
+	"reflect"
 	"testing"
 
 	"gvisor.googlesource.com/gvisor/pkg/sentry/arch"
@@ -25,6 +26,7 @@ import (
 	"gvisor.googlesource.com/gvisor/pkg/sentry/platform"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
 	"gvisor.googlesource.com/gvisor/pkg/syserror"
+	"gvisor.googlesource.com/gvisor/pkg/waiter"
 )
 
 func testMemoryManager(ctx context.Context) *MemoryManager {
@@ -172,3 +174,279 @@ func TestIOAfterMProtect(t *testing.T) {
 		t.Errorf("CopyOut got %d want 1", n)
 	}
 }
+
+// TestCoreMappings tests the mappings and populated ranges reported for core
+// dumps.
+func TestCoreMappings(t *testing.T) {
+	ctx := contexttest.Context(t)
+	mm := testMemoryManager(ctx)
+	defer mm.DecUsers(ctx)
+
+	addr, err := mm.MMap(ctx, memmap.MMapOpts{
+		Length:   4 * usermem.PageSize,
+		Private:  true,
+		Perms:    usermem.ReadWrite,
+		MaxPerms: usermem.AnyAccess,
+	})
+	if err != nil {
+		t.Fatalf("MMap got err %v want nil", err)
+	}
+	guard, err := mm.MMap(ctx, memmap.MMapOpts{
+		Length:   usermem.PageSize,
+		Private:  true,
+		MaxPerms: usermem.AnyAccess,
+	})
+	if err != nil {
+		t.Fatalf("MMap got err %v want nil", err)
+	}
+
+	// Nothing is populated before the mapping is touched.
+	touched := addr + 2*usermem.PageSize
+	for _, m := range mm.CoreMappings() {
+		if m.Range.Contains(addr) && len(m.Populated) != 0 {
+			t.Errorf("Untouched mapping %v has populated ranges %v", m.Range, m.Populated)
+		}
+	}
+	if _, err := mm.CopyOut(ctx, touched, []byte{1}, usermem.IOOpts{}); err != nil {
+		t.Fatalf("CopyOut got err %v want nil", err)
+	}
+
+	var found, foundGuard bool
+	for _, m := range mm.CoreMappings() {
+		switch {
+		case m.Range.Contains(touched):
+			found = true
+			if !m.Dump {
+				t.Errorf("Anonymous mapping %v isn't dumped", m.Range)
+			}
+			var populated bool
+			for _, ar := range m.Populated {
+				if !m.Range.IsSupersetOf(ar) {
+					t.Errorf("Populated range %v isn't in mapping %v", ar, m.Range)
+				}
+				populated = populated || ar.Contains(touched)
+			}
+			if !populated {
+				t.Errorf("Touched address %#x isn't in populated ranges %v", touched, m.Populated)
+			}
+		case m.Range.Contains(guard):
+			foundGuard = true
+			if m.Dump {
+				t.Errorf("Inaccessible mapping %v is dumped", m.Range)
+			}
+		}
+	}
+	if !found || !foundGuard {
+		t.Errorf("CoreMappings didn't report all mappings: got %+v", mm.CoreMappings())
+	}
+}
+
+// TestUserfault tests that faults on missing pages in a registered range are
+// reported, and resolved by filling the page.
+func TestUserfault(t *testing.T) {
+	ctx := contexttest.Context(t)
+	mm := testMemoryManager(ctx)
+	defer mm.DecUsers(ctx)
+
+	addr, err := mm.MMap(ctx, memmap.MMapOpts{
+		Length:   2 * usermem.PageSize,
+		Private:  true,
+		Perms:    usermem.ReadWrite,
+		MaxPerms: usermem.AnyAccess,
+	})
+	if err != nil {
+		t.Fatalf("MMap got err %v want nil", err)
+	}
+	ar, _ := addr.ToRange(2 * usermem.PageSize)
+
+	uf := mm.NewUserfault()
+	if err := uf.Register(ar); err != nil {
+		t.Fatalf("Register got err %v want nil", err)
+	}
+	if err := mm.NewUserfault().Register(ar); err != syserror.EBUSY {
+		t.Errorf("Register of registered range got err %v want EBUSY", err)
+	}
+
+	// Sentry accesses to missing pages fail.
+	b := make([]byte, 1)
+	if _, err := mm.CopyIn(ctx, addr, b, usermem.IOOpts{}); err != syserror.EFAULT {
+		t.Errorf("CopyIn got err %v want EFAULT", err)
+	}
+
+	// Application faults are reported once per page.
+	err = mm.HandleUserFault(ctx, addr+1, usermem.Write, 0)
+	uerr, ok := err.(*UserfaultError)
+	if !ok {
+		t.Fatalf("HandleUserFault got err %v want *UserfaultError", err)
+	}
+	err = mm.HandleUserFault(ctx, addr, usermem.Read, 0)
+	if uerr2, ok := err.(*UserfaultError); !ok || uerr2.C != uerr.C {
+		t.Errorf("HandleUserFault of faulting page got err %v want %v", err, uerr)
+	}
+	if got := uf.Readiness(waiter.EventIn); got != waiter.EventIn {
+		t.Errorf("Readiness got %v want %v", got, waiter.EventIn)
+	}
+	want := []UserfaultEvent{{Addr: addr, Write: true}}
+	if got := uf.Events(2); !reflect.DeepEqual(got, want) {
+		t.Errorf("Events got %+v want %+v", got, want)
+	}
+
+	// Filling the page makes it present, and waking wakes the faulting
+	// thread.
+	src := make([]byte, usermem.PageSize)
+	src[0] = 1
+	if err := uf.Fill(ctx, addr, src); err != nil {
+		t.Fatalf("Fill got err %v want nil", err)
+	}
+	if err := uf.Fill(ctx, addr, nil); err != syserror.EEXIST {
+		t.Errorf("Fill of present page got err %v want EEXIST", err)
+	}
+	uf.Wake(ar)
+	select {
+	case <-uerr.C:
+	default:
+		t.Errorf("Wake didn't wake faulting thread")
+	}
+	if _, err := mm.CopyIn(ctx, addr, b, usermem.IOOpts{}); err != nil || b[0] != 1 {
+		t.Errorf("CopyIn got (%v, %v) want (%v, nil)", b[0], err, 1)
+	}
+
+	// After release, missing pages are faulted in normally.
+	uf.Release()
+	if _, err := mm.CopyIn(ctx, addr+usermem.PageSize, b, usermem.IOOpts{}); err != nil {
+		t.Errorf("CopyIn after Release got err %v want nil", err)
+	}
+}
+
+// TestExecPolicy tests enforcement of ExecPolicy on anonymous mappings.
+func TestExecPolicy(t *testing.T) {
+	ctx := contexttest.Context(t)
+	rx := usermem.AccessType{Read: true, Execute: true}
+	for _, test := range []struct {
+		name   string
+		policy *ExecPolicy
+		perms  usermem.AccessType
+		want   error
+	}{
+		{
+			name:   "write exec denied",
+			policy: &ExecPolicy{DenyWriteExec: true},
+			perms:  usermem.AnyAccess,
+			want:   syserror.EACCES,
+		},
+		{
+			name:   "anonymous exec permitted without DenyAnonymousExec",
+			policy: &ExecPolicy{DenyWriteExec: true},
+			perms:  rx,
+		},
+		{
+			name:   "anonymous exec denied",
+			policy: &ExecPolicy{DenyAnonymousExec: true},
+			perms:  rx,
+			want:   syserror.EACCES,
+		},
+		{
+			name:   "anonymous non-exec permitted",
+			policy: &ExecPolicy{DenyWriteExec: true, DenyAnonymousExec: true},
+			perms:  usermem.ReadWrite,
+		},
+		{
+			name:   "audit only",
+			policy: &ExecPolicy{DenyWriteExec: true, DenyAnonymousExec: true, AuditOnly: true},
+			perms:  usermem.AnyAccess,
+		},
+		{
+			name:   "exempt binary",
+			policy: &ExecPolicy{DenyWriteExec: true, DenyAnonymousExec: true, Exceptions: []string{"/usr/bin/*"}},
+			perms:  usermem.AnyAccess,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			mm := testMemoryManager(ctx)
+			defer mm.DecUsers(ctx)
+			mm.SetExecPolicy(test.policy, "/usr/bin/test")
+
+			// Check mmap.
+			_, err := mm.MMap(ctx, memmap.MMapOpts{
+				Length:   usermem.PageSize,
+				Private:  true,
+				Perms:    test.perms,
+				MaxPerms: usermem.AnyAccess,
+			})
+			if err != test.want {
+				t.Errorf("MMap got err %v want %v", err, test.want)
+			}
+
+			// Check mprotect of an existing mapping.
+			addr, err := mm.MMap(ctx, memmap.MMapOpts{
+				Length:   usermem.PageSize,
+				Private:  true,
+				Perms:    usermem.Read,
+				MaxPerms: usermem.AnyAccess,
+			})
+			if err != nil {
+				t.Fatalf("MMap got err %v want nil", err)
+			}
+			if err := mm.MProtect(addr, usermem.PageSize, test.perms, false); err != test.want {
+				t.Errorf("MProtect got err %v want %v", err, test.want)
+			}
+		})
+	}
+}
+
+func TestExecPolicySharedAnonymous(t *testing.T) {
+	ctx := contexttest.Context(t)
+	rx := usermem.AccessType{Read: true, Execute: true}
+
+	// mmap(MAP_SHARED | MAP_ANONYMOUS).
+	mm := testMemoryManager(ctx)
+	defer mm.DecUsers(ctx)
+	mm.SetExecPolicy(&ExecPolicy{DenyAnonymousExec: true}, "/usr/bin/test")
+	if _, err := mm.MMap(ctx, memmap.MMapOpts{
+		Length:   usermem.PageSize,
+		Perms:    rx,
+		MaxPerms: usermem.AnyAccess,
+	}); err != syserror.EACCES {
+		t.Errorf("MMap of shared anonymous memory got err %v want %v", err, syserror.EACCES)
+	}
+
+	// mmap of /dev/zero, whose ConfigureMMap installs a SpecialMappable.
+	for _, private := range []bool{false, true} {
+		m, err := NewSharedAnonMappable(usermem.PageSize, platform.FromContext(ctx))
+		if err != nil {
+			t.Fatalf("NewSharedAnonMappable failed: %v", err)
+		}
+		_, err = mm.MMap(ctx, memmap.MMapOpts{
+			Length:          usermem.PageSize,
+			MappingIdentity: m,
+			Mappable:        m,
+			Private:         private,
+			Perms:           rx,
+			MaxPerms:        usermem.AnyAccess,
+		})
+		m.DecRef()
+		if err != syserror.EACCES {
+			t.Errorf("MMap of /dev/zero (private %t) got err %v want %v", private, err, syserror.EACCES)
+		}
+	}
+}
+
+func TestDumpability(t *testing.T) {
+	ctx := contexttest.Context(t)
+	mm := testMemoryManager(ctx)
+	defer mm.DecUsers(ctx)
+	if got := mm.Dumpability(); got != UserDumpable {
+		t.Errorf("Dumpability() = %v, want %v", got, UserDumpable)
+	}
+
+	// Dumpability is inherited by fork.
+	mm.SetDumpability(NotDumpable)
+	mm2, err := mm.Fork(ctx)
+	if err != nil {
+		t.Fatalf("Fork failed: %v", err)
+	}
+	defer mm2.DecUsers(ctx)
+	if got := mm2.Dumpability(); got != NotDumpable {
+		t.Errorf("forked Dumpability() = %v, want %v", got, NotDumpable)
+	}
+}
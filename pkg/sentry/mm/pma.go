@@ -317,6 +317,12 @@ func (mm *MemoryManager) insertPMAsLocked(ctx context.Context, vseg vmaIterator,
 
 	// Private anonymous mappings get pmas by allocating.
 	if vma.mappable == nil {
+		// Missing pages in vmas registered with a userfaultfd are only filled
+		// by the userfaultfd; see Userfault.
+		if vma.uffd != nil {
+			return pgap, syserror.EFAULT
+		}
+
 		// Limit the range we allocate to ar, aligned to privateAllocUnit.
 		maskAR := privateAligned(ar)
 		allocAR := optAR.Intersect(maskAR)
@@ -82,24 +82,60 @@ func (mm *MemoryManager) vmaMapsEntryLocked(ctx context.Context, vseg vmaIterato
 		vseg.Start(), vseg.End(), vma.realPerms, private, vma.off, devMajor, devMinor, ino)
 
 	// Figure out our filename or hint.
-	var s string
+	if s := vmaNameLocked(ctx, vma); s != "" {
+		// Per linux, we pad until the 74th character.
+		if pad := 73 - b.Len(); pad > 0 {
+			b.WriteString(strings.Repeat(" ", pad))
+		}
+		b.WriteString(s)
+	}
+	b.WriteString("\n")
+	return b.Bytes()
+}
+
+// vmaNameLocked returns the filename or hint shown for vma in
+// /proc/[pid]/maps, which is empty for anonymous memory.
+//
+// Preconditions: mm.mappingMu must be locked.
+func vmaNameLocked(ctx context.Context, vma *vma) string {
 	if vma.hint != "" {
-		s = vma.hint
-	} else if vma.id != nil {
+		return vma.hint
+	}
+	if vma.id != nil {
 		// FIXME: We are holding mm.mappingMu here, which is
 		// consistent with Linux's holding mmap_sem in
 		// fs/proc/task_mmu.c:show_map_vma() => fs/seq_file.c:seq_file_path().
 		// However, it's not clear that fs.File.MappedName() is actually
 		// consistent with this lock order.
-		s = vma.id.MappedName(ctx)
+		return vma.id.MappedName(ctx)
 	}
-	if s != "" {
-		// Per linux, we pad until the 74th character.
-		if pad := 73 - b.Len(); pad > 0 {
-			b.WriteString(strings.Repeat(" ", pad))
+	return ""
+}
+
+// CodeOrigin returns the name shown in /proc/[pid]/maps for the mapping that
+// contains the instruction at addr, which is empty for anonymous memory. ok is
+// false if addr is not in an executable mapping, or if the page containing
+// addr is a private copy of a mapped file page, i.e. the code it contains may
+// have been modified since it was mapped.
+func (mm *MemoryManager) CodeOrigin(ctx context.Context, addr usermem.Addr) (name string, ok bool) {
+	mm.mappingMu.RLock()
+	defer mm.mappingMu.RUnlock()
+	vseg := mm.vmas.FindSegment(addr)
+	if !vseg.Ok() {
+		return "", false
+	}
+	vma := vseg.ValuePtr()
+	if !vma.effectivePerms.Execute {
+		return "", false
+	}
+	if vma.mappable != nil {
+		mm.activeMu.RLock()
+		pseg := mm.pmas.FindSegment(addr)
+		modified := pseg.Ok() && pseg.ValuePtr().private
+		mm.activeMu.RUnlock()
+		if modified {
+			return "", false
 		}
-		b.WriteString(s)
 	}
-	b.WriteString("\n")
-	return b.Bytes()
+	return vmaNameLocked(ctx, vma), true
 }
@@ -34,6 +34,10 @@ type SpecialMappable struct {
 	p    platform.Platform
 	fr   platform.FileRange
 	name string
+
+	// anonymous is true if the SpecialMappable represents shared anonymous
+	// memory. anonymous is immutable.
+	anonymous bool
 }
 
 // NewSpecialMappable returns a SpecialMappable that owns fr, which represents
@@ -143,5 +147,7 @@ func NewSharedAnonMappable(length uint64, p platform.Platform) (*SpecialMappable
 	if err != nil {
 		return nil, err
 	}
-	return NewSpecialMappable("/dev/zero (deleted)", p, fr), nil
+	m := NewSpecialMappable("/dev/zero (deleted)", p, fr)
+	m.anonymous = true
+	return m, nil
 }
@@ -17,6 +17,7 @@ package mm
 import (
 	"fmt"
 	mrand "math/rand"
+	"sync/atomic"
 
 	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
@@ -28,7 +29,8 @@ import (
 )
 
 // HandleUserFault handles an application page fault. sp is the faulting
-// application thread's stack pointer.
+// application thread's stack pointer. If the fault is reported to a
+// userfaultfd, HandleUserFault returns a *UserfaultError.
 //
 // Preconditions: mm.as != nil.
 func (mm *MemoryManager) HandleUserFault(ctx context.Context, addr usermem.Addr, at usermem.AccessType, sp usermem.Addr) error {
@@ -52,6 +54,15 @@ func (mm *MemoryManager) HandleUserFault(ctx context.Context, addr usermem.Addr,
 
 	// Ensure that we have a usable pma.
 	mm.activeMu.Lock()
+	if uffd := vseg.ValuePtr().uffd; uffd != nil && !mm.pmas.FindSegment(ar.Start).Ok() {
+		// The page is missing from a vma registered with a userfaultfd, so
+		// the fault must be resolved by the userfaultfd's reader. Report it
+		// before unlocking so that it can't race with the page being filled.
+		err := uffd.report(ar.Start, at.Write)
+		mm.activeMu.Unlock()
+		mm.mappingMu.RUnlock()
+		return err
+	}
 	pseg, _, err := mm.getPMAsLocked(ctx, vseg, ar, pmaOpts{
 		breakCOW: at.Write,
 	})
@@ -82,6 +93,10 @@ func (mm *MemoryManager) MMap(ctx context.Context, opts memmap.MMapOpts) (userme
 	}
 	opts.Length = uint64(length)
 
+	if err := mm.checkExecPolicyMMap(ctx, &opts); err != nil {
+		return 0, err
+	}
+
 	if opts.Mappable != nil {
 		// Offset must be aligned.
 		if usermem.Addr(opts.Offset).RoundDown() != usermem.Addr(opts.Offset) {
@@ -532,6 +547,9 @@ func (mm *MemoryManager) MProtect(addr usermem.Addr, length uint64, realPerms us
 		if !vseg.ValuePtr().maxPerms.SupersetOf(effectivePerms) {
 			return syserror.EACCES
 		}
+		if err := mm.checkExecPolicyMProtectLocked(vseg, ar, effectivePerms); err != nil {
+			return err
+		}
 		vseg = mm.vmas.Isolate(vseg, ar)
 
 		// Update vma permissions.
@@ -792,3 +810,27 @@ func (mm *MemoryManager) MaxResidentSetSize() uint64 {
 	defer mm.activeMu.RUnlock()
 	return uint64(mm.maxRSS)
 }
+
+// EnableMembarrierPrivate causes future calls to IsMembarrierPrivateEnabled to
+// return true.
+func (mm *MemoryManager) EnableMembarrierPrivate() {
+	atomic.StoreUint32(&mm.membarrierPrivateEnabled, 1)
+}
+
+// IsMembarrierPrivateEnabled returns true if mm.EnableMembarrierPrivate() has
+// previously been called.
+func (mm *MemoryManager) IsMembarrierPrivateEnabled() bool {
+	return atomic.LoadUint32(&mm.membarrierPrivateEnabled) != 0
+}
+
+// EnableMembarrierSyncCore causes future calls to IsMembarrierSyncCoreEnabled
+// to return true.
+func (mm *MemoryManager) EnableMembarrierSyncCore() {
+	atomic.StoreUint32(&mm.membarrierSyncCoreEnabled, 1)
+}
+
+// IsMembarrierSyncCoreEnabled returns true if mm.EnableMembarrierSyncCore() has
+// previously been called.
+func (mm *MemoryManager) IsMembarrierSyncCoreEnabled() bool {
+	return atomic.LoadUint32(&mm.membarrierSyncCoreEnabled) != 0
+}
@@ -0,0 +1,341 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mm
+
+import (
+	"sync"
+
+	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/safemem"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usage"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
+	"gvisor.googlesource.com/gvisor/pkg/syserror"
+	"gvisor.googlesource.com/gvisor/pkg/waiter"
+)
+
+// Userfault is the MemoryManager side of a userfaultfd. It reports faults
+// taken by application threads on missing pages in the private anonymous vmas
+// registered with it, and fills those pages on request.
+//
+// Only faults taken by application code are reported. Sentry accesses to
+// missing pages in registered vmas (e.g. the buffer passed to read(2)) fail
+// with EFAULT, as for Linux's UFFD_USER_MODE_ONLY.
+type Userfault struct {
+	// Queue is notified with EventIn when a fault is reported.
+	waiter.Queue `state:"nosave"`
+
+	// mm is the MemoryManager whose faults are reported. mm is immutable.
+	mm *MemoryManager
+
+	// mu protects the fields below.
+	mu sync.Mutex `state:"nosave"`
+
+	// faults maps the address of each page with an outstanding fault to the
+	// fault. Threads waiting for a fault are interrupted by save and take the
+	// fault again after restore, so faults and pending are not saved.
+	faults map[usermem.Addr]*userfault `state:"nosave"`
+
+	// pending is the subset of faults that have not yet been read, in the
+	// order in which they were taken.
+	pending []*userfault `state:"nosave"`
+}
+
+// userfault is an outstanding fault on a single page.
+type userfault struct {
+	event UserfaultEvent
+
+	// done is closed when the fault is resolved.
+	done chan struct{} `state:"nosave"`
+
+	// woken is set when done is closed.
+	woken bool
+}
+
+// UserfaultEvent describes a fault reported by a Userfault.
+type UserfaultEvent struct {
+	// Addr is the address of the faulting page.
+	Addr usermem.Addr
+
+	// Write is true if the fault was caused by a write.
+	Write bool
+}
+
+// UserfaultError is returned by MemoryManager.HandleUserFault when a fault has
+// been reported to a Userfault. The faulting thread should wait for C to be
+// closed and then retry the access.
+type UserfaultError struct {
+	C chan struct{} `state:"nosave"`
+}
+
+// Error implements error.Error.
+func (*UserfaultError) Error() string {
+	return "fault reported to userfaultfd"
+}
+
+// NewUserfault returns a Userfault that reports faults in mm.
+func (mm *MemoryManager) NewUserfault() *Userfault {
+	return &Userfault{mm: mm}
+}
+
+// checkRangeLocked checks that ar is entirely covered by vmas that may be
+// registered with a Userfault, and returns an iterator to the vma containing
+// ar.Start.
+//
+// Preconditions: u.mm.mappingMu must be locked. ar must be page-aligned and
+// non-empty.
+func (u *Userfault) checkRangeLocked(ar usermem.AddrRange) (vmaIterator, error) {
+	vseg := u.mm.vmas.LowerBoundSegment(ar.Start)
+	if !vseg.Ok() || ar.Start < vseg.Start() {
+		return vmaIterator{}, syserror.EINVAL
+	}
+	for vs := vseg; ; {
+		if vs.ValuePtr().mappable != nil {
+			return vmaIterator{}, syserror.EINVAL
+		}
+		if ar.End <= vs.End() {
+			return vseg, nil
+		}
+		vs, _ = vs.NextNonEmpty()
+		if !vs.Ok() {
+			return vmaIterator{}, syserror.EINVAL
+		}
+	}
+}
+
+// Register registers the vmas in ar with u, such that application faults on
+// missing pages in ar are reported by u.
+//
+// Preconditions: ar must be page-aligned and non-empty.
+func (u *Userfault) Register(ar usermem.AddrRange) error {
+	mm := u.mm
+	mm.mappingMu.Lock()
+	defer mm.mappingMu.Unlock()
+	vseg, err := u.checkRangeLocked(ar)
+	if err != nil {
+		return err
+	}
+	for vs := vseg; ; {
+		if uffd := vs.ValuePtr().uffd; uffd != nil && uffd != u {
+			return syserror.EBUSY
+		}
+		if ar.End <= vs.End() {
+			break
+		}
+		vs = vs.NextSegment()
+	}
+
+	defer func() {
+		mm.vmas.MergeRange(ar)
+		mm.vmas.MergeAdjacent(ar)
+	}()
+	for {
+		vseg = mm.vmas.Isolate(vseg, ar)
+		vseg.ValuePtr().uffd = u
+		if ar.End <= vseg.End() {
+			return nil
+		}
+		vseg = vseg.NextSegment()
+	}
+}
+
+// Unregister unregisters the vmas in ar from u, and wakes threads waiting for
+// faults in ar.
+//
+// Preconditions: ar must be page-aligned and non-empty.
+func (u *Userfault) Unregister(ar usermem.AddrRange) error {
+	mm := u.mm
+	mm.mappingMu.Lock()
+	vseg, err := u.checkRangeLocked(ar)
+	if err != nil {
+		mm.mappingMu.Unlock()
+		return err
+	}
+	for {
+		if vseg.ValuePtr().uffd == u {
+			vseg = mm.vmas.Isolate(vseg, ar)
+			vseg.ValuePtr().uffd = nil
+		}
+		if ar.End <= vseg.End() {
+			break
+		}
+		vseg = vseg.NextSegment()
+	}
+	mm.vmas.MergeRange(ar)
+	mm.vmas.MergeAdjacent(ar)
+	mm.mappingMu.Unlock()
+
+	u.Wake(ar)
+	return nil
+}
+
+// Release unregisters all vmas registered with u, and wakes all threads
+// waiting for faults reported by u. Threads that retry such faults find that
+// the page is no longer tracked, and fault it in normally.
+func (u *Userfault) Release() {
+	mm := u.mm
+	mm.mappingMu.Lock()
+	for vseg := mm.vmas.FirstSegment(); vseg.Ok(); vseg = vseg.NextSegment() {
+		if vma := vseg.ValuePtr(); vma.uffd == u {
+			vma.uffd = nil
+		}
+	}
+	mm.vmas.MergeRange(mm.applicationAddrRange())
+	mm.mappingMu.Unlock()
+
+	u.Wake(mm.applicationAddrRange())
+}
+
+// Wake wakes threads waiting for faults in ar, which retry their faulting
+// accesses. Faults in ar that have not yet been read are discarded.
+func (u *Userfault) Wake(ar usermem.AddrRange) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for addr, f := range u.faults {
+		if ar.Contains(addr) {
+			close(f.done)
+			f.woken = true
+			delete(u.faults, addr)
+		}
+	}
+	pending := u.pending[:0]
+	for _, f := range u.pending {
+		if !f.woken {
+			pending = append(pending, f)
+		}
+	}
+	for i := len(pending); i < len(u.pending); i++ {
+		u.pending[i] = nil
+	}
+	u.pending = pending
+}
+
+// Events removes and returns up to max unread faults.
+func (u *Userfault) Events(max int) []UserfaultEvent {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if max > len(u.pending) {
+		max = len(u.pending)
+	}
+	if max == 0 {
+		return nil
+	}
+	evs := make([]UserfaultEvent, max)
+	for i, f := range u.pending[:max] {
+		evs[i] = f.event
+	}
+	u.pending = append(u.pending[:0], u.pending[max:]...)
+	return evs
+}
+
+// Readiness implements waiter.Waitable.Readiness.
+func (u *Userfault) Readiness(mask waiter.EventMask) waiter.EventMask {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if len(u.pending) != 0 {
+		return mask & waiter.EventIn
+	}
+	return 0
+}
+
+// report reports an application fault on the page at addr, and returns the
+// UserfaultError that the faulting thread should wait on. Concurrent faults on
+// the same page are reported once.
+//
+// Preconditions: addr must be page-aligned.
+func (u *Userfault) report(addr usermem.Addr, write bool) error {
+	u.mu.Lock()
+	f, ok := u.faults[addr]
+	if !ok {
+		if u.faults == nil {
+			u.faults = make(map[usermem.Addr]*userfault)
+		}
+		f = &userfault{
+			event: UserfaultEvent{Addr: addr, Write: write},
+			done:  make(chan struct{}),
+		}
+		u.faults[addr] = f
+		u.pending = append(u.pending, f)
+	}
+	u.mu.Unlock()
+
+	if !ok {
+		u.Notify(waiter.EventIn)
+	}
+	return &UserfaultError{C: f.done}
+}
+
+// Fill populates the missing page at addr, which must be in a vma registered
+// with u, with a copy of src, or with zeroes if src is nil. It does not wake
+// threads waiting for a fault on the page; see Wake.
+//
+// Fill returns ENOENT if addr is not in a vma registered with u, EEXIST if the
+// page is already present, and ESRCH if u's MemoryManager has no remaining
+// users.
+//
+// Preconditions: addr must be page-aligned. If src is not nil,
+// len(src) == usermem.PageSize.
+func (u *Userfault) Fill(ctx context.Context, addr usermem.Addr, src []byte) error {
+	mm := u.mm
+	if !mm.IncUsers() {
+		return syserror.ESRCH
+	}
+	defer mm.DecUsers(ctx)
+
+	ar, ok := addr.ToRange(usermem.PageSize)
+	if !ok {
+		return syserror.EINVAL
+	}
+	mm.mappingMu.RLock()
+	defer mm.mappingMu.RUnlock()
+	vseg := mm.vmas.FindSegment(addr)
+	if !vseg.Ok() || vseg.ValuePtr().uffd != u {
+		return syserror.ENOENT
+	}
+	vma := vseg.ValuePtr()
+
+	mm.activeMu.Lock()
+	defer mm.activeMu.Unlock()
+	pseg, pgap := mm.pmas.Find(addr)
+	if pseg.Ok() {
+		return syserror.EEXIST
+	}
+
+	mem := mm.p.Memory()
+	fr, err := mem.Allocate(usermem.PageSize, usage.Anonymous)
+	if err != nil {
+		return err
+	}
+	if src != nil {
+		ims, err := mem.MapInternal(fr, usermem.Write)
+		if err == nil {
+			_, err = safemem.CopySeq(ims, safemem.BlockSeqOf(safemem.BlockFromSafeSlice(src)))
+		}
+		if err != nil {
+			mem.DecRef(fr)
+			return err
+		}
+	}
+	mm.incPrivateRef(fr)
+	mm.addRSSLocked(ar)
+	mem.IncRef(fr)
+	mm.pmas.Insert(pgap, ar, pma{
+		file:              mem,
+		off:               fr.Start,
+		vmaEffectivePerms: vma.effectivePerms,
+		vmaMaxPerms:       vma.maxPerms,
+		private:           true,
+	})
+	return nil
+}
@@ -359,6 +359,7 @@ func (vmaSetFunctions) ClearValue(vma *vma) {
 	vma.mappable = nil
 	vma.id = nil
 	vma.hint = ""
+	vma.uffd = nil
 }
 
 func (vmaSetFunctions) Merge(ar1 usermem.AddrRange, vma1 vma, ar2 usermem.AddrRange, vma2 vma) (vma, bool) {
@@ -369,7 +370,8 @@ func (vmaSetFunctions) Merge(ar1 usermem.AddrRange, vma1 vma, ar2 usermem.AddrRa
 		vma1.private != vma2.private ||
 		vma1.growsDown != vma2.growsDown ||
 		vma1.id != vma2.id ||
-		vma1.hint != vma2.hint {
+		vma1.hint != vma2.hint ||
+		vma1.uffd != vma2.uffd {
 		return vma{}, false
 	}
 
@@ -140,6 +140,15 @@ type FileMem struct {
 
 	mappingsMu sync.Mutex
 	mappings   atomic.Value
+
+	// savedHashes contains, for each page in the file, a hash of the page's
+	// contents when it was last saved by SaveTo or SaveDeltaTo, or 0 if the
+	// page was not saved. SaveDeltaTo uses savedHashes to identify pages
+	// that changed since the previous save. savedHashes is nil if the
+	// filemem has never been saved.
+	//
+	// savedHashes is protected by mu.
+	savedHashes []uint64
 }
 
 // usage tracks usage information.
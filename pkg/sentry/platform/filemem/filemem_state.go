@@ -17,18 +17,45 @@ package filemem
 import (
 	"bytes"
 	"fmt"
+	"hash/crc64"
 	"io"
 	"runtime"
 	"syscall"
 
 	"gvisor.googlesource.com/gvisor/pkg/log"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/platform"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/usage"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
 	"gvisor.googlesource.com/gvisor/pkg/state"
 )
 
+// pageHashTable is the table used by pageHash.
+var pageHashTable = crc64.MakeTable(crc64.ECMA)
+
+// pageHash returns a hash of the contents of the page pg, which is never 0.
+func pageHash(pg []byte) uint64 {
+	return crc64.Checksum(pg, pageHashTable) | 1
+}
+
 // SaveTo implements platform.Memory.SaveTo.
 func (f *FileMem) SaveTo(w io.Writer) error {
+	return f.saveTo(w, false)
+}
+
+// SaveDeltaTo implements platform.Memory.SaveDeltaTo.
+func (f *FileMem) SaveDeltaTo(w io.Writer) error {
+	return f.saveTo(w, true)
+}
+
+// saveTo implements SaveTo and SaveDeltaTo.
+//
+// The memory state consists of the file size and usage set, followed by the
+// contents of each committed segment. For a full save, each committed
+// segment's contents are written as a single block. For a delta save, each
+// committed segment's contents are preceded by a list of the ranges in the
+// segment that changed since the previous save, and only the contents of
+// those ranges are written.
+func (f *FileMem) saveTo(w io.Writer, delta bool) error {
 	// Wait for reclaim.
 	f.mu.Lock()
 	defer f.mu.Unlock()
@@ -39,6 +66,10 @@ func (f *FileMem) SaveTo(w io.Writer) error {
 		f.mu.Lock()
 	}
 
+	if delta && f.savedHashes == nil {
+		return fmt.Errorf("no previous save to compute a delta from")
+	}
+
 	// Ensure that all pages that contain data have knownCommitted set, since
 	// we only store knownCommitted pages below.
 	zeroPage := make([]byte, usermem.PageSize)
@@ -79,36 +110,79 @@ func (f *FileMem) SaveTo(w io.Writer) error {
 		return err
 	}
 
-	// Dump out committed pages.
+	// Dump out committed pages, recording their hashes for the next delta
+	// save.
+	hashes := make([]uint64, f.fileSize/usermem.PageSize)
+	var savedPages, totalPages uint64
 	for seg := f.usage.FirstSegment(); seg.Ok(); seg = seg.NextSegment() {
 		if !seg.Value().knownCommitted {
 			continue
 		}
-		// Write a header to distinguish from objects.
-		if err := state.WriteHeader(w, uint64(seg.Range().Length()), false); err != nil {
+
+		// Hash the segment's pages, and find those that changed since the
+		// previous save. Unless delta is true, the whole segment is
+		// written.
+		changed := []uint64{seg.Start(), seg.End()}
+		if delta {
+			changed = changed[:0]
+		}
+		off := seg.Start()
+		if err := f.forEachMappingSlice(seg.Range(), func(s []byte) {
+			for pgoff := 0; pgoff < len(s); pgoff += usermem.PageSize {
+				i := off / usermem.PageSize
+				hashes[i] = pageHash(s[pgoff : pgoff+usermem.PageSize])
+				if delta && (i >= uint64(len(f.savedHashes)) || f.savedHashes[i] != hashes[i]) {
+					if n := len(changed); n > 0 && changed[n-1] == off {
+						changed[n-1] += usermem.PageSize
+					} else {
+						changed = append(changed, off, off+usermem.PageSize)
+					}
+				}
+				off += usermem.PageSize
+			}
+		}); err != nil {
 			return err
 		}
-		// Write out data.
-		var ioErr error
-		err := f.forEachMappingSlice(seg.Range(), func(s []byte) {
-			if ioErr != nil {
-				return
+		if delta {
+			if err := state.Save(w, &changed, nil); err != nil {
+				return err
 			}
-			_, ioErr = w.Write(s)
-		})
-		if ioErr != nil {
-			return ioErr
 		}
-		if err != nil {
-			return err
+
+		for i := 0; i < len(changed); i += 2 {
+			fr := platform.FileRange{changed[i], changed[i+1]}
+			// Write a header to distinguish from objects.
+			if err := state.WriteHeader(w, uint64(fr.Length()), false); err != nil {
+				return err
+			}
+			// Write out data.
+			var ioErr error
+			err := f.forEachMappingSlice(fr, func(s []byte) {
+				if ioErr != nil {
+					return
+				}
+				_, ioErr = w.Write(s)
+			})
+			if ioErr != nil {
+				return ioErr
+			}
+			if err != nil {
+				return err
+			}
+			savedPages += fr.Length() / usermem.PageSize
 		}
+		totalPages += seg.Range().Length() / usermem.PageSize
 
 		// Update accounting for restored pages. We need to do this here since
 		// these segments are marked as "known committed", and will be skipped
 		// over on accounting scans.
 		usage.MemoryAccounting.Inc(seg.Range().Length(), seg.Value().kind)
 	}
+	if delta {
+		log.Infof("Saved %d of %d committed pages that changed since the previous save", savedPages, totalPages)
+	}
 
+	f.savedHashes = hashes
 	return nil
 }
 
@@ -168,3 +242,108 @@ func (f *FileMem) LoadFrom(r io.Reader) error {
 
 	return nil
 }
+
+// LoadDeltaFrom implements platform.Memory.LoadDeltaFrom.
+func (f *FileMem) LoadDeltaFrom(r io.Reader) error {
+	// Load metadata.
+	var fileSize int64
+	if err := state.Load(r, &fileSize, nil); err != nil {
+		return err
+	}
+	if fileSize < f.fileSize {
+		return fmt.Errorf("file size decreased from %d to %d", f.fileSize, fileSize)
+	}
+	if err := f.file.Truncate(fileSize); err != nil {
+		return err
+	}
+	newMappings := make([]uintptr, fileSize>>chunkShift)
+	copy(newMappings, f.mappings.Load().([]uintptr))
+	f.mappings.Store(newMappings)
+	var newUsage usageSet
+	if err := state.Load(r, &newUsage, nil); err != nil {
+		return err
+	}
+
+	// Undo accounting for the pages loaded from the previous save, and
+	// decommit the pages that are no longer committed. Pages that remain
+	// committed keep their contents unless they are included below.
+	for seg := f.usage.FirstSegment(); seg.Ok(); seg = seg.NextSegment() {
+		if seg.Value().knownCommitted {
+			usage.MemoryAccounting.Dec(seg.Range().Length(), seg.Value().kind)
+		}
+	}
+	var start uint64
+	decommit := func(end uint64) error {
+		if start == end {
+			return nil
+		}
+		// See Decommit.
+		return syscall.Fallocate(int(f.file.Fd()), _FALLOC_FL_PUNCH_HOLE|_FALLOC_FL_KEEP_SIZE, int64(start), int64(end-start))
+	}
+	for seg := newUsage.FirstSegment(); seg.Ok(); seg = seg.NextSegment() {
+		if !seg.Value().knownCommitted {
+			continue
+		}
+		if err := decommit(seg.Start()); err != nil {
+			return err
+		}
+		start = seg.End()
+	}
+	if err := decommit(uint64(fileSize)); err != nil {
+		return err
+	}
+	f.fileSize = fileSize
+	f.usage = newUsage
+
+	// Load changed pages.
+	for seg := f.usage.FirstSegment(); seg.Ok(); seg = seg.NextSegment() {
+		if !seg.Value().knownCommitted {
+			continue
+		}
+		var changed []uint64
+		if err := state.Load(r, &changed, nil); err != nil {
+			return err
+		}
+		if len(changed)%2 != 0 {
+			return fmt.Errorf("odd number of changed range bounds: %d", len(changed))
+		}
+		for i := 0; i < len(changed); i += 2 {
+			fr := platform.FileRange{changed[i], changed[i+1]}
+			if !fr.WellFormed() || fr.Start < seg.Start() || fr.End > seg.End() {
+				return fmt.Errorf("changed range %v not in segment %v", fr, seg.Range())
+			}
+			// Verify header.
+			length, object, err := state.ReadHeader(r)
+			if err != nil {
+				return err
+			}
+			if object {
+				// Not expected.
+				return fmt.Errorf("unexpected object")
+			}
+			if expected := uint64(fr.Length()); length != expected {
+				// Size mismatch.
+				return fmt.Errorf("mismatched range: expected %d, got %d", expected, length)
+			}
+			// Read data.
+			var ioErr error
+			err = f.forEachMappingSlice(fr, func(s []byte) {
+				if ioErr != nil {
+					return
+				}
+				_, ioErr = io.ReadFull(r, s)
+			})
+			if ioErr != nil {
+				return ioErr
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		// See LoadFrom.
+		usage.MemoryAccounting.Inc(seg.End()-seg.Start(), seg.Value().kind)
+	}
+
+	return nil
+}
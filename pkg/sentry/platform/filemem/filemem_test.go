@@ -15,8 +15,11 @@
 package filemem
 
 import (
+	"bytes"
 	"testing"
 
+	"gvisor.googlesource.com/gvisor/pkg/sentry/platform"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usage"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
 )
 
@@ -120,3 +123,86 @@ func TestFindUnallocatedRange(t *testing.T) {
 		})
 	}
 }
+
+// fill sets every byte in fr to b.
+func fill(t *testing.T, f *FileMem, fr platform.FileRange, b byte) {
+	if err := f.forEachMappingSlice(fr, func(s []byte) {
+		for i := range s {
+			s[i] = b
+		}
+	}); err != nil {
+		t.Fatalf("forEachMappingSlice(%v) failed: %v", fr, err)
+	}
+}
+
+// contents returns a copy of the bytes in fr.
+func contents(t *testing.T, f *FileMem, fr platform.FileRange) []byte {
+	var buf []byte
+	if err := f.forEachMappingSlice(fr, func(s []byte) {
+		buf = append(buf, s...)
+	}); err != nil {
+		t.Fatalf("forEachMappingSlice(%v) failed: %v", fr, err)
+	}
+	return buf
+}
+
+func TestSaveDelta(t *testing.T) {
+	src, err := New("filemem-test-src")
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	defer src.Destroy()
+	dst, err := New("filemem-test-dst")
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	defer dst.Destroy()
+
+	var buf bytes.Buffer
+	if err := src.SaveDeltaTo(&buf); err == nil {
+		t.Errorf("SaveDeltaTo() before SaveTo() succeeded, want error")
+	}
+
+	fr, err := src.Allocate(8*page, usage.Anonymous)
+	if err != nil {
+		t.Fatalf("Allocate() failed: %v", err)
+	}
+	fill(t, src, fr, 1)
+	buf.Reset()
+	if err := src.SaveTo(&buf); err != nil {
+		t.Fatalf("SaveTo() failed: %v", err)
+	}
+	fullLen := buf.Len()
+	if err := dst.LoadFrom(&buf); err != nil {
+		t.Fatalf("LoadFrom() failed: %v", err)
+	}
+
+	// Change two pages, and zero a third, which will be decommitted.
+	fill(t, src, platform.FileRange{fr.Start + page, fr.Start + 3*page}, 2)
+	fill(t, src, platform.FileRange{fr.Start + 5*page, fr.Start + 6*page}, 0)
+	buf.Reset()
+	if err := src.SaveDeltaTo(&buf); err != nil {
+		t.Fatalf("SaveDeltaTo() failed: %v", err)
+	}
+	if buf.Len() >= fullLen/2 {
+		t.Errorf("delta is %d bytes, want less than %d bytes", buf.Len(), fullLen/2)
+	}
+	if err := dst.LoadDeltaFrom(&buf); err != nil {
+		t.Fatalf("LoadDeltaFrom() failed: %v", err)
+	}
+	if !bytes.Equal(contents(t, dst, fr), contents(t, src, fr)) {
+		t.Errorf("contents differ after LoadDeltaFrom()")
+	}
+
+	// An unchanged delta contains no pages.
+	buf.Reset()
+	if err := src.SaveDeltaTo(&buf); err != nil {
+		t.Fatalf("SaveDeltaTo() failed: %v", err)
+	}
+	if err := dst.LoadDeltaFrom(&buf); err != nil {
+		t.Fatalf("LoadDeltaFrom() failed: %v", err)
+	}
+	if !bytes.Equal(contents(t, dst, fr), contents(t, src, fr)) {
+		t.Errorf("contents differ after empty LoadDeltaFrom()")
+	}
+}
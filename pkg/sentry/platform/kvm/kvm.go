@@ -89,6 +89,13 @@ func New() (*KVM, error) {
 	}, nil
 }
 
+// ReliableTSC returns true if applications can read time from the TSC in the
+// VDSO, rather than from the sentry: the host TSC is invariant, and the guest
+// TSC is identical to it on every vCPU.
+func (k *KVM) ReliableTSC() bool {
+	return hasInvariantTSC() && !k.machine.approximateTSC
+}
+
 // SupportsAddressSpaceIO implements platform.Platform.SupportsAddressSpaceIO.
 func (*KVM) SupportsAddressSpaceIO() bool {
 	return false
@@ -168,6 +168,16 @@ type modelControlRegisters struct {
 	entries [16]modelControlRegister
 }
 
+// deviceAttr is a device attribute.
+//
+// This mirrors kvm_device_attr.
+type deviceAttr struct {
+	flags uint32
+	group uint32
+	attr  uint64
+	addr  uint64
+}
+
 // runData is the run structure. This may be mapped for synchronous register
 // access (although that doesn't appear to be supported by my kernel at least).
 //
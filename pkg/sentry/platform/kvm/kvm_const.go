@@ -33,6 +33,13 @@ const (
 	_KVM_GET_SUPPORTED_CPUID    = 0xc008ae05
 	_KVM_SET_CPUID2             = 0x4008ae90
 	_KVM_SET_SIGNAL_MASK        = 0x4004ae8b
+	_KVM_SET_DEVICE_ATTR        = 0x4018aee1
+)
+
+// KVM vCPU device attributes.
+const (
+	_KVM_VCPU_TSC_CTRL   = 0x0
+	_KVM_VCPU_TSC_OFFSET = 0x0
 )
 
 // KVM exit reasons.
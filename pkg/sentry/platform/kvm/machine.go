@@ -57,6 +57,12 @@ type machine struct {
 	// the negative vCPU id. This is merely an optimization, so while
 	// collisions here are not possible, it wouldn't matter anyways.
 	vCPUs map[uint64]*vCPU
+
+	// approximateTSC indicates that the guest TSC of some vCPUs could only
+	// be set close to the host TSC, rather than identical to it.
+	//
+	// It is set only while the vCPUs are created.
+	approximateTSC bool
 }
 
 const (
@@ -21,6 +21,7 @@ import (
 	"reflect"
 	"syscall"
 
+	"gvisor.googlesource.com/gvisor/pkg/cpuid"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/arch"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/platform"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/platform/ring0"
@@ -137,6 +138,17 @@ func (c *vCPU) initArchState() error {
 	return c.setSystemTime()
 }
 
+// hasInvariantTSC returns true if the host TSC runs at a constant rate in all
+// power states, as reported by CPUID.80000007H:EDX[8].
+func hasInvariantTSC() bool {
+	const invariantTSC = 1 << 8
+	if max, _, _, _ := cpuid.HostID(0x80000000, 0); max < 0x80000007 {
+		return false
+	}
+	_, _, _, dx := cpuid.HostID(0x80000007, 0)
+	return dx&invariantTSC != 0
+}
+
 // nonCanonical generates a canonical address return.
 //
 //go:nosplit
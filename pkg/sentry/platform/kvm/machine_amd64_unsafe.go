@@ -107,11 +107,22 @@ func (c *vCPU) setCPUID() error {
 	return nil
 }
 
-// setSystemTime sets the TSC for the vCPU.
+// setSystemTime sets the TSC for the vCPU to the host TSC.
 //
-// FIXME: This introduces a slight TSC offset between host and
-// guest, which may vary per vCPU.
+// The TSC offset is relative to the host TSC, and isn't saved, so it is set
+// again for the new host whenever vCPUs are created, e.g. after restore.
 func (c *vCPU) setSystemTime() error {
+	// Prefer a zero TSC offset, which makes the guest TSC identical to the
+	// host TSC on every vCPU.
+	if err := c.setTSCOffset(0); err == nil {
+		return nil
+	}
+	c.machine.approximateTSC = true
+
+	// Otherwise, set the TSC directly.
+	//
+	// FIXME: This introduces a slight TSC offset between host and
+	// guest, which may vary per vCPU.
 	const _MSR_IA32_TSC = 0x00000010
 	registers := modelControlRegisters{
 		nmsrs: 1,
@@ -130,6 +141,25 @@ func (c *vCPU) setSystemTime() error {
 	return nil
 }
 
+// setTSCOffset sets the offset of the guest TSC from the host TSC.
+//
+// This requires KVM_VCPU_TSC_CTRL, which was added in Linux 5.16.
+func (c *vCPU) setTSCOffset(offset int64) error {
+	attr := deviceAttr{
+		group: _KVM_VCPU_TSC_CTRL,
+		attr:  _KVM_VCPU_TSC_OFFSET,
+		addr:  uint64(uintptr(unsafe.Pointer(&offset))),
+	}
+	if _, _, errno := syscall.RawSyscall(
+		syscall.SYS_IOCTL,
+		uintptr(c.fd),
+		_KVM_SET_DEVICE_ATTR,
+		uintptr(unsafe.Pointer(&attr))); errno != 0 {
+		return fmt.Errorf("error setting TSC offset: %v", errno)
+	}
+	return nil
+}
+
 // setSignalMask sets the vCPU signal mask.
 //
 // This must be called prior to running the vCPU.
@@ -149,6 +149,17 @@ type Context interface {
 	Interrupt()
 }
 
+// NicenessSetter is implemented by Contexts that can pass the niceness of the
+// thread that they execute on to the host, so that host CPU contention is
+// resolved according to application priorities.
+type NicenessSetter interface {
+	// SetNiceness sets the host niceness, in the range [-20, 19], with which
+	// the Context executes application code. It takes effect on the next
+	// call to Switch. The host may refuse to decrease niceness; such
+	// failures are not reported.
+	SetNiceness(n int)
+}
+
 var (
 	// ErrContextSignal is returned by Context.Switch() to indicate that the
 	// Context was interrupted by a signal.
@@ -397,6 +408,15 @@ type Memory interface {
 	// LoadFrom loads the memory state from the given stream, which will
 	// generally be a statefile.
 	LoadFrom(r io.Reader) error
+
+	// SaveDeltaTo saves the changes to the memory state since the last call
+	// to SaveTo or SaveDeltaTo to the given stream. It returns an error if
+	// the memory state has not been saved before.
+	SaveDeltaTo(w io.Writer) error
+
+	// LoadDeltaFrom applies changes saved by SaveDeltaTo to memory state
+	// previously loaded by LoadFrom or LoadDeltaFrom.
+	LoadDeltaFrom(r io.Reader) error
 }
 
 // AllocateAndFill allocates memory of the given kind from mem and fills it by
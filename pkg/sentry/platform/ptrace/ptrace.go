@@ -48,6 +48,7 @@ package ptrace
 
 import (
 	"sync"
+	"sync/atomic"
 
 	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/arch"
@@ -94,6 +95,15 @@ type context struct {
 	// lastFaultIP is the address of the last faulting instruction;
 	// this is also only meaningful if lastFaultSP is non-nil.
 	lastFaultIP usermem.Addr
+
+	// niceness is the host niceness with which application code is
+	// executed. It must be accessed atomically.
+	niceness int32
+}
+
+// SetNiceness implements platform.NicenessSetter.SetNiceness.
+func (c *context) SetNiceness(n int) {
+	atomic.StoreInt32(&c.niceness, int32(n))
 }
 
 // Switch runs the provided context in the given address space.
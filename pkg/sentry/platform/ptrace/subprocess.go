@@ -19,6 +19,7 @@ import (
 	"os"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"syscall"
 
 	"gvisor.googlesource.com/gvisor/pkg/sentry/arch"
@@ -47,6 +48,10 @@ type thread struct {
 	tgid int32
 	tid  int32
 	cpu  uint32
+
+	// niceness is the host niceness last set by setNiceness. It is only
+	// accessed by the tracer of the thread.
+	niceness int32
 }
 
 // threadPool is a collection of threads.
@@ -431,6 +436,7 @@ func (s *subprocess) switchToApp(c *context, ac arch.Context) bool {
 	// emulation below several times faster, presumably by avoiding
 	// interprocessor wakeups and by simplifying the schedule.
 	t.bind()
+	t.setNiceness(atomic.LoadInt32(&c.niceness))
 
 	// Set registers.
 	if err := t.setRegs(regs); err != nil {
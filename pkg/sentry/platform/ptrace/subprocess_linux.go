@@ -24,6 +24,21 @@ import (
 	"gvisor.googlesource.com/gvisor/pkg/sentry/platform/procid"
 )
 
+// setNiceness sets the host niceness of t to n, if it differs from the
+// niceness last set. Threads are shared by all contexts that switch on the
+// same tracer, so their niceness follows the context that is running. As with
+// bind, no failures are reported: without CAP_SYS_NICE, the host refuses to
+// decrease niceness.
+//
+// Precondition: the current runtime thread should be locked.
+func (t *thread) setNiceness(n int32) {
+	if t.niceness == n {
+		return
+	}
+	t.niceness = n
+	syscall.RawSyscall(syscall.SYS_SETPRIORITY, 0 /* PRIO_PROCESS */, uintptr(t.tid), uintptr(n))
+}
+
 // createStub creates a fresh stub processes.
 //
 // Precondition: the runtime OS thread must be locked.
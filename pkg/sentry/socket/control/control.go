@@ -129,7 +129,8 @@ func PackRights(t *kernel.Task, rights SCMRights, cloexec bool, buf []byte) []by
 
 // scmCredentials represents an SCM_CREDENTIALS socket control message.
 type scmCredentials struct {
-	t    *kernel.Task
+	// tg is the process whose ID is passed, or nil if the ID is 0.
+	tg   *kernel.ThreadGroup
 	kuid auth.KUID
 	kgid auth.KGID
 }
@@ -146,10 +147,32 @@ func NewSCMCredentials(t *kernel.Task, cred linux.ControlMessageCredentials) (SC
 	if err != nil {
 		return nil, err
 	}
-	if kernel.ThreadID(cred.PID) != t.ThreadGroup().ID() && !t.HasCapabilityIn(linux.CAP_SYS_ADMIN, t.PIDNamespace().UserNamespace()) {
+	pidns := t.PIDNamespace()
+	if kernel.ThreadID(cred.PID) != pidns.IDOfThreadGroup(t.ThreadGroup()) && !t.HasCapabilityIn(linux.CAP_SYS_ADMIN, pidns.UserNamespace()) {
 		return nil, syserror.EPERM
 	}
-	return &scmCredentials{t, kuid, kgid}, nil
+	// The process is passed rather than its ID, so that the receiver sees
+	// its ID in the receiver's PID namespace.
+	var tg *kernel.ThreadGroup
+	if cred.PID != 0 {
+		if tg = pidns.ThreadGroupWithID(kernel.ThreadID(cred.PID)); tg == nil {
+			return nil, syserror.ESRCH
+		}
+	}
+	return &scmCredentials{tg, kuid, kgid}, nil
+}
+
+// CurrentCredentials returns the credentials of t's process as they are
+// passed to peers, with its effective user and group IDs.
+func CurrentCredentials(t *kernel.Task) SCMCredentials {
+	tcred := t.Credentials()
+	return &scmCredentials{t.ThreadGroup(), tcred.EffectiveKUID, tcred.EffectiveKGID}
+}
+
+// KernelCredentials returns the credentials of messages sent by the kernel,
+// such as netlink messages: PID 0 and the root user and group.
+func KernelCredentials() SCMCredentials {
+	return &scmCredentials{nil, auth.RootKUID, auth.RootKGID}
 }
 
 // Equals implements unix.CredentialsControlMessage.Equals.
@@ -240,7 +263,13 @@ func (c *scmCredentials) Credentials(t *kernel.Task) (kernel.ThreadID, auth.UID,
 	// of SCM_CREDENTIALS in unix(7)), they are translated into the
 	// corresponding values as per the receiving process's user and group ID
 	// mappings." - user_namespaces(7)
-	pid := t.PIDNamespace().IDOfTask(c.t)
+	//
+	// Similarly, the process ID is the ID of the process in the receiver's
+	// PID namespace, or 0 if it isn't visible there.
+	var pid kernel.ThreadID
+	if c.tg != nil {
+		pid = t.PIDNamespace().IDOfThreadGroup(c.tg)
+	}
 	uid := c.kuid.In(t.UserNamespace()).OrOverflow()
 	gid := c.kgid.In(t.UserNamespace()).OrOverflow()
 
@@ -264,6 +293,17 @@ func PackCredentials(t *kernel.Task, creds SCMCredentials, buf []byte) []byte {
 	return putCmsg(buf, linux.SCM_CREDENTIALS, align, c)
 }
 
+// SecurityLabel is the security context of all tasks, as reported by
+// SO_PEERSEC and SCM_SECURITY. The sentry doesn't implement Linux security
+// modules, so all tasks are unconfined, which AppArmor reports as
+// "unconfined".
+const SecurityLabel = "unconfined"
+
+// PackSecurity packs the SCM_SECURITY message of the sender into a buffer.
+func PackSecurity(t *kernel.Task, buf []byte) []byte {
+	return putCmsgStruct(buf, linux.SCM_SECURITY, t.Arch().Width(), []byte(SecurityLabel))
+}
+
 // AlignUp rounds a length up to an alignment. align must be a power of 2.
 func AlignUp(length int, align uint) int {
 	return (length + int(align) - 1) & ^(int(align) - 1)
@@ -390,8 +430,7 @@ func makeCreds(t *kernel.Task, socketOrEndpoint interface{}) SCMCredentials {
 		return nil
 	}
 	if cr, ok := socketOrEndpoint.(unix.Credentialer); ok && (cr.Passcred() || cr.ConnectedPasscred()) {
-		tcred := t.Credentials()
-		return &scmCredentials{t, tcred.EffectiveKUID, tcred.EffectiveKGID}
+		return CurrentCredentials(t)
 	}
 	return nil
 }
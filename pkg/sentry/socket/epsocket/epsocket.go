@@ -39,15 +39,18 @@ import (
 	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/fsutil"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/inet"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel/auth"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel/kdefs"
 	ktime "gvisor.googlesource.com/gvisor/pkg/sentry/kernel/time"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/safemem"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/socket"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/socket/control"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
 	"gvisor.googlesource.com/gvisor/pkg/syserr"
 	"gvisor.googlesource.com/gvisor/pkg/syserror"
 	"gvisor.googlesource.com/gvisor/pkg/tcpip"
 	"gvisor.googlesource.com/gvisor/pkg/tcpip/buffer"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/header"
 	nstack "gvisor.googlesource.com/gvisor/pkg/tcpip/stack"
 	"gvisor.googlesource.com/gvisor/pkg/tcpip/transport/unix"
 	"gvisor.googlesource.com/gvisor/pkg/waiter"
@@ -116,10 +119,10 @@ type SocketOperations struct {
 }
 
 // New creates a new endpoint socket.
-func New(t *kernel.Task, family int, skType unix.SockType, queue *waiter.Queue, endpoint tcpip.Endpoint) *fs.File {
-	dirent := socket.NewDirent(t, epsocketDevice)
+func New(ctx context.Context, family int, skType unix.SockType, queue *waiter.Queue, endpoint tcpip.Endpoint) *fs.File {
+	dirent := socket.NewDirent(ctx, epsocketDevice)
 	defer dirent.DecRef()
-	return fs.NewFile(t, dirent, fs.FileFlags{Read: true, Write: true}, &SocketOperations{
+	return fs.NewFile(ctx, dirent, fs.FileFlags{Read: true, Write: true}, &SocketOperations{
 		Queue:    queue,
 		family:   family,
 		Endpoint: endpoint,
@@ -475,13 +478,37 @@ func GetSockOpt(t *kernel.Task, s socket.Socket, ep commonEndpoint, family int,
 				return nil, syserr.ErrInvalidArgument
 			}
 
-			tcred := t.Credentials()
+			// The credentials are those of the peer when the connection
+			// was established (or of this socket when it started
+			// listening), as seen from the caller's namespaces.
+			var creds control.SCMCredentials
+			if pc, ok := ep.(unix.PeerCredentialer); ok {
+				creds, _ = pc.PeerCredentials().(control.SCMCredentials)
+			}
+			if creds == nil {
+				return syscall.Ucred{
+					Uid: uint32(auth.OverflowUID),
+					Gid: uint32(auth.OverflowGID),
+				}, nil
+			}
+			pid, uid, gid := creds.Credentials(t)
 			return syscall.Ucred{
-				Pid: int32(t.ThreadGroup().ID()),
-				Uid: uint32(tcred.EffectiveKUID.In(tcred.UserNamespace).OrOverflow()),
-				Gid: uint32(tcred.EffectiveKGID.In(tcred.UserNamespace).OrOverflow()),
+				Pid: int32(pid),
+				Uid: uint32(uid),
+				Gid: uint32(gid),
 			}, nil
 
+		case linux.SO_PEERSEC:
+			if family != linux.AF_UNIX {
+				return nil, syserr.ErrProtocolNotAvailable
+			}
+
+			label := []byte(control.SecurityLabel + "\x00")
+			if outLen < len(label) {
+				return nil, syserr.ErrRange
+			}
+			return label, nil
+
 		case linux.SO_PASSCRED:
 			if outLen < sizeOfInt32 {
 				return nil, syserr.ErrInvalidArgument
@@ -494,6 +521,18 @@ func GetSockOpt(t *kernel.Task, s socket.Socket, ep commonEndpoint, family int,
 
 			return int32(v), nil
 
+		case linux.SO_PASSSEC:
+			if outLen < sizeOfInt32 {
+				return nil, syserr.ErrInvalidArgument
+			}
+
+			var v tcpip.PasssecOption
+			if err := ep.GetSockOpt(&v); err != nil {
+				return nil, syserr.TranslateNetstackError(err)
+			}
+
+			return int32(v), nil
+
 		case linux.SO_SNDBUF:
 			if outLen < sizeOfInt32 {
 				return nil, syserr.ErrInvalidArgument
@@ -616,12 +655,42 @@ func GetSockOpt(t *kernel.Task, s socket.Socket, ep commonEndpoint, family int,
 			}
 
 			return int32(v), nil
+
+		case linux.IP6T_SO_ORIGINAL_DST:
+			return getOriginalDst(ep, header.IPv6AddressSize, linux.AF_INET6, outLen)
+		}
+
+	case syscall.SOL_IP:
+		switch name {
+		case linux.SO_ORIGINAL_DST:
+			return getOriginalDst(ep, header.IPv4AddressSize, linux.AF_INET, outLen)
 		}
 	}
 
 	return nil, syserr.ErrProtocolNotAvailable
 }
 
+// getOriginalDst implements SO_ORIGINAL_DST and IP6T_SO_ORIGINAL_DST. Like
+// Linux, it only reports original destinations of the address length that
+// matches the option's level.
+func getOriginalDst(ep commonEndpoint, addrLen int, family int, outLen int) (interface{}, *syserr.Error) {
+	var v tcpip.OriginalDestinationOption
+	if err := ep.GetSockOpt(&v); err != nil {
+		if err == tcpip.ErrUnknownProtocolOption {
+			return nil, syserr.ErrProtocolNotAvailable
+		}
+		return nil, syserr.TranslateNetstackError(err)
+	}
+	if len(v.Addr) != addrLen {
+		return nil, syserr.ErrNoSuchFile
+	}
+	addr, size := ConvertAddress(family, tcpip.FullAddress(v))
+	if outLen < int(size) {
+		return nil, syserr.ErrInvalidArgument
+	}
+	return addr, nil
+}
+
 // SetSockOpt implements the linux syscall setsockopt(2) for sockets backed by
 // tcpip.Endpoint.
 func (s *SocketOperations) SetSockOpt(t *kernel.Task, level int, name int, optVal []byte) *syserr.Error {
@@ -666,6 +735,14 @@ func SetSockOpt(t *kernel.Task, s socket.Socket, ep commonEndpoint, level int, n
 			v := usermem.ByteOrder.Uint32(optVal)
 			return syserr.TranslateNetstackError(ep.SetSockOpt(tcpip.PasscredOption(v)))
 
+		case linux.SO_PASSSEC:
+			if len(optVal) < sizeOfInt32 {
+				return syserr.ErrInvalidArgument
+			}
+
+			v := usermem.ByteOrder.Uint32(optVal)
+			return syserr.TranslateNetstackError(ep.SetSockOpt(tcpip.PasssecOption(v)))
+
 		case linux.SO_RCVTIMEO:
 			if len(optVal) < linux.SizeOfTimeval {
 				return syserr.ErrInvalidArgument
@@ -87,6 +87,12 @@ func (p *provider) Socket(t *kernel.Task, stype unix.SockType, protocol int) (*f
 	if e != nil {
 		return nil, syserr.TranslateNetstackError(e)
 	}
+	if transProto == tcp.ProtocolNumber && eps.redirectExempt(t) {
+		if e := ep.SetSockOpt(tcpip.NoRedirectOption(1)); e != nil {
+			ep.Close()
+			return nil, syserr.TranslateNetstackError(e)
+		}
+	}
 
 	return New(t, p.family, stype, wq, ep), nil
 }
@@ -18,7 +18,11 @@ import (
 	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
 	"gvisor.googlesource.com/gvisor/pkg/log"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/inet"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel/auth"
 	"gvisor.googlesource.com/gvisor/pkg/syserr"
+	"gvisor.googlesource.com/gvisor/pkg/syserror"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/link/qdisc"
 	"gvisor.googlesource.com/gvisor/pkg/tcpip/network/ipv4"
 	"gvisor.googlesource.com/gvisor/pkg/tcpip/network/ipv6"
 	"gvisor.googlesource.com/gvisor/pkg/tcpip/stack"
@@ -28,6 +32,29 @@ import (
 // Stack implements inet.Stack for netstack/tcpip/stack.Stack.
 type Stack struct {
 	Stack *stack.Stack `state:"manual"`
+
+	// RedirectExemptUIDs are the UIDs whose TCP sockets are exempt from
+	// the stack's redirect rules, so that an interception proxy running as
+	// one of them can connect to the original destinations. A socket is
+	// exempt if its creator's effective UID is in the list.
+	RedirectExemptUIDs []auth.KUID
+
+	// Qdiscs are the endpoints that shape the outbound traffic of the
+	// interfaces, by interface index. Interfaces without one can't be
+	// shaped. It is only modified before the stack is used.
+	Qdiscs map[int32]*qdisc.Endpoint `state:"nosave"`
+}
+
+// redirectExempt returns true if TCP sockets created by t are exempt from the
+// stack's redirect rules.
+func (s *Stack) redirectExempt(t *kernel.Task) bool {
+	uid := t.Credentials().EffectiveKUID
+	for _, exempt := range s.RedirectExemptUIDs {
+		if uid == exempt {
+			return true
+		}
+	}
+	return false
 }
 
 // SupportsIPv6 implements Stack.SupportsIPv6.
@@ -130,3 +157,40 @@ func (s *Stack) TCPSACKEnabled() (bool, error) {
 func (s *Stack) SetTCPSACKEnabled(enabled bool) error {
 	return syserr.TranslateNetstackError(s.Stack.SetTransportProtocolOption(tcp.ProtocolNumber, tcp.SACKEnabled(enabled))).ToError()
 }
+
+// QueueingDiscipline implements inet.TrafficShaper.QueueingDiscipline.
+func (s *Stack) QueueingDiscipline(idx int32) (inet.QueueingDiscipline, bool) {
+	e, ok := s.Qdiscs[idx]
+	if !ok {
+		return inet.QueueingDiscipline{}, false
+	}
+	c := e.Config()
+	return inet.QueueingDiscipline{
+		Rate:    c.Rate,
+		Burst:   c.Burst,
+		Limit:   c.Limit,
+		Flows:   c.Flows,
+		Quantum: c.Quantum,
+		Target:  c.Target,
+	}, true
+}
+
+// SetQueueingDiscipline implements inet.TrafficShaper.SetQueueingDiscipline.
+func (s *Stack) SetQueueingDiscipline(idx int32, q inet.QueueingDiscipline) error {
+	e, ok := s.Qdiscs[idx]
+	if !ok {
+		return syserror.ENODEV
+	}
+	if err := e.SetConfig(qdisc.Config{
+		Rate:    q.Rate,
+		Burst:   q.Burst,
+		Limit:   q.Limit,
+		Flows:   q.Flows,
+		Quantum: q.Quantum,
+		Target:  q.Target,
+	}); err != nil {
+		log.Warningf("Failed to shape interface %d: %v", idx, err)
+		return syserror.EINVAL
+	}
+	return nil
+}
@@ -0,0 +1,288 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hostinet
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"syscall"
+
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
+	"gvisor.googlesource.com/gvisor/pkg/syserr"
+)
+
+const (
+	// Allow is the action of rules that let operations through.
+	Allow = "allow"
+
+	// Deny is the action of rules that refuse operations.
+	Deny = "deny"
+
+	// Connect is the operation of connecting a socket, or of sending a
+	// datagram to an explicit destination.
+	Connect = "connect"
+
+	// Bind is the operation of binding a socket to a local address, or of
+	// listening on a socket that is not bound, which binds it to an
+	// ephemeral port.
+	Bind = "bind"
+)
+
+// Policy restricts the addresses that host sockets can be connected and bound
+// to. Unlike an egress policy, which filters packets in netstack, it is
+// enforced by the sentry before the connect(2), bind(2), listen(2) and
+// sendmsg(2) calls on the host sockets. It is stored as JSON, for example:
+//
+//	{
+//	  "default": "deny",
+//	  "rules": [
+//	    {"action": "allow", "operation": "connect", "protocol": "udp", "ports": [53]},
+//	    {"action": "allow", "operation": "connect", "cidr": "10.0.0.0/8", "protocol": "tcp"},
+//	    {"action": "allow", "operation": "bind", "protocol": "tcp", "ports": [8080]}
+//	  ]
+//	}
+type Policy struct {
+	// Default is the action taken for operations that don't match any
+	// rule, either Allow or Deny.
+	Default string `json:"default"`
+
+	// Rules are the rules of the policy. The first rule that matches an
+	// operation decides its fate.
+	Rules []Rule `json:"rules"`
+}
+
+// Rule matches socket operations. Empty fields match all operations.
+type Rule struct {
+	// Action is the action taken for matching operations, either Allow or
+	// Deny.
+	Action string `json:"action"`
+
+	// Operation is the operation, either Connect or Bind.
+	Operation string `json:"operation,omitempty"`
+
+	// CIDR is the subnet that contains the address, e.g. "10.0.0.0/8". For
+	// Connect it is the remote address, for Bind the local one.
+	CIDR string `json:"cidr,omitempty"`
+
+	// Protocol is the transport protocol, one of "tcp", "udp" or "icmp".
+	Protocol string `json:"protocol,omitempty"`
+
+	// Ports are the ports of the address. They can only be used with the
+	// "tcp" and "udp" protocols, or with no protocol, in which case the
+	// rule only matches TCP and UDP sockets.
+	Ports []uint16 `json:"ports,omitempty"`
+}
+
+// policy is the compiled form of a Policy.
+type policy struct {
+	allow bool
+	rules []rule
+}
+
+// rule is the compiled form of a Rule.
+type rule struct {
+	allow bool
+
+	// operation is the operation, if not empty.
+	operation string
+
+	// subnet is the subnet of the address, if not nil.
+	subnet *net.IPNet
+
+	// protocols are the transport protocols, if not empty.
+	protocols []int
+
+	// ports are the ports of the address, if not empty.
+	ports []uint16
+}
+
+func parseAction(action string) (bool, error) {
+	switch action {
+	case Allow:
+		return true, nil
+	case Deny:
+		return false, nil
+	default:
+		return false, fmt.Errorf("invalid action %q", action)
+	}
+}
+
+// Validate returns an error if the policy is malformed.
+func (p *Policy) Validate() error {
+	_, err := p.compile()
+	return err
+}
+
+func (p *Policy) compile() (*policy, error) {
+	allow, err := parseAction(p.Default)
+	if err != nil {
+		return nil, fmt.Errorf("default: %v", err)
+	}
+	c := &policy{
+		allow: allow,
+		rules: make([]rule, 0, len(p.Rules)),
+	}
+	for i, r := range p.Rules {
+		cr, err := r.compile()
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %v", i, err)
+		}
+		c.rules = append(c.rules, cr)
+	}
+	return c, nil
+}
+
+func (r *Rule) compile() (rule, error) {
+	var c rule
+	var err error
+	if c.allow, err = parseAction(r.Action); err != nil {
+		return rule{}, err
+	}
+
+	switch r.Operation {
+	case "", Connect, Bind:
+		c.operation = r.Operation
+	default:
+		return rule{}, fmt.Errorf("invalid operation %q", r.Operation)
+	}
+
+	if r.CIDR != "" {
+		_, ipNet, err := net.ParseCIDR(r.CIDR)
+		if err != nil {
+			return rule{}, fmt.Errorf("invalid cidr %q: %v", r.CIDR, err)
+		}
+		c.subnet = ipNet
+	}
+
+	switch r.Protocol {
+	case "":
+		if len(r.Ports) > 0 {
+			c.protocols = []int{syscall.IPPROTO_TCP, syscall.IPPROTO_UDP}
+		}
+	case "tcp":
+		c.protocols = []int{syscall.IPPROTO_TCP}
+	case "udp":
+		c.protocols = []int{syscall.IPPROTO_UDP}
+	case "icmp":
+		if len(r.Ports) > 0 {
+			return rule{}, fmt.Errorf("ports can't be used with protocol %q", r.Protocol)
+		}
+		c.protocols = []int{syscall.IPPROTO_ICMP, syscall.IPPROTO_ICMPV6}
+	default:
+		return rule{}, fmt.Errorf("invalid protocol %q", r.Protocol)
+	}
+	c.ports = r.Ports
+	return c, nil
+}
+
+// matches returns true if the rule matches the operation op on a socket of
+// the given transport protocol, with the given address and port.
+func (r *rule) matches(op string, protocol int, ip net.IP, port uint16) bool {
+	if r.operation != "" && r.operation != op {
+		return false
+	}
+	if r.subnet != nil && !r.subnet.Contains(ip) {
+		return false
+	}
+	if len(r.protocols) > 0 {
+		found := false
+		for _, p := range r.protocols {
+			if p == protocol {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(r.ports) > 0 {
+		found := false
+		for _, p := range r.ports {
+			if p == port {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// check returns nil if the policy allows the operation op on a socket of the
+// given transport protocol with the address sockaddr.
+func (p *policy) check(op string, protocol int, sockaddr []byte) *syserr.Error {
+	if len(sockaddr) < 2 {
+		return syserr.ErrInvalidArgument
+	}
+	var ip net.IP
+	switch usermem.ByteOrder.Uint16(sockaddr) {
+	case syscall.AF_UNSPEC:
+		// connect(2) with AF_UNSPEC dissolves the association of the
+		// socket, and bind(2) treats it as INADDR_ANY.
+		if op == Connect {
+			return nil
+		}
+		ip = net.IPv4zero
+	case syscall.AF_INET:
+		if len(sockaddr) < syscall.SizeofSockaddrInet4 {
+			return syserr.ErrInvalidArgument
+		}
+		ip = net.IP(sockaddr[4:8])
+	case syscall.AF_INET6:
+		// The host accepts the shorter sockaddr_in6 of RFC 2133, which
+		// has no scope ID.
+		if len(sockaddr) < syscall.SizeofSockaddrInet6-4 {
+			return syserr.ErrInvalidArgument
+		}
+		ip = net.IP(sockaddr[8:24])
+	default:
+		return syserr.ErrAddressFamilyNotSupported
+	}
+	var port uint16
+	if len(sockaddr) >= 4 {
+		port = binary.BigEndian.Uint16(sockaddr[2:4])
+	}
+
+	allow := p.allow
+	for i := range p.rules {
+		if p.rules[i].matches(op, protocol, ip, port) {
+			allow = p.rules[i].allow
+			break
+		}
+	}
+	if allow {
+		return nil
+	}
+	if op == Bind {
+		return syserr.ErrPermissionDenied
+	}
+	return syserr.ErrNotPermitted
+}
+
+// checkListen returns nil if the policy allows listen(2) on a socket of the
+// given transport protocol whose local address is sockaddr, as returned by
+// getsockname(2). listen(2) binds a socket that is not bound yet to an
+// ephemeral port on the wildcard address, which is checked as a Bind to port
+// 0. Sockets that are already bound were checked by bind(2).
+func (p *policy) checkListen(protocol int, sockaddr []byte) *syserr.Error {
+	if len(sockaddr) >= 4 && binary.BigEndian.Uint16(sockaddr[2:4]) != 0 {
+		return nil
+	}
+	return p.check(Bind, protocol, sockaddr)
+}
@@ -0,0 +1,138 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hostinet
+
+import (
+	"encoding/binary"
+	"net"
+	"syscall"
+	"testing"
+
+	"gvisor.googlesource.com/gvisor/pkg/syserr"
+)
+
+func inet4(ip string, port uint16) []byte {
+	b := make([]byte, syscall.SizeofSockaddrInet4)
+	binary.LittleEndian.PutUint16(b, syscall.AF_INET)
+	binary.BigEndian.PutUint16(b[2:], port)
+	copy(b[4:], net.ParseIP(ip).To4())
+	return b
+}
+
+func inet6(ip string, port uint16) []byte {
+	b := make([]byte, syscall.SizeofSockaddrInet6)
+	binary.LittleEndian.PutUint16(b, syscall.AF_INET6)
+	binary.BigEndian.PutUint16(b[2:], port)
+	copy(b[8:], net.ParseIP(ip).To16())
+	return b
+}
+
+func TestPolicyCheck(t *testing.T) {
+	p := &Policy{
+		Default: Deny,
+		Rules: []Rule{
+			{Action: Allow, Operation: Connect, Protocol: "udp", Ports: []uint16{53}},
+			{Action: Deny, Operation: Connect, CIDR: "10.1.0.0/16"},
+			{Action: Allow, Operation: Connect, CIDR: "10.0.0.0/8", Protocol: "tcp"},
+			{Action: Allow, Operation: Bind, Protocol: "tcp", Ports: []uint16{8080}},
+			{Action: Allow, Operation: Bind, Protocol: "udp", Ports: []uint16{0}},
+			{Action: Allow, Protocol: "icmp"},
+		},
+	}
+	c, err := p.compile()
+	if err != nil {
+		t.Fatalf("compile failed: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name     string
+		op       string
+		protocol int
+		sockaddr []byte
+		want     *syserr.Error
+	}{
+		{"dns", Connect, syscall.IPPROTO_UDP, inet4("8.8.8.8", 53), nil},
+		{"dns over tcp", Connect, syscall.IPPROTO_TCP, inet4("8.8.8.8", 53), syserr.ErrNotPermitted},
+		{"denied subnet", Connect, syscall.IPPROTO_TCP, inet4("10.1.2.3", 80), syserr.ErrNotPermitted},
+		{"allowed subnet", Connect, syscall.IPPROTO_TCP, inet4("10.2.3.4", 80), nil},
+		{"mapped address", Connect, syscall.IPPROTO_TCP, inet6("::ffff:10.2.3.4", 80), nil},
+		{"mapped denied address", Connect, syscall.IPPROTO_TCP, inet6("::ffff:10.1.2.3", 80), syserr.ErrNotPermitted},
+		{"ipv6", Connect, syscall.IPPROTO_TCP, inet6("2001:db8::1", 80), syserr.ErrNotPermitted},
+		{"bind", Bind, syscall.IPPROTO_TCP, inet6("::", 8080), nil},
+		{"bind other port", Bind, syscall.IPPROTO_TCP, inet4("0.0.0.0", 8081), syserr.ErrPermissionDenied},
+		{"bind ephemeral", Bind, syscall.IPPROTO_UDP, inet4("0.0.0.0", 0), nil},
+		{"ping", Connect, syscall.IPPROTO_ICMP, inet4("1.1.1.1", 0), nil},
+		{"disconnect", Connect, syscall.IPPROTO_UDP, []byte{syscall.AF_UNSPEC, 0}, nil},
+		{"short", Connect, syscall.IPPROTO_TCP, inet4("10.2.3.4", 80)[:8], syserr.ErrInvalidArgument},
+		{"unix", Connect, syscall.IPPROTO_TCP, []byte{syscall.AF_UNIX, 0, '/'}, syserr.ErrAddressFamilyNotSupported},
+	} {
+		if got := c.check(tc.op, tc.protocol, tc.sockaddr); got != tc.want {
+			t.Errorf("%s: check(%q, %d, %v) = %v, want %v", tc.name, tc.op, tc.protocol, tc.sockaddr, got, tc.want)
+		}
+	}
+}
+
+func TestPolicyCheckListen(t *testing.T) {
+	p := &Policy{
+		Default: Deny,
+		Rules: []Rule{
+			{Action: Allow, Operation: Bind, Protocol: "tcp", Ports: []uint16{8080}},
+		},
+	}
+	c, err := p.compile()
+	if err != nil {
+		t.Fatalf("compile failed: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name     string
+		sockaddr []byte
+		want     *syserr.Error
+	}{
+		{"bound", inet4("0.0.0.0", 8080), nil},
+		{"bound elsewhere", inet6("::1", 9090), nil},
+		{"unbound", inet4("0.0.0.0", 0), syserr.ErrPermissionDenied},
+		{"unbound ipv6", inet6("::", 0), syserr.ErrPermissionDenied},
+	} {
+		if got := c.checkListen(syscall.IPPROTO_TCP, tc.sockaddr); got != tc.want {
+			t.Errorf("%s: checkListen(%v) = %v, want %v", tc.name, tc.sockaddr, got, tc.want)
+		}
+	}
+
+	// A policy that allows binding to ephemeral ports allows listening on
+	// unbound sockets.
+	p.Rules = append(p.Rules, Rule{Action: Allow, Operation: Bind, Protocol: "tcp", Ports: []uint16{0}})
+	if c, err = p.compile(); err != nil {
+		t.Fatalf("compile failed: %v", err)
+	}
+	if got := c.checkListen(syscall.IPPROTO_TCP, inet4("0.0.0.0", 0)); got != nil {
+		t.Errorf("checkListen on unbound socket = %v, want nil", got)
+	}
+}
+
+func TestPolicyValidate(t *testing.T) {
+	for _, p := range []Policy{
+		{Default: "drop"},
+		{Default: Allow, Rules: []Rule{{Action: "drop"}}},
+		{Default: Allow, Rules: []Rule{{Action: Deny, Operation: "listen"}}},
+		{Default: Allow, Rules: []Rule{{Action: Deny, CIDR: "10.0.0.0"}}},
+		{Default: Allow, Rules: []Rule{{Action: Deny, Protocol: "sctp"}}},
+		{Default: Allow, Rules: []Rule{{Action: Deny, Protocol: "icmp", Ports: []uint16{1}}}},
+	} {
+		if err := p.Validate(); err == nil {
+			t.Errorf("Validate(%+v) succeeded, want error", p)
+		}
+	}
+}
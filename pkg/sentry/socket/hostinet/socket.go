@@ -55,12 +55,23 @@ type socketOperations struct {
 
 	fd    int // must be O_NONBLOCK
 	queue waiter.Queue
+
+	// protocol is the transport protocol of the socket, e.g. IPPROTO_TCP.
+	protocol int
+
+	// policy restricts the addresses that the socket can be connected and
+	// bound to, if not nil.
+	policy *policy
 }
 
 var _ = socket.Socket(&socketOperations{})
 
-func newSocketFile(ctx context.Context, fd int, nonblock bool) (*fs.File, *syserr.Error) {
-	s := &socketOperations{fd: fd}
+func newSocketFile(ctx context.Context, fd int, protocol int, p *policy, nonblock bool) (*fs.File, *syserr.Error) {
+	s := &socketOperations{
+		fd:       fd,
+		protocol: protocol,
+		policy:   p,
+	}
 	if err := fdnotifier.AddFD(int32(fd), &s.queue); err != nil {
 		return nil, syserr.FromError(err)
 	}
@@ -143,6 +154,11 @@ func (s *socketOperations) Connect(t *kernel.Task, sockaddr []byte, blocking boo
 	if len(sockaddr) > sizeofSockaddr {
 		sockaddr = sockaddr[:sizeofSockaddr]
 	}
+	if s.policy != nil {
+		if err := s.policy.check(Connect, s.protocol, sockaddr); err != nil {
+			return err
+		}
+	}
 
 	_, _, errno := syscall.Syscall(syscall.SYS_CONNECT, uintptr(s.fd), uintptr(firstBytePtr(sockaddr)), uintptr(len(sockaddr)))
 
@@ -218,7 +234,7 @@ func (s *socketOperations) Accept(t *kernel.Task, peerRequested bool, flags int,
 		return 0, peerAddr, peerAddrlen, syserr.FromError(syscallErr)
 	}
 
-	f, err := newSocketFile(t, fd, flags&syscall.SOCK_NONBLOCK != 0)
+	f, err := newSocketFile(t, fd, s.protocol, s.policy, flags&syscall.SOCK_NONBLOCK != 0)
 	if err != nil {
 		syscall.Close(fd)
 		return 0, nil, 0, err
@@ -237,6 +253,11 @@ func (s *socketOperations) Bind(t *kernel.Task, sockaddr []byte) *syserr.Error {
 	if len(sockaddr) > sizeofSockaddr {
 		sockaddr = sockaddr[:sizeofSockaddr]
 	}
+	if s.policy != nil {
+		if err := s.policy.check(Bind, s.protocol, sockaddr); err != nil {
+			return err
+		}
+	}
 
 	_, _, errno := syscall.Syscall(syscall.SYS_BIND, uintptr(s.fd), uintptr(firstBytePtr(sockaddr)), uintptr(len(sockaddr)))
 	if errno != 0 {
@@ -247,6 +268,15 @@ func (s *socketOperations) Bind(t *kernel.Task, sockaddr []byte) *syserr.Error {
 
 // Listen implements socket.Socket.Listen.
 func (s *socketOperations) Listen(t *kernel.Task, backlog int) *syserr.Error {
+	if s.policy != nil {
+		addr, _, err := s.GetSockName(t)
+		if err != nil {
+			return err
+		}
+		if err := s.policy.checkListen(s.protocol, addr.([]byte)); err != nil {
+			return err
+		}
+	}
 	return syserr.FromError(syscall.Listen(s.fd, backlog))
 }
 
@@ -424,6 +454,14 @@ func (s *socketOperations) SendMsg(t *kernel.Task, src usermem.IOSequence, to []
 		return 0, syserr.ErrInvalidArgument
 	}
 
+	// Sending to an explicit destination is subject to the same rules as
+	// connecting to it.
+	if s.policy != nil && len(to) != 0 {
+		if err := s.policy.check(Connect, s.protocol, to); err != nil {
+			return 0, err
+		}
+	}
+
 	sendmsgFromBlocks := safemem.WriterFunc(func(srcs safemem.BlockSeq) (uint64, error) {
 		// Refuse to do anything if any part of src.Addrs was unusable.
 		if uint64(src.NumBytes()) != srcs.NumBytes() {
@@ -513,43 +551,61 @@ type socketProvider struct {
 // Socket implements socket.Provider.Socket.
 func (p *socketProvider) Socket(t *kernel.Task, stypeflags unix.SockType, protocol int) (*fs.File, *syserr.Error) {
 	// Check that we are using the host network stack.
-	stack := t.NetworkContext()
-	if stack == nil {
-		return nil, nil
-	}
-	if _, ok := stack.(*Stack); !ok {
+	stack, ok := t.NetworkContext().(*Stack)
+	if !ok {
 		return nil, nil
 	}
 
-	// Only accept TCP and UDP.
+	// Only accept TCP, UDP and ICMP.
+	icmpProtocol := syscall.IPPROTO_ICMP
+	if p.family == syscall.AF_INET6 {
+		icmpProtocol = syscall.IPPROTO_ICMPV6
+	}
 	stype := int(stypeflags) & linux.SOCK_TYPE_MASK
+	transport := protocol
 	switch stype {
 	case syscall.SOCK_STREAM:
 		switch protocol {
 		case 0, syscall.IPPROTO_TCP:
-			// ok
+			transport = syscall.IPPROTO_TCP
 		default:
 			return nil, nil
 		}
 	case syscall.SOCK_DGRAM:
 		switch protocol {
 		case 0, syscall.IPPROTO_UDP:
-			// ok
+			transport = syscall.IPPROTO_UDP
+		case icmpProtocol:
+			// ICMP echo ("ping") sockets. The host permits these
+			// subject to net.ipv4.ping_group_range.
 		default:
 			return nil, nil
 		}
+	case syscall.SOCK_RAW:
+		if protocol != icmpProtocol {
+			return nil, nil
+		}
+		// Raw sockets require CAP_NET_RAW, both in the sandbox and, for
+		// the host socket, in the host.
+		if !t.HasCapability(linux.CAP_NET_RAW) {
+			return nil, syserr.ErrPermissionDenied
+		}
 	default:
 		return nil, nil
 	}
 
 	// Conservatively ignore all flags specified by the application and add
 	// SOCK_NONBLOCK since socketOperations requires it. Pass a protocol of 0
-	// to simplify the syscall filters, since 0 and IPPROTO_* are equivalent.
-	fd, err := syscall.Socket(p.family, stype|syscall.SOCK_NONBLOCK|syscall.SOCK_CLOEXEC, 0)
+	// for TCP and UDP to simplify the syscall filters, since 0 and IPPROTO_*
+	// are equivalent.
+	if protocol != icmpProtocol {
+		protocol = 0
+	}
+	fd, err := syscall.Socket(p.family, stype|syscall.SOCK_NONBLOCK|syscall.SOCK_CLOEXEC, protocol)
 	if err != nil {
 		return nil, syserr.FromError(err)
 	}
-	return newSocketFile(t, fd, stypeflags&syscall.SOCK_NONBLOCK != 0)
+	return newSocketFile(t, fd, transport, stack.policy, stypeflags&syscall.SOCK_NONBLOCK != 0)
 }
 
 // Pair implements socket.Provider.Pair.
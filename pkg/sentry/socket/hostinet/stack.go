@@ -50,6 +50,10 @@ type Stack struct {
 	tcpRecvBufSize inet.TCPBufferSize
 	tcpSendBufSize inet.TCPBufferSize
 	tcpSACKEnabled bool
+
+	// policy restricts the addresses that sockets can be connected and
+	// bound to, if not nil. It is only set before sockets are created.
+	policy *policy
 }
 
 // NewStack returns an empty Stack containing no configuration.
@@ -94,6 +98,18 @@ func (s *Stack) Configure() error {
 	return nil
 }
 
+// SetPolicy restricts the addresses that sockets created from now on can be
+// connected and bound to. It must be called before the first socket of the
+// stack is created.
+func (s *Stack) SetPolicy(p *Policy) error {
+	c, err := p.compile()
+	if err != nil {
+		return err
+	}
+	s.policy = c
+	return nil
+}
+
 // ExtractHostInterfaces will populate an interface map and
 // interfaceAddrs map with the results of the equivalent
 // netlink messages.
@@ -181,6 +197,72 @@ func doNetlinkRouteRequest(req int) ([]syscall.NetlinkMessage, error) {
 	return syscall.ParseNetlinkMessage(data)
 }
 
+// DumpNetlinkRoute implements inet.NetlinkRouteDumper.DumpNetlinkRoute.
+func (s *Stack) DumpNetlinkRoute(typ uint16, data []byte) ([]inet.NetlinkRouteMessage, error) {
+	// Only forward read-only requests. The lower 2 bits of the type
+	// describe the kind of command; 2 is a get (see
+	// include/uapi/linux/rtnetlink.h). Other kinds would also not be
+	// answered with NLMSG_DONE.
+	if typ < syscall.RTM_BASE || typ&0x3 != 0x2 {
+		return nil, syscall.EINVAL
+	}
+
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.NETLINK_ROUTE)
+	if err != nil {
+		return nil, err
+	}
+	defer syscall.Close(fd)
+
+	// Send the request with a fixed sequence number; the socket is not
+	// shared, so all responses belong to it.
+	const seq = 1
+	req := make([]byte, syscall.NLMSG_HDRLEN+len(data))
+	usermem.ByteOrder.PutUint32(req[0:], uint32(len(req)))
+	usermem.ByteOrder.PutUint16(req[4:], typ)
+	usermem.ByteOrder.PutUint16(req[6:], syscall.NLM_F_REQUEST|syscall.NLM_F_DUMP)
+	usermem.ByteOrder.PutUint32(req[8:], seq)
+	copy(req[syscall.NLMSG_HDRLEN:], data)
+	if err := syscall.Sendto(fd, req, 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		return nil, err
+	}
+
+	var msgs []inet.NetlinkRouteMessage
+	for {
+		buf := make([]byte, 32*1024)
+		n, _, err := syscall.Recvfrom(fd, buf, 0)
+		if err != nil {
+			return nil, err
+		}
+		resps, err := syscall.ParseNetlinkMessage(buf[:n])
+		if err != nil {
+			return nil, err
+		}
+		for _, resp := range resps {
+			if resp.Header.Seq != seq {
+				continue
+			}
+			switch resp.Header.Type {
+			case syscall.NLMSG_DONE:
+				return msgs, nil
+			case syscall.NLMSG_ERROR:
+				if len(resp.Data) < 4 {
+					return nil, syscall.EINVAL
+				}
+				errno := -int32(usermem.ByteOrder.Uint32(resp.Data))
+				if errno == 0 {
+					return msgs, nil
+				}
+				return nil, syscall.Errno(errno)
+			}
+			msgs = append(msgs, inet.NetlinkRouteMessage{
+				Type:  resp.Header.Type,
+				Flags: resp.Header.Flags,
+				Data:  resp.Data,
+			})
+		}
+	}
+}
+
 func readTCPBufferSizeFile(filename string) (inet.TCPBufferSize, error) {
 	contents, err := ioutil.ReadFile(filename)
 	if err != nil {
@@ -0,0 +1,224 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package genetlink provides a NETLINK_GENERIC socket protocol, which carries
+// the messages of the generic netlink families registered with RegisterFamily,
+// and those of the controller family that userspace uses to resolve family
+// names to IDs.
+package genetlink
+
+import (
+	"bytes"
+	"fmt"
+
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/binary"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/socket/netlink"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
+	"gvisor.googlesource.com/gvisor/pkg/syserr"
+)
+
+// Family is a generic netlink family.
+type Family interface {
+	// Name returns the name of the family, by which userspace finds its
+	// ID.
+	Name() string
+
+	// Version returns the version of the family.
+	Version() uint32
+
+	// MaxAttr returns the largest attribute type used by the family.
+	MaxAttr() uint32
+
+	// AdminCommand returns true if command may only be sent by tasks with
+	// CAP_NET_ADMIN, as the operations with GENL_ADMIN_PERM in Linux.
+	AdminCommand(command uint8) bool
+
+	// ProcessMessage processes a single message addressed to the family,
+	// with generic netlink header ghdr followed by data. hdr.Type is the ID
+	// of the family, which replies must use as their type.
+	//
+	// The semantics of ms and the returned error are those of
+	// netlink.Protocol.ProcessMessage.
+	ProcessMessage(ctx context.Context, hdr linux.NetlinkMessageHeader, ghdr linux.GenericNetlinkHeader, data []byte, ms *netlink.MessageSet) *syserr.Error
+}
+
+// ctrlName and ctrlVersion are the name and version of the controller family,
+// whose ID is linux.GENL_ID_CTRL.
+const (
+	ctrlName    = "nlctrl"
+	ctrlVersion = 2
+)
+
+// families holds all registered families. The ID of families[i] is
+// linux.GENL_START_ALLOC + i.
+var families []Family
+
+// RegisterFamily registers a generic netlink family, and allocates its ID.
+//
+// Preconditions: May only be called before any netlink sockets are created.
+func RegisterFamily(f Family) {
+	name := f.Name()
+	if len(name) >= linux.GENL_NAMSIZ {
+		panic(fmt.Sprintf("Generic netlink family name %q too long", name))
+	}
+	if _, g := familyByName(name); g != nil || name == ctrlName {
+		panic(fmt.Sprintf("Generic netlink family %q already registered", name))
+	}
+	families = append(families, f)
+}
+
+// familyByID returns the family with the given ID, or nil if there is none.
+func familyByID(id uint16) Family {
+	if id < linux.GENL_START_ALLOC || int(id-linux.GENL_START_ALLOC) >= len(families) {
+		return nil
+	}
+	return families[id-linux.GENL_START_ALLOC]
+}
+
+// familyByName returns the ID of the family with the given name, and the
+// family, or nil if there is none.
+func familyByName(name string) (uint16, Family) {
+	for i, f := range families {
+		if f.Name() == name {
+			return uint16(linux.GENL_START_ALLOC + i), f
+		}
+	}
+	return 0, nil
+}
+
+// Protocol implements netlink.Protocol.
+type Protocol struct{}
+
+var _ netlink.Protocol = (*Protocol)(nil)
+
+// NewProtocol creates a NETLINK_GENERIC netlink.Protocol.
+func NewProtocol(t *kernel.Task) (netlink.Protocol, *syserr.Error) {
+	return &Protocol{}, nil
+}
+
+// Protocol implements netlink.Protocol.Protocol.
+func (p *Protocol) Protocol() int {
+	return linux.NETLINK_GENERIC
+}
+
+// putFamily adds the CTRL_CMD_NEWFAMILY message describing the family with
+// the given ID, name, version and maximum attribute type to ms.
+func putFamily(ms *netlink.MessageSet, id uint16, name string, version, maxAttr uint32) {
+	m := ms.AddMessage(linux.NetlinkMessageHeader{
+		Type: linux.GENL_ID_CTRL,
+	})
+	m.Put(linux.GenericNetlinkHeader{
+		Command: linux.CTRL_CMD_NEWFAMILY,
+		Version: ctrlVersion,
+	})
+	m.PutAttrString(linux.CTRL_ATTR_FAMILY_NAME, name)
+	m.PutAttr(linux.CTRL_ATTR_FAMILY_ID, id)
+	m.PutAttr(linux.CTRL_ATTR_VERSION, version)
+	// No family has a header beyond the generic netlink header.
+	m.PutAttr(linux.CTRL_ATTR_HDRSIZE, uint32(0))
+	m.PutAttr(linux.CTRL_ATTR_MAXATTR, maxAttr)
+
+	// TODO: Report the operations and multicast groups of
+	// families.
+}
+
+// getFamily handles CTRL_CMD_GETFAMILY requests.
+func (p *Protocol) getFamily(hdr linux.NetlinkMessageHeader, data []byte, ms *netlink.MessageSet) *syserr.Error {
+	if hdr.Flags&linux.NLM_F_DUMP == linux.NLM_F_DUMP {
+		// We always send back an NLMSG_DONE.
+		ms.Multi = true
+		putFamily(ms, linux.GENL_ID_CTRL, ctrlName, ctrlVersion, linux.CTRL_ATTR_MCAST_GROUPS)
+		for i, f := range families {
+			putFamily(ms, uint16(linux.GENL_START_ALLOC+i), f.Name(), f.Version(), f.MaxAttr())
+		}
+		return nil
+	}
+
+	// Families are looked up by ID or, failing that, by name. See
+	// net/netlink/genetlink.c:ctrl_getfamily.
+	attrs := netlink.ParseAttrs(data)
+	if a, ok := attrs[linux.CTRL_ATTR_FAMILY_ID]; ok {
+		if len(a) < 2 {
+			return syserr.ErrInvalidArgument
+		}
+		id := usermem.ByteOrder.Uint16(a)
+		if id == linux.GENL_ID_CTRL {
+			putFamily(ms, id, ctrlName, ctrlVersion, linux.CTRL_ATTR_MCAST_GROUPS)
+			return nil
+		}
+		f := familyByID(id)
+		if f == nil {
+			return syserr.ErrNoFileOrDir
+		}
+		putFamily(ms, id, f.Name(), f.Version(), f.MaxAttr())
+		return nil
+	}
+	if a, ok := attrs[linux.CTRL_ATTR_FAMILY_NAME]; ok {
+		// The name is NUL-terminated.
+		if i := bytes.IndexByte(a, 0); i >= 0 {
+			a = a[:i]
+		}
+		name := string(a)
+		if name == ctrlName {
+			putFamily(ms, linux.GENL_ID_CTRL, ctrlName, ctrlVersion, linux.CTRL_ATTR_MCAST_GROUPS)
+			return nil
+		}
+		id, f := familyByName(name)
+		if f == nil {
+			return syserr.ErrNoFileOrDir
+		}
+		putFamily(ms, id, name, f.Version(), f.MaxAttr())
+		return nil
+	}
+	return syserr.ErrInvalidArgument
+}
+
+// ProcessMessage implements netlink.Protocol.ProcessMessage.
+func (p *Protocol) ProcessMessage(ctx context.Context, hdr linux.NetlinkMessageHeader, data []byte, ms *netlink.MessageSet) *syserr.Error {
+	// All messages start with a generic netlink header.
+	if len(data) < linux.GenericNetlinkHeaderSize {
+		return syserr.ErrInvalidArgument
+	}
+	var ghdr linux.GenericNetlinkHeader
+	binary.Unmarshal(data[:linux.GenericNetlinkHeaderSize], usermem.ByteOrder, &ghdr)
+	data = data[linux.GenericNetlinkHeaderSize:]
+
+	if hdr.Type == linux.GENL_ID_CTRL {
+		switch ghdr.Command {
+		case linux.CTRL_CMD_GETFAMILY:
+			return p.getFamily(hdr, data, ms)
+		default:
+			return syserr.ErrNotSupported
+		}
+	}
+
+	f := familyByID(hdr.Type)
+	if f == nil {
+		return syserr.ErrNoFileOrDir
+	}
+	// See net/netlink/genetlink.c:genl_family_rcv_msg.
+	if f.AdminCommand(ghdr.Command) && !auth.CredentialsFromContext(ctx).HasCapability(linux.CAP_NET_ADMIN) {
+		return syserr.ErrNotPermitted
+	}
+	return f.ProcessMessage(ctx, hdr, ghdr, data, ms)
+}
+
+// init registers the NETLINK_GENERIC provider.
+func init() {
+	netlink.RegisterProvider(linux.NETLINK_GENERIC, NewProtocol)
+}
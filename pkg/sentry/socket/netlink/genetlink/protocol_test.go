@@ -0,0 +1,196 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package genetlink
+
+import (
+	"testing"
+
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/binary"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/context/contexttest"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/socket/netlink"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
+	"gvisor.googlesource.com/gvisor/pkg/syserr"
+)
+
+// testFamily is a Family that records the messages addressed to it.
+type testFamily struct {
+	ghdr linux.GenericNetlinkHeader
+	data []byte
+}
+
+func (*testFamily) Name() string    { return "test" }
+func (*testFamily) Version() uint32 { return 3 }
+func (*testFamily) MaxAttr() uint32 { return 5 }
+
+// testAdminCommand is the command of testFamily that requires CAP_NET_ADMIN.
+const testAdminCommand = 9
+
+func (*testFamily) AdminCommand(command uint8) bool { return command == testAdminCommand }
+
+func (f *testFamily) ProcessMessage(ctx context.Context, hdr linux.NetlinkMessageHeader, ghdr linux.GenericNetlinkHeader, data []byte, ms *netlink.MessageSet) *syserr.Error {
+	f.ghdr = ghdr
+	f.data = data
+	return nil
+}
+
+// withFamilies runs fn with fs as the registered families.
+func withFamilies(fs []Family, fn func()) {
+	old := families
+	families = fs
+	defer func() { families = old }()
+	fn()
+}
+
+// request returns the payload of a message with generic netlink header ghdr
+// and the attributes added by put.
+func request(ghdr linux.GenericNetlinkHeader, put func(m *netlink.Message)) []byte {
+	m := netlink.NewMessage(linux.NetlinkMessageHeader{})
+	m.Put(ghdr)
+	put(m)
+	return m.Finalize()[linux.NetlinkMessageHeaderSize:]
+}
+
+// reply parses the single message in ms.
+func reply(t *testing.T, ms *netlink.MessageSet) (linux.NetlinkMessageHeader, linux.GenericNetlinkHeader, map[uint16][]byte) {
+	if len(ms.Messages) != 1 {
+		t.Fatalf("got %d messages, want 1", len(ms.Messages))
+	}
+	b := ms.Messages[0].Finalize()
+	var hdr linux.NetlinkMessageHeader
+	binary.Unmarshal(b[:linux.NetlinkMessageHeaderSize], usermem.ByteOrder, &hdr)
+	b = b[linux.NetlinkMessageHeaderSize:hdr.Length]
+	var ghdr linux.GenericNetlinkHeader
+	binary.Unmarshal(b[:linux.GenericNetlinkHeaderSize], usermem.ByteOrder, &ghdr)
+	return hdr, ghdr, netlink.ParseAttrs(b[linux.GenericNetlinkHeaderSize:])
+}
+
+func TestGetFamily(t *testing.T) {
+	withFamilies([]Family{&testFamily{}}, func() {
+		for _, tc := range []struct {
+			name string
+			put  func(m *netlink.Message)
+		}{
+			{
+				name: "by name",
+				put: func(m *netlink.Message) {
+					m.PutAttrString(linux.CTRL_ATTR_FAMILY_NAME, "test")
+				},
+			},
+			{
+				name: "by ID",
+				put: func(m *netlink.Message) {
+					m.PutAttr(linux.CTRL_ATTR_FAMILY_ID, uint16(linux.GENL_START_ALLOC))
+				},
+			},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				p := &Protocol{}
+				ms := netlink.NewMessageSet(1, 2)
+				data := request(linux.GenericNetlinkHeader{Command: linux.CTRL_CMD_GETFAMILY}, tc.put)
+				if err := p.ProcessMessage(context.Background(), linux.NetlinkMessageHeader{Type: linux.GENL_ID_CTRL}, data, ms); err != nil {
+					t.Fatalf("ProcessMessage got err %v, want nil", err)
+				}
+				hdr, ghdr, attrs := reply(t, ms)
+				if hdr.Type != linux.GENL_ID_CTRL || ghdr.Command != linux.CTRL_CMD_NEWFAMILY {
+					t.Errorf("got type %d command %d, want %d %d", hdr.Type, ghdr.Command, linux.GENL_ID_CTRL, linux.CTRL_CMD_NEWFAMILY)
+				}
+				if id := usermem.ByteOrder.Uint16(attrs[linux.CTRL_ATTR_FAMILY_ID]); id != linux.GENL_START_ALLOC {
+					t.Errorf("got family ID %d, want %d", id, linux.GENL_START_ALLOC)
+				}
+				if name := string(attrs[linux.CTRL_ATTR_FAMILY_NAME]); name != "test\x00" {
+					t.Errorf("got family name %q, want %q", name, "test\x00")
+				}
+				if v := usermem.ByteOrder.Uint32(attrs[linux.CTRL_ATTR_VERSION]); v != 3 {
+					t.Errorf("got version %d, want 3", v)
+				}
+				if v := usermem.ByteOrder.Uint32(attrs[linux.CTRL_ATTR_MAXATTR]); v != 5 {
+					t.Errorf("got max attribute %d, want 5", v)
+				}
+			})
+		}
+	})
+}
+
+func TestGetFamilyUnknown(t *testing.T) {
+	withFamilies(nil, func() {
+		p := &Protocol{}
+		ms := netlink.NewMessageSet(1, 2)
+		data := request(linux.GenericNetlinkHeader{Command: linux.CTRL_CMD_GETFAMILY}, func(m *netlink.Message) {
+			m.PutAttrString(linux.CTRL_ATTR_FAMILY_NAME, "test")
+		})
+		if err := p.ProcessMessage(context.Background(), linux.NetlinkMessageHeader{Type: linux.GENL_ID_CTRL}, data, ms); err != syserr.ErrNoFileOrDir {
+			t.Errorf("ProcessMessage got err %v, want %v", err, syserr.ErrNoFileOrDir)
+		}
+	})
+}
+
+func TestFamilyMessage(t *testing.T) {
+	f := &testFamily{}
+	withFamilies([]Family{f}, func() {
+		p := &Protocol{}
+		ms := netlink.NewMessageSet(1, 2)
+		data := request(linux.GenericNetlinkHeader{Command: 7, Version: 1}, func(m *netlink.Message) {
+			m.PutAttr(1, uint32(42))
+		})
+		if err := p.ProcessMessage(context.Background(), linux.NetlinkMessageHeader{Type: linux.GENL_START_ALLOC}, data, ms); err != nil {
+			t.Fatalf("ProcessMessage got err %v, want nil", err)
+		}
+		if f.ghdr.Command != 7 || f.ghdr.Version != 1 {
+			t.Errorf("got header %+v, want command 7 version 1", f.ghdr)
+		}
+		if a := netlink.ParseAttrs(f.data)[1]; len(a) != 4 || usermem.ByteOrder.Uint32(a) != 42 {
+			t.Errorf("got attribute %v, want 42", a)
+		}
+
+		// Messages must include a generic netlink header, and be
+		// addressed to a registered family.
+		if err := p.ProcessMessage(context.Background(), linux.NetlinkMessageHeader{Type: linux.GENL_START_ALLOC}, data[:2], ms); err != syserr.ErrInvalidArgument {
+			t.Errorf("ProcessMessage of short message got err %v, want %v", err, syserr.ErrInvalidArgument)
+		}
+		if err := p.ProcessMessage(context.Background(), linux.NetlinkMessageHeader{Type: linux.GENL_START_ALLOC + 1}, data, ms); err != syserr.ErrNoFileOrDir {
+			t.Errorf("ProcessMessage to unknown family got err %v, want %v", err, syserr.ErrNoFileOrDir)
+		}
+	})
+}
+
+func TestFamilyAdminCommand(t *testing.T) {
+	f := &testFamily{}
+	withFamilies([]Family{f}, func() {
+		p := &Protocol{}
+		hdr := linux.NetlinkMessageHeader{Type: linux.GENL_START_ALLOC}
+		data := request(linux.GenericNetlinkHeader{Command: testAdminCommand}, func(*netlink.Message) {})
+
+		// Without CAP_NET_ADMIN, the message doesn't reach the family.
+		user := auth.NewUserCredentials(1000, 1000, nil, &auth.TaskCapabilities{}, auth.NewRootUserNamespace())
+		ms := netlink.NewMessageSet(1, 2)
+		if err := p.ProcessMessage(contexttest.WithCreds(context.Background(), user), hdr, data, ms); err != syserr.ErrNotPermitted {
+			t.Errorf("unprivileged ProcessMessage got err %v, want %v", err, syserr.ErrNotPermitted)
+		}
+		if f.ghdr.Command != 0 {
+			t.Errorf("unprivileged message was processed with header %+v", f.ghdr)
+		}
+
+		root := auth.NewRootCredentials(auth.NewRootUserNamespace())
+		if err := p.ProcessMessage(contexttest.WithCreds(context.Background(), root), hdr, data, ms); err != nil {
+			t.Errorf("privileged ProcessMessage got err %v, want nil", err)
+		}
+		if f.ghdr.Command != testAdminCommand {
+			t.Errorf("privileged message got header %+v, want command %d", f.ghdr, testAdminCommand)
+		}
+	})
+}
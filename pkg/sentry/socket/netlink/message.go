@@ -110,6 +110,49 @@ func (m *Message) PutAttrString(atype uint16, s string) {
 	m.putZeros(aligned - l)
 }
 
+// PutNestedAttr adds a netlink attribute containing the attributes added by
+// put to the message.
+//
+// Preconditions: The serialized attribute fits in math.MaxUint16 bytes.
+func (m *Message) PutNestedAttr(atype uint16, put func(m *Message)) {
+	start := len(m.buf)
+	m.Put(linux.NetlinkAttrHeader{
+		Type: atype,
+	})
+	put(m)
+
+	l := len(m.buf) - start
+	if l > math.MaxUint16 {
+		panic(fmt.Sprintf("attribute too large: %d", l))
+	}
+	// Update the length, which is the first 2 bytes of the header.
+	usermem.ByteOrder.PutUint16(m.buf[start:], uint16(l))
+}
+
+// ParseAttrs parses the netlink attributes in b, and returns their payloads by
+// type. Parsing stops at the first malformed attribute. If an attribute type
+// occurs several times, the last one is returned.
+func ParseAttrs(b []byte) map[uint16][]byte {
+	attrs := make(map[uint16][]byte)
+	for len(b) >= linux.NetlinkAttrHeaderSize {
+		var hdr linux.NetlinkAttrHeader
+		binary.Unmarshal(b[:linux.NetlinkAttrHeaderSize], usermem.ByteOrder, &hdr)
+		l := int(hdr.Length)
+		if l < linux.NetlinkAttrHeaderSize || l > len(b) {
+			break
+		}
+		attrs[hdr.Type] = b[linux.NetlinkAttrHeaderSize:l]
+
+		// Advance to the next attribute.
+		next := alignUp(l, linux.NLA_ALIGNTO)
+		if next > len(b) {
+			break
+		}
+		b = b[next:]
+	}
+	return attrs
+}
+
 // MessageSet contains a series of netlink messages.
 type MessageSet struct {
 	// Multi indicates that this a multi-part message, to be terminated by
@@ -39,6 +39,17 @@ type Protocol interface {
 	ProcessMessage(ctx context.Context, hdr linux.NetlinkMessageHeader, data []byte, ms *MessageSet) *syserr.Error
 }
 
+// MulticastProtocol is a Protocol whose sockets may join multicast groups, to
+// receive the messages that the kernel sends to them with Socket.Multicast.
+type MulticastProtocol interface {
+	Protocol
+
+	// SetGroups is called with the mask of the multicast groups that s
+	// joins when it is bound, replacing those it joined before, and with 0
+	// when it is released.
+	SetGroups(s *Socket, groups uint32) *syserr.Error
+}
+
 // Provider is a function that creates a new Protocol for a specific netlink
 // protocol.
 //
@@ -145,6 +145,43 @@ func (p *Protocol) dumpAddrs(ctx context.Context, hdr linux.NetlinkMessageHeader
 	return nil
 }
 
+// passthroughTypes are the read-only message types that are forwarded to the
+// host if the network stack supports it. See inet.NetlinkRouteDumper.
+var passthroughTypes = map[uint16]struct{}{
+	linux.RTM_GETNEIGH: {},
+	linux.RTM_GETROUTE: {},
+	linux.RTM_GETRULE:  {},
+}
+
+// dumpPassthrough handles dump requests of passthroughTypes.
+func (p *Protocol) dumpPassthrough(ctx context.Context, hdr linux.NetlinkMessageHeader, data []byte, ms *netlink.MessageSet) *syserr.Error {
+	stack := inet.StackFromContext(ctx)
+	if stack == nil {
+		return syserr.ErrNotSupported
+	}
+	d, ok := stack.(inet.NetlinkRouteDumper)
+	if !ok {
+		return syserr.ErrNotSupported
+	}
+
+	msgs, err := d.DumpNetlinkRoute(hdr.Type, data)
+	if err != nil {
+		return syserr.FromError(err)
+	}
+
+	// We always send back an NLMSG_DONE.
+	ms.Multi = true
+	for _, msg := range msgs {
+		m := ms.AddMessage(linux.NetlinkMessageHeader{
+			Type:  msg.Type,
+			Flags: msg.Flags &^ linux.NLM_F_MULTI,
+		})
+		m.Put(msg.Data)
+	}
+
+	return nil
+}
+
 // ProcessMessage implements netlink.Protocol.ProcessMessage.
 func (p *Protocol) ProcessMessage(ctx context.Context, hdr linux.NetlinkMessageHeader, data []byte, ms *netlink.MessageSet) *syserr.Error {
 	// All messages start with a 1 byte protocol family.
@@ -162,10 +199,17 @@ func (p *Protocol) ProcessMessage(ctx context.Context, hdr linux.NetlinkMessageH
 		}
 	}
 
-	// TODO: Only the dump variant of the types below are
+	// TODO: Only the dump variant of the GET types below are
 	// supported.
 	if hdr.Flags&linux.NLM_F_DUMP != linux.NLM_F_DUMP {
-		return syserr.ErrNotSupported
+		switch hdr.Type {
+		case linux.RTM_NEWQDISC:
+			return p.newQdisc(ctx, hdr, data)
+		case linux.RTM_DELQDISC:
+			return p.delQdisc(ctx, hdr, data)
+		default:
+			return syserr.ErrNotSupported
+		}
 	}
 
 	switch hdr.Type {
@@ -173,7 +217,12 @@ func (p *Protocol) ProcessMessage(ctx context.Context, hdr linux.NetlinkMessageH
 		return p.dumpLinks(ctx, hdr, data, ms)
 	case linux.RTM_GETADDR:
 		return p.dumpAddrs(ctx, hdr, data, ms)
+	case linux.RTM_GETQDISC:
+		return p.dumpQdiscs(ctx, hdr, data, ms)
 	default:
+		if _, ok := passthroughTypes[hdr.Type]; ok {
+			return p.dumpPassthrough(ctx, hdr, data, ms)
+		}
 		return syserr.ErrNotSupported
 	}
 }
@@ -0,0 +1,371 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package route
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/binary"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/inet"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/socket/netlink"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
+	"gvisor.googlesource.com/gvisor/pkg/syserr"
+)
+
+// The queueing discipline of an interface is a tbf qdisc at the root, which
+// limits the rate, with an optional fq_codel child, which queues packets per
+// flow. Shaping is disabled if there is no tbf qdisc, which is reported as a
+// noqueue qdisc.
+//
+// The handles of the tbf and fq_codel qdiscs in dumps are fixed, and the
+// parent of a new fq_codel qdisc is assumed to be the tbf qdisc.
+const (
+	tbfHandle     = 0x10000
+	fqCodelHandle = 0x20000
+)
+
+// Defaults of fq_codel qdiscs, from net/sched/sch_fq_codel.c.
+const (
+	fqCodelDefaultLimit  = 10240
+	fqCodelDefaultFlows  = 1024
+	fqCodelDefaultTarget = 5 * time.Millisecond
+	fqCodelMaxFlows      = 65536
+
+	// fqCodelInterval is only reported, since packets are dropped as soon
+	// as their queueing delay exceeds the target.
+	fqCodelInterval = 100 * time.Millisecond
+)
+
+// nsPerTick is the duration of a packet scheduler tick, as advertised in
+// /proc/net/psched.
+const nsPerTick = 64
+
+// trafficShaper returns the network stack of ctx as an inet.TrafficShaper.
+func trafficShaper(ctx context.Context) (inet.Stack, inet.TrafficShaper, *syserr.Error) {
+	stack := inet.StackFromContext(ctx)
+	if stack == nil {
+		return nil, nil, syserr.ErrNotSupported
+	}
+	ts, ok := stack.(inet.TrafficShaper)
+	if !ok {
+		return nil, nil, syserr.ErrNotSupported
+	}
+	return stack, ts, nil
+}
+
+// hasFQCodel returns true if q has an fq_codel qdisc.
+func hasFQCodel(q inet.QueueingDiscipline) bool {
+	return q.Flows > 1 || q.Target != 0
+}
+
+// parseTrafficControlMessage parses the tcmsg at the beginning of data, and
+// the attributes that follow it.
+func parseTrafficControlMessage(data []byte) (linux.TrafficControlMessage, map[uint16][]byte, *syserr.Error) {
+	var tcm linux.TrafficControlMessage
+	if len(data) < linux.TrafficControlMessageSize {
+		return tcm, nil, syserr.ErrInvalidArgument
+	}
+	binary.Unmarshal(data[:linux.TrafficControlMessageSize], usermem.ByteOrder, &tcm)
+	return tcm, netlink.ParseAttrs(data[linux.TrafficControlMessageSize:]), nil
+}
+
+// attrUint32 returns the value of the 32-bit attribute a, if it is present.
+func attrUint32(a []byte) (uint32, bool) {
+	if len(a) < 4 {
+		return 0, false
+	}
+	return usermem.ByteOrder.Uint32(a), true
+}
+
+// newQdisc handles RTM_NEWQDISC requests.
+func (p *Protocol) newQdisc(ctx context.Context, hdr linux.NetlinkMessageHeader, data []byte) *syserr.Error {
+	tcm, attrs, err := parseTrafficControlMessage(data)
+	if err != nil {
+		return err
+	}
+	_, ts, err := trafficShaper(ctx)
+	if err != nil {
+		return err
+	}
+	q, ok := ts.QueueingDiscipline(tcm.Index)
+	if !ok {
+		return syserr.ErrNoDevice
+	}
+
+	create := hdr.Flags&linux.NLM_F_CREATE == linux.NLM_F_CREATE
+	excl := hdr.Flags&linux.NLM_F_EXCL == linux.NLM_F_EXCL
+	kind := strings.TrimRight(string(attrs[linux.TCA_KIND]), "\x00")
+	opts := netlink.ParseAttrs(attrs[linux.TCA_OPTIONS])
+	root := tcm.Parent == linux.TC_H_ROOT
+	switch {
+	case kind == "tbf" && root:
+		if q.Rate != 0 && excl {
+			return syserr.ErrExists
+		}
+		if q.Rate == 0 && !create {
+			return syserr.ErrNoFileOrDir
+		}
+		rate, burst, err := parseTBFOptions(opts)
+		if err != nil {
+			return err
+		}
+		if q.Rate == 0 {
+			// New qdiscs start without a child.
+			q = inet.QueueingDiscipline{}
+		}
+		q.Rate = rate
+		q.Burst = burst
+
+	case kind == "fq_codel" && !root:
+		if q.Rate == 0 {
+			// There is no tbf qdisc to be the parent.
+			return syserr.ErrNoFileOrDir
+		}
+		if hasFQCodel(q) && excl {
+			return syserr.ErrExists
+		}
+		if !hasFQCodel(q) {
+			if !create {
+				return syserr.ErrNoFileOrDir
+			}
+			q.Limit = fqCodelDefaultLimit
+			q.Flows = fqCodelDefaultFlows
+			q.Quantum = 0
+			q.Target = fqCodelDefaultTarget
+		}
+		if err := parseFQCodelOptions(opts, &q); err != nil {
+			return err
+		}
+
+	default:
+		// In particular, fq_codel can't be the root qdisc, since
+		// interfaces don't queue packets themselves, so it would
+		// never have packets to reorder.
+		return syserr.ErrNotSupported
+	}
+	return syserr.FromError(ts.SetQueueingDiscipline(tcm.Index, q))
+}
+
+// parseTBFOptions returns the rate and burst in the options of a tbf qdisc.
+func parseTBFOptions(opts map[uint16][]byte) (uint64, uint32, *syserr.Error) {
+	var parms linux.TBFQueueOptions
+	b := opts[linux.TCA_TBF_PARMS]
+	size := int(binary.Size(parms))
+	if len(b) < size {
+		return 0, 0, syserr.ErrInvalidArgument
+	}
+	binary.Unmarshal(b[:size], usermem.ByteOrder, &parms)
+
+	rate := uint64(parms.Rate.Rate)
+	if b := opts[linux.TCA_TBF_RATE64]; len(b) >= 8 {
+		rate = usermem.ByteOrder.Uint64(b)
+	}
+	if rate == 0 {
+		return 0, 0, syserr.ErrInvalidArgument
+	}
+
+	// Recent versions of tc pass the burst in bytes. Otherwise, it is
+	// the time that it takes to send it at the rate, in ticks.
+	burst, ok := attrUint32(opts[linux.TCA_TBF_BURST])
+	if !ok {
+		b := float64(parms.Buffer) * nsPerTick * float64(rate) / float64(time.Second)
+		if b > math.MaxUint32 {
+			b = math.MaxUint32
+		}
+		burst = uint32(b)
+	}
+	if burst == 0 {
+		return 0, 0, syserr.ErrInvalidArgument
+	}
+
+	// The limit, in bytes, is ignored. The number of queued packets is
+	// limited by the fq_codel qdisc instead.
+	return rate, burst, nil
+}
+
+// parseFQCodelOptions applies the options of an fq_codel qdisc to q.
+func parseFQCodelOptions(opts map[uint16][]byte, q *inet.QueueingDiscipline) *syserr.Error {
+	if v, ok := attrUint32(opts[linux.TCA_FQ_CODEL_LIMIT]); ok {
+		if v == 0 {
+			return syserr.ErrInvalidArgument
+		}
+		q.Limit = v
+	}
+	if v, ok := attrUint32(opts[linux.TCA_FQ_CODEL_FLOWS]); ok {
+		if v == 0 || v > fqCodelMaxFlows {
+			return syserr.ErrInvalidArgument
+		}
+		q.Flows = v
+	}
+	if v, ok := attrUint32(opts[linux.TCA_FQ_CODEL_QUANTUM]); ok {
+		q.Quantum = v
+	}
+	if v, ok := attrUint32(opts[linux.TCA_FQ_CODEL_TARGET]); ok {
+		q.Target = time.Duration(v) * time.Microsecond
+	}
+	// The interval and ECN aren't supported, and are ignored.
+	return nil
+}
+
+// delQdisc handles RTM_DELQDISC requests.
+func (p *Protocol) delQdisc(ctx context.Context, hdr linux.NetlinkMessageHeader, data []byte) *syserr.Error {
+	tcm, _, err := parseTrafficControlMessage(data)
+	if err != nil {
+		return err
+	}
+	_, ts, err := trafficShaper(ctx)
+	if err != nil {
+		return err
+	}
+	q, ok := ts.QueueingDiscipline(tcm.Index)
+	if !ok {
+		return syserr.ErrNoDevice
+	}
+
+	if tcm.Parent == linux.TC_H_ROOT {
+		if q.Rate == 0 {
+			return syserr.ErrNoFileOrDir
+		}
+		// Deleting the root qdisc also deletes its child.
+		q = inet.QueueingDiscipline{}
+	} else {
+		if !hasFQCodel(q) {
+			return syserr.ErrNoFileOrDir
+		}
+		q.Limit = 0
+		q.Flows = 0
+		q.Quantum = 0
+		q.Target = 0
+	}
+	return syserr.FromError(ts.SetQueueingDiscipline(tcm.Index, q))
+}
+
+// dumpQdiscs handles RTM_GETQDISC + NLM_F_DUMP requests.
+func (p *Protocol) dumpQdiscs(ctx context.Context, hdr linux.NetlinkMessageHeader, data []byte, ms *netlink.MessageSet) *syserr.Error {
+	// The request may contain a tcmsg, whose index selects a single
+	// interface.
+	var index int32
+	if tcm, _, err := parseTrafficControlMessage(data); err == nil {
+		index = tcm.Index
+	}
+
+	// We always send back an NLMSG_DONE.
+	ms.Multi = true
+
+	stack, ts, err := trafficShaper(ctx)
+	if err != nil {
+		// No interfaces can be shaped.
+		return nil
+	}
+
+	var ids []int
+	for id := range stack.Interfaces() {
+		if index == 0 || id == index {
+			ids = append(ids, int(id))
+		}
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		q, ok := ts.QueueingDiscipline(int32(id))
+		if !ok {
+			continue
+		}
+		if q.Rate == 0 {
+			m := ms.AddMessage(linux.NetlinkMessageHeader{
+				Type: linux.RTM_NEWQDISC,
+			})
+			m.Put(linux.TrafficControlMessage{
+				Family: linux.AF_UNSPEC,
+				Index:  int32(id),
+				Parent: linux.TC_H_ROOT,
+				Info:   1,
+			})
+			m.PutAttrString(linux.TCA_KIND, "noqueue")
+			continue
+		}
+		putTBF(ms, int32(id), q)
+		if hasFQCodel(q) {
+			putFQCodel(ms, int32(id), q)
+		}
+	}
+	return nil
+}
+
+// putTBF adds the tbf qdisc of the interface with the given index to ms.
+func putTBF(ms *netlink.MessageSet, id int32, q inet.QueueingDiscipline) {
+	m := ms.AddMessage(linux.NetlinkMessageHeader{
+		Type: linux.RTM_NEWQDISC,
+	})
+	m.Put(linux.TrafficControlMessage{
+		Family: linux.AF_UNSPEC,
+		Index:  id,
+		Handle: tbfHandle,
+		Parent: linux.TC_H_ROOT,
+		Info:   1,
+	})
+	m.PutAttrString(linux.TCA_KIND, "tbf")
+
+	rate := uint32(math.MaxUint32)
+	if q.Rate < math.MaxUint32 {
+		rate = uint32(q.Rate)
+	}
+	buffer := float64(q.Burst) * float64(time.Second) / float64(q.Rate) / nsPerTick
+	if buffer > math.MaxUint32 {
+		buffer = math.MaxUint32
+	}
+	m.PutNestedAttr(linux.TCA_OPTIONS, func(m *netlink.Message) {
+		m.PutAttr(linux.TCA_TBF_PARMS, linux.TBFQueueOptions{
+			Rate: linux.TrafficControlRateSpec{
+				Rate: rate,
+			},
+			// The queue is limited in packets, which are at
+			// most a quantum each.
+			Limit:  q.Limit * q.Quantum,
+			Buffer: uint32(buffer),
+		})
+		if q.Rate >= math.MaxUint32 {
+			m.PutAttr(linux.TCA_TBF_RATE64, q.Rate)
+		}
+	})
+}
+
+// putFQCodel adds the fq_codel qdisc of the interface with the given index to
+// ms.
+func putFQCodel(ms *netlink.MessageSet, id int32, q inet.QueueingDiscipline) {
+	m := ms.AddMessage(linux.NetlinkMessageHeader{
+		Type: linux.RTM_NEWQDISC,
+	})
+	m.Put(linux.TrafficControlMessage{
+		Family: linux.AF_UNSPEC,
+		Index:  id,
+		Handle: fqCodelHandle,
+		Parent: tbfHandle,
+		Info:   1,
+	})
+	m.PutAttrString(linux.TCA_KIND, "fq_codel")
+	m.PutNestedAttr(linux.TCA_OPTIONS, func(m *netlink.Message) {
+		m.PutAttr(linux.TCA_FQ_CODEL_TARGET, uint32(q.Target/time.Microsecond))
+		m.PutAttr(linux.TCA_FQ_CODEL_LIMIT, q.Limit)
+		m.PutAttr(linux.TCA_FQ_CODEL_INTERVAL, uint32(fqCodelInterval/time.Microsecond))
+		m.PutAttr(linux.TCA_FQ_CODEL_ECN, uint32(0))
+		m.PutAttr(linux.TCA_FQ_CODEL_FLOWS, q.Flows)
+		m.PutAttr(linux.TCA_FQ_CODEL_QUANTUM, q.Quantum)
+	})
+}
@@ -29,6 +29,7 @@ import (
 	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel/kdefs"
 	ktime "gvisor.googlesource.com/gvisor/pkg/sentry/kernel/time"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/socket"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/socket/control"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/socket/netlink/port"
 	sunix "gvisor.googlesource.com/gvisor/pkg/sentry/socket/unix"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
@@ -48,7 +49,8 @@ var netlinkSocketDevice = device.NewAnonDevice()
 // Socket is the base socket type for netlink sockets.
 //
 // This implementation only supports userspace sending and receiving messages
-// to/from the kernel.
+// to/from the kernel, and receiving messages sent by the kernel to multicast
+// groups of MulticastProtocols.
 //
 // Socket implements socket.Socket.
 type Socket struct {
@@ -82,6 +84,12 @@ type Socket struct {
 	// portID is the port ID allocated for this socket.
 	portID int32
 
+	// groups is the mask of the multicast groups joined by this socket.
+	groups uint32
+
+	// passcred indicates that SO_PASSCRED is set.
+	passcred bool
+
 	// sendBufferSize is the send buffer "size". We don't actually have a
 	// fixed buffer but only consume this many bytes.
 	sendBufferSize uint64
@@ -119,6 +127,10 @@ func NewSocket(t *kernel.Task, protocol Protocol) (*Socket, *syserr.Error) {
 
 // Release implements fs.FileOperations.Release.
 func (s *Socket) Release() {
+	if s.groups != 0 {
+		s.protocol.(MulticastProtocol).SetGroups(s, 0)
+	}
+
 	s.connection.Release()
 	s.ep.Close()
 
@@ -209,15 +221,25 @@ func (s *Socket) Bind(t *kernel.Task, sockaddr []byte) *syserr.Error {
 		return err
 	}
 
-	// No support for multicast groups yet.
-	if a.Groups != 0 {
+	// Only multicast protocols support multicast groups.
+	mp, multicast := s.protocol.(MulticastProtocol)
+	if a.Groups != 0 && !multicast {
 		return syserr.ErrPermissionDenied
 	}
 
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	return s.bindPort(t, int32(a.PortID))
+	if err := s.bindPort(t, int32(a.PortID)); err != nil {
+		return err
+	}
+	if multicast && a.Groups != s.groups {
+		if err := mp.SetGroups(s, a.Groups); err != nil {
+			return err
+		}
+		s.groups = a.Groups
+	}
+	return nil
 }
 
 // Connect implements socket.Socket.Connect.
@@ -271,14 +293,46 @@ func (s *Socket) Shutdown(t *kernel.Task, how int) *syserr.Error {
 
 // GetSockOpt implements socket.Socket.GetSockOpt.
 func (s *Socket) GetSockOpt(t *kernel.Task, level int, name int, outLen int) (interface{}, *syserr.Error) {
-	// TODO: no sockopts supported.
-	return nil, syserr.ErrProtocolNotAvailable
+	// TODO: only SO_PASSCRED is supported.
+	if level != linux.SOL_SOCKET || name != linux.SO_PASSCRED {
+		return nil, syserr.ErrProtocolNotAvailable
+	}
+	if outLen < 4 {
+		return nil, syserr.ErrInvalidArgument
+	}
+	var v int32
+	if s.Passcred() {
+		v = 1
+	}
+	return v, nil
 }
 
 // SetSockOpt implements socket.Socket.SetSockOpt.
 func (s *Socket) SetSockOpt(t *kernel.Task, level int, name int, opt []byte) *syserr.Error {
-	// TODO: no sockopts supported.
-	return syserr.ErrProtocolNotAvailable
+	// TODO: only SO_PASSCRED is supported.
+	if level != linux.SOL_SOCKET || name != linux.SO_PASSCRED {
+		return syserr.ErrProtocolNotAvailable
+	}
+	if len(opt) < 4 {
+		return syserr.ErrInvalidArgument
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.passcred = usermem.ByteOrder.Uint32(opt) != 0
+	return nil
+}
+
+// Passcred implements unix.Credentialer.Passcred.
+func (s *Socket) Passcred() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.passcred
+}
+
+// ConnectedPasscred implements unix.Credentialer.ConnectedPasscred.
+func (s *Socket) ConnectedPasscred() bool {
+	// The kernel peer doesn't receive credentials.
+	return false
 }
 
 // GetSockName implements socket.Socket.GetSockName.
@@ -289,6 +343,7 @@ func (s *Socket) GetSockName(t *kernel.Task) (interface{}, uint32, *syserr.Error
 	sa := linux.SockAddrNetlink{
 		Family: linux.AF_NETLINK,
 		PortID: uint32(s.portID),
+		Groups: s.groups,
 	}
 	return sa, uint32(binary.Size(sa)), nil
 }
@@ -306,24 +361,34 @@ func (s *Socket) GetPeerName(t *kernel.Task) (interface{}, uint32, *syserr.Error
 
 // RecvMsg implements socket.Socket.RecvMsg.
 func (s *Socket) RecvMsg(t *kernel.Task, dst usermem.IOSequence, flags int, haveDeadline bool, deadline ktime.Time, senderRequested bool, controlDataLen uint64) (int, interface{}, uint32, socket.ControlMessages, *syserr.Error) {
-	from := linux.SockAddrNetlink{
-		Family: linux.AF_NETLINK,
-		PortID: 0,
-	}
-	fromLen := uint32(binary.Size(from))
-
 	trunc := flags&linux.MSG_TRUNC != 0
 
+	// The address of messages holds the multicast group they were sent
+	// to, if any.
+	var addr tcpip.FullAddress
 	r := sunix.EndpointReader{
 		Endpoint: s.ep,
+		Creds:    s.Passcred(),
 		Peek:     flags&linux.MSG_PEEK != 0,
+		From:     &addr,
+	}
+	from := func() (interface{}, uint32) {
+		sa := linux.SockAddrNetlink{
+			Family: linux.AF_NETLINK,
+			PortID: 0,
+		}
+		if addr.Port != 0 {
+			sa.Groups = 1 << (addr.Port - 1)
+		}
+		return sa, uint32(binary.Size(sa))
 	}
 
 	if n, err := dst.CopyOutFrom(t, &r); err != syserror.ErrWouldBlock || flags&linux.MSG_DONTWAIT != 0 {
 		if trunc {
 			n = int64(r.MsgSize)
 		}
-		return int(n), from, fromLen, socket.ControlMessages{}, syserr.FromError(err)
+		sa, saLen := from()
+		return int(n), sa, saLen, socket.ControlMessages{Unix: r.Control}, syserr.FromError(err)
 	}
 
 	// We'll have to block. Register for notification and keep trying to
@@ -337,7 +402,8 @@ func (s *Socket) RecvMsg(t *kernel.Task, dst usermem.IOSequence, flags int, have
 			if trunc {
 				n = int64(r.MsgSize)
 			}
-			return int(n), from, fromLen, socket.ControlMessages{}, syserr.FromError(err)
+			sa, saLen := from()
+			return int(n), sa, saLen, socket.ControlMessages{Unix: r.Control}, syserr.FromError(err)
 		}
 
 		if err := t.BlockWithDeadline(ch, haveDeadline, deadline); err != nil {
@@ -359,6 +425,18 @@ func (s *Socket) Read(ctx context.Context, _ *fs.File, dst usermem.IOSequence, _
 	})
 }
 
+// Multicast sends buf, a message from the kernel to the multicast group
+// group, to userspace. As in Linux, the message is dropped if the receive
+// buffer is full.
+func (s *Socket) Multicast(buf []byte, group int) {
+	cms := unix.ControlMessages{Credentials: control.KernelCredentials()}
+	// The group is passed to RecvMsg in the port of the address.
+	_, notify, _ := s.connection.Send([][]byte{buf}, cms, tcpip.FullAddress{Port: uint16(group)})
+	if notify {
+		s.connection.SendNotify()
+	}
+}
+
 // sendResponse sends the response messages in ms back to userspace.
 func (s *Socket) sendResponse(ctx context.Context, ms *MessageSet) *syserr.Error {
 	// Linux combines multiple netlink messages into a single datagram.
@@ -440,24 +518,61 @@ func (s *Socket) processMessages(ctx context.Context, buf []byte) *syserr.Error
 			continue
 		}
 
-		// TODO: ACKs not supported yet.
-		if hdr.Flags&linux.NLM_F_ACK == linux.NLM_F_ACK {
-			return syserr.ErrNotSupported
-		}
-
 		ms := NewMessageSet(s.portID, hdr.Seq)
 		if err := s.protocol.ProcessMessage(ctx, hdr, data, ms); err != nil {
-			return err
+			// Like Linux, errors are reported to the sender in an
+			// NLMSG_ERROR message, and not by the send call. See
+			// net/netlink/af_netlink.c:netlink_rcv_skb.
+			if err := s.sendAck(ctx, hdr, data, err); err != nil {
+				return err
+			}
+			continue
 		}
 
 		if err := s.sendResponse(ctx, ms); err != nil {
 			return err
 		}
+
+		// Dumps are terminated by NLMSG_DONE instead of an
+		// acknowledgement.
+		if hdr.Flags&linux.NLM_F_ACK == linux.NLM_F_ACK && !ms.Multi {
+			if err := s.sendAck(ctx, hdr, data, nil); err != nil {
+				return err
+			}
+		}
 	}
 
 	return nil
 }
 
+// sendAck sends an NLMSG_ERROR message in response to the message with header
+// hdr and payload data. It reports err, or acknowledges the message if err is
+// nil.
+func (s *Socket) sendAck(ctx context.Context, hdr linux.NetlinkMessageHeader, data []byte, err *syserr.Error) *syserr.Error {
+	var errno int32
+	if err != nil {
+		errno = -int32(linux.EINVAL.Number())
+		if le := syserr.ToLinux(err); le != nil {
+			errno = -int32(le.Number())
+		}
+	}
+
+	ms := NewMessageSet(s.portID, hdr.Seq)
+	m := ms.AddMessage(linux.NetlinkMessageHeader{
+		Type: linux.NLMSG_ERROR,
+	})
+	m.Put(linux.NetlinkErrorMessage{
+		Error:  errno,
+		Header: hdr,
+	})
+	if err != nil {
+		// Like Linux, the payload of the message is included with
+		// errors, but not with acknowledgements.
+		m.Put(data)
+	}
+	return s.sendResponse(ctx, ms)
+}
+
 // sendMsg is the core of message send, used for SendMsg and Write.
 func (s *Socket) sendMsg(ctx context.Context, src usermem.IOSequence, to []byte, flags int, controlMessages socket.ControlMessages) (int, *syserr.Error) {
 	dstPort := int32(0)
@@ -0,0 +1,218 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package taskstats provides the TASKSTATS generic netlink family, which
+// reports the delay accounting and other statistics of tasks, as used by
+// iotop(8) and getdelays.
+package taskstats
+
+import (
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/socket/netlink"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/socket/netlink/genetlink"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usage"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
+	"gvisor.googlesource.com/gvisor/pkg/syserr"
+)
+
+// Family implements genetlink.Family.
+type Family struct{}
+
+var _ genetlink.Family = (*Family)(nil)
+
+// Name implements genetlink.Family.Name.
+func (*Family) Name() string {
+	return linux.TASKSTATS_GENL_NAME
+}
+
+// Version implements genetlink.Family.Version.
+func (*Family) Version() uint32 {
+	return linux.TASKSTATS_GENL_VERSION
+}
+
+// MaxAttr implements genetlink.Family.MaxAttr.
+func (*Family) MaxAttr() uint32 {
+	return linux.TASKSTATS_CMD_ATTR_MAX
+}
+
+// AdminCommand implements genetlink.Family.AdminCommand.
+//
+// TASKSTATS_CMD_GET reports the statistics of tasks of other users, so it
+// requires CAP_NET_ADMIN. See kernel/taskstats.c:taskstats_ops.
+func (*Family) AdminCommand(command uint8) bool {
+	return command == linux.TASKSTATS_CMD_GET
+}
+
+// ProcessMessage implements genetlink.Family.ProcessMessage.
+func (f *Family) ProcessMessage(ctx context.Context, hdr linux.NetlinkMessageHeader, ghdr linux.GenericNetlinkHeader, data []byte, ms *netlink.MessageSet) *syserr.Error {
+	if ghdr.Command != linux.TASKSTATS_CMD_GET {
+		return syserr.ErrNotSupported
+	}
+	t := kernel.TaskFromContext(ctx)
+	if t == nil {
+		return syserr.ErrInvalidArgument
+	}
+
+	attrs := netlink.ParseAttrs(data)
+	_, register := attrs[linux.TASKSTATS_CMD_ATTR_REGISTER_CPUMASK]
+	_, deregister := attrs[linux.TASKSTATS_CMD_ATTR_DEREGISTER_CPUMASK]
+	if register || deregister {
+		// TODO: Send the statistics of exiting tasks to
+		// listeners registered for the CPUs in the mask.
+		return syserr.ErrNotSupported
+	}
+
+	// Only one of the PID and TGID is used. See
+	// kernel/taskstats.c:taskstats_user_cmd.
+	ns := t.PIDNamespace()
+	if a, ok := attrs[linux.TASKSTATS_CMD_ATTR_PID]; ok {
+		if len(a) < 4 {
+			return syserr.ErrInvalidArgument
+		}
+		tid := kernel.ThreadID(usermem.ByteOrder.Uint32(a))
+		target := ns.TaskWithID(tid)
+		if target == nil {
+			return syserr.ErrNoProcess
+		}
+		stats := taskStats(t, target)
+		putStats(hdr, ms, linux.TASKSTATS_TYPE_AGGR_PID, linux.TASKSTATS_TYPE_PID, tid, stats)
+		return nil
+	}
+	if a, ok := attrs[linux.TASKSTATS_CMD_ATTR_TGID]; ok {
+		if len(a) < 4 {
+			return syserr.ErrInvalidArgument
+		}
+		tgid := kernel.ThreadID(usermem.ByteOrder.Uint32(a))
+		tg := ns.ThreadGroupWithID(tgid)
+		if tg == nil {
+			return syserr.ErrNoProcess
+		}
+		stats, ok := threadGroupStats(t, tg)
+		if !ok {
+			return syserr.ErrNoProcess
+		}
+		putStats(hdr, ms, linux.TASKSTATS_TYPE_AGGR_TGID, linux.TASKSTATS_TYPE_TGID, tgid, stats)
+		return nil
+	}
+	return syserr.ErrInvalidArgument
+}
+
+// putStats adds the TASKSTATS_CMD_NEW reply carrying the statistics of the
+// task or thread group with the given ID to ms.
+func putStats(hdr linux.NetlinkMessageHeader, ms *netlink.MessageSet, aggrType, idType uint16, id kernel.ThreadID, stats linux.Taskstats) {
+	m := ms.AddMessage(linux.NetlinkMessageHeader{
+		Type: hdr.Type,
+	})
+	m.Put(linux.GenericNetlinkHeader{
+		Command: linux.TASKSTATS_CMD_NEW,
+		Version: linux.TASKSTATS_GENL_VERSION,
+	})
+	m.PutNestedAttr(aggrType, func(m *netlink.Message) {
+		m.PutAttr(idType, uint32(id))
+		m.PutAttr(linux.TASKSTATS_TYPE_STATS, stats)
+	})
+}
+
+// taskStats returns the statistics of target, as seen by t.
+func taskStats(t, target *kernel.Task) linux.Taskstats {
+	ns := t.PIDNamespace()
+	userns := t.UserNamespace()
+	creds := target.Credentials()
+
+	var ppid kernel.ThreadID
+	if parent := target.Parent(); parent != nil {
+		ppid = ns.IDOfThreadGroup(parent.ThreadGroup())
+	}
+
+	stats := linux.Taskstats{
+		Version:   linux.TASKSTATS_VERSION,
+		Nice:      uint8(target.Niceness()),
+		Sched:     linux.SCHED_NORMAL,
+		UID:       uint32(creds.RealKUID.In(userns).OrOverflow()),
+		GID:       uint32(creds.RealKGID.In(userns).OrOverflow()),
+		PID:       uint32(ns.IDOfTask(target)),
+		PPID:      uint32(ppid),
+		BeginTime: uint32(target.StartTime().Seconds()),
+		// Memory high-water marks are in KB.
+		HiwaterRSS: target.MaxRSS(linux.RUSAGE_SELF) / 1024,
+	}
+	copy(stats.Comm[:], target.Name())
+	stats.ElapsedTime = uint64(t.Kernel().RealtimeClock().Now().Sub(target.StartTime()) / time.Microsecond)
+
+	delay, count := target.SchedDelay()
+	var io usage.IO
+	io.Accumulate(target.IOUsage())
+	fillUsage(&stats, delay, count, target.CPUStats(), &io)
+	return stats
+}
+
+// threadGroupStats returns the combined statistics of all past and present
+// threads in tg, as seen by t. It returns false if tg has no leader.
+func threadGroupStats(t *kernel.Task, tg *kernel.ThreadGroup) (linux.Taskstats, bool) {
+	leader := tg.Leader()
+	if leader == nil {
+		return linux.Taskstats{}, false
+	}
+	stats := taskStats(t, leader)
+	stats.PID = uint32(t.PIDNamespace().IDOfThreadGroup(tg))
+
+	delay, count := tg.SchedDelay()
+	fillUsage(&stats, delay, count, tg.CPUStats(), tg.IOUsage())
+	return stats, true
+}
+
+// fillUsage fills in the delay accounting, CPU and I/O fields of stats.
+func fillUsage(stats *linux.Taskstats, schedDelay time.Duration, schedCount uint64, cpu usage.CPUStats, io *usage.IO) {
+	run := uint64(cpu.UserTime + cpu.SysTime)
+
+	// CPU delays are the times that tasks were runnable but not running.
+	stats.CPUCount = schedCount
+	stats.CPUDelayTotal = uint64(schedDelay)
+	stats.CPURunRealTotal = run
+	stats.CPURunVirtualTotal = run
+	stats.CPUScaledRunRealTotal = run
+
+	// Block I/O delays are the times that tasks waited for synchronous I/O
+	// to the file system.
+	stats.BlkIOCount = io.BlockIOCount
+	stats.BlkIODelayTotal = io.BlockIODelay
+
+	// The sentry neither swaps out nor reclaims application memory, so
+	// tasks never wait for swap-in or for free pages, and SwapinCount,
+	// SwapinDelayTotal, FreepagesCount and FreepagesDelayTotal are always
+	// zero.
+
+	stats.UTime = uint64(cpu.UserTime / time.Microsecond)
+	stats.STime = uint64(cpu.SysTime / time.Microsecond)
+	stats.UTimeScaled = stats.UTime
+	stats.STimeScaled = stats.STime
+	stats.NVCSw = cpu.VoluntarySwitches
+
+	stats.ReadChar = io.CharsRead
+	stats.WriteChar = io.CharsWritten
+	stats.ReadSyscalls = io.ReadSyscalls
+	stats.WriteSyscalls = io.WriteSyscalls
+	stats.ReadBytes = io.BytesRead
+	stats.WriteBytes = io.BytesWritten
+	stats.CancelledWriteBytes = io.BytesWriteCancelled
+}
+
+// init registers the TASKSTATS family.
+func init() {
+	genetlink.RegisterFamily(&Family{})
+}
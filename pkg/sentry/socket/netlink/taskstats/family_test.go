@@ -0,0 +1,116 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package taskstats
+
+import (
+	"testing"
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/binary"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/context/contexttest"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/socket/netlink"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/socket/netlink/genetlink"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usage"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
+	"gvisor.googlesource.com/gvisor/pkg/syserr"
+)
+
+func TestTaskstatsSize(t *testing.T) {
+	if got := binary.Size(linux.Taskstats{}); got != linux.TaskstatsSize {
+		t.Errorf("binary.Size(Taskstats{}) = %d, want %d", got, linux.TaskstatsSize)
+	}
+}
+
+func TestFillUsage(t *testing.T) {
+	var io usage.IO
+	io.AccountReadSyscall(100)
+	io.AccountReadIO(4096)
+	io.AccountBlockIODelay(3 * time.Millisecond)
+	io.AccountBlockIODelay(time.Millisecond)
+	cpu := usage.CPUStats{
+		UserTime:          2 * time.Second,
+		SysTime:           time.Second,
+		VoluntarySwitches: 7,
+	}
+
+	var stats linux.Taskstats
+	fillUsage(&stats, 5*time.Millisecond, 2, cpu, &io)
+
+	want := linux.Taskstats{
+		CPUCount:              2,
+		CPUDelayTotal:         uint64(5 * time.Millisecond),
+		BlkIOCount:            2,
+		BlkIODelayTotal:       uint64(4 * time.Millisecond),
+		CPURunRealTotal:       uint64(3 * time.Second),
+		CPURunVirtualTotal:    uint64(3 * time.Second),
+		CPUScaledRunRealTotal: uint64(3 * time.Second),
+		UTime:                 2000000,
+		STime:                 1000000,
+		UTimeScaled:           2000000,
+		STimeScaled:           1000000,
+		NVCSw:                 7,
+		ReadChar:              100,
+		ReadSyscalls:          1,
+		ReadBytes:             4096,
+	}
+	if stats != want {
+		t.Errorf("fillUsage got %+v, want %+v", stats, want)
+	}
+}
+
+// request returns the payload of a generic netlink message with the given
+// command and the attributes added by put.
+func request(command uint8, put func(m *netlink.Message)) []byte {
+	m := netlink.NewMessage(linux.NetlinkMessageHeader{})
+	m.Put(linux.GenericNetlinkHeader{Command: command, Version: linux.TASKSTATS_GENL_VERSION})
+	put(m)
+	return m.Finalize()[linux.NetlinkMessageHeaderSize:]
+}
+
+// TestGetUnprivileged checks that tasks without CAP_NET_ADMIN can't read the
+// statistics of any task.
+func TestGetUnprivileged(t *testing.T) {
+	p, _ := genetlink.NewProtocol(nil)
+
+	// Look up the ID of the family, which any task may do.
+	ms := netlink.NewMessageSet(1, 2)
+	data := request(linux.CTRL_CMD_GETFAMILY, func(m *netlink.Message) {
+		m.PutAttrString(linux.CTRL_ATTR_FAMILY_NAME, linux.TASKSTATS_GENL_NAME)
+	})
+	if err := p.ProcessMessage(context.Background(), linux.NetlinkMessageHeader{Type: linux.GENL_ID_CTRL}, data, ms); err != nil {
+		t.Fatalf("CTRL_CMD_GETFAMILY got err %v, want nil", err)
+	}
+	if len(ms.Messages) != 1 {
+		t.Fatalf("CTRL_CMD_GETFAMILY got %d messages, want 1", len(ms.Messages))
+	}
+	b := ms.Messages[0].Finalize()[linux.NetlinkMessageHeaderSize+linux.GenericNetlinkHeaderSize:]
+	id := usermem.ByteOrder.Uint16(netlink.ParseAttrs(b)[linux.CTRL_ATTR_FAMILY_ID])
+
+	user := auth.NewUserCredentials(1000, 1000, nil, &auth.TaskCapabilities{}, auth.NewRootUserNamespace())
+	ctx := contexttest.WithCreds(context.Background(), user)
+	data = request(linux.TASKSTATS_CMD_GET, func(m *netlink.Message) {
+		m.PutAttr(linux.TASKSTATS_CMD_ATTR_PID, uint32(1))
+	})
+	ms = netlink.NewMessageSet(1, 2)
+	if err := p.ProcessMessage(ctx, linux.NetlinkMessageHeader{Type: id}, data, ms); err != syserr.ErrNotPermitted {
+		t.Errorf("unprivileged TASKSTATS_CMD_GET got err %v, want %v", err, syserr.ErrNotPermitted)
+	}
+	if len(ms.Messages) != 0 {
+		t.Errorf("unprivileged TASKSTATS_CMD_GET got %d replies, want none", len(ms.Messages))
+	}
+}
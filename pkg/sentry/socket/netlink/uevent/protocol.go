@@ -0,0 +1,93 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package uevent provides a NETLINK_KOBJECT_UEVENT socket protocol, over
+// which the kernel multicasts the uevents sent with kernel.Kernel.SendUEvent,
+// as udev expects.
+package uevent
+
+import (
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/socket/netlink"
+	"gvisor.googlesource.com/gvisor/pkg/syserr"
+)
+
+// kernelGroup is the multicast group of the uevents sent by the kernel.
+// Group 2 carries the events rebroadcast by udev itself, which never reach
+// the sentry.
+const kernelGroup = 1
+
+// Protocol implements netlink.MulticastProtocol.
+type Protocol struct {
+	k *kernel.Kernel
+
+	// s is the socket using this Protocol if it joined the kernel group,
+	// in which case p is registered as a listener of k's uevents.
+	//
+	// s is set before p is registered and cleared after it is
+	// unregistered, so NotifyUEvent can read it without a lock.
+	s *netlink.Socket
+}
+
+var _ netlink.MulticastProtocol = (*Protocol)(nil)
+
+// NewProtocol creates a NETLINK_KOBJECT_UEVENT netlink.Protocol.
+func NewProtocol(t *kernel.Task) (netlink.Protocol, *syserr.Error) {
+	return &Protocol{k: t.Kernel()}, nil
+}
+
+// Protocol implements netlink.Protocol.Protocol.
+func (p *Protocol) Protocol() int {
+	return linux.NETLINK_KOBJECT_UEVENT
+}
+
+// ProcessMessage implements netlink.Protocol.ProcessMessage. Messages sent to
+// the kernel are ignored, as in Linux.
+func (p *Protocol) ProcessMessage(ctx context.Context, hdr linux.NetlinkMessageHeader, data []byte, ms *netlink.MessageSet) *syserr.Error {
+	return nil
+}
+
+// SetGroups implements netlink.MulticastProtocol.SetGroups.
+func (p *Protocol) SetGroups(s *netlink.Socket, groups uint32) *syserr.Error {
+	joined := groups&(1<<(kernelGroup-1)) != 0
+	switch {
+	case joined && p.s == nil:
+		p.s = s
+		p.k.AddUEventListener(p)
+	case !joined && p.s != nil:
+		p.k.RemoveUEventListener(p)
+		p.s = nil
+	}
+	return nil
+}
+
+// NotifyUEvent implements kernel.UEventListener.NotifyUEvent.
+func (p *Protocol) NotifyUEvent(e kernel.UEvent, seqnum uint64) {
+	p.s.Multicast(e.Message(seqnum), kernelGroup)
+}
+
+// afterLoad is invoked by stateify.
+func (p *Protocol) afterLoad() {
+	// The kernel's listeners aren't saved.
+	if p.s != nil {
+		p.k.AddUEventListener(p)
+	}
+}
+
+// init registers the NETLINK_KOBJECT_UEVENT provider.
+func init() {
+	netlink.RegisterProvider(linux.NETLINK_KOBJECT_UEVENT, NewProtocol)
+}
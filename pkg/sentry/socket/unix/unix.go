@@ -145,6 +145,11 @@ func (s *SocketOperations) GetSockOpt(t *kernel.Task, level, name, outLen int) (
 // Listen implements the linux syscall listen(2) for sockets backed by
 // a unix.Endpoint.
 func (s *SocketOperations) Listen(t *kernel.Task, backlog int) *syserr.Error {
+	// Connecting sockets see the credentials of the listener when it
+	// started listening.
+	if pc, ok := s.ep.(unix.PeerCredentialer); ok {
+		pc.SetCredentials(control.CurrentCredentials(t))
+	}
 	return syserr.TranslateNetstackError(s.ep.Listen(backlog))
 }
 
@@ -336,6 +341,12 @@ func (s *SocketOperations) Connect(t *kernel.Task, sockaddr []byte, blocking boo
 	}
 	defer ep.Release()
 
+	// The peer sees the credentials of the connecting process at the time
+	// of the connection.
+	if pc, ok := s.ep.(unix.PeerCredentialer); ok {
+		pc.SetCredentials(control.CurrentCredentials(t))
+	}
+
 	// Connect the server endpoint.
 	return syserr.TranslateNetstackError(s.ep.Connect(ep))
 }
@@ -405,6 +416,12 @@ func (s *SocketOperations) ConnectedPasscred() bool {
 	return s.ep.ConnectedPasscred()
 }
 
+// Passsec implements unix.SecurityPasser.Passsec.
+func (s *SocketOperations) Passsec() bool {
+	sp, ok := s.ep.(unix.SecurityPasser)
+	return ok && sp.Passsec()
+}
+
 // Readiness implements waiter.Waitable.Readiness.
 func (s *SocketOperations) Readiness(mask waiter.EventMask) waiter.EventMask {
 	return s.ep.Readiness(mask)
@@ -560,7 +577,7 @@ func (*provider) Pair(t *kernel.Task, stype unix.SockType, protocol int) (*fs.Fi
 	}
 
 	// Create the endpoints and sockets.
-	ep1, ep2 := unix.NewPair(stype, t.Kernel())
+	ep1, ep2 := unix.NewPair(stype, t.Kernel(), control.CurrentCredentials(t))
 	s1 := New(t, ep1)
 	s2 := New(t, ep2)
 
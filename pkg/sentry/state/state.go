@@ -29,6 +29,13 @@ import (
 
 var previousMetadata map[string]string
 
+// lastCheckpointID is the checkpoint ID of the last successful save, or empty
+// if there was no such save or the save after it failed. Incremental saves
+// are only possible relative to lastCheckpointID.
+//
+// lastCheckpointID is protected by the kernel being paused during saves.
+var lastCheckpointID string
+
 // ErrStateFile is returned when the state file cannot be opened.
 type ErrStateFile struct {
 	err error
@@ -52,6 +59,11 @@ type SaveOpts struct {
 
 	// Callback is called prior to unpause, with any save error.
 	Callback func(err error)
+
+	// Incremental indicates that only the memory that changed since the
+	// previous successful save should be saved. Loading the result
+	// requires the states saved since the last non-incremental save.
+	Incremental bool
 }
 
 // Save saves the system state.
@@ -69,6 +81,21 @@ func (opts SaveOpts) Save(k *kernel.Kernel, w *watchdog.Watchdog) error {
 		opts.Metadata = make(map[string]string)
 	}
 	addSaveMetadata(opts.Metadata)
+	id, err := newCheckpointID()
+	if err != nil {
+		err = fmt.Errorf("error generating checkpoint ID: %v", err)
+		opts.Callback(err)
+		return err
+	}
+	opts.Metadata[metadataCheckpointID] = id
+	if opts.Incremental {
+		if lastCheckpointID == "" {
+			err := fmt.Errorf("incremental save requires a previous successful save")
+			opts.Callback(err)
+			return err
+		}
+		opts.Metadata[metadataParentCheckpointID] = lastCheckpointID
+	}
 
 	// Open the statefile.
 	wc, err := statefile.NewWriter(opts.Destination, opts.Key, opts.Metadata)
@@ -76,11 +103,23 @@ func (opts SaveOpts) Save(k *kernel.Kernel, w *watchdog.Watchdog) error {
 		err = ErrStateFile{err}
 	} else {
 		// Save the kernel.
-		err = k.SaveTo(wc)
+		if opts.Incremental {
+			err = k.SaveDeltaTo(wc)
+		} else {
+			err = k.SaveTo(wc)
+		}
 		if closeErr := wc.Close(); err == nil && closeErr != nil {
 			err = ErrStateFile{closeErr}
 		}
 	}
+
+	// A failed save may have partially updated the state that incremental
+	// saves are relative to, so the next save must be a full one.
+	if err != nil {
+		lastCheckpointID = ""
+	} else {
+		lastCheckpointID = id
+	}
 	opts.Callback(err)
 	return err
 }
@@ -92,6 +131,11 @@ type LoadOpts struct {
 
 	// Key is used for state integrity check.
 	Key []byte
+
+	// Parents are the sources of the states that Source was incrementally
+	// saved relative to, starting with the last non-incremental save, in
+	// order. Parents must be empty if Source was not saved incrementally.
+	Parents []io.Reader
 }
 
 // Load loads the given kernel, setting the provided platform and stack.
@@ -102,8 +146,26 @@ func (opts LoadOpts) Load(k *kernel.Kernel, p platform.Platform, n inet.Stack) e
 		return ErrStateFile{err}
 	}
 
+	// Open the parents, checking that they form a chain ending in Source.
+	var parents []io.Reader
+	parentID := ""
+	for i, source := range opts.Parents {
+		pr, pm, err := statefile.NewReader(source, opts.Key)
+		if err != nil {
+			return ErrStateFile{err}
+		}
+		if got := pm[metadataParentCheckpointID]; got != parentID {
+			return fmt.Errorf("parent %d has parent checkpoint ID %q, want %q", i, got, parentID)
+		}
+		parents = append(parents, pr)
+		parentID = pm[metadataCheckpointID]
+	}
+	if got := m[metadataParentCheckpointID]; got != parentID {
+		return fmt.Errorf("statefile has parent checkpoint ID %q, want %q", got, parentID)
+	}
+
 	previousMetadata = m
 
 	// Restore the Kernel object graph.
-	return k.LoadFrom(r, p, n)
+	return k.LoadFrom(r, parents, p, n)
 }
@@ -15,6 +15,8 @@
 package state
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"time"
 
@@ -27,6 +29,14 @@ const (
 	metadataTimestamp = "timestamp"
 )
 
+// The save metadata keys for incremental saves. Every save is assigned a
+// unique checkpoint ID. An incremental save also records the checkpoint ID of
+// the save it was taken relative to.
+const (
+	metadataCheckpointID       = "checkpoint_id"
+	metadataParentCheckpointID = "parent_checkpoint_id"
+)
+
 func addSaveMetadata(m map[string]string) {
 	t, err := cpuTime()
 	if err != nil {
@@ -43,3 +53,12 @@ func addSaveMetadata(m map[string]string) {
 
 	m[metadataTimestamp] = fmt.Sprintf("%v", time.Now())
 }
+
+// newCheckpointID returns a new random checkpoint ID.
+func newCheckpointID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b[:]), nil
+}
@@ -0,0 +1,163 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package strace
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
+)
+
+// Depth determines how deeply the arguments of a syscall are decoded.
+type Depth int
+
+const (
+	// DepthRaw formats all arguments as hexadecimal numbers.
+	DepthRaw Depth = iota
+
+	// DepthArgs decodes arguments, such as flags, paths and structs, but
+	// doesn't dump the contents of data buffers.
+	DepthArgs
+
+	// DepthFull decodes arguments and dumps the contents of data buffers,
+	// up to the maximum size of each sink. This is the default.
+	DepthFull
+)
+
+// depthNames are the names of depths, as accepted by ParseDepth.
+var depthNames = map[string]Depth{
+	"raw":  DepthRaw,
+	"args": DepthArgs,
+	"full": DepthFull,
+}
+
+// ParseDepth parses a depth named "raw", "args" or "full".
+func ParseDepth(s string) (Depth, error) {
+	d, ok := depthNames[s]
+	if !ok {
+		return 0, fmt.Errorf("invalid depth %q", s)
+	}
+	return d, nil
+}
+
+// Filter restricts the syscalls that are traced to the log and event sinks.
+// The ring sink records all enabled syscalls, since it is meant to explain
+// anomalies after the fact.
+type Filter struct {
+	// TIDs, if not empty, restricts tracing to the given tasks, by thread
+	// ID in the root PID namespace. The ID of a thread group matches all
+	// of its tasks.
+	TIDs []int32
+
+	// ErrorsOnly restricts tracing to syscalls that fail. They are only
+	// traced on exit.
+	ErrorsOnly bool
+
+	// Depth overrides the decoding depth of the syscalls or syscall
+	// groups it names.
+	Depth map[string]Depth
+}
+
+// filter is the compiled form of a Filter.
+type filter struct {
+	tids       map[kernel.ThreadID]struct{}
+	errorsOnly bool
+	depth      map[string]Depth
+}
+
+// currentFilter holds the *filter set by SetFilter.
+var currentFilter atomic.Value
+
+func init() {
+	currentFilter.Store(&filter{})
+}
+
+// SetFilter replaces the filter that applies to traced syscalls. The zero
+// Filter traces all enabled syscalls.
+func SetFilter(f Filter) error {
+	c := &filter{errorsOnly: f.ErrorsOnly}
+	if len(f.TIDs) != 0 {
+		c.tids = make(map[kernel.ThreadID]struct{})
+		for _, tid := range f.TIDs {
+			c.tids[kernel.ThreadID(tid)] = struct{}{}
+		}
+	}
+	if len(f.Depth) != 0 {
+		c.depth = make(map[string]Depth)
+		for name, d := range f.Depth {
+			if d < DepthRaw || d > DepthFull {
+				return fmt.Errorf("invalid depth %d for %q", d, name)
+			}
+			names, err := expandGroups([]string{name})
+			if err != nil {
+				return err
+			}
+			for _, n := range names {
+				if !knownSyscall(n) {
+					return fmt.Errorf("syscall %q not found", n)
+				}
+				c.depth[n] = d
+			}
+		}
+	}
+	currentFilter.Store(c)
+	return nil
+}
+
+// knownSyscall returns true if name is a syscall in any syscall table.
+func knownSyscall(name string) bool {
+	for _, s := range syscallTables {
+		if _, ok := s.syscalls.ConvertToSysno(name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// loadFilter returns the current filter.
+func loadFilter() *filter {
+	return currentFilter.Load().(*filter)
+}
+
+// traces returns true if syscalls made by t are traced.
+func (f *filter) traces(t *kernel.Task) bool {
+	if f.tids == nil {
+		return true
+	}
+	root := t.Kernel().TaskSet().Root
+	if _, ok := f.tids[root.IDOfTask(t)]; ok {
+		return true
+	}
+	_, ok := f.tids[root.IDOfThreadGroup(t.ThreadGroup())]
+	return ok
+}
+
+// format returns the syscall info to use to format a syscall, and whether
+// the contents of its data buffers are dumped.
+func (f *filter) format(info SyscallInfo) (SyscallInfo, bool) {
+	switch d, ok := f.depth[info.name]; {
+	case !ok || d == DepthFull:
+		return info, true
+	case d == DepthArgs:
+		return info, false
+	default:
+		n := len(info.format)
+		if n > len(defaultFormat) {
+			n = len(defaultFormat)
+		}
+		return SyscallInfo{name: info.name, format: defaultFormat[:n]}, false
+	}
+}
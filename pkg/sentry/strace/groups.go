@@ -0,0 +1,107 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package strace
+
+import (
+	"fmt"
+	"strings"
+)
+
+// syscallGroups are the classes of syscalls that can be traced together by
+// naming them with a "%" prefix, such as "%network". They follow the classes
+// of strace(1).
+var syscallGroups = map[string][]string{
+	// file contains syscalls that take a file name.
+	"file": {
+		"access", "acct", "chdir", "chmod", "chown", "chroot", "creat",
+		"execve", "faccessat", "fchmodat", "fchownat", "futimesat",
+		"getxattr", "inotify_add_watch", "lchown", "lgetxattr", "link",
+		"linkat", "listxattr", "llistxattr", "lremovexattr", "lsetxattr",
+		"lstat", "mkdir", "mkdirat", "mknod", "mknodat", "mount",
+		"name_to_handle_at", "newfstatat", "open", "openat", "pivot_root",
+		"quotactl", "readlink", "readlinkat", "removexattr", "rename",
+		"renameat", "renameat2", "rmdir", "setxattr", "stat", "statfs",
+		"swapoff", "swapon", "symlink", "symlinkat", "truncate", "umount2",
+		"unlink", "unlinkat", "uselib", "utime", "utimensat", "utimes",
+	},
+
+	// desc contains syscalls that take or return a file descriptor.
+	"desc": {
+		"close", "dup", "dup2", "dup3", "epoll_create", "epoll_create1",
+		"epoll_ctl", "epoll_pwait", "epoll_wait", "eventfd", "eventfd2",
+		"fadvise64", "fallocate", "fchdir", "fchmod", "fchown", "fcntl",
+		"fdatasync", "flock", "fstat", "fstatfs", "fsync", "ftruncate",
+		"getdents", "getdents64", "inotify_init", "inotify_init1", "ioctl",
+		"lseek", "mmap", "pipe", "pipe2", "poll", "ppoll",
+		"pread64", "preadv", "pselect6", "pwrite64", "pwritev", "read",
+		"readahead", "readv", "select", "sendfile", "signalfd", "signalfd4",
+		"splice", "sync_file_range", "syncfs", "tee", "timerfd_create",
+		"timerfd_gettime", "timerfd_settime", "vmsplice", "write", "writev",
+	},
+
+	// network contains socket syscalls.
+	"network": {
+		"accept", "accept4", "bind", "connect", "getpeername",
+		"getsockname", "getsockopt", "listen", "recvfrom", "recvmmsg",
+		"recvmsg", "sendmmsg", "sendmsg", "sendto", "setsockopt",
+		"shutdown", "socket", "socketpair",
+	},
+
+	// process contains syscalls that manage the lifetime of processes.
+	"process": {
+		"clone", "execve", "exit", "exit_group", "fork", "kill",
+		"rt_sigqueueinfo", "rt_tgsigqueueinfo", "tgkill", "tkill",
+		"unshare", "vfork", "wait4", "waitid",
+	},
+
+	// signal contains syscalls that handle signals.
+	"signal": {
+		"kill", "pause", "rt_sigaction", "rt_sigpending", "rt_sigprocmask",
+		"rt_sigqueueinfo", "rt_sigreturn", "rt_sigsuspend",
+		"rt_sigtimedwait", "rt_tgsigqueueinfo", "sigaltstack", "signalfd",
+		"signalfd4", "tgkill", "tkill",
+	},
+
+	// ipc contains System V IPC syscalls.
+	"ipc": {
+		"msgctl", "msgget", "msgrcv", "msgsnd", "semctl", "semget", "semop",
+		"semtimedop", "shmat", "shmctl", "shmdt", "shmget",
+	},
+
+	// memory contains syscalls that manage memory mappings.
+	"memory": {
+		"brk", "get_mempolicy", "madvise", "mbind", "migrate_pages",
+		"mincore", "mlock", "mlockall", "mmap", "move_pages", "mprotect",
+		"mremap", "msync", "munlock", "munlockall", "munmap",
+		"remap_file_pages", "set_mempolicy",
+	},
+}
+
+// expandGroups returns names with each syscall group replaced by its syscalls.
+func expandGroups(names []string) ([]string, error) {
+	var expanded []string
+	for _, name := range names {
+		if !strings.HasPrefix(name, "%") {
+			expanded = append(expanded, name)
+			continue
+		}
+		group, ok := syscallGroups[name[1:]]
+		if !ok {
+			return nil, fmt.Errorf("syscall group %q not found", name)
+		}
+		expanded = append(expanded, group...)
+	}
+	return expanded, nil
+}
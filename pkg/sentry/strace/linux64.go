@@ -335,4 +335,14 @@ var linuxAMD64 = SyscallMap{
 	315: makeSyscallInfo("sched_getattr", Hex, Hex, Hex),
 	316: makeSyscallInfo("renameat2", Hex, Path, Hex, Path, Hex),
 	317: makeSyscallInfo("seccomp", Hex, Hex, Hex),
+	323: makeSyscallInfo("userfaultfd", Hex),
+	324: makeSyscallInfo("membarrier", Hex, Hex),
+	332: makeSyscallInfo("statx", Hex, Path, Hex, Hex, Hex),
+	334: makeSyscallInfo("rseq", Hex, Hex, Hex, Hex),
+	425: makeSyscallInfo("io_uring_setup", Hex, Hex),
+	426: makeSyscallInfo("io_uring_enter", Hex, Hex, Hex, Hex, Hex, Hex),
+	427: makeSyscallInfo("io_uring_register", Hex, Hex, Hex, Hex),
+	435: makeSyscallInfo("clone3", Hex, Hex),
+	436: makeSyscallInfo("close_range", Hex, Hex, Hex),
+	437: makeSyscallInfo("openat2", Hex, Path, Hex, Hex),
 }
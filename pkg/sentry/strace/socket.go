@@ -440,6 +440,7 @@ var SocketProtocol = map[int32]abi.ValueSet{
 var controlMessageType = map[int32]string{
 	linux.SCM_RIGHTS:      "SCM_RIGHTS",
 	linux.SCM_CREDENTIALS: "SCM_CREDENTIALS",
+	linux.SCM_SECURITY:    "SCM_SECURITY",
 	linux.SO_TIMESTAMP:    "SO_TIMESTAMP",
 }
 
@@ -46,6 +46,18 @@ var LogMaximumSize uint = DefaultLogMaximumSize
 // do anything useful with binary text dump of byte array arguments.
 var EventMaximumSize uint
 
+// DefaultRingSize is the default RingSize.
+const DefaultRingSize = 64
+
+// RingSize is the number of syscall traces that each task keeps for
+// SinkTypeRing.
+var RingSize = DefaultRingSize
+
+// RingMaximumSize determines the maximum display size for data blobs (read,
+// write, etc.) recorded in a task's trace ring. It is small, since ring
+// traces are recorded for every traced syscall but rarely displayed.
+var RingMaximumSize uint = 64
+
 func iovecs(t *kernel.Task, addr usermem.Addr, iovcnt int, printContent bool, maxBytes uint64) string {
 	if iovcnt < 0 || iovcnt > linux.UIO_MAXIOV {
 		return fmt.Sprintf("%#x (error decoding iovecs: invalid iovcnt)", addr)
@@ -120,7 +132,7 @@ func path(t *kernel.Task, addr usermem.Addr) string {
 	if err != nil {
 		return fmt.Sprintf("%#x (error decoding path: %s)", addr, err)
 	}
-	return fmt.Sprintf("%#x %s", addr, path)
+	return fmt.Sprintf("%#x %s", addr, t.ThreadGroup().RedactionPolicy().Path(path))
 }
 
 func fdpair(t *kernel.Task, addr usermem.Addr) string {
@@ -229,12 +241,13 @@ func stringVector(t *kernel.Task, addr usermem.Addr) string {
 	if err != nil {
 		return fmt.Sprintf("%#x {error copying vector: %v}", addr, err)
 	}
+	redaction := t.ThreadGroup().RedactionPolicy()
 	s := fmt.Sprintf("%#x [", addr)
 	for i, v := range vec {
 		if i != 0 {
 			s += ", "
 		}
-		s += fmt.Sprintf("%q", v)
+		s += fmt.Sprintf("%q", redaction.Arg(v))
 	}
 	s += "]"
 	return s
@@ -369,8 +382,8 @@ func (i *SyscallInfo) post(t *kernel.Task, args arch.SyscallArguments, rval uint
 }
 
 // printEntry prints the given system call entry.
-func (i *SyscallInfo) printEnter(t *kernel.Task, args arch.SyscallArguments) []string {
-	output := i.pre(t, args, LogMaximumSize)
+func (i *SyscallInfo) printEnter(t *kernel.Task, args arch.SyscallArguments, maximumBlobSize uint) []string {
+	output := i.pre(t, args, maximumBlobSize)
 
 	switch len(output) {
 	case 0:
@@ -399,11 +412,11 @@ func (i *SyscallInfo) printEnter(t *kernel.Task, args arch.SyscallArguments) []s
 }
 
 // printExit prints the given system call exit.
-func (i *SyscallInfo) printExit(t *kernel.Task, elapsed time.Duration, output []string, args arch.SyscallArguments, retval uintptr, err error, errno int) {
+func (i *SyscallInfo) printExit(t *kernel.Task, elapsed time.Duration, output []string, args arch.SyscallArguments, retval uintptr, err error, errno int, maximumBlobSize uint) {
 	var rval string
 	if err == nil {
 		// Fill in the output after successful execution.
-		i.post(t, args, retval, output, LogMaximumSize)
+		i.post(t, args, retval, output, maximumBlobSize)
 		rval = fmt.Sprintf("%#x (%v)", retval, elapsed)
 	} else {
 		rval = fmt.Sprintf("%#x errno=%d (%s) (%v)", retval, errno, err, elapsed)
@@ -435,8 +448,8 @@ func (i *SyscallInfo) printExit(t *kernel.Task, elapsed time.Duration, output []
 }
 
 // sendEnter sends the syscall enter to event log.
-func (i *SyscallInfo) sendEnter(t *kernel.Task, args arch.SyscallArguments) []string {
-	output := i.pre(t, args, EventMaximumSize)
+func (i *SyscallInfo) sendEnter(t *kernel.Task, args arch.SyscallArguments, maximumBlobSize uint) []string {
+	output := i.pre(t, args, maximumBlobSize)
 
 	event := pb.Strace{
 		Process:  t.Name(),
@@ -454,10 +467,10 @@ func (i *SyscallInfo) sendEnter(t *kernel.Task, args arch.SyscallArguments) []st
 }
 
 // sendExit sends the syscall exit to event log.
-func (i *SyscallInfo) sendExit(t *kernel.Task, elapsed time.Duration, output []string, args arch.SyscallArguments, rval uintptr, err error, errno int) {
+func (i *SyscallInfo) sendExit(t *kernel.Task, elapsed time.Duration, output []string, args arch.SyscallArguments, rval uintptr, err error, errno int, maximumBlobSize uint) {
 	if err == nil {
 		// Fill in the output after successful execution.
-		i.post(t, args, rval, output, EventMaximumSize)
+		i.post(t, args, rval, output, maximumBlobSize)
 	}
 
 	exit := &pb.StraceExit{
@@ -479,13 +492,33 @@ func (i *SyscallInfo) sendExit(t *kernel.Task, elapsed time.Duration, output []s
 	eventchannel.Emit(&event)
 }
 
+// recordRing records the given system call in the task's trace ring.
+func (i *SyscallInfo) recordRing(t *kernel.Task, elapsed time.Duration, output []string, args arch.SyscallArguments, retval uintptr, err error, errno int) {
+	var rval string
+	if err == nil {
+		// Fill in the output after successful execution.
+		i.post(t, args, retval, output, RingMaximumSize)
+		rval = fmt.Sprintf("%#x (%v)", retval, elapsed)
+	} else {
+		rval = fmt.Sprintf("%#x errno=%d (%s) (%v)", retval, errno, err, elapsed)
+	}
+	t.RecordTrace(RingSize, fmt.Sprintf("%s(%s) = %s", i.name, strings.Join(output, ", "), rval))
+}
+
 type syscallContext struct {
 	info        SyscallInfo
 	args        arch.SyscallArguments
 	start       time.Time
 	logOutput   []string
 	eventOutput []string
+	ringOutput  []string
 	flags       uint32
+
+	// The following fields apply to the log and event sinks only.
+	filteredInfo SyscallInfo
+	logSize      uint
+	eventSize    uint
+	errorsOnly   bool
 }
 
 // SyscallEnter implements kernel.Stracer.SyscallEnter. It logs the syscall
@@ -499,21 +532,50 @@ func (s SyscallMap) SyscallEnter(t *kernel.Task, sysno uintptr, args arch.Syscal
 		}
 	}
 
+	f := loadFilter()
+	if !f.traces(t) {
+		flags &^= kernel.StraceEnableLog | kernel.StraceEnableEvent
+	}
+	filteredInfo, dumpData := f.format(info)
+	logSize, eventSize := LogMaximumSize, EventMaximumSize
+	if !dumpData {
+		logSize, eventSize = 0, 0
+	}
+
+	// Syscalls traced only if they fail are formatted now, since their
+	// arguments may change, but printed on exit.
 	var output, eventOutput []string
 	if bits.IsOn32(flags, kernel.StraceEnableLog) {
-		output = info.printEnter(t, args)
+		if f.errorsOnly {
+			output = filteredInfo.pre(t, args, logSize)
+		} else {
+			output = filteredInfo.printEnter(t, args, logSize)
+		}
 	}
 	if bits.IsOn32(flags, kernel.StraceEnableEvent) {
-		eventOutput = info.sendEnter(t, args)
+		if f.errorsOnly {
+			eventOutput = filteredInfo.pre(t, args, eventSize)
+		} else {
+			eventOutput = filteredInfo.sendEnter(t, args, eventSize)
+		}
+	}
+	var ringOutput []string
+	if bits.IsOn32(flags, kernel.StraceEnableRing) {
+		ringOutput = info.pre(t, args, RingMaximumSize)
 	}
 
 	return &syscallContext{
-		info:        info,
-		args:        args,
-		start:       time.Now(),
-		logOutput:   output,
-		eventOutput: eventOutput,
-		flags:       flags,
+		info:         info,
+		args:         args,
+		start:        time.Now(),
+		logOutput:    output,
+		eventOutput:  eventOutput,
+		ringOutput:   ringOutput,
+		flags:        flags,
+		filteredInfo: filteredInfo,
+		logSize:      logSize,
+		eventSize:    eventSize,
+		errorsOnly:   f.errorsOnly,
 	}
 }
 
@@ -524,21 +586,30 @@ func (s SyscallMap) SyscallExit(context interface{}, t *kernel.Task, sysno, rval
 	c := context.(*syscallContext)
 
 	elapsed := time.Since(c.start)
-	if bits.IsOn32(c.flags, kernel.StraceEnableLog) {
-		c.info.printExit(t, elapsed, c.logOutput, c.args, rval, err, errno)
+	traced := err != nil || !c.errorsOnly
+	if traced && bits.IsOn32(c.flags, kernel.StraceEnableLog) {
+		c.filteredInfo.printExit(t, elapsed, c.logOutput, c.args, rval, err, errno, c.logSize)
+	}
+	if traced && bits.IsOn32(c.flags, kernel.StraceEnableEvent) {
+		c.filteredInfo.sendExit(t, elapsed, c.eventOutput, c.args, rval, err, errno, c.eventSize)
 	}
-	if bits.IsOn32(c.flags, kernel.StraceEnableEvent) {
-		c.info.sendExit(t, elapsed, c.eventOutput, c.args, rval, err, errno)
+	if bits.IsOn32(c.flags, kernel.StraceEnableRing) {
+		c.info.recordRing(t, elapsed, c.ringOutput, c.args, rval, err, errno)
 	}
 }
 
 // ConvertToSysnoMap converts the names to a map keyed on the syscall number and value set to true.
 // The map is in a convenient format to call SyscallFlagsTable.Enable().
+// Names starting with "%" stand for a group of syscalls, such as "%network".
 func (s SyscallMap) ConvertToSysnoMap(syscalls []string) (map[uintptr]bool, error) {
 	if syscalls == nil {
 		// Sentinel: no list.
 		return nil, nil
 	}
+	syscalls, err := expandGroups(syscalls)
+	if err != nil {
+		return nil, err
+	}
 
 	l := make(map[uintptr]bool)
 	for _, sc := range syscalls {
@@ -601,6 +672,10 @@ const (
 
 	// SinkTypeEvent sends strace to event log
 	SinkTypeEvent
+
+	// SinkTypeRing records straces in each task's trace ring, which is
+	// logged when the task encounters an anomaly.
+	SinkTypeRing
 )
 
 func convertToSyscallFlag(sinks SinkType) uint32 {
@@ -611,6 +686,9 @@ func convertToSyscallFlag(sinks SinkType) uint32 {
 	if bits.IsOn32(uint32(sinks), uint32(SinkTypeEvent)) {
 		ret |= kernel.StraceEnableEvent
 	}
+	if bits.IsOn32(uint32(sinks), uint32(SinkTypeRing)) {
+		ret |= kernel.StraceEnableRing
+	}
 	return ret
 }
 
@@ -0,0 +1,53 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+import (
+	"gvisor.googlesource.com/gvisor/pkg/binary"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
+	"gvisor.googlesource.com/gvisor/pkg/syserror"
+)
+
+// copyInExtensible copies in an extensible syscall argument structure, such
+// as those of clone3(2) and openat2(2), into dst, which must be a pointer to
+// the latest known version of the structure. The application's version is
+// size bytes at addr and must be at least minSize bytes. Fields beyond size
+// are zeroed, as for an older version of the structure; a newer version is
+// only accepted if the fields that are not known are zero.
+func copyInExtensible(t *kernel.Task, addr usermem.Addr, size, minSize uint, dst interface{}) error {
+	if size < minSize {
+		return syserror.EINVAL
+	}
+	if size > usermem.PageSize {
+		return syserror.E2BIG
+	}
+	buf := make([]byte, size)
+	if _, err := t.CopyInBytes(addr, buf); err != nil {
+		return err
+	}
+	known := int(binary.Size(dst))
+	if len(buf) > known {
+		for _, b := range buf[known:] {
+			if b != 0 {
+				return syserror.E2BIG
+			}
+		}
+		buf = buf[:known]
+	}
+	buf = append(buf, make([]byte, known-len(buf))...)
+	binary.Unmarshal(buf, usermem.ByteOrder, dst)
+	return nil
+}
@@ -44,34 +44,6 @@ func fdFlagsToLinux(flags kernel.FDFlags) (mask uint) {
 	return
 }
 
-// flagsToLinux converts a FileFlags object to a Linux representation.
-func flagsToLinux(flags fs.FileFlags) (mask uint) {
-	if flags.Direct {
-		mask |= syscall.O_DIRECT
-	}
-	if flags.NonBlocking {
-		mask |= syscall.O_NONBLOCK
-	}
-	if flags.Sync {
-		mask |= syscall.O_SYNC
-	}
-	if flags.Append {
-		mask |= syscall.O_APPEND
-	}
-	if flags.Directory {
-		mask |= syscall.O_DIRECTORY
-	}
-	switch {
-	case flags.Read && flags.Write:
-		mask |= syscall.O_RDWR
-	case flags.Write:
-		mask |= syscall.O_WRONLY
-	case flags.Read:
-		mask |= syscall.O_RDONLY
-	}
-	return
-}
-
 // linuxToFlags converts linux file flags to a FileFlags object.
 func linuxToFlags(mask uint) (flags fs.FileFlags) {
 	return fs.FileFlags{
@@ -203,12 +203,12 @@ var AMD64 = &kernel.SyscallTable{
 		156: syscalls.Error(syscall.EPERM),               // Sysctl, syscall is "worthless"
 		157: Prctl,
 		158: ArchPrctl,
-		159: syscalls.CapError(linux.CAP_SYS_TIME), // Adjtimex, requires cap_sys_time
+		159: Adjtimex,
 		160: Setrlimit,
 		161: Chroot,
 		162: Sync,
 		163: syscalls.CapError(linux.CAP_SYS_PACCT), // Acct, requires cap_sys_pacct
-		164: syscalls.CapError(linux.CAP_SYS_TIME),  // Settimeofday, requires cap_sys_time
+		164: Settimeofday,
 		165: Mount,
 		166: Umount2,
 		167: syscalls.CapError(linux.CAP_SYS_ADMIN), // Swapon, requires cap_sys_admin
@@ -349,7 +349,7 @@ var AMD64 = &kernel.SyscallTable{
 		302: Prlimit64,
 		303: syscalls.ErrorWithEvent(syscall.EOPNOTSUPP), // NameToHandleAt, needs filesystem support
 		304: syscalls.ErrorWithEvent(syscall.EOPNOTSUPP), // OpenByHandleAt, needs filesystem support
-		305: syscalls.CapError(linux.CAP_SYS_TIME),       // ClockAdjtime, requires cap_sys_time
+		305: ClockAdjtime,
 		306: Syncfs,
 		307: SendMMsg,
 		//     308: Setns, TODO
@@ -360,6 +360,16 @@ var AMD64 = &kernel.SyscallTable{
 		313: syscalls.CapError(linux.CAP_SYS_MODULE), // FinitModule, requires cap_sys_module
 		// "Backports."
 		318: GetRandom,
+		323: Userfaultfd,
+		324: Membarrier,
+		332: Statx,
+		334: RSeq,
+		425: IOUringSetup,
+		426: IOUringEnter,
+		427: IOUringRegister,
+		435: Clone3,
+		436: CloseRange,
+		437: Openat2,
 	},
 
 	Emulate: map[usermem.Addr]uintptr{
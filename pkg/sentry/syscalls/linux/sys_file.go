@@ -15,7 +15,9 @@
 package linux
 
 import (
+	"fmt"
 	"io"
+	"math"
 	"syscall"
 
 	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
@@ -34,9 +36,18 @@ import (
 
 // fileOpAt performs an operation on the second last component in the path.
 func fileOpAt(t *kernel.Task, dirFD kdefs.FD, path string, fn func(root *fs.Dirent, d *fs.Dirent, name string) error) error {
+	return fileOpAtWithOptions(t, dirFD, path, fs.ResolveOptions{}, fn)
+}
+
+// fileOpAtWithOptions is identical to fileOpAt except that resolution of the
+// second last component is restricted by opts. If opts confine resolution to
+// dirFD, fn is passed that directory as root.
+func fileOpAtWithOptions(t *kernel.Task, dirFD kdefs.FD, path string, opts fs.ResolveOptions, fn func(root *fs.Dirent, d *fs.Dirent, name string) error) error {
 	// Extract the last component.
 	dir, name := fs.SplitLast(path)
-	if dir == "/" {
+	if opts != (fs.ResolveOptions{}) {
+		// The common cases below don't apply.
+	} else if dir == "/" {
 		// Common case: we are accessing a file in the root.
 		root := t.FSContext().RootDirectory()
 		err := fn(root, root, name)
@@ -53,13 +64,20 @@ func fileOpAt(t *kernel.Task, dirFD kdefs.FD, path string, fn func(root *fs.Dire
 		return err
 	}
 
-	return fileOpOn(t, dirFD, dir, true /* resolve */, func(root *fs.Dirent, d *fs.Dirent) error {
+	return fileOpOnWithOptions(t, dirFD, dir, true /* resolve */, opts, func(root *fs.Dirent, d *fs.Dirent) error {
 		return fn(root, d, name)
 	})
 }
 
 // fileOpOn performs an operation on the last entry of the path.
 func fileOpOn(t *kernel.Task, dirFD kdefs.FD, path string, resolve bool, fn func(root *fs.Dirent, d *fs.Dirent) error) error {
+	return fileOpOnWithOptions(t, dirFD, path, resolve, fs.ResolveOptions{}, fn)
+}
+
+// fileOpOnWithOptions is identical to fileOpOn except that resolution is
+// restricted by opts. If opts confine resolution to dirFD, fn is passed that
+// directory as root.
+func fileOpOnWithOptions(t *kernel.Task, dirFD kdefs.FD, path string, resolve bool, opts fs.ResolveOptions, fn func(root *fs.Dirent, d *fs.Dirent) error) error {
 	var (
 		d   *fs.Dirent // The file.
 		wd  *fs.Dirent // The working directory (if required.)
@@ -68,8 +86,10 @@ func fileOpOn(t *kernel.Task, dirFD kdefs.FD, path string, resolve bool, fn func
 		err error
 	)
 
-	// Extract the working directory (maybe).
-	if len(path) > 0 && path[0] == '/' {
+	// Extract the working directory (maybe). Scoped resolution always
+	// needs it, since it serves as the root.
+	scoped := opts.Beneath || opts.InRoot
+	if len(path) > 0 && path[0] == '/' && !scoped {
 		// Absolute path; rel can be nil.
 	} else if dirFD == linux.AT_FDCWD {
 		// Need to reference the working directory.
@@ -88,13 +108,19 @@ func fileOpOn(t *kernel.Task, dirFD kdefs.FD, path string, resolve bool, fn func
 	}
 
 	// Grab the root (always required.)
-	root := t.FSContext().RootDirectory()
+	var root *fs.Dirent
+	if scoped {
+		root = rel
+		root.IncRef()
+	} else {
+		root = t.FSContext().RootDirectory()
+	}
 
 	// Lookup the node.
 	if resolve {
-		d, err = t.MountNamespace().FindInode(t, root, rel, path, linux.MaxSymlinkTraversals)
+		d, err = t.MountNamespace().FindInodeWithOptions(t, root, rel, path, linux.MaxSymlinkTraversals, opts)
 	} else {
-		d, err = t.MountNamespace().FindLink(t, root, rel, path, linux.MaxSymlinkTraversals)
+		d, err = t.MountNamespace().FindLinkWithOptions(t, root, rel, path, linux.MaxSymlinkTraversals, opts)
 	}
 	root.DecRef()
 	if wd != nil {
@@ -129,20 +155,20 @@ func copyInPath(t *kernel.Task, addr usermem.Addr, allowEmpty bool) (path string
 	return path, dirPath, nil
 }
 
-func openAt(t *kernel.Task, dirFD kdefs.FD, addr usermem.Addr, flags uint) (fd uintptr, err error) {
+func openAt(t *kernel.Task, dirFD kdefs.FD, addr usermem.Addr, flags uint, opts fs.ResolveOptions) (fd uintptr, err error) {
 	path, dirPath, err := copyInPath(t, addr, false /* allowEmpty */)
 	if err != nil {
 		return 0, err
 	}
 
-	err = fileOpOn(t, dirFD, path, true /* resolve */, func(root *fs.Dirent, d *fs.Dirent) error {
+	err = fileOpOnWithOptions(t, dirFD, path, true /* resolve */, opts, func(root *fs.Dirent, d *fs.Dirent) error {
 		// First check a few things about the filesystem before trying to get the file
 		// reference.
 		//
 		// It's required that Check does not try to open files not that aren't backed by
 		// this dirent (e.g. pipes and sockets) because this would result in opening these
 		// files an extra time just to check permissions.
-		if err := d.Inode.CheckPermission(t, flagsToPermissions(flags)); err != nil {
+		if err := d.CheckPermission(t, flagsToPermissions(flags)); err != nil {
 			return err
 		}
 
@@ -207,7 +233,7 @@ func mknodAt(t *kernel.Task, dirFD kdefs.FD, addr usermem.Addr, mode linux.FileM
 		}
 
 		// Do we have the appropriate permissions on the parent?
-		if err := d.Inode.CheckPermission(t, fs.PermMask{Write: true, Execute: true}); err != nil {
+		if err := d.CheckPermission(t, fs.PermMask{Write: true, Execute: true}); err != nil {
 			return err
 		}
 
@@ -285,7 +311,7 @@ func Mknodat(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Sysca
 	return 0, nil, mknodAt(t, dirFD, path, mode)
 }
 
-func createAt(t *kernel.Task, dirFD kdefs.FD, addr usermem.Addr, flags uint, mode linux.FileMode) (fd uintptr, err error) {
+func createAt(t *kernel.Task, dirFD kdefs.FD, addr usermem.Addr, flags uint, mode linux.FileMode, opts fs.ResolveOptions) (fd uintptr, err error) {
 	path, dirPath, err := copyInPath(t, addr, false /* allowEmpty */)
 	if err != nil {
 		return 0, err
@@ -294,13 +320,13 @@ func createAt(t *kernel.Task, dirFD kdefs.FD, addr usermem.Addr, flags uint, mod
 		return 0, syserror.ENOENT
 	}
 
-	err = fileOpAt(t, dirFD, path, func(root *fs.Dirent, d *fs.Dirent, name string) error {
+	err = fileOpAtWithOptions(t, dirFD, path, opts, func(root *fs.Dirent, d *fs.Dirent, name string) error {
 		if !fs.IsDir(d.Inode.StableAttr) {
 			return syserror.ENOTDIR
 		}
 
 		// Does this file exist already?
-		targetDirent, err := t.MountNamespace().FindInode(t, root, d, name, linux.MaxSymlinkTraversals)
+		targetDirent, err := t.MountNamespace().FindInodeWithOptions(t, root, d, name, linux.MaxSymlinkTraversals, opts)
 		var newFile *fs.File
 		switch err {
 		case nil:
@@ -315,7 +341,7 @@ func createAt(t *kernel.Task, dirFD kdefs.FD, addr usermem.Addr, flags uint, mod
 			// Like sys_open, check for a few things about the
 			// filesystem before trying to get a reference to the
 			// fs.File. The same constraints on Check apply.
-			if err := targetDirent.Inode.CheckPermission(t, flagsToPermissions(flags)); err != nil {
+			if err := targetDirent.CheckPermission(t, flagsToPermissions(flags)); err != nil {
 				return err
 			}
 
@@ -337,7 +363,7 @@ func createAt(t *kernel.Task, dirFD kdefs.FD, addr usermem.Addr, flags uint, mod
 			return err
 		default:
 			// Do we have write permissions on the parent?
-			if err := d.Inode.CheckPermission(t, fs.PermMask{Write: true, Execute: true}); err != nil {
+			if err := d.CheckPermission(t, fs.PermMask{Write: true, Execute: true}); err != nil {
 				return err
 			}
 
@@ -379,10 +405,10 @@ func Open(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallC
 	flags := uint(args[1].Uint())
 	if flags&syscall.O_CREAT != 0 {
 		mode := linux.FileMode(args[2].ModeT())
-		n, err := createAt(t, linux.AT_FDCWD, addr, flags, mode)
+		n, err := createAt(t, linux.AT_FDCWD, addr, flags, mode, fs.ResolveOptions{})
 		return n, nil, err
 	}
-	n, err := openAt(t, linux.AT_FDCWD, addr, flags)
+	n, err := openAt(t, linux.AT_FDCWD, addr, flags, fs.ResolveOptions{})
 	return n, nil, err
 }
 
@@ -393,10 +419,88 @@ func Openat(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Syscal
 	flags := uint(args[2].Uint())
 	if flags&syscall.O_CREAT != 0 {
 		mode := linux.FileMode(args[3].ModeT())
-		n, err := createAt(t, dirFD, addr, flags, mode)
+		n, err := createAt(t, dirFD, addr, flags, mode, fs.ResolveOptions{})
 		return n, nil, err
 	}
-	n, err := openAt(t, dirFD, addr, flags)
+	n, err := openAt(t, dirFD, addr, flags, fs.ResolveOptions{})
+	return n, nil, err
+}
+
+// Flags accepted by openat2(2). Unlike openat(2), openat2(2) rejects unknown
+// flags.
+const (
+	// openat2Flags are the O_* flags accepted by openat2(2), Linux's
+	// VALID_OPEN_FLAGS.
+	openat2Flags = syscall.O_RDONLY | syscall.O_WRONLY | syscall.O_RDWR | syscall.O_CREAT | syscall.O_EXCL | syscall.O_NOCTTY | syscall.O_TRUNC | syscall.O_APPEND | syscall.O_NONBLOCK | syscall.O_SYNC | syscall.O_DSYNC | syscall.O_ASYNC | syscall.O_DIRECT | openat2LargeFile | syscall.O_DIRECTORY | syscall.O_NOFOLLOW | syscall.O_NOATIME | syscall.O_CLOEXEC | linux.O_PATH | openat2TmpFile
+
+	// openat2LargeFile is Linux's O_LARGEFILE, which package syscall
+	// defines as 0 on 64-bit architectures, where it is implied.
+	openat2LargeFile = 0100000
+
+	// openat2TmpFile is Linux's __O_TMPFILE, which O_TMPFILE combines with
+	// O_DIRECTORY.
+	openat2TmpFile = 020000000
+
+	// openat2PathFlags are the only flags that may be combined with O_PATH.
+	openat2PathFlags = syscall.O_DIRECTORY | syscall.O_NOFOLLOW | linux.O_PATH | syscall.O_CLOEXEC
+
+	// openat2Resolve are the RESOLVE_* flags accepted by openat2(2).
+	openat2Resolve = linux.RESOLVE_NO_XDEV | linux.RESOLVE_NO_MAGICLINKS | linux.RESOLVE_NO_SYMLINKS | linux.RESOLVE_BENEATH | linux.RESOLVE_IN_ROOT | linux.RESOLVE_CACHED
+)
+
+// Openat2 implements linux syscall openat2(2).
+func Openat2(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	dirFD := kdefs.FD(args[0].Int())
+	addr := args[1].Pointer()
+	howAddr := args[2].Pointer()
+	size := args[3].SizeT()
+
+	var how linux.OpenHow
+	if err := copyInExtensible(t, howAddr, size, linux.OPEN_HOW_SIZE_VER0, &how); err != nil {
+		return 0, nil, err
+	}
+
+	// Mirrors fs/open.c:build_open_flags().
+	if how.Flags&^openat2Flags != 0 {
+		return 0, nil, syserror.EINVAL
+	}
+	if how.Flags&linux.O_PATH != 0 && how.Flags&^openat2PathFlags != 0 {
+		return 0, nil, syserror.EINVAL
+	}
+	if how.Flags&(syscall.O_CREAT|openat2TmpFile) != 0 {
+		if how.Mode&^07777 != 0 {
+			return 0, nil, syserror.EINVAL
+		}
+	} else if how.Mode != 0 {
+		return 0, nil, syserror.EINVAL
+	}
+	if how.Resolve&^openat2Resolve != 0 {
+		return 0, nil, syserror.EINVAL
+	}
+	// RESOLVE_BENEATH and RESOLVE_IN_ROOT are contradictory.
+	if how.Resolve&linux.RESOLVE_BENEATH != 0 && how.Resolve&linux.RESOLVE_IN_ROOT != 0 {
+		return 0, nil, syserror.EINVAL
+	}
+	// Paths are not resolved from a cache that could be consulted without
+	// blocking, so RESOLVE_CACHED always asks the caller to retry without
+	// it, as Linux does when a path is not cached.
+	if how.Resolve&linux.RESOLVE_CACHED != 0 {
+		return 0, nil, syserror.EAGAIN
+	}
+
+	opts := fs.ResolveOptions{
+		Beneath:      how.Resolve&linux.RESOLVE_BENEATH != 0,
+		InRoot:       how.Resolve&linux.RESOLVE_IN_ROOT != 0,
+		NoSymlinks:   how.Resolve&linux.RESOLVE_NO_SYMLINKS != 0,
+		NoMagicLinks: how.Resolve&linux.RESOLVE_NO_MAGICLINKS != 0,
+		NoXDev:       how.Resolve&linux.RESOLVE_NO_XDEV != 0,
+	}
+	flags := uint(how.Flags)
+	if flags&syscall.O_CREAT != 0 {
+		n, err := createAt(t, dirFD, addr, flags, linux.FileMode(how.Mode), opts)
+		return n, nil, err
+	}
+	n, err := openAt(t, dirFD, addr, flags, opts)
 	return n, nil, err
 }
 
@@ -404,7 +508,7 @@ func Openat(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Syscal
 func Creat(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
 	addr := args[0].Pointer()
 	mode := linux.FileMode(args[1].ModeT())
-	n, err := createAt(t, linux.AT_FDCWD, addr, syscall.O_WRONLY|syscall.O_TRUNC, mode)
+	n, err := createAt(t, linux.AT_FDCWD, addr, syscall.O_WRONLY|syscall.O_TRUNC, mode, fs.ResolveOptions{})
 	return n, nil, err
 }
 
@@ -531,6 +635,9 @@ func Ioctl(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Syscall
 	default:
 		ret, err := file.FileOperations.Ioctl(t, t.MemoryManager(), args)
 		if err != nil {
+			if err == syserror.ENOTTY {
+				t.Kernel().Compat().RecordIoctl(uint32(request), fmt.Sprintf("%T", file.FileOperations), args)
+			}
 			return 0, nil, err
 		}
 
@@ -662,6 +769,42 @@ func Close(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Syscall
 	return 0, nil, handleIOError(t, false /* partial */, err, syscall.EINTR, "close", file)
 }
 
+// CloseRange implements linux syscall close_range(2).
+func CloseRange(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	first := args[0].Uint()
+	last := args[1].Uint()
+	flags := args[2].Uint()
+
+	if flags&^(linux.CLOSE_RANGE_UNSHARE|linux.CLOSE_RANGE_CLOEXEC) != 0 || first > last {
+		return 0, nil, syserror.EINVAL
+	}
+	// FDs are ints, so larger values can't be valid.
+	if first > math.MaxInt32 {
+		return 0, nil, nil
+	}
+	if last > math.MaxInt32 {
+		last = math.MaxInt32
+	}
+
+	if flags&linux.CLOSE_RANGE_UNSHARE != 0 {
+		if err := t.Unshare(&kernel.SharingOptions{NewFiles: true}); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	if flags&linux.CLOSE_RANGE_CLOEXEC != 0 {
+		t.FDMap().SetFlagsRange(kdefs.FD(first), kdefs.FD(last), kernel.FDFlags{CloseOnExec: true})
+		return 0, nil, nil
+	}
+
+	// As in Linux, errors from flushing the files are not reported.
+	for _, file := range t.FDMap().RemoveRange(kdefs.FD(first), kdefs.FD(last)) {
+		file.Flush(t)
+		file.DecRef()
+	}
+	return 0, nil, nil
+}
+
 // Dup implements linux syscall dup(2).
 func Dup(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
 	fd := kdefs.FD(args[0].Int())
@@ -753,7 +896,7 @@ func Fcntl(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Syscall
 			CloseOnExec: flags&syscall.FD_CLOEXEC != 0,
 		})
 	case syscall.F_GETFL:
-		return uintptr(flagsToLinux(file.Flags())), nil, nil
+		return uintptr(file.Flags().ToLinux()), nil, nil
 	case syscall.F_SETFL:
 		flags := uint(args[2].Uint())
 		file.SetFlags(linuxToSettableFlags(flags))
@@ -931,7 +1074,7 @@ func mkdirAt(t *kernel.Task, dirFD kdefs.FD, addr usermem.Addr, mode linux.FileM
 			return err
 		default:
 			// Do we have write permissions on the parent?
-			if err := d.Inode.CheckPermission(t, fs.PermMask{Write: true, Execute: true}); err != nil {
+			if err := d.CheckPermission(t, fs.PermMask{Write: true, Execute: true}); err != nil {
 				return err
 			}
 
@@ -1017,7 +1160,7 @@ func symlinkAt(t *kernel.Task, dirFD kdefs.FD, newAddr usermem.Addr, oldAddr use
 		}
 
 		// Make sure we have write permissions on the parent directory.
-		if err := d.Inode.CheckPermission(t, fs.PermMask{Write: true, Execute: true}); err != nil {
+		if err := d.CheckPermission(t, fs.PermMask{Write: true, Execute: true}); err != nil {
 			return err
 		}
 		return d.CreateLink(t, root, oldPath, name)
@@ -1093,7 +1236,7 @@ func linkAt(t *kernel.Task, oldDirFD kdefs.FD, oldAddr usermem.Addr, newDirFD kd
 			}
 
 			// Make sure we have write permissions on the parent directory.
-			if err := newParent.Inode.CheckPermission(t, fs.PermMask{Write: true, Execute: true}); err != nil {
+			if err := newParent.CheckPermission(t, fs.PermMask{Write: true, Execute: true}); err != nil {
 				return err
 			}
 			return newParent.CreateHardLink(t, root, target.Dirent, newName)
@@ -1114,7 +1257,7 @@ func linkAt(t *kernel.Task, oldDirFD kdefs.FD, oldAddr usermem.Addr, newDirFD kd
 			}
 
 			// Make sure we have write permissions on the parent directory.
-			if err := newParent.Inode.CheckPermission(t, fs.PermMask{Write: true, Execute: true}); err != nil {
+			if err := newParent.CheckPermission(t, fs.PermMask{Write: true, Execute: true}); err != nil {
 				return err
 			}
 			return newParent.CreateHardLink(t, root, target, newName)
@@ -1293,7 +1436,7 @@ func Truncate(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Sysc
 
 		// Reject truncation if the access permissions do not allow truncation.
 		// This is different from the behavior of sys_ftruncate, see below.
-		if err := d.Inode.CheckPermission(t, fs.PermMask{Write: true}); err != nil {
+		if err := d.CheckPermission(t, fs.PermMask{Write: true}); err != nil {
 			return err
 		}
 
@@ -1576,7 +1719,7 @@ func utimes(t *kernel.Task, dirFD kdefs.FD, addr usermem.Addr, ts fs.TimeSpec, r
 			}
 
 			// Trying to set to current system time? Must have write access.
-			if err := d.Inode.CheckPermission(t, fs.PermMask{Write: true}); err != nil {
+			if err := d.CheckPermission(t, fs.PermMask{Write: true}); err != nil {
 				return err
 			}
 		}
@@ -1954,6 +2097,11 @@ func Sendfile(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Sysc
 		}
 	}
 
+	// Compare Linux's fs/read_write.c:do_sendfile(), which accounts the
+	// transfer as both a read and a write.
+	t.IOUsage().AccountReadSyscall(n)
+	t.IOUsage().AccountWriteSyscall(n)
+
 	// We can only pass a single file to handleIOError, so pick inFile
 	// arbitrarily.
 	return uintptr(n), nil, handleIOError(t, n != 0, err, kernel.ERESTARTSYS, "sendfile", inFile)
@@ -114,7 +114,7 @@ func InotifyAddWatch(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kern
 		}
 
 		// Copy out to the return frame.
-		fd = kdefs.FD(ino.AddWatch(dirent, mask))
+		fd = kdefs.FD(ino.AddWatch(t, dirent, mask))
 
 		return nil
 	})
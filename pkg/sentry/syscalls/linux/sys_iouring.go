@@ -0,0 +1,617 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+import (
+	"syscall"
+
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/arch"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel/eventfd"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel/iouring"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel/kdefs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usermem"
+	"gvisor.googlesource.com/gvisor/pkg/syserror"
+	"gvisor.googlesource.com/gvisor/pkg/waiter"
+)
+
+// ioUringSupportedOps are the opcodes implemented by ioUringSubmit, as
+// reported by IORING_REGISTER_PROBE.
+var ioUringSupportedOps = map[uint8]bool{
+	linux.IORING_OP_NOP:         true,
+	linux.IORING_OP_READV:       true,
+	linux.IORING_OP_WRITEV:      true,
+	linux.IORING_OP_FSYNC:       true,
+	linux.IORING_OP_READ_FIXED:  true,
+	linux.IORING_OP_WRITE_FIXED: true,
+	linux.IORING_OP_POLL_ADD:    true,
+	linux.IORING_OP_POLL_REMOVE: true,
+	linux.IORING_OP_READ:        true,
+	linux.IORING_OP_WRITE:       true,
+}
+
+// ioUringSqeFlags are the supported IOUringSqe.Flags. Requests always
+// complete asynchronously when they would block, so IOSQE_ASYNC needs no
+// handling.
+const ioUringSqeFlags = linux.IOSQE_FIXED_FILE | linux.IOSQE_ASYNC
+
+// IOUringSetup implements linux syscall io_uring_setup(2).
+func IOUringSetup(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	entries := args[0].Uint()
+	paramsAddr := args[1].Pointer()
+
+	var params linux.IOUringParams
+	if _, err := t.CopyIn(paramsAddr, &params); err != nil {
+		return 0, nil, err
+	}
+	for _, r := range params.Resv {
+		if r != 0 {
+			return 0, nil, syserror.EINVAL
+		}
+	}
+	// Only the completion queue size may be configured; in particular there
+	// is no kernel polling thread.
+	if params.Flags&^(linux.IORING_SETUP_CQSIZE|linux.IORING_SETUP_CLAMP) != 0 {
+		return 0, nil, syserror.EINVAL
+	}
+	clamp := params.Flags&linux.IORING_SETUP_CLAMP != 0
+
+	if entries == 0 {
+		return 0, nil, syserror.EINVAL
+	}
+	if entries > linux.IORING_MAX_ENTRIES {
+		if !clamp {
+			return 0, nil, syserror.EINVAL
+		}
+		entries = linux.IORING_MAX_ENTRIES
+	}
+	sqEntries := roundUpPowerOfTwo(entries)
+	cqEntries := 2 * sqEntries
+	if params.Flags&linux.IORING_SETUP_CQSIZE != 0 {
+		if params.CqEntries == 0 {
+			return 0, nil, syserror.EINVAL
+		}
+		cqEntries = params.CqEntries
+		if cqEntries > linux.IORING_MAX_CQ_ENTRIES {
+			if !clamp {
+				return 0, nil, syserror.EINVAL
+			}
+			cqEntries = linux.IORING_MAX_CQ_ENTRIES
+		}
+		cqEntries = roundUpPowerOfTwo(cqEntries)
+		if cqEntries < sqEntries {
+			return 0, nil, syserror.EINVAL
+		}
+	}
+
+	file, err := iouring.New(t, sqEntries, cqEntries)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer file.DecRef()
+
+	params.SqEntries = sqEntries
+	params.CqEntries = cqEntries
+	params.Features = linux.IORING_FEAT_SINGLE_MMAP | linux.IORING_FEAT_NODROP | linux.IORING_FEAT_SUBMIT_STABLE | linux.IORING_FEAT_RW_CUR_POS
+	params.SqOff, params.CqOff = file.FileOperations.(*iouring.Ring).Offsets()
+	if _, err := t.CopyOut(paramsAddr, &params); err != nil {
+		return 0, nil, err
+	}
+
+	// The file is always close-on-exec, as in Linux.
+	fd, err := t.FDMap().NewFDFrom(0, file, kernel.FDFlags{
+		CloseOnExec: true,
+	}, t.ThreadGroup().Limits())
+	if err != nil {
+		return 0, nil, err
+	}
+	return uintptr(fd), nil, nil
+}
+
+// roundUpPowerOfTwo returns the smallest power of two no less than n.
+//
+// Preconditions: 0 < n <= 1<<31.
+func roundUpPowerOfTwo(n uint32) uint32 {
+	p := uint32(1)
+	for p < n {
+		p <<= 1
+	}
+	return p
+}
+
+// getIOUring returns the io_uring file and ring for fd. The caller must drop
+// the returned file's reference.
+func getIOUring(t *kernel.Task, fd kdefs.FD) (*fs.File, *iouring.Ring, error) {
+	file := t.FDMap().GetFile(fd)
+	if file == nil {
+		return nil, nil, syserror.EBADF
+	}
+	r, ok := file.FileOperations.(*iouring.Ring)
+	if !ok {
+		file.DecRef()
+		return nil, nil, syserror.EOPNOTSUPP
+	}
+	return file, r, nil
+}
+
+// IOUringEnter implements linux syscall io_uring_enter(2).
+func IOUringEnter(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	fd := kdefs.FD(args[0].Int())
+	toSubmit := args[1].Uint()
+	minComplete := args[2].Uint()
+	flags := args[3].Uint()
+	maskAddr := args[4].Pointer()
+	maskSize := uint(args[5].Uint())
+
+	if flags&^(linux.IORING_ENTER_GETEVENTS|linux.IORING_ENTER_SQ_WAKEUP) != 0 {
+		return 0, nil, syserror.EINVAL
+	}
+
+	file, r, err := getIOUring(t, fd)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer file.DecRef()
+
+	var submitted uint32
+	if toSubmit > 0 {
+		if r.Overflowed() {
+			return 0, nil, syserror.EBUSY
+		}
+		for submitted < toSubmit {
+			sqe, ok, err := r.PopSubmission()
+			if err != nil {
+				if submitted > 0 {
+					return uintptr(submitted), nil, nil
+				}
+				return 0, nil, err
+			}
+			if !ok {
+				break
+			}
+			ioUringSubmit(t, r, &sqe)
+			submitted++
+		}
+	}
+
+	if flags&linux.IORING_ENTER_GETEVENTS == 0 || minComplete == 0 {
+		return uintptr(submitted), nil, nil
+	}
+
+	if maskAddr != 0 {
+		mask, err := copyInSigSet(t, maskAddr, maskSize)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		oldmask := t.SignalMask()
+		t.SetSignalMask(mask)
+		t.SetSavedSignalMask(oldmask)
+	}
+
+	if max := r.CQEntries(); minComplete > max {
+		minComplete = max
+	}
+	e, ch := waiter.NewChannelEntry(nil)
+	r.EventRegister(&e, waiter.EventIn)
+	defer r.EventUnregister(&e)
+	for r.Completions() < minComplete {
+		if err := t.Block(ch); err != nil {
+			if submitted > 0 {
+				return uintptr(submitted), nil, nil
+			}
+			return 0, nil, syserror.ConvertIntr(err, syserror.EINTR)
+		}
+	}
+	return uintptr(submitted), nil, nil
+}
+
+// ioUringSubmit starts the request sqe. Its completion is posted to r,
+// possibly after ioUringSubmit returns.
+func ioUringSubmit(t *kernel.Task, r *iouring.Ring, sqe *linux.IOUringSqe) {
+	if sqe.Flags&^ioUringSqeFlags != 0 || !ioUringSupportedOps[sqe.Opcode] {
+		r.Complete(sqe.UserData, ioUringErr(t, syserror.EINVAL), false)
+		return
+	}
+
+	switch sqe.Opcode {
+	case linux.IORING_OP_NOP:
+		r.Complete(sqe.UserData, 0, false)
+		return
+	case linux.IORING_OP_POLL_REMOVE:
+		if !r.CancelPoll(sqe.Addr) {
+			r.Complete(sqe.UserData, ioUringErr(t, syserror.ENOENT), false)
+			return
+		}
+		r.Complete(sqe.Addr, ioUringErr(t, syscall.ECANCELED), false)
+		r.Complete(sqe.UserData, 0, false)
+		return
+	}
+
+	var file *fs.File
+	if sqe.Flags&linux.IOSQE_FIXED_FILE != 0 {
+		file = r.File(sqe.FD)
+	} else {
+		file = t.FDMap().GetFile(kdefs.FD(sqe.FD))
+	}
+	if file == nil {
+		r.Complete(sqe.UserData, ioUringErr(t, syserror.EBADF), false)
+		return
+	}
+	defer file.DecRef()
+
+	switch sqe.Opcode {
+	case linux.IORING_OP_FSYNC:
+		if sqe.OpFlags&^linux.IORING_FSYNC_DATASYNC != 0 {
+			r.Complete(sqe.UserData, ioUringErr(t, syserror.EINVAL), false)
+			return
+		}
+		file.IncRef()
+		userData := sqe.UserData
+		start, end, syncType := ioUringSyncRange(sqe)
+		fs.Async(func() {
+			err := file.Fsync(t.AsyncContext(), start, end, syncType)
+			file.DecRef()
+			r.Complete(userData, ioUringErr(t, err), true)
+		})
+
+	case linux.IORING_OP_POLL_ADD:
+		// Errors and hangups are always reported, as in Linux.
+		mask := waiter.EventMask(sqe.OpFlags) | waiter.EventErr | waiter.EventHUp
+		if ready := file.Readiness(mask); ready != 0 {
+			r.Complete(sqe.UserData, int32(ready), false)
+			return
+		}
+		userData := sqe.UserData
+		r.Wait(file, mask, userData, true /* poll */, func(ready waiter.EventMask) {
+			r.Complete(userData, int32(ready), true)
+		})
+
+	default:
+		ioseq, err := ioUringMemoryFor(t, r, sqe)
+		if err == nil {
+			err = ioUringCheckAccess(file, sqe.Opcode)
+		}
+		if err != nil {
+			r.Complete(sqe.UserData, ioUringErr(t, err), false)
+			return
+		}
+		// The request may reference the submission entry after it has been
+		// reused by the application (IORING_FEAT_SUBMIT_STABLE), so keep a
+		// copy.
+		req := *sqe
+		file.IncRef()
+		fs.Async(func() { ioUringReadWrite(t, r, file, &req, ioseq) })
+	}
+}
+
+// ioUringErr returns the completion result for err.
+func ioUringErr(t *kernel.Task, err error) int32 {
+	return -int32(t.ExtractErrno(err, 0))
+}
+
+// ioUringSyncRange returns the range and type of the sync requested by an
+// IORING_OP_FSYNC request.
+func ioUringSyncRange(sqe *linux.IOUringSqe) (int64, int64, fs.SyncType) {
+	syncType := fs.SyncAll
+	if sqe.OpFlags&linux.IORING_FSYNC_DATASYNC != 0 {
+		syncType = fs.SyncData
+	}
+	start := int64(sqe.Off)
+	end := int64(fs.FileMaxOffset)
+	if sqe.Len != 0 {
+		end = start + int64(sqe.Len)
+	}
+	return start, end, syncType
+}
+
+// ioUringIsRead returns true if op reads from a file.
+func ioUringIsRead(op uint8) bool {
+	switch op {
+	case linux.IORING_OP_READ, linux.IORING_OP_READV, linux.IORING_OP_READ_FIXED:
+		return true
+	default:
+		return false
+	}
+}
+
+// ioUringCheckAccess returns EBADF if file was not opened for the access made
+// by op.
+func ioUringCheckAccess(file *fs.File, op uint8) error {
+	if ioUringIsRead(op) {
+		if !file.Flags().Read {
+			return syserror.EBADF
+		}
+	} else if !file.Flags().Write {
+		return syserror.EBADF
+	}
+	return nil
+}
+
+// ioUringMemoryFor returns the memory read or written by a read or write
+// request.
+func ioUringMemoryFor(t *kernel.Task, r *iouring.Ring, sqe *linux.IOUringSqe) (usermem.IOSequence, error) {
+	length := int(sqe.Len)
+	if length < 0 {
+		return usermem.IOSequence{}, syserror.EINVAL
+	}
+
+	// As in aio, the request completes asynchronously with respect to t's
+	// task goroutine, so t's AddressSpace may not be active during the I/O.
+	opts := usermem.IOOpts{
+		AddressSpaceActive: false,
+	}
+	switch sqe.Opcode {
+	case linux.IORING_OP_READ, linux.IORING_OP_WRITE:
+		return t.SingleIOSequence(usermem.Addr(sqe.Addr), length, opts)
+
+	case linux.IORING_OP_READV, linux.IORING_OP_WRITEV:
+		return t.IovecsIOSequence(usermem.Addr(sqe.Addr), length, opts)
+
+	case linux.IORING_OP_READ_FIXED, linux.IORING_OP_WRITE_FIXED:
+		buf, ok := r.Buffer(sqe.BufIndex)
+		if !ok {
+			return usermem.IOSequence{}, syserror.EFAULT
+		}
+		ar, ok := usermem.Addr(sqe.Addr).ToRange(uint64(sqe.Len))
+		if !ok || !buf.IsSupersetOf(ar) {
+			return usermem.IOSequence{}, syserror.EFAULT
+		}
+		return t.SingleIOSequence(ar.Start, length, opts)
+
+	default:
+		return usermem.IOSequence{}, syserror.EINVAL
+	}
+}
+
+// ioUringReadWrite performs a read or write request and posts its
+// completion. If the file is not ready and was not opened with O_NONBLOCK,
+// the request is retried once the file is ready, as a blocking read(2) or
+// write(2) would be.
+//
+// ioUringReadWrite consumes the reference on file.
+func ioUringReadWrite(t *kernel.Task, r *iouring.Ring, file *fs.File, sqe *linux.IOUringSqe, ioseq usermem.IOSequence) {
+	c := t.AsyncContext()
+	read := ioUringIsRead(sqe.Opcode)
+
+	// An offset of -1 uses and advances the file offset
+	// (IORING_FEAT_RW_CUR_POS), as does any offset for files without one.
+	offset := int64(sqe.Off)
+	var n int64
+	var err error
+	if read {
+		if offset == -1 || !file.Flags().Pread {
+			n, err = file.Readv(c, ioseq)
+		} else {
+			n, err = file.Preadv(c, ioseq, offset)
+		}
+	} else {
+		if offset == -1 || !file.Flags().Pwrite {
+			n, err = file.Writev(c, ioseq)
+		} else {
+			n, err = file.Pwritev(c, ioseq, offset)
+		}
+	}
+
+	if n == 0 && err == syserror.ErrWouldBlock && !file.Flags().NonBlocking {
+		mask := waiter.EventIn
+		if !read {
+			mask = waiter.EventOut
+		}
+		if r.Wait(file, mask, sqe.UserData, false /* poll */, func(waiter.EventMask) {
+			ioUringReadWrite(t, r, file, sqe, ioseq)
+		}) {
+			return
+		}
+	}
+	file.DecRef()
+
+	if err != nil {
+		op := "io_uring read"
+		if !read {
+			op = "io_uring write"
+		}
+		if err = handleIOError(t, n != 0 /* partial */, err, nil /* never interrupted */, op, file); err != nil {
+			r.Complete(sqe.UserData, ioUringErr(t, err), true)
+			return
+		}
+	}
+	r.Complete(sqe.UserData, int32(n), true)
+}
+
+// IOUringRegister implements linux syscall io_uring_register(2).
+func IOUringRegister(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	fd := kdefs.FD(args[0].Int())
+	opcode := args[1].Uint()
+	addr := args[2].Pointer()
+	nrArgs := args[3].Uint()
+
+	file, r, err := getIOUring(t, fd)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer file.DecRef()
+
+	switch opcode {
+	case linux.IORING_REGISTER_BUFFERS:
+		if nrArgs == 0 || nrArgs > linux.UIO_MAXIOV {
+			return 0, nil, syserror.EINVAL
+		}
+		buffers, err := copyInIOUringBuffers(t, addr, int(nrArgs))
+		if err != nil {
+			return 0, nil, err
+		}
+		return 0, nil, r.RegisterBuffers(buffers)
+
+	case linux.IORING_REGISTER_FILES:
+		if nrArgs == 0 {
+			return 0, nil, syserror.EINVAL
+		}
+		if nrArgs > linux.IORING_MAX_FIXED_FILES {
+			return 0, nil, syserror.EMFILE
+		}
+		files, err := ioUringFiles(t, addr, int(nrArgs))
+		if err != nil {
+			return 0, nil, err
+		}
+		if err := r.RegisterFiles(files); err != nil {
+			decRefFiles(files)
+			return 0, nil, err
+		}
+		return 0, nil, nil
+
+	case linux.IORING_REGISTER_EVENTFD, linux.IORING_REGISTER_EVENTFD_ASYNC:
+		if nrArgs != 1 {
+			return 0, nil, syserror.EINVAL
+		}
+		var efd int32
+		if _, err := t.CopyIn(addr, &efd); err != nil {
+			return 0, nil, err
+		}
+		ev := t.FDMap().GetFile(kdefs.FD(efd))
+		if ev == nil {
+			return 0, nil, syserror.EBADF
+		}
+		if _, ok := ev.FileOperations.(*eventfd.EventOperations); !ok {
+			ev.DecRef()
+			return 0, nil, syserror.EINVAL
+		}
+		if err := r.RegisterEventfd(ev, opcode == linux.IORING_REGISTER_EVENTFD_ASYNC); err != nil {
+			ev.DecRef()
+			return 0, nil, err
+		}
+		return 0, nil, nil
+
+	case linux.IORING_UNREGISTER_BUFFERS, linux.IORING_UNREGISTER_FILES, linux.IORING_UNREGISTER_EVENTFD:
+		if addr != 0 || nrArgs != 0 {
+			return 0, nil, syserror.EINVAL
+		}
+		switch opcode {
+		case linux.IORING_UNREGISTER_BUFFERS:
+			return 0, nil, r.UnregisterBuffers()
+		case linux.IORING_UNREGISTER_FILES:
+			return 0, nil, r.UnregisterFiles()
+		default:
+			return 0, nil, r.UnregisterEventfd()
+		}
+
+	case linux.IORING_REGISTER_PROBE:
+		return 0, nil, ioUringProbe(t, addr, nrArgs)
+
+	default:
+		// IORING_REGISTER_FILES_UPDATE and personalities are not supported.
+		return 0, nil, syserror.EINVAL
+	}
+}
+
+// copyInIOUringBuffers copies in the n struct iovecs at addr describing
+// buffers to register.
+func copyInIOUringBuffers(t *kernel.Task, addr usermem.Addr, n int) ([]usermem.AddrRange, error) {
+	// Linux limits each buffer to 1GB.
+	const maxBufferSize = 1 << 30
+
+	iovecs := make([]uint64, 2*n)
+	if _, err := t.CopyIn(addr, iovecs); err != nil {
+		return nil, err
+	}
+	buffers := make([]usermem.AddrRange, 0, n)
+	for i := 0; i < n; i++ {
+		base, length := iovecs[2*i], iovecs[2*i+1]
+		if base == 0 || length == 0 || length > maxBufferSize {
+			return nil, syserror.EFAULT
+		}
+		ar, ok := usermem.Addr(base).ToRange(length)
+		if !ok {
+			return nil, syserror.EFAULT
+		}
+		buffers = append(buffers, ar)
+	}
+	return buffers, nil
+}
+
+// ioUringFiles returns references to the files for the n file descriptors at
+// addr. A descriptor of -1 leaves its slot empty.
+func ioUringFiles(t *kernel.Task, addr usermem.Addr, n int) ([]*fs.File, error) {
+	fds := make([]int32, n)
+	if _, err := t.CopyIn(addr, fds); err != nil {
+		return nil, err
+	}
+	files := make([]*fs.File, n)
+	for i, fd := range fds {
+		if fd == -1 {
+			continue
+		}
+		f := t.FDMap().GetFile(kdefs.FD(fd))
+		if f == nil {
+			decRefFiles(files)
+			return nil, syserror.EBADF
+		}
+		// Registering an io_uring with itself, or another io_uring, could
+		// create a reference cycle; Linux rejects it too.
+		if _, ok := f.FileOperations.(*iouring.Ring); ok {
+			f.DecRef()
+			decRefFiles(files)
+			return nil, syserror.EBADF
+		}
+		files[i] = f
+	}
+	return files, nil
+}
+
+// decRefFiles drops the references on the non-nil files in files.
+func decRefFiles(files []*fs.File) {
+	for _, f := range files {
+		if f != nil {
+			f.DecRef()
+		}
+	}
+}
+
+// ioUringProbe implements IORING_REGISTER_PROBE, reporting the supported
+// opcodes in the struct io_uring_probe at addr with room for n entries.
+func ioUringProbe(t *kernel.Task, addr usermem.Addr, n uint32) error {
+	if n > linux.IORING_OP_LAST {
+		n = linux.IORING_OP_LAST
+	}
+
+	// The probe must be zeroed by the caller.
+	buf := make([]byte, linux.SizeOfIOUringProbe+n*linux.SizeOfIOUringProbeOp)
+	if _, err := t.CopyInBytes(addr, buf); err != nil {
+		return err
+	}
+	for _, b := range buf {
+		if b != 0 {
+			return syserror.EINVAL
+		}
+	}
+
+	var probe linux.IOUringProbe
+	ops := make([]linux.IOUringProbeOp, n)
+	probe.LastOp = linux.IORING_OP_LAST - 1
+	probe.OpsLen = uint8(n)
+	for i := range ops {
+		ops[i].Op = uint8(i)
+		if ioUringSupportedOps[uint8(i)] {
+			ops[i].Flags = linux.IO_URING_OP_SUPPORTED
+		}
+	}
+	if _, err := t.CopyOut(addr, &probe); err != nil {
+		return err
+	}
+	_, err := t.CopyOut(addr+linux.SizeOfIOUringProbe, ops)
+	return err
+}
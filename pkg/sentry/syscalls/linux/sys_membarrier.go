@@ -0,0 +1,86 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+import (
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/arch"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
+	"gvisor.googlesource.com/gvisor/pkg/syserror"
+)
+
+// membarrierCommands is the set of membarrier(2) commands reported by
+// MEMBARRIER_CMD_QUERY. Commands that use restartable sequences are not
+// supported.
+const membarrierCommands = linux.MEMBARRIER_CMD_GLOBAL |
+	linux.MEMBARRIER_CMD_GLOBAL_EXPEDITED |
+	linux.MEMBARRIER_CMD_REGISTER_GLOBAL_EXPEDITED |
+	linux.MEMBARRIER_CMD_PRIVATE_EXPEDITED |
+	linux.MEMBARRIER_CMD_REGISTER_PRIVATE_EXPEDITED |
+	linux.MEMBARRIER_CMD_PRIVATE_EXPEDITED_SYNC_CORE |
+	linux.MEMBARRIER_CMD_REGISTER_PRIVATE_EXPEDITED_SYNC_CORE
+
+// Membarrier implements syscall membarrier(2).
+func Membarrier(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	cmd := args[0].Int()
+	flags := args[1].Uint()
+
+	if flags != 0 {
+		// MEMBARRIER_CMD_FLAG_CPU is only valid with
+		// MEMBARRIER_CMD_PRIVATE_EXPEDITED_RSEQ, which is unsupported.
+		return 0, nil, syserror.EINVAL
+	}
+
+	switch cmd {
+	case linux.MEMBARRIER_CMD_QUERY:
+		return membarrierCommands, nil, nil
+
+	case linux.MEMBARRIER_CMD_GLOBAL, linux.MEMBARRIER_CMD_GLOBAL_EXPEDITED:
+		// Linux only requires MEMBARRIER_CMD_GLOBAL_EXPEDITED to affect
+		// processes that have registered for it, but affecting all tasks
+		// is equally correct.
+		t.Membarrier(false /* private */)
+		return 0, nil, nil
+
+	case linux.MEMBARRIER_CMD_REGISTER_GLOBAL_EXPEDITED:
+		// Every task is already affected by MEMBARRIER_CMD_GLOBAL_EXPEDITED.
+		return 0, nil, nil
+
+	case linux.MEMBARRIER_CMD_PRIVATE_EXPEDITED:
+		if !t.MemoryManager().IsMembarrierPrivateEnabled() {
+			return 0, nil, syserror.EPERM
+		}
+		t.Membarrier(true /* private */)
+		return 0, nil, nil
+
+	case linux.MEMBARRIER_CMD_REGISTER_PRIVATE_EXPEDITED:
+		t.MemoryManager().EnableMembarrierPrivate()
+		return 0, nil, nil
+
+	case linux.MEMBARRIER_CMD_PRIVATE_EXPEDITED_SYNC_CORE:
+		if !t.MemoryManager().IsMembarrierSyncCoreEnabled() {
+			return 0, nil, syserror.EPERM
+		}
+		t.Membarrier(true /* private */)
+		return 0, nil, nil
+
+	case linux.MEMBARRIER_CMD_REGISTER_PRIVATE_EXPEDITED_SYNC_CORE:
+		t.MemoryManager().EnableMembarrierSyncCore()
+		return 0, nil, nil
+
+	default:
+		return 0, nil, syserror.EINVAL
+	}
+}
@@ -113,8 +113,18 @@ func Umount2(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Sysca
 	addr := args[0].Pointer()
 	flags := args[1].Int()
 
-	const unsupported = linux.MNT_FORCE | linux.MNT_EXPIRE
-	if flags&unsupported != 0 {
+	const valid = linux.MNT_FORCE | linux.MNT_DETACH | linux.MNT_EXPIRE | linux.UMOUNT_NOFOLLOW
+	if flags&^valid != 0 {
+		return 0, nil, syserror.EINVAL
+	}
+
+	// MNT_EXPIRE cannot be combined with MNT_FORCE or MNT_DETACH. We don't
+	// implement mount expiry at all.
+	//
+	// MNT_FORCE is accepted: none of our filesystems have in-flight
+	// requests to abort (Linux's umount_begin), so it behaves like a plain
+	// unmount.
+	if flags&linux.MNT_EXPIRE != 0 {
 		return 0, nil, syserror.EINVAL
 	}
 
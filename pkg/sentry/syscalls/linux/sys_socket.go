@@ -755,6 +755,10 @@ func recvSingleMsg(t *kernel.Task, s socket.Socket, msgPtr usermem.Addr, flags i
 		controlData = control.PackCredentials(t, creds, controlData)
 	}
 
+	if sp, ok := s.(unix.SecurityPasser); ok && sp.Passsec() {
+		controlData = control.PackSecurity(t, controlData)
+	}
+
 	if cms.IP.HasTimestamp {
 		controlData = control.PackTimestamp(t, cms.IP.Timestamp, controlData)
 	}
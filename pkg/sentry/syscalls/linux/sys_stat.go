@@ -108,8 +108,28 @@ func stat(t *kernel.Task, d *fs.Dirent, dirPath bool, statAddr usermem.Addr) err
 		return err
 	}
 
+	_, err = t.CopyOut(statAddr, linux.Stat{
+		Dev:     uint64(d.Inode.StableAttr.DeviceID),
+		Rdev:    uint64(linux.MakeDeviceID(d.Inode.StableAttr.DeviceFileMajor, d.Inode.StableAttr.DeviceFileMinor)),
+		Ino:     uint64(d.Inode.StableAttr.InodeID),
+		Nlink:   uattr.Links,
+		Mode:    fileType(d.Inode.StableAttr) | uint32(uattr.Perms.LinuxMode()),
+		UID:     uint32(uattr.Owner.UID.In(t.UserNamespace()).OrOverflow()),
+		GID:     uint32(uattr.Owner.GID.In(t.UserNamespace()).OrOverflow()),
+		Size:    uattr.Size,
+		Blksize: d.Inode.StableAttr.BlockSize,
+		Blocks:  uattr.Usage / 512,
+		ATime:   uattr.AccessTime.Timespec(),
+		MTime:   uattr.ModificationTime.Timespec(),
+		CTime:   uattr.StatusChangeTime.Timespec(),
+	})
+	return err
+}
+
+// fileType returns the file type bits of the mode of a file.
+func fileType(sattr fs.StableAttr) uint32 {
 	var mode uint32
-	switch d.Inode.StableAttr.Type {
+	switch sattr.Type {
 	case fs.RegularFile, fs.SpecialFile:
 		mode |= linux.ModeRegular
 	case fs.Symlink:
@@ -125,22 +145,104 @@ func stat(t *kernel.Task, d *fs.Dirent, dirPath bool, statAddr usermem.Addr) err
 	case fs.Socket:
 		mode |= linux.ModeSocket
 	}
+	return mode
+}
 
-	_, err = t.CopyOut(statAddr, linux.Stat{
-		Dev:     uint64(d.Inode.StableAttr.DeviceID),
-		Rdev:    uint64(linux.MakeDeviceID(d.Inode.StableAttr.DeviceFileMajor, d.Inode.StableAttr.DeviceFileMinor)),
-		Ino:     uint64(d.Inode.StableAttr.InodeID),
-		Nlink:   uattr.Links,
-		Mode:    mode | uint32(uattr.Perms.LinuxMode()),
-		UID:     uint32(uattr.Owner.UID.In(t.UserNamespace()).OrOverflow()),
-		GID:     uint32(uattr.Owner.GID.In(t.UserNamespace()).OrOverflow()),
-		Size:    uattr.Size,
-		Blksize: d.Inode.StableAttr.BlockSize,
-		Blocks:  uattr.Usage / 512,
-		ATime:   uattr.AccessTime.Timespec(),
-		MTime:   uattr.ModificationTime.Timespec(),
-		CTime:   uattr.StatusChangeTime.Timespec(),
+// Statx implements linux syscall statx(2).
+func Statx(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	fd := kdefs.FD(args[0].Int())
+	pathAddr := args[1].Pointer()
+	flags := args[2].Int()
+	mask := args[3].Uint()
+	statxAddr := args[4].Pointer()
+
+	if mask&linux.STATX__RESERVED != 0 {
+		return 0, nil, syserror.EINVAL
+	}
+	if flags&^(linux.AT_SYMLINK_NOFOLLOW|linux.AT_EMPTY_PATH|linux.AT_NO_AUTOMOUNT|linux.AT_STATX_SYNC_TYPE) != 0 {
+		return 0, nil, syserror.EINVAL
+	}
+	if flags&linux.AT_STATX_SYNC_TYPE == linux.AT_STATX_SYNC_TYPE {
+		return 0, nil, syserror.EINVAL
+	}
+
+	path, dirPath, err := copyInPath(t, pathAddr, flags&linux.AT_EMPTY_PATH != 0)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if path == "" {
+		file := t.FDMap().GetFile(fd)
+		if file == nil {
+			return 0, nil, syserror.EBADF
+		}
+		defer file.DecRef()
+
+		return 0, nil, statx(t, file.Dirent, false /* dirPath */, flags, statxAddr)
+	}
+
+	// There are no automounts, so AT_NO_AUTOMOUNT has no effect.
+	return 0, nil, fileOpOn(t, fd, path, flags&linux.AT_SYMLINK_NOFOLLOW == 0, func(root *fs.Dirent, d *fs.Dirent) error {
+		return statx(t, d, dirPath, flags, statxAddr)
 	})
+}
+
+// statx implements statx from the given *fs.Dirent.
+//
+// All available fields are filled regardless of the requested mask, as
+// Linux does, since none are more costly to get than the others.
+func statx(t *kernel.Task, d *fs.Dirent, dirPath bool, flags int32, statxAddr usermem.Addr) error {
+	if dirPath && !fs.IsDir(d.Inode.StableAttr) {
+		return syserror.ENOTDIR
+	}
+
+	// Filesystems that cache attributes are authoritative for them, so
+	// syncing only requires writing back what is cached. Attributes are
+	// always returned from cache if there is one, so AT_STATX_DONT_SYNC
+	// is the same as AT_STATX_SYNC_AS_STAT.
+	if flags&linux.AT_STATX_SYNC_TYPE == linux.AT_STATX_FORCE_SYNC {
+		if err := d.Inode.WriteOut(t); err != nil {
+			return err
+		}
+	}
+
+	uattr, err := d.Inode.UnstableAttr(t)
+	if err != nil {
+		return err
+	}
+
+	sattr := d.Inode.StableAttr
+	msrc := d.Inode.MountSource
+	rdevMajor, rdevMinor := sattr.DeviceFileMajor, sattr.DeviceFileMinor
+	devMajor, devMinor := linux.DecodeDeviceID(uint32(sattr.DeviceID))
+	s := linux.Statx{
+		Mask:           linux.STATX_BASIC_STATS | linux.STATX_MNT_ID,
+		Blksize:        uint32(sattr.BlockSize),
+		Nlink:          uint32(uattr.Links),
+		UID:            uint32(uattr.Owner.UID.In(t.UserNamespace()).OrOverflow()),
+		GID:            uint32(uattr.Owner.GID.In(t.UserNamespace()).OrOverflow()),
+		Mode:           uint16(fileType(sattr) | uint32(uattr.Perms.LinuxMode())),
+		Ino:            sattr.InodeID,
+		Size:           uint64(uattr.Size),
+		Blocks:         uint64(uattr.Usage) / 512,
+		AttributesMask: linux.STATX_ATTR_MOUNT_ROOT,
+		Atime:          linux.NsecToStatxTimestamp(uattr.AccessTime.Nanoseconds()),
+		Ctime:          linux.NsecToStatxTimestamp(uattr.StatusChangeTime.Nanoseconds()),
+		Mtime:          linux.NsecToStatxTimestamp(uattr.ModificationTime.Nanoseconds()),
+		RdevMajor:      uint32(rdevMajor),
+		RdevMinor:      rdevMinor,
+		DevMajor:       uint32(devMajor),
+		DevMinor:       devMinor,
+		MntID:          msrc.ID(),
+	}
+	if !uattr.CreationTime.IsZero() {
+		s.Mask |= linux.STATX_BTIME
+		s.Btime = linux.NsecToStatxTimestamp(uattr.CreationTime.Nanoseconds())
+	}
+	if msrc.Root() == d {
+		s.Attributes |= linux.STATX_ATTR_MOUNT_ROOT
+	}
+	_, err = t.CopyOut(statxAddr, &s)
 	return err
 }
 
@@ -15,6 +15,7 @@
 package linux
 
 import (
+	"math"
 	"syscall"
 
 	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
@@ -128,7 +129,15 @@ func ExitGroup(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Sys
 
 // clone is used by Clone, Fork, and VFork.
 func clone(t *kernel.Task, flags int, stack usermem.Addr, parentTID usermem.Addr, childTID usermem.Addr, tls usermem.Addr) (uintptr, *kernel.SyscallControl, error) {
-	opts := kernel.CloneOptions{
+	opts := cloneOptions(flags, stack, parentTID, childTID, tls)
+	ntid, ctrl, err := t.Clone(&opts)
+	return uintptr(ntid), ctrl, err
+}
+
+// cloneOptions returns the kernel.CloneOptions for the given clone(2)
+// arguments.
+func cloneOptions(flags int, stack usermem.Addr, parentTID usermem.Addr, childTID usermem.Addr, tls usermem.Addr) kernel.CloneOptions {
+	return kernel.CloneOptions{
 		SharingOptions: kernel.SharingOptions{
 			NewAddressSpace:     flags&syscall.CLONE_VM == 0,
 			NewSignalHandlers:   flags&syscall.CLONE_SIGHAND == 0,
@@ -154,8 +163,6 @@ func clone(t *kernel.Task, flags int, stack usermem.Addr, parentTID usermem.Addr
 		Untraced:      flags&syscall.CLONE_UNTRACED == syscall.CLONE_UNTRACED,
 		InheritTracer: flags&syscall.CLONE_PTRACE == syscall.CLONE_PTRACE,
 	}
-	ntid, ctrl, err := t.Clone(&opts)
-	return uintptr(ntid), ctrl, err
 }
 
 // Clone implements linux syscall clone(2).
@@ -171,6 +178,75 @@ func Clone(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Syscall
 	return clone(t, flags, stack, parentTID, childTID, tls)
 }
 
+// Clone3 implements linux syscall clone3(2).
+func Clone3(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	addr := args[0].Pointer()
+	size := args[1].SizeT()
+
+	var cargs linux.CloneArgs
+	if err := copyInExtensible(t, addr, size, linux.CLONE_ARGS_SIZE_VER0, &cargs); err != nil {
+		return 0, nil, err
+	}
+
+	// Mirrors kernel/fork.c:clone3_args_valid().
+	const knownFlags = 0xffffffff | linux.CLONE_CLEAR_SIGHAND | linux.CLONE_INTO_CGROUP
+	if cargs.Flags&^knownFlags != 0 {
+		return 0, nil, syserror.EINVAL
+	}
+	// The exit signal is passed in CloneArgs.ExitSignal instead, and
+	// CLONE_DETACHED is no longer meaningful.
+	if cargs.Flags&(exitSignalMask|syscall.CLONE_DETACHED) != 0 {
+		return 0, nil, syserror.EINVAL
+	}
+	if cargs.ExitSignal&^exitSignalMask != 0 || cargs.ExitSignal > linux.SignalMaximum {
+		return 0, nil, syserror.EINVAL
+	}
+	if cargs.Flags&(syscall.CLONE_THREAD|syscall.CLONE_PARENT) != 0 && cargs.ExitSignal != 0 {
+		return 0, nil, syserror.EINVAL
+	}
+	if (cargs.Stack == 0) != (cargs.StackSize == 0) {
+		return 0, nil, syserror.EINVAL
+	}
+	if cargs.SetTIDSize > linux.MAX_PID_NS_LEVEL || (cargs.SetTID == 0) != (cargs.SetTIDSize == 0) {
+		return 0, nil, syserror.EINVAL
+	}
+
+	// PID file descriptors are not supported.
+	if cargs.Flags&linux.CLONE_PIDFD != 0 {
+		return 0, nil, syserror.EINVAL
+	}
+	if cargs.Flags&linux.CLONE_INTO_CGROUP != 0 {
+		if cargs.Cgroup > math.MaxInt32 {
+			return 0, nil, syserror.EINVAL
+		}
+		// There is no cgroup filesystem, so no file descriptor can refer
+		// to a cgroup.
+		return 0, nil, syserror.EBADF
+	}
+
+	var setTIDs []kernel.ThreadID
+	if cargs.SetTIDSize != 0 {
+		tids := make([]int32, cargs.SetTIDSize)
+		if _, err := t.CopyIn(usermem.Addr(cargs.SetTID), tids); err != nil {
+			return 0, nil, err
+		}
+		setTIDs = make([]kernel.ThreadID, len(tids))
+		for i, tid := range tids {
+			setTIDs[i] = kernel.ThreadID(tid)
+		}
+	}
+
+	// The stack grows down from the end of the region described by Stack and
+	// StackSize.
+	stack := usermem.Addr(cargs.Stack + cargs.StackSize)
+	opts := cloneOptions(int(cargs.Flags), stack, usermem.Addr(cargs.ParentTID), usermem.Addr(cargs.ChildTID), usermem.Addr(cargs.TLS))
+	opts.TerminationSignal = linux.Signal(cargs.ExitSignal)
+	opts.ClearSignalHandlers = cargs.Flags&linux.CLONE_CLEAR_SIGHAND != 0
+	opts.SetTIDs = setTIDs
+	ntid, ctrl, err := t.Clone(&opts)
+	return uintptr(ntid), ctrl, err
+}
+
 // Fork implements Linux syscall fork(2).
 func Fork(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
 	// "A call to fork() is equivalent to a call to clone(2) specifying flags
@@ -356,12 +432,12 @@ func Waitid(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Syscal
 	case s.Exited():
 		si.Code = arch.CLD_EXITED
 		si.SetStatus(int32(s.ExitStatus()))
-	case s.Signaled():
-		si.Code = arch.CLD_KILLED
-		si.SetStatus(int32(s.Signal()))
 	case s.CoreDump():
 		si.Code = arch.CLD_DUMPED
 		si.SetStatus(int32(s.Signal()))
+	case s.Signaled():
+		si.Code = arch.CLD_KILLED
+		si.SetStatus(int32(s.Signal()))
 	case s.Stopped():
 		if wr.Event == kernel.EventTraceeStop {
 			si.Code = arch.CLD_TRAPPED
@@ -124,6 +124,8 @@ func getClock(t *kernel.Task, clockID int32) (ktime.Clock, error) {
 	case linux.CLOCK_MONOTONIC, linux.CLOCK_MONOTONIC_COARSE, linux.CLOCK_MONOTONIC_RAW:
 		// CLOCK_MONOTONIC approximates CLOCK_MONOTONIC_RAW.
 		return t.Kernel().MonotonicClock(), nil
+	case linux.CLOCK_TAI:
+		return t.Kernel().TAIClock(), nil
 	case linux.CLOCK_PROCESS_CPUTIME_ID:
 		return t.ThreadGroup().CPUClock(), nil
 	case linux.CLOCK_THREAD_CPUTIME_ID:
@@ -147,8 +149,84 @@ func ClockGettime(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.
 }
 
 // ClockSettime implements linux syscall clock_settime(2).
-func ClockSettime(*kernel.Task, arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
-	return 0, nil, syserror.EPERM
+//
+// Only the sandbox's CLOCK_REALTIME may be set; the host clock is never
+// changed.
+func ClockSettime(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	clockID := int32(args[0].Int())
+	addr := args[1].Pointer()
+
+	if clockID != linux.CLOCK_REALTIME {
+		return 0, nil, syserror.EINVAL
+	}
+	ts, err := copyTimespecIn(t, addr)
+	if err != nil {
+		return 0, nil, err
+	}
+	if !ts.Valid() || ts.Sec < 0 {
+		return 0, nil, syserror.EINVAL
+	}
+	if !t.HasCapability(linux.CAP_SYS_TIME) {
+		return 0, nil, syserror.EPERM
+	}
+	return 0, nil, t.Kernel().SetRealtime(ktime.FromTimespec(ts))
+}
+
+// adjtime reads, and adjusts as requested by txc.Modes, the sandbox's
+// CLOCK_REALTIME, as adjtimex(2) does. The host clock is never changed.
+func adjtime(t *kernel.Task, txc *linux.Timex) (uintptr, error) {
+	readOnly := txc.Modes == 0
+	if txc.Modes&linux.ADJ_ADJTIME != 0 {
+		readOnly = txc.Modes&linux.ADJ_OFFSET_READONLY != 0
+	}
+	if !readOnly && !t.HasCapability(linux.CAP_SYS_TIME) {
+		return 0, syserror.EPERM
+	}
+	return t.Kernel().Adjtime(txc)
+}
+
+// Adjtimex implements linux syscall adjtimex(2).
+func Adjtimex(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	addr := args[0].Pointer()
+
+	var txc linux.Timex
+	if _, err := t.CopyIn(addr, &txc); err != nil {
+		return 0, nil, err
+	}
+	state, err := adjtime(t, &txc)
+	if err != nil {
+		return 0, nil, err
+	}
+	if _, err := t.CopyOut(addr, &txc); err != nil {
+		return 0, nil, err
+	}
+	return state, nil, nil
+}
+
+// ClockAdjtime implements linux syscall clock_adjtime(2).
+func ClockAdjtime(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	clockID := int32(args[0].Int())
+	addr := args[1].Pointer()
+
+	if _, err := getClock(t, clockID); err != nil {
+		return 0, nil, err
+	}
+	if clockID != linux.CLOCK_REALTIME {
+		return 0, nil, syserror.EOPNOTSUPP
+	}
+
+	var txc linux.Timex
+	if _, err := t.CopyIn(addr, &txc); err != nil {
+		return 0, nil, err
+	}
+	state, err := adjtime(t, &txc)
+	if err != nil {
+		return 0, nil, err
+	}
+	if _, err := t.CopyOut(addr, &txc); err != nil {
+		return 0, nil, err
+	}
+	return state, nil, nil
 }
 
 // Time implements linux syscall time(2).
@@ -296,6 +374,7 @@ func ClockNanosleep(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kerne
 	if clockID > 0 {
 		if clockID != linux.CLOCK_REALTIME &&
 			clockID != linux.CLOCK_MONOTONIC &&
+			clockID != linux.CLOCK_TAI &&
 			clockID != linux.CLOCK_PROCESS_CPUTIME_ID {
 			return 0, nil, syserror.EINVAL
 		}
@@ -314,6 +393,32 @@ func ClockNanosleep(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kerne
 	return 0, nil, clockNanosleepFor(t, c, dur, rem)
 }
 
+// Settimeofday implements linux syscall settimeofday(2).
+//
+// As with clock_settime(2), only the sandbox's CLOCK_REALTIME is set. The
+// timezone is ignored, as it is obsolete.
+func Settimeofday(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	tv := args[0].Pointer()
+
+	if tv == usermem.Addr(0) {
+		if !t.HasCapability(linux.CAP_SYS_TIME) {
+			return 0, nil, syserror.EPERM
+		}
+		return 0, nil, nil
+	}
+	nowTv, err := copyTimevalIn(t, tv)
+	if err != nil {
+		return 0, nil, err
+	}
+	if nowTv.Sec < 0 || nowTv.Usec < 0 || nowTv.Usec >= 1e6 {
+		return 0, nil, syserror.EINVAL
+	}
+	if !t.HasCapability(linux.CAP_SYS_TIME) {
+		return 0, nil, syserror.EPERM
+	}
+	return 0, nil, t.Kernel().SetRealtime(ktime.FromNanoseconds(nowTv.ToNsecCapped()))
+}
+
 // Gettimeofday implements linux syscall gettimeofday(2).
 func Gettimeofday(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
 	tv := args[0].Pointer()
@@ -0,0 +1,50 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+import (
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/arch"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel/userfaultfd"
+	"gvisor.googlesource.com/gvisor/pkg/syserror"
+)
+
+// Userfaultfd implements linux syscall userfaultfd(2).
+//
+// Only application faults are reported, so every userfaultfd behaves as if
+// created with UFFD_USER_MODE_ONLY, which Linux permits without privilege.
+func Userfaultfd(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	flags := args[0].Int()
+	if flags&^(linux.O_CLOEXEC|linux.O_NONBLOCK|linux.UFFD_USER_MODE_ONLY) != 0 {
+		return 0, nil, syserror.EINVAL
+	}
+
+	file := userfaultfd.New(t, t.MemoryManager())
+	defer file.DecRef()
+	file.SetFlags(fs.SettableFileFlags{
+		NonBlocking: flags&linux.O_NONBLOCK != 0,
+	})
+
+	fd, err := t.FDMap().NewFDFrom(0, file, kernel.FDFlags{
+		CloseOnExec: flags&linux.O_CLOEXEC != 0,
+	}, t.ThreadGroup().Limits())
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return uintptr(fd), nil, nil
+}
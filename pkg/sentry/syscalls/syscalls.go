@@ -63,8 +63,10 @@ func CapError(c linux.Capability) kernel.SyscallFn {
 }
 
 // UnimplementedEvent emits an UnimplementedSyscall event via the event
-// channel.
+// channel, and records the syscall in the kernel's CompatTracker.
 func UnimplementedEvent(t *kernel.Task) {
+	t.Kernel().Compat().RecordSyscall(t.Arch().SyscallNo(), t.Arch().SyscallArgs())
+	t.DumpTrace("Unimplemented syscall")
 	eventchannel.Emit(&uspb.UnimplementedSyscall{
 		Tid:       int32(t.ThreadID()),
 		Registers: t.Arch().StateData().Proto(),
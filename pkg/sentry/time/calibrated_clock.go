@@ -17,6 +17,7 @@
 package time
 
 import (
+	"fmt"
 	"sync"
 	"time"
 
@@ -32,7 +33,7 @@ var fallbackMetric = metric.MustCreateNewUint64Metric("/time/fallback", false /*
 
 // CalibratedClock implements a clock that tracks a reference clock.
 //
-// Users should call Update at regular intervals of around approxUpdateInterval
+// Users should call Update at regular intervals of around its update interval
 // to ensure that the clock does not drift significantly from the reference
 // clock.
 type CalibratedClock struct {
@@ -53,12 +54,18 @@ type CalibratedClock struct {
 
 	// errorNS is the estimated clock error in nanoseconds.
 	errorNS ReferenceNS
+
+	// updateInterval is the approximate interval at which Update is
+	// called. It is immutable.
+	updateInterval time.Duration
 }
 
-// NewCalibratedClock creates a CalibratedClock that tracks the given ClockID.
-func NewCalibratedClock(c ClockID) *CalibratedClock {
+// NewCalibratedClock creates a CalibratedClock that tracks the given ClockID,
+// and is updated at approximately the given interval.
+func NewCalibratedClock(c ClockID, updateInterval time.Duration) *CalibratedClock {
 	return &CalibratedClock{
-		ref: newSampler(c),
+		ref:            newSampler(c),
+		updateInterval: updateInterval,
 	}
 }
 
@@ -124,7 +131,7 @@ func (c *CalibratedClock) updateParams(actual Parameters) {
 	}
 
 	// Otherwise, adjust the params to correct for errors.
-	newParams, errorNS, err := errorAdjust(c.params, actual, actual.BaseCycles)
+	newParams, errorNS, err := errorAdjust(c.params, actual, actual.BaseCycles, c.updateInterval)
 	if err != nil {
 		// Something is very wrong. Reset and try again from the
 		// beginning.
@@ -133,7 +140,7 @@ func (c *CalibratedClock) updateParams(actual Parameters) {
 	}
 	logErrorAdjustment(c.ref.clockID, errorNS, c.params, newParams)
 
-	if errorNS.Magnitude() >= MaxClockError {
+	if errorNS.Magnitude() >= maxClockError(c.updateInterval) {
 		// We should never get such extreme error, something is very
 		// wrong. Reset everything and start again.
 		//
@@ -238,16 +245,31 @@ type CalibratedClocks struct {
 
 	// realtime is the realtime equivalent of monotonic.
 	realtime *CalibratedClock
+
+	// updateInterval is the approximate interval at which Update is
+	// called. It is immutable.
+	updateInterval time.Duration
 }
 
-// NewCalibratedClocks creates a CalibratedClocks.
-func NewCalibratedClocks() *CalibratedClocks {
+// NewCalibratedClocks creates a CalibratedClocks that is updated at
+// approximately the given interval, which must be between MinUpdateInterval
+// and MaxUpdateInterval.
+func NewCalibratedClocks(updateInterval time.Duration) *CalibratedClocks {
+	if updateInterval < MinUpdateInterval || updateInterval > MaxUpdateInterval {
+		panic(fmt.Sprintf("update interval %v out of range [%v, %v]", updateInterval, MinUpdateInterval, MaxUpdateInterval))
+	}
 	return &CalibratedClocks{
-		monotonic: NewCalibratedClock(Monotonic),
-		realtime:  NewCalibratedClock(Realtime),
+		monotonic:      NewCalibratedClock(Monotonic, updateInterval),
+		realtime:       NewCalibratedClock(Realtime, updateInterval),
+		updateInterval: updateInterval,
 	}
 }
 
+// UpdateInterval implements Clocks.UpdateInterval.
+func (c *CalibratedClocks) UpdateInterval() time.Duration {
+	return c.updateInterval
+}
+
 // Update implements Clocks.Update.
 func (c *CalibratedClocks) Update() (Parameters, bool, Parameters, bool) {
 	monotonicParams, monotonicOk := c.monotonic.Update()
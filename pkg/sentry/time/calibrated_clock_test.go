@@ -23,7 +23,8 @@ import (
 // the given sample list and cycle counts from the given cycle list.
 func newTestCalibratedClock(samples []sample, cycles []TSCValue) *CalibratedClock {
 	return &CalibratedClock{
-		ref: newTestSampler(samples, cycles),
+		ref:            newTestSampler(samples, cycles),
+		updateInterval: DefaultUpdateInterval,
 	}
 }
 
@@ -79,12 +80,12 @@ func TestErrorCorrection(t *testing.T) {
 		{
 			name: "slow-down",
 			samples: [5]sample{
-				{before: 1000000, after: 1000001, ref: ReferenceNS(1 * ApproxUpdateInterval.Nanoseconds())},
-				{before: 2000000, after: 2000001, ref: ReferenceNS(2 * ApproxUpdateInterval.Nanoseconds())},
+				{before: 1000000, after: 1000001, ref: ReferenceNS(1 * DefaultUpdateInterval.Nanoseconds())},
+				{before: 2000000, after: 2000001, ref: ReferenceNS(2 * DefaultUpdateInterval.Nanoseconds())},
 				// Reference clock has slowed down, causing 100ms of error.
-				{before: 3010000, after: 3010001, ref: ReferenceNS(3 * ApproxUpdateInterval.Nanoseconds())},
-				{before: 4020000, after: 4020001, ref: ReferenceNS(4 * ApproxUpdateInterval.Nanoseconds())},
-				{before: 5030000, after: 5030001, ref: ReferenceNS(5 * ApproxUpdateInterval.Nanoseconds())},
+				{before: 3010000, after: 3010001, ref: ReferenceNS(3 * DefaultUpdateInterval.Nanoseconds())},
+				{before: 4020000, after: 4020001, ref: ReferenceNS(4 * DefaultUpdateInterval.Nanoseconds())},
+				{before: 5030000, after: 5030001, ref: ReferenceNS(5 * DefaultUpdateInterval.Nanoseconds())},
 			},
 			projectedTimeStart: 3005 * time.Millisecond.Nanoseconds(),
 			projectedTimeEnd:   3015 * time.Millisecond.Nanoseconds(),
@@ -92,12 +93,12 @@ func TestErrorCorrection(t *testing.T) {
 		{
 			name: "speed-up",
 			samples: [5]sample{
-				{before: 1000000, after: 1000001, ref: ReferenceNS(1 * ApproxUpdateInterval.Nanoseconds())},
-				{before: 2000000, after: 2000001, ref: ReferenceNS(2 * ApproxUpdateInterval.Nanoseconds())},
+				{before: 1000000, after: 1000001, ref: ReferenceNS(1 * DefaultUpdateInterval.Nanoseconds())},
+				{before: 2000000, after: 2000001, ref: ReferenceNS(2 * DefaultUpdateInterval.Nanoseconds())},
 				// Reference clock has sped up, causing 100ms of error.
-				{before: 2990000, after: 2990001, ref: ReferenceNS(3 * ApproxUpdateInterval.Nanoseconds())},
-				{before: 3980000, after: 3980001, ref: ReferenceNS(4 * ApproxUpdateInterval.Nanoseconds())},
-				{before: 4970000, after: 4970001, ref: ReferenceNS(5 * ApproxUpdateInterval.Nanoseconds())},
+				{before: 2990000, after: 2990001, ref: ReferenceNS(3 * DefaultUpdateInterval.Nanoseconds())},
+				{before: 3980000, after: 3980001, ref: ReferenceNS(4 * DefaultUpdateInterval.Nanoseconds())},
+				{before: 4970000, after: 4970001, ref: ReferenceNS(5 * DefaultUpdateInterval.Nanoseconds())},
 			},
 			projectedTimeStart: 2985 * time.Millisecond.Nanoseconds(),
 			projectedTimeEnd:   2995 * time.Millisecond.Nanoseconds(),
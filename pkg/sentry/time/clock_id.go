@@ -25,6 +25,10 @@ type ClockID int32
 const (
 	Realtime ClockID = iota
 	Monotonic
+
+	// TAI is derived from Realtime by kernel.Timekeeper, by adding the TAI
+	// offset. Clocks implementations need not support it.
+	TAI
 )
 
 // String implements fmt.Stringer.String.
@@ -34,6 +38,8 @@ func (c ClockID) String() string {
 		return "Realtime"
 	case Monotonic:
 		return "Monotonic"
+	case TAI:
+		return "TAI"
 	default:
 		return strconv.Itoa(int(c))
 	}
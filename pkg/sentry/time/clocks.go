@@ -14,15 +14,23 @@
 
 package time
 
+import (
+	"time"
+)
+
 // Clocks represents a clock source that contains both a monotonic and realtime
 // clock.
 type Clocks interface {
 	// Update performs an update step, keeping the clocks in sync with the
 	// reference host clocks, and returning the new timekeeping parameters.
 	//
-	// Update should be called at approximately ApproxUpdateInterval.
+	// Update should be called at approximately UpdateInterval.
 	Update() (monotonicParams Parameters, monotonicOk bool, realtimeParam Parameters, realtimeOk bool)
 
+	// UpdateInterval returns the approximate interval at which Update
+	// should be called.
+	UpdateInterval() time.Duration
+
 	// GetTime returns the current time in nanoseconds for the given clock.
 	//
 	// Clocks implementations must support at least Monotonic and
@@ -22,43 +22,54 @@ import (
 )
 
 const (
-	// ApproxUpdateInterval is the approximate interval that parameters
-	// should be updated at.
+	// DefaultUpdateInterval is the default approximate interval at which
+	// parameters are updated.
 	//
-	// Error correction assumes that the next update will occur after this
-	// much time.
+	// Error correction assumes that the next update will occur after the
+	// update interval passes.
 	//
-	// If an update occurs before ApproxUpdateInterval passes, it has no
+	// If an update occurs before the update interval passes, it has no
 	// adverse effect on error correction behavior.
 	//
-	// If an update occurs after ApproxUpdateInterval passes, the clock
-	// will overshoot its error correction target and begin accumulating
-	// error in the other direction.
+	// If an update occurs after the update interval passes, the clock will
+	// overshoot its error correction target and begin accumulating error
+	// in the other direction.
 	//
-	// If updates occur after more than 2*ApproxUpdateInterval passes, the
-	// clock becomes unstable, accumulating more error than it had
-	// originally. Repeated updates after more than 2*ApproxUpdateInterval
-	// will cause unbounded increases in error.
+	// If updates occur after more than twice the update interval passes,
+	// the clock becomes unstable, accumulating more error than it had
+	// originally. Repeated updates after more than twice the update
+	// interval will cause unbounded increases in error.
 	//
 	// These statements assume that the host clock does not change. Actual
 	// error will depend upon host clock changes.
 	//
 	// TODO: make error correction more robust to delayed
 	// updates.
-	ApproxUpdateInterval = 1 * time.Second
+	DefaultUpdateInterval = 1 * time.Second
 
-	// MaxClockError is the maximum amount of error that the clocks will
-	// try to correct.
+	// MinUpdateInterval and MaxUpdateInterval bound the update interval.
 	//
-	// This limit:
-	//
-	//  * Puts a limit on cases of otherwise unbounded increases in error.
-	//
-	//  * Avoids unreasonably large frequency adjustments required to
-	//    correct large errors over a single update interval.
-	MaxClockError = ReferenceNS(ApproxUpdateInterval) / 4
+	// Shorter intervals correct errors sooner, at the cost of more
+	// frequent updates, and of a less precise frequency estimate, since
+	// the frequency is computed over fewer update intervals' worth of
+	// samples.
+	MinUpdateInterval = 1 * time.Millisecond
+	MaxUpdateInterval = 10 * time.Second
 )
 
+// maxClockError returns the maximum amount of error that the clocks will try
+// to correct over the given update interval.
+//
+// This limit:
+//
+//  * Puts a limit on cases of otherwise unbounded increases in error.
+//
+//  * Avoids unreasonably large frequency adjustments required to
+//    correct large errors over a single update interval.
+func maxClockError(interval time.Duration) ReferenceNS {
+	return ReferenceNS(interval) / 4
+}
+
 // Parameters are the timekeeping parameters needed to compute the current
 // time.
 type Parameters struct {
@@ -104,6 +115,29 @@ func (p Parameters) ComputeTime(nowCycles TSCValue) (int64, bool) {
 	return int64(uint64(p.BaseRef) + diffNS), ok
 }
 
+// Scaled returns Parameters that compute baseRef at p.BaseCycles, and from
+// there advance ppb parts per billion faster than p does. ppb must be greater
+// than -10^9.
+//
+// It returns !ok if the new frequency does not fit in 64 bits.
+func (p Parameters) Scaled(baseRef ReferenceNS, ppb int64) (Parameters, bool) {
+	nsPerSec := time.Second.Nanoseconds()
+	if ppb <= -nsPerSec {
+		return Parameters{}, false
+	}
+	// Time advances by 1/f per cycle, so advancing (1 + ppb/10^9) times
+	// faster divides the frequency by the same factor.
+	f, ok := muldiv64(p.Frequency, uint64(nsPerSec), uint64(nsPerSec+ppb))
+	if !ok {
+		return Parameters{}, false
+	}
+	return Parameters{
+		BaseCycles: p.BaseCycles,
+		BaseRef:    baseRef,
+		Frequency:  f,
+	}, true
+}
+
 // errorAdjust returns a new Parameters struct "adjusted" that satisfies:
 //
 // 1. adjusted.ComputeTime(now) = prevParams.ComputeTime(now)
@@ -111,7 +145,7 @@ func (p Parameters) ComputeTime(nowCycles TSCValue) (int64, bool) {
 //
 // 2. adjusted.ComputeTime(TSC at next update) = newParams.ComputeTime(TSC at next update)
 //   * i.e., Any error between prevParams and newParams will be corrected over
-//     the course of the next update period.
+//     the course of the next update period, which lasts interval.
 //
 // errorAdjust also returns the current clock error.
 //
@@ -120,7 +154,7 @@ func (p Parameters) ComputeTime(nowCycles TSCValue) (int64, bool) {
 //   backwards.
 // * newParams.BaseCycles <= now; i.e., the new parameters be computed at or
 //   before now.
-func errorAdjust(prevParams Parameters, newParams Parameters, now TSCValue) (Parameters, ReferenceNS, error) {
+func errorAdjust(prevParams Parameters, newParams Parameters, now TSCValue, interval time.Duration) (Parameters, ReferenceNS, error) {
 	if newParams.BaseCycles < prevParams.BaseCycles {
 		// Oh dear! Something is very wrong.
 		return Parameters{}, 0, fmt.Errorf("TSC went backwards in updated clock params: %v < %v", newParams.BaseCycles, prevParams.BaseCycles)
@@ -129,7 +163,7 @@ func errorAdjust(prevParams Parameters, newParams Parameters, now TSCValue) (Par
 		return Parameters{}, 0, fmt.Errorf("parameters contain base cycles later than now: %v > %v", newParams.BaseCycles, now)
 	}
 
-	intervalNS := int64(ApproxUpdateInterval.Nanoseconds())
+	intervalNS := interval.Nanoseconds()
 	nsPerSec := uint64(time.Second.Nanoseconds())
 
 	// Current time as computed by prevParams.
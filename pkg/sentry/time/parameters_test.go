@@ -74,6 +74,56 @@ func TestParametersComputeTime(t *testing.T) {
 	}
 }
 
+func TestParametersScaled(t *testing.T) {
+	p := Parameters{
+		BaseCycles: 10000,
+		BaseRef:    ReferenceNS(5000 * time.Millisecond.Nanoseconds()),
+		Frequency:  1000000000,
+	}
+	testCases := []struct {
+		name string
+		ppb  int64
+		want int64
+	}{
+		{
+			name: "same-rate",
+			ppb:  0,
+			want: 7 * time.Second.Nanoseconds(),
+		},
+		{
+			// 500ppm faster gains 500us over a second.
+			name: "faster",
+			ppb:  500000,
+			want: 7*time.Second.Nanoseconds() + 500*time.Microsecond.Nanoseconds(),
+		},
+		{
+			name: "slower",
+			ppb:  -500000,
+			want: 7*time.Second.Nanoseconds() - 500*time.Microsecond.Nanoseconds(),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			scaled, ok := p.Scaled(ReferenceNS(6*time.Second.Nanoseconds()), tc.ppb)
+			if !ok {
+				t.Fatalf("Scaled ok got false want true")
+			}
+			got, ok := scaled.ComputeTime(p.BaseCycles + TSCValue(p.Frequency))
+			if !ok {
+				t.Errorf("ComputeTime ok got %v want true", got)
+			}
+			// Allow for rounding of the frequency.
+			if diff := got - tc.want; diff < -1 || diff > 1 {
+				t.Errorf("ComputeTime got %v want %v", got, tc.want)
+			}
+		})
+	}
+
+	if _, ok := p.Scaled(p.BaseRef, -time.Second.Nanoseconds()); ok {
+		t.Errorf("Scaled(-10^9) ok got true want false")
+	}
+}
+
 func TestParametersErrorAdjust(t *testing.T) {
 	testCases := []struct {
 		name      string
@@ -181,7 +231,7 @@ func TestParametersErrorAdjust(t *testing.T) {
 				BaseRef:    ReferenceNS(4500 * time.Millisecond.Nanoseconds()),
 				// We must decrease the new frequency by 50% to
 				// correct 0.5s of error in 1s
-				// (ApproxUpdateInterval).
+				// (DefaultUpdateInterval).
 				Frequency: 4500,
 			},
 			errorNS: ReferenceNS(-500 * time.Millisecond.Nanoseconds()),
@@ -286,7 +336,7 @@ func TestParametersErrorAdjust(t *testing.T) {
 				BaseRef:    ReferenceNS(5500 * time.Millisecond.Nanoseconds()),
 				// We must increase the new frequency by 50% to
 				// correct 0.5s of error in 1s
-				// (ApproxUpdateInterval).
+				// (DefaultUpdateInterval).
 				Frequency: 16500,
 			},
 			errorNS: ReferenceNS(500 * time.Millisecond.Nanoseconds()),
@@ -344,7 +394,7 @@ func TestParametersErrorAdjust(t *testing.T) {
 				BaseRef:    ReferenceNS(6000 * time.Millisecond.Nanoseconds()),
 				// We must increase the frequency by 200% to
 				// correct 2s of error in 1s
-				// (ApproxUpdateInterval).
+				// (DefaultUpdateInterval).
 				Frequency: 30000,
 			},
 			errorNS: ReferenceNS(2000 * time.Millisecond.Nanoseconds()),
@@ -383,7 +433,7 @@ func TestParametersErrorAdjust(t *testing.T) {
 	}
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			got, errorNS, err := errorAdjust(tc.oldParams, tc.newParams, tc.now)
+			got, errorNS, err := errorAdjust(tc.oldParams, tc.newParams, tc.now, DefaultUpdateInterval)
 			if err != nil && !tc.wantErr {
 				t.Errorf("err got %v want nil", err)
 			} else if err == nil && tc.wantErr {
@@ -16,6 +16,7 @@ package usage
 
 import (
 	"sync/atomic"
+	"time"
 )
 
 // IO contains I/O-related statistics.
@@ -44,6 +45,12 @@ type IO struct {
 	// BytesWriteCancelled is the number of bytes not written out due to
 	// truncation.
 	BytesWriteCancelled uint64
+
+	// BlockIODelay is the total time, in nanoseconds, spent waiting for
+	// synchronous I/O to the file system, and BlockIOCount is the number of
+	// such waits. These are analogous to Linux's blkio delay accounting.
+	BlockIODelay uint64
+	BlockIOCount uint64
 }
 
 // AccountReadSyscall does the accounting for a read syscall.
@@ -76,6 +83,24 @@ func (i *IO) AccountWriteIO(bytes int64) {
 	}
 }
 
+// AccountCancelledWriteIO does the accounting for dirty data that is dropped
+// without being written into the file system, e.g. by truncation.
+func (i *IO) AccountCancelledWriteIO(bytes int64) {
+	if bytes > 0 {
+		atomic.AddUint64(&i.BytesWriteCancelled, uint64(bytes))
+	}
+}
+
+// AccountBlockIODelay does the accounting for a wait of d for synchronous I/O
+// to the file system.
+func (i *IO) AccountBlockIODelay(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	atomic.AddUint64(&i.BlockIODelay, uint64(d))
+	atomic.AddUint64(&i.BlockIOCount, 1)
+}
+
 // Accumulate adds up io usages.
 func (i *IO) Accumulate(io *IO) {
 	atomic.AddUint64(&i.CharsRead, atomic.LoadUint64(&io.CharsRead))
@@ -85,4 +110,6 @@ func (i *IO) Accumulate(io *IO) {
 	atomic.AddUint64(&i.BytesRead, atomic.LoadUint64(&io.BytesRead))
 	atomic.AddUint64(&i.BytesWritten, atomic.LoadUint64(&io.BytesWritten))
 	atomic.AddUint64(&i.BytesWriteCancelled, atomic.LoadUint64(&io.BytesWriteCancelled))
+	atomic.AddUint64(&i.BlockIODelay, atomic.LoadUint64(&io.BlockIODelay))
+	atomic.AddUint64(&i.BlockIOCount, atomic.LoadUint64(&io.BlockIOCount))
 }
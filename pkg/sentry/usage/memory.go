@@ -253,16 +253,35 @@ func (m *MemoryLocked) Copy() (MemoryStats, uint64) {
 // MinimumTotalMemoryBytes is the minimum reported total system memory.
 var MinimumTotalMemoryBytes uint64 = 2 << 30 // 2 GB
 
+// memoryLimit is the memory limit of the sandbox, or 0 if it has none. It is
+// accessed atomically.
+var memoryLimit uint64
+
+// SetMemoryLimit sets the memory limit of the sandbox, which is reported as
+// its total memory. A limit of 0 removes the limit.
+func SetMemoryLimit(limit uint64) {
+	atomic.StoreUint64(&memoryLimit, limit)
+}
+
+// MemoryLimit returns the memory limit set by SetMemoryLimit.
+func MemoryLimit() uint64 {
+	return atomic.LoadUint64(&memoryLimit)
+}
+
 // TotalMemory returns the "total usable memory" available.
 //
 // This number doesn't really have a true value so it's based on the following
 // inputs and further bounded to be above some minimum guaranteed value (2GB),
 // additionally ensuring that total memory reported is always less than used.
+// If the sandbox has a memory limit, the limit is used instead of the inputs
+// and the minimum.
 //
 // memSize should be the platform.Memory size reported by platform.Memory.TotalSize()
 // used is the total memory reported by MemoryLocked.Total()
 func TotalMemory(memSize, used uint64) uint64 {
-	if memSize < MinimumTotalMemoryBytes {
+	if limit := MemoryLimit(); limit != 0 {
+		memSize = limit
+	} else if memSize < MinimumTotalMemoryBytes {
 		memSize = MinimumTotalMemoryBytes
 	}
 	if memSize < used {
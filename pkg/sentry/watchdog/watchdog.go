@@ -32,6 +32,7 @@ package watchdog
 import (
 	"bytes"
 	"fmt"
+	"os"
 	"sync"
 	"time"
 
@@ -113,7 +114,11 @@ type Watchdog struct {
 	// mu protects the fields below.
 	mu sync.Mutex
 
-	// started is true if the watchdog has been started before.
+	// active is true between calls to Start and Stop, even if the watchdog
+	// is disabled.
+	active bool
+
+	// started is true if the watchdog goroutine is running.
 	started bool
 }
 
@@ -138,13 +143,21 @@ func New(k *kernel.Kernel, taskTimeout time.Duration, a Action) *Watchdog {
 
 // Start starts the watchdog.
 func (w *Watchdog) Start() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.active = true
+	w.startLocked()
+}
+
+// startLocked starts the watchdog goroutine, unless the watchdog is disabled
+// or the goroutine is running.
+//
+// Preconditions: w.mu must be locked.
+func (w *Watchdog) startLocked() {
 	if w.taskTimeout == 0 {
 		log.Infof("Watchdog disabled")
 		return
 	}
-
-	w.mu.Lock()
-	defer w.mu.Unlock()
 	if w.started {
 		return
 	}
@@ -158,12 +171,16 @@ func (w *Watchdog) Start() {
 
 // Stop requests the watchdog to stop and wait for it.
 func (w *Watchdog) Stop() {
-	if w.taskTimeout == 0 {
-		return
-	}
-
 	w.mu.Lock()
 	defer w.mu.Unlock()
+	w.active = false
+	w.stopLocked()
+}
+
+// stopLocked stops the watchdog goroutine if it is running, and waits for it.
+//
+// Preconditions: w.mu must be locked.
+func (w *Watchdog) stopLocked() {
 	if !w.started {
 		return
 	}
@@ -174,6 +191,22 @@ func (w *Watchdog) Stop() {
 	log.Infof("Watchdog stopped")
 }
 
+// SetTimeout changes the task timeout and the action of the watchdog. A
+// timeout of 0 disables the watchdog. If the watchdog is started, it is
+// restarted with the new settings.
+func (w *Watchdog) SetTimeout(taskTimeout time.Duration, a Action) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	// The goroutine reads the settings without holding w.mu.
+	w.stopLocked()
+	w.period = taskTimeout / 4
+	w.taskTimeout = taskTimeout
+	w.timeoutAction = a
+	if w.active {
+		w.startLocked()
+	}
+}
+
 // loop is the main watchdog routine. It only returns when 'Stop()' is called.
 func (w *Watchdog) loop() {
 	// Loop until someone stops it.
@@ -243,6 +276,7 @@ func (w *Watchdog) report(offenders map[*kernel.Task]*offender, newTaskFound boo
 	for t, o := range offenders {
 		tid := w.k.TaskSet().Root.IDOfTask(t)
 		buf.WriteString(fmt.Sprintf("\tTask tid: %v (%#x), entered RunSys state %v ago.\n", tid, uint64(tid), now.Sub(o.lastUpdateTime)))
+		t.DumpTrace("Watchdog detected stuck task")
 	}
 	buf.WriteString("Search for '(*Task).run(0x..., 0x<tid>)' in the stack dump to find the offending goroutine")
 
@@ -274,6 +308,7 @@ func (w *Watchdog) report(offenders map[*kernel.Task]*offender, newTaskFound boo
 		case <-metricsEmitted:
 		case <-time.After(1 * time.Second):
 		}
+		log.DumpRecent(os.Stderr)
 		panic("Sentry detected stuck task(s). See stack trace and message above for more details")
 	}
 }
@@ -52,6 +52,7 @@ package state
 import (
 	"fmt"
 	"io"
+	"io/ioutil"
 	"reflect"
 	"runtime"
 
@@ -106,6 +107,26 @@ func Load(r io.Reader, rootPtr interface{}, stats *Stats) error {
 	})
 }
 
+// Skip skips over the state of a single object saved by Save, without
+// decoding it.
+func Skip(r io.Reader) error {
+	for {
+		length, object, err := ReadHeader(r)
+		if err != nil {
+			return err
+		}
+		if !object {
+			if length != 0 {
+				return fmt.Errorf("expected zero-length terminal, got %d", length)
+			}
+			return nil
+		}
+		if n, err := io.CopyN(ioutil.Discard, r, int64(length)); err != nil {
+			return fmt.Errorf("short object: read %d of %d bytes: %v", n, length, err)
+		}
+	}
+}
+
 // Fns are the state dispatch functions.
 type Fns struct {
 	// Save is a function like Save(concreteType, Map).
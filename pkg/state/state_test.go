@@ -16,6 +16,7 @@ package state
 
 import (
 	"bytes"
+	"io"
 	"io/ioutil"
 	"math"
 	"reflect"
@@ -611,6 +612,30 @@ func (b *benchStruct) afterLoad() {
 	// Do nothing, just force scheduling.
 }
 
+func TestSkip(t *testing.T) {
+	buf := &bytes.Buffer{}
+	if err := Save(buf, buildObject(10), nil); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	want := []string{"after", "skipped"}
+	if err := Save(buf, &want, nil); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	if err := Skip(buf); err != nil {
+		t.Fatalf("skip failed: %v", err)
+	}
+	var got []string
+	if err := Load(buf, &got, nil); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v after skip, want %v", got, want)
+	}
+	if err := Skip(buf); err != io.EOF {
+		t.Errorf("skip at end of stream got %v, want %v", err, io.EOF)
+	}
+}
+
 // buildObject builds a benchmark object.
 func buildObject(n int) (b *benchStruct) {
 	for i := 0; i < n; i++ {
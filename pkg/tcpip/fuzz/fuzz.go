@@ -0,0 +1,228 @@
+// Copyright 2018 The Netstack Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package fuzz provides a fuzzing entry point for the network stack. Fuzz
+// injects raw frames into a stack with all supported network and transport
+// protocols enabled, with endpoints listening for TCP and UDP so that
+// inbound segments reach the transport protocols.
+//
+// Fuzz follows the go-fuzz conventions, and the corpus of interesting inputs
+// can be serialized with WriteCorpus and ReadCorpus.
+package fuzz
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/buffer"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/link/channel"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/network/arp"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/network/ipv6"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/stack"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/transport/ping"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/transport/tcp"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/transport/udp"
+	"gvisor.googlesource.com/gvisor/pkg/waiter"
+)
+
+const (
+	// StackAddr is the IPv4 address assigned to the stack.
+	StackAddr = tcpip.Address("\x0a\x00\x00\x01")
+
+	// StackV6Addr is the IPv6 address assigned to the stack.
+	StackV6Addr = tcpip.Address("\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x01")
+
+	// StackLinkAddr is the link address of the stack's NIC.
+	StackLinkAddr = tcpip.LinkAddress("\x0a\x0a\x0b\x0b\x0c\x0c")
+
+	// StackPort is the port on which the stack listens for TCP connections
+	// and receives UDP datagrams, on both IPv4 and IPv6.
+	StackPort = 1234
+
+	// mtu is the MTU of the stack's NIC.
+	mtu = 65536
+)
+
+// protocols maps the first byte of a fuzz input to the network protocol of
+// the frame in the rest of the input.
+var protocols = []tcpip.NetworkProtocolNumber{
+	ipv4.ProtocolNumber,
+	ipv6.ProtocolNumber,
+	arp.ProtocolNumber,
+}
+
+// Stack is a network stack that frames can be injected into.
+type Stack struct {
+	// Stack is the network stack.
+	Stack *stack.Stack
+
+	// linkEP is the link endpoint of the stack's only NIC.
+	linkEP *channel.Endpoint
+
+	// eps are the endpoints that receive inbound TCP and UDP traffic.
+	eps []tcpip.Endpoint
+}
+
+// NewStack returns a Stack with all supported protocols enabled.
+func NewStack() (*Stack, error) {
+	s := stack.New(&tcpip.StdClock{},
+		[]string{ipv4.ProtocolName, ipv6.ProtocolName, arp.ProtocolName},
+		[]string{tcp.ProtocolName, udp.ProtocolName, ping.ProtocolName4, ping.ProtocolName6})
+
+	id, linkEP := channel.New(256, mtu, StackLinkAddr)
+	if err := s.CreateNIC(1, id); err != nil {
+		return nil, fmt.Errorf("CreateNIC failed: %v", err)
+	}
+	if err := s.AddAddress(1, ipv4.ProtocolNumber, StackAddr); err != nil {
+		return nil, fmt.Errorf("AddAddress for ipv4 failed: %v", err)
+	}
+	if err := s.AddAddress(1, ipv6.ProtocolNumber, StackV6Addr); err != nil {
+		return nil, fmt.Errorf("AddAddress for ipv6 failed: %v", err)
+	}
+	if err := s.AddAddress(1, arp.ProtocolNumber, arp.ProtocolAddress); err != nil {
+		return nil, fmt.Errorf("AddAddress for arp failed: %v", err)
+	}
+	s.SetRouteTable([]tcpip.Route{
+		{
+			Destination: "\x00\x00\x00\x00",
+			Mask:        "\x00\x00\x00\x00",
+			NIC:         1,
+		},
+		{
+			Destination: "\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00",
+			Mask:        "\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00",
+			NIC:         1,
+		},
+	})
+
+	fs := &Stack{Stack: s, linkEP: linkEP}
+	for _, c := range []struct {
+		transport tcpip.TransportProtocolNumber
+		network   tcpip.NetworkProtocolNumber
+		addr      tcpip.Address
+	}{
+		{tcp.ProtocolNumber, ipv4.ProtocolNumber, StackAddr},
+		{tcp.ProtocolNumber, ipv6.ProtocolNumber, StackV6Addr},
+		{udp.ProtocolNumber, ipv4.ProtocolNumber, StackAddr},
+		{udp.ProtocolNumber, ipv6.ProtocolNumber, StackV6Addr},
+	} {
+		var wq waiter.Queue
+		ep, err := s.NewEndpoint(c.transport, c.network, &wq)
+		if err != nil {
+			fs.Close()
+			return nil, fmt.Errorf("NewEndpoint failed: %v", err)
+		}
+		fs.eps = append(fs.eps, ep)
+		if err := ep.Bind(tcpip.FullAddress{Addr: c.addr, Port: StackPort}, nil); err != nil {
+			fs.Close()
+			return nil, fmt.Errorf("Bind failed: %v", err)
+		}
+		if c.transport == tcp.ProtocolNumber {
+			if err := ep.Listen(10); err != nil {
+				fs.Close()
+				return nil, fmt.Errorf("Listen failed: %v", err)
+			}
+		}
+	}
+	return fs, nil
+}
+
+// Close releases the stack's endpoints.
+func (s *Stack) Close() {
+	for _, ep := range s.eps {
+		ep.Close()
+	}
+}
+
+// Inject injects a frame of the given network protocol into the stack, and
+// returns the number of packets that the stack sent in response before
+// Inject returned.
+func (s *Stack) Inject(protocol tcpip.NetworkProtocolNumber, frame []byte) int {
+	vv := buffer.NewVectorisedView(len(frame), []buffer.View{buffer.View(frame)})
+	s.linkEP.Inject(protocol, &vv)
+	return s.linkEP.Drain()
+}
+
+var (
+	fuzzStackOnce sync.Once
+	fuzzStack     *Stack
+)
+
+// Fuzz injects data into a shared Stack. The first byte of data selects the
+// network protocol, and the rest of data is the frame. Fuzz returns 1 if the
+// stack responded to the frame, which indicates that the input reached deep
+// into the stack, and 0 otherwise.
+func Fuzz(data []byte) int {
+	fuzzStackOnce.Do(func() {
+		s, err := NewStack()
+		if err != nil {
+			panic(err)
+		}
+		fuzzStack = s
+	})
+	if len(data) < 1 {
+		return 0
+	}
+	protocol := protocols[int(data[0])%len(protocols)]
+	// Copy the frame, since the stack may retain it.
+	frame := append([]byte(nil), data[1:]...)
+	if fuzzStack.Inject(protocol, frame) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// Input returns the fuzz input that injects frame as the given network
+// protocol.
+func Input(protocol tcpip.NetworkProtocolNumber, frame []byte) []byte {
+	for i, p := range protocols {
+		if p == protocol {
+			return append([]byte{byte(i)}, frame...)
+		}
+	}
+	panic(fmt.Sprintf("unsupported network protocol %d", protocol))
+}
+
+// WriteCorpus writes each input to a file in dir, named by the SHA-1 hash of
+// its contents as go-fuzz does. dir is created if it does not exist.
+func WriteCorpus(dir string, inputs [][]byte) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for _, in := range inputs {
+		sum := sha1.Sum(in)
+		name := filepath.Join(dir, hex.EncodeToString(sum[:]))
+		if err := ioutil.WriteFile(name, in, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadCorpus returns the inputs stored in the files in dir.
+func ReadCorpus(dir string) ([][]byte, error) {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var inputs [][]byte
+	for _, fi := range fis {
+		if !fi.Mode().IsRegular() {
+			continue
+		}
+		in, err := ioutil.ReadFile(filepath.Join(dir, fi.Name()))
+		if err != nil {
+			return nil, err
+		}
+		inputs = append(inputs, in)
+	}
+	return inputs, nil
+}
@@ -0,0 +1,61 @@
+// Copyright 2018 The Netstack Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fuzz
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"sort"
+	"testing"
+
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/header"
+)
+
+func TestSeeds(t *testing.T) {
+	// The stack responds to ARP requests synchronously.
+	if got := Fuzz(Input(header.ARPProtocolNumber, arpRequest())); got != 1 {
+		t.Errorf("Fuzz(ARP request) = %d, want 1", got)
+	}
+
+	// Truncated and empty frames must not crash the stack.
+	for _, seed := range Seeds() {
+		for i := 0; i <= len(seed); i++ {
+			Fuzz(seed[:i])
+		}
+	}
+}
+
+func TestCorpus(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fuzz_test")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	want := Seeds()
+	// Writing an input twice stores it once.
+	if err := WriteCorpus(dir, append(want, want[0])); err != nil {
+		t.Fatalf("WriteCorpus failed: %v", err)
+	}
+	got, err := ReadCorpus(dir)
+	if err != nil {
+		t.Fatalf("ReadCorpus failed: %v", err)
+	}
+
+	less := func(s [][]byte) func(i, j int) bool {
+		return func(i, j int) bool { return bytes.Compare(s[i], s[j]) < 0 }
+	}
+	sort.Slice(want, less(want))
+	sort.Slice(got, less(got))
+	if len(got) != len(want) {
+		t.Fatalf("ReadCorpus returned %d inputs, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if !bytes.Equal(got[i], want[i]) {
+			t.Errorf("input %d = %x, want %x", i, got[i], want[i])
+		}
+	}
+}
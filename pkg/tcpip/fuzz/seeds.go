@@ -0,0 +1,127 @@
+// Copyright 2018 The Netstack Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fuzz
+
+import (
+	"encoding/binary"
+
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/header"
+)
+
+const (
+	// testAddr is the source address of the seed IPv4 packets.
+	testAddr = tcpip.Address("\x0a\x00\x00\x02")
+
+	// testV6Addr is the source address of the seed IPv6 packets.
+	testV6Addr = tcpip.Address("\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x02")
+
+	// testLinkAddr is the source link address of the seed ARP packets.
+	testLinkAddr = tcpip.LinkAddress("\x01\x02\x03\x04\x05\x06")
+
+	// testPort is the source port of the seed TCP and UDP packets.
+	testPort = 4096
+)
+
+// Seeds returns fuzz inputs containing well-formed frames for each protocol
+// supported by the stack, addressed to the stack. They make a good initial
+// corpus.
+func Seeds() [][]byte {
+	return [][]byte{
+		Input(header.IPv4ProtocolNumber, ipv4Packet(header.TCPProtocolNumber, tcpSyn(testAddr, StackAddr))),
+		Input(header.IPv4ProtocolNumber, ipv4Packet(header.UDPProtocolNumber, udpDatagram(testAddr, StackAddr))),
+		Input(header.IPv4ProtocolNumber, ipv4Packet(header.ICMPv4ProtocolNumber, icmpv4Echo())),
+		Input(header.IPv6ProtocolNumber, ipv6Packet(header.TCPProtocolNumber, tcpSyn(testV6Addr, StackV6Addr))),
+		Input(header.IPv6ProtocolNumber, ipv6Packet(header.UDPProtocolNumber, udpDatagram(testV6Addr, StackV6Addr))),
+		Input(header.ARPProtocolNumber, arpRequest()),
+	}
+}
+
+// transportChecksum returns the checksum of a transport segment b, including
+// the network-layer pseudo-header.
+func transportChecksum(protocol tcpip.TransportProtocolNumber, src, dst tcpip.Address, b []byte) uint16 {
+	length := make([]byte, 2)
+	binary.BigEndian.PutUint16(length, uint16(len(b)))
+	sum := header.Checksum(length, header.PseudoHeaderChecksum(protocol, src, dst))
+	return ^header.Checksum(b, sum)
+}
+
+func tcpSyn(src, dst tcpip.Address) []byte {
+	b := make([]byte, header.TCPMinimumSize)
+	tcp := header.TCP(b)
+	tcp.Encode(&header.TCPFields{
+		SrcPort:    testPort,
+		DstPort:    StackPort,
+		SeqNum:     789,
+		DataOffset: header.TCPMinimumSize,
+		Flags:      header.TCPFlagSyn,
+		WindowSize: 30000,
+	})
+	tcp.SetChecksum(transportChecksum(header.TCPProtocolNumber, src, dst, b))
+	return b
+}
+
+func udpDatagram(src, dst tcpip.Address) []byte {
+	payload := []byte("fuzz")
+	b := make([]byte, header.UDPMinimumSize+len(payload))
+	copy(b[header.UDPMinimumSize:], payload)
+	udp := header.UDP(b)
+	udp.Encode(&header.UDPFields{
+		SrcPort: testPort,
+		DstPort: StackPort,
+		Length:  uint16(len(b)),
+	})
+	udp.SetChecksum(transportChecksum(header.UDPProtocolNumber, src, dst, b))
+	return b
+}
+
+func icmpv4Echo() []byte {
+	b := make([]byte, header.ICMPv4EchoMinimumSize+4)
+	icmp := header.ICMPv4(b)
+	icmp.SetType(header.ICMPv4Echo)
+	copy(b[header.ICMPv4EchoMinimumSize:], "ping")
+	icmp.SetChecksum(^header.Checksum(b, 0))
+	return b
+}
+
+func ipv4Packet(protocol tcpip.TransportProtocolNumber, payload []byte) []byte {
+	b := make([]byte, header.IPv4MinimumSize+len(payload))
+	copy(b[header.IPv4MinimumSize:], payload)
+	ip := header.IPv4(b)
+	ip.Encode(&header.IPv4Fields{
+		IHL:         header.IPv4MinimumSize,
+		TotalLength: uint16(len(b)),
+		TTL:         65,
+		Protocol:    uint8(protocol),
+		SrcAddr:     testAddr,
+		DstAddr:     StackAddr,
+	})
+	ip.SetChecksum(^ip.CalculateChecksum())
+	return b
+}
+
+func ipv6Packet(protocol tcpip.TransportProtocolNumber, payload []byte) []byte {
+	b := make([]byte, header.IPv6MinimumSize+len(payload))
+	copy(b[header.IPv6MinimumSize:], payload)
+	header.IPv6(b).Encode(&header.IPv6Fields{
+		PayloadLength: uint16(len(payload)),
+		NextHeader:    uint8(protocol),
+		HopLimit:      65,
+		SrcAddr:       testV6Addr,
+		DstAddr:       StackV6Addr,
+	})
+	return b
+}
+
+func arpRequest() []byte {
+	b := make([]byte, header.ARPSize)
+	arp := header.ARP(b)
+	arp.SetIPv4OverEthernet()
+	arp.SetOp(header.ARPRequest)
+	copy(arp.HardwareAddressSender(), testLinkAddr)
+	copy(arp.ProtocolAddressSender(), testAddr)
+	copy(arp.ProtocolAddressTarget(), StackAddr)
+	return b
+}
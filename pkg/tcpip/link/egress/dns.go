@@ -0,0 +1,221 @@
+// Copyright 2018 The Netstack Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package egress
+
+import (
+	"encoding/binary"
+	"strings"
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+)
+
+const (
+	dnsPort       = 53
+	dnsHeaderSize = 12
+
+	dnsTypeA    = 1
+	dnsTypeAAAA = 28
+	dnsClassIN  = 1
+
+	// dnsMaxPointers is the maximum number of compression pointers that
+	// are followed in a name.
+	dnsMaxPointers = 16
+
+	// maxPendingQueries is the maximum number of DNS queries that are
+	// waiting for a response.
+	maxPendingQueries = 1024
+
+	// queryTimeout is the time after which a DNS query without a response
+	// is forgotten.
+	queryTimeout = 30 * time.Second
+
+	// maxHosts is the maximum number of addresses that host names are
+	// remembered for.
+	maxHosts = 1 << 14
+
+	// minNameTTL is the minimum time for which a resolved name is
+	// remembered, since applications may cache DNS responses for longer
+	// than their TTL.
+	minNameTTL = time.Minute
+)
+
+// canonicalName returns name in lower case, without a trailing dot.
+func canonicalName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
+
+// dnsQuery identifies a DNS query that is waiting for a response.
+type dnsQuery struct {
+	server    tcpip.Address
+	localPort uint16
+	id        uint16
+	name      string
+}
+
+// hostTable remembers the host names that addresses were resolved from, based
+// on DNS responses to queries that were sent by the sandbox.
+type hostTable struct {
+	// pending maps DNS queries to the time at which they expire.
+	pending map[dnsQuery]time.Time
+
+	// names maps addresses to the names that they were resolved from, and
+	// the time at which each name expires.
+	names map[tcpip.Address]map[string]time.Time
+}
+
+func newHostTable() hostTable {
+	return hostTable{
+		pending: make(map[dnsQuery]time.Time),
+		names:   make(map[tcpip.Address]map[string]time.Time),
+	}
+}
+
+// query records the DNS query in the outbound packet p.
+func (t *hostTable) query(p *packet, now time.Time) {
+	msg := p.payload
+	if len(msg) < dnsHeaderSize || msg[2]&0x80 != 0 || binary.BigEndian.Uint16(msg[4:]) != 1 {
+		// Not a query with a single question.
+		return
+	}
+	name, _, ok := readDNSName(msg, dnsHeaderSize)
+	if !ok {
+		return
+	}
+	if len(t.pending) >= maxPendingQueries {
+		for q, expiry := range t.pending {
+			if now.After(expiry) {
+				delete(t.pending, q)
+			}
+		}
+		if len(t.pending) >= maxPendingQueries {
+			return
+		}
+	}
+	q := dnsQuery{p.remote, p.localPort, binary.BigEndian.Uint16(msg), name}
+	t.pending[q] = now.Add(queryTimeout)
+}
+
+// response records the addresses in the DNS response in the inbound packet p,
+// if it answers a pending query. Each address is associated with the name in
+// the question and with the owner name of its record, which differ if the
+// question name is an alias.
+func (t *hostTable) response(p *packet, now time.Time) {
+	msg := p.payload
+	if len(msg) < dnsHeaderSize || msg[2]&0x80 == 0 || binary.BigEndian.Uint16(msg[4:]) != 1 {
+		// Not a response with a single question.
+		return
+	}
+	name, off, ok := readDNSName(msg, dnsHeaderSize)
+	if !ok {
+		return
+	}
+	q := dnsQuery{p.remote, p.localPort, binary.BigEndian.Uint16(msg), name}
+	expiry, ok := t.pending[q]
+	delete(t.pending, q)
+	if !ok || now.After(expiry) {
+		// Unsolicited responses are ignored.
+		return
+	}
+
+	// Skip the question's type and class.
+	off += 4
+	for n := binary.BigEndian.Uint16(msg[6:]); n > 0; n-- {
+		owner, next, ok := readDNSName(msg, off)
+		if !ok || next+10 > len(msg) {
+			return
+		}
+		typ := binary.BigEndian.Uint16(msg[next:])
+		class := binary.BigEndian.Uint16(msg[next+2:])
+		ttl := time.Duration(binary.BigEndian.Uint32(msg[next+4:])) * time.Second
+		length := int(binary.BigEndian.Uint16(msg[next+8:]))
+		data := next + 10
+		if data+length > len(msg) {
+			return
+		}
+		off = data + length
+
+		if class != dnsClassIN || !(typ == dnsTypeA && length == 4 || typ == dnsTypeAAAA && length == 16) {
+			continue
+		}
+		if ttl < minNameTTL {
+			ttl = minNameTTL
+		}
+		addr := tcpip.Address(msg[data : data+length])
+		t.add(addr, name, now.Add(ttl), now)
+		t.add(addr, owner, now.Add(ttl), now)
+	}
+}
+
+// add records that addr was resolved from name until expiry.
+func (t *hostTable) add(addr tcpip.Address, name string, expiry, now time.Time) {
+	names, ok := t.names[addr]
+	if !ok {
+		if len(t.names) >= maxHosts {
+			t.sweep(now)
+			if len(t.names) >= maxHosts {
+				return
+			}
+		}
+		names = make(map[string]time.Time)
+		t.names[addr] = names
+	}
+	if expiry.After(names[name]) {
+		names[name] = expiry
+	}
+}
+
+// sweep forgets expired names.
+func (t *hostTable) sweep(now time.Time) {
+	for addr, names := range t.names {
+		for name, expiry := range names {
+			if now.After(expiry) {
+				delete(names, name)
+			}
+		}
+		if len(names) == 0 {
+			delete(t.names, addr)
+		}
+	}
+}
+
+// readDNSName reads the possibly compressed name at offset off in the DNS
+// message msg. It returns the name in canonical form and the offset following
+// the name.
+func readDNSName(msg []byte, off int) (string, int, bool) {
+	var labels []string
+	next := -1
+	for pointers := 0; ; {
+		if off >= len(msg) {
+			return "", 0, false
+		}
+		length := int(msg[off])
+		switch {
+		case length == 0:
+			if next < 0 {
+				next = off + 1
+			}
+			return canonicalName(strings.Join(labels, ".")), next, true
+		case length&0xc0 == 0xc0:
+			if off+2 > len(msg) || pointers == dnsMaxPointers {
+				return "", 0, false
+			}
+			if next < 0 {
+				next = off + 2
+			}
+			pointers++
+			off = int(binary.BigEndian.Uint16(msg[off:]) & 0x3fff)
+		case length&0xc0 != 0:
+			// Reserved label types.
+			return "", 0, false
+		default:
+			if off+1+length > len(msg) {
+				return "", 0, false
+			}
+			labels = append(labels, string(msg[off+1:off+1+length]))
+			off += 1 + length
+		}
+	}
+}
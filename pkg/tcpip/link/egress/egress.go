@@ -0,0 +1,563 @@
+// Copyright 2018 The Netstack Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package egress provides the implementation of data-link layer endpoints that
+// wrap another endpoint and only let through outbound packets that are allowed
+// by a Policy.
+//
+// A Policy is an ordered list of rules that match packets by destination
+// subnet, destination host name, transport protocol and destination port. To
+// match host names, the endpoint snoops on DNS responses to queries sent
+// through it and remembers which host names resolved to which addresses.
+//
+// The endpoint is stateful: once an outbound packet is allowed, later packets
+// of the same flow are allowed as well. Inbound packets only keep alive flows
+// that were already allowed on the way out; they never create flows, so an
+// unsolicited inbound packet does not open an egress path. Inbound packets are
+// never dropped.
+//
+// Egress endpoints can be used in the networking stack by calling New(eID, p)
+// to create a new endpoint, where eID is the ID of the endpoint being wrapped,
+// and then passing it as an argument to Stack.CreateNIC().
+package egress
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/log"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/buffer"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/header"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/stack"
+)
+
+const (
+	// Allow is the action of rules that let packets through.
+	Allow = "allow"
+
+	// Deny is the action of rules that drop packets.
+	Deny = "deny"
+)
+
+// Policy is an egress policy. It is stored as JSON, for example:
+//
+//	{
+//	  "default": "deny",
+//	  "rules": [
+//	    {"action": "allow", "protocol": "udp", "ports": [53]},
+//	    {"action": "deny", "cidr": "10.0.0.0/8"},
+//	    {"action": "allow", "host": "*.example.com", "protocol": "tcp", "ports": [443]}
+//	  ]
+//	}
+type Policy struct {
+	// Default is the action taken for packets that don't match any rule,
+	// either Allow or Deny.
+	Default string `json:"default"`
+
+	// Rules are the rules of the policy. The first rule that matches a
+	// packet decides its fate.
+	Rules []Rule `json:"rules"`
+}
+
+// Rule matches outbound packets. Empty fields match all packets.
+type Rule struct {
+	// Action is the action taken for matching packets, either Allow or
+	// Deny.
+	Action string `json:"action"`
+
+	// CIDR is the subnet that contains the destination, e.g. "10.0.0.0/8".
+	CIDR string `json:"cidr,omitempty"`
+
+	// Host is the name that the destination address was resolved from,
+	// e.g. "example.com". If it starts with "*.", it matches all
+	// subdomains of the rest of the name, but not the name itself.
+	//
+	// Host can only match addresses that the sandbox resolved with DNS
+	// over UDP through the endpoint. It can't be combined with CIDR.
+	Host string `json:"host,omitempty"`
+
+	// Protocol is the transport protocol, one of "tcp", "udp" or "icmp".
+	Protocol string `json:"protocol,omitempty"`
+
+	// Ports are the destination ports. They can only be used with the
+	// "tcp" and "udp" protocols, or with no protocol, in which case the
+	// rule only matches TCP and UDP packets.
+	Ports []uint16 `json:"ports,omitempty"`
+}
+
+// rule is the compiled form of a Rule.
+type rule struct {
+	allow bool
+
+	// subnet is the destination subnet, if not nil.
+	subnet *tcpip.Subnet
+
+	// host is the destination host name, if not empty. If wildcard is
+	// true, host matches all of its subdomains instead of itself.
+	host     string
+	wildcard bool
+
+	// protocols are the transport protocols, if not empty.
+	protocols []tcpip.TransportProtocolNumber
+
+	// ports are the destination ports, if not empty.
+	ports []uint16
+}
+
+func parseAction(action string) (bool, error) {
+	switch action {
+	case Allow:
+		return true, nil
+	case Deny:
+		return false, nil
+	default:
+		return false, fmt.Errorf("invalid action %q", action)
+	}
+}
+
+// Validate returns an error if the policy is malformed.
+func (p *Policy) Validate() error {
+	_, _, err := p.compile()
+	return err
+}
+
+func (p *Policy) compile() (bool, []rule, error) {
+	allow, err := parseAction(p.Default)
+	if err != nil {
+		return false, nil, fmt.Errorf("default: %v", err)
+	}
+	rules := make([]rule, 0, len(p.Rules))
+	for i, r := range p.Rules {
+		c, err := r.compile()
+		if err != nil {
+			return false, nil, fmt.Errorf("rule %d: %v", i, err)
+		}
+		rules = append(rules, c)
+	}
+	return allow, rules, nil
+}
+
+func (r *Rule) compile() (rule, error) {
+	var c rule
+	var err error
+	if c.allow, err = parseAction(r.Action); err != nil {
+		return rule{}, err
+	}
+
+	if r.CIDR != "" && r.Host != "" {
+		return rule{}, fmt.Errorf("cidr and host can't be used together")
+	}
+	if r.CIDR != "" {
+		_, ipNet, err := net.ParseCIDR(r.CIDR)
+		if err != nil {
+			return rule{}, fmt.Errorf("invalid cidr %q: %v", r.CIDR, err)
+		}
+		subnet, err := tcpip.NewSubnet(tcpip.Address(ipNet.IP), tcpip.AddressMask(ipNet.Mask))
+		if err != nil {
+			return rule{}, fmt.Errorf("invalid cidr %q: %v", r.CIDR, err)
+		}
+		c.subnet = &subnet
+	}
+	if r.Host != "" {
+		c.host = canonicalName(r.Host)
+		if strings.HasPrefix(c.host, "*.") {
+			c.host = c.host[len("*."):]
+			c.wildcard = true
+		}
+		if c.host == "" || strings.Contains(c.host, "*") {
+			return rule{}, fmt.Errorf("invalid host %q", r.Host)
+		}
+	}
+
+	switch r.Protocol {
+	case "":
+		if len(r.Ports) > 0 {
+			c.protocols = []tcpip.TransportProtocolNumber{header.TCPProtocolNumber, header.UDPProtocolNumber}
+		}
+	case "tcp":
+		c.protocols = []tcpip.TransportProtocolNumber{header.TCPProtocolNumber}
+	case "udp":
+		c.protocols = []tcpip.TransportProtocolNumber{header.UDPProtocolNumber}
+	case "icmp":
+		if len(r.Ports) > 0 {
+			return rule{}, fmt.Errorf("ports can't be used with protocol %q", r.Protocol)
+		}
+		c.protocols = []tcpip.TransportProtocolNumber{header.ICMPv4ProtocolNumber, header.ICMPv6ProtocolNumber}
+	default:
+		return rule{}, fmt.Errorf("invalid protocol %q", r.Protocol)
+	}
+	c.ports = r.Ports
+	return c, nil
+}
+
+// matches returns true if the rule matches the packet p, which is sent to a
+// destination with the given host names.
+func (r *rule) matches(p *packet, names map[string]time.Time, now time.Time) bool {
+	if r.subnet != nil && !r.subnet.Contains(p.remote) {
+		return false
+	}
+	if r.host != "" && !r.matchesHost(names, now) {
+		return false
+	}
+	if len(r.protocols) > 0 {
+		found := false
+		for _, proto := range r.protocols {
+			if proto == p.protocol {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(r.ports) > 0 {
+		found := false
+		for _, port := range r.ports {
+			if port == p.remotePort {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *rule) matchesHost(names map[string]time.Time, now time.Time) bool {
+	for name, expiry := range names {
+		if now.After(expiry) {
+			continue
+		}
+		if r.wildcard {
+			if strings.HasSuffix(name, "."+r.host) {
+				return true
+			}
+		} else if name == r.host {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	// maxFlows is the maximum number of flows that are tracked.
+	maxFlows = 1 << 16
+
+	// tcpFlowTimeout is the time after which an idle TCP flow is
+	// forgotten. It is longer than the default TCP keepalive interval, so
+	// that idle connections with keepalives survive.
+	tcpFlowTimeout = 3 * time.Hour
+
+	// flowTimeout is the time after which other idle flows are forgotten.
+	flowTimeout = 5 * time.Minute
+)
+
+// flow identifies a flow of packets between a local and a remote endpoint.
+// The ports of ICMP flows are 0.
+type flow struct {
+	protocol   tcpip.TransportProtocolNumber
+	remote     tcpip.Address
+	remotePort uint16
+	localPort  uint16
+}
+
+// packet contains the parts of a packet that the endpoint looks at. The remote
+// end is the destination of outbound packets and the source of inbound
+// packets.
+type packet struct {
+	protocol   tcpip.TransportProtocolNumber
+	remote     tcpip.Address
+	remotePort uint16
+	localPort  uint16
+
+	// icmpType is the ICMP type of ICMP packets.
+	icmpType uint8
+
+	// payload is the transport payload, or the part of it that was
+	// available when the packet was parsed.
+	payload []byte
+}
+
+func (p *packet) flow() flow {
+	return flow{p.protocol, p.remote, p.remotePort, p.localPort}
+}
+
+// parse parses the network and transport headers at the beginning of b, which
+// is a packet of the given network protocol. If outbound is true, the remote
+// end is the destination, otherwise it is the source. ok is false if b isn't
+// an IP packet, or if it is too short to contain the headers.
+func parse(b []byte, protocol tcpip.NetworkProtocolNumber, outbound bool) (p packet, ok bool) {
+	var transport []byte
+	switch protocol {
+	case header.IPv4ProtocolNumber:
+		h := header.IPv4(b)
+		if len(b) < header.IPv4MinimumSize || int(h.HeaderLength()) < header.IPv4MinimumSize || len(b) < int(h.HeaderLength()) {
+			return packet{}, false
+		}
+		p.protocol = h.TransportProtocol()
+		if outbound {
+			p.remote = h.DestinationAddress()
+		} else {
+			p.remote = h.SourceAddress()
+		}
+		if h.FragmentOffset() != 0 {
+			// Only the first fragment has the transport header.
+			return p, true
+		}
+		transport = b[h.HeaderLength():]
+	case header.IPv6ProtocolNumber:
+		h := header.IPv6(b)
+		if len(b) < header.IPv6MinimumSize {
+			return packet{}, false
+		}
+		// Extension headers aren't parsed, so packets that have them
+		// are treated like packets of an unknown transport protocol.
+		p.protocol = h.TransportProtocol()
+		if outbound {
+			p.remote = h.DestinationAddress()
+		} else {
+			p.remote = h.SourceAddress()
+		}
+		transport = b[header.IPv6MinimumSize:]
+	default:
+		return packet{}, false
+	}
+
+	switch p.protocol {
+	case header.TCPProtocolNumber:
+		h := header.TCP(transport)
+		if len(transport) < header.TCPMinimumSize {
+			return packet{}, false
+		}
+		p.remotePort, p.localPort = h.DestinationPort(), h.SourcePort()
+		if int(h.DataOffset()) <= len(transport) {
+			p.payload = transport[h.DataOffset():]
+		}
+	case header.UDPProtocolNumber:
+		h := header.UDP(transport)
+		if len(transport) < header.UDPMinimumSize {
+			return packet{}, false
+		}
+		p.remotePort, p.localPort = h.DestinationPort(), h.SourcePort()
+		p.payload = transport[header.UDPMinimumSize:]
+	case header.ICMPv4ProtocolNumber, header.ICMPv6ProtocolNumber:
+		if len(transport) < 1 {
+			return packet{}, false
+		}
+		p.icmpType = transport[0]
+	}
+	if !outbound {
+		p.remotePort, p.localPort = p.localPort, p.remotePort
+	}
+	return p, true
+}
+
+// isNDP returns true if p is an IPv6 neighbor discovery packet, which is
+// always allowed.
+func (p *packet) isNDP() bool {
+	if p.protocol != header.ICMPv6ProtocolNumber {
+		return false
+	}
+	switch header.ICMPv6Type(p.icmpType) {
+	case header.ICMPv6RouterSolicit, header.ICMPv6RouterAdvert, header.ICMPv6NeighborSolicit, header.ICMPv6NeighborAdvert, header.ICMPv6RedirectMsg:
+		return true
+	default:
+		return false
+	}
+}
+
+type endpoint struct {
+	dispatcher stack.NetworkDispatcher
+	lower      stack.LinkEndpoint
+
+	// defaultAllow and rules are the compiled policy. They are immutable.
+	defaultAllow bool
+	rules        []rule
+
+	// now returns the current time.
+	now func() time.Time
+
+	// mu protects the fields below.
+	mu sync.Mutex
+
+	// flows maps allowed flows to the time at which they expire.
+	flows map[flow]time.Time
+
+	// hosts holds the names that addresses were resolved from.
+	hosts hostTable
+}
+
+// New creates a new egress link-layer endpoint. It wraps around another
+// endpoint and drops outbound packets that aren't allowed by the policy p.
+func New(lower tcpip.LinkEndpointID, p *Policy) (tcpip.LinkEndpointID, error) {
+	e, err := newEndpoint(stack.FindLinkEndpoint(lower), p)
+	if err != nil {
+		return 0, err
+	}
+	return stack.RegisterLinkEndpoint(e), nil
+}
+
+func newEndpoint(lower stack.LinkEndpoint, p *Policy) (*endpoint, error) {
+	defaultAllow, rules, err := p.compile()
+	if err != nil {
+		return nil, fmt.Errorf("invalid egress policy: %v", err)
+	}
+	return &endpoint{
+		lower:        lower,
+		defaultAllow: defaultAllow,
+		rules:        rules,
+		now:          time.Now,
+		flows:        make(map[flow]time.Time),
+		hosts:        newHostTable(),
+	}, nil
+}
+
+// trackLocked records that the flow f is allowed. e.mu must be locked.
+func (e *endpoint) trackLocked(f flow, now time.Time) {
+	timeout := flowTimeout
+	if f.protocol == header.TCPProtocolNumber {
+		timeout = tcpFlowTimeout
+	}
+	if _, ok := e.flows[f]; !ok && len(e.flows) >= maxFlows {
+		for k, expiry := range e.flows {
+			if now.After(expiry) {
+				delete(e.flows, k)
+			}
+		}
+		if len(e.flows) >= maxFlows {
+			// The packets of untracked flows are still checked
+			// against the rules.
+			return
+		}
+	}
+	e.flows[f] = now.Add(timeout)
+}
+
+// allow returns true if the outbound packet p may be sent.
+func (e *endpoint) allow(p *packet) bool {
+	if p.isNDP() {
+		return true
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := e.now()
+	f := p.flow()
+	if expiry, ok := e.flows[f]; !ok || now.After(expiry) {
+		allow := e.defaultAllow
+		names := e.hosts.names[p.remote]
+		for i := range e.rules {
+			if e.rules[i].matches(p, names, now) {
+				allow = e.rules[i].allow
+				break
+			}
+		}
+		if !allow {
+			return false
+		}
+	}
+	e.trackLocked(f, now)
+	if p.protocol == header.UDPProtocolNumber && p.remotePort == dnsPort {
+		e.hosts.query(p, now)
+	}
+	return true
+}
+
+// DeliverNetworkPacket implements the stack.NetworkDispatcher interface. It is
+// called by the link-layer endpoint being wrapped when a packet arrives. It
+// refreshes the flow of the packet if one was already allowed, snoops on DNS
+// responses to such flows, and forwards the packet to the actual dispatcher.
+func (e *endpoint) DeliverNetworkPacket(linkEP stack.LinkEndpoint, remoteLinkAddr tcpip.LinkAddress, protocol tcpip.NetworkProtocolNumber, vv *buffer.VectorisedView) {
+	b := vv.First()
+	if len(vv.Views()) > 1 {
+		b = vv.ToView()
+	}
+	if p, ok := parse(b, protocol, false /* outbound */); ok {
+		e.mu.Lock()
+		now := e.now()
+		f := p.flow()
+		if expiry, ok := e.flows[f]; ok && !now.After(expiry) {
+			e.trackLocked(f, now)
+			if p.protocol == header.UDPProtocolNumber && p.remotePort == dnsPort {
+				e.hosts.response(&p, now)
+			}
+		}
+		e.mu.Unlock()
+	}
+	e.dispatcher.DeliverNetworkPacket(e, remoteLinkAddr, protocol, vv)
+}
+
+// Attach implements the stack.LinkEndpoint interface. It saves the dispatcher
+// and registers with the lower endpoint as its dispatcher so that "e" is called
+// for inbound packets.
+func (e *endpoint) Attach(dispatcher stack.NetworkDispatcher) {
+	e.dispatcher = dispatcher
+	e.lower.Attach(e)
+}
+
+// IsAttached implements stack.LinkEndpoint.IsAttached.
+func (e *endpoint) IsAttached() bool {
+	return e.dispatcher != nil
+}
+
+// MTU implements stack.LinkEndpoint.MTU. It just forwards the request to the
+// lower endpoint.
+func (e *endpoint) MTU() uint32 {
+	return e.lower.MTU()
+}
+
+// Capabilities implements stack.LinkEndpoint.Capabilities. It just forwards the
+// request to the lower endpoint.
+func (e *endpoint) Capabilities() stack.LinkEndpointCapabilities {
+	return e.lower.Capabilities()
+}
+
+// MaxHeaderLength implements the stack.LinkEndpoint interface. It just forwards
+// the request to the lower endpoint.
+func (e *endpoint) MaxHeaderLength() uint16 {
+	return e.lower.MaxHeaderLength()
+}
+
+// LinkAddress implements stack.LinkEndpoint.LinkAddress. It just forwards the
+// request to the lower endpoint.
+func (e *endpoint) LinkAddress() tcpip.LinkAddress {
+	return e.lower.LinkAddress()
+}
+
+// WritePacket implements the stack.LinkEndpoint interface. It is called by
+// higher-level protocols to write packets; it forwards the packet to the lower
+// endpoint if the policy allows it, and fails with ErrNoRoute otherwise.
+func (e *endpoint) WritePacket(r *stack.Route, hdr *buffer.Prependable, payload buffer.View, protocol tcpip.NetworkProtocolNumber) *tcpip.Error {
+	if protocol != header.IPv4ProtocolNumber && protocol != header.IPv6ProtocolNumber {
+		return e.lower.WritePacket(r, hdr, payload, protocol)
+	}
+
+	p, ok := parse(hdr.UsedBytes(), protocol, true /* outbound */)
+	if !ok {
+		// The transport header may not be entirely in hdr.
+		b := make([]byte, 0, hdr.UsedLength()+len(payload))
+		b = append(append(b, hdr.UsedBytes()...), payload...)
+		if p, ok = parse(b, protocol, true /* outbound */); !ok {
+			log.Debugf("Egress policy dropped malformed packet")
+			return tcpip.ErrNoRoute
+		}
+	} else if p.protocol == header.UDPProtocolNumber && len(p.payload) == 0 {
+		// The UDP payload is normally passed separately from the
+		// headers. It is only needed for DNS queries.
+		p.payload = payload
+	}
+	if !e.allow(&p) {
+		log.Debugf("Egress policy dropped packet with protocol %d to %v port %d", p.protocol, p.remote, p.remotePort)
+		return tcpip.ErrNoRoute
+	}
+	return e.lower.WritePacket(r, hdr, payload, protocol)
+}
@@ -0,0 +1,406 @@
+// Copyright 2018 The Netstack Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package egress
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/buffer"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/header"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/stack"
+)
+
+const (
+	localAddr    = tcpip.Address("\x0a\x00\x00\x02")
+	resolverAddr = tcpip.Address("\x0a\x00\x00\x01")
+)
+
+type countedEndpoint struct {
+	writeCount int
+	dispatcher stack.NetworkDispatcher
+}
+
+func (e *countedEndpoint) Attach(dispatcher stack.NetworkDispatcher) {
+	e.dispatcher = dispatcher
+}
+
+func (e *countedEndpoint) IsAttached() bool {
+	return e.dispatcher != nil
+}
+
+func (e *countedEndpoint) MTU() uint32 {
+	return 1500
+}
+
+func (e *countedEndpoint) Capabilities() stack.LinkEndpointCapabilities {
+	return 0
+}
+
+func (e *countedEndpoint) MaxHeaderLength() uint16 {
+	return 0
+}
+
+func (e *countedEndpoint) LinkAddress() tcpip.LinkAddress {
+	return ""
+}
+
+func (e *countedEndpoint) WritePacket(r *stack.Route, hdr *buffer.Prependable, payload buffer.View, protocol tcpip.NetworkProtocolNumber) *tcpip.Error {
+	e.writeCount++
+	return nil
+}
+
+type countedDispatcher struct {
+	dispatchCount int
+}
+
+func (d *countedDispatcher) DeliverNetworkPacket(linkEP stack.LinkEndpoint, remoteLinkAddr tcpip.LinkAddress, protocol tcpip.NetworkProtocolNumber, vv *buffer.VectorisedView) {
+	d.dispatchCount++
+}
+
+type testContext struct {
+	t          *testing.T
+	ep         *endpoint
+	lower      *countedEndpoint
+	dispatcher *countedDispatcher
+	now        time.Time
+}
+
+func newTestContext(t *testing.T, p *Policy) *testContext {
+	lower := &countedEndpoint{}
+	ep, err := newEndpoint(lower, p)
+	if err != nil {
+		t.Fatalf("newEndpoint failed: %v", err)
+	}
+	c := &testContext{
+		t:          t,
+		ep:         ep,
+		lower:      lower,
+		dispatcher: &countedDispatcher{},
+		now:        time.Unix(1000, 0),
+	}
+	ep.now = func() time.Time { return c.now }
+	ep.Attach(c.dispatcher)
+	return c
+}
+
+// transportHeader returns a TCP or UDP header with the given ports.
+func transportHeader(protocol tcpip.TransportProtocolNumber, srcPort, dstPort uint16, payloadLen int) []byte {
+	switch protocol {
+	case header.TCPProtocolNumber:
+		b := make([]byte, header.TCPMinimumSize)
+		header.TCP(b).Encode(&header.TCPFields{
+			SrcPort:    srcPort,
+			DstPort:    dstPort,
+			DataOffset: header.TCPMinimumSize,
+			Flags:      header.TCPFlagSyn,
+		})
+		return b
+	case header.UDPProtocolNumber:
+		b := make([]byte, header.UDPMinimumSize)
+		header.UDP(b).Encode(&header.UDPFields{
+			SrcPort: srcPort,
+			DstPort: dstPort,
+			Length:  uint16(header.UDPMinimumSize + payloadLen),
+		})
+		return b
+	default:
+		// ICMP echo request.
+		return []byte{8, 0, 0, 0, 0, 0, 0, 0}
+	}
+}
+
+func ipv4Header(protocol tcpip.TransportProtocolNumber, src, dst tcpip.Address, totalLen int) []byte {
+	b := make([]byte, header.IPv4MinimumSize)
+	header.IPv4(b).Encode(&header.IPv4Fields{
+		IHL:         header.IPv4MinimumSize,
+		TotalLength: uint16(totalLen),
+		TTL:         64,
+		Protocol:    uint8(protocol),
+		SrcAddr:     src,
+		DstAddr:     dst,
+	})
+	return b
+}
+
+// send writes an IPv4 packet from the local address to dst through the
+// endpoint, and returns true if it reached the lower endpoint.
+func (c *testContext) send(protocol tcpip.TransportProtocolNumber, dst tcpip.Address, srcPort, dstPort uint16, payload []byte) bool {
+	th := transportHeader(protocol, srcPort, dstPort, len(payload))
+	hdr := buffer.NewPrependable(header.IPv4MinimumSize + len(th))
+	copy(hdr.Prepend(len(th)), th)
+	copy(hdr.Prepend(header.IPv4MinimumSize), ipv4Header(protocol, localAddr, dst, header.IPv4MinimumSize+len(th)+len(payload)))
+
+	before := c.lower.writeCount
+	err := c.ep.WritePacket(nil, &hdr, buffer.View(payload), header.IPv4ProtocolNumber)
+	sent := c.lower.writeCount != before
+	if sent != (err == nil) {
+		c.t.Fatalf("WritePacket returned %v, but packet sent = %t", err, sent)
+	}
+	if err != nil && err != tcpip.ErrNoRoute {
+		c.t.Fatalf("WritePacket returned %v, want %v", err, tcpip.ErrNoRoute)
+	}
+	return sent
+}
+
+// receive delivers an IPv4 packet from src to the local address through the
+// endpoint.
+func (c *testContext) receive(protocol tcpip.TransportProtocolNumber, src tcpip.Address, srcPort, dstPort uint16, payload []byte) {
+	th := transportHeader(protocol, srcPort, dstPort, len(payload))
+	totalLen := header.IPv4MinimumSize + len(th) + len(payload)
+	b := make([]byte, 0, totalLen)
+	b = append(b, ipv4Header(protocol, src, localAddr, totalLen)...)
+	b = append(b, th...)
+	b = append(b, payload...)
+
+	before := c.dispatcher.dispatchCount
+	vv := buffer.NewVectorisedView(len(b), []buffer.View{b})
+	c.ep.DeliverNetworkPacket(c.lower, "", header.IPv4ProtocolNumber, &vv)
+	if c.dispatcher.dispatchCount != before+1 {
+		c.t.Fatalf("Inbound packet wasn't delivered")
+	}
+}
+
+func dnsName(name string) []byte {
+	var b []byte
+	for _, l := range strings.Split(name, ".") {
+		b = append(b, byte(len(l)))
+		b = append(b, l...)
+	}
+	return append(b, 0)
+}
+
+func dnsQueryMessage(id uint16, name string) []byte {
+	b := make([]byte, dnsHeaderSize)
+	binary.BigEndian.PutUint16(b, id)
+	binary.BigEndian.PutUint16(b[4:], 1)
+	b = append(b, dnsName(name)...)
+	return append(b, 0, dnsTypeA, 0, dnsClassIN)
+}
+
+// dnsResponseMessage returns a response to a query for name, in which name is
+// an alias of target, and target has address addr.
+func dnsResponseMessage(id uint16, name, target string, addr tcpip.Address, ttl uint32) []byte {
+	b := dnsQueryMessage(id, name)
+	b[2] |= 0x80
+	binary.BigEndian.PutUint16(b[6:], 2)
+
+	// CNAME record, with the owner name compressed to the question name.
+	b = append(b, 0xc0, dnsHeaderSize, 0, 5, 0, dnsClassIN, 0, 0, 0, 60)
+	rdata := dnsName(target)
+	b = append(b, byte(len(rdata)>>8), byte(len(rdata)))
+	targetOff := len(b)
+	b = append(b, rdata...)
+
+	// A record, with the owner name compressed to the CNAME's target.
+	b = append(b, 0xc0|byte(targetOff>>8), byte(targetOff), 0, dnsTypeA, 0, dnsClassIN)
+	b = append(b, byte(ttl>>24), byte(ttl>>16), byte(ttl>>8), byte(ttl))
+	b = append(b, 0, byte(len(addr)))
+	return append(b, addr...)
+}
+
+func TestValidate(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		policy Policy
+		err    string
+	}{
+		{
+			name:   "valid",
+			policy: Policy{Default: Deny, Rules: []Rule{{Action: Allow, CIDR: "10.0.0.0/8", Protocol: "tcp", Ports: []uint16{80}}, {Action: Allow, Host: "*.example.com"}}},
+		},
+		{
+			name:   "missing default",
+			policy: Policy{},
+			err:    "default",
+		},
+		{
+			name:   "bad action",
+			policy: Policy{Default: Allow, Rules: []Rule{{Action: "drop"}}},
+			err:    "invalid action",
+		},
+		{
+			name:   "bad cidr",
+			policy: Policy{Default: Allow, Rules: []Rule{{Action: Deny, CIDR: "10.0.0.1"}}},
+			err:    "invalid cidr",
+		},
+		{
+			name:   "cidr and host",
+			policy: Policy{Default: Allow, Rules: []Rule{{Action: Deny, CIDR: "10.0.0.0/8", Host: "example.com"}}},
+			err:    "together",
+		},
+		{
+			name:   "bad host",
+			policy: Policy{Default: Allow, Rules: []Rule{{Action: Deny, Host: "a.*.com"}}},
+			err:    "invalid host",
+		},
+		{
+			name:   "icmp ports",
+			policy: Policy{Default: Allow, Rules: []Rule{{Action: Deny, Protocol: "icmp", Ports: []uint16{1}}}},
+			err:    "ports",
+		},
+		{
+			name:   "bad protocol",
+			policy: Policy{Default: Allow, Rules: []Rule{{Action: Deny, Protocol: "sctp"}}},
+			err:    "invalid protocol",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.policy.Validate()
+			if test.err == "" {
+				if err != nil {
+					t.Fatalf("Validate failed: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("Validate returned %v, want error containing %q", err, test.err)
+			}
+		})
+	}
+}
+
+func TestRules(t *testing.T) {
+	c := newTestContext(t, &Policy{
+		Default: Deny,
+		Rules: []Rule{
+			{Action: Deny, CIDR: "192.168.1.0/24"},
+			{Action: Allow, CIDR: "192.168.0.0/16", Protocol: "tcp", Ports: []uint16{80, 443}},
+			{Action: Allow, Protocol: "icmp"},
+		},
+	})
+
+	for _, test := range []struct {
+		name     string
+		protocol tcpip.TransportProtocolNumber
+		dst      tcpip.Address
+		port     uint16
+		want     bool
+	}{
+		{"allowed", header.TCPProtocolNumber, "\xc0\xa8\x02\x01", 443, true},
+		{"earlier rule denies", header.TCPProtocolNumber, "\xc0\xa8\x01\x01", 443, false},
+		{"wrong port", header.TCPProtocolNumber, "\xc0\xa8\x02\x01", 22, false},
+		{"wrong protocol", header.UDPProtocolNumber, "\xc0\xa8\x02\x01", 443, false},
+		{"outside subnet", header.TCPProtocolNumber, "\x0a\x00\x00\x05", 443, false},
+		{"icmp", header.ICMPv4ProtocolNumber, "\x0a\x00\x00\x05", 0, true},
+	} {
+		if got := c.send(test.protocol, test.dst, 1000, test.port, nil); got != test.want {
+			t.Errorf("%s: packet sent = %t, want %t", test.name, got, test.want)
+		}
+	}
+
+	// Non-IP packets are not filtered.
+	hdr := buffer.NewPrependable(0)
+	if err := c.ep.WritePacket(nil, &hdr, nil, header.ARPProtocolNumber); err != nil {
+		t.Errorf("WritePacket of ARP packet failed: %v", err)
+	}
+}
+
+func TestHost(t *testing.T) {
+	c := newTestContext(t, &Policy{
+		Default: Deny,
+		Rules: []Rule{
+			{Action: Allow, CIDR: "10.0.0.1/32", Protocol: "udp", Ports: []uint16{53}},
+			{Action: Allow, Host: "*.example.com", Protocol: "tcp", Ports: []uint16{443}},
+		},
+	})
+	const target = tcpip.Address("\x5d\xb8\xd8\x22")
+
+	if c.send(header.TCPProtocolNumber, target, 1000, 443, nil) {
+		t.Fatalf("Packet to unresolved host was sent")
+	}
+
+	// A response that doesn't answer a query is ignored.
+	c.receive(header.UDPProtocolNumber, resolverAddr, 53, 2000, dnsResponseMessage(1, "www.example.com", "cdn.example.net", target, 300))
+	if c.send(header.TCPProtocolNumber, target, 1001, 443, nil) {
+		t.Fatalf("Packet to host resolved by unsolicited response was sent")
+	}
+
+	// A response with a different ID is ignored.
+	if !c.send(header.UDPProtocolNumber, resolverAddr, 2000, 53, dnsQueryMessage(2, "www.example.com")) {
+		t.Fatalf("DNS query wasn't sent")
+	}
+	c.receive(header.UDPProtocolNumber, resolverAddr, 53, 2000, dnsResponseMessage(3, "www.example.com", "cdn.example.net", target, 300))
+	if c.send(header.TCPProtocolNumber, target, 1002, 443, nil) {
+		t.Fatalf("Packet to host resolved by mismatched response was sent")
+	}
+
+	// Names are case insensitive, and the alias matches the rule even though the
+	// address belongs to another name.
+	c.receive(header.UDPProtocolNumber, resolverAddr, 53, 2000, dnsResponseMessage(2, "WWW.Example.com", "cdn.example.net", target, 300))
+	if !c.send(header.TCPProtocolNumber, target, 1003, 443, nil) {
+		t.Fatalf("Packet to resolved host wasn't sent")
+	}
+	if c.send(header.TCPProtocolNumber, target, 1004, 80, nil) {
+		t.Fatalf("Packet to resolved host on wrong port was sent")
+	}
+
+	// Once the name expires, new flows are denied but the existing one
+	// still works.
+	c.now = c.now.Add(301 * time.Second)
+	if c.send(header.TCPProtocolNumber, target, 1005, 443, nil) {
+		t.Fatalf("Packet to expired host was sent")
+	}
+	if !c.send(header.TCPProtocolNumber, target, 1003, 443, nil) {
+		t.Fatalf("Packet of existing flow wasn't sent")
+	}
+}
+
+func TestReplies(t *testing.T) {
+	c := newTestContext(t, &Policy{
+		Default: Deny,
+		Rules: []Rule{
+			{Action: Allow, CIDR: "10.0.0.1/32", Protocol: "udp", Ports: []uint16{53}},
+			{Action: Allow, Host: "www.example.com", Protocol: "tcp", Ports: []uint16{443}},
+		},
+	})
+	const target = tcpip.Address("\x5d\xb8\xd8\x22")
+
+	if !c.send(header.UDPProtocolNumber, resolverAddr, 2000, 53, dnsQueryMessage(1, "www.example.com")) {
+		t.Fatalf("DNS query wasn't sent")
+	}
+	c.receive(header.UDPProtocolNumber, resolverAddr, 53, 2000, dnsResponseMessage(1, "www.example.com", "www.example.com", target, 60))
+	if !c.send(header.TCPProtocolNumber, target, 1000, 443, nil) {
+		t.Fatalf("Packet to resolved host wasn't sent")
+	}
+
+	// Inbound packets keep the flow alive after the name and the last
+	// outbound packet have expired.
+	c.now = c.now.Add(tcpFlowTimeout - time.Second)
+	c.receive(header.TCPProtocolNumber, target, 443, 1000, nil)
+	c.now = c.now.Add(tcpFlowTimeout - time.Second)
+	if !c.send(header.TCPProtocolNumber, target, 1000, 443, nil) {
+		t.Fatalf("Reply wasn't sent")
+	}
+	if c.send(header.TCPProtocolNumber, target, 1001, 443, nil) {
+		t.Fatalf("Packet of another flow was sent")
+	}
+
+	// Idle flows are forgotten, and inbound packets don't revive them.
+	c.now = c.now.Add(tcpFlowTimeout + time.Second)
+	c.receive(header.TCPProtocolNumber, target, 443, 1000, nil)
+	if c.send(header.TCPProtocolNumber, target, 1000, 443, nil) {
+		t.Fatalf("Packet of expired flow was sent")
+	}
+}
+
+func TestUnsolicited(t *testing.T) {
+	c := newTestContext(t, &Policy{Default: Deny})
+	const remote = tcpip.Address("\x5d\xb8\xd8\x22")
+
+	// An inbound packet, possibly spoofed, doesn't open an egress path for
+	// its flow.
+	c.receive(header.TCPProtocolNumber, remote, 5000, 80, nil)
+	if c.send(header.TCPProtocolNumber, remote, 80, 5000, nil) {
+		t.Fatalf("Reply to unsolicited packet was sent")
+	}
+	c.receive(header.UDPProtocolNumber, remote, 5000, 80, nil)
+	if c.send(header.UDPProtocolNumber, remote, 80, 5000, nil) {
+		t.Fatalf("Reply to unsolicited datagram was sent")
+	}
+}
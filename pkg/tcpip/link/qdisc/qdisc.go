@@ -0,0 +1,479 @@
+// Copyright 2018 The Netstack Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package qdisc provides the implementation of data-link layer endpoints that
+// wrap another endpoint and shape the outbound traffic, like a Linux queueing
+// discipline.
+//
+// Outbound packets are sent at a limited rate, using a token bucket. Packets
+// that can't be sent immediately are queued in flow queues, which are selected
+// by hashing the addresses, transport protocol and ports of the packets. Flow
+// queues are served with deficit round robin, so that a bulk flow can't add
+// latency to interactive ones. Optionally, packets that have been queued for
+// longer than a target delay are dropped from the head of their queue, which
+// is a simplified form of CoDel. Together, these approximate a Linux tbf
+// qdisc with an fq_codel child.
+//
+// Endpoints are created with shaping disabled, in which case packets are passed
+// to the lower endpoint as they are written. Shaping is enabled by calling
+// Endpoint.SetConfig with a non-zero rate.
+//
+// Qdisc endpoints can be used in the networking stack by calling New(eID) to
+// create a new endpoint, where eID is the ID of the endpoint being wrapped,
+// and then passing it as an argument to Stack.CreateNIC().
+package qdisc
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/buffer"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/header"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/stack"
+)
+
+const (
+	// DefaultLimit is the default maximum number of queued packets.
+	DefaultLimit = 1000
+
+	// defaultBurstTime is the time during which the default burst can be
+	// sent at the configured rate.
+	defaultBurstTime = 10 * time.Millisecond
+)
+
+// Config configures the shaping of an endpoint's outbound traffic. The zero
+// value disables shaping.
+type Config struct {
+	// Rate is the maximum rate at which packets are sent, in bytes per
+	// second. If it is zero, shaping is disabled and the other fields
+	// are ignored.
+	Rate uint64
+
+	// Burst is the number of bytes that can be sent at once. If it is
+	// zero, it defaults to the number of bytes that are sent in 10ms at
+	// Rate, and at least twice the MTU.
+	Burst uint32
+
+	// Limit is the maximum number of queued packets. Packets written when
+	// the queue is full are dropped. If it is zero, it defaults to
+	// DefaultLimit.
+	Limit uint32
+
+	// Flows is the number of flow queues. If it is zero or one, there is
+	// a single first-in first-out queue.
+	Flows uint32
+
+	// Quantum is the number of bytes that each flow queue may send in
+	// turn. If it is zero, it defaults to the MTU.
+	Quantum uint32
+
+	// Target is the queueing delay above which packets are dropped. It is
+	// never applied to the last packet of a flow queue, so that a flow
+	// isn't stalled. If it is zero, packets are only dropped when the
+	// queue is full.
+	Target time.Duration
+}
+
+// queuedPacket is an outbound packet that is waiting to be sent. It holds
+// copies of the route, header and payload that were written. Link-layer
+// endpoints only use the addresses of routes, so the copy of the route doesn't
+// hold a reference on its network endpoint.
+type queuedPacket struct {
+	route    stack.Route
+	hdr      buffer.Prependable
+	payload  buffer.View
+	protocol tcpip.NetworkProtocolNumber
+
+	// size is the size of the packet, without link-layer headers.
+	size int
+
+	// enqueued is the time at which the packet was queued.
+	enqueued time.Time
+}
+
+// flowQueue is the queue of the packets of the flows that hash to it.
+type flowQueue struct {
+	packets []queuedPacket
+
+	// deficit is the number of bytes that the queue may send before it
+	// is its next queue's turn.
+	deficit int
+
+	// active is true if the queue is in Endpoint.active.
+	active bool
+}
+
+// Endpoint is a link-layer endpoint that shapes the outbound traffic of the
+// endpoint that it wraps.
+type Endpoint struct {
+	dispatcher stack.NetworkDispatcher
+	lower      stack.LinkEndpoint
+
+	// mu protects the fields below.
+	mu sync.Mutex
+
+	// cond is signaled when packets are queued.
+	cond sync.Cond
+
+	// config is the current configuration. Its zero fields are replaced
+	// by their defaults when shaping is enabled.
+	config Config
+
+	// flows are the flow queues. There are config.Flows of them.
+	flows []flowQueue
+
+	// active are the indexes of the flow queues that have packets, in the
+	// order in which they are served.
+	active []int
+
+	// queued is the number of queued packets.
+	queued int
+
+	// tokens is the number of bytes that can be sent at the time last. It
+	// is negative when a packet larger than the available tokens was sent.
+	tokens int64
+	last   time.Time
+
+	// running is true if the goroutine that sends queued packets was
+	// started.
+	running bool
+
+	// dropped is the number of packets that were dropped.
+	dropped uint64
+}
+
+// New creates a new qdisc link-layer endpoint. It wraps around another
+// endpoint, and initially passes the packets that are written to it as they
+// are.
+func New(lower tcpip.LinkEndpointID) (tcpip.LinkEndpointID, *Endpoint) {
+	e := newEndpoint(stack.FindLinkEndpoint(lower))
+	return stack.RegisterLinkEndpoint(e), e
+}
+
+func newEndpoint(lower stack.LinkEndpoint) *Endpoint {
+	e := &Endpoint{lower: lower}
+	e.cond.L = &e.mu
+	return e
+}
+
+// Config returns the current configuration of the endpoint, with defaults
+// filled in.
+func (e *Endpoint) Config() Config {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.config
+}
+
+// SetConfig reconfigures the endpoint. Packets that are already queued keep
+// their order within their flows. Any that exceed the new limit are dropped,
+// and all of them are sent without delay if shaping is disabled.
+func (e *Endpoint) SetConfig(c Config) error {
+	mtu := e.lower.MTU()
+	if c.Rate == 0 {
+		c = Config{}
+	} else {
+		if c.Burst == 0 {
+			burst := c.Rate * uint64(defaultBurstTime) / uint64(time.Second)
+			if min := 2 * uint64(mtu); burst < min {
+				burst = min
+			}
+			if burst > 1<<31 {
+				burst = 1 << 31
+			}
+			c.Burst = uint32(burst)
+		}
+		if c.Limit == 0 {
+			c.Limit = DefaultLimit
+		}
+		if c.Flows == 0 {
+			c.Flows = 1
+		}
+		if c.Quantum == 0 {
+			c.Quantum = mtu
+		}
+	}
+	if c.Target < 0 {
+		return fmt.Errorf("negative target delay %v", c.Target)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	// Requeue the packets in the new flow queues. Packets of the same
+	// flow are in the same old queue, so their order is preserved. If
+	// shaping is disabled, the remaining packets are put in a single queue
+	// and sent as soon as possible, while new packets are sent directly.
+	n := c.Flows
+	if n == 0 {
+		n = 1
+	}
+	flows := make([]flowQueue, n)
+	var active []int
+	queued := 0
+	for _, i := range e.active {
+		for _, p := range e.flows[i].packets {
+			if c.Rate != 0 && queued >= int(c.Limit) {
+				e.dropped++
+				continue
+			}
+			j := 0
+			if n > 1 {
+				j = int(flowHash(p.hdr.UsedBytes(), p.protocol) % n)
+			}
+			q := &flows[j]
+			if !q.active {
+				q.active = true
+				q.deficit = int(c.Quantum)
+				active = append(active, j)
+			}
+			q.packets = append(q.packets, p)
+			queued++
+		}
+	}
+	e.config = c
+	e.flows = flows
+	e.active = active
+	e.queued = queued
+	if c.Rate != 0 {
+		e.tokens = int64(c.Burst)
+		e.last = time.Now()
+		if !e.running {
+			e.running = true
+			go e.run() // S/R-SAFE: packets are not saved.
+		}
+	}
+	return nil
+}
+
+// Dropped returns the number of packets that were dropped because the queue
+// was full or because they were queued for longer than the target delay.
+func (e *Endpoint) Dropped() uint64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.dropped
+}
+
+// enqueueLocked queues the packet p. It returns false if the queue is full.
+// e.mu must be locked.
+func (e *Endpoint) enqueueLocked(p queuedPacket) bool {
+	if e.queued >= int(e.config.Limit) {
+		return false
+	}
+	i := 0
+	if n := uint32(len(e.flows)); n > 1 {
+		i = int(flowHash(p.hdr.UsedBytes(), p.protocol) % n)
+	}
+	q := &e.flows[i]
+	if !q.active {
+		q.active = true
+		q.deficit = int(e.config.Quantum)
+		e.active = append(e.active, i)
+	}
+	q.packets = append(q.packets, p)
+	e.queued++
+	e.cond.Signal()
+	return true
+}
+
+// dequeueLocked returns the next packet to send, serving the flow queues with
+// deficit round robin. Packets that were queued for longer than the target
+// delay are dropped. It returns false if there are no queued packets. e.mu
+// must be locked.
+func (e *Endpoint) dequeueLocked(now time.Time) (queuedPacket, bool) {
+	for len(e.active) > 0 {
+		i := e.active[0]
+		q := &e.flows[i]
+		if len(q.packets) == 0 {
+			q.active = false
+			e.active = e.active[1:]
+			continue
+		}
+		if q.deficit <= 0 && e.config.Rate != 0 {
+			// It is the next queue's turn.
+			q.deficit += int(e.config.Quantum)
+			e.active = append(e.active[1:], i)
+			continue
+		}
+
+		p := q.packets[0]
+		q.packets[0] = queuedPacket{}
+		q.packets = q.packets[1:]
+		e.queued--
+		if e.config.Target != 0 && len(q.packets) > 0 && now.Sub(p.enqueued) > e.config.Target {
+			e.dropped++
+			continue
+		}
+		q.deficit -= p.size
+		return p, true
+	}
+	return queuedPacket{}, false
+}
+
+// waitTokensLocked waits until a packet of the given size may be sent, and
+// takes the tokens for it. The packet may be sent once there are enough tokens
+// for it, or a full bucket for packets larger than the burst. e.mu must be
+// locked, but it is released while waiting.
+func (e *Endpoint) waitTokensLocked(size int) {
+	for e.config.Rate != 0 {
+		now := time.Now()
+		elapsed := now.Sub(e.last)
+		e.last = now
+		if burstTime := time.Duration(uint64(e.config.Burst) * uint64(time.Second) / e.config.Rate); elapsed > burstTime {
+			elapsed = burstTime
+		}
+		e.tokens += int64(uint64(elapsed) * e.config.Rate / uint64(time.Second))
+		if e.tokens > int64(e.config.Burst) {
+			e.tokens = int64(e.config.Burst)
+		}
+
+		need := int64(size)
+		if need > int64(e.config.Burst) {
+			need = int64(e.config.Burst)
+		}
+		if e.tokens >= need {
+			e.tokens -= int64(size)
+			return
+		}
+		wait := time.Duration(uint64(need-e.tokens) * uint64(time.Second) / e.config.Rate)
+		e.mu.Unlock()
+		time.Sleep(wait)
+		e.mu.Lock()
+	}
+}
+
+// run sends the queued packets to the lower endpoint at the configured rate.
+func (e *Endpoint) run() {
+	e.mu.Lock()
+	for {
+		p, ok := e.dequeueLocked(time.Now())
+		if !ok {
+			e.cond.Wait()
+			continue
+		}
+		e.waitTokensLocked(p.size)
+		e.mu.Unlock()
+		e.lower.WritePacket(&p.route, &p.hdr, p.payload, p.protocol)
+		e.mu.Lock()
+	}
+}
+
+// flowHash hashes the addresses and transport protocol in the network header,
+// and the ports in the transport header, of the packet at the beginning of b.
+func flowHash(b []byte, protocol tcpip.NetworkProtocolNumber) uint32 {
+	h := fnvHash(2166136261)
+	switch protocol {
+	case header.IPv4ProtocolNumber:
+		if len(b) < header.IPv4MinimumSize {
+			break
+		}
+		ip := header.IPv4(b)
+		h.add(b[9:10])  // Protocol.
+		h.add(b[12:20]) // Addresses.
+		if hl := int(ip.HeaderLength()); ip.FragmentOffset() == 0 && len(b) >= hl+4 {
+			h.add(b[hl : hl+4]) // Ports.
+		}
+	case header.IPv6ProtocolNumber:
+		if len(b) < header.IPv6MinimumSize {
+			break
+		}
+		h.add(b[6:7])                      // Next header.
+		h.add(b[8:header.IPv6MinimumSize]) // Addresses.
+		if len(b) >= header.IPv6MinimumSize+4 {
+			h.add(b[header.IPv6MinimumSize : header.IPv6MinimumSize+4]) // Ports.
+		}
+	}
+	return uint32(h)
+}
+
+// fnvHash is a 32-bit FNV-1a hash.
+type fnvHash uint32
+
+func (h *fnvHash) add(b []byte) {
+	for _, c := range b {
+		*h ^= fnvHash(c)
+		*h *= 16777619
+	}
+}
+
+// DeliverNetworkPacket implements the stack.NetworkDispatcher interface. It is
+// called by the link-layer endpoint being wrapped when a packet arrives, and
+// forwards the packet to the actual dispatcher.
+func (e *Endpoint) DeliverNetworkPacket(linkEP stack.LinkEndpoint, remoteLinkAddr tcpip.LinkAddress, protocol tcpip.NetworkProtocolNumber, vv *buffer.VectorisedView) {
+	e.dispatcher.DeliverNetworkPacket(e, remoteLinkAddr, protocol, vv)
+}
+
+// Attach implements the stack.LinkEndpoint interface. It saves the dispatcher
+// and registers with the lower endpoint as its dispatcher so that "e" is called
+// for inbound packets.
+func (e *Endpoint) Attach(dispatcher stack.NetworkDispatcher) {
+	e.dispatcher = dispatcher
+	e.lower.Attach(e)
+}
+
+// IsAttached implements stack.LinkEndpoint.IsAttached.
+func (e *Endpoint) IsAttached() bool {
+	return e.dispatcher != nil
+}
+
+// MTU implements stack.LinkEndpoint.MTU. It just forwards the request to the
+// lower endpoint.
+func (e *Endpoint) MTU() uint32 {
+	return e.lower.MTU()
+}
+
+// Capabilities implements stack.LinkEndpoint.Capabilities. It just forwards the
+// request to the lower endpoint.
+func (e *Endpoint) Capabilities() stack.LinkEndpointCapabilities {
+	return e.lower.Capabilities()
+}
+
+// MaxHeaderLength implements the stack.LinkEndpoint interface. It just forwards
+// the request to the lower endpoint.
+func (e *Endpoint) MaxHeaderLength() uint16 {
+	return e.lower.MaxHeaderLength()
+}
+
+// LinkAddress implements stack.LinkEndpoint.LinkAddress. It just forwards the
+// request to the lower endpoint.
+func (e *Endpoint) LinkAddress() tcpip.LinkAddress {
+	return e.lower.LinkAddress()
+}
+
+// WritePacket implements the stack.LinkEndpoint interface. It is called by
+// higher-level protocols to write packets. If shaping is disabled, it forwards
+// the packet to the lower endpoint. Otherwise, it queues a copy of the packet,
+// which is sent later, and drops it if the queue is full.
+func (e *Endpoint) WritePacket(r *stack.Route, hdr *buffer.Prependable, payload buffer.View, protocol tcpip.NetworkProtocolNumber) *tcpip.Error {
+	e.mu.Lock()
+	if e.config.Rate == 0 {
+		e.mu.Unlock()
+		return e.lower.WritePacket(r, hdr, payload, protocol)
+	}
+
+	// The caller may reuse the header and payload once this returns, and
+	// the lower endpoint needs room to prepend its own headers.
+	p := queuedPacket{
+		route: stack.Route{
+			RemoteAddress:     r.RemoteAddress,
+			RemoteLinkAddress: r.RemoteLinkAddress,
+			LocalAddress:      r.LocalAddress,
+			LocalLinkAddress:  r.LocalLinkAddress,
+			NextHop:           r.NextHop,
+			NetProto:          r.NetProto,
+		},
+		hdr:      buffer.NewPrependable(hdr.UsedLength() + int(e.lower.MaxHeaderLength())),
+		payload:  append(buffer.View(nil), payload...),
+		protocol: protocol,
+		size:     hdr.UsedLength() + len(payload),
+		enqueued: time.Now(),
+	}
+	copy(p.hdr.Prepend(hdr.UsedLength()), hdr.UsedBytes())
+	if !e.enqueueLocked(p) {
+		e.dropped++
+	}
+	e.mu.Unlock()
+	return nil
+}
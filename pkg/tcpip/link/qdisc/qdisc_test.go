@@ -0,0 +1,233 @@
+// Copyright 2018 The Netstack Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package qdisc
+
+import (
+	"testing"
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/buffer"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/header"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/link/channel"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/stack"
+)
+
+const (
+	mtu        = 1500
+	localAddr  = tcpip.Address("\x0a\x00\x00\x02")
+	remoteAddr = tcpip.Address("\x0a\x00\x00\x01")
+)
+
+func newTestEndpoint() (*Endpoint, *channel.Endpoint) {
+	_, lower := channel.New(100, mtu, "")
+	return newEndpoint(lower), lower
+}
+
+// writeUDP writes a UDP packet from the given local port with a payload of
+// the given size through e.
+func writeUDP(t *testing.T, e *Endpoint, port uint16, size int) {
+	hdr := buffer.NewPrependable(header.IPv4MinimumSize + header.UDPMinimumSize)
+	udp := header.UDP(hdr.Prepend(header.UDPMinimumSize))
+	udp.Encode(&header.UDPFields{
+		SrcPort: port,
+		DstPort: 53,
+		Length:  uint16(header.UDPMinimumSize + size),
+	})
+	ip := header.IPv4(hdr.Prepend(header.IPv4MinimumSize))
+	ip.Encode(&header.IPv4Fields{
+		IHL:         header.IPv4MinimumSize,
+		TotalLength: uint16(header.IPv4MinimumSize + header.UDPMinimumSize + size),
+		TTL:         64,
+		Protocol:    uint8(header.UDPProtocolNumber),
+		SrcAddr:     localAddr,
+		DstAddr:     remoteAddr,
+	})
+	r := stack.Route{RemoteAddress: remoteAddr, LocalAddress: localAddr}
+	if err := e.WritePacket(&r, &hdr, buffer.NewView(size), header.IPv4ProtocolNumber); err != nil {
+		t.Fatalf("WritePacket failed: %v", err)
+	}
+}
+
+// packetPort returns the source port of the UDP packet p.
+func packetPort(p channel.PacketInfo) uint16 {
+	return header.UDP(p.Header[header.IPv4MinimumSize:]).SourcePort()
+}
+
+func TestDisabled(t *testing.T) {
+	e, lower := newTestEndpoint()
+	writeUDP(t, e, 1000, 100)
+	select {
+	case p := <-lower.C:
+		if got := packetPort(p); got != 1000 {
+			t.Errorf("got packet from port %d, want 1000", got)
+		}
+	default:
+		t.Fatalf("packet was not sent immediately")
+	}
+}
+
+func TestRate(t *testing.T) {
+	e, lower := newTestEndpoint()
+	const rate = 100000
+	if err := e.SetConfig(Config{Rate: rate, Burst: mtu}); err != nil {
+		t.Fatalf("SetConfig failed: %v", err)
+	}
+
+	const packets = 10
+	const size = 1000
+	start := time.Now()
+	for i := 0; i < packets; i++ {
+		writeUDP(t, e, 1000, size-header.IPv4MinimumSize-header.UDPMinimumSize)
+	}
+	for i := 0; i < packets; i++ {
+		select {
+		case <-lower.C:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for packet %d", i)
+		}
+	}
+
+	// All but the first packet must wait for tokens.
+	want := time.Duration((packets-1)*size) * time.Second / rate
+	if elapsed := time.Since(start); elapsed < want*3/4 {
+		t.Errorf("sent %d bytes in %v, want at least %v", packets*size, elapsed, want)
+	}
+}
+
+func TestDisableFlushesQueue(t *testing.T) {
+	e, lower := newTestEndpoint()
+	if err := e.SetConfig(Config{Rate: 1000, Burst: mtu}); err != nil {
+		t.Fatalf("SetConfig failed: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		writeUDP(t, e, 1000, 1000)
+	}
+	if err := e.SetConfig(Config{}); err != nil {
+		t.Fatalf("SetConfig failed: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		select {
+		case <-lower.C:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for packet %d", i)
+		}
+	}
+}
+
+// enqueueUDP queues a packet like writeUDP, without starting the goroutine
+// that sends queued packets.
+func enqueueUDP(t *testing.T, e *Endpoint, port uint16, size int, enqueued time.Time) bool {
+	hdr := buffer.NewPrependable(header.IPv4MinimumSize + header.UDPMinimumSize)
+	header.UDP(hdr.Prepend(header.UDPMinimumSize)).Encode(&header.UDPFields{SrcPort: port, DstPort: 53})
+	header.IPv4(hdr.Prepend(header.IPv4MinimumSize)).Encode(&header.IPv4Fields{
+		IHL:      header.IPv4MinimumSize,
+		Protocol: uint8(header.UDPProtocolNumber),
+		SrcAddr:  localAddr,
+		DstAddr:  remoteAddr,
+	})
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.enqueueLocked(queuedPacket{
+		hdr:      hdr,
+		protocol: header.IPv4ProtocolNumber,
+		size:     size,
+		enqueued: enqueued,
+	})
+}
+
+func dequeuePorts(e *Endpoint, now time.Time) []uint16 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var ports []uint16
+	for {
+		p, ok := e.dequeueLocked(now)
+		if !ok {
+			return ports
+		}
+		ports = append(ports, header.UDP(p.hdr.UsedBytes()[header.IPv4MinimumSize:]).SourcePort())
+	}
+}
+
+// configure sets the configuration of e without starting the goroutine that
+// sends queued packets.
+func configure(e *Endpoint, c Config) {
+	e.config = c
+	e.flows = make([]flowQueue, c.Flows)
+}
+
+func TestFairQueueing(t *testing.T) {
+	e, _ := newTestEndpoint()
+	configure(e, Config{Rate: 1, Limit: 100, Flows: 1024, Quantum: mtu})
+
+	// Find two ports whose flows are in different queues.
+	bulk, interactive := uint16(1000), uint16(1001)
+	hash := func(port uint16) uint32 {
+		hdr := buffer.NewPrependable(header.IPv4MinimumSize + header.UDPMinimumSize)
+		header.UDP(hdr.Prepend(header.UDPMinimumSize)).Encode(&header.UDPFields{SrcPort: port, DstPort: 53})
+		header.IPv4(hdr.Prepend(header.IPv4MinimumSize)).Encode(&header.IPv4Fields{
+			IHL:      header.IPv4MinimumSize,
+			Protocol: uint8(header.UDPProtocolNumber),
+			SrcAddr:  localAddr,
+			DstAddr:  remoteAddr,
+		})
+		return flowHash(hdr.UsedBytes(), header.IPv4ProtocolNumber) % 1024
+	}
+	for hash(interactive) == hash(bulk) {
+		interactive++
+	}
+
+	now := time.Now()
+	for i := 0; i < 4; i++ {
+		enqueueUDP(t, e, bulk, mtu, now)
+	}
+	enqueueUDP(t, e, interactive, 100, now)
+
+	// The interactive packet is sent as soon as the bulk flow has used its
+	// quantum.
+	got := dequeuePorts(e, now)
+	want := []uint16{bulk, interactive, bulk, bulk, bulk}
+	if len(got) != len(want) {
+		t.Fatalf("got packets from ports %v, want %v", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("got packets from ports %v, want %v", got, want)
+		}
+	}
+}
+
+func TestLimit(t *testing.T) {
+	e, _ := newTestEndpoint()
+	configure(e, Config{Rate: 1, Limit: 2, Flows: 1, Quantum: mtu})
+	now := time.Now()
+	for i := 0; i < 2; i++ {
+		if !enqueueUDP(t, e, 1000, 100, now) {
+			t.Fatalf("packet %d was not queued", i)
+		}
+	}
+	if enqueueUDP(t, e, 1000, 100, now) {
+		t.Fatalf("packet was queued beyond the limit")
+	}
+}
+
+func TestTarget(t *testing.T) {
+	e, _ := newTestEndpoint()
+	configure(e, Config{Rate: 1, Limit: 100, Flows: 1, Quantum: 10 * mtu, Target: 10 * time.Millisecond})
+	now := time.Now()
+	enqueueUDP(t, e, 1000, 100, now.Add(-time.Second))
+	enqueueUDP(t, e, 1001, 100, now.Add(-time.Second))
+	enqueueUDP(t, e, 1002, 100, now)
+	enqueueUDP(t, e, 1003, 100, now.Add(-time.Second))
+
+	// Late packets are dropped, except for the last one.
+	got := dequeuePorts(e, now)
+	if len(got) != 2 || got[0] != 1002 || got[1] != 1003 {
+		t.Fatalf("got packets from ports %v, want [1002 1003]", got)
+	}
+	if d := e.Dropped(); d != 2 {
+		t.Errorf("got %d dropped packets, want 2", d)
+	}
+}
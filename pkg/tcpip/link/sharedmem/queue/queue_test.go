@@ -25,7 +25,7 @@ func TestBasicTxQueue(t *testing.T) {
 	txp.Init(pb2)
 
 	var q Tx
-	q.Init(pb1, pb2)
+	q.Init(pb1, pb2, nil)
 
 	// Enqueue two buffers.
 	b := []TxBuffer{
@@ -193,7 +193,7 @@ func TestBadTxCompletion(t *testing.T) {
 	txp.Init(pb2)
 
 	var q Tx
-	q.Init(pb1, pb2)
+	q.Init(pb1, pb2, nil)
 
 	// Post a completion that is too short, and check that it is ignored.
 	if d := txp.Push(7); d == nil {
@@ -308,7 +308,7 @@ func TestFillTxPipe(t *testing.T) {
 	txp.Init(pb2)
 
 	var q Tx
-	q.Init(pb1, pb2)
+	q.Init(pb1, pb2, nil)
 
 	// Transmit twice, which should fill the tx pipe.
 	b := []TxBuffer{
@@ -376,7 +376,7 @@ func TestLotsOfTransmissions(t *testing.T) {
 	txp.Init(pb2)
 
 	var q Tx
-	q.Init(pb1, pb2)
+	q.Init(pb1, pb2, nil)
 
 	// Prepare packet with two buffers.
 	b := []TxBuffer{
@@ -505,3 +505,27 @@ func TestRxDisableNotification(t *testing.T) {
 		t.Fatalf("Bad value in shared state: got %v, want %v", state, eventFDDisabled)
 	}
 }
+
+func TestTxNotificationEnabled(t *testing.T) {
+	// Check that the shared state set by the peer is properly interpreted.
+	pb1 := make([]byte, 100)
+	pb2 := make([]byte, 100)
+
+	var state uint32
+	var q Tx
+	q.Init(pb1, pb2, &state)
+
+	for _, test := range []struct {
+		state uint32
+		want  bool
+	}{
+		{eventFDUninitialized, false},
+		{eventFDDisabled, false},
+		{eventFDEnabled, true},
+	} {
+		state = test.state
+		if got := q.NotificationEnabled(); got != test.want {
+			t.Errorf("NotificationEnabled() with shared state %v: got %v, want %v", test.state, got, test.want)
+		}
+	}
+}
@@ -4,6 +4,56 @@
 
 // Package queue provides the implementation of transmit and receive queues
 // based on shared memory ring buffers.
+//
+// The layout of the queues is an ABI shared with the peer, which may be an
+// external dataplane, and must not change incompatibly. All integers are
+// little-endian, and all offsets are in bytes.
+//
+// Each queue consists of a data region, two pipes (see package pipe), a
+// shared data region and an eventfd. Pipe records are:
+//
+// Transmit queue, tx pipe (packets to transmit, written by the endpoint):
+//
+//	0   uint64  packet ID
+//	8   uint32  total packet size
+//	12  uint32  reserved, zero
+//	16  buffer descriptors, 12 bytes each:
+//	    0  uint64  offset of the buffer in the data region
+//	    8  uint32  size of the buffer
+//
+// Transmit queue, rx pipe (completions, written by the peer):
+//
+//	0   uint64  ID of a packet whose buffers may be reused
+//
+// Receive queue, tx pipe (posted buffers, written by the endpoint):
+//
+//	0   uint64  offset of the buffer in the data region
+//	8   uint32  size of the buffer
+//	12  uint32  reserved, zero
+//	16  uint64  user data, opaque to the peer
+//	24  uint64  buffer ID
+//
+// Receive queue, rx pipe (received packets, written by the peer):
+//
+//	0   uint32  total packet size
+//	4   uint32  reserved, zero
+//	8   buffer descriptors, 28 bytes each:
+//	    0   uint64  offset of the buffer in the data region
+//	    8   uint32  size of the data in the buffer
+//	    12  uint64  user data of the posted buffer
+//	    20  uint64  ID of the posted buffer
+//
+// A single record describes a whole packet, and any number of records may be
+// made visible to the other side at once, so the peer can batch both
+// descriptors and doorbells.
+//
+// The first four bytes of the shared data region hold a uint32 eventfd state,
+// which is written by the side that consumes packets from the queue (the peer
+// for transmit queues, the endpoint for receive queues): 0 (uninitialized) or
+// 1 (disabled) suppress the doorbell; 2 (enabled) asks the producer to write
+// to the eventfd after it makes new records visible. Before sleeping on the
+// eventfd, the consumer must enable notifications and then check the pipe
+// again, so that records made visible concurrently are not missed.
 package queue
 
 import (
@@ -6,6 +6,7 @@ package queue
 
 import (
 	"encoding/binary"
+	"sync/atomic"
 
 	"gvisor.googlesource.com/gvisor/pkg/log"
 	"gvisor.googlesource.com/gvisor/pkg/tcpip/link/sharedmem/pipe"
@@ -39,16 +40,26 @@ type TxBuffer struct {
 //
 // This struct is thread-compatible.
 type Tx struct {
-	tx pipe.Tx
-	rx pipe.Rx
+	tx                 pipe.Tx
+	rx                 pipe.Rx
+	sharedEventFDState *uint32
 }
 
-// Init initializes the transmit queue with the given pipes.
-func (t *Tx) Init(tx, rx []byte) {
+// Init initializes the transmit queue with the given pipes, and shared state
+// pointer -- the latter is used by the peer to enable/disable eventfd
+// notifications.
+func (t *Tx) Init(tx, rx []byte, sharedEventFDState *uint32) {
+	t.sharedEventFDState = sharedEventFDState
 	t.tx.Init(tx)
 	t.rx.Init(rx)
 }
 
+// NotificationEnabled returns true if the peer has requested to be notified
+// via the eventfd when packets are enqueued.
+func (t *Tx) NotificationEnabled() bool {
+	return atomic.LoadUint32(t.sharedEventFDState) == eventFDEnabled
+}
+
 // Enqueue queues the given linked list of buffers for transmission as one
 // packet. While it is queued, the caller must not modify them.
 func (t *Tx) Enqueue(id uint64, totalDataLen, bufferCount uint32, buffer *TxBuffer) bool {
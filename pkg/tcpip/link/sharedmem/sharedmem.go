@@ -50,6 +50,13 @@ type QueueConfig struct {
 	SharedDataFD int
 }
 
+// txQueue is a tx queue along with the lock that serializes transmissions on
+// it.
+type txQueue struct {
+	mu sync.Mutex
+	tx tx
+}
+
 type endpoint struct {
 	// mtu (maximum transmission unit) is the maximum size of a packet.
 	mtu uint32
@@ -60,63 +67,100 @@ type endpoint struct {
 	// addr is the local address of this endpoint.
 	addr tcpip.LinkAddress
 
-	// rx is the receive queue.
-	rx rx
+	// rx is the set of receive queues. Each is serviced by its own worker
+	// goroutine.
+	rx []rx
+
+	// tx is the set of transmit queues. Packets of the same flow are always
+	// transmitted on the same queue.
+	tx []txQueue
 
 	// stopRequested is to be accessed atomically only, and determines if
 	// the worker goroutines should stop.
 	stopRequested uint32
 
+	// runningWorkers is the number of worker goroutines that haven't
+	// stopped yet. It is to be accessed atomically only. The last worker
+	// to stop releases the tx queues.
+	runningWorkers int32
+
 	// Wait group used to indicate that all workers have stopped.
 	completed sync.WaitGroup
 
 	// mu protects the following fields.
 	mu sync.Mutex
 
-	// tx is the transmit queue.
-	tx tx
-
-	// workerStarted specifies whether the worker goroutine was started.
+	// workerStarted specifies whether the worker goroutines were started.
 	workerStarted bool
 }
 
 // New creates a new shared-memory-based endpoint. Buffers will be broken up
 // into buffers of "bufferSize" bytes.
 func New(mtu, bufferSize uint32, addr tcpip.LinkAddress, tx, rx QueueConfig) (tcpip.LinkEndpointID, error) {
+	return NewMultiQueue(mtu, bufferSize, addr, []QueueConfig{tx}, []QueueConfig{rx})
+}
+
+// NewMultiQueue creates a new shared-memory-based endpoint with multiple tx
+// and rx queues, which allows the peer to process them in parallel. Buffers
+// will be broken up into buffers of "bufferSize" bytes.
+func NewMultiQueue(mtu, bufferSize uint32, addr tcpip.LinkAddress, txConfigs, rxConfigs []QueueConfig) (tcpip.LinkEndpointID, error) {
+	if len(txConfigs) == 0 || len(rxConfigs) == 0 {
+		return 0, syscall.EINVAL
+	}
+
 	e := &endpoint{
 		mtu:        mtu,
 		bufferSize: bufferSize,
 		addr:       addr,
+		tx:         make([]txQueue, len(txConfigs)),
+		rx:         make([]rx, len(rxConfigs)),
 	}
 
-	if err := e.tx.init(bufferSize, &tx); err != nil {
-		return 0, err
+	for i := range txConfigs {
+		if err := e.tx[i].tx.init(bufferSize, &txConfigs[i]); err != nil {
+			e.cleanup(i, 0)
+			return 0, err
+		}
 	}
 
-	if err := e.rx.init(bufferSize, &rx); err != nil {
-		e.tx.cleanup()
-		return 0, err
+	for i := range rxConfigs {
+		if err := e.rx[i].init(bufferSize, &rxConfigs[i]); err != nil {
+			e.cleanup(len(txConfigs), i)
+			return 0, err
+		}
 	}
 
 	return stack.RegisterLinkEndpoint(e), nil
 }
 
+// cleanup releases the first txCount tx queues and the first rxCount rx
+// queues.
+func (e *endpoint) cleanup(txCount, rxCount int) {
+	for i := 0; i < txCount; i++ {
+		e.tx[i].tx.cleanup()
+	}
+	for i := 0; i < rxCount; i++ {
+		e.rx[i].cleanup()
+	}
+}
+
 // Close frees all resources associated with the endpoint.
 func (e *endpoint) Close() {
-	// Tell dispatch goroutine to stop, then write to the eventfd so that
-	// it wakes up in case it's sleeping.
+	// Tell dispatch goroutines to stop, then write to the eventfds so that
+	// they wake up in case they're sleeping.
 	atomic.StoreUint32(&e.stopRequested, 1)
-	syscall.Write(e.rx.eventFD, []byte{1, 0, 0, 0, 0, 0, 0, 0})
+	for i := range e.rx {
+		syscall.Write(e.rx[i].eventFD, []byte{1, 0, 0, 0, 0, 0, 0, 0})
+	}
 
-	// Cleanup the queues inline if the worker hasn't started yet; we also
-	// know it won't start from now on because stopRequested is set to 1.
+	// Cleanup the queues inline if the workers haven't started yet; we also
+	// know they won't start from now on because stopRequested is set to 1.
 	e.mu.Lock()
 	workerPresent := e.workerStarted
 	e.mu.Unlock()
 
 	if !workerPresent {
-		e.tx.cleanup()
-		e.rx.cleanup()
+		e.cleanup(len(e.tx), len(e.rx))
 	}
 }
 
@@ -125,14 +169,17 @@ func (e *endpoint) Wait() {
 	e.completed.Wait()
 }
 
-// Attach implements stack.LinkEndpoint.Attach. It launches the goroutine that
-// reads packets from the rx queue.
+// Attach implements stack.LinkEndpoint.Attach. It launches the goroutines that
+// read packets from the rx queues.
 func (e *endpoint) Attach(dispatcher stack.NetworkDispatcher) {
 	e.mu.Lock()
 	if !e.workerStarted && atomic.LoadUint32(&e.stopRequested) == 0 {
 		e.workerStarted = true
-		e.completed.Add(1)
-		go e.dispatchLoop(dispatcher) // S/R-FIXME
+		e.runningWorkers = int32(len(e.rx))
+		e.completed.Add(len(e.rx))
+		for i := range e.rx {
+			go e.dispatchLoop(&e.rx[i], dispatcher) // S/R-FIXME
+		}
 	}
 	e.mu.Unlock()
 }
@@ -179,9 +226,13 @@ func (e *endpoint) WritePacket(r *stack.Route, hdr *buffer.Prependable, payload
 	})
 
 	// Transmit the packet.
-	e.mu.Lock()
-	ok := e.tx.transmit(hdr.UsedBytes(), payload)
-	e.mu.Unlock()
+	q := &e.tx[0]
+	if len(e.tx) > 1 {
+		q = &e.tx[flowHash(r, protocol)%uint32(len(e.tx))]
+	}
+	q.mu.Lock()
+	ok := q.tx.transmit(hdr.UsedBytes(), payload)
+	q.mu.Unlock()
 
 	if !ok {
 		return tcpip.ErrWouldBlock
@@ -190,12 +241,25 @@ func (e *endpoint) WritePacket(r *stack.Route, hdr *buffer.Prependable, payload
 	return nil
 }
 
+// flowHash returns a hash of the flow that packets sent via r with the given
+// protocol belong to, which is used to pick a tx queue.
+func flowHash(r *stack.Route, protocol tcpip.NetworkProtocolNumber) uint32 {
+	// FNV-1a.
+	h := uint32(2166136261)
+	for _, a := range []tcpip.Address{r.LocalAddress, r.RemoteAddress} {
+		for i := 0; i < len(a); i++ {
+			h = (h ^ uint32(a[i])) * 16777619
+		}
+	}
+	return (h ^ uint32(protocol)) * 16777619
+}
+
 // dispatchLoop reads packets from the rx queue in a loop and dispatches them
 // to the network stack.
-func (e *endpoint) dispatchLoop(d stack.NetworkDispatcher) {
+func (e *endpoint) dispatchLoop(r *rx, d stack.NetworkDispatcher) {
 	// Post initial set of buffers.
-	limit := e.rx.q.PostedBuffersLimit()
-	if l := uint64(len(e.rx.data)) / uint64(e.bufferSize); limit > l {
+	limit := r.q.PostedBuffersLimit()
+	if l := uint64(len(r.data)) / uint64(e.bufferSize); limit > l {
 		limit = l
 	}
 	for i := uint64(0); i < limit; i++ {
@@ -204,7 +268,7 @@ func (e *endpoint) dispatchLoop(d stack.NetworkDispatcher) {
 			Size:   e.bufferSize,
 			ID:     i,
 		}
-		if !e.rx.q.PostBuffers([]queue.RxBuffer{b}) {
+		if !r.q.PostBuffers([]queue.RxBuffer{b}) {
 			log.Warningf("Unable to post %v-th buffer", i)
 		}
 	}
@@ -215,14 +279,14 @@ func (e *endpoint) dispatchLoop(d stack.NetworkDispatcher) {
 	vv := buffer.NewVectorisedView(0, views)
 	for atomic.LoadUint32(&e.stopRequested) == 0 {
 		var n uint32
-		rxb, n = e.rx.postAndReceive(rxb, &e.stopRequested)
+		rxb, n = r.postAndReceive(rxb, &e.stopRequested)
 
 		// Copy data from the shared area to its own buffer, then
 		// prepare to repost the buffer.
 		b := make([]byte, n)
 		offset := uint32(0)
 		for i := range rxb {
-			copy(b[offset:], e.rx.data[rxb[i].Offset:][:rxb[i].Size])
+			copy(b[offset:], r.data[rxb[i].Offset:][:rxb[i].Size])
 			offset += rxb[i].Size
 
 			rxb[i].Size = e.bufferSize
@@ -239,9 +303,12 @@ func (e *endpoint) dispatchLoop(d stack.NetworkDispatcher) {
 		d.DeliverNetworkPacket(e, eth.SourceAddress(), eth.Type(), &vv)
 	}
 
-	// Clean state.
-	e.tx.cleanup()
-	e.rx.cleanup()
+	// Clean state. The tx queues are shared by all workers, so only the
+	// last one to stop releases them.
+	r.cleanup()
+	if atomic.AddInt32(&e.runningWorkers, -1) == 0 {
+		e.cleanup(len(e.tx), 0)
+	}
 
 	e.completed.Done()
 }
@@ -10,6 +10,7 @@ import (
 	"os"
 	"reflect"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"testing"
 	"time"
@@ -512,7 +513,7 @@ func TestSimpleReceive(t *testing.T) {
 	defer c.cleanup()
 
 	// Check that buffers have been posted.
-	limit := c.ep.rx.q.PostedBuffersLimit()
+	limit := c.ep.rx[0].q.PostedBuffersLimit()
 	timeout := time.After(2 * time.Second)
 	for i := uint64(0); i < limit; i++ {
 		bi := queue.DecodeRxBufferHeader(pollPull(t, &c.rxq.tx, timeout, "Timeout waiting for all buffers to be posted"))
@@ -590,7 +591,7 @@ func TestRxBuffersReposted(t *testing.T) {
 	defer c.cleanup()
 
 	// Receive all posted buffers.
-	limit := c.ep.rx.q.PostedBuffersLimit()
+	limit := c.ep.rx[0].q.PostedBuffersLimit()
 	buffers := make([]queue.RxBuffer, 0, limit)
 	timeout := time.After(2 * time.Second)
 	for i := limit; i > 0; i-- {
@@ -701,3 +702,153 @@ func TestCloseWhileWaitingToPost(t *testing.T) {
 	cleaned = true
 	c.ep.Wait()
 }
+
+// TestTxDoorbell checks that the endpoint notifies the peer of transmitted
+// packets via the eventfd only when the peer enables notifications.
+func TestTxDoorbell(t *testing.T) {
+	c := newTestContext(t, 20000, 1500, localLinkAddr)
+	defer c.cleanup()
+
+	sharedData, err := getBuffer(c.txCfg.SharedDataFD)
+	if err != nil {
+		t.Fatalf("getBuffer failed: %v", err)
+	}
+	defer syscall.Munmap(sharedData)
+	state := sharedDataPointer(sharedData)
+
+	if err := syscall.SetNonblock(c.txCfg.EventFD, true); err != nil {
+		t.Fatalf("SetNonblock failed: %v", err)
+	}
+
+	r := stack.Route{
+		RemoteLinkAddress: remoteLinkAddr,
+	}
+	buf := buffer.NewView(100)
+
+	for _, test := range []struct {
+		state    uint32
+		doorbell bool
+	}{
+		{0, false}, // Uninitialized.
+		{2, true},  // Enabled.
+		{1, false}, // Disabled.
+	} {
+		atomic.StoreUint32(state, test.state)
+
+		hdr := buffer.NewPrependable(int(c.ep.MaxHeaderLength()))
+		if err := c.ep.WritePacket(&r, &hdr, buf, header.IPv4ProtocolNumber); err != nil {
+			t.Fatalf("WritePacket failed: %v", err)
+		}
+		if c.txq.tx.Pull() == nil {
+			t.Fatalf("Packet not transmitted with eventfd state %v", test.state)
+		}
+		c.txq.tx.Flush()
+
+		var tmp [8]byte
+		_, err := syscall.Read(c.txCfg.EventFD, tmp[:])
+		if rang := err == nil; rang != test.doorbell {
+			t.Errorf("Doorbell rang = %v with eventfd state %v, want %v (read error %v)", rang, test.state, test.doorbell, err)
+		}
+	}
+}
+
+// TestMultiQueue checks that packets of a flow are always transmitted on the
+// same tx queue, and that packets are received from all rx queues.
+func TestMultiQueue(t *testing.T) {
+	const (
+		bufferSize = 1500
+		queues     = 2
+	)
+	sizes := queueSizes{
+		dataSize:       queueDataSize,
+		txPipeSize:     queuePipeSize,
+		rxPipeSize:     queuePipeSize,
+		sharedDataSize: 4096,
+	}
+	var (
+		txCfgs, rxCfgs []QueueConfig
+		txqs, rxqs     [queues]queueBuffers
+	)
+	for i := 0; i < queues; i++ {
+		txCfgs = append(txCfgs, createQueueFDs(t, sizes))
+		rxCfgs = append(rxCfgs, createQueueFDs(t, sizes))
+		initQueue(t, &txqs[i], &txCfgs[i])
+		initQueue(t, &rxqs[i], &rxCfgs[i])
+	}
+	defer func() {
+		for i := 0; i < queues; i++ {
+			closeFDs(&txCfgs[i])
+			closeFDs(&rxCfgs[i])
+			txqs[i].cleanup()
+			rxqs[i].cleanup()
+		}
+	}()
+
+	id, err := NewMultiQueue(20000, bufferSize, localLinkAddr, txCfgs, rxCfgs)
+	if err != nil {
+		t.Fatalf("NewMultiQueue failed: %v", err)
+	}
+	c := &testContext{
+		t:        t,
+		ep:       stack.FindLinkEndpoint(id).(*endpoint),
+		packetCh: make(chan struct{}, 100),
+	}
+	c.ep.Attach(c)
+	defer func() {
+		c.ep.Close()
+		c.ep.Wait()
+	}()
+
+	// Send packets on several flows, and check that each flow sticks to a
+	// single tx queue.
+	buf := buffer.NewView(100)
+	flowQueue := make(map[tcpip.Address]int)
+	for iters := 0; iters < 10; iters++ {
+		for f := 0; f < 8; f++ {
+			r := stack.Route{
+				LocalAddress:      "\x0a\x00\x00\x01",
+				RemoteAddress:     tcpip.Address([]byte{10, 0, 0, byte(2 + f)}),
+				RemoteLinkAddress: remoteLinkAddr,
+			}
+			hdr := buffer.NewPrependable(int(c.ep.MaxHeaderLength()))
+			if err := c.ep.WritePacket(&r, &hdr, buf, header.IPv4ProtocolNumber); err != nil {
+				t.Fatalf("WritePacket failed: %v", err)
+			}
+
+			q := -1
+			for i := range txqs {
+				if desc := txqs[i].tx.Pull(); desc != nil {
+					if q != -1 {
+						t.Fatalf("Packet transmitted on queues %v and %v", q, i)
+					}
+					q = i
+					pi := queue.DecodeTxPacketHeader(desc)
+					txqs[i].tx.Flush()
+					b := txqs[i].rx.Push(8)
+					queue.EncodeTxCompletion(b, pi.ID)
+					txqs[i].rx.Flush()
+				}
+			}
+			if q == -1 {
+				t.Fatalf("Packet not transmitted")
+			}
+			if want, ok := flowQueue[r.RemoteAddress]; ok && q != want {
+				t.Fatalf("Packet of flow %v transmitted on queue %v, want %v", r.RemoteAddress, q, want)
+			}
+			flowQueue[r.RemoteAddress] = q
+		}
+	}
+
+	// Complete a packet on each rx queue.
+	timeout := time.After(2 * time.Second)
+	for i := range rxqs {
+		bi := queue.DecodeRxBufferHeader(pollPull(t, &rxqs[i].tx, timeout, "Timeout waiting for buffer to be posted"))
+		rxqs[i].tx.Flush()
+		b := rxqs[i].rx.Push(queue.RxCompletionSize(1))
+		queue.EncodeRxCompletion(b, bufferSize, 0)
+		queue.EncodeRxCompletionBuffer(b, 0, bi)
+		rxqs[i].rx.Flush()
+		syscall.Write(rxCfgs[i].EventFD, []byte{1, 0, 0, 0, 0, 0, 0, 0})
+	}
+	c.waitForPackets(queues, timeout, "Timeout waiting for packets")
+}
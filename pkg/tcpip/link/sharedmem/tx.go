@@ -17,10 +17,12 @@ const (
 
 // tx holds all state associated with a tx queue.
 type tx struct {
-	data []byte
-	q    queue.Tx
-	ids  idManager
-	bufs bufferManager
+	data       []byte
+	sharedData []byte
+	q          queue.Tx
+	ids        idManager
+	bufs       bufferManager
+	eventFD    int
 }
 
 // init initializes all state needed by the tx queue based on the information
@@ -48,11 +50,32 @@ func (t *tx) init(mtu uint32, c *QueueConfig) error {
 		return err
 	}
 
+	sharedData, err := getBuffer(c.SharedDataFD)
+	if err != nil {
+		syscall.Munmap(txPipe)
+		syscall.Munmap(rxPipe)
+		syscall.Munmap(data)
+		return err
+	}
+
+	// Duplicate the eventFD so that caller can close it but we can still
+	// use it.
+	efd, err := syscall.Dup(c.EventFD)
+	if err != nil {
+		syscall.Munmap(txPipe)
+		syscall.Munmap(rxPipe)
+		syscall.Munmap(data)
+		syscall.Munmap(sharedData)
+		return err
+	}
+
 	// Initialize state based on buffers.
-	t.q.Init(txPipe, rxPipe)
+	t.q.Init(txPipe, rxPipe, sharedDataPointer(sharedData))
 	t.ids.init()
 	t.bufs.init(0, len(data), int(mtu))
 	t.data = data
+	t.sharedData = sharedData
+	t.eventFD = efd
 
 	return nil
 }
@@ -64,6 +87,8 @@ func (t *tx) cleanup() {
 	syscall.Munmap(a)
 	syscall.Munmap(b)
 	syscall.Munmap(t.data)
+	syscall.Munmap(t.sharedData)
+	syscall.Close(t.eventFD)
 }
 
 // transmit sends a packet made up of up to two buffers. Returns a boolean that
@@ -125,6 +150,12 @@ func (t *tx) transmit(a, b []byte) bool {
 		return false
 	}
 
+	// Ring the doorbell unless the peer suppressed it, e.g., because it is
+	// already busy processing the queue.
+	if t.q.NotificationEnabled() {
+		syscall.Write(t.eventFD, []byte{1, 0, 0, 0, 0, 0, 0, 0})
+	}
+
 	return true
 }
 
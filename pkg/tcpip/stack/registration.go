@@ -59,6 +59,14 @@ type TransportEndpoint interface {
 	HandleControlPacket(id TransportEndpointID, typ ControlType, extra uint32, vv *buffer.VectorisedView)
 }
 
+// Resetter is implemented by transport endpoints whose connections can be
+// aborted by the stack, e.g., when a drain deadline expires.
+type Resetter interface {
+	// Reset aborts the endpoint's connection, if any, and returns true if
+	// there was one to abort.
+	Reset() bool
+}
+
 // TransportProtocol is the interface that needs to be implemented by transport
 // protocols (e.g., tcp, udp) that want to be part of the networking stack.
 type TransportProtocol interface {
@@ -273,6 +273,17 @@ type Stack struct {
 
 	// clock is used to generate user-visible times.
 	clock tcpip.Clock
+
+	// redirectRules are the rules installed with SetRedirectRules.
+	redirectRules []RedirectRule
+
+	// originalDestinations maps the local address and port of each
+	// redirected connection to its original destination.
+	originalDestinations map[tcpip.FullAddress]tcpip.FullAddress
+
+	// draining is 1 if the stack is in drain mode. It is accessed
+	// atomically.
+	draining uint32
 }
 
 // New allocates a new networking stack with only the requested networking and
@@ -291,6 +302,8 @@ func New(clock tcpip.Clock, network []string, transport []string) *Stack {
 		linkAddrCache:      newLinkAddrCache(ageLimit, resolutionTimeout, resolutionAttempts),
 		PortManager:        ports.NewPortManager(),
 		clock:              clock,
+
+		originalDestinations: make(map[tcpip.FullAddress]tcpip.FullAddress),
 	}
 
 	// Add specified network protocols.
@@ -429,6 +442,14 @@ func (s *Stack) SetRouteTable(table []tcpip.Route) {
 	s.routeTable = table
 }
 
+// GetRouteTable returns a copy of the route table which is currently in use.
+func (s *Stack) GetRouteTable() []tcpip.Route {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return append([]tcpip.Route(nil), s.routeTable...)
+}
+
 // NewEndpoint creates a new transport layer endpoint of the given protocol.
 func (s *Stack) NewEndpoint(transport tcpip.TransportProtocolNumber, network tcpip.NetworkProtocolNumber, waiterQueue *waiter.Queue) (tcpip.Endpoint, *tcpip.Error) {
 	t, ok := s.transportProtocols[transport]
@@ -857,3 +878,139 @@ func (s *Stack) RemoveTCPProbe() {
 	s.tcpProbeFunc = nil
 	s.mu.Unlock()
 }
+
+// RedirectRule redirects outbound TCP connections to a local address, where an
+// interception proxy can accept them and retrieve their original destination
+// with OriginalDestination.
+type RedirectRule struct {
+	// Destination is the subnet of the destinations that are redirected.
+	Destination tcpip.Subnet
+
+	// Ports are the destination ports that are redirected. If empty, all
+	// ports are redirected.
+	Ports []uint16
+
+	// Target is the local address that connections are redirected to. It
+	// must be of the same protocol as Destination.
+	Target tcpip.FullAddress
+}
+
+// SetRedirectRules replaces the redirect rules of the stack. The first rule
+// that matches a connection decides where it is redirected to.
+//
+// Connections to loopback addresses and to the target itself are never
+// redirected. Endpoints can opt out of redirection with the
+// tcpip.NoRedirectOption option, which is how the interception proxy avoids
+// redirecting its own connections.
+//
+// NOTE: Only connections that are started after this call are redirected.
+func (s *Stack) SetRedirectRules(rules []RedirectRule) {
+	s.mu.Lock()
+	s.redirectRules = append([]RedirectRule(nil), rules...)
+	s.mu.Unlock()
+}
+
+// isLoopback returns true if addr is an IPv4 or IPv6 loopback address.
+func isLoopback(addr tcpip.Address) bool {
+	switch len(addr) {
+	case header.IPv4AddressSize:
+		return addr[0] == 127
+	case header.IPv6AddressSize:
+		return addr == "\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x01"
+	default:
+		return false
+	}
+}
+
+// RedirectTarget returns the address that a TCP connection to dst is
+// redirected to, if any.
+func (s *Stack) RedirectTarget(dst tcpip.FullAddress) (tcpip.FullAddress, bool) {
+	if isLoopback(dst.Addr) {
+		return tcpip.FullAddress{}, false
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for i := range s.redirectRules {
+		r := &s.redirectRules[i]
+		if !r.Destination.Contains(dst.Addr) {
+			continue
+		}
+		if len(r.Ports) > 0 {
+			found := false
+			for _, p := range r.Ports {
+				if p == dst.Port {
+					found = true
+					break
+				}
+			}
+			if !found {
+				continue
+			}
+		}
+		if r.Target.Addr == dst.Addr && r.Target.Port == dst.Port {
+			return tcpip.FullAddress{}, false
+		}
+		return r.Target, true
+	}
+	return tcpip.FullAddress{}, false
+}
+
+// AddOriginalDestination records that the redirected connection with the given
+// local address and port was originally made to dst.
+func (s *Stack) AddOriginalDestination(local, dst tcpip.FullAddress) {
+	local.NIC = 0
+	s.mu.Lock()
+	s.originalDestinations[local] = dst
+	s.mu.Unlock()
+}
+
+// RemoveOriginalDestination removes the original destination recorded for the
+// given local address and port.
+func (s *Stack) RemoveOriginalDestination(local tcpip.FullAddress) {
+	local.NIC = 0
+	s.mu.Lock()
+	delete(s.originalDestinations, local)
+	s.mu.Unlock()
+}
+
+// OriginalDestination returns the original destination of the redirected
+// connection whose local end has the given address and port. The interception
+// proxy passes the remote address of the connections it accepts.
+func (s *Stack) OriginalDestination(local tcpip.FullAddress) (tcpip.FullAddress, bool) {
+	local.NIC = 0
+	s.mu.RLock()
+	dst, ok := s.originalDestinations[local]
+	s.mu.RUnlock()
+	return dst, ok
+}
+
+// SetDraining puts the stack into or out of drain mode. While draining,
+// transport protocols refuse new incoming connections but continue to serve
+// the existing ones.
+func (s *Stack) SetDraining(draining bool) {
+	v := uint32(0)
+	if draining {
+		v = 1
+	}
+	atomic.StoreUint32(&s.draining, v)
+}
+
+// Draining returns true if the stack is in drain mode.
+func (s *Stack) Draining() bool {
+	return atomic.LoadUint32(&s.draining) != 0
+}
+
+// ResetConnections aborts all connections of the given transport protocol
+// whose endpoints implement Resetter. It returns the number of connections
+// that were aborted.
+func (s *Stack) ResetConnections(trans tcpip.TransportProtocolNumber) int {
+	n := 0
+	for _, ep := range s.demux.endpoints(trans) {
+		if r, ok := ep.(Resetter); ok && r.Reset() {
+			n++
+		}
+	}
+	return n
+}
@@ -87,6 +87,28 @@ func (d *transportDemuxer) unregisterEndpoint(netProtos []tcpip.NetworkProtocolN
 	}
 }
 
+// endpoints returns the endpoints registered for the given transport
+// protocol. Endpoints registered for several network protocols are only
+// returned once.
+func (d *transportDemuxer) endpoints(protocol tcpip.TransportProtocolNumber) []TransportEndpoint {
+	seen := make(map[TransportEndpoint]struct{})
+	var eps []TransportEndpoint
+	for ids, t := range d.protocol {
+		if ids.transport != protocol {
+			continue
+		}
+		t.mu.RLock()
+		for _, ep := range t.endpoints {
+			if _, ok := seen[ep]; !ok {
+				seen[ep] = struct{}{}
+				eps = append(eps, ep)
+			}
+		}
+		t.mu.RUnlock()
+	}
+	return eps
+}
+
 // deliverPacket attempts to deliver the given packet. Returns true if it found
 // an endpoint, false otherwise.
 func (d *transportDemuxer) deliverPacket(r *Route, protocol tcpip.TransportProtocolNumber, vv *buffer.VectorisedView, id TransportEndpointID) bool {
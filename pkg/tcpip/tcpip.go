@@ -398,10 +398,25 @@ type ReuseAddressOption int
 // Only supported on Unix sockets.
 type PasscredOption int
 
+// PasssecOption is used by SetSockOpt/GetSockOpt to specify whether
+// SCM_SECURITY socket control messages are enabled.
+//
+// Only supported on Unix sockets.
+type PasssecOption int
+
 // TimestampOption is used by SetSockOpt/GetSockOpt to specify whether
 // SO_TIMESTAMP socket control messages are enabled.
 type TimestampOption int
 
+// NoRedirectOption is used by SetSockOpt/GetSockOpt to specify whether the
+// connections of an endpoint are exempt from the stack's redirect rules.
+type NoRedirectOption int
+
+// OriginalDestinationOption is used by GetSockOpt to retrieve the original
+// destination of a redirected connection. It is available on both ends of the
+// connection.
+type OriginalDestinationOption FullAddress
+
 // TCPInfoOption is used by GetSockOpt to expose TCP statistics.
 //
 // TODO: Add and populate stat fields.
@@ -289,6 +289,12 @@ func (e *endpoint) handleSynSegment(ctx *listenContext, s *segment, opts *header
 func (e *endpoint) handleListenSegment(ctx *listenContext, s *segment) {
 	switch s.flags {
 	case flagSyn:
+		if ctx.stack.Draining() {
+			// New connections are refused while the stack is
+			// draining.
+			replyWithReset(s)
+			return
+		}
 		opts := parseSynSegmentOptions(s)
 		if incSynRcvdCount() {
 			s.incRef()
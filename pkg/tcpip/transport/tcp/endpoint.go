@@ -40,6 +40,7 @@ const (
 	notifyClose
 	notifyMTUChanged
 	notifyDrain
+	notifyReset
 )
 
 // SACKInfo holds TCP SACK related information for a given endpoint.
@@ -150,6 +151,16 @@ type endpoint struct {
 	noDelay   bool
 	reuseAddr bool
 
+	// noRedirect is set to true if the endpoint's connections are exempt
+	// from the stack's redirect rules.
+	noRedirect bool
+
+	// redirected is set to true if the endpoint's connection was
+	// redirected by the stack, in which case originalDst is the
+	// destination that the user asked to connect to.
+	redirected  bool
+	originalDst tcpip.FullAddress
+
 	// segmentQueue is used to hand received segments to the protocol
 	// goroutine. Segments are queued as long as the queue is not full,
 	// and dropped when it is.
@@ -373,6 +384,10 @@ func (e *endpoint) cleanupLocked() {
 		e.stack.UnregisterTransportEndpoint(e.boundNICID, e.effectiveNetProtos, ProtocolNumber, e.id)
 	}
 
+	if e.redirected {
+		e.stack.RemoveOriginalDestination(tcpip.FullAddress{Addr: e.id.LocalAddress, Port: e.id.LocalPort})
+	}
+
 	e.route.Release()
 }
 
@@ -582,6 +597,12 @@ func (e *endpoint) SetSockOpt(opt interface{}) *tcpip.Error {
 		e.mu.Unlock()
 		return nil
 
+	case tcpip.NoRedirectOption:
+		e.mu.Lock()
+		e.noRedirect = v != 0
+		e.mu.Unlock()
+		return nil
+
 	case tcpip.ReceiveBufferSizeOption:
 		// Make sure the receive buffer size is within the min and max
 		// allowed.
@@ -752,6 +773,38 @@ func (e *endpoint) GetSockOpt(opt interface{}) *tcpip.Error {
 		}
 		return nil
 
+	case *tcpip.NoRedirectOption:
+		e.mu.RLock()
+		v := e.noRedirect
+		e.mu.RUnlock()
+
+		*o = 0
+		if v {
+			*o = 1
+		}
+		return nil
+
+	case *tcpip.OriginalDestinationOption:
+		e.mu.RLock()
+		defer e.mu.RUnlock()
+
+		if e.state != stateConnected {
+			return tcpip.ErrNotConnected
+		}
+
+		// The connecting end remembers its original destination, while
+		// the accepting end looks it up by the connecting end's address.
+		if e.redirected {
+			*o = tcpip.OriginalDestinationOption(e.originalDst)
+			return nil
+		}
+		dst, ok := e.stack.OriginalDestination(tcpip.FullAddress{Addr: e.id.RemoteAddress, Port: e.id.RemotePort})
+		if !ok {
+			return tcpip.ErrNoSuchFile
+		}
+		*o = tcpip.OriginalDestinationOption(dst)
+		return nil
+
 	case *tcpip.TCPInfoOption:
 		*o = tcpip.TCPInfoOption{}
 		return nil
@@ -836,6 +889,24 @@ func (e *endpoint) Connect(addr tcpip.FullAddress) *tcpip.Error {
 		return tcpip.ErrInvalidEndpointState
 	}
 
+	// Redirect the connection if the stack's redirect rules ask for it.
+	// The original destination is registered with the stack below, once
+	// the local port is known.
+	redirected := false
+	var originalDst tcpip.FullAddress
+	if !e.noRedirect {
+		if target, ok := e.stack.RedirectTarget(addr); ok {
+			redirected = true
+			originalDst = tcpip.FullAddress{Addr: addr.Addr, Port: addr.Port}
+			addr = target
+			if header.IsV4MappedAddress(connectingAddr) {
+				connectingAddr = tcpip.Address("\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\xff\xff") + target.Addr
+			} else {
+				connectingAddr = target.Addr
+			}
+		}
+	}
+
 	// Find a route to the desired destination.
 	r, err := e.stack.FindRoute(nicid, e.id.LocalAddress, addr.Addr, netProto)
 	if err != nil {
@@ -898,6 +969,11 @@ func (e *endpoint) Connect(addr tcpip.FullAddress) *tcpip.Error {
 	e.effectiveNetProtos = netProtos
 	e.connectingAddress = connectingAddr
 	e.workerRunning = true
+	if redirected {
+		e.redirected = true
+		e.originalDst = originalDst
+		e.stack.AddOriginalDestination(tcpip.FullAddress{Addr: e.id.LocalAddress, Port: e.id.LocalPort}, originalDst)
+	}
 
 	go e.protocolMainLoop(false) // S/R-SAFE: will be drained before save.
 
@@ -1134,6 +1210,15 @@ func (e *endpoint) GetRemoteAddress() (tcpip.FullAddress, *tcpip.Error) {
 		return tcpip.FullAddress{}, tcpip.ErrNotConnected
 	}
 
+	// Redirection is transparent to the connecting end.
+	if e.redirected {
+		return tcpip.FullAddress{
+			Addr: e.originalDst.Addr,
+			Port: e.originalDst.Port,
+			NIC:  e.boundNICID,
+		}, nil
+	}
+
 	return tcpip.FullAddress{
 		Addr: e.id.RemoteAddress,
 		Port: e.id.RemotePort,
@@ -1176,6 +1261,18 @@ func (e *endpoint) HandleControlPacket(id stack.TransportEndpointID, typ stack.C
 	}
 }
 
+// Reset implements stack.Resetter.Reset. It aborts an established connection
+// by sending a RST to the peer.
+func (e *endpoint) Reset() bool {
+	e.mu.RLock()
+	connected := e.state == stateConnected
+	e.mu.RUnlock()
+	if connected {
+		e.notifyProtocolGoroutine(notifyReset)
+	}
+	return connected
+}
+
 // updateSndBufferUsage is called by the protocol goroutine when room opens up
 // in the send buffer. The number of newly available bytes is v.
 func (e *endpoint) updateSndBufferUsage(v int) {
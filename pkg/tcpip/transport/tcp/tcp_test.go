@@ -2667,6 +2667,178 @@ func TestSelfConnect(t *testing.T) {
 	}
 }
 
+func TestDrain(t *testing.T) {
+	c := context.New(t, defaultMTU)
+	defer c.Cleanup()
+
+	c.CreateConnected(789, 30000, nil)
+
+	// Create a listener.
+	var wq waiter.Queue
+	ep, err := c.Stack().NewEndpoint(tcp.ProtocolNumber, ipv4.ProtocolNumber, &wq)
+	if err != nil {
+		t.Fatalf("NewEndpoint failed: %v", err)
+	}
+	defer ep.Close()
+
+	if err := ep.Bind(tcpip.FullAddress{Port: context.StackPort}, nil); err != nil {
+		t.Fatalf("Bind failed: %v", err)
+	}
+
+	if err := ep.Listen(10); err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+
+	// New connections must be refused while draining.
+	c.Stack().SetDraining(true)
+	c.SendPacket(nil, &context.Headers{
+		SrcPort: context.TestPort + 1,
+		DstPort: context.StackPort,
+		Flags:   header.TCPFlagSyn,
+		SeqNum:  100,
+		RcvWnd:  30000,
+	})
+	checker.IPv4(t, c.GetPacket(),
+		checker.TCP(
+			checker.SrcPort(context.StackPort),
+			checker.DstPort(context.TestPort+1),
+			checker.TCPFlags(header.TCPFlagAck|header.TCPFlagRst),
+			checker.AckNum(101),
+		))
+
+	// Resetting connections must abort the established one, but not the
+	// listener.
+	if n := c.Stack().ResetConnections(tcp.ProtocolNumber); n != 1 {
+		t.Fatalf("ResetConnections returned %d, want 1", n)
+	}
+	checker.IPv4(t, c.GetPacket(),
+		checker.TCP(
+			checker.DstPort(context.TestPort),
+			checker.TCPFlags(header.TCPFlagAck|header.TCPFlagRst),
+			checker.SeqNum(uint32(c.IRS)+1),
+		))
+
+	if _, _, err := c.EP.Read(nil); err != tcpip.ErrConnectionAborted {
+		t.Fatalf("Unexpected error from Read: got %v, want %v", err, tcpip.ErrConnectionAborted)
+	}
+}
+
+func TestRedirect(t *testing.T) {
+	// This test ensures that connections to a destination matched by the
+	// stack's redirect rules are made to the rule's target instead, and
+	// that both ends can retrieve the original destination.
+	s := stack.New(&tcpip.StdClock{}, []string{ipv4.ProtocolName}, []string{tcp.ProtocolName})
+
+	id := loopback.New()
+	if testing.Verbose() {
+		id = sniffer.New(id)
+	}
+
+	if err := s.CreateNIC(1, id); err != nil {
+		t.Fatalf("CreateNIC failed: %v", err)
+	}
+
+	const proxyAddr = "\x7f\x00\x00\x01"
+	if err := s.AddAddress(1, ipv4.ProtocolNumber, proxyAddr); err != nil {
+		t.Fatalf("AddAddress failed: %v", err)
+	}
+
+	s.SetRouteTable([]tcpip.Route{
+		{
+			Destination: proxyAddr,
+			Mask:        "\xff\xff\xff\xff",
+			Gateway:     "",
+			NIC:         1,
+		},
+	})
+
+	subnet, nerr := tcpip.NewSubnet("\x00\x00\x00\x00", "\x00\x00\x00\x00")
+	if nerr != nil {
+		t.Fatalf("NewSubnet failed: %v", nerr)
+	}
+	proxy := tcpip.FullAddress{Addr: proxyAddr, Port: 15001}
+	s.SetRedirectRules([]stack.RedirectRule{{Destination: subnet, Target: proxy}})
+
+	// Create the proxy's listening endpoint.
+	var lwq waiter.Queue
+	listener, err := s.NewEndpoint(tcp.ProtocolNumber, ipv4.ProtocolNumber, &lwq)
+	if err != nil {
+		t.Fatalf("NewEndpoint failed: %v", err)
+	}
+	defer listener.Close()
+
+	if err := listener.Bind(proxy, nil); err != nil {
+		t.Fatalf("Bind failed: %v", err)
+	}
+
+	if err := listener.Listen(10); err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+
+	lwe, lch := waiter.NewChannelEntry(nil)
+	lwq.EventRegister(&lwe, waiter.EventIn)
+	defer lwq.EventUnregister(&lwe)
+
+	// Connect to an address that has no route; the connection must be
+	// redirected to the proxy.
+	var wq waiter.Queue
+	ep, err := s.NewEndpoint(tcp.ProtocolNumber, ipv4.ProtocolNumber, &wq)
+	if err != nil {
+		t.Fatalf("NewEndpoint failed: %v", err)
+	}
+	defer ep.Close()
+
+	we, ch := waiter.NewChannelEntry(nil)
+	wq.EventRegister(&we, waiter.EventOut)
+	defer wq.EventUnregister(&we)
+
+	original := tcpip.FullAddress{Addr: "\x0a\x00\x00\x01", Port: 80}
+	if err := ep.Connect(original); err != tcpip.ErrConnectStarted {
+		t.Fatalf("Unexpected return value from Connect: %v", err)
+	}
+
+	<-ch
+	if err := ep.GetSockOpt(tcpip.ErrorOption{}); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+
+	<-lch
+	n, _, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Accept failed: %v", err)
+	}
+	defer n.Close()
+
+	if got, err := ep.GetRemoteAddress(); err != nil || got.Addr != original.Addr || got.Port != original.Port {
+		t.Fatalf("GetRemoteAddress() = %+v, %v, want %+v", got, err, original)
+	}
+
+	for _, e := range []tcpip.Endpoint{ep, n} {
+		var got tcpip.OriginalDestinationOption
+		if err := e.GetSockOpt(&got); err != nil {
+			t.Fatalf("GetSockOpt(OriginalDestinationOption) failed: %v", err)
+		}
+		if got.Addr != original.Addr || got.Port != original.Port {
+			t.Fatalf("Unexpected original destination: got %+v, want %+v", got, original)
+		}
+	}
+
+	// Endpoints that are exempt from redirection must not be redirected.
+	exempt, err := s.NewEndpoint(tcp.ProtocolNumber, ipv4.ProtocolNumber, &waiter.Queue{})
+	if err != nil {
+		t.Fatalf("NewEndpoint failed: %v", err)
+	}
+	defer exempt.Close()
+
+	if err := exempt.SetSockOpt(tcpip.NoRedirectOption(1)); err != nil {
+		t.Fatalf("SetSockOpt failed: %v", err)
+	}
+
+	if err := exempt.Connect(original); err != tcpip.ErrNoRoute {
+		t.Fatalf("Unexpected return value from Connect: got %v, want %v", err, tcpip.ErrNoRoute)
+	}
+}
+
 func TestPathMTUDiscovery(t *testing.T) {
 	// This test verifies the stack retransmits packets after it receives an
 	// ICMP packet indicating that the path MTU has been exceeded.
@@ -31,6 +31,10 @@ type ConnectingEndpoint interface {
 	// Passcred implements socket.Credentialer.Passcred.
 	Passcred() bool
 
+	// Credentials returns the credentials set by
+	// PeerCredentialer.SetCredentials, which are reported to the peer.
+	Credentials() CredentialsControlMessage
+
 	// Type returns the socket type, typically either SockStream or
 	// SockSeqpacket. The connection attempt must be aborted if this
 	// value doesn't match the ConnectableEndpoint's type.
@@ -109,15 +113,16 @@ func NewConnectioned(stype SockType, uid UniqueIDProvider) Endpoint {
 }
 
 // NewPair allocates a new pair of connected unix-domain connectionedEndpoints.
-func NewPair(stype SockType, uid UniqueIDProvider) (Endpoint, Endpoint) {
+// Both endpoints have the credentials cred, and report them to each other.
+func NewPair(stype SockType, uid UniqueIDProvider, cred CredentialsControlMessage) (Endpoint, Endpoint) {
 	a := &connectionedEndpoint{
-		baseEndpoint: baseEndpoint{Queue: &waiter.Queue{}},
+		baseEndpoint: baseEndpoint{Queue: &waiter.Queue{}, cred: cred, peerCred: cred},
 		id:           uid.UniqueID(),
 		idGenerator:  uid,
 		stype:        stype,
 	}
 	b := &connectionedEndpoint{
-		baseEndpoint: baseEndpoint{Queue: &waiter.Queue{}},
+		baseEndpoint: baseEndpoint{Queue: &waiter.Queue{}, cred: cred, peerCred: cred},
 		id:           uid.UniqueID(),
 		idGenerator:  uid,
 		stype:        stype,
@@ -250,11 +255,15 @@ func (e *connectionedEndpoint) BidirectionalConnect(ce ConnectingEndpoint, retur
 		return tcpip.ErrConnectionRefused
 	}
 
-	// Create a newly bound connectionedEndpoint.
+	// Create a newly bound connectionedEndpoint. Like in Linux, the new
+	// endpoint has the credentials of the listening endpoint, and each
+	// end reports the credentials of the other at the time of connection.
 	ne := &connectionedEndpoint{
 		baseEndpoint: baseEndpoint{
-			path:  e.path,
-			Queue: &waiter.Queue{},
+			path:     e.path,
+			Queue:    &waiter.Queue{},
+			cred:     e.cred,
+			peerCred: ce.Credentials(),
 		},
 		id:          e.idGenerator.UniqueID(),
 		idGenerator: e.idGenerator,
@@ -275,6 +284,9 @@ func (e *connectionedEndpoint) BidirectionalConnect(ce ConnectingEndpoint, retur
 	select {
 	case e.acceptedChan <- ne:
 		// Commit state.
+		if ce, ok := ce.(*connectionedEndpoint); ok {
+			ce.peerCred = e.cred
+		}
 		connected := &connectedEndpoint{
 			endpoint:   ne,
 			writeQueue: writeQueue,
@@ -303,6 +315,47 @@ func (e *connectionedEndpoint) BidirectionalConnect(ce ConnectingEndpoint, retur
 	}
 }
 
+// AcceptExternal implements ExternalAcceptor.AcceptExternal.
+func (e *connectionedEndpoint) AcceptExternal(stype SockType, connect func(*waiter.Queue) (Receiver, ConnectedEndpoint, *tcpip.Error)) *tcpip.Error {
+	e.Lock()
+	if !e.Listening() || e.stype != stype {
+		e.Unlock()
+		return tcpip.ErrConnectionRefused
+	}
+
+	// The new endpoint has no peer credentials, since the peer isn't a
+	// task.
+	ne := &connectionedEndpoint{
+		baseEndpoint: baseEndpoint{
+			path:  e.path,
+			Queue: &waiter.Queue{},
+			cred:  e.cred,
+		},
+		id:          e.idGenerator.UniqueID(),
+		idGenerator: e.idGenerator,
+		stype:       e.stype,
+	}
+	r, ce, err := connect(ne.Queue)
+	if err != nil {
+		e.Unlock()
+		return err
+	}
+	ne.receiver = r
+	ne.connected = ce
+
+	select {
+	case e.acceptedChan <- ne:
+		e.Unlock()
+		e.Notify(waiter.EventIn)
+		return nil
+	default:
+		// Busy; refuse the connection like BidirectionalConnect.
+		e.Unlock()
+		ne.Close()
+		return tcpip.ErrConnectionRefused
+	}
+}
+
 // UnidirectionalConnect implements BoundEndpoint.UnidirectionalConnect.
 func (e *connectionedEndpoint) UnidirectionalConnect() (ConnectedEndpoint, *tcpip.Error) {
 	return nil, tcpip.ErrConnectionRefused
@@ -346,6 +399,16 @@ func (e *connectionedEndpoint) Listen(backlog int) *tcpip.Error {
 	return nil
 }
 
+// PeerCredentials implements PeerCredentialer.PeerCredentials.
+func (e *connectionedEndpoint) PeerCredentials() CredentialsControlMessage {
+	e.Lock()
+	defer e.Unlock()
+	if e.Listening() {
+		return e.cred
+	}
+	return e.peerCred
+}
+
 // Accept accepts a new connection.
 func (e *connectionedEndpoint) Accept() (Endpoint, *tcpip.Error) {
 	e.Lock()
@@ -190,6 +190,41 @@ type Credentialer interface {
 	ConnectedPasscred() bool
 }
 
+// A SecurityPasser is a socket or endpoint that supports the SO_PASSSEC socket
+// option.
+type SecurityPasser interface {
+	// Passsec returns whether or not the SO_PASSSEC socket option is
+	// enabled on this end.
+	Passsec() bool
+}
+
+// A PeerCredentialer is an endpoint that records the credentials of its peer,
+// as reported by the SO_PEERCRED socket option.
+type PeerCredentialer interface {
+	// SetCredentials sets the credentials that the endpoint reports to the
+	// endpoints it connects to, or that connect to it while it listens.
+	SetCredentials(CredentialsControlMessage)
+
+	// PeerCredentials returns the credentials of the peer when the
+	// connection was established, or the endpoint's own credentials if it
+	// is listening. It returns nil if they are not known.
+	PeerCredentials() CredentialsControlMessage
+}
+
+// An ExternalAcceptor is a BoundEndpoint that can accept connections from
+// peers outside of the sentry.
+type ExternalAcceptor interface {
+	// AcceptExternal queues a new connection to be returned by Accept.
+	// connect is called with the waiter queue of the new endpoint, and
+	// returns the Receiver and ConnectedEndpoint that it uses to
+	// communicate with the peer. If connect succeeds, the new endpoint
+	// takes ownership of them.
+	//
+	// This method will return tcpip.ErrConnectionRefused if the endpoint
+	// isn't listening, isn't of type stype or its backlog is full.
+	AcceptExternal(stype SockType, connect func(*waiter.Queue) (Receiver, ConnectedEndpoint, *tcpip.Error)) *tcpip.Error
+}
+
 // A BoundEndpoint is a unix endpoint that can be connected to.
 type BoundEndpoint interface {
 	// BidirectionalConnect establishes a bi-directional connection between two
@@ -660,6 +695,10 @@ type baseEndpoint struct {
 	// enabled on this endpoint. Must be accessed atomically.
 	passcred int32
 
+	// passsec specifies whether SCM_SECURITY socket control messages are
+	// enabled on this endpoint. Must be accessed atomically.
+	passsec int32
+
 	// Mutex protects the below fields.
 	sync.Mutex `state:"nosave"`
 
@@ -673,6 +712,13 @@ type baseEndpoint struct {
 	// path is not empty if the endpoint has been bound,
 	// or may be used if the endpoint is connected.
 	path string
+
+	// cred is the credentials set by SetCredentials.
+	cred CredentialsControlMessage
+
+	// peerCred is the credentials of the connected endpoint when the
+	// connection was established.
+	peerCred CredentialsControlMessage
 }
 
 // EventRegister implements waiter.Waitable.EventRegister.
@@ -715,6 +761,38 @@ func (e *baseEndpoint) setPasscred(pc bool) {
 	}
 }
 
+// Passsec implements SecurityPasser.Passsec.
+func (e *baseEndpoint) Passsec() bool {
+	return atomic.LoadInt32(&e.passsec) != 0
+}
+
+func (e *baseEndpoint) setPasssec(ps bool) {
+	if ps {
+		atomic.StoreInt32(&e.passsec, 1)
+	} else {
+		atomic.StoreInt32(&e.passsec, 0)
+	}
+}
+
+// SetCredentials implements PeerCredentialer.SetCredentials.
+func (e *baseEndpoint) SetCredentials(c CredentialsControlMessage) {
+	e.Lock()
+	e.cred = c
+	e.Unlock()
+}
+
+// Credentials implements ConnectingEndpoint.Credentials.
+func (e *baseEndpoint) Credentials() CredentialsControlMessage {
+	return e.cred
+}
+
+// PeerCredentials implements PeerCredentialer.PeerCredentials.
+func (e *baseEndpoint) PeerCredentials() CredentialsControlMessage {
+	e.Lock()
+	defer e.Unlock()
+	return e.peerCred
+}
+
 // Connected implements ConnectingEndpoint.Connected.
 func (e *baseEndpoint) Connected() bool {
 	return e.receiver != nil && e.connected != nil
@@ -777,6 +855,9 @@ func (e *baseEndpoint) SetSockOpt(opt interface{}) *tcpip.Error {
 	case tcpip.PasscredOption:
 		e.setPasscred(v != 0)
 		return nil
+	case tcpip.PasssecOption:
+		e.setPasssec(v != 0)
+		return nil
 	}
 	return nil
 }
@@ -819,6 +900,13 @@ func (e *baseEndpoint) GetSockOpt(opt interface{}) *tcpip.Error {
 			*o = tcpip.PasscredOption(0)
 		}
 		return nil
+	case *tcpip.PasssecOption:
+		if e.Passsec() {
+			*o = tcpip.PasssecOption(1)
+		} else {
+			*o = tcpip.PasssecOption(0)
+		}
+		return nil
 	case *tcpip.SendBufferSizeOption:
 		e.Lock()
 		if !e.Connected() {
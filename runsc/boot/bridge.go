@@ -0,0 +1,254 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+	"syscall"
+
+	"gvisor.googlesource.com/gvisor/pkg/fd"
+	"gvisor.googlesource.com/gvisor/pkg/log"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/host"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/transport/unix"
+	"gvisor.googlesource.com/gvisor/pkg/unet"
+	"gvisor.googlesource.com/gvisor/pkg/waiter"
+)
+
+// abstractImports connects sandbox sockets to the host abstract sockets that
+// are imported with Config.AbstractBridges, through the gofer. See
+// fsgofer.AbstractBridge for the protocol.
+type abstractImports struct {
+	// imports maps the name of each imported socket to its connection to
+	// the gofer.
+	imports map[string]*abstractImport
+}
+
+// BoundEndpoint implements kernel.AbstractSocketBridge.BoundEndpoint.
+func (a *abstractImports) BoundEndpoint(name string) unix.BoundEndpoint {
+	imp, ok := a.imports[name]
+	if !ok {
+		return nil
+	}
+	return &abstractImportEndpoint{imp}
+}
+
+// abstractImport is the connection to the gofer for an imported socket.
+type abstractImport struct {
+	name string
+
+	// mu serializes requests to the gofer.
+	mu   sync.Mutex
+	sock *unet.Socket
+}
+
+// connect returns a host socket of type stype connected to the imported
+// socket.
+func (i *abstractImport) connect(stype unix.SockType) (*fd.FD, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	var req [4]byte
+	binary.LittleEndian.PutUint32(req[:], uint32(stype))
+	w := i.sock.Writer(true)
+	if _, err := w.WriteVec([][]byte{req[:]}); err != nil {
+		return nil, err
+	}
+
+	var resp [4]byte
+	r := i.sock.Reader(true)
+	r.EnableFDs(1)
+	n, err := r.ReadVec([][]byte{resp[:]})
+	if err != nil {
+		r.CloseFDs()
+		return nil, err
+	}
+	fds, err := r.ExtractFDs()
+	if err != nil {
+		return nil, err
+	}
+	if errno := syscall.Errno(binary.LittleEndian.Uint32(resp[:])); n != len(resp) || errno != 0 || len(fds) != 1 {
+		for _, f := range fds {
+			syscall.Close(f)
+		}
+		if errno == 0 {
+			return nil, fmt.Errorf("invalid response from gofer")
+		}
+		return nil, errno
+	}
+	return fd.New(fds[0]), nil
+}
+
+// abstractImportEndpoint is a unix.BoundEndpoint for an imported socket. Like
+// gofer-backed endpoints, each connection is a host socket.
+type abstractImportEndpoint struct {
+	imp *abstractImport
+}
+
+// BidirectionalConnect implements unix.BoundEndpoint.BidirectionalConnect.
+func (e *abstractImportEndpoint) BidirectionalConnect(ce unix.ConnectingEndpoint, returnConnect func(unix.Receiver, unix.ConnectedEndpoint)) *tcpip.Error {
+	stype := ce.Type()
+	if stype != unix.SockStream && stype != unix.SockSeqpacket {
+		return tcpip.ErrConnectionRefused
+	}
+
+	// No lock ordering required as only the ConnectingEndpoint has a mutex.
+	ce.Lock()
+
+	// Check connecting state.
+	if ce.Connected() {
+		ce.Unlock()
+		return tcpip.ErrAlreadyConnected
+	}
+	if ce.Listening() {
+		ce.Unlock()
+		return tcpip.ErrInvalidEndpointState
+	}
+
+	hostFile, err := e.imp.connect(stype)
+	if err != nil {
+		ce.Unlock()
+		log.Infof("Connection to imported abstract socket %q failed: %v", e.imp.name, err)
+		return tcpip.ErrConnectionRefused
+	}
+
+	c, terr := host.NewConnectedEndpoint(hostFile, ce.WaiterQueue(), "\x00"+e.imp.name)
+	if terr != nil {
+		ce.Unlock()
+		hostFile.Close()
+		return terr
+	}
+
+	returnConnect(c, c)
+	ce.Unlock()
+	c.Init()
+
+	return nil
+}
+
+// UnidirectionalConnect implements unix.BoundEndpoint.UnidirectionalConnect.
+func (e *abstractImportEndpoint) UnidirectionalConnect() (unix.ConnectedEndpoint, *tcpip.Error) {
+	hostFile, err := e.imp.connect(unix.SockDgram)
+	if err != nil {
+		log.Infof("Connection to imported abstract socket %q failed: %v", e.imp.name, err)
+		return nil, tcpip.ErrConnectionRefused
+	}
+
+	c, terr := host.NewConnectedEndpoint(hostFile, &waiter.Queue{}, "\x00"+e.imp.name)
+	if terr != nil {
+		hostFile.Close()
+		return nil, terr
+	}
+	c.Init()
+
+	// We don't need the receiver.
+	c.CloseRecv()
+	c.Release()
+
+	return c, nil
+}
+
+// Release implements unix.BoundEndpoint.Release.
+func (e *abstractImportEndpoint) Release() {}
+
+// serveAbstractExport passes the host connections that the gofer accepts for
+// the exported socket name to the sandbox socket bound to name in ns, until
+// sock is closed.
+func serveAbstractExport(ns *kernel.AbstractSocketNamespace, name string, sock *unet.Socket) {
+	for {
+		var msg [1]byte
+		r := sock.Reader(true)
+		r.EnableFDs(1)
+		if _, err := r.ReadVec([][]byte{msg[:]}); err != nil {
+			r.CloseFDs()
+			if err != io.EOF {
+				log.Warningf("Error receiving connection to exported abstract socket %q: %v", name, err)
+			}
+			return
+		}
+		fds, err := r.ExtractFDs()
+		if err != nil || len(fds) != 1 {
+			log.Warningf("Invalid connection to exported abstract socket %q: %v, %v", name, fds, err)
+			for _, f := range fds {
+				syscall.Close(f)
+			}
+			continue
+		}
+		if err := acceptAbstractExport(ns, name, fd.New(fds[0])); err != nil {
+			log.Infof("Connection to exported abstract socket %q refused: %v", name, err)
+		}
+	}
+}
+
+// acceptAbstractExport queues the host connection hostFile to be accepted by
+// the sandbox socket bound to name in ns. It takes ownership of hostFile.
+func acceptAbstractExport(ns *kernel.AbstractSocketNamespace, name string, hostFile *fd.FD) error {
+	ep := ns.BoundEndpoint(name)
+	if ep == nil {
+		hostFile.Close()
+		return fmt.Errorf("no socket is bound")
+	}
+	defer ep.Release()
+
+	ea, ok := ep.(unix.ExternalAcceptor)
+	if !ok {
+		hostFile.Close()
+		return fmt.Errorf("socket doesn't accept connections")
+	}
+	owned := false
+	if err := ea.AcceptExternal(unix.SockStream, func(q *waiter.Queue) (unix.Receiver, unix.ConnectedEndpoint, *tcpip.Error) {
+		c, err := host.NewConnectedEndpoint(hostFile, q, "")
+		if err != nil {
+			return nil, nil, err
+		}
+		c.Init()
+		owned = true
+		return c, c, nil
+	}); err != nil {
+		if !owned {
+			hostFile.Close()
+		}
+		return fmt.Errorf("%v", err)
+	}
+	return nil
+}
+
+// startAbstractBridges connects the sockets bridged by bridges to ns, using
+// the sockets connected to the gofer in bridgeFDs, in the same order.
+func startAbstractBridges(ns *kernel.AbstractSocketNamespace, bridges []AbstractBridge, bridgeFDs []int) error {
+	if len(bridges) != len(bridgeFDs) {
+		return fmt.Errorf("got %d bridge FDs for %d abstract socket bridges", len(bridgeFDs), len(bridges))
+	}
+	imports := &abstractImports{imports: make(map[string]*abstractImport)}
+	for i, b := range bridges {
+		sock, err := unet.NewSocket(bridgeFDs[i])
+		if err != nil {
+			return fmt.Errorf("error creating socket for abstract socket bridge %q: %v", b.Name, err)
+		}
+		if b.Export {
+			go serveAbstractExport(ns, b.Name, sock) // S/R-SAFE: not saved.
+			continue
+		}
+		imports.imports[b.Name] = &abstractImport{name: b.Name, sock: sock}
+	}
+	if len(imports.imports) > 0 {
+		ns.SetBridge(imports)
+	}
+	return nil
+}
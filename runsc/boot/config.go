@@ -16,8 +16,13 @@ package boot
 
 import (
 	"fmt"
+	"net"
 	"strconv"
 	"strings"
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/dns"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/watchdog"
 )
 
 // PlatformType tells which platform to use.
@@ -54,6 +59,50 @@ func (p PlatformType) String() string {
 	}
 }
 
+// KVMClock tells how applications read time on the KVM platform.
+type KVMClock int
+
+const (
+	// KVMClockTSC passes the host TSC through to the guest, so that the
+	// VDSO reads time without exiting to the sentry. This is the default.
+	KVMClockTSC KVMClock = iota
+
+	// KVMClockAuto uses KVMClockTSC if the TSC is reliable, and
+	// KVMClockSentry otherwise.
+	KVMClockAuto
+
+	// KVMClockSentry serves all reads of time from the sentry, with the
+	// VDSO falling back to syscalls.
+	KVMClockSentry
+)
+
+// MakeKVMClock converts clock from string.
+func MakeKVMClock(s string) (KVMClock, error) {
+	switch s {
+	case "auto":
+		return KVMClockAuto, nil
+	case "tsc":
+		return KVMClockTSC, nil
+	case "sentry":
+		return KVMClockSentry, nil
+	default:
+		return 0, fmt.Errorf("invalid KVM clock %q", s)
+	}
+}
+
+func (c KVMClock) String() string {
+	switch c {
+	case KVMClockAuto:
+		return "auto"
+	case KVMClockTSC:
+		return "tsc"
+	case KVMClockSentry:
+		return "sentry"
+	default:
+		return fmt.Sprintf("unknown(%d)", c)
+	}
+}
+
 // FileAccessType tells how the filesystem is accessed.
 type FileAccessType int
 
@@ -64,6 +113,12 @@ const (
 
 	// FileAccessDirect connects the sandbox directly to the host filesystem.
 	FileAccessDirect
+
+	// FileAccessDonated has the Gofer open the root of each mount and donate
+	// the FD to the sandbox at startup. The sandbox then accesses files
+	// relative to these FDs, without a round trip to the Gofer for each
+	// operation, and cannot open files by host path.
+	FileAccessDonated
 )
 
 // MakeFileAccessType converts type from string.
@@ -73,6 +128,8 @@ func MakeFileAccessType(s string) (FileAccessType, error) {
 		return FileAccessProxy, nil
 	case "direct":
 		return FileAccessDirect, nil
+	case "donated":
+		return FileAccessDonated, nil
 	default:
 		return 0, fmt.Errorf("invalid file access type %q", s)
 	}
@@ -84,6 +141,8 @@ func (f FileAccessType) String() string {
 		return "proxy"
 	case FileAccessDirect:
 		return "direct"
+	case FileAccessDonated:
+		return "donated"
 	default:
 		return fmt.Sprintf("unknown(%d)", f)
 	}
@@ -101,6 +160,11 @@ const (
 
 	// NetworkNone sets up just loopback using netstack.
 	NetworkNone
+
+	// NetworkNAT uses internal network stack, connected to the host network
+	// through a userspace NAT that runs outside of the sandbox. It doesn't
+	// require any privileges or network configuration on the host.
+	NetworkNAT
 )
 
 // MakeNetworkType converts type from string.
@@ -112,6 +176,8 @@ func MakeNetworkType(s string) (NetworkType, error) {
 		return NetworkHost, nil
 	case "none":
 		return NetworkNone, nil
+	case "nat":
+		return NetworkNAT, nil
 	default:
 		return 0, fmt.Errorf("invalid network type %q", s)
 	}
@@ -125,11 +191,226 @@ func (n NetworkType) String() string {
 		return "host"
 	case NetworkNone:
 		return "none"
+	case NetworkNAT:
+		return "nat"
 	default:
 		return fmt.Sprintf("unknown(%d)", n)
 	}
 }
 
+// WatchdogAction tells what the watchdog does when a task is stuck.
+type WatchdogAction int
+
+const (
+	// WatchdogLog logs a warning with the stacks of the stuck tasks.
+	WatchdogLog WatchdogAction = iota
+
+	// WatchdogPanic logs as WatchdogLog does, and then panics.
+	WatchdogPanic
+)
+
+// MakeWatchdogAction converts action from string.
+func MakeWatchdogAction(s string) (WatchdogAction, error) {
+	switch s {
+	case "log":
+		return WatchdogLog, nil
+	case "panic":
+		return WatchdogPanic, nil
+	default:
+		return 0, fmt.Errorf("invalid watchdog action %q", s)
+	}
+}
+
+func (a WatchdogAction) String() string {
+	switch a {
+	case WatchdogLog:
+		return "log"
+	case WatchdogPanic:
+		return "panic"
+	default:
+		return fmt.Sprintf("unknown(%d)", a)
+	}
+}
+
+// watchdogAction returns the corresponding watchdog.Action.
+func (a WatchdogAction) watchdogAction() watchdog.Action {
+	if a == WatchdogPanic {
+		return watchdog.Panic
+	}
+	return watchdog.LogWarning
+}
+
+// TimeLimitAction tells what happens to a sandbox that exceeds its time
+// limit.
+type TimeLimitAction int
+
+const (
+	// TimeLimitKill kills the sandbox, whose root container exits as if
+	// killed by SIGKILL.
+	TimeLimitKill TimeLimitAction = iota
+
+	// TimeLimitCheckpoint checkpoints the sandbox to Config.TimeLimitImage,
+	// and then exits, so that it can be restored to resume its work.
+	TimeLimitCheckpoint
+)
+
+// MakeTimeLimitAction converts action from string.
+func MakeTimeLimitAction(s string) (TimeLimitAction, error) {
+	switch s {
+	case "kill":
+		return TimeLimitKill, nil
+	case "checkpoint":
+		return TimeLimitCheckpoint, nil
+	default:
+		return 0, fmt.Errorf("invalid time limit action %q", s)
+	}
+}
+
+func (a TimeLimitAction) String() string {
+	switch a {
+	case TimeLimitKill:
+		return "kill"
+	case TimeLimitCheckpoint:
+		return "checkpoint"
+	default:
+		return fmt.Sprintf("unknown(%d)", a)
+	}
+}
+
+// ActivationSocket is a listening socket that is created in the sandbox
+// network stack before the container starts, and passed to it with the
+// systemd socket activation protocol.
+type ActivationSocket struct {
+	// Network is the type of the socket: "tcp", "tcp6", "udp" or "udp6".
+	Network string
+
+	// Port is the port that the socket is bound to, on all addresses.
+	Port uint16
+}
+
+// String returns the socket in the format accepted by
+// ParseActivationSockets.
+func (s ActivationSocket) String() string {
+	return fmt.Sprintf("%s:%d", s.Network, s.Port)
+}
+
+// ParseActivationSockets parses a comma-separated list of sockets in the
+// format <network>:<port>, e.g. "tcp:8080,udp:53".
+func ParseActivationSockets(s string) ([]ActivationSocket, error) {
+	var socks []ActivationSocket
+	for _, str := range strings.Split(s, ",") {
+		parts := strings.SplitN(str, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid socket %q, must be <network>:<port>", str)
+		}
+		switch parts[0] {
+		case "tcp", "tcp6", "udp", "udp6":
+		default:
+			return nil, fmt.Errorf("invalid network %q, must be 'tcp', 'tcp6', 'udp' or 'udp6'", parts[0])
+		}
+		port, err := strconv.ParseUint(parts[1], 10, 16)
+		if err != nil || port == 0 {
+			return nil, fmt.Errorf("invalid port %q", parts[1])
+		}
+		socks = append(socks, ActivationSocket{Network: parts[0], Port: uint16(port)})
+	}
+	return socks, nil
+}
+
+// AbstractBridge makes a host abstract unix socket reachable from the
+// sandbox, or a sandbox abstract unix socket reachable from the host. The
+// connections are established by the gofer, which runs in the host network
+// namespace.
+type AbstractBridge struct {
+	// Export is true if the socket is bound in the sandbox and host
+	// processes connect to it. Otherwise, the socket is bound on the host
+	// and processes in the sandbox connect to it.
+	Export bool
+
+	// Name is the name of the abstract socket, without the leading NUL
+	// byte.
+	Name string
+
+	// UIDs are the host UIDs that may connect to an exported socket. If
+	// empty, host processes of any UID may connect.
+	UIDs []uint32
+}
+
+// String returns the bridge in the format accepted by ParseAbstractBridges.
+func (b AbstractBridge) String() string {
+	if !b.Export {
+		return "import:" + b.Name
+	}
+	s := "export:" + b.Name
+	if len(b.UIDs) > 0 {
+		uids := make([]string, 0, len(b.UIDs))
+		for _, uid := range b.UIDs {
+			uids = append(uids, strconv.FormatUint(uint64(uid), 10))
+		}
+		s += ":" + strings.Join(uids, "+")
+	}
+	return s
+}
+
+// ParseAbstractBridges parses a comma-separated list of bridges in the format
+// import:<name> or export:<name>[:<uid>+<uid>...], e.g.
+// "import:dns-cache,export:app-metrics:0+1000".
+func ParseAbstractBridges(s string) ([]AbstractBridge, error) {
+	var bridges []AbstractBridge
+	names := make(map[string]bool)
+	for _, str := range strings.Split(s, ",") {
+		parts := strings.Split(str, ":")
+		if len(parts) < 2 || parts[1] == "" {
+			return nil, fmt.Errorf("invalid bridge %q, must be import:<name> or export:<name>[:<uids>]", str)
+		}
+		var b AbstractBridge
+		switch parts[0] {
+		case "import":
+			if len(parts) != 2 {
+				return nil, fmt.Errorf("invalid bridge %q, imported sockets can't have UIDs", str)
+			}
+		case "export":
+			if len(parts) > 3 {
+				return nil, fmt.Errorf("invalid bridge %q, must be export:<name>[:<uids>]", str)
+			}
+			b.Export = true
+			if len(parts) == 3 {
+				for _, u := range strings.Split(parts[2], "+") {
+					uid, err := strconv.ParseUint(u, 10, 32)
+					if err != nil {
+						return nil, fmt.Errorf("invalid UID %q in bridge %q", u, str)
+					}
+					b.UIDs = append(b.UIDs, uint32(uid))
+				}
+			}
+		default:
+			return nil, fmt.Errorf("invalid direction %q, must be 'import' or 'export'", parts[0])
+		}
+		b.Name = parts[1]
+		if names[b.Name] {
+			return nil, fmt.Errorf("socket %q is bridged more than once", b.Name)
+		}
+		names[b.Name] = true
+		bridges = append(bridges, b)
+	}
+	return bridges, nil
+}
+
+// ParseDNSUpstreams parses a comma-separated list of DNS upstreams in the
+// format accepted by dns.ParseUpstream, e.g.
+// "tls://192.0.2.1#dns.example,192.0.2.2".
+func ParseDNSUpstreams(s string) ([]dns.Upstream, error) {
+	var upstreams []dns.Upstream
+	for _, str := range strings.Split(s, ",") {
+		u, err := dns.ParseUpstream(str)
+		if err != nil {
+			return nil, err
+		}
+		upstreams = append(upstreams, u)
+	}
+	return upstreams, nil
+}
+
 // Config holds configuration that is not part of the runtime spec.
 type Config struct {
 	// RootDir is the runtime root directory.
@@ -144,6 +425,18 @@ type Config struct {
 	// LogFormat is the log format, "text" or "json".
 	LogFormat string
 
+	// LogMaxSize is the size in bytes beyond which log files are rotated.
+	// 0 disables rotation.
+	LogMaxSize int64
+
+	// LogMaxFiles is the number of rotated log files that are kept.
+	LogMaxFiles int
+
+	// LogRingSize is the number of recent log statements that are kept in
+	// memory, and reported when the sandbox panics and in the resource
+	// report. 0 disables the ring.
+	LogRingSize int
+
 	// DebugLogDir is the directory to log debug information to, if not
 	// empty.
 	DebugLogDir string
@@ -154,15 +447,138 @@ type Config struct {
 	// Overlay is whether to wrap the root filesystem in an overlay.
 	Overlay bool
 
+	// HostNotify indicates that changes made on the host to files served
+	// by the gofer should generate inotify events inside the sandbox.
+	HostNotify bool
+
+	// GoferProfile is the path to a JSON file containing a hardening
+	// profile for the gofer, if not empty. See fsgofer.Profile.
+	GoferProfile string
+
+	// GoferChannels is the number of sockets connecting the sandbox to the
+	// gofer for each mount. Requests to the gofer are spread over them, so
+	// that they don't wait for each other to be sent and received. If
+	// GoferChannels is 0, a single socket is used.
+	GoferChannels int
+
+	// GoferWorkers is the maximum number of requests that the gofer
+	// handles at once for each mount. If GoferWorkers is 0, the number of
+	// requests is unlimited.
+	GoferWorkers int
+
+	// ImagePolicy is the path to a signed JSON file containing the
+	// integrity policy that the root filesystem of each container must
+	// match before the container is created, if not empty. See
+	// imagepolicy.Policy.
+	ImagePolicy string
+
+	// ImagePolicyKey is the path to the PEM-encoded public key that
+	// ImagePolicy is signed with.
+	ImagePolicyKey string
+
+	// MaxTasks is the maximum number of tasks that may exist in the
+	// sandbox at once, across all containers. If MaxTasks is 0, the number
+	// of tasks is unlimited.
+	MaxTasks uint64
+
+	// HostNiceness indicates that the niceness of each task should be
+	// applied to the host thread that runs it. This is only supported by
+	// the ptrace platform. Decreasing niceness below that of the sandbox
+	// requires CAP_SYS_NICE on the host.
+	HostNiceness bool
+
+	// TimeSlice is the time for which a task may run application code
+	// before it is preempted to let other tasks run, when tasks contend for
+	// the sandbox's CPUs. If it is 0, tasks are never preempted by the
+	// sentry.
+	TimeSlice time.Duration
+
+	// CorePattern is the pattern of the names of the core dumps of
+	// sandboxed processes, as in /proc/sys/kernel/core_pattern. If it is
+	// empty, no core dumps are written.
+	CorePattern string
+
+	// IgnoreOCISeccomp indicates whether the seccomp profile in the spec
+	// is ignored instead of being enforced on the container's processes.
+	IgnoreOCISeccomp bool
+
+	// VDSOUpdateInterval is the interval at which the sentry updates the
+	// timekeeping parameters that the vDSO uses to compute the time
+	// without a syscall. If it is 0, time.DefaultUpdateInterval is used.
+	VDSOUpdateInterval time.Duration
+
+	// TAIOffset is the offset of CLOCK_TAI from CLOCK_REALTIME in the
+	// sandbox, in seconds. If it is negative, the offset of the host is
+	// used.
+	TAIOffset int32
+
+	// DeviceProxy is the list of host device files, such as /dev/nvidia0,
+	// that are proxied into the sandbox's /dev. Only the ioctls safelisted
+	// for the device's driver are forwarded to the host, see
+	// devproxy.Driver.
+	DeviceProxy []string
+
 	// Network indicates what type of network to use.
 	Network NetworkType
 
+	// EgressPolicy is the path to a JSON file containing the egress policy
+	// of the sandbox network, if not empty. See egress.Policy.
+	EgressPolicy string
+
+	// SocketPolicy is the path to a JSON file containing the policy that
+	// restricts the addresses that sockets of the host network can be
+	// connected and bound to, if not empty. See hostinet.Policy.
+	SocketPolicy string
+
+	// Metadata is the path to a JSON file containing the responses of a
+	// metadata service in the sandbox network, if not empty. See
+	// metadata.Config.
+	Metadata string
+
+	// TCPRedirectPort is the port on the loopback address that outbound TCP
+	// connections are redirected to, if not 0. An interception proxy
+	// listening on it can retrieve the original destination of each
+	// connection with SO_ORIGINAL_DST.
+	TCPRedirectPort uint16
+
+	// TCPRedirectPorts are the destination ports of the connections that
+	// are redirected. If empty, connections to all ports are redirected.
+	TCPRedirectPorts []uint16
+
+	// TCPRedirectExemptUIDs are the UIDs whose TCP connections are never
+	// redirected, such as the UID of the interception proxy.
+	TCPRedirectExemptUIDs []uint32
+
+	// DNSResolver is the address in the sandbox network at which a caching
+	// DNS resolver answers queries over UDP and TCP, if not nil.
+	DNSResolver net.IP
+
+	// DNSUpstreams are the servers that the DNS resolver forwards queries
+	// to, in order of preference.
+	DNSUpstreams []dns.Upstream
+
+	// DNSSearch are the search domains of the DNS resolver, which are
+	// tried for single-label names, as in resolv.conf(5).
+	DNSSearch []string
+
+	// ActivationSockets are the listening sockets that are passed to the
+	// container with the systemd socket activation protocol, as FDs
+	// starting at 3.
+	ActivationSockets []ActivationSocket
+
+	// AbstractBridges are the abstract unix sockets that are bridged
+	// between the sandbox and the host. They require a gofer.
+	AbstractBridges []AbstractBridge
+
 	// LogPackets indicates that all network packets should be logged.
 	LogPackets bool
 
 	// Platform is the platform to run on.
 	Platform PlatformType
 
+	// KVMClock is how applications read time with PlatformKVM.
+	KVMClock KVMClock
+
 	// Strace indicates that strace should be enabled.
 	Strace bool
 
@@ -173,26 +589,189 @@ type Config struct {
 	// StraceLogSize is the max size of data blobs to display.
 	StraceLogSize uint
 
+	// StraceRingSize is the number of recent syscalls that each task
+	// records, to be logged when the task encounters an anomaly. If
+	// StraceSyscalls is not empty, only those syscalls are recorded. If
+	// StraceRingSize is 0, syscalls are not recorded.
+	StraceRingSize uint
+
+	// SyscallLatency indicates that the latency of each syscall should be
+	// recorded in the /syscalls/latency metric.
+	SyscallLatency bool
+
+	// SlowSyscallThreshold is the latency at or above which syscalls are
+	// logged when SyscallLatency is true. If it is 0, no syscalls are
+	// logged.
+	SlowSyscallThreshold time.Duration
+
+	// ProfileBlock and ProfileMutex indicate that blocking events and mutex
+	// contention should be recorded at all times, so that the profiles
+	// collected by "runsc profile" include events from before they were
+	// requested.
+	ProfileBlock bool
+	ProfileMutex bool
+
+	// WatchdogTimeout is the time after which a task that is stuck in a
+	// syscall, or is not scheduled, is reported by the watchdog. If it is
+	// 0, the watchdog is disabled.
+	WatchdogTimeout time.Duration
+
+	// WatchdogAction is what the watchdog does when a task is stuck.
+	WatchdogAction WatchdogAction
+
+	// FlightRecorderPeriod is the time between the samples of goroutine
+	// stacks and task states taken by the flight recorder. If it is 0, the
+	// flight recorder is disabled.
+	FlightRecorderPeriod time.Duration
+
+	// FlightRecorderSamples is the number of recent samples that the flight
+	// recorder keeps.
+	FlightRecorderSamples uint
+
+	// ProcessLogSize is the number of recent process fork, exec and exit
+	// events that the sentry keeps. If it is 0, process events are not
+	// recorded.
+	ProcessLogSize uint
+
+	// ResourceReport is the path of the file where a JSON report of the
+	// resource usage of the sandbox is written when it exits. If it is
+	// empty, no report is written.
+	ResourceReport string
+
+	// TimeLimit is the wall time, from the start of the root container,
+	// after which TimeLimitAction is taken. If it is 0, wall time is not
+	// limited.
+	TimeLimit time.Duration
+
+	// CPUTimeLimit is the CPU time used by all tasks of the sandbox, in
+	// application and sentry code, after which TimeLimitAction is taken.
+	// If it is 0, CPU time is not limited.
+	CPUTimeLimit time.Duration
+
+	// TimeLimitAction is what happens when TimeLimit or CPUTimeLimit is
+	// exceeded.
+	TimeLimitAction TimeLimitAction
+
+	// TimeLimitImage is the path of the file where the sandbox is
+	// checkpointed with TimeLimitCheckpoint.
+	TimeLimitImage string
+
+	// TimeLimitReport is the path of the file where a JSON report is
+	// written if TimeLimit or CPUTimeLimit is exceeded. If it is empty, no
+	// report is written.
+	TimeLimitReport string
+
+	// RestoreFile is the path of a checkpoint image from which the sandbox
+	// is restored, instead of starting the container's process. It is set
+	// by "runsc restore" rather than by a flag.
+	RestoreFile string
+
+	// RestoreRebind maps the destinations of gofer mounts in the checkpoint
+	// image to the destinations of the bind mounts in the spec that they
+	// are restored from. Mounts without an entry are restored from the
+	// mount with the same destination. It is set by "runsc restore"
+	// rather than by a flag.
+	RestoreRebind map[string]string
+
 	// DisableSeccomp indicates whether seccomp syscall filters should be
 	// disabled. Pardon the double negation, but default to enabled is important.
 	DisableSeccomp bool
 }
 
+// MountFDs returns the number of sockets connecting the sandbox to the gofer
+// for each mount. With FileAccessDonated, a single socket carries the donated
+// FD.
+func (c *Config) MountFDs() int {
+	if c.FileAccess == FileAccessDonated || c.GoferChannels < 1 {
+		return 1
+	}
+	return c.GoferChannels
+}
+
 // ToFlags returns a slice of flags that correspond to the given Config.
 func (c *Config) ToFlags() []string {
+	redirectPorts := make([]string, 0, len(c.TCPRedirectPorts))
+	for _, p := range c.TCPRedirectPorts {
+		redirectPorts = append(redirectPorts, strconv.FormatUint(uint64(p), 10))
+	}
+	redirectExemptUIDs := make([]string, 0, len(c.TCPRedirectExemptUIDs))
+	for _, uid := range c.TCPRedirectExemptUIDs {
+		redirectExemptUIDs = append(redirectExemptUIDs, strconv.FormatUint(uint64(uid), 10))
+	}
+	activationSockets := make([]string, 0, len(c.ActivationSockets))
+	for _, s := range c.ActivationSockets {
+		activationSockets = append(activationSockets, s.String())
+	}
+	var dnsResolver string
+	if c.DNSResolver != nil {
+		dnsResolver = c.DNSResolver.String()
+	}
+	dnsUpstreams := make([]string, 0, len(c.DNSUpstreams))
+	for _, u := range c.DNSUpstreams {
+		dnsUpstreams = append(dnsUpstreams, u.String())
+	}
+	abstractBridges := make([]string, 0, len(c.AbstractBridges))
+	for _, b := range c.AbstractBridges {
+		abstractBridges = append(abstractBridges, b.String())
+	}
 	return []string{
 		"--root=" + c.RootDir,
 		"--debug=" + strconv.FormatBool(c.Debug),
 		"--log=" + c.LogFilename,
 		"--log-format=" + c.LogFormat,
+		"--log-max-size=" + strconv.FormatInt(c.LogMaxSize, 10),
+		"--log-max-files=" + strconv.Itoa(c.LogMaxFiles),
+		"--log-ring-size=" + strconv.Itoa(c.LogRingSize),
 		"--debug-log-dir=" + c.DebugLogDir,
 		"--file-access=" + c.FileAccess.String(),
 		"--overlay=" + strconv.FormatBool(c.Overlay),
+		"--host-notify=" + strconv.FormatBool(c.HostNotify),
+		"--gofer-profile=" + c.GoferProfile,
+		"--gofer-channels=" + strconv.Itoa(c.GoferChannels),
+		"--gofer-workers=" + strconv.Itoa(c.GoferWorkers),
+		"--image-policy=" + c.ImagePolicy,
+		"--image-policy-key=" + c.ImagePolicyKey,
+		"--max-tasks=" + strconv.FormatUint(c.MaxTasks, 10),
+		"--host-niceness=" + strconv.FormatBool(c.HostNiceness),
+		"--time-slice=" + c.TimeSlice.String(),
+		"--core-pattern=" + c.CorePattern,
+		"--oci-seccomp=" + strconv.FormatBool(!c.IgnoreOCISeccomp),
+		"--vdso-update-interval=" + c.VDSOUpdateInterval.String(),
+		"--tai-offset=" + strconv.Itoa(int(c.TAIOffset)),
+		"--device-proxy=" + strings.Join(c.DeviceProxy, ","),
 		"--network=" + c.Network.String(),
+		"--egress-policy=" + c.EgressPolicy,
+		"--socket-policy=" + c.SocketPolicy,
+		"--metadata=" + c.Metadata,
+		"--tcp-redirect=" + strconv.FormatUint(uint64(c.TCPRedirectPort), 10),
+		"--tcp-redirect-ports=" + strings.Join(redirectPorts, ","),
+		"--tcp-redirect-exempt-uids=" + strings.Join(redirectExemptUIDs, ","),
+		"--dns-resolver=" + dnsResolver,
+		"--dns-upstream=" + strings.Join(dnsUpstreams, ","),
+		"--dns-search=" + strings.Join(c.DNSSearch, ","),
+		"--socket-activation=" + strings.Join(activationSockets, ","),
+		"--abstract-bridge=" + strings.Join(abstractBridges, ","),
 		"--log-packets=" + strconv.FormatBool(c.LogPackets),
 		"--platform=" + c.Platform.String(),
+		"--kvm-clock=" + c.KVMClock.String(),
 		"--strace=" + strconv.FormatBool(c.Strace),
 		"--strace-syscalls=" + strings.Join(c.StraceSyscalls, ","),
 		"--strace-log-size=" + strconv.Itoa(int(c.StraceLogSize)),
+		"--strace-ring-size=" + strconv.Itoa(int(c.StraceRingSize)),
+		"--syscall-latency=" + strconv.FormatBool(c.SyscallLatency),
+		"--slow-syscall-threshold=" + c.SlowSyscallThreshold.String(),
+		"--profile-block=" + strconv.FormatBool(c.ProfileBlock),
+		"--profile-mutex=" + strconv.FormatBool(c.ProfileMutex),
+		"--watchdog-timeout=" + c.WatchdogTimeout.String(),
+		"--watchdog-action=" + c.WatchdogAction.String(),
+		"--flight-recorder-period=" + c.FlightRecorderPeriod.String(),
+		"--flight-recorder-samples=" + strconv.Itoa(int(c.FlightRecorderSamples)),
+		"--process-log-size=" + strconv.Itoa(int(c.ProcessLogSize)),
+		"--resource-report=" + c.ResourceReport,
+		"--time-limit=" + c.TimeLimit.String(),
+		"--cpu-time-limit=" + c.CPUTimeLimit.String(),
+		"--time-limit-action=" + c.TimeLimitAction.String(),
+		"--time-limit-image=" + c.TimeLimitImage,
+		"--time-limit-report=" + c.TimeLimitReport,
 	}
 }
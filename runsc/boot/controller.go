@@ -16,45 +16,128 @@ package boot
 
 import (
 	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
 
+	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"gvisor.googlesource.com/gvisor/pkg/control/server"
+	"gvisor.googlesource.com/gvisor/pkg/log"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/arch"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/control"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/flightrecorder"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/socket/epsocket"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/socket/hostinet"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/strace"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/watchdog"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/adapters/gonet"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/stack"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/transport/tcp"
+	"gvisor.googlesource.com/gvisor/pkg/urpc"
+	"gvisor.googlesource.com/gvisor/pkg/waiter"
 )
 
 const (
 	// ContainerCheckpoint checkpoints a container.
 	ContainerCheckpoint = "containerManager.Checkpoint"
 
+	// ContainerDrain is the URPC endpoint for draining the sandbox's
+	// network connections, used by "runsc drain".
+	ContainerDrain = "containerManager.Drain"
+
 	// ContainerEvent is the URPC endpoint for getting stats about the
 	// container used by "runsc events".
 	ContainerEvent = "containerManager.Event"
 
+	// ContainerFlightRecord is the URPC endpoint for dumping the samples of
+	// the flight recorder, used by "runsc debug --flight-record".
+	ContainerFlightRecord = "containerManager.FlightRecord"
+
+	// ContainerMaintain is the URPC endpoint for running maintenance tasks
+	// in the sandbox, used by "runsc debug".
+	ContainerMaintain = "containerManager.Maintain"
+
 	// ContainerExecute is the URPC endpoint for executing a command in a
 	// container..
 	ContainerExecute = "containerManager.Execute"
 
+	// ContainerPause pauses the container, used by "runsc pause".
+	ContainerPause = "containerManager.Pause"
+
+	// ContainerPortForward is the URPC endpoint for connecting a host
+	// socket to a port in the sandbox network stack, used by "runsc
+	// port-forward".
+	ContainerPortForward = "containerManager.PortForward"
+
 	// ContainerProcesses is the URPC endpoint for getting the list of
 	// processes running in a container.
 	ContainerProcesses = "containerManager.Processes"
 
+	// ContainerProcessEvents is the URPC endpoint for getting the process
+	// fork, exec and exit events recorded in the sandbox, used by "runsc
+	// debug --process-log".
+	ContainerProcessEvents = "containerManager.ProcessEvents"
+
+	// ContainerUpdate is the URPC endpoint for changing the resource
+	// limits of a running container, used by "runsc update".
+	ContainerUpdate = "containerManager.Update"
+
+	// ContainerResume resumes a paused container, used by "runsc resume".
+	ContainerResume = "containerManager.Resume"
+
 	// ContainerSignal is used to send a signal to a container.
 	ContainerSignal = "containerManager.Signal"
 
+	// ContainerSetFlags is the URPC endpoint for changing flags of a
+	// running sandbox, used by "runsc flags set".
+	ContainerSetFlags = "containerManager.SetFlags"
+
+	// ContainerStrace is the URPC endpoint for changing which syscalls are
+	// traced to the log, used by "runsc strace".
+	ContainerStrace = "containerManager.Strace"
+
 	// ContainerWait is used to wait on the init process of the container
 	// and return its ExitStatus.
 	ContainerWait = "containerManager.Wait"
 
+	// HostNetworkSetPolicy is the URPC endpoint for restricting the
+	// addresses that sockets of the host network can be connected and
+	// bound to.
+	HostNetworkSetPolicy = "HostNetwork.SetPolicy"
+
+	// MetricsSnapshot is the URPC endpoint for getting the values of the
+	// sentry's metrics, used by "runsc metric-server".
+	MetricsSnapshot = "Metrics.Snapshot"
+
 	// NetworkCreateLinksAndRoutes is the URPC endpoint for creating links
 	// and routes in a network stack.
 	NetworkCreateLinksAndRoutes = "Network.CreateLinksAndRoutes"
 
+	// NetworkStartMetadataServer is the URPC endpoint for starting the
+	// metadata service of a network stack.
+	NetworkStartMetadataServer = "Network.StartMetadataServer"
+
 	// RootContainerStart is the URPC endpoint for starting a new sandbox
 	// with root container.
 	RootContainerStart = "containerManager.StartRoot"
+
+	// ProfileCPU, ProfileHeap, ProfileBlock and ProfileMutex are the URPC
+	// endpoints for collecting pprof profiles of the sentry, used by
+	// "runsc profile".
+	ProfileCPU   = "Profile.CPU"
+	ProfileHeap  = "Profile.Heap"
+	ProfileBlock = "Profile.Block"
+	ProfileMutex = "Profile.Mutex"
+
+	// ProfileTrace is the URPC endpoint for collecting a runtime execution
+	// trace of the sentry, used by "runsc trace".
+	ProfileTrace = "Profile.Trace"
 )
 
 // ControlSocketAddr generates an abstract unix socket name for the given id.
@@ -73,26 +156,49 @@ type controller struct {
 }
 
 // newController creates a new controller and starts it listening.
-func newController(fd int, k *kernel.Kernel, w *watchdog.Watchdog) (*controller, error) {
+func newController(fd int, id string, k *kernel.Kernel, w *watchdog.Watchdog, conf *Config) (*controller, error) {
 	srv, err := server.CreateFromFD(fd)
 	if err != nil {
 		return nil, err
 	}
 
+	profile := &control.Profile{}
+	if conf.ProfileBlock {
+		profile.EnableBlockProfiling(true)
+	}
+	if conf.ProfileMutex {
+		profile.EnableMutexProfiling(true)
+	}
+
+	recorder := flightrecorder.New(k, int(conf.FlightRecorderSamples))
+	if conf.FlightRecorderPeriod > 0 {
+		recorder.SetPeriod(conf.FlightRecorderPeriod)
+	}
+
 	manager := &containerManager{
 		startChan:       make(chan struct{}),
 		startResultChan: make(chan error),
 		k:               k,
 		watchdog:        w,
+		profile:         profile,
+		recorder:        recorder,
+		conf:            *conf,
+		rootID:          id,
 	}
 	srv.Register(manager)
+	srv.Register(profile)
+	srv.Register(&control.Metrics{})
 
 	if eps, ok := k.NetworkStack().(*epsocket.Stack); ok {
 		net := &Network{
-			Stack: eps.Stack,
+			Stack:  eps.Stack,
+			Qdiscs: eps.Qdiscs,
 		}
 		srv.Register(net)
 	}
+	if hs, ok := k.NetworkStack().(*hostinet.Stack); ok {
+		srv.Register(&HostNetwork{Stack: hs})
+	}
 
 	if err := srv.StartServing(); err != nil {
 		return nil, err
@@ -121,6 +227,40 @@ type containerManager struct {
 
 	// watchdog is the kernel watchdog.
 	watchdog *watchdog.Watchdog
+
+	// profile collects profiles of the sentry.
+	profile *control.Profile
+
+	// recorder is the flight recorder of the sentry.
+	recorder *flightrecorder.Recorder
+
+	// confMu protects conf.
+	confMu sync.Mutex
+
+	// conf is the configuration of the sandbox, including the changes made
+	// by SetFlags.
+	conf Config
+
+	// rootID is the ID of the root container. The sandbox runs no other
+	// containers.
+	rootID string
+
+	// pausedMu protects paused.
+	pausedMu sync.Mutex
+
+	// paused is true if the tasks of the root container are frozen by
+	// Pause.
+	paused bool
+}
+
+// checkContainer returns an error if cid isn't the ID of a container in the
+// sandbox. Only the root container can run in a sandbox, so its tasks are all
+// the tasks in the kernel.
+func (cm *containerManager) checkContainer(cid string) error {
+	if cid != cm.rootID {
+		return fmt.Errorf("container %q not found: sandbox only runs container %q", cid, cm.rootID)
+	}
+	return nil
 }
 
 // StartRoot will start the root container process.
@@ -135,6 +275,17 @@ func (cm *containerManager) Processes(_, out *[]*control.Process) error {
 	return control.Processes(cm.k, out)
 }
 
+// ProcessEvents retrieves the process events recorded in the sandbox, oldest
+// first.
+func (cm *containerManager) ProcessEvents(_, out *[]kernel.ProcessEvent) error {
+	pl := cm.k.ProcessLog()
+	if pl == nil {
+		return fmt.Errorf("process events are not recorded, see --process-log-size")
+	}
+	*out = pl.Events()
+	return nil
+}
+
 // Execute runs a command on a created or running sandbox.
 func (cm *containerManager) Execute(e *control.ExecArgs, waitStatus *uint32) error {
 	proc := control.Proc{Kernel: cm.k}
@@ -144,19 +295,150 @@ func (cm *containerManager) Execute(e *control.ExecArgs, waitStatus *uint32) err
 	return nil
 }
 
-// Checkpoint pauses a sandbox and saves its state.
-func (cm *containerManager) Checkpoint(o *control.SaveOpts, _ *struct{}) error {
+// Checkpoint pauses a sandbox and saves its state, and returns the inventory
+// of the saved processes.
+func (cm *containerManager) Checkpoint(o *control.SaveOpts, inv *control.Inventory) error {
 	state := control.State{
 		Kernel:   cm.k,
 		Watchdog: cm.watchdog,
 	}
-	return state.Save(o, nil)
+	return state.Save(o, inv)
+}
+
+// Maintain runs maintenance tasks in the sandbox.
+func (cm *containerManager) Maintain(o *control.MaintenanceOpts, out *control.MaintenanceResult) error {
+	m := control.Maintenance{Kernel: cm.k}
+	if err := m.Run(o, out); err != nil {
+		return err
+	}
+	if eps, ok := cm.k.NetworkStack().(*epsocket.Stack); ok && o.NetworkDiagnostics {
+		out.Network += fmt.Sprintf("Netstack stats: %+v\n", eps.Stack.Stats())
+	}
+	return nil
+}
+
+// FlightRecordArgs are arguments to the FlightRecord method.
+type FlightRecordArgs struct {
+	// FilePayload contains the destination for the samples.
+	urpc.FilePayload
+}
+
+// FlightRecord writes the samples of the flight recorder to the file in the
+// payload.
+func (cm *containerManager) FlightRecord(args *FlightRecordArgs, _ *struct{}) error {
+	if len(args.FilePayload.Files) != 1 {
+		return control.ErrInvalidFiles
+	}
+	f := args.FilePayload.Files[0]
+	defer f.Close()
+	return cm.recorder.Dump(f)
+}
+
+// PortForwardArgs are arguments to the PortForward method.
+type PortForwardArgs struct {
+	// CID is the container id.
+	CID string
+
+	// Port is the TCP port in the sandbox to connect to.
+	Port uint16
+
+	// FilePayload contains the host stream socket whose data is forwarded
+	// to and from the connection.
+	urpc.FilePayload
+}
+
+// PortForward connects to the given port on the sandbox's loopback address
+// and copies data between the connection and the host socket in the payload
+// until both are shut down. It returns once the connection is established.
+func (cm *containerManager) PortForward(args *PortForwardArgs, _ *struct{}) error {
+	if len(args.FilePayload.Files) != 1 {
+		return control.ErrInvalidFiles
+	}
+	hf := args.FilePayload.Files[0]
+
+	eps, ok := cm.k.NetworkStack().(*epsocket.Stack)
+	if !ok {
+		hf.Close()
+		return fmt.Errorf("cannot forward port: sandbox does not use netstack")
+	}
+	var wq waiter.Queue
+	ep, err := dialLoopback(eps.Stack, &wq, args.Port)
+	if err != nil {
+		hf.Close()
+		return fmt.Errorf("cannot forward port %d: %v", args.Port, err)
+	}
+	go forwardStream(hf, ep, gonet.NewConn(&wq, ep)) // S/R-SAFE: not saved.
+	return nil
+}
+
+// dialLoopback connects a new TCP endpoint to the given port on the IPv4
+// loopback address of stack s.
+func dialLoopback(s *stack.Stack, wq *waiter.Queue, port uint16) (tcpip.Endpoint, *tcpip.Error) {
+	ep, err := s.NewEndpoint(tcp.ProtocolNumber, ipv4.ProtocolNumber, wq)
+	if err != nil {
+		return nil, err
+	}
+	if err := connectEndpoint(ep, wq, tcpip.FullAddress{Addr: "\x7f\x00\x00\x01", Port: port}); err != nil {
+		ep.Close()
+		return nil, err
+	}
+	return ep, nil
+}
+
+// connectEndpoint connects the TCP endpoint ep, whose wait queue is wq, to
+// addr, and waits for the connection to be established.
+func connectEndpoint(ep tcpip.Endpoint, wq *waiter.Queue, addr tcpip.FullAddress) *tcpip.Error {
+	we, ch := waiter.NewChannelEntry(nil)
+	wq.EventRegister(&we, waiter.EventOut)
+	defer wq.EventUnregister(&we)
+
+	err := ep.Connect(addr)
+	if err == tcpip.ErrConnectStarted {
+		<-ch
+		err = ep.GetSockOpt(tcpip.ErrorOption{})
+	}
+	return err
+}
+
+// forwardStream copies data in both directions between the host socket hf and
+// the sandbox connection sc, whose endpoint is ep, until both directions are
+// shut down. Shutdowns are propagated from one side to the other.
+func forwardStream(hf *os.File, ep tcpip.Endpoint, sc net.Conn) {
+	// Fd puts the file into blocking mode, so it is called before the
+	// copies start.
+	fd := int(hf.Fd())
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		if _, err := io.Copy(hf, sc); err != nil {
+			// Unblock the other direction.
+			sc.Close()
+			hf.Close()
+			return
+		}
+		syscall.Shutdown(fd, syscall.SHUT_WR)
+	}()
+	go func() {
+		defer wg.Done()
+		if _, err := io.Copy(sc, hf); err != nil {
+			sc.Close()
+			hf.Close()
+			return
+		}
+		ep.Shutdown(tcpip.ShutdownWrite)
+	}()
+	wg.Wait()
+	sc.Close()
+	hf.Close()
 }
 
 // Wait waits for the init process in the given container.
 func (cm *containerManager) Wait(cid *string, waitStatus *uint32) error {
-	// TODO: Use the cid and wait on the init process in that
-	// container. Currently we just wait on PID 1 in the sandbox.
+	if err := cm.checkContainer(*cid); err != nil {
+		return err
+	}
 	tg := cm.k.TaskSet().Root.ThreadGroupWithID(1)
 	if tg == nil {
 		return fmt.Errorf("cannot wait: no thread group with id 1")
@@ -177,9 +459,9 @@ type SignalArgs struct {
 
 // Signal sends a signal to the init process of the container.
 func (cm *containerManager) Signal(args *SignalArgs, _ *struct{}) error {
-	// TODO: Use the cid and send the signal to the init
-	// process in theat container. Currently we just signal PID 1 in the
-	// sandbox.
+	if err := cm.checkContainer(args.CID); err != nil {
+		return err
+	}
 	si := arch.SignalInfo{Signo: args.Signo}
 	t := cm.k.TaskSet().Root.TaskWithID(1)
 	if t == nil {
@@ -187,3 +469,156 @@ func (cm *containerManager) Signal(args *SignalArgs, _ *struct{}) error {
 	}
 	return t.SendSignal(&si)
 }
+
+// DrainArgs are arguments to the Drain method.
+type DrainArgs struct {
+	// CID is the container id.
+	CID string
+
+	// Signo is the signal to send to the init process once the network
+	// stack is draining. No signal is sent if it is zero.
+	Signo int32
+
+	// ResetAfter is the time after which the remaining TCP connections
+	// are reset. They are never reset if it is zero.
+	ResetAfter time.Duration
+}
+
+// Drain puts the network stack into drain mode, in which new incoming
+// connections are refused while existing ones are served, and then signals
+// the init process of the container so that it can shut down gracefully.
+func (cm *containerManager) Drain(args *DrainArgs, _ *struct{}) error {
+	eps, ok := cm.k.NetworkStack().(*epsocket.Stack)
+	if !ok {
+		return fmt.Errorf("cannot drain: sandbox does not use netstack")
+	}
+	if args.ResetAfter < 0 {
+		return fmt.Errorf("cannot drain: negative reset deadline %v", args.ResetAfter)
+	}
+	eps.Stack.SetDraining(true)
+	log.Infof("Network stack is draining")
+	if args.ResetAfter > 0 {
+		time.AfterFunc(args.ResetAfter, func() {
+			n := eps.Stack.ResetConnections(tcp.ProtocolNumber)
+			log.Infof("Drain deadline expired, reset %d connections", n)
+		})
+	}
+	if args.Signo == 0 {
+		return nil
+	}
+	return cm.Signal(&SignalArgs{CID: args.CID, Signo: args.Signo}, nil)
+}
+
+// UpdateArgs are arguments to the Update method.
+type UpdateArgs struct {
+	// CID is the container id.
+	CID string
+
+	// Resources are the new limits. Limits that aren't set are unchanged.
+	Resources specs.LinuxResources
+}
+
+// Update changes the limits that the sentry enforces or reports for the
+// container. The memory limit is reported to applications as the total
+// memory, and changes to it are announced with memory hotplug uevents. The
+// pids limit bounds the number of tasks of the container. CPU limits are only
+// enforced by the host cgroup of the sandbox.
+//
+// Since the sandbox only runs the root container, its limits are the limits
+// of the sandbox.
+func (cm *containerManager) Update(args *UpdateArgs, _ *struct{}) error {
+	if err := cm.checkContainer(args.CID); err != nil {
+		return err
+	}
+	r := &args.Resources
+	if r.Memory != nil && r.Memory.Limit != nil {
+		var limit uint64
+		if *r.Memory.Limit > 0 {
+			limit = uint64(*r.Memory.Limit)
+		}
+		log.Infof("Setting memory limit to %d bytes", limit)
+		cm.k.SetMemoryLimit(limit)
+	}
+	if r.Pids != nil {
+		pids := cm.k.RootPIDsController()
+		if tg := cm.k.GlobalInit(); tg != nil {
+			pids = tg.PIDsController()
+		}
+		// Per the runtime spec, a limit of 0 or -1 means unlimited.
+		var limit uint64
+		if r.Pids.Limit > 0 {
+			limit = uint64(r.Pids.Limit)
+		}
+		log.Infof("Setting pids limit to %d", limit)
+		pids.SetMax(limit)
+	}
+	return nil
+}
+
+// Pause freezes the tasks of the container with the given ID until Resume is
+// called. Frozen tasks don't run, and signals sent to them are delivered once
+// they are resumed.
+func (cm *containerManager) Pause(cid *string, _ *struct{}) error {
+	if err := cm.checkContainer(*cid); err != nil {
+		return err
+	}
+	cm.pausedMu.Lock()
+	defer cm.pausedMu.Unlock()
+	if cm.paused {
+		return fmt.Errorf("container %q is already paused", *cid)
+	}
+	log.Infof("Pausing container %q", *cid)
+	cm.k.Pause()
+	cm.paused = true
+	return nil
+}
+
+// Resume thaws the tasks of the container with the given ID, which were
+// frozen by Pause.
+func (cm *containerManager) Resume(cid *string, _ *struct{}) error {
+	if err := cm.checkContainer(*cid); err != nil {
+		return err
+	}
+	cm.pausedMu.Lock()
+	defer cm.pausedMu.Unlock()
+	if !cm.paused {
+		return fmt.Errorf("container %q is not paused", *cid)
+	}
+	log.Infof("Resuming container %q", *cid)
+	cm.k.Unpause()
+	cm.paused = false
+	return nil
+}
+
+// StraceArgs are arguments to the Strace method.
+type StraceArgs struct {
+	// Enable enables tracing syscalls to the log. If it is false, tracing
+	// to the log is disabled and the other fields are ignored.
+	Enable bool
+
+	// Syscalls are the names of the syscalls, or syscall groups such as
+	// "%file", to trace. All syscalls are traced if it is empty.
+	Syscalls []string
+
+	// Filter further restricts the traced syscalls.
+	Filter strace.Filter
+}
+
+// Strace changes which syscalls are traced to the log, and how. The syscalls
+// recorded by --strace-ring-size are not affected.
+func (cm *containerManager) Strace(args *StraceArgs, _ *struct{}) error {
+	if !args.Enable {
+		strace.Disable(strace.SinkTypeLog)
+		log.Infof("Strace disabled")
+		return strace.SetFilter(strace.Filter{})
+	}
+	if err := strace.SetFilter(args.Filter); err != nil {
+		return err
+	}
+	log.Infof("Strace enabled for syscalls %v with filter %+v", args.Syscalls, args.Filter)
+	if len(args.Syscalls) == 0 {
+		strace.EnableAll(strace.SinkTypeLog)
+		return nil
+	}
+	return strace.Enable(args.Syscalls, strace.SinkTypeLog)
+}
@@ -0,0 +1,165 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"gvisor.googlesource.com/gvisor/pkg/dns"
+	"gvisor.googlesource.com/gvisor/pkg/log"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/socket/epsocket"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/adapters/gonet"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/stack"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/transport/tcp"
+	"gvisor.googlesource.com/gvisor/pkg/waiter"
+)
+
+const (
+	// dnsPort is the port that the DNS resolver listens on.
+	dnsPort = 53
+
+	// dnsCacheSize is the number of responses cached by the DNS resolver.
+	dnsCacheSize = 1024
+)
+
+// netstackDialer implements dns.Dialer with sockets in the sandbox network
+// stack, so that queries to the upstreams are subject to the egress policy
+// like any other traffic of the sandbox.
+type netstackDialer struct {
+	s *stack.Stack
+}
+
+// ListenPacket implements dns.Dialer.ListenPacket.
+func (d netstackDialer) ListenPacket(addr *net.UDPAddr) (net.PacketConn, error) {
+	proto, _ := ipToAddressAndProto(addr.IP)
+	c, err := gonet.NewPacketConn(d.s, tcpip.FullAddress{}, proto)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// DialTCP implements dns.Dialer.DialTCP. The connections are never redirected
+// to an interception proxy.
+func (d netstackDialer) DialTCP(addr *net.TCPAddr) (net.Conn, error) {
+	proto, a := ipToAddressAndProto(addr.IP)
+	var wq waiter.Queue
+	ep, err := d.s.NewEndpoint(tcp.ProtocolNumber, proto, &wq)
+	if err != nil {
+		return nil, errors.New(err.String())
+	}
+	if err := ep.SetSockOpt(tcpip.NoRedirectOption(1)); err != nil {
+		ep.Close()
+		return nil, errors.New(err.String())
+	}
+	if err := connectEndpoint(ep, &wq, tcpip.FullAddress{Addr: a, Port: uint16(addr.Port)}); err != nil {
+		ep.Close()
+		return nil, fmt.Errorf("failed to connect to %v: %v", addr, err)
+	}
+	return gonet.NewConn(&wq, ep), nil
+}
+
+// startDNSResolver starts a caching DNS resolver that answers queries on port
+// 53 of conf.DNSResolver, over UDP and TCP. The address is added to the
+// loopback interface, so it is reachable from the sandbox but not from the
+// outside.
+//
+// It must be called before the seccomp filters are installed, as the host's
+// root certificates are loaded from files.
+func startDNSResolver(s *epsocket.Stack, conf *Config) error {
+	cfg := dns.Config{
+		Upstreams: conf.DNSUpstreams,
+		Search:    conf.DNSSearch,
+		CacheSize: dnsCacheSize,
+		Dialer:    netstackDialer{s.Stack},
+	}
+	for _, u := range conf.DNSUpstreams {
+		if u.TLS {
+			pool, err := x509.SystemCertPool()
+			if err != nil {
+				return fmt.Errorf("failed to load the root certificates: %v", err)
+			}
+			cfg.RootCAs = pool
+			break
+		}
+	}
+	r, err := dns.New(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create DNS resolver: %v", err)
+	}
+
+	proto, addr := ipToAddressAndProto(conf.DNSResolver)
+	if err := addLoopbackAddress(s.Stack, proto, addr); err != nil {
+		return err
+	}
+	local := tcpip.FullAddress{Addr: addr, Port: dnsPort}
+	pc, err := gonet.NewPacketConn(s.Stack, local, proto)
+	if err != nil {
+		return fmt.Errorf("failed to listen on UDP port %d: %v", dnsPort, err)
+	}
+	l, err := gonet.NewListener(s.Stack, local, proto)
+	if err != nil {
+		pc.Close()
+		return fmt.Errorf("failed to listen on TCP port %d: %v", dnsPort, err)
+	}
+	go func() {
+		err := r.ServePacket(pc)
+		log.Warningf("DNS resolver stopped serving UDP: %v", err)
+	}()
+	go func() {
+		err := r.Serve(l)
+		log.Warningf("DNS resolver stopped serving TCP: %v", err)
+	}()
+	log.Infof("Serving DNS on %v, forwarding to %v", conf.DNSResolver, conf.DNSUpstreams)
+	return nil
+}
+
+// addLoopbackAddress adds addr to the loopback interface of s, and routes it
+// there ahead of any other route.
+func addLoopbackAddress(s *stack.Stack, proto tcpip.NetworkProtocolNumber, addr tcpip.Address) error {
+	loopbacks := map[tcpip.Address]bool{
+		ipToAddress(net.IPv4(127, 0, 0, 1)): true,
+		ipToAddress(net.IPv6loopback):       true,
+	}
+	var id tcpip.NICID
+	for nicID, info := range s.NICInfo() {
+		for _, pa := range info.ProtocolAddresses {
+			if loopbacks[pa.Address] {
+				id = nicID
+			}
+		}
+	}
+	if id == 0 {
+		return fmt.Errorf("no loopback interface to add address %v to", addr)
+	}
+
+	if err := s.AddAddress(id, proto, addr); err != nil {
+		return fmt.Errorf("AddAddress(%v, %v, %v) failed: %v", id, proto, addr, err)
+	}
+	// The route table is searched in order, so the route takes precedence
+	// over the routes of the other interfaces, which may include addr.
+	route := tcpip.Route{
+		Destination: addr,
+		Mask:        tcpip.Address(strings.Repeat("\xff", len(addr))),
+		NIC:         id,
+	}
+	s.SetRouteTable(append([]tcpip.Route{route}, s.GetRouteTable()...))
+	return nil
+}
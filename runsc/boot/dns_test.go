@@ -0,0 +1,120 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/dns"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/socket/epsocket"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/adapters/gonet"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/network/ipv4"
+)
+
+// dnsQuery is a query for the A records of example.com, with ID 0x4242.
+var dnsQuery = []byte("\x42\x42\x01\x00\x00\x01\x00\x00\x00\x00\x00\x00" +
+	"\x07example\x03com\x00\x00\x01\x00\x01")
+
+// serveUpstream answers the queries received on c with the address 192.0.2.1
+// for the first question.
+func serveUpstream(c net.PacketConn) {
+	b := make([]byte, 512)
+	for {
+		n, from, err := c.ReadFrom(b)
+		if err != nil {
+			return
+		}
+		if n < 12 {
+			continue
+		}
+		// Keep the header and the question, without any additional
+		// records, and append the answer.
+		end := 12
+		for end < n && b[end] != 0 {
+			end += int(b[end]) + 1
+		}
+		end += 5
+		if end > n {
+			continue
+		}
+		resp := append([]byte(nil), b[:end]...)
+		resp[2] |= 0x80
+		copy(resp[6:], "\x00\x01\x00\x00\x00\x00")
+		resp = append(resp, "\xc0\x0c\x00\x01\x00\x01\x00\x00\x01\x00\x00\x04\xc0\x00\x02\x01"...)
+		c.WriteTo(resp, from)
+	}
+}
+
+func TestDNSResolver(t *testing.T) {
+	s := newEmptyNetworkStack(&Config{Network: NetworkSandbox}, &tcpip.StdClock{}).(*epsocket.Stack)
+	n := &Network{Stack: s.Stack}
+	args := &CreateLinksAndRoutesArgs{
+		LoopbackLinks: []LoopbackLink{{
+			Name:      "lo",
+			Addresses: []net.IP{net.IPv4(127, 0, 0, 1)},
+			Routes: []Route{{
+				Destination: net.IPv4(127, 0, 0, 0),
+				Mask:        net.IPv4Mask(255, 0, 0, 0),
+			}},
+		}},
+	}
+	if err := n.CreateLinksAndRoutes(args, nil); err != nil {
+		t.Fatalf("CreateLinksAndRoutes failed: %v", err)
+	}
+
+	upstream, err := gonet.NewPacketConn(s.Stack, tcpip.FullAddress{Addr: "\x7f\x00\x00\x01", Port: 5353}, ipv4.ProtocolNumber)
+	if err != nil {
+		t.Fatalf("NewPacketConn failed: %v", err)
+	}
+	defer upstream.Close()
+	go serveUpstream(upstream)
+
+	conf := &Config{
+		DNSResolver:  net.ParseIP("169.254.169.253"),
+		DNSUpstreams: []dns.Upstream{{IP: net.IPv4(127, 0, 0, 1).To4(), Port: 5353}},
+	}
+	if err := startDNSResolver(s, conf); err != nil {
+		t.Fatalf("startDNSResolver failed: %v", err)
+	}
+	if routes := s.Stack.GetRouteTable(); len(routes) != 2 || routes[0].Destination != "\xa9\xfe\xa9\xfd" {
+		t.Errorf("got routes %+v, want a route to the resolver first", routes)
+	}
+
+	c, err := gonet.NewPacketConn(s.Stack, tcpip.FullAddress{}, ipv4.ProtocolNumber)
+	if err != nil {
+		t.Fatalf("NewPacketConn failed: %v", err)
+	}
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(10 * time.Second))
+	if _, err := c.WriteTo(dnsQuery, &net.UDPAddr{IP: conf.DNSResolver.To4(), Port: dnsPort}); err != nil {
+		t.Fatalf("WriteTo failed: %v", err)
+	}
+	b := make([]byte, 512)
+	m, _, err := c.ReadFrom(b)
+	if err != nil {
+		t.Fatalf("ReadFrom failed: %v", err)
+	}
+	resp := b[:m]
+	if len(resp) < 12 || !bytes.Equal(resp[:2], dnsQuery[:2]) || resp[3]&0xf != 0 {
+		t.Fatalf("got response %x, want a successful response to query %x", resp, dnsQuery)
+	}
+	if !bytes.Contains(resp, []byte("\x00\x04\xc0\x00\x02\x01")) {
+		t.Errorf("got response %x, want address 192.0.2.1", resp)
+	}
+}
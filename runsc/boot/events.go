@@ -78,5 +78,10 @@ func (s *Stats) populateMemory(k *kernel.Kernel) {
 }
 
 func (s *Stats) populatePIDs(k *kernel.Kernel) {
-	s.Pids.Current = uint64(len(k.TaskSet().Root.ThreadGroups()))
+	pids := k.RootPIDsController()
+	if tg := k.GlobalInit(); tg != nil {
+		pids = tg.PIDsController()
+	}
+	s.Pids.Current = pids.Current()
+	s.Pids.Limit = pids.Max()
 }
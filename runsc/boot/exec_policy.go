@@ -0,0 +1,73 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/mm"
+)
+
+// execPolicyAnnotation is the spec annotation that restricts the executable
+// mappings that the container's processes may create. Its value is a JSON
+// object, for example:
+//
+//	{
+//	  "deny-write-exec": true,
+//	  "deny-anonymous-exec": true,
+//	  "audit-only": false,
+//	  "exceptions": ["/usr/bin/node", "/usr/lib/jvm/*/bin/java"]
+//	}
+//
+// See mm.ExecPolicy for the meaning of each field.
+const execPolicyAnnotation = "dev.gvisor.exec-policy"
+
+// execPolicySpec is the JSON form of execPolicyAnnotation.
+type execPolicySpec struct {
+	DenyWriteExec     bool     `json:"deny-write-exec"`
+	DenyAnonymousExec bool     `json:"deny-anonymous-exec"`
+	AuditOnly         bool     `json:"audit-only"`
+	Exceptions        []string `json:"exceptions"`
+}
+
+// execPolicy returns the executable mapping policy declared by the spec, or
+// nil if the spec does not restrict executable mappings.
+func execPolicy(spec *specs.Spec) (*mm.ExecPolicy, error) {
+	val, ok := spec.Annotations[execPolicyAnnotation]
+	if !ok {
+		return nil, nil
+	}
+	var s execPolicySpec
+	if err := json.Unmarshal([]byte(val), &s); err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %v", execPolicyAnnotation, err)
+	}
+	for _, pattern := range s.Exceptions {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid %s annotation: invalid exception %q: %v", execPolicyAnnotation, pattern, err)
+		}
+	}
+	if !s.DenyWriteExec && !s.DenyAnonymousExec {
+		return nil, nil
+	}
+	return &mm.ExecPolicy{
+		DenyWriteExec:     s.DenyWriteExec,
+		DenyAnonymousExec: s.DenyAnonymousExec,
+		AuditOnly:         s.AuditOnly,
+		Exceptions:        s.Exceptions,
+	}, nil
+}
@@ -16,23 +16,32 @@ package boot
 
 import (
 	"fmt"
+	"strings"
 	"syscall"
 
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/host"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel/kdefs"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/limits"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/socket/epsocket"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/network/ipv6"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/transport/tcp"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/transport/udp"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/transport/unix"
+	"gvisor.googlesource.com/gvisor/pkg/waiter"
 )
 
 // createFDMap creates an fd map that contains stdin, stdout, and stderr. If
 // console is true, then ioctl calls will be passed through to the host fd.
 //
-// TODO: We currently arn't passing any FDs in to the sandbox, so
-// there's not much else for this function to do.  It will get more complicated
-// when gofers enter the picture.  Also the LISTEN_FDS environment variable
-// allows passing arbitrary FDs to the sandbox, which we do not yet support.
+// TODO: We currently arn't passing any host FDs in to the sandbox,
+// so there's not much else for this function to do. Listening sockets for
+// socket activation are added by addActivationSockets.
 func createFDMap(ctx context.Context, k *kernel.Kernel, l *limits.LimitSet, console bool) (*kernel.FDMap, error) {
 	fdm := k.NewFDMap()
 	defer fdm.DecRef()
@@ -59,3 +68,73 @@ func createFDMap(ctx context.Context, k *kernel.Kernel, l *limits.LimitSet, cons
 	fdm.IncRef()
 	return fdm, nil
 }
+
+// listenFDsStart is the first FD passed with the systemd socket activation
+// protocol, SD_LISTEN_FDS_START in sd-daemon.h.
+const listenFDsStart = 3
+
+// activationBacklog is the backlog of listening activation sockets. It is the
+// maximum backlog that applications may set with listen(2), so that
+// connections made before the application starts are not refused.
+const activationBacklog = 1024
+
+// addActivationSockets creates socks in the sandbox network stack and installs
+// them in fdm, starting at FD 3. It returns envv with the environment
+// variables of the systemd socket activation protocol set.
+func addActivationSockets(ctx context.Context, k *kernel.Kernel, fdm *kernel.FDMap, l *limits.LimitSet, socks []ActivationSocket, envv []string) ([]string, error) {
+	s, ok := k.NetworkStack().(*epsocket.Stack)
+	if !ok {
+		return nil, fmt.Errorf("socket activation requires a sandbox network stack")
+	}
+	for i, sock := range socks {
+		file, err := newActivationSocket(ctx, s, sock)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create socket %v: %v", sock, err)
+		}
+		err = fdm.NewFDAt(kdefs.FD(listenFDsStart+i), file, kernel.FDFlags{}, l)
+		file.DecRef()
+		if err != nil {
+			return nil, fmt.Errorf("failed to add socket %v to FDMap: %v", sock, err)
+		}
+	}
+
+	// Replace any variables set by the spec. The container's init process
+	// is the first process in the sandbox, so its PID is 1.
+	env := make([]string, 0, len(envv)+2)
+	for _, e := range envv {
+		if !strings.HasPrefix(e, "LISTEN_PID=") && !strings.HasPrefix(e, "LISTEN_FDS=") && !strings.HasPrefix(e, "LISTEN_FDNAMES=") {
+			env = append(env, e)
+		}
+	}
+	return append(env, "LISTEN_PID=1", fmt.Sprintf("LISTEN_FDS=%d", len(socks))), nil
+}
+
+// newActivationSocket returns a socket described by sock, bound to all
+// addresses and listening if it is a stream socket.
+func newActivationSocket(ctx context.Context, s *epsocket.Stack, sock ActivationSocket) (*fs.File, error) {
+	family, netProto := linux.AF_INET, ipv4.ProtocolNumber
+	if strings.HasSuffix(sock.Network, "6") {
+		family, netProto = linux.AF_INET6, ipv6.ProtocolNumber
+	}
+	stype, transProto := unix.SockStream, tcp.ProtocolNumber
+	if strings.HasPrefix(sock.Network, "udp") {
+		stype, transProto = unix.SockDgram, udp.ProtocolNumber
+	}
+
+	wq := &waiter.Queue{}
+	ep, err := s.Stack.NewEndpoint(transProto, netProto, wq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create endpoint: %v", err)
+	}
+	if err := ep.Bind(tcpip.FullAddress{Port: sock.Port}, nil); err != nil {
+		ep.Close()
+		return nil, fmt.Errorf("failed to bind: %v", err)
+	}
+	if stype == unix.SockStream {
+		if err := ep.Listen(activationBacklog); err != nil {
+			ep.Close()
+			return nil, fmt.Errorf("failed to listen: %v", err)
+		}
+	}
+	return epsocket.New(ctx, family, stype, wq, ep), nil
+}
@@ -18,7 +18,9 @@ import (
 	"syscall"
 
 	"golang.org/x/sys/unix"
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
 	"gvisor.googlesource.com/gvisor/pkg/seccomp"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/devproxy"
 )
 
 // allowedSyscalls is the set of syscalls executed by the Sentry
@@ -93,6 +95,18 @@ func consoleFilters() seccomp.SyscallRules {
 	}
 }
 
+// deviceProxyFilters returns syscalls made to forward ioctls to proxied host
+// devices. Only the safelisted ioctl requests are allowed.
+func deviceProxyFilters() seccomp.SyscallRules {
+	var rules []seccomp.Rule
+	for _, r := range devproxy.Requests() {
+		rules = append(rules, seccomp.Rule{seccomp.AllowAny{}, seccomp.AllowValue(r)})
+	}
+	return seccomp.SyscallRules{
+		syscall.SYS_IOCTL: rules,
+	}
+}
+
 // whitelistFSFilters returns syscalls made by whitelistFS. Using WhitelistFS
 // is less secure because it runs inside the Sentry and must be able to perform
 // file operations that would otherwise be disabled by seccomp when a Gofer is
@@ -132,6 +146,38 @@ func whitelistFSFilters() seccomp.SyscallRules {
 	}
 }
 
+// donatedFSFilters returns syscalls made by whitelistFS on mounts whose root
+// was donated by the Gofer. Files are only opened relative to directories of
+// these mounts, with the exact flags used by whitelistFS, so syscalls that take
+// a path without a directory FD remain disallowed. Donated FDs are not confined
+// to their mounts by seccomp: absolute paths and ".." are rejected by the
+// Sentry's path resolution, and symlinks are not followed.
+func donatedFSFilters() seccomp.SyscallRules {
+	var openat []seccomp.Rule
+	for _, flags := range []uintptr{
+		syscall.O_RDWR | syscall.O_NOFOLLOW,
+		syscall.O_RDONLY | syscall.O_NOFOLLOW,
+		syscall.O_WRONLY | syscall.O_NOFOLLOW,
+		linux.O_PATH | syscall.O_NOFOLLOW,
+		syscall.O_RDWR | syscall.O_CREAT | syscall.O_EXCL,
+	} {
+		openat = append(openat, seccomp.Rule{
+			seccomp.AllowAny{},
+			seccomp.AllowAny{},
+			seccomp.AllowValue(flags),
+		})
+	}
+	return seccomp.SyscallRules{
+		syscall.SYS_MKDIRAT:   {},
+		syscall.SYS_OPENAT:    openat,
+		syscall.SYS_SYMLINKAT: {},
+		syscall.SYS_UNLINKAT: {
+			{seccomp.AllowAny{}, seccomp.AllowAny{}, seccomp.AllowValue(0)},
+			{seccomp.AllowAny{}, seccomp.AllowAny{}, seccomp.AllowValue(linux.AT_REMOVEDIR)},
+		},
+	}
+}
+
 // hostInetFilters contains syscalls that are needed by sentry/socket/hostinet.
 func hostInetFilters() seccomp.SyscallRules {
 	return seccomp.SyscallRules{
@@ -165,6 +211,14 @@ func ptraceFilters() seccomp.SyscallRules {
 	}
 }
 
+// ptraceNicenessFilters returns syscalls made by the ptrace platform to
+// propagate task niceness to its stub threads.
+func ptraceNicenessFilters() seccomp.SyscallRules {
+	return seccomp.SyscallRules{
+		syscall.SYS_SETPRIORITY: {},
+	}
+}
+
 // kvmFilters returns syscalls made exclusively by the KVM platform.
 func kvmFilters() seccomp.SyscallRules {
 	return seccomp.SyscallRules{
@@ -28,7 +28,7 @@ import (
 )
 
 // Install installs seccomp filters for based on the given platform.
-func Install(p platform.Platform, whitelistFS, console, hostNetwork bool) error {
+func Install(p platform.Platform, whitelistFS, donatedFS, console, hostNetwork, hostNiceness, deviceProxy bool) error {
 	s := allowedSyscalls
 
 	// Set of additional filters used by -race and -msan. Returns empty
@@ -39,6 +39,9 @@ func Install(p platform.Platform, whitelistFS, console, hostNetwork bool) error
 		Report("direct file access allows unrestricted file access!")
 		s.Merge(whitelistFSFilters())
 	}
+	if donatedFS {
+		s.Merge(donatedFSFilters())
+	}
 	if console {
 		Report("console is enabled: syscall filters less restrictive!")
 		s.Merge(consoleFilters())
@@ -47,10 +50,18 @@ func Install(p platform.Platform, whitelistFS, console, hostNetwork bool) error
 		Report("host networking enabled: syscall filters less restrictive!")
 		s.Merge(hostInetFilters())
 	}
+	if deviceProxy {
+		Report("device proxy enabled: syscall filters less restrictive!")
+		s.Merge(deviceProxyFilters())
+	}
 
 	switch p := p.(type) {
 	case *ptrace.PTrace:
 		s.Merge(ptraceFilters())
+		if hostNiceness {
+			Report("host niceness enabled: syscall filters less restrictive!")
+			s.Merge(ptraceNicenessFilters())
+		}
 	case *kvm.KVM:
 		s.Merge(kvmFilters())
 	default:
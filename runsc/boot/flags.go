@@ -0,0 +1,191 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/abi"
+	"gvisor.googlesource.com/gvisor/pkg/log"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/arch"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/strace"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/link/sniffer"
+)
+
+// DynamicFlags are the names of the flags that can be changed in a running
+// sandbox with SetFlags.
+var DynamicFlags = []string{
+	"debug",
+	"flight-recorder-period",
+	"log-packets",
+	"profile-block",
+	"profile-mutex",
+	"slow-syscall-threshold",
+	"strace",
+	"strace-syscalls",
+	"syscall-latency",
+	"watchdog-action",
+	"watchdog-timeout",
+}
+
+// SetFlagsArgs are arguments to the SetFlags method.
+type SetFlagsArgs struct {
+	// Flags are the new values of the flags, by flag name without leading
+	// dashes, e.g. "strace": "true".
+	Flags map[string]string
+}
+
+// SetFlags changes the values of flags of the running sandbox. Only the flags
+// in DynamicFlags can be changed. If any flag is invalid, no flag is changed.
+func (cm *containerManager) SetFlags(args *SetFlagsArgs, _ *struct{}) error {
+	cm.confMu.Lock()
+	defer cm.confMu.Unlock()
+
+	conf := cm.conf
+	if err := setFlags(&conf, args.Flags); err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(args.Flags))
+	for name := range args.Flags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	log.Infof("Setting flags %v", args.Flags)
+
+	// Flags that configure the same feature are applied together, once.
+	applied := make(map[string]bool)
+	for _, name := range names {
+		switch name {
+		case "debug":
+			if conf.Debug {
+				log.SetLevel(log.Debug)
+			} else {
+				log.SetLevel(log.Info)
+			}
+		case "flight-recorder-period":
+			cm.recorder.SetPeriod(conf.FlightRecorderPeriod)
+		case "log-packets":
+			if conf.LogPackets {
+				atomic.StoreUint32(&sniffer.LogPackets, 1)
+			} else {
+				atomic.StoreUint32(&sniffer.LogPackets, 0)
+			}
+		case "profile-block":
+			cm.profile.EnableBlockProfiling(conf.ProfileBlock)
+		case "profile-mutex":
+			cm.profile.EnableMutexProfiling(conf.ProfileMutex)
+		case "strace", "strace-syscalls":
+			if applied["strace"] {
+				continue
+			}
+			applied["strace"] = true
+			sargs := StraceArgs{Enable: conf.Strace, Syscalls: conf.StraceSyscalls}
+			if err := cm.Strace(&sargs, nil); err != nil {
+				return err
+			}
+		case "syscall-latency", "slow-syscall-threshold":
+			if applied["syscall-latency"] {
+				continue
+			}
+			applied["syscall-latency"] = true
+			if conf.SyscallLatency {
+				kernel.EnableSyscallLatency(conf.SlowSyscallThreshold)
+			} else {
+				kernel.DisableSyscallLatency()
+			}
+		case "watchdog-timeout", "watchdog-action":
+			if applied["watchdog"] {
+				continue
+			}
+			applied["watchdog"] = true
+			cm.watchdog.SetTimeout(conf.WatchdogTimeout, conf.WatchdogAction.watchdogAction())
+		}
+	}
+
+	cm.conf = conf
+	return nil
+}
+
+// setFlags parses the values of flags into conf. Only the flags in
+// DynamicFlags are accepted.
+func setFlags(conf *Config, flags map[string]string) error {
+	for name, val := range flags {
+		var err error
+		switch name {
+		case "debug":
+			conf.Debug, err = strconv.ParseBool(val)
+		case "flight-recorder-period":
+			conf.FlightRecorderPeriod, err = parseDuration(val)
+		case "log-packets":
+			conf.LogPackets, err = strconv.ParseBool(val)
+		case "profile-block":
+			conf.ProfileBlock, err = strconv.ParseBool(val)
+		case "profile-mutex":
+			conf.ProfileMutex, err = strconv.ParseBool(val)
+		case "slow-syscall-threshold":
+			conf.SlowSyscallThreshold, err = parseDuration(val)
+		case "strace":
+			conf.Strace, err = strconv.ParseBool(val)
+		case "strace-syscalls":
+			conf.StraceSyscalls = nil
+			if val != "" {
+				conf.StraceSyscalls = strings.Split(val, ",")
+			}
+		case "syscall-latency":
+			conf.SyscallLatency, err = strconv.ParseBool(val)
+		case "watchdog-action":
+			conf.WatchdogAction, err = MakeWatchdogAction(val)
+		case "watchdog-timeout":
+			conf.WatchdogTimeout, err = parseDuration(val)
+		default:
+			return fmt.Errorf("flag %q can't be changed in a running sandbox", name)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid value %q for flag %q: %v", val, name, err)
+		}
+	}
+
+	// Check the syscall names now, rather than fail after other flags have
+	// been applied.
+	if len(conf.StraceSyscalls) > 0 {
+		sys, ok := strace.Lookup(abi.Linux, arch.AMD64)
+		if !ok {
+			return fmt.Errorf("no syscall names available")
+		}
+		if _, err := sys.ConvertToSysnoMap(conf.StraceSyscalls); err != nil {
+			return fmt.Errorf("invalid value for flag \"strace-syscalls\": %v", err)
+		}
+	}
+	return nil
+}
+
+// parseDuration parses a duration that can't be negative.
+func parseDuration(s string) (time.Duration, error) {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("duration is negative")
+	}
+	return d, nil
+}
@@ -0,0 +1,98 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSetFlags(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		flags   map[string]string
+		want    Config
+		wantErr bool
+	}{
+		{
+			name:  "bools",
+			flags: map[string]string{"debug": "true", "log-packets": "1", "profile-block": "true", "profile-mutex": "true"},
+			want:  Config{Debug: true, LogPackets: true, ProfileBlock: true, ProfileMutex: true},
+		},
+		{
+			name:  "strace",
+			flags: map[string]string{"strace": "true", "strace-syscalls": "read,%network"},
+			want:  Config{Strace: true, StraceSyscalls: []string{"read", "%network"}},
+		},
+		{
+			name:  "syscall latency",
+			flags: map[string]string{"syscall-latency": "true", "slow-syscall-threshold": "10ms"},
+			want:  Config{SyscallLatency: true, SlowSyscallThreshold: 10 * time.Millisecond},
+		},
+		{
+			name:  "flight recorder",
+			flags: map[string]string{"flight-recorder-period": "500ms"},
+			want:  Config{FlightRecorderPeriod: 500 * time.Millisecond},
+		},
+		{
+			name:  "watchdog",
+			flags: map[string]string{"watchdog-timeout": "1m", "watchdog-action": "panic"},
+			want:  Config{WatchdogTimeout: time.Minute, WatchdogAction: WatchdogPanic},
+		},
+		{
+			name:    "static flag",
+			flags:   map[string]string{"network": "host"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid bool",
+			flags:   map[string]string{"debug": "maybe"},
+			wantErr: true,
+		},
+		{
+			name:    "negative duration",
+			flags:   map[string]string{"watchdog-timeout": "-1s"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid action",
+			flags:   map[string]string{"watchdog-action": "reboot"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown syscall",
+			flags:   map[string]string{"strace-syscalls": "read,nosuchcall"},
+			wantErr: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var conf Config
+			err := setFlags(&conf, tc.flags)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("setFlags(%v) succeeded, want error", tc.flags)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("setFlags(%v) failed: %v", tc.flags, err)
+			}
+			if !reflect.DeepEqual(conf, tc.want) {
+				t.Errorf("setFlags(%v) = %+v, want %+v", tc.flags, conf, tc.want)
+			}
+		})
+	}
+}
@@ -15,12 +15,14 @@
 package boot
 
 import (
+	"encoding/json"
 	"fmt"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"syscall"
 
 	// Include filesystem types that OCI spec might mount.
-	_ "gvisor.googlesource.com/gvisor/pkg/sentry/fs/dev"
 	_ "gvisor.googlesource.com/gvisor/pkg/sentry/fs/gofer"
 	_ "gvisor.googlesource.com/gvisor/pkg/sentry/fs/host"
 	_ "gvisor.googlesource.com/gvisor/pkg/sentry/fs/proc"
@@ -33,17 +35,24 @@ import (
 	"gvisor.googlesource.com/gvisor/pkg/log"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/context"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/dev"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/devproxy"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/ramfs"
 	"gvisor.googlesource.com/gvisor/pkg/syserror"
+	"gvisor.googlesource.com/gvisor/pkg/unet"
 )
 
 type fdDispenser struct {
 	fds []int
+
+	// channels is the number of FDs of each mount.
+	channels int
 }
 
-func (f *fdDispenser) remove() int {
-	rv := f.fds[0]
-	f.fds = f.fds[1:]
+// remove returns the FDs of the channels of the next mount.
+func (f *fdDispenser) remove() []int {
+	rv := f.fds[:f.channels]
+	f.fds = f.fds[f.channels:]
 	return rv
 }
 
@@ -52,10 +61,11 @@ func (f *fdDispenser) empty() bool {
 }
 
 // createMountNamespace creates a mount namespace containing the root filesystem
-// and all mounts. 'rootCtx' is used to walk directories to find mount points.
-func createMountNamespace(userCtx context.Context, rootCtx context.Context, spec *specs.Spec, conf *Config, ioFDs []int) (*fs.MountNamespace, error) {
-	fds := &fdDispenser{fds: ioFDs}
-	rootInode, err := createRootMount(rootCtx, spec, conf, fds)
+// and all mounts of the container with the given ID. 'rootCtx' is used to walk
+// directories to find mount points.
+func createMountNamespace(userCtx context.Context, rootCtx context.Context, cid string, spec *specs.Spec, conf *Config, ioFDs []int) (*fs.MountNamespace, error) {
+	fds := &fdDispenser{fds: ioFDs, channels: conf.MountFDs()}
+	rootInode, err := createRootMount(rootCtx, cid, spec, conf, fds)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create root mount: %v", err)
 	}
@@ -63,7 +73,7 @@ func createMountNamespace(userCtx context.Context, rootCtx context.Context, spec
 	if err != nil {
 		return nil, fmt.Errorf("failed to create root mount namespace: %v", err)
 	}
-	if err := configureMounts(rootCtx, spec, conf, mns, fds); err != nil {
+	if err := configureMounts(rootCtx, cid, spec, conf, mns, fds); err != nil {
 		return nil, fmt.Errorf("failed to configure mounts: %v", err)
 	}
 	if !fds.empty() {
@@ -74,7 +84,7 @@ func createMountNamespace(userCtx context.Context, rootCtx context.Context, spec
 
 // configureMounts iterates over Spec.Mounts and mounts them in the specified
 // mount namespace.
-func configureMounts(ctx context.Context, spec *specs.Spec, conf *Config, mns *fs.MountNamespace, fds *fdDispenser) error {
+func configureMounts(ctx context.Context, cid string, spec *specs.Spec, conf *Config, mns *fs.MountNamespace, fds *fdDispenser) error {
 	// Keep track of whether proc, sys, and tmp were mounted.
 	var procMounted, sysMounted, tmpMounted bool
 
@@ -96,13 +106,13 @@ func configureMounts(ctx context.Context, spec *specs.Spec, conf *Config, mns *f
 			tmpMounted = true
 		}
 
-		if err := mountSubmount(ctx, spec, conf, mns, fds, m); err != nil {
+		if err := mountSubmount(ctx, cid, spec, conf, mns, fds, m); err != nil {
 			return err
 		}
 	}
 
 	// Always mount /dev.
-	if err := mountSubmount(ctx, spec, conf, mns, nil, specs.Mount{
+	if err := mountSubmount(ctx, cid, spec, conf, mns, nil, specs.Mount{
 		Type:        "devtmpfs",
 		Destination: "/dev",
 	}); err != nil {
@@ -110,7 +120,7 @@ func configureMounts(ctx context.Context, spec *specs.Spec, conf *Config, mns *f
 	}
 
 	// Always mount /dev/pts.
-	if err := mountSubmount(ctx, spec, conf, mns, nil, specs.Mount{
+	if err := mountSubmount(ctx, cid, spec, conf, mns, nil, specs.Mount{
 		Type:        "devpts",
 		Destination: "/dev/pts",
 	}); err != nil {
@@ -120,7 +130,7 @@ func configureMounts(ctx context.Context, spec *specs.Spec, conf *Config, mns *f
 	// Mount proc and sys even if the user did not ask for it, as the spec
 	// says we SHOULD.
 	if !procMounted {
-		if err := mountSubmount(ctx, spec, conf, mns, nil, specs.Mount{
+		if err := mountSubmount(ctx, cid, spec, conf, mns, nil, specs.Mount{
 			Type:        "proc",
 			Destination: "/proc",
 		}); err != nil {
@@ -128,7 +138,7 @@ func configureMounts(ctx context.Context, spec *specs.Spec, conf *Config, mns *f
 		}
 	}
 	if !sysMounted {
-		if err := mountSubmount(ctx, spec, conf, mns, nil, specs.Mount{
+		if err := mountSubmount(ctx, cid, spec, conf, mns, nil, specs.Mount{
 			Type:        "sysfs",
 			Destination: "/sys",
 		}); err != nil {
@@ -140,7 +150,7 @@ func configureMounts(ctx context.Context, spec *specs.Spec, conf *Config, mns *f
 	// rely on the host /tmp, but this is a nice optimization, and fixes
 	// some apps that call mknod in /tmp.
 	if !tmpMounted {
-		if err := mountSubmount(ctx, spec, conf, mns, nil, specs.Mount{
+		if err := mountSubmount(ctx, cid, spec, conf, mns, nil, specs.Mount{
 			Type:        "tmpfs",
 			Destination: "/tmp",
 		}); err != nil {
@@ -151,21 +161,56 @@ func configureMounts(ctx context.Context, spec *specs.Spec, conf *Config, mns *f
 	return nil
 }
 
+// addProxiedDevices adds the host devices in conf.DeviceProxy, open at
+// deviceFDs, to /dev.
+func addProxiedDevices(ctx context.Context, mns *fs.MountNamespace, conf *Config, deviceFDs []int) error {
+	if len(deviceFDs) != len(conf.DeviceProxy) {
+		return fmt.Errorf("got %d device FDs for %d proxied devices", len(deviceFDs), len(conf.DeviceProxy))
+	}
+	if len(deviceFDs) == 0 {
+		return nil
+	}
+
+	root := mns.Root()
+	defer root.DecRef()
+	d, err := mns.FindInode(ctx, root, nil, "/dev", fs.DefaultTraversalLimit)
+	if err != nil {
+		return fmt.Errorf("failed to find /dev: %v", err)
+	}
+	defer d.DecRef()
+	devDir, ok := d.Inode.InodeOperations.(*dev.Dev)
+	if !ok {
+		return fmt.Errorf("/dev is not a devtmpfs")
+	}
+
+	for i, path := range conf.DeviceProxy {
+		name := filepath.Base(path)
+		driver, err := devproxy.FindDriver(name)
+		if err != nil {
+			return err
+		}
+		device := devproxy.NewDevice(ctx, driver, deviceFDs[i], fs.RootOwner, fs.FilePermsFromMode(0666))
+		devDir.AddChild(ctx, name, devproxy.NewInode(device, d.Inode.MountSource))
+		log.Infof("Proxying host device %q with driver %s", path, driver.Name)
+	}
+	return nil
+}
+
 // createRootMount creates the root filesystem.
-func createRootMount(ctx context.Context, spec *specs.Spec, conf *Config, fds *fdDispenser) (*fs.Inode, error) {
+func createRootMount(ctx context.Context, cid string, spec *specs.Spec, conf *Config, fds *fdDispenser) (*fs.Inode, error) {
 	// First construct the filesystem from the spec.Root.
-	mf := fs.MountSourceFlags{ReadOnly: spec.Root.Readonly}
+	mf, audit, err := rootMountFlags(spec)
+	if err != nil {
+		return nil, err
+	}
 
-	var (
-		rootInode *fs.Inode
-		err       error
-	)
+	var rootInode *fs.Inode
 	switch conf.FileAccess {
 	case FileAccessProxy:
-		fd := fds.remove()
-		log.Infof("Mounting root over 9P, ioFD: %d", fd)
+		data := p9MountOptions(cid, spec, fds)
+		log.Infof("Mounting root over 9P: %v", data)
 		hostFS := mustFindFilesystem("9p")
-		rootInode, err = hostFS.Mount(ctx, "root", mf, fmt.Sprintf("trans=fd,rfdno=%d,wfdno=%d,privateunixsocket=true", fd, fd))
+		rootInode, err = hostFS.Mount(ctx, "root", mf, strings.Join(data, ","))
 		if err != nil {
 			return nil, fmt.Errorf("failed to generate root mount point: %v", err)
 		}
@@ -177,6 +222,19 @@ func createRootMount(ctx context.Context, spec *specs.Spec, conf *Config, fds *f
 			return nil, fmt.Errorf("failed to generate root mount point: %v", err)
 		}
 
+	case FileAccessDonated:
+		ioFDs := fds.remove()
+		rootFD, err := receiveMountFD(ioFDs[0])
+		if err != nil {
+			return nil, fmt.Errorf("failed to receive root FD: %v", err)
+		}
+		log.Infof("Mounting root from donated FD %d, ioFD: %d", rootFD, ioFDs[0])
+		hostFS := mustFindFilesystem("whitelistfs")
+		rootInode, err = hostFS.Mount(ctx, "root", mf, fmt.Sprintf("rootfd=%d,dont_translate_ownership=true", rootFD))
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate root mount point: %v", err)
+		}
+
 	default:
 		return nil, fmt.Errorf("invalid file access type: %v", conf.FileAccess)
 	}
@@ -190,7 +248,7 @@ func createRootMount(ctx context.Context, spec *specs.Spec, conf *Config, fds *f
 		return nil, fmt.Errorf("error adding submount overlay: %v", err)
 	}
 
-	if conf.Overlay {
+	if conf.Overlay && !audit {
 		log.Debugf("Adding overlay on top of root mount")
 		// Overlay a tmpfs filesystem on top of the root.
 		rootInode, err = addOverlay(ctx, conf, rootInode, "root-overlay-upper", mf)
@@ -222,12 +280,15 @@ func addOverlay(ctx context.Context, conf *Config, lower *fs.Inode, name string,
 	return fs.NewOverlayRoot(ctx, upper, lower, lowerFlags)
 }
 
-func mountSubmount(ctx context.Context, spec *specs.Spec, conf *Config, mns *fs.MountNamespace, fds *fdDispenser, m specs.Mount) error {
+func mountSubmount(ctx context.Context, cid string, spec *specs.Spec, conf *Config, mns *fs.MountNamespace, fds *fdDispenser, m specs.Mount) error {
 	// Map mount type to filesystem name, and parse out the options that we are
 	// capable of dealing with.
 	var data []string
 	var fsName string
-	var useOverlay bool
+	mf, useOverlay, err := submountFlags(spec, conf, m)
+	if err != nil {
+		return err
+	}
 	switch m.Type {
 	case "devpts", "devtmpfs", "proc", "sysfs":
 		fsName = m.Type
@@ -237,7 +298,6 @@ func mountSubmount(ctx context.Context, spec *specs.Spec, conf *Config, mns *fs.
 		fsName = m.Type
 
 		// tmpfs has some extra supported options that we must pass through.
-		var err error
 		data, err = parseAndFilterOptions(m.Options, "mode", "uid", "gid")
 		if err != nil {
 			return err
@@ -245,17 +305,21 @@ func mountSubmount(ctx context.Context, spec *specs.Spec, conf *Config, mns *fs.
 	case "bind":
 		switch conf.FileAccess {
 		case FileAccessProxy:
-			fd := fds.remove()
 			fsName = "9p"
-			data = []string{"trans=fd", fmt.Sprintf("rfdno=%d", fd), fmt.Sprintf("wfdno=%d", fd), "privateunixsocket=true"}
+			data = p9MountOptions(cid, spec, fds)
 		case FileAccessDirect:
 			fsName = "whitelistfs"
 			data = []string{"root=" + m.Source, "dont_translate_ownership=true"}
+		case FileAccessDonated:
+			fsName = "whitelistfs"
+			rootFD, err := receiveMountFD(fds.remove()[0])
+			if err != nil {
+				return fmt.Errorf("failed to receive FD of mount %q: %v", m.Destination, err)
+			}
+			data = []string{fmt.Sprintf("rootfd=%d", rootFD), "dont_translate_ownership=true"}
 		default:
 			return fmt.Errorf("invalid file access type: %v", conf.FileAccess)
 		}
-		// If configured, add overlay to all writable mounts.
-		useOverlay = conf.Overlay && !mountFlags(m.Options).ReadOnly
 
 	default:
 		// TODO: Support all the mount types and make this a
@@ -269,13 +333,7 @@ func mountSubmount(ctx context.Context, spec *specs.Spec, conf *Config, mns *fs.
 	// All filesystem names should have been mapped to something we know.
 	filesystem := mustFindFilesystem(fsName)
 
-	mf := mountFlags(m.Options)
-	if useOverlay {
-		// All writes go to upper, be paranoid and make lower readonly.
-		mf.ReadOnly = true
-	}
-
-	inode, err := filesystem.Mount(ctx, m.Type, mf, strings.Join(data, ","))
+	inode, err := filesystem.Mount(ctx, mountDevice(m), mf, strings.Join(data, ","))
 	if err != nil {
 		return fmt.Errorf("failed to create mount with source %q: %v", m.Source, err)
 	}
@@ -329,6 +387,211 @@ func mountSubmount(ctx context.Context, spec *specs.Spec, conf *Config, mns *fs.
 	return nil
 }
 
+// rootMountFlags returns the flags of the root mount, and whether writes to
+// it are audited.
+func rootMountFlags(spec *specs.Spec) (fs.MountSourceFlags, bool, error) {
+	mf := fs.MountSourceFlags{ReadOnly: spec.Root.Readonly}
+	audit, err := auditWrites(spec, "/")
+	if err != nil {
+		return fs.MountSourceFlags{}, false, err
+	}
+	if audit {
+		mf.ReadOnly = true
+		mf.AuditWrites = true
+	}
+	return mf, audit, nil
+}
+
+// submountFlags returns the flags of the mount m, and whether an overlay is
+// added on top of it.
+func submountFlags(spec *specs.Spec, conf *Config, m specs.Mount) (fs.MountSourceFlags, bool, error) {
+	audit, err := auditWrites(spec, m.Destination)
+	if err != nil {
+		return fs.MountSourceFlags{}, false, err
+	}
+	mf := mountFlags(m.Options)
+	// If configured, add overlay to all writable bind mounts.
+	useOverlay := m.Type == "bind" && conf.Overlay && !mf.ReadOnly && !audit
+	if audit {
+		mf.ReadOnly = true
+		mf.AuditWrites = true
+	}
+	if useOverlay {
+		// All writes go to upper, be paranoid and make lower readonly.
+		mf.ReadOnly = true
+	}
+	return mf, useOverlay, nil
+}
+
+// mountDevice returns the device name of the mount m. The device names of
+// bind mounts identify their gofer connections when the sandbox is restored,
+// so they must be unique.
+func mountDevice(m specs.Mount) string {
+	if m.Type == "bind" {
+		return "9pfs-" + m.Destination
+	}
+	return m.Type
+}
+
+// createRestoreEnvironment returns the environment in which the mounts of the
+// container with the given ID are restored. The gofer mounts are connected to
+// ioFDs in the same order as createMountNamespace, and with the same device
+// names and flags. Other filesystems are saved with the sandbox.
+func createRestoreEnvironment(cid string, spec *specs.Spec, conf *Config, ioFDs []int) (*fs.RestoreEnvironment, error) {
+	if conf.FileAccess != FileAccessProxy {
+		return nil, fmt.Errorf("only sandboxes with --file-access=%v can be restored", FileAccessProxy)
+	}
+	fds := &fdDispenser{fds: ioFDs, channels: conf.MountFDs()}
+	mf, _, err := rootMountFlags(spec)
+	if err != nil {
+		return nil, err
+	}
+	mounts := []fs.MountArgs{{
+		Dev:   "root",
+		Flags: mf,
+		Data:  strings.Join(p9MountOptions(cid, spec, fds), ","),
+	}}
+	for _, m := range spec.Mounts {
+		// Mounts under /dev are ignored by configureMounts.
+		if strings.HasPrefix(m.Destination, "/dev") || m.Type != "bind" {
+			continue
+		}
+		mf, _, err := submountFlags(spec, conf, m)
+		if err != nil {
+			return nil, err
+		}
+		mounts = append(mounts, fs.MountArgs{
+			Dev:   mountDevice(m),
+			Flags: mf,
+			Data:  strings.Join(p9MountOptions(cid, spec, fds), ","),
+		})
+	}
+	if !fds.empty() {
+		return nil, fmt.Errorf("not all mount points were consumed, remaining: %v", fds)
+	}
+	rebindDevs, err := restoreRebindDevs(spec, conf)
+	if err != nil {
+		return nil, err
+	}
+	return &fs.RestoreEnvironment{
+		MountSources:          map[string][]fs.MountArgs{"9p": mounts},
+		RebindDevs:            rebindDevs,
+		ValidateFileSize:      true,
+		ValidateFileTimestamp: true,
+	}, nil
+}
+
+// restoreRebindDevs returns the device names of the gofer mounts that are
+// restored from other mounts of spec, as given by conf.RestoreRebind.
+func restoreRebindDevs(spec *specs.Spec, conf *Config) (map[string]string, error) {
+	if len(conf.RestoreRebind) == 0 {
+		return nil, nil
+	}
+	devs := make(map[string]string)
+	for saved, dest := range conf.RestoreRebind {
+		if saved == "/" || dest == "/" {
+			return nil, fmt.Errorf("the root mount can't be rebound")
+		}
+		var found *specs.Mount
+		for i, m := range spec.Mounts {
+			if m.Destination == dest && m.Type == "bind" && !strings.HasPrefix(m.Destination, "/dev") {
+				found = &spec.Mounts[i]
+			}
+		}
+		if found == nil {
+			return nil, fmt.Errorf("mount %q is rebound to %q, which isn't a bind mount of the spec", saved, dest)
+		}
+		devs[mountDevice(specs.Mount{Type: "bind", Destination: saved})] = mountDevice(*found)
+	}
+	return devs, nil
+}
+
+// receiveMountFD receives the FD of the root of a mount, donated by the gofer
+// over the socket ioFD. ioFD is left open, so that the gofer exits with the
+// sandbox.
+func receiveMountFD(ioFD int) (int, error) {
+	socket, err := unet.NewSocket(ioFD)
+	if err != nil {
+		return -1, err
+	}
+	defer socket.Release()
+
+	r := socket.Reader(true /* blocking */)
+	r.EnableFDs(1)
+	if _, err := r.ReadVec([][]byte{make([]byte, 1)}); err != nil {
+		return -1, err
+	}
+	fds, err := r.ExtractFDs()
+	if err != nil {
+		return -1, err
+	}
+	if len(fds) != 1 {
+		for _, fd := range fds {
+			syscall.Close(fd)
+		}
+		return -1, fmt.Errorf("got %d FDs, want 1", len(fds))
+	}
+	return fds[0], nil
+}
+
+// p9MountOptions returns the 9p mount options of the next mount of the
+// container with the given ID, which connects to the gofer over FDs taken
+// from fds.
+func p9MountOptions(cid string, spec *specs.Spec, fds *fdDispenser) []string {
+	data := append(p9ChannelOptions(fds.remove()), "privateunixsocket=true")
+	return append(data, p9IOMaxOptions(cid, spec)...)
+}
+
+// p9ChannelOptions returns the 9p mount options that connect to the gofer over
+// the channels ioFDs, the first of which is the main one.
+func p9ChannelOptions(ioFDs []int) []string {
+	opts := []string{"trans=fd", fmt.Sprintf("rfdno=%d", ioFDs[0]), fmt.Sprintf("wfdno=%d", ioFDs[0])}
+	if len(ioFDs) > 1 {
+		var fds []string
+		for _, fd := range ioFDs[1:] {
+			fds = append(fds, strconv.Itoa(fd))
+		}
+		opts = append(opts, "channelfds="+strings.Join(fds, ":"))
+	}
+	return opts
+}
+
+// p9IOMaxOptions returns 9p mount options that limit the rate of file I/O to
+// the blkio throttles in the spec. All file I/O of the sandbox goes to gofers
+// rather than to host block devices, so device numbers are ignored and the
+// lowest limit of each kind applies. The limits are a budget shared by all
+// mounts of the container with the given ID.
+func p9IOMaxOptions(cid string, spec *specs.Spec) []string {
+	if spec.Linux == nil || spec.Linux.Resources == nil || spec.Linux.Resources.BlockIO == nil {
+		return nil
+	}
+	bio := spec.Linux.Resources.BlockIO
+	var opts []string
+	for _, t := range []struct {
+		key  string
+		devs []specs.LinuxThrottleDevice
+	}{
+		{"io_max_rbps", bio.ThrottleReadBpsDevice},
+		{"io_max_wbps", bio.ThrottleWriteBpsDevice},
+		{"io_max_riops", bio.ThrottleReadIOPSDevice},
+		{"io_max_wiops", bio.ThrottleWriteIOPSDevice},
+	} {
+		var rate uint64
+		for _, d := range t.devs {
+			if d.Rate != 0 && (rate == 0 || d.Rate < rate) {
+				rate = d.Rate
+			}
+		}
+		if rate != 0 {
+			opts = append(opts, fmt.Sprintf("%s=%d", t.key, rate))
+		}
+	}
+	if len(opts) > 0 {
+		opts = append(opts, "io_group="+cid)
+	}
+	return opts
+}
+
 func mkdirAll(ctx context.Context, mns *fs.MountNamespace, path string) error {
 	root := mns.Root()
 	defer root.DecRef()
@@ -395,6 +658,33 @@ func destinations(mounts []specs.Mount, extra ...string) []string {
 	return append(ds, extra...)
 }
 
+// auditWritesAnnotation is the spec annotation that lists the destinations of
+// mounts that are made read-only and report every write attempt on the
+// eventchannel. "/" refers to the root filesystem. Its value is a JSON array,
+// for example:
+//
+//	["/", "/etc"]
+const auditWritesAnnotation = "dev.gvisor.audit-writes"
+
+// auditWrites returns true if the spec requests that writes to the mount at
+// dest be audited.
+func auditWrites(spec *specs.Spec, dest string) (bool, error) {
+	val, ok := spec.Annotations[auditWritesAnnotation]
+	if !ok {
+		return false, nil
+	}
+	var dests []string
+	if err := json.Unmarshal([]byte(val), &dests); err != nil {
+		return false, fmt.Errorf("invalid %s annotation: %v", auditWritesAnnotation, err)
+	}
+	for _, d := range dests {
+		if filepath.Clean(d) == filepath.Clean(dest) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 func mountFlags(opts []string) fs.MountSourceFlags {
 	mf := fs.MountSourceFlags{}
 	for _, o := range opts {
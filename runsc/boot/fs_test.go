@@ -0,0 +1,121 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"reflect"
+	"testing"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
+)
+
+// TestCreateRestoreEnvironment checks that the gofer mounts of a restored
+// container are connected to the gofer FDs in order, with the device names
+// they were mounted with.
+func TestCreateRestoreEnvironment(t *testing.T) {
+	spec := testSpec()
+	spec.Mounts = []specs.Mount{
+		{Destination: "/data", Type: "bind", Source: "/src/data"},
+		{Destination: "/tmp", Type: "tmpfs"},
+		{Destination: "/dev/foo", Type: "bind", Source: "/dev/foo"},
+		{Destination: "/config", Type: "bind", Source: "/src/config", Options: []string{"ro"}},
+	}
+	conf := &Config{FileAccess: FileAccessProxy}
+
+	env, err := createRestoreEnvironment("foo", spec, conf, []int{3, 4, 5})
+	if err != nil {
+		t.Fatalf("createRestoreEnvironment failed: %v", err)
+	}
+	want := map[string][]fs.MountArgs{
+		"9p": {
+			{
+				Dev:   "root",
+				Flags: fs.MountSourceFlags{ReadOnly: true},
+				Data:  "trans=fd,rfdno=3,wfdno=3,privateunixsocket=true",
+			},
+			{
+				Dev:  "9pfs-/data",
+				Data: "trans=fd,rfdno=4,wfdno=4,privateunixsocket=true",
+			},
+			{
+				Dev:   "9pfs-/config",
+				Flags: fs.MountSourceFlags{ReadOnly: true},
+				Data:  "trans=fd,rfdno=5,wfdno=5,privateunixsocket=true",
+			},
+		},
+	}
+	if !reflect.DeepEqual(env.MountSources, want) {
+		t.Errorf("MountSources got %+v, want %+v", env.MountSources, want)
+	}
+	if !env.ValidateFileSize || !env.ValidateFileTimestamp {
+		t.Errorf("restore environment doesn't validate files: %+v", env)
+	}
+	if env.RebindDevs != nil {
+		t.Errorf("RebindDevs got %v, want none", env.RebindDevs)
+	}
+
+	// The mount saved at /olddata is restored from the mount at /data.
+	conf.RestoreRebind = map[string]string{"/olddata": "/data"}
+	env, err = createRestoreEnvironment("foo", spec, conf, []int{3, 4, 5})
+	if err != nil {
+		t.Fatalf("createRestoreEnvironment with rebind failed: %v", err)
+	}
+	wantRebind := map[string]string{"9pfs-/olddata": "9pfs-/data"}
+	if !reflect.DeepEqual(env.RebindDevs, wantRebind) {
+		t.Errorf("RebindDevs got %v, want %v", env.RebindDevs, wantRebind)
+	}
+	args, rebound, ok := env.FindMount("9p", "9pfs-/olddata")
+	if !ok || !rebound || args.Data != want["9p"][1].Data {
+		t.Errorf("FindMount(9pfs-/olddata) got (%+v, %t, %t), want the mount of /data", args, rebound, ok)
+	}
+}
+
+func TestCreateRestoreEnvironmentErrors(t *testing.T) {
+	spec := testSpec()
+	spec.Mounts = []specs.Mount{
+		{Destination: "/data", Type: "bind", Source: "/src/data"},
+	}
+	for _, tc := range []struct {
+		name  string
+		conf  *Config
+		ioFDs []int
+	}{
+		{
+			name:  "direct file access",
+			conf:  &Config{FileAccess: FileAccessDirect},
+			ioFDs: []int{3, 4},
+		},
+		{
+			name:  "extra FDs",
+			conf:  &Config{FileAccess: FileAccessProxy},
+			ioFDs: []int{3, 4, 5},
+		},
+		{
+			name:  "rebind to missing mount",
+			conf:  &Config{FileAccess: FileAccessProxy, RestoreRebind: map[string]string{"/olddata": "/other"}},
+			ioFDs: []int{3, 4},
+		},
+		{
+			name:  "rebind root",
+			conf:  &Config{FileAccess: FileAccessProxy, RestoreRebind: map[string]string{"/": "/data"}},
+			ioFDs: []int{3, 4},
+		},
+	} {
+		if _, err := createRestoreEnvironment("foo", spec, tc.conf, tc.ioFDs); err == nil {
+			t.Errorf("%s: createRestoreEnvironment succeeded, want error", tc.name)
+		}
+	}
+}
@@ -58,3 +58,16 @@ func createLimitSet(spec *specs.Spec) (*limits.LimitSet, error) {
 	}
 	return ls, nil
 }
+
+// pidsLimit returns the maximum number of tasks permitted in the container by
+// the pids cgroup settings in spec, or 0 if the number is unlimited.
+func pidsLimit(spec *specs.Spec) uint64 {
+	if spec.Linux == nil || spec.Linux.Resources == nil || spec.Linux.Resources.Pids == nil {
+		return 0
+	}
+	// Per the runtime spec, a limit of 0 or -1 means unlimited.
+	if l := spec.Linux.Resources.Pids.Limit; l > 0 {
+		return uint64(l)
+	}
+	return 0
+}
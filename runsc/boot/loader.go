@@ -18,14 +18,17 @@ package boot
 import (
 	"fmt"
 	"math/rand"
+	"os"
 	"sync/atomic"
 	"syscall"
 	gtime "time"
 
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/bpf"
 	"gvisor.googlesource.com/gvisor/pkg/cpuid"
 	"gvisor.googlesource.com/gvisor/pkg/log"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/inet"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel/auth"
@@ -36,8 +39,10 @@ import (
 	"gvisor.googlesource.com/gvisor/pkg/sentry/sighandling"
 	slinux "gvisor.googlesource.com/gvisor/pkg/sentry/syscalls/linux"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/time"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usage"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/watchdog"
 	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/link/qdisc"
 	"gvisor.googlesource.com/gvisor/pkg/tcpip/link/sniffer"
 	"gvisor.googlesource.com/gvisor/pkg/tcpip/network/arp"
 	"gvisor.googlesource.com/gvisor/pkg/tcpip/network/ipv4"
@@ -53,7 +58,10 @@ import (
 	"gvisor.googlesource.com/gvisor/pkg/sentry/socket/epsocket"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/socket/hostinet"
 	_ "gvisor.googlesource.com/gvisor/pkg/sentry/socket/netlink"
+	_ "gvisor.googlesource.com/gvisor/pkg/sentry/socket/netlink/genetlink"
 	_ "gvisor.googlesource.com/gvisor/pkg/sentry/socket/netlink/route"
+	_ "gvisor.googlesource.com/gvisor/pkg/sentry/socket/netlink/taskstats"
+	_ "gvisor.googlesource.com/gvisor/pkg/sentry/socket/netlink/uevent"
 	_ "gvisor.googlesource.com/gvisor/pkg/sentry/socket/unix"
 )
 
@@ -78,6 +86,23 @@ type Loader struct {
 
 	// procArgs refers to the root container task.
 	procArgs kernel.CreateProcessArgs
+
+	// resources records the resource usage of the sandbox for
+	// WriteResourceReport. It is nil if Config.ResourceReport is empty.
+	resources *resourceRecorder
+
+	// timeLimit enforces the time limits of the sandbox. It is nil until
+	// StartTimeLimit is called, and if no limit is set.
+	timeLimit *timeLimiter
+
+	// restoreFile is the checkpoint image that the sandbox is restored
+	// from by Run, instead of starting the container's process. It is nil
+	// if the sandbox is not restored.
+	restoreFile *os.File
+
+	// restoreEnv is the environment in which the mounts of the restored
+	// container are restored. It is nil if restoreFile is nil.
+	restoreEnv *fs.RestoreEnvironment
 }
 
 func init() {
@@ -88,8 +113,10 @@ func init() {
 	kernel.RegisterSyscallTable(slinux.AMD64)
 }
 
-// New initializes a new kernel loader configured by spec.
-func New(spec *specs.Spec, conf *Config, controllerFD int, ioFDs []int, console bool) (*Loader, error) {
+// New initializes a new kernel loader configured by spec, for the root
+// container with the given ID. If restoreFD is not -1, the sandbox is restored
+// from the checkpoint image in restoreFD when it runs.
+func New(id string, spec *specs.Spec, conf *Config, controllerFD, restoreFD int, ioFDs, deviceFDs, bridgeFDs []int, console bool) (*Loader, error) {
 	// Create kernel and platform.
 	p, err := createPlatform(conf)
 	if err != nil {
@@ -112,7 +139,19 @@ func New(spec *specs.Spec, conf *Config, controllerFD int, ioFDs []int, console
 	if err != nil {
 		return nil, fmt.Errorf("error creating timekeeper: %v", err)
 	}
-	tk.SetClocks(time.NewCalibratedClocks())
+	updateInterval := conf.VDSOUpdateInterval
+	if updateInterval == 0 {
+		updateInterval = time.DefaultUpdateInterval
+	}
+	if !vdsoClockEnabled(conf, p) {
+		tk.DisableVDSO()
+	}
+	tk.SetClocks(time.NewCalibratedClocks(updateInterval))
+	taiOffset, err := getTAIOffset(conf)
+	if err != nil {
+		return nil, fmt.Errorf("error getting TAI offset: %v", err)
+	}
+	tk.SetTAIOffset(taiOffset)
 
 	// Create initial limits.
 	ls, err := createLimitSet(spec)
@@ -150,6 +189,9 @@ func New(spec *specs.Spec, conf *Config, controllerFD int, ioFDs []int, console
 	if err := enableStrace(conf); err != nil {
 		return nil, fmt.Errorf("failed to enable strace: %v", err)
 	}
+	if conf.SyscallLatency {
+		kernel.EnableSyscallLatency(conf.SlowSyscallThreshold)
+	}
 
 	// Get the executable path, which is a bit tricky because we have to
 	// inspect the environment PATH which is relative to the root path.
@@ -175,9 +217,20 @@ func New(spec *specs.Spec, conf *Config, controllerFD int, ioFDs []int, console
 		Vdso:              vdso,
 		RootUTSNamespace:  utsns,
 		RootIPCNamespace:  ipcns,
+		MaxTasks:          conf.MaxTasks,
+		PropagateNiceness: conf.HostNiceness,
+		TimeSlice:         conf.TimeSlice,
+		ProcessLogSize:    int(conf.ProcessLogSize),
 	}); err != nil {
 		return nil, fmt.Errorf("error initializing kernel: %v", err)
 	}
+	k.SetCorePattern(conf.CorePattern)
+
+	// Report the memory limit of the container, if any, as the total
+	// memory. It may be changed later with "runsc update".
+	if r := spec.Linux; r != nil && r.Resources != nil && r.Resources.Memory != nil && r.Resources.Memory.Limit != nil && *r.Resources.Memory.Limit > 0 {
+		usage.SetMemoryLimit(uint64(*r.Resources.Memory.Limit))
+	}
 
 	// Turn on packet logging if enabled.
 	if conf.LogPackets {
@@ -189,7 +242,7 @@ func New(spec *specs.Spec, conf *Config, controllerFD int, ioFDs []int, console
 	}
 
 	// Create a watchdog.
-	watchdog := watchdog.New(k, watchdog.DefaultTimeout, watchdog.LogWarning)
+	watchdog := watchdog.New(k, conf.WatchdogTimeout, conf.WatchdogAction.watchdogAction())
 
 	// Create the control server using the provided FD.
 	//
@@ -200,11 +253,47 @@ func New(spec *specs.Spec, conf *Config, controllerFD int, ioFDs []int, console
 	// misconfigured process will cause an error, and we want the control
 	// server up before that so that we don't time out trying to connect to
 	// it.
-	ctrl, err := newController(controllerFD, k, watchdog)
+	ctrl, err := newController(controllerFD, id, k, watchdog, conf)
 	if err != nil {
 		return nil, fmt.Errorf("error creating control server: %v", err)
 	}
 
+	whitelist, err := syscallWhitelist(spec)
+	if err != nil {
+		return nil, err
+	}
+	origins, err := syscallOriginPolicy(spec)
+	if err != nil {
+		return nil, err
+	}
+	execs, err := execPolicy(spec)
+	if err != nil {
+		return nil, err
+	}
+	redaction, err := redactionPolicy(spec)
+	if err != nil {
+		return nil, err
+	}
+	var filters []bpf.Program
+	if conf.IgnoreOCISeccomp {
+		if spec.Linux != nil && spec.Linux.Seccomp != nil {
+			log.Warningf("Ignoring the seccomp profile in the spec")
+		}
+	} else {
+		filters, err = seccompFilters(spec)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// The root container's abstract sockets are bridged with the host.
+	abstractSockets := kernel.NewAbstractSocketNamespace()
+	if restoreFD == -1 {
+		if err := startAbstractBridges(abstractSockets, conf.AbstractBridges, bridgeFDs); err != nil {
+			return nil, fmt.Errorf("error bridging abstract sockets: %v", err)
+		}
+	}
+
 	// Create the process arguments.
 	procArgs := kernel.CreateProcessArgs{
 		Filename:         exec,
@@ -214,11 +303,18 @@ func New(spec *specs.Spec, conf *Config, controllerFD int, ioFDs []int, console
 		Credentials:      creds,
 		// Creating the FDMap requires that we have kernel.Kernel.fdMapUids, so
 		// it must wait until we have a Kernel.
-		Umask:                uint(syscall.Umask(0)),
-		Limits:               ls,
-		MaxSymlinkTraversals: linux.MaxSymlinkTraversals,
-		UTSNamespace:         utsns,
-		IPCNamespace:         ipcns,
+		Umask:                   uint(syscall.Umask(0)),
+		Limits:                  ls,
+		MaxSymlinkTraversals:    linux.MaxSymlinkTraversals,
+		UTSNamespace:            utsns,
+		IPCNamespace:            ipcns,
+		AbstractSocketNamespace: abstractSockets,
+		PIDsController:          kernel.NewPIDsController(k.RootPIDsController(), pidsLimit(spec)),
+		SyscallWhitelist:        whitelist,
+		SyscallOrigins:          origins,
+		ExecPolicy:              execs,
+		Redaction:               redaction,
+		SyscallFilters:          filters,
 	}
 	ctx := procArgs.NewContext(k)
 
@@ -232,23 +328,47 @@ func New(spec *specs.Spec, conf *Config, controllerFD int, ioFDs []int, console
 	}
 	rootCtx := rootProcArgs.NewContext(k)
 
-	// Create the virtual filesystem.
-	mns, err := createMountNamespace(ctx, rootCtx, spec, conf, ioFDs)
-	if err != nil {
-		return nil, fmt.Errorf("error creating mounts: %v", err)
-	}
-	k.SetRootMountNamespace(mns)
+	// A restored sandbox gets its filesystems and files from the checkpoint
+	// image, except for the gofer mounts, which are reconnected to ioFDs.
+	var restoreFile *os.File
+	var restoreEnv *fs.RestoreEnvironment
+	if restoreFD != -1 {
+		if len(conf.DeviceProxy) > 0 || len(conf.AbstractBridges) > 0 {
+			return nil, fmt.Errorf("sandboxes with proxied devices or abstract socket bridges can't be restored")
+		}
+		restoreFile = os.NewFile(uintptr(restoreFD), "restore file")
+		restoreEnv, err = createRestoreEnvironment(id, spec, conf, ioFDs)
+		if err != nil {
+			return nil, fmt.Errorf("error creating restore environment: %v", err)
+		}
+	} else {
+		// Create the virtual filesystem.
+		mns, err := createMountNamespace(ctx, rootCtx, id, spec, conf, ioFDs)
+		if err != nil {
+			return nil, fmt.Errorf("error creating mounts: %v", err)
+		}
+		if err := addProxiedDevices(rootCtx, mns, conf, deviceFDs); err != nil {
+			return nil, fmt.Errorf("error adding proxied devices: %v", err)
+		}
+		k.SetRootMountNamespace(mns)
 
-	// Create the FD map, which will set stdin, stdout, and stderr.  If console
-	// is true, then ioctl calls will be passed through to the host fd.
-	fdm, err := createFDMap(ctx, k, ls, console)
-	if err != nil {
-		return nil, fmt.Errorf("error importing fds: %v", err)
-	}
+		// Create the FD map, which will set stdin, stdout, and stderr.  If console
+		// is true, then ioctl calls will be passed through to the host fd.
+		fdm, err := createFDMap(ctx, k, ls, console)
+		if err != nil {
+			return nil, fmt.Errorf("error importing fds: %v", err)
+		}
+		if len(conf.ActivationSockets) > 0 {
+			procArgs.Envv, err = addActivationSockets(ctx, k, fdm, ls, conf.ActivationSockets, procArgs.Envv)
+			if err != nil {
+				return nil, fmt.Errorf("error creating activation sockets: %v", err)
+			}
+		}
 
-	// CreateProcess takes a reference on FDMap if successful. We
-	// won't need ours either way.
-	procArgs.FDMap = fdm
+		// CreateProcess takes a reference on FDMap if successful. We
+		// won't need ours either way.
+		procArgs.FDMap = fdm
+	}
 
 	// We don't care about child signals; some platforms can generate a
 	// tremendous number of useless ones (I'm looking at you, ptrace).
@@ -259,6 +379,11 @@ func New(spec *specs.Spec, conf *Config, controllerFD int, ioFDs []int, console
 	// the emulated kernel.
 	stopSignalForwarding := sighandling.StartForwarding(k)
 
+	var resources *resourceRecorder
+	if conf.ResourceReport != "" {
+		resources = newResourceRecorder(k)
+	}
+
 	return &Loader{
 		k:                    k,
 		ctrl:                 ctrl,
@@ -267,6 +392,9 @@ func New(spec *specs.Spec, conf *Config, controllerFD int, ioFDs []int, console
 		watchdog:             watchdog,
 		stopSignalForwarding: stopSignalForwarding,
 		procArgs:             procArgs,
+		resources:            resources,
+		restoreFile:          restoreFile,
+		restoreEnv:           restoreEnv,
 	}, nil
 }
 
@@ -278,6 +406,12 @@ func (l *Loader) Destroy() {
 	}
 	l.stopSignalForwarding()
 	l.watchdog.Stop()
+	if l.resources != nil {
+		l.resources.Stop()
+	}
+	if l.timeLimit != nil {
+		l.timeLimit.Stop()
+	}
 }
 
 func createPlatform(conf *Config) (platform.Platform, error) {
@@ -293,6 +427,48 @@ func createPlatform(conf *Config) (platform.Platform, error) {
 	}
 }
 
+// vdsoClockEnabled returns true if the VDSO may read time itself on p, rather
+// than falling back to syscalls.
+func vdsoClockEnabled(conf *Config, p platform.Platform) bool {
+	k, ok := p.(*kvm.KVM)
+	if !ok {
+		// The VDSO reads the host TSC directly.
+		return true
+	}
+	switch conf.KVMClock {
+	case KVMClockTSC:
+		if !k.ReliableTSC() {
+			log.Warningf("KVM clock: TSC is not reliable, time read by the VDSO may differ from time read by syscalls")
+		}
+		return true
+	case KVMClockSentry:
+		return false
+	default:
+		if !k.ReliableTSC() {
+			log.Warningf("KVM clock: TSC is not reliable, falling back to time served by the sentry; the VDSO makes syscalls to read time")
+			return false
+		}
+		log.Infof("KVM clock: TSC is reliable, the VDSO reads time itself")
+		return true
+	}
+}
+
+// getTAIOffset returns the offset of CLOCK_TAI from CLOCK_REALTIME in the
+// sandbox, in seconds.
+func getTAIOffset(conf *Config) (int32, error) {
+	if conf.TAIOffset >= 0 {
+		return conf.TAIOffset, nil
+	}
+	// Use the offset of the host, which adjtimex(2) reports to
+	// unprivileged callers when no mode bits are set.
+	var tx syscall.Timex
+	if _, err := syscall.Adjtimex(&tx); err != nil {
+		return 0, err
+	}
+	log.Infof("Host TAI offset: %ds", tx.Tai)
+	return tx.Tai, nil
+}
+
 // Run runs the root container..
 func (l *Loader) Run() error {
 	err := l.run()
@@ -319,25 +495,47 @@ func (l *Loader) run() error {
 		}
 	}
 
+	if l.conf.DNSResolver != nil {
+		// The sandbox network has been configured, so the upstreams are
+		// reachable.
+		s, ok := l.k.NetworkStack().(*epsocket.Stack)
+		if !ok {
+			return fmt.Errorf("DNS resolver requires a sandbox network stack")
+		}
+		if err := startDNSResolver(s, l.conf); err != nil {
+			return err
+		}
+	}
+
 	// Finally done with all configuration. Setup filters before user code
 	// is loaded.
 	if l.conf.DisableSeccomp {
 		filter.Report("syscall filter is DISABLED. Running in less secure mode.")
 	} else {
 		whitelistFS := l.conf.FileAccess == FileAccessDirect
+		donatedFS := l.conf.FileAccess == FileAccessDonated
 		hostNet := l.conf.Network == NetworkHost
-		if err := filter.Install(l.k.Platform, whitelistFS, l.console, hostNet); err != nil {
+		deviceProxy := len(l.conf.DeviceProxy) > 0
+		if err := filter.Install(l.k.Platform, whitelistFS, donatedFS, l.console, hostNet, l.conf.HostNiceness, deviceProxy); err != nil {
 			return fmt.Errorf("Failed to install seccomp filters: %v", err)
 		}
 	}
 
-	// Create the root container init task.
-	if _, err := l.k.CreateProcess(l.procArgs); err != nil {
-		return fmt.Errorf("failed to create init process: %v", err)
-	}
+	if l.restoreFile != nil {
+		// The restored kernel already contains the container's
+		// processes.
+		if err := l.restore(); err != nil {
+			return fmt.Errorf("failed to restore: %v", err)
+		}
+	} else {
+		// Create the root container init task.
+		if _, err := l.k.CreateProcess(l.procArgs); err != nil {
+			return fmt.Errorf("failed to create init process: %v", err)
+		}
 
-	// CreateProcess takes a reference on FDMap if successful.
-	l.procArgs.FDMap.DecRef()
+		// CreateProcess takes a reference on FDMap if successful.
+		l.procArgs.FDMap.DecRef()
+	}
 
 	l.watchdog.Start()
 	return l.k.Start()
@@ -361,11 +559,18 @@ func newEmptyNetworkStack(conf *Config, clock tcpip.Clock) inet.Stack {
 	case NetworkHost:
 		return hostinet.NewStack()
 
-	case NetworkNone, NetworkSandbox:
+	case NetworkNone, NetworkSandbox, NetworkNAT:
 		// NetworkNone sets up loopback using netstack.
 		netProtos := []string{ipv4.ProtocolName, ipv6.ProtocolName, arp.ProtocolName}
 		protoNames := []string{tcp.ProtocolName, udp.ProtocolName, ping.ProtocolName4}
-		return &epsocket.Stack{stack.New(clock, netProtos, protoNames)}
+		s := &epsocket.Stack{
+			Stack:  stack.New(clock, netProtos, protoNames),
+			Qdiscs: make(map[int32]*qdisc.Endpoint),
+		}
+		if conf.TCPRedirectPort != 0 {
+			setTCPRedirect(s, conf)
+		}
+		return s
 
 	default:
 		panic(fmt.Sprintf("invalid network configuration: %v", conf.Network))
@@ -56,7 +56,7 @@ func createLoader() (*Loader, error) {
 		FileAccess:     FileAccessDirect,
 		DisableSeccomp: true,
 	}
-	return New(testSpec(), conf, fd, nil, false)
+	return New("foo", testSpec(), conf, fd, -1, nil, nil, nil, false)
 }
 
 // TestRun runs a simple application in a sandbox and checks that it succeeds.
@@ -257,7 +257,7 @@ func TestCreateMountNamespace(t *testing.T) {
 
 	for _, tc := range testCases {
 		ctx := contexttest.Context(t)
-		mm, err := createMountNamespace(ctx, ctx, &tc.spec, conf, nil)
+		mm, err := createMountNamespace(ctx, ctx, "foo", &tc.spec, conf, nil)
 		if err != nil {
 			t.Fatalf("createMountNamespace test case %q failed: %v", tc.name, err)
 		}
@@ -0,0 +1,57 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"fmt"
+	"net/http"
+
+	"gvisor.googlesource.com/gvisor/pkg/log"
+	"gvisor.googlesource.com/gvisor/pkg/metadata"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/adapters/gonet"
+)
+
+// metadataPort is the port that the metadata service listens on.
+const metadataPort = 80
+
+// StartMetadataServer starts a metadata service that serves c over HTTP on
+// port 80 of its address, which is added to the loopback interface, so it is
+// reachable from the sandbox but not from the outside. It must be called
+// after CreateLinksAndRoutes.
+func (n *Network) StartMetadataServer(c *metadata.Config, _ *struct{}) error {
+	h, err := metadata.New(c)
+	if err != nil {
+		return fmt.Errorf("invalid metadata config: %v", err)
+	}
+	ip, err := c.IP()
+	if err != nil {
+		return err
+	}
+	proto, addr := ipToAddressAndProto(ip)
+	if err := addLoopbackAddress(n.Stack, proto, addr); err != nil {
+		return err
+	}
+	l, err := gonet.NewListener(n.Stack, tcpip.FullAddress{Addr: addr, Port: metadataPort}, proto)
+	if err != nil {
+		return fmt.Errorf("failed to listen on TCP port %d: %v", metadataPort, err)
+	}
+	go func() {
+		err := http.Serve(l, h)
+		log.Warningf("Metadata service stopped serving: %v", err)
+	}()
+	log.Infof("Serving metadata on %v with %d entries", ip, len(c.Entries))
+	return nil
+}
@@ -0,0 +1,78 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/metadata"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/socket/epsocket"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/adapters/gonet"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/network/ipv4"
+)
+
+func TestMetadataServer(t *testing.T) {
+	s := newEmptyNetworkStack(&Config{Network: NetworkNone}, &tcpip.StdClock{}).(*epsocket.Stack)
+	n := &Network{Stack: s.Stack}
+	args := &CreateLinksAndRoutesArgs{
+		LoopbackLinks: []LoopbackLink{{
+			Name:      "lo",
+			Addresses: []net.IP{net.IPv4(127, 0, 0, 1)},
+			Routes: []Route{{
+				Destination: net.IPv4(127, 0, 0, 0),
+				Mask:        net.IPv4Mask(255, 0, 0, 0),
+			}},
+		}},
+	}
+	if err := n.CreateLinksAndRoutes(args, nil); err != nil {
+		t.Fatalf("CreateLinksAndRoutes failed: %v", err)
+	}
+	c := &metadata.Config{
+		Entries: []metadata.Entry{{Path: "/latest/meta-data/instance-id", Body: "i-42"}},
+	}
+	if err := n.StartMetadataServer(c, nil); err != nil {
+		t.Fatalf("StartMetadataServer failed: %v", err)
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			Dial: func(_, addr string) (net.Conn, error) {
+				tcpAddr, err := net.ResolveTCPAddr("tcp", addr)
+				if err != nil {
+					return nil, err
+				}
+				return gonet.DialTCP(s.Stack, tcpip.FullAddress{Addr: tcpip.Address(tcpAddr.IP.To4()), Port: uint16(tcpAddr.Port)}, ipv4.ProtocolNumber)
+			},
+		},
+		Timeout: 10 * time.Second,
+	}
+	resp, err := client.Get("http://169.254.169.254/latest/meta-data/instance-id")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("error reading response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || string(body) != "i-42" {
+		t.Errorf("got %q with body %q, want %q", resp.Status, body, "i-42")
+	}
+}
@@ -18,12 +18,18 @@ import (
 	"fmt"
 	"math/rand"
 	"net"
+	"strings"
 	"syscall"
 
 	"gvisor.googlesource.com/gvisor/pkg/log"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/socket/epsocket"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/socket/hostinet"
 	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/link/egress"
 	"gvisor.googlesource.com/gvisor/pkg/tcpip/link/fdbased"
 	"gvisor.googlesource.com/gvisor/pkg/tcpip/link/loopback"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/link/qdisc"
 	"gvisor.googlesource.com/gvisor/pkg/tcpip/link/sniffer"
 	"gvisor.googlesource.com/gvisor/pkg/tcpip/network/arp"
 	"gvisor.googlesource.com/gvisor/pkg/tcpip/network/ipv4"
@@ -35,6 +41,23 @@ import (
 // Network exposes methods that can be used to configure a network stack.
 type Network struct {
 	Stack *stack.Stack
+
+	// Qdiscs receives the queueing disciplines of the FDBasedLinks, by NIC
+	// ID, so that tc can shape their outbound traffic.
+	Qdiscs map[int32]*qdisc.Endpoint
+}
+
+// HostNetwork exposes methods that can be used to configure the host network
+// stack.
+type HostNetwork struct {
+	Stack *hostinet.Stack
+}
+
+// SetPolicy restricts the addresses that sockets of the host network can be
+// connected and bound to. It must be called before the container starts.
+func (n *HostNetwork) SetPolicy(p *hostinet.Policy, _ *struct{}) error {
+	log.Infof("Setting host network socket policy: %+v", p)
+	return n.Stack.SetPolicy(p)
 }
 
 // Route represents a route in the network stack.
@@ -56,6 +79,10 @@ type FDBasedLink struct {
 	MTU       int
 	Addresses []net.IP
 	Routes    []Route
+
+	// RawIP indicates that the link carries IP packets without an
+	// ethernet header.
+	RawIP bool
 }
 
 // LoopbackLink configures a loopback li nk.
@@ -75,6 +102,9 @@ type CreateLinksAndRoutesArgs struct {
 	FDBasedLinks  []FDBasedLink
 
 	DefaultGateway DefaultRoute
+
+	// EgressPolicy is the egress policy of the FDBasedLinks, if not nil.
+	EgressPolicy *egress.Policy
 }
 
 // Empty returns true if route hasn't been set.
@@ -109,7 +139,7 @@ func (n *Network) CreateLinksAndRoutes(args *CreateLinksAndRoutesArgs, _ *struct
 		nicID++
 		nicids[link.Name] = nicID
 
-		linkEP := loopback.New()
+		linkEP := sniffer.New(loopback.New())
 
 		log.Infof("Enabling loopback interface %q with id %d on addresses %+v", link.Name, nicID, link.Addresses)
 		if err := n.createNICWithAddrs(nicID, link.Name, linkEP, link.Addresses); err != nil {
@@ -133,13 +163,29 @@ func (n *Network) CreateLinksAndRoutes(args *CreateLinksAndRoutesArgs, _ *struct
 			return fmt.Errorf("failed to dup FD %v: %v", oldFD, err)
 		}
 
-		linkEP := fdbased.New(&fdbased.Options{
+		linkEP := sniffer.New(fdbased.New(&fdbased.Options{
 			FD:              newFD,
 			MTU:             uint32(link.MTU),
 			ChecksumOffload: false,
-			EthernetHeader:  true,
+			EthernetHeader:  !link.RawIP,
 			Address:         tcpip.LinkAddress(generateRndMac()),
-		})
+		}))
+
+		// The sniffer is below the queueing discipline, so that it
+		// logs packets when they are actually sent.
+		linkEP, q := qdisc.New(linkEP)
+		if n.Qdiscs != nil {
+			n.Qdiscs[int32(nicID)] = q
+		}
+
+		if args.EgressPolicy != nil {
+			// The sniffer and queueing discipline are below the
+			// policy, so that dropped packets are never queued.
+			if linkEP, err = egress.New(linkEP, args.EgressPolicy); err != nil {
+				return err
+			}
+			log.Infof("Applying egress policy to interface %q", link.Name)
+		}
 
 		log.Infof("Enabling interface %q with id %d on addresses %+v", link.Name, nicID, link.Addresses)
 		if err := n.createNICWithAddrs(nicID, link.Name, linkEP, link.Addresses); err != nil {
@@ -168,7 +214,7 @@ func (n *Network) CreateLinksAndRoutes(args *CreateLinksAndRoutesArgs, _ *struct
 // createNICWithAddrs creates a NIC in the network stack and adds the given
 // addresses.
 func (n *Network) createNICWithAddrs(id tcpip.NICID, name string, linkEP tcpip.LinkEndpointID, addrs []net.IP) error {
-	if err := n.Stack.CreateNamedNIC(id, name, sniffer.New(linkEP)); err != nil {
+	if err := n.Stack.CreateNamedNIC(id, name, linkEP); err != nil {
 		return fmt.Errorf("CreateNamedNIC(%v, %v, %v) failed: %v", id, name, linkEP, err)
 	}
 
@@ -186,6 +232,32 @@ func (n *Network) createNICWithAddrs(id tcpip.NICID, name string, linkEP tcpip.L
 	return nil
 }
 
+// setTCPRedirect redirects the outbound TCP connections of the stack as
+// configured by conf.TCPRedirectPort. Connections to IPv4 and IPv6
+// destinations are redirected to the IPv4 and IPv6 loopback addresses,
+// respectively.
+func setTCPRedirect(s *epsocket.Stack, conf *Config) {
+	var rules []stack.RedirectRule
+	for _, loopback := range []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback} {
+		_, target := ipToAddressAndProto(loopback)
+		zero := tcpip.Address(strings.Repeat("\x00", len(target)))
+		subnet, err := tcpip.NewSubnet(zero, tcpip.AddressMask(zero))
+		if err != nil {
+			panic(fmt.Sprintf("tcpip.NewSubnet(%v, %v) failed: %v", zero, zero, err))
+		}
+		rules = append(rules, stack.RedirectRule{
+			Destination: subnet,
+			Ports:       conf.TCPRedirectPorts,
+			Target:      tcpip.FullAddress{Addr: target, Port: conf.TCPRedirectPort},
+		})
+	}
+	log.Infof("Redirecting outbound TCP connections to loopback port %d", conf.TCPRedirectPort)
+	s.Stack.SetRedirectRules(rules)
+	for _, uid := range conf.TCPRedirectExemptUIDs {
+		s.RedirectExemptUIDs = append(s.RedirectExemptUIDs, auth.KUID(uid))
+	}
+}
+
 // ipToAddressAndProto converts IP to tcpip.Address and a protocol number.
 //
 // Note: don't use 'len(ip)' to determine IP version because length is always 16.
@@ -0,0 +1,247 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/abi"
+	"gvisor.googlesource.com/gvisor/pkg/log"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/arch"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/strace"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usage"
+)
+
+// resourceSamplePeriod is the time between the samples of memory usage taken
+// for the resource report.
+const resourceSamplePeriod = time.Second
+
+// ResourceReport is the resource usage of a sandbox over its lifetime. It is
+// written as JSON when the sandbox exits if Config.ResourceReport is set, so
+// that the limits of a workload can be sized from its actual usage.
+type ResourceReport struct {
+	// DurationSeconds is the wall time from the creation of the sandbox
+	// to its exit.
+	DurationSeconds float64 `json:"durationSeconds"`
+
+	// ExitCode and ExitSignal are the exit status of the root container.
+	ExitCode   int `json:"exitCode"`
+	ExitSignal int `json:"exitSignal,omitempty"`
+
+	Memory MemoryReport `json:"memory"`
+	CPU    CPUReport    `json:"cpu"`
+	IO     IOReport     `json:"io"`
+
+	// Syscalls is the number of times each syscall was executed, by name.
+	Syscalls map[string]uint64 `json:"syscalls"`
+
+	// RecentLogs are the most recent log messages of the sandbox, if
+	// Config.LogRingSize is set.
+	RecentLogs []log.Record `json:"recentLogs,omitempty"`
+}
+
+// MemoryReport is the peak memory usage of a sandbox. Memory usage is sampled
+// every resourceSamplePeriod, so spikes shorter than that may be missed.
+type MemoryReport struct {
+	// Peak is the peak usage of each category. Categories may peak at
+	// different times, so their sum may exceed PeakTotal.
+	Peak MemoryUsage `json:"peak"`
+
+	// PeakTotal is the peak usage of all categories together.
+	PeakTotal uint64 `json:"peakTotal"`
+}
+
+// MemoryUsage is memory usage in bytes, by category. See usage.MemoryKind
+// for the meaning of the categories.
+type MemoryUsage struct {
+	System    uint64 `json:"system"`
+	Anonymous uint64 `json:"anonymous"`
+	PageCache uint64 `json:"pageCache"`
+	Tmpfs     uint64 `json:"tmpfs"`
+	Mapped    uint64 `json:"mapped"`
+	Ramdiskfs uint64 `json:"ramdiskfs"`
+}
+
+// CPUReport is the CPU time used by the tasks of a sandbox.
+type CPUReport struct {
+	// GuestSeconds is the time spent executing application code.
+	GuestSeconds float64 `json:"guestSeconds"`
+
+	// SentrySeconds is the time spent executing sentry code on behalf of
+	// the application, such as syscalls and page faults.
+	SentrySeconds float64 `json:"sentrySeconds"`
+}
+
+// IOReport is the I/O done by the tasks of a sandbox.
+type IOReport struct {
+	// ReadBytes and WriteBytes are the bytes read and written by read and
+	// write syscalls, of which there were ReadSyscalls and WriteSyscalls.
+	ReadBytes     uint64 `json:"readBytes"`
+	WriteBytes    uint64 `json:"writeBytes"`
+	ReadSyscalls  uint64 `json:"readSyscalls"`
+	WriteSyscalls uint64 `json:"writeSyscalls"`
+
+	// StorageReadBytes and StorageWriteBytes are the bytes actually read
+	// into and written from the sentry page cache.
+	StorageReadBytes  uint64 `json:"storageReadBytes"`
+	StorageWriteBytes uint64 `json:"storageWriteBytes"`
+}
+
+// resourceRecorder samples the memory usage of a sandbox, and counts its
+// syscalls, to produce a ResourceReport when it exits.
+type resourceRecorder struct {
+	k     *kernel.Kernel
+	start time.Time
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+
+	// mu protects the fields below.
+	mu        sync.Mutex
+	peak      MemoryUsage
+	peakTotal uint64
+}
+
+// newResourceRecorder enables the counting of syscalls, and starts sampling
+// the memory usage of k until Stop is called.
+func newResourceRecorder(k *kernel.Kernel) *resourceRecorder {
+	kernel.EnableSyscallCounts()
+	r := &resourceRecorder{
+		k:     k,
+		start: time.Now(),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	go r.run() // S/R-SAFE: doesn't affect the application.
+	return r
+}
+
+func (r *resourceRecorder) run() {
+	defer close(r.done)
+	ticker := time.NewTicker(resourceSamplePeriod)
+	defer ticker.Stop()
+	for {
+		r.sample()
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Stop stops sampling. It may be called more than once.
+func (r *resourceRecorder) Stop() {
+	r.stopOnce.Do(func() { close(r.stop) })
+	<-r.done
+}
+
+// sample records the current memory usage.
+func (r *resourceRecorder) sample() {
+	if err := r.k.Platform.Memory().UpdateUsage(); err != nil {
+		log.Warningf("Error updating memory usage: %v", err)
+	}
+	r.record(usage.MemoryAccounting.Copy())
+}
+
+// record updates the peak memory usage with a sample.
+func (r *resourceRecorder) record(mem usage.MemoryStats, total uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	raise(&r.peak.System, mem.System)
+	raise(&r.peak.Anonymous, mem.Anonymous)
+	raise(&r.peak.PageCache, mem.PageCache)
+	raise(&r.peak.Tmpfs, mem.Tmpfs)
+	raise(&r.peak.Mapped, mem.Mapped)
+	raise(&r.peak.Ramdiskfs, mem.Ramdiskfs)
+	raise(&r.peakTotal, total)
+}
+
+// raise sets *peak to v if v is greater.
+func raise(peak *uint64, v uint64) {
+	if v > *peak {
+		*peak = v
+	}
+}
+
+// Report stops sampling, and returns the resource usage of the sandbox, whose
+// root container exited with ws.
+func (r *resourceRecorder) Report(ws kernel.ExitStatus) *ResourceReport {
+	r.Stop()
+	r.sample()
+	cpu := r.k.CPUStats()
+	io := r.k.IOUsage()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return &ResourceReport{
+		DurationSeconds: time.Since(r.start).Seconds(),
+		ExitCode:        ws.Code,
+		ExitSignal:      int(ws.Signo),
+		Memory: MemoryReport{
+			Peak:      r.peak,
+			PeakTotal: r.peakTotal,
+		},
+		CPU: CPUReport{
+			GuestSeconds:  cpu.UserTime.Seconds(),
+			SentrySeconds: cpu.SysTime.Seconds(),
+		},
+		IO: IOReport{
+			ReadBytes:         io.CharsRead,
+			WriteBytes:        io.CharsWritten,
+			ReadSyscalls:      io.ReadSyscalls,
+			WriteSyscalls:     io.WriteSyscalls,
+			StorageReadBytes:  io.BytesRead,
+			StorageWriteBytes: io.BytesWritten,
+		},
+		Syscalls:   syscallNames(kernel.SyscallCounts()),
+		RecentLogs: log.Recent(),
+	}
+}
+
+// syscallNames returns counts, which are by syscall number, by syscall name.
+func syscallNames(counts map[uintptr]uint64) map[string]uint64 {
+	table, ok := strace.Lookup(abi.Linux, arch.AMD64)
+	names := make(map[string]uint64, len(counts))
+	for sysno, n := range counts {
+		name := fmt.Sprintf("sys_%d", sysno)
+		if ok {
+			name = table.Name(sysno)
+		}
+		names[name] += n
+	}
+	return names
+}
+
+// WriteResourceReport writes the resource usage of the sandbox, whose root
+// container exited with ws, to w as JSON.
+func (l *Loader) WriteResourceReport(w io.Writer, ws kernel.ExitStatus) error {
+	if l.resources == nil {
+		return errors.New("resource report is not enabled")
+	}
+	b, err := json.MarshalIndent(l.resources.Report(ws), "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
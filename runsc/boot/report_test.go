@@ -0,0 +1,45 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"reflect"
+	"testing"
+
+	"gvisor.googlesource.com/gvisor/pkg/sentry/usage"
+)
+
+func TestResourceRecorderPeaks(t *testing.T) {
+	var r resourceRecorder
+	r.record(usage.MemoryStats{Anonymous: 100, Tmpfs: 10}, 110)
+	r.record(usage.MemoryStats{Anonymous: 50, Tmpfs: 40, Mapped: 5}, 95)
+	r.record(usage.MemoryStats{Anonymous: 20}, 20)
+
+	want := MemoryUsage{Anonymous: 100, Tmpfs: 40, Mapped: 5}
+	if r.peak != want {
+		t.Errorf("peak = %+v, want %+v", r.peak, want)
+	}
+	if r.peakTotal != 110 {
+		t.Errorf("peakTotal = %d, want 110", r.peakTotal)
+	}
+}
+
+func TestSyscallNames(t *testing.T) {
+	got := syscallNames(map[uintptr]uint64{0: 3, 1: 2, 1999: 1})
+	want := map[string]uint64{"read": 3, "write": 2, "sys_1999": 1}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("syscallNames = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"fmt"
+
+	"gvisor.googlesource.com/gvisor/pkg/log"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/flightrecorder"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/sighandling"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/socket/epsocket"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/state"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/time"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/watchdog"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/stack"
+)
+
+// restore replaces the kernel of the loader with the kernel saved in
+// l.restoreFile, which already contains the processes of the container.
+//
+// The network stack of the sandbox is kept, so restore must be called after
+// it is configured: restored sockets bind to the sandbox's addresses.
+//
+// Preconditions: The kernel has not been started.
+func (l *Loader) restore() error {
+	defer func() {
+		l.restoreFile.Close()
+		l.restoreFile = nil
+	}()
+
+	// The saved memory is loaded into a new platform, as the one of the
+	// current kernel already backs its VDSO.
+	p, err := createPlatform(l.conf)
+	if err != nil {
+		return fmt.Errorf("error creating platform: %v", err)
+	}
+	k := &kernel.Kernel{
+		Platform: p,
+	}
+
+	networkStack := l.k.NetworkStack()
+	if eps, ok := networkStack.(*epsocket.Stack); ok {
+		stack.StackFromEnv = eps.Stack
+	}
+	fs.SetRestoreEnvironment(*l.restoreEnv)
+
+	log.Infof("Restoring sandbox")
+	if err := (state.LoadOpts{Source: l.restoreFile}).Load(k, p, networkStack); err != nil {
+		return fmt.Errorf("error loading checkpoint image: %v", err)
+	}
+	updateInterval := l.conf.VDSOUpdateInterval
+	if updateInterval == 0 {
+		updateInterval = time.DefaultUpdateInterval
+	}
+	if !vdsoClockEnabled(l.conf, p) {
+		k.Timekeeper().DisableVDSO()
+	}
+	k.Timekeeper().SetClocks(time.NewCalibratedClocks(updateInterval))
+
+	// Move everything that refers to the kernel over to the restored one.
+	// The current kernel has no tasks, and is kept as it is the clock of
+	// the network stack.
+	l.stopSignalForwarding()
+	l.stopSignalForwarding = sighandling.StartForwarding(k)
+	l.watchdog.Stop()
+	l.watchdog = watchdog.New(k, l.conf.WatchdogTimeout, l.conf.WatchdogAction.watchdogAction())
+	if l.resources != nil {
+		l.resources.Stop()
+		l.resources = newResourceRecorder(k)
+	}
+	l.ctrl.manager.setKernel(k, l.watchdog)
+	l.k = k
+	return nil
+}
+
+// setKernel makes cm manage k, which is watched by w, instead of its current
+// kernel.
+func (cm *containerManager) setKernel(k *kernel.Kernel, w *watchdog.Watchdog) {
+	cm.confMu.Lock()
+	samples, period := cm.conf.FlightRecorderSamples, cm.conf.FlightRecorderPeriod
+	cm.confMu.Unlock()
+
+	cm.recorder.SetPeriod(0)
+	cm.recorder = flightrecorder.New(k, int(samples))
+	if period > 0 {
+		cm.recorder.SetPeriod(period)
+	}
+	cm.k = k
+	cm.watchdog = w
+}
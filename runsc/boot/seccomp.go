@@ -0,0 +1,353 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"fmt"
+	"sort"
+	"syscall"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"gvisor.googlesource.com/gvisor/pkg/abi"
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/bpf"
+	"gvisor.googlesource.com/gvisor/pkg/log"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/arch"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/strace"
+)
+
+// The offsets are based on struct seccomp_data in include/uapi/linux/seccomp.h.
+const (
+	seccompDataOffsetNR   = 0
+	seccompDataOffsetArch = 4
+	seccompDataOffsetArgs = 16
+)
+
+// seccompFilters returns the seccomp-bpf filters that enforce the seccomp
+// profile declared by the spec, or nil if the spec does not declare one.
+//
+// The filters are installed on the container's processes by the sentry, so
+// they apply to the syscalls that the sentry emulates in the same way that
+// runc's would apply to the host kernel. Applications may still install
+// filters of their own on top.
+func seccompFilters(spec *specs.Spec) ([]bpf.Program, error) {
+	if spec.Linux == nil || spec.Linux.Seccomp == nil {
+		return nil, nil
+	}
+	insns, err := buildSeccompProgram(spec.Linux.Seccomp)
+	if err != nil {
+		return nil, fmt.Errorf("invalid seccomp profile: %v", err)
+	}
+	p, err := bpf.Compile(insns)
+	if err != nil {
+		return nil, fmt.Errorf("error compiling seccomp profile: %v", err)
+	}
+	log.Infof("Seccomp profile compiled to %d instructions", p.Length())
+	return []bpf.Program{p}, nil
+}
+
+// seccompAction returns the SECCOMP_RET_* value that implements action a.
+// SCMP_ACT_ERRNO and SCMP_ACT_TRACE return errnoRet if it is set, and EPERM
+// otherwise, as in runc.
+func seccompAction(a specs.LinuxSeccompAction, errnoRet *uint) (uint32, error) {
+	errno := uint32(syscall.EPERM)
+	if errnoRet != nil {
+		if *errnoRet > linux.SECCOMP_RET_DATA {
+			return 0, fmt.Errorf("invalid errno %d", *errnoRet)
+		}
+		errno = uint32(*errnoRet)
+	}
+	switch a {
+	case specs.ActKill, specs.ActKillThread:
+		return linux.SECCOMP_RET_KILL, nil
+	case specs.ActTrap:
+		return linux.SECCOMP_RET_TRAP, nil
+	case specs.ActErrno:
+		return linux.SECCOMP_RET_ERRNO | errno, nil
+	case specs.ActTrace:
+		return linux.SECCOMP_RET_TRACE | errno, nil
+	case specs.ActAllow:
+		return linux.SECCOMP_RET_ALLOW, nil
+	default:
+		return 0, fmt.Errorf("unsupported action %q", a)
+	}
+}
+
+// seccompRule is a single rule of a seccomp profile for one syscall: if all
+// of args hold, then the syscall's action is action.
+type seccompRule struct {
+	args   []specs.LinuxSeccompArg
+	action uint32
+}
+
+// seccompDefaultLabel is added to the program to return the default action.
+const seccompDefaultLabel = "default"
+
+// buildSeccompProgram builds a BPF program that implements the seccomp profile
+// s. Rules are checked in order, and the first rule that matches a syscall
+// decides its action.
+//
+// Only amd64 syscalls are emulated by the sentry, so s.Architectures is
+// ignored; syscalls made with any other calling convention are killed, as
+// libseccomp does for architectures that a profile doesn't include.
+func buildSeccompProgram(s *specs.LinuxSeccomp) ([]linux.BPFInstruction, error) {
+	def, err := seccompAction(s.DefaultAction, s.DefaultErrnoRet)
+	if err != nil {
+		return nil, err
+	}
+	sys, ok := strace.Lookup(abi.Linux, arch.AMD64)
+	if !ok {
+		return nil, fmt.Errorf("no syscall names available")
+	}
+
+	rules := make(map[uintptr][]seccompRule)
+	for _, rule := range s.Syscalls {
+		action, err := seccompAction(rule.Action, rule.ErrnoRet)
+		if err != nil {
+			return nil, err
+		}
+		groups, err := seccompArgGroups(rule.Args)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range rule.Names {
+			sysno, ok := sys.ConvertToSysno(name)
+			if !ok {
+				// Profiles written for runc commonly name syscalls that
+				// don't exist on amd64. Like runc, skip them.
+				log.Debugf("Seccomp profile: ignoring unknown syscall %q", name)
+				continue
+			}
+			if r := rules[sysno]; len(r) > 0 && len(r[len(r)-1].args) == 0 {
+				// An earlier rule always matches.
+				continue
+			}
+			for _, args := range groups {
+				rules[sysno] = append(rules[sysno], seccompRule{args: args, action: action})
+			}
+		}
+	}
+
+	// Rules that return the default action can't change the outcome unless
+	// a later rule for the same syscall can.
+	var sysnos []uintptr
+	for sysno, r := range rules {
+		for len(r) > 0 && r[len(r)-1].action == def {
+			r = r[:len(r)-1]
+		}
+		if len(r) == 0 {
+			delete(rules, sysno)
+			continue
+		}
+		rules[sysno] = r
+		sysnos = append(sysnos, sysno)
+	}
+	sort.Slice(sysnos, func(i, j int) bool { return sysnos[i] < sysnos[j] })
+
+	program := bpf.NewProgramBuilder()
+
+	// A = seccomp_data.arch
+	// if (A != AUDIT_ARCH_X86_64) return SECCOMP_RET_KILL
+	program.AddStmt(bpf.Ld|bpf.Abs|bpf.W, seccompDataOffsetArch)
+	program.AddJump(bpf.Jmp|bpf.Jeq|bpf.K, linux.AUDIT_ARCH_X86_64, 1, 0)
+	program.AddStmt(bpf.Ret|bpf.K, linux.SECCOMP_RET_KILL)
+
+	if len(sysnos) > 0 {
+		// A = seccomp_data.nr
+		program.AddStmt(bpf.Ld|bpf.Abs|bpf.W, seccompDataOffsetNR)
+		if err := addSeccompIndex(program, sysnos, rules, true); err != nil {
+			return nil, err
+		}
+		if err := program.AddLabel(seccompDefaultLabel); err != nil {
+			return nil, err
+		}
+	}
+	program.AddStmt(bpf.Ret|bpf.K, def)
+	return program.Instructions()
+}
+
+// seccompIndexLabel returns the label of the index node for the middle of the
+// sorted syscall numbers sysnos, or seccompDefaultLabel if sysnos is empty.
+func seccompIndexLabel(sysnos []uintptr) string {
+	if len(sysnos) == 0 {
+		return seccompDefaultLabel
+	}
+	return fmt.Sprintf("index_%d", sysnos[len(sysnos)/2])
+}
+
+// addSeccompIndex adds a binary search over the sorted syscall numbers sysnos
+// to program, with each syscall's rules following its node. Syscalls that
+// aren't found, or that no rule matches, jump to seccompDefaultLabel. The
+// layout matches the one built by pkg/seccomp:
+//
+//	// SYS_PIPE(22), root
+//	  (A == 22) ? goto rules_22 : continue
+//	  (A > 22) ? goto index_35 : goto index_9
+//	rules_22:
+//	  (rules for SYS_PIPE)
+//	  goto default
+//
+//	index_9:  // SYS_MMAP(9), leaf
+//	  (A == 9) ? goto rules_9 : goto default
+//
+// Direct jumps are used where the target may be further away than the limit
+// of a conditional jump (255).
+func addSeccompIndex(program *bpf.ProgramBuilder, sysnos []uintptr, rules map[uintptr][]seccompRule, root bool) error {
+	if len(sysnos) == 0 {
+		return nil
+	}
+	i := len(sysnos) / 2
+	sysno := sysnos[i]
+	left, right := sysnos[:i], sysnos[i+1:]
+	if !root {
+		if err := program.AddLabel(seccompIndexLabel(sysnos)); err != nil {
+			return err
+		}
+	}
+	match := fmt.Sprintf("rules_%d", sysno)
+	program.AddJumpTrueLabel(bpf.Jmp|bpf.Jeq|bpf.K, uint32(sysno), match, 0)
+	if len(left) == 0 && len(right) == 0 {
+		program.AddDirectJumpLabel(seccompDefaultLabel)
+	} else {
+		program.AddJump(bpf.Jmp|bpf.Jgt|bpf.K, uint32(sysno), 0, 1)
+		program.AddDirectJumpLabel(seccompIndexLabel(right))
+		program.AddDirectJumpLabel(seccompIndexLabel(left))
+	}
+
+	if err := program.AddLabel(match); err != nil {
+		return err
+	}
+	for i, rule := range rules[sysno] {
+		if len(rule.args) == 0 {
+			// return action
+			program.AddStmt(bpf.Ret|bpf.K, rule.action)
+			break
+		}
+		// if (!args) goto next
+		// return action
+		// next:
+		next := fmt.Sprintf("next_%d_%d", sysno, i)
+		for j, a := range rule.args {
+			if err := addSeccompArgCheck(program, a, fmt.Sprintf("match_%d_%d_%d", sysno, i, j), next); err != nil {
+				return err
+			}
+		}
+		program.AddStmt(bpf.Ret|bpf.K, rule.action)
+		if err := program.AddLabel(next); err != nil {
+			return err
+		}
+	}
+	if r := rules[sysno]; len(r[len(r)-1].args) != 0 {
+		program.AddDirectJumpLabel(seccompDefaultLabel)
+	}
+
+	if err := addSeccompIndex(program, left, rules, false); err != nil {
+		return err
+	}
+	return addSeccompIndex(program, right, rules, false)
+}
+
+// seccompArgGroups returns the sets of argument conditions under which a rule
+// applies. As in runc, all conditions on distinct arguments must hold, but if
+// an argument is named more than once then each condition applies on its own.
+func seccompArgGroups(args []specs.LinuxSeccompArg) ([][]specs.LinuxSeccompArg, error) {
+	seen := make(map[uint]bool)
+	split := false
+	for _, a := range args {
+		if a.Index >= 6 {
+			return nil, fmt.Errorf("invalid argument index %d", a.Index)
+		}
+		split = split || seen[a.Index]
+		seen[a.Index] = true
+	}
+	if !split {
+		return [][]specs.LinuxSeccompArg{args}, nil
+	}
+	groups := make([][]specs.LinuxSeccompArg, 0, len(args))
+	for _, a := range args {
+		groups = append(groups, []specs.LinuxSeccompArg{a})
+	}
+	return groups, nil
+}
+
+// addSeccompArgCheck adds instructions to program that continue to the next
+// instruction if the syscall argument satisfies a, and jump to mismatch
+// otherwise. match must be a label that is unused by program.
+//
+// Syscall arguments are 64 bits wide, while BPF registers are 32 bits wide,
+// so the high and low halves of each argument are compared separately.
+func addSeccompArgCheck(program *bpf.ProgramBuilder, a specs.LinuxSeccompArg, match, mismatch string) error {
+	low := uint32(seccompDataOffsetArgs + 8*a.Index)
+	high := low + 4
+	switch a.Op {
+	case specs.OpEqualTo:
+		addSeccompEqual(program, low, high, a.Value, match, mismatch)
+	case specs.OpNotEqual:
+		addSeccompEqual(program, low, high, a.Value, mismatch, match)
+	case specs.OpGreaterThan:
+		addSeccompGreater(program, low, high, a.Value, bpf.Jgt, match, mismatch)
+	case specs.OpGreaterEqual:
+		addSeccompGreater(program, low, high, a.Value, bpf.Jge, match, mismatch)
+	case specs.OpLessThan:
+		// arg < value iff !(arg >= value).
+		addSeccompGreater(program, low, high, a.Value, bpf.Jge, mismatch, match)
+	case specs.OpLessEqual:
+		// arg <= value iff !(arg > value).
+		addSeccompGreater(program, low, high, a.Value, bpf.Jgt, mismatch, match)
+	case specs.OpMaskedEqual:
+		// A = high(arg) & high(value)
+		// if (A != high(valueTwo)) goto mismatch
+		// A = low(arg) & low(value)
+		// if (A == low(valueTwo)) goto match else goto mismatch
+		program.AddStmt(bpf.Ld|bpf.Abs|bpf.W, high)
+		program.AddStmt(bpf.Alu|bpf.And|bpf.K, uint32(a.Value>>32))
+		program.AddJumpFalseLabel(bpf.Jmp|bpf.Jeq|bpf.K, uint32(a.ValueTwo>>32), 0, mismatch)
+		program.AddStmt(bpf.Ld|bpf.Abs|bpf.W, low)
+		program.AddStmt(bpf.Alu|bpf.And|bpf.K, uint32(a.Value))
+		program.AddJumpLabels(bpf.Jmp|bpf.Jeq|bpf.K, uint32(a.ValueTwo), match, mismatch)
+	default:
+		return fmt.Errorf("unsupported operator %q", a.Op)
+	}
+	return program.AddLabel(match)
+}
+
+// addSeccompEqual adds instructions to program that jump to t if the argument
+// at offsets low and high is equal to value, and to f otherwise.
+func addSeccompEqual(program *bpf.ProgramBuilder, low, high uint32, value uint64, t, f string) {
+	// A = high(arg)
+	// if (A != high(value)) goto f
+	// A = low(arg)
+	// if (A == low(value)) goto t else goto f
+	program.AddStmt(bpf.Ld|bpf.Abs|bpf.W, high)
+	program.AddJumpFalseLabel(bpf.Jmp|bpf.Jeq|bpf.K, uint32(value>>32), 0, f)
+	program.AddStmt(bpf.Ld|bpf.Abs|bpf.W, low)
+	program.AddJumpLabels(bpf.Jmp|bpf.Jeq|bpf.K, uint32(value), t, f)
+}
+
+// addSeccompGreater adds instructions to program that jump to t if the
+// argument at offsets low and high compares to value as cond (bpf.Jgt or
+// bpf.Jge), and to f otherwise.
+func addSeccompGreater(program *bpf.ProgramBuilder, low, high uint32, value uint64, cond uint16, t, f string) {
+	// A = high(arg)
+	// if (A > high(value)) goto t
+	// if (A != high(value)) goto f
+	// A = low(arg)
+	// if (A cond low(value)) goto t else goto f
+	program.AddStmt(bpf.Ld|bpf.Abs|bpf.W, high)
+	program.AddJumpTrueLabel(bpf.Jmp|bpf.Jgt|bpf.K, uint32(value>>32), t, 0)
+	program.AddJumpFalseLabel(bpf.Jmp|bpf.Jeq|bpf.K, uint32(value>>32), 0, f)
+	program.AddStmt(bpf.Ld|bpf.Abs|bpf.W, low)
+	program.AddJumpLabels(bpf.Jmp|cond|bpf.K, uint32(value), t, f)
+}
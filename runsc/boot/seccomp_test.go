@@ -0,0 +1,270 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"encoding/binary"
+	"syscall"
+	"testing"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"gvisor.googlesource.com/gvisor/pkg/abi"
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/bpf"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/arch"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/strace"
+)
+
+// seccompInput returns the struct seccomp_data for an amd64 syscall.
+func seccompInput(auditArch uint32, sysno uintptr, args ...uint64) bpf.Input {
+	data := make([]byte, seccompDataOffsetArgs+6*8)
+	binary.LittleEndian.PutUint32(data[seccompDataOffsetNR:], uint32(sysno))
+	binary.LittleEndian.PutUint32(data[seccompDataOffsetArch:], auditArch)
+	for i, arg := range args {
+		binary.LittleEndian.PutUint64(data[seccompDataOffsetArgs+8*i:], arg)
+	}
+	return bpf.InputBytes{data, binary.LittleEndian}
+}
+
+func TestSeccompFilters(t *testing.T) {
+	errno := uint32(linux.SECCOMP_RET_ERRNO | uint32(syscall.EPERM))
+	profile := &specs.LinuxSeccomp{
+		DefaultAction: specs.ActErrno,
+		Syscalls: []specs.LinuxSyscall{
+			{
+				Names:  []string{"read", "write", "no_such_syscall"},
+				Action: specs.ActAllow,
+			},
+			{
+				// Redundant with the default action.
+				Names:  []string{"open"},
+				Action: specs.ActErrno,
+			},
+			{
+				Names:  []string{"kill"},
+				Action: specs.ActKill,
+				Args: []specs.LinuxSeccompArg{
+					{Index: 1, Value: 9, Op: specs.OpEqualTo},
+				},
+			},
+			{
+				// Repeated indices apply separately.
+				Names:  []string{"personality"},
+				Action: specs.ActAllow,
+				Args: []specs.LinuxSeccompArg{
+					{Index: 0, Value: 0x0, Op: specs.OpEqualTo},
+					{Index: 0, Value: 0xffffffff, Op: specs.OpEqualTo},
+				},
+			},
+			{
+				Names:  []string{"clone"},
+				Action: specs.ActAllow,
+				Args: []specs.LinuxSeccompArg{
+					{Index: 0, Value: syscall.CLONE_NEWUSER, ValueTwo: 0, Op: specs.OpMaskedEqual},
+				},
+			},
+			{
+				// Distinct indices must all hold.
+				Names:  []string{"lseek"},
+				Action: specs.ActAllow,
+				Args: []specs.LinuxSeccompArg{
+					{Index: 1, Value: 1 << 32, Op: specs.OpLessThan},
+					{Index: 2, Value: 2, Op: specs.OpLessEqual},
+				},
+			},
+			{
+				Names:  []string{"mmap"},
+				Action: specs.ActTrap,
+				Args: []specs.LinuxSeccompArg{
+					{Index: 1, Value: 1 << 32, Op: specs.OpGreaterThan},
+				},
+			},
+			{
+				Names:  []string{"mmap"},
+				Action: specs.ActAllow,
+				Args: []specs.LinuxSeccompArg{
+					{Index: 2, Value: 1, Op: specs.OpNotEqual},
+				},
+			},
+		},
+	}
+	filters, err := seccompFilters(&specs.Spec{Linux: &specs.Linux{Seccomp: profile}})
+	if err != nil {
+		t.Fatalf("seccompFilters failed: %v", err)
+	}
+	if len(filters) != 1 {
+		t.Fatalf("got %d filters, want 1", len(filters))
+	}
+
+	for _, tc := range []struct {
+		name  string
+		arch  uint32
+		sysno uintptr
+		args  []uint64
+		want  uint32
+	}{
+		{"allowed", linux.AUDIT_ARCH_X86_64, syscall.SYS_READ, nil, linux.SECCOMP_RET_ALLOW},
+		{"default", linux.AUDIT_ARCH_X86_64, syscall.SYS_GETPID, nil, errno},
+		{"redundant", linux.AUDIT_ARCH_X86_64, syscall.SYS_OPEN, nil, errno},
+		{"wrong arch", 0x40000003, syscall.SYS_READ, nil, linux.SECCOMP_RET_KILL},
+		{"equal", linux.AUDIT_ARCH_X86_64, syscall.SYS_KILL, []uint64{1, 9}, linux.SECCOMP_RET_KILL},
+		{"not equal", linux.AUDIT_ARCH_X86_64, syscall.SYS_KILL, []uint64{1, 9 | 1<<32}, errno},
+		{"repeated first", linux.AUDIT_ARCH_X86_64, syscall.SYS_PERSONALITY, []uint64{0}, linux.SECCOMP_RET_ALLOW},
+		{"repeated second", linux.AUDIT_ARCH_X86_64, syscall.SYS_PERSONALITY, []uint64{0xffffffff}, linux.SECCOMP_RET_ALLOW},
+		{"repeated neither", linux.AUDIT_ARCH_X86_64, syscall.SYS_PERSONALITY, []uint64{8}, errno},
+		{"masked match", linux.AUDIT_ARCH_X86_64, syscall.SYS_CLONE, []uint64{syscall.CLONE_VM}, linux.SECCOMP_RET_ALLOW},
+		{"masked mismatch", linux.AUDIT_ARCH_X86_64, syscall.SYS_CLONE, []uint64{syscall.CLONE_NEWUSER}, errno},
+		{"all hold", linux.AUDIT_ARCH_X86_64, syscall.SYS_LSEEK, []uint64{0, 0xffffffff, 2}, linux.SECCOMP_RET_ALLOW},
+		{"first fails", linux.AUDIT_ARCH_X86_64, syscall.SYS_LSEEK, []uint64{0, 1 << 32, 2}, errno},
+		{"second fails", linux.AUDIT_ARCH_X86_64, syscall.SYS_LSEEK, []uint64{0, 0, 3}, errno},
+		{"first rule", linux.AUDIT_ARCH_X86_64, syscall.SYS_MMAP, []uint64{0, 1<<32 + 1, 0}, linux.SECCOMP_RET_TRAP},
+		{"second rule", linux.AUDIT_ARCH_X86_64, syscall.SYS_MMAP, []uint64{0, 1 << 32, 0}, linux.SECCOMP_RET_ALLOW},
+		{"no rule", linux.AUDIT_ARCH_X86_64, syscall.SYS_MMAP, []uint64{0, 1 << 32, 1}, errno},
+	} {
+		got, err := bpf.Exec(filters[0], seccompInput(tc.arch, tc.sysno, tc.args...))
+		if err != nil {
+			t.Errorf("%s: bpf.Exec failed: %v", tc.name, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%s: got %#x, want %#x", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestSeccompFiltersErrnoRet(t *testing.T) {
+	enosys := uint(syscall.ENOSYS)
+	eacces := uint(syscall.EACCES)
+	profile := &specs.LinuxSeccomp{
+		DefaultAction:   specs.ActErrno,
+		DefaultErrnoRet: &enosys,
+		Syscalls: []specs.LinuxSyscall{
+			{
+				Names:    []string{"open"},
+				Action:   specs.ActErrno,
+				ErrnoRet: &eacces,
+			},
+			{
+				Names:  []string{"ptrace"},
+				Action: specs.ActTrace,
+			},
+		},
+	}
+	filters, err := seccompFilters(&specs.Spec{Linux: &specs.Linux{Seccomp: profile}})
+	if err != nil {
+		t.Fatalf("seccompFilters failed: %v", err)
+	}
+	for _, tc := range []struct {
+		sysno uintptr
+		want  uint32
+	}{
+		{syscall.SYS_OPEN, linux.SECCOMP_RET_ERRNO | uint32(syscall.EACCES)},
+		{syscall.SYS_PTRACE, linux.SECCOMP_RET_TRACE | uint32(syscall.EPERM)},
+		{syscall.SYS_GETPID, linux.SECCOMP_RET_ERRNO | uint32(syscall.ENOSYS)},
+	} {
+		got, err := bpf.Exec(filters[0], seccompInput(linux.AUDIT_ARCH_X86_64, tc.sysno))
+		if err != nil {
+			t.Errorf("syscall %d: bpf.Exec failed: %v", tc.sysno, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("syscall %d: got %#x, want %#x", tc.sysno, got, tc.want)
+		}
+	}
+}
+
+func TestSeccompFiltersIndex(t *testing.T) {
+	// Allow every other syscall, so that the index has many nodes and
+	// syscalls that aren't in it fall between them.
+	sys, ok := strace.Lookup(abi.Linux, arch.AMD64)
+	if !ok {
+		t.Fatalf("no syscall names available")
+	}
+	var names []string
+	allowed := make(map[uintptr]bool)
+	for sysno := uintptr(0); sysno < 300; sysno += 2 {
+		if _, ok := sys[sysno]; ok {
+			names = append(names, sys.Name(sysno))
+			allowed[sysno] = true
+		}
+	}
+	profile := &specs.LinuxSeccomp{
+		DefaultAction: specs.ActKill,
+		Syscalls: []specs.LinuxSyscall{
+			{Names: names, Action: specs.ActAllow},
+		},
+	}
+	filters, err := seccompFilters(&specs.Spec{Linux: &specs.Linux{Seccomp: profile}})
+	if err != nil {
+		t.Fatalf("seccompFilters failed: %v", err)
+	}
+	for sysno := uintptr(0); sysno < 320; sysno++ {
+		want := uint32(linux.SECCOMP_RET_KILL)
+		if allowed[sysno] {
+			want = linux.SECCOMP_RET_ALLOW
+		}
+		got, err := bpf.Exec(filters[0], seccompInput(linux.AUDIT_ARCH_X86_64, sysno))
+		if err != nil {
+			t.Errorf("syscall %d: bpf.Exec failed: %v", sysno, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("syscall %d: got %#x, want %#x", sysno, got, want)
+		}
+	}
+}
+
+func TestSeccompFiltersErrors(t *testing.T) {
+	badErrno := uint(1 << 16)
+	for _, profile := range []*specs.LinuxSeccomp{
+		{DefaultAction: "SCMP_ACT_BOGUS"},
+		{
+			DefaultAction: specs.ActAllow,
+			Syscalls: []specs.LinuxSyscall{
+				{Names: []string{"read"}, Action: "SCMP_ACT_BOGUS"},
+			},
+		},
+		{
+			DefaultAction: specs.ActAllow,
+			Syscalls: []specs.LinuxSyscall{
+				{
+					Names:  []string{"read"},
+					Action: specs.ActErrno,
+					Args:   []specs.LinuxSeccompArg{{Index: 6, Op: specs.OpEqualTo}},
+				},
+			},
+		},
+		{
+			DefaultAction: specs.ActAllow,
+			Syscalls: []specs.LinuxSyscall{
+				{
+					Names:  []string{"read"},
+					Action: specs.ActErrno,
+					Args:   []specs.LinuxSeccompArg{{Index: 0, Op: "SCMP_CMP_BOGUS"}},
+				},
+			},
+		},
+		{DefaultAction: specs.ActErrno, DefaultErrnoRet: &badErrno},
+	} {
+		if _, err := seccompFilters(&specs.Spec{Linux: &specs.Linux{Seccomp: profile}}); err == nil {
+			t.Errorf("seccompFilters(%+v) succeeded, want error", profile)
+		}
+	}
+
+	filters, err := seccompFilters(&specs.Spec{})
+	if err != nil || filters != nil {
+		t.Errorf("seccompFilters with no profile = %v, %v; want nil, nil", filters, err)
+	}
+}
@@ -15,26 +15,160 @@
 package boot
 
 import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"gvisor.googlesource.com/gvisor/pkg/abi"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/arch"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/strace"
 )
 
+// syscallWhitelistAnnotation is the spec annotation that restricts the
+// syscalls that the container may invoke. Its value is a comma-separated list
+// of syscall names; all other syscalls fail with ENOSYS. This is enforced by
+// the sentry independently of any seccomp filters installed by the
+// application.
+const syscallWhitelistAnnotation = "dev.gvisor.syscall-whitelist"
+
+// syscallOriginAnnotation is the spec annotation that restricts the code
+// from which the container may invoke syscalls. Its value is a JSON object,
+// for example:
+//
+//	{
+//	  "action": "kill",
+//	  "default": ["[vdso]", "/lib/x86_64-linux-gnu/libc-*.so"],
+//	  "binaries": {"/usr/bin/node": ["[vdso]", "/usr/bin/node"]}
+//	}
+//
+// "action" is "log" (the default) or "kill". "default" lists the mappings
+// from which executables without an entry in "binaries" may invoke syscalls;
+// see kernel.SyscallOriginPolicy for the pattern syntax.
+const syscallOriginAnnotation = "dev.gvisor.syscall-origin"
+
+// syscallOriginSpec is the JSON form of syscallOriginAnnotation.
+type syscallOriginSpec struct {
+	Action   string              `json:"action"`
+	Default  []string            `json:"default"`
+	Binaries map[string][]string `json:"binaries"`
+}
+
+// redactAnnotation is the spec annotation that masks secrets in strace
+// output and in process and audit events describing the container. Its value
+// is a JSON object, for example:
+//
+//	{
+//	  "env": ["AWS_SECRET_ACCESS_KEY", "*_TOKEN"],
+//	  "paths": ["/run/secrets", "*.pem"]
+//	}
+//
+// "env" lists the names of environment variables whose values are masked, and
+// "paths" the paths that are masked; see kernel.RedactionPolicy for the
+// pattern syntax.
+const redactAnnotation = "dev.gvisor.redact"
+
+// redactSpec is the JSON form of redactAnnotation.
+type redactSpec struct {
+	Env   []string `json:"env"`
+	Paths []string `json:"paths"`
+}
+
 func enableStrace(conf *Config) error {
 	// We must initialize even if strace is not enabled.
 	strace.Initialize()
 
-	if !conf.Strace {
-		return nil
+	var sinks strace.SinkType
+	if conf.Strace {
+		max := conf.StraceLogSize
+		if max == 0 {
+			max = 1024
+		}
+		strace.LogMaximumSize = max
+		sinks |= strace.SinkTypeLog
 	}
-
-	max := conf.StraceLogSize
-	if max == 0 {
-		max = 1024
+	if conf.StraceRingSize > 0 {
+		strace.RingSize = int(conf.StraceRingSize)
+		sinks |= strace.SinkTypeRing
+	}
+	if sinks == 0 {
+		return nil
 	}
-	strace.LogMaximumSize = max
 
 	if len(conf.StraceSyscalls) == 0 {
-		strace.EnableAll(strace.SinkTypeLog)
+		strace.EnableAll(sinks)
 		return nil
 	}
-	return strace.Enable(conf.StraceSyscalls, strace.SinkTypeLog)
+	return strace.Enable(conf.StraceSyscalls, sinks)
+}
+
+// syscallWhitelist returns the syscall whitelist declared by the spec, or nil
+// if the spec does not restrict syscalls.
+func syscallWhitelist(spec *specs.Spec) (*kernel.SyscallWhitelist, error) {
+	val, ok := spec.Annotations[syscallWhitelistAnnotation]
+	if !ok {
+		return nil, nil
+	}
+	var names []string
+	for _, name := range strings.Split(val, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+
+	sys, ok := strace.Lookup(abi.Linux, arch.AMD64)
+	if !ok {
+		return nil, fmt.Errorf("no syscall names available")
+	}
+	sysnos, err := sys.ConvertToSysnoMap(names)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %v", syscallWhitelistAnnotation, err)
+	}
+	return kernel.NewSyscallWhitelist(sysnos), nil
+}
+
+// syscallOriginPolicy returns the syscall origin policy declared by the spec,
+// or nil if the spec does not restrict the origin of syscalls.
+func syscallOriginPolicy(spec *specs.Spec) (*kernel.SyscallOriginPolicy, error) {
+	val, ok := spec.Annotations[syscallOriginAnnotation]
+	if !ok {
+		return nil, nil
+	}
+	var s syscallOriginSpec
+	if err := json.Unmarshal([]byte(val), &s); err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %v", syscallOriginAnnotation, err)
+	}
+	var action kernel.SyscallOriginAction
+	switch s.Action {
+	case "", "log":
+		action = kernel.SyscallOriginLog
+	case "kill":
+		action = kernel.SyscallOriginKill
+	default:
+		return nil, fmt.Errorf("invalid %s annotation: unknown action %q", syscallOriginAnnotation, s.Action)
+	}
+	p, err := kernel.NewSyscallOriginPolicy(action, s.Default, s.Binaries)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %v", syscallOriginAnnotation, err)
+	}
+	return p, nil
+}
+
+// redactionPolicy returns the redaction policy declared by the spec, or nil
+// if the spec does not mask anything.
+func redactionPolicy(spec *specs.Spec) (*kernel.RedactionPolicy, error) {
+	val, ok := spec.Annotations[redactAnnotation]
+	if !ok {
+		return nil, nil
+	}
+	var s redactSpec
+	if err := json.Unmarshal([]byte(val), &s); err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %v", redactAnnotation, err)
+	}
+	p, err := kernel.NewRedactionPolicy(s.Env, s.Paths)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %v", redactAnnotation, err)
+	}
+	return p, nil
 }
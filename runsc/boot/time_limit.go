@@ -0,0 +1,245 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
+	"gvisor.googlesource.com/gvisor/pkg/log"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/control"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/watchdog"
+	"gvisor.googlesource.com/gvisor/pkg/urpc"
+)
+
+// cpuTimeLimitPeriod is the time between the checks of CPU time against
+// Config.CPUTimeLimit.
+const cpuTimeLimitPeriod = time.Second
+
+// TimeLimitReport describes a sandbox that exceeded its time limit. It is
+// written as JSON to Config.TimeLimitReport, so that batch systems can tell
+// why a workload was stopped and where to resume it from.
+type TimeLimitReport struct {
+	// Limit is the limit that was exceeded, "wall" or "cpu".
+	Limit string `json:"limit"`
+
+	// LimitSeconds is the value of the limit that was exceeded.
+	LimitSeconds float64 `json:"limitSeconds"`
+
+	// Action is the action taken, as in --time-limit-action.
+	Action string `json:"action"`
+
+	// ElapsedSeconds is the wall time from the start of the root
+	// container to the expiry of the limit.
+	ElapsedSeconds float64 `json:"elapsedSeconds"`
+
+	// CPU is the CPU time used by the sandbox when the limit expired.
+	CPU CPUReport `json:"cpu"`
+
+	// Processes are the processes that were running when the limit
+	// expired.
+	Processes []*control.Process `json:"processes"`
+
+	// Checkpointed is true if the sandbox was saved to
+	// Config.TimeLimitImage.
+	Checkpointed bool `json:"checkpointed"`
+
+	// Error is the reason the action failed, if it did.
+	Error string `json:"error,omitempty"`
+}
+
+// timeLimiter takes Config.TimeLimitAction on a sandbox once it exceeds
+// Config.TimeLimit or Config.CPUTimeLimit.
+type timeLimiter struct {
+	k        *kernel.Kernel
+	watchdog *watchdog.Watchdog
+	conf     *Config
+	start    time.Time
+
+	// image and report are the files where the sandbox is checkpointed
+	// and the report is written. Either may be nil. They are owned by the
+	// timeLimiter.
+	image  *os.File
+	report *os.File
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// startTimeLimiter starts enforcing the time limits of conf on k, until
+// Stop is called.
+func startTimeLimiter(k *kernel.Kernel, w *watchdog.Watchdog, conf *Config, image, report *os.File) *timeLimiter {
+	t := &timeLimiter{
+		k:        k,
+		watchdog: w,
+		conf:     conf,
+		start:    time.Now(),
+		image:    image,
+		report:   report,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go t.run() // S/R-SAFE: stops the application only once the limit expires.
+	return t
+}
+
+func (t *timeLimiter) run() {
+	defer close(t.done)
+	defer t.closeFiles()
+
+	// A nil channel blocks forever, which disables the limits that are
+	// not set.
+	var wall <-chan time.Time
+	if t.conf.TimeLimit > 0 {
+		timer := time.NewTimer(t.conf.TimeLimit)
+		defer timer.Stop()
+		wall = timer.C
+	}
+	var cpu <-chan time.Time
+	if t.conf.CPUTimeLimit > 0 {
+		ticker := time.NewTicker(cpuTimeLimitPeriod)
+		defer ticker.Stop()
+		cpu = ticker.C
+	}
+
+	for {
+		select {
+		case <-t.stop:
+			return
+		case <-wall:
+			t.expire("wall", t.conf.TimeLimit)
+			return
+		case <-cpu:
+			if t.cpuTime() >= t.conf.CPUTimeLimit {
+				t.expire("cpu", t.conf.CPUTimeLimit)
+				return
+			}
+		}
+	}
+}
+
+// cpuTime returns the CPU time used by all tasks of the sandbox.
+func (t *timeLimiter) cpuTime() time.Duration {
+	stats := t.k.CPUStats()
+	return stats.UserTime + stats.SysTime
+}
+
+// expire takes the action of the limit, which was exceeded, and writes the
+// report.
+func (t *timeLimiter) expire(limit string, d time.Duration) {
+	log.Warningf("Sandbox exceeded its %s time limit of %v: taking action %v", limit, d, t.conf.TimeLimitAction)
+
+	stats := t.k.CPUStats()
+	r := &TimeLimitReport{
+		Limit:          limit,
+		LimitSeconds:   d.Seconds(),
+		Action:         t.conf.TimeLimitAction.String(),
+		ElapsedSeconds: time.Since(t.start).Seconds(),
+		CPU: CPUReport{
+			GuestSeconds:  stats.UserTime.Seconds(),
+			SentrySeconds: stats.SysTime.Seconds(),
+		},
+	}
+	if err := control.Processes(t.k, &r.Processes); err != nil {
+		log.Warningf("Error listing processes for time limit report: %v", err)
+	}
+
+	if err := t.act(); err != nil {
+		log.Warningf("Error taking time limit action %v: %v", t.conf.TimeLimitAction, err)
+		r.Error = err.Error()
+		// Whatever happened, the sandbox must not run past its limit.
+		t.k.Kill(kernel.ExitStatus{Signo: int(linux.SIGKILL)})
+	} else {
+		r.Checkpointed = t.conf.TimeLimitAction == TimeLimitCheckpoint
+	}
+
+	if t.report != nil {
+		if err := writeTimeLimitReport(t.report, r); err != nil {
+			log.Warningf("Error writing time limit report: %v", err)
+		}
+	}
+}
+
+// act takes the action of Config.TimeLimitAction. Either way, the sandbox
+// exits once act succeeds.
+func (t *timeLimiter) act() error {
+	switch t.conf.TimeLimitAction {
+	case TimeLimitCheckpoint:
+		if t.image == nil {
+			return os.ErrInvalid
+		}
+		state := control.State{
+			Kernel:   t.k,
+			Watchdog: t.watchdog,
+		}
+		// Save takes ownership of the image, and kills the kernel once
+		// it is saved.
+		image := t.image
+		t.image = nil
+		return state.Save(&control.SaveOpts{
+			FilePayload: urpc.FilePayload{Files: []*os.File{image}},
+		}, nil)
+	default:
+		t.k.Kill(kernel.ExitStatus{Signo: int(linux.SIGKILL)})
+		return nil
+	}
+}
+
+// writeTimeLimitReport writes r to f as JSON.
+func writeTimeLimitReport(f *os.File, r *TimeLimitReport) error {
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(b, '\n'))
+	return err
+}
+
+func (t *timeLimiter) closeFiles() {
+	if t.image != nil {
+		t.image.Close()
+	}
+	if t.report != nil {
+		t.report.Close()
+	}
+}
+
+// Stop stops enforcing the time limits. It may be called more than once.
+func (t *timeLimiter) Stop() {
+	t.stopOnce.Do(func() { close(t.stop) })
+	<-t.done
+}
+
+// StartTimeLimit starts enforcing Config.TimeLimit and Config.CPUTimeLimit
+// on the sandbox, which must be running. image and report are the files for
+// Config.TimeLimitImage and Config.TimeLimitReport, or nil if they are not
+// set; the Loader takes ownership of them.
+func (l *Loader) StartTimeLimit(image, report *os.File) {
+	if l.conf.TimeLimit == 0 && l.conf.CPUTimeLimit == 0 {
+		if image != nil {
+			image.Close()
+		}
+		if report != nil {
+			report.Close()
+		}
+		return
+	}
+	l.timeLimit = startTimeLimiter(l.k, l.watchdog, l.conf, image, report)
+}
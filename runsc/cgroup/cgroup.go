@@ -0,0 +1,222 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cgroup configures the host cgroups (v1) of a sandbox, which bound
+// the CPU, memory and number of tasks of the sandbox and gofer processes as
+// the OCI spec requests.
+package cgroup
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"gvisor.googlesource.com/gvisor/pkg/log"
+)
+
+// cgroupRoot is the mount point of the cgroup controller hierarchies. It is
+// a variable for tests.
+var cgroupRoot = "/sys/fs/cgroup"
+
+// controllers are the controllers that cgroups are created in.
+var controllers = []string{"cpu", "memory", "pids"}
+
+// Cgroup is the cgroup of a sandbox in each of the controllers.
+type Cgroup struct {
+	// Path is the path of the cgroup relative to the root of each
+	// controller hierarchy.
+	Path string `json:"path"`
+
+	// Own is true if the cgroup was created by Install, in which case
+	// Uninstall removes it.
+	Own bool `json:"own"`
+}
+
+// New returns the cgroup requested by spec, or nil if it doesn't request one.
+//
+// Only cgroupfs paths in v1 hierarchies are supported. If the spec requests a
+// systemd cgroup ("slice:prefix:name"), or the host doesn't mount v1
+// hierarchies of the controllers, e.g. because it only uses the unified (v2)
+// hierarchy, a warning is logged and New returns nil: the sandbox then runs
+// in the cgroups of its parent, and its limits are only enforced by the
+// sentry.
+func New(spec *specs.Spec) (*Cgroup, error) {
+	if spec.Linux == nil || spec.Linux.CgroupsPath == "" {
+		return nil, nil
+	}
+	path := spec.Linux.CgroupsPath
+	if strings.Contains(path, ":") {
+		log.Warningf("Systemd cgroup path %q is not supported, not configuring cgroups", path)
+		return nil, nil
+	}
+	for _, ctrl := range controllers {
+		if _, err := os.Stat(filepath.Join(cgroupRoot, ctrl)); err != nil {
+			log.Warningf("Cgroup v1 hierarchy of controller %q is not available, not configuring cgroups: %v", ctrl, err)
+			return nil, nil
+		}
+	}
+	return &Cgroup{Path: filepath.Clean("/" + path)}, nil
+}
+
+// dir returns the directory of the cgroup in the given controller.
+func (c *Cgroup) dir(controller string) string {
+	return filepath.Join(cgroupRoot, controller, c.Path)
+}
+
+// Install creates the cgroup, if it doesn't exist, and sets its limits to
+// res, which may be nil.
+func (c *Cgroup) Install(res *specs.LinuxResources) error {
+	if _, err := os.Stat(c.dir(controllers[0])); os.IsNotExist(err) {
+		c.Own = true
+	}
+	for _, ctrl := range controllers {
+		if err := os.MkdirAll(c.dir(ctrl), 0755); err != nil {
+			c.Uninstall()
+			return fmt.Errorf("error creating cgroup: %v", err)
+		}
+	}
+	if res == nil {
+		return nil
+	}
+	if _, err := c.Update(res); err != nil {
+		c.Uninstall()
+		return err
+	}
+	return nil
+}
+
+// Uninstall removes the cgroup if it was created by Install. The processes
+// in it must have been killed; Uninstall waits briefly for them to exit.
+func (c *Cgroup) Uninstall() error {
+	if !c.Own {
+		return nil
+	}
+	var firstErr error
+	for _, ctrl := range controllers {
+		var err error
+		for i := 0; i < 20; i++ {
+			err = syscall.Rmdir(c.dir(ctrl))
+			if err != syscall.EBUSY {
+				break
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+		if err != nil && err != syscall.ENOENT && firstErr == nil {
+			firstErr = fmt.Errorf("error removing cgroup %q: %v", c.dir(ctrl), err)
+		}
+	}
+	return firstErr
+}
+
+// Add moves the process pid into the cgroup.
+func (c *Cgroup) Add(pid int) error {
+	for _, ctrl := range controllers {
+		if err := writeFile(c.dir(ctrl), "cgroup.procs", strconv.Itoa(pid)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setting is a value to write to a cgroup file.
+type setting struct {
+	controller string
+	file       string
+	value      string
+}
+
+// settings returns the cgroup files to write to apply res.
+func settings(res *specs.LinuxResources) []setting {
+	var s []setting
+	if cpu := res.CPU; cpu != nil {
+		if cpu.Shares != nil {
+			s = append(s, setting{"cpu", "cpu.shares", strconv.FormatUint(*cpu.Shares, 10)})
+		}
+		// The period must be set first, since the quota can't exceed
+		// it.
+		if cpu.Period != nil {
+			s = append(s, setting{"cpu", "cpu.cfs_period_us", strconv.FormatUint(*cpu.Period, 10)})
+		}
+		if cpu.Quota != nil {
+			s = append(s, setting{"cpu", "cpu.cfs_quota_us", strconv.FormatInt(*cpu.Quota, 10)})
+		}
+	}
+	if mem := res.Memory; mem != nil {
+		if mem.Limit != nil {
+			// As in the sentry, a limit of 0 or less means unlimited.
+			limit := "-1"
+			if *mem.Limit > 0 {
+				limit = strconv.FormatInt(*mem.Limit, 10)
+			}
+			s = append(s, setting{"memory", "memory.limit_in_bytes", limit})
+		}
+		if mem.Reservation != nil {
+			s = append(s, setting{"memory", "memory.soft_limit_in_bytes", strconv.FormatInt(*mem.Reservation, 10)})
+		}
+	}
+	if pids := res.Pids; pids != nil {
+		// Per the runtime spec, a limit of 0 or -1 means unlimited.
+		limit := "max"
+		if pids.Limit > 0 {
+			limit = strconv.FormatInt(pids.Limit, 10)
+		}
+		s = append(s, setting{"pids", "pids.max", limit})
+	}
+	return s
+}
+
+// Update changes the limits of the cgroup to those set in res; limits that
+// aren't set in res are unchanged. If a limit can't be set, the limits set
+// before it are restored and an error is returned. Otherwise, Update returns a
+// function that restores the limits that it changed.
+func (c *Cgroup) Update(res *specs.LinuxResources) (func(), error) {
+	var done []setting
+	restore := func() {
+		for i := len(done) - 1; i >= 0; i-- {
+			s := done[i]
+			if err := writeFile(c.dir(s.controller), s.file, s.value); err != nil {
+				log.Warningf("Error restoring %q of cgroup %q: %v", s.file, c.Path, err)
+			}
+		}
+	}
+	for _, s := range settings(res) {
+		old, err := ioutil.ReadFile(filepath.Join(c.dir(s.controller), s.file))
+		if err != nil {
+			restore()
+			return nil, fmt.Errorf("error reading cgroup file: %v", err)
+		}
+		if err := writeFile(c.dir(s.controller), s.file, s.value); err != nil {
+			restore()
+			return nil, err
+		}
+		done = append(done, setting{s.controller, s.file, strings.TrimSpace(string(old))})
+	}
+	return restore, nil
+}
+
+// writeFile writes value to the cgroup file name in dir.
+func writeFile(dir, name, value string) error {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(value), 0644); err != nil {
+		return fmt.Errorf("error writing %q to %q: %v", value, path, err)
+	}
+	log.Debugf("Set %q to %q", path, value)
+	return nil
+}
@@ -0,0 +1,215 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cgroup
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// defaults are the initial contents of the cgroup files in tests.
+var defaults = map[string]string{
+	"cpu/cpu.shares":                    "1024",
+	"cpu/cpu.cfs_period_us":             "100000",
+	"cpu/cpu.cfs_quota_us":              "-1",
+	"memory/memory.limit_in_bytes":      "9223372036854771712",
+	"memory/memory.soft_limit_in_bytes": "9223372036854771712",
+	"pids/pids.max":                     "max",
+}
+
+// setupRoot points cgroupRoot to a temporary directory, with a hierarchy for
+// each controller.
+func setupRoot(t *testing.T) {
+	root, err := ioutil.TempDir("", "cgroup")
+	if err != nil {
+		t.Fatalf("error creating temporary directory: %v", err)
+	}
+	cgroupRoot = root
+	for _, ctrl := range controllers {
+		if err := os.Mkdir(filepath.Join(root, ctrl), 0755); err != nil {
+			t.Fatalf("error creating controller hierarchy: %v", err)
+		}
+	}
+}
+
+// setup points cgroupRoot to a temporary directory, and installs a cgroup in
+// it with the default files.
+func setup(t *testing.T) *Cgroup {
+	setupRoot(t)
+	root := cgroupRoot
+	c, err := New(&specs.Spec{Linux: &specs.Linux{CgroupsPath: "sandbox"}})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if err := c.Install(nil); err != nil {
+		t.Fatalf("Install failed: %v", err)
+	}
+	for name, value := range defaults {
+		if err := ioutil.WriteFile(filepath.Join(root, filepath.Dir(name), c.Path, filepath.Base(name)), []byte(value+"\n"), 0644); err != nil {
+			t.Fatalf("error writing %q: %v", name, err)
+		}
+	}
+	return c
+}
+
+// read returns the contents of the file name of c, relative to the root.
+func read(t *testing.T, c *Cgroup, name string) string {
+	b, err := ioutil.ReadFile(filepath.Join(cgroupRoot, filepath.Dir(name), c.Path, filepath.Base(name)))
+	if err != nil {
+		t.Fatalf("error reading %q: %v", name, err)
+	}
+	return string(b)
+}
+
+func TestNew(t *testing.T) {
+	setupRoot(t)
+	defer os.RemoveAll(cgroupRoot)
+
+	for _, test := range []struct {
+		path string
+		want string
+	}{
+		{path: "", want: ""},
+		{path: "/docker/abc", want: "/docker/abc"},
+		{path: "abc", want: "/abc"},
+		// Systemd cgroups aren't supported, and are skipped.
+		{path: "system.slice:docker:abc", want: ""},
+	} {
+		c, err := New(&specs.Spec{Linux: &specs.Linux{CgroupsPath: test.path}})
+		if err != nil {
+			t.Errorf("New(%q) got error %v", test.path, err)
+			continue
+		}
+		got := ""
+		if c != nil {
+			got = c.Path
+		}
+		if got != test.want {
+			t.Errorf("New(%q) got path %q, want %q", test.path, got, test.want)
+		}
+	}
+}
+
+func TestNewWithoutV1Hierarchy(t *testing.T) {
+	setupRoot(t)
+	defer os.RemoveAll(cgroupRoot)
+
+	// Hosts that only mount the unified hierarchy don't have the v1
+	// controller directories.
+	if err := os.RemoveAll(filepath.Join(cgroupRoot, "pids")); err != nil {
+		t.Fatalf("error removing controller hierarchy: %v", err)
+	}
+	c, err := New(&specs.Spec{Linux: &specs.Linux{CgroupsPath: "/docker/abc"}})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if c != nil {
+		t.Errorf("New got cgroup %+v, want nil", c)
+	}
+}
+
+func TestUpdateUnlimitedMemory(t *testing.T) {
+	c := setup(t)
+	defer os.RemoveAll(cgroupRoot)
+
+	for _, limit := range []int64{0, -1} {
+		limit := limit
+		if _, err := c.Update(&specs.LinuxResources{Memory: &specs.LinuxMemory{Limit: &limit}}); err != nil {
+			t.Fatalf("Update failed: %v", err)
+		}
+		if got, want := read(t, c, "memory/memory.limit_in_bytes"), "-1"; got != want {
+			t.Errorf("memory.limit_in_bytes got %q for limit %d, want %q", got, limit, want)
+		}
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	c := setup(t)
+	defer os.RemoveAll(cgroupRoot)
+
+	quota, period := int64(50000), uint64(100000)
+	limit := int64(1 << 30)
+	restore, err := c.Update(&specs.LinuxResources{
+		CPU:    &specs.LinuxCPU{Quota: &quota, Period: &period},
+		Memory: &specs.LinuxMemory{Limit: &limit},
+		Pids:   &specs.LinuxPids{Limit: 100},
+	})
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	for name, want := range map[string]string{
+		"cpu/cpu.shares":               "1024\n",
+		"cpu/cpu.cfs_quota_us":         "50000",
+		"memory/memory.limit_in_bytes": "1073741824",
+		"pids/pids.max":                "100",
+	} {
+		if got := read(t, c, name); got != want {
+			t.Errorf("%s got %q, want %q", name, got, want)
+		}
+	}
+
+	restore()
+	for name, want := range defaults {
+		if got := read(t, c, name); got != want && got != want+"\n" {
+			t.Errorf("%s got %q after restore, want %q", name, got, want)
+		}
+	}
+}
+
+func TestUpdateFailure(t *testing.T) {
+	c := setup(t)
+	defer os.RemoveAll(cgroupRoot)
+
+	// Writing pids.max fails, so the memory limit must be restored.
+	pidsMax := filepath.Join(cgroupRoot, "pids", c.Path, "pids.max")
+	if err := os.Remove(pidsMax); err != nil {
+		t.Fatalf("error removing pids.max: %v", err)
+	}
+	if err := os.Mkdir(pidsMax, 0755); err != nil {
+		t.Fatalf("error creating pids.max: %v", err)
+	}
+	limit := int64(1 << 30)
+	if _, err := c.Update(&specs.LinuxResources{
+		Memory: &specs.LinuxMemory{Limit: &limit},
+		Pids:   &specs.LinuxPids{Limit: 100},
+	}); err == nil {
+		t.Fatalf("Update got nil error, want error")
+	}
+	if got, want := read(t, c, "memory/memory.limit_in_bytes"), defaults["memory/memory.limit_in_bytes"]; got != want {
+		t.Errorf("memory.limit_in_bytes got %q after failed update, want %q", got, want)
+	}
+}
+
+func TestUninstall(t *testing.T) {
+	c := setup(t)
+	defer os.RemoveAll(cgroupRoot)
+
+	// Only empty directories can be removed, as in cgroupfs.
+	for name := range defaults {
+		os.Remove(filepath.Join(cgroupRoot, filepath.Dir(name), c.Path, filepath.Base(name)))
+	}
+	if err := c.Uninstall(); err != nil {
+		t.Fatalf("Uninstall failed: %v", err)
+	}
+	for _, ctrl := range controllers {
+		if _, err := os.Stat(c.dir(ctrl)); !os.IsNotExist(err) {
+			t.Errorf("cgroup %q still exists: %v", c.dir(ctrl), err)
+		}
+	}
+}
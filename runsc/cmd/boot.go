@@ -41,6 +41,32 @@ type Boot struct {
 	// ioFDs is the list of FDs used to connect to FS gofers.
 	ioFDs intFlags
 
+	// deviceFDs is the list of FDs of the host devices that are proxied
+	// into the sandbox, in the order of Config.DeviceProxy.
+	deviceFDs intFlags
+
+	// bridgeFDs is the list of FDs connected to the gofer for each abstract
+	// socket bridge, in the order of Config.AbstractBridges.
+	bridgeFDs intFlags
+
+	// resourceReportFD is the FD of the file where the resource report is
+	// written when the sandbox exits, or -1 if there is none.
+	resourceReportFD int
+
+	// timeLimitImageFD and timeLimitReportFD are the FDs of the files
+	// where the sandbox is checkpointed and the time limit report is
+	// written if the time limit is exceeded, or -1 if there are none.
+	timeLimitImageFD  int
+	timeLimitReportFD int
+
+	// restoreFD is the FD of the checkpoint image that the sandbox is
+	// restored from, or -1 if the container's process is started instead.
+	restoreFD int
+
+	// restoreRebind holds the mount rebindings of the restore, as passed to
+	// "runsc restore --rebind".
+	restoreRebind stringSlice
+
 	// console is set to true if the sandbox should allow terminal ioctl(2)
 	// syscalls.
 	console bool
@@ -62,7 +88,7 @@ func (*Boot) Synopsis() string {
 
 // Usage implements subcommands.Command.Usage.
 func (*Boot) Usage() string {
-	return `boot [flags]`
+	return `boot [flags] <container id>`
 }
 
 // SetFlags implements subcommands.Command.SetFlags.
@@ -70,6 +96,13 @@ func (b *Boot) SetFlags(f *flag.FlagSet) {
 	f.StringVar(&b.bundleDir, "bundle", "", "required path to the root of the bundle directory")
 	f.IntVar(&b.controllerFD, "controller-fd", -1, "required FD of a stream socket for the control server that must be donated to this process")
 	f.Var(&b.ioFDs, "io-fds", "list of FDs to connect 9P clients. They must follow this order: root first, then mounts as defined in the spec")
+	f.Var(&b.deviceFDs, "device-fds", "list of FDs of the host devices to proxy, in the order of --device-proxy")
+	f.Var(&b.bridgeFDs, "bridge-fds", "list of FDs connected to the gofer for each abstract socket bridge, in the order of --abstract-bridge")
+	f.IntVar(&b.resourceReportFD, "resource-report-fd", -1, "FD of the file where the resource report is written when the sandbox exits, in the format of --resource-report")
+	f.IntVar(&b.timeLimitImageFD, "time-limit-image-fd", -1, "FD of the file where the sandbox is checkpointed if it exceeds its time limit, as in --time-limit-image")
+	f.IntVar(&b.timeLimitReportFD, "time-limit-report-fd", -1, "FD of the file where the report is written if the sandbox exceeds its time limit, as in --time-limit-report")
+	f.IntVar(&b.restoreFD, "restore-fd", -1, "FD of the checkpoint image that the sandbox is restored from instead of starting the container's process")
+	f.Var(&b.restoreRebind, "restore-rebind", "<saved destination>:<destination> restores the mount at the saved destination from the bind mount at destination, as in runsc restore --rebind; may be repeated")
 	f.BoolVar(&b.console, "console", false, "set to true if the sandbox should allow terminal ioctl(2) syscalls")
 	f.BoolVar(&b.applyCaps, "apply-caps", false, "if true, apply capabilities defined in the spec to the process")
 }
@@ -77,7 +110,7 @@ func (b *Boot) SetFlags(f *flag.FlagSet) {
 // Execute implements subcommands.Command.Execute.  It starts a sandbox in a
 // waiting state.
 func (b *Boot) Execute(_ context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
-	if b.bundleDir == "" || b.controllerFD == -1 || f.NArg() != 0 {
+	if b.bundleDir == "" || b.controllerFD == -1 || f.NArg() != 1 {
 		f.Usage()
 		return subcommands.ExitUsageError
 	}
@@ -102,6 +135,9 @@ func (b *Boot) Execute(_ context.Context, f *flag.FlagSet, args ...interface{})
 
 	conf := args[0].(*boot.Config)
 	waitStatus := args[1].(*syscall.WaitStatus)
+	if conf.RestoreRebind, err = parseRebind(b.restoreRebind); err != nil {
+		Fatalf("%v", err)
+	}
 
 	if b.applyCaps {
 		caps := spec.Process.Capabilities
@@ -127,7 +163,7 @@ func (b *Boot) Execute(_ context.Context, f *flag.FlagSet, args ...interface{})
 	}
 
 	// Create the loader.
-	l, err := boot.New(spec, conf, b.controllerFD, b.ioFDs.GetArray(), b.console)
+	l, err := boot.New(f.Arg(0), spec, conf, b.controllerFD, b.restoreFD, b.ioFDs.GetArray(), b.deviceFDs.GetArray(), b.bridgeFDs.GetArray(), b.console)
 	if err != nil {
 		Fatalf("error creating loader: %v", err)
 	}
@@ -141,8 +177,25 @@ func (b *Boot) Execute(_ context.Context, f *flag.FlagSet, args ...interface{})
 		Fatalf("error running sandbox: %v", err)
 	}
 
+	// Enforce the time limits, if any, from the start of the application.
+	var image, report *os.File
+	if b.timeLimitImageFD != -1 {
+		image = os.NewFile(uintptr(b.timeLimitImageFD), "time limit image file")
+	}
+	if b.timeLimitReportFD != -1 {
+		report = os.NewFile(uintptr(b.timeLimitReportFD), "time limit report file")
+	}
+	l.StartTimeLimit(image, report)
+
 	ws := l.WaitExit()
 	log.Infof("application exiting with %+v", ws)
+	if b.resourceReportFD != -1 {
+		f := os.NewFile(uintptr(b.resourceReportFD), "resource report file")
+		if err := l.WriteResourceReport(f, ws); err != nil {
+			log.Warningf("Error writing resource report: %v", err)
+		}
+		f.Close()
+	}
 	*waitStatus = syscall.WaitStatus(ws.Status())
 	return subcommands.ExitSuccess
 }
@@ -16,17 +16,34 @@ package cmd
 
 import (
 	"os"
+	"path/filepath"
 
 	"context"
 	"flag"
 	"github.com/google/subcommands"
 	"gvisor.googlesource.com/gvisor/runsc/boot"
 	"gvisor.googlesource.com/gvisor/runsc/container"
+	"gvisor.googlesource.com/gvisor/runsc/criu"
 )
 
+// checkpointImage is the name of the state file in image directories.
+const checkpointImage = "checkpoint.img"
+
+// checkpointImagePath returns the path of the state file given by the
+// image-path flag path. If path is a directory, dir is path.
+func checkpointImagePath(path string) (imagePath, dir string) {
+	// Docker and Podman pass a directory, in which runc saves CRIU images.
+	if fi, err := os.Stat(path); err == nil && fi.IsDir() {
+		return filepath.Join(path, checkpointImage), path
+	}
+	return path, ""
+}
+
 // Checkpoint implements subcommands.Command for the "checkpoint" command.
 type Checkpoint struct {
-	imagePath string
+	imagePath    string
+	incremental  bool
+	leaveRunning bool
 }
 
 // Name implements subcommands.Command.Name.
@@ -42,12 +59,17 @@ func (*Checkpoint) Synopsis() string {
 // Usage implements subcommands.Command.Usage.
 func (*Checkpoint) Usage() string {
 	return `checkpoint [flags] <container id> - save current state of container.
+
+If image-path is a directory, as with runc, the state is saved to
+checkpoint.img in it, along with CRIU images describing the processes.
 `
 }
 
 // SetFlags implements subcommands.Command.SetFlags.
 func (c *Checkpoint) SetFlags(f *flag.FlagSet) {
-	f.StringVar(&c.imagePath, "image-path", "", "path to saved container image")
+	f.StringVar(&c.imagePath, "image-path", "", "path to saved container image, or to a directory to save it to with CRIU metadata")
+	f.BoolVar(&c.incremental, "incremental", false, "save only the memory that changed since the previous checkpoint; requires the previous checkpoint to have used --leave-running")
+	f.BoolVar(&c.leaveRunning, "leave-running", false, "keep the container running after the checkpoint")
 }
 
 // Execute implements subcommands.Command.Execute.
@@ -70,16 +92,24 @@ func (c *Checkpoint) Execute(_ context.Context, f *flag.FlagSet, args ...interfa
 		Fatalf("image-path flag must be provided")
 	}
 
+	imagePath, dir := checkpointImagePath(c.imagePath)
+
 	// Create the image file and open for writing.
-	file, err := os.OpenFile(c.imagePath, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0644)
+	file, err := os.OpenFile(imagePath, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0644)
 	if err != nil {
-		Fatalf("os.OpenFile(%q) failed: %v", c.imagePath, err)
+		Fatalf("os.OpenFile(%q) failed: %v", imagePath, err)
 	}
 	defer file.Close()
 
-	if err := cont.Checkpoint(file); err != nil {
+	inv, err := cont.Checkpoint(file, c.incremental, c.leaveRunning)
+	if err != nil {
 		Fatalf("checkpoint failed: %v", err)
 	}
+	if dir != "" && inv != nil {
+		if err := criu.WriteImages(dir, inv); err != nil {
+			Fatalf("error writing CRIU images: %v", err)
+		}
+	}
 
 	return subcommands.ExitSuccess
 }
@@ -0,0 +1,45 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckpointImagePath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "state")
+
+	for _, tc := range []struct {
+		path      string
+		wantImage string
+		wantDir   string
+	}{
+		{path: dir, wantImage: filepath.Join(dir, checkpointImage), wantDir: dir},
+		{path: file, wantImage: file},
+	} {
+		image, d := checkpointImagePath(tc.path)
+		if image != tc.wantImage || d != tc.wantDir {
+			t.Errorf("checkpointImagePath(%q) got (%q, %q), want (%q, %q)", tc.path, image, d, tc.wantImage, tc.wantDir)
+		}
+	}
+}
@@ -69,6 +69,25 @@ func (i *intFlags) Set(s string) error {
 	return nil
 }
 
+// stringFlags can be used with string flags that appear multiple times.
+type stringFlags []string
+
+// String implements flag.Value.
+func (s *stringFlags) String() string {
+	return fmt.Sprintf("%v", *s)
+}
+
+// Get implements flag.Value.
+func (s *stringFlags) Get() interface{} {
+	return s
+}
+
+// Set implements flag.Value.
+func (s *stringFlags) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
 // setCapsAndCallSelf sets capabilities to the current thread and then execve's
 // itself again with the arguments specified in 'args' to restart the process
 // with the desired capabilities.
@@ -0,0 +1,132 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"flag"
+	"github.com/google/subcommands"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/control"
+	"gvisor.googlesource.com/gvisor/runsc/boot"
+	"gvisor.googlesource.com/gvisor/runsc/container"
+)
+
+// Debug implements subcommands.Command for the "debug" command.
+type Debug struct {
+	opts         control.MaintenanceOpts
+	flightRecord bool
+	processLog   bool
+}
+
+// Name implements subcommands.Command.Name.
+func (*Debug) Name() string {
+	return "debug"
+}
+
+// Synopsis implements subcommands.Command.Synopsis.
+func (*Debug) Synopsis() string {
+	return "run maintenance tasks and gather diagnostics in a running sandbox"
+}
+
+// Usage implements subcommands.Command.Usage.
+func (*Debug) Usage() string {
+	return `debug [flags] <container id> - run maintenance tasks in the container's sandbox.
+`
+}
+
+// SetFlags implements subcommands.Command.SetFlags.
+func (d *Debug) SetFlags(f *flag.FlagSet) {
+	f.BoolVar(&d.opts.DropCaches, "drop-caches", false, "release cached dentries, and the inodes and file contents that they hold")
+	f.BoolVar(&d.opts.CompactHeap, "compact-heap", false, "run the sentry garbage collector and return free memory to the host")
+	f.BoolVar(&d.opts.NetworkDiagnostics, "network", false, "print the state of the sandbox network stack")
+	f.BoolVar(&d.opts.CompatReport, "compat-report", false, "print the unsupported syscalls and ioctls invoked by the application as JSON, instead of the summary")
+	f.BoolVar(&d.opts.HeapProfile, "profile-heap", false, "print the sentry heap held by each process and filesystem of the container as JSON, instead of the summary")
+	f.BoolVar(&d.flightRecord, "flight-record", false, "print the recent goroutine stacks and task states sampled by the flight recorder, see --flight-recorder-period. Can't be combined with other flags.")
+	f.BoolVar(&d.processLog, "process-log", false, "print the recent process fork, exec and exit events as JSON, see --process-log-size. Can't be combined with other flags.")
+}
+
+// Execute implements subcommands.Command.Execute.
+func (d *Debug) Execute(_ context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+	if f.NArg() != 1 {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+
+	id := f.Arg(0)
+	conf := args[0].(*boot.Config)
+
+	if d.flightRecord && (d.processLog || d.opts != (control.MaintenanceOpts{})) {
+		Fatalf("--flight-record can't be combined with other flags")
+	}
+	if d.processLog && d.opts != (control.MaintenanceOpts{}) {
+		Fatalf("--process-log can't be combined with other flags")
+	}
+
+	c, err := container.Load(conf.RootDir, id)
+	if err != nil {
+		Fatalf("error loading container: %v", err)
+	}
+	if d.flightRecord {
+		if err := c.FlightRecord(os.Stdout); err != nil {
+			Fatalf("error dumping flight record: %v", err)
+		}
+		return subcommands.ExitSuccess
+	}
+	if d.processLog {
+		events, err := c.ProcessEvents()
+		if err != nil {
+			Fatalf("error getting process events: %v", err)
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(events); err != nil {
+			Fatalf("error encoding process events: %v", err)
+		}
+		return subcommands.ExitSuccess
+	}
+	res, err := c.Maintain(&d.opts)
+	if err != nil {
+		Fatalf("error running maintenance: %v", err)
+	}
+
+	if res.Compat != nil {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(res.Compat); err != nil {
+			Fatalf("error encoding compatibility report: %v", err)
+		}
+		return subcommands.ExitSuccess
+	}
+	if res.Heap != nil {
+		res.Heap.Container = c.ID
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(res.Heap); err != nil {
+			Fatalf("error encoding heap profile: %v", err)
+		}
+		return subcommands.ExitSuccess
+	}
+
+	fmt.Printf("Sentry heap: %d -> %d bytes\n", res.SentryHeapBefore, res.SentryHeapAfter)
+	fmt.Printf("Application memory: %d -> %d bytes\n", res.AppMemoryBefore, res.AppMemoryAfter)
+	if res.Network != "" {
+		fmt.Print(res.Network)
+	}
+	return subcommands.ExitSuccess
+}
@@ -76,8 +76,8 @@ func (d *Delete) execute(ids []string, conf *boot.Config) error {
 			}
 			return fmt.Errorf("error loading container %q: %v", id, err)
 		}
-		if !d.force && (c.Status == container.Running) {
-			return fmt.Errorf("cannot stop running container without --force flag")
+		if !d.force && (c.Status == container.Running || c.Status == container.Paused) {
+			return fmt.Errorf("cannot stop %s container without --force flag", c.Status)
 		}
 		if err := c.Destroy(); err != nil {
 			return fmt.Errorf("error destroying container: %v", err)
@@ -0,0 +1,379 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"context"
+	"flag"
+	"github.com/google/subcommands"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"gvisor.googlesource.com/gvisor/pkg/log"
+	"gvisor.googlesource.com/gvisor/runsc/boot"
+	"gvisor.googlesource.com/gvisor/runsc/container"
+	"gvisor.googlesource.com/gvisor/runsc/specutils"
+)
+
+// Do implements subcommands.Command for the "do" command. It runs a command
+// in a sandbox whose root filesystem is the host's, without an OCI bundle.
+type Do struct {
+	cwd      string
+	user     string
+	volumes  stringFlags
+	envFiles stringFlags
+	publish  stringFlags
+	uidMaps  stringFlags
+	gidMaps  stringFlags
+}
+
+// Name implements subcommands.Command.Name.
+func (*Do) Name() string {
+	return "do"
+}
+
+// Synopsis implements subcommands.Command.Synopsis.
+func (*Do) Synopsis() string {
+	return "run a command in a sandbox, without an OCI bundle"
+}
+
+// Usage implements subcommands.Command.Usage.
+func (*Do) Usage() string {
+	return `do [flags] <cmd> [cmd args...] - run a command in a sandbox whose root filesystem is the host's.
+
+The host's root filesystem is mounted read-only, and /tmp is an empty tmpfs.
+Host directories can be mounted writable with --volume, or all writes can be
+kept in memory with the global --overlay flag. The command inherits the
+environment and, unless --cwd is given, the working directory of runsc.
+
+OPTIONS:
+`
+}
+
+// SetFlags implements subcommands.Command.SetFlags.
+func (d *Do) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&d.cwd, "cwd", "", "working directory of the command in the sandbox, default is the current working directory")
+	f.StringVar(&d.user, "user", "0:0", "<uid>[:<gid>] that the command runs as in the sandbox")
+	f.Var(&d.volumes, "volume", "<host path>:<sandbox path>[:ro] to bind mount a host file or directory in the sandbox, can be repeated")
+	f.Var(&d.envFiles, "env-file", "file with <name>=<value> lines to add to the environment of the command, can be repeated. A line with just <name> copies the variable from the environment of runsc.")
+	f.Var(&d.publish, "publish", "[host address:]<host port>:<sandbox port> to forward TCP connections from a host port, which listens on localhost unless a host address is given, to a port on the sandbox's loopback address, can be repeated")
+	f.Var(&d.uidMaps, "uid-map", "<sandbox uid>:<host uid>:<size> to map sandbox UIDs to host UIDs in a new user namespace, can be repeated. Requires --gid-map.")
+	f.Var(&d.gidMaps, "gid-map", "<sandbox gid>:<host gid>:<size> to map sandbox GIDs to host GIDs in a new user namespace, can be repeated. Requires --uid-map.")
+}
+
+// Execute implements subcommands.Command.Execute.
+func (d *Do) Execute(_ context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+	if f.NArg() == 0 {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+
+	conf := args[0].(*boot.Config)
+	waitStatus := args[1].(*syscall.WaitStatus)
+
+	if len(d.publish) > 0 && conf.Network == boot.NetworkHost {
+		Fatalf("--publish can't be used with --network=host, the sandbox uses host ports directly")
+	}
+	spec, err := d.makeSpec(f.Args())
+	if err != nil {
+		Fatalf("%v", err)
+	}
+
+	ws, err := d.run(spec, conf)
+	if err != nil {
+		Fatalf("%v", err)
+	}
+	*waitStatus = ws
+	return subcommands.ExitSuccess
+}
+
+// makeSpec returns the spec of a container that runs args.
+func (d *Do) makeSpec(args []string) (*specs.Spec, error) {
+	cwd := d.cwd
+	if cwd == "" {
+		cwd = getwdOrDie()
+	}
+	if !filepath.IsAbs(cwd) {
+		return nil, fmt.Errorf("--cwd %q is not an absolute path", cwd)
+	}
+	user, err := parseUser(d.user)
+	if err != nil {
+		return nil, err
+	}
+	env := os.Environ()
+	for _, name := range d.envFiles {
+		vars, err := readEnvFile(name)
+		if err != nil {
+			return nil, err
+		}
+		env = mergeEnv(env, vars)
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("error getting hostname: %v", err)
+	}
+
+	spec := &specs.Spec{
+		Version: specs.Version,
+		Root: &specs.Root{
+			Path:     "/",
+			Readonly: true,
+		},
+		Process: &specs.Process{
+			Args: args,
+			Cwd:  cwd,
+			Env:  env,
+			User: user,
+		},
+		Hostname: hostname,
+		Linux:    &specs.Linux{},
+	}
+	for _, v := range d.volumes {
+		m, err := parseVolume(v)
+		if err != nil {
+			return nil, err
+		}
+		spec.Mounts = append(spec.Mounts, m)
+	}
+
+	if (len(d.uidMaps) == 0) != (len(d.gidMaps) == 0) {
+		return nil, fmt.Errorf("--uid-map and --gid-map must be used together")
+	}
+	for _, s := range d.uidMaps {
+		m, err := parseIDMapping(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --uid-map: %v", err)
+		}
+		spec.Linux.UIDMappings = append(spec.Linux.UIDMappings, m)
+	}
+	for _, s := range d.gidMaps {
+		m, err := parseIDMapping(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --gid-map: %v", err)
+		}
+		spec.Linux.GIDMappings = append(spec.Linux.GIDMappings, m)
+	}
+	if len(spec.Linux.UIDMappings) > 0 {
+		spec.Linux.Namespaces = append(spec.Linux.Namespaces, specs.LinuxNamespace{Type: specs.UserNamespace})
+	}
+	return spec, nil
+}
+
+// run runs the container of spec in a new sandbox, publishes its ports, and
+// waits for it to exit.
+func (d *Do) run(spec *specs.Spec, conf *boot.Config) (syscall.WaitStatus, error) {
+	// Listen before the sandbox is created, so that ports that are in use
+	// are reported early.
+	ports := make(map[net.Listener]uint16)
+	for _, p := range d.publish {
+		hostAddr, port, err := parsePortForward(p)
+		if err != nil {
+			return 0, err
+		}
+		l, err := net.Listen("tcp", hostAddr)
+		if err != nil {
+			return 0, fmt.Errorf("error listening on %q: %v", hostAddr, err)
+		}
+		defer l.Close()
+		ports[l] = port
+	}
+
+	// The gofer reads the spec from the bundle.
+	bundleDir, err := ioutil.TempDir("", "runsc-do")
+	if err != nil {
+		return 0, fmt.Errorf("error creating bundle dir: %v", err)
+	}
+	defer os.RemoveAll(bundleDir)
+	b, err := json.Marshal(spec)
+	if err != nil {
+		return 0, err
+	}
+	if err := ioutil.WriteFile(filepath.Join(bundleDir, "config.json"), b, 0644); err != nil {
+		return 0, fmt.Errorf("error writing spec: %v", err)
+	}
+	specutils.LogSpec(spec)
+
+	id := fmt.Sprintf("runsc-do-%d", os.Getpid())
+	c, err := container.Create(id, spec, conf, bundleDir, "", "")
+	if err != nil {
+		return 0, fmt.Errorf("error creating container: %v", err)
+	}
+	defer c.Destroy()
+	if err := c.Start(conf); err != nil {
+		return 0, fmt.Errorf("error starting container: %v", err)
+	}
+
+	for l, port := range ports {
+		log.Infof("Publishing %s as port %d in container %q", l.Addr(), port, id)
+		go publishPort(c, l, port)
+	}
+	return c.Wait()
+}
+
+// publishPort forwards the connections accepted on l to port in the sandbox
+// of c, until l is closed.
+func publishPort(c *container.Container, l net.Listener, port uint16) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go forwardConn(c, port, conn.(*net.TCPConn))
+	}
+}
+
+// parseUser parses a user of the form <uid>[:<gid>]. The GID is 0 if it isn't
+// given.
+func parseUser(s string) (specs.User, error) {
+	parts := strings.SplitN(s, ":", 2)
+	uid, err := strconv.ParseUint(parts[0], 10, 32)
+	if err != nil {
+		return specs.User{}, fmt.Errorf("invalid UID in user %q", s)
+	}
+	var gid uint64
+	if len(parts) == 2 {
+		gid, err = strconv.ParseUint(parts[1], 10, 32)
+		if err != nil {
+			return specs.User{}, fmt.Errorf("invalid GID in user %q", s)
+		}
+	}
+	return specs.User{UID: uint32(uid), GID: uint32(gid)}, nil
+}
+
+// parseVolume parses a bind mount of the form <host path>:<sandbox
+// path>[:ro|rw].
+func parseVolume(s string) (specs.Mount, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" {
+		return specs.Mount{}, fmt.Errorf("invalid volume %q: want <host path>:<sandbox path>[:ro]", s)
+	}
+	src, err := filepath.Abs(parts[0])
+	if err != nil {
+		return specs.Mount{}, err
+	}
+	if _, err := os.Stat(src); err != nil {
+		return specs.Mount{}, fmt.Errorf("invalid volume %q: %v", s, err)
+	}
+	if !filepath.IsAbs(parts[1]) {
+		return specs.Mount{}, fmt.Errorf("invalid volume %q: sandbox path must be absolute", s)
+	}
+	m := specs.Mount{
+		Type:        "bind",
+		Source:      src,
+		Destination: filepath.Clean(parts[1]),
+	}
+	if len(parts) == 3 {
+		switch parts[2] {
+		case "ro":
+			m.Options = []string{"ro"}
+		case "rw":
+		default:
+			return specs.Mount{}, fmt.Errorf("invalid volume %q: mode must be 'ro' or 'rw'", s)
+		}
+	}
+	return m, nil
+}
+
+// parseIDMapping parses an ID mapping of the form <sandbox id>:<host
+// id>:<size>.
+func parseIDMapping(s string) (specs.LinuxIDMapping, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return specs.LinuxIDMapping{}, fmt.Errorf("%q is not <sandbox id>:<host id>:<size>", s)
+	}
+	var ids [3]uint32
+	for i, p := range parts {
+		id, err := strconv.ParseUint(p, 10, 32)
+		if err != nil {
+			return specs.LinuxIDMapping{}, fmt.Errorf("invalid ID %q in %q", p, s)
+		}
+		ids[i] = uint32(id)
+	}
+	if ids[2] == 0 {
+		return specs.LinuxIDMapping{}, fmt.Errorf("empty mapping %q", s)
+	}
+	return specs.LinuxIDMapping{ContainerID: ids[0], HostID: ids[1], Size: ids[2]}, nil
+}
+
+// readEnvFile reads the environment variables in the file name, see
+// parseEnv.
+func readEnvFile(name string) ([]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("error opening env file: %v", err)
+	}
+	defer f.Close()
+	env, err := parseEnv(f)
+	if err != nil {
+		return nil, fmt.Errorf("invalid env file %q: %v", name, err)
+	}
+	return env, nil
+}
+
+// parseEnv parses lines of the form <name>=<value>. Empty lines and lines that
+// start with '#' are ignored, and a line with just <name> copies the variable
+// from the environment, if it is set.
+func parseEnv(r io.Reader) ([]string, error) {
+	var env []string
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimLeft(s.Text(), " \t")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		name := strings.TrimSpace(parts[0])
+		if name == "" || strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf("line %d: invalid variable name %q", n, parts[0])
+		}
+		if len(parts) == 1 {
+			if val, ok := os.LookupEnv(name); ok {
+				env = append(env, name+"="+val)
+			}
+			continue
+		}
+		env = append(env, name+"="+parts[1])
+	}
+	return env, s.Err()
+}
+
+// mergeEnv returns env with the variables in vars added, replacing variables
+// of the same name.
+func mergeEnv(env, vars []string) []string {
+	index := make(map[string]int)
+	for i, v := range env {
+		index[strings.SplitN(v, "=", 2)[0]] = i
+	}
+	for _, v := range vars {
+		name := strings.SplitN(v, "=", 2)[0]
+		if i, ok := index[name]; ok {
+			env[i] = v
+			continue
+		}
+		index[name] = len(env)
+		env = append(env, v)
+	}
+	return env
+}
@@ -0,0 +1,99 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func TestParseVolume(t *testing.T) {
+	for _, tc := range []struct {
+		in      string
+		want    specs.Mount
+		wantErr bool
+	}{
+		{in: "/tmp:/data", want: specs.Mount{Type: "bind", Source: "/tmp", Destination: "/data"}},
+		{in: "/tmp:/data/:rw", want: specs.Mount{Type: "bind", Source: "/tmp", Destination: "/data"}},
+		{in: "/tmp:/data:ro", want: specs.Mount{Type: "bind", Source: "/tmp", Destination: "/data", Options: []string{"ro"}}},
+		{in: "/tmp", wantErr: true},
+		{in: "/tmp:data", wantErr: true},
+		{in: "/tmp:/data:rx", wantErr: true},
+		{in: "/nonexistent/path:/data", wantErr: true},
+	} {
+		got, err := parseVolume(tc.in)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("parseVolume(%q) succeeded, want error", tc.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseVolume(%q) failed: %v", tc.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("parseVolume(%q) = %+v, want %+v", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestParseIDMapping(t *testing.T) {
+	got, err := parseIDMapping("0:1000:1")
+	if err != nil {
+		t.Fatalf("parseIDMapping failed: %v", err)
+	}
+	if want := (specs.LinuxIDMapping{ContainerID: 0, HostID: 1000, Size: 1}); got != want {
+		t.Errorf("parseIDMapping = %+v, want %+v", got, want)
+	}
+	for _, in := range []string{"0:1000", "0:1000:0", "0:-1:1", "a:b:c"} {
+		if _, err := parseIDMapping(in); err == nil {
+			t.Errorf("parseIDMapping(%q) succeeded, want error", in)
+		}
+	}
+}
+
+func TestParseEnv(t *testing.T) {
+	const file = `
+# A comment.
+FOO=bar
+  EMPTY=
+URL=http://example.com/?a=b
+RUNSC_DO_TEST_UNSET
+`
+	got, err := parseEnv(strings.NewReader(file))
+	if err != nil {
+		t.Fatalf("parseEnv failed: %v", err)
+	}
+	want := []string{"FOO=bar", "EMPTY=", "URL=http://example.com/?a=b"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseEnv = %q, want %q", got, want)
+	}
+
+	if _, err := parseEnv(strings.NewReader("=value\n")); err == nil {
+		t.Errorf("parseEnv succeeded with an empty name, want error")
+	}
+}
+
+func TestMergeEnv(t *testing.T) {
+	got := mergeEnv([]string{"A=1", "B=2"}, []string{"B=3", "C=4", "C=5"})
+	want := []string{"A=1", "B=3", "C=5"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeEnv = %q, want %q", got, want)
+	}
+}
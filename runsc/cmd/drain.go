@@ -0,0 +1,86 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"syscall"
+	"time"
+
+	"context"
+	"flag"
+	"github.com/google/subcommands"
+	"gvisor.googlesource.com/gvisor/runsc/boot"
+	"gvisor.googlesource.com/gvisor/runsc/container"
+)
+
+// Drain implements subcommands.Command for the "drain" command.
+type Drain struct {
+	signal     string
+	resetAfter time.Duration
+}
+
+// Name implements subcommands.Command.Name.
+func (*Drain) Name() string {
+	return "drain"
+}
+
+// Synopsis implements subcommands.Command.Synopsis.
+func (*Drain) Synopsis() string {
+	return "stops accepting new connections and signals the container"
+}
+
+// Usage implements subcommands.Command.Usage.
+func (*Drain) Usage() string {
+	return `drain [flags] <container id> - refuse new connections to the container, keep the existing ones, and signal the container so that it can shut down gracefully.
+`
+}
+
+// SetFlags implements subcommands.Command.SetFlags.
+func (d *Drain) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&d.signal, "signal", "TERM", "signal to send to the container once it is draining; empty to send none")
+	f.DurationVar(&d.resetAfter, "reset-after", 0, "reset the remaining TCP connections after this long; 0 to never reset them")
+}
+
+// Execute implements subcommands.Command.Execute.
+func (d *Drain) Execute(_ context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+	if f.NArg() != 1 {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+
+	id := f.Arg(0)
+	conf := args[0].(*boot.Config)
+
+	if d.resetAfter < 0 {
+		Fatalf("reset-after must not be negative")
+	}
+
+	var sig syscall.Signal
+	if d.signal != "" {
+		var err error
+		if sig, err = parseSignal(d.signal); err != nil {
+			Fatalf("%v", err)
+		}
+	}
+
+	c, err := container.Load(conf.RootDir, id)
+	if err != nil {
+		Fatalf("error loading container: %v", err)
+	}
+	if err := c.Drain(sig, d.resetAfter); err != nil {
+		Fatalf("%v", err)
+	}
+	return subcommands.ExitSuccess
+}
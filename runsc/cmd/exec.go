@@ -49,6 +49,11 @@ type Exec struct {
 	detach      bool
 	processPath string
 	pidFile     string
+
+	// nice and cpus constrain the scheduling of the new process, so that
+	// exec'd processes can't starve the container's workload.
+	nice int
+	cpus cpuList
 }
 
 // Name implements subcommands.Command.Name.
@@ -90,6 +95,8 @@ func (ex *Exec) SetFlags(f *flag.FlagSet) {
 	f.BoolVar(&ex.detach, "detach", false, "detach from the container's process")
 	f.StringVar(&ex.processPath, "process", "", "path to the process.json")
 	f.StringVar(&ex.pidFile, "pid-file", "", "filename that the container pid will be written to")
+	f.IntVar(&ex.nice, "nice", 0, "niceness of the process, from -20 (highest priority) to 19 (lowest priority)")
+	f.Var(&ex.cpus, "cpus", "CPUs that the process may run on (e.g. '0-3,6'). Defaults to all CPUs")
 }
 
 // Execute implements subcommands.Command.Execute. It starts a process in an
@@ -239,6 +246,8 @@ func (ex *Exec) argsFromCLI(argv []string) (*control.ExecArgs, error) {
 		KGID:             ex.user.kgid,
 		ExtraKGIDs:       extraKGIDs,
 		Capabilities:     caps,
+		Niceness:         ex.nice,
+		CPUs:             ex.cpus,
 	}, nil
 }
 
@@ -252,7 +261,15 @@ func (ex *Exec) argsFromProcessFile() (*control.ExecArgs, error) {
 	if err := json.NewDecoder(f).Decode(&p); err != nil {
 		return nil, fmt.Errorf("error parsing process file: %s, %v", ex.processPath, err)
 	}
-	return argsFromProcess(&p)
+	e, err := argsFromProcess(&p)
+	if err != nil {
+		return nil, err
+	}
+	// The process spec has no scheduling constraints, so they always come
+	// from the command line.
+	e.Niceness = ex.nice
+	e.CPUs = ex.cpus
+	return e, nil
 }
 
 // argsFromProcess performs all the non-IO conversion from the Process struct
@@ -375,3 +392,44 @@ func (u *user) Set(s string) error {
 	}
 	return nil
 }
+
+// cpuList allows -cpus to convey a list of CPUs in the format used by
+// cpuset(7), e.g. "0-3,6".
+type cpuList []uint
+
+// String implements flag.Value.String.
+func (c *cpuList) String() string {
+	return fmt.Sprintf("%v", *c)
+}
+
+// Get implements flag.Value.Get.
+func (c *cpuList) Get() interface{} {
+	return c
+}
+
+// Set implements flag.Value.Set.
+func (c *cpuList) Set(s string) error {
+	var cpus cpuList
+	for _, r := range strings.Split(s, ",") {
+		parts := strings.SplitN(r, "-", 2)
+		first, err := strconv.ParseUint(parts[0], 10, 32)
+		if err != nil {
+			return fmt.Errorf("couldn't parse CPU: %s", parts[0])
+		}
+		last := first
+		if len(parts) > 1 {
+			last, err = strconv.ParseUint(parts[1], 10, 32)
+			if err != nil {
+				return fmt.Errorf("couldn't parse CPU: %s", parts[1])
+			}
+			if last < first {
+				return fmt.Errorf("invalid CPU range: %s", r)
+			}
+		}
+		for cpu := first; cpu <= last; cpu++ {
+			cpus = append(cpus, uint(cpu))
+		}
+	}
+	*c = cpus
+	return nil
+}
@@ -58,6 +58,37 @@ func TestUser(t *testing.T) {
 	}
 }
 
+func TestCPUList(t *testing.T) {
+	testCases := []struct {
+		input   string
+		want    cpuList
+		wantErr bool
+	}{
+		{input: "0", want: cpuList{0}},
+		{input: "0-3", want: cpuList{0, 1, 2, 3}},
+		{input: "1,4-5,7", want: cpuList{1, 4, 5, 7}},
+		{input: "", wantErr: true},
+		{input: "foo", wantErr: true},
+		{input: "3-1", wantErr: true},
+		{input: "1-", wantErr: true},
+		{input: "-1", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		var c cpuList
+		if err := c.Set(tc.input); err != nil && tc.wantErr {
+			// We got an error and wanted one.
+			continue
+		} else if err == nil && tc.wantErr {
+			t.Errorf("cpuList.Set(%s): got no error, but wanted one", tc.input)
+		} else if err != nil && !tc.wantErr {
+			t.Errorf("cpuList.Set(%s): got error %v, but wanted none", tc.input, err)
+		} else if !cmp.Equal(c, tc.want) {
+			t.Errorf("cpuList.Set(%s): got %v, but wanted %v", tc.input, c, tc.want)
+		}
+	}
+}
+
 func TestCLIArgs(t *testing.T) {
 	testCases := []struct {
 		ex       Exec
@@ -71,6 +102,8 @@ func TestCLIArgs(t *testing.T) {
 				extraKGIDs:  []string{"1", "2", "3"},
 				caps:        []string{"CAP_DAC_OVERRIDE"},
 				processPath: "",
+				nice:        10,
+				cpus:        cpuList{0, 1},
 			},
 			argv: []string{"ls", "/"},
 			expected: control.ExecArgs{
@@ -86,6 +119,8 @@ func TestCLIArgs(t *testing.T) {
 					InheritableCaps: auth.CapabilitySetOf(linux.CAP_DAC_OVERRIDE),
 					PermittedCaps:   auth.CapabilitySetOf(linux.CAP_DAC_OVERRIDE),
 				},
+				Niceness: 10,
+				CPUs:     []uint{0, 1},
 			},
 		},
 	}
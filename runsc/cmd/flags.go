@@ -0,0 +1,99 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"context"
+	"flag"
+	"github.com/google/subcommands"
+	"gvisor.googlesource.com/gvisor/runsc/boot"
+	"gvisor.googlesource.com/gvisor/runsc/container"
+)
+
+// Flags implements subcommands.Command for the "flags" command. It extends
+// the command generated by subcommands.FlagsCommand, which describes the
+// top-level flags, with a "set" action.
+type Flags struct{}
+
+// Name implements subcommands.Command.Name.
+func (*Flags) Name() string {
+	return "flags"
+}
+
+// Synopsis implements subcommands.Command.Synopsis.
+func (*Flags) Synopsis() string {
+	return "describe all known top-level flags, or change flags of a running sandbox"
+}
+
+// Usage implements subcommands.Command.Usage.
+func (*Flags) Usage() string {
+	return fmt.Sprintf(`flags [<subcommand>] - describe all known top-level flags, or the flags of <subcommand>.
+flags set <container id> <flag>=<value>... - change flags of the container's sandbox, without restarting it.
+
+The flags that can be set are: %s.
+`, strings.Join(boot.DynamicFlags, ", "))
+}
+
+// SetFlags implements subcommands.Command.SetFlags.
+func (*Flags) SetFlags(*flag.FlagSet) {}
+
+// Execute implements subcommands.Command.Execute.
+func (*Flags) Execute(ctx context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+	if f.NArg() == 0 || f.Arg(0) != "set" {
+		return subcommands.FlagsCommand().Execute(ctx, f, args...)
+	}
+	if f.NArg() < 3 {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+
+	id := f.Arg(1)
+	conf := args[0].(*boot.Config)
+
+	flags, err := parseFlagValues(f.Args()[2:])
+	if err != nil {
+		Fatalf("%v", err)
+	}
+
+	c, err := container.Load(conf.RootDir, id)
+	if err != nil {
+		Fatalf("error loading container: %v", err)
+	}
+	if err := c.SetFlags(flags); err != nil {
+		Fatalf("error setting flags: %v", err)
+	}
+	return subcommands.ExitSuccess
+}
+
+// parseFlagValues parses a list of <flag>=<value>, where the flag name may
+// start with dashes.
+func parseFlagValues(args []string) (map[string]string, error) {
+	flags := make(map[string]string)
+	for _, arg := range args {
+		parts := strings.SplitN(arg, "=", 2)
+		name := strings.TrimLeft(parts[0], "-")
+		if len(parts) != 2 || name == "" {
+			return nil, fmt.Errorf("%q is not <flag>=<value>", arg)
+		}
+		if _, ok := flags[name]; ok {
+			return nil, fmt.Errorf("flag %q is set more than once", name)
+		}
+		flags[name] = parts[1]
+	}
+	return flags, nil
+}
@@ -0,0 +1,56 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseFlagValues(t *testing.T) {
+	for _, tc := range []struct {
+		in      []string
+		want    map[string]string
+		wantErr bool
+	}{
+		{in: []string{"debug=true"}, want: map[string]string{"debug": "true"}},
+		{
+			in: []string{"--strace=true", "-strace-syscalls=read,%network", "debug="},
+			want: map[string]string{
+				"strace":          "true",
+				"strace-syscalls": "read,%network",
+				"debug":           "",
+			},
+		},
+		{in: []string{"debug"}, wantErr: true},
+		{in: []string{"--=true"}, wantErr: true},
+		{in: []string{"debug=true", "--debug=false"}, wantErr: true},
+	} {
+		got, err := parseFlagValues(tc.in)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("parseFlagValues(%q) succeeded, want error", tc.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseFlagValues(%q) failed: %v", tc.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("parseFlagValues(%q) = %v, want %v", tc.in, got, tc.want)
+		}
+	}
+}
@@ -15,8 +15,10 @@
 package cmd
 
 import (
+	"io"
 	"os"
 	"sync"
+	"syscall"
 
 	"context"
 	"flag"
@@ -25,6 +27,7 @@ import (
 	"gvisor.googlesource.com/gvisor/pkg/log"
 	"gvisor.googlesource.com/gvisor/pkg/p9"
 	"gvisor.googlesource.com/gvisor/pkg/unet"
+	"gvisor.googlesource.com/gvisor/runsc/boot"
 	"gvisor.googlesource.com/gvisor/runsc/fsgofer"
 	"gvisor.googlesource.com/gvisor/runsc/specutils"
 )
@@ -34,6 +37,7 @@ import (
 type Gofer struct {
 	bundleDir string
 	ioFDs     intFlags
+	bridgeFDs intFlags
 	applyCaps bool
 }
 
@@ -56,6 +60,7 @@ func (*Gofer) Usage() string {
 func (g *Gofer) SetFlags(f *flag.FlagSet) {
 	f.StringVar(&g.bundleDir, "bundle", "", "path to the root of the bundle directory, defaults to the current directory")
 	f.Var(&g.ioFDs, "io-fds", "list of FDs to connect 9P servers. They must follow this order: root first, then mounts as defined in the spec")
+	f.Var(&g.bridgeFDs, "bridge-fds", "list of FDs to serve abstract socket bridges, in the order of --abstract-bridge")
 	f.BoolVar(&g.applyCaps, "apply-caps", true, "if true, apply capabilities to restrict what the Gofer process can do")
 }
 
@@ -66,6 +71,8 @@ func (g *Gofer) Execute(_ context.Context, f *flag.FlagSet, args ...interface{})
 		return subcommands.ExitUsageError
 	}
 
+	conf := args[0].(*boot.Config)
+
 	spec, err := specutils.ReadSpec(g.bundleDir)
 	if err != nil {
 		Fatalf("error reading spec: %v", err)
@@ -98,57 +105,169 @@ func (g *Gofer) Execute(_ context.Context, f *flag.FlagSet, args ...interface{})
 
 	specutils.LogSpec(spec)
 
+	var profile *fsgofer.Profile
+	if conf.GoferProfile != "" {
+		profile, err = fsgofer.LoadProfile(conf.GoferProfile)
+		if err != nil {
+			Fatalf("%v", err)
+		}
+	}
+
+	// Each mount is served over the same number of FDs.
+	channels := conf.MountFDs()
+	if len(g.ioFDs)%channels != 0 {
+		Fatalf("Got %d FDs for mounts, not a multiple of %d channels", len(g.ioFDs), channels)
+	}
+
 	// Start with root mount, then add any other addition mount as needed.
 	ats := make([]p9.Attacher, 0, len(spec.Mounts)+1)
+	mounts := make([]donatedMount, 0, len(spec.Mounts)+1)
 	p := absPath(g.bundleDir, spec.Root.Path)
-	ats = append(ats, fsgofer.NewAttachPoint(p, fsgofer.Config{
+	mounts = append(mounts, donatedMount{path: p, readonly: spec.Root.Readonly})
+	ats = append(ats, fsgofer.NewAttachPoint(p, profile.Apply("/", fsgofer.Config{
 		ROMount: spec.Root.Readonly,
 		// Docker uses overlay2 by default for the root mount, and overlay2 does a copy-up when
 		// each file is opened as writable. Thus, we open files lazily to avoid copy-up.
 		LazyOpenForWrite: true,
-	}))
-	log.Infof("Serving %q mapped to %q on FD %d", "/", p, g.ioFDs[0])
+		HostNotify:       conf.HostNotify,
+	})))
+	log.Infof("Serving %q mapped to %q on FDs %v", "/", p, g.ioFDs[:channels])
 
 	mountIdx := 1 // first one is the root
 	for _, m := range spec.Mounts {
 		if specutils.Is9PMount(m) {
 			p = absPath(g.bundleDir, m.Source)
-			ats = append(ats, fsgofer.NewAttachPoint(p, fsgofer.Config{
+			mounts = append(mounts, donatedMount{path: p, readonly: isReadonlyMount(m.Options)})
+			ats = append(ats, fsgofer.NewAttachPoint(p, profile.Apply(m.Destination, fsgofer.Config{
 				ROMount:          isReadonlyMount(m.Options),
 				LazyOpenForWrite: false,
-			}))
+				HostNotify:       conf.HostNotify,
+			})))
 
-			if mountIdx >= len(g.ioFDs) {
+			if mountIdx*channels >= len(g.ioFDs) {
 				Fatalf("No FD found for mount. Did you forget --io-fd? mount: %d, %v", len(g.ioFDs), m)
 			}
-			log.Infof("Serving %q mapped to %q on FD %d", m.Destination, p, g.ioFDs[mountIdx])
+			log.Infof("Serving %q mapped to %q on FDs %v", m.Destination, p, g.ioFDs[mountIdx*channels:(mountIdx+1)*channels])
 			mountIdx++
 		}
 	}
-	if mountIdx != len(g.ioFDs) {
+	if mountIdx*channels != len(g.ioFDs) {
 		Fatalf("Too many FDs passed for mounts. mounts: %d, FDs: %d", mountIdx, len(g.ioFDs))
 	}
 
-	runServers(ats, g.ioFDs)
+	if len(g.bridgeFDs) != len(conf.AbstractBridges) {
+		Fatalf("Got %d bridge FDs for %d abstract socket bridges", len(g.bridgeFDs), len(conf.AbstractBridges))
+	}
+	for i, b := range conf.AbstractBridges {
+		startAbstractBridge(b, g.bridgeFDs[i])
+	}
+
+	if conf.FileAccess == boot.FileAccessDonated {
+		donateMounts(mounts, g.ioFDs)
+		return subcommands.ExitSuccess
+	}
+	runServers(ats, g.ioFDs, channels, conf.GoferWorkers)
 	return subcommands.ExitSuccess
 }
 
-func runServers(ats []p9.Attacher, ioFDs []int) {
+// donatedMount is a mount whose root is donated to the sandbox.
+type donatedMount struct {
+	path     string
+	readonly bool
+}
+
+// donateMounts opens the root of each mount and sends its FD to the sandbox
+// over the corresponding FD of ioFDs. It then waits for the sandbox to close
+// the sockets, so that the gofer lives as long as the sandbox.
+func donateMounts(mounts []donatedMount, ioFDs []int) {
+	var wg sync.WaitGroup
+	for i, m := range mounts {
+		socket, err := unet.NewSocket(ioFDs[i])
+		if err != nil {
+			Fatalf("err creating socket on FD %d: %v", ioFDs[i], err)
+		}
+		fd, err := openMountRoot(m)
+		if err != nil {
+			Fatalf("err opening mount %q: %v", m.path, err)
+		}
+		w := socket.Writer(true /* blocking */)
+		w.PackFDs(fd)
+		if _, err := w.WriteVec([][]byte{{0}}); err != nil {
+			Fatalf("err donating mount %q on FD %d: %v", m.path, ioFDs[i], err)
+		}
+		syscall.Close(fd)
+		log.Infof("Donated %q on FD %d", m.path, ioFDs[i])
+
+		wg.Add(1)
+		go func() {
+			// The sandbox never writes to the socket, so this returns
+			// once it is closed.
+			var b [1]byte
+			socket.Read(b[:])
+			socket.Close()
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+	log.Infof("Sandbox closed all donated mounts.")
+}
+
+// openMountRoot opens the root of m to be donated. Writable mounts are opened
+// for writing if possible, so that file mounts can be written to.
+func openMountRoot(m donatedMount) (int, error) {
+	if !m.readonly {
+		fd, err := syscall.Open(m.path, syscall.O_RDWR|syscall.O_CLOEXEC, 0)
+		if err == nil {
+			return fd, nil
+		}
+		if err != syscall.EISDIR {
+			return -1, err
+		}
+	}
+	return syscall.Open(m.path, syscall.O_RDONLY|syscall.O_CLOEXEC, 0)
+}
+
+// startAbstractBridge serves the abstract socket bridge b to the sandbox on
+// bridgeFD. Exported sockets are bound before it returns.
+func startAbstractBridge(b boot.AbstractBridge, bridgeFD int) {
+	socket, err := unet.NewSocket(bridgeFD)
+	if err != nil {
+		Fatalf("err creating abstract socket bridge on FD %d: %v", bridgeFD, err)
+	}
+	ab := fsgofer.NewAbstractImport(b.Name)
+	if b.Export {
+		if ab, err = fsgofer.NewAbstractExport(b.Name, b.UIDs); err != nil {
+			Fatalf("%v", err)
+		}
+	}
+	log.Infof("Serving abstract socket bridge %v on FD %d", b, bridgeFD)
+	go func() {
+		if err := ab.Serve(socket); err != nil && err != io.EOF {
+			log.Warningf("Abstract socket bridge %v stopped: %v", b, err)
+		}
+	}()
+}
+
+func runServers(ats []p9.Attacher, ioFDs []int, channels, workers int) {
 	// Run the loops and wait for all to exit.
 	var wg sync.WaitGroup
-	for i, ioFD := range ioFDs {
+	for i, at := range ats {
 		wg.Add(1)
-		go func(ioFD int, at p9.Attacher) {
-			socket, err := unet.NewSocket(ioFD)
-			if err != nil {
-				Fatalf("err creating server on FD %d: %v", ioFD, err)
+		go func(fds []int, at p9.Attacher) {
+			var sockets []*unet.Socket
+			for _, ioFD := range fds {
+				socket, err := unet.NewSocket(ioFD)
+				if err != nil {
+					Fatalf("err creating server on FD %d: %v", ioFD, err)
+				}
+				sockets = append(sockets, socket)
 			}
 			s := p9.NewServer(at)
-			if err := s.Handle(socket); err != nil {
-				Fatalf("P9 server returned error. Gofer is shutting down. FD: %d, err: %v", ioFD, err)
+			if err := s.HandleChannels(sockets, workers); err != nil {
+				Fatalf("P9 server returned error. Gofer is shutting down. FDs: %v, err: %v", fds, err)
 			}
 			wg.Done()
-		}(ioFD, ats[i])
+		}(ioFDs[i*channels:(i+1)*channels], at)
 	}
 	wg.Wait()
 	log.Infof("All 9P servers exited.")
@@ -0,0 +1,101 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+
+	"context"
+	"flag"
+	"github.com/google/subcommands"
+	"gvisor.googlesource.com/gvisor/runsc/imagepolicy"
+)
+
+// ImagePolicy implements subcommands.Command for the "image-policy" command.
+type ImagePolicy struct {
+	layers bool
+	verity string
+}
+
+// Name implements subcommands.Command.Name.
+func (*ImagePolicy) Name() string {
+	return "image-policy"
+}
+
+// Synopsis implements subcommands.Command.Synopsis.
+func (*ImagePolicy) Synopsis() string {
+	return "print an image policy that matches a root filesystem"
+}
+
+// Usage implements subcommands.Command.Usage.
+func (*ImagePolicy) Usage() string {
+	return `image-policy [flags] <rootfs> - print an image policy that matches the root filesystem at <rootfs>, to be signed and passed to --image-policy.
+`
+}
+
+// SetFlags implements subcommands.Command.SetFlags.
+func (p *ImagePolicy) SetFlags(f *flag.FlagSet) {
+	f.BoolVar(&p.layers, "layers", false, "record the digests of the layers of the overlay mounted at <rootfs> instead of the digest of <rootfs>")
+	f.StringVar(&p.verity, "verity", "", "comma-separated list of files, relative to <rootfs>, whose fs-verity measurements are recorded")
+}
+
+// Execute implements subcommands.Command.Execute.
+func (p *ImagePolicy) Execute(_ context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+	if f.NArg() != 1 {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+	rootfs := f.Arg(0)
+
+	var policy imagepolicy.Policy
+	if p.layers {
+		layers, err := imagepolicy.OverlayLayers(rootfs)
+		if err != nil {
+			Fatalf("%v", err)
+		}
+		for _, layer := range layers {
+			d, err := imagepolicy.TreeDigest(layer)
+			if err != nil {
+				Fatalf("%v", err)
+			}
+			policy.Layers = append(policy.Layers, d)
+		}
+	} else {
+		d, err := imagepolicy.TreeDigest(rootfs)
+		if err != nil {
+			Fatalf("%v", err)
+		}
+		policy.Rootfs = d
+	}
+	if len(p.verity) != 0 {
+		policy.Verity = make(map[string]string)
+		for _, path := range strings.Split(p.verity, ",") {
+			d, err := imagepolicy.Measure(rootfs, path)
+			if err != nil {
+				Fatalf("%v", err)
+			}
+			policy.Verity[path] = d
+		}
+	}
+
+	b, err := json.MarshalIndent(&policy, "", "  ")
+	if err != nil {
+		Fatalf("error marshaling image policy: %v", err)
+	}
+	os.Stdout.Write(append(b, '\n'))
+	return subcommands.ExitSuccess
+}
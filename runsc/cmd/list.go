@@ -18,6 +18,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
 	"text/tabwriter"
 	"time"
 
@@ -25,6 +26,7 @@ import (
 	"flag"
 	"github.com/google/subcommands"
 	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"gvisor.googlesource.com/gvisor/pkg/log"
 	"gvisor.googlesource.com/gvisor/runsc/boot"
 	"gvisor.googlesource.com/gvisor/runsc/container"
 )
@@ -33,6 +35,7 @@ import (
 type List struct {
 	quiet  bool
 	format string
+	watch  bool
 }
 
 // Name implements subcommands.command.name.
@@ -54,6 +57,7 @@ func (*List) Usage() string {
 func (l *List) SetFlags(f *flag.FlagSet) {
 	f.BoolVar(&l.quiet, "quiet", false, "only list container ids")
 	f.StringVar(&l.format, "format", "text", "output format: 'text' (default) or 'json'")
+	f.BoolVar(&l.watch, "watch", false, "keep running and print a JSON event each time a container is added, removed or changes status")
 }
 
 // Execute implements subcommands.Command.Execute.
@@ -64,6 +68,13 @@ func (l *List) Execute(_ context.Context, f *flag.FlagSet, args ...interface{})
 	}
 
 	conf := args[0].(*boot.Config)
+	if l.watch {
+		if err := watchContainers(conf.RootDir, json.NewEncoder(os.Stdout)); err != nil {
+			Fatalf("%v", err)
+		}
+		return subcommands.ExitSuccess
+	}
+
 	ids, err := container.List(conf.RootDir)
 	if err != nil {
 		Fatalf("%v", err)
@@ -115,3 +126,90 @@ func (l *List) Execute(_ context.Context, f *flag.FlagSet, args ...interface{})
 	}
 	return subcommands.ExitSuccess
 }
+
+// livenessInterval is how often containers that are created or running are
+// checked for a sandbox that exited without updating their metadata.
+const livenessInterval = time.Second
+
+// listEvent is printed by list --watch for each change of a container.
+type listEvent struct {
+	// Type is "added", "changed" or "removed".
+	Type string `json:"type"`
+
+	ID string `json:"id"`
+
+	// State is the state of the container, unless it was removed.
+	State *specs.State `json:"state,omitempty"`
+
+	Time time.Time `json:"time"`
+}
+
+// watchContainers prints an "added" event for each container in rootDir, and
+// then an event each time a container is added, removed or changes status,
+// until an error occurs.
+func watchContainers(rootDir string, enc *json.Encoder) error {
+	w, err := container.NewWatcher(rootDir)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	// states are the last states printed, by container id.
+	states := make(map[string]specs.State)
+	update := func(id string) error {
+		last, known := states[id]
+		// Load also accepts abbreviated ids, so it could load another
+		// container if this one was deleted.
+		if _, err := os.Stat(filepath.Join(rootDir, id)); os.IsNotExist(err) {
+			if known {
+				delete(states, id)
+				return enc.Encode(listEvent{Type: "removed", ID: id, Time: time.Now()})
+			}
+			return nil
+		}
+		c, err := container.Load(rootDir, id)
+		if err != nil {
+			// The metadata may not be fully written yet, in which
+			// case another event follows.
+			log.Debugf("Error loading container %q: %v", id, err)
+			return nil
+		}
+		state := c.State()
+		typ := "added"
+		if known {
+			if state.Status == last.Status {
+				return nil
+			}
+			typ = "changed"
+		}
+		states[id] = state
+		return enc.Encode(listEvent{Type: typ, ID: id, State: &state, Time: time.Now()})
+	}
+
+	ids, err := container.List(rootDir)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := update(id); err != nil {
+			return err
+		}
+	}
+	for {
+		ids, err := w.Wait(livenessInterval)
+		if err != nil {
+			return err
+		}
+		for id, state := range states {
+			switch string(state.Status) {
+			case container.Created.String(), container.Running.String(), container.Paused.String():
+				ids = append(ids, id)
+			}
+		}
+		for _, id := range ids {
+			if err := update(id); err != nil {
+				return err
+			}
+		}
+	}
+}
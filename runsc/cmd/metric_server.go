@@ -0,0 +1,129 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+
+	"flag"
+	"github.com/google/subcommands"
+	"gvisor.googlesource.com/gvisor/pkg/log"
+	"gvisor.googlesource.com/gvisor/pkg/metric"
+	"gvisor.googlesource.com/gvisor/runsc/boot"
+	"gvisor.googlesource.com/gvisor/runsc/container"
+)
+
+// MetricServer implements subcommands.Command for the "metric-server"
+// command.
+type MetricServer struct {
+	addr string
+}
+
+// Name implements subcommands.Command.Name.
+func (*MetricServer) Name() string {
+	return "metric-server"
+}
+
+// Synopsis implements subcommands.Command.Synopsis.
+func (*MetricServer) Synopsis() string {
+	return "serve the metrics of all running sandboxes for Prometheus"
+}
+
+// Usage implements subcommands.Command.Usage.
+func (*MetricServer) Usage() string {
+	return `metric-server [flags] - serve the sentry metrics of all running sandboxes under --root.
+
+Metrics are served over HTTP at /metrics in the Prometheus text exposition
+format, labeled with the ID of the sandbox that they came from. Sandboxes are
+queried on every request.
+`
+}
+
+// SetFlags implements subcommands.Command.SetFlags.
+func (m *MetricServer) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&m.addr, "addr", "localhost:9090", "address to listen on: host:port for TCP, or unix:<path> for a Unix socket")
+}
+
+// Execute implements subcommands.Command.Execute.
+func (m *MetricServer) Execute(_ context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+	if f.NArg() != 0 {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+
+	conf := args[0].(*boot.Config)
+
+	network, addr := "tcp", m.addr
+	if strings.HasPrefix(addr, "unix:") {
+		network, addr = "unix", strings.TrimPrefix(addr, "unix:")
+	}
+	l, err := net.Listen(network, addr)
+	if err != nil {
+		Fatalf("error listening on %q: %v", m.addr, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		serveMetrics(conf, w)
+	})
+	log.Infof("Serving metrics on %s", m.addr)
+	if err := http.Serve(l, mux); err != nil {
+		Fatalf("error serving metrics: %v", err)
+	}
+	return subcommands.ExitSuccess
+}
+
+// serveMetrics writes the metrics of all running sandboxes to w.
+func serveMetrics(conf *boot.Config, w http.ResponseWriter) {
+	ids, err := container.List(conf.RootDir)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Containers may share a sandbox, so collect each sandbox's metrics
+	// only once. Sandboxes that can't be queried, e.g. because they have
+	// exited since being listed, are skipped.
+	var sources []metric.PrometheusSource
+	seen := make(map[string]bool)
+	for _, id := range ids {
+		c, err := container.Load(conf.RootDir, id)
+		if err != nil {
+			log.Warningf("Error loading container %q: %v", id, err)
+			continue
+		}
+		if c.Sandbox == nil || seen[c.Sandbox.ID] {
+			continue
+		}
+		seen[c.Sandbox.ID] = true
+		snaps, err := c.Sandbox.Metrics()
+		if err != nil {
+			log.Warningf("Error getting metrics: %v", err)
+			continue
+		}
+		sources = append(sources, metric.PrometheusSource{
+			Labels:  map[string]string{"sandbox": c.Sandbox.ID},
+			Metrics: snaps,
+		})
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	if err := metric.WritePrometheus(w, sources); err != nil {
+		log.Warningf("Error writing metrics: %v", err)
+	}
+}
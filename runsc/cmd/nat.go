@@ -0,0 +1,70 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"flag"
+	"github.com/google/subcommands"
+	"gvisor.googlesource.com/gvisor/pkg/log"
+	"gvisor.googlesource.com/gvisor/runsc/nat"
+)
+
+// NAT implements subcommands.Command for the "nat" command, which forwards
+// the network traffic of a sandbox to the host network. This command should
+// not be called directly.
+type NAT struct {
+	// fd is the FD of the socket connected to the sandbox.
+	fd int
+}
+
+// Name implements subcommands.Command.
+func (*NAT) Name() string {
+	return "nat"
+}
+
+// Synopsis implements subcommands.Command.
+func (*NAT) Synopsis() string {
+	return "launch a userspace NAT that connects a sandbox to the host network (internal use only)"
+}
+
+// Usage implements subcommands.Command.
+func (*NAT) Usage() string {
+	return `nat [flags]`
+}
+
+// SetFlags implements subcommands.Command.
+func (n *NAT) SetFlags(f *flag.FlagSet) {
+	f.IntVar(&n.fd, "fd", -1, "required FD of the socket connected to the sandbox")
+}
+
+// Execute implements subcommands.Command.
+func (n *NAT) Execute(_ context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+	if n.fd < 0 {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+
+	t, err := nat.New(n.fd)
+	if err != nil {
+		Fatalf("error creating NAT: %v", err)
+	}
+	log.Infof("NAT started on FD %d", n.fd)
+
+	// Run until the sandbox exits, closing its end of the socket.
+	t.Wait()
+	log.Infof("NAT: sandbox closed the link, exiting")
+	return subcommands.ExitSuccess
+}
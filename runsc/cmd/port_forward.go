@@ -0,0 +1,129 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"context"
+	"flag"
+	"github.com/google/subcommands"
+	"gvisor.googlesource.com/gvisor/pkg/log"
+	"gvisor.googlesource.com/gvisor/runsc/boot"
+	"gvisor.googlesource.com/gvisor/runsc/container"
+)
+
+// PortForward implements subcommands.Command for the "port-forward" command.
+type PortForward struct{}
+
+// Name implements subcommands.Command.Name.
+func (*PortForward) Name() string {
+	return "port-forward"
+}
+
+// Synopsis implements subcommands.Command.Synopsis.
+func (*PortForward) Synopsis() string {
+	return "forward a host port to a port in the container's network stack"
+}
+
+// Usage implements subcommands.Command.Usage.
+func (*PortForward) Usage() string {
+	return `port-forward <container id> [host address:]<host port>:<container port> - forward TCP connections to a port in the container.
+
+Connections accepted on the host port, which listens on localhost unless a
+host address is given, are forwarded over the sandbox's control socket to the
+container port on the sandbox's loopback address. This works for sandboxes
+with isolated networking, whose ports can't be reached from the host directly.
+The command runs until it is interrupted.
+`
+}
+
+// SetFlags implements subcommands.Command.SetFlags.
+func (*PortForward) SetFlags(f *flag.FlagSet) {}
+
+// Execute implements subcommands.Command.Execute.
+func (*PortForward) Execute(_ context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+	if f.NArg() != 2 {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+
+	id := f.Arg(0)
+	conf := args[0].(*boot.Config)
+
+	hostAddr, port, err := parsePortForward(f.Arg(1))
+	if err != nil {
+		Fatalf("%v", err)
+	}
+
+	c, err := container.Load(conf.RootDir, id)
+	if err != nil {
+		Fatalf("error loading container: %v", err)
+	}
+
+	l, err := net.Listen("tcp", hostAddr)
+	if err != nil {
+		Fatalf("error listening on %q: %v", hostAddr, err)
+	}
+	log.Infof("Forwarding %s to port %d in container %q", l.Addr(), port, id)
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			Fatalf("error accepting connection: %v", err)
+		}
+		go forwardConn(c, port, conn.(*net.TCPConn))
+	}
+}
+
+// forwardConn hands the host connection conn over to the sandbox, which
+// connects it to port.
+func forwardConn(c *container.Container, port uint16, conn *net.TCPConn) {
+	defer conn.Close()
+	f, err := conn.File()
+	if err != nil {
+		log.Warningf("Error getting connection file: %v", err)
+		return
+	}
+	defer f.Close()
+	if err := c.PortForward(port, f); err != nil {
+		log.Warningf("Error forwarding connection from %s: %v", conn.RemoteAddr(), err)
+	}
+}
+
+// parsePortForward parses a port forwarding specification of the form
+// [host address:]<host port>:<container port>. It returns the host address
+// to listen on and the container port.
+func parsePortForward(s string) (string, uint16, error) {
+	i := strings.LastIndex(s, ":")
+	if i < 0 {
+		return "", 0, fmt.Errorf("invalid port forwarding %q: want [host address:]<host port>:<container port>", s)
+	}
+	port, err := strconv.ParseUint(s[i+1:], 10, 16)
+	if err != nil || port == 0 {
+		return "", 0, fmt.Errorf("invalid container port in %q", s)
+	}
+
+	host, hostPort := "localhost", s[:i]
+	if j := strings.LastIndex(hostPort, ":"); j >= 0 {
+		host, hostPort = strings.Trim(hostPort[:j], "[]"), hostPort[j+1:]
+	}
+	if _, err := strconv.ParseUint(hostPort, 10, 16); err != nil {
+		return "", 0, fmt.Errorf("invalid host port in %q", s)
+	}
+	return net.JoinHostPort(host, hostPort), uint16(port), nil
+}
@@ -0,0 +1,52 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"testing"
+)
+
+func TestParsePortForward(t *testing.T) {
+	testCases := []struct {
+		input    string
+		wantAddr string
+		wantPort uint16
+		wantErr  bool
+	}{
+		{input: "8080:80", wantAddr: "localhost:8080", wantPort: 80},
+		{input: "0.0.0.0:8080:80", wantAddr: "0.0.0.0:8080", wantPort: 80},
+		{input: "[::1]:8080:80", wantAddr: "[::1]:8080", wantPort: 80},
+		{input: "", wantErr: true},
+		{input: "80", wantErr: true},
+		{input: "8080:", wantErr: true},
+		{input: "8080:0", wantErr: true},
+		{input: "8080:65536", wantErr: true},
+		{input: "foo:80", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		addr, port, err := parsePortForward(tc.input)
+		if err != nil && tc.wantErr {
+			// We got an error and wanted one.
+			continue
+		} else if err == nil && tc.wantErr {
+			t.Errorf("parsePortForward(%q): got no error, but wanted one", tc.input)
+		} else if err != nil && !tc.wantErr {
+			t.Errorf("parsePortForward(%q): got error %v, but wanted none", tc.input, err)
+		} else if addr != tc.wantAddr || port != tc.wantPort {
+			t.Errorf("parsePortForward(%q): got %q, %d, but wanted %q, %d", tc.input, addr, port, tc.wantAddr, tc.wantPort)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"flag"
+	"github.com/google/subcommands"
+	"gvisor.googlesource.com/gvisor/runsc/boot"
+	"gvisor.googlesource.com/gvisor/runsc/container"
+)
+
+// Profile implements subcommands.Command for the "profile" command.
+type Profile struct {
+	cpu      string
+	heap     string
+	block    string
+	mutex    string
+	duration time.Duration
+}
+
+// Name implements subcommands.Command.Name.
+func (*Profile) Name() string {
+	return "profile"
+}
+
+// Synopsis implements subcommands.Command.Synopsis.
+func (*Profile) Synopsis() string {
+	return "collect pprof profiles from a running sandbox"
+}
+
+// Usage implements subcommands.Command.Usage.
+func (*Profile) Usage() string {
+	return `profile [flags] <container id> - collect pprof profiles of the sentry in the container's sandbox.
+
+CPU, block and mutex profiles are collected concurrently over --duration.
+`
+}
+
+// SetFlags implements subcommands.Command.SetFlags.
+func (p *Profile) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&p.cpu, "cpu", "", "write a CPU profile to the given file")
+	f.StringVar(&p.heap, "heap", "", "write a heap profile to the given file")
+	f.StringVar(&p.block, "block", "", "write a profile of blocking on synchronization primitives to the given file")
+	f.StringVar(&p.mutex, "mutex", "", "write a mutex contention profile to the given file")
+	f.DurationVar(&p.duration, "duration", 30*time.Second, "time over which CPU, block and mutex profiles are collected")
+}
+
+// Execute implements subcommands.Command.Execute.
+func (p *Profile) Execute(_ context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+	if f.NArg() != 1 {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+
+	id := f.Arg(0)
+	conf := args[0].(*boot.Config)
+
+	c, err := container.Load(conf.RootDir, id)
+	if err != nil {
+		Fatalf("error loading container: %v", err)
+	}
+
+	profiles := []struct {
+		endpoint string
+		path     string
+	}{
+		{boot.ProfileCPU, p.cpu},
+		{boot.ProfileHeap, p.heap},
+		{boot.ProfileBlock, p.block},
+		{boot.ProfileMutex, p.mutex},
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(profiles))
+	requested := false
+	for _, prof := range profiles {
+		if prof.path == "" {
+			continue
+		}
+		requested = true
+		out, err := os.OpenFile(prof.path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err != nil {
+			Fatalf("error opening profile file %q: %v", prof.path, err)
+		}
+		wg.Add(1)
+		go func(endpoint string, out *os.File) {
+			defer wg.Done()
+			defer out.Close()
+			if err := c.Profile(endpoint, out, p.duration); err != nil {
+				errs <- fmt.Errorf("error writing %q: %v", out.Name(), err)
+			}
+		}(prof.endpoint, out)
+	}
+	if !requested {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+	wg.Wait()
+	close(errs)
+
+	failed := false
+	for err := range errs {
+		fmt.Fprintln(os.Stderr, err)
+		failed = true
+	}
+	if failed {
+		return subcommands.ExitFailure
+	}
+	return subcommands.ExitSuccess
+}
@@ -15,13 +15,30 @@
 package cmd
 
 import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"syscall"
+
 	"context"
 	"flag"
 	"github.com/google/subcommands"
+	"gvisor.googlesource.com/gvisor/runsc/boot"
+	"gvisor.googlesource.com/gvisor/runsc/container"
+	"gvisor.googlesource.com/gvisor/runsc/specutils"
 )
 
 // Restore implements subcommands.Command for the "restore" command.
 type Restore struct {
+	// Restore flags are a super-set of those for Create.
+	Create
+
+	// imagePath is the path to the saved container image.
+	imagePath string
+
+	// rebind holds the mounts that are restored from other mounts of the
+	// spec, as <saved destination>:<destination> pairs.
+	rebind stringSlice
 }
 
 // Name implements subcommands.Command.Name.
@@ -36,16 +53,84 @@ func (*Restore) Synopsis() string {
 
 // Usage implements subcommands.Command.Usage.
 func (*Restore) Usage() string {
-	return `restore [flags] <container id> - restore last saved state of container.
+	return `restore [flags] <container id> - create and run a secure container from a saved state.
+
+The container is created from the bundle, as with "runsc run", and its
+processes are restored from the image saved by "runsc checkpoint" instead of
+started. If image-path is a directory, the state is read from checkpoint.img in
+it. Only sandboxes with --file-access=proxy can be restored.
+
+The gofer mount that was at <saved> in the checkpointed container can be
+restored from the bind mount at <destination> in the spec with
+--rebind=<saved>:<destination>, e.g. if its volume moved. Files of a rebound
+mount must have the same type, size and modification time as when they were
+saved.
 `
 }
 
 // SetFlags implements subcommands.Command.SetFlags.
 func (r *Restore) SetFlags(f *flag.FlagSet) {
+	r.Create.SetFlags(f)
+	f.StringVar(&r.imagePath, "image-path", "", "path to saved container image, or to a directory containing it")
+	f.Var(&r.rebind, "rebind", "<saved destination>:<destination> restores the mount at the saved destination from the bind mount of the spec at destination; may be repeated")
 }
 
 // Execute implements subcommands.Command.Execute.
 func (r *Restore) Execute(_ context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
-	Fatalf("restore not implemented")
-	return subcommands.ExitFailure
+	if f.NArg() != 1 {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+
+	id := f.Arg(0)
+	conf := args[0].(*boot.Config)
+	waitStatus := args[1].(*syscall.WaitStatus)
+
+	if r.imagePath == "" {
+		Fatalf("image-path flag must be provided")
+	}
+	conf.RestoreFile, _ = checkpointImagePath(r.imagePath)
+	rebind, err := parseRebind(r.rebind)
+	if err != nil {
+		Fatalf("%v", err)
+	}
+	conf.RestoreRebind = rebind
+
+	bundleDir := r.bundleDir
+	if bundleDir == "" {
+		bundleDir = getwdOrDie()
+	}
+	spec, err := specutils.ReadSpec(bundleDir)
+	if err != nil {
+		Fatalf("error reading spec: %v", err)
+	}
+
+	ws, err := container.Run(id, spec, conf, bundleDir, r.consoleSocket, r.pidFile)
+	if err != nil {
+		Fatalf("error restoring container: %v", err)
+	}
+
+	*waitStatus = ws
+	return subcommands.ExitSuccess
+}
+
+// parseRebind parses mount rebindings given as <saved destination>:<destination>
+// pairs into a map from saved destination to destination.
+func parseRebind(pairs []string) (map[string]string, error) {
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+	rebind := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		parts := strings.Split(pair, ":")
+		if len(parts) != 2 || !filepath.IsAbs(parts[0]) || !filepath.IsAbs(parts[1]) {
+			return nil, fmt.Errorf("invalid mount rebinding %q, want <saved destination>:<destination> with absolute paths", pair)
+		}
+		saved := filepath.Clean(parts[0])
+		if _, ok := rebind[saved]; ok {
+			return nil, fmt.Errorf("mount %q is rebound more than once", saved)
+		}
+		rebind[saved] = filepath.Clean(parts[1])
+	}
+	return rebind, nil
 }
@@ -0,0 +1,43 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRebind(t *testing.T) {
+	got, err := parseRebind([]string{"/data:/volumes/data", "/cache/:/cache2"})
+	if err != nil {
+		t.Fatalf("parseRebind failed: %v", err)
+	}
+	want := map[string]string{"/data": "/volumes/data", "/cache": "/cache2"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseRebind got %v, want %v", got, want)
+	}
+
+	for _, pairs := range [][]string{
+		{"/data"},
+		{"data:/volumes/data"},
+		{"/data:volumes/data"},
+		{"/data:/a:/b"},
+		{"/data:/a", "/data/:/b"},
+	} {
+		if _, err := parseRebind(pairs); err == nil {
+			t.Errorf("parseRebind(%q) succeeded, want error", pairs)
+		}
+	}
+}
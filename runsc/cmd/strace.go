@@ -0,0 +1,121 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"context"
+	"flag"
+	"github.com/google/subcommands"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/strace"
+	"gvisor.googlesource.com/gvisor/runsc/boot"
+	"gvisor.googlesource.com/gvisor/runsc/container"
+)
+
+// Strace implements subcommands.Command for the "strace" command.
+type Strace struct {
+	off        bool
+	syscalls   string
+	pids       intFlags
+	errorsOnly bool
+	depth      string
+}
+
+// Name implements subcommands.Command.Name.
+func (*Strace) Name() string {
+	return "strace"
+}
+
+// Synopsis implements subcommands.Command.Synopsis.
+func (*Strace) Synopsis() string {
+	return "change which syscalls a running sandbox traces to its log"
+}
+
+// Usage implements subcommands.Command.Usage.
+func (*Strace) Usage() string {
+	return `strace [flags] <container id> - change which syscalls the container's sandbox traces to its log.
+
+The new settings replace those of --strace and --strace-syscalls, or of a
+previous strace command. Syscalls can be named individually, or by group with
+"%file", "%desc", "%network", "%process", "%signal", "%ipc" or "%memory".
+
+OPTIONS:
+`
+}
+
+// SetFlags implements subcommands.Command.SetFlags.
+func (s *Strace) SetFlags(f *flag.FlagSet) {
+	f.BoolVar(&s.off, "off", false, "stop tracing syscalls to the log")
+	f.StringVar(&s.syscalls, "syscalls", "", "comma-separated list of syscalls and syscall groups to trace, all if empty")
+	f.Var(&s.pids, "pid", "only trace the process or thread with this ID in the sandbox, can be repeated")
+	f.BoolVar(&s.errorsOnly, "errors-only", false, "only trace syscalls that fail")
+	f.StringVar(&s.depth, "depth", "", "comma-separated list of <syscall or group>=<raw|args|full>, which decode arguments as hex numbers, without buffer contents, or fully (default)")
+}
+
+// Execute implements subcommands.Command.Execute.
+func (s *Strace) Execute(_ context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+	if f.NArg() != 1 {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+
+	id := f.Arg(0)
+	conf := args[0].(*boot.Config)
+
+	sargs := boot.StraceArgs{Enable: !s.off}
+	if s.syscalls != "" {
+		sargs.Syscalls = strings.Split(s.syscalls, ",")
+	}
+	for _, pid := range s.pids.GetArray() {
+		sargs.Filter.TIDs = append(sargs.Filter.TIDs, int32(pid))
+	}
+	sargs.Filter.ErrorsOnly = s.errorsOnly
+	depth, err := parseStraceDepth(s.depth)
+	if err != nil {
+		Fatalf("invalid --depth: %v", err)
+	}
+	sargs.Filter.Depth = depth
+
+	c, err := container.Load(conf.RootDir, id)
+	if err != nil {
+		Fatalf("error loading container: %v", err)
+	}
+	if err := c.Strace(&sargs); err != nil {
+		Fatalf("error changing strace: %v", err)
+	}
+	return subcommands.ExitSuccess
+}
+
+// parseStraceDepth parses a comma-separated list of <name>=<depth>.
+func parseStraceDepth(s string) (map[string]strace.Depth, error) {
+	if s == "" {
+		return nil, nil
+	}
+	depth := make(map[string]strace.Depth)
+	for _, e := range strings.Split(s, ",") {
+		parts := strings.SplitN(e, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("%q is not <syscall>=<depth>", e)
+		}
+		d, err := strace.ParseDepth(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		depth[parts[0]] = d
+	}
+	return depth, nil
+}
@@ -0,0 +1,58 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	"gvisor.googlesource.com/gvisor/pkg/sentry/strace"
+)
+
+func TestParseStraceDepth(t *testing.T) {
+	for _, tc := range []struct {
+		in      string
+		want    map[string]strace.Depth
+		wantErr bool
+	}{
+		{in: "", want: nil},
+		{in: "read=raw", want: map[string]strace.Depth{"read": strace.DepthRaw}},
+		{
+			in: "read=args,%network=full",
+			want: map[string]strace.Depth{
+				"read":     strace.DepthArgs,
+				"%network": strace.DepthFull,
+			},
+		},
+		{in: "read", wantErr: true},
+		{in: "=raw", wantErr: true},
+		{in: "read=deep", wantErr: true},
+	} {
+		got, err := parseStraceDepth(tc.in)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("parseStraceDepth(%q) succeeded, want error", tc.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseStraceDepth(%q) failed: %v", tc.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("parseStraceDepth(%q) = %v, want %v", tc.in, got, tc.want)
+		}
+	}
+}
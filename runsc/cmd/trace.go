@@ -0,0 +1,84 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"flag"
+	"github.com/google/subcommands"
+	"gvisor.googlesource.com/gvisor/runsc/boot"
+	"gvisor.googlesource.com/gvisor/runsc/container"
+)
+
+// Trace implements subcommands.Command for the "trace" command.
+type Trace struct {
+	out      string
+	duration time.Duration
+}
+
+// Name implements subcommands.Command.Name.
+func (*Trace) Name() string {
+	return "trace"
+}
+
+// Synopsis implements subcommands.Command.Synopsis.
+func (*Trace) Synopsis() string {
+	return "collect an execution trace from a running sandbox"
+}
+
+// Usage implements subcommands.Command.Usage.
+func (*Trace) Usage() string {
+	return `trace [flags] <container id> - collect a Go runtime execution trace of the sentry in the container's sandbox.
+
+The trace records goroutine scheduling, syscalls and GC events over --duration,
+and can be viewed with "go tool trace".
+`
+}
+
+// SetFlags implements subcommands.Command.SetFlags.
+func (t *Trace) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&t.out, "out", "", "write the trace to the given file (required)")
+	f.DurationVar(&t.duration, "duration", 5*time.Second, "time over which the trace is collected")
+}
+
+// Execute implements subcommands.Command.Execute.
+func (t *Trace) Execute(_ context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+	if f.NArg() != 1 || t.out == "" {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+
+	id := f.Arg(0)
+	conf := args[0].(*boot.Config)
+
+	c, err := container.Load(conf.RootDir, id)
+	if err != nil {
+		Fatalf("error loading container: %v", err)
+	}
+
+	out, err := os.OpenFile(t.out, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		Fatalf("error opening trace file %q: %v", t.out, err)
+	}
+	defer out.Close()
+
+	if err := c.Profile(boot.ProfileTrace, out, t.duration); err != nil {
+		Fatalf("error collecting trace: %v", err)
+	}
+	return subcommands.ExitSuccess
+}
@@ -0,0 +1,156 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+
+	"context"
+	"flag"
+	"github.com/google/subcommands"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"gvisor.googlesource.com/gvisor/runsc/boot"
+	"gvisor.googlesource.com/gvisor/runsc/container"
+)
+
+// Update implements subcommands.Command for the "update" command.
+type Update struct {
+	memory            int64
+	memoryReservation int64
+	cpuShares         uint64
+	cpuQuota          int64
+	cpuPeriod         uint64
+	pidsLimit         int64
+	resources         string
+}
+
+// Name implements subcommands.Command.Name.
+func (*Update) Name() string {
+	return "update"
+}
+
+// Synopsis implements subcommands.Command.Synopsis.
+func (*Update) Synopsis() string {
+	return "update the resource limits of a container"
+}
+
+// Usage implements subcommands.Command.Usage.
+func (*Update) Usage() string {
+	return `update [flags] <container id> - update the resource limits of a container.
+
+The CPU, memory and pids limits are changed in the host cgroup of the sandbox
+and in the sentry. Limits that aren't given are unchanged. Flags override the
+limits read with --resources.
+`
+}
+
+// SetFlags implements subcommands.Command.SetFlags.
+func (u *Update) SetFlags(f *flag.FlagSet) {
+	f.Int64Var(&u.memory, "memory", 0, "memory limit in bytes; 0 or -1 removes the limit")
+	f.Int64Var(&u.memoryReservation, "memory-reservation", 0, "memory soft limit in bytes")
+	f.Uint64Var(&u.cpuShares, "cpu-shares", 0, "CPU shares, relative to other cgroups")
+	f.Int64Var(&u.cpuQuota, "cpu-quota", 0, "CPU time in microseconds the container can use per --cpu-period; -1 removes the limit")
+	f.Uint64Var(&u.cpuPeriod, "cpu-period", 0, "CPU CFS period in microseconds")
+	f.Int64Var(&u.pidsLimit, "pids-limit", 0, "maximum number of tasks; 0 or -1 removes the limit")
+	f.StringVar(&u.resources, "resources", "", "path to a file with the new resources as an OCI LinuxResources JSON object, or - for stdin")
+}
+
+// Execute implements subcommands.Command.Execute.
+func (u *Update) Execute(_ context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+	if f.NArg() != 1 {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+
+	id := f.Arg(0)
+	conf := args[0].(*boot.Config)
+
+	res := &specs.LinuxResources{}
+	if u.resources != "" {
+		r, err := readResources(u.resources)
+		if err != nil {
+			Fatalf("error reading resources: %v", err)
+		}
+		res = r
+	}
+	set := false
+	f.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "memory":
+			if res.Memory == nil {
+				res.Memory = &specs.LinuxMemory{}
+			}
+			res.Memory.Limit = &u.memory
+		case "memory-reservation":
+			if res.Memory == nil {
+				res.Memory = &specs.LinuxMemory{}
+			}
+			res.Memory.Reservation = &u.memoryReservation
+		case "cpu-shares":
+			if res.CPU == nil {
+				res.CPU = &specs.LinuxCPU{}
+			}
+			res.CPU.Shares = &u.cpuShares
+		case "cpu-quota":
+			if res.CPU == nil {
+				res.CPU = &specs.LinuxCPU{}
+			}
+			res.CPU.Quota = &u.cpuQuota
+		case "cpu-period":
+			if res.CPU == nil {
+				res.CPU = &specs.LinuxCPU{}
+			}
+			res.CPU.Period = &u.cpuPeriod
+		case "pids-limit":
+			res.Pids = &specs.LinuxPids{Limit: u.pidsLimit}
+		default:
+			return
+		}
+		set = true
+	})
+	if !set && u.resources == "" {
+		Fatalf("no resources to update")
+	}
+
+	c, err := container.Load(conf.RootDir, id)
+	if err != nil {
+		Fatalf("error loading container: %v", err)
+	}
+	if err := c.Update(res); err != nil {
+		Fatalf("%v", err)
+	}
+	return subcommands.ExitSuccess
+}
+
+// readResources reads a LinuxResources JSON object from path, or from stdin if
+// path is "-".
+func readResources(path string) (*specs.LinuxResources, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	var res specs.LinuxResources
+	if err := json.NewDecoder(r).Decode(&res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
@@ -0,0 +1,159 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+
+	"context"
+	"flag"
+	"github.com/google/subcommands"
+	"gvisor.googlesource.com/gvisor/runsc/boot"
+	"gvisor.googlesource.com/gvisor/runsc/container"
+)
+
+// statusPollInterval is how often the state of a container that isn't
+// running yet is checked.
+const statusPollInterval = 100 * time.Millisecond
+
+// Wait implements subcommands.Command for the "wait" command.
+type Wait struct {
+	timeout time.Duration
+	events  bool
+}
+
+// Name implements subcommands.Command.Name.
+func (*Wait) Name() string {
+	return "wait"
+}
+
+// Synopsis implements subcommands.Command.Synopsis.
+func (*Wait) Synopsis() string {
+	return "wait for a container to exit"
+}
+
+// Usage implements subcommands.Command.Usage.
+func (*Wait) Usage() string {
+	return `wait [flags] <container id> - wait for a container to exit
+
+Waits for the container to start running and exit, and prints its exit status as
+JSON. With --events, a JSON event is also printed each time the status of the
+container changes.
+
+OPTIONS:
+`
+}
+
+// SetFlags implements subcommands.Command.SetFlags.
+func (w *Wait) SetFlags(f *flag.FlagSet) {
+	f.DurationVar(&w.timeout, "timeout", 0, "fail if the container hasn't exited after this long, 0 waits forever")
+	f.BoolVar(&w.events, "events", false, "print an event for each change of the container's status")
+}
+
+// waitResult is printed when the container exits.
+type waitResult struct {
+	ID         string `json:"id"`
+	ExitStatus int    `json:"exitStatus"`
+}
+
+// statusEvent is printed for each change of the container's status.
+type statusEvent struct {
+	ID     string    `json:"id"`
+	Status string    `json:"status"`
+	Time   time.Time `json:"time"`
+}
+
+// Execute implements subcommands.Command.Execute.
+func (w *Wait) Execute(_ context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+	if f.NArg() != 1 {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+
+	id := f.Arg(0)
+	conf := args[0].(*boot.Config)
+
+	var deadline <-chan time.Time
+	if w.timeout > 0 {
+		deadline = time.After(w.timeout)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	var last string
+	for {
+		c, err := container.Load(conf.RootDir, id)
+		if err != nil {
+			Fatalf("error loading container: %v", err)
+		}
+		if status := c.Status.String(); w.events && status != last {
+			enc.Encode(statusEvent{ID: id, Status: status, Time: time.Now()})
+			last = status
+		}
+
+		switch c.Status {
+		case container.Running, container.Paused:
+			ws, err := waitDeadline(c, deadline)
+			if err != nil {
+				Fatalf("error waiting for container: %v", err)
+			}
+			if w.events {
+				enc.Encode(statusEvent{ID: id, Status: container.Stopped.String(), Time: time.Now()})
+			}
+			enc.Encode(waitResult{ID: id, ExitStatus: exitStatus(ws)})
+			return subcommands.ExitSuccess
+		case container.Stopped:
+			// The exit status is lost with the sandbox.
+			Fatalf("container %q has already stopped", id)
+		}
+
+		select {
+		case <-deadline:
+			Fatalf("timed out waiting for container %q", id)
+		case <-time.After(statusPollInterval):
+		}
+	}
+}
+
+// waitDeadline waits for the container to exit, until deadline fires.
+func waitDeadline(c *container.Container, deadline <-chan time.Time) (syscall.WaitStatus, error) {
+	type result struct {
+		ws  syscall.WaitStatus
+		err error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		ws, err := c.Wait()
+		ch <- result{ws, err}
+	}()
+	select {
+	case r := <-ch:
+		return r.ws, r.err
+	case <-deadline:
+		return 0, fmt.Errorf("timed out")
+	}
+}
+
+// exitStatus returns the exit status of a process as reported by a shell:
+// processes killed by a signal have 128 plus the signal number.
+func exitStatus(ws syscall.WaitStatus) int {
+	if ws.Signaled() {
+		return 128 + int(ws.Signal())
+	}
+	return ws.ExitStatus()
+}
@@ -0,0 +1,36 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"syscall"
+	"testing"
+)
+
+func TestExitStatus(t *testing.T) {
+	for _, tc := range []struct {
+		ws   syscall.WaitStatus
+		want int
+	}{
+		{ws: 0, want: 0},
+		{ws: 3 << 8, want: 3},
+		{ws: syscall.WaitStatus(syscall.SIGKILL), want: 137},
+		{ws: syscall.WaitStatus(syscall.SIGTERM), want: 143},
+	} {
+		if got := exitStatus(tc.ws); got != tc.want {
+			t.Errorf("exitStatus(%#x) = %d, want %d", uint32(tc.ws), got, tc.want)
+		}
+	}
+}
@@ -30,7 +30,9 @@ import (
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"gvisor.googlesource.com/gvisor/pkg/log"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/control"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
 	"gvisor.googlesource.com/gvisor/runsc/boot"
+	"gvisor.googlesource.com/gvisor/runsc/imagepolicy"
 	"gvisor.googlesource.com/gvisor/runsc/sandbox"
 	"gvisor.googlesource.com/gvisor/runsc/specutils"
 )
@@ -122,11 +124,11 @@ func Load(rootDir, id string) (*Container, error) {
 		return nil, fmt.Errorf("error unmarshaling container metadata from %q: %v", metaFile, err)
 	}
 
-	// If the status is "Running" or "Created", check that the sandbox
-	// process still exists, and set it to Stopped if it does not.
+	// If the status is "Running", "Created" or "Paused", check that the
+	// sandbox process still exists, and set it to Stopped if it does not.
 	//
 	// This is inherently racey.
-	if c.Status == Running || c.Status == Created {
+	if c.Status == Running || c.Status == Created || c.Status == Paused {
 		// Check if the sandbox process is still running.
 		if c.Sandbox.IsRunning() {
 			// TODO: Send a message into the sandbox to
@@ -204,6 +206,14 @@ func Create(id string, spec *specs.Spec, conf *boot.Config, bundleDir, consoleSo
 		return nil, fmt.Errorf("error looking for existing container in %q: %v", containerRoot, err)
 	}
 
+	// Refuse to create the container if its root filesystem doesn't match
+	// the image policy.
+	if conf.ImagePolicy != "" {
+		if err := verifyImage(spec, conf, bundleDir); err != nil {
+			return nil, err
+		}
+	}
+
 	c := &Container{
 		ID:            id,
 		Spec:          spec,
@@ -230,6 +240,18 @@ func Create(id string, spec *specs.Spec, conf *boot.Config, bundleDir, consoleSo
 	}
 
 	c.Sandbox = s
+
+	// "If any createRuntime hook fails, the runtime MUST generate an
+	// error, stop and destroy the container".
+	hooks, err := createRuntimeHooks(bundleDir)
+	if err == nil {
+		err = executeHooks(hooks, c.State())
+	}
+	if err != nil {
+		c.Destroy()
+		return nil, fmt.Errorf("error executing createRuntime hooks: %v", err)
+	}
+
 	c.Status = Created
 
 	// Save the metadata file.
@@ -250,6 +272,24 @@ func Create(id string, spec *specs.Spec, conf *boot.Config, bundleDir, consoleSo
 	return c, nil
 }
 
+// verifyImage checks the root filesystem of the container against
+// conf.ImagePolicy.
+func verifyImage(spec *specs.Spec, conf *boot.Config, bundleDir string) error {
+	p, err := imagepolicy.Load(conf.ImagePolicy, conf.ImagePolicyKey)
+	if err != nil {
+		return err
+	}
+	root := spec.Root.Path
+	if !filepath.IsAbs(root) {
+		root = filepath.Join(bundleDir, root)
+	}
+	if err := p.Verify(root); err != nil {
+		return fmt.Errorf("container root filesystem doesn't match image policy: %v", err)
+	}
+	log.Infof("Container root filesystem %q matches image policy %q", root, conf.ImagePolicy)
+	return nil
+}
+
 // Start starts running the containerized process inside the sandbox.
 func (c *Container) Start(conf *boot.Config) error {
 	log.Debugf("Start container %q", c.ID)
@@ -262,7 +302,7 @@ func (c *Container) Start(conf *boot.Config) error {
 	if c.Spec.Hooks != nil {
 		if err := executeHooks(c.Spec.Hooks.Prestart, c.State()); err != nil {
 			c.Destroy()
-			return err
+			return fmt.Errorf("error executing prestart hooks: %v", err)
 		}
 	}
 
@@ -316,7 +356,7 @@ func (c *Container) Event() (*boot.Event, error) {
 // Pid returns the Pid of the sandbox the container is running in, or -1 if the
 // container is not running.
 func (c *Container) Pid() int {
-	if c.Status != Running && c.Status != Created {
+	if c.Status != Running && c.Status != Created && c.Status != Paused {
 		return -1
 	}
 	return c.Sandbox.Pid
@@ -338,15 +378,179 @@ func (c *Container) Signal(sig syscall.Signal) error {
 	return c.Sandbox.Signal(c.ID, sig)
 }
 
+// Pause freezes the processes of the running container until Resume is
+// called.
+func (c *Container) Pause() error {
+	log.Debugf("Pause container %q", c.ID)
+	if c.Status != Running {
+		return fmt.Errorf("cannot pause container in state %s", c.Status)
+	}
+	if err := c.Sandbox.Pause(c.ID); err != nil {
+		return err
+	}
+	c.Status = Paused
+	return c.save()
+}
+
+// Resume thaws the processes of the paused container.
+func (c *Container) Resume() error {
+	log.Debugf("Resume container %q", c.ID)
+	if c.Status != Paused {
+		return fmt.Errorf("cannot resume container in state %s", c.Status)
+	}
+	if err := c.Sandbox.Resume(c.ID); err != nil {
+		return err
+	}
+	c.Status = Running
+	return c.save()
+}
+
+// Drain puts the container's network stack into drain mode and signals it.
+// See Sandbox.Drain for sig and resetAfter.
+func (c *Container) Drain(sig syscall.Signal, resetAfter time.Duration) error {
+	log.Debugf("Drain container %q", c.ID)
+	if c.Status == Stopped {
+		return fmt.Errorf("container %q not running, cannot drain", c.ID)
+	}
+	return c.Sandbox.Drain(c.ID, sig, resetAfter)
+}
+
+// Update changes the resource limits of the container to those set in res.
+// Limits that aren't set in res are unchanged. See Sandbox.Update.
+func (c *Container) Update(res *specs.LinuxResources) error {
+	log.Debugf("Update container %q", c.ID)
+	if c.Status == Stopped {
+		return fmt.Errorf("container %q not running, cannot update", c.ID)
+	}
+	if err := c.Sandbox.Update(c.ID, res); err != nil {
+		return err
+	}
+
+	// Record the new limits in the spec.
+	if c.Spec.Linux == nil {
+		c.Spec.Linux = &specs.Linux{}
+	}
+	if c.Spec.Linux.Resources == nil {
+		c.Spec.Linux.Resources = &specs.LinuxResources{}
+	}
+	mergeResources(c.Spec.Linux.Resources, res)
+	return c.save()
+}
+
+// mergeResources sets the CPU, memory and pids limits of dst that are set in
+// src.
+func mergeResources(dst, src *specs.LinuxResources) {
+	if src.CPU != nil {
+		if dst.CPU == nil {
+			dst.CPU = &specs.LinuxCPU{}
+		}
+		if src.CPU.Shares != nil {
+			dst.CPU.Shares = src.CPU.Shares
+		}
+		if src.CPU.Quota != nil {
+			dst.CPU.Quota = src.CPU.Quota
+		}
+		if src.CPU.Period != nil {
+			dst.CPU.Period = src.CPU.Period
+		}
+	}
+	if src.Memory != nil {
+		if dst.Memory == nil {
+			dst.Memory = &specs.LinuxMemory{}
+		}
+		if src.Memory.Limit != nil {
+			dst.Memory.Limit = src.Memory.Limit
+		}
+		if src.Memory.Reservation != nil {
+			dst.Memory.Reservation = src.Memory.Reservation
+		}
+	}
+	if src.Pids != nil {
+		dst.Pids = src.Pids
+	}
+}
+
+// PortForward connects the host stream socket f to the given TCP port in the
+// container. See Sandbox.PortForward.
+func (c *Container) PortForward(port uint16, f *os.File) error {
+	log.Debugf("Port forward container %q", c.ID)
+	if c.Status == Stopped {
+		return fmt.Errorf("container %q not running, cannot forward port", c.ID)
+	}
+	return c.Sandbox.PortForward(c.ID, port, f)
+}
+
+// Strace changes which syscalls the container's sandbox traces to its log.
+// See Sandbox.Strace.
+func (c *Container) Strace(args *boot.StraceArgs) error {
+	log.Debugf("Strace container %q", c.ID)
+	if c.Status != Running && c.Status != Created {
+		return fmt.Errorf("cannot change strace of container in state: %s", c.Status)
+	}
+	return c.Sandbox.Strace(c.ID, args)
+}
+
+// SetFlags changes the values of flags of the container's sandbox.
+func (c *Container) SetFlags(flags map[string]string) error {
+	log.Debugf("Set flags of container %q", c.ID)
+	if c.Status != Running && c.Status != Created {
+		return fmt.Errorf("cannot set flags of container in state: %s", c.Status)
+	}
+	return c.Sandbox.SetFlags(c.ID, flags)
+}
+
 // Checkpoint sends the checkpoint call to the container.
 // The statefile will be written to f, the file at the specified image-path.
-func (c *Container) Checkpoint(f *os.File) error {
+// See Sandbox.Checkpoint for incremental and leaveRunning. It returns the
+// inventory of the checkpointed processes, or nil if the container is not
+// running.
+func (c *Container) Checkpoint(f *os.File, incremental, leaveRunning bool) (*control.Inventory, error) {
 	log.Debugf("Checkpoint container %q", c.ID)
 	if c.Status == Stopped {
 		log.Warningf("container %q not running, not checkpointing", c.ID)
-		return nil
+		return nil, nil
+	}
+	return c.Sandbox.Checkpoint(c.ID, f, incremental, leaveRunning)
+}
+
+// Maintain runs the maintenance tasks given by opts in the container's
+// sandbox.
+func (c *Container) Maintain(opts *control.MaintenanceOpts) (*control.MaintenanceResult, error) {
+	log.Debugf("Running maintenance in container %q", c.ID)
+	if c.Status != Running && c.Status != Created {
+		return nil, fmt.Errorf("cannot run maintenance in container in state: %s", c.Status)
+	}
+	return c.Sandbox.Maintain(c.ID, opts)
+}
+
+// ProcessEvents returns the process events recorded in the container's
+// sandbox.
+func (c *Container) ProcessEvents() ([]kernel.ProcessEvent, error) {
+	log.Debugf("Getting process events for container %q", c.ID)
+	if c.Status != Running && c.Status != Created {
+		return nil, fmt.Errorf("cannot get process events of container in state: %s", c.Status)
+	}
+	return c.Sandbox.ProcessEvents(c.ID)
+}
+
+// FlightRecord writes the samples of the flight recorder of the container's
+// sandbox to f.
+func (c *Container) FlightRecord(f *os.File) error {
+	log.Debugf("Flight record container %q", c.ID)
+	if c.Status != Running && c.Status != Created {
+		return fmt.Errorf("cannot dump flight record of container in state: %s", c.Status)
+	}
+	return c.Sandbox.FlightRecord(c.ID, f)
+}
+
+// Profile collects a sentry profile from the container's sandbox. See
+// Sandbox.Profile.
+func (c *Container) Profile(endpoint string, f *os.File, d time.Duration) error {
+	log.Debugf("Profile container %q with %s", c.ID, endpoint)
+	if c.Status != Running && c.Status != Created {
+		return fmt.Errorf("cannot profile container in state: %s", c.Status)
 	}
-	return c.Sandbox.Checkpoint(c.ID, f)
+	return c.Sandbox.Profile(endpoint, f, d)
 }
 
 // State returns the metadata of the container.
@@ -354,7 +558,7 @@ func (c *Container) State() specs.State {
 	return specs.State{
 		Version: specs.Version,
 		ID:      c.ID,
-		Status:  c.Status.String(),
+		Status:  specs.ContainerState(c.Status.String()),
 		Pid:     c.Pid(),
 		Bundle:  c.BundleDir,
 	}
@@ -380,7 +584,7 @@ func (c *Container) Destroy() error {
 
 	// "If any poststop hook fails, the runtime MUST log a warning, but the
 	// remaining hooks and lifecycle continue as if the hook had succeeded".
-	if c.Spec.Hooks != nil && (c.Status == Created || c.Status == Running) {
+	if c.Spec.Hooks != nil && (c.Status == Created || c.Status == Running || c.Status == Paused) {
 		executeHooksBestEffort(c.Spec.Hooks.Poststop, c.State())
 	}
 
@@ -444,7 +444,7 @@ func TestCheckpoint(t *testing.T) {
 	defer file.Close()
 
 	// Checkpoint running container; save state into new file.
-	if err := cont.Checkpoint(file); err != nil {
+	if _, err := cont.Checkpoint(file, false /* incremental */, false /* leaveRunning */); err != nil {
 		t.Fatalf("error checkpointing container to empty file: %v", err)
 	}
 	defer os.RemoveAll(imagePath)
@@ -459,6 +459,79 @@ func TestCheckpoint(t *testing.T) {
 	}
 }
 
+// TestPauseResume tests that a running container can be paused and resumed,
+// and that its status is updated on disk.
+func TestPauseResume(t *testing.T) {
+	spec := testutil.NewSpecWithArgs("sleep", "100")
+
+	rootDir, bundleDir, conf, err := testutil.SetupContainer(spec)
+	if err != nil {
+		t.Fatalf("error setting up container: %v", err)
+	}
+	defer os.RemoveAll(rootDir)
+	defer os.RemoveAll(bundleDir)
+
+	// Create the container. It can't be paused before it starts.
+	id := testutil.UniqueContainerID()
+	cont, err := container.Create(id, spec, conf, bundleDir, "", "")
+	if err != nil {
+		t.Fatalf("error creating container: %v", err)
+	}
+	defer cont.Destroy()
+	if err := cont.Pause(); err == nil {
+		t.Errorf("Pause of created container succeeded, want error")
+	}
+	if err := cont.Start(conf); err != nil {
+		t.Fatalf("error starting container: %v", err)
+	}
+
+	// Pause the container, and check its status.
+	if err := cont.Pause(); err != nil {
+		t.Fatalf("error pausing container: %v", err)
+	}
+	s, err := container.Load(rootDir, id)
+	if err != nil {
+		t.Fatalf("error loading container: %v", err)
+	}
+	if got, want := s.Status, container.Paused; got != want {
+		t.Errorf("container status got %v, want %v", got, want)
+	}
+	if err := s.Pause(); err == nil {
+		t.Errorf("Pause of paused container succeeded, want error")
+	}
+	execArgs := &control.ExecArgs{Filename: "/bin/true", Argv: []string{"true"}}
+	if _, err := s.Execute(execArgs); err == nil {
+		t.Errorf("Execute in paused container succeeded, want error")
+	}
+
+	// Resume the container, and check its status.
+	if err := s.Resume(); err != nil {
+		t.Fatalf("error resuming container: %v", err)
+	}
+	s, err = container.Load(rootDir, id)
+	if err != nil {
+		t.Fatalf("error loading container: %v", err)
+	}
+	if got, want := s.Status, container.Running; got != want {
+		t.Errorf("container status got %v, want %v", got, want)
+	}
+	if err := s.Resume(); err == nil {
+		t.Errorf("Resume of running container succeeded, want error")
+	}
+	expectedPL := []*control.Process{
+		{
+			UID:  0,
+			PID:  1,
+			PPID: 0,
+			C:    0,
+			Cmd:  "sleep",
+		},
+	}
+	if err := waitForProcessList(s, expectedPL); err != nil {
+		t.Error(err)
+	}
+}
+
 // TestCapabilities verifies that:
 // - Running exec as non-root UID and GID will result in an error (because the
 //   executable file can't be read).
@@ -18,6 +18,8 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
@@ -39,6 +41,29 @@ import (
 // 		}]
 // },
 
+// createRuntimeHooks returns the createRuntime hooks from the spec in
+// bundleDir. The vendored runtime-spec predates createRuntime hooks, so they
+// are decoded separately from specs.Spec. A missing spec has no hooks.
+func createRuntimeHooks(bundleDir string) ([]specs.Hook, error) {
+	specFile := filepath.Join(bundleDir, "config.json")
+	b, err := ioutil.ReadFile(specFile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading spec from file %q: %v", specFile, err)
+	}
+	var spec struct {
+		Hooks struct {
+			CreateRuntime []specs.Hook `json:"createRuntime"`
+		} `json:"hooks"`
+	}
+	if err := json.Unmarshal(b, &spec); err != nil {
+		return nil, fmt.Errorf("error unmarshaling spec from file %q: %v", specFile, err)
+	}
+	return spec.Hooks.CreateRuntime, nil
+}
+
 // executeHooksBestEffort executes hooks and logs warning in case they fail.
 // Runs all hooks, always.
 func executeHooksBestEffort(hooks []specs.Hook, s specs.State) {
@@ -68,6 +93,9 @@ func executeHook(h specs.Hook, s specs.State) error {
 	if !filepath.IsAbs(h.Path) {
 		return fmt.Errorf("path for hook is not absolute: %q", h.Path)
 	}
+	if h.Timeout != nil && *h.Timeout <= 0 {
+		return fmt.Errorf("timeout for hook %q must be greater than zero: %d", h.Path, *h.Timeout)
+	}
 
 	b, err := json.Marshal(s)
 	if err != nil {
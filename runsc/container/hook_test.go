@@ -0,0 +1,116 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package container
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func TestExecuteHook(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hook")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The hook receives the container state on stdin.
+	out := filepath.Join(dir, "state")
+	state := specs.State{ID: "foo", Status: "creating", Pid: 123}
+	h := specs.Hook{Path: "/bin/sh", Args: []string{"sh", "-c", "cat > " + out}}
+	if err := executeHook(h, state); err != nil {
+		t.Fatalf("executeHook failed: %v", err)
+	}
+	b, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	var got specs.State
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("hook got invalid state %q: %v", b, err)
+	}
+	if got.ID != state.ID || got.Status != state.Status || got.Pid != state.Pid {
+		t.Errorf("hook got state %+v, want %+v", got, state)
+	}
+
+	zero, one := 0, 1
+	for _, test := range []struct {
+		name string
+		hook specs.Hook
+		want string
+	}{
+		{"relative path", specs.Hook{Path: "sh"}, "not absolute"},
+		{"failure", specs.Hook{Path: "/bin/sh", Args: []string{"sh", "-c", "echo oops >&2; exit 1"}}, "oops"},
+		{"zero timeout", specs.Hook{Path: "/bin/true", Timeout: &zero}, "greater than zero"},
+		{"timeout", specs.Hook{Path: "/bin/sleep", Args: []string{"sleep", "10"}, Timeout: &one}, "timeout"},
+	} {
+		start := time.Now()
+		err := executeHook(test.hook, state)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: executeHook got error %v, want error containing %q", test.name, err, test.want)
+		}
+		if d := time.Since(start); d > 5*time.Second {
+			t.Errorf("%s: executeHook took %v", test.name, d)
+		}
+	}
+
+	// Hooks stop at the first failure.
+	marker := filepath.Join(dir, "marker")
+	hooks := []specs.Hook{
+		{Path: "/bin/false"},
+		{Path: "/bin/sh", Args: []string{"sh", "-c", "touch " + marker}},
+	}
+	if err := executeHooks(hooks, state); err == nil {
+		t.Errorf("executeHooks succeeded, want error")
+	}
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		t.Errorf("hook after failed hook was executed")
+	}
+	executeHooksBestEffort(hooks, state)
+	if _, err := os.Stat(marker); err != nil {
+		t.Errorf("executeHooksBestEffort did not execute hook after failed hook: %v", err)
+	}
+}
+
+func TestCreateRuntimeHooks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bundle")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if hooks, err := createRuntimeHooks(dir); err != nil || hooks != nil {
+		t.Errorf("createRuntimeHooks without spec = (%v, %v), want (nil, nil)", hooks, err)
+	}
+
+	spec := `{"hooks": {"createRuntime": [{"path": "/bin/true", "args": ["true"]}], "prestart": [{"path": "/bin/false"}]}}`
+	if err := ioutil.WriteFile(filepath.Join(dir, "config.json"), []byte(spec), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	hooks, err := createRuntimeHooks(dir)
+	if err != nil {
+		t.Fatalf("createRuntimeHooks failed: %v", err)
+	}
+	if len(hooks) != 1 || hooks[0].Path != "/bin/true" {
+		t.Errorf("createRuntimeHooks = %+v, want /bin/true", hooks)
+	}
+}
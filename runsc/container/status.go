@@ -33,6 +33,11 @@ const (
 
 	// Stopped indicates "the container process has exited".
 	Stopped
+
+	// Paused indicates that the container's processes are frozen by
+	// "runsc pause". Paused is not part of the runtime CLI spec, but runc
+	// reports it.
+	Paused
 )
 
 // String converts a Status to a string. These strings are part of the runtime
@@ -47,6 +52,8 @@ func (s Status) String() string {
 		return "running"
 	case Stopped:
 		return "stopped"
+	case Paused:
+		return "paused"
 	default:
 		return "unknown"
 	}
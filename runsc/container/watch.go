@@ -0,0 +1,177 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package container
+
+import (
+	"fmt"
+	"path/filepath"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+	"gvisor.googlesource.com/gvisor/pkg/log"
+)
+
+// Watcher reports the containers in a root directory whose metadata may have
+// changed, using inotify rather than scanning the directory.
+//
+// Note that the metadata doesn't reflect sandboxes that exit without runsc
+// updating it, so callers must also check the containers that they know to be
+// created or running with Load.
+type Watcher struct {
+	rootDir string
+
+	// fd is the inotify instance.
+	fd int
+
+	// rootWD is the watch descriptor of rootDir.
+	rootWD int32
+
+	// ids are the container ids of the watch descriptors of container root
+	// directories.
+	ids map[int32]string
+}
+
+const (
+	rootWatchMask      = unix.IN_CREATE | unix.IN_DELETE | unix.IN_MOVED_FROM | unix.IN_MOVED_TO | unix.IN_ONLYDIR
+	containerWatchMask = unix.IN_CLOSE_WRITE | unix.IN_MOVED_TO | unix.IN_ONLYDIR
+)
+
+// NewWatcher returns a Watcher for the containers in rootDir. The containers
+// that exist when it is called should be listed afterwards, so that none are
+// missed.
+func NewWatcher(rootDir string) (*Watcher, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC)
+	if err != nil {
+		return nil, fmt.Errorf("inotify_init1 failed: %v", err)
+	}
+	wd, err := unix.InotifyAddWatch(fd, rootDir, rootWatchMask)
+	if err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("error watching %q: %v", rootDir, err)
+	}
+	w := &Watcher{
+		rootDir: rootDir,
+		fd:      fd,
+		rootWD:  int32(wd),
+		ids:     make(map[int32]string),
+	}
+	ids, err := List(rootDir)
+	if err != nil {
+		w.Close()
+		return nil, err
+	}
+	for _, id := range ids {
+		w.watchContainer(id)
+	}
+	return w, nil
+}
+
+// Close releases the resources of the watcher.
+func (w *Watcher) Close() error {
+	return unix.Close(w.fd)
+}
+
+// watchContainer starts watching the root directory of container id.
+func (w *Watcher) watchContainer(id string) {
+	wd, err := unix.InotifyAddWatch(w.fd, filepath.Join(w.rootDir, id), containerWatchMask)
+	if err != nil {
+		// The container may already have been deleted, which is
+		// reported by the root directory.
+		log.Debugf("Error watching container %q: %v", id, err)
+		return
+	}
+	w.ids[int32(wd)] = id
+}
+
+// Wait waits up to timeout for containers to be created, saved or deleted, and
+// returns their ids, without duplicates. It returns no ids if timeout expires
+// first.
+func (w *Watcher) Wait(timeout time.Duration) ([]string, error) {
+	fds := []unix.PollFd{{Fd: int32(w.fd), Events: unix.POLLIN}}
+	for {
+		n, err := unix.Poll(fds, int(timeout/time.Millisecond))
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("poll failed: %v", err)
+		}
+		if n == 0 {
+			return nil, nil
+		}
+		break
+	}
+
+	buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+	n, err := unix.Read(w.fd, buf)
+	if err != nil {
+		return nil, fmt.Errorf("error reading inotify events: %v", err)
+	}
+
+	var ids []string
+	seen := make(map[string]bool)
+	add := func(id string) {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	for off := 0; off+unix.SizeofInotifyEvent <= n; {
+		ev := (*unix.InotifyEvent)(unsafe.Pointer(&buf[off]))
+		nameBuf := buf[off+unix.SizeofInotifyEvent : off+unix.SizeofInotifyEvent+int(ev.Len)]
+		off += unix.SizeofInotifyEvent + int(ev.Len)
+
+		// The name is padded with NUL bytes.
+		name := string(nameBuf)
+		for i := 0; i < len(name); i++ {
+			if name[i] == 0 {
+				name = name[:i]
+				break
+			}
+		}
+
+		switch {
+		case ev.Mask&unix.IN_Q_OVERFLOW != 0:
+			// Events were lost, so any container may have changed.
+			all, err := List(w.rootDir)
+			if err != nil {
+				return nil, err
+			}
+			for _, id := range all {
+				add(id)
+			}
+		case ev.Wd == w.rootWD:
+			if ev.Mask&unix.IN_ISDIR == 0 {
+				continue
+			}
+			if ev.Mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0 {
+				// The metadata may have been written before the
+				// watch was added.
+				w.watchContainer(name)
+			}
+			add(name)
+		case ev.Mask&unix.IN_IGNORED != 0:
+			// The container root directory was deleted.
+			delete(w.ids, ev.Wd)
+		default:
+			if id, ok := w.ids[ev.Wd]; ok && name == metadataFilename {
+				add(id)
+			}
+		}
+	}
+	return ids, nil
+}
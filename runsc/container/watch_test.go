@@ -0,0 +1,93 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package container
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// waitFor calls w.Wait until it reports id, and fails if it doesn't within a
+// few seconds.
+func waitFor(t *testing.T, w *Watcher, id string) {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		ids, err := w.Wait(100 * time.Millisecond)
+		if err != nil {
+			t.Fatalf("Wait failed: %v", err)
+		}
+		for _, got := range ids {
+			if got == id {
+				return
+			}
+		}
+	}
+	t.Fatalf("Wait didn't report container %q", id)
+}
+
+func TestWatcher(t *testing.T) {
+	rootDir, err := ioutil.TempDir("", "watcher")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(rootDir)
+
+	// Containers that exist before the watcher are watched too.
+	if err := os.Mkdir(filepath.Join(rootDir, "before"), 0711); err != nil {
+		t.Fatalf("Mkdir failed: %v", err)
+	}
+
+	w, err := NewWatcher(rootDir)
+	if err != nil {
+		t.Fatalf("NewWatcher failed: %v", err)
+	}
+	defer w.Close()
+
+	if ids, err := w.Wait(0); err != nil || len(ids) != 0 {
+		t.Errorf("Wait(0) = %v, %v, want no ids", ids, err)
+	}
+
+	// Create a container.
+	cRoot := filepath.Join(rootDir, "after")
+	if err := os.Mkdir(cRoot, 0711); err != nil {
+		t.Fatalf("Mkdir failed: %v", err)
+	}
+	waitFor(t, w, "after")
+
+	// Save the metadata of both containers.
+	for _, id := range []string{"before", "after"} {
+		if err := ioutil.WriteFile(filepath.Join(rootDir, id, metadataFilename), []byte("{}"), 0640); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+		waitFor(t, w, id)
+	}
+
+	// Files other than the metadata are ignored.
+	if err := ioutil.WriteFile(filepath.Join(cRoot, "other"), nil, 0640); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if ids, err := w.Wait(100 * time.Millisecond); err != nil || len(ids) != 0 {
+		t.Errorf("Wait = %v, %v, want no ids", ids, err)
+	}
+
+	// Delete a container.
+	if err := os.RemoveAll(cRoot); err != nil {
+		t.Fatalf("RemoveAll failed: %v", err)
+	}
+	waitFor(t, w, "after")
+}
@@ -0,0 +1,240 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package criu describes checkpoints with CRIU images, so that tools that
+// manage CRIU checkpoints, such as crit and the checkpoint commands of Docker
+// and Podman, can list the processes and open files of runsc checkpoints.
+//
+// The images only have metadata: CRIU can't restore them.
+package criu
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/golang/protobuf/proto"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/control"
+	pb "gvisor.googlesource.com/gvisor/runsc/criu/criu_go_proto"
+)
+
+// Image magics, from criu/include/magic.h.
+const (
+	commonMagic    = 0x54564319
+	inventoryMagic = 0x58313116
+	pstreeMagic    = 0x50273030
+	coreMagic      = 0x55053847
+	fdinfoMagic    = 0x56213732
+	filesMagic     = 0x56303138
+)
+
+const (
+	// imgVersion is CRIU_IMAGES_V1_1, the version of the image format.
+	imgVersion = 2
+
+	// taskAlive is the task_state of running tasks.
+	taskAlive = 1
+)
+
+// WriteImages writes CRIU images describing the processes of inv to dir:
+// inventory.img, pstree.img, a core-<pid>.img per process with its name, a
+// fdinfo-<id>.img per FD table and files.img with the files open in them.
+func WriteImages(dir string, inv *control.Inventory) error {
+	var (
+		pstree  []proto.Message
+		files   []proto.Message
+		fdinfos = make(map[uint32][]proto.Message)
+		rootIDs *pb.TaskKobjIdsEntry
+		fileID  uint32
+	)
+	for i, p := range inv.Processes {
+		threads := make([]uint32, 0, len(p.Threads))
+		for _, tid := range p.Threads {
+			threads = append(threads, uint32(tid))
+		}
+		pstree = append(pstree, &pb.PstreeEntry{
+			Pid:     proto.Uint32(uint32(p.PID)),
+			Ppid:    proto.Uint32(uint32(p.PPID)),
+			Pgid:    proto.Uint32(uint32(p.PGID)),
+			Sid:     proto.Uint32(uint32(p.SID)),
+			Threads: threads,
+		})
+
+		// Tasks don't share their memory, file system context or signal
+		// handlers as far as the images are concerned, so those are
+		// identified by process.
+		ids := &pb.TaskKobjIdsEntry{
+			VmId:      proto.Uint32(uint32(i + 1)),
+			FilesId:   proto.Uint32(uint32(p.FilesID)),
+			FsId:      proto.Uint32(uint32(i + 1)),
+			SighandId: proto.Uint32(uint32(i + 1)),
+		}
+		if rootIDs == nil {
+			rootIDs = ids
+		}
+		core := &pb.CoreEntry{
+			Mtype: pb.CoreEntry_X86_64.Enum(),
+			Tc: &pb.TaskCoreEntry{
+				TaskState:   proto.Uint32(taskAlive),
+				ExitCode:    proto.Uint32(0),
+				Personality: proto.Uint32(0),
+				Flags:       proto.Uint32(0),
+				BlkSigset:   proto.Uint64(0),
+				Comm:        proto.String(p.Comm),
+			},
+			Ids: ids,
+		}
+		if err := writeImage(filepath.Join(dir, fmt.Sprintf("core-%d.img", p.PID)), coreMagic, core); err != nil {
+			return err
+		}
+
+		// Processes sharing an FD table share its fdinfo image.
+		filesID := uint32(p.FilesID)
+		if _, ok := fdinfos[filesID]; ok || p.FilesID == 0 {
+			continue
+		}
+		fdinfos[filesID] = []proto.Message{}
+		for _, fd := range p.FDs {
+			fileID++
+			typ, file := fileEntry(fileID, fd)
+			files = append(files, file)
+			var flags uint32
+			if fd.CloseOnExec {
+				flags = syscall.FD_CLOEXEC
+			}
+			fdinfos[filesID] = append(fdinfos[filesID], &pb.FdinfoEntry{
+				Id:    proto.Uint32(fileID),
+				Flags: proto.Uint32(flags),
+				Type:  typ.Enum(),
+				Fd:    proto.Uint32(uint32(fd.FD)),
+			})
+		}
+	}
+
+	inventory := &pb.InventoryEntry{
+		ImgVersion:  proto.Uint32(imgVersion),
+		FdinfoPerId: proto.Bool(true),
+		RootIds:     rootIDs,
+	}
+	if err := writeImage(filepath.Join(dir, "inventory.img"), inventoryMagic, inventory); err != nil {
+		return err
+	}
+	if err := writeImage(filepath.Join(dir, "pstree.img"), pstreeMagic, pstree...); err != nil {
+		return err
+	}
+	for id, entries := range fdinfos {
+		if err := writeImage(filepath.Join(dir, fmt.Sprintf("fdinfo-%d.img", id)), fdinfoMagic, entries...); err != nil {
+			return err
+		}
+	}
+	return writeImage(filepath.Join(dir, "files.img"), filesMagic, files...)
+}
+
+// fileEntry returns the type and the files.img entry of fd, whose file has
+// the given id. Regular files, directories, devices and pipes are described;
+// other files only have their type.
+func fileEntry(id uint32, fd control.InventoryFD) (pb.FdTypes, *pb.FileEntry) {
+	// The owner of files for SIGIO isn't tracked.
+	fown := &pb.FownEntry{
+		Uid:     proto.Uint32(0),
+		Euid:    proto.Uint32(0),
+		Signum:  proto.Uint32(0),
+		PidType: proto.Uint32(0),
+		Pid:     proto.Uint32(0),
+	}
+	e := &pb.FileEntry{Id: proto.Uint32(id)}
+	var typ pb.FdTypes
+	switch fd.Kind {
+	case "reg", "dir", "chr", "blk":
+		typ = pb.FdTypes_REG
+		e.Reg = &pb.RegFileEntry{
+			Id:    proto.Uint32(id),
+			Flags: proto.Uint32(fd.Flags),
+			Pos:   proto.Uint64(uint64(fd.Pos)),
+			Fown:  fown,
+			Name:  proto.String(fd.Path),
+		}
+	case "pipe":
+		typ = pb.FdTypes_PIPE
+		// Pipes are named "pipe:[<inode>]", and CRIU identifies them by
+		// their inode.
+		ino, _ := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(fd.Path, "pipe:["), "]"), 10, 32)
+		e.Pipe = &pb.PipeEntry{
+			Id:     proto.Uint32(id),
+			PipeId: proto.Uint32(uint32(ino)),
+			Flags:  proto.Uint32(fd.Flags),
+			Fown:   fown,
+		}
+	case "fifo":
+		typ = pb.FdTypes_FIFO
+	case "eventfd":
+		typ = pb.FdTypes_EVENTFD
+	case "eventpoll":
+		typ = pb.FdTypes_EVENTPOLL
+	case "timerfd":
+		typ = pb.FdTypes_TIMERFD
+	case "inotify":
+		typ = pb.FdTypes_INOTIFY
+	default:
+		// The family of sockets isn't known.
+		typ = pb.FdTypes_UND
+	}
+	e.Type = typ.Enum()
+	return typ, e
+}
+
+// writeImage writes a CRIU image with the given magic and entries to path.
+func writeImage(path string, magic uint32, entries ...proto.Message) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if err := writeEntries(f, magic, entries); err != nil {
+		f.Close()
+		return fmt.Errorf("error writing %q: %v", path, err)
+	}
+	return f.Close()
+}
+
+// writeEntries writes the magic of an image followed by its entries, each
+// preceded by its size.
+func writeEntries(w io.Writer, magic uint32, entries []proto.Message) error {
+	var magics []uint32
+	// Only the inventory lacks the common magic.
+	if magic != inventoryMagic {
+		magics = append(magics, commonMagic)
+	}
+	magics = append(magics, magic)
+	if err := binary.Write(w, binary.LittleEndian, magics); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		b, err := proto.Marshal(e)
+		if err != nil {
+			return err
+		}
+		if err := binary.Write(w, binary.LittleEndian, uint32(len(b))); err != nil {
+			return err
+		}
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package criu
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/control"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
+	pb "gvisor.googlesource.com/gvisor/runsc/criu/criu_go_proto"
+)
+
+// readImage reads the image at path, checks its magic and returns its
+// entries, unmarshalled into messages returned by newEntry.
+func readImage(t *testing.T, path string, magic uint32, newEntry func() proto.Message) []proto.Message {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("error reading image: %v", err)
+	}
+	want := []uint32{commonMagic, magic}
+	if magic == inventoryMagic {
+		want = want[1:]
+	}
+	for _, m := range want {
+		if len(b) < 4 {
+			t.Fatalf("%s: truncated magic", path)
+		}
+		if got := binary.LittleEndian.Uint32(b); got != m {
+			t.Fatalf("%s: got magic %#x, want %#x", path, got, m)
+		}
+		b = b[4:]
+	}
+	var entries []proto.Message
+	for len(b) > 0 {
+		if len(b) < 4 {
+			t.Fatalf("%s: truncated entry size", path)
+		}
+		n := binary.LittleEndian.Uint32(b)
+		b = b[4:]
+		if uint32(len(b)) < n {
+			t.Fatalf("%s: truncated entry", path)
+		}
+		e := newEntry()
+		if err := proto.Unmarshal(b[:n], e); err != nil {
+			t.Fatalf("%s: error unmarshalling entry: %v", path, err)
+		}
+		entries = append(entries, e)
+		b = b[n:]
+	}
+	return entries
+}
+
+func TestWriteImages(t *testing.T) {
+	dir, err := ioutil.TempDir("", "criu")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	inv := &control.Inventory{
+		Processes: []control.InventoryProcess{
+			{
+				PID:     1,
+				SID:     1,
+				PGID:    1,
+				Threads: []kernel.ThreadID{1, 3},
+				Comm:    "sh",
+				FilesID: 1,
+				FDs: []control.InventoryFD{
+					{FD: 0, Kind: "chr", Path: "/dev/null", Flags: syscall.O_RDWR},
+					{FD: 3, Kind: "pipe", Path: "pipe:[7]", CloseOnExec: true},
+					{FD: 4, Kind: "reg", Path: "/tmp/log", Flags: syscall.O_WRONLY | syscall.O_APPEND, Pos: 42},
+				},
+			},
+			{
+				PID:     2,
+				PPID:    1,
+				SID:     1,
+				PGID:    2,
+				Threads: []kernel.ThreadID{2},
+				Comm:    "sleep",
+				FilesID: 2,
+				FDs: []control.InventoryFD{
+					{FD: 5, Kind: "socket", Path: "socket:[9]"},
+				},
+			},
+			{
+				// Shares the FD table of the first process, as
+				// after clone(CLONE_FILES).
+				PID:     4,
+				PPID:    1,
+				SID:     1,
+				PGID:    1,
+				Threads: []kernel.ThreadID{4},
+				Comm:    "sh",
+				FilesID: 1,
+			},
+		},
+	}
+	if err := WriteImages(dir, inv); err != nil {
+		t.Fatalf("WriteImages failed: %v", err)
+	}
+
+	inventory := readImage(t, filepath.Join(dir, "inventory.img"), inventoryMagic, func() proto.Message { return &pb.InventoryEntry{} })
+	if len(inventory) != 1 {
+		t.Fatalf("got %d inventory entries, want 1", len(inventory))
+	}
+	if ie := inventory[0].(*pb.InventoryEntry); ie.GetImgVersion() != imgVersion || !ie.GetFdinfoPerId() || ie.GetRootIds().GetFilesId() != 1 {
+		t.Errorf("got inventory %v", ie)
+	}
+
+	var pids [][]uint32
+	for _, e := range readImage(t, filepath.Join(dir, "pstree.img"), pstreeMagic, func() proto.Message { return &pb.PstreeEntry{} }) {
+		pe := e.(*pb.PstreeEntry)
+		pids = append(pids, []uint32{pe.GetPid(), pe.GetPpid(), pe.GetPgid(), pe.GetSid(), uint32(len(pe.GetThreads()))})
+	}
+	if want := [][]uint32{{1, 0, 1, 1, 2}, {2, 1, 2, 1, 1}, {4, 1, 1, 1, 1}}; !reflect.DeepEqual(pids, want) {
+		t.Errorf("got pstree (pid, ppid, pgid, sid, threads) %v, want %v", pids, want)
+	}
+
+	for _, p := range inv.Processes {
+		cores := readImage(t, filepath.Join(dir, fmt.Sprintf("core-%d.img", p.PID)), coreMagic, func() proto.Message { return &pb.CoreEntry{} })
+		if len(cores) != 1 {
+			t.Fatalf("got %d core entries for PID %d, want 1", len(cores), p.PID)
+		}
+		ce := cores[0].(*pb.CoreEntry)
+		if got := ce.GetTc().GetComm(); got != p.Comm {
+			t.Errorf("got comm %q for PID %d, want %q", got, p.PID, p.Comm)
+		}
+		if got := ce.GetIds().GetFilesId(); got != uint32(p.FilesID) {
+			t.Errorf("got files ID %d for PID %d, want %d", got, p.PID, p.FilesID)
+		}
+	}
+
+	// The fdinfo of the shared FD table is only written once.
+	fdinfo := readImage(t, filepath.Join(dir, "fdinfo-1.img"), fdinfoMagic, func() proto.Message { return &pb.FdinfoEntry{} })
+	var fds [][]uint32
+	for _, e := range fdinfo {
+		fe := e.(*pb.FdinfoEntry)
+		fds = append(fds, []uint32{fe.GetFd(), fe.GetId(), uint32(fe.GetType()), fe.GetFlags()})
+	}
+	if want := [][]uint32{{0, 1, uint32(pb.FdTypes_REG), 0}, {3, 2, uint32(pb.FdTypes_PIPE), syscall.FD_CLOEXEC}, {4, 3, uint32(pb.FdTypes_REG), 0}}; !reflect.DeepEqual(fds, want) {
+		t.Errorf("got fdinfo (fd, id, type, flags) %v, want %v", fds, want)
+	}
+
+	files := readImage(t, filepath.Join(dir, "files.img"), filesMagic, func() proto.Message { return &pb.FileEntry{} })
+	if len(files) != 4 {
+		t.Fatalf("got %d file entries, want 4", len(files))
+	}
+	if reg := files[2].(*pb.FileEntry).GetReg(); reg.GetName() != "/tmp/log" || reg.GetPos() != 42 || reg.GetFlags() != syscall.O_WRONLY|syscall.O_APPEND {
+		t.Errorf("got regular file %v", reg)
+	}
+	if pipe := files[1].(*pb.FileEntry).GetPipe(); pipe.GetPipeId() != 7 {
+		t.Errorf("got pipe %v, want pipe ID 7", pipe)
+	}
+	if fe := files[3].(*pb.FileEntry); fe.GetType() != pb.FdTypes_UND || fe.GetId() != 4 {
+		t.Errorf("got socket %v, want undefined type with ID 4", fe)
+	}
+}
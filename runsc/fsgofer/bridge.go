@@ -0,0 +1,165 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsgofer
+
+import (
+	"encoding/binary"
+	"fmt"
+	"syscall"
+
+	"gvisor.googlesource.com/gvisor/pkg/log"
+	"gvisor.googlesource.com/gvisor/pkg/unet"
+)
+
+// AbstractBridge connects the sandbox to a host abstract unix socket, or
+// host processes to a sandbox abstract unix socket. The gofer serves each
+// bridge over its own SOCK_SEQPACKET socket connected to the sandbox:
+//
+// For an imported socket, the sandbox sends a 4-byte little-endian socket
+// type for each connection to the host socket. The gofer replies with a
+// 4-byte little-endian errno, and the connected host socket if the errno is
+// 0.
+//
+// For an exported socket, the gofer sends a 1-byte message with the host
+// socket of each connection that it accepts.
+type AbstractBridge struct {
+	// name is the name of the abstract socket, without the leading NUL
+	// byte.
+	name string
+
+	// uids is the set of host UIDs that may connect to an exported socket.
+	// If it is empty, any UID may connect.
+	uids map[uint32]bool
+
+	// listener is the host socket that host processes connect to, or nil
+	// if the socket is imported.
+	listener *unet.ServerSocket
+}
+
+// NewAbstractImport returns a bridge that connects the sandbox to the host
+// abstract socket name.
+func NewAbstractImport(name string) *AbstractBridge {
+	return &AbstractBridge{name: name}
+}
+
+// NewAbstractExport binds the host abstract socket name, and returns a bridge
+// that connects the host processes with the given UIDs (or any UID, if uids is
+// empty) to the sandbox socket bound to name.
+func NewAbstractExport(name string, uids []uint32) (*AbstractBridge, error) {
+	l, err := unet.BindAndListen("\x00"+name, false)
+	if err != nil {
+		return nil, fmt.Errorf("error binding abstract socket %q: %v", name, err)
+	}
+	b := &AbstractBridge{name: name, uids: make(map[uint32]bool), listener: l}
+	for _, uid := range uids {
+		b.uids[uid] = true
+	}
+	return b, nil
+}
+
+// Serve serves the bridge to the sandbox over sock, until sock is closed or
+// accepting host connections fails.
+func (b *AbstractBridge) Serve(sock *unet.Socket) error {
+	if b.listener != nil {
+		return b.serveExport(sock)
+	}
+	return b.serveImport(sock)
+}
+
+func (b *AbstractBridge) serveImport(sock *unet.Socket) error {
+	for {
+		var req [4]byte
+		r := sock.Reader(true)
+		if n, err := r.ReadVec([][]byte{req[:]}); err != nil {
+			return err
+		} else if n != len(req) {
+			return fmt.Errorf("invalid request of %d bytes", n)
+		}
+
+		var resp [4]byte
+		w := sock.Writer(true)
+		fd, err := connectAbstract(b.name, int(binary.LittleEndian.Uint32(req[:])))
+		if err != nil {
+			errno, ok := err.(syscall.Errno)
+			if !ok {
+				errno = syscall.ECONNREFUSED
+			}
+			log.Infof("Connection to abstract socket %q failed: %v", b.name, err)
+			binary.LittleEndian.PutUint32(resp[:], uint32(errno))
+		} else {
+			w.PackFDs(fd)
+		}
+		_, err = w.WriteVec([][]byte{resp[:]})
+		if fd >= 0 {
+			syscall.Close(fd)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// connectAbstract returns a non-blocking socket of type stype connected to
+// the host abstract socket name, or -1 and an error.
+func connectAbstract(name string, stype int) (int, error) {
+	switch stype {
+	case syscall.SOCK_STREAM, syscall.SOCK_SEQPACKET, syscall.SOCK_DGRAM:
+	default:
+		return -1, syscall.EPROTOTYPE
+	}
+	fd, err := syscall.Socket(syscall.AF_UNIX, stype|syscall.SOCK_NONBLOCK|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return -1, err
+	}
+	// Connecting a non-blocking unix socket doesn't wait for the listener's
+	// backlog to have room, but otherwise completes immediately.
+	if err := syscall.Connect(fd, &syscall.SockaddrUnix{Name: "\x00" + name}); err != nil {
+		syscall.Close(fd)
+		return -1, err
+	}
+	return fd, nil
+}
+
+func (b *AbstractBridge) serveExport(sock *unet.Socket) error {
+	defer b.listener.Close()
+	for {
+		c, err := b.listener.Accept()
+		if err != nil {
+			return err
+		}
+		if len(b.uids) > 0 {
+			cred, err := c.GetPeerCred()
+			if err != nil || !b.uids[cred.Uid] {
+				log.Warningf("Rejected connection to abstract socket %q: peer credentials %+v, %v", b.name, cred, err)
+				c.Close()
+				continue
+			}
+		}
+
+		// Close only our FD rather than the socket, since closing the
+		// socket shuts down the connection.
+		fd, err := c.Release()
+		if err != nil {
+			return err
+		}
+		w := sock.Writer(true)
+		w.PackFDs(fd)
+		_, err = w.WriteVec([][]byte{{0}})
+		syscall.Close(fd)
+		if err != nil {
+			return err
+		}
+	}
+}
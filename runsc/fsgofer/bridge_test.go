@@ -0,0 +1,159 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsgofer
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"syscall"
+	"testing"
+
+	"gvisor.googlesource.com/gvisor/pkg/unet"
+)
+
+// bridgeName returns an abstract socket name that is unique to the test.
+func bridgeName(t *testing.T) string {
+	return fmt.Sprintf("fsgofer-test.%d.%s", os.Getpid(), t.Name())
+}
+
+func TestAbstractImport(t *testing.T) {
+	name := bridgeName(t)
+	l, err := unet.BindAndListen("\x00"+name, false)
+	if err != nil {
+		t.Fatalf("BindAndListen failed: %v", err)
+	}
+	defer l.Close()
+
+	sandbox, gofer, err := unet.SocketPair(true)
+	if err != nil {
+		t.Fatalf("SocketPair failed: %v", err)
+	}
+	defer sandbox.Close()
+	go NewAbstractImport(name).Serve(gofer)
+
+	for _, test := range []struct {
+		stype int
+		errno syscall.Errno
+	}{
+		{syscall.SOCK_STREAM, 0},
+		{syscall.SOCK_DGRAM, syscall.ECONNREFUSED},
+		{syscall.SOCK_RAW, syscall.EPROTOTYPE},
+	} {
+		var req [4]byte
+		binary.LittleEndian.PutUint32(req[:], uint32(test.stype))
+		w := sandbox.Writer(true)
+		if _, err := w.WriteVec([][]byte{req[:]}); err != nil {
+			t.Fatalf("WriteVec failed: %v", err)
+		}
+
+		var resp [4]byte
+		r := sandbox.Reader(true)
+		r.EnableFDs(1)
+		if _, err := r.ReadVec([][]byte{resp[:]}); err != nil {
+			t.Fatalf("ReadVec failed: %v", err)
+		}
+		fds, err := r.ExtractFDs()
+		if err != nil {
+			t.Fatalf("ExtractFDs failed: %v", err)
+		}
+		for _, fd := range fds {
+			syscall.Close(fd)
+		}
+		if errno := syscall.Errno(binary.LittleEndian.Uint32(resp[:])); errno != test.errno {
+			t.Errorf("connecting socket of type %d: got errno %v, want %v", test.stype, errno, test.errno)
+		}
+		if want := 0; test.errno == 0 {
+			want = 1
+			if len(fds) != want {
+				t.Errorf("connecting socket of type %d: got %d FDs, want %d", test.stype, len(fds), want)
+			}
+		}
+	}
+}
+
+func TestAbstractExport(t *testing.T) {
+	name := bridgeName(t)
+	sandbox, gofer, err := unet.SocketPair(true)
+	if err != nil {
+		t.Fatalf("SocketPair failed: %v", err)
+	}
+	defer sandbox.Close()
+
+	// Only the UID of the test may connect.
+	b, err := NewAbstractExport(name, []uint32{uint32(os.Getuid())})
+	if err != nil {
+		t.Fatalf("NewAbstractExport failed: %v", err)
+	}
+	go b.Serve(gofer)
+
+	c, err := unet.Connect("\x00"+name, false)
+	if err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer c.Close()
+
+	var msg [1]byte
+	r := sandbox.Reader(true)
+	r.EnableFDs(1)
+	if _, err := r.ReadVec([][]byte{msg[:]}); err != nil {
+		t.Fatalf("ReadVec failed: %v", err)
+	}
+	fds, err := r.ExtractFDs()
+	if err != nil || len(fds) != 1 {
+		t.Fatalf("got FDs %v, %v, want 1 FD", fds, err)
+	}
+	defer syscall.Close(fds[0])
+
+	// The passed socket is the other end of the connection.
+	if _, err := c.Write([]byte("x")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	var buf [1]byte
+	if n, err := syscall.Read(fds[0], buf[:]); err != nil || n != 1 || buf[0] != 'x' {
+		t.Errorf("Read got %d, %v, %q, want 1, nil, \"x\"", n, err, buf[:n])
+	}
+}
+
+func TestAbstractExportRejectsUID(t *testing.T) {
+	name := bridgeName(t)
+	sandbox, gofer, err := unet.SocketPair(true)
+	if err != nil {
+		t.Fatalf("SocketPair failed: %v", err)
+	}
+	defer sandbox.Close()
+
+	b, err := NewAbstractExport(name, []uint32{uint32(os.Getuid()) + 1})
+	if err != nil {
+		t.Fatalf("NewAbstractExport failed: %v", err)
+	}
+	go b.Serve(gofer)
+
+	c, err := unet.Connect("\x00"+name, false)
+	if err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer c.Close()
+
+	// The gofer closes the connection instead of passing it.
+	var buf [1]byte
+	if _, err := c.Read(buf[:]); err == nil {
+		t.Errorf("Read succeeded, want connection closed")
+	}
+	r := sandbox.Reader(false)
+	if _, err := r.ReadVec([][]byte{buf[:]}); err != syscall.EAGAIN {
+		t.Errorf("got %v from sandbox socket, want EAGAIN", err)
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsgofer
+
+import (
+	"path"
+	"strings"
+	"syscall"
+
+	"gvisor.googlesource.com/gvisor/pkg/log"
+)
+
+// fileID identifies a host file independently of the path used to reach it.
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+func fileIDOf(stat syscall.Stat_t) fileID {
+	return fileID{dev: stat.Dev, ino: stat.Ino}
+}
+
+// deniedName is an entry that doesn't exist in a directory, but that clients
+// may not create.
+type deniedName struct {
+	dir  fileID
+	name string
+}
+
+// denySet holds the host files that correspond to Config.DenyPaths.
+//
+// Files are tracked by identity rather than by host path, so that denial
+// can't be bypassed by reaching a file through a different path, e.g. after
+// one of its ancestors has been renamed.
+type denySet struct {
+	// files is the set of denied files that existed when the attach point
+	// was created.
+	files map[fileID]struct{}
+
+	// names is the set of denied entries that didn't exist when the attach
+	// point was created.
+	names map[deniedName]struct{}
+
+	// parents is the set of directories that contain a denied file or
+	// name, at any depth. They can't be renamed, since that would move the
+	// denied entries with them.
+	parents map[fileID]struct{}
+}
+
+// newDenySet resolves paths, relative to prefix, to the host files they
+// refer to.
+func newDenySet(prefix string, paths []string) *denySet {
+	d := &denySet{
+		files:   make(map[fileID]struct{}),
+		names:   make(map[deniedName]struct{}),
+		parents: make(map[fileID]struct{}),
+	}
+	for _, p := range paths {
+		// Join cleans the path, so that e.g. "../x" can't escape the
+		// attach point and "a//b" matches "a/b".
+		clean := path.Join("/", p)
+		if clean == "/" {
+			log.Warningf("Ignoring deny path %q: it refers to the attach point itself", p)
+			continue
+		}
+		if err := d.add(prefix, strings.Split(clean[1:], "/")); err != nil {
+			log.Warningf("Failed to resolve deny path %q under %q, err: %v", p, prefix, err)
+		}
+	}
+	return d
+}
+
+// add resolves the path made of names, starting at dir.
+//
+// If an intermediate directory doesn't exist, it's denied in place of the
+// full path, since the denied path could otherwise be created beneath it.
+// Likewise, an intermediate component that isn't a directory (e.g. a symlink)
+// is denied itself.
+func (d *denySet) add(dir string, names []string) error {
+	var dirStat syscall.Stat_t
+	if err := syscall.Lstat(dir, &dirStat); err != nil {
+		return err
+	}
+	var parents []fileID
+	for i, name := range names {
+		id := fileIDOf(dirStat)
+		parents = append(parents, id)
+
+		dir = path.Join(dir, name)
+		var stat syscall.Stat_t
+		if err := syscall.Lstat(dir, &stat); err != nil {
+			d.names[deniedName{dir: id, name: name}] = struct{}{}
+			break
+		}
+		if i == len(names)-1 || stat.Mode&syscall.S_IFMT != syscall.S_IFDIR {
+			d.files[fileIDOf(stat)] = struct{}{}
+			break
+		}
+		dirStat = stat
+	}
+	for _, id := range parents {
+		d.parents[id] = struct{}{}
+	}
+	return nil
+}
+
+// isDenied returns true if name in directory dir is denied. stat is the
+// entry's attributes, or nil if it doesn't exist.
+func (d *denySet) isDenied(dir fileID, name string, stat *syscall.Stat_t) bool {
+	if _, ok := d.names[deniedName{dir: dir, name: name}]; ok {
+		return true
+	}
+	return stat != nil && d.isDeniedFile(*stat)
+}
+
+// isDeniedFile returns true if the file is denied.
+func (d *denySet) isDeniedFile(stat syscall.Stat_t) bool {
+	_, ok := d.files[fileIDOf(stat)]
+	return ok
+}
+
+// isDeniedParent returns true if the file is a directory containing a denied
+// entry.
+func (d *denySet) isDeniedParent(stat syscall.Stat_t) bool {
+	_, ok := d.parents[fileIDOf(stat)]
+	return ok
+}
@@ -77,6 +77,20 @@ type Config struct {
 	// copies the entire file up eagerly when it's opened in write mode
 	// even if the file is never actually written to.
 	LazyOpenForWrite bool
+
+	// HostNotify allows clients to watch files for changes made on the
+	// host. See localFile.Watch.
+	HostNotify bool
+
+	// DenyPaths are paths, relative to the attach point, that clients may
+	// not walk to or create. Attempts to do so fail with EACCES. Files
+	// beneath a denied directory are therefore inaccessible as well, and
+	// directories containing denied paths can't be renamed.
+	DenyPaths []string
+
+	// denied is the set of host files corresponding to DenyPaths, resolved
+	// when the attach point is created.
+	denied *denySet
 }
 
 type attachPoint struct {
@@ -90,6 +104,9 @@ type attachPoint struct {
 // NewAttachPoint creates a new attacher that gives local file
 // access to all files under 'prefix'.
 func NewAttachPoint(prefix string, c Config) p9.Attacher {
+	if len(c.DenyPaths) > 0 {
+		c.denied = newDenySet(prefix, c.DenyPaths)
+	}
 	return &attachPoint{prefix: prefix, conf: c}
 }
 
@@ -261,6 +278,24 @@ func openAnyFile(parent *localFile, name string) (*os.File, string, error) {
 	return os.NewFile(uintptr(fd), newPath), newPath, nil
 }
 
+// isDenied returns true if name in l is one of the paths in l.conf.DenyPaths.
+func (l *localFile) isDenied(name string) bool {
+	if l.conf.denied == nil {
+		return false
+	}
+	dir, err := stat(l.controlFD())
+	if err != nil {
+		// Fail closed if the directory can't be identified.
+		log.Warningf("Failed to stat directory %q, err: %v", l.controlFile.Name(), err)
+		return true
+	}
+	var entry *syscall.Stat_t
+	if s, err := statAt(l.controlFD(), name); err == nil {
+		entry = &s
+	}
+	return l.conf.denied.isDenied(fileIDOf(dir), name, entry)
+}
+
 func newLocalFile(conf Config, file *os.File, path string, stat syscall.Stat_t) (*localFile, error) {
 	var ft fileType
 	switch stat.Mode & syscall.S_IFMT {
@@ -375,6 +410,9 @@ func (l *localFile) Create(name string, mode p9.OpenFlags, perm p9.FileMode, uid
 	if !isNameValid(name) {
 		return nil, nil, p9.QID{}, 0, syscall.EINVAL
 	}
+	if l.isDenied(name) {
+		return nil, nil, p9.QID{}, 0, syscall.EACCES
+	}
 
 	// Use a single file for both 'controlFile' and 'openedFile'. Mode must include read for control
 	// and whichever else was requested by caller. Note that resulting file might have a wider mode
@@ -424,6 +462,9 @@ func (l *localFile) Mkdir(name string, perm p9.FileMode, uid p9.UID, gid p9.GID)
 	if !isNameValid(name) {
 		return p9.QID{}, syscall.EINVAL
 	}
+	if l.isDenied(name) {
+		return p9.QID{}, syscall.EACCES
+	}
 
 	if err := syscall.Mkdirat(l.controlFD(), name, uint32(perm.Permissions())); err != nil {
 		return p9.QID{}, extractErrno(err)
@@ -479,6 +520,9 @@ func (l *localFile) Walk(names []string) ([]p9.QID, p9.File, error) {
 		if !isNameValid(name) {
 			return nil, nil, syscall.EINVAL
 		}
+		if last.isDenied(name) {
+			return nil, nil, syscall.EACCES
+		}
 
 		f, path, err := openAnyFile(last, name)
 		if err != nil {
@@ -486,8 +530,15 @@ func (l *localFile) Walk(names []string) ([]p9.QID, p9.File, error) {
 		}
 		stat, err := stat(int(f.Fd()))
 		if err != nil {
+			f.Close()
 			return nil, nil, extractErrno(err)
 		}
+		if last.conf.denied != nil && last.conf.denied.isDeniedFile(stat) {
+			// The entry was replaced by a denied file after it was
+			// checked above.
+			f.Close()
+			return nil, nil, syscall.EACCES
+		}
 		c, err := newLocalFile(last.conf, f, path, stat)
 		if err != nil {
 			return nil, nil, extractErrno(err)
@@ -565,6 +616,11 @@ func (l *localFile) GetAttr(_ p9.AttrMask) (p9.QID, p9.AttrMask, p9.Attr, error)
 		MTime:  true,
 		CTime:  true,
 	}
+	if ts, ok := btime(l.controlFD()); ok {
+		attr.BTimeSeconds = uint64(ts.Sec)
+		attr.BTimeNanoSeconds = uint64(ts.Nsec)
+		valid.BTime = true
+	}
 
 	return makeQID(stat), valid, attr, nil
 }
@@ -716,12 +772,27 @@ func (l *localFile) Rename(directory p9.File, name string) error {
 	if !isNameValid(name) {
 		return syscall.EINVAL
 	}
+	parent := directory.(*localFile)
+	if l.conf.denied != nil {
+		// Moving a directory that contains denied entries would move
+		// them as well, so it's refused just like moving the entries
+		// themselves.
+		stat, err := stat(l.controlFD())
+		if err != nil {
+			return extractErrno(err)
+		}
+		if l.conf.denied.isDeniedFile(stat) || l.conf.denied.isDeniedParent(stat) {
+			return syscall.EACCES
+		}
+	}
+	if parent.isDenied(name) {
+		return syscall.EACCES
+	}
 
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
 	// TODO: change to renameat(2)
-	parent := directory.(*localFile)
 	newPath := path.Join(parent.hostPath, name)
 	if err := syscall.Rename(l.hostPath, newPath); err != nil {
 		return extractErrno(err)
@@ -783,6 +854,9 @@ func (l *localFile) Symlink(target, newName string, uid p9.UID, gid p9.GID) (p9.
 	if !isNameValid(newName) {
 		return p9.QID{}, syscall.EINVAL
 	}
+	if l.isDenied(newName) {
+		return p9.QID{}, syscall.EACCES
+	}
 
 	if err := unix.Symlinkat(target, l.controlFD(), newName); err != nil {
 		return p9.QID{}, extractErrno(err)
@@ -813,6 +887,9 @@ func (l *localFile) Link(target p9.File, newName string) error {
 	if !isNameValid(newName) {
 		return syscall.EINVAL
 	}
+	if l.isDenied(newName) {
+		return syscall.EACCES
+	}
 
 	targetFile := target.(*localFile)
 	if err := unix.Linkat(targetFile.controlFD(), "", l.controlFD(), newName, linux.AT_EMPTY_PATH); err != nil {
@@ -836,6 +913,9 @@ func (l *localFile) UnlinkAt(name string, flags uint32) error {
 	if !isNameValid(name) {
 		return syscall.EINVAL
 	}
+	if l.isDenied(name) {
+		return syscall.EACCES
+	}
 	if err := unix.Unlinkat(l.controlFD(), name, int(flags)); err != nil {
 		return extractErrno(err)
 	}
@@ -908,6 +988,31 @@ func (l *localFile) Connect(p9.ConnectFlags) (*fd.FD, error) {
 	return nil, syscall.ECONNREFUSED
 }
 
+// Watch implements p9.File.
+//
+// The watch is placed through /proc/self/fd so that it follows the file
+// across renames. Note that the returned inotify instance also reports
+// changes made through the gofer itself.
+func (l *localFile) Watch(mask uint32) (*fd.FD, error) {
+	if !l.conf.HostNotify {
+		return nil, syscall.ENOSYS
+	}
+	mask &= unix.IN_ALL_EVENTS
+	if mask == 0 {
+		return nil, syscall.EINVAL
+	}
+
+	ifd, err := unix.InotifyInit1(unix.IN_NONBLOCK | unix.IN_CLOEXEC)
+	if err != nil {
+		return nil, extractErrno(err)
+	}
+	if _, err := unix.InotifyAddWatch(ifd, fmt.Sprintf("/proc/self/fd/%d", l.controlFD()), mask); err != nil {
+		syscall.Close(ifd)
+		return nil, extractErrno(err)
+	}
+	return fd.New(ifd), nil
+}
+
 // Close implements p9.File.
 func (l *localFile) Close() error {
 	err := l.controlFile.Close()
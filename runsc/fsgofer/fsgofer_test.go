@@ -22,7 +22,9 @@ import (
 	"strings"
 	"syscall"
 	"testing"
+	"time"
 
+	"gvisor.googlesource.com/gvisor/pkg/abi/linux"
 	"gvisor.googlesource.com/gvisor/pkg/log"
 	"gvisor.googlesource.com/gvisor/pkg/p9"
 )
@@ -377,6 +379,22 @@ func TestSetAttrOwner(t *testing.T) {
 	})
 }
 
+func TestGetAttrBTime(t *testing.T) {
+	runAll(t, func(t *testing.T, s state) {
+		_, valid, attr, err := s.file.GetAttr(p9.AttrMaskAll())
+		if err != nil {
+			t.Fatalf("%v: GetAttr() failed, err: %v", s, err)
+		}
+		if !valid.BTime {
+			// Not all host filesystems record creation times.
+			return
+		}
+		if now := uint64(time.Now().Unix()); attr.BTimeSeconds == 0 || attr.BTimeSeconds > now {
+			t.Errorf("%v: wrong creation time, got: %v, expected: (0, %v]", s, attr.BTimeSeconds, now)
+		}
+	})
+}
+
 func TestLink(t *testing.T) {
 	if os.Getuid() != 0 {
 		t.Skipf("Link test requires CAP_DAC_READ_SEARCH, running as %d", os.Getuid())
@@ -665,3 +683,184 @@ func TestDoubleAttachError(t *testing.T) {
 		t.Fatalf("Attach(%q) should have failed", "test")
 	}
 }
+
+func TestWatch(t *testing.T) {
+	runCustom(t, []fileType{directory}, []Config{{HostNotify: false}}, func(t *testing.T, s state) {
+		if _, err := s.file.Watch(syscall.IN_CREATE); err != syscall.ENOSYS {
+			t.Errorf("%v: Watch() should have failed, got: %v, expected: syscall.ENOSYS", s, err)
+		}
+	})
+
+	runCustom(t, []fileType{directory}, []Config{{HostNotify: true}}, func(t *testing.T, s state) {
+		f, err := s.file.Watch(syscall.IN_CREATE)
+		if err != nil {
+			t.Fatalf("%v: Watch() failed, err: %v", s, err)
+		}
+		defer f.Close()
+
+		if err := ioutil.WriteFile(path.Join(s.file.hostPath, "new"), nil, 0666); err != nil {
+			t.Fatalf("%v: WriteFile() failed, err: %v", s, err)
+		}
+
+		buf := make([]byte, 4096)
+		n, err := syscall.Read(f.FD(), buf)
+		if err != nil {
+			t.Fatalf("%v: Read() failed, err: %v", s, err)
+		}
+		if n < 16 {
+			t.Fatalf("%v: Read() got %d bytes, want at least 16", s, n)
+		}
+		if mask := uint32(buf[4]) | uint32(buf[5])<<8 | uint32(buf[6])<<16 | uint32(buf[7])<<24; mask&syscall.IN_CREATE == 0 {
+			t.Errorf("%v: got event mask %#x, want IN_CREATE", s, mask)
+		}
+		if name := strings.TrimRight(string(buf[16:n]), "\x00"); name != "new" {
+			t.Errorf("%v: got event name %q, want %q", s, name, "new")
+		}
+	})
+}
+
+func TestDenyPaths(t *testing.T) {
+	dir, err := ioutil.TempDir("", "root-")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir() failed, err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	for _, p := range []string{"secret", "pub/key"} {
+		if err := os.MkdirAll(path.Join(dir, p), 0777); err != nil {
+			t.Fatalf("os.MkdirAll(%q) failed, err: %v", p, err)
+		}
+	}
+
+	a := NewAttachPoint(dir, Config{DenyPaths: []string{"secret", "/pub/key", "../new"}})
+	root, err := a.Attach("/")
+	if err != nil {
+		t.Fatalf("Attach(%q) failed, err: %v", "/", err)
+	}
+	defer root.Close()
+
+	for _, names := range [][]string{{"secret"}, {"pub", "key"}} {
+		if _, _, err := root.Walk(names); err != syscall.EACCES {
+			t.Errorf("Walk(%v) got error %v, want EACCES", names, err)
+		}
+	}
+	if _, pub, err := root.Walk([]string{"pub"}); err != nil {
+		t.Errorf("Walk(pub) failed, err: %v", err)
+	} else {
+		pub.Close()
+	}
+
+	// "../new" is cleaned to "new" at the root of the attach point.
+	if _, err := root.Mkdir("new", 0777, p9.UID(os.Getuid()), p9.GID(os.Getgid())); err != syscall.EACCES {
+		t.Errorf("Mkdir(new) got error %v, want EACCES", err)
+	}
+	if _, err := root.Symlink("/some/target", "secret", p9.UID(os.Getuid()), p9.GID(os.Getgid())); err != syscall.EACCES {
+		t.Errorf("Symlink(secret) got error %v, want EACCES", err)
+	}
+	if err := root.UnlinkAt("secret", linux.AT_REMOVEDIR); err != syscall.EACCES {
+		t.Errorf("UnlinkAt(secret) got error %v, want EACCES", err)
+	}
+}
+
+func TestDenyPathsRename(t *testing.T) {
+	dir, err := ioutil.TempDir("", "root-")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir() failed, err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Mkdir(path.Join(dir, "a"), 0777); err != nil {
+		t.Fatalf("os.Mkdir() failed, err: %v", err)
+	}
+	for _, name := range []string{"a/secret", "a/pub"} {
+		if err := ioutil.WriteFile(path.Join(dir, name), []byte("data"), 0666); err != nil {
+			t.Fatalf("ioutil.WriteFile(%q) failed, err: %v", name, err)
+		}
+	}
+
+	a := NewAttachPoint(dir, Config{DenyPaths: []string{"a/secret", "a/new"}})
+	root, err := a.Attach("/")
+	if err != nil {
+		t.Fatalf("Attach(%q) failed, err: %v", "/", err)
+	}
+	defer root.Close()
+
+	// Renaming an ancestor would make the denied file reachable under a
+	// different path.
+	_, ancestor, err := root.Walk([]string{"a"})
+	if err != nil {
+		t.Fatalf("Walk(a) failed, err: %v", err)
+	}
+	defer ancestor.Close()
+	if err := ancestor.Rename(root, "b"); err != syscall.EACCES {
+		t.Errorf("Rename(a, b) got error %v, want EACCES", err)
+	}
+
+	// Files that aren't denied can still be moved.
+	_, pub, err := root.Walk([]string{"a", "pub"})
+	if err != nil {
+		t.Fatalf("Walk(a/pub) failed, err: %v", err)
+	}
+	defer pub.Close()
+	if err := pub.Rename(root, "pub"); err != nil {
+		t.Errorf("Rename(a/pub, pub) failed, err: %v", err)
+	}
+
+	// Denial follows the files if they are moved or linked on the host.
+	if err := os.Rename(path.Join(dir, "a"), path.Join(dir, "b")); err != nil {
+		t.Fatalf("os.Rename() failed, err: %v", err)
+	}
+	if err := os.Link(path.Join(dir, "b", "secret"), path.Join(dir, "link")); err != nil {
+		t.Fatalf("os.Link() failed, err: %v", err)
+	}
+	for _, names := range [][]string{{"b", "secret"}, {"link"}} {
+		if _, _, err := root.Walk(names); err != syscall.EACCES {
+			t.Errorf("Walk(%v) got error %v, want EACCES", names, err)
+		}
+	}
+	_, b, err := root.Walk([]string{"b"})
+	if err != nil {
+		t.Fatalf("Walk(b) failed, err: %v", err)
+	}
+	defer b.Close()
+	if _, _, _, _, err := b.Create("new", p9.ReadWrite, 0777, p9.UID(os.Getuid()), p9.GID(os.Getgid())); err != syscall.EACCES {
+		t.Errorf("Create(b/new) got error %v, want EACCES", err)
+	}
+}
+
+func TestProfileApply(t *testing.T) {
+	dir, err := ioutil.TempDir("", "profile-")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir() failed, err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := path.Join(dir, "profile.json")
+	data := `{"mounts": [{"destination": "/", "readonly": true}, {"destination": "/data/", "deny_paths": ["a", "b"]}]}`
+	if err := ioutil.WriteFile(file, []byte(data), 0644); err != nil {
+		t.Fatalf("ioutil.WriteFile(%q) failed, err: %v", file, err)
+	}
+	p, err := LoadProfile(file)
+	if err != nil {
+		t.Fatalf("LoadProfile(%q) failed, err: %v", file, err)
+	}
+
+	if c := p.Apply("/", Config{}); !c.ROMount || len(c.DenyPaths) != 0 {
+		t.Errorf("Apply(/) = %+v, want ROMount and no DenyPaths", c)
+	}
+	if c := p.Apply("/data", Config{DenyPaths: []string{"c"}}); c.ROMount || strings.Join(c.DenyPaths, ",") != "c,a,b" {
+		t.Errorf("Apply(/data) = %+v, want DenyPaths [c a b]", c)
+	}
+	if c := p.Apply("/other", Config{}); c.ROMount || len(c.DenyPaths) != 0 {
+		t.Errorf("Apply(/other) = %+v, want no restrictions", c)
+	}
+	var nilProfile *Profile
+	if c := nilProfile.Apply("/", Config{ROMount: true}); !c.ROMount {
+		t.Errorf("nil Profile Apply(/) = %+v, want unchanged", c)
+	}
+
+	if err := ioutil.WriteFile(file, []byte(`{"mounts": [{"destination": "data"}]}`), 0644); err != nil {
+		t.Fatalf("ioutil.WriteFile(%q) failed, err: %v", file, err)
+	}
+	if _, err := LoadProfile(file); err == nil {
+		t.Errorf("LoadProfile() with relative destination should have failed")
+	}
+}
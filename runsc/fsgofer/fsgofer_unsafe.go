@@ -37,6 +37,24 @@ func statAt(dirFd int, name string) (syscall.Stat_t, error) {
 	return stat, nil
 }
 
+// sysStatx is the number of statx(2) on amd64, which package syscall
+// doesn't define.
+const sysStatx = 332
+
+// btime returns the creation time of the file referred to by fd. ok is false
+// if the host kernel or filesystem doesn't report it.
+func btime(fd int) (ts linux.StatxTimestamp, ok bool) {
+	var empty byte
+	var stx linux.Statx
+	if _, _, err := syscall.Syscall6(sysStatx, uintptr(fd), uintptr(unsafe.Pointer(&empty)), linux.AT_EMPTY_PATH|linux.AT_STATX_DONT_SYNC, linux.STATX_BTIME, uintptr(unsafe.Pointer(&stx)), 0); err != 0 {
+		return linux.StatxTimestamp{}, false
+	}
+	if stx.Mask&linux.STATX_BTIME == 0 {
+		return linux.StatxTimestamp{}, false
+	}
+	return stx.Btime, true
+}
+
 func utimensat(dirFd int, name string, times [2]syscall.Timespec, flags int) error {
 	// utimensat(2) doesn't accept empty name, instead name must be nil to make it
 	// operate directly on 'dirFd' unlike other *at syscalls.
@@ -0,0 +1,89 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsgofer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path"
+)
+
+// Profile is a hardening profile for the gofer. It tightens the access that
+// the gofer grants to each mount beyond what the container spec requires.
+//
+// A profile is stored as JSON, for example:
+//
+//	{
+//	  "mounts": [
+//	    {"destination": "/", "readonly": true},
+//	    {"destination": "/data", "deny_paths": ["secrets", "keys/private"]}
+//	  ]
+//	}
+type Profile struct {
+	// Mounts contains the restrictions for each mount. Mounts without an
+	// entry are served as configured by the spec.
+	Mounts []MountProfile `json:"mounts"`
+}
+
+// MountProfile contains the restrictions for a single mount.
+type MountProfile struct {
+	// Destination is the mount point in the container that this entry
+	// applies to, or "/" for the root filesystem.
+	Destination string `json:"destination"`
+
+	// ReadOnly forces the mount to be served read-only, even if the spec
+	// allows writes.
+	ReadOnly bool `json:"readonly"`
+
+	// DenyPaths are paths relative to the mount that may not be accessed
+	// or created. See Config.DenyPaths.
+	DenyPaths []string `json:"deny_paths"`
+}
+
+// LoadProfile reads a Profile from the JSON file at filename.
+func LoadProfile(filename string) (*Profile, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error reading gofer profile %q: %v", filename, err)
+	}
+	var p Profile
+	if err := json.Unmarshal(b, &p); err != nil {
+		return nil, fmt.Errorf("error parsing gofer profile %q: %v", filename, err)
+	}
+	for _, m := range p.Mounts {
+		if !path.IsAbs(m.Destination) {
+			return nil, fmt.Errorf("gofer profile %q: mount destination %q is not absolute", filename, m.Destination)
+		}
+	}
+	return &p, nil
+}
+
+// Apply returns c with the restrictions for the mount at destination added.
+// A nil Profile adds no restrictions.
+func (p *Profile) Apply(destination string, c Config) Config {
+	if p == nil {
+		return c
+	}
+	destination = path.Clean(destination)
+	for _, m := range p.Mounts {
+		if path.Clean(m.Destination) != destination {
+			continue
+		}
+		c.ROMount = c.ROMount || m.ReadOnly
+		c.DenyPaths = append(append([]string(nil), c.DenyPaths...), m.DenyPaths...)
+	}
+	return c
+}
@@ -0,0 +1,89 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imagepolicy
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// TreeDigest returns the tree digest of the directory dir, in the form
+// sha256:<hex digest>.
+//
+// The tree digest is the SHA-256 digest of a listing of every file under dir,
+// including dir itself, in lexical order. Each file is listed with its path
+// relative to dir, its type, its permission bits, its owner and group, and
+// its SHA-256 digest for regular files, its target for symbolic links, or its
+// device number for devices. Timestamps, extended attributes and hard links
+// are not part of the digest.
+func TreeDigest(dir string) (string, error) {
+	h := sha256.New()
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		st, ok := fi.Sys().(*syscall.Stat_t)
+		if !ok {
+			return fmt.Errorf("no stat information for %q", path)
+		}
+		fmt.Fprintf(h, "%q %o %d %d", rel, st.Mode, st.Uid, st.Gid)
+
+		switch st.Mode & syscall.S_IFMT {
+		case syscall.S_IFREG:
+			d, err := fileDigest(path)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(h, " %x", d)
+		case syscall.S_IFLNK:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(h, " %q", target)
+		case syscall.S_IFCHR, syscall.S_IFBLK:
+			fmt.Fprintf(h, " %d", st.Rdev)
+		}
+		fmt.Fprintln(h)
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("error computing digest of %q: %v", dir, err)
+	}
+	return fmt.Sprintf("sha256:%x", h.Sum(nil)), nil
+}
+
+// fileDigest returns the SHA-256 digest of the contents of the regular file
+// at path.
+func fileDigest(path string) ([]byte, error) {
+	f, err := os.OpenFile(path, os.O_RDONLY|syscall.O_NOFOLLOW, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
@@ -0,0 +1,321 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package imagepolicy verifies the root filesystem of a container against a
+// signed integrity policy before the container is started.
+package imagepolicy
+
+import (
+	"bufio"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Policy is an integrity policy for the root filesystem of a container. The
+// root filesystem is accepted only if it matches every measurement in the
+// policy.
+//
+// A policy is stored as JSON, for example:
+//
+//	{
+//	  "rootfs": "sha256:4c1d...",
+//	  "layers": ["sha256:9e0f...", "sha256:17ab..."],
+//	  "verity": {"usr/bin/server": "sha256:d2c8..."}
+//	}
+//
+// and is signed with a detached signature, stored next to it with a ".sig"
+// suffix, over its SHA-256 digest. For example, with openssl:
+//
+//	openssl dgst -sha256 -sign key.pem -out policy.json.sig policy.json
+//
+// Use "runsc image-policy" to generate a policy for a root filesystem.
+type Policy struct {
+	// Rootfs is the tree digest of the root filesystem, as seen by the
+	// container. See TreeDigest.
+	Rootfs string `json:"rootfs,omitempty"`
+
+	// Layers are the tree digests of the read-only layers of the root
+	// filesystem, from the bottom layer to the top one. The root
+	// filesystem must be an overlay mount, whose lower directories are the
+	// layers; its writable upper directory is not verified.
+	Layers []string `json:"layers,omitempty"`
+
+	// Verity maps paths in the root filesystem, relative to its root, to
+	// their fs-verity measurements in the form <algorithm>:<hex digest>.
+	// The files must have fs-verity enabled, and the paths may not
+	// traverse symbolic links.
+	Verity map[string]string `json:"verity,omitempty"`
+}
+
+// digestRE matches tree digests and fs-verity measurements.
+var digestRE = regexp.MustCompile(`^(sha256:[0-9a-f]{64}|sha512:[0-9a-f]{128})$`)
+
+// Load reads the Policy in the JSON file at filename, and checks its detached
+// signature in filename+".sig" with the PEM-encoded RSA or ECDSA public key in
+// keyFilename.
+func Load(filename, keyFilename string) (*Policy, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error reading image policy %q: %v", filename, err)
+	}
+	sig, err := ioutil.ReadFile(filename + ".sig")
+	if err != nil {
+		return nil, fmt.Errorf("error reading image policy signature: %v", err)
+	}
+	key, err := ioutil.ReadFile(keyFilename)
+	if err != nil {
+		return nil, fmt.Errorf("error reading image policy key %q: %v", keyFilename, err)
+	}
+	if err := verifySignature(b, sig, key); err != nil {
+		return nil, fmt.Errorf("image policy %q: %v", filename, err)
+	}
+
+	var p Policy
+	if err := json.Unmarshal(b, &p); err != nil {
+		return nil, fmt.Errorf("error parsing image policy %q: %v", filename, err)
+	}
+	if err := p.validate(); err != nil {
+		return nil, fmt.Errorf("image policy %q: %v", filename, err)
+	}
+	return &p, nil
+}
+
+// validate checks that p is well-formed.
+func (p *Policy) validate() error {
+	if p.Rootfs == "" && len(p.Layers) == 0 && len(p.Verity) == 0 {
+		return fmt.Errorf("policy has no measurements")
+	}
+	if p.Rootfs != "" && !digestRE.MatchString(p.Rootfs) {
+		return fmt.Errorf("invalid rootfs digest %q", p.Rootfs)
+	}
+	for _, d := range p.Layers {
+		if !digestRE.MatchString(d) {
+			return fmt.Errorf("invalid layer digest %q", d)
+		}
+	}
+	for path, d := range p.Verity {
+		if filepath.IsAbs(path) || filepath.Clean(path) != path || strings.HasPrefix(path, "..") {
+			return fmt.Errorf("verity path %q is not a clean relative path", path)
+		}
+		if !digestRE.MatchString(d) {
+			return fmt.Errorf("invalid verity measurement %q for %q", d, path)
+		}
+	}
+	return nil
+}
+
+// verifySignature checks that sig is a signature of the SHA-256 digest of
+// data by the PEM-encoded public key in key.
+func verifySignature(data, sig, key []byte) error {
+	block, _ := pem.Decode(key)
+	if block == nil {
+		return fmt.Errorf("key is not PEM-encoded")
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("error parsing key: %v", err)
+	}
+
+	digest := sha256.Sum256(data)
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig); err != nil {
+			return fmt.Errorf("invalid signature: %v", err)
+		}
+	case *ecdsa.PublicKey:
+		var es struct {
+			R, S *big.Int
+		}
+		if rest, err := asn1.Unmarshal(sig, &es); err != nil || len(rest) != 0 {
+			return fmt.Errorf("invalid signature: malformed ECDSA signature")
+		}
+		if !ecdsa.Verify(pub, digest[:], es.R, es.S) {
+			return fmt.Errorf("invalid signature")
+		}
+	default:
+		return fmt.Errorf("unsupported key type %T", pub)
+	}
+	return nil
+}
+
+// Verify checks the root filesystem at rootfs against p.
+func (p *Policy) Verify(rootfs string) error {
+	if p.Rootfs != "" {
+		d, err := TreeDigest(rootfs)
+		if err != nil {
+			return err
+		}
+		if d != p.Rootfs {
+			return fmt.Errorf("rootfs digest %s doesn't match policy digest %s", d, p.Rootfs)
+		}
+	}
+
+	if len(p.Layers) != 0 {
+		layers, err := OverlayLayers(rootfs)
+		if err != nil {
+			return err
+		}
+		if len(layers) != len(p.Layers) {
+			return fmt.Errorf("rootfs has %d layers, policy has %d", len(layers), len(p.Layers))
+		}
+		for i, layer := range layers {
+			d, err := TreeDigest(layer)
+			if err != nil {
+				return err
+			}
+			if d != p.Layers[i] {
+				return fmt.Errorf("digest %s of layer %d (%q) doesn't match policy digest %s", d, i, layer, p.Layers[i])
+			}
+		}
+	}
+
+	// Check the files in a stable order, so that failures are reproducible.
+	paths := make([]string, 0, len(p.Verity))
+	for path := range p.Verity {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		d, err := Measure(rootfs, path)
+		if err != nil {
+			return err
+		}
+		if d != p.Verity[path] {
+			return fmt.Errorf("fs-verity measurement %s of %q doesn't match policy measurement %s", d, path, p.Verity[path])
+		}
+	}
+	return nil
+}
+
+// Measure returns the fs-verity measurement of the file at path, relative to
+// rootfs. path may not traverse symbolic links, since they would be resolved
+// on the host rather than in the container.
+func Measure(rootfs, path string) (string, error) {
+	cur := rootfs
+	for _, name := range strings.Split(filepath.Clean(path), string(filepath.Separator)) {
+		cur = filepath.Join(cur, name)
+		fi, err := os.Lstat(cur)
+		if err != nil {
+			return "", err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return "", fmt.Errorf("%q: path traverses symbolic link %q", path, cur)
+		}
+	}
+	f, err := os.OpenFile(cur, os.O_RDONLY|syscall.O_NOFOLLOW, 0)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	d, err := measureVerity(f)
+	if err != nil {
+		return "", fmt.Errorf("error measuring %q: %v", path, err)
+	}
+	return d, nil
+}
+
+// OverlayLayers returns the lower directories of the overlay filesystem
+// mounted at rootfs, from the bottom layer to the top one.
+func OverlayLayers(rootfs string) ([]string, error) {
+	rootfs, err := filepath.EvalSymlinks(rootfs)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// If several filesystems are mounted at rootfs, the last one is
+	// visible.
+	var fstype, opts string
+	found := false
+	s := bufio.NewScanner(f)
+	s.Buffer(nil, 1<<20)
+	for s.Scan() {
+		// See proc(5) for the format of mountinfo lines.
+		fields := strings.Fields(s.Text())
+		sep := -1
+		for i, f := range fields {
+			if f == "-" {
+				sep = i
+				break
+			}
+		}
+		if len(fields) < 5 || sep < 0 || len(fields) < sep+4 {
+			continue
+		}
+		if unescapeMountinfo(fields[4]) != rootfs {
+			continue
+		}
+		fstype, opts, found = fields[sep+1], fields[sep+3], true
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if !found || fstype != "overlay" {
+		return nil, fmt.Errorf("rootfs %q is not an overlay mount", rootfs)
+	}
+
+	for _, opt := range strings.Split(opts, ",") {
+		if !strings.HasPrefix(opt, "lowerdir=") {
+			continue
+		}
+		dirs := strings.Split(strings.TrimPrefix(opt, "lowerdir="), ":")
+		// Overlay lists lower directories from the top one down.
+		layers := make([]string, len(dirs))
+		for i, dir := range dirs {
+			layers[len(dirs)-1-i] = unescapeMountinfo(dir)
+		}
+		return layers, nil
+	}
+	return nil, fmt.Errorf("overlay rootfs %q has no lower directories", rootfs)
+}
+
+// unescapeMountinfo undoes the octal escaping of whitespace and backslashes in
+// mountinfo fields.
+func unescapeMountinfo(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if c, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,238 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imagepolicy
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeKey writes the PEM encoding of pub to a file in dir, and returns its
+// path.
+func writeKey(t *testing.T, dir string, pub crypto.PublicKey) string {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatalf("MarshalPKIXPublicKey failed: %v", err)
+	}
+	path := filepath.Join(dir, "key.pem")
+	if err := ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	return path
+}
+
+// writePolicy writes policy and its signature by priv to files in dir, and
+// returns the path of the policy.
+func writePolicy(t *testing.T, dir, policy string, priv crypto.Signer) string {
+	digest := sha256.Sum256([]byte(policy))
+	sig, err := priv.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	path := filepath.Join(dir, "policy.json")
+	if err := ioutil.WriteFile(path, []byte(policy), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if err := ioutil.WriteFile(path+".sig", sig, 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	digest := "sha256:" + strings.Repeat("ab", 32)
+
+	for _, tc := range []struct {
+		name    string
+		policy  string
+		signer  crypto.Signer
+		key     crypto.PublicKey
+		wantErr bool
+	}{
+		{
+			name:   "ecdsa",
+			policy: `{"rootfs": "` + digest + `"}`,
+			signer: ecKey,
+			key:    ecKey.Public(),
+		},
+		{
+			name:   "rsa",
+			policy: `{"layers": ["` + digest + `"], "verity": {"usr/bin/true": "` + digest + `"}}`,
+			signer: rsaKey,
+			key:    rsaKey.Public(),
+		},
+		{
+			name:    "wrong key",
+			policy:  `{"rootfs": "` + digest + `"}`,
+			signer:  otherKey,
+			key:     ecKey.Public(),
+			wantErr: true,
+		},
+		{
+			name:    "empty",
+			policy:  `{}`,
+			signer:  ecKey,
+			key:     ecKey.Public(),
+			wantErr: true,
+		},
+		{
+			name:    "invalid digest",
+			policy:  `{"rootfs": "sha256:abc"}`,
+			signer:  ecKey,
+			key:     ecKey.Public(),
+			wantErr: true,
+		},
+		{
+			name:    "absolute verity path",
+			policy:  `{"verity": {"/usr/bin/true": "` + digest + `"}}`,
+			signer:  ecKey,
+			key:     ecKey.Public(),
+			wantErr: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "imagepolicy")
+			if err != nil {
+				t.Fatalf("TempDir failed: %v", err)
+			}
+			defer os.RemoveAll(dir)
+
+			path := writePolicy(t, dir, tc.policy, tc.signer)
+			_, err = Load(path, writeKey(t, dir, tc.key))
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Errorf("Load got err %v, wantErr %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadTampered(t *testing.T) {
+	dir, err := ioutil.TempDir("", "imagepolicy")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+
+	path := writePolicy(t, dir, `{"rootfs": "sha256:`+strings.Repeat("ab", 32)+`"}`, key)
+	if err := ioutil.WriteFile(path, []byte(`{"rootfs": "sha256:`+strings.Repeat("cd", 32)+`"}`), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if _, err := Load(path, writeKey(t, dir, key.Public())); err == nil {
+		t.Errorf("Load of tampered policy succeeded")
+	}
+}
+
+func TestVerifyRootfs(t *testing.T) {
+	rootfs, err := ioutil.TempDir("", "rootfs")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(rootfs)
+	if err := os.MkdirAll(filepath.Join(rootfs, "bin"), 0755); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+	bin := filepath.Join(rootfs, "bin", "app")
+	if err := ioutil.WriteFile(bin, []byte("app"), 0755); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if err := os.Symlink("app", filepath.Join(rootfs, "bin", "link")); err != nil {
+		t.Fatalf("Symlink failed: %v", err)
+	}
+
+	d, err := TreeDigest(rootfs)
+	if err != nil {
+		t.Fatalf("TreeDigest failed: %v", err)
+	}
+	p := &Policy{Rootfs: d}
+	if err := p.Verify(rootfs); err != nil {
+		t.Errorf("Verify of unmodified rootfs failed: %v", err)
+	}
+
+	// Changes to contents and to permissions are both detected.
+	if err := ioutil.WriteFile(bin, []byte("evil"), 0755); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if err := p.Verify(rootfs); err == nil {
+		t.Errorf("Verify of modified file succeeded")
+	}
+	if err := ioutil.WriteFile(bin, []byte("app"), 0755); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if err := p.Verify(rootfs); err != nil {
+		t.Errorf("Verify of restored rootfs failed: %v", err)
+	}
+	if err := os.Chmod(bin, os.ModeSetuid|0755); err != nil {
+		t.Fatalf("Chmod failed: %v", err)
+	}
+	if err := p.Verify(rootfs); err == nil {
+		t.Errorf("Verify of setuid file succeeded")
+	}
+}
+
+func TestMeasureSymlink(t *testing.T) {
+	rootfs, err := ioutil.TempDir("", "rootfs")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(rootfs)
+	if err := os.Symlink("/usr", filepath.Join(rootfs, "usr")); err != nil {
+		t.Fatalf("Symlink failed: %v", err)
+	}
+	if _, err := Measure(rootfs, "usr/bin/true"); err == nil || !strings.Contains(err.Error(), "symbolic link") {
+		t.Errorf("Measure through symlink got err %v, want symbolic link error", err)
+	}
+}
+
+func TestUnescapeMountinfo(t *testing.T) {
+	for _, tc := range []struct {
+		in, want string
+	}{
+		{`/run/rootfs`, `/run/rootfs`},
+		{`/run/my\040rootfs`, `/run/my rootfs`},
+		{`/run/a\134b`, `/run/a\b`},
+		{`/run/a\`, `/run/a\`},
+	} {
+		if got := unescapeMountinfo(tc.in); got != tc.want {
+			t.Errorf("unescapeMountinfo(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
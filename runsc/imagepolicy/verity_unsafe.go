@@ -0,0 +1,65 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imagepolicy
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// FS_IOC_MEASURE_VERITY and the fs-verity hash algorithms, from
+// include/uapi/linux/fsverity.h.
+const (
+	fsIOCMeasureVerity = 0xc0046686
+
+	fsVerityHashAlgSHA256 = 1
+	fsVerityHashAlgSHA512 = 2
+)
+
+// fsverityDigest is struct fsverity_digest, with room for the largest
+// supported digest.
+type fsverityDigest struct {
+	alg    uint16
+	size   uint16
+	digest [64]byte
+}
+
+// measureVerity returns the fs-verity measurement of f, in the form
+// <algorithm>:<hex digest>.
+func measureVerity(f *os.File) (string, error) {
+	d := fsverityDigest{size: uint16(len(fsverityDigest{}.digest))}
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), fsIOCMeasureVerity, uintptr(unsafe.Pointer(&d))); errno != 0 {
+		if errno == syscall.ENODATA {
+			return "", fmt.Errorf("fs-verity is not enabled")
+		}
+		return "", errno
+	}
+
+	var alg string
+	switch d.alg {
+	case fsVerityHashAlgSHA256:
+		alg = "sha256"
+	case fsVerityHashAlgSHA512:
+		alg = "sha512"
+	default:
+		return "", fmt.Errorf("unknown fs-verity hash algorithm %d", d.alg)
+	}
+	if int(d.size) > len(d.digest) {
+		return "", fmt.Errorf("invalid fs-verity digest size %d", d.size)
+	}
+	return fmt.Sprintf("%s:%x", alg, d.digest[:d.size]), nil
+}
@@ -19,8 +19,11 @@ package main
 import (
 	"fmt"
 	"io"
+	"math"
+	"net"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -29,7 +32,11 @@ import (
 	"flag"
 
 	"github.com/google/subcommands"
+	"gvisor.googlesource.com/gvisor/pkg/dns"
 	"gvisor.googlesource.com/gvisor/pkg/log"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/flightrecorder"
+	sentrytime "gvisor.googlesource.com/gvisor/pkg/sentry/time"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/watchdog"
 	"gvisor.googlesource.com/gvisor/runsc/boot"
 	"gvisor.googlesource.com/gvisor/runsc/cmd"
 )
@@ -48,38 +55,123 @@ var (
 	// Debugging flags.
 	debugLogDir = flag.String("debug-log-dir", "", "additional location for logs. It creates individual log files per command")
 	logPackets  = flag.Bool("log-packets", false, "enable network packet logging")
+	logMaxSize  = flag.Int64("log-max-size", 0, "size in bytes beyond which the files of --log and --debug-log-dir are rotated, by renaming <file> to <file>.1, <file>.1 to <file>.2 and so on. 0 (default) disables rotation.")
+	logMaxFiles = flag.Int("log-max-files", 5, "number of rotated log files that are kept. Only applies with --log-max-size.")
+	logRingSize = flag.Int("log-ring-size", 0, "number of recent log messages that are kept in memory and written to stderr if the sandbox panics, and to the --resource-report. 0 (default) disables the ring.")
 
 	// Debugging flags: strace related
 	strace         = flag.Bool("strace", false, "enable strace")
-	straceSyscalls = flag.String("strace-syscalls", "", "comma-separated list of syscalls to trace. If --strace is true and this list is empty, then all syscalls will be traced.")
+	straceSyscalls = flag.String("strace-syscalls", "", "comma-separated list of syscalls, or syscall groups such as %file or %network, to trace. If --strace is true and this list is empty, then all syscalls will be traced.")
 	straceLogSize  = flag.Uint("strace-log-size", 1024, "default size (in bytes) to log data argument blobs")
+	straceRingSize = flag.Uint("strace-ring-size", 0, "number of recent syscalls that each task records without logging, and logs when it hits an unimplemented syscall, an unhandled fault, or a watchdog stall. Only syscalls in --strace-syscalls are recorded, if set. 0 (default) disables recording.")
+
+	// Debugging flags: syscall latency related
+	syscallLatency       = flag.Bool("syscall-latency", false, "record the latency of each syscall in the /syscalls/latency metric")
+	slowSyscallThreshold = flag.Duration("slow-syscall-threshold", 0, "log syscalls that take at least this long. Only applies with --syscall-latency. 0 (default) disables logging.")
+
+	// Debugging flags: profiling and watchdog related
+	profileBlock    = flag.Bool("profile-block", false, "record blocking events at all times, so that block profiles collected by 'runsc profile' include events from before the profile was requested")
+	profileMutex    = flag.Bool("profile-mutex", false, "record mutex contention at all times, so that mutex profiles collected by 'runsc profile' include events from before the profile was requested")
+	watchdogTimeout = flag.Duration("watchdog-timeout", watchdog.DefaultTimeout, "time after which a task that is stuck in a syscall, or is not scheduled, is reported by the watchdog. 0 disables the watchdog.")
+	watchdogAction  = flag.String("watchdog-action", "log", "what the watchdog does when a task is stuck: log (default) logs the stacks of the stuck tasks, panic also panics the sandbox")
+
+	// Debugging flags: flight recorder related
+	flightRecorderPeriod  = flag.Duration("flight-recorder-period", 0, "sample the goroutine stacks and task states of the sentry this often, and keep the recent samples in memory to be dumped by 'runsc debug --flight-record'. 0 (default) disables sampling.")
+	flightRecorderSamples = flag.Uint("flight-recorder-samples", flightrecorder.DefaultSamples, "number of recent samples kept by the flight recorder")
+
+	// Debugging flags: process log related
+	processLogSize = flag.Uint("process-log-size", 0, "record process fork, exec and exit events, keeping this many recent events in memory to be dumped by 'runsc debug --process-log'. Events are also emitted on the event channel. 0 (default) disables recording.")
+
+	// Debugging flags: resource usage related
+	resourceReport = flag.String("resource-report", "", "path of a file where a JSON report of the resource usage of the sandbox (peak memory, CPU time, I/O and syscall counts) is written when it exits")
+
+	// Flags that limit the run time of the sandbox.
+	timeLimit       = flag.Duration("time-limit", 0, "wall time, from the start of the container, after which --time-limit-action is taken. 0 (default) means unlimited.")
+	cpuTimeLimit    = flag.Duration("cpu-time-limit", 0, "CPU time used by the sandbox after which --time-limit-action is taken. CPU time is checked every second. 0 (default) means unlimited.")
+	timeLimitAction = flag.String("time-limit-action", "kill", "what happens when --time-limit or --cpu-time-limit is exceeded: kill (default) kills the sandbox, checkpoint saves it to --time-limit-image and then exits")
+	timeLimitImage  = flag.String("time-limit-image", "", "path of the file where the sandbox is checkpointed with --time-limit-action=checkpoint. The file is created when the sandbox is created, and left empty if the limit is not exceeded.")
+	timeLimitReport = flag.String("time-limit-report", "", "path of a file where a JSON report (limit, elapsed wall and CPU time, running processes and the outcome of the action) is written if the time limit is exceeded")
 
 	// Flags that control sandbox runtime behavior.
-	platform   = flag.String("platform", "ptrace", "specifies which platform to use: ptrace (default), kvm")
-	network    = flag.String("network", "sandbox", "specifies which network to use: sandbox (default), host, none. Using network inside the sandbox is more secure because it's isolated from the host network.")
-	fileAccess = flag.String("file-access", "proxy", "specifies which filesystem to use: proxy (default), direct. Using a proxy is more secure because it disallows the sandbox from opennig files directly in the host.")
-	overlay    = flag.Bool("overlay", false, "wrap filesystem mounts with writable overlay. All modifications are stored in memory inside the sandbox.")
+	platform      = flag.String("platform", "ptrace", "specifies which platform to use: ptrace (default), kvm")
+	kvmClock      = flag.String("kvm-clock", "tsc", "how applications read time with --platform=kvm: tsc (default) reads the host TSC passed through to the sandbox without syscalls, sentry makes all reads of time syscalls served by the sentry, auto uses tsc if the host TSC is invariant and can be passed through exactly, and sentry otherwise")
+	network       = flag.String("network", "sandbox", "specifies which network to use: sandbox (default), host, none, nat. Using network inside the sandbox is more secure because it's isolated from the host network.")
+	egressPolicy  = flag.String("egress-policy", "", "path to a JSON policy that restricts the outbound traffic of the sandbox by destination subnet, host name and port. Only applies with --network=sandbox or --network=nat.")
+	socketPolicy  = flag.String("socket-policy", "", "path to a JSON policy that restricts the addresses that sockets can be connected and bound to by subnet, protocol and port. Only applies with --network=host.")
+	metadata      = flag.String("metadata", "", "path to a JSON file with the responses of an HTTP metadata service in the sandbox network at 169.254.169.254, or at the address given in the file. Doesn't apply with --network=host.")
+	fileAccess    = flag.String("file-access", "proxy", "specifies which filesystem to use: proxy (default), direct, donated. Using a proxy is more secure because it disallows the sandbox from opennig files directly in the host. With donated, the gofer opens each mount and donates it to the sandbox, which accesses files under it directly.")
+	overlay       = flag.Bool("overlay", false, "wrap filesystem mounts with writable overlay. All modifications are stored in memory inside the sandbox.")
+	goferProfile  = flag.String("gofer-profile", "", "path to a JSON hardening profile that restricts the files the gofer serves for each mount. Only applies with --file-access=proxy.")
+	goferChannels = flag.Int("gofer-channels", 4, "number of sockets connecting the sandbox to the gofer for each mount, over which file requests are spread. Only applies with --file-access=proxy.")
+	goferWorkers  = flag.Int("gofer-workers", 64, "maximum number of file requests the gofer handles at once for each mount. 0 means unlimited. Only applies with --file-access=proxy.")
+	maxTasks      = flag.Uint64("max-tasks", 0, "maximum number of tasks that may exist in the sandbox at once. Task creation beyond the limit fails with EAGAIN. 0 (default) means unlimited.")
+	hostNotify    = flag.Bool("host-notify", false, "forward changes made on the host to files served by the gofer as inotify events inside the sandbox. Only applies with --file-access=proxy.")
+	timeSlice     = flag.Duration("time-slice", 0, "time for which a task may run application code before it is preempted, when more tasks are running than the sandbox has CPUs. 0 (default) leaves scheduling to the Go runtime and the host.")
+	hostNiceness  = flag.Bool("host-niceness", false, "apply the niceness of each task to the host thread that runs it. Only applies with --platform=ptrace. Decreasing niceness requires CAP_SYS_NICE.")
+	deviceProxy   = flag.String("device-proxy", "", "comma-separated list of host devices, such as /dev/nvidia0, to proxy into the sandbox's /dev. Only a safelisted set of ioctls is forwarded to the host driver.")
+	ociSeccomp    = flag.Bool("oci-seccomp", true, "enforce the seccomp profile in the spec on the container's processes, as runc does. If false, the profile is ignored.")
+	corePattern   = flag.String("core-pattern", "core", "pattern of the names of the core dumps of sandboxed processes, as in /proc/sys/kernel/core_pattern. Cores are only dumped if RLIMIT_CORE allows it. Empty disables core dumps.")
+
+	// Flags that control image integrity.
+	imagePolicy    = flag.String("image-policy", "", "path to a signed JSON policy with the digests of the root filesystem, its overlay layers or the fs-verity measurements of its files. Containers whose root filesystem doesn't match the policy are not created. Requires --image-policy-key.")
+	imagePolicyKey = flag.String("image-policy-key", "", "path to the PEM-encoded RSA or ECDSA public key that --image-policy is signed with. The signature is read from the policy path with a .sig suffix.")
+
+	// Flags that control timekeeping.
+	vdsoUpdateInterval = flag.Duration("vdso-update-interval", sentrytime.DefaultUpdateInterval, "interval at which the timekeeping parameters used by the vDSO are updated, between 1ms and 10s. Shorter intervals correct clock drift sooner, at the cost of more CPU time.")
+	taiOffset          = flag.Int("tai-offset", -1, "offset of CLOCK_TAI from CLOCK_REALTIME in the sandbox, in seconds. -1 (default) uses the offset of the host.")
+
+	// Flags that control redirection of TCP connections to an interception proxy.
+	tcpRedirect           = flag.Uint("tcp-redirect", 0, "redirect outbound TCP connections to this port on the loopback address, where an interception proxy can retrieve their original destination with SO_ORIGINAL_DST. Doesn't apply with --network=host. 0 (default) disables redirection.")
+	tcpRedirectPorts      = flag.String("tcp-redirect-ports", "", "comma-separated list of destination ports of the connections redirected by --tcp-redirect. Empty (default) redirects connections to all ports.")
+	tcpRedirectExemptUIDs = flag.String("tcp-redirect-exempt-uids", "", "comma-separated list of UIDs whose connections are not redirected by --tcp-redirect, such as the UID of the interception proxy.")
+
+	// Flags that control the DNS resolver in the sandbox.
+	dnsResolver = flag.String("dns-resolver", "", "address in the sandbox network, e.g. 169.254.169.253, at which a caching DNS resolver answers queries. Requires --dns-upstream. Doesn't apply with --network=host.")
+	dnsUpstream = flag.String("dns-upstream", "", "comma-separated list of servers that the DNS resolver forwards queries to, in order of preference, in the format <ip>[:<port>] for DNS over UDP and TCP, or tls://<ip>[:<port>][#<server name>] for DNS over TLS.")
+	dnsSearch   = flag.String("dns-search", "", "comma-separated list of search domains of the DNS resolver, which are tried for single-label names.")
+
+	// Flags that control socket activation.
+	socketActivation = flag.String("socket-activation", "", "comma-separated list of sockets, in the format <network>:<port> (e.g. 'tcp:8080,udp:53'), that are listening in the sandbox before the container starts and are passed to it with the systemd socket activation protocol (LISTEN_FDS). Doesn't apply with --network=host.")
+
+	// Flags that control bridging of abstract unix sockets.
+	abstractBridge = flag.String("abstract-bridge", "", "comma-separated list of abstract unix sockets to bridge between the sandbox and the host, in the format import:<name> (sandbox processes connect to a host socket) or export:<name>[:<uid>+<uid>...] (host processes of the given UIDs, or any UID, connect to a sandbox socket). Only applies with --file-access=proxy.")
 )
 
 var gitRevision = ""
 
 func main() {
-	// Help and flags commands are generated automatically.
+	// Help command is generated automatically, and the flags command
+	// extends the generated one.
 	subcommands.Register(subcommands.HelpCommand(), "")
-	subcommands.Register(subcommands.FlagsCommand(), "")
+	subcommands.Register(new(cmd.Flags), "")
 
 	// Register user-facing runsc commands.
+	subcommands.Register(new(cmd.Checkpoint), "")
 	subcommands.Register(new(cmd.Create), "")
+	subcommands.Register(new(cmd.Debug), "")
 	subcommands.Register(new(cmd.Delete), "")
+	subcommands.Register(new(cmd.Do), "")
+	subcommands.Register(new(cmd.Drain), "")
 	subcommands.Register(new(cmd.Events), "")
 	subcommands.Register(new(cmd.Exec), "")
 	subcommands.Register(new(cmd.Gofer), "")
+	subcommands.Register(new(cmd.ImagePolicy), "")
 	subcommands.Register(new(cmd.Kill), "")
 	subcommands.Register(new(cmd.List), "")
+	subcommands.Register(new(cmd.MetricServer), "")
+	subcommands.Register(new(cmd.Pause), "")
+	subcommands.Register(new(cmd.PortForward), "")
+	subcommands.Register(new(cmd.Profile), "")
 	subcommands.Register(new(cmd.PS), "")
+	subcommands.Register(new(cmd.Restore), "")
+	subcommands.Register(new(cmd.Resume), "")
 	subcommands.Register(new(cmd.Run), "")
 	subcommands.Register(new(cmd.Start), "")
 	subcommands.Register(new(cmd.State), "")
+	subcommands.Register(new(cmd.Strace), "")
+	subcommands.Register(new(cmd.Trace), "")
+	subcommands.Register(new(cmd.Update), "")
+	subcommands.Register(new(cmd.Wait), "")
 
 	// Register internal commands with the internal group name. This causes
 	// them to be sorted below the user-facing commands with empty group.
@@ -87,6 +179,7 @@ func main() {
 	const internalGroup = "internal use only"
 	subcommands.Register(new(cmd.Boot), internalGroup)
 	subcommands.Register(new(cmd.Gofer), internalGroup)
+	subcommands.Register(new(cmd.NAT), internalGroup)
 
 	// All subcommands must be registered before flag parsing.
 	flag.Parse()
@@ -96,6 +189,11 @@ func main() {
 		cmd.Fatalf("%v", err)
 	}
 
+	kvmClockType, err := boot.MakeKVMClock(*kvmClock)
+	if err != nil {
+		cmd.Fatalf("%v", err)
+	}
+
 	fsAccess, err := boot.MakeFileAccessType(*fileAccess)
 	if err != nil {
 		cmd.Fatalf("%v", err)
@@ -105,25 +203,219 @@ func main() {
 	if err != nil {
 		cmd.Fatalf("%v", err)
 	}
+	if *egressPolicy != "" && netType == boot.NetworkHost {
+		// The host network can't be filtered by the sandbox.
+		cmd.Fatalf("--egress-policy can't be used with --network=host")
+	}
+	if *socketPolicy != "" && netType != boot.NetworkHost {
+		// Other networks are filtered with --egress-policy.
+		cmd.Fatalf("--socket-policy can only be used with --network=host")
+	}
+	if *metadata != "" && netType == boot.NetworkHost {
+		cmd.Fatalf("--metadata can't be used with --network=host")
+	}
+	if *tcpRedirect > math.MaxUint16 {
+		cmd.Fatalf("invalid --tcp-redirect port %d", *tcpRedirect)
+	}
+	if *tcpRedirect != 0 && netType == boot.NetworkHost {
+		cmd.Fatalf("--tcp-redirect can't be used with --network=host")
+	}
+	var dnsResolverIP net.IP
+	if len(*dnsResolver) != 0 {
+		if netType == boot.NetworkHost {
+			cmd.Fatalf("--dns-resolver can't be used with --network=host")
+		}
+		if dnsResolverIP = net.ParseIP(*dnsResolver); dnsResolverIP == nil {
+			cmd.Fatalf("invalid --dns-resolver address %q", *dnsResolver)
+		}
+		if len(*dnsUpstream) == 0 {
+			cmd.Fatalf("--dns-resolver requires --dns-upstream")
+		}
+	}
+	var dnsUpstreams []dns.Upstream
+	if len(*dnsUpstream) != 0 {
+		dnsUpstreams, err = boot.ParseDNSUpstreams(*dnsUpstream)
+		if err != nil {
+			cmd.Fatalf("invalid --dns-upstream: %v", err)
+		}
+	}
+	var activationSockets []boot.ActivationSocket
+	if len(*socketActivation) != 0 {
+		if netType == boot.NetworkHost {
+			cmd.Fatalf("--socket-activation can't be used with --network=host")
+		}
+		activationSockets, err = boot.ParseActivationSockets(*socketActivation)
+		if err != nil {
+			cmd.Fatalf("invalid --socket-activation: %v", err)
+		}
+	}
+	var abstractBridges []boot.AbstractBridge
+	if len(*abstractBridge) != 0 {
+		if fsAccess != boot.FileAccessProxy {
+			cmd.Fatalf("--abstract-bridge can only be used with --file-access=proxy")
+		}
+		abstractBridges, err = boot.ParseAbstractBridges(*abstractBridge)
+		if err != nil {
+			cmd.Fatalf("invalid --abstract-bridge: %v", err)
+		}
+	}
+	var redirectPorts []uint16
+	if len(*tcpRedirectPorts) != 0 {
+		for _, s := range strings.Split(*tcpRedirectPorts, ",") {
+			p, err := strconv.ParseUint(s, 10, 16)
+			if err != nil {
+				cmd.Fatalf("invalid --tcp-redirect-ports: %v", err)
+			}
+			redirectPorts = append(redirectPorts, uint16(p))
+		}
+	}
+	var redirectExemptUIDs []uint32
+	if len(*tcpRedirectExemptUIDs) != 0 {
+		for _, s := range strings.Split(*tcpRedirectExemptUIDs, ",") {
+			uid, err := strconv.ParseUint(s, 10, 32)
+			if err != nil {
+				cmd.Fatalf("invalid --tcp-redirect-exempt-uids: %v", err)
+			}
+			redirectExemptUIDs = append(redirectExemptUIDs, uint32(uid))
+		}
+	}
+
+	wdAction, err := boot.MakeWatchdogAction(*watchdogAction)
+	if err != nil {
+		cmd.Fatalf("%v", err)
+	}
+	if (*imagePolicy == "") != (*imagePolicyKey == "") {
+		cmd.Fatalf("--image-policy and --image-policy-key must be used together")
+	}
+	if *goferChannels < 0 {
+		cmd.Fatalf("invalid --gofer-channels %d", *goferChannels)
+	}
+	if *goferWorkers < 0 {
+		cmd.Fatalf("invalid --gofer-workers %d", *goferWorkers)
+	}
+	if *watchdogTimeout < 0 {
+		cmd.Fatalf("invalid --watchdog-timeout %v", *watchdogTimeout)
+	}
+	if *flightRecorderPeriod < 0 {
+		cmd.Fatalf("invalid --flight-recorder-period %v", *flightRecorderPeriod)
+	}
+	if *flightRecorderSamples == 0 {
+		cmd.Fatalf("--flight-recorder-samples must be greater than 0")
+	}
+	tlAction, err := boot.MakeTimeLimitAction(*timeLimitAction)
+	if err != nil {
+		cmd.Fatalf("%v", err)
+	}
+	if *timeLimit < 0 {
+		cmd.Fatalf("invalid --time-limit %v", *timeLimit)
+	}
+	if *cpuTimeLimit < 0 {
+		cmd.Fatalf("invalid --cpu-time-limit %v", *cpuTimeLimit)
+	}
+	if tlAction == boot.TimeLimitCheckpoint && (*timeLimit != 0 || *cpuTimeLimit != 0) && *timeLimitImage == "" {
+		cmd.Fatalf("--time-limit-action=checkpoint requires --time-limit-image")
+	}
+
+	if strings.HasPrefix(*corePattern, "|") {
+		cmd.Fatalf("--core-pattern can't pipe to a program")
+	}
+	if *timeSlice < 0 {
+		cmd.Fatalf("--time-slice can't be negative")
+	}
+	if *vdsoUpdateInterval < sentrytime.MinUpdateInterval || *vdsoUpdateInterval > sentrytime.MaxUpdateInterval {
+		cmd.Fatalf("--vdso-update-interval must be between %v and %v", sentrytime.MinUpdateInterval, sentrytime.MaxUpdateInterval)
+	}
+	if *taiOffset < -1 || *taiOffset > math.MaxInt32 {
+		cmd.Fatalf("invalid --tai-offset %d", *taiOffset)
+	}
+	if *logMaxSize < 0 {
+		cmd.Fatalf("invalid --log-max-size %d", *logMaxSize)
+	}
+	if *logMaxFiles <= 0 {
+		cmd.Fatalf("--log-max-files must be greater than 0")
+	}
+	if *logRingSize < 0 {
+		cmd.Fatalf("invalid --log-ring-size %d", *logRingSize)
+	}
 
 	// Create a new Config from the flags.
 	conf := &boot.Config{
-		RootDir:       *rootDir,
-		Debug:         *debug,
-		LogFilename:   *logFilename,
-		LogFormat:     *logFormat,
-		DebugLogDir:   *debugLogDir,
-		FileAccess:    fsAccess,
-		Overlay:       *overlay,
-		Network:       netType,
-		LogPackets:    *logPackets,
-		Platform:      platformType,
-		Strace:        *strace,
-		StraceLogSize: *straceLogSize,
+		RootDir:          *rootDir,
+		Debug:            *debug,
+		LogFilename:      *logFilename,
+		LogFormat:        *logFormat,
+		LogMaxSize:       *logMaxSize,
+		LogMaxFiles:      *logMaxFiles,
+		LogRingSize:      *logRingSize,
+		DebugLogDir:      *debugLogDir,
+		FileAccess:       fsAccess,
+		Overlay:          *overlay,
+		HostNotify:       *hostNotify,
+		GoferProfile:     *goferProfile,
+		GoferChannels:    *goferChannels,
+		GoferWorkers:     *goferWorkers,
+		ImagePolicy:      *imagePolicy,
+		ImagePolicyKey:   *imagePolicyKey,
+		MaxTasks:         *maxTasks,
+		HostNiceness:     *hostNiceness,
+		TimeSlice:        *timeSlice,
+		CorePattern:      *corePattern,
+		IgnoreOCISeccomp: !*ociSeccomp,
+		Network:          netType,
+		EgressPolicy:     *egressPolicy,
+		SocketPolicy:     *socketPolicy,
+		Metadata:         *metadata,
+		LogPackets:       *logPackets,
+		Platform:         platformType,
+		KVMClock:         kvmClockType,
+		Strace:           *strace,
+		StraceLogSize:    *straceLogSize,
+		StraceRingSize:   *straceRingSize,
+
+		SyscallLatency:       *syscallLatency,
+		SlowSyscallThreshold: *slowSyscallThreshold,
+
+		ProfileBlock:    *profileBlock,
+		ProfileMutex:    *profileMutex,
+		WatchdogTimeout: *watchdogTimeout,
+		WatchdogAction:  wdAction,
+
+		FlightRecorderPeriod:  *flightRecorderPeriod,
+		FlightRecorderSamples: *flightRecorderSamples,
+
+		ProcessLogSize: *processLogSize,
+
+		ResourceReport: *resourceReport,
+
+		TimeLimit:       *timeLimit,
+		CPUTimeLimit:    *cpuTimeLimit,
+		TimeLimitAction: tlAction,
+		TimeLimitImage:  *timeLimitImage,
+		TimeLimitReport: *timeLimitReport,
+
+		VDSOUpdateInterval: *vdsoUpdateInterval,
+		TAIOffset:          int32(*taiOffset),
+
+		TCPRedirectPort:       uint16(*tcpRedirect),
+		TCPRedirectPorts:      redirectPorts,
+		TCPRedirectExemptUIDs: redirectExemptUIDs,
+
+		DNSResolver:  dnsResolverIP,
+		DNSUpstreams: dnsUpstreams,
+
+		ActivationSockets: activationSockets,
+
+		AbstractBridges: abstractBridges,
 	}
 	if len(*straceSyscalls) != 0 {
 		conf.StraceSyscalls = strings.Split(*straceSyscalls, ",")
 	}
+	if len(*deviceProxy) != 0 {
+		conf.DeviceProxy = strings.Split(*deviceProxy, ",")
+	}
+	if len(*dnsSearch) != 0 {
+		conf.DNSSearch = strings.Split(*dnsSearch, ",")
+	}
 
 	// Set up logging.
 	if *debug {
@@ -135,22 +427,17 @@ func main() {
 		// We must set O_APPEND and not O_TRUNC because Docker passes
 		// the same log file for all commands (and also parses these
 		// log files), so we can't destroy them on each command.
-		f, err := os.OpenFile(*logFilename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		f, err := openLogFile(*logFilename, 0644)
 		if err != nil {
 			cmd.Fatalf("error opening log file %q: %v", *logFilename, err)
 		}
 		logFile = f
 	}
 
-	var e log.Emitter
-	switch *logFormat {
-	case "text":
-		e = log.GoogleEmitter{&log.Writer{Next: logFile}}
-	case "json":
-		e = log.JSONEmitter{log.Writer{Next: logFile}}
-	default:
+	if *logFormat != "text" && *logFormat != "json" {
 		cmd.Fatalf("invalid log format %q, must be 'json' or 'text'", *logFormat)
 	}
+	e := newEmitter(logFile)
 
 	if *debugLogDir != "" {
 		if err := os.MkdirAll(*debugLogDir, 0775); err != nil {
@@ -161,11 +448,17 @@ func main() {
 		scmd := flag.CommandLine.Arg(0)
 		filename := fmt.Sprintf("runsc.log.%s.%s", time.Now().Format("20060102-150405.000000"), scmd)
 		path := filepath.Join(*debugLogDir, filename)
-		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0664)
+		f, err := openLogFile(path, 0664)
 		if err != nil {
 			cmd.Fatalf("error opening log file %q: %v", filename, err)
 		}
-		e = log.MultiEmitter{e, log.GoogleEmitter{&log.Writer{Next: f}}}
+		e = log.MultiEmitter{e, newEmitter(f)}
+	}
+
+	if *logRingSize > 0 {
+		r := log.NewRingEmitter(*logRingSize)
+		log.SetRecent(r)
+		e = log.MultiEmitter{e, r}
 	}
 
 	log.SetTarget(e)
@@ -178,11 +471,30 @@ func main() {
 	log.Infof("Configuration:")
 	log.Infof("\t\tRootDir: %s", conf.RootDir)
 	log.Infof("\t\tPlatform: %v", conf.Platform)
+	if conf.Platform == boot.PlatformKVM {
+		log.Infof("\t\tKVM clock: %v", conf.KVMClock)
+	}
 	log.Infof("\t\tFileAccess: %v, overlay: %t", conf.FileAccess, conf.Overlay)
 	log.Infof("\t\tNetwork: %v, logging: %t", conf.Network, conf.LogPackets)
-	log.Infof("\t\tStrace: %t, max size: %d, syscalls: %s", conf.Strace, conf.StraceLogSize, conf.StraceSyscalls)
+	if conf.TCPRedirectPort != 0 {
+		log.Infof("\t\tTCP redirect: port %d, destination ports: %v, exempt UIDs: %v", conf.TCPRedirectPort, conf.TCPRedirectPorts, conf.TCPRedirectExemptUIDs)
+	}
+	if conf.DNSResolver != nil {
+		log.Infof("\t\tDNS resolver: %v, upstreams: %v, search: %v", conf.DNSResolver, conf.DNSUpstreams, conf.DNSSearch)
+	}
+	log.Infof("\t\tStrace: %t, max size: %d, ring size: %d, syscalls: %s", conf.Strace, conf.StraceLogSize, conf.StraceRingSize, conf.StraceSyscalls)
+	log.Infof("\t\tSyscall latency: %t, slow threshold: %v", conf.SyscallLatency, conf.SlowSyscallThreshold)
+	log.Infof("\t\tWatchdog timeout: %v, action: %v", conf.WatchdogTimeout, conf.WatchdogAction)
 	log.Infof("***************************")
 
+	// Report the recent log messages if the subcommand panics.
+	defer func() {
+		if r := recover(); r != nil {
+			log.DumpRecent(os.Stderr)
+			panic(r)
+		}
+	}()
+
 	// Call the subcommand and pass in the configuration.
 	var ws syscall.WaitStatus
 	subcmdCode := subcommands.Execute(context.Background(), conf, &ws)
@@ -207,3 +519,21 @@ func init() {
 		*rootDir = filepath.Join(runtimeDir, "runsc")
 	}
 }
+
+// openLogFile opens the log file at path for appending, creating it with perm
+// if necessary. The file is rotated if --log-max-size is set.
+func openLogFile(path string, perm os.FileMode) (io.Writer, error) {
+	if *logMaxSize > 0 {
+		return log.OpenRotatingFile(path, perm, *logMaxSize, *logMaxFiles)
+	}
+	return os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, perm)
+}
+
+// newEmitter returns an Emitter that writes to w in the format given by
+// --log-format.
+func newEmitter(w io.Writer) log.Emitter {
+	if *logFormat == "json" {
+		return log.JSONEmitter{log.Writer{Next: w}}
+	}
+	return log.GoogleEmitter{&log.Writer{Next: w}}
+}
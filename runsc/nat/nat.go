@@ -0,0 +1,333 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package nat implements a userspace NAT that connects the sandbox's network
+// stack to the host network without privileges.
+//
+// The sandbox and the NAT exchange raw IP packets over a socket pair. The NAT
+// runs its own netstack in promiscuous mode, which terminates the sandbox's
+// TCP connections and UDP flows, and forwards their data through ordinary
+// host sockets. Since the NAT never creates network devices or raw sockets,
+// it does not require CAP_NET_ADMIN or CAP_NET_RAW.
+//
+// Only IPv4 TCP and UDP are forwarded. Destinations on the NAT's own subnet
+// and on the host's loopback network are not reachable.
+package nat
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/log"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/adapters/gonet"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/buffer"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/header"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/link/fdbased"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/stack"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/transport/tcp"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/transport/udp"
+	"gvisor.googlesource.com/gvisor/pkg/waiter"
+)
+
+const (
+	// MTU is the MTU of the link between the sandbox and the NAT.
+	MTU = 1500
+
+	// nicID is the ID of the NAT's only NIC.
+	nicID = 1
+
+	// maxInFlight is the maximum number of TCP connections that may be
+	// pending in the NAT at once, i.e. for which the host connection has not
+	// yet been established.
+	maxInFlight = 1024
+
+	// dialTimeout is the timeout for establishing host TCP connections.
+	dialTimeout = 30 * time.Second
+
+	// maxUDPPayload is the largest UDP payload that can be sent to the
+	// sandbox without fragmentation.
+	maxUDPPayload = MTU - header.IPv4MinimumSize - header.UDPMinimumSize
+
+	// udpTimeout is the time after which a UDP flow with no replies from the
+	// host is removed.
+	udpTimeout = 60 * time.Second
+)
+
+var (
+	// Subnet is the subnet shared by the sandbox and the NAT.
+	Subnet = net.IPNet{
+		IP:   net.IPv4(10, 0, 2, 0).To4(),
+		Mask: net.CIDRMask(24, 32),
+	}
+
+	// Gateway is the address of the NAT on Subnet. The sandbox must use it
+	// as its default gateway.
+	Gateway = net.IPv4(10, 0, 2, 2).To4()
+
+	// Address is the address of the sandbox on Subnet.
+	Address = net.IPv4(10, 0, 2, 15).To4()
+)
+
+// NAT forwards the connections made by a sandbox to the host network.
+type NAT struct {
+	stack *stack.Stack
+
+	// done is closed when the sandbox's end of the link is closed.
+	done chan struct{}
+
+	// hostLoopback indicates that the host's loopback network is reachable
+	// from the sandbox. It is only set by tests.
+	hostLoopback bool
+
+	// mu protects udpFlows.
+	mu sync.Mutex
+
+	// udpFlows maps the ID of each active UDP flow, as seen by the NAT's
+	// stack, to the flow.
+	udpFlows map[stack.TransportEndpointID]*udpFlow
+}
+
+// New creates a NAT that exchanges IP packets with the sandbox over fd, which
+// must be a SOCK_SEQPACKET socket. New does not take ownership of fd, which
+// must remain open until Wait returns.
+func New(fd int) (*NAT, error) {
+	n := &NAT{
+		stack:    stack.New(&tcpip.StdClock{}, []string{ipv4.ProtocolName}, []string{tcp.ProtocolName, udp.ProtocolName}),
+		done:     make(chan struct{}),
+		udpFlows: make(map[stack.TransportEndpointID]*udpFlow),
+	}
+
+	var once sync.Once
+	linkEP := fdbased.New(&fdbased.Options{
+		FD:  fd,
+		MTU: MTU,
+		ClosedFunc: func(*tcpip.Error) {
+			once.Do(func() { close(n.done) })
+		},
+	})
+	if err := n.stack.CreateNIC(nicID, linkEP); err != nil {
+		return nil, fmt.Errorf("CreateNIC failed: %v", err)
+	}
+	if err := n.stack.AddAddress(nicID, ipv4.ProtocolNumber, tcpip.Address(Gateway)); err != nil {
+		return nil, fmt.Errorf("AddAddress failed: %v", err)
+	}
+
+	// Promiscuous mode makes the NIC accept packets for any destination,
+	// and spoofing allows it to reply from that destination.
+	if err := n.stack.SetPromiscuousMode(nicID, true); err != nil {
+		return nil, fmt.Errorf("SetPromiscuousMode failed: %v", err)
+	}
+	if err := n.stack.SetSpoofing(nicID, true); err != nil {
+		return nil, fmt.Errorf("SetSpoofing failed: %v", err)
+	}
+	n.stack.SetRouteTable([]tcpip.Route{{
+		Destination: tcpip.Address(Subnet.IP),
+		Mask:        tcpip.Address(Subnet.Mask),
+		NIC:         nicID,
+	}})
+
+	fwd := tcp.NewForwarder(n.stack, 0, maxInFlight, n.forwardTCP)
+	n.stack.SetTransportProtocolHandler(tcp.ProtocolNumber, fwd.HandlePacket)
+	n.stack.SetTransportProtocolHandler(udp.ProtocolNumber, n.forwardUDP)
+	return n, nil
+}
+
+// Wait blocks until the sandbox closes its end of the link.
+func (n *NAT) Wait() {
+	<-n.done
+}
+
+// reachable returns true if the sandbox may connect to addr through the NAT.
+func (n *NAT) reachable(addr tcpip.Address) bool {
+	ip := net.IP(addr)
+	if ip.To4() == nil {
+		return false
+	}
+	if ip.IsLoopback() {
+		return n.hostLoopback
+	}
+	return !Subnet.Contains(ip) && !ip.IsUnspecified() && !ip.IsMulticast() && !ip.Equal(net.IPv4bcast)
+}
+
+// hostAddr returns the host address to which traffic for the NAT's local
+// address and port in id is forwarded.
+func hostAddr(id stack.TransportEndpointID) string {
+	return net.JoinHostPort(net.IP(id.LocalAddress).String(), strconv.Itoa(int(id.LocalPort)))
+}
+
+// forwardTCP handles a connection request from the sandbox, by connecting to
+// the requested destination on the host and completing the handshake with the
+// sandbox only if that succeeds.
+func (n *NAT) forwardTCP(r *tcp.ForwarderRequest) {
+	id := r.ID()
+	if !n.reachable(id.LocalAddress) {
+		r.Complete(true)
+		return
+	}
+
+	hc, err := net.DialTimeout("tcp", hostAddr(id), dialTimeout)
+	if err != nil {
+		log.Debugf("NAT: error connecting to %s: %v", hostAddr(id), err)
+		r.Complete(true)
+		return
+	}
+
+	var wq waiter.Queue
+	ep, terr := r.CreateEndpoint(&wq)
+	r.Complete(false)
+	if terr != nil {
+		log.Debugf("NAT: error accepting connection to %s: %v", hostAddr(id), terr)
+		hc.Close()
+		return
+	}
+	proxyTCP(hc.(*net.TCPConn), ep, gonet.NewConn(&wq, ep))
+}
+
+// proxyTCP copies data in both directions between the host connection hc and
+// the sandbox connection sc, whose endpoint is ep, until both directions are
+// shut down. Shutdowns are propagated from one connection to the other.
+func proxyTCP(hc *net.TCPConn, ep tcpip.Endpoint, sc net.Conn) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		if _, err := io.Copy(hc, sc); err != nil {
+			// Unblock the other direction.
+			sc.Close()
+			hc.Close()
+			return
+		}
+		hc.CloseWrite()
+	}()
+	go func() {
+		defer wg.Done()
+		if _, err := io.Copy(sc, hc); err != nil {
+			sc.Close()
+			hc.Close()
+			return
+		}
+		ep.Shutdown(tcpip.ShutdownWrite)
+	}()
+	wg.Wait()
+	sc.Close()
+	hc.Close()
+}
+
+// udpFlow forwards the datagrams between a sandbox address and port and a
+// destination address and port.
+type udpFlow struct {
+	// id is the ID of the flow in the NAT's stack.
+	id stack.TransportEndpointID
+
+	// route is used to send replies to the sandbox.
+	route stack.Route
+
+	// conn is the host socket connected to the destination.
+	conn *net.UDPConn
+}
+
+// forwardUDP handles a UDP datagram from the sandbox, by sending its payload
+// to the destination from the host socket of its flow. It implements the
+// handler passed to stack.SetTransportProtocolHandler.
+func (n *NAT) forwardUDP(r *stack.Route, id stack.TransportEndpointID, vv *buffer.VectorisedView) bool {
+	if !n.reachable(id.LocalAddress) {
+		return false
+	}
+	hdr := header.UDP(vv.First())
+	if int(hdr.Length()) > vv.Size() || hdr.Length() < header.UDPMinimumSize {
+		// Malformed packet.
+		return true
+	}
+	vv.CapLength(int(hdr.Length()))
+	vv.TrimFront(header.UDPMinimumSize)
+	payload := vv.ToView()
+
+	n.mu.Lock()
+	f, ok := n.udpFlows[id]
+	if !ok {
+		hc, err := net.Dial("udp", hostAddr(id))
+		if err != nil {
+			n.mu.Unlock()
+			log.Debugf("NAT: error creating UDP socket for %s: %v", hostAddr(id), err)
+			return true
+		}
+		f = &udpFlow{
+			id:    id,
+			route: r.Clone(),
+			conn:  hc.(*net.UDPConn),
+		}
+		n.udpFlows[id] = f
+		go n.replyUDP(f)
+	}
+	n.mu.Unlock()
+
+	if _, err := f.conn.Write(payload); err != nil {
+		log.Debugf("NAT: error sending UDP datagram to %s: %v", hostAddr(id), err)
+	}
+	return true
+}
+
+// replyUDP sends the datagrams received from the destination of f to the
+// sandbox, until f expires.
+func (n *NAT) replyUDP(f *udpFlow) {
+	defer func() {
+		n.mu.Lock()
+		delete(n.udpFlows, f.id)
+		n.mu.Unlock()
+		f.conn.Close()
+		f.route.Release()
+	}()
+
+	buf := make([]byte, header.MaxIPPacketSize)
+	for {
+		f.conn.SetReadDeadline(time.Now().Add(udpTimeout))
+		nr, err := f.conn.Read(buf)
+		if err != nil {
+			if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+				log.Debugf("NAT: error receiving UDP datagram from %s: %v", hostAddr(f.id), err)
+			}
+			return
+		}
+		if nr > maxUDPPayload {
+			// IP fragmentation is not supported.
+			log.Debugf("NAT: dropping %d-byte UDP datagram from %s", nr, hostAddr(f.id))
+			continue
+		}
+		if err := sendUDP(&f.route, buffer.NewViewFromBytes(buf[:nr]), f.id.LocalPort, f.id.RemotePort); err != nil {
+			log.Debugf("NAT: error sending UDP datagram to sandbox: %v", err)
+		}
+	}
+}
+
+// sendUDP sends a UDP datagram with the given payload on r. It is equivalent
+// to the udp package's sendUDP.
+func sendUDP(r *stack.Route, data buffer.View, localPort, remotePort uint16) *tcpip.Error {
+	hdr := buffer.NewPrependable(header.UDPMinimumSize + int(r.MaxHeaderLength()))
+	u := header.UDP(hdr.Prepend(header.UDPMinimumSize))
+	length := uint16(hdr.UsedLength()) + uint16(len(data))
+	u.Encode(&header.UDPFields{
+		SrcPort: localPort,
+		DstPort: remotePort,
+		Length:  length,
+	})
+	xsum := header.Checksum(data, r.PseudoHeaderChecksum(udp.ProtocolNumber))
+	u.SetChecksum(^u.CalculateChecksum(xsum, length))
+	return r.WritePacket(&hdr, data, udp.ProtocolNumber)
+}
@@ -0,0 +1,225 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nat
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/tcpip"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/adapters/gonet"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/link/fdbased"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/stack"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/transport/tcp"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/transport/udp"
+)
+
+// setup returns a NAT that allows connections to the host's loopback
+// network, and a sandbox stack connected to it.
+func setup(t *testing.T) (*NAT, *stack.Stack, func()) {
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_SEQPACKET, 0)
+	if err != nil {
+		t.Fatalf("Socketpair() failed: %v", err)
+	}
+
+	n, err := New(fds[1])
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	n.hostLoopback = true
+
+	s := stack.New(&tcpip.StdClock{}, []string{ipv4.ProtocolName}, []string{tcp.ProtocolName, udp.ProtocolName})
+	linkEP := fdbased.New(&fdbased.Options{FD: fds[0], MTU: MTU})
+	if err := s.CreateNIC(1, linkEP); err != nil {
+		t.Fatalf("CreateNIC() failed: %v", err)
+	}
+	if err := s.AddAddress(1, ipv4.ProtocolNumber, tcpip.Address(Address)); err != nil {
+		t.Fatalf("AddAddress() failed: %v", err)
+	}
+	s.SetRouteTable([]tcpip.Route{{
+		Destination: tcpip.Address("\x00\x00\x00\x00"),
+		Mask:        tcpip.Address("\x00\x00\x00\x00"),
+		Gateway:     tcpip.Address(Gateway),
+		NIC:         1,
+	}})
+
+	return n, s, func() {
+		// Shutting down the sandbox end of the link stops the NAT. The FDs
+		// are not closed, since the endpoints of both stacks may still
+		// write to them, and their numbers must not be reused by later
+		// tests.
+		syscall.Shutdown(fds[0], syscall.SHUT_RDWR)
+		n.Wait()
+	}
+}
+
+// fullAddress converts a host address to a tcpip.FullAddress.
+func fullAddress(ip net.IP, port int) tcpip.FullAddress {
+	return tcpip.FullAddress{Addr: tcpip.Address(ip.To4()), Port: uint16(port)}
+}
+
+func TestTCP(t *testing.T) {
+	_, s, cleanup := setup(t)
+	defer cleanup()
+
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() failed: %v", err)
+	}
+	defer l.Close()
+
+	// The host server echoes everything until the sandbox closes the
+	// connection.
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		io.Copy(c, c)
+	}()
+
+	addr := l.Addr().(*net.TCPAddr)
+	c, err := gonet.DialTCP(s, fullAddress(addr.IP, addr.Port), ipv4.ProtocolNumber)
+	if err != nil {
+		t.Fatalf("DialTCP(%v) failed: %v", addr, err)
+	}
+	defer c.Close()
+
+	want := bytes.Repeat([]byte("hello, host "), 10000)
+	go c.Write(want)
+
+	got := make([]byte, len(want))
+	c.SetReadDeadline(time.Now().Add(10 * time.Second))
+	if _, err := io.ReadFull(c, got); err != nil {
+		t.Fatalf("ReadFull() failed: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("echoed data differs from sent data")
+	}
+}
+
+func TestTCPUnreachable(t *testing.T) {
+	n, s, cleanup := setup(t)
+	defer cleanup()
+	n.hostLoopback = false
+
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() failed: %v", err)
+	}
+	defer l.Close()
+
+	for _, ip := range []net.IP{net.IPv4(127, 0, 0, 1), Gateway} {
+		addr := fullAddress(ip, l.Addr().(*net.TCPAddr).Port)
+		if c, err := gonet.DialTCP(s, addr, ipv4.ProtocolNumber); err == nil {
+			c.Close()
+			t.Errorf("DialTCP(%v) succeeded, want error", ip)
+		}
+	}
+}
+
+func TestTCPHostClose(t *testing.T) {
+	_, s, cleanup := setup(t)
+	defer cleanup()
+
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() failed: %v", err)
+	}
+	defer l.Close()
+
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		c.Write([]byte("bye"))
+		c.Close()
+	}()
+
+	addr := l.Addr().(*net.TCPAddr)
+	c, err := gonet.DialTCP(s, fullAddress(addr.IP, addr.Port), ipv4.ProtocolNumber)
+	if err != nil {
+		t.Fatalf("DialTCP(%v) failed: %v", addr, err)
+	}
+	defer c.Close()
+
+	c.SetReadDeadline(time.Now().Add(10 * time.Second))
+	got, err := ioutil.ReadAll(c)
+	if err != nil {
+		t.Fatalf("ReadAll() failed: %v", err)
+	}
+	if string(got) != "bye" {
+		t.Errorf("ReadAll() = %q, want %q", got, "bye")
+	}
+}
+
+func TestUDP(t *testing.T) {
+	_, s, cleanup := setup(t)
+	defer cleanup()
+
+	hc, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket() failed: %v", err)
+	}
+	defer hc.Close()
+
+	// The host server replies to each datagram twice.
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, from, err := hc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			hc.WriteTo(buf[:n], from)
+			hc.WriteTo(buf[:n], from)
+		}
+	}()
+
+	sc, err := gonet.NewPacketConn(s, tcpip.FullAddress{Port: 5000}, ipv4.ProtocolNumber)
+	if err != nil {
+		t.Fatalf("NewPacketConn() failed: %v", err)
+	}
+	defer sc.Close()
+
+	addr := hc.LocalAddr().(*net.UDPAddr)
+	for _, msg := range []string{"ping", "pong"} {
+		if _, err := sc.WriteTo([]byte(msg), addr); err != nil {
+			t.Fatalf("WriteTo(%q, %v) failed: %v", msg, addr, err)
+		}
+		for i := 0; i < 2; i++ {
+			buf := make([]byte, 1024)
+			sc.SetReadDeadline(time.Now().Add(10 * time.Second))
+			n, from, err := sc.ReadFrom(buf)
+			if err != nil {
+				t.Fatalf("ReadFrom() failed: %v", err)
+			}
+			if got := string(buf[:n]); got != msg {
+				t.Errorf("ReadFrom() = %q, want %q", got, msg)
+			}
+			if got := from.String(); got != addr.String() {
+				t.Errorf("ReadFrom() got address %s, want %s", got, addr)
+			}
+		}
+	}
+}
@@ -15,9 +15,12 @@
 package sandbox
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"runtime"
 	"strconv"
@@ -27,8 +30,13 @@ import (
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/vishvananda/netlink"
 	"gvisor.googlesource.com/gvisor/pkg/log"
+	"gvisor.googlesource.com/gvisor/pkg/metadata"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/socket/hostinet"
+	"gvisor.googlesource.com/gvisor/pkg/tcpip/link/egress"
 	"gvisor.googlesource.com/gvisor/pkg/urpc"
 	"gvisor.googlesource.com/gvisor/runsc/boot"
+	"gvisor.googlesource.com/gvisor/runsc/nat"
+	"gvisor.googlesource.com/gvisor/runsc/specutils"
 )
 
 const (
@@ -51,9 +59,13 @@ const (
 // If 'conf.Network' is NoNetwork, skips local configuration and creates a
 // loopback interface only.
 //
+// If 'conf.Network' is NetworkNAT, starts a userspace NAT process outside of
+// the sandbox, and connects it to a network interface in the sandbox. See
+// package nat.
+//
 // Run the following container to test it:
 //  docker run -di --runtime=runsc -p 8080:80 -v $PWD:/usr/local/apache2/htdocs/ httpd:2.4
-func setupNetwork(conn *urpc.Client, pid int, spec *specs.Spec, conf *boot.Config) error {
+func setupNetwork(conn *urpc.Client, s *Sandbox, spec *specs.Spec, conf *boot.Config) error {
 	log.Infof("Setting up network")
 
 	// HACK!
@@ -83,6 +95,22 @@ func setupNetwork(conn *urpc.Client, pid int, spec *specs.Spec, conf *boot.Confi
 		conf.Network = boot.NetworkNone
 	}
 
+	var policy *egress.Policy
+	if conf.EgressPolicy != "" && conf.Network != boot.NetworkNone {
+		var err error
+		if policy, err = loadEgressPolicy(conf.EgressPolicy); err != nil {
+			return err
+		}
+	}
+
+	var md *metadata.Config
+	if conf.Metadata != "" && conf.Network != boot.NetworkHost {
+		var err error
+		if md, err = loadMetadata(conf.Metadata); err != nil {
+			return err
+		}
+	}
+
 	switch conf.Network {
 	case boot.NetworkNone:
 		log.Infof("Network is disabled, create loopback interface only")
@@ -92,20 +120,51 @@ func setupNetwork(conn *urpc.Client, pid int, spec *specs.Spec, conf *boot.Confi
 	case boot.NetworkSandbox:
 		// Build the path to the net namespace of the sandbox process.
 		// This is what we will copy.
-		nsPath := filepath.Join("/proc", strconv.Itoa(pid), "ns/net")
-		if err := createInterfacesAndRoutesFromNS(conn, nsPath); err != nil {
+		nsPath := filepath.Join("/proc", strconv.Itoa(s.Pid), "ns/net")
+		if err := createInterfacesAndRoutesFromNS(conn, nsPath, policy); err != nil {
 			return fmt.Errorf("error creating interfaces from net namespace %q: %v", nsPath, err)
 		}
+	case boot.NetworkNAT:
+		if err := createNATInterface(conn, s, conf, policy); err != nil {
+			return fmt.Errorf("error creating NAT interface: %v", err)
+		}
 	case boot.NetworkHost:
-		// Nothing to do here.
+		if conf.SocketPolicy != "" {
+			policy, err := loadSocketPolicy(conf.SocketPolicy)
+			if err != nil {
+				return err
+			}
+			if err := conn.Call(boot.HostNetworkSetPolicy, policy, nil); err != nil {
+				return fmt.Errorf("error setting socket policy: %v", err)
+			}
+		}
 	default:
 		return fmt.Errorf("Invalid network type: %d", conf.Network)
 	}
+
+	if md != nil {
+		// The metadata service listens on the loopback interface, which
+		// now exists.
+		if err := conn.Call(boot.NetworkStartMetadataServer, md, nil); err != nil {
+			return fmt.Errorf("error starting metadata service: %v", err)
+		}
+	}
 	return nil
 }
 
 func createDefaultLoopbackInterface(conn *urpc.Client) error {
-	link := boot.LoopbackLink{
+	if err := conn.Call(boot.NetworkCreateLinksAndRoutes, &boot.CreateLinksAndRoutesArgs{
+		LoopbackLinks: []boot.LoopbackLink{defaultLoopbackLink()},
+	}, nil); err != nil {
+		return fmt.Errorf("error creating loopback link and routes: %v", err)
+	}
+	return nil
+}
+
+// defaultLoopbackLink returns the loopback link that is created in sandboxes
+// that don't copy the network configuration of a network namespace.
+func defaultLoopbackLink() boot.LoopbackLink {
+	return boot.LoopbackLink{
 		Name: "lo",
 		Addresses: []net.IP{
 			net.IP("\x7f\x00\x00\x01"),
@@ -122,14 +181,126 @@ func createDefaultLoopbackInterface(conn *urpc.Client) error {
 			},
 		},
 	}
-	if err := conn.Call(boot.NetworkCreateLinksAndRoutes, &boot.CreateLinksAndRoutesArgs{
-		LoopbackLinks: []boot.LoopbackLink{link},
-	}, nil); err != nil {
-		return fmt.Errorf("error creating loopback link and routes: %v", err)
+}
+
+// createNATInterface starts a userspace NAT process, and creates an interface
+// in the sandbox that is connected to it, along with the default loopback
+// interface.
+func createNATInterface(conn *urpc.Client, s *Sandbox, conf *boot.Config, policy *egress.Policy) error {
+	binPath, err := specutils.BinPath()
+	if err != nil {
+		return err
+	}
+
+	// Create the socket that carries IP packets between the sandbox and the
+	// NAT. SOCK_SEQPACKET preserves packet boundaries, and reports to the NAT
+	// when the sandbox exits.
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_SEQPACKET|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("error creating NAT socket pair: %v", err)
+	}
+	sandEnd := os.NewFile(uintptr(fds[0]), "sandbox nat fd")
+	defer sandEnd.Close()
+	natEnd := os.NewFile(uintptr(fds[1]), "nat fd")
+	defer natEnd.Close()
+
+	// The NAT runs in the current namespaces, since it uses the host network
+	// on behalf of the sandbox.
+	args := conf.ToFlags()
+	args = append(args, "nat", "--fd=3")
+	cmd := exec.Command(binPath, args...)
+	cmd.ExtraFiles = []*os.File{natEnd}
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		// Detach from this session, since the NAT outlives this process.
+		Setsid: true,
+	}
+	log.Debugf("Starting NAT: %s %v", binPath, args)
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("error starting NAT: %v", err)
+	}
+	s.NATPid = cmd.Process.Pid
+	log.Infof("NAT started, pid: %d", s.NATPid)
+
+	subnet := boot.Route{
+		Destination: nat.Subnet.IP,
+		Mask:        nat.Subnet.Mask,
+	}
+	linkArgs := boot.CreateLinksAndRoutesArgs{
+		LoopbackLinks: []boot.LoopbackLink{defaultLoopbackLink()},
+		FDBasedLinks: []boot.FDBasedLink{{
+			Name:      "eth0",
+			MTU:       nat.MTU,
+			Addresses: []net.IP{nat.Address},
+			Routes:    []boot.Route{subnet},
+			RawIP:     true,
+		}},
+		DefaultGateway: boot.DefaultRoute{
+			Route: boot.Route{
+				Destination: net.IPv4zero,
+				Mask:        net.IPMask(net.IPv4zero),
+				Gateway:     nat.Gateway,
+			},
+			Name: "eth0",
+		},
+		EgressPolicy: policy,
+	}
+	linkArgs.FilePayload.Files = []*os.File{sandEnd}
+
+	log.Debugf("Setting up NAT network, config: %+v", linkArgs)
+	if err := conn.Call(boot.NetworkCreateLinksAndRoutes, &linkArgs, nil); err != nil {
+		return fmt.Errorf("error creating links and routes: %v", err)
 	}
 	return nil
 }
 
+// loadEgressPolicy reads an egress.Policy from the JSON file at filename.
+func loadEgressPolicy(filename string) (*egress.Policy, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error reading egress policy %q: %v", filename, err)
+	}
+	var p egress.Policy
+	if err := json.Unmarshal(b, &p); err != nil {
+		return nil, fmt.Errorf("error parsing egress policy %q: %v", filename, err)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, fmt.Errorf("egress policy %q: %v", filename, err)
+	}
+	return &p, nil
+}
+
+// loadSocketPolicy reads a hostinet.Policy from the JSON file at filename.
+func loadSocketPolicy(filename string) (*hostinet.Policy, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error reading socket policy %q: %v", filename, err)
+	}
+	var p hostinet.Policy
+	if err := json.Unmarshal(b, &p); err != nil {
+		return nil, fmt.Errorf("error parsing socket policy %q: %v", filename, err)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, fmt.Errorf("socket policy %q: %v", filename, err)
+	}
+	return &p, nil
+}
+
+// loadMetadata reads a metadata.Config from the JSON file at filename.
+func loadMetadata(filename string) (*metadata.Config, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error reading metadata %q: %v", filename, err)
+	}
+	var c metadata.Config
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("error parsing metadata %q: %v", filename, err)
+	}
+	if err := c.Validate(); err != nil {
+		return nil, fmt.Errorf("metadata %q: %v", filename, err)
+	}
+	return &c, nil
+}
+
 func joinNetNS(nsPath string) (func(), error) {
 	runtime.LockOSThread()
 	restoreNS, err := applyNS(specs.LinuxNamespace{
@@ -161,8 +332,9 @@ func isRootNS(ifaces []net.Interface) bool {
 
 // createInterfacesAndRoutesFromNS scrapes the interface and routes from the
 // net namespace with the given path, creates them in the sandbox, and removes
-// them from the host.
-func createInterfacesAndRoutesFromNS(conn *urpc.Client, nsPath string) error {
+// them from the host. The egress policy, if not nil, applies to all interfaces
+// except loopback.
+func createInterfacesAndRoutesFromNS(conn *urpc.Client, nsPath string, policy *egress.Policy) error {
 	// Join the network namespace that we will be copying.
 	restore, err := joinNetNS(nsPath)
 	if err != nil {
@@ -181,7 +353,9 @@ func createInterfacesAndRoutesFromNS(conn *urpc.Client, nsPath string) error {
 	}
 
 	// Collect addresses and routes from the interfaces.
-	var args boot.CreateLinksAndRoutesArgs
+	args := boot.CreateLinksAndRoutesArgs{
+		EgressPolicy: policy,
+	}
 	for _, iface := range ifaces {
 		if iface.Flags&net.FlagUp == 0 {
 			log.Infof("Skipping down interface: %+v", iface)
@@ -19,6 +19,8 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"syscall"
 	"time"
@@ -28,9 +30,13 @@ import (
 	"gvisor.googlesource.com/gvisor/pkg/control/client"
 	"gvisor.googlesource.com/gvisor/pkg/control/server"
 	"gvisor.googlesource.com/gvisor/pkg/log"
+	"gvisor.googlesource.com/gvisor/pkg/metric"
 	"gvisor.googlesource.com/gvisor/pkg/sentry/control"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/fs/devproxy"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel"
 	"gvisor.googlesource.com/gvisor/pkg/urpc"
 	"gvisor.googlesource.com/gvisor/runsc/boot"
+	"gvisor.googlesource.com/gvisor/runsc/cgroup"
 	"gvisor.googlesource.com/gvisor/runsc/specutils"
 )
 
@@ -51,6 +57,15 @@ type Sandbox struct {
 	// GoferPid is the pid of the gofer running along side the sandbox. May
 	// be 0 if the gofer has been killed or it's not being used.
 	GoferPid int `json:"goferPid"`
+
+	// NATPid is the pid of the userspace NAT that connects the sandbox to
+	// the host network. May be 0 if the NAT has been killed or it's not
+	// being used.
+	NATPid int `json:"natPid"`
+
+	// Cgroup is the host cgroup of the sandbox and gofer processes. It is
+	// nil if the spec doesn't set a cgroups path.
+	Cgroup *cgroup.Cgroup `json:"cgroup"`
 }
 
 // Create creates the sandbox process.
@@ -62,17 +77,45 @@ func Create(id string, spec *specs.Spec, conf *boot.Config, bundleDir, consoleSo
 		return nil, err
 	}
 
+	// Create the cgroup that bounds the resources of the sandbox, if the
+	// spec requests one.
+	cg, err := cgroup.New(spec)
+	if err != nil {
+		return nil, err
+	}
+	if cg != nil {
+		if err := cg.Install(spec.Linux.Resources); err != nil {
+			return nil, err
+		}
+		s.Cgroup = cg
+	}
+
 	// Create the gofer process.
-	ioFiles, err := s.createGoferProcess(spec, conf, bundleDir, binPath)
+	ioFiles, bridgeFiles, err := s.createGoferProcess(spec, conf, bundleDir, binPath)
 	if err != nil {
+		s.Destroy()
 		return nil, err
 	}
 
 	// Create the sandbox process.
-	if err := s.createSandboxProcess(spec, conf, bundleDir, consoleSocket, binPath, ioFiles); err != nil {
+	if err := s.createSandboxProcess(spec, conf, bundleDir, consoleSocket, binPath, ioFiles, bridgeFiles); err != nil {
+		s.Destroy()
 		return nil, err
 	}
 
+	// Move the sandbox and its helper processes into the cgroup.
+	if s.Cgroup != nil {
+		for _, pid := range []int{s.GoferPid, s.NATPid, s.Pid} {
+			if pid == 0 {
+				continue
+			}
+			if err := s.Cgroup.Add(pid); err != nil {
+				s.Destroy()
+				return nil, err
+			}
+		}
+	}
+
 	// Wait for the control server to come up (or timeout).
 	if err := s.waitForCreated(10 * time.Second); err != nil {
 		return nil, err
@@ -91,7 +134,7 @@ func (s *Sandbox) Start(cid string, spec *specs.Spec, conf *boot.Config) error {
 	defer conn.Close()
 
 	// Configure the network.
-	if err := setupNetwork(conn, s.Pid, spec, conf); err != nil {
+	if err := setupNetwork(conn, s, spec, conf); err != nil {
 		return fmt.Errorf("error setting up network: %v", err)
 	}
 
@@ -125,6 +168,22 @@ func (s *Sandbox) Processes(cid string) ([]*control.Process, error) {
 	return pl, nil
 }
 
+// ProcessEvents retrieves the process events recorded in the sandbox.
+func (s *Sandbox) ProcessEvents(cid string) ([]kernel.ProcessEvent, error) {
+	log.Debugf("Getting process events for container %q in sandbox %q", cid, s.ID)
+	conn, err := s.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var events []kernel.ProcessEvent
+	if err := conn.Call(boot.ContainerProcessEvents, nil, &events); err != nil {
+		return nil, fmt.Errorf("error retrieving process events from sandbox: %v", err)
+	}
+	return events, nil
+}
+
 // Execute runs the specified command in the container.
 func (s *Sandbox) Execute(cid string, e *control.ExecArgs) (syscall.WaitStatus, error) {
 	log.Debugf("Executing new process in container %q in sandbox %q", cid, s.ID)
@@ -173,10 +232,13 @@ func (s *Sandbox) connect() (*urpc.Client, error) {
 	return conn, nil
 }
 
-func (s *Sandbox) createGoferProcess(spec *specs.Spec, conf *boot.Config, bundleDir, binPath string) ([]*os.File, error) {
-	if conf.FileAccess != boot.FileAccessProxy {
+func (s *Sandbox) createGoferProcess(spec *specs.Spec, conf *boot.Config, bundleDir, binPath string) ([]*os.File, []*os.File, error) {
+	if conf.FileAccess != boot.FileAccessProxy && len(conf.AbstractBridges) > 0 {
+		return nil, nil, fmt.Errorf("abstract socket bridges require --file-access=proxy")
+	}
+	if conf.FileAccess == boot.FileAccessDirect {
 		// Don't start a gofer. The sandbox will access host FS directly.
-		return nil, nil
+		return nil, nil, nil
 	}
 
 	// Start with the general config flags.
@@ -191,13 +253,16 @@ func (s *Sandbox) createGoferProcess(spec *specs.Spec, conf *boot.Config, bundle
 		}
 	}
 
-	sandEnds := make([]*os.File, 0, mountCount)
-	goferEnds := make([]*os.File, 0, mountCount)
-	for i := 0; i < mountCount; i++ {
+	// Each mount is served, or its FD donated, over conf.MountFDs() sockets.
+	channels := conf.MountFDs()
+
+	sandEnds := make([]*os.File, 0, mountCount*channels)
+	goferEnds := make([]*os.File, 0, mountCount*channels)
+	for i := 0; i < mountCount*channels; i++ {
 		// Create socket that connects the sandbox and gofer.
 		fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM|syscall.SOCK_CLOEXEC, 0)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		sandEnds = append(sandEnds, os.NewFile(uintptr(fds[0]), "sandbox io fd"))
 
@@ -208,6 +273,22 @@ func (s *Sandbox) createGoferProcess(spec *specs.Spec, conf *boot.Config, bundle
 		args = append(args, fmt.Sprintf("--io-fds=%d", 3+i))
 	}
 
+	// Create a socket that connects the sandbox and gofer for each
+	// abstract socket bridge, in the order of conf.AbstractBridges.
+	bridgeEnds := make([]*os.File, 0, len(conf.AbstractBridges))
+	for range conf.AbstractBridges {
+		fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_SEQPACKET|syscall.SOCK_CLOEXEC, 0)
+		if err != nil {
+			return nil, nil, err
+		}
+		bridgeEnds = append(bridgeEnds, os.NewFile(uintptr(fds[0]), "sandbox bridge fd"))
+
+		goferEnd := os.NewFile(uintptr(fds[1]), "gofer bridge fd")
+		defer goferEnd.Close()
+		args = append(args, fmt.Sprintf("--bridge-fds=%d", 3+len(goferEnds)))
+		goferEnds = append(goferEnds, goferEnd)
+	}
+
 	cmd := exec.Command(binPath, args...)
 	cmd.ExtraFiles = goferEnds
 
@@ -220,16 +301,16 @@ func (s *Sandbox) createGoferProcess(spec *specs.Spec, conf *boot.Config, bundle
 	// Start the gofer in the given namespace.
 	log.Debugf("Starting gofer: %s %v", binPath, args)
 	if err := startInNS(cmd, nss); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	s.GoferPid = cmd.Process.Pid
 	log.Infof("Gofer started, pid: %d", cmd.Process.Pid)
-	return sandEnds, nil
+	return sandEnds, bridgeEnds, nil
 }
 
 // createSandboxProcess starts the sandbox as a subprocess by running the "boot"
 // command, passing in the bundle dir.
-func (s *Sandbox) createSandboxProcess(spec *specs.Spec, conf *boot.Config, bundleDir, consoleSocket, binPath string, ioFiles []*os.File) error {
+func (s *Sandbox) createSandboxProcess(spec *specs.Spec, conf *boot.Config, bundleDir, consoleSocket, binPath string, ioFiles, bridgeFiles []*os.File) error {
 	// nextFD is used to get unused FDs that we can pass to the sandbox.  It
 	// starts at 3 because 0, 1, and 2 are taken by stdin/out/err.
 	nextFD := 3
@@ -265,6 +346,87 @@ func (s *Sandbox) createSandboxProcess(spec *specs.Spec, conf *boot.Config, bund
 		nextFD++
 	}
 
+	// The sandbox can't open host devices, so open the proxied devices
+	// here and donate them, in the order of conf.DeviceProxy.
+	deviceFiles, err := openProxiedDevices(conf.DeviceProxy)
+	if err != nil {
+		return err
+	}
+	for _, f := range deviceFiles {
+		defer f.Close()
+		cmd.ExtraFiles = append(cmd.ExtraFiles, f)
+		cmd.Args = append(cmd.Args, "--device-fds="+strconv.Itoa(nextFD))
+		nextFD++
+	}
+
+	// Send the sandbox ends of the abstract socket bridges, if any.
+	for _, f := range bridgeFiles {
+		defer f.Close()
+		cmd.ExtraFiles = append(cmd.ExtraFiles, f)
+		cmd.Args = append(cmd.Args, "--bridge-fds="+strconv.Itoa(nextFD))
+		nextFD++
+	}
+
+	// The sandbox can't open host files, so create the resource report file
+	// here and donate it.
+	if conf.ResourceReport != "" {
+		f, err := os.OpenFile(conf.ResourceReport, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+		if err != nil {
+			return fmt.Errorf("error opening resource report %q: %v", conf.ResourceReport, err)
+		}
+		defer f.Close()
+		cmd.ExtraFiles = append(cmd.ExtraFiles, f)
+		cmd.Args = append(cmd.Args, "--resource-report-fd="+strconv.Itoa(nextFD))
+		nextFD++
+	}
+
+	// Likewise for the time limit files. The image is created now, and
+	// left empty if the sandbox doesn't exceed its time limit.
+	if conf.TimeLimit != 0 || conf.CPUTimeLimit != 0 {
+		if conf.TimeLimitAction == boot.TimeLimitCheckpoint {
+			f, err := os.OpenFile(conf.TimeLimitImage, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+			if err != nil {
+				return fmt.Errorf("error opening time limit image %q: %v", conf.TimeLimitImage, err)
+			}
+			defer f.Close()
+			cmd.ExtraFiles = append(cmd.ExtraFiles, f)
+			cmd.Args = append(cmd.Args, "--time-limit-image-fd="+strconv.Itoa(nextFD))
+			nextFD++
+		}
+		if conf.TimeLimitReport != "" {
+			f, err := os.OpenFile(conf.TimeLimitReport, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+			if err != nil {
+				return fmt.Errorf("error opening time limit report %q: %v", conf.TimeLimitReport, err)
+			}
+			defer f.Close()
+			cmd.ExtraFiles = append(cmd.ExtraFiles, f)
+			cmd.Args = append(cmd.Args, "--time-limit-report-fd="+strconv.Itoa(nextFD))
+			nextFD++
+		}
+	}
+
+	// The sandbox is restored from the checkpoint image instead of
+	// starting the container's process.
+	if conf.RestoreFile != "" {
+		f, err := os.Open(conf.RestoreFile)
+		if err != nil {
+			return fmt.Errorf("error opening restore image %q: %v", conf.RestoreFile, err)
+		}
+		defer f.Close()
+		cmd.ExtraFiles = append(cmd.ExtraFiles, f)
+		cmd.Args = append(cmd.Args, "--restore-fd="+strconv.Itoa(nextFD))
+		nextFD++
+
+		saved := make([]string, 0, len(conf.RestoreRebind))
+		for s := range conf.RestoreRebind {
+			saved = append(saved, s)
+		}
+		sort.Strings(saved)
+		for _, s := range saved {
+			cmd.Args = append(cmd.Args, "--restore-rebind="+s+":"+conf.RestoreRebind[s])
+		}
+	}
+
 	// If the console control socket file is provided, then create a new
 	// pty master/slave pair and set the tty on the sandox process.
 	if consoleEnabled {
@@ -310,7 +472,7 @@ func (s *Sandbox) createSandboxProcess(spec *specs.Spec, conf *boot.Config, bund
 		nss = append(nss, specs.LinuxNamespace{Type: specs.PIDNamespace})
 	}
 
-	if conf.FileAccess == boot.FileAccessProxy {
+	if conf.FileAccess != boot.FileAccessDirect {
 		log.Infof("Sandbox will be started in new mount namespace")
 		nss = append(nss, specs.LinuxNamespace{Type: specs.MountNamespace})
 	} else {
@@ -320,7 +482,9 @@ func (s *Sandbox) createSandboxProcess(spec *specs.Spec, conf *boot.Config, bund
 	// Joins the network namespace if network is enabled. the sandbox talks
 	// directly to the host network, which may have been configured in the
 	// namespace.
-	if ns, ok := getNS(specs.NetworkNamespace, spec); ok && conf.Network != boot.NetworkNone {
+	// The NAT network doesn't use the host network configuration, so the
+	// sandbox can be isolated from it.
+	if ns, ok := getNS(specs.NetworkNamespace, spec); ok && conf.Network != boot.NetworkNone && conf.Network != boot.NetworkNAT {
 		log.Infof("Sandbox will be started in the container's network namespace: %+v", ns)
 		nss = append(nss, ns)
 	} else {
@@ -331,9 +495,12 @@ func (s *Sandbox) createSandboxProcess(spec *specs.Spec, conf *boot.Config, bund
 	// User namespace depends on the following options:
 	//   - Host network/filesystem: requires to run inside the user namespace
 	//       specified in the spec or the current namespace if none is configured.
+	//   - Donated filesystem: files are accessed from the FDs donated by the
+	//       Gofer, which runs in that user namespace, so the sandbox must run
+	//       in the same one to have the same access to them.
 	//   - Gofer: when using a Gofer, the sandbox process can run isolated in an
 	//       empty namespace.
-	if conf.Network == boot.NetworkHost || conf.FileAccess == boot.FileAccessDirect {
+	if conf.Network == boot.NetworkHost || conf.FileAccess != boot.FileAccessProxy {
 		if userns, ok := getNS(specs.UserNamespace, spec); ok {
 			log.Infof("Sandbox will be started in container's user namespace: %+v", userns)
 			nss = append(nss, userns)
@@ -351,6 +518,9 @@ func (s *Sandbox) createSandboxProcess(spec *specs.Spec, conf *boot.Config, bund
 		nss = append(nss, specs.LinuxNamespace{Type: specs.UserNamespace})
 	}
 
+	// The container ID must be the last argument, after all flags.
+	cmd.Args = append(cmd.Args, s.ID)
+
 	log.Debugf("Starting sandbox: %s %v", binPath, cmd.Args)
 	if err := startInNS(cmd, nss); err != nil {
 		return err
@@ -360,6 +530,36 @@ func (s *Sandbox) createSandboxProcess(spec *specs.Spec, conf *boot.Config, bund
 	return nil
 }
 
+// openProxiedDevices opens the host devices at paths, which must be device
+// files in /dev that are supported by the device proxy.
+func openProxiedDevices(paths []string) ([]*os.File, error) {
+	var files []*os.File
+	for _, path := range paths {
+		if filepath.Dir(path) != "/dev" {
+			closeAll(files)
+			return nil, fmt.Errorf("proxied device %q is not in /dev", path)
+		}
+		if _, err := devproxy.FindDriver(filepath.Base(path)); err != nil {
+			closeAll(files)
+			return nil, err
+		}
+		f, err := os.OpenFile(path, os.O_RDWR, 0)
+		if err != nil {
+			closeAll(files)
+			return nil, fmt.Errorf("error opening proxied device %q: %v", path, err)
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// closeAll closes all files.
+func closeAll(files []*os.File) {
+	for _, f := range files {
+		f.Close()
+	}
+}
+
 // waitForCreated waits for the sandbox subprocess control server to be
 // running, at which point the sandbox is in Created state.
 func (s *Sandbox) waitForCreated(timeout time.Duration) error {
@@ -417,6 +617,17 @@ func (s *Sandbox) Destroy() error {
 		killProcess(s.GoferPid, unix.SIGKILL)
 		s.GoferPid = 0
 	}
+	if s.NATPid != 0 {
+		log.Debugf("Killing NAT for sandbox %q", s.ID)
+		killProcess(s.NATPid, unix.SIGKILL)
+		s.NATPid = 0
+	}
+	if s.Cgroup != nil {
+		if err := s.Cgroup.Uninstall(); err != nil {
+			log.Warningf("Error removing cgroup of sandbox %q: %v", s.ID, err)
+		}
+		s.Cgroup = nil
+	}
 
 	return nil
 }
@@ -440,28 +651,247 @@ func (s *Sandbox) Signal(cid string, sig syscall.Signal) error {
 	return nil
 }
 
+// Pause freezes the tasks of the container in the sandbox.
+func (s *Sandbox) Pause(cid string) error {
+	log.Debugf("Pause sandbox %q", s.ID)
+	conn, err := s.connect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := conn.Call(boot.ContainerPause, &cid, nil); err != nil {
+		return fmt.Errorf("err pausing container %q: %v", cid, err)
+	}
+	return nil
+}
+
+// Resume thaws the tasks of the container in the sandbox.
+func (s *Sandbox) Resume(cid string) error {
+	log.Debugf("Resume sandbox %q", s.ID)
+	conn, err := s.connect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := conn.Call(boot.ContainerResume, &cid, nil); err != nil {
+		return fmt.Errorf("err resuming container %q: %v", cid, err)
+	}
+	return nil
+}
+
+// Drain puts the sandbox's network stack into drain mode and sends sig to the
+// container, unless it is zero. Connections that are still open after
+// resetAfter are reset, unless it is zero.
+func (s *Sandbox) Drain(cid string, sig syscall.Signal, resetAfter time.Duration) error {
+	log.Debugf("Drain sandbox %q", s.ID)
+	conn, err := s.connect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	args := boot.DrainArgs{
+		CID:        cid,
+		Signo:      int32(sig),
+		ResetAfter: resetAfter,
+	}
+	if err := conn.Call(boot.ContainerDrain, &args, nil); err != nil {
+		return fmt.Errorf("err draining container %q: %v", cid, err)
+	}
+	return nil
+}
+
+// Update changes the resource limits of the container to those set in res,
+// in both the host cgroup of the sandbox and the sentry. Limits that aren't
+// set in res are unchanged. If the sentry fails to apply them, the host cgroup
+// is restored.
+func (s *Sandbox) Update(cid string, res *specs.LinuxResources) error {
+	log.Debugf("Update sandbox %q", s.ID)
+	conn, err := s.connect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	restore := func() {}
+	if s.Cgroup != nil {
+		if restore, err = s.Cgroup.Update(res); err != nil {
+			return fmt.Errorf("err updating cgroup of container %q: %v", cid, err)
+		}
+	}
+	args := boot.UpdateArgs{
+		CID:       cid,
+		Resources: *res,
+	}
+	if err := conn.Call(boot.ContainerUpdate, &args, nil); err != nil {
+		restore()
+		return fmt.Errorf("err updating container %q: %v", cid, err)
+	}
+	return nil
+}
+
+// Strace changes which syscalls the sandbox traces to its log. See
+// boot.StraceArgs.
+func (s *Sandbox) Strace(cid string, args *boot.StraceArgs) error {
+	log.Debugf("Strace sandbox %q", s.ID)
+	conn, err := s.connect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := conn.Call(boot.ContainerStrace, args, nil); err != nil {
+		return fmt.Errorf("err changing strace of container %q: %v", cid, err)
+	}
+	return nil
+}
+
+// SetFlags changes the values of flags of the sandbox, see
+// boot.DynamicFlags.
+func (s *Sandbox) SetFlags(cid string, flags map[string]string) error {
+	log.Debugf("Set flags of sandbox %q", s.ID)
+	conn, err := s.connect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	args := boot.SetFlagsArgs{Flags: flags}
+	if err := conn.Call(boot.ContainerSetFlags, &args, nil); err != nil {
+		return fmt.Errorf("err setting flags of container %q: %v", cid, err)
+	}
+	return nil
+}
+
+// PortForward connects the host stream socket f to the given TCP port on the
+// sandbox's loopback address. The sandbox copies data between them until both
+// are shut down.
+func (s *Sandbox) PortForward(cid string, port uint16, f *os.File) error {
+	log.Debugf("Port forward sandbox %q", s.ID)
+	conn, err := s.connect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	args := boot.PortForwardArgs{
+		CID:  cid,
+		Port: port,
+		FilePayload: urpc.FilePayload{
+			Files: []*os.File{f},
+		},
+	}
+	if err := conn.Call(boot.ContainerPortForward, &args, nil); err != nil {
+		return fmt.Errorf("err forwarding port %d of container %q: %v", port, cid, err)
+	}
+	return nil
+}
+
 // Checkpoint sends the checkpoint call for a container in the sandbox.
-// The statefile will be written to f.
-func (s *Sandbox) Checkpoint(cid string, f *os.File) error {
+// The statefile will be written to f. If incremental is true, only the memory
+// that changed since the previous checkpoint is saved. If leaveRunning is
+// true, the sandbox continues running after the checkpoint. It returns the
+// inventory of the checkpointed processes.
+func (s *Sandbox) Checkpoint(cid string, f *os.File, incremental, leaveRunning bool) (*control.Inventory, error) {
 	log.Debugf("Checkpoint sandbox %q", s.ID)
 	conn, err := s.connect()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer conn.Close()
 
 	opt := control.SaveOpts{
+		Incremental: incremental,
+		Resume:      leaveRunning,
 		FilePayload: urpc.FilePayload{
 			Files: []*os.File{f},
 		},
 	}
 
-	if err := conn.Call(boot.ContainerCheckpoint, &opt, nil); err != nil {
-		return fmt.Errorf("err checkpointing container %q: %v", cid, err)
+	var inv control.Inventory
+	if err := conn.Call(boot.ContainerCheckpoint, &opt, &inv); err != nil {
+		return nil, fmt.Errorf("err checkpointing container %q: %v", cid, err)
+	}
+	return &inv, nil
+}
+
+// Maintain runs the maintenance tasks given by opts in the sandbox.
+func (s *Sandbox) Maintain(cid string, opts *control.MaintenanceOpts) (*control.MaintenanceResult, error) {
+	log.Debugf("Running maintenance in sandbox %q", s.ID)
+	conn, err := s.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var res control.MaintenanceResult
+	if err := conn.Call(boot.ContainerMaintain, opts, &res); err != nil {
+		return nil, fmt.Errorf("err running maintenance in container %q: %v", cid, err)
+	}
+	return &res, nil
+}
+
+// Profile collects a sentry profile from the sandbox using the profile URPC
+// endpoint, and writes it to f. d is the collection period for profiles that
+// are collected over time.
+func (s *Sandbox) Profile(endpoint string, f *os.File, d time.Duration) error {
+	log.Debugf("Profile sandbox %q with %s", s.ID, endpoint)
+	conn, err := s.connect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	opts := control.ProfileOpts{
+		Duration: d,
+		FilePayload: urpc.FilePayload{
+			Files: []*os.File{f},
+		},
+	}
+	if err := conn.Call(endpoint, &opts, nil); err != nil {
+		return fmt.Errorf("err collecting profile with %s: %v", endpoint, err)
 	}
 	return nil
 }
 
+// FlightRecord writes the samples of the sandbox's flight recorder to f.
+func (s *Sandbox) FlightRecord(cid string, f *os.File) error {
+	log.Debugf("Flight record sandbox %q", s.ID)
+	conn, err := s.connect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	args := boot.FlightRecordArgs{
+		FilePayload: urpc.FilePayload{
+			Files: []*os.File{f},
+		},
+	}
+	if err := conn.Call(boot.ContainerFlightRecord, &args, nil); err != nil {
+		return fmt.Errorf("err dumping flight record of container %q: %v", cid, err)
+	}
+	return nil
+}
+
+// Metrics returns the values of the sentry's metrics.
+func (s *Sandbox) Metrics() ([]metric.MetricSnapshot, error) {
+	log.Debugf("Getting metrics from sandbox %q", s.ID)
+	conn, err := s.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var snaps []metric.MetricSnapshot
+	if err := conn.Call(boot.MetricsSnapshot, nil, &snaps); err != nil {
+		return nil, fmt.Errorf("err getting metrics from sandbox %q: %v", s.ID, err)
+	}
+	return snaps, nil
+}
+
 // IsRunning returns true if the sandbox or gofer process is running.
 func (s *Sandbox) IsRunning() bool {
 	if s.Pid != 0 {
@@ -58,11 +58,6 @@ func ValidateSpec(spec *specs.Spec) error {
 	if spec.Process.ApparmorProfile != "" {
 		log.Warningf("AppArmor profile %q is being ignored", spec.Process.ApparmorProfile)
 	}
-
-	// TODO: Apply seccomp to application inside sandbox.
-	if spec.Linux != nil && spec.Linux.Seccomp != nil {
-		log.Warningf("Seccomp spec is being ignored")
-	}
 	return nil
 }
 
@@ -0,0 +1,169 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package streaming
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/log"
+)
+
+// portForwardProtocol is the port-forward protocol over SPDY.
+const portForwardProtocol = "portforward.k8s.io"
+
+const (
+	// Headers of the streams of the port-forward protocol.
+	portHeader      = "port"
+	requestIDHeader = "requestID"
+
+	// Stream types of the port-forward protocol.
+	streamTypeData = "data"
+)
+
+// portForwardPair is the pair of streams of a forwarded connection.
+type portForwardPair struct {
+	port        int32
+	data        *spdyStream
+	errorStream *spdyStream
+	timer       *time.Timer
+}
+
+// portForwardHandler forwards the connections of a port-forward request over
+// SPDY. Each connection uses a data stream and an error stream, which share
+// a request ID.
+type portForwardHandler struct {
+	s            *Server
+	podSandboxID string
+
+	// mu protects pairs.
+	mu sync.Mutex
+
+	// pairs are the connections whose streams weren't all created, by
+	// request ID.
+	pairs map[string]*portForwardPair
+}
+
+// servePortForward serves req.
+func (s *Server) servePortForward(w http.ResponseWriter, r *http.Request, req *PortForwardRequest) {
+	if isWebSocketRequest(r) {
+		s.serveWebSocketPortForward(w, r, req)
+		return
+	}
+
+	protocol, err := negotiateProtocol(r, []string{portForwardProtocol})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if protocol != "" {
+		w.Header().Set(protocolHeader, protocol)
+	}
+	h := &portForwardHandler{
+		s:            s,
+		podSandboxID: req.PodSandboxID,
+		pairs:        make(map[string]*portForwardPair),
+	}
+	conn, err := upgradeSPDY(w, r, h.newStream)
+	if err != nil {
+		log.Infof("Error upgrading connection: %v", err)
+		return
+	}
+	// Connections are forwarded until the client closes the connection.
+	<-conn.done
+}
+
+// newStream adds a stream to its pair, and starts forwarding the connection
+// once the pair is complete.
+func (h *portForwardHandler) newStream(st *spdyStream) error {
+	port, err := strconv.ParseUint(st.headers.Get(portHeader), 10, 16)
+	if err != nil || port == 0 {
+		return fmt.Errorf("invalid port %q", st.headers.Get(portHeader))
+	}
+	typ := st.headers.Get(streamTypeHeader)
+	id := st.headers.Get(requestIDHeader)
+	if id == "" {
+		// Older clients create the data stream right after the error
+		// stream, and the stream IDs of clients are odd.
+		switch typ {
+		case streamTypeError:
+			id = strconv.FormatInt(int64(st.id), 10)
+		case streamTypeData:
+			id = strconv.FormatInt(int64(st.id)-2, 10)
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	p, ok := h.pairs[id]
+	if !ok {
+		p = &portForwardPair{port: int32(port)}
+		p.timer = time.AfterFunc(h.s.config.StreamCreationTimeout, func() { h.expire(id, p) })
+		h.pairs[id] = p
+	}
+	if p.port != int32(port) {
+		return fmt.Errorf("streams of request %q use ports %d and %d", id, p.port, port)
+	}
+	switch typ {
+	case streamTypeData:
+		if p.data != nil {
+			return fmt.Errorf("duplicate data stream for request %q", id)
+		}
+		p.data = st
+	case streamTypeError:
+		if p.errorStream != nil {
+			return fmt.Errorf("duplicate error stream for request %q", id)
+		}
+		p.errorStream = st
+	default:
+		return fmt.Errorf("invalid stream type %q", typ)
+	}
+	if p.data != nil && p.errorStream != nil {
+		p.timer.Stop()
+		delete(h.pairs, id)
+		go h.forward(p)
+	}
+	return nil
+}
+
+// expire resets the stream of p if the other one wasn't created in time.
+func (h *portForwardHandler) expire(id string, p *portForwardPair) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.pairs[id] != p {
+		return
+	}
+	delete(h.pairs, id)
+	log.Infof("Timed out waiting for the streams of port-forward request %q", id)
+	for _, st := range []*spdyStream{p.data, p.errorStream} {
+		if st != nil {
+			st.Reset()
+		}
+	}
+}
+
+// forward forwards the connection of p.
+func (h *portForwardHandler) forward(p *portForwardPair) {
+	defer p.errorStream.Close()
+	defer p.data.Close()
+	if err := h.s.runtime.PortForward(h.podSandboxID, p.port, p.data); err != nil {
+		msg := fmt.Sprintf("error forwarding port %d to pod %s: %v", p.port, h.podSandboxID, err)
+		log.Infof("%s", msg)
+		p.errorStream.Write([]byte(msg))
+	}
+}
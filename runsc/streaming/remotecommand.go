@@ -0,0 +1,311 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package streaming
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"gvisor.googlesource.com/gvisor/pkg/log"
+)
+
+// The versions of the remote command protocol, used by exec and attach, from
+// the newest to the oldest. Version 2 expects no stderr stream with a
+// terminal, version 3 adds the resize stream, and version 4 reports the exit
+// status as a JSON Status on the error stream.
+const (
+	remoteCommandV4 = "v4.channel.k8s.io"
+	remoteCommandV3 = "v3.channel.k8s.io"
+	remoteCommandV2 = "v2.channel.k8s.io"
+	remoteCommandV1 = "channel.k8s.io"
+)
+
+var remoteCommandProtocols = []string{remoteCommandV4, remoteCommandV3, remoteCommandV2, remoteCommandV1}
+
+const (
+	// protocolHeader is the header used to negotiate the version of a
+	// streaming protocol over SPDY.
+	protocolHeader = "X-Stream-Protocol-Version"
+
+	// streamTypeHeader is the header of SPDY streams that identifies
+	// their use.
+	streamTypeHeader = "streamType"
+
+	// Stream types of the remote command protocol.
+	streamTypeError  = "error"
+	streamTypeStdin  = "stdin"
+	streamTypeStdout = "stdout"
+	streamTypeStderr = "stderr"
+	streamTypeResize = "resize"
+)
+
+// negotiateProtocol returns the first of the supported protocols that the
+// client of r supports. It returns "" if the client didn't list any protocol,
+// and an error if it supports none of them.
+func negotiateProtocol(r *http.Request, supported []string) (string, error) {
+	var client []string
+	for _, v := range r.Header[protocolHeader] {
+		for _, p := range strings.Split(v, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				client = append(client, p)
+			}
+		}
+	}
+	if len(client) == 0 {
+		return "", nil
+	}
+	for _, p := range supported {
+		for _, c := range client {
+			if p == c {
+				return p, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("unable to negotiate protocol: client supports %v, server supports %v", client, supported)
+}
+
+// remoteCommand holds the streams of an exec or attach request, established
+// over SPDY or WebSocket.
+type remoteCommand struct {
+	protocol string
+
+	// stdin, stdout and stderr are nil if they weren't requested.
+	stdin  io.Reader
+	stdout io.WriteCloser
+	stderr io.WriteCloser
+
+	// errorStream receives the status of the command.
+	errorStream io.WriteCloser
+
+	// resize receives the terminal size changes, and is nil if there is
+	// no terminal or the protocol doesn't support resizing.
+	resize chan TerminalSize
+}
+
+// exitStatus is the status reported to clients of the remote command protocol
+// version 4, which is the JSON encoding of a Kubernetes Status.
+type exitStatus struct {
+	Metadata struct{}       `json:"metadata"`
+	Status   string         `json:"status"`
+	Message  string         `json:"message,omitempty"`
+	Reason   string         `json:"reason,omitempty"`
+	Details  *statusDetails `json:"details,omitempty"`
+	Code     int            `json:"code,omitempty"`
+}
+
+type statusDetails struct {
+	Causes []statusCause `json:"causes,omitempty"`
+}
+
+type statusCause struct {
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// writeStatus reports the result of the command on the error stream, and
+// closes it. Older protocol versions only report failures, as text.
+func (rc *remoteCommand) writeStatus(code int, err error) error {
+	var s exitStatus
+	switch {
+	case err != nil:
+		s = exitStatus{
+			Status:  "Failure",
+			Message: err.Error(),
+			Reason:  "InternalError",
+			Code:    http.StatusInternalServerError,
+		}
+	case code != 0:
+		s = exitStatus{
+			Status:  "Failure",
+			Message: fmt.Sprintf("command terminated with non-zero exit code: exit status %d", code),
+			Reason:  "NonZeroExitCode",
+			Details: &statusDetails{
+				Causes: []statusCause{{Reason: "ExitCode", Message: strconv.Itoa(code)}},
+			},
+			Code: http.StatusInternalServerError,
+		}
+	default:
+		s = exitStatus{Status: "Success"}
+	}
+
+	var b []byte
+	if rc.protocol == remoteCommandV4 {
+		b, err = json.Marshal(&s)
+		if err != nil {
+			return err
+		}
+	} else if s.Status != "Success" {
+		b = []byte(s.Message)
+	}
+	if len(b) > 0 {
+		if _, err := rc.errorStream.Write(b); err != nil {
+			return err
+		}
+	}
+	return rc.errorStream.Close()
+}
+
+// closeOutput closes stdout and stderr, once the command is done with them.
+func (rc *remoteCommand) closeOutput() {
+	if rc.stdout != nil {
+		rc.stdout.Close()
+	}
+	if rc.stderr != nil {
+		rc.stderr.Close()
+	}
+}
+
+// readResize decodes the terminal sizes sent on r into rc.resize, until r is
+// closed or done is closed. It closes rc.resize when it returns.
+func (rc *remoteCommand) readResize(r io.Reader, done <-chan struct{}) {
+	defer close(rc.resize)
+	d := json.NewDecoder(r)
+	for {
+		var size TerminalSize
+		if err := d.Decode(&size); err != nil {
+			if err != io.EOF {
+				log.Debugf("Error decoding terminal size: %v", err)
+			}
+			return
+		}
+		select {
+		case rc.resize <- size:
+		case <-done:
+			return
+		}
+	}
+}
+
+// serveExec serves req.
+func (s *Server) serveExec(w http.ResponseWriter, r *http.Request, req *ExecRequest) {
+	s.serveRemoteCommand(w, r, req.TTY, req.Stdin, req.Stdout, req.Stderr, func(rc *remoteCommand) {
+		code, err := s.runtime.Exec(req.ContainerID, req.Cmd, rc.stdin, rc.stdout, rc.stderr, req.TTY, rc.resize)
+		rc.closeOutput()
+		if err != nil {
+			log.Warningf("Error executing %v in container %q: %v", req.Cmd, req.ContainerID, err)
+		}
+		if err := rc.writeStatus(code, err); err != nil {
+			log.Debugf("Error writing exec status: %v", err)
+		}
+	})
+}
+
+// serveAttach serves req.
+func (s *Server) serveAttach(w http.ResponseWriter, r *http.Request, req *AttachRequest) {
+	s.serveRemoteCommand(w, r, req.TTY, req.Stdin, req.Stdout, req.Stderr, func(rc *remoteCommand) {
+		err := s.runtime.Attach(req.ContainerID, rc.stdin, rc.stdout, rc.stderr, req.TTY, rc.resize)
+		rc.closeOutput()
+		if err != nil {
+			log.Warningf("Error attaching to container %q: %v", req.ContainerID, err)
+		}
+		if err := rc.writeStatus(0, err); err != nil {
+			log.Debugf("Error writing attach status: %v", err)
+		}
+	})
+}
+
+// serveRemoteCommand establishes the streams of an exec or attach request over
+// SPDY or WebSocket, and calls run with them.
+func (s *Server) serveRemoteCommand(w http.ResponseWriter, r *http.Request, tty, stdin, stdout, stderr bool, run func(*remoteCommand)) {
+	if isWebSocketRequest(r) {
+		serveWebSocketRemoteCommand(w, r, tty, stdin, stdout, stderr, run)
+		return
+	}
+
+	protocol, err := negotiateProtocol(r, remoteCommandProtocols)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if protocol != "" {
+		w.Header().Set(protocolHeader, protocol)
+	}
+	resize := tty && (protocol == remoteCommandV3 || protocol == remoteCommandV4)
+
+	// The streams are created by the client once the connection is
+	// upgraded.
+	expected := 1
+	for _, b := range []bool{stdin, stdout, stderr, resize} {
+		if b {
+			expected++
+		}
+	}
+	streams := make(chan *spdyStream, expected)
+	newStream := func(st *spdyStream) error {
+		switch t := st.headers.Get(streamTypeHeader); t {
+		case streamTypeError, streamTypeStdin, streamTypeStdout, streamTypeStderr, streamTypeResize:
+		default:
+			return fmt.Errorf("invalid stream type %q", t)
+		}
+		select {
+		case streams <- st:
+			return nil
+		default:
+			return errors.New("too many streams")
+		}
+	}
+	conn, err := upgradeSPDY(w, r, newStream)
+	if err != nil {
+		log.Infof("Error upgrading connection: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	rc := remoteCommand{protocol: protocol}
+	var resizeStream io.Reader
+	timeout := time.NewTimer(s.config.StreamCreationTimeout)
+	defer timeout.Stop()
+	for i := 0; i < expected; i++ {
+		var st *spdyStream
+		select {
+		case st = <-streams:
+		case <-timeout.C:
+			log.Infof("Timed out waiting for %d streams, got %d", expected, i)
+			return
+		case <-conn.done:
+			return
+		}
+		switch st.headers.Get(streamTypeHeader) {
+		case streamTypeError:
+			rc.errorStream = st
+		case streamTypeStdin:
+			rc.stdin = st
+		case streamTypeStdout:
+			rc.stdout = st
+		case streamTypeStderr:
+			rc.stderr = st
+		case streamTypeResize:
+			resizeStream = st
+		}
+	}
+	if rc.errorStream == nil || (stdin && rc.stdin == nil) || (stdout && rc.stdout == nil) || (stderr && rc.stderr == nil) || (resize && resizeStream == nil) {
+		log.Infof("Client created unexpected streams")
+		return
+	}
+
+	if resizeStream != nil {
+		rc.resize = make(chan TerminalSize)
+		done := make(chan struct{})
+		defer close(done)
+		go rc.readResize(resizeStream, done)
+	}
+	run(&rc)
+}
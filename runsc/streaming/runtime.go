@@ -0,0 +1,289 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package streaming
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+
+	"github.com/kr/pty"
+	"gvisor.googlesource.com/gvisor/pkg/log"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/control"
+	"gvisor.googlesource.com/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.googlesource.com/gvisor/pkg/urpc"
+	"gvisor.googlesource.com/gvisor/runsc/container"
+	"gvisor.googlesource.com/gvisor/runsc/specutils"
+)
+
+// ContainerRuntime is a Runtime for the runsc containers in RootDir. Pod
+// sandbox IDs are the IDs of the containers that own the sandboxes.
+type ContainerRuntime struct {
+	RootDir string
+}
+
+// Exec implements Runtime.Exec. The command runs with the user, environment,
+// working directory and capabilities of the container's process. With a
+// terminal, its stdio is the slave of a host pty, which the sentry uses as a
+// host terminal.
+func (r *ContainerRuntime) Exec(containerID string, cmd []string, in io.Reader, out, errOut io.WriteCloser, tty bool, resize <-chan TerminalSize) (int, error) {
+	c, err := container.Load(r.RootDir, containerID)
+	if err != nil {
+		return 0, fmt.Errorf("error loading container %q: %v", containerID, err)
+	}
+	p := c.Spec.Process
+	caps, err := specutils.Capabilities(p.Capabilities)
+	if err != nil {
+		return 0, fmt.Errorf("error creating capabilities: %v", err)
+	}
+	extraKGIDs := make([]auth.KGID, 0, len(p.User.AdditionalGids))
+	for _, gid := range p.User.AdditionalGids {
+		extraKGIDs = append(extraKGIDs, auth.KGID(gid))
+	}
+	e := &control.ExecArgs{
+		Argv:             cmd,
+		Envv:             p.Env,
+		WorkingDirectory: p.Cwd,
+		KUID:             auth.KUID(p.User.UID),
+		KGID:             auth.KGID(p.User.GID),
+		ExtraKGIDs:       extraKGIDs,
+		Capabilities:     caps,
+	}
+	e.Filename, err = specutils.GetExecutablePath(cmd[0], c.Spec.Root.Path, e.Envv)
+	if err != nil {
+		return 0, fmt.Errorf("error getting executable path: %v", err)
+	}
+
+	var s *stdio
+	if tty {
+		s, err = newTerminalStdio(in, out, resize)
+	} else {
+		s, err = newPipeStdio(in, out, errOut)
+	}
+	if err != nil {
+		return 0, err
+	}
+	e.FilePayload = urpc.FilePayload{Files: s.files}
+	ws, err := c.Execute(e)
+	s.wait()
+	if err != nil {
+		return 0, fmt.Errorf("error executing %v in container %q: %v", cmd, containerID, err)
+	}
+	if ws.Signaled() {
+		return 128 + int(ws.Signal()), nil
+	}
+	return ws.ExitStatus(), nil
+}
+
+// Attach implements Runtime.Attach. The stdio of the init process of a runsc
+// container belongs to the process that created the container, which is
+// where attach requests must be served.
+func (r *ContainerRuntime) Attach(containerID string, in io.Reader, out, errOut io.WriteCloser, tty bool, resize <-chan TerminalSize) error {
+	return fmt.Errorf("cannot attach to container %q: its stdio belongs to the process that created it", containerID)
+}
+
+// PortForward implements Runtime.PortForward. The port is connected to on the
+// loopback address of the sandbox's network stack.
+func (r *ContainerRuntime) PortForward(podSandboxID string, port int32, stream io.ReadWriteCloser) error {
+	if port <= 0 || port > 0xffff {
+		return fmt.Errorf("invalid port %d", port)
+	}
+	c, err := container.Load(r.RootDir, podSandboxID)
+	if err != nil {
+		return fmt.Errorf("error loading container %q: %v", podSandboxID, err)
+	}
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("error creating socket pair: %v", err)
+	}
+	local := os.NewFile(uintptr(fds[0]), "port-forward")
+	remote := os.NewFile(uintptr(fds[1]), "port-forward")
+	err = c.PortForward(uint16(port), remote)
+	remote.Close()
+	if err != nil {
+		local.Close()
+		return err
+	}
+	conn, err := net.FileConn(local)
+	local.Close()
+	if err != nil {
+		return fmt.Errorf("error creating connection: %v", err)
+	}
+	defer conn.Close()
+	uc := conn.(*net.UnixConn)
+
+	// Copy in both directions, propagating half-closes.
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		io.Copy(uc, stream)
+		uc.CloseWrite()
+	}()
+	io.Copy(stream, uc)
+	stream.Close()
+	wg.Wait()
+	return nil
+}
+
+// stdio is the host side of the stdio of a process.
+type stdio struct {
+	// files are the stdin, stdout and stderr of the process.
+	files []*os.File
+
+	// wg waits for the output to be copied, once files are closed.
+	wg sync.WaitGroup
+
+	// cleanup is called once the output is copied.
+	cleanup func()
+}
+
+// wait closes the files of the process, waits for its output to be copied,
+// and releases the host side of the stdio.
+func (s *stdio) wait() {
+	for _, f := range s.files {
+		f.Close()
+	}
+	s.wg.Wait()
+	if s.cleanup != nil {
+		s.cleanup()
+	}
+}
+
+// copyOutput copies r to w in the background, and closes w once r is done.
+func (s *stdio) copyOutput(w io.WriteCloser, r io.Reader) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		// Reads of pty masters fail with EIO once the slave is
+		// closed, which ends the output.
+		io.Copy(w, r)
+		w.Close()
+	}()
+}
+
+// copyInput copies r to w in the background, and calls done once r is done.
+// It isn't waited for, as r may only end when the client leaves.
+func copyInput(w io.Writer, r io.Reader, done func()) {
+	go func() {
+		if _, err := io.Copy(w, r); err != nil {
+			log.Debugf("Error copying stdin: %v", err)
+		}
+		done()
+	}()
+}
+
+// newPipeStdio returns stdio connected to in, out and errOut with pipes. The
+// stdio that isn't requested is /dev/null.
+func newPipeStdio(in io.Reader, out, errOut io.WriteCloser) (*stdio, error) {
+	s := &stdio{}
+	fail := func(err error) (*stdio, error) {
+		for _, f := range s.files {
+			f.Close()
+		}
+		return nil, err
+	}
+	if in == nil {
+		f, err := os.Open(os.DevNull)
+		if err != nil {
+			return fail(err)
+		}
+		s.files = append(s.files, f)
+	} else {
+		pr, pw, err := os.Pipe()
+		if err != nil {
+			return fail(err)
+		}
+		s.files = append(s.files, pr)
+		copyInput(pw, in, func() { pw.Close() })
+	}
+	for _, w := range []io.WriteCloser{out, errOut} {
+		if w == nil {
+			f, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+			if err != nil {
+				return fail(err)
+			}
+			s.files = append(s.files, f)
+			continue
+		}
+		pr, pw, err := os.Pipe()
+		if err != nil {
+			return fail(err)
+		}
+		s.files = append(s.files, pw)
+		s.copyOutput(w, pr)
+	}
+	return s, nil
+}
+
+// newTerminalStdio returns stdio connected to in and out with a pty, whose
+// size follows resize.
+func newTerminalStdio(in io.Reader, out io.WriteCloser, resize <-chan TerminalSize) (*stdio, error) {
+	master, slave, err := pty.Open()
+	if err != nil {
+		return nil, fmt.Errorf("error opening pty: %v", err)
+	}
+	s := &stdio{
+		files: []*os.File{slave, slave, slave},
+	}
+	done := make(chan struct{})
+	s.cleanup = func() {
+		close(done)
+		master.Close()
+	}
+
+	if in != nil {
+		copyInput(master, in, func() {})
+	}
+	if out != nil {
+		s.copyOutput(out, master)
+	} else {
+		// The output must still be read for the process to make
+		// progress.
+		s.copyOutput(nopWriteCloser{ioutil.Discard}, master)
+	}
+	if resize != nil {
+		go func() {
+			for {
+				select {
+				case size, ok := <-resize:
+					if !ok {
+						return
+					}
+					if err := pty.Setsize(master, &pty.Winsize{Rows: size.Height, Cols: size.Width}); err != nil {
+						log.Debugf("Error resizing terminal: %v", err)
+					}
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+	return s, nil
+}
+
+// nopWriteCloser is an io.WriteCloser whose Close does nothing.
+type nopWriteCloser struct {
+	io.Writer
+}
+
+// Close implements io.Closer.Close.
+func (nopWriteCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,262 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package streaming implements the streaming server of the Kubernetes
+// container runtime interface (CRI), which serves the exec, attach and
+// port-forward requests of kubectl over SPDY or WebSocket connections.
+//
+// A CRI shim returns the URLs of GetExec, GetAttach and GetPortForward from the
+// corresponding CRI calls, and serves the Server over HTTP. The requests are
+// carried out by a Runtime, such as ContainerRuntime for runsc containers.
+package streaming
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// tokenTTL is the time after which the URL of a request expires if it
+	// wasn't used.
+	tokenTTL = time.Minute
+
+	// maxInFlight is the maximum number of requests whose URLs haven't
+	// been used yet.
+	maxInFlight = 1000
+
+	// defaultStreamCreationTimeout is the default time to wait for clients
+	// to create the streams of a request.
+	defaultStreamCreationTimeout = 30 * time.Second
+)
+
+// TerminalSize is the size of a terminal, sent by clients when their
+// terminal is resized.
+type TerminalSize struct {
+	Width  uint16
+	Height uint16
+}
+
+// Runtime carries out streaming requests.
+type Runtime interface {
+	// Exec runs cmd in a container, with the given stdio, and returns its
+	// exit status. in, out and errOut are nil if the client didn't request
+	// them. If tty is true, the process runs in a terminal whose size
+	// changes are received from resize, and errOut is nil.
+	Exec(containerID string, cmd []string, in io.Reader, out, errOut io.WriteCloser, tty bool, resize <-chan TerminalSize) (int, error)
+
+	// Attach connects the given stdio to the init process of a container,
+	// as Exec does.
+	Attach(containerID string, in io.Reader, out, errOut io.WriteCloser, tty bool, resize <-chan TerminalSize) error
+
+	// PortForward connects stream to port of the network of a pod sandbox,
+	// and copies data between them until both are closed.
+	PortForward(podSandboxID string, port int32, stream io.ReadWriteCloser) error
+}
+
+// ExecRequest is a request to run a command in a container, as in the
+// ExecRequest of the CRI.
+type ExecRequest struct {
+	ContainerID string
+	Cmd         []string
+	TTY         bool
+	Stdin       bool
+	Stdout      bool
+	Stderr      bool
+}
+
+// AttachRequest is a request to attach to the init process of a container, as
+// in the AttachRequest of the CRI.
+type AttachRequest struct {
+	ContainerID string
+	TTY         bool
+	Stdin       bool
+	Stdout      bool
+	Stderr      bool
+}
+
+// PortForwardRequest is a request to forward ports of a pod sandbox, as in
+// the PortForwardRequest of the CRI. Clients using SPDY may forward any port,
+// and clients using WebSocket list the ports in the URL.
+type PortForwardRequest struct {
+	PodSandboxID string
+}
+
+// Config configures a Server.
+type Config struct {
+	// BaseURL is the URL at which the Server is served, which the URLs of
+	// the requests are relative to.
+	BaseURL *url.URL
+
+	// StreamCreationTimeout is the time to wait for clients to create
+	// the streams of a request. If it is 0, a default is used.
+	StreamCreationTimeout time.Duration
+}
+
+// Server serves the streaming requests of CRI clients. Each request is first
+// registered with GetExec, GetAttach or GetPortForward, which return a
+// single-use URL that the client connects to.
+type Server struct {
+	config  Config
+	runtime Runtime
+
+	// mu protects requests.
+	mu sync.Mutex
+
+	// requests are the requests whose URLs haven't been used, by token.
+	requests map[string]pendingRequest
+}
+
+// pendingRequest is a request whose URL hasn't been used.
+type pendingRequest struct {
+	// req is an *ExecRequest, *AttachRequest or *PortForwardRequest.
+	req     interface{}
+	expires time.Time
+}
+
+// NewServer returns a Server that carries out requests with runtime.
+func NewServer(config Config, runtime Runtime) (*Server, error) {
+	if config.BaseURL == nil {
+		return nil, errors.New("no base URL")
+	}
+	if config.StreamCreationTimeout <= 0 {
+		config.StreamCreationTimeout = defaultStreamCreationTimeout
+	}
+	return &Server{
+		config:   config,
+		runtime:  runtime,
+		requests: make(map[string]pendingRequest),
+	}, nil
+}
+
+// GetExec registers req and returns the URL at which it is served.
+func (s *Server) GetExec(req *ExecRequest) (string, error) {
+	if req.ContainerID == "" {
+		return "", errors.New("missing container ID")
+	}
+	if len(req.Cmd) == 0 {
+		return "", errors.New("missing command")
+	}
+	if err := validateStdio(req.TTY, req.Stdin, req.Stdout, req.Stderr); err != nil {
+		return "", err
+	}
+	return s.register("exec", req)
+}
+
+// GetAttach registers req and returns the URL at which it is served.
+func (s *Server) GetAttach(req *AttachRequest) (string, error) {
+	if req.ContainerID == "" {
+		return "", errors.New("missing container ID")
+	}
+	if err := validateStdio(req.TTY, req.Stdin, req.Stdout, req.Stderr); err != nil {
+		return "", err
+	}
+	return s.register("attach", req)
+}
+
+// GetPortForward registers req and returns the URL at which it is served.
+func (s *Server) GetPortForward(req *PortForwardRequest) (string, error) {
+	if req.PodSandboxID == "" {
+		return "", errors.New("missing pod sandbox ID")
+	}
+	return s.register("portforward", req)
+}
+
+// validateStdio checks the stdio requested by an exec or attach request.
+func validateStdio(tty, stdin, stdout, stderr bool) error {
+	if tty && stderr {
+		return errors.New("tty and stderr can't both be requested")
+	}
+	if !stdin && !stdout && !stderr {
+		return errors.New("one of stdin, stdout or stderr must be requested")
+	}
+	return nil
+}
+
+// register stores req under a new token, and returns its URL.
+func (s *Server) register(method string, req interface{}) (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for t, r := range s.requests {
+		if now.After(r.expires) {
+			delete(s.requests, t)
+		}
+	}
+	if len(s.requests) >= maxInFlight {
+		return "", errors.New("too many requests in flight")
+	}
+	s.requests[token] = pendingRequest{req: req, expires: now.Add(tokenTTL)}
+
+	u := s.config.BaseURL.ResolveReference(&url.URL{Path: path.Join(method, token)})
+	return u.String(), nil
+}
+
+// consume returns the request registered under token, which can't be used
+// again, or nil if there is none.
+func (s *Server) consume(token string) interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.requests[token]
+	if !ok {
+		return nil
+	}
+	delete(s.requests, token)
+	if time.Now().After(r.expires) {
+		return nil
+	}
+	return r.req
+}
+
+// ServeHTTP implements http.Handler.ServeHTTP. It serves the URLs returned by
+// GetExec, GetAttach and GetPortForward.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	method, token := path.Split(r.URL.Path)
+	req := s.consume(token)
+	switch req := req.(type) {
+	case *ExecRequest:
+		if strings.HasSuffix(method, "/exec/") {
+			s.serveExec(w, r, req)
+			return
+		}
+	case *AttachRequest:
+		if strings.HasSuffix(method, "/attach/") {
+			s.serveAttach(w, r, req)
+			return
+		}
+	case *PortForwardRequest:
+		if strings.HasSuffix(method, "/portforward/") {
+			s.servePortForward(w, r, req)
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
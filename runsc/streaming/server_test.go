@@ -0,0 +1,577 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package streaming
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// fakeRuntime is a Runtime with a single container, "c1". Exec reports the
+// first terminal size and the command, echoes stdin, and exits with the last
+// argument of the command. Port 80 echoes its input.
+type fakeRuntime struct{}
+
+func (fakeRuntime) Exec(containerID string, cmd []string, in io.Reader, out, errOut io.WriteCloser, tty bool, resize <-chan TerminalSize) (int, error) {
+	if containerID != "c1" {
+		return 0, fmt.Errorf("no container %q", containerID)
+	}
+	if resize != nil {
+		size := <-resize
+		fmt.Fprintf(out, "%dx%d\n", size.Width, size.Height)
+	}
+	if errOut != nil {
+		fmt.Fprintf(errOut, "running %v\n", cmd)
+	}
+	if in != nil && out != nil {
+		io.Copy(out, in)
+	}
+	return strconv.Atoi(cmd[len(cmd)-1])
+}
+
+func (fakeRuntime) Attach(containerID string, in io.Reader, out, errOut io.WriteCloser, tty bool, resize <-chan TerminalSize) error {
+	return errors.New("attach failed")
+}
+
+func (fakeRuntime) PortForward(podSandboxID string, port int32, stream io.ReadWriteCloser) error {
+	if port != 80 {
+		return errors.New("connection refused")
+	}
+	io.Copy(stream, stream)
+	return stream.Close()
+}
+
+// newTestServer returns a Server using fakeRuntime, served by an HTTP server.
+func newTestServer(t *testing.T) (*Server, func()) {
+	ts := httptest.NewServer(nil)
+	u, err := url.Parse(ts.URL + "/cri/")
+	if err != nil {
+		t.Fatalf("error parsing URL: %v", err)
+	}
+	s, err := NewServer(Config{BaseURL: u, StreamCreationTimeout: 5 * time.Second}, fakeRuntime{})
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	ts.Config.Handler = s
+	return s, ts.Close
+}
+
+// spdyClient is the client side of a SPDY connection.
+type spdyClient struct {
+	conn         net.Conn
+	compressor   headerCompressor
+	decompressor headerDecompressor
+	nextID       uint32
+
+	mu      sync.Mutex
+	streams map[uint32]*clientStream
+}
+
+// clientStream is a stream of a spdyClient.
+type clientStream struct {
+	c  *spdyClient
+	id uint32
+
+	// replied receives whether the stream was accepted.
+	replied chan bool
+
+	// data receives the data frames of the stream, and is closed once
+	// the server half-closes or resets the stream.
+	data chan []byte
+}
+
+// dialSPDY connects to url, upgrading the connection to SPDY with the given
+// protocols, and returns the client and the negotiated protocol.
+func dialSPDY(t *testing.T, rawurl string, protocols ...string) (*spdyClient, string) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		t.Fatalf("error parsing URL: %v", err)
+	}
+	conn, err := net.Dial("tcp", u.Host)
+	if err != nil {
+		t.Fatalf("error connecting to %s: %v", u.Host, err)
+	}
+	req := fmt.Sprintf("POST %s HTTP/1.1\r\nHost: %s\r\nConnection: Upgrade\r\nUpgrade: SPDY/3.1\r\n", u.RequestURI(), u.Host)
+	for _, p := range protocols {
+		req += protocolHeader + ": " + p + "\r\n"
+	}
+	if _, err := conn.Write([]byte(req + "\r\n")); err != nil {
+		t.Fatalf("error writing request: %v", err)
+	}
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, nil)
+	if err != nil {
+		t.Fatalf("error reading response: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		body, _ := ioutil.ReadAll(resp.Body)
+		t.Fatalf("got response %q: %s", resp.Status, body)
+	}
+	c := &spdyClient{
+		conn:    conn,
+		nextID:  1,
+		streams: make(map[uint32]*clientStream),
+	}
+	go c.read(r)
+	return c, resp.Header.Get(protocolHeader)
+}
+
+func (c *spdyClient) read(r io.Reader) {
+	defer func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		for id, s := range c.streams {
+			close(s.data)
+			delete(c.streams, id)
+		}
+	}()
+	for {
+		f, err := readFrame(r)
+		if err != nil {
+			return
+		}
+		if !f.control {
+			c.mu.Lock()
+			if s := c.streams[f.streamID]; s != nil {
+				if len(f.data) > 0 {
+					s.data <- f.data
+				}
+				if f.flags&flagFin != 0 {
+					close(s.data)
+					delete(c.streams, f.streamID)
+				}
+			}
+			c.mu.Unlock()
+			continue
+		}
+		if f.typ != typeSynReply && f.typ != typeRstStream {
+			continue
+		}
+		id := binary.BigEndian.Uint32(f.data[0:4])
+		if f.typ == typeSynReply {
+			if _, err := c.decompressor.decompress(f.data[4:]); err != nil {
+				return
+			}
+		}
+		c.mu.Lock()
+		if s := c.streams[id]; s != nil {
+			select {
+			case s.replied <- f.typ == typeSynReply:
+			default:
+			}
+			if f.typ == typeRstStream {
+				close(s.data)
+				delete(c.streams, id)
+			}
+		}
+		c.mu.Unlock()
+	}
+}
+
+// createStream creates a stream with the given headers, and returns whether
+// the server accepted it.
+func (c *spdyClient) createStream(t *testing.T, headers ...string) (*clientStream, bool) {
+	h := make(http.Header)
+	for i := 0; i < len(headers); i += 2 {
+		h.Set(headers[i], headers[i+1])
+	}
+	block, err := c.compressor.compress(h)
+	if err != nil {
+		t.Fatalf("error compressing headers: %v", err)
+	}
+	s := &clientStream{
+		c:       c,
+		id:      c.nextID,
+		replied: make(chan bool, 1),
+		data:    make(chan []byte, 100),
+	}
+	c.nextID += 2
+	c.mu.Lock()
+	c.streams[s.id] = s
+	c.mu.Unlock()
+	var data []byte
+	data = appendUint32(data, s.id)
+	data = appendUint32(data, 0)
+	data = append(data, 0, 0)
+	data = append(data, block...)
+	if _, err := c.conn.Write(appendFrame(nil, spdyFrame{control: true, typ: typeSynStream, data: data})); err != nil {
+		t.Fatalf("error writing SYN_STREAM: %v", err)
+	}
+	select {
+	case ok := <-s.replied:
+		return s, ok
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for a reply to stream %d", s.id)
+		return nil, false
+	}
+}
+
+func (s *clientStream) write(t *testing.T, data string, fin bool) {
+	f := spdyFrame{streamID: s.id, data: []byte(data)}
+	if fin {
+		f.flags = flagFin
+	}
+	if _, err := s.c.conn.Write(appendFrame(nil, f)); err != nil {
+		t.Fatalf("error writing data: %v", err)
+	}
+}
+
+// readAll returns the data of the stream, until the server half-closes it.
+func (s *clientStream) readAll(t *testing.T) string {
+	var b []byte
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case d, ok := <-s.data:
+			if !ok {
+				return string(b)
+			}
+			b = append(b, d...)
+		case <-timeout:
+			t.Fatalf("timed out reading stream %d, got %q", s.id, b)
+		}
+	}
+}
+
+func TestExecSPDY(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+	u, err := s.GetExec(&ExecRequest{ContainerID: "c1", Cmd: []string{"cat", "3"}, Stdin: true, Stdout: true, Stderr: true})
+	if err != nil {
+		t.Fatalf("GetExec failed: %v", err)
+	}
+	c, protocol := dialSPDY(t, u, remoteCommandV4, remoteCommandV3)
+	defer c.conn.Close()
+	if protocol != remoteCommandV4 {
+		t.Errorf("negotiated protocol %q, want %q", protocol, remoteCommandV4)
+	}
+
+	var streams [4]*clientStream
+	for i, typ := range []string{streamTypeError, streamTypeStdin, streamTypeStdout, streamTypeStderr} {
+		st, ok := c.createStream(t, streamTypeHeader, typ)
+		if !ok {
+			t.Fatalf("stream %q was refused", typ)
+		}
+		streams[i] = st
+	}
+	streams[1].write(t, "hello", false)
+	streams[1].write(t, " world", true)
+
+	if got, want := streams[2].readAll(t), "hello world"; got != want {
+		t.Errorf("stdout = %q, want %q", got, want)
+	}
+	if got, want := streams[3].readAll(t), "running [cat 3]\n"; got != want {
+		t.Errorf("stderr = %q, want %q", got, want)
+	}
+	var status exitStatus
+	if err := json.Unmarshal([]byte(streams[0].readAll(t)), &status); err != nil {
+		t.Fatalf("error decoding status: %v", err)
+	}
+	if status.Status != "Failure" || status.Reason != "NonZeroExitCode" || status.Details == nil || len(status.Details.Causes) != 1 || status.Details.Causes[0] != (statusCause{Reason: "ExitCode", Message: "3"}) {
+		t.Errorf("got status %+v, want exit code 3", status)
+	}
+}
+
+func TestExecSPDYTerminal(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+	u, err := s.GetExec(&ExecRequest{ContainerID: "c1", Cmd: []string{"sh", "0"}, TTY: true, Stdout: true})
+	if err != nil {
+		t.Fatalf("GetExec failed: %v", err)
+	}
+	c, _ := dialSPDY(t, u, remoteCommandV4)
+	defer c.conn.Close()
+
+	errStream, _ := c.createStream(t, streamTypeHeader, streamTypeError)
+	stdout, _ := c.createStream(t, streamTypeHeader, streamTypeStdout)
+	resize, ok := c.createStream(t, streamTypeHeader, streamTypeResize)
+	if !ok {
+		t.Fatalf("resize stream was refused")
+	}
+	resize.write(t, `{"Width":80,"Height":24}`, false)
+
+	if got, want := stdout.readAll(t), "80x24\n"; got != want {
+		t.Errorf("stdout = %q, want %q", got, want)
+	}
+	if got, want := errStream.readAll(t), `{"metadata":{},"status":"Success"}`; got != want {
+		t.Errorf("status = %q, want %q", got, want)
+	}
+}
+
+func TestExecSPDYOldProtocol(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+	u, err := s.GetExec(&ExecRequest{ContainerID: "c2", Cmd: []string{"true"}, Stdout: true})
+	if err != nil {
+		t.Fatalf("GetExec failed: %v", err)
+	}
+	c, protocol := dialSPDY(t, u, remoteCommandV2)
+	defer c.conn.Close()
+	if protocol != remoteCommandV2 {
+		t.Errorf("negotiated protocol %q, want %q", protocol, remoteCommandV2)
+	}
+
+	errStream, _ := c.createStream(t, streamTypeHeader, streamTypeError)
+	c.createStream(t, streamTypeHeader, streamTypeStdout)
+	if got, want := errStream.readAll(t), `no container "c2"`; got != want {
+		t.Errorf("status = %q, want %q", got, want)
+	}
+}
+
+func TestExecSPDYInvalidStream(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+	u, err := s.GetExec(&ExecRequest{ContainerID: "c1", Cmd: []string{"true"}, Stdout: true})
+	if err != nil {
+		t.Fatalf("GetExec failed: %v", err)
+	}
+	c, _ := dialSPDY(t, u, remoteCommandV4)
+	defer c.conn.Close()
+	if _, ok := c.createStream(t, streamTypeHeader, "bogus"); ok {
+		t.Errorf("stream of invalid type was accepted")
+	}
+}
+
+func TestAttachSPDY(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+	u, err := s.GetAttach(&AttachRequest{ContainerID: "c1", Stdout: true})
+	if err != nil {
+		t.Fatalf("GetAttach failed: %v", err)
+	}
+	c, _ := dialSPDY(t, u, remoteCommandV4)
+	defer c.conn.Close()
+
+	errStream, _ := c.createStream(t, streamTypeHeader, streamTypeError)
+	c.createStream(t, streamTypeHeader, streamTypeStdout)
+	var status exitStatus
+	if err := json.Unmarshal([]byte(errStream.readAll(t)), &status); err != nil {
+		t.Fatalf("error decoding status: %v", err)
+	}
+	if status.Reason != "InternalError" || status.Message != "attach failed" {
+		t.Errorf("got status %+v, want an internal error", status)
+	}
+}
+
+func TestPortForwardSPDY(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+	u, err := s.GetPortForward(&PortForwardRequest{PodSandboxID: "c1"})
+	if err != nil {
+		t.Fatalf("GetPortForward failed: %v", err)
+	}
+	c, protocol := dialSPDY(t, u, portForwardProtocol)
+	defer c.conn.Close()
+	if protocol != portForwardProtocol {
+		t.Errorf("negotiated protocol %q, want %q", protocol, portForwardProtocol)
+	}
+
+	// Two connections to port 80, and one to a closed port.
+	for i := 0; i < 2; i++ {
+		id := strconv.Itoa(i)
+		errStream, _ := c.createStream(t, streamTypeHeader, streamTypeError, portHeader, "80", requestIDHeader, id)
+		data, ok := c.createStream(t, streamTypeHeader, streamTypeData, portHeader, "80", requestIDHeader, id)
+		if !ok {
+			t.Fatalf("data stream was refused")
+		}
+		data.write(t, "ping "+id, true)
+		if got, want := data.readAll(t), "ping "+id; got != want {
+			t.Errorf("data = %q, want %q", got, want)
+		}
+		if got := errStream.readAll(t); got != "" {
+			t.Errorf("got error %q", got)
+		}
+	}
+
+	errStream, _ := c.createStream(t, streamTypeHeader, streamTypeError, portHeader, "81", requestIDHeader, "2")
+	data, _ := c.createStream(t, streamTypeHeader, streamTypeData, portHeader, "81", requestIDHeader, "2")
+	if got := errStream.readAll(t); !strings.Contains(got, "connection refused") {
+		t.Errorf("got error %q, want connection refused", got)
+	}
+	if got := data.readAll(t); got != "" {
+		t.Errorf("data = %q, want none", got)
+	}
+}
+
+func TestProtocolNegotiationFailure(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+	u, err := s.GetPortForward(&PortForwardRequest{PodSandboxID: "c1"})
+	if err != nil {
+		t.Fatalf("GetPortForward failed: %v", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, u, nil)
+	if err != nil {
+		t.Fatalf("error creating request: %v", err)
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", spdyUpgrade)
+	req.Header.Set(protocolHeader, "v9.portforward.k8s.io")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("got status %q, want %d", resp.Status, http.StatusForbidden)
+	}
+}
+
+func TestURLSingleUse(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+	u, err := s.GetExec(&ExecRequest{ContainerID: "c1", Cmd: []string{"true"}, Stdout: true})
+	if err != nil {
+		t.Fatalf("GetExec failed: %v", err)
+	}
+
+	// The URL of an exec request can't be used for port-forward, and is
+	// consumed by the attempt.
+	pf := strings.Replace(u, "/exec/", "/portforward/", 1)
+	for _, rawurl := range []string{pf, u} {
+		resp, err := http.Post(rawurl, "", nil)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("POST %s: got status %q, want %d", rawurl, resp.Status, http.StatusNotFound)
+		}
+	}
+}
+
+func TestGetRequestValidation(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+	for _, req := range []*ExecRequest{
+		{Cmd: []string{"true"}, Stdout: true},
+		{ContainerID: "c1", Stdout: true},
+		{ContainerID: "c1", Cmd: []string{"true"}},
+		{ContainerID: "c1", Cmd: []string{"true"}, TTY: true, Stdout: true, Stderr: true},
+	} {
+		if _, err := s.GetExec(req); err == nil {
+			t.Errorf("GetExec(%+v) succeeded", req)
+		}
+	}
+}
+
+// dialWebSocket connects to rawurl with the given protocol.
+func dialWebSocket(t *testing.T, rawurl, protocol string) *websocket.Conn {
+	config, err := websocket.NewConfig(strings.Replace(rawurl, "http://", "ws://", 1), "http://localhost/")
+	if err != nil {
+		t.Fatalf("error creating WebSocket config: %v", err)
+	}
+	config.Protocol = []string{protocol}
+	ws, err := websocket.DialConfig(config)
+	if err != nil {
+		t.Fatalf("error connecting to %s: %v", rawurl, err)
+	}
+	ws.SetDeadline(time.Now().Add(5 * time.Second))
+	return ws
+}
+
+// readChannels returns the data received on each channel, until the server
+// closes the connection.
+func readChannels(t *testing.T, ws *websocket.Conn) map[byte]string {
+	data := make(map[byte]string)
+	for {
+		var msg []byte
+		if err := websocket.Message.Receive(ws, &msg); err != nil {
+			if err != io.EOF {
+				t.Fatalf("error receiving message: %v", err)
+			}
+			return data
+		}
+		if len(msg) == 0 {
+			t.Fatalf("empty message")
+		}
+		data[msg[0]] += string(msg[1:])
+	}
+}
+
+func TestExecWebSocket(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+	u, err := s.GetExec(&ExecRequest{ContainerID: "c1", Cmd: []string{"sh", "0"}, TTY: true, Stdout: true})
+	if err != nil {
+		t.Fatalf("GetExec failed: %v", err)
+	}
+	ws := dialWebSocket(t, u, webSocketProtocolV4)
+	defer ws.Close()
+	if err := websocket.Message.Send(ws, append([]byte{channelResize}, `{"Width":100,"Height":50}`...)); err != nil {
+		t.Fatalf("error sending resize: %v", err)
+	}
+	data := readChannels(t, ws)
+	if got, want := data[channelStdout], "100x50\n"; got != want {
+		t.Errorf("stdout = %q, want %q", got, want)
+	}
+	if got, want := data[channelError], `{"metadata":{},"status":"Success"}`; got != want {
+		t.Errorf("status = %q, want %q", got, want)
+	}
+}
+
+func TestPortForwardWebSocket(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+	u, err := s.GetPortForward(&PortForwardRequest{PodSandboxID: "c1"})
+	if err != nil {
+		t.Fatalf("GetPortForward failed: %v", err)
+	}
+	ws := dialWebSocket(t, u+"?port=80,81", webSocketProtocolV4)
+	defer ws.Close()
+
+	// Each channel starts with its port.
+	ports := map[byte]uint16{0: 80, 1: 80, 2: 81, 3: 81}
+	var msg []byte
+	for range ports {
+		if err := websocket.Message.Receive(ws, &msg); err != nil {
+			t.Fatalf("error receiving message: %v", err)
+		}
+		if len(msg) != 3 || binary.LittleEndian.Uint16(msg[1:]) != ports[msg[0]] {
+			t.Errorf("got message %v, want the port of channel %d", msg, msg[0])
+		}
+		delete(ports, msg[0])
+	}
+
+	if err := websocket.Message.Send(ws, []byte("\x00ping")); err != nil {
+		t.Fatalf("error sending data: %v", err)
+	}
+	got := make(map[byte]string)
+	for got[0] != "ping" || got[3] == "" {
+		if err := websocket.Message.Receive(ws, &msg); err != nil {
+			t.Fatalf("error receiving message, got %q: %v", got, err)
+		}
+		got[msg[0]] += string(msg[1:])
+	}
+	if !strings.Contains(got[3], "connection refused") {
+		t.Errorf("got error %q on port 81, want connection refused", got[3])
+	}
+}
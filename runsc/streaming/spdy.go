@@ -0,0 +1,656 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package streaming
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"gvisor.googlesource.com/gvisor/pkg/log"
+)
+
+// The server side of SPDY/3.1, limited to what the Kubernetes streaming
+// protocols use: clients create all the streams, and there is no flow control,
+// as with the Kubernetes implementation.
+
+const (
+	spdyVersion = 3
+
+	// spdyUpgrade is the value of the Upgrade header of SPDY requests.
+	spdyUpgrade = "SPDY/3.1"
+
+	// frameHeaderSize is the size of the header of all frames.
+	frameHeaderSize = 8
+
+	// maxFrameSize is the maximum size of a frame, which is limited by its
+	// 24-bit length field.
+	maxFrameSize = 1<<24 - 1
+
+	// maxDataSize is the maximum size of the data frames that are sent.
+	maxDataSize = 32 << 10
+
+	// maxStreamBuffer is the maximum amount of data buffered for a stream
+	// that isn't read. Clients can't be slowed down without flow control,
+	// so streams that exceed it are reset.
+	maxStreamBuffer = 1 << 20
+
+	// Control frame types.
+	typeSynStream = 1
+	typeSynReply  = 2
+	typeRstStream = 3
+	typePing      = 6
+	typeGoAway    = 7
+
+	// flagFin half-closes a stream.
+	flagFin = 0x01
+
+	// RST_STREAM status codes.
+	rstProtocolError = 1
+	rstInvalidStream = 2
+	rstRefusedStream = 3
+	rstCancel        = 5
+	rstFlowControl   = 7
+)
+
+// spdyDictionary is the zlib dictionary of header blocks, defined by the
+// SPDY/3 specification.
+const spdyDictionary = "\x00\x00\x00\x07options\x00\x00\x00\x04head\x00\x00\x00\x04post" +
+	"\x00\x00\x00\x03put\x00\x00\x00\x06delete\x00\x00\x00\x05trace" +
+	"\x00\x00\x00\x06accept\x00\x00\x00\x0eaccept-charset\x00\x00\x00" +
+	"\x0faccept-encoding\x00\x00\x00\x0faccept-language\x00\x00\x00" +
+	"\x0daccept-ranges\x00\x00\x00\x03age\x00\x00\x00\x05allow\x00" +
+	"\x00\x00\x0dauthorization\x00\x00\x00\x0dcache-control\x00\x00" +
+	"\x00\x0aconnection\x00\x00\x00\x0ccontent-base\x00\x00\x00\x10co" +
+	"ntent-encoding\x00\x00\x00\x10content-language\x00\x00\x00\x0eco" +
+	"ntent-length\x00\x00\x00\x10content-location\x00\x00\x00\x0bcont" +
+	"ent-md5\x00\x00\x00\x0dcontent-range\x00\x00\x00\x0ccontent-type" +
+	"\x00\x00\x00\x04date\x00\x00\x00\x04etag\x00\x00\x00\x06expect" +
+	"\x00\x00\x00\x07expires\x00\x00\x00\x04from\x00\x00\x00\x04host" +
+	"\x00\x00\x00\x08if-match\x00\x00\x00\x11if-modified-since\x00" +
+	"\x00\x00\x0dif-none-match\x00\x00\x00\x08if-range\x00\x00\x00" +
+	"\x13if-unmodified-since\x00\x00\x00\x0dlast-modified\x00\x00\x00" +
+	"\x08location\x00\x00\x00\x0cmax-forwards\x00\x00\x00\x06pragma" +
+	"\x00\x00\x00\x12proxy-authenticate\x00\x00\x00\x13proxy-authoriz" +
+	"ation\x00\x00\x00\x05range\x00\x00\x00\x07referer\x00\x00\x00" +
+	"\x0bretry-after\x00\x00\x00\x06server\x00\x00\x00\x02te\x00\x00" +
+	"\x00\x07trailer\x00\x00\x00\x11transfer-encoding\x00\x00\x00\x07" +
+	"upgrade\x00\x00\x00\x0auser-agent\x00\x00\x00\x04vary\x00\x00" +
+	"\x00\x03via\x00\x00\x00\x07warning\x00\x00\x00\x10www-authentica" +
+	"te\x00\x00\x00\x06method\x00\x00\x00\x03get\x00\x00\x00\x06statu" +
+	"s\x00\x00\x00\x06200 OK\x00\x00\x00\x07version\x00\x00\x00\x08HT" +
+	"TP/1.1\x00\x00\x00\x03url\x00\x00\x00\x06public\x00\x00\x00\x0as" +
+	"et-cookie\x00\x00\x00\x0akeep-alive\x00\x00\x00\x06origin1001012" +
+	"0120220520630030230330430530630740240540640740840941041141241341" +
+	"4415416417502504505203 Non-Authoritative Information204 No Conte" +
+	"nt301 Moved Permanently400 Bad Request401 Unauthorized403 Forbid" +
+	"den404 Not Found500 Internal Server Error501 Not Implemented503 " +
+	"Service UnavailableJan Feb Mar Apr May Jun Jul Aug Sept Oct Nov " +
+	"Dec 00:00:00 Mon, Tue, Wed, Thu, Fri, Sat, Sun, GMTchunked,text/" +
+	"html,image/png,image/jpg,image/gif,application/xml,application/x" +
+	"html+xml,text/plain,text/javascript,publicprivatemax-age=gzip,de" +
+	"flate,sdchcharset=utf-8charset=iso-8859-1,utf-,*,enq=0."
+
+// spdyFrame is a SPDY frame.
+type spdyFrame struct {
+	// control is true for control frames, and false for data frames.
+	control bool
+
+	// typ is the type of control frames.
+	typ uint16
+
+	// streamID is the stream of data frames, and 0 for control frames,
+	// whose stream, if any, is in data.
+	streamID uint32
+
+	flags uint8
+	data  []byte
+}
+
+// readFrame reads a frame from r.
+func readFrame(r io.Reader) (spdyFrame, error) {
+	var hdr [frameHeaderSize]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return spdyFrame{}, err
+	}
+	var f spdyFrame
+	first := binary.BigEndian.Uint32(hdr[0:4])
+	if first&(1<<31) != 0 {
+		f.control = true
+		if version := (first >> 16) & 0x7fff; version != spdyVersion {
+			return spdyFrame{}, fmt.Errorf("unsupported SPDY version %d", version)
+		}
+		f.typ = uint16(first)
+	} else {
+		f.streamID = first
+	}
+	f.flags = hdr[4]
+	length := binary.BigEndian.Uint32(hdr[4:8]) & maxFrameSize
+	f.data = make([]byte, length)
+	if _, err := io.ReadFull(r, f.data); err != nil {
+		return spdyFrame{}, err
+	}
+	return f, nil
+}
+
+// appendFrame appends the wire format of f to b.
+func appendFrame(b []byte, f spdyFrame) []byte {
+	var hdr [frameHeaderSize]byte
+	if f.control {
+		binary.BigEndian.PutUint32(hdr[0:4], 1<<31|spdyVersion<<16|uint32(f.typ))
+	} else {
+		binary.BigEndian.PutUint32(hdr[0:4], f.streamID)
+	}
+	binary.BigEndian.PutUint32(hdr[4:8], uint32(len(f.data)))
+	hdr[4] = f.flags
+	return append(append(b, hdr[:]...), f.data...)
+}
+
+// headerCompressor compresses the header blocks sent on a connection, which
+// share a zlib stream.
+type headerCompressor struct {
+	buf bytes.Buffer
+	w   *zlib.Writer
+}
+
+// compress returns the compressed header block of h. Header names are sent
+// in lower case, and multiple values are separated by NUL bytes.
+func (c *headerCompressor) compress(h http.Header) ([]byte, error) {
+	if c.w == nil {
+		w, err := zlib.NewWriterLevelDict(&c.buf, zlib.DefaultCompression, []byte(spdyDictionary))
+		if err != nil {
+			return nil, err
+		}
+		c.w = w
+	}
+	var block []byte
+	block = appendUint32(block, uint32(len(h)))
+	for name, values := range h {
+		block = appendString(block, strings.ToLower(name))
+		block = appendString(block, strings.Join(values, "\x00"))
+	}
+	c.buf.Reset()
+	if _, err := c.w.Write(block); err != nil {
+		return nil, err
+	}
+	if err := c.w.Flush(); err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), c.buf.Bytes()...), nil
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+func appendString(b []byte, s string) []byte {
+	return append(appendUint32(b, uint32(len(s))), s...)
+}
+
+// headerDecompressor decompresses the header blocks received on a connection,
+// which share a zlib stream.
+type headerDecompressor struct {
+	// buf holds the compressed data that wasn't consumed yet. It is a
+	// ByteReader, so that the decompressor doesn't read ahead of it.
+	buf bytes.Buffer
+	r   io.ReadCloser
+
+	// remaining is the number of bytes that can still be decompressed
+	// for the current header block.
+	remaining int
+}
+
+const (
+	// maxHeaderSize bounds the size of the names and values in header
+	// blocks.
+	maxHeaderSize = 64 << 10
+
+	// maxHeaderBlockSize bounds the decompressed size of header blocks.
+	maxHeaderBlockSize = 256 << 10
+)
+
+// decompress returns the headers of the compressed header block b.
+func (d *headerDecompressor) decompress(b []byte) (http.Header, error) {
+	d.buf.Write(b)
+	if d.r == nil {
+		r, err := zlib.NewReaderDict(&d.buf, []byte(spdyDictionary))
+		if err != nil {
+			return nil, err
+		}
+		d.r = r
+	}
+	d.remaining = maxHeaderBlockSize
+	n, err := d.readUint32()
+	if err != nil {
+		return nil, err
+	}
+	h := make(http.Header)
+	for i := uint32(0); i < n; i++ {
+		name, err := d.readString()
+		if err != nil {
+			return nil, err
+		}
+		value, err := d.readString()
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range strings.Split(value, "\x00") {
+			h.Add(name, v)
+		}
+	}
+	return h, nil
+}
+
+// read fills b, within the remaining size of the header block.
+func (d *headerDecompressor) read(b []byte) error {
+	if len(b) > d.remaining {
+		return fmt.Errorf("header block exceeds %d bytes", maxHeaderBlockSize)
+	}
+	d.remaining -= len(b)
+	_, err := io.ReadFull(d.r, b)
+	return err
+}
+
+func (d *headerDecompressor) readUint32() (uint32, error) {
+	var buf [4]byte
+	if err := d.read(buf[:]); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(buf[:]), nil
+}
+
+func (d *headerDecompressor) readString() (string, error) {
+	n, err := d.readUint32()
+	if err != nil {
+		return "", err
+	}
+	if n > maxHeaderSize || int(n) > d.remaining {
+		return "", fmt.Errorf("header of %d bytes is too large", n)
+	}
+	buf := make([]byte, n)
+	if err := d.read(buf); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+// spdyConn is the server side of a SPDY connection.
+type spdyConn struct {
+	conn net.Conn
+	r    io.Reader
+
+	// newStream is called for each stream created by the client, before
+	// the stream is accepted. If it returns an error, the stream is
+	// refused. The stream can't send frames until the SYN_REPLY is sent.
+	newStream func(*spdyStream) error
+
+	// done is closed once the connection is closed.
+	done chan struct{}
+
+	// wmu serializes writes, and protects compressor.
+	wmu        sync.Mutex
+	compressor headerCompressor
+
+	// mu protects streams.
+	mu      sync.Mutex
+	streams map[uint32]*spdyStream
+}
+
+// upgradeSPDY upgrades the HTTP connection of r to a SPDY connection, after
+// adding the headers in w, and serves it in a new goroutine. newStream is
+// called for each new stream.
+func upgradeSPDY(w http.ResponseWriter, r *http.Request, newStream func(*spdyStream) error) (*spdyConn, error) {
+	if !strings.Contains(strings.ToLower(r.Header.Get("Connection")), "upgrade") || !strings.EqualFold(r.Header.Get("Upgrade"), spdyUpgrade) {
+		http.Error(w, "missing upgrade headers", http.StatusBadRequest)
+		return nil, errors.New("missing upgrade headers")
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "connection can't be upgraded", http.StatusInternalServerError)
+		return nil, errors.New("connection can't be hijacked")
+	}
+	w.Header().Set("Connection", "Upgrade")
+	w.Header().Set("Upgrade", spdyUpgrade)
+	w.WriteHeader(http.StatusSwitchingProtocols)
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		return nil, fmt.Errorf("error hijacking connection: %v", err)
+	}
+	c := &spdyConn{
+		conn:      conn,
+		r:         bufio.NewReader(io.MultiReader(rw.Reader, conn)),
+		newStream: newStream,
+		done:      make(chan struct{}),
+		streams:   make(map[uint32]*spdyStream),
+	}
+	go c.serve()
+	return c, nil
+}
+
+// Close closes the connection and all its streams.
+func (c *spdyConn) Close() error {
+	return c.conn.Close()
+}
+
+// serve reads frames until the connection is closed.
+func (c *spdyConn) serve() {
+	defer func() {
+		c.conn.Close()
+		c.mu.Lock()
+		for _, s := range c.streams {
+			s.closeRemote()
+		}
+		c.streams = nil
+		c.mu.Unlock()
+		close(c.done)
+	}()
+
+	var decompressor headerDecompressor
+	for {
+		f, err := readFrame(c.r)
+		if err != nil {
+			if err != io.EOF {
+				log.Debugf("Error reading SPDY frame: %v", err)
+			}
+			return
+		}
+		if !f.control {
+			c.handleData(f)
+			continue
+		}
+		switch f.typ {
+		case typeSynStream:
+			// Stream ID, associated stream ID, priority and slot.
+			if len(f.data) < 10 {
+				log.Debugf("Invalid SYN_STREAM frame of %d bytes", len(f.data))
+				return
+			}
+			id := binary.BigEndian.Uint32(f.data[0:4]) & 0x7fffffff
+			h, err := decompressor.decompress(f.data[10:])
+			if err != nil {
+				// The header compression state is lost.
+				log.Debugf("Error decompressing headers: %v", err)
+				return
+			}
+			c.handleSynStream(id, f.flags, h)
+		case typeRstStream:
+			if len(f.data) < 8 {
+				return
+			}
+			if s := c.stream(binary.BigEndian.Uint32(f.data[0:4]) & 0x7fffffff); s != nil {
+				s.closeRemote()
+				c.removeStream(s.id)
+			}
+		case typePing:
+			c.writeFrame(f)
+		case typeGoAway:
+			return
+		default:
+			// Flow control and settings are ignored, and
+			// HEADERS frames aren't used.
+		}
+	}
+}
+
+// handleSynStream handles a stream created by the client.
+func (c *spdyConn) handleSynStream(id uint32, flags uint8, h http.Header) {
+	if id == 0 || c.stream(id) != nil {
+		c.reset(id, rstProtocolError)
+		return
+	}
+	s := &spdyStream{
+		conn:     c,
+		id:       id,
+		headers:  h,
+		accepted: make(chan struct{}),
+	}
+	s.cond.L = &s.mu
+	if flags&flagFin != 0 {
+		s.remoteClosed = true
+	}
+	// Streams handed off by newStream may be used right away, so the
+	// frames they send wait for the SYN_REPLY.
+	defer close(s.accepted)
+	if err := c.newStream(s); err != nil {
+		log.Debugf("Refusing stream %d: %v", id, err)
+		c.reset(id, rstRefusedStream)
+		return
+	}
+	c.mu.Lock()
+	c.streams[id] = s
+	c.mu.Unlock()
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	block, err := c.compressor.compress(http.Header{})
+	if err != nil {
+		log.Warningf("Error compressing headers: %v", err)
+		c.conn.Close()
+		return
+	}
+	c.writeFrameLocked(spdyFrame{
+		control: true,
+		typ:     typeSynReply,
+		data:    append(appendUint32(nil, id), block...),
+	})
+}
+
+// handleData handles a data frame.
+func (c *spdyConn) handleData(f spdyFrame) {
+	s := c.stream(f.streamID)
+	if s == nil {
+		c.reset(f.streamID, rstInvalidStream)
+		return
+	}
+	s.receive(f.data, f.flags&flagFin != 0)
+}
+
+func (c *spdyConn) stream(id uint32) *spdyStream {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.streams[id]
+}
+
+func (c *spdyConn) removeStream(id uint32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.streams, id)
+}
+
+// reset sends a RST_STREAM frame for stream id.
+func (c *spdyConn) reset(id uint32, status uint32) error {
+	return c.writeFrame(spdyFrame{
+		control: true,
+		typ:     typeRstStream,
+		data:    appendUint32(appendUint32(nil, id), status),
+	})
+}
+
+// writeFrame sends f.
+func (c *spdyConn) writeFrame(f spdyFrame) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	return c.writeFrameLocked(f)
+}
+
+// writeFrameLocked sends f. Preconditions: c.wmu must be locked.
+func (c *spdyConn) writeFrameLocked(f spdyFrame) error {
+	_, err := c.conn.Write(appendFrame(nil, f))
+	return err
+}
+
+// spdyStream is a stream of a SPDY connection. It implements
+// io.ReadWriteCloser, where Close half-closes the stream.
+type spdyStream struct {
+	conn    *spdyConn
+	id      uint32
+	headers http.Header
+
+	// accepted is closed once the stream is accepted or refused, after
+	// which frames can be sent on it.
+	accepted chan struct{}
+
+	// mu protects the fields below, and cond is signaled when they change.
+	mu   sync.Mutex
+	cond sync.Cond
+
+	// data is the data that was received and not read.
+	data [][]byte
+
+	// buffered is the total size of data.
+	buffered int
+
+	// err is returned by reads instead of io.EOF if the stream was reset
+	// by the server.
+	err error
+
+	// remoteClosed is true once the client half-closed or reset the
+	// stream.
+	remoteClosed bool
+
+	// closed is true once Close was called.
+	closed bool
+}
+
+// receive queues data received on the stream.
+func (s *spdyStream) receive(data []byte, fin bool) {
+	s.mu.Lock()
+	if s.remoteClosed {
+		s.mu.Unlock()
+		return
+	}
+	if s.buffered+len(data) > maxStreamBuffer {
+		s.remoteClosed = true
+		s.closed = true
+		s.data = nil
+		s.buffered = 0
+		err := fmt.Errorf("stream buffers more than %d bytes", maxStreamBuffer)
+		s.err = err
+		s.cond.Broadcast()
+		s.mu.Unlock()
+		log.Debugf("Resetting stream %d: %v", s.id, err)
+		s.conn.removeStream(s.id)
+		s.conn.reset(s.id, rstFlowControl)
+		return
+	}
+	if len(data) > 0 {
+		s.data = append(s.data, data)
+		s.buffered += len(data)
+	}
+	if fin {
+		s.remoteClosed = true
+	}
+	done := s.remoteClosed && s.closed
+	s.cond.Broadcast()
+	s.mu.Unlock()
+	if done {
+		s.conn.removeStream(s.id)
+	}
+}
+
+// closeRemote makes reads return io.EOF once the data received is read.
+func (s *spdyStream) closeRemote() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.remoteClosed = true
+	s.cond.Broadcast()
+}
+
+// Read implements io.Reader.Read.
+func (s *spdyStream) Read(b []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for len(s.data) == 0 {
+		if s.err != nil {
+			return 0, s.err
+		}
+		if s.remoteClosed {
+			return 0, io.EOF
+		}
+		s.cond.Wait()
+	}
+	n := copy(b, s.data[0])
+	s.buffered -= n
+	if s.data[0] = s.data[0][n:]; len(s.data[0]) == 0 {
+		s.data = s.data[1:]
+	}
+	return n, nil
+}
+
+// Write implements io.Writer.Write.
+func (s *spdyStream) Write(b []byte) (int, error) {
+	s.mu.Lock()
+	closed := s.closed
+	s.mu.Unlock()
+	if closed {
+		return 0, errors.New("write on closed stream")
+	}
+	n := 0
+	for n < len(b) {
+		chunk := b[n:]
+		if len(chunk) > maxDataSize {
+			chunk = chunk[:maxDataSize]
+		}
+		if err := s.writeFrame(spdyFrame{streamID: s.id, data: chunk}); err != nil {
+			return n, err
+		}
+		n += len(chunk)
+	}
+	return n, nil
+}
+
+// Close implements io.Closer.Close. It half-closes the stream, so the client
+// can still send data.
+func (s *spdyStream) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	remoteClosed := s.remoteClosed
+	s.mu.Unlock()
+	if remoteClosed {
+		s.conn.removeStream(s.id)
+	}
+	return s.writeFrame(spdyFrame{streamID: s.id, flags: flagFin})
+}
+
+// Reset aborts the stream in both directions.
+func (s *spdyStream) Reset() error {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	s.closeRemote()
+	s.conn.removeStream(s.id)
+	<-s.accepted
+	return s.conn.reset(s.id, rstCancel)
+}
+
+// writeFrame sends f once the stream is accepted.
+func (s *spdyStream) writeFrame(f spdyFrame) error {
+	<-s.accepted
+	return s.conn.writeFrame(f)
+}
@@ -0,0 +1,198 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package streaming
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFrameRoundTrip(t *testing.T) {
+	for _, f := range []spdyFrame{
+		{control: true, typ: typeSynReply, data: []byte{0, 0, 0, 1}},
+		{control: true, typ: typePing, flags: flagFin, data: []byte{}},
+		{streamID: 3, data: []byte("hello")},
+		{streamID: 5, flags: flagFin, data: []byte{}},
+		{streamID: 7, data: bytes.Repeat([]byte{'x'}, maxDataSize)},
+	} {
+		b := appendFrame(nil, f)
+		got, err := readFrame(bytes.NewReader(b))
+		if err != nil {
+			t.Fatalf("readFrame(%+v) failed: %v", f, err)
+		}
+		if !reflect.DeepEqual(got, f) {
+			t.Errorf("readFrame(appendFrame(%+v)) = %+v", f, got)
+		}
+	}
+}
+
+func TestReadFrameVersion(t *testing.T) {
+	b := appendFrame(nil, spdyFrame{control: true, typ: typePing, data: []byte{0, 0, 0, 1}})
+	b[1] = 2
+	if _, err := readFrame(bytes.NewReader(b)); err == nil {
+		t.Errorf("readFrame succeeded for a SPDY/2 frame")
+	}
+}
+
+func TestHeaderCompression(t *testing.T) {
+	var c headerCompressor
+	var d headerDecompressor
+	// The blocks share the compression state, so they must be
+	// decompressed in order.
+	for _, h := range []http.Header{
+		{"Streamtype": {"stdout"}},
+		{"Streamtype": {"stdout"}},
+		{"Port": {"80"}, "Requestid": {"0"}, "Streamtype": {"data"}},
+		{},
+		{"X-Multi": {"a", "b"}},
+	} {
+		b, err := c.compress(h)
+		if err != nil {
+			t.Fatalf("compress(%v) failed: %v", h, err)
+		}
+		got, err := d.decompress(b)
+		if err != nil {
+			t.Fatalf("decompress(compress(%v)) failed: %v", h, err)
+		}
+		if !reflect.DeepEqual(got, h) {
+			t.Errorf("decompress(compress(%v)) = %v", h, got)
+		}
+	}
+}
+
+func TestHeaderNamesLowerCase(t *testing.T) {
+	var c headerCompressor
+	b, err := c.compress(http.Header{"Streamtype": {"error"}})
+	if err != nil {
+		t.Fatalf("compress failed: %v", err)
+	}
+	r, err := zlib.NewReaderDict(bytes.NewReader(b), []byte(spdyDictionary))
+	if err != nil {
+		t.Fatalf("error creating zlib reader: %v", err)
+	}
+	// A count of 1, followed by the length and the name.
+	want := []byte("\x00\x00\x00\x01\x00\x00\x00\x0astreamtype")
+	got := make([]byte, len(want))
+	if _, err := io.ReadFull(r, got); err != nil {
+		t.Fatalf("error reading header block: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("header block starts with %q, want %q", got, want)
+	}
+}
+
+func TestHeaderBlockSize(t *testing.T) {
+	var c headerCompressor
+	var d headerDecompressor
+	h := make(http.Header)
+	value := strings.Repeat("x", maxHeaderSize)
+	for i := 0; i*maxHeaderSize <= maxHeaderBlockSize; i++ {
+		h.Set(fmt.Sprintf("X-Header-%d", i), value)
+	}
+	b, err := c.compress(h)
+	if err != nil {
+		t.Fatalf("compress failed: %v", err)
+	}
+	if _, err := d.decompress(b); err == nil {
+		t.Errorf("decompress succeeded for a header block larger than %d bytes", maxHeaderBlockSize)
+	}
+}
+
+// newTestConn returns a SPDY connection whose frames are read from the
+// returned connection.
+func newTestConn(newStream func(*spdyStream) error) (*spdyConn, net.Conn) {
+	client, server := net.Pipe()
+	return &spdyConn{
+		conn:      server,
+		newStream: newStream,
+		done:      make(chan struct{}),
+		streams:   make(map[uint32]*spdyStream),
+	}, client
+}
+
+func TestSynReplyFirst(t *testing.T) {
+	c, client := newTestConn(func(s *spdyStream) error {
+		// The stream is used before newStream returns.
+		go s.Write([]byte("hello"))
+		return nil
+	})
+	defer client.Close()
+	go c.handleSynStream(1, 0, http.Header{})
+
+	f, err := readFrame(client)
+	if err != nil {
+		t.Fatalf("readFrame failed: %v", err)
+	}
+	if !f.control || f.typ != typeSynReply {
+		t.Fatalf("got frame %+v, want SYN_REPLY", f)
+	}
+	f, err = readFrame(client)
+	if err != nil {
+		t.Fatalf("readFrame failed: %v", err)
+	}
+	if f.control || f.streamID != 1 || string(f.data) != "hello" {
+		t.Errorf("got frame %+v, want data of stream 1", f)
+	}
+}
+
+func TestStreamBufferLimit(t *testing.T) {
+	streams := make(chan *spdyStream, 1)
+	c, client := newTestConn(func(s *spdyStream) error {
+		streams <- s
+		return nil
+	})
+	defer client.Close()
+	frames := make(chan spdyFrame)
+	go func() {
+		for {
+			f, err := readFrame(client)
+			if err != nil {
+				close(frames)
+				return
+			}
+			frames <- f
+		}
+	}()
+	c.handleSynStream(1, 0, http.Header{})
+	s := <-streams
+	if f := <-frames; !f.control || f.typ != typeSynReply {
+		t.Fatalf("got frame %+v, want SYN_REPLY", f)
+	}
+
+	// The stream is reset once more data is buffered than allowed.
+	c.handleData(spdyFrame{streamID: 1, data: make([]byte, maxStreamBuffer)})
+	go c.handleData(spdyFrame{streamID: 1, data: []byte{0}})
+	f := <-frames
+	if !f.control || f.typ != typeRstStream || len(f.data) != 8 {
+		t.Fatalf("got frame %+v, want RST_STREAM", f)
+	}
+	if status := binary.BigEndian.Uint32(f.data[4:8]); status != rstFlowControl {
+		t.Errorf("got RST_STREAM status %d, want %d", status, rstFlowControl)
+	}
+	if c.stream(1) != nil {
+		t.Errorf("stream 1 wasn't removed")
+	}
+	if _, err := s.Read(make([]byte, 1)); err == nil || err == io.EOF {
+		t.Errorf("Read returned %v, want an error", err)
+	}
+}
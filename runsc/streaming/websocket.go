@@ -0,0 +1,268 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package streaming
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/websocket"
+	"gvisor.googlesource.com/gvisor/pkg/log"
+)
+
+// Over WebSocket, the streams of a request are multiplexed on channels: the
+// first byte of each binary message is the channel that the rest belongs to.
+// The base64 variants of the protocols aren't supported.
+const (
+	// webSocketProtocolV4 reports the exit status of remote commands as a
+	// JSON Status, and webSocketProtocolV1 as text. Both are used for
+	// port-forward.
+	webSocketProtocolV4 = "v4.channel.k8s.io"
+	webSocketProtocolV1 = "channel.k8s.io"
+
+	// Channels of the remote command protocol.
+	channelStdin  = 0
+	channelStdout = 1
+	channelStderr = 2
+	channelError  = 3
+	channelResize = 4
+)
+
+// isWebSocketRequest returns true if r requests a WebSocket connection.
+func isWebSocketRequest(r *http.Request) bool {
+	return strings.Contains(strings.ToLower(r.Header.Get("Connection")), "upgrade") && strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
+
+// serveWebSocket upgrades r to a WebSocket connection, negotiating one of the
+// supported protocols, and calls handler with it.
+func serveWebSocket(w http.ResponseWriter, r *http.Request, supported []string, handler func(ws *websocket.Conn, protocol string)) {
+	websocket.Server{
+		Handshake: func(config *websocket.Config, r *http.Request) error {
+			if len(config.Protocol) == 0 {
+				return nil
+			}
+			for _, p := range supported {
+				for _, c := range config.Protocol {
+					if p == c {
+						config.Protocol = []string{p}
+						return nil
+					}
+				}
+			}
+			return fmt.Errorf("unable to negotiate protocol: client supports %v, server supports %v", config.Protocol, supported)
+		},
+		Handler: func(ws *websocket.Conn) {
+			protocol := ""
+			if p := ws.Config().Protocol; len(p) == 1 {
+				protocol = p[0]
+			}
+			handler(ws, protocol)
+		},
+	}.ServeHTTP(w, r)
+}
+
+// wsChannel writes to a channel of a WebSocket connection. Channels can't be
+// half-closed, so Close does nothing.
+type wsChannel struct {
+	ws *websocket.Conn
+	id byte
+}
+
+// Write implements io.Writer.Write. Each call sends a message.
+func (c *wsChannel) Write(b []byte) (int, error) {
+	msg := make([]byte, len(b)+1)
+	msg[0] = c.id
+	copy(msg[1:], b)
+	if err := websocket.Message.Send(c.ws, msg); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Close implements io.Closer.Close.
+func (c *wsChannel) Close() error {
+	return nil
+}
+
+// readWebSocket copies the messages received on each channel to the writer
+// of the channel in channels, until the connection is closed. It then closes
+// the writers.
+func readWebSocket(ws *websocket.Conn, channels map[byte]*io.PipeWriter) {
+	defer func() {
+		for _, w := range channels {
+			w.Close()
+		}
+	}()
+	for {
+		var msg []byte
+		if err := websocket.Message.Receive(ws, &msg); err != nil {
+			if err != io.EOF {
+				log.Debugf("Error reading WebSocket message: %v", err)
+			}
+			return
+		}
+		if len(msg) == 0 {
+			continue
+		}
+		w, ok := channels[msg[0]]
+		if !ok {
+			log.Debugf("Ignoring message on channel %d", msg[0])
+			continue
+		}
+		if _, err := w.Write(msg[1:]); err != nil {
+			// The reader is gone; drop the rest of the channel.
+			delete(channels, msg[0])
+		}
+	}
+}
+
+// serveWebSocketRemoteCommand establishes the channels of an exec or attach
+// request over WebSocket, and calls run with them.
+func serveWebSocketRemoteCommand(w http.ResponseWriter, r *http.Request, tty, stdin, stdout, stderr bool, run func(*remoteCommand)) {
+	serveWebSocket(w, r, []string{webSocketProtocolV4, webSocketProtocolV1}, func(ws *websocket.Conn, protocol string) {
+		rc := remoteCommand{
+			errorStream: &wsChannel{ws: ws, id: channelError},
+		}
+		// The protocols correspond to the versions of the SPDY
+		// protocol whose status reports they share.
+		if protocol == webSocketProtocolV4 {
+			rc.protocol = remoteCommandV4
+		} else {
+			rc.protocol = remoteCommandV1
+		}
+		channels := make(map[byte]*io.PipeWriter)
+		if stdin {
+			pr, pw := io.Pipe()
+			// Unblock readWebSocket if the command doesn't read
+			// all of stdin.
+			defer pr.Close()
+			rc.stdin = pr
+			channels[channelStdin] = pw
+		}
+		if stdout {
+			rc.stdout = &wsChannel{ws: ws, id: channelStdout}
+		}
+		if stderr {
+			rc.stderr = &wsChannel{ws: ws, id: channelStderr}
+		}
+		done := make(chan struct{})
+		defer close(done)
+		if tty {
+			pr, pw := io.Pipe()
+			channels[channelResize] = pw
+			rc.resize = make(chan TerminalSize)
+			go rc.readResize(pr, done)
+		}
+
+		// Let the client know that the connection is established with
+		// an empty message on the first channel it reads.
+		first := rc.errorStream
+		if rc.stderr != nil {
+			first = rc.stderr
+		}
+		if rc.stdout != nil {
+			first = rc.stdout
+		}
+		if _, err := first.Write(nil); err != nil {
+			log.Debugf("Error writing WebSocket message: %v", err)
+			return
+		}
+
+		go readWebSocket(ws, channels)
+		run(&rc)
+	})
+}
+
+// serveWebSocketPortForward serves a port-forward request over WebSocket.
+// The ports are listed in the port query parameters of the request. Port i
+// of the list uses channel 2i for its data and 2i+1 for its errors, and the
+// first message on each channel is the port, as a little-endian uint16.
+func (s *Server) serveWebSocketPortForward(w http.ResponseWriter, r *http.Request, req *PortForwardRequest) {
+	var ports []uint16
+	for _, v := range r.URL.Query()[portHeader] {
+		for _, p := range strings.Split(v, ",") {
+			port, err := strconv.ParseUint(p, 10, 16)
+			if err != nil || port == 0 {
+				http.Error(w, fmt.Sprintf("invalid port %q", p), http.StatusBadRequest)
+				return
+			}
+			ports = append(ports, uint16(port))
+		}
+	}
+	if len(ports) == 0 {
+		http.Error(w, "no port to forward", http.StatusBadRequest)
+		return
+	}
+	if len(ports) > 127 {
+		http.Error(w, "too many ports", http.StatusBadRequest)
+		return
+	}
+
+	serveWebSocket(w, r, []string{webSocketProtocolV4, webSocketProtocolV1}, func(ws *websocket.Conn, _ string) {
+		channels := make(map[byte]*io.PipeWriter)
+		var streams []*wsPortStream
+		for i, port := range ports {
+			data := &wsChannel{ws: ws, id: byte(2 * i)}
+			errorStream := &wsChannel{ws: ws, id: byte(2*i + 1)}
+			var hdr [2]byte
+			binary.LittleEndian.PutUint16(hdr[:], port)
+			for _, c := range []*wsChannel{data, errorStream} {
+				if _, err := c.Write(hdr[:]); err != nil {
+					log.Debugf("Error writing WebSocket message: %v", err)
+					return
+				}
+			}
+			pr, pw := io.Pipe()
+			channels[data.id] = pw
+			streams = append(streams, &wsPortStream{PipeReader: pr, wsChannel: data, errorStream: errorStream, port: port})
+		}
+
+		var wg sync.WaitGroup
+		for _, st := range streams {
+			wg.Add(1)
+			go func(st *wsPortStream) {
+				defer wg.Done()
+				defer st.PipeReader.Close()
+				if err := s.runtime.PortForward(req.PodSandboxID, int32(st.port), st); err != nil {
+					msg := fmt.Sprintf("error forwarding port %d to pod %s: %v", st.port, req.PodSandboxID, err)
+					log.Infof("%s", msg)
+					st.errorStream.Write([]byte(msg))
+				}
+			}(st)
+		}
+		// Ports are forwarded until the client closes the connection.
+		readWebSocket(ws, channels)
+		ws.Close()
+		wg.Wait()
+	})
+}
+
+// wsPortStream is the stream of a port forwarded over WebSocket.
+type wsPortStream struct {
+	*io.PipeReader
+	*wsChannel
+	errorStream *wsChannel
+	port        uint16
+}
+
+// Close implements io.Closer.Close. Like Close of wsChannel, it does nothing.
+func (s *wsPortStream) Close() error {
+	return s.wsChannel.Close()
+}
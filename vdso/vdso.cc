@@ -37,6 +37,10 @@ extern "C" int __vdso_clock_gettime(clockid_t clock, struct timespec* ts) {
       ret = ClockMonotonic(ts);
       break;
 
+    case CLOCK_TAI:
+      ret = ClockTAI(ts);
+      break;
+
     default:
       ret = sys_clock_gettime(clock, ts);
       break;
@@ -41,6 +41,8 @@ struct params {
   int64_t realtime_base_cycles;
   int64_t realtime_base_ref;
   uint64_t realtime_frequency;
+
+  int64_t tai_offset;
 };
 
 // Returns a pointer to the global parameter page.
@@ -142,4 +144,37 @@ int ClockMonotonic(struct timespec* ts) {
   return 0;
 }
 
+// ClockTAI() is the VDSO implementation of clock_gettime(CLOCK_TAI).
+int ClockTAI(struct timespec* ts) {
+  struct params* params = get_params();
+  uint64_t seq;
+  uint64_t ready;
+  int64_t base_ref;
+  int64_t base_cycles;
+  uint64_t frequency;
+  int64_t tai_offset;
+  int64_t now_cycles;
+
+  do {
+    seq = read_seqcount_begin(&params->seq_count);
+    ready = params->realtime_ready;
+    base_ref = params->realtime_base_ref;
+    base_cycles = params->realtime_base_cycles;
+    frequency = params->realtime_frequency;
+    tai_offset = params->tai_offset;
+    now_cycles = cycle_clock();
+  } while (read_seqcount_retry(&params->seq_count, seq));
+
+  if (!ready) {
+    return sys_clock_gettime(CLOCK_TAI, ts);
+  }
+
+  int64_t delta_cycles =
+      (now_cycles < base_cycles) ? 0 : now_cycles - base_cycles;
+  int64_t now_ns =
+      base_ref + cycles_to_ns(frequency, delta_cycles) + tai_offset;
+  *ts = ns_to_timespec(now_ns);
+  return 0;
+}
+
 }  // namespace vdso
@@ -17,10 +17,16 @@
 
 #include <time.h>
 
+// CLOCK_TAI is missing from older libc headers.
+#ifndef CLOCK_TAI
+#define CLOCK_TAI 11
+#endif
+
 namespace vdso {
 
 int ClockRealtime(struct timespec* ts);
 int ClockMonotonic(struct timespec* ts);
+int ClockTAI(struct timespec* ts);
 
 }  // namespace vdso
 